@@ -8,26 +8,45 @@ import (
 
 	"github.com/rancher/machine/commands"
 	"github.com/rancher/machine/commands/mcndirs"
+	"github.com/rancher/machine/drivers/aliyunecs"
 	"github.com/rancher/machine/drivers/amazonec2"
 	"github.com/rancher/machine/drivers/azure"
 	"github.com/rancher/machine/drivers/digitalocean"
+	"github.com/rancher/machine/drivers/equinixmetal"
 	"github.com/rancher/machine/drivers/exoscale"
 	"github.com/rancher/machine/drivers/generic"
 	"github.com/rancher/machine/drivers/google"
+	"github.com/rancher/machine/drivers/harvester"
+	"github.com/rancher/machine/drivers/hetzner"
 	"github.com/rancher/machine/drivers/hyperv"
+	"github.com/rancher/machine/drivers/ibmcloud"
+	"github.com/rancher/machine/drivers/kvm"
+	"github.com/rancher/machine/drivers/linode"
+	"github.com/rancher/machine/drivers/lxd"
 	"github.com/rancher/machine/drivers/none"
 	"github.com/rancher/machine/drivers/noop"
+	"github.com/rancher/machine/drivers/nutanix"
+	"github.com/rancher/machine/drivers/oci"
 	"github.com/rancher/machine/drivers/openstack"
 	"github.com/rancher/machine/drivers/pod"
+	"github.com/rancher/machine/drivers/proxmox"
+	"github.com/rancher/machine/drivers/qemu"
 	"github.com/rancher/machine/drivers/rackspace"
+	"github.com/rancher/machine/drivers/scaleway"
 	"github.com/rancher/machine/drivers/softlayer"
 	"github.com/rancher/machine/drivers/virtualbox"
 	"github.com/rancher/machine/drivers/vmwarefusion"
 	"github.com/rancher/machine/drivers/vmwarevcloudair"
 	"github.com/rancher/machine/drivers/vmwarevsphere"
+	"github.com/rancher/machine/drivers/vultr"
+	"github.com/rancher/machine/libmachine/drivers"
 	"github.com/rancher/machine/libmachine/drivers/plugin"
 	"github.com/rancher/machine/libmachine/drivers/plugin/localbinary"
+	"github.com/rancher/machine/libmachine/drivers/plugin/sandbox"
+	rpcdriver "github.com/rancher/machine/libmachine/drivers/rpc"
+	"github.com/rancher/machine/libmachine/fips"
 	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/ssh"
 	"github.com/rancher/machine/version"
 	"github.com/urfave/cli"
 )
@@ -86,6 +105,8 @@ func setDebugOutputLevel() {
 }
 
 func main() {
+	sandbox.Init()
+
 	if os.Getenv(localbinary.PluginEnvKey) == localbinary.PluginEnvVal {
 		driverName := os.Getenv(localbinary.PluginEnvDriverName)
 		runDriver(driverName)
@@ -93,6 +114,7 @@ func main() {
 	}
 
 	localbinary.CurrentBinaryIsDockerMachine = true
+	rpcdriver.InProcessDrivers = coreDrivers
 
 	setDebugOutputLevel()
 	cli.AppHelpTemplate = AppHelpTemplate
@@ -123,13 +145,13 @@ func main() {
 		cli.StringFlag{
 			EnvVar: "MACHINE_TLS_CA_CERT",
 			Name:   "tls-ca-cert",
-			Usage:  "CA to verify remotes against",
+			Usage:  "CA to verify remotes against, possibly an intermediate CA followed by its chain",
 			Value:  "",
 		},
 		cli.StringFlag{
 			EnvVar: "MACHINE_TLS_CA_KEY",
 			Name:   "tls-ca-key",
-			Usage:  "Private key to generate certificates",
+			Usage:  "Private key to generate certificates: a key file, encrypted with $MACHINE_CA_KEY_PASSPHRASE if set, or vault:<mount>/<key> or awskms:<key> to sign with Vault or AWS KMS",
 			Value:  "",
 		},
 		cli.StringFlag{
@@ -150,11 +172,45 @@ func main() {
 			Usage:  "Token to use for requests to the Github API",
 			Value:  "",
 		},
+		cli.StringFlag{
+			EnvVar: "MACHINE_LOG_FORMAT",
+			Name:   "log-format",
+			Usage:  "Format of the create progress: text or json",
+			Value:  "text",
+		},
+		cli.StringFlag{
+			EnvVar: "MACHINE_PLUGIN_REGISTRY",
+			Name:   "plugin-registry",
+			Usage:  "URL of the index to install missing driver plugins from",
+			Value:  "",
+		},
+		cli.BoolFlag{
+			EnvVar: "MACHINE_SANDBOX_PLUGINS",
+			Name:   "sandbox-plugins",
+			Usage:  "Run the driver plugins other than the core ones in a sandbox (Linux only)",
+		},
+		cli.StringFlag{
+			EnvVar: "MACHINE_METRICS_ADDR",
+			Name:   "metrics-addr",
+			Usage:  "Address to serve the metrics of the driver plugins on, e.g. 127.0.0.1:9090; not served unless set",
+			Value:  "",
+		},
 		cli.BoolFlag{
 			EnvVar: "MACHINE_NATIVE_SSH",
 			Name:   "native-ssh",
 			Usage:  "Use the native (Go-based) SSH implementation.",
 		},
+		cli.BoolFlag{
+			EnvVar: fips.EnvVar,
+			Name:   "fips",
+			Usage:  "Restrict the crypto to the FIPS-approved algorithms",
+		},
+		cli.IntFlag{
+			EnvVar: "MACHINE_SSH_KEEPALIVE_INTERVAL",
+			Name:   "ssh-keepalive-interval",
+			Usage:  "Interval in seconds of the keepalives sent on the SSH connections, 0 to disable them",
+			Value:  int(ssh.DefaultKeepAliveInterval.Seconds()),
+		},
 		cli.StringFlag{
 			EnvVar: "MACHINE_BUGSNAG_API_TOKEN",
 			Name:   "bugsnag-api-token",
@@ -187,46 +243,48 @@ func main() {
 	}
 }
 
+// coreDrivers creates the drivers compiled into this binary, by name.
+var coreDrivers = map[string]func() drivers.Driver{
+	"aliyunecs":       func() drivers.Driver { return aliyunecs.NewDriver("", "") },
+	"amazonec2":       func() drivers.Driver { return amazonec2.NewDriver("", "") },
+	"azure":           func() drivers.Driver { return azure.NewDriver("", "") },
+	"digitalocean":    func() drivers.Driver { return digitalocean.NewDriver("", "") },
+	"equinixmetal":    func() drivers.Driver { return equinixmetal.NewDriver("", "") },
+	"exoscale":        func() drivers.Driver { return exoscale.NewDriver("", "") },
+	"generic":         func() drivers.Driver { return generic.NewDriver("", "") },
+	"google":          func() drivers.Driver { return google.NewDriver("", "") },
+	"harvester":       func() drivers.Driver { return harvester.NewDriver("", "") },
+	"hetzner":         func() drivers.Driver { return hetzner.NewDriver("", "") },
+	"hyperv":          func() drivers.Driver { return hyperv.NewDriver("", "") },
+	"ibmcloud":        func() drivers.Driver { return ibmcloud.NewDriver("", "") },
+	"kvm":             func() drivers.Driver { return kvm.NewDriver("", "") },
+	"linode":          func() drivers.Driver { return linode.NewDriver("", "") },
+	"lxd":             func() drivers.Driver { return lxd.NewDriver("", "") },
+	"none":            func() drivers.Driver { return none.NewDriver("", "") },
+	"nutanix":         func() drivers.Driver { return nutanix.NewDriver("", "") },
+	"oci":             func() drivers.Driver { return oci.NewDriver("", "") },
+	"openstack":       func() drivers.Driver { return openstack.NewDriver("", "") },
+	"proxmox":         func() drivers.Driver { return proxmox.NewDriver("", "") },
+	"qemu":            func() drivers.Driver { return qemu.NewDriver("", "") },
+	"rackspace":       func() drivers.Driver { return rackspace.NewDriver("", "") },
+	"scaleway":        func() drivers.Driver { return scaleway.NewDriver("", "") },
+	"softlayer":       func() drivers.Driver { return softlayer.NewDriver("", "") },
+	"virtualbox":      func() drivers.Driver { return virtualbox.NewDriver("", "") },
+	"vmwarefusion":    func() drivers.Driver { return vmwarefusion.NewDriver("", "") },
+	"vmwarevcloudair": func() drivers.Driver { return vmwarevcloudair.NewDriver("", "") },
+	"vmwarevsphere":   func() drivers.Driver { return vmwarevsphere.NewDriver("", "") },
+	"vultr":           func() drivers.Driver { return vultr.NewDriver("", "") },
+	"pod":             func() drivers.Driver { return pod.NewDriver("", "") },
+	"noop":            func() drivers.Driver { return noop.NewDriver("", "") },
+}
+
 func runDriver(driverName string) {
-	switch driverName {
-	case "amazonec2":
-		plugin.RegisterDriver(amazonec2.NewDriver("", ""))
-	case "azure":
-		plugin.RegisterDriver(azure.NewDriver("", ""))
-	case "digitalocean":
-		plugin.RegisterDriver(digitalocean.NewDriver("", ""))
-	case "exoscale":
-		plugin.RegisterDriver(exoscale.NewDriver("", ""))
-	case "generic":
-		plugin.RegisterDriver(generic.NewDriver("", ""))
-	case "google":
-		plugin.RegisterDriver(google.NewDriver("", ""))
-	case "hyperv":
-		plugin.RegisterDriver(hyperv.NewDriver("", ""))
-	case "none":
-		plugin.RegisterDriver(none.NewDriver("", ""))
-	case "openstack":
-		plugin.RegisterDriver(openstack.NewDriver("", ""))
-	case "rackspace":
-		plugin.RegisterDriver(rackspace.NewDriver("", ""))
-	case "softlayer":
-		plugin.RegisterDriver(softlayer.NewDriver("", ""))
-	case "virtualbox":
-		plugin.RegisterDriver(virtualbox.NewDriver("", ""))
-	case "vmwarefusion":
-		plugin.RegisterDriver(vmwarefusion.NewDriver("", ""))
-	case "vmwarevcloudair":
-		plugin.RegisterDriver(vmwarevcloudair.NewDriver("", ""))
-	case "vmwarevsphere":
-		plugin.RegisterDriver(vmwarevsphere.NewDriver("", ""))
-	case "pod":
-		plugin.RegisterDriver(pod.NewDriver("", ""))
-	case "noop":
-		plugin.RegisterDriver(noop.NewDriver("", ""))
-	default:
+	newDriver, ok := coreDrivers[driverName]
+	if !ok {
 		fmt.Fprintf(os.Stderr, "Unsupported driver: %s\n", driverName)
 		os.Exit(1)
 	}
+	plugin.RegisterDriverFactory(newDriver)
 }
 
 func cmdNotFound(c *cli.Context, command string) {
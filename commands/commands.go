@@ -5,18 +5,25 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/rancher/machine/commands/mcndirs"
 	"github.com/rancher/machine/libmachine"
 	"github.com/rancher/machine/libmachine/crashreport"
 	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/drivers/plugin/localbinary"
+	"github.com/rancher/machine/libmachine/drivers/plugin/sandbox"
+	"github.com/rancher/machine/libmachine/fips"
 	"github.com/rancher/machine/libmachine/host"
 	"github.com/rancher/machine/libmachine/log"
 	"github.com/rancher/machine/libmachine/mcnerror"
 	"github.com/rancher/machine/libmachine/mcnutils"
+	"github.com/rancher/machine/libmachine/metrics"
 	"github.com/rancher/machine/libmachine/persist"
+	"github.com/rancher/machine/libmachine/progress"
 	"github.com/rancher/machine/libmachine/ssh"
 	"github.com/urfave/cli"
 )
@@ -31,6 +38,7 @@ var (
 	ErrNoMachineSpecified = errors.New("Error: Expected to get one or more machine names as arguments")
 	ErrExpectedOneMachine = errors.New("Error: Expected one machine name as an argument")
 	ErrTooManyArguments   = errors.New("Error: Too many arguments given")
+	ErrInvalidLogFormat   = errors.New("Error: --log-format must be one of \"text\" or \"json\"")
 
 	osExit = func(code int) { os.Exit(code) }
 
@@ -165,6 +173,17 @@ func runCommand(command func(commandLine CommandLine, api libmachine.API) error)
 		}
 		api.GithubAPIToken = context.GlobalString("github-api-token")
 
+		switch context.GlobalString("log-format") {
+		case "", "text":
+			api.Progress = progress.LogBanner
+		case "json":
+			api.Progress = progress.LogJSON
+		default:
+			log.Error(ErrInvalidLogFormat)
+			osExit(1)
+			return
+		}
+
 		// TODO (nathanleclaire): These should ultimately be accessed
 		// through the libmachine client by the rest of the code and
 		// not through their respective modules.  For now, however,
@@ -173,6 +192,32 @@ func runCommand(command func(commandLine CommandLine, api libmachine.API) error)
 		mcndirs.BaseDir = context.GlobalString("storage-path")
 		mcnutils.GithubAPIToken = api.GithubAPIToken
 		ssh.SetDefaultClient(api.SSHClientType)
+		ssh.SetKeepAliveInterval(time.Duration(context.GlobalInt("ssh-keepalive-interval")) * time.Second)
+		if context.GlobalBool("fips") {
+			fips.Enable()
+		}
+
+		localbinary.PluginsDir = mcndirs.GetPluginsDir()
+		if registry := context.GlobalString("plugin-registry"); registry != "" {
+			localbinary.PluginRegistry = localbinary.NewRegistry(registry, mcndirs.GetPluginsDir())
+		}
+
+		if context.GlobalBool("sandbox-plugins") {
+			localbinary.PluginSandbox = &sandbox.Options{
+				WritablePaths: []string{mcndirs.GetBaseDir()},
+				TempDir:       filepath.Join(mcndirs.GetBaseDir(), "tmp"),
+			}
+		}
+
+		if addr := context.GlobalString("metrics-addr"); addr != "" {
+			listener, err := metrics.ListenAndServe(addr)
+			if err != nil {
+				log.Error(err)
+				osExit(1)
+				return
+			}
+			defer listener.Close()
+		}
 
 		secretName, secretNamespace := context.GlobalString("secret-name"), context.GlobalString("secret-namespace")
 		if secretName != "" {
@@ -188,6 +233,9 @@ func runCommand(command func(commandLine CommandLine, api libmachine.API) error)
 
 		if err := command(&contextCommandLine{context}, api); err != nil {
 			log.Error(err)
+			if code := drivers.GetErrorCode(err); code != "" {
+				log.Errorf("Error code: %s", code)
+			}
 
 			if crashErr, ok := err.(crashreport.CrashError); ok {
 				crashReporter := crashreport.NewCrashReporter(mcndirs.GetBaseDir(), context.GlobalString("bugsnag-api-token"))
@@ -246,6 +294,33 @@ var Commands = []cli.Command{
 			},
 		},
 	},
+	{
+		Name:        "config-engine",
+		Usage:       "Change the engine options of a machine",
+		Description: "Argument is a machine name. The options given replace the ones of the machine.",
+		Action:      runCommand(cmdConfigEngine),
+		Flags: []cli.Flag{
+			cli.StringSliceFlag{
+				Name:  "engine-registry-mirror",
+				Usage: "Registry mirrors of the engine",
+				Value: &cli.StringSlice{},
+			},
+			cli.StringSliceFlag{
+				Name:  "engine-insecure-registry",
+				Usage: "Insecure registries of the engine",
+				Value: &cli.StringSlice{},
+			},
+			cli.StringSliceFlag{
+				Name:  "engine-label",
+				Usage: "Labels of the engine",
+				Value: &cli.StringSlice{},
+			},
+			cli.StringFlag{
+				Name:  "engine-log-driver",
+				Usage: "Default log driver of the containers",
+			},
+		},
+	},
 	{
 		Flags:       SharedCreateFlags,
 		Name:        "create",
@@ -257,6 +332,55 @@ var Commands = []cli.Command{
 		}, cmdCreate)),
 		SkipFlagParsing: true,
 	},
+	{
+		Name:  "plugin",
+		Usage: "Manage driver plugins",
+		Subcommands: []cli.Command{
+			{
+				Name:   "ls",
+				Usage:  "List the installed driver plugins with their version and flags",
+				Action: runCommand(cmdPluginLs),
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "output, o",
+						Usage: "Output format: [text, json]",
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:  "driver",
+		Usage: "Describe a driver",
+		Subcommands: []cli.Command{
+			{
+				Name:   "inspect",
+				Usage:  "Inspect the capabilities and architectures of a driver",
+				Action: runCommand(cmdDriverInspect),
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "format, f",
+						Usage: "Format the output using the given go template.",
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:   "drivers",
+		Usage:  "List available drivers with their capabilities",
+		Action: runCommand(cmdDrivers),
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "driver, d",
+				Usage: "Only describe the named driver",
+			},
+			cli.StringFlag{
+				Name:  "output, o",
+				Usage: "Output format: [text, json]",
+			},
+		},
+	},
 	{
 		Name:        "env",
 		Usage:       "Display the commands to set up the environment for the Docker client",
@@ -279,6 +403,10 @@ var Commands = []cli.Command{
 				Name:  "no-proxy",
 				Usage: "Add machine IP to NO_PROXY environment variable",
 			},
+			cli.BoolFlag{
+				Name:  "proxy",
+				Usage: "Set the proxy environment variables to the proxy of the machine engine, with the machine IP added to NO_PROXY",
+			},
 		},
 	},
 	{
@@ -299,6 +427,24 @@ var Commands = []cli.Command{
 		Usage:       "Get the IP address of a machine",
 		Description: "Argument(s) are one or more machine names.",
 		Action:      runCommand(cmdIP),
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "all, a",
+				Usage: "Print every known address, labeled by kind (public, private, ipv6)",
+			},
+			cli.BoolFlag{
+				Name:  "public",
+				Usage: "Print only public addresses",
+			},
+			cli.BoolFlag{
+				Name:  "private",
+				Usage: "Print only private addresses",
+			},
+			cli.StringFlag{
+				Name:  "output, o",
+				Usage: "Output format: [text, json]",
+			},
+		},
 	},
 	{
 		Name:            "kill",
@@ -334,10 +480,16 @@ var Commands = []cli.Command{
 		},
 	},
 	{
-		Name:            "provision",
-		Usage:           "Re-provision existing machines",
-		Action:          runCommand(withDriverFlags("provision", true, &updateConfigGenericFlag, cmdProvision)),
-		Flags:           []cli.Flag{updateConfigBoolFlag},
+		Name:   "provision",
+		Usage:  "Re-provision existing machines",
+		Action: runCommand(withDriverFlags("provision", true, &updateConfigGenericFlag, cmdProvision)),
+		Flags: []cli.Flag{
+			updateConfigBoolFlag,
+			cli.BoolFlag{
+				Name:  "resume",
+				Usage: "Resume the provisioning of machines whose creation failed from their last checkpoint",
+			},
+		},
 		SkipFlagParsing: true,
 	},
 	{
@@ -356,6 +508,26 @@ var Commands = []cli.Command{
 			},
 		},
 	},
+	{
+		Name:        "resize",
+		Usage:       "Change the size of a machine",
+		Description: "Argument is a machine name.",
+		Action:      runCommand(cmdResize),
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "instance-type",
+				Usage: "Instance type, or machine type or VM size, of the clouds to resize the machine to",
+			},
+			cli.IntFlag{
+				Name:  "cpus",
+				Usage: "Number of CPUs to resize the machine to",
+			},
+			cli.IntFlag{
+				Name:  "memory",
+				Usage: "Size of memory in MB to resize the machine to",
+			},
+		},
+	},
 	{
 		Name:        "restart",
 		Usage:       "Restart a machine",
@@ -380,17 +552,71 @@ var Commands = []cli.Command{
 		Action:          runCommand(withDriverFlags("rm", true, &updateConfigGenericFlag, cmdRm)),
 		SkipFlagParsing: true,
 	},
+	{
+		Name:        "rotate-certs",
+		Usage:       "Rotate the TLS certificates of machines, restarting their engine once",
+		Description: "Argument(s) are one or more machine names.",
+		Action:      runCommand(cmdRotateCerts),
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "only-client",
+				Usage: "Rotate the client certificate only, without restarting the engines",
+			},
+			cli.StringFlag{
+				Name:  "ca",
+				Usage: "Rotate the CA too: \"start\" to trust the new CA along with the current one, \"finish\" to sign with the new CA once every machine is started, \"end\" to stop trusting the previous CA once every machine is finished",
+			},
+			cli.StringSliceFlag{
+				Name:  "tls-san",
+				Usage: "Extra SANs of the server certificates, replacing the ones of the machines: DNS names or IP addresses",
+				Value: &cli.StringSlice{},
+			},
+			cli.IntFlag{
+				Name:  "tls-cert-validity",
+				Usage: "Validity of the server certificates, in days, replacing the one of the machines",
+			},
+			cli.StringSliceFlag{
+				Name:  "tls-key-usage",
+				Usage: "Key usages of the server certificates, replacing the ones of the machines",
+				Value: &cli.StringSlice{},
+			},
+		},
+	},
+	{
+		Name:  "snapshot",
+		Usage: "Snapshot a machine and restore it",
+		Subcommands: []cli.Command{
+			{
+				Name:        "create",
+				Usage:       "Snapshot the disks of a machine",
+				Description: "Arguments are a machine name and a snapshot name.",
+				Action:      runCommand(cmdSnapshotCreate),
+			},
+			{
+				Name:        "ls",
+				Usage:       "List the snapshots of a machine",
+				Description: "Argument is a machine name.",
+				Action:      runCommand(cmdSnapshotLs),
+			},
+			{
+				Name:        "restore",
+				Usage:       "Restore the disks of a machine from a snapshot",
+				Description: "Arguments are a machine name and a snapshot ID.",
+				Action:      runCommand(cmdSnapshotRestore),
+			},
+		},
+	},
 	{
 		Name:            "ssh",
 		Usage:           "Log into or run a command on a machine with SSH.",
-		Description:     "Arguments are [machine-name] [command]",
+		Description:     "Arguments are [-A] [-L|-R forwarding]... [--refresh-hostkey] [machine-name] [command]. -A forwards the ssh-agent to the machine. -L and -R forward a local port to the machine and a port of the machine to the local host, like ssh does, with a forwarding of [bind_address:]port:host:hostport. --refresh-hostkey replaces the recorded SSH host key of the machine, once it was recreated.",
 		Action:          runCommand(cmdSSH),
 		SkipFlagParsing: true,
 	},
 	{
 		Name:        "scp",
 		Usage:       "Copy files between machines",
-		Description: "Arguments are [[user@]machine:][path] [[user@]machine:][path].",
+		Description: "Arguments are [[user@]machine:][path] [[user@]machine:][path]. A file is copied between the local host and a machine with its SSH client, the other copies with scp, or rsync with --delta.",
 		Action:      runCommand(cmdScp),
 		Flags: []cli.Flag{
 			cli.BoolFlag{
@@ -453,6 +679,17 @@ var Commands = []cli.Command{
 		Flags:           []cli.Flag{updateConfigBoolFlag},
 		SkipFlagParsing: true,
 	},
+	{
+		Flags:       SharedCreateFlags,
+		Name:        "validate",
+		Usage:       "Validate the configuration of a machine without creating it",
+		Description: fmt.Sprintf("Run '%s validate --driver name --help' to include the create flags for that driver in the help text.", os.Args[0]),
+		Action: runCommand(withDriverFlags("validate", false, &cli.GenericFlag{
+			Name:   "driver, d",
+			EnvVar: "MACHINE_DRIVER",
+		}, cmdValidate)),
+		SkipFlagParsing: true,
+	},
 	{
 		Name:   "version",
 		Usage:  "Show the Docker Machine version or a machine docker version",
@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rancher/machine/libmachine"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/provision"
+)
+
+var errExpectedEngineConfig = errors.New("Error: Expected --engine-registry-mirror, --engine-insecure-registry, --engine-label or --engine-log-driver")
+
+func cmdConfigEngine(c CommandLine, api libmachine.API) error {
+	if len(c.Args()) != 1 {
+		c.ShowHelp()
+		return ErrExpectedOneMachine
+	}
+
+	registryMirrors := c.StringSlice("engine-registry-mirror")
+	insecureRegistries := c.StringSlice("engine-insecure-registry")
+	labels := c.StringSlice("engine-label")
+	logDriver := c.String("engine-log-driver")
+	if len(registryMirrors) == 0 && len(insecureRegistries) == 0 && len(labels) == 0 && logDriver == "" {
+		c.ShowHelp()
+		return errExpectedEngineConfig
+	}
+
+	h, err := api.Load(c.Args().First())
+	if err != nil {
+		return err
+	}
+	if h.HostOptions.EngineOptions == nil {
+		return fmt.Errorf("Docker was not provisioned on machine %s, cannot configure the engine", h.Name)
+	}
+
+	// The options given replace the ones of the machine.
+	engineOptions := *h.HostOptions.EngineOptions
+	if len(registryMirrors) > 0 {
+		engineOptions.RegistryMirror = registryMirrors
+	}
+	if len(insecureRegistries) > 0 {
+		engineOptions.InsecureRegistry = insecureRegistries
+	}
+	if len(labels) > 0 {
+		engineOptions.Labels = labels
+	}
+	if logDriver != "" {
+		if h.HostOptions.MachineOS == provision.WindowsMachineOS {
+			return errors.New("--engine-log-driver cannot be used with Windows machines")
+		}
+		engineOptions.ArbitraryFlags = setEngineFlag(engineOptions.ArbitraryFlags, "log-driver", logDriver)
+	}
+
+	log.Infof("Configuring the engine of %q...", h.Name)
+	if err := h.ConfigureEngine(engineOptions); err != nil {
+		return fmt.Errorf("Error configuring the engine of %q: %w", h.Name, err)
+	}
+
+	return api.Save(h)
+}
+
+// setEngineFlag returns the arbitrary engine flags with the flag of the name
+// set to value, replacing the values it had.
+func setEngineFlag(flags []string, name, value string) []string {
+	updated := []string{}
+	for _, flag := range flags {
+		if flag != name && !strings.HasPrefix(flag, name+"=") {
+			updated = append(updated, flag)
+		}
+	}
+	return append(updated, name+"="+value)
+}
@@ -0,0 +1,35 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/rancher/machine/commands/commandstest"
+	"github.com/rancher/machine/drivers/fakedriver"
+	"github.com/rancher/machine/libmachine/host"
+	"github.com/rancher/machine/libmachine/libmachinetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCmdConfigEngineErrors(t *testing.T) {
+	api := &libmachinetest.FakeAPI{
+		Hosts: []*host.Host{{Name: "k3s", Driver: &fakedriver.Driver{}, HostOptions: &host.Options{ProvisionEngine: host.ProvisionEngineK3s}}},
+	}
+
+	err := cmdConfigEngine(&commandstest.FakeCommandLine{
+		CliArgs:    []string{"k3s"},
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{}},
+	}, api)
+	assert.Equal(t, errExpectedEngineConfig, err)
+
+	err = cmdConfigEngine(&commandstest.FakeCommandLine{
+		CliArgs:    []string{"k3s"},
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{"engine-log-driver": "journald"}},
+	}, api)
+	assert.EqualError(t, err, "Docker was not provisioned on machine k3s, cannot configure the engine")
+}
+
+func TestSetEngineFlag(t *testing.T) {
+	flags := setEngineFlag([]string{"log-driver=json-file", "log-opt=max-size=10m", "debug"}, "log-driver", "journald")
+
+	assert.Equal(t, []string{"log-opt=max-size=10m", "debug", "log-driver=journald"}, flags)
+}
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -17,14 +18,19 @@ import (
 	"github.com/rancher/machine/commands/mcndirs"
 	"github.com/rancher/machine/libmachine"
 	"github.com/rancher/machine/libmachine/auth"
+	"github.com/rancher/machine/libmachine/cert"
+	"github.com/rancher/machine/libmachine/containerd"
 	"github.com/rancher/machine/libmachine/crashreport"
 	"github.com/rancher/machine/libmachine/drivers"
 	rpcdriver "github.com/rancher/machine/libmachine/drivers/rpc"
 	"github.com/rancher/machine/libmachine/engine"
 	"github.com/rancher/machine/libmachine/host"
+	"github.com/rancher/machine/libmachine/k3s"
 	"github.com/rancher/machine/libmachine/log"
 	"github.com/rancher/machine/libmachine/mcnerror"
 	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/rancher/machine/libmachine/provision"
+	"github.com/rancher/machine/libmachine/ssh"
 	"github.com/rancher/machine/libmachine/swarm"
 	"github.com/urfave/cli"
 	"gopkg.in/yaml.v2"
@@ -48,6 +54,51 @@ var (
 			Value:  drivers.DefaultEngineInstallURL,
 			EnvVar: "MACHINE_DOCKER_INSTALL_URL",
 		},
+		cli.StringFlag{
+			Name:   "engine-install-version",
+			Usage:  "Exact engine version to install from the Docker packages of the distribution, e.g. 24.0.7",
+			EnvVar: "MACHINE_DOCKER_INSTALL_VERSION",
+		},
+		cli.StringFlag{
+			Name:   "engine-packages-url",
+			Usage:  "Base URL of a mirror of the Docker package repositories to install the engine from, like " + provision.DefaultEnginePackagesURL,
+			EnvVar: "MACHINE_DOCKER_PACKAGES_URL",
+		},
+		cli.StringFlag{
+			Name:   "engine-offline-bundle",
+			Usage:  "Local path of a tarball of the static Docker binaries to install the engine from, without network access",
+			EnvVar: "MACHINE_DOCKER_OFFLINE_BUNDLE",
+		},
+		cli.StringFlag{
+			Name:   "engine-selinux",
+			Usage:  "SELinux mode of Red Hat family machines: enforcing, with container-selinux and the SELinux support of the engine, or permissive",
+			EnvVar: "MACHINE_DOCKER_SELINUX",
+		},
+		cli.StringSliceFlag{
+			Name:  "engine-selinux-boolean",
+			Usage: "SELinux boolean to set on Red Hat family machines, in the form name=on or name=off",
+			Value: &cli.StringSlice{},
+		},
+		cli.StringFlag{
+			Name:   "engine-http-proxy",
+			Usage:  "HTTP proxy of the engine and of the downloads of the provisioning, like http://proxy.example.com:3128",
+			EnvVar: "MACHINE_DOCKER_HTTP_PROXY",
+		},
+		cli.StringFlag{
+			Name:   "engine-https-proxy",
+			Usage:  "HTTPS proxy of the engine and of the downloads of the provisioning",
+			EnvVar: "MACHINE_DOCKER_HTTPS_PROXY",
+		},
+		cli.StringFlag{
+			Name:   "engine-no-proxy",
+			Usage:  "Comma-separated list of the hosts the engine and the provisioning reach without the proxy",
+			EnvVar: "MACHINE_DOCKER_NO_PROXY",
+		},
+		cli.BoolFlag{
+			Name:   "engine-nvidia-runtime",
+			Usage:  "Install the NVIDIA container toolkit and make its runtime the default runtime of the engine",
+			EnvVar: "MACHINE_ENGINE_NVIDIA_RUNTIME",
+		},
 		cli.StringSliceFlag{
 			Name:  "engine-opt",
 			Usage: "Specify arbitrary flags to include with the created engine in the form flag=value",
@@ -128,7 +179,17 @@ var (
 		},
 		cli.StringSliceFlag{
 			Name:  "tls-san",
-			Usage: "Support extra SANs for TLS certs",
+			Usage: "Support extra SANs for TLS certs: DNS names, like the names of load balancers, or IP addresses",
+			Value: &cli.StringSlice{},
+		},
+		cli.IntFlag{
+			Name:  "tls-cert-validity",
+			Usage: "Validity of the server TLS certificates, in days",
+			Value: int(cert.DefaultValidity / (24 * time.Hour)),
+		},
+		cli.StringSliceFlag{
+			Name:  "tls-key-usage",
+			Usage: "Key usages of the server TLS certificates, replacing the defaults: digital-signature, key-encipherment, key-agreement, server-auth, client-auth...",
 			Value: &cli.StringSlice{},
 		},
 		cli.StringFlag{
@@ -136,15 +197,188 @@ var (
 			Usage: "Use a custom provisioning script instead of installing docker",
 			Value: "",
 		},
+		cli.StringFlag{
+			Name:   "provision-pre-hook",
+			Usage:  "Local script, or inline commands, to run on the machine as root before installing the engine",
+			EnvVar: "MACHINE_PROVISION_PRE_HOOK",
+		},
+		cli.StringFlag{
+			Name:   "provision-post-hook",
+			Usage:  "Local script, or inline commands, to run on the machine as root after installing the engine",
+			EnvVar: "MACHINE_PROVISION_POST_HOOK",
+		},
+		cli.StringFlag{
+			Name:   "provision-engine",
+			Usage:  "What to provision the machine with: [docker, k3s, containerd, podman]",
+			Value:  host.ProvisionEngineDocker,
+			EnvVar: "MACHINE_PROVISION_ENGINE",
+		},
+		cli.StringFlag{
+			Name:  "k3s-role",
+			Usage: "Role of the k3s node: [server, agent]",
+			Value: k3s.RoleServer,
+		},
+		cli.StringFlag{
+			Name:  "k3s-channel",
+			Usage: "Release channel k3s is installed from",
+			Value: "stable",
+		},
+		cli.StringFlag{
+			Name:  "k3s-version",
+			Usage: "Version of k3s to install, instead of the latest of the channel",
+		},
+		cli.StringFlag{
+			Name:  "k3s-server-url",
+			Usage: "URL of the k3s server an agent joins",
+		},
+		cli.StringFlag{
+			Name:   "k3s-token",
+			Usage:  "Token of the k3s cluster an agent joins",
+			EnvVar: "MACHINE_K3S_TOKEN",
+		},
+		cli.StringFlag{
+			Name:  "k3s-registries-file",
+			Usage: "registries.yaml file configuring the registries and mirrors of k3s",
+		},
+		cli.StringFlag{
+			Name:  "k3s-install-url",
+			Usage: "Custom URL of the k3s install script",
+			Value: k3s.DefaultInstallURL,
+		},
+		cli.StringFlag{
+			Name:  "containerd-version",
+			Usage: "Version of containerd to install",
+			Value: containerd.DefaultVersion,
+		},
+		cli.StringFlag{
+			Name:  "containerd-runc-version",
+			Usage: "Version of runc to install with containerd",
+			Value: containerd.DefaultRuncVersion,
+		},
+		cli.StringSliceFlag{
+			Name:  "containerd-registry-mirror",
+			Usage: "Specify the Docker Hub mirrors of containerd",
+			Value: &cli.StringSlice{},
+		},
 		cli.StringFlag{
 			Name:  "hostname-override",
 			Usage: "Specify hostname to use during cloud-init instead of default generated hostname",
 			Value: "",
 		},
+		cli.BoolFlag{
+			Name:  "keep-on-error",
+			Usage: "Keep the resources of a machine whose creation failed, for debugging or resuming its provisioning with 'provision --resume'",
+		},
+		cli.StringFlag{
+			Name:   drivers.SSHKeyTypeFlag,
+			Usage:  "Type of the SSH key generated for the machine, rsa, ecdsa or ed25519, for the drivers supporting it",
+			EnvVar: "MACHINE_SSH_KEY_TYPE",
+		},
+		cli.StringFlag{
+			Name:   drivers.MachineTagsFlag,
+			Usage:  "Comma-separated key=value tags of the cloud resources of the machine, for the drivers supporting them",
+			EnvVar: "MACHINE_TAGS",
+		},
+		cli.StringFlag{
+			Name:   drivers.MachineUserDataFlag,
+			Usage:  "File of the user-data passed to the machine, a template of {{.MachineName}}, {{.SSHUser}} and {{.SSHPublicKey}}, for the drivers supporting it",
+			EnvVar: "MACHINE_USER_DATA",
+		},
+		cli.BoolFlag{
+			Name:   drivers.PreferIPv6Flag,
+			Usage:  "Connect to dual-stack machines over IPv6, for the drivers supporting it",
+			EnvVar: "MACHINE_PREFER_IPV6",
+		},
+		cli.StringFlag{
+			Name:   drivers.SSHJumpHostsFlag,
+			Usage:  "Comma-separated [user@]host[:port] jump hosts the SSH connections to the machine go through in order, like the ProxyJump option of OpenSSH, for the drivers supporting them",
+			EnvVar: "MACHINE_SSH_JUMP_HOSTS",
+		},
+		cli.StringFlag{
+			Name:   drivers.SSHJumpKeyFlag,
+			Usage:  "SSH private key path of the jump hosts (if not provided, the ssh-agent is used)",
+			EnvVar: "MACHINE_SSH_JUMP_KEY",
+		},
+		cli.IntFlag{
+			Name:   drivers.SSHWaitAttemptsFlag,
+			Usage:  fmt.Sprintf("Maximum number of attempts to connect to the machine over SSH while it boots, for the drivers supporting it. When 0, %d without --ssh-wait-timeout and unlimited but for it otherwise", ssh.DefaultRetryPolicy.MaxAttempts),
+			EnvVar: "MACHINE_SSH_WAIT_ATTEMPTS",
+		},
+		cli.IntFlag{
+			Name:   drivers.SSHWaitIntervalFlag,
+			Usage:  "Seconds between the attempts to connect to the machine over SSH",
+			Value:  int(ssh.DefaultRetryPolicy.Interval / time.Second),
+			EnvVar: "MACHINE_SSH_WAIT_INTERVAL",
+		},
+		cli.IntFlag{
+			Name:   drivers.SSHWaitTimeoutFlag,
+			Usage:  "Seconds to wait for SSH to be available on the machine in total, unlimited but for --ssh-wait-attempts when 0",
+			EnvVar: "MACHINE_SSH_WAIT_TIMEOUT",
+		},
+		cli.BoolFlag{
+			Name:   drivers.SSHWaitBackoffFlag,
+			Usage:  "Double the interval between the attempts to connect to the machine over SSH after each one, up to a minute",
+			EnvVar: "MACHINE_SSH_WAIT_BACKOFF",
+		},
+		cli.BoolFlag{
+			Name:   "ssh-connection-sharing",
+			Usage:  "Share one SSH connection between the commands run on the machine",
+			EnvVar: "MACHINE_SSH_CONNECTION_SHARING",
+		},
+		cli.StringFlag{
+			Name:   "ssh-ciphers",
+			Usage:  "Comma-separated SSH ciphers offered to the machine, added to the defaults with a leading '+' or removed from them with a '-', like the Ciphers option of OpenSSH",
+			EnvVar: ssh.CiphersEnv,
+		},
+		cli.StringFlag{
+			Name:   "ssh-kex-algorithms",
+			Usage:  "Comma-separated SSH key exchange algorithms offered to the machine, added to the defaults with a leading '+' or removed from them with a '-'",
+			EnvVar: ssh.KeyExchangesEnv,
+		},
+		cli.StringFlag{
+			Name:   "ssh-macs",
+			Usage:  "Comma-separated SSH MAC algorithms offered to the machine, added to the defaults with a leading '+' or removed from them with a '-'",
+			EnvVar: ssh.MACsEnv,
+		},
+		cli.StringFlag{
+			Name:   "ssh-user-ca-key",
+			Usage:  "Private key of the SSH user CA signing short-lived certificates for the machine key, which the SSH clients authenticate with",
+			EnvVar: ssh.UserCAKeyEnv,
+		},
+		cli.IntFlag{
+			Name:  "ssh-user-cert-validity",
+			Usage: "Validity of the SSH user certificates, in minutes",
+			Value: int(ssh.DefaultUserCertValidity / time.Minute),
+		},
+		cli.StringFlag{
+			Name:   "ssh-host-ca-key",
+			Usage:  "Public key of the SSH host CA the host key certificate of the machine must be signed by",
+			EnvVar: ssh.HostCAKeyEnv,
+		},
+		cli.BoolFlag{
+			Name:  "schema",
+			Usage: "Print the create flags of the driver as JSON, without creating anything",
+		},
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Only validate the flags, run the driver pre-create checks and list the resources the driver would create, without creating anything",
+		},
+		cli.StringFlag{
+			Name:  "output",
+			Usage: "Output format of the --dry-run report: [text, json]",
+		},
 	}
 )
 
 func cmdCreate(c CommandLine, api libmachine.API) error {
+	if c.Bool("schema") {
+		return printDriverFlagSchema(c, api, os.Stdout)
+	}
+
+	if c.Bool("dry-run") {
+		return cmdValidate(c, api)
+	}
+
 	if len(c.Args()) > 1 {
 		return fmt.Errorf("invalid arguments: found extra arguments %v", c.Args()[1:])
 	}
@@ -199,6 +433,14 @@ func cmdCreate(c CommandLine, api libmachine.API) error {
 			StorageDriver:    c.String("engine-storage-driver"),
 			TLSVerify:        true,
 			InstallURL:       c.String("engine-install-url"),
+			InstallVersion:   c.String("engine-install-version"),
+			PackagesURL:      c.String("engine-packages-url"),
+			NvidiaRuntime:    c.Bool("engine-nvidia-runtime"),
+			SELinux:          c.String("engine-selinux"),
+			SELinuxBooleans:  c.StringSlice("engine-selinux-boolean"),
+			HTTPProxy:        c.String("engine-http-proxy"),
+			HTTPSProxy:       c.String("engine-https-proxy"),
+			NoProxy:          c.String("engine-no-proxy"),
 		},
 		SwarmOptions: &swarm.Options{
 			IsSwarm:            c.Bool("swarm") || c.Bool("swarm-master"),
@@ -229,12 +471,52 @@ func cmdCreate(c CommandLine, api libmachine.API) error {
 	// driver parameters (an interface fulfilling drivers.DriverOptions,
 	// concrete type rpcdriver.RpcFlags).
 	mcnFlags := h.Driver.GetCreateFlags()
-	driverOpts := getDriverOpts(c, mcnFlags)
+	driverOpts, err := getDriverOpts(c, mcnFlags)
+	if err != nil {
+		return err
+	}
 	userdataFlag := drivers.DriverUserdataFlag(h.Driver)
 	osFlag := drivers.DriverOSFlag(h.Driver)
 
 	customInstallScript := c.String("custom-install-script")
 	h.HostOptions.HostnameOverride = c.String("hostname-override")
+	h.HostOptions.KeepOnError = c.Bool("keep-on-error")
+	h.HostOptions.SSHConnectionSharing = c.Bool("ssh-connection-sharing")
+	if err := setSSHAlgorithms(c, h.HostOptions); err != nil {
+		return err
+	}
+	if err := setSSHCertAuthorities(c, h.HostOptions); err != nil {
+		return err
+	}
+	if err := setServerCertOptions(c, h.HostOptions.AuthOptions); err != nil {
+		return err
+	}
+	if err := setEngineInstallSource(c, h.HostOptions.EngineOptions); err != nil {
+		return err
+	}
+	if err := provision.CheckSELinuxOptions(h.HostOptions.EngineOptions.SELinux, h.HostOptions.EngineOptions.SELinuxBooleans); err != nil {
+		return err
+	}
+	if err := provision.CheckProxyOptions(*h.HostOptions.EngineOptions); err != nil {
+		return err
+	}
+	if osFlag != "" {
+		h.HostOptions.MachineOS = driverOpts.String(osFlag)
+	}
+	if h.HostOptions.MachineOS == provision.WindowsMachineOS {
+		if provisionEngine := c.String("provision-engine"); provisionEngine != "" && provisionEngine != host.ProvisionEngineDocker {
+			return fmt.Errorf("--provision-engine=%s cannot be used with Windows machines", provisionEngine)
+		}
+		if h.HostOptions.SwarmOptions.IsSwarm {
+			return errors.New("swarm cannot be used with Windows machines")
+		}
+		if h.HostOptions.EngineOptions.InstallVersion != "" || h.HostOptions.EngineOptions.PackagesURL != "" || h.HostOptions.EngineOptions.OfflineBundle != "" {
+			return errors.New("the engine of Windows machines can only be installed with --engine-install-url")
+		}
+		if h.HostOptions.EngineOptions.HTTPProxy != "" || h.HostOptions.EngineOptions.HTTPSProxy != "" || h.HostOptions.EngineOptions.NoProxy != "" {
+			return errors.New("the proxy of the engine cannot be set on Windows machines, set it with --engine-env")
+		}
+	}
 	if customInstallScript != "" {
 		h.HostOptions.CustomInstallScript = customInstallScript
 		h.HostOptions.AuthOptions = nil
@@ -249,8 +531,58 @@ func cmdCreate(c CommandLine, api libmachine.API) error {
 		}
 	}
 
+	switch provisionEngine := c.String("provision-engine"); provisionEngine {
+	case "", host.ProvisionEngineDocker:
+	case host.ProvisionEngineK3s:
+		if customInstallScript != "" {
+			return fmt.Errorf("--custom-install-script cannot be used with --provision-engine=%s", provisionEngine)
+		}
+		k3sOptions, err := getK3sOptions(c)
+		if err != nil {
+			return err
+		}
+		h.HostOptions.ProvisionEngine = provisionEngine
+		h.HostOptions.K3sOptions = k3sOptions
+		h.HostOptions.AuthOptions = nil
+		h.HostOptions.EngineOptions = nil
+		h.HostOptions.SwarmOptions = nil
+	case host.ProvisionEngineContainerd:
+		if customInstallScript != "" {
+			return fmt.Errorf("--custom-install-script cannot be used with --provision-engine=%s", provisionEngine)
+		}
+		h.HostOptions.ProvisionEngine = provisionEngine
+		h.HostOptions.ContainerdOptions = &containerd.Options{
+			Version:        c.String("containerd-version"),
+			RuncVersion:    c.String("containerd-runc-version"),
+			RegistryMirror: c.StringSlice("containerd-registry-mirror"),
+		}
+		h.HostOptions.AuthOptions = nil
+		h.HostOptions.EngineOptions = nil
+		h.HostOptions.SwarmOptions = nil
+	case host.ProvisionEnginePodman:
+		if customInstallScript != "" {
+			return fmt.Errorf("--custom-install-script cannot be used with --provision-engine=%s", provisionEngine)
+		}
+		if h.HostOptions.SwarmOptions.IsSwarm {
+			return fmt.Errorf("swarm cannot be used with --provision-engine=%s", provisionEngine)
+		}
+		h.HostOptions.ProvisionEngine = provisionEngine
+		h.HostOptions.EngineOptions = nil
+		h.HostOptions.SwarmOptions = nil
+	default:
+		return fmt.Errorf("invalid --provision-engine %q, must be one of docker, k3s, containerd, podman", provisionEngine)
+	}
+
+	if err := setProvisionHooks(c, h.HostOptions); err != nil {
+		return err
+	}
+
 	if err := h.Driver.SetConfigFromFlags(driverOpts); err != nil {
-		return fmt.Errorf("error setting machine configuration from flags provided: %s", err)
+		// The drivers only reject flags there.
+		if drivers.GetErrorCode(err) == "" {
+			err = drivers.NewError(drivers.ErrorCodeInvalidFlag, err)
+		}
+		return fmt.Errorf("error setting machine configuration from flags provided: %w", err)
 	}
 
 	if err := api.Create(h); err != nil {
@@ -282,7 +614,162 @@ func cmdCreate(c CommandLine, api libmachine.API) error {
 	return nil
 }
 
-func getDriverOpts(c CommandLine, mcnflags []mcnflag.Flag) *rpcdriver.RPCFlags {
+// setProvisionHooks sets the hooks run around the installation of the Docker
+// or Podman engine, the paths of local scripts made absolute.
+func setProvisionHooks(c CommandLine, hostOptions *host.Options) error {
+	preHook := c.String("provision-pre-hook")
+	postHook := c.String("provision-post-hook")
+	if preHook == "" && postHook == "" {
+		return nil
+	}
+
+	switch {
+	case hostOptions.CustomInstallScript != "":
+		return errors.New("--provision-pre-hook and --provision-post-hook cannot be used with --custom-install-script")
+	case hostOptions.ProvisionEngine == host.ProvisionEngineK3s || hostOptions.ProvisionEngine == host.ProvisionEngineContainerd:
+		return fmt.Errorf("--provision-pre-hook and --provision-post-hook cannot be used with --provision-engine=%s", hostOptions.ProvisionEngine)
+	case hostOptions.MachineOS == provision.WindowsMachineOS:
+		return errors.New("--provision-pre-hook and --provision-post-hook cannot be used with Windows machines")
+	}
+
+	for _, hook := range []struct {
+		target *string
+		value  string
+	}{
+		{&hostOptions.PreProvisionHook, preHook},
+		{&hostOptions.PostProvisionHook, postHook},
+	} {
+		*hook.target = hook.value
+		// Scripts are uploaded again when the machine is provisioned
+		// later, from another working directory.
+		if info, err := os.Stat(hook.value); err == nil && !info.IsDir() {
+			path, err := filepath.Abs(hook.value)
+			if err != nil {
+				return err
+			}
+			*hook.target = path
+		}
+	}
+	return nil
+}
+
+// setSSHAlgorithms checks the SSH algorithms offered to the machine and sets
+// them in its options.
+func setSSHAlgorithms(c CommandLine, hostOptions *host.Options) error {
+	algorithms := ssh.Algorithms{
+		Ciphers:      c.String("ssh-ciphers"),
+		KeyExchanges: c.String("ssh-kex-algorithms"),
+		MACs:         c.String("ssh-macs"),
+	}
+	if algorithms.IsZero() {
+		return nil
+	}
+	if err := algorithms.Validate(); err != nil {
+		return err
+	}
+
+	hostOptions.SSHAlgorithms = &algorithms
+	return nil
+}
+
+// setSSHCertAuthorities checks the SSH certificate authorities of the machine
+// and sets them in its options.
+func setSSHCertAuthorities(c CommandLine, hostOptions *host.Options) error {
+	authorities := ssh.CertAuthorities{
+		UserCAKey: c.String("ssh-user-ca-key"),
+		HostCAKey: c.String("ssh-host-ca-key"),
+	}
+	if authorities.IsZero() {
+		return nil
+	}
+
+	// The keys are used by every later command, wherever it is run from.
+	for _, path := range []*string{&authorities.UserCAKey, &authorities.HostCAKey} {
+		if *path == "" {
+			continue
+		}
+		if _, err := os.Stat(*path); err != nil {
+			return fmt.Errorf("SSH CA key does not exist: %q", *path)
+		}
+		abs, err := filepath.Abs(*path)
+		if err != nil {
+			return err
+		}
+		*path = abs
+	}
+
+	if authorities.UserCAKey != "" {
+		validity := c.Int("ssh-user-cert-validity")
+		if validity <= 0 {
+			return fmt.Errorf("--ssh-user-cert-validity must be positive, got %d", validity)
+		}
+		authorities.UserCertValidity = time.Duration(validity) * time.Minute
+	}
+
+	hostOptions.SSHCertAuthorities = &authorities
+	return nil
+}
+
+// setServerCertOptions checks the validity and the key usages of the server
+// TLS certificates given, and sets them.
+func setServerCertOptions(c CommandLine, authOptions *auth.Options) error {
+	if days := c.Int("tls-cert-validity"); days != 0 {
+		if days < 0 {
+			return fmt.Errorf("--tls-cert-validity must be positive, got %d", days)
+		}
+		authOptions.ServerCertValidity = time.Duration(days) * 24 * time.Hour
+		if authOptions.ServerCertValidity == cert.DefaultValidity {
+			authOptions.ServerCertValidity = 0
+		}
+	}
+
+	if usages := c.StringSlice("tls-key-usage"); len(usages) > 0 {
+		if _, _, err := cert.ParseKeyUsages(usages); err != nil {
+			return fmt.Errorf("invalid --tls-key-usage: %s", err)
+		}
+		authOptions.ServerCertKeyUsages = usages
+	}
+	return nil
+}
+
+// setEngineInstallSource checks the options installing the engine from a
+// package repository or an offline bundle, in an exact version, instead of
+// with the install script.
+func setEngineInstallSource(c CommandLine, engineOptions *engine.Options) error {
+	installVersion := c.String("engine-install-version")
+	packagesURL := c.String("engine-packages-url")
+	bundle := c.String("engine-offline-bundle")
+	if installVersion == "" && packagesURL == "" && bundle == "" {
+		return nil
+	}
+
+	if installURL := c.String("engine-install-url"); installURL != drivers.DefaultEngineInstallURL {
+		return fmt.Errorf("--engine-install-url=%s cannot be used with --engine-install-version, --engine-packages-url or --engine-offline-bundle", installURL)
+	}
+	if packagesURL != "" && bundle != "" {
+		return errors.New("--engine-packages-url and --engine-offline-bundle cannot be used together")
+	}
+	if installVersion != "" {
+		if _, err := provision.ParseEngineInstallVersion(installVersion); err != nil {
+			return err
+		}
+	}
+	if bundle != "" {
+		// The bundle is uploaded again when the machine is provisioned
+		// later, from another working directory.
+		path, err := filepath.Abs(bundle)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("unable to read the offline bundle: %s", err)
+		}
+		engineOptions.OfflineBundle = path
+	}
+	return nil
+}
+
+func getDriverOpts(c CommandLine, mcnflags []mcnflag.Flag) (*rpcdriver.RPCFlags, error) {
 	// TODO: This function is pretty damn YOLO and would benefit from some
 	// sanity checking around types and assertions.
 	//
@@ -311,41 +798,85 @@ func getDriverOpts(c CommandLine, mcnflags []mcnflag.Flag) *rpcdriver.RPCFlags {
 		}
 	}
 
-	return &driverOpts
+	if err := resolveStringFlags(mcnflags, &driverOpts); err != nil {
+		return nil, err
+	}
+
+	if err := mcnflag.ValidateValues(mcnflags, driverOpts.Values); err != nil {
+		return nil, drivers.NewError(drivers.ErrorCodeInvalidFlag, err)
+	}
+
+	return &driverOpts, nil
+}
+
+// resolveStringFlags replaces string flag values given indirectly, through a
+// --<flag>-file companion, a MACHINE_DRIVER_<FLAG>_FILE variable or a
+// ref+env:// reference, with the value they point to.
+func resolveStringFlags(mcnflags []mcnflag.Flag, driverOpts *rpcdriver.RPCFlags) error {
+	for _, f := range mcnflags {
+		var name string
+		switch f := f.(type) {
+		case *mcnflag.StringFlag:
+			name = f.Name
+		case mcnflag.StringFlag:
+			name = f.Name
+		default:
+			continue
+		}
+
+		fileFlag := mcnflag.FileFlagName(name)
+		filePath, _ := driverOpts.Values[fileFlag].(string)
+		delete(driverOpts.Values, fileFlag)
+
+		value, _ := driverOpts.Values[name].(string)
+		resolved, err := mcnflag.ResolveStringValue(name, value, filePath)
+		if err != nil {
+			return err
+		}
+		if filePath != "" || resolved != value {
+			log.Debugf("Resolved the value of --%s indirectly", name)
+		}
+		driverOpts.Values[name] = resolved
+	}
+
+	return nil
 }
 
 func convertMcnFlagsToCliFlags(mcnFlags []mcnflag.Flag) ([]cli.Flag, error) {
 	cliFlags := []cli.Flag{}
 	for _, f := range mcnFlags {
-		switch t := f.(type) {
+		switch f := mcnflag.Indirect(f).(type) {
 		// TODO: It seems pretty wrong to just default "nil" to this,
 		// but cli.BoolFlag doesn't have a "Value" field (false is
 		// always the default)
-		case *mcnflag.BoolFlag:
-			f := f.(*mcnflag.BoolFlag)
+		case mcnflag.BoolFlag:
 			cliFlags = append(cliFlags, cli.BoolFlag{
 				Name:   f.Name,
 				EnvVar: f.EnvVar,
 				Usage:  f.Usage,
 			})
-		case *mcnflag.IntFlag:
-			f := f.(*mcnflag.IntFlag)
+		case mcnflag.IntFlag:
 			cliFlags = append(cliFlags, cli.IntFlag{
 				Name:   f.Name,
 				EnvVar: f.EnvVar,
 				Usage:  f.Usage,
 				Value:  f.Value,
 			})
-		case *mcnflag.StringFlag:
-			f := f.(*mcnflag.StringFlag)
+		case mcnflag.StringFlag:
 			cliFlags = append(cliFlags, cli.StringFlag{
 				Name:   f.Name,
 				EnvVar: f.EnvVar,
 				Usage:  f.Usage,
 				Value:  f.Value,
 			})
-		case *mcnflag.StringSliceFlag:
-			f := f.(*mcnflag.StringSliceFlag)
+			if f.Sensitive {
+				cliFlags = append(cliFlags, cli.StringFlag{
+					Name:   mcnflag.FileFlagName(f.Name),
+					EnvVar: mcnflag.FileEnvVar(f.Name),
+					Usage:  fmt.Sprintf("Read the value of --%s from a file", f.Name),
+				})
+			}
+		case mcnflag.StringSliceFlag:
 			cliFlags = append(cliFlags, cli.StringSliceFlag{
 				Name:   f.Name,
 				EnvVar: f.EnvVar,
@@ -356,7 +887,7 @@ func convertMcnFlagsToCliFlags(mcnFlags []mcnflag.Flag) ([]cli.Flag, error) {
 			})
 		default:
 			log.Warn("Flag is ", f)
-			return nil, fmt.Errorf("[convertMcnFlagsToCliFlags] flag is unrecognized flag type: %T", t)
+			return nil, fmt.Errorf("[convertMcnFlagsToCliFlags] flag is unrecognized flag type: %T", f)
 		}
 	}
 
@@ -380,6 +911,39 @@ func validateSwarmDiscovery(discovery string) error {
 	return fmt.Errorf("[validateSwarmDiscovery] swarm Discovery URL was in the wrong format: %s", discovery)
 }
 
+// getK3sOptions returns the k3s options of the flags, of which an agent needs
+// the server and token of its cluster.
+func getK3sOptions(c CommandLine) (*k3s.Options, error) {
+	opts := &k3s.Options{
+		Role:           c.String("k3s-role"),
+		Channel:        c.String("k3s-channel"),
+		Version:        c.String("k3s-version"),
+		ServerURL:      c.String("k3s-server-url"),
+		Token:          c.String("k3s-token"),
+		RegistriesFile: c.String("k3s-registries-file"),
+		InstallURL:     c.String("k3s-install-url"),
+	}
+
+	switch opts.Role {
+	case "":
+		opts.Role = k3s.RoleServer
+	case k3s.RoleServer:
+	case k3s.RoleAgent:
+		if opts.ServerURL == "" || opts.Token == "" {
+			return nil, errors.New("a k3s agent needs --k3s-server-url and --k3s-token")
+		}
+	default:
+		return nil, fmt.Errorf("invalid --k3s-role %q, must be server or agent", opts.Role)
+	}
+
+	if opts.RegistriesFile != "" {
+		if _, err := os.Stat(opts.RegistriesFile); err != nil {
+			return nil, fmt.Errorf("unable to read --k3s-registries-file: %s", err)
+		}
+	}
+	return opts, nil
+}
+
 func tlsPath(c CommandLine, flag string, defaultName string) string {
 	path := c.GlobalString(flag)
 	if path != "" {
@@ -563,3 +1127,20 @@ func appendValueToListInCloudConfig(cf map[interface{}]interface{}, key string,
 
 	return nil
 }
+
+// printDriverFlagSchema prints the schema of the create flags of the driver
+// given with --driver.
+func printDriverFlagSchema(c CommandLine, api libmachine.API, out io.Writer) error {
+	schemas, err := libmachine.DriverFlagSchema(api, c.String("driver"))
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(schemas, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, string(data))
+	return nil
+}
@@ -1,13 +1,27 @@
 package commands
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"flag"
 
 	"github.com/rancher/machine/commands/commandstest"
+	"github.com/rancher/machine/drivers/generic"
+	"github.com/rancher/machine/drivers/none"
+	"github.com/rancher/machine/libmachine/auth"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/engine"
+	"github.com/rancher/machine/libmachine/host"
+	"github.com/rancher/machine/libmachine/k3s"
+	"github.com/rancher/machine/libmachine/log"
 	"github.com/rancher/machine/libmachine/mcnflag"
 	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
 )
 
 func TestValidateSwarmDiscoveryErrorsGivenInvalidURL(t *testing.T) {
@@ -108,7 +122,8 @@ func TestGetDriverOpts(t *testing.T) {
 				Data: tt.data,
 			},
 		}
-		driverOpts := getDriverOpts(commandLine, getDriverOptsFlags)
+		driverOpts, err := getDriverOpts(commandLine, getDriverOptsFlags)
+		assert.NoError(t, err)
 		assert.Equal(t, tt.expected["bool"], driverOpts.Bool("bool"))
 		assert.Equal(t, tt.expected["int"], driverOpts.Int("int"))
 		assert.Equal(t, tt.expected["int_defaulted"], driverOpts.Int("int_defaulted"))
@@ -118,3 +133,369 @@ func TestGetDriverOpts(t *testing.T) {
 		assert.Equal(t, tt.expected["stringslice_defaulted"], driverOpts.StringSlice("stringslice_defaulted"))
 	}
 }
+
+var secretFlags = []mcnflag.Flag{
+	&mcnflag.StringFlag{
+		Name:      "driver-secret",
+		Sensitive: true,
+	},
+	&mcnflag.StringFlag{
+		Name: "driver-region",
+	},
+}
+
+func TestConvertMcnFlagsToCliFlagsSensitive(t *testing.T) {
+	cliFlags, err := convertMcnFlagsToCliFlags(secretFlags)
+
+	assert.NoError(t, err)
+	assert.Len(t, cliFlags, 3)
+	assert.Equal(t, "driver-secret-file", cliFlags[1].(cli.StringFlag).Name)
+	assert.Equal(t, "MACHINE_DRIVER_DRIVER_SECRET_FILE", cliFlags[1].(cli.StringFlag).EnvVar)
+	assert.Equal(t, "driver-region", cliFlags[2].(cli.StringFlag).Name)
+}
+
+func TestGetDriverOptsIndirectValues(t *testing.T) {
+	secretPath := filepath.Join(t.TempDir(), "secret")
+	assert.NoError(t, os.WriteFile(secretPath, []byte("s3cr3t-from-file\n"), 0600))
+	t.Setenv("TEST_DRIVER_REGION", "region-from-env")
+
+	out := &bytes.Buffer{}
+	log.SetDebug(true)
+	log.SetOutWriter(out)
+	defer func() {
+		log.SetDebug(false)
+		log.SetOutWriter(os.Stdout)
+	}()
+
+	commandLine := &commandstest.FakeCommandLine{
+		LocalFlags: &commandstest.FakeFlagger{
+			Data: map[string]interface{}{
+				"driver-secret-file": fakeFlagGetter{value: secretPath},
+				"driver-region":      fakeFlagGetter{value: "ref+env://TEST_DRIVER_REGION"},
+			},
+		},
+	}
+
+	driverOpts, err := getDriverOpts(commandLine, secretFlags)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t-from-file", driverOpts.String("driver-secret"))
+	assert.Equal(t, "region-from-env", driverOpts.String("driver-region"))
+	assert.NotContains(t, driverOpts.Values, "driver-secret-file")
+	assert.NotContains(t, out.String(), "s3cr3t-from-file")
+	assert.NotContains(t, strings.Join(log.History(), "\n"), "s3cr3t-from-file")
+}
+
+func TestGetDriverOptsFileEnvVar(t *testing.T) {
+	secretPath := filepath.Join(t.TempDir(), "secret")
+	assert.NoError(t, os.WriteFile(secretPath, []byte("s3cr3t\r\n"), 0600))
+	t.Setenv("MACHINE_DRIVER_DRIVER_SECRET_FILE", secretPath)
+
+	commandLine := &commandstest.FakeCommandLine{
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{}},
+	}
+
+	driverOpts, err := getDriverOpts(commandLine, secretFlags)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t", driverOpts.String("driver-secret"))
+}
+
+func TestGetDriverOptsIndirectErrors(t *testing.T) {
+	emptyPath := filepath.Join(t.TempDir(), "empty")
+	assert.NoError(t, os.WriteFile(emptyPath, []byte("\n"), 0600))
+
+	testCases := []struct {
+		data        map[string]interface{}
+		expectedErr string
+	}{
+		{
+			data:        map[string]interface{}{"driver-secret-file": fakeFlagGetter{value: filepath.Join(t.TempDir(), "missing")}},
+			expectedErr: "--driver-secret",
+		},
+		{
+			data:        map[string]interface{}{"driver-secret-file": fakeFlagGetter{value: emptyPath}},
+			expectedErr: "error reading the value of --driver-secret from file: " + emptyPath + " is empty",
+		},
+		{
+			data:        map[string]interface{}{"driver-region": fakeFlagGetter{value: "ref+env://TEST_DRIVER_UNSET"}},
+			expectedErr: "error resolving the value of --driver-region: environment variable TEST_DRIVER_UNSET is not set",
+		},
+	}
+
+	for _, tc := range testCases {
+		commandLine := &commandstest.FakeCommandLine{
+			LocalFlags: &commandstest.FakeFlagger{Data: tc.data},
+		}
+
+		_, err := getDriverOpts(commandLine, secretFlags)
+
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), tc.expectedErr)
+		}
+	}
+}
+
+func TestGetDriverOptsInvalidValue(t *testing.T) {
+	enumFlags := []mcnflag.Flag{
+		mcnflag.StringFlag{Name: "driver-http-tokens", Options: []string{"optional", "required"}},
+	}
+	commandLine := &commandstest.FakeCommandLine{
+		LocalFlags: &commandstest.FakeFlagger{
+			Data: map[string]interface{}{"driver-http-tokens": fakeFlagGetter{value: "always"}},
+		},
+	}
+
+	_, err := getDriverOpts(commandLine, enumFlags)
+
+	assert.EqualError(t, err, `invalid value "always" for --driver-http-tokens, expected one of optional, required`)
+	assert.Equal(t, drivers.ErrorCodeInvalidFlag, drivers.GetErrorCode(err))
+}
+
+func TestPrintDriverFlagSchema(t *testing.T) {
+	api := &driversAPI{drivers: map[string]drivers.Driver{
+		"generic": generic.NewDriver("", ""),
+		"none":    none.NewDriver("", ""),
+	}}
+
+	testCases := []struct {
+		driver   string
+		expected string
+	}{
+		{
+			driver: "none",
+			expected: `[
+    {
+        "Name": "url",
+        "Type": "string",
+        "Default": "",
+        "Description": "URL of host when no driver is selected",
+        "Sensitive": false
+    }
+]
+`,
+		},
+		{
+			driver: "generic",
+			expected: `[
+    {
+        "Name": "generic-engine-port",
+        "Type": "int",
+        "Default": 2376,
+        "EnvVar": "GENERIC_ENGINE_PORT",
+        "Description": "Docker engine port",
+        "Sensitive": false
+    },
+    {
+        "Name": "generic-ip-address",
+        "Type": "string",
+        "Default": "",
+        "EnvVar": "GENERIC_IP_ADDRESS",
+        "Description": "IP Address of machine",
+        "Sensitive": false
+    },
+    {
+        "Name": "generic-ssh-user",
+        "Type": "string",
+        "Default": "root",
+        "EnvVar": "GENERIC_SSH_USER",
+        "Description": "SSH user",
+        "Sensitive": false
+    },
+    {
+        "Name": "generic-ssh-key",
+        "Type": "string",
+        "Default": "",
+        "EnvVar": "GENERIC_SSH_KEY",
+        "Description": "SSH private key path (if not provided, default SSH key will be used)",
+        "Sensitive": false
+    },
+    {
+        "Name": "generic-ssh-password",
+        "Type": "string",
+        "Default": "",
+        "EnvVar": "GENERIC_SSH_PASSWORD",
+        "Description": "SSH password, for machines the SSH key cannot be installed in beforehand (the key is generated and installed while provisioning)",
+        "Sensitive": true
+    },
+    {
+        "Name": "generic-ssh-password-prompt",
+        "Type": "bool",
+        "Default": false,
+        "Description": "Prompt for the SSH password, like --generic-ssh-password",
+        "Sensitive": false
+    },
+    {
+        "Name": "generic-ssh-port",
+        "Type": "int",
+        "Default": 22,
+        "EnvVar": "GENERIC_SSH_PORT",
+        "Description": "SSH port",
+        "Sensitive": false
+    },
+    {
+        "Name": "generic-ssh-bastion-host",
+        "Type": "string",
+        "Default": "",
+        "EnvVar": "GENERIC_SSH_BASTION_HOST",
+        "Description": "SSH bastion to reach the machine through, if it is not reachable directly",
+        "Sensitive": false
+    },
+    {
+        "Name": "generic-ssh-bastion-port",
+        "Type": "int",
+        "Default": 22,
+        "EnvVar": "GENERIC_SSH_BASTION_PORT",
+        "Description": "SSH port of the bastion",
+        "Sensitive": false
+    },
+    {
+        "Name": "generic-ssh-bastion-user",
+        "Type": "string",
+        "Default": "root",
+        "EnvVar": "GENERIC_SSH_BASTION_USER",
+        "Description": "SSH user of the bastion",
+        "Sensitive": false
+    },
+    {
+        "Name": "generic-ssh-bastion-key",
+        "Type": "string",
+        "Default": "",
+        "EnvVar": "GENERIC_SSH_BASTION_KEY",
+        "Description": "SSH private key path of the bastion (if not provided, the ssh-agent is used with the external client)",
+        "Sensitive": false
+    }
+]
+`,
+		},
+	}
+
+	for _, tc := range testCases {
+		commandLine := &commandstest.FakeCommandLine{
+			LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{"driver": tc.driver}},
+		}
+		out := &bytes.Buffer{}
+
+		err := printDriverFlagSchema(commandLine, api, out)
+
+		assert.NoError(t, err, tc.driver)
+		assert.Equal(t, tc.expected, out.String(), tc.driver)
+	}
+
+	err := printDriverFlagSchema(&commandstest.FakeCommandLine{
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{"driver": "missing"}},
+	}, api, &bytes.Buffer{})
+	assert.EqualError(t, err, "plugin binary not found")
+}
+
+func TestGetK3sOptions(t *testing.T) {
+	opts, err := getK3sOptions(&commandstest.FakeCommandLine{
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{
+			"k3s-channel": "stable",
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, k3s.RoleServer, opts.Role)
+	assert.Equal(t, "stable", opts.Channel)
+
+	_, err = getK3sOptions(&commandstest.FakeCommandLine{
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{
+			"k3s-role":       k3s.RoleAgent,
+			"k3s-server-url": "https://10.0.0.1:6443",
+		}},
+	})
+	assert.EqualError(t, err, "a k3s agent needs --k3s-server-url and --k3s-token")
+
+	_, err = getK3sOptions(&commandstest.FakeCommandLine{
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{
+			"k3s-role": "worker",
+		}},
+	})
+	assert.EqualError(t, err, `invalid --k3s-role "worker", must be server or agent`)
+}
+
+func TestSetEngineInstallSource(t *testing.T) {
+	bundle := filepath.Join(t.TempDir(), "docker-24.0.7.tgz")
+	assert.NoError(t, os.WriteFile(bundle, nil, 0600))
+
+	engineOptions := &engine.Options{}
+	err := setEngineInstallSource(&commandstest.FakeCommandLine{
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{
+			"engine-install-url":     drivers.DefaultEngineInstallURL,
+			"engine-install-version": "24.0.7",
+			"engine-offline-bundle":  bundle,
+		}},
+	}, engineOptions)
+	assert.NoError(t, err)
+	assert.Equal(t, bundle, engineOptions.OfflineBundle)
+
+	err = setEngineInstallSource(&commandstest.FakeCommandLine{
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{
+			"engine-install-url":    drivers.DefaultEngineInstallURL,
+			"engine-packages-url":   "https://mirror.example.com/docker",
+			"engine-offline-bundle": bundle,
+		}},
+	}, &engine.Options{})
+	assert.EqualError(t, err, "--engine-packages-url and --engine-offline-bundle cannot be used together")
+
+	err = setEngineInstallSource(&commandstest.FakeCommandLine{
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{
+			"engine-install-url":  "none",
+			"engine-packages-url": "https://mirror.example.com/docker",
+		}},
+	}, &engine.Options{})
+	assert.EqualError(t, err, "--engine-install-url=none cannot be used with --engine-install-version, --engine-packages-url or --engine-offline-bundle")
+}
+
+func TestSetServerCertOptions(t *testing.T) {
+	authOptions := &auth.Options{}
+	err := setServerCertOptions(&commandstest.FakeCommandLine{
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{
+			"tls-cert-validity": 90,
+			"tls-key-usage":     []string{"digital-signature", "server-auth"},
+		}},
+	}, authOptions)
+	assert.NoError(t, err)
+	assert.Equal(t, 90*24*time.Hour, authOptions.ServerCertValidity)
+	assert.Equal(t, []string{"digital-signature", "server-auth"}, authOptions.ServerCertKeyUsages)
+
+	// The default validity is left out of the options of the machine.
+	err = setServerCertOptions(&commandstest.FakeCommandLine{
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{"tls-cert-validity": 1080}},
+	}, authOptions)
+	assert.NoError(t, err)
+	assert.Zero(t, authOptions.ServerCertValidity)
+
+	err = setServerCertOptions(&commandstest.FakeCommandLine{
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{"tls-cert-validity": -1}},
+	}, authOptions)
+	assert.EqualError(t, err, "--tls-cert-validity must be positive, got -1")
+
+	err = setServerCertOptions(&commandstest.FakeCommandLine{
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{"tls-key-usage": []string{"client-auth"}}},
+	}, authOptions)
+	assert.EqualError(t, err, "invalid --tls-key-usage: the server certificates need the server-auth key usage")
+}
+
+func TestSetProvisionHooks(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "pre.sh")
+	assert.NoError(t, os.WriteFile(script, nil, 0600))
+
+	hostOptions := &host.Options{}
+	err := setProvisionHooks(&commandstest.FakeCommandLine{
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{
+			"provision-pre-hook":  script,
+			"provision-post-hook": "systemctl restart rsyslog",
+		}},
+	}, hostOptions)
+	assert.NoError(t, err)
+	assert.Equal(t, script, hostOptions.PreProvisionHook)
+	assert.Equal(t, "systemctl restart rsyslog", hostOptions.PostProvisionHook)
+
+	err = setProvisionHooks(&commandstest.FakeCommandLine{
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{
+			"provision-pre-hook": script,
+		}},
+	}, &host.Options{ProvisionEngine: host.ProvisionEngineK3s})
+	assert.EqualError(t, err, "--provision-pre-hook and --provision-post-hook cannot be used with --provision-engine=k3s")
+}
@@ -0,0 +1,159 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/rancher/machine/libmachine"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/drivers/plugin/localbinary"
+)
+
+var (
+	errDriversInvalidOutput = errors.New("Error: --output must be one of \"text\" or \"json\"")
+	errExpectedOneDriver    = errors.New("Error: Expected one driver name as an argument")
+
+	// listDriverNames is swapped out in tests.
+	listDriverNames = localbinary.ListDrivers
+)
+
+// driverInfo describes a locally resolvable driver. Error is set when the
+// driver plugin could not be launched.
+type driverInfo struct {
+	Name          string
+	APIVersion    int `json:",omitempty"`
+	Capabilities  []drivers.Capability
+	Architectures []string `json:",omitempty"`
+	Error         string   `json:",omitempty"`
+}
+
+func cmdDrivers(c CommandLine, api libmachine.API) error {
+	return printDrivers(c, api, os.Stdout)
+}
+
+func printDrivers(c CommandLine, api libmachine.API, out io.Writer) error {
+	output := c.String("output")
+	if output != "" && output != "text" && output != "json" {
+		return errDriversInvalidOutput
+	}
+
+	names := listDriverNames()
+	if name := c.String("driver"); name != "" {
+		names = []string{name}
+	}
+
+	infos := probeDrivers(api, names, c.GlobalString("storage-path"))
+
+	if output == "json" {
+		data, err := json.MarshalIndent(infos, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, string(data))
+	} else {
+		w := tabwriter.NewWriter(out, 5, 1, 3, ' ', 0)
+		fmt.Fprintln(w, "NAME\tAPI VERSION\tCAPABILITIES\tERRORS")
+		for _, info := range infos {
+			apiVersion := "-"
+			if info.Error == "" {
+				apiVersion = fmt.Sprint(info.APIVersion)
+			}
+			capabilities := make([]string, len(info.Capabilities))
+			for i, capability := range info.Capabilities {
+				capabilities[i] = string(capability)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", info.Name, apiVersion, strings.Join(capabilities, ","), info.Error)
+		}
+		w.Flush()
+	}
+
+	// Only a single, explicitly requested driver makes the command fail.
+	if len(infos) == 1 && infos[0].Error != "" && c.String("driver") != "" {
+		return errors.New(infos[0].Error)
+	}
+
+	return nil
+}
+
+func cmdDriverInspect(c CommandLine, api libmachine.API) error {
+	return inspectDriver(c, api, os.Stdout)
+}
+
+// inspectDriver prints the API version, capabilities and architectures of the
+// driver named by the single argument, as JSON or through the --format
+// template, for tooling to adapt to the driver.
+func inspectDriver(c CommandLine, api libmachine.API, out io.Writer) error {
+	if len(c.Args()) != 1 {
+		c.ShowHelp()
+		return errExpectedOneDriver
+	}
+
+	info := probeDrivers(api, c.Args(), c.GlobalString("storage-path"))[0]
+	if info.Error != "" {
+		return errors.New(info.Error)
+	}
+
+	tmplString := c.String("format")
+	if tmplString == "" {
+		prettyJSON, err := json.MarshalIndent(info, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, string(prettyJSON))
+		return nil
+	}
+
+	tmpl, err := template.New("").Funcs(funcMap).Parse(tmplString)
+	if err != nil {
+		return fmt.Errorf("template parsing error: %v", err)
+	}
+	if err := tmpl.Execute(out, info); err != nil {
+		return err
+	}
+	fmt.Fprintln(out)
+	return nil
+}
+
+// probeDrivers briefly launches each driver plugin to ask for its API
+// version and capabilities, closing it once probed. A driver that fails to
+// launch is reported with its error instead of aborting the listing.
+func probeDrivers(api libmachine.API, names []string, storePath string) []driverInfo {
+	rawDriver, err := json.Marshal(&drivers.BaseDriver{StorePath: storePath})
+	if err != nil {
+		rawDriver = []byte("{}")
+	}
+
+	infos := make([]driverInfo, 0, len(names))
+	for _, name := range names {
+		info := driverInfo{Name: name, Capabilities: []drivers.Capability{}}
+
+		h, err := api.NewHost(name, rawDriver)
+		switch {
+		case err != nil:
+			info.Error = err.Error()
+		case h == nil || h.Driver == nil:
+			info.Error = fmt.Sprintf("Driver %q could not be loaded", name)
+		default:
+			if versioned, ok := h.Driver.(interface{ APIVersion() int }); ok {
+				info.APIVersion = versioned.APIVersion()
+			}
+			if capabilities := drivers.GetCapabilities(h.Driver); capabilities != nil {
+				info.Capabilities = capabilities
+			}
+			if architectures := drivers.GetSupportedArchitectures(h.Driver); len(architectures) > 0 {
+				info.Architectures = architectures
+			}
+			libmachine.CloseDriver(h.Driver)
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos
+}
@@ -0,0 +1,177 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/rancher/machine/commands/commandstest"
+	"github.com/rancher/machine/drivers/fakedriver"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/host"
+	"github.com/rancher/machine/libmachine/libmachinetest"
+	"github.com/stretchr/testify/assert"
+)
+
+// driversAPI launches fake drivers by name, failing for unknown names.
+type driversAPI struct {
+	libmachinetest.FakeAPI
+	drivers map[string]drivers.Driver
+}
+
+func (api *driversAPI) NewHost(driverName string, rawDriver []byte) (*host.Host, error) {
+	d, ok := api.drivers[driverName]
+	if !ok {
+		return nil, errors.New("plugin binary not found")
+	}
+	return &host.Host{Driver: d, DriverName: driverName}, nil
+}
+
+// versionedDriver reports a plugin API version like an RPC client driver.
+type versionedDriver struct {
+	*fakedriver.Driver
+}
+
+func (d *versionedDriver) APIVersion() int {
+	return 1
+}
+
+// closingDriver counts how many times its plugin is closed.
+type closingDriver struct {
+	*versionedDriver
+	closed int
+}
+
+func (d *closingDriver) Close() error {
+	d.closed++
+	return nil
+}
+
+func newDriversAPI() *driversAPI {
+	return &driversAPI{
+		drivers: map[string]drivers.Driver{
+			"capable": &versionedDriver{&fakedriver.Driver{
+				MockCapabilities: []drivers.Capability{drivers.CapabilityStartStop, drivers.CapabilityKill},
+			}},
+			"legacy": &versionedDriver{&fakedriver.Driver{}},
+		},
+	}
+}
+
+func driversCommandLine(flags map[string]interface{}) *commandstest.FakeCommandLine {
+	return &commandstest.FakeCommandLine{
+		LocalFlags:  &commandstest.FakeFlagger{Data: flags},
+		GlobalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{}},
+	}
+}
+
+func TestCmdDriversListing(t *testing.T) {
+	defer func(orig func() []string) { listDriverNames = orig }(listDriverNames)
+	listDriverNames = func() []string { return []string{"capable", "broken", "legacy"} }
+
+	out := &bytes.Buffer{}
+	err := printDrivers(driversCommandLine(map[string]interface{}{"output": "json"}), newDriversAPI(), out)
+	assert.NoError(t, err)
+
+	var infos []driverInfo
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &infos))
+	assert.Equal(t, []driverInfo{
+		{Name: "capable", APIVersion: 1, Capabilities: []drivers.Capability{drivers.CapabilityStartStop, drivers.CapabilityKill}},
+		{Name: "broken", Capabilities: []drivers.Capability{}, Error: "plugin binary not found"},
+		{Name: "legacy", APIVersion: 1, Capabilities: []drivers.Capability{}},
+	}, infos)
+}
+
+func TestCmdDriversText(t *testing.T) {
+	defer func(orig func() []string) { listDriverNames = orig }(listDriverNames)
+	listDriverNames = func() []string { return []string{"capable", "broken"} }
+
+	out := &bytes.Buffer{}
+	err := printDrivers(driversCommandLine(map[string]interface{}{}), newDriversAPI(), out)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "NAME      API VERSION   CAPABILITIES      ERRORS\n"+
+		"capable   1             start-stop,kill   \n"+
+		"broken    -                               plugin binary not found\n", out.String())
+}
+
+func TestCmdDriversClosesPlugins(t *testing.T) {
+	defer func(orig func() []string) { listDriverNames = orig }(listDriverNames)
+	listDriverNames = func() []string { return []string{"closing", "broken"} }
+
+	api := newDriversAPI()
+	driver := &closingDriver{versionedDriver: &versionedDriver{&fakedriver.Driver{}}}
+	api.drivers["closing"] = driver
+
+	assert.NoError(t, printDrivers(driversCommandLine(map[string]interface{}{}), api, &bytes.Buffer{}))
+	assert.Equal(t, 1, driver.closed)
+}
+
+func TestCmdDriversSingleDriver(t *testing.T) {
+	out := &bytes.Buffer{}
+	err := printDrivers(driversCommandLine(map[string]interface{}{"driver": "legacy"}), newDriversAPI(), out)
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "legacy")
+	assert.NotContains(t, out.String(), "capable")
+
+	err = printDrivers(driversCommandLine(map[string]interface{}{"driver": "broken"}), newDriversAPI(), &bytes.Buffer{})
+	assert.EqualError(t, err, "plugin binary not found")
+}
+
+func TestCmdDriversInvalidOutput(t *testing.T) {
+	err := printDrivers(driversCommandLine(map[string]interface{}{"output": "yaml"}), newDriversAPI(), &bytes.Buffer{})
+	assert.Equal(t, errDriversInvalidOutput, err)
+}
+
+func TestCmdDriverInspect(t *testing.T) {
+	api := newDriversAPI()
+	api.drivers["arm"] = &versionedDriver{&fakedriver.Driver{
+		MockCapabilities:  []drivers.Capability{drivers.CapabilitySSH},
+		MockArchitectures: []string{"amd64", "arm64"},
+	}}
+
+	out := &bytes.Buffer{}
+	err := inspectDriver(&commandstest.FakeCommandLine{
+		CliArgs:     []string{"arm"},
+		LocalFlags:  &commandstest.FakeFlagger{Data: map[string]interface{}{}},
+		GlobalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{}},
+	}, api, out)
+	assert.NoError(t, err)
+
+	var info driverInfo
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &info))
+	assert.Equal(t, driverInfo{
+		Name:          "arm",
+		APIVersion:    1,
+		Capabilities:  []drivers.Capability{drivers.CapabilitySSH},
+		Architectures: []string{"amd64", "arm64"},
+	}, info)
+}
+
+func TestCmdDriverInspectFormat(t *testing.T) {
+	out := &bytes.Buffer{}
+	err := inspectDriver(&commandstest.FakeCommandLine{
+		CliArgs:     []string{"capable"},
+		LocalFlags:  &commandstest.FakeFlagger{Data: map[string]interface{}{"format": "{{.Name}} {{.Capabilities}}"}},
+		GlobalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{}},
+	}, newDriversAPI(), out)
+	assert.NoError(t, err)
+	assert.Equal(t, "capable [start-stop kill]\n", out.String())
+}
+
+func TestCmdDriverInspectErrors(t *testing.T) {
+	err := inspectDriver(&commandstest.FakeCommandLine{
+		CliArgs:     []string{},
+		LocalFlags:  &commandstest.FakeFlagger{Data: map[string]interface{}{}},
+		GlobalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{}},
+	}, newDriversAPI(), &bytes.Buffer{})
+	assert.Equal(t, errExpectedOneDriver, err)
+
+	err = inspectDriver(&commandstest.FakeCommandLine{
+		CliArgs:     []string{"broken"},
+		LocalFlags:  &commandstest.FakeFlagger{Data: map[string]interface{}{}},
+		GlobalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{}},
+	}, newDriversAPI(), &bytes.Buffer{})
+	assert.EqualError(t, err, "plugin binary not found")
+}
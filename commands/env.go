@@ -6,18 +6,22 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"text/template"
 
 	"github.com/rancher/machine/commands/mcndirs"
 	"github.com/rancher/machine/libmachine"
 	"github.com/rancher/machine/libmachine/check"
+	"github.com/rancher/machine/libmachine/containerd"
+	"github.com/rancher/machine/libmachine/engine"
+	"github.com/rancher/machine/libmachine/host"
 	"github.com/rancher/machine/libmachine/log"
 	"github.com/rancher/machine/libmachine/shell"
 )
 
 const (
-	envTmpl = `{{ .Prefix }}DOCKER_TLS_VERIFY{{ .Delimiter }}{{ .DockerTLSVerify }}{{ .Suffix }}{{ .Prefix }}DOCKER_HOST{{ .Delimiter }}{{ .DockerHost }}{{ .Suffix }}{{ .Prefix }}DOCKER_CERT_PATH{{ .Delimiter }}{{ .DockerCertPath }}{{ .Suffix }}{{ .Prefix }}DOCKER_MACHINE_NAME{{ .Delimiter }}{{ .MachineName }}{{ .Suffix }}{{ if .ComposePathsVar }}{{ .Prefix }}COMPOSE_CONVERT_WINDOWS_PATHS{{ .Delimiter }}true{{ .Suffix }}{{end}}{{ if .NoProxyVar }}{{ .Prefix }}{{ .NoProxyVar }}{{ .Delimiter }}{{ .NoProxyValue }}{{ .Suffix }}{{end}}{{ .UsageHint }}`
+	envTmpl = `{{ if .ContainerdAddress }}{{ .Prefix }}CONTAINERD_ADDRESS{{ .Delimiter }}{{ .ContainerdAddress }}{{ .Suffix }}{{ else }}{{ .Prefix }}DOCKER_TLS_VERIFY{{ .Delimiter }}{{ .DockerTLSVerify }}{{ .Suffix }}{{ .Prefix }}DOCKER_HOST{{ .Delimiter }}{{ .DockerHost }}{{ .Suffix }}{{ .Prefix }}DOCKER_CERT_PATH{{ .Delimiter }}{{ .DockerCertPath }}{{ .Suffix }}{{ end }}{{ .Prefix }}DOCKER_MACHINE_NAME{{ .Delimiter }}{{ .MachineName }}{{ .Suffix }}{{ if .ComposePathsVar }}{{ .Prefix }}COMPOSE_CONVERT_WINDOWS_PATHS{{ .Delimiter }}true{{ .Suffix }}{{end}}{{ if .HTTPProxyVar }}{{ .Prefix }}{{ .HTTPProxyVar }}{{ .Delimiter }}{{ .HTTPProxyValue }}{{ .Suffix }}{{end}}{{ if .HTTPSProxyVar }}{{ .Prefix }}{{ .HTTPSProxyVar }}{{ .Delimiter }}{{ .HTTPSProxyValue }}{{ .Suffix }}{{end}}{{ if .NoProxyVar }}{{ .Prefix }}{{ .NoProxyVar }}{{ .Delimiter }}{{ .NoProxyValue }}{{ .Suffix }}{{end}}{{ .UsageHint }}`
 )
 
 var (
@@ -37,10 +41,19 @@ type ShellConfig struct {
 	DockerCertPath  string
 	DockerHost      string
 	DockerTLSVerify string
-	UsageHint       string
-	MachineName     string
-	NoProxyVar      string
-	NoProxyValue    string
+	// ContainerdAddress is the local end of the SSH tunnel to the containerd
+	// socket of a machine provisioned with containerd.
+	ContainerdAddress string
+	UsageHint         string
+	MachineName       string
+	NoProxyVar        string
+	NoProxyValue      string
+	// HTTPProxyVar and HTTPSProxyVar are set with the proxy of the engine
+	// of the machine.
+	HTTPProxyVar    string
+	HTTPProxyValue  string
+	HTTPSProxyVar   string
+	HTTPSProxyValue string
 	ComposePathsVar bool
 }
 
@@ -84,22 +97,31 @@ func shellCfgSet(c CommandLine, api libmachine.API) (*ShellConfig, error) {
 		return nil, err
 	}
 
-	dockerHost, _, err := check.DefaultConnChecker.Check(host, c.Bool("swarm"))
-	if err != nil {
-		return nil, fmt.Errorf("Error checking TLS connection: %s", err)
-	}
-
 	userShell, err := getShell(c.String("shell"))
 	if err != nil {
 		return nil, err
 	}
 
 	shellCfg := &ShellConfig{
-		DockerCertPath:  filepath.Join(mcndirs.GetMachineDir(), host.Name),
-		DockerHost:      dockerHost,
-		DockerTLSVerify: "1",
-		UsageHint:       defaultUsageHinter.GenerateUsageHint(userShell, os.Args),
-		MachineName:     host.Name,
+		UsageHint:   defaultUsageHinter.GenerateUsageHint(userShell, os.Args),
+		MachineName: host.Name,
+	}
+
+	if usesContainerd(host) {
+		shellCfg.ContainerdAddress = filepath.Join(mcndirs.GetMachineDir(), host.Name, "containerd.sock")
+		hint, err := containerdTunnelHint(host, userShell, shellCfg.ContainerdAddress)
+		if err != nil {
+			return nil, err
+		}
+		shellCfg.UsageHint = hint + shellCfg.UsageHint
+	} else {
+		dockerHost, _, err := check.DefaultConnChecker.Check(host, c.Bool("swarm"))
+		if err != nil {
+			return nil, fmt.Errorf("Error checking TLS connection: %s", err)
+		}
+		shellCfg.DockerCertPath = filepath.Join(mcndirs.GetMachineDir(), host.Name)
+		shellCfg.DockerHost = dockerHost
+		shellCfg.DockerTLSVerify = "1"
 	}
 
 	if c.Bool("no-proxy") {
@@ -110,18 +132,14 @@ func shellCfgSet(c CommandLine, api libmachine.API) (*ShellConfig, error) {
 
 		noProxyVar, noProxyValue := findNoProxyFromEnv()
 
-		// add the docker host to the no_proxy list idempotently
-		switch {
-		case noProxyValue == "":
-			noProxyValue = ip
-		case strings.Contains(noProxyValue, ip):
-		//ip already in no_proxy list, nothing to do
-		default:
-			noProxyValue = fmt.Sprintf("%s,%s", noProxyValue, ip)
-		}
-
 		shellCfg.NoProxyVar = noProxyVar
-		shellCfg.NoProxyValue = noProxyValue
+		shellCfg.NoProxyValue = addNoProxy(noProxyValue, ip)
+	}
+
+	if c.Bool("proxy") {
+		if err := setProxyVars(shellCfg, host); err != nil {
+			return nil, err
+		}
 	}
 
 	if runtimeOS() == "windows" {
@@ -176,6 +194,14 @@ func shellCfgUnset(c CommandLine, api libmachine.API) (*ShellConfig, error) {
 		shellCfg.NoProxyVar, shellCfg.NoProxyValue = findNoProxyFromEnv()
 	}
 
+	if c.Bool("proxy") {
+		shellCfg.HTTPProxyVar = "HTTP_PROXY"
+		shellCfg.HTTPSProxyVar = "HTTPS_PROXY"
+		if shellCfg.NoProxyVar == "" {
+			shellCfg.NoProxyVar = "NO_PROXY"
+		}
+	}
+
 	switch userShell {
 	case "fish":
 		shellCfg.Prefix = "set -e "
@@ -216,6 +242,44 @@ func executeTemplateStdout(shellCfg *ShellConfig) error {
 	return tmpl.Execute(os.Stdout, shellCfg)
 }
 
+func usesContainerd(h *host.Host) bool {
+	return h.HostOptions != nil && h.HostOptions.ProvisionEngine == host.ProvisionEngineContainerd
+}
+
+// containerdTunnelHint returns the comment giving the ssh command forwarding
+// address to the containerd socket of the machine.
+func containerdTunnelHint(h *host.Host, userShell, address string) (string, error) {
+	hostname, err := h.Driver.GetSSHHostname()
+	if err != nil {
+		return "", err
+	}
+	port, err := h.Driver.GetSSHPort()
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"ssh", "-nNT", "-o", "StreamLocalBindUnlink=yes", "-p", strconv.Itoa(port)}
+	if keyPath := h.Driver.GetSSHKeyPath(); keyPath != "" {
+		args = append(args, "-i", keyPath)
+	}
+	args = append(args, "-L", address+":"+containerd.SocketPath, fmt.Sprintf("%s@%s", h.Driver.GetSSHUsername(), hostname))
+
+	comment := shellComment(userShell)
+	return fmt.Sprintf("%s Run this command to open the tunnel to containerd: \n%s %s\n", comment, comment, strings.Join(args, " ")), nil
+}
+
+func shellComment(userShell string) string {
+	switch userShell {
+	case "cmd":
+		return "REM"
+	case "emacs":
+		return ";;"
+	case "tcsh":
+		return ":"
+	}
+	return "#"
+}
+
 func getShell(userShell string) (string, error) {
 	if userShell != "" {
 		return userShell, nil
@@ -223,6 +287,56 @@ func getShell(userShell string) (string, error) {
 	return shell.Detect()
 }
 
+// setProxyVars sets the proxy variables of the shell to the proxy of the
+// engine of the machine, adding the machine to the hosts reached without it.
+func setProxyVars(shellCfg *ShellConfig, h *host.Host) error {
+	var engineOptions *engine.Options
+	if h.HostOptions != nil {
+		engineOptions = h.HostOptions.EngineOptions
+	}
+	if engineOptions == nil || (engineOptions.HTTPProxy == "" && engineOptions.HTTPSProxy == "") {
+		return fmt.Errorf("machine %q has no proxy, it was created without --engine-http-proxy or --engine-https-proxy", h.Name)
+	}
+
+	ip, err := h.Driver.GetIP()
+	if err != nil {
+		return fmt.Errorf("Error getting host IP: %s", err)
+	}
+
+	if engineOptions.HTTPProxy != "" {
+		shellCfg.HTTPProxyVar, shellCfg.HTTPProxyValue = "HTTP_PROXY", engineOptions.HTTPProxy
+	}
+	if engineOptions.HTTPSProxy != "" {
+		shellCfg.HTTPSProxyVar, shellCfg.HTTPSProxyValue = "HTTPS_PROXY", engineOptions.HTTPSProxy
+	}
+
+	noProxyValue := engineOptions.NoProxy
+	if shellCfg.NoProxyVar == "" {
+		shellCfg.NoProxyVar = "NO_PROXY"
+	} else {
+		noProxyValue = shellCfg.NoProxyValue
+		for _, noProxy := range strings.Split(engineOptions.NoProxy, ",") {
+			noProxyValue = addNoProxy(noProxyValue, noProxy)
+		}
+	}
+	shellCfg.NoProxyValue = addNoProxy(noProxyValue, ip)
+	return nil
+}
+
+// addNoProxy adds the host to the no_proxy list idempotently.
+func addNoProxy(noProxyValue, noProxy string) string {
+	switch {
+	case noProxy == "":
+		return noProxyValue
+	case noProxyValue == "":
+		return noProxy
+	case strings.Contains(noProxyValue, noProxy):
+		// already in no_proxy list, nothing to do
+		return noProxyValue
+	}
+	return fmt.Sprintf("%s,%s", noProxyValue, noProxy)
+}
+
 func findNoProxyFromEnv() (string, string) {
 	// first check for an existing lower case no_proxy var
 	noProxyVar := "no_proxy"
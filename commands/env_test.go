@@ -8,9 +8,12 @@ import (
 	"github.com/rancher/machine/commands/commandstest"
 	"github.com/rancher/machine/commands/mcndirs"
 	"github.com/rancher/machine/drivers/fakedriver"
+	"github.com/rancher/machine/drivers/generic"
 	"github.com/rancher/machine/libmachine"
 	"github.com/rancher/machine/libmachine/auth"
 	"github.com/rancher/machine/libmachine/check"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/engine"
 	"github.com/rancher/machine/libmachine/host"
 	"github.com/rancher/machine/libmachine/libmachinetest"
 	"github.com/rancher/machine/libmachine/state"
@@ -127,6 +130,46 @@ func TestShellCfgSet(t *testing.T) {
 			expectedShellCfg: nil,
 			expectedErr:      ErrNoDefault,
 		},
+		{
+			description: "bash shell set happy path for a containerd machine",
+			commandLine: &commandstest.FakeCommandLine{
+				CliArgs: []string{"quux"},
+				LocalFlags: &commandstest.FakeFlagger{
+					Data: map[string]interface{}{
+						"shell":    "bash",
+						"swarm":    false,
+						"no-proxy": false,
+					},
+				},
+			},
+			api: &libmachinetest.FakeAPI{
+				Hosts: []*host.Host{
+					{
+						Name: "quux",
+						Driver: &generic.Driver{BaseDriver: &drivers.BaseDriver{
+							IPAddress:  "1.2.3.4",
+							SSHUser:    "ubuntu",
+							SSHPort:    22,
+							SSHKeyPath: "/keys/id_rsa",
+						}},
+						HostOptions: &host.Options{
+							ProvisionEngine: host.ProvisionEngineContainerd,
+						},
+					},
+				},
+			},
+			expectedShellCfg: &ShellConfig{
+				Prefix:            "export ",
+				Delimiter:         "=\"",
+				Suffix:            "\"\n",
+				ContainerdAddress: filepath.Join(mcndirs.GetMachineDir(), "quux", "containerd.sock"),
+				UsageHint: "# Run this command to open the tunnel to containerd: \n# ssh -nNT -o StreamLocalBindUnlink=yes -p 22 -i /keys/id_rsa -L " +
+					filepath.Join(mcndirs.GetMachineDir(), "quux", "containerd.sock") + ":/run/containerd/containerd.sock ubuntu@1.2.3.4\n" + usageHint,
+				MachineName:     "quux",
+				ComposePathsVar: isRuntimeWindows,
+			},
+			expectedErr: nil,
+		},
 		{
 			description: "bash shell set happy path without any flags set",
 			commandLine: &commandstest.FakeCommandLine{
@@ -439,6 +482,56 @@ func TestShellCfgSet(t *testing.T) {
 			noProxyValue: "192.168.59.1",
 			expectedErr:  nil,
 		},
+		{
+			description: "bash shell set happy path with --proxy flag",
+			commandLine: &commandstest.FakeCommandLine{
+				CliArgs: []string{"quux"},
+				LocalFlags: &commandstest.FakeFlagger{
+					Data: map[string]interface{}{
+						"shell": "bash",
+						"swarm": false,
+						"proxy": true,
+					},
+				},
+			},
+			api: &libmachinetest.FakeAPI{
+				Hosts: []*host.Host{
+					{
+						Name: "quux",
+						Driver: &fakedriver.Driver{
+							MockState: state.Running,
+							MockIP:    "1.2.3.4",
+						},
+						HostOptions: &host.Options{
+							EngineOptions: &engine.Options{
+								HTTPProxy: "http://proxy.example.com:3128",
+								NoProxy:   "registry.example.com",
+							},
+						},
+					},
+				},
+			},
+			connChecker: &FakeConnChecker{
+				DockerHost:  "tcp://1.2.3.4:2376",
+				AuthOptions: nil,
+				Err:         nil,
+			},
+			expectedShellCfg: &ShellConfig{
+				Prefix:          "export ",
+				Delimiter:       "=\"",
+				Suffix:          "\"\n",
+				DockerCertPath:  filepath.Join(mcndirs.GetMachineDir(), "quux"),
+				DockerHost:      "tcp://1.2.3.4:2376",
+				DockerTLSVerify: "1",
+				UsageHint:       usageHint,
+				HTTPProxyVar:    "HTTP_PROXY",
+				HTTPProxyValue:  "http://proxy.example.com:3128",
+				NoProxyVar:      "NO_PROXY",
+				NoProxyValue:    "registry.example.com,1.2.3.4",
+				MachineName:     "quux",
+				ComposePathsVar: isRuntimeWindows,
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -7,6 +7,9 @@ import (
 	"text/template"
 
 	"github.com/rancher/machine/libmachine"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/host"
+	"github.com/rancher/machine/libmachine/log"
 )
 
 var funcMap = template.FuncMap{
@@ -20,6 +23,31 @@ var funcMap = template.FuncMap{
 	},
 }
 
+// inspectedHost is the stored host with the addresses, tags and price its
+// driver reports, so that they show the same for every driver.
+type inspectedHost struct {
+	*host.Host
+	Addresses []drivers.NetworkAddress `json:",omitempty"`
+	Tags      map[string]string        `json:",omitempty"`
+	Cost      *drivers.CostEstimate    `json:",omitempty"`
+}
+
+func inspectHost(h *host.Host) inspectedHost {
+	addrs, err := drivers.GetIPs(h.Driver)
+	if err != nil && err != drivers.ErrAddressKindsNotReported {
+		log.Debugf("Error getting the addresses of %q: %s", h.Name, err)
+	}
+	tags, err := drivers.GetTags(h.Driver)
+	if err != nil && err != drivers.ErrTagsNotReported {
+		log.Debugf("Error getting the tags of %q: %s", h.Name, err)
+	}
+	cost, err := drivers.EstimateCost(h.Driver)
+	if err != nil && err != drivers.ErrCostNotSupported {
+		log.Debugf("Error estimating the cost of %q: %s", h.Name, err)
+	}
+	return inspectedHost{Host: h, Addresses: addrs, Tags: tags, Cost: cost}
+}
+
 func cmdInspect(c CommandLine, api libmachine.API) error {
 	if len(c.Args()) > 1 {
 		c.ShowHelp()
@@ -44,7 +72,7 @@ func cmdInspect(c CommandLine, api libmachine.API) error {
 			return fmt.Errorf("template parsing error: %v", err)
 		}
 
-		jsonHost, err := json.Marshal(host)
+		jsonHost, err := json.Marshal(inspectHost(host))
 		if err != nil {
 			return err
 		}
@@ -60,7 +88,7 @@ func cmdInspect(c CommandLine, api libmachine.API) error {
 
 		os.Stdout.Write([]byte{'\n'})
 	} else {
-		prettyJSON, err := json.MarshalIndent(host, "", "    ")
+		prettyJSON, err := json.MarshalIndent(inspectHost(host), "", "    ")
 		if err != nil {
 			return err
 		}
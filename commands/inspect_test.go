@@ -4,8 +4,12 @@ import (
 	"testing"
 
 	"github.com/rancher/machine/commands/commandstest"
+	"github.com/rancher/machine/drivers/fakedriver"
 	"github.com/rancher/machine/libmachine"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/host"
 	"github.com/rancher/machine/libmachine/libmachinetest"
+	"github.com/rancher/machine/libmachine/state"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -29,3 +33,90 @@ func TestCmdInspect(t *testing.T) {
 		assert.Equal(t, tc.expectedErr, err)
 	}
 }
+
+func TestCmdInspectAddresses(t *testing.T) {
+	stdoutGetter := commandstest.NewStdoutGetter()
+	defer stdoutGetter.Stop()
+
+	commandLine := &commandstest.FakeCommandLine{
+		CliArgs: []string{"multi"},
+		LocalFlags: &commandstest.FakeFlagger{
+			Data: map[string]interface{}{"format": "{{.Name}} {{json .Addresses}}"},
+		},
+	}
+	api := &libmachinetest.FakeAPI{
+		Hosts: []*host.Host{
+			{
+				Name: "multi",
+				Driver: &fakedriver.NetworkDriver{
+					Driver: &fakedriver.Driver{MockState: state.Running},
+					MockIPs: []drivers.NetworkAddress{
+						{Kind: drivers.AddressPublic, Address: "5.6.7.8"},
+						{Kind: drivers.AddressPrivate, Address: "10.0.0.5", Interface: "eth1"},
+					},
+				},
+			},
+		},
+	}
+
+	err := cmdInspect(commandLine, api)
+
+	assert.NoError(t, err)
+	assert.Equal(t, `multi [{"Address":"5.6.7.8","Kind":"public"},{"Address":"10.0.0.5","Interface":"eth1","Kind":"private"}]`+"\n", stdoutGetter.Output())
+}
+
+func TestCmdInspectTags(t *testing.T) {
+	stdoutGetter := commandstest.NewStdoutGetter()
+	defer stdoutGetter.Stop()
+
+	commandLine := &commandstest.FakeCommandLine{
+		CliArgs: []string{"tagged"},
+		LocalFlags: &commandstest.FakeFlagger{
+			Data: map[string]interface{}{"format": "{{json .Tags}}"},
+		},
+	}
+	api := &libmachinetest.FakeAPI{
+		Hosts: []*host.Host{
+			{
+				Name: "tagged",
+				Driver: &fakedriver.TaggedDriver{
+					Driver:   &fakedriver.Driver{},
+					MockTags: map[string]string{"env": "prod", "team": "infra"},
+				},
+			},
+		},
+	}
+
+	err := cmdInspect(commandLine, api)
+
+	assert.NoError(t, err)
+	assert.Equal(t, `{"env":"prod","team":"infra"}`+"\n", stdoutGetter.Output())
+}
+
+func TestCmdInspectCost(t *testing.T) {
+	stdoutGetter := commandstest.NewStdoutGetter()
+	defer stdoutGetter.Stop()
+
+	commandLine := &commandstest.FakeCommandLine{
+		CliArgs: []string{"priced"},
+		LocalFlags: &commandstest.FakeFlagger{
+			Data: map[string]interface{}{"format": "{{json .Cost}}"},
+		},
+	}
+	api := &libmachinetest.FakeAPI{
+		Hosts: []*host.Host{
+			{
+				Name: "priced",
+				Driver: &fakedriver.PricedDriver{
+					Driver:   &fakedriver.Driver{},
+					MockCost: drivers.CostEstimate{Currency: "USD", Hourly: 0.5, Monthly: 365},
+				},
+			},
+		},
+	}
+
+	err := cmdInspect(commandLine, api)
+
+	assert.NoError(t, err)
+	assert.Equal(t, `{"Currency":"USD","Hourly":0.5,"Monthly":365}`+"\n", stdoutGetter.Output())
+}
@@ -1,7 +1,144 @@
 package commands
 
-import "github.com/rancher/machine/libmachine"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/rancher/machine/libmachine"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/persist"
+)
+
+var (
+	errIPConflictingSelectors = errors.New("Error: --all, --public and --private are mutually exclusive")
+	errIPInvalidOutput        = errors.New("Error: --output must be one of \"text\" or \"json\"")
+)
+
+// machineAddresses is the JSON representation of a machine's addresses.
+type machineAddresses struct {
+	Name      string
+	Addresses []drivers.NetworkAddress
+}
 
 func cmdIP(c CommandLine, api libmachine.API) error {
-	return runAction("ip", c, api)
+	all, public, private := c.Bool("all"), c.Bool("public"), c.Bool("private")
+	output := c.String("output")
+
+	if output != "" && output != "text" && output != "json" {
+		return errIPInvalidOutput
+	}
+
+	if !all && !public && !private && output != "json" {
+		return runAction("ip", c, api)
+	}
+
+	selected := 0
+	for _, set := range []bool{all, public, private} {
+		if set {
+			selected++
+		}
+	}
+	if selected > 1 {
+		return errIPConflictingSelectors
+	}
+
+	var kind drivers.AddressKind
+	switch {
+	case public:
+		kind = drivers.AddressPublic
+	case private:
+		kind = drivers.AddressPrivate
+	}
+
+	hostsToLoad := c.Args()
+	if len(hostsToLoad) == 0 {
+		target, err := targetHost(c, api)
+		if err != nil {
+			return err
+		}
+		hostsToLoad = []string{target}
+	}
+
+	hosts, hostsInError := persist.LoadHosts(api, hostsToLoad)
+	if len(hostsInError) > 0 {
+		errs := []error{}
+		for _, err := range hostsInError {
+			errs = append(errs, err)
+		}
+		return consolidateErrs(errs)
+	}
+
+	if len(hosts) == 0 {
+		return ErrHostLoad
+	}
+
+	var (
+		results []machineAddresses
+		errs    []error
+	)
+	for _, h := range hosts {
+		addrs, err := drivers.GetIPs(h.Driver)
+		if err == drivers.ErrAddressKindsNotReported {
+			if kind != "" {
+				errs = append(errs, fmt.Errorf("Error: cannot select %s addresses of %q: %s", kind, h.Name, err))
+				continue
+			}
+			// Without kinds, --all degrades to the single GetIP result.
+			var ip string
+			if ip, err = h.Driver.GetIP(); err == nil {
+				addrs = []drivers.NetworkAddress{{Kind: drivers.AddressPublic, Address: ip}}
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Error getting IP addresses of %q: %s", h.Name, err))
+			continue
+		}
+
+		if kind != "" {
+			addrs = drivers.AddressesOfKind(addrs, kind)
+			if len(addrs) == 0 {
+				errs = append(errs, drivers.ErrAddressKindNotFound{MachineName: h.Name, Kind: kind})
+				continue
+			}
+		}
+
+		results = append(results, machineAddresses{Name: h.Name, Addresses: addrs})
+	}
+
+	if output == "json" {
+		if results == nil {
+			results = []machineAddresses{}
+		}
+		out, err := json.MarshalIndent(results, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	} else {
+		printAddresses(results, kind == "", len(hosts) > 1)
+	}
+
+	if len(errs) > 0 {
+		return consolidateErrs(errs)
+	}
+
+	return nil
+}
+
+// printAddresses prints one address per line. When labeled is set each line
+// carries the address kind, and when named is set the machine name as well.
+func printAddresses(results []machineAddresses, labeled, named bool) {
+	for _, r := range results {
+		for _, addr := range r.Addresses {
+			line := addr.Address
+			if labeled {
+				line = fmt.Sprintf("%s\t%s", addr.Kind, line)
+			}
+			if named {
+				line = fmt.Sprintf("%s\t%s", r.Name, line)
+			}
+			fmt.Println(line)
+		}
+	}
 }
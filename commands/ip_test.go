@@ -1,11 +1,14 @@
 package commands
 
 import (
+	"encoding/json"
+	"errors"
 	"testing"
 
 	"github.com/rancher/machine/commands/commandstest"
 	"github.com/rancher/machine/drivers/fakedriver"
 	"github.com/rancher/machine/libmachine"
+	"github.com/rancher/machine/libmachine/drivers"
 	"github.com/rancher/machine/libmachine/host"
 	"github.com/rancher/machine/libmachine/libmachinetest"
 	"github.com/rancher/machine/libmachine/state"
@@ -77,3 +80,162 @@ func TestCmdIP(t *testing.T) {
 		stdoutGetter.Stop()
 	}
 }
+
+func newIPTestAPI() *libmachinetest.FakeAPI {
+	return &libmachinetest.FakeAPI{
+		Hosts: []*host.Host{
+			{
+				Name: "single",
+				Driver: &fakedriver.Driver{
+					MockState: state.Running,
+					MockIP:    "1.2.3.4",
+				},
+			},
+			{
+				Name: "multi",
+				Driver: &fakedriver.NetworkDriver{
+					Driver: &fakedriver.Driver{
+						MockState: state.Running,
+						MockIP:    "5.6.7.8",
+					},
+					MockIPs: []drivers.NetworkAddress{
+						{Kind: drivers.AddressPublic, Address: "5.6.7.8"},
+						{Kind: drivers.AddressPrivate, Address: "10.0.0.5"},
+						{Kind: drivers.AddressIPv6, Address: "2001:db8::5"},
+					},
+				},
+			},
+			{
+				Name: "noPublic",
+				Driver: &fakedriver.NetworkDriver{
+					Driver: &fakedriver.Driver{
+						MockState: state.Running,
+						MockIP:    "10.0.0.6",
+					},
+					MockIPs: []drivers.NetworkAddress{
+						{Kind: drivers.AddressPrivate, Address: "10.0.0.6"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestCmdIPSelectors(t *testing.T) {
+	testCases := []struct {
+		description string
+		args        []string
+		flags       map[string]interface{}
+		expectedErr error
+		expectedOut string
+	}{
+		{
+			description: "all on multi-address driver",
+			args:        []string{"multi"},
+			flags:       map[string]interface{}{"all": true},
+			expectedOut: "public\t5.6.7.8\nprivate\t10.0.0.5\nipv6\t2001:db8::5\n",
+		},
+		{
+			description: "all degrades to GetIP labeled public",
+			args:        []string{"single"},
+			flags:       map[string]interface{}{"all": true},
+			expectedOut: "public\t1.2.3.4\n",
+		},
+		{
+			description: "all on several machines includes names",
+			args:        []string{"single", "multi"},
+			flags:       map[string]interface{}{"all": true},
+			expectedOut: "single\tpublic\t1.2.3.4\nmulti\tpublic\t5.6.7.8\nmulti\tprivate\t10.0.0.5\nmulti\tipv6\t2001:db8::5\n",
+		},
+		{
+			description: "private on multi-address driver",
+			args:        []string{"multi"},
+			flags:       map[string]interface{}{"private": true},
+			expectedOut: "10.0.0.5\n",
+		},
+		{
+			description: "private on single-address driver",
+			args:        []string{"single"},
+			flags:       map[string]interface{}{"private": true},
+			expectedErr: errors.New(`Error: cannot select private addresses of "single": driver does not report address kinds`),
+		},
+		{
+			description: "public on single-address driver",
+			args:        []string{"single"},
+			flags:       map[string]interface{}{"public": true},
+			expectedErr: errors.New(`Error: cannot select public addresses of "single": driver does not report address kinds`),
+		},
+		{
+			description: "private reports the machines that have one",
+			args:        []string{"multi", "single"},
+			flags:       map[string]interface{}{"private": true},
+			expectedErr: errors.New(`Error: cannot select private addresses of "single": driver does not report address kinds`),
+			expectedOut: "multi\t10.0.0.5\n",
+		},
+		{
+			description: "public on multi-address driver without a public address",
+			args:        []string{"noPublic"},
+			flags:       map[string]interface{}{"public": true},
+			expectedErr: errors.New(`machine "noPublic" has no public address`),
+		},
+		{
+			description: "text output keeps the default format",
+			args:        []string{"multi"},
+			flags:       map[string]interface{}{"output": "text"},
+			expectedOut: "5.6.7.8\n",
+		},
+		{
+			description: "conflicting selectors",
+			args:        []string{"multi"},
+			flags:       map[string]interface{}{"public": true, "private": true},
+			expectedErr: errIPConflictingSelectors,
+		},
+		{
+			description: "invalid output",
+			args:        []string{"multi"},
+			flags:       map[string]interface{}{"output": "yaml"},
+			expectedErr: errIPInvalidOutput,
+		},
+	}
+
+	for _, tc := range testCases {
+		stdoutGetter := commandstest.NewStdoutGetter()
+
+		commandLine := &commandstest.FakeCommandLine{
+			CliArgs:    tc.args,
+			LocalFlags: &commandstest.FakeFlagger{Data: tc.flags},
+		}
+		err := cmdIP(commandLine, newIPTestAPI())
+
+		assert.Equal(t, tc.expectedErr, err, tc.description)
+		assert.Equal(t, tc.expectedOut, stdoutGetter.Output(), tc.description)
+
+		stdoutGetter.Stop()
+	}
+}
+
+func TestCmdIPJSON(t *testing.T) {
+	stdoutGetter := commandstest.NewStdoutGetter()
+	defer stdoutGetter.Stop()
+
+	commandLine := &commandstest.FakeCommandLine{
+		CliArgs: []string{"single", "multi"},
+		LocalFlags: &commandstest.FakeFlagger{
+			Data: map[string]interface{}{"output": "json"},
+		},
+	}
+
+	err := cmdIP(commandLine, newIPTestAPI())
+	assert.NoError(t, err)
+
+	var results []machineAddresses
+	assert.NoError(t, json.Unmarshal([]byte(stdoutGetter.Output()), &results))
+	assert.Equal(t, []machineAddresses{
+		{Name: "single", Addresses: []drivers.NetworkAddress{{Kind: drivers.AddressPublic, Address: "1.2.3.4"}}},
+		{Name: "multi", Addresses: []drivers.NetworkAddress{
+			{Kind: drivers.AddressPublic, Address: "5.6.7.8"},
+			{Kind: drivers.AddressPrivate, Address: "10.0.0.5"},
+			{Kind: drivers.AddressIPv6, Address: "2001:db8::5"},
+		}},
+	}, results)
+}
@@ -310,9 +310,9 @@ func matchesLabel(host *host.Host, labels []string) bool {
 		return true
 	}
 
-	var englabels = make(map[string]string, len(host.HostOptions.EngineOptions.Labels))
+	var englabels = make(map[string]string)
 
-	if host.HostOptions != nil && host.HostOptions.EngineOptions.Labels != nil {
+	if host.HostOptions != nil && host.HostOptions.EngineOptions != nil {
 		for _, s := range host.HostOptions.EngineOptions.Labels {
 			kv := strings.SplitN(s, "=", 2)
 			englabels[kv[0]] = kv[1]
@@ -374,6 +374,14 @@ func attemptGetHostState(h *host.Host, stateQueryChan chan<- HostListItem) {
 	if hostError == drivers.ErrHostIsNotRunning.Error() {
 		hostError = ""
 	}
+	if hostError == "" && h.LifecycleState == host.LifecycleError {
+		hostError = "Creation failed, run 'rm' to clean up"
+	}
+	if hostError == "" {
+		if _, err := drivers.GetHealth(h.Driver); err != nil {
+			hostError = err.Error()
+		}
+	}
 
 	var swarmOptions *swarm.Options
 	var engineOptions *engine.Options
@@ -430,12 +438,17 @@ func getHostState(h *host.Host, hostListItemsChan chan<- HostListItem, timeout t
 
 	// Otherwise, give up after a predetermined duration.
 	case <-time.After(timeout):
-		hostListItemsChan <- HostListItem{
+		hli := HostListItem{
 			Name:         h.Name,
 			DriverName:   h.Driver.DriverName(),
 			State:        state.Timeout,
 			ResponseTime: timeout,
 		}
+		// A hung plugin is the likely reason of the timeout.
+		if _, err := drivers.GetHealth(h.Driver); err != nil {
+			hli.Error = err.Error()
+		}
+		hostListItemsChan <- hli
 	}
 }
 
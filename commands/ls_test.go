@@ -111,6 +111,20 @@ func TestFilterHostsReturnSetLabel(t *testing.T) {
 	assert.EqualValues(t, actual, hosts)
 }
 
+func TestFilterHostsByLabelWithoutEngine(t *testing.T) {
+	opts := FilterOptions{
+		Labels: []string{"com.class.foo=bar"},
+	}
+	hosts := []*host.Host{
+		{
+			Name:        "testhost",
+			DriverName:  "fakedriver",
+			HostOptions: &host.Options{ProvisionEngine: host.ProvisionEngineK3s},
+		},
+	}
+	assert.Empty(t, filterHosts(hosts, opts))
+}
+
 func TestFilterHostsReturnsEmptyGivenEmptyHosts(t *testing.T) {
 	opts := FilterOptions{
 		SwarmName: []string{"foo"},
@@ -494,6 +508,34 @@ func TestGetHostStateError(t *testing.T) {
 	assert.Nil(t, hostItem.SwarmOptions)
 }
 
+// unhealthyDriver is the driver of a plugin which stopped responding.
+type unhealthyDriver struct {
+	*fakedriver.Driver
+}
+
+func (d *unhealthyDriver) Health() (time.Time, error) {
+	return time.Time{}, errors.New("Driver plugin is not responding: context deadline exceeded")
+}
+
+func TestGetHostStateUnhealthyPlugin(t *testing.T) {
+	defer func(versioner mcndockerclient.DockerVersioner) { mcndockerclient.CurrentDockerVersioner = versioner }(mcndockerclient.CurrentDockerVersioner)
+	mcndockerclient.CurrentDockerVersioner = &mcndockerclient.FakeDockerVersioner{Version: "1.9"}
+
+	hosts := []*host.Host{
+		{
+			Name: "foo",
+			Driver: &unhealthyDriver{&fakedriver.Driver{
+				MockState: state.Running,
+			}},
+		},
+	}
+
+	hostItem := getHostListItems(hosts, nil, 10*time.Second)[0]
+
+	assert.Equal(t, state.Running, hostItem.State)
+	assert.Equal(t, "Driver plugin is not responding: context deadline exceeded", hostItem.Error)
+}
+
 func TestGetSomeHostInError(t *testing.T) {
 	defer func(versioner mcndockerclient.DockerVersioner) { mcndockerclient.CurrentDockerVersioner = versioner }(mcndockerclient.CurrentDockerVersioner)
 	mcndockerclient.CurrentDockerVersioner = &mcndockerclient.FakeDockerVersioner{Version: "1.9"}
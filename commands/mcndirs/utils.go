@@ -25,3 +25,7 @@ func GetMachineDir() string {
 func GetMachineCertDir() string {
 	return filepath.Join(GetBaseDir(), "certs")
 }
+
+func GetPluginsDir() string {
+	return filepath.Join(GetBaseDir(), "plugins")
+}
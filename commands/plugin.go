@@ -0,0 +1,54 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/rancher/machine/libmachine"
+	"github.com/rancher/machine/libmachine/drivers/plugin/localbinary"
+)
+
+var (
+	errPluginLsInvalidOutput = errors.New("Error: --output must be one of \"text\" or \"json\"")
+
+	// installedPlugins is swapped out in tests.
+	installedPlugins = localbinary.InstalledPlugins
+)
+
+func cmdPluginLs(c CommandLine, api libmachine.API) error {
+	return printPlugins(c, api, os.Stdout)
+}
+
+func printPlugins(c CommandLine, api libmachine.API, out io.Writer) error {
+	output := c.String("output")
+	if output != "" && output != "text" && output != "json" {
+		return errPluginLsInvalidOutput
+	}
+
+	infos := libmachine.DescribePlugins(api, installedPlugins())
+
+	if output == "json" {
+		data, err := json.MarshalIndent(infos, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, string(data))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 5, 1, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tPATH\tAPI VERSION\tFLAGS\tERRORS")
+	for _, info := range infos {
+		apiVersion, flags := "-", "-"
+		if info.Error == "" {
+			apiVersion = fmt.Sprint(info.APIVersion)
+			flags = fmt.Sprint(len(info.Flags))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", info.DriverName, info.Path, apiVersion, flags, info.Error)
+	}
+	return w.Flush()
+}
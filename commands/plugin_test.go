@@ -0,0 +1,87 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/rancher/machine/drivers/fakedriver"
+	"github.com/rancher/machine/libmachine"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/drivers/plugin/localbinary"
+	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/stretchr/testify/assert"
+)
+
+// flaggedDriver has create flags to describe.
+type flaggedDriver struct {
+	*versionedDriver
+}
+
+func (d *flaggedDriver) GetCreateFlags() []mcnflag.Flag {
+	return []mcnflag.Flag{
+		mcnflag.StringFlag{Name: "hetzner-api-token", EnvVar: "HETZNER_API_TOKEN", Usage: "Project-specific Hetzner API token"},
+	}
+}
+
+func newPluginsAPI() *driversAPI {
+	return &driversAPI{
+		drivers: map[string]drivers.Driver{
+			"/usr/local/bin/docker-machine-driver-hetzner": &flaggedDriver{&versionedDriver{&fakedriver.Driver{}}},
+		},
+	}
+}
+
+func withInstalledPlugins(t *testing.T, plugins ...localbinary.InstalledPlugin) {
+	orig := installedPlugins
+	t.Cleanup(func() { installedPlugins = orig })
+	installedPlugins = func() []localbinary.InstalledPlugin { return plugins }
+}
+
+func TestCmdPluginLsJSON(t *testing.T) {
+	withInstalledPlugins(t,
+		localbinary.InstalledPlugin{DriverName: "hetzner", Path: "/usr/local/bin/docker-machine-driver-hetzner"},
+		localbinary.InstalledPlugin{DriverName: "broken", Path: "/usr/local/bin/docker-machine-driver-broken"})
+
+	out := &bytes.Buffer{}
+	err := printPlugins(driversCommandLine(map[string]interface{}{"output": "json"}), newPluginsAPI(), out)
+	assert.NoError(t, err)
+
+	var infos []libmachine.PluginInfo
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &infos))
+	assert.Equal(t, []libmachine.PluginInfo{
+		{
+			DriverName: "hetzner",
+			Path:       "/usr/local/bin/docker-machine-driver-hetzner",
+			APIVersion: 1,
+			Flags: []mcnflag.Schema{
+				{Name: "hetzner-api-token", Type: "string", Default: "", EnvVar: "HETZNER_API_TOKEN", Description: "Project-specific Hetzner API token"},
+			},
+		},
+		{
+			DriverName: "broken",
+			Path:       "/usr/local/bin/docker-machine-driver-broken",
+			Flags:      []mcnflag.Schema{},
+			Error:      "plugin binary not found",
+		},
+	}, infos)
+}
+
+func TestCmdPluginLsText(t *testing.T) {
+	withInstalledPlugins(t,
+		localbinary.InstalledPlugin{DriverName: "hetzner", Path: "/usr/local/bin/docker-machine-driver-hetzner"},
+		localbinary.InstalledPlugin{DriverName: "broken", Path: "/opt/docker-machine-driver-broken"})
+
+	out := &bytes.Buffer{}
+	err := printPlugins(driversCommandLine(map[string]interface{}{}), newPluginsAPI(), out)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "NAME      PATH                                           API VERSION   FLAGS   ERRORS\n"+
+		"hetzner   /usr/local/bin/docker-machine-driver-hetzner   1             1       \n"+
+		"broken    /opt/docker-machine-driver-broken              -             -       plugin binary not found\n", out.String())
+}
+
+func TestCmdPluginLsInvalidOutput(t *testing.T) {
+	err := printPlugins(driversCommandLine(map[string]interface{}{"output": "yaml"}), newPluginsAPI(), &bytes.Buffer{})
+	assert.Equal(t, errPluginLsInvalidOutput, err)
+}
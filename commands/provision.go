@@ -1,7 +1,46 @@
 package commands
 
-import "github.com/rancher/machine/libmachine"
+import (
+	"github.com/rancher/machine/libmachine"
+	"github.com/rancher/machine/libmachine/persist"
+)
 
 func cmdProvision(c CommandLine, api libmachine.API) error {
+	if c.Bool("resume") {
+		return resumeProvisioning(c, api)
+	}
 	return runAction("provision", c, api)
 }
+
+// resumeProvisioning resumes the provisioning of the machines named on the
+// command line from their last checkpoint.
+func resumeProvisioning(c CommandLine, api libmachine.API) error {
+	hostsToLoad := c.Args()
+	if len(hostsToLoad) == 0 {
+		target, err := targetHost(c, api)
+		if err != nil {
+			return err
+		}
+		hostsToLoad = []string{target}
+	}
+
+	hosts, hostsInError := persist.LoadHosts(api, hostsToLoad)
+	if len(hostsInError) > 0 {
+		errs := []error{}
+		for _, err := range hostsInError {
+			errs = append(errs, err)
+		}
+		return consolidateErrs(errs)
+	}
+
+	errs := []error{}
+	for _, h := range hosts {
+		if err := api.Resume(h); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return consolidateErrs(errs)
+	}
+	return nil
+}
@@ -65,3 +65,19 @@ func TestCmdProvision(t *testing.T) {
 		assert.Equal(t, tc.expectedErr, cmdProvision(tc.commandLine, tc.api))
 	}
 }
+
+func TestCmdProvisionResume(t *testing.T) {
+	commandLine := &commandstest.FakeCommandLine{
+		CliArgs: []string{"foo", "missing"},
+		LocalFlags: &commandstest.FakeFlagger{
+			Data: map[string]interface{}{"resume": true},
+		},
+	}
+	api := &libmachinetest.FakeAPI{
+		Hosts: []*host.Host{{Name: "foo", Driver: &fakedriver.Driver{}}},
+	}
+
+	err := cmdProvision(commandLine, api)
+
+	assert.EqualError(t, err, `Docker machine "missing" does not exist. Use "docker-machine ls" to list machines. Use "docker-machine create" to add a new one.`)
+}
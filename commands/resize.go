@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rancher/machine/libmachine"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/log"
+)
+
+var errExpectedResizeSpec = errors.New("Error: Expected --instance-type, --cpus or --memory")
+
+func cmdResize(c CommandLine, api libmachine.API) error {
+	if len(c.Args()) != 1 {
+		c.ShowHelp()
+		return ErrExpectedOneMachine
+	}
+
+	spec := drivers.ResizeSpec{
+		InstanceType: c.String("instance-type"),
+		CPUs:         c.Int("cpus"),
+		MemoryMB:     c.Int("memory"),
+	}
+	if spec == (drivers.ResizeSpec{}) {
+		c.ShowHelp()
+		return errExpectedResizeSpec
+	}
+
+	h, err := api.Load(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Resizing %q...", h.Name)
+	if err := drivers.Resize(h.Driver, spec); err != nil {
+		return fmt.Errorf("Error resizing %q: %w", h.Name, err)
+	}
+
+	if err := api.Save(h); err != nil {
+		return err
+	}
+
+	log.Info("Resized machines may have new IP addresses. You may need to re-run the `docker-machine env` command.")
+	return nil
+}
@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/rancher/machine/commands/commandstest"
+	"github.com/rancher/machine/drivers/fakedriver"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/host"
+	"github.com/rancher/machine/libmachine/libmachinetest"
+	"github.com/rancher/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCmdResize(t *testing.T) {
+	d := &fakedriver.ResizableDriver{Driver: &fakedriver.Driver{MockState: state.Running}}
+	commandLine := &commandstest.FakeCommandLine{
+		CliArgs: []string{"resized"},
+		LocalFlags: &commandstest.FakeFlagger{
+			Data: map[string]interface{}{"cpus": 4, "memory": 8192},
+		},
+	}
+	api := &libmachinetest.FakeAPI{
+		Hosts: []*host.Host{{Name: "resized", Driver: d}},
+	}
+
+	err := cmdResize(commandLine, api)
+
+	assert.NoError(t, err)
+	assert.Equal(t, drivers.ResizeSpec{CPUs: 4, MemoryMB: 8192}, d.MockSpec)
+	assert.Equal(t, state.Running, d.MockState)
+}
+
+func TestCmdResizeErrors(t *testing.T) {
+	api := &libmachinetest.FakeAPI{
+		Hosts: []*host.Host{{Name: "fixed", Driver: &fakedriver.Driver{}}},
+	}
+
+	err := cmdResize(&commandstest.FakeCommandLine{
+		CliArgs:    []string{"fixed"},
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{}},
+	}, api)
+	assert.Equal(t, errExpectedResizeSpec, err)
+
+	err = cmdResize(&commandstest.FakeCommandLine{
+		CliArgs:    []string{"fixed"},
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{"instance-type": "t3.large"}},
+	}, api)
+	assert.ErrorIs(t, err, drivers.ErrResizeNotSupported)
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/rancher/machine/libmachine"
+	"github.com/rancher/machine/libmachine/drivers"
 	"github.com/rancher/machine/libmachine/log"
 	"github.com/rancher/machine/libmachine/mcnerror"
 )
@@ -73,6 +74,8 @@ func removeRemoteMachine(hostName string, api libmachine.API) error {
 		return loaderr
 	}
 
+	drivers.CloseSSHConnections(hostName)
+
 	err := currentHost.Driver.Remove()
 	if err != nil && !strings.Contains(strings.ToLower(err.Error()), "not found") {
 		return err
@@ -0,0 +1,187 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rancher/machine/libmachine"
+	"github.com/rancher/machine/libmachine/auth"
+	"github.com/rancher/machine/libmachine/host"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/persist"
+)
+
+var (
+	errUnknownCARotation = errors.New(`Error: --ca expects "start", "finish" or "end"`)
+	errOnlyClientWithCA  = errors.New("Error: --only-client cannot be used with --ca")
+	errServerCertOptions = errors.New("Error: --tls-san, --tls-cert-validity and --tls-key-usage need the server certificates to be rotated")
+)
+
+var caRotations = map[string]host.CARotation{
+	"":       host.KeepCA,
+	"start":  host.StartCARotation,
+	"finish": host.FinishCARotation,
+	"end":    host.EndCARotation,
+}
+
+func cmdRotateCerts(c CommandLine, api libmachine.API) error {
+	rotation, ok := caRotations[c.String("ca")]
+	if !ok {
+		return errUnknownCARotation
+	}
+	opts := host.RotateCertsOptions{
+		OnlyClient: c.Bool("only-client"),
+		CA:         rotation,
+	}
+	if opts.OnlyClient && opts.CA != host.KeepCA {
+		return errOnlyClientWithCA
+	}
+
+	// The server certificate options given replace the ones of the
+	// machines, which the later provisionings keep.
+	sans := c.StringSlice("tls-san")
+	serverCertOptions := len(sans) > 0 || c.Int("tls-cert-validity") != 0 || len(c.StringSlice("tls-key-usage")) > 0
+	if serverCertOptions {
+		if opts.OnlyClient || opts.CA == host.EndCARotation {
+			return errServerCertOptions
+		}
+		if err := setServerCertOptions(c, &auth.Options{}); err != nil {
+			return err
+		}
+	}
+
+	hostsToLoad := c.Args()
+	if len(hostsToLoad) == 0 {
+		target, err := targetHost(c, api)
+		if err != nil {
+			return err
+		}
+		hostsToLoad = []string{target}
+	}
+
+	hosts, hostsInError := persist.LoadHosts(api, hostsToLoad)
+	if len(hostsInError) > 0 {
+		errs := []error{}
+		for _, err := range hostsInError {
+			errs = append(errs, err)
+		}
+		return consolidateErrs(errs)
+	}
+
+	// Every machine of a CA, listed or not, goes through each step of its
+	// rotation before the next one.
+	var caHosts []*host.Host
+	if opts.CA != host.KeepCA {
+		var err error
+		if caHosts, err = loadCAHosts(api, hosts); err != nil {
+			return err
+		}
+		for _, caCertPath := range caCertPaths(hosts) {
+			if err := host.CheckCARotation(opts.CA, caCertPath, caHosts); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The machines share the client certificate and the CA, so they are
+	// rotated one at a time, each engine being restarted once.
+	for _, h := range hosts {
+		if serverCertOptions && h.HostOptions.AuthOptions != nil {
+			if len(sans) > 0 {
+				h.HostOptions.AuthOptions.ServerCertSANs = sans
+			}
+			if err := setServerCertOptions(c, h.HostOptions.AuthOptions); err != nil {
+				return err
+			}
+		}
+
+		log.Infof("Rotating the certificates of %q...", h.Name)
+		if err := h.RotateCerts(opts); err != nil {
+			return fmt.Errorf("Error rotating the certificates of %q: %w", h.Name, err)
+		}
+
+		if serverCertOptions || opts.CA != host.KeepCA {
+			if err := api.Save(h); err != nil {
+				return err
+			}
+		}
+	}
+
+	if opts.CA == host.EndCARotation {
+		// The rotation ended for the machines of the CA not listed too.
+		for _, h := range caHosts {
+			if h.HostOptions.CARotation == host.KeepCA {
+				continue
+			}
+			h.HostOptions.CARotation = host.KeepCA
+			if err := api.Save(h); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch opts.CA {
+	case host.StartCARotation:
+		log.Info("Once every machine of the CA trusts the new one, run `docker-machine rotate-certs --ca finish` on them.")
+	case host.FinishCARotation:
+		log.Info("Once every machine of the CA is finished, run `docker-machine rotate-certs --ca end` to stop trusting the previous CA.")
+	}
+	return nil
+}
+
+// loadCAHosts loads the machines of the store sharing a CA with the hosts,
+// the hosts themselves being returned as they are.
+func loadCAHosts(api libmachine.API, hosts []*host.Host) ([]*host.Host, error) {
+	all, hostsInError, err := persist.LoadAllHosts(api)
+	if err != nil {
+		return nil, err
+	}
+	for name, err := range hostsInError {
+		log.Warnf("Machine %q, which cannot be loaded, is not checked for the CA rotation: %s", name, err)
+	}
+
+	loaded := map[string]*host.Host{}
+	for _, h := range hosts {
+		loaded[h.Name] = h
+	}
+	caCerts := caCertPaths(hosts)
+
+	caHosts := []*host.Host{}
+	for _, h := range all {
+		if listed, ok := loaded[h.Name]; ok {
+			h = listed
+		}
+		if h.HostOptions == nil || h.HostOptions.AuthOptions == nil {
+			continue
+		}
+		for _, caCertPath := range caCerts {
+			if h.HostOptions.AuthOptions.CaCertPath == caCertPath {
+				caHosts = append(caHosts, h)
+				break
+			}
+		}
+	}
+	return caHosts, nil
+}
+
+// caCertPaths returns the paths of the CA certificates of the hosts.
+func caCertPaths(hosts []*host.Host) []string {
+	paths := []string{}
+	for _, h := range hosts {
+		if h.HostOptions == nil || h.HostOptions.AuthOptions == nil {
+			continue
+		}
+		path := h.HostOptions.AuthOptions.CaCertPath
+		found := false
+		for _, p := range paths {
+			if p == path {
+				found = true
+				break
+			}
+		}
+		if !found {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
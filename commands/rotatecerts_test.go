@@ -0,0 +1,66 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/rancher/machine/commands/commandstest"
+	"github.com/rancher/machine/drivers/fakedriver"
+	"github.com/rancher/machine/libmachine/auth"
+	"github.com/rancher/machine/libmachine/host"
+	"github.com/rancher/machine/libmachine/libmachinetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCmdRotateCertsErrors(t *testing.T) {
+	api := &libmachinetest.FakeAPI{
+		Hosts: []*host.Host{{Name: "k3s", Driver: &fakedriver.Driver{}, HostOptions: &host.Options{ProvisionEngine: host.ProvisionEngineK3s}}},
+	}
+
+	err := cmdRotateCerts(&commandstest.FakeCommandLine{
+		CliArgs:    []string{"k3s"},
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{"ca": "rotate"}},
+	}, api)
+	assert.Equal(t, errUnknownCARotation, err)
+
+	err = cmdRotateCerts(&commandstest.FakeCommandLine{
+		CliArgs:    []string{"k3s"},
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{"ca": "start", "only-client": true}},
+	}, api)
+	assert.Equal(t, errOnlyClientWithCA, err)
+
+	err = cmdRotateCerts(&commandstest.FakeCommandLine{
+		CliArgs:    []string{"k3s"},
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{"only-client": true, "tls-san": []string{"lb.example.com"}}},
+	}, api)
+	assert.Equal(t, errServerCertOptions, err)
+
+	err = cmdRotateCerts(&commandstest.FakeCommandLine{
+		CliArgs:    []string{"k3s"},
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{}},
+	}, api)
+	assert.EqualError(t, err, `Error rotating the certificates of "k3s": Docker was not provisioned on machine k3s, cannot rotate the certificates`)
+}
+
+func TestCmdRotateCertsChecksTheCARotationOfEveryMachine(t *testing.T) {
+	machine := func(name string, rotation host.CARotation) *host.Host {
+		return &host.Host{Name: name, Driver: &fakedriver.Driver{}, HostOptions: &host.Options{
+			CARotation:  rotation,
+			AuthOptions: &auth.Options{CaCertPath: "/certs/ca.pem"},
+		}}
+	}
+	api := &libmachinetest.FakeAPI{
+		Hosts: []*host.Host{machine("started", host.StartCARotation), machine("unlisted", host.KeepCA)},
+	}
+
+	err := cmdRotateCerts(&commandstest.FakeCommandLine{
+		CliArgs:    []string{"started"},
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{"ca": "finish"}},
+	}, api)
+	assert.EqualError(t, err, "the CA rotation cannot finish before the machines unlisted of the CA /certs/ca.pem start it")
+
+	err = cmdRotateCerts(&commandstest.FakeCommandLine{
+		CliArgs:    []string{"started", "unlisted"},
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{"ca": "end"}},
+	}, api)
+	assert.EqualError(t, err, "the CA rotation cannot end before the machines started, unlisted of the CA /certs/ca.pem finish it")
+}
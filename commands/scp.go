@@ -5,10 +5,17 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
 	"strings"
 
+	"github.com/rancher/machine/libmachine"
+	"github.com/rancher/machine/libmachine/drivers"
 	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/mcnutils"
 	"github.com/rancher/machine/libmachine/persist"
+	"github.com/rancher/machine/libmachine/ssh"
+	"github.com/rancher/machine/libmachine/state"
 )
 
 var (
@@ -53,6 +60,119 @@ func (s *storeHostInfoLoader) load(name string) (HostInfo, error) {
 	return host.Driver, nil
 }
 
+// transferFile copies a single file between the local host and a machine
+// with the SSH client of the machine. It copies nothing, leaving the copy to
+// scp or rsync, when the copy is recursive, a delta one, between machines
+// or as another user than the SSH one of the machine.
+func transferFile(src, dest string, recursive, delta bool, api libmachine.API) (bool, error) {
+	if recursive || delta {
+		return false, nil
+	}
+
+	srcMachine, srcPath, srcOK := parseTransferArg(src)
+	destMachine, destPath, destOK := parseTransferArg(dest)
+	if !srcOK || !destOK || (srcMachine == "") == (destMachine == "") {
+		return false, nil
+	}
+
+	if destMachine != "" {
+		return true, uploadFile(api, srcPath, destMachine, destPath)
+	}
+	return true, downloadFile(api, srcMachine, srcPath, destPath)
+}
+
+// parseTransferArg splits a [machine:]path argument of scp. It is not ok
+// for an argument naming the user.
+func parseTransferArg(arg string) (machine, p string, ok bool) {
+	machine, p, found := strings.Cut(arg, ":")
+	if !found {
+		return "", arg, true
+	}
+	if machine == "localhost" {
+		return "", p, true
+	}
+	return machine, p, !strings.Contains(machine, "@")
+}
+
+// transferClient returns the SSH client of the named machine, which must be
+// running.
+func transferClient(api libmachine.API, name string) (ssh.Client, error) {
+	h, err := api.Load(name)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading host: %s", err)
+	}
+
+	currentState, err := h.Driver.GetState()
+	if err != nil {
+		return nil, err
+	}
+	if currentState != state.Running {
+		return nil, errStateInvalidForSSH{h.Name}
+	}
+
+	return h.CreateSSHClient()
+}
+
+// uploadFile copies the local file src to dest on the machine, into it if
+// it is a directory, like scp does.
+func uploadFile(api libmachine.API, src, machine, dest string) error {
+	client, err := transferClient(api, machine)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("%s is a directory, copy it with --recursive", src)
+	}
+
+	if dest == "" || strings.HasSuffix(dest, "/") || isRemoteDir(client, dest) {
+		dest = path.Join(dest, filepath.Base(src))
+	}
+
+	return client.Upload(f, dest, ssh.FileAttributes{Mode: fi.Mode().Perm()})
+}
+
+// isRemoteDir tells whether p is a directory on the machine.
+func isRemoteDir(client ssh.Client, p string) bool {
+	_, err := client.Output("test -d '" + strings.ReplaceAll(p, "'", `'\''`) + "'")
+	return err == nil
+}
+
+// downloadFile copies the file src of the machine to the local dest, into it
+// if it is a directory, like scp does.
+func downloadFile(api libmachine.API, machine, src, dest string) error {
+	client, err := transferClient(api, machine)
+	if err != nil {
+		return err
+	}
+
+	if fi, err := os.Stat(dest); err == nil && fi.IsDir() {
+		dest = filepath.Join(dest, path.Base(src))
+	}
+
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+
+	if err := client.Download(src, f); err != nil {
+		f.Close()
+		os.Remove(dest)
+		return err
+	}
+	return f.Close()
+}
+
 func getScpCmd(src, dest string, recursive bool, delta bool, quiet bool, hostInfoLoader HostInfoLoader) (*exec.Cmd, error) {
 	var cmdPath string
 	var err error
@@ -109,7 +229,7 @@ func getScpCmd(src, dest string, recursive bool, delta bool, quiet bool, hostInf
 	// TODO: Check that "--progress" flag is available in user's version of rsync.
 	// Use quiet mode as a workaround, if it should happen to not be supported...
 	if delta {
-		sshArgs = append([]string{"-e"}, "ssh "+strings.Join(sshArgs, " "))
+		sshArgs = append([]string{"-e"}, "ssh "+joinRsyncArgs(sshArgs))
 		if !quiet {
 			sshArgs = append([]string{"--progress"}, sshArgs...)
 		}
@@ -167,9 +287,37 @@ func getInfoForScpArg(hostAndPath string, hostInfoLoader HostInfoLoader) (h Host
 		args = append(args, "-o", fmt.Sprintf("IdentityFile=%q", h.GetSSHKeyPath()))
 	}
 
+	// Reach the machine through its bastion and jump hosts, if any.
+	if bd, ok := h.(drivers.DriverWithSSHBastion); ok {
+		bastion, err := bd.GetSSHBastion()
+		if err != nil {
+			return nil, "", "", nil, err
+		}
+		if bastion != nil {
+			sshBinaryPath, err := exec.LookPath("ssh")
+			if err != nil {
+				sshBinaryPath = "ssh"
+			}
+			args = append(args, "-o", "ProxyCommand="+ssh.ProxyCommand(sshBinaryPath, bastion))
+		}
+	}
+
 	return
 }
 
+// joinRsyncArgs joins the ssh arguments into the remote shell command of
+// rsync, which splits it on spaces unless they are quoted.
+func joinRsyncArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if strings.Contains(arg, " ") {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'"'"'`) + "'"
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
 func generateLocationArg(hostInfo HostInfo, user, path string) (string, error) {
 	if hostInfo == nil {
 		return path, nil
@@ -183,6 +331,10 @@ func generateLocationArg(hostInfo HostInfo, user, path string) (string, error) {
 	if user == "" {
 		user = hostInfo.GetSSHUsername()
 	}
+	// scp takes IPv6 literals in brackets, to tell them from the path
+	if hostname = mcnutils.UnbracketHost(hostname); strings.Contains(hostname, ":") {
+		hostname = "[" + hostname + "]"
+	}
 	location := fmt.Sprintf("%s@%s:%s", user, hostname, path)
 	return location, nil
 }
@@ -1,10 +1,20 @@
 package commands
 
 import (
+	"errors"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/rancher/machine/drivers/fakedriver"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/host"
+	"github.com/rancher/machine/libmachine/libmachinetest"
+	"github.com/rancher/machine/libmachine/ssh"
+	"github.com/rancher/machine/libmachine/ssh/sshtest"
+	"github.com/rancher/machine/libmachine/state"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -82,6 +92,35 @@ func TestGetInfoForRemoteScpArg(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+type driverHostInfoLoader struct {
+	driver drivers.Driver
+}
+
+func (l *driverHostInfoLoader) load(name string) (HostInfo, error) {
+	return l.driver, nil
+}
+
+func TestGetInfoForScpArgThroughJumpHosts(t *testing.T) {
+	hostInfoLoader := driverHostInfoLoader{&fakedriver.Driver{
+		BaseDriver: &drivers.BaseDriver{
+			SSHJumpHosts: []string{"jump@bastion.example.com:2222"},
+		},
+	}}
+
+	_, _, _, opts, err := getInfoForScpArg("myfunhost:/home/docker/foo", &hostInfoLoader)
+	assert.NoError(t, err)
+	assert.Len(t, opts, 2)
+	assert.Equal(t, "-o", opts[0])
+	assert.True(t, strings.HasPrefix(opts[1], "ProxyCommand="))
+	assert.True(t, strings.HasSuffix(opts[1], " -p 2222 -W %h:%p jump@bastion.example.com"))
+}
+
+func TestJoinRsyncArgs(t *testing.T) {
+	args := []string{"-o", "Port=22", "-o", "ProxyCommand=ssh -o ProxyCommand='ssh -W %%h:%%p a' -W %h:%p b"}
+
+	assert.Equal(t, `-o Port=22 -o 'ProxyCommand=ssh -o ProxyCommand='"'"'ssh -W %%h:%%p a'"'"' -W %h:%p b'`, joinRsyncArgs(args))
+}
+
 func TestHostLocation(t *testing.T) {
 	arg, err := generateLocationArg(nil, "user1", "/home/docker/foo")
 
@@ -106,6 +145,18 @@ func TestRemoteLocation(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestRemoteLocationIPv6(t *testing.T) {
+	hostInfo := MockHostInfo{
+		ip:          "2001:db8::1",
+		sshUsername: "root",
+	}
+
+	arg, err := generateLocationArg(&hostInfo, "", "/home/docker/foo")
+
+	assert.Equal(t, "root@[2001:db8::1]:/home/docker/foo", arg)
+	assert.NoError(t, err)
+}
+
 func TestGetScpCmd(t *testing.T) {
 	hostInfoLoader := MockHostInfoLoader{MockHostInfo{
 		ip:          "12.34.56.78",
@@ -177,3 +228,60 @@ func TestGetScpCmdWithDelta(t *testing.T) {
 	assert.Equal(t, expectedCmd, cmd)
 	assert.NoError(t, err)
 }
+
+func TestTransferFile(t *testing.T) {
+	client := &sshtest.FakeClient{
+		Outputs: map[string]sshtest.CmdResult{
+			"test -d '/etc/hostname'": {Err: errors.New("exit status 1")},
+		},
+	}
+	host.SetSSHClientCreator(&FakeSSHClientCreator{client: client})
+	defer host.SetSSHClientCreator(&host.StandardSSHClientCreator{})
+
+	api := &libmachinetest.FakeAPI{
+		Hosts: []*host.Host{
+			{
+				Name: "default",
+				Driver: &fakedriver.Driver{
+					MockState: state.Running,
+				},
+			},
+		},
+	}
+
+	dir := t.TempDir()
+	local := filepath.Join(dir, "hostname")
+	assert.NoError(t, os.WriteFile(local, []byte("box\n"), 0640))
+
+	copied, err := transferFile(local, "default:/tmp/", false, false, api)
+	assert.True(t, copied)
+	assert.NoError(t, err)
+	assert.Equal(t, "box\n", client.Files["/tmp/hostname"])
+	assert.Equal(t, ssh.FileAttributes{Mode: 0640}, client.FileAttributes["/tmp/hostname"])
+
+	copied, err = transferFile(local, "default:/etc/hostname", false, false, api)
+	assert.True(t, copied)
+	assert.NoError(t, err)
+	assert.Equal(t, "box\n", client.Files["/etc/hostname"])
+
+	copied, err = transferFile("default:/tmp/hostname", filepath.Join(dir, "downloaded"), false, false, api)
+	assert.True(t, copied)
+	assert.NoError(t, err)
+	content, err := os.ReadFile(filepath.Join(dir, "downloaded"))
+	assert.NoError(t, err)
+	assert.Equal(t, "box\n", string(content))
+
+	for _, args := range [][]string{
+		{local, "default:/tmp/", "recursive"},
+		{local, "default:/tmp/", "delta"},
+		{local, "root@default:/tmp/"},
+		{"default:/tmp/hostname", "other:/tmp/"},
+		{local, filepath.Join(dir, "copy")},
+	} {
+		recursive := len(args) == 3 && args[2] == "recursive"
+		delta := len(args) == 3 && args[2] == "delta"
+		copied, err := transferFile(args[0], args[1], recursive, delta, api)
+		assert.False(t, copied, args)
+		assert.NoError(t, err)
+	}
+}
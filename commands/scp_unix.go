@@ -16,6 +16,10 @@ func cmdScp(c CommandLine, api libmachine.API) error {
 	src := args[0]
 	dest := args[1]
 
+	if copied, err := transferFile(src, dest, c.Bool("recursive"), c.Bool("delta"), api); copied {
+		return err
+	}
+
 	hostInfoLoader := &storeHostInfoLoader{api}
 
 	cmd, err := getScpCmd(src, dest, c.Bool("recursive"), c.Bool("delta"), c.Bool("quiet"), hostInfoLoader)
@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rancher/machine/libmachine"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/log"
+)
+
+var (
+	errExpectedSnapshotName = errors.New("Error: Expected a machine name and a snapshot name as arguments")
+	errExpectedSnapshotID   = errors.New("Error: Expected a machine name and a snapshot ID as arguments")
+)
+
+func cmdSnapshotCreate(c CommandLine, api libmachine.API) error {
+	return createSnapshot(c, api, os.Stdout)
+}
+
+// createSnapshot snapshots the machine and prints the ID of the snapshot.
+func createSnapshot(c CommandLine, api libmachine.API, out io.Writer) error {
+	if len(c.Args()) != 2 {
+		c.ShowHelp()
+		return errExpectedSnapshotName
+	}
+
+	h, err := api.Load(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Snapshotting %q...", h.Name)
+	snapshot, err := drivers.CreateSnapshot(h.Driver, c.Args().Get(1))
+	if err != nil {
+		return fmt.Errorf("Error snapshotting %q: %w", h.Name, err)
+	}
+
+	fmt.Fprintln(out, snapshot.ID)
+	return api.Save(h)
+}
+
+func cmdSnapshotLs(c CommandLine, api libmachine.API) error {
+	return listSnapshots(c, api, os.Stdout)
+}
+
+// listSnapshots prints the snapshots of the machine, oldest first.
+func listSnapshots(c CommandLine, api libmachine.API, out io.Writer) error {
+	if len(c.Args()) > 1 {
+		c.ShowHelp()
+		return ErrExpectedOneMachine
+	}
+
+	target, err := targetHost(c, api)
+	if err != nil {
+		return err
+	}
+
+	h, err := api.Load(target)
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := drivers.ListSnapshots(h.Driver)
+	if err != nil {
+		return fmt.Errorf("Error listing the snapshots of %q: %w", h.Name, err)
+	}
+
+	w := tabwriter.NewWriter(out, 5, 1, 3, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tCREATED")
+	for _, snapshot := range snapshots {
+		created := ""
+		if !snapshot.Created.IsZero() {
+			created = snapshot.Created.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", snapshot.ID, snapshot.Name, created)
+	}
+	return w.Flush()
+}
+
+func cmdSnapshotRestore(c CommandLine, api libmachine.API) error {
+	if len(c.Args()) != 2 {
+		c.ShowHelp()
+		return errExpectedSnapshotID
+	}
+
+	h, err := api.Load(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Restoring %q from snapshot %s...", h.Name, c.Args().Get(1))
+	if err := drivers.RestoreSnapshot(h.Driver, c.Args().Get(1)); err != nil {
+		return fmt.Errorf("Error restoring %q: %w", h.Name, err)
+	}
+
+	return api.Save(h)
+}
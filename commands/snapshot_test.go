@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/rancher/machine/commands/commandstest"
+	"github.com/rancher/machine/drivers/fakedriver"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/host"
+	"github.com/rancher/machine/libmachine/libmachinetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newSnapshotAPI(d drivers.Driver) *libmachinetest.FakeAPI {
+	return &libmachinetest.FakeAPI{
+		Hosts: []*host.Host{{Name: "snapshotted", Driver: d}},
+	}
+}
+
+func TestCmdSnapshotCreate(t *testing.T) {
+	d := &fakedriver.SnapshotDriver{Driver: &fakedriver.Driver{}}
+	out := &bytes.Buffer{}
+
+	err := createSnapshot(&commandstest.FakeCommandLine{CliArgs: []string{"snapshotted", "base"}}, newSnapshotAPI(d), out)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "snap-1\n", out.String())
+	assert.Equal(t, []drivers.Snapshot{{ID: "snap-1", Name: "base"}}, d.MockSnapshots)
+}
+
+func TestCmdSnapshotCreateExpectsName(t *testing.T) {
+	d := &fakedriver.SnapshotDriver{Driver: &fakedriver.Driver{}}
+
+	err := createSnapshot(&commandstest.FakeCommandLine{CliArgs: []string{"snapshotted"}}, newSnapshotAPI(d), &bytes.Buffer{})
+
+	assert.Equal(t, errExpectedSnapshotName, err)
+}
+
+func TestCmdSnapshotLs(t *testing.T) {
+	d := &fakedriver.SnapshotDriver{
+		Driver: &fakedriver.Driver{},
+		MockSnapshots: []drivers.Snapshot{
+			{ID: "snap-1", Name: "base", Created: time.Date(2024, 5, 2, 10, 4, 5, 0, time.UTC)},
+			{ID: "snap-2", Name: "configured"},
+		},
+	}
+	out := &bytes.Buffer{}
+
+	err := listSnapshots(&commandstest.FakeCommandLine{CliArgs: []string{"snapshotted"}}, newSnapshotAPI(d), out)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "ID       NAME         CREATED\n"+
+		"snap-1   base         2024-05-02T10:04:05Z\n"+
+		"snap-2   configured   \n", out.String())
+}
+
+func TestCmdSnapshotNotSupported(t *testing.T) {
+	err := listSnapshots(&commandstest.FakeCommandLine{CliArgs: []string{"snapshotted"}}, newSnapshotAPI(&fakedriver.Driver{}), &bytes.Buffer{})
+
+	assert.ErrorIs(t, err, drivers.ErrSnapshotsNotSupported)
+}
+
+func TestCmdSnapshotRestore(t *testing.T) {
+	d := &fakedriver.SnapshotDriver{
+		Driver:        &fakedriver.Driver{},
+		MockSnapshots: []drivers.Snapshot{{ID: "snap-1", Name: "base"}},
+	}
+
+	err := cmdSnapshotRestore(&commandstest.FakeCommandLine{CliArgs: []string{"snapshotted", "snap-1"}}, newSnapshotAPI(d))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "snap-1", d.MockRestored)
+}
@@ -2,9 +2,16 @@ package commands
 
 import (
 	"fmt"
+	"net"
+	"strconv"
+	"strings"
 
 	"github.com/rancher/machine/libmachine"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/ssh"
 	"github.com/rancher/machine/libmachine/state"
+	"github.com/urfave/cli"
 )
 
 type errStateInvalidForSSH struct {
@@ -23,6 +30,31 @@ func cmdSSH(c CommandLine, api libmachine.API) error {
 		return nil
 	}
 
+	var (
+		forwardAgent, refreshHostKey bool
+		forwardings                  []forwarding
+	)
+	for args := c.Args(); ; args = args.Tail() {
+		switch args.First() {
+		case "-A":
+			forwardAgent = true
+			continue
+		case "-L", "-R":
+			f, err := parseForwarding(args.Get(1), args.First() == "-R")
+			if err != nil {
+				return err
+			}
+			forwardings = append(forwardings, f)
+			args = args.Tail()
+			continue
+		case "--refresh-hostkey", "-refresh-hostkey":
+			refreshHostKey = true
+			continue
+		}
+		c = &argsCommandLine{CommandLine: c, args: args}
+		break
+	}
+
 	target, err := targetHost(c, api)
 	if err != nil {
 		return err
@@ -42,10 +74,123 @@ func cmdSSH(c CommandLine, api libmachine.API) error {
 		return errStateInvalidForSSH{host.Name}
 	}
 
+	if refreshHostKey {
+		log.Infof("Forgetting the SSH host key of %s, the new one is recorded", host.Name)
+		if err := drivers.ForgetSSHHostKey(host.Name); err != nil {
+			return err
+		}
+	}
+
 	client, err := host.CreateSSHClient()
 	if err != nil {
 		return err
 	}
 
+	if forwardAgent {
+		agentClient, ok := client.(ssh.AgentForwardingClient)
+		if !ok {
+			return fmt.Errorf("the SSH client of %s cannot forward the ssh-agent", host.Name)
+		}
+		agentClient.ForwardAgent()
+	}
+
+	if len(forwardings) > 0 {
+		tunnelingClient, ok := client.(ssh.TunnelingClient)
+		if !ok {
+			return fmt.Errorf("the SSH client of %s cannot forward ports", host.Name)
+		}
+		for _, f := range forwardings {
+			tunnel, err := f.start(tunnelingClient)
+			if err != nil {
+				return err
+			}
+			defer tunnel.Close()
+		}
+	}
+
 	return client.Shell(c.Args().Tail()...)
 }
+
+// forwarding is a port forwarded by `machine ssh -L` or `-R`, from the
+// listen address to the target one.
+type forwarding struct {
+	remote         bool
+	listen, target string
+}
+
+func (f forwarding) start(client ssh.TunnelingClient) (*ssh.Tunnel, error) {
+	if f.remote {
+		return client.RemoteForward(f.listen, f.target)
+	}
+	return client.LocalForward(f.listen, f.target)
+}
+
+// parseForwarding parses a forwarding in the form of ssh,
+// [bind_address:]port:host:hostport or [bind_address:]port:path, with the
+// IPv6 addresses in brackets. Without bind address, it listens on localhost.
+func parseForwarding(spec string, remote bool) (forwarding, error) {
+	f := forwarding{remote: remote}
+	invalid := fmt.Errorf("invalid forwarding %q, expected [bind_address:]port:host:hostport", spec)
+
+	fields := splitForwarding(spec)
+	switch last := len(fields) - 1; {
+	case last >= 1 && strings.HasPrefix(fields[last], "/"):
+		f.target = fields[last]
+		fields = fields[:last]
+	case last >= 2:
+		if _, err := strconv.Atoi(fields[last]); err != nil {
+			return f, invalid
+		}
+		f.target = net.JoinHostPort(fields[last-1], fields[last])
+		fields = fields[:last-1]
+	default:
+		return f, invalid
+	}
+
+	switch len(fields) {
+	case 1:
+		fields = []string{"localhost", fields[0]}
+	case 2:
+	default:
+		return f, invalid
+	}
+	if _, err := strconv.Atoi(fields[1]); err != nil {
+		return f, invalid
+	}
+	f.listen = net.JoinHostPort(fields[0], fields[1])
+	return f, nil
+}
+
+// splitForwarding splits spec at the colons out of brackets, removing them.
+func splitForwarding(spec string) []string {
+	var (
+		fields    []string
+		field     strings.Builder
+		bracketed bool
+	)
+	for _, r := range spec {
+		switch {
+		case r == '[' && !bracketed:
+			bracketed = true
+		case r == ']' && bracketed:
+			bracketed = false
+		case r == ':' && !bracketed:
+			fields = append(fields, field.String())
+			field.Reset()
+		default:
+			field.WriteRune(r)
+		}
+	}
+	return append(fields, field.String())
+}
+
+// argsCommandLine is a command line with other arguments, like the ones
+// left once the flags of a command skipping their parsing are handled.
+type argsCommandLine struct {
+	CommandLine
+	args cli.Args
+}
+
+func (c *argsCommandLine) Args() cli.Args {
+	return c.args
+}
@@ -28,12 +28,13 @@ func (fsc *FakeSSHClientCreator) CreateSSHClient(d drivers.Driver) (ssh.Client,
 
 func TestCmdSSH(t *testing.T) {
 	testCases := []struct {
-		commandLine   CommandLine
-		api           libmachine.API
-		expectedErr   error
-		helpShown     bool
-		clientCreator host.SSHClientCreator
-		expectedShell []string
+		commandLine    CommandLine
+		api            libmachine.API
+		expectedErr    error
+		helpShown      bool
+		clientCreator  host.SSHClientCreator
+		expectedShell  []string
+		agentForwarded bool
 	}{
 		{
 			commandLine: &commandstest.FakeCommandLine{
@@ -76,6 +77,44 @@ func TestCmdSSH(t *testing.T) {
 			clientCreator: &FakeSSHClientCreator{},
 			expectedShell: []string{"df", "-h"},
 		},
+		{
+			commandLine: &commandstest.FakeCommandLine{
+				CliArgs: []string{"-A", "default", "ssh-add", "-l"},
+			},
+			api: &libmachinetest.FakeAPI{
+				Hosts: []*host.Host{
+					{
+						Name: "default",
+						Driver: &fakedriver.Driver{
+							MockState: state.Running,
+						},
+					},
+				},
+			},
+			expectedErr:    nil,
+			clientCreator:  &FakeSSHClientCreator{},
+			expectedShell:  []string{"ssh-add", "-l"},
+			agentForwarded: true,
+		},
+		{
+			commandLine: &commandstest.FakeCommandLine{
+				CliArgs: []string{"--refresh-hostkey", "-A", "default", "uptime"},
+			},
+			api: &libmachinetest.FakeAPI{
+				Hosts: []*host.Host{
+					{
+						Name: "default",
+						Driver: &fakedriver.Driver{
+							MockState: state.Running,
+						},
+					},
+				},
+			},
+			expectedErr:    nil,
+			clientCreator:  &FakeSSHClientCreator{},
+			expectedShell:  []string{"uptime"},
+			agentForwarded: true,
+		},
 		{
 			commandLine: &commandstest.FakeCommandLine{
 				CliArgs: []string{"default"},
@@ -106,6 +145,26 @@ func TestCmdSSH(t *testing.T) {
 
 		if fcc, ok := tc.clientCreator.(*FakeSSHClientCreator); ok {
 			assert.Equal(t, tc.expectedShell, fcc.client.(*sshtest.FakeClient).ActivatedShell)
+			assert.Equal(t, tc.agentForwarded, fcc.client.(*sshtest.FakeClient).AgentForwarded)
 		}
 	}
 }
+
+func TestParseForwarding(t *testing.T) {
+	f, err := parseForwarding("8080:localhost:80", false)
+	assert.NoError(t, err)
+	assert.Equal(t, forwarding{listen: "localhost:8080", target: "localhost:80"}, f)
+
+	f, err = parseForwarding("0.0.0.0:2375:/var/run/docker.sock", false)
+	assert.NoError(t, err)
+	assert.Equal(t, forwarding{listen: "0.0.0.0:2375", target: "/var/run/docker.sock"}, f)
+
+	f, err = parseForwarding("[::1]:9000:[fe80::1]:9001", true)
+	assert.NoError(t, err)
+	assert.Equal(t, forwarding{remote: true, listen: "[::1]:9000", target: "[fe80::1]:9001"}, f)
+
+	for _, spec := range []string{"", "8080", "8080:localhost", "http:localhost:80", "a:b:8080:localhost:80"} {
+		_, err := parseForwarding(spec, false)
+		assert.Error(t, err, spec)
+	}
+}
@@ -0,0 +1,226 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rancher/machine/libmachine"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/host"
+	"github.com/rancher/machine/libmachine/mcnerror"
+)
+
+var (
+	errValidationFailed        = errors.New("error: machine configuration is not valid")
+	errValidationInvalidOutput = errors.New("error: --output must be one of \"text\" or \"json\"")
+)
+
+// validationCheck is the outcome of a single step of a dry run.
+type validationCheck struct {
+	Name    string
+	Passed  bool
+	Error   string `json:",omitempty"`
+	Warning string `json:",omitempty"`
+}
+
+// validationReport is printed by 'create --dry-run' and 'validate'.
+type validationReport struct {
+	Machine string
+	Driver  string
+	Passed  bool
+	Checks  []validationCheck
+	// Resources are the resources the driver would create.
+	Resources []drivers.PlannedResource `json:",omitempty"`
+	// Cost is the price of the machine the driver would create.
+	Cost *drivers.CostEstimate `json:",omitempty"`
+}
+
+// check runs fn as the named check and records its outcome.
+func (r *validationReport) check(name string, fn func() error) bool {
+	c := validationCheck{Name: name, Passed: true}
+	if err := fn(); err != nil {
+		c.Passed = false
+		c.Error = err.Error()
+		r.Passed = false
+	}
+	r.Checks = append(r.Checks, c)
+	return c.Passed
+}
+
+func (r *validationReport) warn(name, warning string) {
+	r.Checks = append(r.Checks, validationCheck{Name: name, Passed: true, Warning: warning})
+}
+
+func cmdValidate(c CommandLine, api libmachine.API) error {
+	return validateCreate(c, api, os.Stdout)
+}
+
+// validateCreate runs the steps of 'create' that do not touch the store or
+// the machine: flag parsing, the driver's SetConfigFromFlags, PreCreateCheck,
+// PreCreatePlan and EstimateCost. No certificates, keys or ISOs are generated
+// or downloaded.
+func validateCreate(c CommandLine, api libmachine.API, out io.Writer) error {
+	output := c.String("output")
+	if output != "" && output != "text" && output != "json" {
+		return errValidationInvalidOutput
+	}
+
+	if len(c.Args()) > 1 {
+		return fmt.Errorf("invalid arguments: found extra arguments %v", c.Args()[1:])
+	}
+
+	name := c.Args().First()
+	if name == "" {
+		c.ShowHelp()
+		return errNoMachineName
+	}
+
+	driverName := c.String("driver")
+	report := &validationReport{Machine: name, Driver: driverName, Passed: true}
+
+	report.check("machine-name", func() error {
+		if !host.ValidateHostName(name) {
+			return mcnerror.ErrInvalidHostname
+		}
+		return nil
+	})
+
+	report.check("swarm-discovery", func() error {
+		return validateSwarmDiscovery(c.String("swarm-discovery"))
+	})
+
+	report.check("machine-exists", func() error {
+		exists, err := api.Exists(name)
+		if err != nil {
+			return fmt.Errorf("error checking if host exists: %s", err)
+		}
+		if exists {
+			return mcnerror.ErrHostAlreadyExists{Name: name}
+		}
+		return nil
+	})
+
+	var h *host.Host
+	loaded := report.check("driver-plugin", func() error {
+		rawDriver, err := json.Marshal(&drivers.BaseDriver{
+			MachineName: name,
+			StorePath:   c.GlobalString("storage-path"),
+		})
+		if err != nil {
+			return fmt.Errorf("error attempting to marshal bare driver data: %s", err)
+		}
+
+		h, err = api.NewHost(driverName, rawDriver)
+		if err != nil {
+			return fmt.Errorf("error getting new host: %s", err)
+		}
+		return nil
+	})
+
+	configured := loaded && report.check("driver-flags", func() error {
+		driverOpts, err := getDriverOpts(c, h.Driver.GetCreateFlags())
+		if err != nil {
+			return err
+		}
+		return h.Driver.SetConfigFromFlags(driverOpts)
+	})
+
+	if configured {
+		if !drivers.HasCapability(h.Driver, drivers.CapabilityDryRun) {
+			report.warn("pre-create-check", "the driver does not declare a side-effect free pre-create check")
+		}
+		drivers.SetDryRun(h.Driver, true)
+
+		if report.check("pre-create-check", h.Driver.PreCreateCheck) {
+			planCreate(report, h.Driver)
+			estimateCost(report, h.Driver)
+		}
+	}
+
+	if err := printValidationReport(report, output, out); err != nil {
+		return err
+	}
+
+	if !report.Passed {
+		return errValidationFailed
+	}
+
+	return nil
+}
+
+// planCreate records the resources the driver would create, warning about
+// the drivers that cannot tell them.
+func planCreate(report *validationReport, d drivers.Driver) {
+	resources, err := drivers.PreCreatePlan(d)
+	if err == drivers.ErrPlanNotSupported {
+		report.warn("pre-create-plan", err.Error())
+		return
+	}
+
+	if report.check("pre-create-plan", func() error { return err }) {
+		report.Resources = resources
+	}
+}
+
+// estimateCost records the price of the machine the driver would create. A
+// price that cannot be looked up is only warned about, the configuration
+// being valid regardless.
+func estimateCost(report *validationReport, d drivers.Driver) {
+	estimate, err := drivers.EstimateCost(d)
+	if err == drivers.ErrCostNotSupported {
+		return
+	}
+	if err != nil {
+		report.warn("estimate-cost", err.Error())
+		return
+	}
+	report.Cost = estimate
+}
+
+// formatCost formats the hourly and monthly price of the estimate.
+func formatCost(estimate *drivers.CostEstimate) string {
+	cost := fmt.Sprintf("%.4f %s/hour, %.2f %s/month", estimate.Hourly, estimate.Currency, estimate.Monthly, estimate.Currency)
+	if estimate.Source != "" {
+		cost += " (" + estimate.Source + ")"
+	}
+	return cost
+}
+
+func printValidationReport(report *validationReport, output string, out io.Writer) error {
+	if output == "json" {
+		data, err := json.MarshalIndent(report, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, string(data))
+		return nil
+	}
+
+	for _, c := range report.Checks {
+		switch {
+		case !c.Passed:
+			fmt.Fprintf(out, "FAIL  %s: %s\n", c.Name, c.Error)
+		case c.Warning != "":
+			fmt.Fprintf(out, "WARN  %s: %s\n", c.Name, c.Warning)
+		default:
+			fmt.Fprintf(out, "PASS  %s\n", c.Name)
+		}
+	}
+
+	for _, r := range report.Resources {
+		if r.Details != "" {
+			fmt.Fprintf(out, "PLAN  %s %s: %s\n", r.Type, r.Name, r.Details)
+		} else {
+			fmt.Fprintf(out, "PLAN  %s %s\n", r.Type, r.Name)
+		}
+	}
+
+	if report.Cost != nil {
+		fmt.Fprintf(out, "COST  %s\n", formatCost(report.Cost))
+	}
+
+	return nil
+}
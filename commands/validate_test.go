@@ -0,0 +1,209 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/rancher/machine/commands/commandstest"
+	"github.com/rancher/machine/drivers/fakedriver"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/host"
+	"github.com/rancher/machine/libmachine/persist"
+	"github.com/stretchr/testify/assert"
+)
+
+// validateDriver records whether it was put in dry-run mode before its
+// pre-create check ran.
+type validateDriver struct {
+	*fakedriver.Driver
+	preCreateErr   error
+	plan           []drivers.PlannedResource
+	cost           *drivers.CostEstimate
+	costErr        error
+	dryRun         bool
+	checkedDryRun  bool
+	configureCalls int
+}
+
+func (d *validateDriver) SetConfigFromFlags(flags drivers.DriverOptions) error {
+	d.configureCalls++
+	return nil
+}
+
+func (d *validateDriver) SetDryRun(dryRun bool) {
+	d.dryRun = dryRun
+}
+
+func (d *validateDriver) PreCreateCheck() error {
+	d.checkedDryRun = d.dryRun
+	return d.preCreateErr
+}
+
+func (d *validateDriver) PreCreatePlan() ([]drivers.PlannedResource, error) {
+	return d.plan, nil
+}
+
+func (d *validateDriver) EstimateCost() (*drivers.CostEstimate, error) {
+	if d.cost == nil && d.costErr == nil {
+		return nil, drivers.ErrCostNotSupported
+	}
+	return d.cost, d.costErr
+}
+
+// storeAPI is backed by a real file store so tests can check that nothing is
+// written to it.
+type storeAPI struct {
+	persist.Store
+	driver drivers.Driver
+}
+
+func (api *storeAPI) NewHost(driverName string, rawDriver []byte) (*host.Host, error) {
+	if api.driver == nil {
+		return nil, errors.New("plugin binary not found")
+	}
+	return &host.Host{Name: "validated", Driver: api.driver, DriverName: driverName}, nil
+}
+
+func (api *storeAPI) Create(h *host.Host) error {
+	return errors.New("create must not be called during a dry run")
+}
+
+func (api *storeAPI) Resume(h *host.Host) error {
+	return errors.New("resume must not be called during a dry run")
+}
+
+func (api *storeAPI) Close() error {
+	return nil
+}
+
+// validateFlags hides the command flags from getDriverOpts, which would
+// otherwise read them as driver flags.
+type validateFlags struct {
+	*commandstest.FakeCommandLine
+}
+
+func (c validateFlags) FlagNames() []string {
+	return nil
+}
+
+func validateCommandLine(flags map[string]interface{}) CommandLine {
+	return validateFlags{&commandstest.FakeCommandLine{
+		CliArgs:     []string{"validated"},
+		LocalFlags:  &commandstest.FakeFlagger{Data: flags},
+		GlobalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{}},
+	}}
+}
+
+func TestValidateCreateWritesNothing(t *testing.T) {
+	storePath := t.TempDir()
+	d := &validateDriver{
+		Driver: &fakedriver.Driver{
+			MockCapabilities: []drivers.Capability{drivers.CapabilityDryRun},
+		},
+		plan: []drivers.PlannedResource{
+			{Type: "key-pair", Name: "validated"},
+			{Type: "instance", Name: "validated", Details: "t3.micro"},
+		},
+	}
+	api := &storeAPI{Store: persist.NewFilestore(storePath, "", ""), driver: d}
+
+	out := &bytes.Buffer{}
+	err := validateCreate(validateCommandLine(map[string]interface{}{"driver": "fake"}), api, out)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, d.configureCalls)
+	assert.True(t, d.checkedDryRun)
+	assert.Equal(t, "PASS  machine-name\n"+
+		"PASS  swarm-discovery\n"+
+		"PASS  machine-exists\n"+
+		"PASS  driver-plugin\n"+
+		"PASS  driver-flags\n"+
+		"PASS  pre-create-check\n"+
+		"PASS  pre-create-plan\n"+
+		"PLAN  key-pair validated\n"+
+		"PLAN  instance validated: t3.micro\n", out.String())
+
+	entries, err := os.ReadDir(storePath)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestValidateCreateJSONReport(t *testing.T) {
+	d := &validateDriver{Driver: &fakedriver.Driver{}, preCreateErr: errors.New("AMI not found")}
+	api := &storeAPI{Store: persist.NewFilestore(t.TempDir(), "", ""), driver: d}
+
+	out := &bytes.Buffer{}
+	err := validateCreate(validateCommandLine(map[string]interface{}{"driver": "fake", "output": "json"}), api, out)
+
+	assert.Equal(t, errValidationFailed, err)
+
+	var report validationReport
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	assert.False(t, report.Passed)
+	assert.Equal(t, "fake", report.Driver)
+	assert.Equal(t, []validationCheck{
+		{Name: "machine-name", Passed: true},
+		{Name: "swarm-discovery", Passed: true},
+		{Name: "machine-exists", Passed: true},
+		{Name: "driver-plugin", Passed: true},
+		{Name: "driver-flags", Passed: true},
+		{Name: "pre-create-check", Passed: true, Warning: "the driver does not declare a side-effect free pre-create check"},
+		{Name: "pre-create-check", Passed: false, Error: "AMI not found"},
+	}, report.Checks)
+}
+
+func TestValidateCreateMissingDriver(t *testing.T) {
+	api := &storeAPI{Store: persist.NewFilestore(t.TempDir(), "", "")}
+
+	out := &bytes.Buffer{}
+	err := validateCreate(validateCommandLine(map[string]interface{}{"driver": "missing"}), api, out)
+
+	assert.Equal(t, errValidationFailed, err)
+	assert.Contains(t, out.String(), "FAIL  driver-plugin: error getting new host: plugin binary not found\n")
+	assert.NotContains(t, out.String(), "pre-create-check")
+}
+
+func TestCmdCreateDryRun(t *testing.T) {
+	d := &validateDriver{Driver: &fakedriver.Driver{}}
+	api := &storeAPI{Store: persist.NewFilestore(t.TempDir(), "", ""), driver: d}
+
+	err := cmdCreate(validateCommandLine(map[string]interface{}{"dry-run": true, "output": "yaml"}), api)
+
+	assert.Equal(t, errValidationInvalidOutput, err)
+}
+
+func TestValidateCreateWithoutPlan(t *testing.T) {
+	d := &fakedriver.Driver{MockCapabilities: []drivers.Capability{drivers.CapabilityDryRun}}
+	api := &storeAPI{Store: persist.NewFilestore(t.TempDir(), "", ""), driver: d}
+
+	out := &bytes.Buffer{}
+	err := validateCreate(validateCommandLine(map[string]interface{}{"driver": "fake"}), api, out)
+
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "WARN  pre-create-plan: driver does not report the resources it creates\n")
+}
+
+func TestValidateCreateCost(t *testing.T) {
+	d := &validateDriver{
+		Driver: &fakedriver.Driver{MockCapabilities: []drivers.Capability{drivers.CapabilityDryRun}},
+		cost:   &drivers.CostEstimate{Currency: "USD", Hourly: 0.0104, Monthly: 7.592, Source: "price list"},
+	}
+	api := &storeAPI{Store: persist.NewFilestore(t.TempDir(), "", ""), driver: d}
+
+	out := &bytes.Buffer{}
+	err := validateCreate(validateCommandLine(map[string]interface{}{"driver": "fake"}), api, out)
+
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "COST  0.0104 USD/hour, 7.59 USD/month (price list)\n")
+
+	d.cost, d.costErr = nil, errors.New("pricing unavailable")
+	out.Reset()
+	err = validateCreate(validateCommandLine(map[string]interface{}{"driver": "fake"}), api, out)
+
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "pricing unavailable")
+	assert.NotContains(t, out.String(), "COST")
+}
@@ -31,7 +31,7 @@ _docker_machine_machines() {
     _docker_machine_q ls --format '{{.Name}}' "$@"
 }
 
-_docker_machine_drivers() {
+_docker_machine_driver_names() {
     local drivers=(
         amazonec2
         azure
@@ -145,7 +145,7 @@ _docker_machine_config() {
 _docker_machine_create() {
     case "${prev}" in
         --driver|-d)
-            COMPREPLY=($(compgen -W "$(_docker_machine_drivers)" -- "${cur}"))
+            COMPREPLY=($(compgen -W "$(_docker_machine_driver_names)" -- "${cur}"))
             return
             ;;
     esac
@@ -159,6 +159,36 @@ _docker_machine_create() {
     fi
 }
 
+_docker_machine_drivers() {
+    case "${prev}" in
+        --driver|-d)
+            return
+            ;;
+        --output|-o)
+            COMPREPLY=($(compgen -W "text json" -- "${cur}"))
+            return
+            ;;
+    esac
+
+    COMPREPLY=($(compgen -W "--driver -d --output -o --help" -- "${cur}"))
+}
+
+_docker_machine_plugin() {
+    if [[ ${cword} -eq $(( command_pos + 1 )) ]]; then
+        COMPREPLY=($(compgen -W "ls" -- "${cur}"))
+        return
+    fi
+
+    case "${prev}" in
+        --output|-o)
+            COMPREPLY=($(compgen -W "text json" -- "${cur}"))
+            return
+            ;;
+    esac
+
+    COMPREPLY=($(compgen -W "--output -o --help" -- "${cur}"))
+}
+
 _docker_machine_env() {
     case "${prev}" in
         --shell)
@@ -198,8 +228,15 @@ _docker_machine_inspect() {
 }
 
 _docker_machine_ip() {
+    case "${prev}" in
+        --output|-o)
+            COMPREPLY=($(compgen -W "text json" -- "${cur}"))
+            return
+            ;;
+    esac
+
     if [[ "${cur}" == -* ]]; then
-        COMPREPLY=($(compgen -W "--help" -- "${cur}"))
+        COMPREPLY=($(compgen -W "--all -a --public --private --output -o --help" -- "${cur}"))
     else
         COMPREPLY=($(compgen -W "$(_docker_machine_machines)" -- "${cur}"))
     fi
@@ -217,7 +254,7 @@ _docker_machine_ls() {
     local key=$(_docker_machine_map_key_of_current_option '--filter')
     case "$key" in
         driver)
-            COMPREPLY=($(compgen -W "$(_docker_machine_drivers)" -- "${cur##*=}"))
+            COMPREPLY=($(compgen -W "$(_docker_machine_driver_names)" -- "${cur##*=}"))
             return
             ;;
         state)
@@ -348,6 +385,10 @@ _docker_machine_url() {
     fi
 }
 
+_docker_machine_validate() {
+    _docker_machine_create
+}
+
 _docker_machine_version() {
     if [[ "${cur}" == -* ]]; then
         COMPREPLY=($(compgen -W "--help" -- "${cur}"))
@@ -378,9 +419,9 @@ _docker_machine_docker_machine() {
 
 _docker_machine() {
     COMPREPLY=()
-    local commands=(active config create env inspect ip kill ls mount provision regenerate-certs restart rm ssh scp start status stop upgrade url version help)
+    local commands=(active config create drivers env inspect ip kill ls mount plugin provision regenerate-certs restart rm ssh scp start status stop upgrade url validate version help)
 
-    local flags=(--debug --native-ssh --github-api-token --bugsnag-api-token --help --version)
+    local flags=(--debug --log-format --native-ssh --plugin-registry --sandbox-plugins --metrics-addr --github-api-token --bugsnag-api-token --help --version)
     local wants_dir=(--storage-path)
     local wants_file=(--tls-ca-cert --tls-ca-key --tls-client-cert --tls-client-key)
 
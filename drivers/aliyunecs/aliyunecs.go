@@ -0,0 +1,518 @@
+package aliyunecs
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	rpcdriver "github.com/rancher/machine/libmachine/drivers/rpc"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/rancher/machine/libmachine/ssh"
+	"github.com/rancher/machine/libmachine/state"
+)
+
+type Driver struct {
+	*drivers.BaseDriver
+	AccessKeyID        string
+	AccessKeySecret    string
+	InstanceID         string
+	Region             string
+	Zone               string
+	InstanceType       string
+	ImageID            string
+	VpcID              string
+	VSwitchID          string
+	SecurityGroupID    string
+	SystemDiskCategory string
+	SystemDiskSize     int
+	InternetBandwidth  int
+	InternetChargeType string
+	UserDataFile       string
+	Tags               string
+	KeyPairName        string
+	PrivateIPAddress   string
+}
+
+const (
+	defaultSSHPort            = 22
+	defaultSSHUser            = "root"
+	defaultRegion             = "cn-hangzhou"
+	defaultInstanceType       = "ecs.g6.large"
+	defaultImageID            = "ubuntu_22_04_x64_20G_alibase_20240130.vhd"
+	defaultSystemDiskCategory = "cloud_essd"
+	defaultSystemDiskSize     = 40
+	defaultInternetBandwidth  = 1
+	defaultInternetChargeType = "PayByTraffic"
+)
+
+// Capabilities returns the optional operations supported by the driver.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityStartStop,
+		drivers.CapabilityRestart,
+		drivers.CapabilityKill,
+		drivers.CapabilityPrivateIP,
+		drivers.CapabilityCustomSSHPort,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+	}
+}
+
+// GetCreateFlags registers the flags this driver adds to
+// "docker hosts create"
+func (d *Driver) GetCreateFlags() []mcnflag.Flag {
+	return []mcnflag.Flag{
+		mcnflag.StringFlag{
+			EnvVar: "ALIBABA_CLOUD_ACCESS_KEY_ID",
+			Name:   "aliyunecs-access-key-id",
+			Usage:  "Alibaba Cloud AccessKey ID",
+		},
+		mcnflag.StringFlag{
+			EnvVar:    "ALIBABA_CLOUD_ACCESS_KEY_SECRET",
+			Name:      "aliyunecs-access-key-secret",
+			Usage:     "Alibaba Cloud AccessKey secret",
+			Sensitive: true,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "ALIYUNECS_SSH_USER",
+			Name:   "aliyunecs-ssh-user",
+			Usage:  "SSH username",
+			Value:  defaultSSHUser,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "ALIYUNECS_SSH_PORT",
+			Name:   "aliyunecs-ssh-port",
+			Usage:  "SSH port",
+			Value:  defaultSSHPort,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "ALIBABA_CLOUD_REGION_ID",
+			Name:   "aliyunecs-region",
+			Usage:  "ECS region",
+			Value:  defaultRegion,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "ALIYUNECS_ZONE",
+			Name:   "aliyunecs-zone",
+			Usage:  "ECS zone (default the one of the vswitch)",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "ALIYUNECS_INSTANCE_TYPE",
+			Name:   "aliyunecs-instance-type",
+			Usage:  "ECS instance type",
+			Value:  defaultInstanceType,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "ALIYUNECS_IMAGE_ID",
+			Name:   "aliyunecs-image-id",
+			Usage:  "ECS image ID",
+			Value:  defaultImageID,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "ALIYUNECS_VPC_ID",
+			Name:   "aliyunecs-vpc-id",
+			Usage:  "ID of the VPC the vswitch has to be in",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "ALIYUNECS_VSWITCH_ID",
+			Name:   "aliyunecs-vswitch-id",
+			Usage:  "ID of the vswitch of the instance",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "ALIYUNECS_SECURITY_GROUP_ID",
+			Name:   "aliyunecs-security-group-id",
+			Usage:  "ID of the security group of the instance, in the VPC",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "ALIYUNECS_SYSTEM_DISK_CATEGORY",
+			Name:   "aliyunecs-system-disk-category",
+			Usage:  "category of the system disk, e.g. cloud_essd or cloud_efficiency",
+			Value:  defaultSystemDiskCategory,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "ALIYUNECS_SYSTEM_DISK_SIZE",
+			Name:   "aliyunecs-system-disk-size",
+			Usage:  "size in GB of the system disk",
+			Value:  defaultSystemDiskSize,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "ALIYUNECS_INTERNET_MAX_BANDWIDTH",
+			Name:   "aliyunecs-internet-max-bandwidth",
+			Usage:  "maximum outbound internet bandwidth in Mbit/s, 0 for no public IP",
+			Value:  defaultInternetBandwidth,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "ALIYUNECS_INTERNET_CHARGE_TYPE",
+			Name:   "aliyunecs-internet-charge-type",
+			Usage:  "billing of the internet bandwidth, PayByTraffic or PayByBandwidth",
+			Value:  defaultInternetChargeType,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "ALIYUNECS_USERDATA",
+			Name:   "aliyunecs-userdata",
+			Usage:  "path to file with cloud-init user-data",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "ALIYUNECS_TAGS",
+			Name:   "aliyunecs-tags",
+			Usage:  "comma-separated list of key=value tags to apply to the instance",
+		},
+	}
+}
+
+func NewDriver(hostName, storePath string) *Driver {
+	return &Driver{
+		Region:             defaultRegion,
+		InstanceType:       defaultInstanceType,
+		ImageID:            defaultImageID,
+		SystemDiskCategory: defaultSystemDiskCategory,
+		SystemDiskSize:     defaultSystemDiskSize,
+		InternetBandwidth:  defaultInternetBandwidth,
+		InternetChargeType: defaultInternetChargeType,
+		BaseDriver: &drivers.BaseDriver{
+			MachineName: hostName,
+			StorePath:   storePath,
+		},
+	}
+}
+
+func (d *Driver) GetSSHHostname() (string, error) {
+	return d.GetIP()
+}
+
+// DriverName returns the name of the driver
+func (d *Driver) DriverName() string {
+	return "aliyunecs"
+}
+
+// UnmarshalJSON loads driver config from JSON. This function is used by the RPCServerDriver that wraps
+// all drivers as a means of populating an already-initialized driver with new configuration.
+// See `RPCServerDriver.SetConfigRaw`.
+func (d *Driver) UnmarshalJSON(data []byte) error {
+	// Unmarshal driver config into an aliased type to prevent infinite recursion on UnmarshalJSON.
+	type targetDriver Driver
+
+	// Copy data from `d` to `target` before unmarshalling. This will ensure that already-initialized values
+	// from `d` that are left untouched during unmarshal (like functions) are preserved.
+	target := targetDriver(*d)
+
+	if err := json.Unmarshal(data, &target); err != nil {
+		return fmt.Errorf("error unmarshalling driver config from JSON: %w", err)
+	}
+
+	// Copy unmarshalled data back to `d`.
+	*d = Driver(target)
+
+	// Make sure to reload values that are subject to change from envvars and os.Args.
+	driverOpts, err := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	if err != nil {
+		return err
+	}
+	if _, ok := driverOpts.Values["aliyunecs-access-key-secret"]; ok {
+		d.AccessKeySecret = driverOpts.String("aliyunecs-access-key-secret")
+	}
+
+	return nil
+}
+
+func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
+	d.AccessKeyID = flags.String("aliyunecs-access-key-id")
+	d.AccessKeySecret = flags.String("aliyunecs-access-key-secret")
+	d.Region = flags.String("aliyunecs-region")
+	d.Zone = flags.String("aliyunecs-zone")
+	d.InstanceType = flags.String("aliyunecs-instance-type")
+	d.ImageID = flags.String("aliyunecs-image-id")
+	d.VpcID = flags.String("aliyunecs-vpc-id")
+	d.VSwitchID = flags.String("aliyunecs-vswitch-id")
+	d.SecurityGroupID = flags.String("aliyunecs-security-group-id")
+	d.SystemDiskCategory = flags.String("aliyunecs-system-disk-category")
+	d.SystemDiskSize = flags.Int("aliyunecs-system-disk-size")
+	d.InternetBandwidth = flags.Int("aliyunecs-internet-max-bandwidth")
+	d.InternetChargeType = flags.String("aliyunecs-internet-charge-type")
+	d.UserDataFile = flags.String("aliyunecs-userdata")
+	d.Tags = flags.String("aliyunecs-tags")
+	d.SSHUser = flags.String("aliyunecs-ssh-user")
+	d.SSHPort = flags.Int("aliyunecs-ssh-port")
+
+	d.SetSwarmConfigFromFlags(flags)
+
+	if d.AccessKeyID == "" || d.AccessKeySecret == "" {
+		return fmt.Errorf("aliyunecs driver requires the --aliyunecs-access-key-id and --aliyunecs-access-key-secret options")
+	}
+	if d.VSwitchID == "" || d.SecurityGroupID == "" {
+		return fmt.Errorf("aliyunecs driver requires the --aliyunecs-vswitch-id and --aliyunecs-security-group-id options")
+	}
+	if d.InternetChargeType != "PayByTraffic" && d.InternetChargeType != "PayByBandwidth" {
+		return fmt.Errorf("aliyunecs internet charge type must be PayByTraffic or PayByBandwidth, got %q", d.InternetChargeType)
+	}
+	if d.InternetBandwidth < 0 {
+		return fmt.Errorf("aliyunecs internet bandwidth must not be negative, got %d", d.InternetBandwidth)
+	}
+
+	return nil
+}
+
+func (d *Driver) PreCreateCheck() error {
+	if d.UserDataFile != "" {
+		if _, err := os.Stat(d.UserDataFile); os.IsNotExist(err) {
+			return fmt.Errorf("user-data file %s could not be found", d.UserDataFile)
+		}
+	}
+
+	client := d.getClient()
+	vswitch, err := client.GetVSwitch(d.VSwitchID)
+	if err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("aliyunecs vswitch %s doesn't exist in region %s", d.VSwitchID, d.Region)
+		}
+		return err
+	}
+	if d.VpcID != "" && vswitch.VpcID != d.VpcID {
+		return fmt.Errorf("aliyunecs vswitch %s is in VPC %s, not %s", d.VSwitchID, vswitch.VpcID, d.VpcID)
+	}
+	if d.Zone != "" && vswitch.ZoneID != d.Zone {
+		return fmt.Errorf("aliyunecs vswitch %s is in zone %s, not %s", d.VSwitchID, vswitch.ZoneID, d.Zone)
+	}
+
+	if err := client.SecurityGroupExists(d.SecurityGroupID, vswitch.VpcID); err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("aliyunecs security group %s doesn't exist in VPC %s", d.SecurityGroupID, vswitch.VpcID)
+		}
+		return err
+	}
+
+	zones, err := client.Zones()
+	if err != nil {
+		return err
+	}
+	for _, zone := range zones {
+		if zone.ZoneID != vswitch.ZoneID {
+			continue
+		}
+		for _, instanceType := range zone.AvailableInstanceTypes.InstanceTypes {
+			if instanceType == d.InstanceType {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("aliyunecs instance type %s is not available in zone %s", d.InstanceType, vswitch.ZoneID)
+}
+
+func (d *Driver) Create() error {
+	params, err := d.runInstanceParams()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Creating SSH key...")
+
+	d.SSHKeyPath = d.GetSSHKeyPath()
+	if err := ssh.GenerateSSHKey(d.SSHKeyPath); err != nil {
+		return err
+	}
+	publicKey, err := os.ReadFile(d.SSHKeyPath + ".pub")
+	if err != nil {
+		return err
+	}
+
+	client := d.getClient()
+	if err := client.ImportKeyPair(d.MachineName, strings.TrimSpace(string(publicKey))); err != nil {
+		return err
+	}
+	d.KeyPairName = d.MachineName
+	params["KeyPairName"] = d.KeyPairName
+
+	log.Infof("Creating ECS instance...")
+
+	d.InstanceID, err = client.RunInstance(params)
+	if err != nil {
+		return d.removeAfter(err)
+	}
+
+	log.Info("Waiting for the instance to be running...")
+	for {
+		instance, err := client.GetInstance(d.InstanceID)
+		if err != nil {
+			return d.removeAfter(err)
+		}
+
+		d.PrivateIPAddress = instance.PrivateIP()
+		d.IPAddress = instance.PublicIP()
+		if d.InternetBandwidth == 0 {
+			d.IPAddress = d.PrivateIPAddress
+		}
+
+		if instance.Status == "Running" && d.IPAddress != "" {
+			break
+		}
+
+		time.Sleep(5 * time.Second)
+	}
+
+	log.Debugf("Created ECS instance ID %s, IP address %s, Private IP address %s",
+		d.InstanceID,
+		d.IPAddress,
+		d.PrivateIPAddress)
+
+	return nil
+}
+
+// runInstanceParams returns the parameters of the RunInstances call, but
+// the key pair.
+func (d *Driver) runInstanceParams() (map[string]string, error) {
+	params := map[string]string{
+		"InstanceType":            d.InstanceType,
+		"ImageId":                 d.ImageID,
+		"VSwitchId":               d.VSwitchID,
+		"SecurityGroupId":         d.SecurityGroupID,
+		"InstanceName":            d.MachineName,
+		"HostName":                d.MachineName,
+		"SystemDisk.Category":     d.SystemDiskCategory,
+		"SystemDisk.Size":         strconv.Itoa(d.SystemDiskSize),
+		"InternetMaxBandwidthOut": strconv.Itoa(d.InternetBandwidth),
+		"InternetChargeType":      d.InternetChargeType,
+	}
+	if d.Zone != "" {
+		params["ZoneId"] = d.Zone
+	}
+	for i, tag := range d.getTags() {
+		params[fmt.Sprintf("Tag.%d.Key", i+1)] = tag[0]
+		params[fmt.Sprintf("Tag.%d.Value", i+1)] = tag[1]
+	}
+
+	if d.UserDataFile != "" {
+		buf, err := os.ReadFile(d.UserDataFile)
+		if err != nil {
+			return nil, err
+		}
+		params["UserData"] = base64.StdEncoding.EncodeToString(buf)
+	}
+
+	return params, nil
+}
+
+func (d *Driver) removeAfter(err error) error {
+	if removeErr := d.Remove(); removeErr != nil {
+		return fmt.Errorf("failed to create machine due to error: %v. Removing instance: %v", err, removeErr)
+	}
+	return err
+}
+
+func (d *Driver) GetURL() (string, error) {
+	if err := drivers.MustBeRunning(d); err != nil {
+		return "", err
+	}
+
+	ip, err := d.GetIP()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("tcp://%s", net.JoinHostPort(ip, "2376")), nil
+}
+
+// GetIPs returns the public and private addresses of the instance.
+func (d *Driver) GetIPs() ([]drivers.NetworkAddress, error) {
+	instance, err := d.getClient().GetInstance(d.InstanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return instanceAddresses(instance), nil
+}
+
+// instanceAddresses returns the public and private addresses of the instance.
+func instanceAddresses(instance *Instance) []drivers.NetworkAddress {
+	var addrs []drivers.NetworkAddress
+	addrs = drivers.AppendAddress(addrs, drivers.AddressPublic, instance.PublicIP())
+	addrs = drivers.AppendAddress(addrs, drivers.AddressPrivate, instance.PrivateIP())
+	return addrs
+}
+
+func (d *Driver) GetState() (state.State, error) {
+	instance, err := d.getClient().GetInstance(d.InstanceID)
+	if err != nil {
+		if !isNotFound(err) {
+			return state.Error, err
+		}
+		return state.None, fmt.Errorf("machine %v not found", d.MachineName)
+	}
+
+	return instanceState(instance.Status), nil
+}
+
+// instanceState returns the state of an instance of the status.
+func instanceState(status string) state.State {
+	switch status {
+	case "Pending", "Starting":
+		return state.Starting
+	case "Running":
+		return state.Running
+	case "Stopping":
+		return state.Stopping
+	case "Stopped":
+		return state.Stopped
+	}
+	return state.None
+}
+
+func (d *Driver) Start() error {
+	return d.getClient().InstanceAction("StartInstance", d.InstanceID, nil)
+}
+
+func (d *Driver) Stop() error {
+	return d.getClient().InstanceAction("StopInstance", d.InstanceID, nil)
+}
+
+func (d *Driver) Restart() error {
+	return d.getClient().InstanceAction("RebootInstance", d.InstanceID, nil)
+}
+
+func (d *Driver) Kill() error {
+	return d.getClient().InstanceAction("StopInstance", d.InstanceID, map[string]string{"ForceStop": "true"})
+}
+
+func (d *Driver) Remove() error {
+	client := d.getClient()
+	if d.InstanceID != "" {
+		if err := client.InstanceAction("DeleteInstance", d.InstanceID, map[string]string{"Force": "true"}); err != nil {
+			if !isNotFound(err) {
+				return err
+			}
+			log.Infof("ECS instance doesn't exist, assuming it is already deleted")
+		}
+	}
+	if d.KeyPairName != "" {
+		if err := client.DeleteKeyPair(d.KeyPairName); err != nil && !isNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Driver) getClient() *Client {
+	return NewClient(d.AccessKeyID, d.AccessKeySecret, d.Region)
+}
+
+// getTags returns the tags, given as key=value pairs, as pairs.
+func (d *Driver) getTags() [][2]string {
+	var tagList [][2]string
+
+	for _, t := range strings.Split(d.Tags, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(t, "=")
+		tagList = append(tagList, [2]string{strings.TrimSpace(key), strings.TrimSpace(value)})
+	}
+
+	return tagList
+}
@@ -0,0 +1,147 @@
+package aliyunecs
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDriver(storePath string) *Driver {
+	driver := NewDriver("default", storePath)
+	driver.AccessKeyID = "KEY"
+	driver.AccessKeySecret = "SECRET"
+	driver.VSwitchID = "vsw-1"
+	driver.SecurityGroupID = "sg-1"
+	return driver
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	driver := NewDriver("", "")
+
+	// Unmarhsal driver configuration from JSON and args.
+	os.Args = append(os.Args, []string{"--aliyunecs-access-key-secret", "test secret"}...)
+
+	driverBytes, err := json.Marshal(driver)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(driverBytes, driver))
+
+	// Make sure that config has been pulled in from envvars and args.
+	assert.Equal(t, "test secret", driver.AccessKeySecret)
+}
+
+func TestSetConfigFromFlags(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"aliyunecs-access-key-id":     "KEY",
+			"aliyunecs-access-key-secret": "SECRET",
+			"aliyunecs-vswitch-id":        "vsw-1",
+			"aliyunecs-security-group-id": "sg-1",
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	err := driver.SetConfigFromFlags(checkFlags)
+
+	assert.NoError(t, err)
+	assert.Empty(t, checkFlags.InvalidFlags)
+	assert.Equal(t, "cn-hangzhou", driver.Region)
+	assert.Equal(t, "ecs.g6.large", driver.InstanceType)
+	assert.Equal(t, "cloud_essd", driver.SystemDiskCategory)
+	assert.Equal(t, 40, driver.SystemDiskSize)
+	assert.Equal(t, 1, driver.InternetBandwidth)
+	assert.Equal(t, "PayByTraffic", driver.InternetChargeType)
+
+	sshPort, err := driver.GetSSHPort()
+	assert.NoError(t, err)
+	assert.Equal(t, "root", driver.GetSSHUsername())
+	assert.Equal(t, 22, sshPort)
+}
+
+func TestRunInstanceParams(t *testing.T) {
+	userdata := filepath.Join(t.TempDir(), "cloud-init.yaml")
+	assert.NoError(t, os.WriteFile(userdata, []byte("#cloud-config\n"), 0600))
+
+	driver := newTestDriver("path")
+	driver.InternetBandwidth = 10
+	driver.UserDataFile = userdata
+	driver.Tags = "team=rancher, test"
+
+	params, err := driver.runInstanceParams()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"InstanceType":            "ecs.g6.large",
+		"ImageId":                 "ubuntu_22_04_x64_20G_alibase_20240130.vhd",
+		"VSwitchId":               "vsw-1",
+		"SecurityGroupId":         "sg-1",
+		"InstanceName":            "default",
+		"HostName":                "default",
+		"SystemDisk.Category":     "cloud_essd",
+		"SystemDisk.Size":         "40",
+		"InternetMaxBandwidthOut": "10",
+		"InternetChargeType":      "PayByTraffic",
+		"UserData":                "I2Nsb3VkLWNvbmZpZwo=",
+		"Tag.1.Key":               "team",
+		"Tag.1.Value":             "rancher",
+		"Tag.2.Key":               "test",
+		"Tag.2.Value":             "",
+	}, params)
+
+	driver.Zone = "cn-hangzhou-h"
+	params, err = driver.runInstanceParams()
+	assert.NoError(t, err)
+	assert.Equal(t, "cn-hangzhou-h", params["ZoneId"])
+
+	driver.UserDataFile = filepath.Join(t.TempDir(), "missing.yaml")
+	_, err = driver.runInstanceParams()
+	assert.Error(t, err)
+}
+
+func TestInstanceState(t *testing.T) {
+	for status, expected := range map[string]state.State{
+		"Pending":  state.Starting,
+		"Starting": state.Starting,
+		"Running":  state.Running,
+		"Stopping": state.Stopping,
+		"Stopped":  state.Stopped,
+		"Unknown":  state.None,
+	} {
+		assert.Equal(t, expected, instanceState(status), status)
+	}
+}
+
+func TestInstanceAddresses(t *testing.T) {
+	instance := &Instance{}
+	instance.PublicIPAddress.IPAddress = []string{"1.2.3.4"}
+	instance.VpcAttributes.PrivateIPAddress.IPAddress = []string{"172.16.0.3"}
+
+	assert.Equal(t, []drivers.NetworkAddress{
+		{Kind: drivers.AddressPublic, Address: "1.2.3.4"},
+		{Kind: drivers.AddressPrivate, Address: "172.16.0.3"},
+	}, instanceAddresses(instance))
+
+	// The elastic IP is the public address when the instance has one.
+	instance.EIPAddress.IPAddress = "5.6.7.8"
+	assert.Equal(t, "5.6.7.8", instance.PublicIP())
+
+	assert.Empty(t, instanceAddresses(&Instance{}))
+}
+
+func TestIsNotFound(t *testing.T) {
+	assert.True(t, isNotFound(&APIError{StatusCode: http.StatusNotFound}))
+	assert.True(t, isNotFound(&APIError{StatusCode: http.StatusForbidden, Code: "InvalidInstanceId.NotFound"}))
+	assert.False(t, isNotFound(&APIError{StatusCode: http.StatusBadRequest, Code: "SignatureDoesNotMatch"}))
+	assert.False(t, isNotFound(errors.New("aliyunecs: timeout")))
+}
+
+func TestPercentEncode(t *testing.T) {
+	assert.Equal(t, "a%20b%2A~%2F", percentEncode("a b*~/"))
+}
@@ -0,0 +1,288 @@
+package aliyunecs
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rancher/machine/libmachine/mcnutils"
+	"github.com/rancher/machine/libmachine/version"
+)
+
+// apiEndpoint is the template of the ECS API endpoints, replaced by the
+// tests.
+var apiEndpoint = "https://ecs.{region}.aliyuncs.com"
+
+// apiVersion is the version of the ECS API the calls are made to.
+const apiVersion = "2014-05-26"
+
+// Client makes the calls to the Alibaba Cloud ECS API the driver needs, in
+// a region.
+type Client struct {
+	accessKeyID     string
+	accessKeySecret string
+	region          string
+	endpoint        string
+	httpClient      *http.Client
+}
+
+func NewClient(accessKeyID, accessKeySecret, region string) *Client {
+	return &Client{
+		accessKeyID:     accessKeyID,
+		accessKeySecret: accessKeySecret,
+		region:          region,
+		endpoint:        strings.ReplaceAll(apiEndpoint, "{region}", region),
+		httpClient:      &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// APIError is an error answered by the ECS API.
+type APIError struct {
+	StatusCode int
+	Code       string `json:"Code"`
+	Message    string `json:"Message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("aliyunecs: %s (%s)", e.Message, e.Code)
+}
+
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && (apiErr.StatusCode == http.StatusNotFound || strings.HasSuffix(apiErr.Code, ".NotFound"))
+}
+
+type Instance struct {
+	InstanceID      string `json:"InstanceId"`
+	InstanceName    string `json:"InstanceName"`
+	Status          string `json:"Status"`
+	PublicIPAddress struct {
+		IPAddress []string `json:"IpAddress"`
+	} `json:"PublicIpAddress"`
+	EIPAddress struct {
+		IPAddress string `json:"IpAddress"`
+	} `json:"EipAddress"`
+	VpcAttributes struct {
+		PrivateIPAddress struct {
+			IPAddress []string `json:"IpAddress"`
+		} `json:"PrivateIpAddress"`
+	} `json:"VpcAttributes"`
+}
+
+// PublicIP returns the public address of the instance, its elastic IP
+// when it has one.
+func (i *Instance) PublicIP() string {
+	if i.EIPAddress.IPAddress != "" {
+		return i.EIPAddress.IPAddress
+	}
+	if len(i.PublicIPAddress.IPAddress) > 0 {
+		return i.PublicIPAddress.IPAddress[0]
+	}
+	return ""
+}
+
+func (i *Instance) PrivateIP() string {
+	if len(i.VpcAttributes.PrivateIPAddress.IPAddress) > 0 {
+		return i.VpcAttributes.PrivateIPAddress.IPAddress[0]
+	}
+	return ""
+}
+
+type Zone struct {
+	ZoneID                 string `json:"ZoneId"`
+	AvailableInstanceTypes struct {
+		InstanceTypes []string `json:"InstanceTypes"`
+	} `json:"AvailableInstanceTypes"`
+}
+
+type VSwitch struct {
+	VSwitchID string `json:"VSwitchId"`
+	VpcID     string `json:"VpcId"`
+	ZoneID    string `json:"ZoneId"`
+}
+
+// percentEncode encodes like the signatures of the API expect.
+func percentEncode(s string) string {
+	return strings.NewReplacer("+", "%20", "*", "%2A", "%7E", "~").Replace(url.QueryEscape(s))
+}
+
+// sign adds the signature, of version 1.0, of the parameters of a call.
+func (c *Client) sign(method string, params url.Values) {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = percentEncode(key) + "=" + percentEncode(params.Get(key))
+	}
+	stringToSign := method + "&" + percentEncode("/") + "&" + percentEncode(strings.Join(pairs, "&"))
+
+	mac := hmac.New(sha1.New, []byte(c.accessKeySecret+"&"))
+	mac.Write([]byte(stringToSign))
+	params.Set("Signature", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+// do calls the action with the parameters.
+func (c *Client) do(action string, params map[string]string, reply interface{}) error {
+	query := url.Values{
+		"Action":           {action},
+		"Format":           {"JSON"},
+		"Version":          {apiVersion},
+		"AccessKeyId":      {c.accessKeyID},
+		"SignatureMethod":  {"HMAC-SHA1"},
+		"SignatureVersion": {"1.0"},
+		"SignatureNonce":   {mcnutils.GenerateRandomID()},
+		"Timestamp":        {time.Now().UTC().Format("2006-01-02T15:04:05Z")},
+		"RegionId":         {c.region},
+	}
+	for key, value := range params {
+		query.Set(key, value)
+	}
+	c.sign(http.MethodGet, query)
+
+	req, err := http.NewRequest(http.MethodGet, c.endpoint+"/?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", fmt.Sprintf("docker-machine/v%d", version.APIVersion))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 400 {
+		apiErr := &APIError{}
+		if err := json.Unmarshal(data, apiErr); err != nil || apiErr.Message == "" {
+			apiErr.Code = "Unknown"
+			apiErr.Message = resp.Status
+		}
+		apiErr.StatusCode = resp.StatusCode
+		return apiErr
+	}
+
+	if reply == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, reply)
+}
+
+// jsonList encodes the values as the JSON lists some parameters are.
+func jsonList(values ...string) string {
+	data, _ := json.Marshal(values)
+	return string(data)
+}
+
+// Zones returns the zones of the region.
+func (c *Client) Zones() ([]Zone, error) {
+	var reply struct {
+		Zones struct {
+			Zone []Zone `json:"Zone"`
+		} `json:"Zones"`
+	}
+	if err := c.do("DescribeZones", nil, &reply); err != nil {
+		return nil, err
+	}
+	return reply.Zones.Zone, nil
+}
+
+func (c *Client) GetVSwitch(id string) (*VSwitch, error) {
+	var reply struct {
+		VSwitches struct {
+			VSwitch []VSwitch `json:"VSwitch"`
+		} `json:"VSwitches"`
+	}
+	if err := c.do("DescribeVSwitches", map[string]string{"VSwitchId": id}, &reply); err != nil {
+		return nil, err
+	}
+	if len(reply.VSwitches.VSwitch) == 0 {
+		return nil, &APIError{StatusCode: http.StatusNotFound, Code: "InvalidVSwitchId.NotFound", Message: "The specified vswitch does not exist."}
+	}
+	return &reply.VSwitches.VSwitch[0], nil
+}
+
+// SecurityGroupExists fails if the security group is not one of the VPC.
+func (c *Client) SecurityGroupExists(id, vpcID string) error {
+	var reply struct {
+		SecurityGroups struct {
+			SecurityGroup []struct {
+				SecurityGroupID string `json:"SecurityGroupId"`
+			} `json:"SecurityGroup"`
+		} `json:"SecurityGroups"`
+	}
+	params := map[string]string{"SecurityGroupIds": jsonList(id), "VpcId": vpcID}
+	if err := c.do("DescribeSecurityGroups", params, &reply); err != nil {
+		return err
+	}
+	if len(reply.SecurityGroups.SecurityGroup) == 0 {
+		return &APIError{StatusCode: http.StatusNotFound, Code: "InvalidSecurityGroupId.NotFound", Message: "The specified security group does not exist."}
+	}
+	return nil
+}
+
+func (c *Client) ImportKeyPair(name, publicKey string) error {
+	return c.do("ImportKeyPair", map[string]string{"KeyPairName": name, "PublicKeyBody": publicKey}, nil)
+}
+
+func (c *Client) DeleteKeyPair(name string) error {
+	return c.do("DeleteKeyPairs", map[string]string{"KeyPairNames": jsonList(name)}, nil)
+}
+
+// RunInstance creates and starts an instance with the parameters of
+// RunInstances.
+func (c *Client) RunInstance(params map[string]string) (string, error) {
+	var reply struct {
+		InstanceIDSets struct {
+			InstanceIDSet []string `json:"InstanceIdSet"`
+		} `json:"InstanceIdSets"`
+	}
+	params["Amount"] = "1"
+	if err := c.do("RunInstances", params, &reply); err != nil {
+		return "", err
+	}
+	if len(reply.InstanceIDSets.InstanceIDSet) == 0 {
+		return "", fmt.Errorf("aliyunecs: no instance was created")
+	}
+	return reply.InstanceIDSets.InstanceIDSet[0], nil
+}
+
+func (c *Client) GetInstance(id string) (*Instance, error) {
+	var reply struct {
+		Instances struct {
+			Instance []Instance `json:"Instance"`
+		} `json:"Instances"`
+	}
+	if err := c.do("DescribeInstances", map[string]string{"InstanceIds": jsonList(id)}, &reply); err != nil {
+		return nil, err
+	}
+	if len(reply.Instances.Instance) == 0 {
+		return nil, &APIError{StatusCode: http.StatusNotFound, Code: "InvalidInstanceId.NotFound", Message: "The specified instance does not exist."}
+	}
+	return &reply.Instances.Instance[0], nil
+}
+
+// InstanceAction runs an action, e.g. "StartInstance", on the instance.
+func (c *Client) InstanceAction(action, id string, params map[string]string) error {
+	if params == nil {
+		params = map[string]string{}
+	}
+	params["InstanceId"] = id
+	return c.do(action, params, nil)
+}
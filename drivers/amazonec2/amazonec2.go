@@ -18,8 +18,11 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/pricing"
+	"github.com/aws/aws-sdk-go/service/ssm"
 	"github.com/rancher/machine/drivers/driverutil"
 	"github.com/rancher/machine/libmachine/drivers"
 	rpcdriver "github.com/rancher/machine/libmachine/drivers/rpc"
@@ -46,6 +49,9 @@ const (
 	defaultSSHUser              = "ubuntu"
 	defaultSpotPrice            = "0.50"
 	defaultBlockDurationMinutes = 0
+	defaultSpotInterruption     = ec2.InstanceInterruptionBehaviorTerminate
+	defaultSpotTimeout          = 600
+	defaultLaunchTemplateVer    = "$Default"
 	charset                     = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 	ec2VolumeResource           = "volume"
 	ec2NetworkInterfaceResource = "network-interface"
@@ -57,6 +63,25 @@ const (
 	spotInstanceRequestNotFoundCode = "InvalidSpotInstanceRequestID.NotFound"
 )
 
+// spotUnavailableCodes are the errors of EC2 when it cannot launch a spot
+// instance now, which a fallback on-demand instance works around.
+var spotUnavailableCodes = []string{
+	"InsufficientInstanceCapacity",
+	"SpotMaxPriceTooLow",
+	"MaxSpotInstanceCountExceeded",
+}
+
+// spotInterruptionCodes are the state reasons of the spot instances EC2
+// interrupted.
+var spotInterruptionCodes = []string{
+	"Server.SpotInstanceShutdown",
+	"Server.SpotInstanceTermination",
+}
+
+// spotPollInterval is how often the spot instance request is described
+// while it is not fulfilled, replaced by the tests.
+var spotPollInterval = 5 * time.Second
+
 var (
 	dockerPort                           int64 = 2376
 	swarmPort                            int64 = 3376
@@ -84,11 +109,52 @@ var (
 	errorReadingUserData                       = errors.New("unable to read --amazonec2-userdata file")
 	errorInvalidValueForHTTPToken              = errors.New("httpToken must be either optional or required")
 	errorInvalidValueForHTTPEndpoint           = errors.New("httpEndpoint must be either enabled or disabled")
+	errorInvalidValueForHTTPHopLimit           = errors.New("httpPutResponseHopLimit must be between 1 and 64")
+	errorInvalidValueForSpotInterruption       = errors.New("spot interruption behavior must be either terminate, stop or hibernate")
+	errorInvalidSpotTimeout                    = errors.New("spot fulfillment timeout must be a positive number of seconds")
+	errorSpotFallbackWithoutSpot               = errors.New("using --amazonec2-spot-fallback-on-demand also requires --amazonec2-request-spot-instance")
+	errorSpotRequestNotFulfilled               = errors.New("spot instance request not fulfilled")
+	errorLaunchTemplateVersionWithoutId        = errors.New("using --amazonec2-launch-template-version also requires --amazonec2-launch-template-id")
+	errorAdditionalSubnetWithPublicIP          = errors.New("using --amazonec2-additional-subnet-id also requires --amazonec2-private-address-only, EC2 only assigns public addresses to instances with a single network interface")
+	errorResizeWithoutInstanceType             = errors.New("amazonec2 resizes instances by instance type, use --instance-type")
 )
 
+// retryOptions retry the EC2 calls throttled while many machines are created
+// at once, beyond the retries of the SDK.
+var retryOptions = drivers.DefaultRetryOptions.WithRetryable(request.IsErrorThrottle)
+
+// errorCodes classify the EC2 errors of the failures callers handle apart.
+var errorCodes = map[string]drivers.ErrorCode{
+	"AuthFailure":                  drivers.ErrorCodeAuthFailure,
+	"UnauthorizedOperation":        drivers.ErrorCodeAuthFailure,
+	"InvalidClientTokenId":         drivers.ErrorCodeAuthFailure,
+	"SignatureDoesNotMatch":        drivers.ErrorCodeAuthFailure,
+	"InstanceLimitExceeded":        drivers.ErrorCodeQuotaExceeded,
+	"VcpuLimitExceeded":            drivers.ErrorCodeQuotaExceeded,
+	"MaxSpotInstanceCountExceeded": drivers.ErrorCodeQuotaExceeded,
+	"InvalidAMIID.NotFound":        drivers.ErrorCodeNotFound,
+	"InvalidSubnetID.NotFound":     drivers.ErrorCodeNotFound,
+	"InvalidGroup.NotFound":        drivers.ErrorCodeNotFound,
+	"InvalidKeyPair.NotFound":      drivers.ErrorCodeNotFound,
+	"InvalidVpcID.NotFound":        drivers.ErrorCodeNotFound,
+	"RequestLimitExceeded":         drivers.ErrorCodeTransientNetwork,
+}
+
+// classifyError gives err the code of its EC2 error, if it has one.
+func classifyError(err error) error {
+	if awsErr, ok := err.(awserr.Error); ok {
+		if code, ok := errorCodes[awsErr.Code()]; ok {
+			return drivers.NewError(code, err)
+		}
+	}
+	return err
+}
+
 type Driver struct {
 	*drivers.BaseDriver
 	clientFactory         func() Ec2Client
+	ssmClientFactory      func() SSMClient
+	pricingClientFactory  func() PricingClient
 	awsCredentialsFactory func() awsCredentials
 	Id                    string
 	AccessKey             string
@@ -102,6 +168,7 @@ type Driver struct {
 	KeyName          string
 	InstanceId       string
 	InstanceType     string
+	Architecture     string
 	OS               string
 	PrivateIPAddress string
 
@@ -113,37 +180,67 @@ type Driver struct {
 	SecurityGroupName  string
 	SecurityGroupNames []string
 
-	SecurityGroupReadOnly   bool
-	OpenPorts               []string
-	Tags                    string
-	ReservationId           string
-	DeviceName              string
-	RootSize                int64
-	VolumeType              string
-	IamInstanceProfile      string
-	VpcId                   string
-	SubnetId                string
-	Zone                    string
-	keyPath                 string
-	RequestSpotInstance     bool
-	SpotPrice               string
-	BlockDurationMinutes    int64
-	PrivateIPOnly           bool
-	UsePrivateIP            bool
-	UseEbsOptimizedInstance bool
-	Monitoring              bool
-	SSHPrivateKeyPath       string
-	RetryCount              int
-	Endpoint                string
-	DisableSSL              bool
-	UserDataFile            string
-	EncryptEbsVolume        bool
-	spotInstanceRequestId   string
-	kmsKeyId                *string
-	bdmList                 []*ec2.BlockDeviceMapping
+	SecurityGroupReadOnly    bool
+	OpenPorts                []string
+	Tags                     string
+	ReservationId            string
+	DeviceName               string
+	RootSize                 int64
+	VolumeType               string
+	IamInstanceProfile       string
+	VpcId                    string
+	SubnetId                 string
+	AdditionalSubnetIds      []string
+	Zone                     string
+	keyPath                  string
+	RequestSpotInstance      bool
+	SpotPrice                string
+	BlockDurationMinutes     int64
+	SpotInterruptionBehavior string
+	SpotFulfillmentTimeout   int
+	SpotFallbackOnDemand     bool
+	SpotInstanceRequestId    string
+	LaunchTemplateId         string
+	LaunchTemplateVersion    string
+	PrivateIPOnly            bool
+	UsePrivateIP             bool
+	Ipv6AddressCount         int
+	UseEbsOptimizedInstance  bool
+	Monitoring               bool
+	SSHPrivateKeyPath        string
+	RetryCount               int
+	Endpoint                 string
+	DisableSSL               bool
+	UserDataFile             string
+	EncryptEbsVolume         bool
+	kmsKeyId                 *string
+	bdmList                  []*ec2.BlockDeviceMapping
+	launchTemplateData       *ec2.ResponseLaunchTemplateData
 	// Metadata Options
-	HttpEndpoint string
-	HttpTokens   string
+	HttpEndpoint            string
+	HttpTokens              string
+	HttpPutResponseHopLimit int64
+}
+
+// Capabilities returns the optional operations supported by the driver.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityStartStop,
+		drivers.CapabilityRestart,
+		drivers.CapabilityKill,
+		drivers.CapabilityPrivateIP,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+		drivers.CapabilitySnapshots,
+		drivers.CapabilityResize,
+		drivers.CapabilityIPv6,
+	}
+}
+
+// SupportedArchitectures returns the architectures of the machines the driver
+// creates, picked from the instance type.
+func (d *Driver) SupportedArchitectures() []string {
+	return []string{"amd64", "arm64"}
 }
 
 func (d *Driver) GetCreateFlags() []mcnflag.Flag {
@@ -154,14 +251,16 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			EnvVar: "AWS_ACCESS_KEY_ID",
 		},
 		mcnflag.StringFlag{
-			Name:   "amazonec2-secret-key",
-			Usage:  "AWS Secret Key",
-			EnvVar: "AWS_SECRET_ACCESS_KEY",
+			Name:      "amazonec2-secret-key",
+			Usage:     "AWS Secret Key",
+			EnvVar:    "AWS_SECRET_ACCESS_KEY",
+			Sensitive: true,
 		},
 		mcnflag.StringFlag{
-			Name:   "amazonec2-session-token",
-			Usage:  "AWS Session Token",
-			EnvVar: "AWS_SESSION_TOKEN",
+			Name:      "amazonec2-session-token",
+			Usage:     "AWS Session Token",
+			EnvVar:    "AWS_SESSION_TOKEN",
+			Sensitive: true,
 		},
 		mcnflag.StringFlag{
 			Name:   "amazonec2-ami",
@@ -190,6 +289,11 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "AWS VPC subnet id",
 			EnvVar: "AWS_SUBNET_ID",
 		},
+		mcnflag.StringSliceFlag{
+			Name:   "amazonec2-additional-subnet-id",
+			Usage:  "AWS VPC subnet id of an additional network interface of the instance, e.g. on a private network",
+			EnvVar: "AWS_ADDITIONAL_SUBNET_ID",
+		},
 		mcnflag.BoolFlag{
 			Name:   "amazonec2-security-group-readonly",
 			Usage:  "Skip adding default rules to security groups",
@@ -250,7 +354,7 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 		},
 		mcnflag.StringFlag{
 			Name:  "amazonec2-spot-price",
-			Usage: "AWS spot instance bid price (in dollar)",
+			Usage: "AWS spot instance max price (in dollar), empty for the on-demand price",
 			Value: defaultSpotPrice,
 		},
 		mcnflag.IntFlag{
@@ -258,6 +362,20 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage: "AWS spot instance duration in minutes (60, 120, 180, 240, 300, or 360)",
 			Value: defaultBlockDurationMinutes,
 		},
+		mcnflag.StringFlag{
+			Name:  "amazonec2-spot-interruption-behavior",
+			Usage: "What AWS does to the spot instance when interrupting it: terminate, stop or hibernate",
+			Value: defaultSpotInterruption,
+		},
+		mcnflag.IntFlag{
+			Name:  "amazonec2-spot-fulfillment-timeout",
+			Usage: "Seconds to wait for the spot instance request to be fulfilled before canceling it",
+			Value: defaultSpotTimeout,
+		},
+		mcnflag.BoolFlag{
+			Name:  "amazonec2-spot-fallback-on-demand",
+			Usage: "Launch an on-demand instance when the spot instance request cannot be fulfilled",
+		},
 		mcnflag.BoolFlag{
 			Name:  "amazonec2-private-address-only",
 			Usage: "Only use a private IP address",
@@ -266,6 +384,10 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Name:  "amazonec2-use-private-address",
 			Usage: "Force the usage of private IP address",
 		},
+		mcnflag.IntFlag{
+			Name:  "amazonec2-ipv6-address-count",
+			Usage: "Number of IPv6 addresses of the instance, in a subnet with an IPv6 CIDR block",
+		},
 		mcnflag.BoolFlag{
 			Name:  "amazonec2-monitoring",
 			Usage: "Set this flag to enable CloudWatch monitoring",
@@ -316,14 +438,31 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			EnvVar: "AWS_KMS_KEY",
 		},
 		mcnflag.StringFlag{
-			Name:   "amazonec2-http-endpoint",
-			Usage:  "Enables or disables the HTTP metadata endpoint on your instances",
-			EnvVar: "AWS_HTTP_ENDPOINT",
+			Name:    "amazonec2-http-endpoint",
+			Usage:   "Enables or disables the HTTP metadata endpoint on your instances",
+			EnvVar:  "AWS_HTTP_ENDPOINT",
+			Options: []string{"enabled", "disabled"},
+		},
+		mcnflag.StringFlag{
+			Name:    "amazonec2-http-tokens",
+			Usage:   "The state of token usage for your instance metadata requests.",
+			EnvVar:  "AWS_HTTP_TOKENS",
+			Options: []string{"optional", "required"},
+		},
+		mcnflag.StringFlag{
+			Name:   "amazonec2-launch-template-id",
+			Usage:  "ID of the launch template to create the instance from, whose settings take precedence over the flags but for the key pair, user data and tags",
+			EnvVar: "AWS_LAUNCH_TEMPLATE_ID",
 		},
 		mcnflag.StringFlag{
-			Name:   "amazonec2-http-tokens",
-			Usage:  "The state of token usage for your instance metadata requests.",
-			EnvVar: "AWS_HTTP_TOKENS",
+			Name:   "amazonec2-launch-template-version",
+			Usage:  "Version of the launch template, e.g. 3 or $Latest (default $Default)",
+			EnvVar: "AWS_LAUNCH_TEMPLATE_VERSION",
+		},
+		mcnflag.IntFlag{
+			Name:   "amazonec2-http-put-response-hop-limit",
+			Usage:  "The number of network hops of the metadata token responses, 2 or more for containers to get tokens",
+			EnvVar: "AWS_HTTP_PUT_RESPONSE_HOP_LIMIT",
 		},
 	}
 }
@@ -331,15 +470,17 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 func NewDriver(hostName, storePath string) *Driver {
 	id := generateId()
 	driver := &Driver{
-		Id:                   id,
-		AMI:                  defaultAmiId,
-		Region:               defaultRegion,
-		InstanceType:         defaultInstanceType,
-		RootSize:             defaultRootSize,
-		Zone:                 defaultZone,
-		SecurityGroupNames:   []string{defaultSecurityGroup},
-		SpotPrice:            defaultSpotPrice,
-		BlockDurationMinutes: defaultBlockDurationMinutes,
+		Id:                       id,
+		AMI:                      defaultAmiId,
+		Region:                   defaultRegion,
+		InstanceType:             defaultInstanceType,
+		RootSize:                 defaultRootSize,
+		Zone:                     defaultZone,
+		SecurityGroupNames:       []string{defaultSecurityGroup},
+		SpotPrice:                defaultSpotPrice,
+		BlockDurationMinutes:     defaultBlockDurationMinutes,
+		SpotInterruptionBehavior: defaultSpotInterruption,
+		SpotFulfillmentTimeout:   defaultSpotTimeout,
 		BaseDriver: &drivers.BaseDriver{
 			SSHUser:     defaultSSHUser,
 			MachineName: hostName,
@@ -348,12 +489,28 @@ func NewDriver(hostName, storePath string) *Driver {
 	}
 
 	driver.clientFactory = driver.buildClient
+	driver.ssmClientFactory = driver.buildSSMClient
+	driver.pricingClientFactory = driver.buildPricingClient
 	driver.awsCredentialsFactory = driver.buildCredentials
 
 	return driver
 }
 
 func (d *Driver) buildClient() Ec2Client {
+	return ec2.New(session.New(d.buildConfig()))
+}
+
+func (d *Driver) buildSSMClient() SSMClient {
+	return ssm.New(session.New(d.buildConfig()))
+}
+
+// buildPricingClient returns a client of the Price List API, which is only
+// served in a few regions and prices every region from there.
+func (d *Driver) buildPricingClient() PricingClient {
+	return pricing.New(session.New(d.buildConfig().WithRegion(pricingRegion)))
+}
+
+func (d *Driver) buildConfig() *aws.Config {
 	config := aws.NewConfig()
 	alogger := AwsLogger()
 	config = config.WithRegion(d.Region)
@@ -365,7 +522,7 @@ func (d *Driver) buildClient() Ec2Client {
 		config = config.WithEndpoint(d.Endpoint)
 		config = config.WithDisableSSL(d.DisableSSL)
 	}
-	return ec2.New(session.New(config))
+	return config
 }
 
 func (d *Driver) buildCredentials() awsCredentials {
@@ -395,7 +552,10 @@ func (d *Driver) UnmarshalJSON(data []byte) error {
 	*d = Driver(target)
 
 	// Make sure to reload values that are subject to change from envvars and os.Args.
-	driverOpts := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	driverOpts, err := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	if err != nil {
+		return err
+	}
 	if _, ok := driverOpts.Values["amazonec2-access-key"]; ok {
 		d.AccessKey = driverOpts.String("amazonec2-access-key")
 	}
@@ -428,9 +588,13 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.RequestSpotInstance = flags.Bool("amazonec2-request-spot-instance")
 	d.SpotPrice = flags.String("amazonec2-spot-price")
 	d.BlockDurationMinutes = int64(flags.Int("amazonec2-block-duration-minutes"))
+	d.SpotFallbackOnDemand = flags.Bool("amazonec2-spot-fallback-on-demand")
+	d.LaunchTemplateId = flags.String("amazonec2-launch-template-id")
+	d.LaunchTemplateVersion = flags.String("amazonec2-launch-template-version")
 	d.InstanceType = flags.String("amazonec2-instance-type")
 	d.VpcId = flags.String("amazonec2-vpc-id")
 	d.SubnetId = flags.String("amazonec2-subnet-id")
+	d.AdditionalSubnetIds = flags.StringSlice("amazonec2-additional-subnet-id")
 	d.SecurityGroupNames = flags.StringSlice("amazonec2-security-group")
 	d.SecurityGroupReadOnly = flags.Bool("amazonec2-security-group-readonly")
 	d.Tags = flags.String("amazonec2-tags")
@@ -443,6 +607,8 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.SSHUser = flags.String("amazonec2-ssh-user")
 	d.SSHPort = 22
 	d.PrivateIPOnly = flags.Bool("amazonec2-private-address-only")
+	d.Ipv6AddressCount = flags.Int("amazonec2-ipv6-address-count")
+	d.SetIPv6PreferenceFromFlags(flags)
 	d.UsePrivateIP = flags.Bool("amazonec2-use-private-address")
 	d.Monitoring = flags.Bool("amazonec2-monitoring")
 	d.UseEbsOptimizedInstance = flags.Bool("amazonec2-use-ebs-optimized-instance")
@@ -450,6 +616,22 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.KeyName = flags.String("amazonec2-keypair-name")
 	d.ExistingKey = flags.String("amazonec2-keypair-name") != ""
 	d.SetSwarmConfigFromFlags(flags)
+	// EC2 imports RSA and Ed25519 keys only.
+	if err := d.SetSSHKeyTypeFromFlags(flags, ssh.KeyTypeRSA, ssh.KeyTypeEd25519); err != nil {
+		return err
+	}
+	if err := d.SetTagsFromFlags(flags); err != nil {
+		return err
+	}
+	if err := d.SetUserDataFromFlags(flags); err != nil {
+		return err
+	}
+	if err := d.SetSSHJumpHostsFromFlags(flags); err != nil {
+		return err
+	}
+	if err := d.SetSSHRetryPolicyFromFlags(flags); err != nil {
+		return err
+	}
 	d.RetryCount = flags.Int("amazonec2-retries")
 	d.OpenPorts = flags.StringSlice("amazonec2-open-port")
 	d.UserDataFile = flags.String("amazonec2-userdata")
@@ -471,6 +653,44 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 		d.HttpTokens = httpTokens
 	}
 
+	httpHopLimit := flags.Int("amazonec2-http-put-response-hop-limit")
+	if httpHopLimit != 0 {
+		if httpHopLimit < 1 || httpHopLimit > 64 {
+			return errorInvalidValueForHTTPHopLimit
+		}
+		d.HttpPutResponseHopLimit = int64(httpHopLimit)
+	}
+
+	spotInterruption := flags.String("amazonec2-spot-interruption-behavior")
+	if spotInterruption != "" {
+		switch spotInterruption {
+		case ec2.InstanceInterruptionBehaviorTerminate, ec2.InstanceInterruptionBehaviorStop, ec2.InstanceInterruptionBehaviorHibernate:
+		default:
+			return errorInvalidValueForSpotInterruption
+		}
+		d.SpotInterruptionBehavior = spotInterruption
+	}
+
+	spotTimeout := flags.Int("amazonec2-spot-fulfillment-timeout")
+	if spotTimeout < 0 {
+		return errorInvalidSpotTimeout
+	}
+	if spotTimeout > 0 {
+		d.SpotFulfillmentTimeout = spotTimeout
+	}
+
+	if d.SpotFallbackOnDemand && !d.RequestSpotInstance {
+		return errorSpotFallbackWithoutSpot
+	}
+
+	if len(d.AdditionalSubnetIds) > 0 && !d.PrivateIPOnly {
+		return errorAdditionalSubnetWithPublicIP
+	}
+
+	if d.LaunchTemplateVersion != "" && d.LaunchTemplateId == "" {
+		return errorLaunchTemplateVersionWithoutId
+	}
+
 	kmskeyid := flags.String("amazonec2-kms-key")
 	if kmskeyid != "" {
 		d.kmsKeyId = aws.String(kmskeyid)
@@ -590,6 +810,84 @@ func (d *Driver) checkSubnet() error {
 	return nil
 }
 
+// describeInstanceTypesDeniedCodes are the codes of the errors of the
+// DescribeInstanceTypes calls the IAM policy of the credentials denies.
+var describeInstanceTypesDeniedCodes = []string{"UnauthorizedOperation", "AccessDenied"}
+
+// checkArchitecture finds the architecture of the instance type, preferring
+// x86_64 for the types supporting several, and replaces the default amd64
+// AMI of the region by the current Ubuntu AMI of the architecture, the one
+// with the NVIDIA driver on instance types with NVIDIA GPUs. It is skipped
+// when the credentials may not describe instance types.
+func (d *Driver) checkArchitecture() error {
+	types, err := d.getClient().DescribeInstanceTypes(&ec2.DescribeInstanceTypesInput{
+		InstanceTypes: []*string{&d.InstanceType},
+	})
+	if awsErr, ok := err.(awserr.Error); ok && contains(describeInstanceTypesDeniedCodes, awsErr.Code()) {
+		log.Warnf("Unable to find the architecture of the instance type %s, the AMI is used as is: %s", d.InstanceType, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(types.InstanceTypes) == 0 || types.InstanceTypes[0].ProcessorInfo == nil {
+		return fmt.Errorf("instance type %s not found on region %s", d.InstanceType, d.Region)
+	}
+
+	architectures := aws.StringValueSlice(types.InstanceTypes[0].ProcessorInfo.SupportedArchitectures)
+	if len(architectures) == 0 {
+		return nil
+	}
+	d.Architecture = architectures[0]
+	for _, architecture := range architectures {
+		if architecture == ec2.ArchitectureTypeX8664 {
+			d.Architecture = architecture
+		}
+	}
+
+	gpus := nvidiaGPUs(types.InstanceTypes[0])
+
+	// custom endpoints have no public parameters, checkAMI reports a mismatch
+	if (d.Architecture == ec2.ArchitectureTypeX8664 && gpus == 0) || d.Endpoint != "" {
+		return nil
+	}
+	if r, ok := regionDetails[d.Region]; !ok || d.AMI != r.AmiId {
+		return nil
+	}
+
+	if gpus > 0 {
+		ami, err := nvidiaAMI(d.ssmClientFactory(), d.Architecture)
+		if err != nil {
+			return err
+		}
+		log.Infof("Using the Ubuntu AMI %s with the NVIDIA driver for the instance type %s with %d GPUs", ami, d.InstanceType, gpus)
+		d.AMI = ami
+		return nil
+	}
+
+	ami, err := ubuntuAMI(d.ssmClientFactory(), d.Architecture)
+	if err != nil {
+		return err
+	}
+	log.Infof("Using the Ubuntu AMI %s for the %s instance type %s", ami, d.Architecture, d.InstanceType)
+	d.AMI = ami
+	return nil
+}
+
+// nvidiaGPUs returns the number of NVIDIA GPUs of the instance type.
+func nvidiaGPUs(instanceType *ec2.InstanceTypeInfo) int64 {
+	if instanceType.GpuInfo == nil {
+		return 0
+	}
+	var count int64
+	for _, gpu := range instanceType.GpuInfo.Gpus {
+		if aws.StringValue(gpu.Manufacturer) == "NVIDIA" {
+			count += aws.Int64Value(gpu.Count)
+		}
+	}
+	return count
+}
+
 func (d *Driver) checkAMI() error {
 	// Check if image exists
 	images, err := d.getClient().DescribeImages(&ec2.DescribeImagesInput{
@@ -602,6 +900,11 @@ func (d *Driver) checkAMI() error {
 		return fmt.Errorf("AMI %s not found on region %s", d.AMI, d.getRegionZone())
 	}
 
+	// Fail before launching an instance that cannot boot the image
+	if architecture := aws.StringValue(images.Images[0].Architecture); architecture != "" && d.Architecture != "" && architecture != d.Architecture {
+		return fmt.Errorf("AMI %s is %s, but instance type %s is %s", d.AMI, architecture, d.InstanceType, d.Architecture)
+	}
+
 	// Select the right device name, if not provided
 	if d.DeviceName == "" {
 		d.DeviceName = *images.Images[0].RootDeviceName
@@ -613,11 +916,105 @@ func (d *Driver) checkAMI() error {
 	return nil
 }
 
+// checkLaunchTemplate reads the settings of the launch template version,
+// whose AMI and instance type replace the ones of the flags.
+func (d *Driver) checkLaunchTemplate() error {
+	version := d.LaunchTemplateVersion
+	if version == "" {
+		version = defaultLaunchTemplateVer
+	}
+	versions, err := d.getClient().DescribeLaunchTemplateVersions(&ec2.DescribeLaunchTemplateVersionsInput{
+		LaunchTemplateId: &d.LaunchTemplateId,
+		Versions:         []*string{&version},
+	})
+	if err != nil {
+		return err
+	}
+	if len(versions.LaunchTemplateVersions) == 0 || versions.LaunchTemplateVersions[0].LaunchTemplateData == nil {
+		return fmt.Errorf("launch template %s version %s not found on region %s", d.LaunchTemplateId, version, d.Region)
+	}
+
+	d.launchTemplateData = versions.LaunchTemplateVersions[0].LaunchTemplateData
+	if d.launchTemplateData.ImageId != nil {
+		d.AMI = *d.launchTemplateData.ImageId
+	}
+	if d.launchTemplateData.InstanceType != nil {
+		d.InstanceType = *d.launchTemplateData.InstanceType
+	}
+
+	return nil
+}
+
+// applyLaunchTemplate has the request launch the instance from the launch
+// template, if any, dropping the settings the template has from the
+// request but for the key pair, the user data and the tags of the machine.
+func (d *Driver) applyLaunchTemplate(req *ec2.RunInstancesInput) {
+	if d.LaunchTemplateId == "" {
+		return
+	}
+
+	version := d.LaunchTemplateVersion
+	if version == "" {
+		version = defaultLaunchTemplateVer
+	}
+	req.LaunchTemplate = &ec2.LaunchTemplateSpecification{
+		LaunchTemplateId: &d.LaunchTemplateId,
+		Version:          &version,
+	}
+
+	data := d.launchTemplateData
+	if data == nil {
+		return
+	}
+	if data.ImageId != nil {
+		req.ImageId = nil
+	}
+	if data.InstanceType != nil {
+		req.InstanceType = nil
+	}
+	if len(data.NetworkInterfaces) > 0 {
+		// The subnet of the template decides the zone.
+		req.NetworkInterfaces = nil
+		req.Placement = nil
+	}
+	if data.Placement != nil && data.Placement.AvailabilityZone != nil {
+		req.Placement = nil
+	}
+	if data.IamInstanceProfile != nil {
+		req.IamInstanceProfile = nil
+	}
+	if len(data.BlockDeviceMappings) > 0 {
+		req.BlockDeviceMappings = nil
+	}
+	if data.MetadataOptions != nil {
+		req.MetadataOptions = nil
+	}
+	if data.Monitoring != nil {
+		req.Monitoring = nil
+	}
+	if data.EbsOptimized != nil {
+		req.EbsOptimized = nil
+	}
+	if data.UserData != nil && aws.StringValue(req.UserData) == "" {
+		req.UserData = nil
+	}
+}
+
 func (d *Driver) PreCreateCheck() error {
+	if d.LaunchTemplateId != "" {
+		if err := d.checkLaunchTemplate(); err != nil {
+			return err
+		}
+	}
+
 	if err := d.checkSubnet(); err != nil {
 		return err
 	}
 
+	if err := d.checkArchitecture(); err != nil {
+		return err
+	}
+
 	if err := d.checkAMI(); err != nil {
 		return err
 	}
@@ -672,6 +1069,15 @@ func (d *Driver) Base64UserData() (userdata string, err error) {
 			return
 		}
 		userdata = base64.StdEncoding.EncodeToString(buf)
+		return
+	}
+
+	machineUserData, err := d.MachineUserData()
+	if err != nil {
+		return
+	}
+	if machineUserData != "" {
+		userdata = base64.StdEncoding.EncodeToString([]byte(machineUserData))
 	}
 	return
 }
@@ -717,147 +1123,82 @@ func (d *Driver) innerCreate() error {
 		SubnetId:                 &d.SubnetId,
 		AssociatePublicIpAddress: aws.Bool(!d.PrivateIPOnly),
 	}}
+	if d.Ipv6AddressCount > 0 {
+		netSpecs[0].Ipv6AddressCount = aws.Int64(int64(d.Ipv6AddressCount))
+	}
+	for i, subnetID := range d.AdditionalSubnetIds {
+		netSpecs = append(netSpecs, &ec2.InstanceNetworkInterfaceSpecification{
+			DeviceIndex: aws.Int64(int64(i + 1)),
+			Groups:      makePointerSlice(d.securityGroupIds()),
+			SubnetId:    aws.String(subnetID),
+		})
+	}
 
 	regionZone := d.getRegionZone()
 	log.Debugf("launching instance in subnet %s", d.SubnetId)
 
-	var instance *ec2.Instance
-	if d.RequestSpotInstance {
-		req := ec2.RunInstancesInput{
-			ImageId:  &d.AMI,
-			MinCount: aws.Int64(1),
-			MaxCount: aws.Int64(1),
-			Placement: &ec2.Placement{
-				AvailabilityZone: &regionZone,
-			},
-			KeyName:           &d.KeyName,
-			InstanceType:      &d.InstanceType,
-			NetworkInterfaces: netSpecs,
-			Monitoring:        &ec2.RunInstancesMonitoringEnabled{Enabled: aws.Bool(d.Monitoring)},
-			IamInstanceProfile: &ec2.IamInstanceProfileSpecification{
-				Name: &d.IamInstanceProfile,
-			},
-			EbsOptimized:        &d.UseEbsOptimizedInstance,
-			BlockDeviceMappings: bdmList,
-			UserData:            &userdata,
-			MetadataOptions:     &ec2.InstanceMetadataOptionsRequest{},
-			InstanceMarketOptions: &ec2.InstanceMarketOptionsRequest{
-				MarketType: aws.String(ec2.MarketTypeSpot),
-				SpotOptions: &ec2.SpotMarketOptions{
-					MaxPrice:         &d.SpotPrice,
-					SpotInstanceType: aws.String(ec2.SpotInstanceTypeOneTime),
-				},
-			},
-		}
+	req := ec2.RunInstancesInput{
+		ImageId:  &d.AMI,
+		MinCount: aws.Int64(1),
+		MaxCount: aws.Int64(1),
+		Placement: &ec2.Placement{
+			AvailabilityZone: &regionZone,
+		},
+		KeyName:           &d.KeyName,
+		InstanceType:      &d.InstanceType,
+		NetworkInterfaces: netSpecs,
+		Monitoring:        &ec2.RunInstancesMonitoringEnabled{Enabled: aws.Bool(d.Monitoring)},
+		IamInstanceProfile: &ec2.IamInstanceProfileSpecification{
+			Name: &d.IamInstanceProfile,
+		},
+		EbsOptimized:        &d.UseEbsOptimizedInstance,
+		BlockDeviceMappings: bdmList,
+		UserData:            &userdata,
+		MetadataOptions:     &ec2.InstanceMetadataOptionsRequest{},
+	}
 
-		if d.HttpEndpoint != "" {
-			req.MetadataOptions.HttpEndpoint = aws.String(d.HttpEndpoint)
-		}
+	if d.HttpEndpoint != "" {
+		req.MetadataOptions.HttpEndpoint = aws.String(d.HttpEndpoint)
+	}
 
-		if d.HttpTokens != "" {
-			req.MetadataOptions.HttpTokens = aws.String(d.HttpTokens)
-		}
+	if d.HttpTokens != "" {
+		req.MetadataOptions.HttpTokens = aws.String(d.HttpTokens)
+	}
 
-		if d.BlockDurationMinutes != 0 {
-			req.InstanceMarketOptions.SpotOptions.BlockDurationMinutes = &d.BlockDurationMinutes
-		}
-		res, err := d.getClient().RunInstances(&req)
-		if err != nil {
-			return fmt.Errorf("Error request spot instance: %s", err)
-		}
-		d.spotInstanceRequestId = *res.Instances[0].SpotInstanceRequestId
+	if d.HttpPutResponseHopLimit != 0 {
+		req.MetadataOptions.HttpPutResponseHopLimit = aws.Int64(d.HttpPutResponseHopLimit)
+	}
 
-		log.Info("Waiting for spot instance...")
-		for i := 0; i < 3; i++ {
-			// AWS eventual consistency means we could not have SpotInstanceRequest ready yet
-			err = d.getClient().WaitUntilSpotInstanceRequestFulfilled(&ec2.DescribeSpotInstanceRequestsInput{
-				SpotInstanceRequestIds: []*string{&d.spotInstanceRequestId},
-			})
-			if err != nil {
-				if awsErr, ok := err.(awserr.Error); ok {
-					if awsErr.Code() == spotInstanceRequestNotFoundCode {
-						time.Sleep(5 * time.Second)
-						continue
-					}
-				}
-				return fmt.Errorf("Error fulfilling spot request: %v", err)
-			}
-			break
-		}
-		log.Infof("Created spot instance request %v", d.spotInstanceRequestId)
-		// resolve instance id
-		for i := 0; i < 3; i++ {
-			// Even though the waiter succeeded, eventual consistency means we could
-			// get a describe output that does not include this information. Try a
-			// few times just in case
-			var resolvedSpotInstance *ec2.DescribeSpotInstanceRequestsOutput
-			resolvedSpotInstance, err = d.getClient().DescribeSpotInstanceRequests(&ec2.DescribeSpotInstanceRequestsInput{
-				SpotInstanceRequestIds: []*string{&d.spotInstanceRequestId},
-			})
-			if err != nil {
-				// Unexpected; no need to retry
-				return fmt.Errorf("Error describing previously made spot instance request: %v", err)
-			}
-			maybeInstanceId := resolvedSpotInstance.SpotInstanceRequests[0].InstanceId
-			if maybeInstanceId != nil {
-				var instances *ec2.DescribeInstancesOutput
-				instances, err = d.getClient().DescribeInstances(&ec2.DescribeInstancesInput{
-					InstanceIds: []*string{maybeInstanceId},
-				})
-				if err != nil {
-					// Retry if we get an id from spot instance but EC2 doesn't recognize it yet; see above, eventual consistency possible
-					continue
-				}
-				instance = instances.Reservations[0].Instances[0]
-				err = nil
-				break
-			}
-			time.Sleep(5 * time.Second)
-		}
+	d.applyLaunchTemplate(&req)
 
-		if err != nil {
-			return fmt.Errorf("Error resolving spot instance to real instance: %v", err)
+	var instance *ec2.Instance
+	if d.RequestSpotInstance {
+		var err error
+		instance, err = d.launchSpotInstance(req)
+		if errors.Is(err, errorSpotRequestNotFulfilled) && d.SpotFallbackOnDemand {
+			log.Warnf("%s, launching an on-demand instance instead", err)
+			d.RequestSpotInstance = false
+		} else if err != nil {
+			return err
 		}
-	} else {
+	}
+
+	if !d.RequestSpotInstance {
 		log.Debug("Building tags for instance creation")
-		resourceTags := d.buildResourceTags([]string{
+		req.TagSpecifications = d.buildResourceTags([]string{
 			ec2InstanceResource, // required
 			ec2VolumeResource,   // EBS volume
 			ec2NetworkInterfaceResource,
 		})
-		req := ec2.RunInstancesInput{
-			ImageId:  &d.AMI,
-			MinCount: aws.Int64(1),
-			MaxCount: aws.Int64(1),
-			Placement: &ec2.Placement{
-				AvailabilityZone: &regionZone,
-			},
-			KeyName:           &d.KeyName,
-			InstanceType:      &d.InstanceType,
-			NetworkInterfaces: netSpecs,
-			Monitoring:        &ec2.RunInstancesMonitoringEnabled{Enabled: aws.Bool(d.Monitoring)},
-			IamInstanceProfile: &ec2.IamInstanceProfileSpecification{
-				Name: &d.IamInstanceProfile,
-			},
-			EbsOptimized:        &d.UseEbsOptimizedInstance,
-			BlockDeviceMappings: bdmList,
-			UserData:            &userdata,
-			MetadataOptions:     &ec2.InstanceMetadataOptionsRequest{},
-			TagSpecifications:   resourceTags,
-		}
-
-		if d.HttpEndpoint != "" {
-			req.MetadataOptions.HttpEndpoint = aws.String(d.HttpEndpoint)
-		}
-
-		if d.HttpTokens != "" {
-			req.MetadataOptions.HttpTokens = aws.String(d.HttpTokens)
-		}
 
-		res, err := d.getClient().RunInstances(&req)
+		var res *ec2.Reservation
+		err := drivers.Retry(retryOptions, "Launching instance", func() (err error) {
+			res, err = d.getClient().RunInstances(&req)
+			return err
+		})
 
 		if err != nil {
-			return fmt.Errorf("Error launching instance: %s", err)
+			return fmt.Errorf("Error launching instance: %w", classifyError(err))
 		}
 		instance = res.Instances[0]
 	}
@@ -898,10 +1239,134 @@ func (d *Driver) innerCreate() error {
 	return nil
 }
 
+// launchSpotInstance requests the spot instance and waits for the request
+// to be fulfilled, failing with errorSpotRequestNotFulfilled when EC2 has
+// no capacity at the price in time.
+func (d *Driver) launchSpotInstance(req ec2.RunInstancesInput) (*ec2.Instance, error) {
+	spotOptions := &ec2.SpotMarketOptions{
+		SpotInstanceType: aws.String(ec2.SpotInstanceTypeOneTime),
+	}
+	if d.SpotPrice != "" {
+		spotOptions.MaxPrice = &d.SpotPrice
+	}
+	if d.SpotInterruptionBehavior != "" && d.SpotInterruptionBehavior != ec2.InstanceInterruptionBehaviorTerminate {
+		// Only persistent requests can start the instance again.
+		spotOptions.SpotInstanceType = aws.String(ec2.SpotInstanceTypePersistent)
+		spotOptions.InstanceInterruptionBehavior = &d.SpotInterruptionBehavior
+	}
+	if d.BlockDurationMinutes != 0 {
+		spotOptions.BlockDurationMinutes = &d.BlockDurationMinutes
+	}
+	req.InstanceMarketOptions = &ec2.InstanceMarketOptionsRequest{
+		MarketType:  aws.String(ec2.MarketTypeSpot),
+		SpotOptions: spotOptions,
+	}
+
+	var res *ec2.Reservation
+	err := drivers.Retry(retryOptions, "Requesting spot instance", func() (err error) {
+		res, err = d.getClient().RunInstances(&req)
+		return err
+	})
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && contains(spotUnavailableCodes, awsErr.Code()) {
+			return nil, fmt.Errorf("%w: %s", errorSpotRequestNotFulfilled, awsErr.Message())
+		}
+		return nil, fmt.Errorf("Error request spot instance: %w", classifyError(err))
+	}
+	d.SpotInstanceRequestId = *res.Instances[0].SpotInstanceRequestId
+
+	log.Info("Waiting for spot instance...")
+	instanceId, err := d.waitForSpotInstanceRequest()
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Created spot instance request %v", d.SpotInstanceRequestId)
+
+	// resolve instance id
+	for i := 0; i < 3; i++ {
+		var instances *ec2.DescribeInstancesOutput
+		instances, err = d.getClient().DescribeInstances(&ec2.DescribeInstancesInput{
+			InstanceIds: []*string{&instanceId},
+		})
+		if err == nil && len(instances.Reservations) > 0 && len(instances.Reservations[0].Instances) > 0 {
+			return instances.Reservations[0].Instances[0], nil
+		}
+		// Retry if we get an id from spot instance but EC2 doesn't recognize it yet, eventual consistency possible
+		time.Sleep(spotPollInterval)
+	}
+	if err == nil {
+		err = fmt.Errorf("instance %v not found", instanceId)
+	}
+	return nil, fmt.Errorf("Error resolving spot instance to real instance: %v", err)
+}
+
+// waitForSpotInstanceRequest waits for the spot instance request to be
+// fulfilled and returns its instance ID, canceling the request once the
+// fulfillment timeout is over.
+func (d *Driver) waitForSpotInstanceRequest() (string, error) {
+	deadline := time.Now().Add(time.Duration(d.SpotFulfillmentTimeout) * time.Second)
+	status := "pending-evaluation"
+	for {
+		requests, err := d.getClient().DescribeSpotInstanceRequests(&ec2.DescribeSpotInstanceRequestsInput{
+			SpotInstanceRequestIds: []*string{&d.SpotInstanceRequestId},
+		})
+		if err != nil {
+			// AWS eventual consistency means we could not have SpotInstanceRequest ready yet
+			if awsErr, ok := err.(awserr.Error); !ok || awsErr.Code() != spotInstanceRequestNotFoundCode {
+				return "", fmt.Errorf("Error fulfilling spot request: %v", err)
+			}
+		} else if len(requests.SpotInstanceRequests) > 0 {
+			request := requests.SpotInstanceRequests[0]
+			if request.Status != nil {
+				status = aws.StringValue(request.Status.Code)
+			}
+			switch aws.StringValue(request.State) {
+			case ec2.SpotInstanceStateActive:
+				if request.InstanceId != nil {
+					return *request.InstanceId, nil
+				}
+			case ec2.SpotInstanceStateFailed, ec2.SpotInstanceStateCancelled, ec2.SpotInstanceStateClosed:
+				return "", fmt.Errorf("Error fulfilling spot request: %s", status)
+			}
+			log.Debugf("spot instance request %s is %s", d.SpotInstanceRequestId, status)
+		}
+
+		if time.Now().After(deadline) {
+			if err := d.cancelSpotInstanceRequest(); err != nil {
+				return "", err
+			}
+			d.SpotInstanceRequestId = ""
+			return "", fmt.Errorf("%w in %d seconds: %s", errorSpotRequestNotFulfilled, d.SpotFulfillmentTimeout, status)
+		}
+		time.Sleep(spotPollInterval)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// spotInterruption returns why EC2 interrupted the instance, if it is a
+// spot instance EC2 interrupted.
+func spotInterruption(inst *ec2.Instance) string {
+	if aws.StringValue(inst.InstanceLifecycle) != ec2.InstanceLifecycleTypeSpot || inst.StateReason == nil {
+		return ""
+	}
+	if !contains(spotInterruptionCodes, aws.StringValue(inst.StateReason.Code)) {
+		return ""
+	}
+	return aws.StringValue(inst.StateReason.Message)
+}
+
 // configureTags will add tags to the instance after
 // it has been created and transitioned into 'running'.
 func (d *Driver) configureTags(instance *ec2.Instance) error {
-	tags := append(buildEC2Tags(d.Tags), &ec2.Tag{
+	tags := append(d.ec2Tags(), &ec2.Tag{
 		Key:   aws.String("Name"),
 		Value: &d.MachineName,
 	})
@@ -958,10 +1423,50 @@ func (d *Driver) GetIP() (string, error) {
 		return *inst.PrivateIpAddress, nil
 	}
 
-	if inst.PublicIpAddress == nil {
+	ip := d.SelectIP(aws.StringValue(inst.PublicIpAddress), primaryIPv6(inst))
+	if ip == "" {
 		return "", fmt.Errorf("No IP for instance %v", *inst.InstanceId)
 	}
-	return *inst.PublicIpAddress, nil
+	return ip, nil
+}
+
+// primaryIPv6 returns the first IPv6 address of the primary network
+// interface of the instance.
+func primaryIPv6(inst *ec2.Instance) string {
+	for _, ni := range inst.NetworkInterfaces {
+		if ni.Attachment != nil && aws.Int64Value(ni.Attachment.DeviceIndex) == 0 && len(ni.Ipv6Addresses) > 0 {
+			return aws.StringValue(ni.Ipv6Addresses[0].Ipv6Address)
+		}
+	}
+	return ""
+}
+
+// GetIPs returns the public, private and IPv6 addresses of the instance,
+// those of its network interfaces labeled with the ID of the interface.
+func (d *Driver) GetIPs() ([]drivers.NetworkAddress, error) {
+	inst, err := d.getInstance()
+	if err != nil {
+		return nil, err
+	}
+
+	return instanceAddresses(inst), nil
+}
+
+func instanceAddresses(inst *ec2.Instance) []drivers.NetworkAddress {
+	var addrs []drivers.NetworkAddress
+	addrs = drivers.AppendAddress(addrs, drivers.AddressPublic, aws.StringValue(inst.PublicIpAddress))
+	for _, ni := range inst.NetworkInterfaces {
+		iface := aws.StringValue(ni.NetworkInterfaceId)
+		for _, ip := range ni.PrivateIpAddresses {
+			addrs = drivers.AppendInterfaceAddress(addrs, drivers.AddressPrivate, iface, aws.StringValue(ip.PrivateIpAddress))
+		}
+		for _, ip6 := range ni.Ipv6Addresses {
+			addrs = drivers.AppendInterfaceAddress(addrs, drivers.AddressIPv6, iface, aws.StringValue(ip6.Ipv6Address))
+		}
+	}
+	addrs = drivers.AppendAddress(addrs, drivers.AddressPrivate, aws.StringValue(inst.PrivateIpAddress))
+
+	return addrs
 }
 
 func (d *Driver) GetState() (state.State, error) {
@@ -979,8 +1484,14 @@ func (d *Driver) GetState() (state.State, error) {
 	case ec2.InstanceStateNameShuttingDown:
 		return state.Stopping, nil
 	case ec2.InstanceStateNameStopped:
+		if reason := spotInterruption(inst); reason != "" {
+			log.Warnf("spot instance %v of machine %v was interrupted by AWS: %s", d.InstanceId, d.MachineName, reason)
+		}
 		return state.Stopped, nil
 	case ec2.InstanceStateNameTerminated:
+		if reason := spotInterruption(inst); reason != "" {
+			return state.Error, fmt.Errorf("spot instance %v of machine %v was interrupted by AWS: %s", d.InstanceId, d.MachineName, reason)
+		}
 		return state.Error, fmt.Errorf("valid machine %v not found", d.MachineName)
 	default:
 		log.Warnf("unrecognized instance state: %v", *inst.State.Name)
@@ -1035,23 +1546,47 @@ func (d *Driver) Kill() error {
 	return err
 }
 
+// Resize changes the instance type of the instance, which EC2 only changes
+// while it is stopped.
+func (d *Driver) Resize(spec drivers.ResizeSpec) error {
+	if spec.InstanceType == "" {
+		return errorResizeWithoutInstanceType
+	}
+
+	err := drivers.WhileStopped(d, func() error {
+		_, err := d.getClient().ModifyInstanceAttribute(&ec2.ModifyInstanceAttributeInput{
+			InstanceId:   &d.InstanceId,
+			InstanceType: &ec2.AttributeValue{Value: aws.String(spec.InstanceType)},
+		})
+		return classifyError(err)
+	})
+	if err != nil {
+		return err
+	}
+
+	d.InstanceType = spec.InstanceType
+	return nil
+}
+
 func (d *Driver) Remove() error {
 	multierr := mcnutils.MultiError{
 		Errs: []error{},
 	}
 
-	if err := d.terminate(); err != nil {
-		multierr.Errs = append(multierr.Errs, err)
-	}
-
 	// In case of failure waiting for a SpotInstance, we must cancel the unfulfilled request, otherwise an instance may be created later.
-	// If the instance was created, terminating it will be enough for canceling the SpotInstanceRequest
-	if d.RequestSpotInstance && d.spotInstanceRequestId != "" {
+	// Persistent requests must be canceled before their instance is terminated, otherwise they launch another one.
+	if d.RequestSpotInstance && d.SpotInstanceRequestId != "" {
 		if err := d.cancelSpotInstanceRequest(); err != nil {
-			multierr.Errs = append(multierr.Errs, err)
+			if awsErr, ok := err.(awserr.Error); !ok || awsErr.Code() != spotInstanceRequestNotFoundCode {
+				multierr.Errs = append(multierr.Errs, err)
+			}
 		}
 	}
 
+	if err := d.terminate(); err != nil {
+		multierr.Errs = append(multierr.Errs, err)
+	}
+
 	if !d.ExistingKey {
 		if err := d.deleteKeyPair(); err != nil && !strings.Contains(err.Error(), "not found") {
 			multierr.Errs = append(multierr.Errs, err)
@@ -1068,7 +1603,7 @@ func (d *Driver) Remove() error {
 func (d *Driver) cancelSpotInstanceRequest() error {
 	// NB: Canceling a Spot instance request does not terminate running Spot instances associated with the request
 	_, err := d.getClient().CancelSpotInstanceRequests(&ec2.CancelSpotInstanceRequestsInput{
-		SpotInstanceRequestIds: []*string{&d.spotInstanceRequestId},
+		SpotInstanceRequestIds: []*string{&d.SpotInstanceRequestId},
 	})
 
 	return err
@@ -1111,7 +1646,7 @@ func (d *Driver) createKeyPair() error {
 
 	if d.SSHPrivateKeyPath == "" {
 		log.Debugf("Creating New SSH Key")
-		if err := ssh.GenerateSSHKey(d.GetSSHKeyPath()); err != nil {
+		if err := d.GenerateSSHKey(d.GetSSHKeyPath()); err != nil {
 			return err
 		}
 		keyPath = d.GetSSHKeyPath()
@@ -1205,7 +1740,7 @@ func (d *Driver) securityGroupAvailableFunc(id string) func() bool {
 //
 // NB: The ec2InstanceResource must be passed for the EC2 instance to have a name.
 func (d *Driver) buildResourceTags(resources []string) []*ec2.TagSpecification {
-	tags := buildEC2Tags(d.Tags)
+	tags := d.ec2Tags()
 	if len(tags) == 0 {
 		resource := ec2InstanceResource
 		return []*ec2.TagSpecification{{
@@ -1656,6 +2191,28 @@ func (d *Driver) getRegionZone() string {
 	return d.Zone
 }
 
+// ec2Tags returns the tags of --amazonec2-tags followed by the machine tags.
+func (d *Driver) ec2Tags() []*ec2.Tag {
+	tags := buildEC2Tags(d.Tags)
+	for _, key := range drivers.SortedTagKeys(d.MachineTags) {
+		tags = append(tags, &ec2.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(d.MachineTags[key]),
+		})
+	}
+	return tags
+}
+
+// GetTags returns the tags of the instance and of its volumes and network
+// interfaces.
+func (d *Driver) GetTags() (map[string]string, error) {
+	tags := map[string]string{}
+	for _, tag := range d.ec2Tags() {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	return tags, nil
+}
+
 // buildEC2Tags accepts a string of tagGroups (in the format of 'key1,value1,key2,value2')
 // and returns a slice of ec2.Tag's which can be applied to various ec2 resources.
 func buildEC2Tags(tagGroups string) []*ec2.Tag {
@@ -1,16 +1,21 @@
 package amazonec2
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"os"
 	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/rancher/machine/commands/commandstest"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/state"
 	"github.com/rancher/machine/version"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -517,3 +522,480 @@ func TestInvalidAMI(t *testing.T) {
 
 	assert.Error(t, err)
 }
+
+func fastSpotPolls(t *testing.T) {
+	orig := spotPollInterval
+	spotPollInterval = time.Millisecond
+	t.Cleanup(func() { spotPollInterval = orig })
+}
+
+func TestLaunchSpotInstance(t *testing.T) {
+	fastSpotPolls(t)
+	client := &fakeEC2WithSpot{fulfilledAfter: 3}
+	driver := NewCustomTestDriver(client)
+	driver.RequestSpotInstance = true
+	driver.SpotInterruptionBehavior = ec2.InstanceInterruptionBehaviorStop
+
+	instance, err := driver.launchSpotInstance(ec2.RunInstancesInput{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "i-spot", *instance.InstanceId)
+	assert.Equal(t, "sir-1", driver.SpotInstanceRequestId)
+	assert.Equal(t, &ec2.InstanceMarketOptionsRequest{
+		MarketType: aws.String(ec2.MarketTypeSpot),
+		SpotOptions: &ec2.SpotMarketOptions{
+			MaxPrice:                     aws.String(defaultSpotPrice),
+			SpotInstanceType:             aws.String(ec2.SpotInstanceTypePersistent),
+			InstanceInterruptionBehavior: aws.String(ec2.InstanceInterruptionBehaviorStop),
+		},
+	}, client.runInputs[0].InstanceMarketOptions)
+}
+
+func TestLaunchSpotInstanceOnDemandPrice(t *testing.T) {
+	fastSpotPolls(t)
+	client := &fakeEC2WithSpot{fulfilledAfter: 2}
+	driver := NewCustomTestDriver(client)
+	driver.SpotPrice = ""
+
+	_, err := driver.launchSpotInstance(ec2.RunInstancesInput{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, &ec2.SpotMarketOptions{
+		SpotInstanceType: aws.String(ec2.SpotInstanceTypeOneTime),
+	}, client.runInputs[0].InstanceMarketOptions.SpotOptions)
+}
+
+func TestLaunchSpotInstanceTimeout(t *testing.T) {
+	fastSpotPolls(t)
+	client := &fakeEC2WithSpot{}
+	driver := NewCustomTestDriver(client)
+	driver.SpotFulfillmentTimeout = 1
+
+	_, err := driver.launchSpotInstance(ec2.RunInstancesInput{})
+
+	assert.ErrorIs(t, err, errorSpotRequestNotFulfilled)
+	assert.EqualError(t, err, "spot instance request not fulfilled in 1 seconds: capacity-not-available")
+	assert.Equal(t, []string{"sir-1"}, client.canceled)
+	assert.Empty(t, driver.SpotInstanceRequestId)
+}
+
+func TestLaunchSpotInstanceNoCapacity(t *testing.T) {
+	client := &fakeEC2WithSpot{runErr: awserr.New("InsufficientInstanceCapacity", "There is no Spot capacity available that matches your request.", nil)}
+	driver := NewCustomTestDriver(client)
+
+	_, err := driver.launchSpotInstance(ec2.RunInstancesInput{})
+
+	assert.ErrorIs(t, err, errorSpotRequestNotFulfilled)
+
+	client.runErr = awserr.New("InvalidParameterValue", "Invalid max price", nil)
+	_, err = driver.launchSpotInstance(ec2.RunInstancesInput{})
+	assert.False(t, errors.Is(err, errorSpotRequestNotFulfilled))
+}
+
+func TestInvalidSpotOptions(t *testing.T) {
+	for data, expected := range map[string]error{
+		`{"amazonec2-spot-interruption-behavior": "pause"}`: errorInvalidValueForSpotInterruption,
+		`{"amazonec2-spot-fallback-on-demand": true}`:       errorSpotFallbackWithoutSpot,
+		`{"amazonec2-launch-template-version": "3"}`:        errorLaunchTemplateVersionWithoutId,
+	} {
+		values := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal([]byte(data), &values))
+		values["amazonec2-region"] = "us-east-1"
+
+		driver := NewCustomTestDriver(&fakeEC2WithLogin{})
+		driver.awsCredentialsFactory = NewValidAwsCredentials
+		err := driver.SetConfigFromFlags(&commandstest.FakeFlagger{Data: values})
+
+		assert.Equal(t, expected, err, data)
+	}
+}
+
+func TestGetStateSpotInterrupted(t *testing.T) {
+	client := &fakeEC2WithSpot{instance: &ec2.Instance{
+		InstanceId:        aws.String("i-spot"),
+		InstanceLifecycle: aws.String(ec2.InstanceLifecycleTypeSpot),
+		State:             &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameTerminated)},
+		StateReason: &ec2.StateReason{
+			Code:    aws.String("Server.SpotInstanceTermination"),
+			Message: aws.String("Server.SpotInstanceTermination: Spot instance termination"),
+		},
+	}}
+	driver := NewCustomTestDriver(client)
+	driver.InstanceId = "i-spot"
+
+	s, err := driver.GetState()
+	assert.Equal(t, state.Error, s)
+	assert.EqualError(t, err, "spot instance i-spot of machine machineFoo was interrupted by AWS: Server.SpotInstanceTermination: Spot instance termination")
+
+	client.instance.State.Name = aws.String(ec2.InstanceStateNameStopped)
+	client.instance.StateReason.Code = aws.String("Server.SpotInstanceShutdown")
+	s, err = driver.GetState()
+	assert.NoError(t, err)
+	assert.Equal(t, state.Stopped, s)
+}
+
+func TestRemoveCancelsSpotRequestFirst(t *testing.T) {
+	client := &fakeEC2WithSpot{}
+	driver := NewCustomTestDriver(client)
+	driver.RequestSpotInstance = true
+	driver.SpotInstanceRequestId = "sir-1"
+	driver.InstanceId = "i-spot"
+	driver.ExistingKey = true
+
+	assert.NoError(t, driver.Remove())
+	assert.Equal(t, []string{"sir-1"}, client.canceled)
+	assert.Equal(t, []string{"i-spot"}, client.terminated)
+}
+
+func TestInvalidHTTPHopLimit(t *testing.T) {
+	driver := NewCustomTestDriver(&fakeEC2WithLogin{})
+	driver.awsCredentialsFactory = NewValidAwsCredentials
+	options := &commandstest.FakeFlagger{
+		Data: map[string]interface{}{
+			"amazonec2-region":                      "us-east-1",
+			"amazonec2-http-tokens":                 "required",
+			"amazonec2-http-put-response-hop-limit": 65,
+		},
+	}
+
+	err := driver.SetConfigFromFlags(options)
+
+	assert.Equal(t, errorInvalidValueForHTTPHopLimit, err)
+}
+
+func TestLaunchTemplate(t *testing.T) {
+	driver := NewCustomTestDriver(&fakeEC2WithLaunchTemplate{data: &ec2.ResponseLaunchTemplateData{
+		ImageId:      aws.String("ami-0c43b23f011ba5061"),
+		InstanceType: aws.String("m6i.large"),
+		BlockDeviceMappings: []*ec2.LaunchTemplateBlockDeviceMapping{{
+			DeviceName: aws.String("/dev/sda1"),
+			Ebs:        &ec2.LaunchTemplateEbsBlockDevice{Encrypted: aws.Bool(true), KmsKeyId: aws.String("cmk")},
+		}},
+		MetadataOptions: &ec2.LaunchTemplateInstanceMetadataOptions{HttpTokens: aws.String("required")},
+	}})
+	driver.LaunchTemplateId = "lt-0abc"
+
+	assert.NoError(t, driver.checkLaunchTemplate())
+	assert.Equal(t, "ami-0c43b23f011ba5061", driver.AMI)
+	assert.Equal(t, "m6i.large", driver.InstanceType)
+
+	req := ec2.RunInstancesInput{
+		ImageId:             &driver.AMI,
+		InstanceType:        &driver.InstanceType,
+		KeyName:             aws.String("machineFoo"),
+		UserData:            aws.String("I2Nsb3VkLWNvbmZpZw=="),
+		BlockDeviceMappings: []*ec2.BlockDeviceMapping{{DeviceName: aws.String("/dev/sda1")}},
+		MetadataOptions:     &ec2.InstanceMetadataOptionsRequest{},
+		NetworkInterfaces:   []*ec2.InstanceNetworkInterfaceSpecification{{SubnetId: aws.String("subnet-1")}},
+	}
+	driver.applyLaunchTemplate(&req)
+
+	assert.Equal(t, ec2.RunInstancesInput{
+		LaunchTemplate: &ec2.LaunchTemplateSpecification{
+			LaunchTemplateId: aws.String("lt-0abc"),
+			Version:          aws.String("$Default"),
+		},
+		KeyName:           aws.String("machineFoo"),
+		UserData:          aws.String("I2Nsb3VkLWNvbmZpZw=="),
+		NetworkInterfaces: []*ec2.InstanceNetworkInterfaceSpecification{{SubnetId: aws.String("subnet-1")}},
+	}, req)
+}
+
+func TestLaunchTemplateNotFound(t *testing.T) {
+	driver := NewCustomTestDriver(&fakeEC2WithLaunchTemplate{})
+	driver.LaunchTemplateId = "lt-0abc"
+	driver.LaunchTemplateVersion = "7"
+
+	assert.EqualError(t, driver.checkLaunchTemplate(), "launch template lt-0abc version 7 not found on region us-east-1")
+
+	driver.LaunchTemplateId = "lt-0def"
+	assert.Error(t, driver.checkLaunchTemplate())
+}
+
+func TestCheckArchitecture(t *testing.T) {
+	ec2Client := &fakeEC2WithArchitecture{
+		instanceTypes: map[string][]string{
+			"t3.micro":    {"x86_64"},
+			"t2.micro":    {"i386", "x86_64"},
+			"t4g.micro":   {"arm64"},
+			"g4dn.xlarge": {"x86_64"},
+			"g5g.xlarge":  {"arm64"},
+		},
+		gpus: map[string]int64{"g4dn.xlarge": 1, "g5g.xlarge": 1},
+	}
+	ssmClient := &fakeSSM{parameters: map[string]string{
+		"/aws/service/canonical/ubuntu/server/22.04/stable/current/arm64/hvm/ebs-gp2/ami-id":         "ami-0arm64",
+		"/aws/service/deeplearning/ami/x86_64/base-oss-nvidia-driver-gpu-ubuntu-22.04/latest/ami-id": "ami-0nvidia",
+		"/aws/service/deeplearning/ami/arm64/base-oss-nvidia-driver-gpu-ubuntu-22.04/latest/ami-id":  "ami-0nvidiaarm64",
+	}}
+	defaultAMI := regionDetails["us-east-1"].AmiId
+
+	tests := []struct {
+		instanceType string
+		ami          string
+		architecture string
+		wantAMI      string
+	}{
+		{"t3.micro", defaultAMI, "x86_64", defaultAMI},
+		{"t2.micro", defaultAMI, "x86_64", defaultAMI},
+		{"t4g.micro", defaultAMI, "arm64", "ami-0arm64"},
+		{"t4g.micro", "ami-0custom", "arm64", "ami-0custom"},
+		{"g4dn.xlarge", defaultAMI, "x86_64", "ami-0nvidia"},
+		{"g5g.xlarge", defaultAMI, "arm64", "ami-0nvidiaarm64"},
+		{"g4dn.xlarge", "ami-0custom", "x86_64", "ami-0custom"},
+	}
+
+	for _, test := range tests {
+		driver := NewCustomTestDriver(ec2Client)
+		driver.ssmClientFactory = func() SSMClient { return ssmClient }
+		driver.InstanceType = test.instanceType
+		driver.AMI = test.ami
+
+		assert.NoError(t, driver.checkArchitecture(), test.instanceType)
+		assert.Equal(t, test.architecture, driver.Architecture, test.instanceType)
+		assert.Equal(t, test.wantAMI, driver.AMI, test.instanceType)
+	}
+
+	driver := NewCustomTestDriver(ec2Client)
+	driver.InstanceType = "m7x.large"
+	assert.EqualError(t, driver.checkArchitecture(), "instance type m7x.large not found on region us-east-1")
+}
+
+func TestCheckArchitectureDenied(t *testing.T) {
+	driver := NewCustomTestDriver(&fakeEC2WithArchitecture{
+		describeErr: awserr.New("UnauthorizedOperation", "You are not authorized to perform this operation.", nil),
+	})
+	driver.InstanceType = "t4g.micro"
+	defaultAMI := driver.AMI
+
+	assert.NoError(t, driver.checkArchitecture())
+	assert.Empty(t, driver.Architecture)
+	assert.Equal(t, defaultAMI, driver.AMI)
+
+	driver = NewCustomTestDriver(&fakeEC2WithArchitecture{
+		describeErr: awserr.New("InvalidInstanceType", "The instance type is invalid.", nil),
+	})
+	assert.Error(t, driver.checkArchitecture())
+}
+
+func TestCheckAMIArchitecture(t *testing.T) {
+	driver := NewCustomTestDriver(&fakeEC2WithArchitecture{images: map[string]string{
+		"ami-0amd64": "x86_64",
+		"ami-0arm64": "arm64",
+	}})
+	driver.InstanceType = "t4g.micro"
+	driver.Architecture = "arm64"
+
+	driver.AMI = "ami-0arm64"
+	assert.NoError(t, driver.checkAMI())
+
+	driver.AMI = "ami-0amd64"
+	assert.EqualError(t, driver.checkAMI(), "AMI ami-0amd64 is x86_64, but instance type t4g.micro is arm64")
+}
+
+func TestClassifyError(t *testing.T) {
+	assert.Equal(t, drivers.ErrorCodeQuotaExceeded, drivers.GetErrorCode(classifyError(awserr.New("InstanceLimitExceeded", "limit", nil))))
+	assert.Equal(t, drivers.ErrorCodeAuthFailure, drivers.GetErrorCode(classifyError(awserr.New("AuthFailure", "denied", nil))))
+	assert.Equal(t, drivers.ErrorCodeNotFound, drivers.GetErrorCode(classifyError(awserr.New("InvalidAMIID.NotFound", "no ami", nil))))
+	assert.True(t, drivers.IsRetryable(classifyError(awserr.New("RequestLimitExceeded", "throttled", nil))))
+	assert.Equal(t, drivers.ErrorCode(""), drivers.GetErrorCode(classifyError(awserr.New("InvalidParameterValue", "bad", nil))))
+	assert.Equal(t, drivers.ErrorCode(""), drivers.GetErrorCode(classifyError(errors.New("unknown"))))
+}
+
+func TestAdditionalSubnetRequiresPrivateAddress(t *testing.T) {
+	values := map[string]interface{}{
+		"amazonec2-region":               "us-east-1",
+		"amazonec2-additional-subnet-id": []string{"subnet-private"},
+	}
+
+	driver := NewCustomTestDriver(&fakeEC2WithLogin{})
+	driver.awsCredentialsFactory = NewValidAwsCredentials
+	assert.Equal(t, errorAdditionalSubnetWithPublicIP, driver.SetConfigFromFlags(&commandstest.FakeFlagger{Data: values}))
+
+	values["amazonec2-private-address-only"] = true
+	assert.NoError(t, driver.SetConfigFromFlags(&commandstest.FakeFlagger{Data: values}))
+	assert.Equal(t, []string{"subnet-private"}, driver.AdditionalSubnetIds)
+}
+
+func TestInstanceAddresses(t *testing.T) {
+	inst := &ec2.Instance{
+		PrivateIpAddress: aws.String("10.0.0.5"),
+		NetworkInterfaces: []*ec2.InstanceNetworkInterface{
+			{
+				NetworkInterfaceId: aws.String("eni-primary"),
+				PrivateIpAddresses: []*ec2.InstancePrivateIpAddress{{PrivateIpAddress: aws.String("10.0.0.5")}},
+				Ipv6Addresses:      []*ec2.InstanceIpv6Address{{Ipv6Address: aws.String("2001:db8::5")}},
+			},
+			{
+				NetworkInterfaceId: aws.String("eni-backend"),
+				PrivateIpAddresses: []*ec2.InstancePrivateIpAddress{{PrivateIpAddress: aws.String("10.1.0.5")}},
+			},
+		},
+	}
+
+	assert.Equal(t, []drivers.NetworkAddress{
+		{Kind: drivers.AddressPrivate, Address: "10.0.0.5", Interface: "eni-primary"},
+		{Kind: drivers.AddressIPv6, Address: "2001:db8::5", Interface: "eni-primary"},
+		{Kind: drivers.AddressPrivate, Address: "10.1.0.5", Interface: "eni-backend"},
+	}, instanceAddresses(inst))
+}
+
+func TestPrimaryIPv6(t *testing.T) {
+	inst := &ec2.Instance{
+		NetworkInterfaces: []*ec2.InstanceNetworkInterface{
+			{
+				Attachment:    &ec2.InstanceNetworkInterfaceAttachment{DeviceIndex: aws.Int64(1)},
+				Ipv6Addresses: []*ec2.InstanceIpv6Address{{Ipv6Address: aws.String("2001:db8:1::5")}},
+			},
+			{
+				Attachment:    &ec2.InstanceNetworkInterfaceAttachment{DeviceIndex: aws.Int64(0)},
+				Ipv6Addresses: []*ec2.InstanceIpv6Address{{Ipv6Address: aws.String("2001:db8::5")}},
+			},
+		},
+	}
+
+	assert.Equal(t, "2001:db8::5", primaryIPv6(inst))
+	assert.Empty(t, primaryIPv6(&ec2.Instance{}))
+}
+
+func TestBuildResourceTagsMachineTags(t *testing.T) {
+	driver := NewTestDriver()
+	driver.MachineName = "tagged"
+	driver.Tags = "owner,ops"
+	driver.MachineTags = map[string]string{"team": "infra", "env": "prod"}
+
+	specs := driver.buildResourceTags([]string{ec2VolumeResource})
+
+	assert.Len(t, specs, 1)
+	assert.Equal(t, []*ec2.Tag{
+		{Key: aws.String("owner"), Value: aws.String("ops")},
+		{Key: aws.String("env"), Value: aws.String("prod")},
+		{Key: aws.String("team"), Value: aws.String("infra")},
+	}, specs[0].Tags)
+
+	tags, err := driver.GetTags()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"owner": "ops", "env": "prod", "team": "infra"}, tags)
+}
+
+func TestSnapshots(t *testing.T) {
+	ec2Client := &fakeEC2WithSnapshots{}
+	driver := NewCustomTestDriver(ec2Client)
+	driver.InstanceId = "i-0123"
+
+	_, err := driver.CreateSnapshot("base")
+	assert.NoError(t, err)
+	snapshot, err := driver.CreateSnapshot("configured")
+	assert.NoError(t, err)
+	assert.Equal(t, "snap-2", snapshot.ID)
+	assert.Equal(t, "configured", snapshot.Name)
+	assert.Equal(t, "vol-root", aws.StringValue(ec2Client.snapshots[0].VolumeId))
+	assert.Contains(t, ec2Client.snapshots[0].Tags, &ec2.Tag{Key: aws.String(snapshotInstanceTag), Value: aws.String("i-0123")})
+
+	snapshots, err := driver.ListSnapshots()
+	assert.NoError(t, err)
+	assert.Equal(t, []drivers.Snapshot{
+		{ID: "snap-1", Name: "base", Created: time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)},
+		{ID: "snap-2", Name: "configured", Created: time.Date(2024, 5, 2, 10, 1, 0, 0, time.UTC)},
+	}, snapshots)
+
+	assert.NoError(t, driver.RestoreSnapshot("snap-1"))
+	assert.Equal(t, "i-0123", aws.StringValue(ec2Client.restored.InstanceId))
+	assert.Equal(t, "snap-1", aws.StringValue(ec2Client.restored.SnapshotId))
+}
+
+func TestResize(t *testing.T) {
+	ec2Client := &fakeEC2WithResize{state: ec2.InstanceStateNameRunning, instanceType: "t3.small"}
+	driver := NewCustomTestDriver(ec2Client)
+	driver.InstanceId = "i-0123"
+
+	err := driver.Resize(drivers.ResizeSpec{InstanceType: "t3.large"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "t3.large", ec2Client.instanceType)
+	assert.Equal(t, ec2.InstanceStateNameStopped, ec2Client.modifiedIn)
+	assert.Equal(t, ec2.InstanceStateNameRunning, ec2Client.state)
+	assert.Equal(t, "t3.large", driver.InstanceType)
+}
+
+func TestResizeWithoutInstanceType(t *testing.T) {
+	driver := NewCustomTestDriver(&fakeEC2WithResize{})
+
+	err := driver.Resize(drivers.ResizeSpec{CPUs: 4})
+
+	assert.Equal(t, errorResizeWithoutInstanceType, err)
+}
+
+func TestPreCreatePlan(t *testing.T) {
+	groups := []string{"existingGroup", "newGroup"}
+	recorder := fakeEC2SecurityGroupTestRecorder{}
+	recorder.On("DescribeSecurityGroups", mock.MatchedBy(matchGroupLookup(groups))).Return(
+		&ec2.DescribeSecurityGroupsOutput{SecurityGroups: []*ec2.SecurityGroup{
+			{GroupName: aws.String("existingGroup"), GroupId: aws.String("existingGroupId")},
+		}}, nil)
+
+	driver := NewCustomTestDriver(&recorder)
+	driver.SecurityGroupNames = groups
+	driver.VpcId = "vpc-1"
+	driver.SubnetId = "subnet-1"
+	driver.AMI = "ami-1"
+	driver.InstanceType = "t3.micro"
+	driver.RequestSpotInstance = true
+	driver.SpotPrice = "0.10"
+
+	resources, err := driver.PreCreatePlan()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []drivers.PlannedResource{
+		{Type: "key-pair", Name: "machineFoo-*"},
+		{Type: "security-group", Name: "newGroup", Details: "in vpc-1"},
+		{Type: "spot-instances-request", Name: "machineFoo", Details: "at most 0.10"},
+		{Type: "instance", Name: "machineFoo", Details: "t3.micro from ami-1 in subnet-1"},
+	}, resources)
+	recorder.AssertExpectations(t)
+}
+
+func TestBase64UserDataFromMachineUserData(t *testing.T) {
+	dir := t.TempDir()
+	userdataPath := filepath.Join(dir, "machine-userdata.yml")
+	assert.NoError(t, os.WriteFile(userdataPath, []byte("hostname: {{.MachineName}}\n"), 0600))
+
+	driver := NewTestDriver()
+	driver.MachineUserDataFile = userdataPath
+
+	userdata, err := driver.Base64UserData()
+
+	assert.NoError(t, err)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("hostname: "+driver.MachineName+"\n")), userdata)
+}
+
+func TestEstimateCost(t *testing.T) {
+	pricingClient := &fakePricing{price: "0.0104000000"}
+	driver := NewTestDriver()
+	driver.pricingClientFactory = func() PricingClient { return pricingClient }
+	driver.InstanceType = "t3.micro"
+	driver.Region = "eu-west-1"
+
+	estimate, err := driver.EstimateCost()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "USD", estimate.Currency)
+	assert.Equal(t, 0.0104, estimate.Hourly)
+	assert.InDelta(t, 7.592, estimate.Monthly, 0.0001)
+	assert.Equal(t, "t3.micro", pricingClient.filters["instanceType"])
+	assert.Equal(t, "eu-west-1", pricingClient.filters["regionCode"])
+}
+
+func TestEstimateCostWithoutPrice(t *testing.T) {
+	driver := NewTestDriver()
+	driver.pricingClientFactory = func() PricingClient { return &fakePricing{} }
+
+	_, err := driver.EstimateCost()
+
+	assert.Equal(t, drivers.ErrorCodeNotFound, drivers.GetErrorCode(err))
+
+	driver.Endpoint = "https://ec2.example.com"
+	_, err = driver.EstimateCost()
+
+	assert.Equal(t, drivers.ErrCostNotSupported, err)
+}
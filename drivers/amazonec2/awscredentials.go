@@ -48,6 +48,9 @@ func (c *defaultAWSCredentials) Credentials() *credentials.Credentials {
 
 type AwsDefaultCredentialsProvider struct{}
 
+// Credentials returns the credentials of the default chain of the SDK,
+// reading the ones of an instance role with IMDSv2, and with IMDSv1 on the
+// instances without the session tokens of IMDSv2.
 func (c *AwsDefaultCredentialsProvider) Credentials() *credentials.Credentials {
 	return session.New().Config.Credentials
 }
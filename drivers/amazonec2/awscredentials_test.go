@@ -1,7 +1,12 @@
 package amazonec2
 
 import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -99,3 +104,59 @@ func TestErrorGeneratedWhenAllProvidersGenerateErrors(t *testing.T) {
 	_, err := awsCreds.Credentials().Get()
 	assert.Error(t, err)
 }
+
+// fakeIMDS answers the calls of the SDK like the instance metadata service
+// of an instance requiring IMDSv2 sessions, or of an instance with IMDSv1
+// only without tokens.
+func fakeIMDS(t *testing.T, tokens bool) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && r.URL.Path == "/latest/api/token" {
+			if !tokens {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Header().Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+			io.WriteString(w, "TOKEN")
+			return
+		}
+		if tokens && r.Header.Get("X-Aws-Ec2-Metadata-Token") != "TOKEN" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/latest/meta-data/iam/security-credentials/":
+			io.WriteString(w, "machine-role")
+		case "/latest/meta-data/iam/security-credentials/machine-role":
+			io.WriteString(w, `{"Code": "Success", "AccessKeyId": "role_access", "SecretAccessKey": "role_secret", "Token": "role_token", "Expiration": "`+time.Now().Add(time.Hour).UTC().Format(time.RFC3339)+`"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "")
+	t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", server.URL)
+}
+
+func TestInstanceRoleCredentialsUseIMDSv2(t *testing.T) {
+	fakeIMDS(t, true)
+
+	creds, err := (&AwsDefaultCredentialsProvider{}).Credentials().Get()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "role_access", creds.AccessKeyID)
+	assert.Equal(t, "role_token", creds.SessionToken)
+}
+
+func TestInstanceRoleCredentialsFallBackToIMDSv1(t *testing.T) {
+	fakeIMDS(t, false)
+
+	creds, err := (&AwsDefaultCredentialsProvider{}).Credentials().Get()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "role_access", creds.AccessKeyID)
+}
@@ -0,0 +1,96 @@
+package amazonec2
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/pricing"
+	"github.com/rancher/machine/libmachine/drivers"
+)
+
+// pricingRegion is the region of the Price List API endpoint used.
+const pricingRegion = "us-east-1"
+
+// priceListProduct is the part of a product of the Price List API holding
+// its on-demand prices.
+type priceListProduct struct {
+	Terms struct {
+		OnDemand map[string]struct {
+			PriceDimensions map[string]struct {
+				Unit         string            `json:"unit"`
+				PricePerUnit map[string]string `json:"pricePerUnit"`
+			} `json:"priceDimensions"`
+		} `json:"OnDemand"`
+	} `json:"terms"`
+}
+
+// EstimateCost returns the on-demand price of the instance type in the
+// region, running Linux on shared tenancy. Spot instances cost at most that.
+func (d *Driver) EstimateCost() (*drivers.CostEstimate, error) {
+	if d.Endpoint != "" || strings.HasPrefix(d.Region, "cn-") {
+		return nil, drivers.ErrCostNotSupported
+	}
+
+	filters := map[string]string{
+		"instanceType":    d.InstanceType,
+		"regionCode":      d.Region,
+		"operatingSystem": "Linux",
+		"tenancy":         "Shared",
+		"preInstalledSw":  "NA",
+		"capacitystatus":  "Used",
+	}
+	input := &pricing.GetProductsInput{
+		ServiceCode: aws.String("AmazonEC2"),
+		MaxResults:  aws.Int64(1),
+	}
+	for field, value := range filters {
+		input.Filters = append(input.Filters, &pricing.Filter{
+			Type:  aws.String(pricing.FilterTypeTermMatch),
+			Field: aws.String(field),
+			Value: aws.String(value),
+		})
+	}
+
+	products, err := d.pricingClientFactory().GetProducts(input)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	if len(products.PriceList) == 0 {
+		return nil, drivers.Errorf(drivers.ErrorCodeNotFound, "no price of instance type %s in region %s", d.InstanceType, d.Region)
+	}
+
+	hourly, err := onDemandHourlyPrice(products.PriceList[0])
+	if err != nil {
+		return nil, err
+	}
+	return &drivers.CostEstimate{
+		Currency: "USD",
+		Hourly:   hourly,
+		Monthly:  hourly * drivers.HoursPerMonth,
+		Source:   fmt.Sprintf("AWS on-demand price of %s, excluding EBS", d.InstanceType),
+	}, nil
+}
+
+// onDemandHourlyPrice returns the hourly USD price of the product.
+func onDemandHourlyPrice(product aws.JSONValue) (float64, error) {
+	raw, err := json.Marshal(product)
+	if err != nil {
+		return 0, err
+	}
+	var p priceListProduct
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return 0, err
+	}
+
+	for _, term := range p.Terms.OnDemand {
+		for _, dimension := range term.PriceDimensions {
+			if price, ok := dimension.PricePerUnit["USD"]; ok && dimension.Unit == "Hrs" {
+				return strconv.ParseFloat(price, 64)
+			}
+		}
+	}
+	return 0, fmt.Errorf("no hourly on-demand price in the price list")
+}
@@ -0,0 +1,82 @@
+package amazonec2
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/rancher/machine/libmachine/drivers"
+)
+
+// PreCreatePlan returns the key pair, the security groups missing from the
+// VPC, the spot request and the instance Create would create.
+func (d *Driver) PreCreatePlan() ([]drivers.PlannedResource, error) {
+	if _, err := d.Base64UserData(); err != nil {
+		return nil, err
+	}
+
+	resources := []drivers.PlannedResource{}
+	if d.SSHPrivateKeyPath == "" || d.KeyName == "" {
+		resources = append(resources, drivers.PlannedResource{Type: "key-pair", Name: d.MachineName + "-*"})
+	}
+
+	missing, err := d.missingSecurityGroups()
+	if err != nil {
+		return nil, err
+	}
+	for _, groupName := range missing {
+		resources = append(resources, drivers.PlannedResource{Type: "security-group", Name: groupName, Details: "in " + d.VpcId})
+	}
+
+	if d.RequestSpotInstance {
+		spot := drivers.PlannedResource{Type: "spot-instances-request", Name: d.MachineName}
+		if d.SpotPrice != "" {
+			spot.Details = "at most " + d.SpotPrice
+		}
+		resources = append(resources, spot)
+	}
+	resources = append(resources, drivers.PlannedResource{
+		Type:    ec2InstanceResource,
+		Name:    d.MachineName,
+		Details: fmt.Sprintf("%s from %s in %s", d.InstanceType, d.AMI, d.SubnetId),
+	})
+	return resources, nil
+}
+
+// missingSecurityGroups returns the names of the security groups of the
+// machine that configureSecurityGroups would create.
+func (d *Driver) missingSecurityGroups() ([]string, error) {
+	groupNames := d.securityGroupNames()
+	if len(groupNames) == 0 {
+		return nil, nil
+	}
+
+	groups, err := d.getClient().DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("group-name"),
+				Values: makePointerSlice(groupNames),
+			},
+			{
+				Name:   aws.String("vpc-id"),
+				Values: []*string{&d.VpcId},
+			},
+		},
+	})
+	if err != nil {
+		return nil, classifyError(err)
+	}
+
+	existing := map[string]bool{}
+	for _, group := range groups.SecurityGroups {
+		existing[aws.StringValue(group.GroupName)] = true
+	}
+
+	var missing []string
+	for _, groupName := range groupNames {
+		if !existing[groupName] {
+			missing = append(missing, groupName)
+		}
+	}
+	return missing, nil
+}
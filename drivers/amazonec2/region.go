@@ -2,8 +2,21 @@ package amazonec2
 
 import (
 	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ssm"
 )
 
+// ubuntuAMIParameter is the public SSM parameter naming the current Ubuntu
+// 22.04 LTS hvm:ebs-ssd AMI of an architecture in the region of the client.
+const ubuntuAMIParameter = "/aws/service/canonical/ubuntu/server/22.04/stable/current/%s/hvm/ebs-gp2/ami-id"
+
+// nvidiaAMIParameter is the public SSM parameter naming the current Ubuntu
+// 22.04 Deep Learning Base AMI, which has the NVIDIA driver, of an
+// architecture in the region of the client.
+const nvidiaAMIParameter = "/aws/service/deeplearning/ami/%s/base-oss-nvidia-driver-gpu-ubuntu-22.04/latest/ami-id"
+
 type region struct {
 	AmiId string
 }
@@ -45,6 +58,30 @@ var regionDetails map[string]*region = map[string]*region{
 	"custom-endpoint": {""},
 }
 
+// ubuntuAMI returns the current Ubuntu AMI of the architecture, named like
+// the EC2 API does, e.g. arm64.
+func ubuntuAMI(client SSMClient, arch string) (string, error) {
+	parameter, err := client.GetParameter(&ssm.GetParameterInput{
+		Name: aws.String(fmt.Sprintf(ubuntuAMIParameter, arch)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to find the Ubuntu AMI for %s: %s", arch, err)
+	}
+	return aws.StringValue(parameter.Parameter.Value), nil
+}
+
+// nvidiaAMI returns the current Ubuntu AMI with the NVIDIA driver of the
+// architecture.
+func nvidiaAMI(client SSMClient, arch string) (string, error) {
+	parameter, err := client.GetParameter(&ssm.GetParameterInput{
+		Name: aws.String(fmt.Sprintf(nvidiaAMIParameter, arch)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to find the Ubuntu AMI with the NVIDIA driver for %s: %s", arch, err)
+	}
+	return aws.StringValue(parameter.Parameter.Value), nil
+}
+
 func awsRegionsList() []string {
 	var list []string
 
@@ -0,0 +1,100 @@
+package amazonec2
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/rancher/machine/libmachine/drivers"
+)
+
+// snapshotInstanceTag is the tag giving the ID of the instance an EBS
+// snapshot was taken of, which outlives the root volume it was taken of.
+const snapshotInstanceTag = "machine-instance-id"
+
+// CreateSnapshot takes an EBS snapshot of the root volume of the instance.
+func (d *Driver) CreateSnapshot(name string) (drivers.Snapshot, error) {
+	instance, err := d.getInstance()
+	if err != nil {
+		return drivers.Snapshot{}, err
+	}
+	volumeID := rootVolumeID(instance)
+	if volumeID == "" {
+		return drivers.Snapshot{}, fmt.Errorf("instance %s has no EBS root volume", d.InstanceId)
+	}
+
+	tags := append(d.ec2Tags(),
+		&ec2.Tag{Key: aws.String("Name"), Value: aws.String(name)},
+		&ec2.Tag{Key: aws.String(snapshotInstanceTag), Value: aws.String(d.InstanceId)},
+	)
+	snapshot, err := d.getClient().CreateSnapshot(&ec2.CreateSnapshotInput{
+		VolumeId:    aws.String(volumeID),
+		Description: aws.String(fmt.Sprintf("Snapshot %s of %s", name, d.MachineName)),
+		TagSpecifications: []*ec2.TagSpecification{{
+			ResourceType: aws.String(ec2.ResourceTypeSnapshot),
+			Tags:         tags,
+		}},
+	})
+	if err != nil {
+		return drivers.Snapshot{}, classifyError(err)
+	}
+	return ec2Snapshot(snapshot), nil
+}
+
+// ListSnapshots returns the EBS snapshots taken of the instance, oldest
+// first.
+func (d *Driver) ListSnapshots() ([]drivers.Snapshot, error) {
+	out, err := d.getClient().DescribeSnapshots(&ec2.DescribeSnapshotsInput{
+		OwnerIds: []*string{aws.String("self")},
+		Filters: []*ec2.Filter{{
+			Name:   aws.String("tag:" + snapshotInstanceTag),
+			Values: []*string{aws.String(d.InstanceId)},
+		}},
+	})
+	if err != nil {
+		return nil, classifyError(err)
+	}
+
+	snapshots := make([]drivers.Snapshot, 0, len(out.Snapshots))
+	for _, snapshot := range out.Snapshots {
+		snapshots = append(snapshots, ec2Snapshot(snapshot))
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Created.Before(snapshots[j].Created)
+	})
+	return snapshots, nil
+}
+
+// RestoreSnapshot replaces the root volume of the instance by a volume
+// created from the EBS snapshot, which EC2 does while the instance runs.
+func (d *Driver) RestoreSnapshot(id string) error {
+	_, err := d.getClient().CreateReplaceRootVolumeTask(&ec2.CreateReplaceRootVolumeTaskInput{
+		InstanceId:               aws.String(d.InstanceId),
+		SnapshotId:               aws.String(id),
+		DeleteReplacedRootVolume: aws.Bool(true),
+	})
+	return classifyError(err)
+}
+
+func rootVolumeID(instance *ec2.Instance) string {
+	for _, mapping := range instance.BlockDeviceMappings {
+		if aws.StringValue(mapping.DeviceName) == aws.StringValue(instance.RootDeviceName) && mapping.Ebs != nil {
+			return aws.StringValue(mapping.Ebs.VolumeId)
+		}
+	}
+	return ""
+}
+
+func ec2Snapshot(snapshot *ec2.Snapshot) drivers.Snapshot {
+	s := drivers.Snapshot{
+		ID:      aws.StringValue(snapshot.SnapshotId),
+		Created: aws.TimeValue(snapshot.StartTime),
+	}
+	for _, tag := range snapshot.Tags {
+		if aws.StringValue(tag.Key) == "Name" {
+			s.Name = aws.StringValue(tag.Value)
+		}
+	}
+	return s
+}
@@ -2,10 +2,15 @@ package amazonec2
 
 import (
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/pricing"
+	"github.com/aws/aws-sdk-go/service/ssm"
 
 	"github.com/stretchr/testify/mock"
 )
@@ -177,3 +182,238 @@ func NewCustomTestDriver(ec2Client Ec2Client) *Driver {
 	}
 	return driver
 }
+
+// fakeEC2WithSpot launches spot instances, fulfilling their requests once
+// described fulfilledAfter times, and records the calls.
+type fakeEC2WithSpot struct {
+	*fakeEC2
+	runErr         error
+	fulfilledAfter int
+	instance       *ec2.Instance
+
+	runInputs  []*ec2.RunInstancesInput
+	describes  int
+	canceled   []string
+	terminated []string
+}
+
+func (f *fakeEC2WithSpot) RunInstances(input *ec2.RunInstancesInput) (*ec2.Reservation, error) {
+	f.runInputs = append(f.runInputs, input)
+	if input.InstanceMarketOptions == nil {
+		return &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("i-ondemand")}}}, nil
+	}
+	if f.runErr != nil {
+		return nil, f.runErr
+	}
+	return &ec2.Reservation{Instances: []*ec2.Instance{{InstanceId: aws.String("i-spot"), SpotInstanceRequestId: aws.String("sir-1")}}}, nil
+}
+
+func (f *fakeEC2WithSpot) DescribeSpotInstanceRequests(input *ec2.DescribeSpotInstanceRequestsInput) (*ec2.DescribeSpotInstanceRequestsOutput, error) {
+	f.describes++
+	if f.describes == 1 {
+		return nil, awserr.New(spotInstanceRequestNotFoundCode, "The spot instance request ID 'sir-1' does not exist", nil)
+	}
+	if f.fulfilledAfter == 0 || f.describes < f.fulfilledAfter {
+		return &ec2.DescribeSpotInstanceRequestsOutput{SpotInstanceRequests: []*ec2.SpotInstanceRequest{{
+			State:  aws.String(ec2.SpotInstanceStateOpen),
+			Status: &ec2.SpotInstanceStatus{Code: aws.String("capacity-not-available")},
+		}}}, nil
+	}
+	return &ec2.DescribeSpotInstanceRequestsOutput{SpotInstanceRequests: []*ec2.SpotInstanceRequest{{
+		State:      aws.String(ec2.SpotInstanceStateActive),
+		Status:     &ec2.SpotInstanceStatus{Code: aws.String("fulfilled")},
+		InstanceId: aws.String("i-spot"),
+	}}}, nil
+}
+
+func (f *fakeEC2WithSpot) DescribeInstances(input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+	instance := f.instance
+	if instance == nil {
+		instance = &ec2.Instance{InstanceId: input.InstanceIds[0]}
+	}
+	return &ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{Instances: []*ec2.Instance{instance}}}}, nil
+}
+
+func (f *fakeEC2WithSpot) CancelSpotInstanceRequests(input *ec2.CancelSpotInstanceRequestsInput) (*ec2.CancelSpotInstanceRequestsOutput, error) {
+	f.canceled = append(f.canceled, *input.SpotInstanceRequestIds[0])
+	return &ec2.CancelSpotInstanceRequestsOutput{}, nil
+}
+
+func (f *fakeEC2WithSpot) TerminateInstances(input *ec2.TerminateInstancesInput) (*ec2.TerminateInstancesOutput, error) {
+	if len(f.canceled) == 0 {
+		return nil, errors.New("persistent request not canceled before terminating its instance")
+	}
+	f.terminated = append(f.terminated, *input.InstanceIds[0])
+	return &ec2.TerminateInstancesOutput{}, nil
+}
+
+type fakeEC2WithLaunchTemplate struct {
+	*fakeEC2WithLogin
+	data *ec2.ResponseLaunchTemplateData
+}
+
+func (f *fakeEC2WithLaunchTemplate) DescribeLaunchTemplateVersions(input *ec2.DescribeLaunchTemplateVersionsInput) (*ec2.DescribeLaunchTemplateVersionsOutput, error) {
+	if *input.LaunchTemplateId != "lt-0abc" {
+		return nil, awserr.New("InvalidLaunchTemplateId.NotFound", "The specified launch template does not exist", nil)
+	}
+	if *input.Versions[0] != "$Default" {
+		return &ec2.DescribeLaunchTemplateVersionsOutput{}, nil
+	}
+	return &ec2.DescribeLaunchTemplateVersionsOutput{LaunchTemplateVersions: []*ec2.LaunchTemplateVersion{{
+		LaunchTemplateData: f.data,
+	}}}, nil
+}
+
+// fakeEC2WithArchitecture describes instance types of the architectures and
+// images of the architectures, both by name.
+type fakeEC2WithArchitecture struct {
+	*fakeEC2
+	instanceTypes map[string][]string
+	gpus          map[string]int64
+	images        map[string]string
+	describeErr   error
+}
+
+func (f *fakeEC2WithArchitecture) DescribeInstanceTypes(input *ec2.DescribeInstanceTypesInput) (*ec2.DescribeInstanceTypesOutput, error) {
+	if f.describeErr != nil {
+		return nil, f.describeErr
+	}
+	architectures, ok := f.instanceTypes[aws.StringValue(input.InstanceTypes[0])]
+	if !ok {
+		return &ec2.DescribeInstanceTypesOutput{}, nil
+	}
+	info := &ec2.InstanceTypeInfo{
+		ProcessorInfo: &ec2.ProcessorInfo{SupportedArchitectures: aws.StringSlice(architectures)},
+	}
+	if gpus := f.gpus[aws.StringValue(input.InstanceTypes[0])]; gpus > 0 {
+		info.GpuInfo = &ec2.GpuInfo{Gpus: []*ec2.GpuDeviceInfo{{Manufacturer: aws.String("NVIDIA"), Count: aws.Int64(gpus)}}}
+	}
+	return &ec2.DescribeInstanceTypesOutput{InstanceTypes: []*ec2.InstanceTypeInfo{info}}, nil
+}
+
+func (f *fakeEC2WithArchitecture) DescribeImages(input *ec2.DescribeImagesInput) (*ec2.DescribeImagesOutput, error) {
+	architecture, ok := f.images[aws.StringValue(input.ImageIds[0])]
+	if !ok {
+		return &ec2.DescribeImagesOutput{}, nil
+	}
+	return &ec2.DescribeImagesOutput{Images: []*ec2.Image{{
+		Architecture:   aws.String(architecture),
+		RootDeviceName: aws.String("/dev/sda1"),
+	}}}, nil
+}
+
+// fakeEC2WithSnapshots describes an instance with an EBS root volume and
+// keeps the snapshots taken of it.
+type fakeEC2WithSnapshots struct {
+	*fakeEC2
+	snapshots []*ec2.Snapshot
+	restored  *ec2.CreateReplaceRootVolumeTaskInput
+}
+
+func (f *fakeEC2WithSnapshots) DescribeInstances(input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+	return &ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{Instances: []*ec2.Instance{{
+		InstanceId:     input.InstanceIds[0],
+		RootDeviceName: aws.String("/dev/sda1"),
+		BlockDeviceMappings: []*ec2.InstanceBlockDeviceMapping{{
+			DeviceName: aws.String("/dev/sda1"),
+			Ebs:        &ec2.EbsInstanceBlockDevice{VolumeId: aws.String("vol-root")},
+		}},
+	}}}}}, nil
+}
+
+func (f *fakeEC2WithSnapshots) CreateSnapshot(input *ec2.CreateSnapshotInput) (*ec2.Snapshot, error) {
+	snapshot := &ec2.Snapshot{
+		SnapshotId: aws.String(fmt.Sprintf("snap-%d", len(f.snapshots)+1)),
+		VolumeId:   input.VolumeId,
+		StartTime:  aws.Time(time.Date(2024, 5, 2, 10, len(f.snapshots), 0, 0, time.UTC)),
+		Tags:       input.TagSpecifications[0].Tags,
+	}
+	f.snapshots = append([]*ec2.Snapshot{snapshot}, f.snapshots...)
+	return snapshot, nil
+}
+
+func (f *fakeEC2WithSnapshots) DescribeSnapshots(input *ec2.DescribeSnapshotsInput) (*ec2.DescribeSnapshotsOutput, error) {
+	return &ec2.DescribeSnapshotsOutput{Snapshots: f.snapshots}, nil
+}
+
+func (f *fakeEC2WithSnapshots) CreateReplaceRootVolumeTask(input *ec2.CreateReplaceRootVolumeTaskInput) (*ec2.CreateReplaceRootVolumeTaskOutput, error) {
+	f.restored = input
+	return &ec2.CreateReplaceRootVolumeTaskOutput{}, nil
+}
+
+// fakeEC2WithResize stops and starts an instance at once and records the
+// instance type it is changed to and the state it is changed in.
+type fakeEC2WithResize struct {
+	*fakeEC2
+	state        string
+	instanceType string
+	modifiedIn   string
+}
+
+func (f *fakeEC2WithResize) DescribeInstances(input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+	return &ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{Instances: []*ec2.Instance{{
+		InstanceId:   input.InstanceIds[0],
+		InstanceType: aws.String(f.instanceType),
+		State:        &ec2.InstanceState{Name: aws.String(f.state)},
+	}}}}}, nil
+}
+
+func (f *fakeEC2WithResize) StopInstances(input *ec2.StopInstancesInput) (*ec2.StopInstancesOutput, error) {
+	f.state = ec2.InstanceStateNameStopped
+	return &ec2.StopInstancesOutput{}, nil
+}
+
+func (f *fakeEC2WithResize) StartInstances(input *ec2.StartInstancesInput) (*ec2.StartInstancesOutput, error) {
+	f.state = ec2.InstanceStateNameRunning
+	return &ec2.StartInstancesOutput{}, nil
+}
+
+func (f *fakeEC2WithResize) ModifyInstanceAttribute(input *ec2.ModifyInstanceAttributeInput) (*ec2.ModifyInstanceAttributeOutput, error) {
+	f.instanceType = aws.StringValue(input.InstanceType.Value)
+	f.modifiedIn = f.state
+	return &ec2.ModifyInstanceAttributeOutput{}, nil
+}
+
+// fakeSSM names the Ubuntu AMIs by parameter.
+type fakeSSM struct {
+	parameters map[string]string
+}
+
+func (f *fakeSSM) GetParameter(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+	value, ok := f.parameters[aws.StringValue(input.Name)]
+	if !ok {
+		return nil, errors.New("parameter not found")
+	}
+	return &ssm.GetParameterOutput{Parameter: &ssm.Parameter{Value: aws.String(value)}}, nil
+}
+
+// fakePricing prices every instance type, recording the filters of the last
+// lookup.
+type fakePricing struct {
+	price   string
+	filters map[string]string
+}
+
+func (f *fakePricing) GetProducts(input *pricing.GetProductsInput) (*pricing.GetProductsOutput, error) {
+	f.filters = map[string]string{}
+	for _, filter := range input.Filters {
+		f.filters[aws.StringValue(filter.Field)] = aws.StringValue(filter.Value)
+	}
+	if f.price == "" {
+		return &pricing.GetProductsOutput{}, nil
+	}
+
+	product := aws.JSONValue{"terms": map[string]interface{}{
+		"OnDemand": map[string]interface{}{
+			"SKU.TERM": map[string]interface{}{
+				"priceDimensions": map[string]interface{}{
+					"SKU.TERM.DIM": map[string]interface{}{
+						"unit":         "Hrs",
+						"pricePerUnit": map[string]interface{}{"USD": f.price},
+					},
+				},
+			},
+		},
+	}}
+	return &pricing.GetProductsOutput{PriceList: []aws.JSONValue{product}}, nil
+}
@@ -13,11 +13,13 @@ import (
 
 	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-06-01/storage"
 	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/rancher/machine/drivers/azure/azureutil"
 	"github.com/rancher/machine/libmachine/drivers"
 	rpcdriver "github.com/rancher/machine/libmachine/drivers/rpc"
 	"github.com/rancher/machine/libmachine/log"
 	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/rancher/machine/libmachine/ssh"
 	"github.com/rancher/machine/libmachine/state"
 )
 
@@ -29,11 +31,14 @@ const (
 	defaultSSHUser              = "docker-user" // 'root' not allowed on Azure
 	defaultDockerPort           = 2376
 	defaultAzureImage           = "canonical:UbuntuServer:18.04-LTS:latest"
+	defaultAzureARM64Image      = "canonical:0001-com-ubuntu-server-jammy:22_04-lts-arm64:latest"
 	defaultAzureVNet            = "docker-machine-vnet"
 	defaultAzureSubnet          = "docker-machine"
 	defaultAzureSubnetPrefix    = "192.168.0.0/16"
 	defaultStorageType          = string(storage.StandardLRS)
 	defaultAzureAvailabilitySet = "docker-machine"
+	defaultAzurePriority        = "Regular"
+	defaultEphemeralPlacement   = "CacheDisk"
 )
 
 const (
@@ -70,6 +75,12 @@ const (
 	flAzureAcceleratedNetworking     = "azure-accelerated-networking"
 	flAzureEnablePublicIPStandardSKU = "azure-enable-public-ip-standard-sku"
 	flAzureAvailabilityZones         = "azure-availability-zone"
+	flAzurePriority                  = "azure-priority"
+	flAzureEvictionPolicy            = "azure-eviction-policy"
+	flAzureMaxPrice                  = "azure-max-price"
+	flAzureEphemeralOSDisk           = "azure-ephemeral-os-disk"
+	flAzureEphemeralOSDiskPlacement  = "azure-ephemeral-os-disk-placement"
+	flAzureNvidiaGPUDriver           = "azure-nvidia-gpu-driver"
 )
 
 const (
@@ -108,6 +119,12 @@ type Driver struct {
 	AcceleratedNetworking     bool
 	AvailabilityZone          string
 	EnablePublicIPStandardSKU bool
+	Priority                  string
+	EvictionPolicy            string
+	MaxPrice                  float64
+	EphemeralOSDisk           bool
+	EphemeralOSDiskPlacement  string
+	NvidiaGPUDriver           bool
 
 	OpenPorts      []string
 	PrivateIPAddr  string
@@ -122,6 +139,7 @@ type Driver struct {
 	resolvedIP    string // cache
 	nsgResource   azure.Resource
 	nsgUsedInPool bool
+	dryRun        bool
 }
 
 // NewDriver returns a new driver instance.
@@ -136,10 +154,31 @@ func NewDriver(hostName, storePath string) drivers.Driver {
 			MachineName: hostName,
 			StorePath:   storePath,
 		},
+		Priority: defaultAzurePriority,
+		MaxPrice: -1,
 	}
 	return d
 }
 
+// Capabilities returns the optional operations supported by the driver.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityStartStop,
+		drivers.CapabilityRestart,
+		drivers.CapabilityKill,
+		drivers.CapabilityPrivateIP,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+		drivers.CapabilityResize,
+	}
+}
+
+// SupportedArchitectures returns the architectures of the machines the driver
+// creates, picked from the VM size.
+func (d *Driver) SupportedArchitectures() []string {
+	return []string{"amd64", "arm64"}
+}
+
 // GetCreateFlags returns list of create flags driver accepts.
 func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 	return []mcnflag.Flag{
@@ -294,9 +333,10 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			EnvVar: "AZURE_CLIENT_ID",
 		},
 		mcnflag.StringFlag{
-			Name:   flAzureClientSecret,
-			Usage:  "Azure Service Principal Account password (optional, browser auth is used if not specified)",
-			EnvVar: "AZURE_CLIENT_SECRET",
+			Name:      flAzureClientSecret,
+			Usage:     "Azure Service Principal Account password (optional, browser auth is used if not specified)",
+			EnvVar:    "AZURE_CLIENT_SECRET",
+			Sensitive: true,
 		},
 		mcnflag.StringFlag{
 			Name:   flAzureTags,
@@ -318,6 +358,38 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "Specify if an Accelerated Networking NIC should be created for your VM",
 			EnvVar: "AZURE_ACCELERATED_NETWORKING",
 		},
+		mcnflag.StringFlag{
+			Name:   flAzurePriority,
+			Usage:  "Priority of the Azure VM: Regular or Spot",
+			EnvVar: "AZURE_PRIORITY",
+			Value:  defaultAzurePriority,
+		},
+		mcnflag.StringFlag{
+			Name:   flAzureEvictionPolicy,
+			Usage:  "What Azure does to the Spot VM when evicting it: Deallocate or Delete (default Deallocate, Delete with an ephemeral OS disk)",
+			EnvVar: "AZURE_EVICTION_POLICY",
+		},
+		mcnflag.StringFlag{
+			Name:   flAzureMaxPrice,
+			Usage:  "Maximum hourly price in US dollars to pay for the Spot VM, -1 to pay up to the on-demand price (default -1)",
+			EnvVar: "AZURE_MAX_PRICE",
+		},
+		mcnflag.BoolFlag{
+			Name:   flAzureEphemeralOSDisk,
+			Usage:  "Place the OS disk on the local storage of the host instead of a managed disk (requires --azure-managed-disks)",
+			EnvVar: "AZURE_EPHEMERAL_OS_DISK",
+		},
+		mcnflag.StringFlag{
+			Name:   flAzureEphemeralOSDiskPlacement,
+			Usage:  "Local storage the ephemeral OS disk is placed on: CacheDisk or ResourceDisk",
+			EnvVar: "AZURE_EPHEMERAL_OS_DISK_PLACEMENT",
+			Value:  defaultEphemeralPlacement,
+		},
+		mcnflag.BoolFlag{
+			Name:   flAzureNvidiaGPUDriver,
+			Usage:  "Install the NVIDIA GPU driver extension on the VM (requires an N series size with NVIDIA GPUs)",
+			EnvVar: "AZURE_NVIDIA_GPU_DRIVER",
+		},
 	}
 }
 
@@ -340,7 +412,10 @@ func (d *Driver) UnmarshalJSON(data []byte) error {
 	*d = Driver(target)
 
 	// Make sure to reload values that are subject to change from envvars and os.Args.
-	driverOpts := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	driverOpts, err := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	if err != nil {
+		return err
+	}
 	if _, ok := driverOpts.Values[flAzureEnvironment]; ok {
 		d.Environment = driverOpts.String(flAzureEnvironment)
 	}
@@ -390,6 +465,11 @@ func (d *Driver) SetConfigFromFlags(fl drivers.DriverOptions) error {
 		}
 	}
 
+	// The default image has no Arm64 build, Arm64 sizes get an Arm64 image.
+	if d.Image == defaultAzureImage && isARM64Size(d.Size) {
+		d.Image = defaultAzureARM64Image
+	}
+
 	// Optional flags or Flags of other types
 	d.AvailabilityZone = fl.String(flAzureAvailabilityZones)
 	d.EnablePublicIPStandardSKU = fl.Bool(flAzureEnablePublicIPStandardSKU)
@@ -410,6 +490,23 @@ func (d *Driver) SetConfigFromFlags(fl drivers.DriverOptions) error {
 	d.DiskSize = fl.Int(flAzureDiskSize)
 	d.NSG = fl.String(flAzureNSG)
 	d.Plan = fl.String(flAzurePlan)
+	if priority := fl.String(flAzurePriority); priority != "" {
+		d.Priority = priority
+	}
+	d.EvictionPolicy = fl.String(flAzureEvictionPolicy)
+	if maxPrice := fl.String(flAzureMaxPrice); maxPrice != "" {
+		v, err := strconv.ParseFloat(maxPrice, 64)
+		if err != nil {
+			return fmt.Errorf("invalid value for --%s: %q is not a price", flAzureMaxPrice, maxPrice)
+		}
+		d.MaxPrice = v
+	}
+	d.EphemeralOSDisk = fl.Bool(flAzureEphemeralOSDisk)
+	d.EphemeralOSDiskPlacement = fl.String(flAzureEphemeralOSDiskPlacement)
+	if d.EphemeralOSDisk && d.EphemeralOSDiskPlacement == "" {
+		d.EphemeralOSDiskPlacement = defaultEphemeralPlacement
+	}
+	d.NvidiaGPUDriver = fl.Bool(flAzureNvidiaGPUDriver)
 
 	d.ClientID = fl.String(flAzureClientID)
 	d.ClientSecret = fl.String(flAzureClientSecret)
@@ -418,6 +515,25 @@ func (d *Driver) SetConfigFromFlags(fl drivers.DriverOptions) error {
 	// Set flags on the BaseDriver
 	d.BaseDriver.SSHPort = sshPort
 	d.SetSwarmConfigFromFlags(fl)
+	// Azure accepts RSA and Ed25519 keys only.
+	if err := d.SetSSHKeyTypeFromFlags(fl, ssh.KeyTypeRSA, ssh.KeyTypeEd25519); err != nil {
+		return err
+	}
+	if err := d.SetTagsFromFlags(fl); err != nil {
+		return err
+	}
+	if err := d.SetUserDataFromFlags(fl); err != nil {
+		return err
+	}
+	if err := d.SetSSHJumpHostsFromFlags(fl); err != nil {
+		return err
+	}
+	if err := d.SetSSHRetryPolicyFromFlags(fl); err != nil {
+		return err
+	}
+	for key, value := range d.MachineTags {
+		d.Tags[key] = to.StringPtr(value)
+	}
 
 	log.Debug("Set configuration from flags.")
 	return nil
@@ -426,6 +542,12 @@ func (d *Driver) SetConfigFromFlags(fl drivers.DriverOptions) error {
 // DriverName returns the name of the driver.
 func (d *Driver) DriverName() string { return driverName }
 
+// SetDryRun makes PreCreateCheck skip registering resource providers with the
+// subscription.
+func (d *Driver) SetDryRun(dryRun bool) {
+	d.dryRun = dryRun
+}
+
 // PreCreateCheck validates if driver values are valid to create the machine.
 func (d *Driver) PreCreateCheck() (err error) {
 	if d.CustomDataFile != "" {
@@ -434,6 +556,14 @@ func (d *Driver) PreCreateCheck() (err error) {
 		}
 	}
 
+	if err := d.checkPriority(); err != nil {
+		return err
+	}
+
+	if d.NvidiaGPUDriver && !isNvidiaGPUSize(d.Size) {
+		return fmt.Errorf("--%s requires a VM size with NVIDIA GPUs, %s has none", flAzureNvidiaGPUDriver, d.Size)
+	}
+
 	if d.AvailabilityZone != "" {
 		if !d.ManagedDisks {
 			return fmt.Errorf("Managed Disks must be used when creating resources in specific Availability Zones (--azure-managed-disks)")
@@ -456,12 +586,14 @@ func (d *Driver) PreCreateCheck() (err error) {
 	}
 
 	// Register used resource providers with current Azure subscription.
-	if err := c.RegisterResourceProviders(ctx,
-		"Microsoft.Compute",
-		"Microsoft.Network",
-		"Microsoft.Storage",
-		"Microsoft.Resources"); err != nil {
-		return err
+	if !d.dryRun {
+		if err := c.RegisterResourceProviders(ctx,
+			"Microsoft.Compute",
+			"Microsoft.Network",
+			"Microsoft.Storage",
+			"Microsoft.Resources"); err != nil {
+			return err
+		}
 	}
 
 	// Validate if firewall rules can be read correctly
@@ -543,7 +675,7 @@ func (d *Driver) Create() error {
 		}
 	}
 	if err := c.CreateNetworkInterface(ctx, d.deploymentCtx, d.ResourceGroup, d.naming().NIC(), d.Location,
-		d.deploymentCtx.PublicIPAddressID, d.deploymentCtx.SubnetID, d.deploymentCtx.NetworkSecurityGroupID, d.PrivateIPAddr, d.AcceleratedNetworking); err != nil {
+		d.deploymentCtx.PublicIPAddressID, d.deploymentCtx.SubnetID, d.deploymentCtx.NetworkSecurityGroupID, d.PrivateIPAddr, d.AcceleratedNetworking, d.Tags); err != nil {
 		return err
 	}
 	if !d.ManagedDisks {
@@ -555,10 +687,26 @@ func (d *Driver) Create() error {
 	if err := d.generateSSHKey(d.deploymentCtx); err != nil {
 		return err
 	}
-	if err := c.CreateVirtualMachine(ctx, d.ResourceGroup, d.naming().VM(), d.Location, d.Size, d.deploymentCtx.AvailabilitySetID,
-		d.deploymentCtx.NetworkInterfaceID, d.BaseDriver.SSHUser, d.deploymentCtx.SSHPublicKey, d.Image, d.Plan, customData, d.deploymentCtx.StorageAccount,
-		d.ManagedDisks, d.StorageType, int32(d.DiskSize), d.Tags, d.AvailabilityZone); err != nil {
-		return err
+	if customData == "" {
+		machineUserData, err := d.MachineUserData()
+		if err != nil {
+			return err
+		}
+		if machineUserData != "" {
+			customData = base64.StdEncoding.EncodeToString([]byte(machineUserData))
+		}
+	}
+	if err := drivers.Retry(retryOptions, "Creating virtual machine", func() error {
+		return c.CreateVirtualMachine(ctx, d.ResourceGroup, d.naming().VM(), d.Location, d.Size, d.deploymentCtx.AvailabilitySetID,
+			d.deploymentCtx.NetworkInterfaceID, d.BaseDriver.SSHUser, d.deploymentCtx.SSHPublicKey, d.Image, d.Plan, customData, d.deploymentCtx.StorageAccount,
+			d.ManagedDisks, d.StorageType, int32(d.DiskSize), d.Tags, d.AvailabilityZone, d.spotOptions(), d.ephemeralPlacement())
+	}); err != nil {
+		return classifyError(err)
+	}
+	if d.NvidiaGPUDriver {
+		if err := c.InstallNvidiaGPUDriver(ctx, d.ResourceGroup, d.naming().VM(), d.Location); err != nil {
+			return classifyError(err)
+		}
 	}
 	ip, err := d.GetIP()
 	if err != nil {
@@ -617,6 +765,16 @@ func (d *Driver) Remove() error {
 	return err
 }
 
+// GetTags returns the tags of the VM and of its network interface, those of
+// --azure-tags and the machine tags.
+func (d *Driver) GetTags() (map[string]string, error) {
+	tags := map[string]string{}
+	for key, value := range d.Tags {
+		tags[key] = to.String(value)
+	}
+	return tags, nil
+}
+
 // GetIP returns public IP address or hostname of the machine instance.
 func (d *Driver) GetIP() (string, error) {
 	if err := d.checkLegacyDriver(true); err != nil {
@@ -635,6 +793,39 @@ func (d *Driver) GetIP() (string, error) {
 	return d.resolvedIP, nil
 }
 
+// GetIPs returns the public address (or FQDN when a DNS label is set) and the
+// private IPv4 and IPv6 addresses of the machine instance.
+func (d *Driver) GetIPs() ([]drivers.NetworkAddress, error) {
+	if err := d.checkLegacyDriver(true); err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	c, err := d.newAzureClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []drivers.NetworkAddress
+	if !d.NoPublicIP {
+		ip, err := c.GetPublicIPAddress(ctx, d.ResourceGroup, d.naming().IP(), d.DNSLabel != "")
+		if err != nil {
+			return nil, fmt.Errorf("Error querying Public IP: %v", err)
+		}
+		addrs = drivers.AppendAddress(addrs, drivers.AddressPublic, ip)
+	}
+
+	ips, err := c.GetPrivateIPAddresses(ctx, d.ResourceGroup, d.naming().NIC())
+	if err != nil {
+		return nil, fmt.Errorf("Error querying Private IP: %v", err)
+	}
+	for _, ip := range ips {
+		addrs = drivers.AppendAddress(addrs, drivers.AddressPrivate, ip)
+	}
+
+	return addrs, nil
+}
+
 // GetSSHHostname returns an IP address or hostname for the machine instance.
 func (d *Driver) GetSSHHostname() (string, error) {
 	return d.GetIP()
@@ -676,8 +867,17 @@ func (d *Driver) GetState() (state.State, error) {
 	powerState, err := c.GetVirtualMachinePowerState(ctx,
 		d.ResourceGroup, d.naming().VM())
 	if err != nil {
+		if d.isSpot() && azureutil.IsNotFound(err) {
+			// Azure deletes Spot VMs it evicts with the Delete policy.
+			return state.Error, fmt.Errorf("spot virtual machine %s of machine %s was evicted by Azure", d.naming().VM(), d.MachineName)
+		}
 		return state.None, err
 	}
+	if d.isSpot() && powerState == azureutil.Deallocated {
+		// Stop only powers the machine off: a deallocated Spot VM was
+		// evicted with the Deallocate policy.
+		log.Warnf("spot virtual machine %s of machine %s was evicted by Azure", d.naming().VM(), d.MachineName)
+	}
 
 	machineState := machineStateForVMPowerState(powerState)
 	log.Debugf("Determined Azure PowerState=%q, docker-machine state=%q",
@@ -746,6 +946,29 @@ func (d *Driver) Kill() error {
 	return c.StopVirtualMachine(ctx, d.ResourceGroup, d.naming().VM(), true)
 }
 
+// Resize changes the size of the virtual machine. Azure resizes running
+// virtual machines itself, restarting them.
+func (d *Driver) Resize(spec drivers.ResizeSpec) error {
+	if err := d.checkLegacyDriver(true); err != nil {
+		return err
+	}
+	if spec.InstanceType == "" {
+		return errors.New("azure resizes virtual machines by size, use --instance-type")
+	}
+
+	ctx := context.Background()
+	c, err := d.newAzureClient(ctx)
+	if err != nil {
+		return err
+	}
+	if err := c.ResizeVirtualMachine(ctx, d.ResourceGroup, d.naming().VM(), spec.InstanceType); err != nil {
+		return classifyError(err)
+	}
+
+	d.Size = spec.InstanceType
+	return nil
+}
+
 // checkLegacyDriver errors out if it encounters an Azure VM created with the
 // legacy (<=0.6.0) docker-machine Azure driver.
 func (d *Driver) checkLegacyDriver(short bool) error {
@@ -315,7 +315,7 @@ func (a AzureClient) CleanupSubnetIfExists(ctx context.Context, resourceGroup, v
 }
 
 // CreateNetworkInterface creates a network interface
-func (a AzureClient) CreateNetworkInterface(ctx context.Context, deploymentCtx *DeploymentContext, resourceGroup, name, location, publicIPAddressID, subnetID, nsgID, privateIPAddress string, enabledAcceleratedNetworking bool) error {
+func (a AzureClient) CreateNetworkInterface(ctx context.Context, deploymentCtx *DeploymentContext, resourceGroup, name, location, publicIPAddressID, subnetID, nsgID, privateIPAddress string, enabledAcceleratedNetworking bool, tags map[string]*string) error {
 	// NOTE(ahmetalpbalkan) This method is expected to fail if the user
 	// specified Azure location is different than location of the virtual
 	// network as Azure does not support cross-region virtual networks. In this
@@ -333,6 +333,7 @@ func (a AzureClient) CreateNetworkInterface(ctx context.Context, deploymentCtx *
 	}
 	networkInterfacesClient := a.networkInterfacesClient()
 	future, err := networkInterfacesClient.CreateOrUpdate(ctx, resourceGroup, name, network.Interface{
+		Tags:     tags,
 		Location: to.StringPtr(location),
 		InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
 			EnableAcceleratedNetworking: to.BoolPtr(enabledAcceleratedNetworking),
@@ -561,10 +562,20 @@ func (a AzureClient) removeOSDiskBlob(ctx context.Context, resourceGroup, vmName
 	return nil
 }
 
-// CreateVirtualMachine creates a VM according to the specifications and adds an SSH key to access the VM
+// VMSpotOptions configures a VM as an Azure Spot VM.
+type VMSpotOptions struct {
+	// EvictionPolicy is Deallocate or Delete.
+	EvictionPolicy string
+	// MaxPrice is the maximum hourly price in US dollars, -1 for the
+	// on-demand price.
+	MaxPrice float64
+}
+
+// CreateVirtualMachine creates a VM according to the specifications and adds an SSH key to access the VM. The VM is a
+// Spot VM if spot is not nil, and its OS disk is ephemeral if ephemeralPlacement is not empty.
 func (a AzureClient) CreateVirtualMachine(ctx context.Context, resourceGroup, name, location, size, availabilitySetID, networkInterfaceID,
 	username, sshPublicKey, imageName, imagePlan, customData string, storageAccount *storage.AccountProperties, isManaged bool,
-	storageType string, diskSize int32, tags map[string]*string, availabilityZone string) error {
+	storageType string, diskSize int32, tags map[string]*string, availabilityZone string, spot *VMSpotOptions, ephemeralPlacement string) error {
 	// TODO: "VM created from Image cannot have blob based disks. All disks have to be managed disks."
 	imgReference, err := a.getImageReference(ctx, imageName, location)
 	if err != nil {
@@ -586,6 +597,7 @@ func (a AzureClient) CreateVirtualMachine(ctx context.Context, resourceGroup, na
 		"username": username,
 		"osImage":  imageName,
 		"plan":     imagePurchasePlan,
+		"spot":     spot != nil,
 	})
 
 	sshKeyPath := fmt.Sprintf("/home/%s/.ssh/authorized_keys", username)
@@ -630,7 +642,7 @@ func (a AzureClient) CreateVirtualMachine(ctx context.Context, resourceGroup, na
 			OsProfile: osProfile,
 			StorageProfile: &compute.StorageProfile{
 				ImageReference: imgReference,
-				OsDisk:         getOSDisk(name, storageAccount, isManaged, storageType, diskSize),
+				OsDisk:         getOSDisk(name, storageAccount, isManaged, storageType, diskSize, ephemeralPlacement),
 			},
 		},
 		Plan: imagePurchasePlan,
@@ -648,6 +660,14 @@ func (a AzureClient) CreateVirtualMachine(ctx context.Context, resourceGroup, na
 		vm.Zones = to.StringSlicePtr([]string{availabilityZone})
 	}
 
+	if spot != nil {
+		vm.VirtualMachineProperties.Priority = compute.Spot
+		vm.VirtualMachineProperties.EvictionPolicy = compute.VirtualMachineEvictionPolicyTypes(spot.EvictionPolicy)
+		vm.VirtualMachineProperties.BillingProfile = &compute.BillingProfile{
+			MaxPrice: to.Float64Ptr(spot.MaxPrice),
+		}
+	}
+
 	future, err := virtualMachinesClient.CreateOrUpdate(ctx, resourceGroup, name, vm)
 	if err != nil {
 		return err
@@ -659,6 +679,30 @@ func (a AzureClient) CreateVirtualMachine(ctx context.Context, resourceGroup, na
 	return err
 }
 
+// InstallNvidiaGPUDriver installs the NVIDIA GPU driver extension on the
+// virtual machine and waits for the driver to be installed.
+func (a AzureClient) InstallNvidiaGPUDriver(ctx context.Context, resourceGroup, vmName, location string) error {
+	log.Info("Installing NVIDIA GPU driver extension.", logutil.Fields{"vm": vmName})
+	c := a.virtualMachineExtensionsClient()
+	future, err := c.CreateOrUpdate(ctx, resourceGroup, vmName, "NvidiaGpuDriverLinux", compute.VirtualMachineExtension{
+		Location: to.StringPtr(location),
+		VirtualMachineExtensionProperties: &compute.VirtualMachineExtensionProperties{
+			Publisher:               to.StringPtr("Microsoft.HpcCompute"),
+			Type:                    to.StringPtr("NvidiaGpuDriverLinux"),
+			TypeHandlerVersion:      to.StringPtr("1.6"),
+			AutoUpgradeMinorVersion: to.BoolPtr(true),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err = future.WaitForCompletionRef(ctx, c.Client); err != nil {
+		return err
+	}
+	_, err = future.Result(c)
+	return err
+}
+
 // getImageReference parses a publisher:offer:sku:version or parses the string as a custom image reference
 func (a AzureClient) getImageReference(ctx context.Context, image, location string) (*compute.ImageReference, error) {
 	if strings.Contains(strings.ToLower(image), "/images/") {
@@ -692,8 +736,8 @@ func (a AzureClient) getImagePurchasePlan(ctx context.Context, plan string) (*co
 }
 
 // GetOSDisk creates and returns pointer to a disk that is configured for either managed or unmanaged disks depending
-// on setting.
-func getOSDisk(name string, account *storage.AccountProperties, isManaged bool, storageType string, diskSize int32) *compute.OSDisk {
+// on setting. A managed disk is ephemeral, on the local storage of the host, if ephemeralPlacement is not empty.
+func getOSDisk(name string, account *storage.AccountProperties, isManaged bool, storageType string, diskSize int32, ephemeralPlacement string) *compute.OSDisk {
 	var osdisk *compute.OSDisk
 	if isManaged {
 		osdisk = &compute.OSDisk{
@@ -705,6 +749,14 @@ func getOSDisk(name string, account *storage.AccountProperties, isManaged bool,
 			},
 			DiskSizeGB: to.Int32Ptr(diskSize),
 		}
+		if ephemeralPlacement != "" {
+			// Ephemeral OS disks only support read-only caching.
+			osdisk.Caching = compute.CachingTypesReadOnly
+			osdisk.DiffDiskSettings = &compute.DiffDiskSettings{
+				Option:    compute.Local,
+				Placement: compute.DiffDiskPlacement(ephemeralPlacement),
+			}
+		}
 	} else {
 		osDiskBlobURL := osDiskStorageBlobURL(account, name)
 		log.Debugf("OS disk blob will be placed at: %s", osDiskBlobURL)
@@ -836,6 +888,31 @@ func (a AzureClient) GetPrivateIPAddress(ctx context.Context, resourceGroup, nam
 	return to.String((*nic.InterfacePropertiesFormat.IPConfigurations)[0].InterfaceIPConfigurationPropertiesFormat.PrivateIPAddress), nil
 }
 
+// GetPrivateIPAddresses returns the private IP address of every IP
+// configuration on the specified network interface, IPv4 and IPv6 alike.
+func (a AzureClient) GetPrivateIPAddresses(ctx context.Context, resourceGroup, name string) ([]string, error) {
+	f := logutil.Fields{"name": name}
+	log.Debug("Querying network interface.", f)
+	nic, err := a.networkInterfacesClient().Get(ctx, resourceGroup, name, "")
+	if err != nil {
+		return nil, err
+	}
+	if nic.InterfacePropertiesFormat == nil || nic.InterfacePropertiesFormat.IPConfigurations == nil {
+		log.Debug("No IPConfigurations found on NIC", f)
+		return nil, nil
+	}
+	var ips []string
+	for _, cfg := range *nic.InterfacePropertiesFormat.IPConfigurations {
+		if cfg.InterfaceIPConfigurationPropertiesFormat == nil {
+			continue
+		}
+		if ip := to.String(cfg.InterfaceIPConfigurationPropertiesFormat.PrivateIPAddress); ip != "" {
+			ips = append(ips, ip)
+		}
+	}
+	return ips, nil
+}
+
 // StartVirtualMachine starts the virtual machine and waits until it reaches
 // the goal state (running) or times out.
 func (a AzureClient) StartVirtualMachine(ctx context.Context, resourceGroup, name string) error {
@@ -890,6 +967,26 @@ func (a AzureClient) RestartVirtualMachine(ctx context.Context, resourceGroup, n
 	return a.waitVMPowerState(ctx, resourceGroup, name, Running, waitStartTimeout)
 }
 
+// ResizeVirtualMachine changes the size of the virtual machine, which Azure
+// restarts if it runs.
+func (a AzureClient) ResizeVirtualMachine(ctx context.Context, resourceGroup, name, size string) error {
+	log.Info("Resizing virtual machine.", logutil.Fields{"vm": name, "size": size})
+	virtualMachinesClient := a.virtualMachinesClient()
+	future, err := virtualMachinesClient.Update(ctx, resourceGroup, name, compute.VirtualMachineUpdate{
+		VirtualMachineProperties: &compute.VirtualMachineProperties{
+			HardwareProfile: &compute.HardwareProfile{VMSize: compute.VirtualMachineSizeTypes(size)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err = future.WaitForCompletionRef(ctx, virtualMachinesClient.Client); err != nil {
+		return err
+	}
+	_, err = future.Result(virtualMachinesClient)
+	return err
+}
+
 // waitVMPowerState polls the Virtual Machine instance view until it reaches the
 // specified goal power state or times out. If checking for virtual machine
 // state fails or waiting times out, an error is returned.
@@ -960,6 +1057,13 @@ func checkResourceExistsFromError(err error) (bool, error) {
 	return false, v
 }
 
+// IsNotFound returns whether the error is the Azure API answering that the
+// resource does not exist.
+func IsNotFound(err error) bool {
+	v, ok := err.(autorest.DetailedError)
+	return ok && v.StatusCode == http.StatusNotFound
+}
+
 // osDiskStorageBlobURL gives the full url of the VHD blob where the OS disk for
 // the given VM should be stored.
 func osDiskStorageBlobURL(account *storage.AccountProperties, vmName string) string {
@@ -0,0 +1,90 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rancher/machine/libmachine/drivers"
+)
+
+// retailPricesURL is the public API of the Azure retail prices, which needs
+// no authentication and only prices the public cloud.
+var retailPricesURL = "https://prices.azure.com/api/retail/prices"
+
+type retailPrices struct {
+	Items        []retailPrice `json:"Items"`
+	NextPageLink string        `json:"NextPageLink"`
+}
+
+type retailPrice struct {
+	CurrencyCode  string  `json:"currencyCode"`
+	RetailPrice   float64 `json:"retailPrice"`
+	UnitOfMeasure string  `json:"unitOfMeasure"`
+	ProductName   string  `json:"productName"`
+	SkuName       string  `json:"skuName"`
+}
+
+// EstimateCost returns the pay-as-you-go price of the VM size in the
+// location, running Linux, or its Spot price for Spot VMs.
+func (d *Driver) EstimateCost() (*drivers.CostEstimate, error) {
+	if d.Environment != defaultAzureEnvironment {
+		return nil, drivers.ErrCostNotSupported
+	}
+
+	location := strings.ToLower(strings.Replace(d.Location, " ", "", -1))
+	filter := fmt.Sprintf("serviceName eq 'Virtual Machines' and priceType eq 'Consumption' and armRegionName eq '%s' and armSkuName eq '%s'", location, d.Size)
+	next := retailPricesURL + "?$filter=" + url.QueryEscape(filter)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	for next != "" {
+		page, err := getRetailPrices(client, next)
+		if err != nil {
+			return nil, err
+		}
+		if price := selectRetailPrice(page.Items, d.Priority == "Spot"); price != nil {
+			return &drivers.CostEstimate{
+				Currency: price.CurrencyCode,
+				Hourly:   price.RetailPrice,
+				Monthly:  price.RetailPrice * drivers.HoursPerMonth,
+				Source:   fmt.Sprintf("Azure retail price of %s, excluding disks", price.SkuName),
+			}, nil
+		}
+		next = page.NextPageLink
+	}
+	return nil, drivers.Errorf(drivers.ErrorCodeNotFound, "no price of VM size %s in location %s", d.Size, d.Location)
+}
+
+func getRetailPrices(client *http.Client, pageURL string) (*retailPrices, error) {
+	resp, err := client.Get(pageURL)
+	if err != nil {
+		return nil, drivers.NewError(drivers.ErrorCodeTransientNetwork, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("retail prices API returned %s", resp.Status)
+	}
+	page := &retailPrices{}
+	if err := json.NewDecoder(resp.Body).Decode(page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// selectRetailPrice returns the hourly Linux price among the prices of a VM
+// size, the Spot one if spot is set, or nil if there is none.
+func selectRetailPrice(prices []retailPrice, spot bool) *retailPrice {
+	for i, price := range prices {
+		if price.UnitOfMeasure != "1 Hour" || strings.HasSuffix(price.ProductName, "Windows") || strings.Contains(price.SkuName, "Low Priority") {
+			continue
+		}
+		if strings.HasSuffix(price.SkuName, " Spot") == spot {
+			return &prices[i]
+		}
+	}
+	return nil
+}
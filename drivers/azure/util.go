@@ -2,8 +2,11 @@ package azure
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"regexp"
 	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-12-01/network"
@@ -13,8 +16,8 @@ import (
 	"github.com/rancher/machine/drivers/azure/azureutil"
 	"github.com/rancher/machine/drivers/azure/logutil"
 	"github.com/rancher/machine/drivers/driverutil"
+	"github.com/rancher/machine/libmachine/drivers"
 	"github.com/rancher/machine/libmachine/log"
-	"github.com/rancher/machine/libmachine/ssh"
 	"github.com/rancher/machine/libmachine/state"
 )
 
@@ -74,7 +77,7 @@ func (d *Driver) generateSSHKey(deploymentCtx *azureutil.DeploymentContext) erro
 		"priv": privPath,
 	})
 
-	if err := ssh.GenerateSSHKey(privPath); err != nil {
+	if err := d.GenerateSSHKey(privPath); err != nil {
 		return err
 	}
 	log.Debug("SSH key pair generated.")
@@ -190,6 +193,148 @@ func (d *Driver) resolveNSGReference(nsg string) (azure.Resource, error) {
 	}, nil
 }
 
+// retryOptions retry the creation of the VM when Azure Resource Manager
+// throttles the subscription, once autorest is done retrying the request.
+var retryOptions = drivers.DefaultRetryOptions.WithRetryable(isThrottled)
+
+func isThrottled(err error) bool {
+	var reqErr *azure.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.StatusCode == http.StatusTooManyRequests
+	}
+	var detailedErr autorest.DetailedError
+	if errors.As(err, &detailedErr) {
+		return detailedErr.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// classifyError gives err the code of the status of its Azure response.
+func classifyError(err error) error {
+	var statusCode int
+	var serviceCode string
+	var reqErr *azure.RequestError
+	var detailedErr autorest.DetailedError
+	switch {
+	case errors.As(err, &reqErr):
+		statusCode, _ = reqErr.StatusCode.(int)
+		if reqErr.ServiceError != nil {
+			serviceCode = reqErr.ServiceError.Code
+		}
+	case errors.As(err, &detailedErr):
+		statusCode, _ = detailedErr.StatusCode.(int)
+		if serviceErr, ok := detailedErr.Original.(*azure.ServiceError); ok {
+			serviceCode = serviceErr.Code
+		}
+	default:
+		return err
+	}
+
+	switch {
+	case strings.Contains(serviceCode, "QuotaExceeded"):
+		return drivers.NewError(drivers.ErrorCodeQuotaExceeded, err)
+	case statusCode == http.StatusUnauthorized, statusCode == http.StatusForbidden:
+		return drivers.NewError(drivers.ErrorCodeAuthFailure, err)
+	case statusCode == http.StatusNotFound:
+		return drivers.NewError(drivers.ErrorCodeNotFound, err)
+	case statusCode == http.StatusTooManyRequests:
+		return drivers.NewError(drivers.ErrorCodeTransientNetwork, err)
+	}
+	return err
+}
+
+// arm64SizePattern matches the VM sizes of the Arm64 series, which have a p
+// among the additive features following the vCPU count, as in Standard_D2ps_v5
+// or Standard_E4-2pds_v5.
+var arm64SizePattern = regexp.MustCompile(`^standard_[a-z]+\d+(-\d+)?[a-z]*p[a-z]*(_|$)`)
+
+func isARM64Size(size string) bool {
+	return arm64SizePattern.MatchString(strings.ToLower(size))
+}
+
+// nvidiaGPUSizePattern matches the VM sizes of the N series, whose NC, ND and
+// NV families have NVIDIA GPUs but for the NVv4 and MI300X sizes, which have
+// AMD GPUs.
+var nvidiaGPUSizePattern = regexp.MustCompile(`^standard_n[cdv]\d`)
+
+func isNvidiaGPUSize(size string) bool {
+	size = strings.ToLower(size)
+	if strings.HasSuffix(size, "as_v4") || strings.Contains(size, "mi300x") {
+		return false
+	}
+	return nvidiaGPUSizePattern.MatchString(size)
+}
+
+// checkPriority validates the Spot and ephemeral OS disk options.
+func (d *Driver) checkPriority() error {
+	switch d.Priority {
+	case "Regular", "Spot":
+	default:
+		return fmt.Errorf("--%s must be either Regular or Spot, not %q", flAzurePriority, d.Priority)
+	}
+	if !d.isSpot() {
+		if d.EvictionPolicy != "" {
+			return fmt.Errorf("--%s requires --%s=Spot", flAzureEvictionPolicy, flAzurePriority)
+		}
+		if d.MaxPrice != -1 {
+			return fmt.Errorf("--%s requires --%s=Spot", flAzureMaxPrice, flAzurePriority)
+		}
+	}
+	switch d.EvictionPolicy {
+	case "", "Deallocate", "Delete":
+	default:
+		return fmt.Errorf("--%s must be either Deallocate or Delete, not %q", flAzureEvictionPolicy, d.EvictionPolicy)
+	}
+	if d.MaxPrice != -1 && d.MaxPrice <= 0 {
+		return fmt.Errorf("--%s must be -1 or a price greater than 0", flAzureMaxPrice)
+	}
+
+	if !d.EphemeralOSDisk {
+		return nil
+	}
+	if !d.ManagedDisks {
+		return fmt.Errorf("Managed Disks must be used with an ephemeral OS disk (--%s)", flAzureManagedDisks)
+	}
+	switch d.EphemeralOSDiskPlacement {
+	case "CacheDisk", "ResourceDisk":
+	default:
+		return fmt.Errorf("--%s must be either CacheDisk or ResourceDisk, not %q", flAzureEphemeralOSDiskPlacement, d.EphemeralOSDiskPlacement)
+	}
+	// An ephemeral OS disk is lost when the VM is deallocated.
+	if d.EvictionPolicy == "Deallocate" {
+		return fmt.Errorf("Spot VMs with an ephemeral OS disk can only be evicted with --%s=Delete", flAzureEvictionPolicy)
+	}
+	return nil
+}
+
+func (d *Driver) isSpot() bool {
+	return d.Priority == "Spot"
+}
+
+// spotOptions returns the Spot options of the VM, nil for a Regular VM.
+func (d *Driver) spotOptions() *azureutil.VMSpotOptions {
+	if !d.isSpot() {
+		return nil
+	}
+	evictionPolicy := d.EvictionPolicy
+	if evictionPolicy == "" {
+		evictionPolicy = "Deallocate"
+		if d.EphemeralOSDisk {
+			evictionPolicy = "Delete"
+		}
+	}
+	return &azureutil.VMSpotOptions{EvictionPolicy: evictionPolicy, MaxPrice: d.MaxPrice}
+}
+
+// ephemeralPlacement returns where the ephemeral OS disk is placed, or ""
+// for a managed or unmanaged OS disk.
+func (d *Driver) ephemeralPlacement() string {
+	if !d.EphemeralOSDisk {
+		return ""
+	}
+	return d.EphemeralOSDiskPlacement
+}
+
 func machineStateForVMPowerState(ps azureutil.VMPowerState) state.State {
 	m := map[azureutil.VMPowerState]state.State{
 		azureutil.Running:      state.Running,
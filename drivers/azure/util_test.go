@@ -1,9 +1,16 @@
 package azure
 
 import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-12-01/network"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/rancher/machine/drivers/azure/azureutil"
+	"github.com/rancher/machine/libmachine/drivers"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -29,3 +36,129 @@ func TestParseSecurityRuleProtocol(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckPriority(t *testing.T) {
+	tests := []struct {
+		driver      Driver
+		expectedErr bool
+	}{
+		{Driver{Priority: "Regular", MaxPrice: -1}, false},
+		{Driver{Priority: "Spot", MaxPrice: -1}, false},
+		{Driver{Priority: "Spot", EvictionPolicy: "Delete", MaxPrice: 0.05}, false},
+		{Driver{Priority: "Low", MaxPrice: -1}, true},
+		{Driver{Priority: "Regular", EvictionPolicy: "Delete", MaxPrice: -1}, true},
+		{Driver{Priority: "Regular", MaxPrice: 0.05}, true},
+		{Driver{Priority: "Spot", EvictionPolicy: "Stop", MaxPrice: -1}, true},
+		{Driver{Priority: "Spot", MaxPrice: 0}, true},
+		{Driver{Priority: "Regular", MaxPrice: -1, EphemeralOSDisk: true, ManagedDisks: true, EphemeralOSDiskPlacement: "ResourceDisk"}, false},
+		{Driver{Priority: "Regular", MaxPrice: -1, EphemeralOSDisk: true, EphemeralOSDiskPlacement: "CacheDisk"}, true},
+		{Driver{Priority: "Regular", MaxPrice: -1, EphemeralOSDisk: true, ManagedDisks: true, EphemeralOSDiskPlacement: "Local"}, true},
+		{Driver{Priority: "Spot", MaxPrice: -1, EphemeralOSDisk: true, ManagedDisks: true, EphemeralOSDiskPlacement: "CacheDisk"}, false},
+		{Driver{Priority: "Spot", EvictionPolicy: "Deallocate", MaxPrice: -1, EphemeralOSDisk: true, ManagedDisks: true, EphemeralOSDiskPlacement: "CacheDisk"}, true},
+	}
+
+	for _, tc := range tests {
+		err := tc.driver.checkPriority()
+		if tc.expectedErr {
+			assert.Error(t, err)
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+}
+
+func TestSpotOptions(t *testing.T) {
+	d := Driver{Priority: "Regular"}
+	assert.Nil(t, d.spotOptions())
+
+	d = Driver{Priority: "Spot", MaxPrice: -1}
+	assert.Equal(t, &azureutil.VMSpotOptions{EvictionPolicy: "Deallocate", MaxPrice: -1}, d.spotOptions())
+
+	d = Driver{Priority: "Spot", MaxPrice: 0.05, EphemeralOSDisk: true}
+	assert.Equal(t, &azureutil.VMSpotOptions{EvictionPolicy: "Delete", MaxPrice: 0.05}, d.spotOptions())
+}
+
+func TestIsARM64Size(t *testing.T) {
+	for size, expected := range map[string]bool{
+		"Standard_D2ps_v5":    true,
+		"Standard_E4-2pds_v5": true,
+		"standard_b2pts_v2":   true,
+		"Standard_D2pls_v5":   true,
+		"Standard_D2_v2":      false,
+		"Standard_DS2_v2":     false,
+		"Standard_D2s_v3":     false,
+		"Standard_NP10s":      false,
+		"Standard_M32ms":      false,
+	} {
+		assert.Equal(t, expected, isARM64Size(size), size)
+	}
+}
+
+func TestIsNvidiaGPUSize(t *testing.T) {
+	for size, expected := range map[string]bool{
+		"Standard_NC6s_v3":           true,
+		"Standard_NC24ads_A100_v4":   true,
+		"Standard_ND96asr_v4":        true,
+		"Standard_NV12s_v3":          true,
+		"standard_nv36ads_a10_v5":    true,
+		"Standard_NV8as_v4":          false,
+		"Standard_ND96isr_MI300X_v5": false,
+		"Standard_NP10s":             false,
+		"Standard_D2_v2":             false,
+	} {
+		assert.Equal(t, expected, isNvidiaGPUSize(size), size)
+	}
+}
+
+func TestIsThrottled(t *testing.T) {
+	assert.True(t, isThrottled(autorest.DetailedError{StatusCode: 429}))
+	assert.True(t, isThrottled(&azure.RequestError{DetailedError: autorest.DetailedError{StatusCode: 429}}))
+	assert.False(t, isThrottled(autorest.DetailedError{StatusCode: 409}))
+	assert.False(t, isThrottled(errors.New("invalid image")))
+}
+
+func TestClassifyError(t *testing.T) {
+	quota := &azure.RequestError{DetailedError: autorest.DetailedError{StatusCode: 409}, ServiceError: &azure.ServiceError{Code: "OperationNotAllowed"}}
+	assert.Equal(t, drivers.ErrorCode(""), drivers.GetErrorCode(classifyError(quota)))
+	quota.ServiceError.Code = "QuotaExceeded"
+	assert.Equal(t, drivers.ErrorCodeQuotaExceeded, drivers.GetErrorCode(classifyError(quota)))
+	assert.Equal(t, drivers.ErrorCodeAuthFailure, drivers.GetErrorCode(classifyError(autorest.DetailedError{StatusCode: 401})))
+	assert.Equal(t, drivers.ErrorCodeNotFound, drivers.GetErrorCode(classifyError(autorest.DetailedError{StatusCode: 404})))
+	assert.True(t, drivers.IsRetryable(classifyError(autorest.DetailedError{StatusCode: 429})))
+	assert.Equal(t, drivers.ErrorCode(""), drivers.GetErrorCode(classifyError(errors.New("invalid image"))))
+}
+
+func TestSelectRetailPrice(t *testing.T) {
+	prices := []retailPrice{
+		{RetailPrice: 0.2, UnitOfMeasure: "1 Hour", ProductName: "Virtual Machines Dv3 Series Windows", SkuName: "D2 v3"},
+		{RetailPrice: 0.02, UnitOfMeasure: "1 Hour", ProductName: "Virtual Machines Dv3 Series", SkuName: "D2 v3 Low Priority"},
+		{RetailPrice: 0.01, UnitOfMeasure: "1 Hour", ProductName: "Virtual Machines Dv3 Series", SkuName: "D2 v3 Spot"},
+		{RetailPrice: 0.096, UnitOfMeasure: "1 Hour", ProductName: "Virtual Machines Dv3 Series", SkuName: "D2 v3"},
+	}
+
+	assert.Equal(t, 0.096, selectRetailPrice(prices, false).RetailPrice)
+	assert.Equal(t, 0.01, selectRetailPrice(prices, true).RetailPrice)
+	assert.Nil(t, selectRetailPrice(prices[:1], false))
+}
+
+func TestEstimateCost(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Contains(t, r.URL.Query().Get("$filter"), "armRegionName eq 'westeurope' and armSkuName eq 'Standard_D2_v3'")
+		w.Write([]byte(`{"Items":[{"currencyCode":"USD","retailPrice":0.096,"unitOfMeasure":"1 Hour","productName":"Virtual Machines Dv3 Series","skuName":"D2 v3"}]}`))
+	}))
+	defer server.Close()
+	defer func(u string) { retailPricesURL = u }(retailPricesURL)
+	retailPricesURL = server.URL
+
+	d := &Driver{Environment: defaultAzureEnvironment, Location: "West Europe", Size: "Standard_D2_v3", Priority: defaultAzurePriority}
+	estimate, err := d.EstimateCost()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "USD", estimate.Currency)
+	assert.Equal(t, 0.096, estimate.Hourly)
+	assert.InDelta(t, 70.08, estimate.Monthly, 0.0001)
+
+	d.Environment = "AzureChinaCloud"
+	_, err = d.EstimateCost()
+	assert.Equal(t, drivers.ErrCostNotSupported, err)
+}
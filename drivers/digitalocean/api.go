@@ -0,0 +1,150 @@
+package digitalocean
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/digitalocean/godo"
+	"github.com/rancher/machine/libmachine/drivers"
+)
+
+// dropletCreateRequest adds the droplet options the godo version in use
+// predates to its create request.
+type dropletCreateRequest struct {
+	godo.DropletCreateRequest
+	VPCUUID          string `json:"vpc_uuid,omitempty"`
+	WithDropletAgent *bool  `json:"with_droplet_agent,omitempty"`
+}
+
+type dropletRoot struct {
+	Droplet *godo.Droplet `json:"droplet"`
+}
+
+type firewallRoot struct {
+	Firewall *firewall `json:"firewall"`
+}
+
+type firewall struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	DropletIDs []int  `json:"droplet_ids"`
+}
+
+type firewallDropletsRequest struct {
+	DropletIDs []int `json:"droplet_ids"`
+}
+
+// dropletsPageRoot is a page of droplets, of which the godo version in use
+// does not read the total.
+type dropletsPageRoot struct {
+	Meta struct {
+		Total int `json:"total"`
+	} `json:"meta"`
+}
+
+// retryOptions retry the API calls rate limited while many machines are
+// created at once.
+var retryOptions = drivers.DefaultRetryOptions.WithRetryable(isRateLimited)
+
+func isRateLimited(err error) bool {
+	errResp, ok := err.(*godo.ErrorResponse)
+	return ok && errResp.Response != nil && errResp.Response.StatusCode == http.StatusTooManyRequests
+}
+
+// classifyError gives err the code of the status of its API response.
+func classifyError(err error) error {
+	errResp, ok := err.(*godo.ErrorResponse)
+	if !ok || errResp.Response == nil {
+		return err
+	}
+	switch errResp.Response.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return drivers.NewError(drivers.ErrorCodeAuthFailure, err)
+	case http.StatusNotFound:
+		return drivers.NewError(drivers.ErrorCodeNotFound, err)
+	case http.StatusTooManyRequests:
+		return drivers.NewError(drivers.ErrorCodeTransientNetwork, err)
+	}
+	return err
+}
+
+func createDroplet(client *godo.Client, createRequest *dropletCreateRequest) (*godo.Droplet, error) {
+	req, err := client.NewRequest(context.TODO(), http.MethodPost, "v2/droplets", createRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	root := new(dropletRoot)
+	if _, err := client.Do(req, root); err != nil {
+		return nil, err
+	}
+	return root.Droplet, nil
+}
+
+// countDroplets returns the number of droplets of the account, which
+// count against its droplet limit.
+func countDroplets(client *godo.Client) (int, error) {
+	req, err := client.NewRequest(context.TODO(), http.MethodGet, "v2/droplets?per_page=1", nil)
+	if err != nil {
+		return 0, err
+	}
+
+	root := new(dropletsPageRoot)
+	if _, err := client.Do(req, root); err != nil {
+		return 0, err
+	}
+	return root.Meta.Total, nil
+}
+
+func getFirewall(client *godo.Client, id string) (*firewall, *godo.Response, error) {
+	req, err := client.NewRequest(context.TODO(), http.MethodGet, "v2/firewalls/"+id, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	root := new(firewallRoot)
+	resp, err := client.Do(req, root)
+	if err != nil {
+		return nil, resp, err
+	}
+	return root.Firewall, resp, nil
+}
+
+func addDropletToFirewall(client *godo.Client, id string, dropletID int) error {
+	req, err := client.NewRequest(context.TODO(), http.MethodPost, "v2/firewalls/"+id+"/droplets", &firewallDropletsRequest{
+		DropletIDs: []int{dropletID},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Do(req, nil)
+	return err
+}
+
+// assignReservedIP assigns the reserved IP, which the API still serves as a
+// floating IP, to the droplet and waits for the assignment to complete.
+func assignReservedIP(client *godo.Client, ip string, dropletID int) error {
+	action, _, err := client.FloatingIPActions.Assign(context.TODO(), ip, dropletID)
+	if err != nil {
+		return err
+	}
+
+	for {
+		switch action.Status {
+		case godo.ActionCompleted:
+			return nil
+		case "errored":
+			return fmt.Errorf("failed to assign reserved IP %s to droplet %d", ip, dropletID)
+		}
+
+		time.Sleep(2 * time.Second)
+
+		action, _, err = client.Actions.Get(context.TODO(), action.ID)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package digitalocean
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/digitalocean/godo"
+	"github.com/rancher/machine/libmachine/drivers"
+)
+
+// EstimateCost returns the price of the droplet size, which the sizes API
+// reports.
+func (d *Driver) EstimateCost() (*drivers.CostEstimate, error) {
+	client := d.getClient()
+
+	opt := &godo.ListOptions{PerPage: 200}
+	for {
+		sizes, resp, err := client.Sizes.List(context.TODO(), opt)
+		if err != nil {
+			return nil, classifyError(err)
+		}
+		if estimate := sizeCost(sizes, d.Size); estimate != nil {
+			return estimate, nil
+		}
+		if resp.Links == nil || resp.Links.IsLastPage() {
+			break
+		}
+		page, err := resp.Links.CurrentPage()
+		if err != nil {
+			return nil, err
+		}
+		opt.Page = page + 1
+	}
+	return nil, drivers.Errorf(drivers.ErrorCodeNotFound, "droplet size %s not found", d.Size)
+}
+
+// sizeCost returns the price of the size of the slug, or nil if sizes do not
+// include it.
+func sizeCost(sizes []godo.Size, slug string) *drivers.CostEstimate {
+	for _, size := range sizes {
+		if size.Slug == slug {
+			return &drivers.CostEstimate{
+				Currency: "USD",
+				Hourly:   size.PriceHourly,
+				Monthly:  size.PriceMonthly,
+				Source:   fmt.Sprintf("DigitalOcean price of %s, the droplet and its disk", slug),
+			}
+		}
+	}
+	return nil
+}
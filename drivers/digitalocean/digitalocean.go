@@ -17,7 +17,6 @@ import (
 	"github.com/rancher/machine/libmachine/log"
 	"github.com/rancher/machine/libmachine/mcnflag"
 	"github.com/rancher/machine/libmachine/mcnutils"
-	"github.com/rancher/machine/libmachine/ssh"
 	"github.com/rancher/machine/libmachine/state"
 	"golang.org/x/oauth2"
 )
@@ -40,6 +39,10 @@ type Driver struct {
 	Monitoring        bool
 	Tags              string
 	PrivateIPAddress  string
+	VPCUUID           string
+	ReservedIP        string
+	Firewalls         []string
+	DropletAgent      bool
 }
 
 const (
@@ -50,14 +53,29 @@ const (
 	defaultSize    = "s-1vcpu-1gb"
 )
 
+// Capabilities returns the optional operations supported by the driver.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityStartStop,
+		drivers.CapabilityRestart,
+		drivers.CapabilityKill,
+		drivers.CapabilityPrivateIP,
+		drivers.CapabilityCustomSSHPort,
+		drivers.CapabilityIPv6,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+	}
+}
+
 // GetCreateFlags registers the flags this driver adds to
 // "docker hosts create"
 func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 	return []mcnflag.Flag{
 		mcnflag.StringFlag{
-			EnvVar: "DIGITALOCEAN_ACCESS_TOKEN",
-			Name:   "digitalocean-access-token",
-			Usage:  "Digital Ocean access token",
+			EnvVar:    "DIGITALOCEAN_ACCESS_TOKEN",
+			Name:      "digitalocean-access-token",
+			Usage:     "Digital Ocean access token",
+			Sensitive: true,
 		},
 		mcnflag.StringFlag{
 			EnvVar: "DIGITALOCEAN_SSH_USER",
@@ -129,6 +147,26 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Name:   "digitalocean-tags",
 			Usage:  "comma-separated list of tags to apply to the Droplet",
 		},
+		mcnflag.StringFlag{
+			EnvVar: "DIGITALOCEAN_VPC_UUID",
+			Name:   "digitalocean-vpc-uuid",
+			Usage:  "UUID of the VPC to create the droplet in, instead of the default VPC of the region",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "DIGITALOCEAN_RESERVED_IP",
+			Name:   "digitalocean-reserved-ip",
+			Usage:  "unassigned reserved IP of the region to assign to the droplet and reach it with",
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "DIGITALOCEAN_FIREWALL",
+			Name:   "digitalocean-firewall",
+			Usage:  "ID of an existing cloud firewall to add the droplet to. Can be repeated.",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "DIGITALOCEAN_DISABLE_DROPLET_AGENT",
+			Name:   "digitalocean-disable-droplet-agent",
+			Usage:  "do not install the droplet agent, which enables the web console",
+		},
 	}
 }
 
@@ -137,6 +175,8 @@ func NewDriver(hostName, storePath string) *Driver {
 		Image:  defaultImage,
 		Size:   defaultSize,
 		Region: defaultRegion,
+		// the API installs the agent when the option is omitted
+		DropletAgent: true,
 		BaseDriver: &drivers.BaseDriver{
 			MachineName: hostName,
 			StorePath:   storePath,
@@ -172,7 +212,10 @@ func (d *Driver) UnmarshalJSON(data []byte) error {
 	*d = Driver(target)
 
 	// Make sure to reload values that are subject to change from envvars and os.Args.
-	driverOpts := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	driverOpts, err := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	if err != nil {
+		return err
+	}
 	if _, ok := driverOpts.Values["digitalocean-access-token"]; ok {
 		d.AccessToken = driverOpts.String("digitalocean-access-token")
 	}
@@ -186,6 +229,7 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.Region = flags.String("digitalocean-region")
 	d.Size = flags.String("digitalocean-size")
 	d.IPv6 = flags.Bool("digitalocean-ipv6")
+	d.SetIPv6PreferenceFromFlags(flags)
 	d.PrivateNetworking = flags.Bool("digitalocean-private-networking")
 	d.Backups = flags.Bool("digitalocean-backups")
 	d.UserDataFile = flags.String("digitalocean-userdata")
@@ -195,8 +239,27 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.SSHKey = flags.String("digitalocean-ssh-key-path")
 	d.Monitoring = flags.Bool("digitalocean-monitoring")
 	d.Tags = flags.String("digitalocean-tags")
+	d.VPCUUID = flags.String("digitalocean-vpc-uuid")
+	d.ReservedIP = flags.String("digitalocean-reserved-ip")
+	d.Firewalls = flags.StringSlice("digitalocean-firewall")
+	d.DropletAgent = !flags.Bool("digitalocean-disable-droplet-agent")
 
 	d.SetSwarmConfigFromFlags(flags)
+	if err := d.SetSSHKeyTypeFromFlags(flags); err != nil {
+		return err
+	}
+	if err := d.SetTagsFromFlags(flags); err != nil {
+		return err
+	}
+	if err := d.SetUserDataFromFlags(flags); err != nil {
+		return err
+	}
+	if err := d.SetSSHJumpHostsFromFlags(flags); err != nil {
+		return err
+	}
+	if err := d.SetSSHRetryPolicyFromFlags(flags); err != nil {
+		return err
+	}
 
 	if d.AccessToken == "" {
 		return fmt.Errorf("digitalocean driver requires the --digitalocean-access-token option")
@@ -227,13 +290,43 @@ func (d *Driver) PreCreateCheck() error {
 	if err != nil {
 		return err
 	}
+	validRegion := false
 	for _, region := range regions {
 		if region.Slug == d.Region {
-			return nil
+			validRegion = true
+			break
 		}
 	}
+	if !validRegion {
+		return fmt.Errorf("digitalocean requires a valid region")
+	}
 
-	return fmt.Errorf("digitalocean requires a valid region")
+	if d.ReservedIP != "" {
+		ip, resp, err := client.FloatingIPs.Get(context.TODO(), d.ReservedIP)
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				return fmt.Errorf("reserved IP %s does not exist", d.ReservedIP)
+			}
+			return err
+		}
+		if ip.Region == nil || ip.Region.Slug != d.Region {
+			return fmt.Errorf("reserved IP %s is not in region %s", d.ReservedIP, d.Region)
+		}
+		if ip.Droplet != nil {
+			return fmt.Errorf("reserved IP %s is already assigned to droplet %s", d.ReservedIP, ip.Droplet.Name)
+		}
+	}
+
+	for _, id := range d.Firewalls {
+		if _, resp, err := getFirewall(client, id); err != nil {
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				return fmt.Errorf("cloud firewall %s does not exist", id)
+			}
+			return err
+		}
+	}
+
+	return nil
 }
 
 func (d *Driver) Create() error {
@@ -255,32 +348,34 @@ func (d *Driver) Create() error {
 
 	d.SSHKeyID = key.ID
 
+	if userdata == "" {
+		if userdata, err = d.MachineUserData(); err != nil {
+			return err
+		}
+	}
+
 	log.Infof("Creating Digital Ocean droplet...")
 
 	client := d.getClient()
 
-	createRequest := &godo.DropletCreateRequest{
-		Image:             godo.DropletCreateImage{Slug: d.Image},
-		Name:              d.MachineName,
-		Region:            d.Region,
-		Size:              d.Size,
-		IPv6:              d.IPv6,
-		PrivateNetworking: d.PrivateNetworking,
-		Backups:           d.Backups,
-		UserData:          userdata,
-		SSHKeys:           []godo.DropletCreateSSHKey{{ID: d.SSHKeyID}},
-		Monitoring:        d.Monitoring,
-		Tags:              d.getTags(),
-	}
-
-	newDroplet, _, err := client.Droplets.Create(context.TODO(), createRequest)
-	if err != nil {
+	createRequest := d.createRequest(userdata)
+
+	var newDroplet *godo.Droplet
+	err = drivers.Retry(retryOptions, "Creating droplet", func() (err error) {
+		newDroplet, err = createDroplet(client, createRequest)
 		return err
+	})
+	if err != nil {
+		return classifyError(err)
 	}
 
 	d.DropletID = newDroplet.ID
 
+	// droplets of a VPC always have a private address in it
+	privateNetworking := d.PrivateNetworking || d.VPCUUID != ""
+
 	log.Info("Waiting for IP address to be assigned to the Droplet...")
+	var ipv6 string
 	for {
 		newDroplet, _, err = client.Droplets.Get(context.TODO(), d.DropletID)
 		if err != nil {
@@ -293,26 +388,70 @@ func (d *Driver) Create() error {
 			if network.Type == "public" {
 				d.IPAddress = network.IPAddress
 			}
-			if d.PrivateNetworking && network.Type == "private" {
+			if privateNetworking && network.Type == "private" {
 				d.PrivateIPAddress = network.IPAddress
 			}
 		}
+		for _, network := range newDroplet.Networks.V6 {
+			if network.Type == "public" {
+				ipv6 = network.IPAddress
+			}
+		}
 
-		if d.IPAddress != "" && (!d.PrivateNetworking || d.PrivateIPAddress != "") {
+		if d.IPAddress != "" && (!privateNetworking || d.PrivateIPAddress != "") && (!d.IPv6 || ipv6 != "") {
 			break
 		}
 
 		time.Sleep(5 * time.Second)
 	}
 
+	d.IPAddress = d.SelectIP(d.IPAddress, ipv6)
 	log.Debugf("Created droplet ID %d, IP address %s, Private IP address %s",
 		newDroplet.ID,
 		d.IPAddress,
 		d.PrivateIPAddress)
 
+	for _, id := range d.Firewalls {
+		log.Infof("Adding droplet to cloud firewall %s...", id)
+		if err := addDropletToFirewall(client, id, d.DropletID); err != nil {
+			return fmt.Errorf("failed to add droplet to cloud firewall %s: %v", id, err)
+		}
+	}
+
+	if d.ReservedIP != "" {
+		log.Infof("Assigning reserved IP %s to the droplet...", d.ReservedIP)
+		if err := assignReservedIP(client, d.ReservedIP, d.DropletID); err != nil {
+			return err
+		}
+		d.IPAddress = d.ReservedIP
+	}
+
 	return nil
 }
 
+func (d *Driver) createRequest(userdata string) *dropletCreateRequest {
+	createRequest := &dropletCreateRequest{
+		DropletCreateRequest: godo.DropletCreateRequest{
+			Image:             godo.DropletCreateImage{Slug: d.Image},
+			Name:              d.MachineName,
+			Region:            d.Region,
+			Size:              d.Size,
+			IPv6:              d.IPv6,
+			PrivateNetworking: d.PrivateNetworking,
+			Backups:           d.Backups,
+			UserData:          userdata,
+			SSHKeys:           []godo.DropletCreateSSHKey{{ID: d.SSHKeyID}},
+			Monitoring:        d.Monitoring,
+			Tags:              d.getTags(),
+		},
+		VPCUUID: d.VPCUUID,
+	}
+	if !d.DropletAgent {
+		createRequest.WithDropletAgent = &d.DropletAgent
+	}
+	return createRequest
+}
+
 func (d *Driver) createSSHKey() (*godo.Key, error) {
 	d.SSHKeyPath = d.GetSSHKeyPath()
 
@@ -333,7 +472,7 @@ func (d *Driver) createSSHKey() (*godo.Key, error) {
 		return key, nil
 	}
 
-	if err := ssh.GenerateSSHKey(d.SSHKeyPath); err != nil {
+	if err := d.GenerateSSHKey(d.SSHKeyPath); err != nil {
 		return nil, err
 	}
 
@@ -368,6 +507,29 @@ func (d *Driver) GetURL() (string, error) {
 	return fmt.Sprintf("tcp://%s", net.JoinHostPort(ip, "2376")), nil
 }
 
+// GetIPs returns the public, private and IPv6 addresses of the droplet.
+func (d *Driver) GetIPs() ([]drivers.NetworkAddress, error) {
+	droplet, _, err := d.getClient().Droplets.Get(context.TODO(), d.DropletID)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []drivers.NetworkAddress
+	addrs = drivers.AppendAddress(addrs, drivers.AddressPublic, d.ReservedIP)
+	for _, network := range droplet.Networks.V4 {
+		kind := drivers.AddressPublic
+		if network.Type == "private" {
+			kind = drivers.AddressPrivate
+		}
+		addrs = drivers.AppendAddress(addrs, kind, network.IPAddress)
+	}
+	for _, network := range droplet.Networks.V6 {
+		addrs = drivers.AppendAddress(addrs, drivers.AddressIPv6, network.IPAddress)
+	}
+
+	return addrs, nil
+}
+
 func (d *Driver) GetState() (state.State, error) {
 	droplet, resp, err := d.getClient().Droplets.Get(context.TODO(), d.DropletID)
 	if err != nil {
@@ -448,9 +610,25 @@ func (d *Driver) getTags() []string {
 		}
 	}
 
+	// Droplet tags have no value, the machine tags are key:value tags.
+	for _, key := range drivers.SortedTagKeys(d.MachineTags) {
+		tagList = append(tagList, key+":"+d.MachineTags[key])
+	}
+
 	return tagList
 }
 
+// GetTags returns the tags of the droplet, those without a value mapped to
+// an empty one.
+func (d *Driver) GetTags() (map[string]string, error) {
+	tags := map[string]string{}
+	for _, tag := range d.getTags() {
+		key, value, _ := strings.Cut(tag, ":")
+		tags[key] = value
+	}
+	return tags, nil
+}
+
 func (d *Driver) GetSSHKeyPath() string {
 	if d.SSHKey != "" {
 		d.SSHKeyPath = d.ResolveStorePath(path.Base(d.SSHKey))
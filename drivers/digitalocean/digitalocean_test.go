@@ -2,9 +2,12 @@ package digitalocean
 
 import (
 	"encoding/json"
+	"errors"
+	"net/http"
 	"os"
 	"testing"
 
+	"github.com/digitalocean/godo"
 	"github.com/rancher/machine/libmachine/drivers"
 	"github.com/stretchr/testify/assert"
 )
@@ -129,3 +132,93 @@ func TestTagsEmpty(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Nil(t, driver.getTags())
 }
+
+func TestNetworkingFlags(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"digitalocean-access-token":          "TOKEN",
+			"digitalocean-vpc-uuid":              "5a4981aa-9653-4bd1-bef5-d6bff52042e4",
+			"digitalocean-reserved-ip":           "203.0.113.10",
+			"digitalocean-firewall":              []string{"bb4b2611-3d72-467b-8602-280330ecd65c"},
+			"digitalocean-disable-droplet-agent": true,
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	err := driver.SetConfigFromFlags(checkFlags)
+	assert.NoError(t, err)
+	assert.Empty(t, checkFlags.InvalidFlags)
+
+	assert.Equal(t, "5a4981aa-9653-4bd1-bef5-d6bff52042e4", driver.VPCUUID)
+	assert.Equal(t, "203.0.113.10", driver.ReservedIP)
+	assert.Equal(t, []string{"bb4b2611-3d72-467b-8602-280330ecd65c"}, driver.Firewalls)
+	assert.False(t, driver.DropletAgent)
+}
+
+func TestCreateRequest(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	body, err := json.Marshal(driver.createRequest(""))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(body), "vpc_uuid")
+	assert.NotContains(t, string(body), "with_droplet_agent")
+
+	driver.VPCUUID = "5a4981aa-9653-4bd1-bef5-d6bff52042e4"
+	driver.DropletAgent = false
+
+	body, err = json.Marshal(driver.createRequest(""))
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), `"name":"default"`)
+	assert.Contains(t, string(body), `"vpc_uuid":"5a4981aa-9653-4bd1-bef5-d6bff52042e4"`)
+	assert.Contains(t, string(body), `"with_droplet_agent":false`)
+}
+
+func TestIsRateLimited(t *testing.T) {
+	assert.True(t, isRateLimited(&godo.ErrorResponse{Response: &http.Response{StatusCode: 429}}))
+	assert.False(t, isRateLimited(&godo.ErrorResponse{Response: &http.Response{StatusCode: 422}}))
+	assert.False(t, isRateLimited(errors.New("droplet limit reached")))
+}
+
+func TestClassifyError(t *testing.T) {
+	assert.Equal(t, drivers.ErrorCodeAuthFailure, drivers.GetErrorCode(classifyError(&godo.ErrorResponse{Response: &http.Response{StatusCode: 401}})))
+	assert.Equal(t, drivers.ErrorCodeNotFound, drivers.GetErrorCode(classifyError(&godo.ErrorResponse{Response: &http.Response{StatusCode: 404}})))
+	assert.True(t, drivers.IsRetryable(classifyError(&godo.ErrorResponse{Response: &http.Response{StatusCode: 429}})))
+	assert.Equal(t, drivers.ErrorCode(""), drivers.GetErrorCode(classifyError(&godo.ErrorResponse{Response: &http.Response{StatusCode: 422}})))
+}
+
+func TestMachineTags(t *testing.T) {
+	driver := NewDriver("default", "path")
+	driver.Tags = "docker"
+	driver.MachineTags = map[string]string{"team": "infra", "env": "prod"}
+
+	assert.Equal(t, []string{"docker", "env:prod", "team:infra"}, driver.getTags())
+
+	tags, err := driver.GetTags()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"docker": "", "env": "prod", "team": "infra"}, tags)
+}
+
+func TestCheckDropletLimit(t *testing.T) {
+	assert.NoError(t, checkDropletLimit(10, 9))
+	assert.NoError(t, checkDropletLimit(0, 9))
+
+	err := checkDropletLimit(10, 10)
+	assert.EqualError(t, err, "the account has 10 droplets, its limit")
+	assert.Equal(t, drivers.ErrorCodeQuotaExceeded, drivers.GetErrorCode(err))
+}
+
+func TestSizeCost(t *testing.T) {
+	sizes := []godo.Size{
+		{Slug: "s-1vcpu-1gb", PriceHourly: 0.00893, PriceMonthly: 6},
+		{Slug: "s-2vcpu-2gb", PriceHourly: 0.02679, PriceMonthly: 18},
+	}
+
+	estimate := sizeCost(sizes, "s-2vcpu-2gb")
+	assert.Equal(t, "USD", estimate.Currency)
+	assert.Equal(t, 0.02679, estimate.Hourly)
+	assert.Equal(t, 18.0, estimate.Monthly)
+
+	assert.Nil(t, sizeCost(sizes, "s-8vcpu-16gb"))
+}
@@ -0,0 +1,52 @@
+package digitalocean
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/rancher/machine/libmachine/drivers"
+)
+
+// PreCreatePlan checks that the account has a droplet left and returns the
+// SSH key and the droplet Create would create.
+func (d *Driver) PreCreatePlan() ([]drivers.PlannedResource, error) {
+	if d.UserDataFile != "" {
+		if _, err := os.Stat(d.UserDataFile); err != nil {
+			return nil, err
+		}
+	}
+
+	client := d.getClient()
+
+	account, _, err := client.Account.Get(context.TODO())
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	count, err := countDroplets(client)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	if err := checkDropletLimit(account.DropletLimit, count); err != nil {
+		return nil, err
+	}
+
+	resources := []drivers.PlannedResource{}
+	if d.SSHKeyFingerprint == "" {
+		resources = append(resources, drivers.PlannedResource{Type: "ssh_key", Name: d.MachineName})
+	}
+	return append(resources, drivers.PlannedResource{
+		Type:    "droplet",
+		Name:    d.MachineName,
+		Details: fmt.Sprintf("%s from %s in %s", d.Size, d.Image, d.Region),
+	}), nil
+}
+
+// checkDropletLimit returns a quota error if the account has as many
+// droplets as its limit allows.
+func checkDropletLimit(limit, count int) error {
+	if limit > 0 && count >= limit {
+		return drivers.Errorf(drivers.ErrorCodeQuotaExceeded, "the account has %d droplets, its limit", count)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package driverutil
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/log"
+	"gopkg.in/yaml.v2"
+)
+
+// isoMakers are the commands which can write the seed ISOs.
+var isoMakers = []string{"mkisofs", "genisoimage", "xorrisofs"}
+
+// MakeISO writes the ISO of the directory with the volume label. It is
+// replaced by the tests of the drivers.
+var MakeISO = func(iso, label, dir string) error {
+	var path string
+	for _, name := range isoMakers {
+		if p, err := exec.LookPath(name); err == nil {
+			path = p
+			break
+		}
+	}
+	if path == "" {
+		return fmt.Errorf("none of %v found to create the cloud-init seed ISO", isoMakers)
+	}
+
+	cmd := exec.Command(path, "-J", "-r", "-V", label, "-output", iso, dir)
+	log.Debugf("COMMAND: %v", cmd.Args)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %v: %s", filepath.Base(path), err, out)
+	}
+	return nil
+}
+
+// WriteSeedISO writes the cloud-init NoCloud seed ISO of the instance at
+// iso, its user-data and meta-data files being written to dataDir.
+func WriteSeedISO(iso, dataDir, instanceName string, userData []byte) error {
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "user-data"), userData, 0600); err != nil {
+		return err
+	}
+	metaData := fmt.Sprintf("instance-id: %s\nlocal-hostname: %s\n", instanceName, instanceName)
+	if err := os.WriteFile(filepath.Join(dataDir, "meta-data"), []byte(metaData), 0600); err != nil {
+		return err
+	}
+
+	return MakeISO(iso, "cidata", dataDir)
+}
+
+// userData returns the content of the user data file, or else the machine
+// user-data of the driver, with where it comes from for the errors.
+func userData(d *drivers.BaseDriver, file string) ([]byte, string, error) {
+	if file == "" {
+		data, err := d.MachineUserData()
+		return []byte(data), "--" + drivers.MachineUserDataFlag, err
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, file, fmt.Errorf("cannot read user data file %v: %v", file, err)
+	}
+	return data, file, nil
+}
+
+// CloudConfigWithUser returns the #cloud-config creating the SSH user of
+// the driver, with sudo and the key, on top of the cloud-config file or
+// else the machine user-data, if any.
+func CloudConfigWithUser(d *drivers.BaseDriver, cloudConfig, publicKey string) ([]byte, error) {
+	data, source, err := userData(d, cloudConfig)
+	if err != nil {
+		return nil, err
+	}
+	config := map[interface{}]interface{}{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid cloud-config %s: %s", source, err)
+	}
+
+	user := map[interface{}]interface{}{
+		"name":                d.SSHUser,
+		"lock_passwd":         true,
+		"sudo":                "ALL=(ALL) NOPASSWD:ALL",
+		"shell":               "/bin/bash",
+		"ssh_authorized_keys": []string{publicKey},
+	}
+	users, _ := config["users"].([]interface{})
+	if len(users) == 0 {
+		// The default user of the image is kept, as it is when no users
+		// are listed.
+		users = []interface{}{"default"}
+	}
+	config["users"] = append(users, user)
+
+	data, err = yaml.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("#cloud-config\n"), data...), nil
+}
+
+// CloudConfigWithKey returns the #cloud-config of the user data file or
+// else the machine user-data, if any, which also authorizes the key.
+// Without a key, the user data is only checked and nothing is returned.
+func CloudConfigWithKey(d *drivers.BaseDriver, userDataFile, publicKey string) ([]byte, error) {
+	data, source, err := userData(d, userDataFile)
+	if err != nil {
+		return nil, err
+	}
+	var config yaml.MapSlice
+	if len(data) > 0 {
+		if !bytes.HasPrefix(data, []byte("#cloud-config")) {
+			return nil, fmt.Errorf("user data %s must be a #cloud-config", source)
+		}
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("invalid user data %s: %s", source, err)
+		}
+	}
+	if publicKey == "" {
+		return nil, nil
+	}
+
+	keys := []interface{}{publicKey}
+	found := false
+	for i, item := range config {
+		if item.Key == "ssh_authorized_keys" {
+			existing, _ := item.Value.([]interface{})
+			config[i].Value = append(existing, keys...)
+			found = true
+		}
+	}
+	if !found {
+		config = append(config, yaml.MapItem{Key: "ssh_authorized_keys", Value: keys})
+	}
+
+	data, err = yaml.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("#cloud-config\n"), data...), nil
+}
@@ -0,0 +1,101 @@
+package driverutil
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestCloudConfigWithUser(t *testing.T) {
+	cloudConfig := filepath.Join(t.TempDir(), "cloud-config")
+	assert.NoError(t, os.WriteFile(cloudConfig, []byte("packages:\n- qemu-guest-agent\n"), 0600))
+
+	data, err := CloudConfigWithUser(&drivers.BaseDriver{SSHUser: "docker"}, cloudConfig, "ssh-rsa AAAA")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "#cloud-config\n"))
+
+	var config struct {
+		Packages []string      `yaml:"packages"`
+		Users    []interface{} `yaml:"users"`
+	}
+	assert.NoError(t, yaml.Unmarshal(data, &config))
+	assert.Equal(t, []string{"qemu-guest-agent"}, config.Packages)
+	assert.Len(t, config.Users, 2)
+	assert.Equal(t, "default", config.Users[0])
+	user := config.Users[1].(map[interface{}]interface{})
+	assert.Equal(t, "docker", user["name"])
+	assert.Equal(t, []interface{}{"ssh-rsa AAAA"}, user["ssh_authorized_keys"])
+}
+
+func TestCloudConfigWithKey(t *testing.T) {
+	userData := filepath.Join(t.TempDir(), "user-data")
+	assert.NoError(t, os.WriteFile(userData, []byte("#cloud-config\npackages:\n- qemu-guest-agent\nssh_authorized_keys:\n- ssh-ed25519 AAAA user\n"), 0600))
+
+	d := &drivers.BaseDriver{}
+	data, err := CloudConfigWithKey(d, userData, "ssh-rsa BBBB")
+	assert.NoError(t, err)
+	assert.Equal(t, "#cloud-config\npackages:\n- qemu-guest-agent\nssh_authorized_keys:\n- ssh-ed25519 AAAA user\n- ssh-rsa BBBB\n", string(data))
+
+	data, err = CloudConfigWithKey(d, userData, "")
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+
+	assert.NoError(t, os.WriteFile(userData, []byte("#!/bin/sh\necho hello\n"), 0600))
+	_, err = CloudConfigWithKey(d, userData, "")
+	assert.EqualError(t, err, "user data "+userData+" must be a #cloud-config")
+}
+
+func TestCloudConfigOfMachineUserData(t *testing.T) {
+	d := &drivers.BaseDriver{MachineName: "default", SSHUser: "docker", StorePath: t.TempDir()}
+	d.MachineUserDataFile = filepath.Join(t.TempDir(), "user-data")
+	assert.NoError(t, os.WriteFile(d.MachineUserDataFile, []byte("#cloud-config\nhostname: {{.MachineName}}\n"), 0600))
+
+	data, err := CloudConfigWithKey(d, "", "ssh-rsa BBBB")
+	assert.NoError(t, err)
+	assert.Equal(t, "#cloud-config\nhostname: default\nssh_authorized_keys:\n- ssh-rsa BBBB\n", string(data))
+
+	data, err = CloudConfigWithUser(d, "", "ssh-rsa AAAA")
+	assert.NoError(t, err)
+	var config struct {
+		Hostname string        `yaml:"hostname"`
+		Users    []interface{} `yaml:"users"`
+	}
+	assert.NoError(t, yaml.Unmarshal(data, &config))
+	assert.Equal(t, "default", config.Hostname)
+	assert.Len(t, config.Users, 2)
+
+	// The user data file of the driver is used instead.
+	userData := filepath.Join(t.TempDir(), "user-data")
+	assert.NoError(t, os.WriteFile(userData, []byte("#cloud-config\npackages:\n- curl\n"), 0600))
+	data, err = CloudConfigWithKey(d, userData, "ssh-rsa BBBB")
+	assert.NoError(t, err)
+	assert.Equal(t, "#cloud-config\npackages:\n- curl\nssh_authorized_keys:\n- ssh-rsa BBBB\n", string(data))
+
+	assert.NoError(t, os.WriteFile(d.MachineUserDataFile, []byte("#!/bin/sh\necho {{.MachineName}}\n"), 0600))
+	_, err = CloudConfigWithKey(d, "", "")
+	assert.EqualError(t, err, "user data --machine-user-data must be a #cloud-config")
+}
+
+func TestWriteSeedISO(t *testing.T) {
+	orig := MakeISO
+	var made []string
+	MakeISO = func(iso, label, dir string) error {
+		made = append(made, label, iso, dir)
+		return nil
+	}
+	defer func() { MakeISO = orig }()
+
+	dir := t.TempDir()
+	iso, dataDir := filepath.Join(dir, "seed.iso"), filepath.Join(dir, "data")
+	assert.NoError(t, WriteSeedISO(iso, dataDir, "default", []byte("#cloud-config\n")))
+
+	assert.Equal(t, []string{"cidata", iso, dataDir}, made)
+	metaData, err := os.ReadFile(filepath.Join(dataDir, "meta-data"))
+	assert.NoError(t, err)
+	assert.Equal(t, "instance-id: default\nlocal-hostname: default\n", string(metaData))
+}
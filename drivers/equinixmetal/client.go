@@ -0,0 +1,231 @@
+package equinixmetal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rancher/machine/libmachine/version"
+)
+
+// apiEndpoint is the Equinix Metal API, replaced by the tests.
+var apiEndpoint = "https://api.equinix.com/metal/v1"
+
+// Client makes the calls to the Equinix Metal API the driver needs.
+type Client struct {
+	token      string
+	endpoint   string
+	httpClient *http.Client
+}
+
+func NewClient(token string) *Client {
+	return &Client{
+		token:      token,
+		endpoint:   apiEndpoint,
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// APIError is an error answered by the Equinix Metal API.
+type APIError struct {
+	StatusCode int
+	Errors     []string `json:"errors"`
+}
+
+func (e *APIError) Error() string {
+	return "equinixmetal: " + strings.Join(e.Errors, ", ")
+}
+
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+type IPAddress struct {
+	Address       string `json:"address"`
+	AddressFamily int    `json:"address_family"`
+	Public        bool   `json:"public"`
+}
+
+type Port struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type Device struct {
+	ID           string      `json:"id"`
+	Hostname     string      `json:"hostname"`
+	State        string      `json:"state"`
+	NetworkType  string      `json:"network_type"`
+	IPAddresses  []IPAddress `json:"ip_addresses"`
+	NetworkPorts []Port      `json:"network_ports"`
+}
+
+// Address returns the first address of the device in the family, 4 or 6,
+// which is public or not.
+func (d *Device) Address(family int, public bool) string {
+	for _, ip := range d.IPAddresses {
+		if ip.AddressFamily == family && ip.Public == public {
+			return ip.Address
+		}
+	}
+	return ""
+}
+
+// Port returns the ID of the network port of the device with the name,
+// e.g. "bond0".
+func (d *Device) Port(name string) string {
+	for _, port := range d.NetworkPorts {
+		if port.Name == name {
+			return port.ID
+		}
+	}
+	return ""
+}
+
+type DeviceCreateRequest struct {
+	Hostname              string   `json:"hostname"`
+	Metro                 string   `json:"metro"`
+	Plan                  string   `json:"plan"`
+	OperatingSystem       string   `json:"operating_system"`
+	BillingCycle          string   `json:"billing_cycle"`
+	HardwareReservationID string   `json:"hardware_reservation_id,omitempty"`
+	UserData              string   `json:"userdata,omitempty"`
+	Tags                  []string `json:"tags,omitempty"`
+	ProjectSSHKeys        []string `json:"project_ssh_keys,omitempty"`
+}
+
+type SSHKey struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	Key   string `json:"key"`
+}
+
+func (c *Client) do(method, path string, body, reply interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.endpoint+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Auth-Token", c.token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("docker-machine/v%d", version.APIVersion))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 400 {
+		apiErr := &APIError{}
+		if err := json.Unmarshal(data, apiErr); err != nil || len(apiErr.Errors) == 0 {
+			apiErr.Errors = []string{resp.Status}
+		}
+		apiErr.StatusCode = resp.StatusCode
+		return apiErr
+	}
+
+	if reply == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, reply)
+}
+
+// slugs returns the slugs, or codes, of a collection, e.g. the plans.
+func (c *Client) slugs(path, collection, field string) ([]string, error) {
+	var reply map[string][]map[string]interface{}
+	if err := c.do(http.MethodGet, path, nil, &reply); err != nil {
+		return nil, err
+	}
+	var slugs []string
+	for _, item := range reply[collection] {
+		if slug, ok := item[field].(string); ok {
+			slugs = append(slugs, slug)
+		}
+	}
+	return slugs, nil
+}
+
+func (c *Client) Metros() ([]string, error) {
+	return c.slugs("/locations/metros", "metros", "code")
+}
+
+func (c *Client) Plans() ([]string, error) {
+	return c.slugs("/plans", "plans", "slug")
+}
+
+func (c *Client) OperatingSystems() ([]string, error) {
+	return c.slugs("/operating-systems", "operating_systems", "slug")
+}
+
+func (c *Client) GetHardwareReservation(id string) error {
+	return c.do(http.MethodGet, "/hardware-reservations/"+id, nil, nil)
+}
+
+func (c *Client) CreateSSHKey(projectID, label, publicKey string) (*SSHKey, error) {
+	var reply SSHKey
+	body := map[string]string{"label": label, "key": publicKey}
+	if err := c.do(http.MethodPost, "/projects/"+projectID+"/ssh-keys", body, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+func (c *Client) DeleteSSHKey(id string) error {
+	return c.do(http.MethodDelete, "/ssh-keys/"+id, nil, nil)
+}
+
+func (c *Client) CreateDevice(projectID string, request *DeviceCreateRequest) (*Device, error) {
+	var reply Device
+	if err := c.do(http.MethodPost, "/projects/"+projectID+"/devices", request, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+func (c *Client) GetDevice(id string) (*Device, error) {
+	var reply Device
+	if err := c.do(http.MethodGet, "/devices/"+id, nil, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+func (c *Client) DeleteDevice(id string) error {
+	return c.do(http.MethodDelete, "/devices/"+id, nil, nil)
+}
+
+// DeviceAction runs an action, e.g. "power_on", on the device.
+func (c *Client) DeviceAction(id, action string) error {
+	return c.do(http.MethodPost, "/devices/"+id+"/actions", map[string]string{"type": action}, nil)
+}
+
+// PortAction runs an action on a network port, e.g. "disbond" or
+// "convert/layer-2".
+func (c *Client) PortAction(id, action string) error {
+	return c.do(http.MethodPost, "/ports/"+id+"/"+action, nil, nil)
+}
+
+// AssignVLAN assigns the VLAN, by ID or VXLAN number, to a network port.
+func (c *Client) AssignVLAN(portID, vlan string) error {
+	return c.do(http.MethodPost, "/ports/"+portID+"/assign", map[string]string{"vnid": vlan}, nil)
+}
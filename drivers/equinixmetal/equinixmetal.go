@@ -0,0 +1,544 @@
+package equinixmetal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	rpcdriver "github.com/rancher/machine/libmachine/drivers/rpc"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/rancher/machine/libmachine/ssh"
+	"github.com/rancher/machine/libmachine/state"
+)
+
+type Driver struct {
+	*drivers.BaseDriver
+	AuthToken           string
+	ProjectID           string
+	DeviceID            string
+	Metro               string
+	Plan                string
+	OS                  string
+	BillingCycle        string
+	HardwareReservation string
+	UserDataFile        string
+	NetworkType         string
+	VLANs               []string
+	Layer2IPAddress     string
+	Tags                string
+	SSHKeyID            string
+	PrivateIPAddress    string
+}
+
+const (
+	defaultSSHPort      = 22
+	defaultSSHUser      = "root"
+	defaultMetro        = "da"
+	defaultPlan         = "c3.small.x86"
+	defaultOS           = "ubuntu_22_04"
+	defaultBillingCycle = "hourly"
+
+	// The network types of the devices, which are all reached over layer
+	// 3 but the layer2-bonded ones.
+	networkTypeLayer3       = "layer3"
+	networkTypeHybrid       = "hybrid"
+	networkTypeHybridBonded = "hybrid-bonded"
+	networkTypeLayer2Bonded = "layer2-bonded"
+
+	// nextAvailable reserves any of the hardware reserved by the project.
+	nextAvailable = "next-available"
+)
+
+// Capabilities returns the optional operations supported by the driver.
+// Devices cannot be forcibly powered off.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityStartStop,
+		drivers.CapabilityRestart,
+		drivers.CapabilityPrivateIP,
+		drivers.CapabilityCustomSSHPort,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+	}
+}
+
+// GetCreateFlags registers the flags this driver adds to
+// "docker hosts create"
+func (d *Driver) GetCreateFlags() []mcnflag.Flag {
+	return []mcnflag.Flag{
+		mcnflag.StringFlag{
+			EnvVar:    "METAL_AUTH_TOKEN",
+			Name:      "equinixmetal-api-key",
+			Usage:     "Equinix Metal API key",
+			Sensitive: true,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "METAL_PROJECT_ID",
+			Name:   "equinixmetal-project-id",
+			Usage:  "Equinix Metal project to create the device in",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "EQUINIXMETAL_SSH_USER",
+			Name:   "equinixmetal-ssh-user",
+			Usage:  "SSH username",
+			Value:  defaultSSHUser,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "EQUINIXMETAL_SSH_PORT",
+			Name:   "equinixmetal-ssh-port",
+			Usage:  "SSH port",
+			Value:  defaultSSHPort,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "EQUINIXMETAL_METRO",
+			Name:   "equinixmetal-metro",
+			Usage:  "Equinix Metal metro code",
+			Value:  defaultMetro,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "EQUINIXMETAL_PLAN",
+			Name:   "equinixmetal-plan",
+			Usage:  "Equinix Metal plan",
+			Value:  defaultPlan,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "EQUINIXMETAL_OS",
+			Name:   "equinixmetal-os",
+			Usage:  "Equinix Metal operating system",
+			Value:  defaultOS,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "EQUINIXMETAL_BILLING_CYCLE",
+			Name:   "equinixmetal-billing-cycle",
+			Usage:  "Equinix Metal billing cycle, hourly or monthly",
+			Value:  defaultBillingCycle,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "EQUINIXMETAL_HW_RESERVATION_ID",
+			Name:   "equinixmetal-hw-reservation-id",
+			Usage:  "ID of the reserved hardware to deploy the device on, or next-available",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "EQUINIXMETAL_USERDATA",
+			Name:   "equinixmetal-userdata",
+			Usage:  "path to file with cloud-init user-data",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "EQUINIXMETAL_NETWORK_TYPE",
+			Name:   "equinixmetal-network-type",
+			Usage:  "network type of the device: layer3, hybrid, hybrid-bonded or layer2-bonded",
+			Value:  networkTypeLayer3,
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "EQUINIXMETAL_VLANS",
+			Name:   "equinixmetal-vlans",
+			Usage:  "VLANs, by ID or VXLAN number, to attach the device to in the layer 2 network types",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "EQUINIXMETAL_LAYER2_IP",
+			Name:   "equinixmetal-layer2-ip",
+			Usage:  "address the device is reached at over its VLANs in the layer2-bonded network type",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "EQUINIXMETAL_TAGS",
+			Name:   "equinixmetal-tags",
+			Usage:  "comma-separated list of tags to apply to the device",
+		},
+	}
+}
+
+func NewDriver(hostName, storePath string) *Driver {
+	return &Driver{
+		Metro:        defaultMetro,
+		Plan:         defaultPlan,
+		OS:           defaultOS,
+		BillingCycle: defaultBillingCycle,
+		NetworkType:  networkTypeLayer3,
+		BaseDriver: &drivers.BaseDriver{
+			MachineName: hostName,
+			StorePath:   storePath,
+		},
+	}
+}
+
+func (d *Driver) GetSSHHostname() (string, error) {
+	return d.GetIP()
+}
+
+// DriverName returns the name of the driver
+func (d *Driver) DriverName() string {
+	return "equinixmetal"
+}
+
+// UnmarshalJSON loads driver config from JSON. This function is used by the RPCServerDriver that wraps
+// all drivers as a means of populating an already-initialized driver with new configuration.
+// See `RPCServerDriver.SetConfigRaw`.
+func (d *Driver) UnmarshalJSON(data []byte) error {
+	// Unmarshal driver config into an aliased type to prevent infinite recursion on UnmarshalJSON.
+	type targetDriver Driver
+
+	// Copy data from `d` to `target` before unmarshalling. This will ensure that already-initialized values
+	// from `d` that are left untouched during unmarshal (like functions) are preserved.
+	target := targetDriver(*d)
+
+	if err := json.Unmarshal(data, &target); err != nil {
+		return fmt.Errorf("error unmarshalling driver config from JSON: %w", err)
+	}
+
+	// Copy unmarshalled data back to `d`.
+	*d = Driver(target)
+
+	// Make sure to reload values that are subject to change from envvars and os.Args.
+	driverOpts, err := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	if err != nil {
+		return err
+	}
+	if _, ok := driverOpts.Values["equinixmetal-api-key"]; ok {
+		d.AuthToken = driverOpts.String("equinixmetal-api-key")
+	}
+
+	return nil
+}
+
+func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
+	d.AuthToken = flags.String("equinixmetal-api-key")
+	d.ProjectID = flags.String("equinixmetal-project-id")
+	d.Metro = flags.String("equinixmetal-metro")
+	d.Plan = flags.String("equinixmetal-plan")
+	d.OS = flags.String("equinixmetal-os")
+	d.BillingCycle = flags.String("equinixmetal-billing-cycle")
+	d.HardwareReservation = flags.String("equinixmetal-hw-reservation-id")
+	d.UserDataFile = flags.String("equinixmetal-userdata")
+	d.NetworkType = flags.String("equinixmetal-network-type")
+	d.VLANs = flags.StringSlice("equinixmetal-vlans")
+	d.Layer2IPAddress = flags.String("equinixmetal-layer2-ip")
+	d.Tags = flags.String("equinixmetal-tags")
+	d.SSHUser = flags.String("equinixmetal-ssh-user")
+	d.SSHPort = flags.Int("equinixmetal-ssh-port")
+
+	d.SetSwarmConfigFromFlags(flags)
+
+	if d.AuthToken == "" {
+		return fmt.Errorf("equinixmetal driver requires the --equinixmetal-api-key option")
+	}
+	if d.ProjectID == "" {
+		return fmt.Errorf("equinixmetal driver requires the --equinixmetal-project-id option")
+	}
+
+	switch d.NetworkType {
+	case networkTypeLayer3:
+	case networkTypeHybrid, networkTypeHybridBonded, networkTypeLayer2Bonded:
+		if len(d.VLANs) == 0 {
+			return fmt.Errorf("equinixmetal driver requires the --equinixmetal-vlans option in the %s network type", d.NetworkType)
+		}
+	default:
+		return fmt.Errorf("equinixmetal network type must be one of layer3, hybrid, hybrid-bonded or layer2-bonded, got %q", d.NetworkType)
+	}
+	if (d.NetworkType == networkTypeLayer2Bonded) != (d.Layer2IPAddress != "") {
+		return fmt.Errorf("equinixmetal driver requires the --equinixmetal-layer2-ip option in, and only in, the layer2-bonded network type")
+	}
+
+	return nil
+}
+
+func (d *Driver) PreCreateCheck() error {
+	if d.UserDataFile != "" {
+		if _, err := os.Stat(d.UserDataFile); os.IsNotExist(err) {
+			return fmt.Errorf("user-data file %s could not be found", d.UserDataFile)
+		}
+	}
+
+	client := d.getClient()
+	for _, check := range []struct {
+		what, value string
+		list        func() ([]string, error)
+	}{
+		{"metro", d.Metro, client.Metros},
+		{"plan", d.Plan, client.Plans},
+		{"operating system", d.OS, client.OperatingSystems},
+	} {
+		values, err := check.list()
+		if err != nil {
+			return err
+		}
+		if !contains(values, check.value) {
+			return fmt.Errorf("equinixmetal requires a valid %s, got %q", check.what, check.value)
+		}
+	}
+
+	if d.HardwareReservation != "" && d.HardwareReservation != nextAvailable {
+		if err := client.GetHardwareReservation(d.HardwareReservation); err != nil {
+			if isNotFound(err) {
+				return fmt.Errorf("equinixmetal hardware reservation %s doesn't exist", d.HardwareReservation)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Driver) Create() error {
+	createRequest, err := d.createRequest()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Creating SSH key...")
+
+	d.SSHKeyPath = d.GetSSHKeyPath()
+	if err := ssh.GenerateSSHKey(d.SSHKeyPath); err != nil {
+		return err
+	}
+	publicKey, err := os.ReadFile(d.SSHKeyPath + ".pub")
+	if err != nil {
+		return err
+	}
+
+	client := d.getClient()
+	key, err := client.CreateSSHKey(d.ProjectID, d.MachineName, string(publicKey))
+	if err != nil {
+		return err
+	}
+	d.SSHKeyID = key.ID
+	createRequest.ProjectSSHKeys = []string{key.ID}
+
+	log.Infof("Creating Equinix Metal device...")
+
+	device, err := client.CreateDevice(d.ProjectID, createRequest)
+	if err != nil {
+		if removeErr := d.Remove(); removeErr != nil {
+			return fmt.Errorf("failed to create machine due to error: %v. Removing SSH key: %v", err, removeErr)
+		}
+		return err
+	}
+	d.DeviceID = device.ID
+
+	log.Info("Waiting for the device to be active...")
+	for {
+		device, err = client.GetDevice(d.DeviceID)
+		if err != nil {
+			return d.removeAfter(err)
+		}
+		if device.State == "failed" {
+			return d.removeAfter(fmt.Errorf("equinixmetal device %s failed to provision", d.DeviceID))
+		}
+
+		d.IPAddress = device.Address(4, true)
+		d.PrivateIPAddress = device.Address(4, false)
+
+		if device.State == "active" && d.IPAddress != "" {
+			break
+		}
+
+		time.Sleep(5 * time.Second)
+	}
+
+	if err := d.configureNetwork(client, device); err != nil {
+		return d.removeAfter(err)
+	}
+
+	log.Debugf("Created Equinix Metal device ID %s, IP address %s, Private IP address %s",
+		device.ID,
+		d.IPAddress,
+		d.PrivateIPAddress)
+
+	return nil
+}
+
+// createRequest returns the request creating the device, without its SSH
+// key.
+func (d *Driver) createRequest() (*DeviceCreateRequest, error) {
+	createRequest := &DeviceCreateRequest{
+		Hostname:              d.MachineName,
+		Metro:                 d.Metro,
+		Plan:                  d.Plan,
+		OperatingSystem:       d.OS,
+		BillingCycle:          d.BillingCycle,
+		HardwareReservationID: d.HardwareReservation,
+		Tags:                  d.getTags(),
+	}
+
+	if d.UserDataFile != "" {
+		buf, err := os.ReadFile(d.UserDataFile)
+		if err != nil {
+			return nil, err
+		}
+		createRequest.UserData = string(buf)
+	}
+
+	return createRequest, nil
+}
+
+// configureNetwork moves the active device to its network type and
+// attaches it to its VLANs.
+func (d *Driver) configureNetwork(client *Client, device *Device) error {
+	var port string
+	switch d.NetworkType {
+	case networkTypeLayer3:
+		return nil
+	case networkTypeHybrid:
+		// eth1 leaves the bond to carry the VLANs alone.
+		port = device.Port("eth1")
+		if port == "" {
+			return fmt.Errorf("equinixmetal device %s has no eth1 port for the hybrid network type", device.ID)
+		}
+		if err := client.PortAction(port, "disbond"); err != nil {
+			return err
+		}
+	case networkTypeHybridBonded, networkTypeLayer2Bonded:
+		port = device.Port("bond0")
+		if port == "" {
+			return fmt.Errorf("equinixmetal device %s has no bond0 port", device.ID)
+		}
+		if d.NetworkType == networkTypeLayer2Bonded {
+			log.Infof("Converting the device to layer 2, it will be reached at %s...", d.Layer2IPAddress)
+			if err := client.PortAction(port, "convert/layer-2"); err != nil {
+				return err
+			}
+			d.IPAddress = d.Layer2IPAddress
+			d.PrivateIPAddress = ""
+		}
+	}
+
+	for _, vlan := range d.VLANs {
+		if err := client.AssignVLAN(port, vlan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Driver) removeAfter(err error) error {
+	if removeErr := d.Remove(); removeErr != nil {
+		return fmt.Errorf("failed to create machine due to error: %v. Removing device: %v", err, removeErr)
+	}
+	return err
+}
+
+func (d *Driver) GetURL() (string, error) {
+	if err := drivers.MustBeRunning(d); err != nil {
+		return "", err
+	}
+
+	ip, err := d.GetIP()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("tcp://%s", net.JoinHostPort(ip, "2376")), nil
+}
+
+// GetIPs returns the public, private and IPv6 addresses of the device, and
+// the address it is reached at over its VLANs in layer 2.
+func (d *Driver) GetIPs() ([]drivers.NetworkAddress, error) {
+	device, err := d.getClient().GetDevice(d.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	return d.deviceAddresses(device), nil
+}
+
+func (d *Driver) deviceAddresses(device *Device) []drivers.NetworkAddress {
+	var addrs []drivers.NetworkAddress
+	addrs = drivers.AppendAddress(addrs, drivers.AddressPublic, device.Address(4, true))
+	addrs = drivers.AppendAddress(addrs, drivers.AddressPrivate, device.Address(4, false))
+	addrs = drivers.AppendAddress(addrs, drivers.AddressPrivate, d.Layer2IPAddress)
+	return drivers.AppendAddress(addrs, drivers.AddressIPv6, device.Address(6, true))
+}
+
+func (d *Driver) GetState() (state.State, error) {
+	device, err := d.getClient().GetDevice(d.DeviceID)
+	if err != nil {
+		if !isNotFound(err) {
+			return state.Error, err
+		}
+		return state.None, fmt.Errorf("machine %v not found", d.MachineName)
+	}
+	return deviceState(device.State), nil
+}
+
+func deviceState(status string) state.State {
+	switch status {
+	case "queued", "provisioning", "powering_on", "reinstalling":
+		return state.Starting
+	case "active":
+		return state.Running
+	case "powering_off":
+		return state.Stopping
+	case "inactive":
+		return state.Stopped
+	case "failed":
+		return state.Error
+	}
+	return state.None
+}
+
+func (d *Driver) Start() error {
+	return d.getClient().DeviceAction(d.DeviceID, "power_on")
+}
+
+func (d *Driver) Stop() error {
+	return d.getClient().DeviceAction(d.DeviceID, "power_off")
+}
+
+func (d *Driver) Restart() error {
+	return d.getClient().DeviceAction(d.DeviceID, "reboot")
+}
+
+// Kill powers the device off, as it cannot be forcibly powered off.
+func (d *Driver) Kill() error {
+	return d.Stop()
+}
+
+func (d *Driver) Remove() error {
+	client := d.getClient()
+	if d.DeviceID != "" {
+		if err := client.DeleteDevice(d.DeviceID); err != nil {
+			if !isNotFound(err) {
+				return err
+			}
+			log.Infof("Equinix Metal device doesn't exist, assuming it is already deleted")
+		}
+	}
+	if d.SSHKeyID != "" {
+		if err := client.DeleteSSHKey(d.SSHKeyID); err != nil {
+			if !isNotFound(err) {
+				return err
+			}
+			log.Infof("Equinix Metal SSH key doesn't exist, assuming it is already deleted")
+		}
+	}
+	return nil
+}
+
+func (d *Driver) getClient() *Client {
+	return NewClient(d.AuthToken)
+}
+
+func (d *Driver) getTags() []string {
+	var tagList []string
+
+	for _, t := range strings.Split(d.Tags, ",") {
+		t = strings.TrimSpace(t)
+		if t != "" {
+			tagList = append(tagList, t)
+		}
+	}
+
+	return tagList
+}
@@ -0,0 +1,139 @@
+package equinixmetal
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnmarshalJSON(t *testing.T) {
+	driver := NewDriver("", "")
+
+	// Unmarhsal driver configuration from JSON and args.
+	os.Args = append(os.Args, []string{"--equinixmetal-api-key", "test api key"}...)
+
+	driverBytes, err := json.Marshal(driver)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(driverBytes, driver))
+
+	// Make sure that config has been pulled in from envvars and args.
+	assert.Equal(t, "test api key", driver.AuthToken)
+}
+
+func TestSetConfigFromFlags(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"equinixmetal-api-key":      "TOKEN",
+			"equinixmetal-project-id":   "project",
+			"equinixmetal-network-type": "hybrid",
+			"equinixmetal-vlans":        []string{"1000"},
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	err := driver.SetConfigFromFlags(checkFlags)
+
+	assert.NoError(t, err)
+	assert.Empty(t, checkFlags.InvalidFlags)
+	assert.Equal(t, "da", driver.Metro)
+	assert.Equal(t, "c3.small.x86", driver.Plan)
+	assert.Equal(t, "ubuntu_22_04", driver.OS)
+	assert.Equal(t, "hourly", driver.BillingCycle)
+	assert.Equal(t, []string{"1000"}, driver.VLANs)
+
+	sshPort, err := driver.GetSSHPort()
+	assert.NoError(t, err)
+	assert.Equal(t, "root", driver.GetSSHUsername())
+	assert.Equal(t, 22, sshPort)
+}
+
+func TestSetConfigFromFlagsInvalidNetwork(t *testing.T) {
+	for _, tc := range []struct {
+		flags    map[string]interface{}
+		expected string
+	}{
+		{
+			map[string]interface{}{"equinixmetal-network-type": "layer4"},
+			`equinixmetal network type must be one of layer3, hybrid, hybrid-bonded or layer2-bonded, got "layer4"`,
+		},
+		{
+			map[string]interface{}{"equinixmetal-network-type": "hybrid-bonded"},
+			"equinixmetal driver requires the --equinixmetal-vlans option in the hybrid-bonded network type",
+		},
+		{
+			map[string]interface{}{"equinixmetal-network-type": "layer2-bonded", "equinixmetal-vlans": []string{"1000"}},
+			"equinixmetal driver requires the --equinixmetal-layer2-ip option in, and only in, the layer2-bonded network type",
+		},
+	} {
+		driver := NewDriver("default", "path")
+		tc.flags["equinixmetal-api-key"] = "TOKEN"
+		tc.flags["equinixmetal-project-id"] = "project"
+		checkFlags := &drivers.CheckDriverOptions{
+			FlagsValues: tc.flags,
+			CreateFlags: driver.GetCreateFlags(),
+		}
+		assert.EqualError(t, driver.SetConfigFromFlags(checkFlags), tc.expected)
+	}
+}
+
+func TestCreateRequest(t *testing.T) {
+	userdata := filepath.Join(t.TempDir(), "cloud-init.yaml")
+	assert.NoError(t, os.WriteFile(userdata, []byte("#cloud-config\n"), 0600))
+
+	driver := NewDriver("default", "path")
+	driver.HardwareReservation = "hw-1"
+	driver.UserDataFile = userdata
+	driver.Tags = "rancher, test"
+
+	request, err := driver.createRequest()
+	assert.NoError(t, err)
+	assert.Equal(t, &DeviceCreateRequest{
+		Hostname:              "default",
+		Metro:                 "da",
+		Plan:                  "c3.small.x86",
+		OperatingSystem:       "ubuntu_22_04",
+		BillingCycle:          "hourly",
+		HardwareReservationID: "hw-1",
+		UserData:              "#cloud-config\n",
+		Tags:                  []string{"rancher", "test"},
+	}, request)
+}
+
+func TestDeviceState(t *testing.T) {
+	for status, expected := range map[string]state.State{
+		"provisioning": state.Starting,
+		"active":       state.Running,
+		"powering_off": state.Stopping,
+		"inactive":     state.Stopped,
+		"failed":       state.Error,
+		"deleted":      state.None,
+	} {
+		assert.Equal(t, expected, deviceState(status), status)
+	}
+}
+
+func TestDeviceAddresses(t *testing.T) {
+	var device Device
+	assert.NoError(t, json.Unmarshal([]byte(`{"id": "42", "ip_addresses": [{"address": "1.2.3.4", "address_family": 4, "public": true}, {"address": "2001:db8::1", "address_family": 6, "public": true}, {"address": "10.0.0.3", "address_family": 4, "public": false}], "network_ports": [{"id": "port-bond0", "name": "bond0"}, {"id": "port-eth1", "name": "eth1"}]}`), &device))
+
+	driver := NewDriver("default", "path")
+	assert.Equal(t, []drivers.NetworkAddress{
+		{Kind: drivers.AddressPublic, Address: "1.2.3.4"},
+		{Kind: drivers.AddressPrivate, Address: "10.0.0.3"},
+		{Kind: drivers.AddressIPv6, Address: "2001:db8::1"},
+	}, driver.deviceAddresses(&device))
+
+	// Devices in layer 2 are also reached at their VLAN address.
+	driver.Layer2IPAddress = "192.168.100.2"
+	assert.Contains(t, driver.deviceAddresses(&device), drivers.NetworkAddress{Kind: drivers.AddressPrivate, Address: "192.168.100.2"})
+
+	assert.Equal(t, "port-eth1", device.Port("eth1"))
+	assert.Empty(t, device.Port("eth2"))
+}
@@ -58,6 +58,17 @@ manage_etc_hosts: localhost
 `
 )
 
+// Capabilities returns the optional operations supported by the driver.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityStartStop,
+		drivers.CapabilityRestart,
+		drivers.CapabilityKill,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+	}
+}
+
 // GetCreateFlags registers the flags this driver adds to
 // "docker hosts create"
 func (d *Driver) GetCreateFlags() []mcnflag.Flag {
@@ -73,9 +84,10 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "exoscale API key",
 		},
 		mcnflag.StringFlag{
-			EnvVar: "EXOSCALE_API_SECRET",
-			Name:   "exoscale-api-secret-key",
-			Usage:  "exoscale API secret key",
+			EnvVar:    "EXOSCALE_API_SECRET",
+			Name:      "exoscale-api-secret-key",
+			Usage:     "exoscale API secret key",
+			Sensitive: true,
 		},
 		mcnflag.StringFlag{
 			EnvVar: "EXOSCALE_INSTANCE_PROFILE",
@@ -205,7 +217,10 @@ func (d *Driver) UnmarshalJSON(data []byte) error {
 	*d = Driver(target)
 
 	// Make sure to reload values that are subject to change from envvars and os.Args.
-	driverOpts := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	driverOpts, err := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	if err != nil {
+		return err
+	}
 	if _, ok := driverOpts.Values["exoscale-api-key"]; ok {
 		d.APIKey = driverOpts.String("exoscale-api-key")
 	}
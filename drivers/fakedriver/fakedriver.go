@@ -2,6 +2,7 @@ package fakedriver
 
 import (
 	"fmt"
+	"net"
 
 	"github.com/rancher/machine/libmachine/drivers"
 	"github.com/rancher/machine/libmachine/mcnflag"
@@ -13,6 +14,17 @@ type Driver struct {
 	MockState state.State
 	MockIP    string
 	MockName  string
+
+	MockCapabilities  []drivers.Capability
+	MockArchitectures []string
+}
+
+func (d *Driver) Capabilities() []drivers.Capability {
+	return d.MockCapabilities
+}
+
+func (d *Driver) SupportedArchitectures() []string {
+	return d.MockArchitectures
 }
 
 func (d *Driver) GetCreateFlags() []mcnflag.Flag {
@@ -36,7 +48,7 @@ func (d *Driver) GetURL() (string, error) {
 	if ip == "" {
 		return "", nil
 	}
-	return fmt.Sprintf("tcp://%s:2376", ip), nil
+	return fmt.Sprintf("tcp://%s", net.JoinHostPort(ip, "2376")), nil
 }
 
 func (d *Driver) GetMachineName() string {
@@ -107,3 +119,76 @@ func (d *Driver) Remove() error {
 func (d *Driver) Upgrade() error {
 	return nil
 }
+
+// NetworkDriver is a fake driver that reports multiple addresses.
+type NetworkDriver struct {
+	*Driver
+	MockIPs []drivers.NetworkAddress
+}
+
+func (d *NetworkDriver) GetIPs() ([]drivers.NetworkAddress, error) {
+	if d.MockState != state.Running {
+		return nil, drivers.ErrHostIsNotRunning
+	}
+	return d.MockIPs, nil
+}
+
+// TaggedDriver is a fake driver that tags the machine.
+type TaggedDriver struct {
+	*Driver
+	MockTags map[string]string
+}
+
+func (d *TaggedDriver) GetTags() (map[string]string, error) {
+	return d.MockTags, nil
+}
+
+// PricedDriver is a fake driver that estimates the cost of the machine.
+type PricedDriver struct {
+	*Driver
+	MockCost drivers.CostEstimate
+}
+
+func (d *PricedDriver) EstimateCost() (*drivers.CostEstimate, error) {
+	return &d.MockCost, nil
+}
+
+// SnapshotDriver is a fake driver that snapshots the machine.
+type SnapshotDriver struct {
+	*Driver
+	MockSnapshots []drivers.Snapshot
+	MockRestored  string
+}
+
+func (d *SnapshotDriver) CreateSnapshot(name string) (drivers.Snapshot, error) {
+	snapshot := drivers.Snapshot{ID: fmt.Sprintf("snap-%d", len(d.MockSnapshots)+1), Name: name}
+	d.MockSnapshots = append(d.MockSnapshots, snapshot)
+	return snapshot, nil
+}
+
+func (d *SnapshotDriver) ListSnapshots() ([]drivers.Snapshot, error) {
+	return d.MockSnapshots, nil
+}
+
+func (d *SnapshotDriver) RestoreSnapshot(id string) error {
+	for _, snapshot := range d.MockSnapshots {
+		if snapshot.ID == id {
+			d.MockRestored = id
+			return nil
+		}
+	}
+	return fmt.Errorf("snapshot %s not found", id)
+}
+
+// ResizableDriver is a fake driver that records the size it is resized to.
+type ResizableDriver struct {
+	*Driver
+	MockSpec drivers.ResizeSpec
+}
+
+func (d *ResizableDriver) Resize(spec drivers.ResizeSpec) error {
+	return drivers.WhileStopped(d, func() error {
+		d.MockSpec = spec
+		return nil
+	})
+}
@@ -19,14 +19,29 @@ import (
 
 type Driver struct {
 	*drivers.BaseDriver
-	EnginePort int
-	SSHKey     string
+	EnginePort    int
+	SSHKey        string
+	SSHBastionKey string
+	// The SSH password is only used until the provisioner installs the key,
+	// and never stored.
+	SSHPassword       string `json:"-"`
+	SSHPasswordPrompt bool   `json:"-"`
 }
 
 const (
 	defaultTimeout = 15 * time.Second
 )
 
+// Capabilities returns the optional operations supported by the driver.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityRestart,
+		drivers.CapabilityCustomSSHPort,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+	}
+}
+
 // GetCreateFlags registers the flags this driver adds to
 // "docker hosts create"
 func (d *Driver) GetCreateFlags() []mcnflag.Flag {
@@ -54,12 +69,44 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Value:  "",
 			EnvVar: "GENERIC_SSH_KEY",
 		},
+		mcnflag.StringFlag{
+			Name:      "generic-ssh-password",
+			Usage:     "SSH password, for machines the SSH key cannot be installed in beforehand (the key is generated and installed while provisioning)",
+			EnvVar:    "GENERIC_SSH_PASSWORD",
+			Sensitive: true,
+		},
+		mcnflag.BoolFlag{
+			Name:  "generic-ssh-password-prompt",
+			Usage: "Prompt for the SSH password, like --generic-ssh-password",
+		},
 		mcnflag.IntFlag{
 			Name:   "generic-ssh-port",
 			Usage:  "SSH port",
 			Value:  drivers.DefaultSSHPort,
 			EnvVar: "GENERIC_SSH_PORT",
 		},
+		mcnflag.StringFlag{
+			Name:   "generic-ssh-bastion-host",
+			Usage:  "SSH bastion to reach the machine through, if it is not reachable directly",
+			EnvVar: "GENERIC_SSH_BASTION_HOST",
+		},
+		mcnflag.IntFlag{
+			Name:   "generic-ssh-bastion-port",
+			Usage:  "SSH port of the bastion",
+			Value:  drivers.DefaultSSHPort,
+			EnvVar: "GENERIC_SSH_BASTION_PORT",
+		},
+		mcnflag.StringFlag{
+			Name:   "generic-ssh-bastion-user",
+			Usage:  "SSH user of the bastion",
+			Value:  drivers.DefaultSSHUser,
+			EnvVar: "GENERIC_SSH_BASTION_USER",
+		},
+		mcnflag.StringFlag{
+			Name:   "generic-ssh-bastion-key",
+			Usage:  "SSH private key path of the bastion (if not provided, the ssh-agent is used with the external client)",
+			EnvVar: "GENERIC_SSH_BASTION_KEY",
+		},
 	}
 }
 
@@ -91,18 +138,33 @@ func (d *Driver) GetSSHKeyPath() string {
 	return d.SSHKeyPath
 }
 
+// GetSSHPassword returns the password authentication of the machine, until
+// its key is installed.
+func (d *Driver) GetSSHPassword() (drivers.SSHPassword, error) {
+	return drivers.SSHPassword{Password: d.SSHPassword, Prompt: d.SSHPasswordPrompt}, nil
+}
+
 func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.EnginePort = flags.Int("generic-engine-port")
 	d.IPAddress = flags.String("generic-ip-address")
 	d.SSHUser = flags.String("generic-ssh-user")
 	d.SSHKey = flags.String("generic-ssh-key")
+	d.SSHPassword = flags.String("generic-ssh-password")
+	d.SSHPasswordPrompt = flags.Bool("generic-ssh-password-prompt")
 	d.SSHPort = flags.Int("generic-ssh-port")
+	d.SSHBastionHost = flags.String("generic-ssh-bastion-host")
+	d.SSHBastionPort = flags.Int("generic-ssh-bastion-port")
+	d.SSHBastionUser = flags.String("generic-ssh-bastion-user")
+	d.SSHBastionKey = flags.String("generic-ssh-bastion-key")
 
 	if d.IPAddress == "" {
 		return errors.New("generic driver requires the --generic-ip-address option")
 	}
 
-	return nil
+	if err := d.SetSSHJumpHostsFromFlags(flags); err != nil {
+		return err
+	}
+	return d.SetSSHRetryPolicyFromFlags(flags)
 }
 
 func (d *Driver) PreCreateCheck() error {
@@ -114,11 +176,27 @@ func (d *Driver) PreCreateCheck() error {
 		// TODO: validate the key is a valid key
 	}
 
+	if d.SSHBastionKey != "" {
+		if d.SSHBastionHost == "" {
+			return errors.New("--generic-ssh-bastion-key requires the --generic-ssh-bastion-host option")
+		}
+		if _, err := os.Stat(d.SSHBastionKey); os.IsNotExist(err) {
+			return fmt.Errorf("SSH bastion key does not exist: %q", d.SSHBastionKey)
+		}
+	}
+
 	return nil
 }
 
 func (d *Driver) Create() error {
-	if d.SSHKey == "" {
+	if d.SSHKey == "" && (d.SSHPassword != "" || d.SSHPasswordPrompt) {
+		log.Info("Generating SSH key...")
+
+		d.SSHKeyPath = d.ResolveStorePath("id_rsa")
+		if err := d.GenerateSSHKey(d.SSHKeyPath); err != nil {
+			return err
+		}
+	} else if d.SSHKey == "" {
 		log.Info("No SSH key specified. Assuming an existing key at the default location.")
 	} else {
 		log.Info("Importing SSH key...")
@@ -133,6 +211,15 @@ func (d *Driver) Create() error {
 		}
 	}
 
+	if d.SSHBastionKey != "" {
+		log.Info("Importing SSH bastion key...")
+
+		d.SSHBastionKeyPath = d.ResolveStorePath("bastion-" + path.Base(d.SSHBastionKey))
+		if err := copySSHKey(d.SSHBastionKey, d.SSHBastionKeyPath); err != nil {
+			return err
+		}
+	}
+
 	log.Debugf("IP: %s", d.IPAddress)
 
 	return nil
@@ -154,10 +241,21 @@ func (d *Driver) GetURL() (string, error) {
 func (d *Driver) GetState() (state.State, error) {
 	address := net.JoinHostPort(d.IPAddress, strconv.Itoa(d.SSHPort))
 
-	_, err := net.DialTimeout("tcp", address, defaultTimeout)
+	bastion, err := d.GetSSHBastion()
+	if err != nil {
+		return state.Error, err
+	}
+
+	var conn net.Conn
+	if bastion != nil {
+		conn, err = bastion.Dial("tcp", address)
+	} else {
+		conn, err = net.DialTimeout("tcp", address, defaultTimeout)
+	}
 	if err != nil {
 		return state.Stopped, nil
 	}
+	conn.Close()
 
 	return state.Running, nil
 }
@@ -1,6 +1,7 @@
 package generic
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/rancher/machine/libmachine/drivers"
@@ -24,3 +25,67 @@ func TestSetConfigFromFlags(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Empty(t, checkFlags.InvalidFlags)
 }
+
+func TestSetConfigFromBastionFlags(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"generic-ip-address":       "10.0.0.4",
+			"generic-ssh-bastion-host": "bastion.example.com",
+			"generic-ssh-bastion-port": 2222,
+			"generic-ssh-bastion-user": "jump",
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	err := driver.SetConfigFromFlags(checkFlags)
+	assert.NoError(t, err)
+	assert.Empty(t, checkFlags.InvalidFlags)
+
+	bastion, err := drivers.GetSSHBastion(driver)
+	assert.NoError(t, err)
+	assert.Equal(t, "jump", bastion.User)
+	assert.Equal(t, "bastion.example.com", bastion.Host)
+	assert.Equal(t, 2222, bastion.Port)
+	assert.Empty(t, bastion.Auth.Keys)
+}
+
+func TestBastionKeyRequiresHost(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"generic-ip-address":      "10.0.0.4",
+			"generic-ssh-bastion-key": "path",
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	assert.NoError(t, driver.SetConfigFromFlags(checkFlags))
+	assert.EqualError(t, driver.PreCreateCheck(), "--generic-ssh-bastion-key requires the --generic-ssh-bastion-host option")
+}
+
+func TestSetConfigFromPasswordFlags(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"generic-ip-address":   "10.0.0.5",
+			"generic-ssh-password": "admin",
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	assert.NoError(t, driver.SetConfigFromFlags(checkFlags))
+	assert.Empty(t, checkFlags.InvalidFlags)
+
+	password, err := drivers.GetSSHPassword(driver)
+	assert.NoError(t, err)
+	assert.Equal(t, drivers.SSHPassword{Password: "admin"}, password)
+
+	// The password is not stored with the machine.
+	data, err := json.Marshal(driver)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "admin")
+}
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/rancher/machine/drivers/driverutil"
+	"github.com/rancher/machine/libmachine/drivers"
 	"github.com/rancher/machine/libmachine/log"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
@@ -31,7 +32,6 @@ type ComputeUtil struct {
 	address           string
 	network           string
 	subnetwork        string
-	preemptible       bool
 	useInternalIP     bool
 	useInternalIPOnly bool
 	service           *raw.Service
@@ -87,7 +87,6 @@ func newComputeUtil(driver *Driver) (*ComputeUtil, error) {
 		address:           driver.Address,
 		network:           driver.Network,
 		subnetwork:        driver.Subnetwork,
-		preemptible:       driver.Preemptible,
 		useInternalIP:     driver.UseInternalIP,
 		useInternalIPOnly: driver.UseInternalIPOnly,
 		service:           service,
@@ -129,6 +128,85 @@ func (c *ComputeUtil) deleteDisk() error {
 	return c.waitForRegionalOp(op.Name)
 }
 
+// retryOptions retry the API calls rate limited while many machines are
+// created at once.
+var retryOptions = drivers.DefaultRetryOptions.WithRetryable(isRetryable)
+
+// classifyError gives err the code of its API error.
+func classifyError(err error) error {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	for _, item := range apiErr.Errors {
+		if item.Reason == "quotaExceeded" || item.Reason == "QUOTA_EXCEEDED" {
+			return drivers.NewError(drivers.ErrorCodeQuotaExceeded, err)
+		}
+	}
+	if isRetryable(err) {
+		return drivers.NewError(drivers.ErrorCodeTransientNetwork, err)
+	}
+	switch apiErr.Code {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return drivers.NewError(drivers.ErrorCodeAuthFailure, err)
+	case http.StatusNotFound:
+		return drivers.NewError(drivers.ErrorCodeNotFound, err)
+	}
+	return err
+}
+
+// isRetryable tells the rate limit and backend errors, which the API asks to
+// retry with exponential backoff, from the others.
+func isRetryable(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.Code {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusForbidden:
+		for _, item := range apiErr.Errors {
+			if item.Reason == "rateLimitExceeded" || item.Reason == "userRateLimitExceeded" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// machineTypeArchitecture returns the CPU architecture of the machine type,
+// ARM64 or X86_64.
+func (c *ComputeUtil) machineTypeArchitecture(machineType string) (string, error) {
+	t, err := c.service.MachineTypes.Get(c.project, c.zone, machineType).Do()
+	if err != nil {
+		return "", err
+	}
+	return t.Architecture, nil
+}
+
+// imageArchitecture returns the CPU architecture of the image, given as
+// project/global/images/name or project/global/images/family/name. It is
+// empty for images that do not declare one.
+func (c *ComputeUtil) imageArchitecture(image string) (string, error) {
+	parts := strings.Split(image, "/")
+	if len(parts) < 4 || parts[1] != "global" || parts[2] != "images" {
+		return "", fmt.Errorf("invalid image %q, expected project/global/images/name", image)
+	}
+
+	var i *raw.Image
+	var err error
+	if parts[3] == "family" && len(parts) == 5 {
+		i, err = c.service.Images.GetFromFamily(parts[0], parts[4]).Do()
+	} else {
+		i, err = c.service.Images.Get(parts[0], parts[3]).Do()
+	}
+	if err != nil {
+		return "", err
+	}
+	return i.Architecture, nil
+}
+
 // staticAddress returns the external static IP address.
 func (c *ComputeUtil) staticAddress() (string, error) {
 	// is the address a name?
@@ -281,15 +359,23 @@ func (c *ComputeUtil) createInstance(d *Driver) error {
 		Tags: &raw.Tags{
 			Items: parseTags(d),
 		},
+		// GCE tags are network tags, the machine tags are labels.
+		Labels: d.MachineTags,
 		ServiceAccounts: []*raw.ServiceAccount{
 			{
 				Email:  "default",
 				Scopes: strings.Split(d.Scopes, ","),
 			},
 		},
-		Scheduling: &raw.Scheduling{
-			Preemptible: c.preemptible,
-		},
+		Scheduling:             scheduling(d),
+		ShieldedInstanceConfig: shieldedInstanceConfig(d),
+		MinCpuPlatform:         d.MinCPUPlatform,
+	}
+	if d.AcceleratorType != "" {
+		instance.GuestAccelerators = []*raw.AcceleratorConfig{{
+			AcceleratorType:  c.zoneURL + "/acceleratorTypes/" + d.AcceleratorType,
+			AcceleratorCount: int64(d.AcceleratorCount),
+		}}
 	}
 
 	if strings.Contains(c.subnetwork, "/subnetworks/") {
@@ -322,14 +408,19 @@ func (c *ComputeUtil) createInstance(d *Driver) error {
 			// The maximum supported disk size is 1000GB, the cast should be fine.
 			DiskSizeGb: int64(d.DiskSize),
 			DiskType:   c.diskType(),
+			Labels:     d.MachineTags,
 		}
 	} else {
 		instance.Disks[0].Source = c.zoneURL + "/disks/" + c.instanceName + "-disk"
 	}
-	op, err := c.service.Instances.Insert(c.project, c.zone, instance).Do()
+	var op *raw.Operation
+	err = drivers.Retry(retryOptions, "Inserting instance", func() (err error) {
+		op, err = c.service.Instances.Insert(c.project, c.zone, instance).Do()
+		return err
+	})
 
 	if err != nil {
-		return err
+		return classifyError(err)
 	}
 
 	log.Infof("Waiting for Instance")
@@ -345,6 +436,49 @@ func (c *ComputeUtil) createInstance(d *Driver) error {
 	return c.uploadSSHKeyAndUserdata(instance, d.GetSSHKeyPath(), d.Userdata)
 }
 
+// scheduling returns the scheduling options of a preemptible, Spot or
+// standard instance.
+func scheduling(d *Driver) *raw.Scheduling {
+	if d.ProvisioningModel != provisioningModelSpot {
+		s := &raw.Scheduling{
+			Preemptible: d.Preemptible,
+		}
+		// GCE cannot live migrate instances with GPUs.
+		if d.AcceleratorType != "" {
+			s.OnHostMaintenance = "TERMINATE"
+		}
+		return s
+	}
+
+	terminationAction := d.InstanceTerminationAction
+	if terminationAction == "" {
+		terminationAction = "STOP"
+	}
+	// Spot instances can neither restart nor be live migrated.
+	return &raw.Scheduling{
+		ProvisioningModel:         provisioningModelSpot,
+		InstanceTerminationAction: terminationAction,
+		AutomaticRestart:          googleapi.Bool(false),
+		OnHostMaintenance:         "TERMINATE",
+	}
+}
+
+// shieldedInstanceConfig returns the Shielded VM options of the instance, or
+// nil to leave the defaults of the image when none is set.
+func shieldedInstanceConfig(d *Driver) *raw.ShieldedInstanceConfig {
+	if !d.SecureBoot && !d.VTPM && !d.IntegrityMonitoring {
+		return nil
+	}
+	// The options left unset are sent as disabled rather than left to
+	// their default.
+	return &raw.ShieldedInstanceConfig{
+		EnableSecureBoot:          d.SecureBoot,
+		EnableVtpm:                d.VTPM,
+		EnableIntegrityMonitoring: d.IntegrityMonitoring,
+		ForceSendFields:           []string{"EnableSecureBoot", "EnableVtpm", "EnableIntegrityMonitoring"},
+	}
+}
+
 // configureInstance configures an existing instance for use with Docker Machine.
 func (c *ComputeUtil) configureInstance(d *Driver) error {
 	log.Infof("Configuring instance")
@@ -459,10 +593,27 @@ func (c *ComputeUtil) startInstance() error {
 	return c.waitForRegionalOp(op.Name)
 }
 
+// setMachineType changes the machine type of the stopped instance.
+func (c *ComputeUtil) setMachineType(machineType string) error {
+	op, err := c.service.Instances.SetMachineType(c.project, c.zone, c.instanceName, &raw.InstancesSetMachineTypeRequest{
+		MachineType: c.zoneURL + "/machineTypes/" + machineType,
+	}).Do()
+	if err != nil {
+		return classifyError(err)
+	}
+
+	log.Infof("Waiting for machine type to change.")
+	return c.waitForRegionalOp(op.Name)
+}
+
 // waitForOp waits for the operation to finish.
 func (c *ComputeUtil) waitForOp(opGetter func() (*raw.Operation, error)) error {
 	for {
-		op, err := opGetter()
+		var op *raw.Operation
+		err := drivers.Retry(retryOptions, "Getting operation", func() (err error) {
+			op, err = opGetter()
+			return err
+		})
 		if err != nil {
 			return err
 		}
@@ -1,10 +1,13 @@
 package google
 
 import (
+	"errors"
 	"testing"
 
+	"github.com/rancher/machine/libmachine/drivers"
 	"github.com/stretchr/testify/assert"
 	raw "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
 )
 
 func TestDefaultTag(t *testing.T) {
@@ -70,3 +73,63 @@ func TestMissingOpenedPorts(t *testing.T) {
 		assert.Equal(t, test.expectedMissing, missingPorts, test.description)
 	}
 }
+
+func TestScheduling(t *testing.T) {
+	assert.Equal(t, &raw.Scheduling{Preemptible: true}, scheduling(&Driver{ProvisioningModel: "STANDARD", Preemptible: true}))
+
+	spot := scheduling(&Driver{ProvisioningModel: "SPOT"})
+	assert.Equal(t, "SPOT", spot.ProvisioningModel)
+	assert.Equal(t, "STOP", spot.InstanceTerminationAction)
+	assert.Equal(t, "TERMINATE", spot.OnHostMaintenance)
+	assert.False(t, *spot.AutomaticRestart)
+
+	spot = scheduling(&Driver{ProvisioningModel: "SPOT", InstanceTerminationAction: "DELETE"})
+	assert.Equal(t, "DELETE", spot.InstanceTerminationAction)
+
+	gpu := scheduling(&Driver{ProvisioningModel: "STANDARD", AcceleratorType: "nvidia-tesla-t4", AcceleratorCount: 1})
+	assert.Equal(t, "TERMINATE", gpu.OnHostMaintenance)
+}
+
+func TestShieldedInstanceConfig(t *testing.T) {
+	assert.Nil(t, shieldedInstanceConfig(&Driver{}))
+
+	config := shieldedInstanceConfig(&Driver{SecureBoot: true})
+	assert.True(t, config.EnableSecureBoot)
+	assert.False(t, config.EnableVtpm)
+	assert.False(t, config.EnableIntegrityMonitoring)
+	assert.Len(t, config.ForceSendFields, 3)
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, isRetryable(&googleapi.Error{Code: 429}))
+	assert.True(t, isRetryable(&googleapi.Error{Code: 503}))
+	assert.True(t, isRetryable(&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}))
+	assert.False(t, isRetryable(&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "forbidden"}}}))
+	assert.False(t, isRetryable(&googleapi.Error{Code: 404}))
+	assert.False(t, isRetryable(errors.New("connection refused")))
+}
+
+func TestClassifyError(t *testing.T) {
+	assert.Equal(t, drivers.ErrorCodeQuotaExceeded, drivers.GetErrorCode(classifyError(&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "quotaExceeded"}}})))
+	assert.Equal(t, drivers.ErrorCodeAuthFailure, drivers.GetErrorCode(classifyError(&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "forbidden"}}})))
+	assert.Equal(t, drivers.ErrorCodeNotFound, drivers.GetErrorCode(classifyError(&googleapi.Error{Code: 404})))
+	assert.True(t, drivers.IsRetryable(classifyError(&googleapi.Error{Code: 503})))
+	assert.Equal(t, drivers.ErrorCode(""), drivers.GetErrorCode(classifyError(errors.New("connection refused"))))
+}
+
+func TestCheckCPUQuota(t *testing.T) {
+	region := &raw.Region{Name: "us-central1", Quotas: []*raw.Quota{
+		{Metric: "INSTANCES", Limit: 100, Usage: 99},
+		{Metric: "CPUS", Limit: 24, Usage: 20},
+	}}
+
+	assert.NoError(t, checkCPUQuota(region, &raw.MachineType{Name: "n1-standard-4", GuestCpus: 4}))
+
+	err := checkCPUQuota(region, &raw.MachineType{Name: "n1-standard-8", GuestCpus: 8})
+	assert.EqualError(t, err, "machine type n1-standard-8 has 8 CPUs, region us-central1 has 4 CPUs left of its quota of 24")
+	assert.Equal(t, drivers.ErrorCodeQuotaExceeded, drivers.GetErrorCode(err))
+}
+
+func TestFormatPorts(t *testing.T) {
+	assert.Equal(t, "2376/tcp, 53/udp, 80/tcp", formatPorts(map[string][]string{"tcp": {"80", "2376"}, "udp": {"53"}}))
+}
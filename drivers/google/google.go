@@ -37,6 +37,18 @@ type Driver struct {
 	UseExisting       bool
 	OpenPorts         []string
 	Userdata          string
+
+	ProvisioningModel         string
+	InstanceTerminationAction string
+	SecureBoot                bool
+	VTPM                      bool
+	IntegrityMonitoring       bool
+	CustomCPUs                int
+	CustomMemory              int
+	CustomMachineSeries       string
+	MinCPUPlatform            string
+	AcceleratorType           string
+	AcceleratorCount          int
 }
 
 const (
@@ -49,8 +61,32 @@ const (
 	defaultDiskSize    = 10
 	defaultNetwork     = "default"
 	defaultSubnetwork  = ""
+
+	provisioningModelStandard = "STANDARD"
+	provisioningModelSpot     = "SPOT"
 )
 
+// defaultARM64ImageName replaces the default image on Arm machine types.
+const defaultARM64ImageName = "ubuntu-os-cloud/global/images/family/ubuntu-2204-lts-arm64"
+
+// Capabilities returns the optional operations supported by the driver.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityStartStop,
+		drivers.CapabilityRestart,
+		drivers.CapabilityKill,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+		drivers.CapabilityResize,
+	}
+}
+
+// SupportedArchitectures returns the architectures of the machines the driver
+// creates, picked from the machine type.
+func (d *Driver) SupportedArchitectures() []string {
+	return []string{"amd64", "arm64"}
+}
+
 // GetCreateFlags registers the flags this driver adds to
 // "docker hosts create"
 func (d *Driver) GetCreateFlags() []mcnflag.Flag {
@@ -80,9 +116,10 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			EnvVar: "GOOGLE_USERNAME",
 		},
 		mcnflag.StringFlag{
-			Name:   "google-auth-encoded-json",
-			Usage:  "Base64 encoded GCE auth json",
-			EnvVar: "GOOGLE_APPLICATION_CREDENTIALS_ENCODED_JSON",
+			Name:      "google-auth-encoded-json",
+			Usage:     "Base64 encoded GCE auth json",
+			EnvVar:    "GOOGLE_APPLICATION_CREDENTIALS_ENCODED_JSON",
+			Sensitive: true,
 		},
 		mcnflag.StringFlag{
 			Name:   "google-project",
@@ -160,6 +197,63 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			EnvVar: "GOOGLE_USERDATA",
 			Value:  "",
 		},
+		mcnflag.StringFlag{
+			Name:   "google-provisioning-model",
+			Usage:  "GCE Instance provisioning model: STANDARD or SPOT",
+			Value:  provisioningModelStandard,
+			EnvVar: "GOOGLE_PROVISIONING_MODEL",
+		},
+		mcnflag.StringFlag{
+			Name:   "google-instance-termination-action",
+			Usage:  "What GCE does to the Spot instance when preempting it: STOP or DELETE (default STOP)",
+			EnvVar: "GOOGLE_INSTANCE_TERMINATION_ACTION",
+		},
+		mcnflag.BoolFlag{
+			Name:   "google-shielded-secure-boot",
+			Usage:  "Enable Secure Boot on the Shielded VM instance (the Shielded VM options not enabled are disabled once one is)",
+			EnvVar: "GOOGLE_SHIELDED_SECURE_BOOT",
+		},
+		mcnflag.BoolFlag{
+			Name:   "google-shielded-vtpm",
+			Usage:  "Enable the virtual TPM on the Shielded VM instance (the Shielded VM options not enabled are disabled once one is)",
+			EnvVar: "GOOGLE_SHIELDED_VTPM",
+		},
+		mcnflag.BoolFlag{
+			Name:   "google-shielded-integrity-monitoring",
+			Usage:  "Enable integrity monitoring on the Shielded VM instance (the Shielded VM options not enabled are disabled once one is)",
+			EnvVar: "GOOGLE_SHIELDED_INTEGRITY_MONITORING",
+		},
+		mcnflag.IntFlag{
+			Name:   "google-custom-cpus",
+			Usage:  "Number of vCPUs of a custom machine type, overriding --google-machine-type",
+			EnvVar: "GOOGLE_CUSTOM_CPUS",
+		},
+		mcnflag.IntFlag{
+			Name:   "google-custom-memory",
+			Usage:  "Memory (in MB, a multiple of 256) of a custom machine type, overriding --google-machine-type",
+			EnvVar: "GOOGLE_CUSTOM_MEMORY",
+		},
+		mcnflag.StringFlag{
+			Name:   "google-custom-machine-series",
+			Usage:  "Machine series of a custom machine type, e.g. n2 (default n1)",
+			EnvVar: "GOOGLE_CUSTOM_MACHINE_SERIES",
+		},
+		mcnflag.StringFlag{
+			Name:   "google-min-cpu-platform",
+			Usage:  "Minimum CPU platform of the GCE instance, e.g. \"Intel Cascade Lake\"",
+			EnvVar: "GOOGLE_MIN_CPU_PLATFORM",
+		},
+		mcnflag.StringFlag{
+			Name:   "google-accelerator-type",
+			Usage:  "Type of the GPUs attached to the GCE instance, e.g. nvidia-tesla-t4",
+			EnvVar: "GOOGLE_ACCELERATOR_TYPE",
+		},
+		mcnflag.IntFlag{
+			Name:   "google-accelerator-count",
+			Usage:  "Number of GPUs of --google-accelerator-type attached to the GCE instance",
+			Value:  1,
+			EnvVar: "GOOGLE_ACCELERATOR_COUNT",
+		},
 	}
 }
 
@@ -174,6 +268,8 @@ func NewDriver(machineName string, storePath string) *Driver {
 		Network:      defaultNetwork,
 		Subnetwork:   defaultSubnetwork,
 		Scopes:       defaultScopes,
+
+		ProvisioningModel: provisioningModelStandard,
 		BaseDriver: &drivers.BaseDriver{
 			SSHUser:     defaultUser,
 			MachineName: machineName,
@@ -182,6 +278,11 @@ func NewDriver(machineName string, storePath string) *Driver {
 	}
 }
 
+// GetTags returns the labels of the instance and of its boot disk.
+func (d *Driver) GetTags() (map[string]string, error) {
+	return d.MachineTags, nil
+}
+
 // GetSSHHostname returns hostname for use with ssh
 func (d *Driver) GetSSHHostname() (string, error) {
 	return d.GetIP()
@@ -219,7 +320,10 @@ func (d *Driver) UnmarshalJSON(data []byte) error {
 	*d = Driver(target)
 
 	// Make sure to reload values that are subject to change from envvars and os.Args.
-	driverOpts := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	driverOpts, err := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	if err != nil {
+		return err
+	}
 	if _, ok := driverOpts.Values["google-auth-encoded-json"]; ok {
 		d.Auth = driverOpts.String("google-auth-encoded-json")
 	}
@@ -252,15 +356,96 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 		d.Scopes = flags.String("google-scopes")
 		d.Tags = flags.String("google-tags")
 		d.OpenPorts = flags.StringSlice("google-open-port")
+
+		if provisioningModel := flags.String("google-provisioning-model"); provisioningModel != "" {
+			d.ProvisioningModel = strings.ToUpper(provisioningModel)
+		}
+		d.InstanceTerminationAction = strings.ToUpper(flags.String("google-instance-termination-action"))
+		d.SecureBoot = flags.Bool("google-shielded-secure-boot")
+		d.VTPM = flags.Bool("google-shielded-vtpm")
+		d.IntegrityMonitoring = flags.Bool("google-shielded-integrity-monitoring")
+		d.CustomCPUs = flags.Int("google-custom-cpus")
+		d.CustomMemory = flags.Int("google-custom-memory")
+		d.CustomMachineSeries = flags.String("google-custom-machine-series")
+		d.MinCPUPlatform = flags.String("google-min-cpu-platform")
+		d.AcceleratorType = flags.String("google-accelerator-type")
+		if d.AcceleratorType != "" {
+			d.AcceleratorCount = flags.Int("google-accelerator-count")
+		}
+		if err := d.checkInstanceOptions(); err != nil {
+			return err
+		}
+		if d.CustomCPUs != 0 {
+			d.MachineType = customMachineType(d.CustomMachineSeries, d.CustomCPUs, d.CustomMemory)
+		}
 	}
 	d.SSHUser = flags.String("google-username")
 	d.SSHPort = 22
 	d.Userdata = flags.String("google-userdata")
 	d.SetSwarmConfigFromFlags(flags)
+	if err := d.SetTagsFromFlags(flags); err != nil {
+		return err
+	}
+	if err := d.SetUserDataFromFlags(flags); err != nil {
+		return err
+	}
+	if err := d.SetSSHJumpHostsFromFlags(flags); err != nil {
+		return err
+	}
+	if err := d.SetSSHRetryPolicyFromFlags(flags); err != nil {
+		return err
+	}
+
+	return nil
+}
 
+// checkInstanceOptions validates the provisioning model and custom machine
+// type options.
+func (d *Driver) checkInstanceOptions() error {
+	switch d.ProvisioningModel {
+	case provisioningModelStandard:
+		if d.InstanceTerminationAction != "" {
+			return errors.New("--google-instance-termination-action requires --google-provisioning-model=SPOT")
+		}
+	case provisioningModelSpot:
+		if d.Preemptible {
+			return errors.New("--google-preemptible and --google-provisioning-model=SPOT cannot be used together")
+		}
+		switch d.InstanceTerminationAction {
+		case "", "STOP", "DELETE":
+		default:
+			return fmt.Errorf("--google-instance-termination-action must be either STOP or DELETE, not %q", d.InstanceTerminationAction)
+		}
+	default:
+		return fmt.Errorf("--google-provisioning-model must be either STANDARD or SPOT, not %q", d.ProvisioningModel)
+	}
+
+	if (d.CustomCPUs == 0) != (d.CustomMemory == 0) {
+		return errors.New("--google-custom-cpus and --google-custom-memory must be used together")
+	}
+	if d.CustomCPUs < 0 || d.CustomMemory < 0 || d.CustomMemory%256 != 0 {
+		return fmt.Errorf("invalid custom machine type: %d vCPUs, %d MB of memory (a multiple of 256)", d.CustomCPUs, d.CustomMemory)
+	}
+	if d.CustomMachineSeries != "" && d.CustomCPUs == 0 {
+		return errors.New("--google-custom-machine-series requires --google-custom-cpus and --google-custom-memory")
+	}
+	if d.AcceleratorType != "" && d.AcceleratorCount <= 0 {
+		return fmt.Errorf("--google-accelerator-count must be positive, not %d", d.AcceleratorCount)
+	}
 	return nil
 }
 
+// customMachineType returns the name of the custom machine type, e.g.
+// n2-custom-4-8192, of the series.
+func customMachineType(series string, cpus, memory int) string {
+	name := fmt.Sprintf("custom-%d-%d", cpus, memory)
+	if series == "" || series == "n1" {
+		// N1 custom machine types have no series prefix.
+		return name
+	}
+	return series + "-" + name
+}
+
 // PreCreateCheck is called to enforce pre-creation steps
 func (d *Driver) PreCreateCheck() error {
 	c, err := newComputeUtil(d)
@@ -291,6 +476,18 @@ func (d *Driver) PreCreateCheck() error {
 		}
 	}
 
+	if !d.UseExisting {
+		if err := d.checkArchitecture(c); err != nil {
+			return err
+		}
+		if d.AcceleratorType != "" {
+			log.Infof("Check that accelerator type %s exists in zone %s", d.AcceleratorType, d.Zone)
+			if _, err := c.service.AcceleratorTypes.Get(d.Project, d.Zone, d.AcceleratorType).Do(); err != nil {
+				return fmt.Errorf("Accelerator type %q not found in zone %q. %v", d.AcceleratorType, d.Zone, err)
+			}
+		}
+	}
+
 	if d.Userdata != "" {
 		file, err := os.ReadFile(d.Userdata)
 		if err != nil {
@@ -302,6 +499,36 @@ func (d *Driver) PreCreateCheck() error {
 	return nil
 }
 
+// checkArchitecture picks the Arm image on Arm machine types when the image is
+// left to its default, and checks the image can boot on the machine type.
+func (d *Driver) checkArchitecture(c *ComputeUtil) error {
+	log.Infof("Check the architecture of machine type %s", d.MachineType)
+
+	architecture, err := c.machineTypeArchitecture(d.MachineType)
+	if err != nil {
+		return fmt.Errorf("Machine type %q not found in zone %q. %v", d.MachineType, d.Zone, err)
+	}
+	d.MachineImage = imageForArchitecture(d.MachineImage, architecture)
+
+	imageArchitecture, err := c.imageArchitecture(d.MachineImage)
+	if err != nil {
+		return fmt.Errorf("Image %q not found. %v", d.MachineImage, err)
+	}
+	if architecture != "" && imageArchitecture != "" && architecture != imageArchitecture {
+		return fmt.Errorf("image %s is %s, but machine type %s is %s", d.MachineImage, imageArchitecture, d.MachineType, architecture)
+	}
+	return nil
+}
+
+// imageForArchitecture returns the image of a machine type of the
+// architecture, the Arm image instead of the default one on Arm.
+func imageForArchitecture(image, architecture string) string {
+	if architecture == "ARM64" && image == defaultImageName {
+		return defaultARM64ImageName
+	}
+	return image
+}
+
 // Create creates a GCE VM instance acting as a docker host.
 func (d *Driver) Create() error {
 	log.Infof("Generating SSH Key")
@@ -310,6 +537,14 @@ func (d *Driver) Create() error {
 		return err
 	}
 
+	if d.Userdata == "" {
+		userdata, err := d.MachineUserData()
+		if err != nil {
+			return err
+		}
+		d.Userdata = userdata
+	}
+
 	log.Infof("Creating host...")
 
 	c, err := newComputeUtil(d)
@@ -444,6 +679,29 @@ func (d *Driver) Kill() error {
 	return d.Stop()
 }
 
+// Resize changes the machine type of the instance, which GCE only changes
+// while it is stopped.
+func (d *Driver) Resize(spec drivers.ResizeSpec) error {
+	if spec.InstanceType == "" {
+		return errors.New("google resizes instances by machine type, use --instance-type")
+	}
+
+	c, err := newComputeUtil(d)
+	if err != nil {
+		return err
+	}
+
+	err = drivers.WhileStopped(d, func() error {
+		return c.setMachineType(spec.InstanceType)
+	})
+	if err != nil {
+		return err
+	}
+
+	d.MachineType = spec.InstanceType
+	return nil
+}
+
 // Remove deletes the GCE instance and the disk.
 func (d *Driver) Remove() error {
 	c, err := newComputeUtil(d)
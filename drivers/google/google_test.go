@@ -38,3 +38,65 @@ func TestSetConfigFromFlags(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Empty(t, checkFlags.InvalidFlags)
 }
+
+func TestSetConfigFromFlagsCustomMachineType(t *testing.T) {
+	driver := NewDriver("", "")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"google-project":               "PROJECT",
+			"google-custom-cpus":           4,
+			"google-custom-memory":         8192,
+			"google-custom-machine-series": "n2",
+			"google-provisioning-model":    "spot",
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	err := driver.SetConfigFromFlags(checkFlags)
+
+	assert.NoError(t, err)
+	assert.Empty(t, checkFlags.InvalidFlags)
+	assert.Equal(t, "n2-custom-4-8192", driver.MachineType)
+	assert.Equal(t, "SPOT", driver.ProvisioningModel)
+}
+
+func TestCheckInstanceOptions(t *testing.T) {
+	var tests = []struct {
+		description string
+		driver      *Driver
+		expectedErr bool
+	}{
+		{"standard", &Driver{ProvisioningModel: "STANDARD"}, false},
+		{"spot", &Driver{ProvisioningModel: "SPOT", InstanceTerminationAction: "DELETE"}, false},
+		{"unknown provisioning model", &Driver{ProvisioningModel: "RESERVED"}, true},
+		{"termination action without spot", &Driver{ProvisioningModel: "STANDARD", InstanceTerminationAction: "STOP"}, true},
+		{"unknown termination action", &Driver{ProvisioningModel: "SPOT", InstanceTerminationAction: "HIBERNATE"}, true},
+		{"spot and preemptible", &Driver{ProvisioningModel: "SPOT", Preemptible: true}, true},
+		{"custom machine type", &Driver{ProvisioningModel: "STANDARD", CustomCPUs: 2, CustomMemory: 4096}, false},
+		{"custom cpus without memory", &Driver{ProvisioningModel: "STANDARD", CustomCPUs: 2}, true},
+		{"custom memory not a multiple of 256", &Driver{ProvisioningModel: "STANDARD", CustomCPUs: 2, CustomMemory: 4000}, true},
+		{"custom series without custom type", &Driver{ProvisioningModel: "STANDARD", CustomMachineSeries: "n2"}, true},
+		{"accelerators", &Driver{ProvisioningModel: "STANDARD", AcceleratorType: "nvidia-tesla-t4", AcceleratorCount: 2}, false},
+		{"no accelerators of the type", &Driver{ProvisioningModel: "STANDARD", AcceleratorType: "nvidia-tesla-t4"}, true},
+	}
+
+	for _, test := range tests {
+		err := test.driver.checkInstanceOptions()
+
+		assert.Equal(t, test.expectedErr, err != nil, test.description)
+	}
+}
+
+func TestCustomMachineType(t *testing.T) {
+	assert.Equal(t, "custom-2-4096", customMachineType("", 2, 4096))
+	assert.Equal(t, "custom-2-4096", customMachineType("n1", 2, 4096))
+	assert.Equal(t, "n2d-custom-2-4096", customMachineType("n2d", 2, 4096))
+}
+
+func TestImageForArchitecture(t *testing.T) {
+	assert.Equal(t, defaultARM64ImageName, imageForArchitecture(defaultImageName, "ARM64"))
+	assert.Equal(t, defaultImageName, imageForArchitecture(defaultImageName, "X86_64"))
+	assert.Equal(t, defaultImageName, imageForArchitecture(defaultImageName, ""))
+	assert.Equal(t, "my-project/global/images/my-image", imageForArchitecture("my-project/global/images/my-image", "ARM64"))
+}
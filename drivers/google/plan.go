@@ -0,0 +1,77 @@
+package google
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	raw "google.golang.org/api/compute/v1"
+)
+
+// PreCreatePlan checks the CPU quota of the region left for the instance and
+// returns the firewall rule changes, the disk and the instance Create would
+// create.
+func (d *Driver) PreCreatePlan() ([]drivers.PlannedResource, error) {
+	c, err := newComputeUtil(d)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := []drivers.PlannedResource{}
+
+	ports, err := c.portsUsed()
+	if err != nil {
+		return nil, err
+	}
+	rule, _ := c.firewallRule()
+	if rule == nil {
+		resources = append(resources, drivers.PlannedResource{Type: "firewall", Name: firewallRule, Details: "opening " + strings.Join(ports, ", ")})
+	} else if missing := missingOpenedPorts(rule, ports); len(missing) > 0 {
+		resources = append(resources, drivers.PlannedResource{Type: "firewall", Name: firewallRule, Details: "updated to open " + formatPorts(missing)})
+	}
+
+	if d.UseExisting {
+		return resources, nil
+	}
+
+	machineType, err := c.service.MachineTypes.Get(c.project, c.zone, d.MachineType).Do()
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	region, err := c.service.Regions.Get(c.project, c.region()).Do()
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	if err := checkCPUQuota(region, machineType); err != nil {
+		return nil, err
+	}
+
+	return append(resources,
+		drivers.PlannedResource{Type: "disk", Name: c.diskName(), Details: fmt.Sprintf("%d GB %s from %s", d.DiskSize, d.DiskType, d.MachineImage)},
+		drivers.PlannedResource{Type: "instance", Name: c.instanceName, Details: fmt.Sprintf("%s in %s", d.MachineType, d.Zone)},
+	), nil
+}
+
+// checkCPUQuota returns a quota error if the region has fewer CPUs left than
+// the machine type has.
+func checkCPUQuota(region *raw.Region, machineType *raw.MachineType) error {
+	for _, quota := range region.Quotas {
+		if quota.Metric == "CPUS" && quota.Usage+float64(machineType.GuestCpus) > quota.Limit {
+			return drivers.Errorf(drivers.ErrorCodeQuotaExceeded, "machine type %s has %d CPUs, region %s has %v CPUs left of its quota of %v",
+				machineType.Name, machineType.GuestCpus, region.Name, quota.Limit-quota.Usage, quota.Limit)
+		}
+	}
+	return nil
+}
+
+func formatPorts(ports map[string][]string) string {
+	formatted := []string{}
+	for proto, protoPorts := range ports {
+		for _, port := range protoPorts {
+			formatted = append(formatted, port+"/"+proto)
+		}
+	}
+	sort.Strings(formatted)
+	return strings.Join(formatted, ", ")
+}
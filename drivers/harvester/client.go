@@ -0,0 +1,158 @@
+package harvester
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+var (
+	vmResource       = schema.GroupVersionResource{Group: "kubevirt.io", Version: "v1", Resource: "virtualmachines"}
+	vmiResource      = schema.GroupVersionResource{Group: "kubevirt.io", Version: "v1", Resource: "virtualmachineinstances"}
+	imageResource    = schema.GroupVersionResource{Group: "harvesterhci.io", Version: "v1beta1", Resource: "virtualmachineimages"}
+	networkResource  = schema.GroupVersionResource{Group: "k8s.cni.cncf.io", Version: "v1", Resource: "network-attachment-definitions"}
+	resourceListKind = map[schema.GroupVersionResource]string{
+		vmResource:      "VirtualMachineList",
+		vmiResource:     "VirtualMachineInstanceList",
+		imageResource:   "VirtualMachineImageList",
+		networkResource: "NetworkAttachmentDefinitionList",
+	}
+)
+
+// newClients returns the clients of the cluster of the configuration,
+// replaced by the tests.
+var newClients = func(config *rest.Config) (dynamic.Interface, kubernetes.Interface, error) {
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	k8s, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dynamicClient, k8s, nil
+}
+
+// Client makes the calls to the Harvester cluster the driver needs: the
+// KubeVirt VMs and their cloud-init secrets and disks, in a namespace.
+type Client struct {
+	namespace string
+	dynamic   dynamic.Interface
+	k8s       kubernetes.Interface
+}
+
+// NewClient returns a client of the cluster of the kubeconfig content, or
+// of the file, or else of the default kubeconfig.
+func NewClient(kubeconfigContent, kubeconfigPath, namespace string) (*Client, error) {
+	var config *rest.Config
+	var err error
+	switch {
+	case kubeconfigContent != "":
+		config, err = clientcmd.RESTConfigFromKubeConfig([]byte(kubeconfigContent))
+	case kubeconfigPath != "":
+		config, err = clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	default:
+		loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+		config, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("harvester kubeconfig: %s", err)
+	}
+
+	dynamicClient, k8s, err := newClients(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{namespace: namespace, dynamic: dynamicClient, k8s: k8s}, nil
+}
+
+func isNotFound(err error) bool {
+	return apierrors.IsNotFound(err)
+}
+
+// namespacedName splits the reference, e.g. "default/ubuntu", defaulting
+// to the namespace.
+func namespacedName(ref, namespace string) (string, string) {
+	if i := strings.Index(ref, "/"); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return namespace, ref
+}
+
+// ImageStorageClass returns the storage class the disks of the image are
+// provisioned with.
+func (c *Client) ImageStorageClass(ctx context.Context, ref string) (string, error) {
+	namespace, name := namespacedName(ref, c.namespace)
+	image, err := c.dynamic.Resource(imageResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	storageClass, _, _ := unstructured.NestedString(image.Object, "status", "storageClassName")
+	if storageClass == "" {
+		return "", fmt.Errorf("harvester image %s/%s is not ready", namespace, name)
+	}
+	return storageClass, nil
+}
+
+func (c *Client) GetNetwork(ctx context.Context, ref string) error {
+	namespace, name := namespacedName(ref, c.namespace)
+	_, err := c.dynamic.Resource(networkResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	return err
+}
+
+func (c *Client) CreateSecret(ctx context.Context, secret *corev1.Secret) error {
+	_, err := c.k8s.CoreV1().Secrets(c.namespace).Create(ctx, secret, metav1.CreateOptions{})
+	return err
+}
+
+func (c *Client) DeleteSecret(ctx context.Context, name string) error {
+	return c.k8s.CoreV1().Secrets(c.namespace).Delete(ctx, name, metav1.DeleteOptions{})
+}
+
+func (c *Client) DeletePVC(ctx context.Context, name string) error {
+	return c.k8s.CoreV1().PersistentVolumeClaims(c.namespace).Delete(ctx, name, metav1.DeleteOptions{})
+}
+
+func (c *Client) CreateVM(ctx context.Context, vm *unstructured.Unstructured) error {
+	_, err := c.dynamic.Resource(vmResource).Namespace(c.namespace).Create(ctx, vm, metav1.CreateOptions{})
+	return err
+}
+
+func (c *Client) GetVM(ctx context.Context, name string) (*unstructured.Unstructured, error) {
+	return c.dynamic.Resource(vmResource).Namespace(c.namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+// SetRunning starts or stops the VM.
+func (c *Client) SetRunning(ctx context.Context, name string, running bool) error {
+	patch := []byte(fmt.Sprintf(`{"spec": {"running": %t}}`, running))
+	_, err := c.dynamic.Resource(vmResource).Namespace(c.namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// DeleteVM deletes the VM, its instance first.
+func (c *Client) DeleteVM(ctx context.Context, name string) error {
+	propagation := metav1.DeletePropagationForeground
+	return c.dynamic.Resource(vmResource).Namespace(c.namespace).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+}
+
+func (c *Client) GetVMI(ctx context.Context, name string) (*unstructured.Unstructured, error) {
+	return c.dynamic.Resource(vmiResource).Namespace(c.namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+// DeleteVMI deletes the running instance of the VM, which is started again
+// if the VM still runs, waiting the grace period, when given, instead of
+// the one of the VM.
+func (c *Client) DeleteVMI(ctx context.Context, name string, gracePeriod *int64) error {
+	return c.dynamic.Resource(vmiResource).Namespace(c.namespace).Delete(ctx, name, metav1.DeleteOptions{GracePeriodSeconds: gracePeriod})
+}
@@ -0,0 +1,603 @@
+package harvester
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rancher/machine/drivers/driverutil"
+	"github.com/rancher/machine/libmachine/drivers"
+	rpcdriver "github.com/rancher/machine/libmachine/drivers/rpc"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/rancher/machine/libmachine/ssh"
+	"github.com/rancher/machine/libmachine/state"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+type Driver struct {
+	*drivers.BaseDriver
+	KubeconfigContent string
+	KubeconfigPath    string
+	Namespace         string
+	CPUCount          int
+	MemorySize        int
+	DiskSize          int
+	DiskBus           string
+	ImageName         string
+	NetworkName       string
+	UserDataFile      string
+	NetworkDataFile   string
+}
+
+const (
+	defaultSSHPort    = 22
+	defaultSSHUser    = "ubuntu"
+	defaultNamespace  = "default"
+	defaultCPUCount   = 2
+	defaultMemorySize = 4
+	defaultDiskSize   = 40
+	defaultDiskBus    = "virtio"
+
+	// operationTimeout is how long a call to the cluster is waited for.
+	operationTimeout = time.Minute
+)
+
+// Capabilities returns the optional operations supported by the driver.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityStartStop,
+		drivers.CapabilityRestart,
+		drivers.CapabilityKill,
+		drivers.CapabilityCustomSSHPort,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+	}
+}
+
+// GetCreateFlags registers the flags this driver adds to
+// "docker hosts create"
+func (d *Driver) GetCreateFlags() []mcnflag.Flag {
+	return []mcnflag.Flag{
+		mcnflag.StringFlag{
+			EnvVar:    "HARVESTER_KUBECONFIG_CONTENT",
+			Name:      "harvester-kubeconfig-content",
+			Usage:     "content of the kubeconfig of the Harvester cluster",
+			Sensitive: true,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HARVESTER_KUBECONFIG_PATH",
+			Name:   "harvester-kubeconfig-path",
+			Usage:  "path of the kubeconfig of the Harvester cluster (default the current kubeconfig)",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HARVESTER_VM_NAMESPACE",
+			Name:   "harvester-vm-namespace",
+			Usage:  "namespace to create the VM in",
+			Value:  defaultNamespace,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "HARVESTER_CPU_COUNT",
+			Name:   "harvester-cpu-count",
+			Usage:  "number of CPUs of the VM",
+			Value:  defaultCPUCount,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "HARVESTER_MEMORY_SIZE",
+			Name:   "harvester-memory-size",
+			Usage:  "memory of the VM in GiB",
+			Value:  defaultMemorySize,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "HARVESTER_DISK_SIZE",
+			Name:   "harvester-disk-size",
+			Usage:  "size of the disk of the VM in GiB",
+			Value:  defaultDiskSize,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HARVESTER_DISK_BUS",
+			Name:   "harvester-disk-bus",
+			Usage:  "bus of the disk of the VM: virtio, sata or scsi",
+			Value:  defaultDiskBus,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HARVESTER_IMAGE_NAME",
+			Name:   "harvester-image-name",
+			Usage:  "image of the disk of the VM, as namespace/name or name in the VM namespace",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HARVESTER_NETWORK_NAME",
+			Name:   "harvester-network-name",
+			Usage:  "VM network to attach the VM to, as namespace/name or name in the VM namespace (default the pod network)",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HARVESTER_USER_DATA",
+			Name:   "harvester-user-data",
+			Usage:  "path of a #cloud-config file to pass to cloud-init",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HARVESTER_NETWORK_DATA",
+			Name:   "harvester-network-data",
+			Usage:  "path of a network configuration file to pass to cloud-init",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HARVESTER_SSH_USER",
+			Name:   "harvester-ssh-user",
+			Usage:  "SSH username",
+			Value:  defaultSSHUser,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "HARVESTER_SSH_PORT",
+			Name:   "harvester-ssh-port",
+			Usage:  "SSH port",
+			Value:  defaultSSHPort,
+		},
+	}
+}
+
+func NewDriver(hostName, storePath string) *Driver {
+	return &Driver{
+		Namespace:  defaultNamespace,
+		CPUCount:   defaultCPUCount,
+		MemorySize: defaultMemorySize,
+		DiskSize:   defaultDiskSize,
+		DiskBus:    defaultDiskBus,
+		BaseDriver: &drivers.BaseDriver{
+			MachineName: hostName,
+			StorePath:   storePath,
+			SSHUser:     defaultSSHUser,
+			SSHPort:     defaultSSHPort,
+		},
+	}
+}
+
+func (d *Driver) GetSSHHostname() (string, error) {
+	return d.GetIP()
+}
+
+// DriverName returns the name of the driver
+func (d *Driver) DriverName() string {
+	return "harvester"
+}
+
+// UnmarshalJSON loads driver config from JSON. This function is used by the RPCServerDriver that wraps
+// all drivers as a means of populating an already-initialized driver with new configuration.
+// See `RPCServerDriver.SetConfigRaw`.
+func (d *Driver) UnmarshalJSON(data []byte) error {
+	// Unmarshal driver config into an aliased type to prevent infinite recursion on UnmarshalJSON.
+	type targetDriver Driver
+
+	// Copy data from `d` to `target` before unmarshalling. This will ensure that already-initialized values
+	// from `d` that are left untouched during unmarshal (like functions) are preserved.
+	target := targetDriver(*d)
+
+	if err := json.Unmarshal(data, &target); err != nil {
+		return fmt.Errorf("error unmarshalling driver config from JSON: %w", err)
+	}
+
+	// Copy unmarshalled data back to `d`.
+	*d = Driver(target)
+
+	// Make sure to reload values that are subject to change from envvars and os.Args.
+	driverOpts, err := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	if err != nil {
+		return err
+	}
+	if _, ok := driverOpts.Values["harvester-kubeconfig-content"]; ok {
+		d.KubeconfigContent = driverOpts.String("harvester-kubeconfig-content")
+	}
+
+	return nil
+}
+
+func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
+	d.KubeconfigContent = flags.String("harvester-kubeconfig-content")
+	d.KubeconfigPath = flags.String("harvester-kubeconfig-path")
+	d.Namespace = flags.String("harvester-vm-namespace")
+	d.CPUCount = flags.Int("harvester-cpu-count")
+	d.MemorySize = flags.Int("harvester-memory-size")
+	d.DiskSize = flags.Int("harvester-disk-size")
+	d.DiskBus = flags.String("harvester-disk-bus")
+	d.ImageName = flags.String("harvester-image-name")
+	d.NetworkName = flags.String("harvester-network-name")
+	d.UserDataFile = flags.String("harvester-user-data")
+	d.NetworkDataFile = flags.String("harvester-network-data")
+	d.SSHUser = flags.String("harvester-ssh-user")
+	d.SSHPort = flags.Int("harvester-ssh-port")
+
+	d.SetSwarmConfigFromFlags(flags)
+	if err := d.SetUserDataFromFlags(flags); err != nil {
+		return err
+	}
+
+	if d.ImageName == "" {
+		return fmt.Errorf("harvester driver requires the --harvester-image-name option")
+	}
+	if d.CPUCount <= 0 || d.MemorySize <= 0 || d.DiskSize <= 0 {
+		return fmt.Errorf("harvester CPU count, memory and disk sizes must be positive")
+	}
+	switch d.DiskBus {
+	case "virtio", "sata", "scsi":
+	default:
+		return fmt.Errorf("harvester disk bus must be virtio, sata or scsi, got %q", d.DiskBus)
+	}
+
+	return nil
+}
+
+func (d *Driver) PreCreateCheck() error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+
+	if _, err := client.ImageStorageClass(ctx, d.ImageName); err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("harvester image %s doesn't exist", d.ImageName)
+		}
+		return err
+	}
+	if d.NetworkName != "" {
+		if err := client.GetNetwork(ctx, d.NetworkName); err != nil {
+			if isNotFound(err) {
+				return fmt.Errorf("harvester network %s doesn't exist", d.NetworkName)
+			}
+			return err
+		}
+	}
+	if _, err := driverutil.CloudConfigWithKey(d.BaseDriver, d.UserDataFile, ""); err != nil {
+		return err
+	}
+	if d.NetworkDataFile != "" {
+		if _, err := os.ReadFile(d.NetworkDataFile); err != nil {
+			return fmt.Errorf("cannot read network data file %v: %v", d.NetworkDataFile, err)
+		}
+	}
+
+	return nil
+}
+
+func (d *Driver) Create() error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Creating SSH key...")
+
+	d.SSHKeyPath = d.GetSSHKeyPath()
+	if err := ssh.GenerateSSHKey(d.SSHKeyPath); err != nil {
+		return err
+	}
+	publicKey, err := os.ReadFile(d.SSHKeyPath + ".pub")
+	if err != nil {
+		return err
+	}
+
+	userData, err := driverutil.CloudConfigWithKey(d.BaseDriver, d.UserDataFile, strings.TrimSpace(string(publicKey)))
+	if err != nil {
+		return err
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: d.cloudInitSecretName()},
+		Data:       map[string][]byte{"userdata": userData},
+	}
+	if d.NetworkDataFile != "" {
+		networkData, err := os.ReadFile(d.NetworkDataFile)
+		if err != nil {
+			return err
+		}
+		secret.Data["networkdata"] = networkData
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+
+	storageClass, err := client.ImageStorageClass(ctx, d.ImageName)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Creating Harvester VM...")
+
+	if err := client.CreateSecret(ctx, secret); err != nil {
+		return err
+	}
+	vm, err := d.virtualMachine(storageClass)
+	if err != nil {
+		return d.removeAfter(err)
+	}
+	if err := client.CreateVM(ctx, vm); err != nil {
+		return d.removeAfter(err)
+	}
+
+	log.Info("Waiting for the VM to be running...")
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+		vmi, err := client.GetVMI(ctx, d.MachineName)
+		cancel()
+		if err != nil && !isNotFound(err) {
+			return d.removeAfter(err)
+		}
+
+		if err == nil {
+			phase, _, _ := unstructured.NestedString(vmi.Object, "status", "phase")
+			if phase == "Failed" {
+				return d.removeAfter(fmt.Errorf("harvester VM %s/%s failed", d.Namespace, d.MachineName))
+			}
+			if d.IPAddress = instanceIP(vmi); phase == "Running" && d.IPAddress != "" {
+				break
+			}
+		}
+
+		time.Sleep(5 * time.Second)
+	}
+
+	log.Debugf("Created Harvester VM %s/%s, IP address %s", d.Namespace, d.MachineName, d.IPAddress)
+
+	return nil
+}
+
+func (d *Driver) cloudInitSecretName() string {
+	return d.MachineName + "-cloudinit"
+}
+
+func (d *Driver) diskName() string {
+	return d.MachineName + "-disk-0"
+}
+
+// virtualMachine returns the VM to create, whose disk is provisioned from
+// the image with its storage class by Harvester.
+func (d *Driver) virtualMachine(storageClass string) (*unstructured.Unstructured, error) {
+	volumeMode := corev1.PersistentVolumeBlock
+	claims, err := json.Marshal([]corev1.PersistentVolumeClaim{{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        d.diskName(),
+			Annotations: map[string]string{"harvesterhci.io/imageId": d.imageID()},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+			VolumeMode:  &volumeMode,
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(fmt.Sprintf("%dGi", d.DiskSize))},
+			},
+			StorageClassName: &storageClass,
+		},
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	network := map[string]interface{}{"name": "default", "pod": map[string]interface{}{}}
+	iface := map[string]interface{}{"name": "default", "model": "virtio", "masquerade": map[string]interface{}{}}
+	if d.NetworkName != "" {
+		namespace, name := namespacedName(d.NetworkName, d.Namespace)
+		network = map[string]interface{}{"name": "default", "multus": map[string]interface{}{"networkName": namespace + "/" + name}}
+		iface = map[string]interface{}{"name": "default", "model": "virtio", "bridge": map[string]interface{}{}}
+	}
+
+	cloudInit := map[string]interface{}{"secretRef": map[string]interface{}{"name": d.cloudInitSecretName()}}
+	if d.NetworkDataFile != "" {
+		cloudInit["networkDataSecretRef"] = map[string]interface{}{"name": d.cloudInitSecretName()}
+	}
+
+	memory := fmt.Sprintf("%dGi", d.MemorySize)
+	resources := map[string]interface{}{"cpu": strconv.Itoa(d.CPUCount), "memory": memory}
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "kubevirt.io/v1",
+		"kind":       "VirtualMachine",
+		"metadata": map[string]interface{}{
+			"name":      d.MachineName,
+			"namespace": d.Namespace,
+			"labels":    map[string]interface{}{"harvesterhci.io/creator": "docker-machine-driver-harvester"},
+			"annotations": map[string]interface{}{
+				"harvesterhci.io/volumeClaimTemplates": string(claims),
+			},
+		},
+		"spec": map[string]interface{}{
+			"running": true,
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"labels": map[string]interface{}{"harvesterhci.io/vmName": d.MachineName},
+				},
+				"spec": map[string]interface{}{
+					"hostname": d.MachineName,
+					"domain": map[string]interface{}{
+						"cpu": map[string]interface{}{"cores": int64(d.CPUCount)},
+						"devices": map[string]interface{}{
+							"disks": []interface{}{
+								map[string]interface{}{
+									"name":      "disk-0",
+									"bootOrder": int64(1),
+									"disk":      map[string]interface{}{"bus": d.DiskBus},
+								},
+								map[string]interface{}{
+									"name": "cloudinitdisk",
+									"disk": map[string]interface{}{"bus": "virtio"},
+								},
+							},
+							"interfaces": []interface{}{iface},
+						},
+						"resources": map[string]interface{}{
+							"requests": resources,
+							"limits":   resources,
+						},
+					},
+					"networks": []interface{}{network},
+					"volumes": []interface{}{
+						map[string]interface{}{
+							"name":                  "disk-0",
+							"persistentVolumeClaim": map[string]interface{}{"claimName": d.diskName()},
+						},
+						map[string]interface{}{
+							"name":             "cloudinitdisk",
+							"cloudInitNoCloud": cloudInit,
+						},
+					},
+				},
+			},
+		},
+	}}, nil
+}
+
+func (d *Driver) imageID() string {
+	namespace, name := namespacedName(d.ImageName, d.Namespace)
+	return namespace + "/" + name
+}
+
+// instanceIP returns the first address reported for the interfaces of the
+// VM instance, skipping link-local ones.
+func instanceIP(vmi *unstructured.Unstructured) string {
+	interfaces, _, _ := unstructured.NestedSlice(vmi.Object, "status", "interfaces")
+	for _, iface := range interfaces {
+		fields, ok := iface.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		address, _ := fields["ipAddress"].(string)
+		if ip := strings.Split(address, "/")[0]; net.ParseIP(ip) != nil && !net.ParseIP(ip).IsLinkLocalUnicast() {
+			return ip
+		}
+	}
+	return ""
+}
+
+func (d *Driver) removeAfter(err error) error {
+	if removeErr := d.Remove(); removeErr != nil {
+		return fmt.Errorf("failed to create machine due to error: %v. Removing VM: %v", err, removeErr)
+	}
+	return err
+}
+
+func (d *Driver) GetURL() (string, error) {
+	if err := drivers.MustBeRunning(d); err != nil {
+		return "", err
+	}
+
+	ip, err := d.GetIP()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("tcp://%s", net.JoinHostPort(ip, "2376")), nil
+}
+
+func (d *Driver) GetState() (state.State, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return state.Error, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+
+	vm, err := client.GetVM(ctx, d.MachineName)
+	if err != nil {
+		if !isNotFound(err) {
+			return state.Error, err
+		}
+		return state.None, fmt.Errorf("machine %v not found", d.MachineName)
+	}
+
+	status, _, _ := unstructured.NestedString(vm.Object, "status", "printableStatus")
+	switch status {
+	case "Provisioning", "WaitingForVolumeBinding", "Starting":
+		return state.Starting, nil
+	case "Running":
+		return state.Running, nil
+	case "Paused":
+		return state.Paused, nil
+	case "Stopping", "Terminating":
+		return state.Stopping, nil
+	case "Stopped":
+		return state.Stopped, nil
+	case "CrashLoopBackOff", "ErrorUnschedulable", "ErrImagePull", "ImagePullBackOff", "ErrorPvcNotFound", "DataVolumeError":
+		return state.Error, nil
+	}
+	return state.None, nil
+}
+
+func (d *Driver) setRunning(running bool) error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+	return client.SetRunning(ctx, d.MachineName, running)
+}
+
+func (d *Driver) Start() error {
+	return d.setRunning(true)
+}
+
+func (d *Driver) Stop() error {
+	return d.setRunning(false)
+}
+
+// Restart deletes the VM instance, which KubeVirt starts again.
+func (d *Driver) Restart() error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+	return client.DeleteVMI(ctx, d.MachineName, nil)
+}
+
+// Kill stops the VM and deletes its instance without a grace period.
+func (d *Driver) Kill() error {
+	if err := d.Stop(); err != nil {
+		return err
+	}
+
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+	if err := client.DeleteVMI(ctx, d.MachineName, new(int64)); err != nil && !isNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// Remove deletes the VM, then its disk and cloud-init secret.
+func (d *Driver) Remove() error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+
+	if err := client.DeleteVM(ctx, d.MachineName); err != nil {
+		if !isNotFound(err) {
+			return err
+		}
+		log.Infof("Harvester VM doesn't exist, assuming it is already deleted")
+	}
+	if err := client.DeletePVC(ctx, d.diskName()); err != nil && !isNotFound(err) {
+		return err
+	}
+	if err := client.DeleteSecret(ctx, d.cloudInitSecretName()); err != nil && !isNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func (d *Driver) getClient() (*Client, error) {
+	return NewClient(d.KubeconfigContent, d.KubeconfigPath, d.Namespace)
+}
@@ -0,0 +1,319 @@
+package harvester
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+const kubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: harvester
+  cluster:
+    server: https://harvester.example.com:6443
+users:
+- name: admin
+  user:
+    token: TOKEN
+contexts:
+- name: harvester
+  context:
+    cluster: harvester
+    user: admin
+current-context: harvester
+`
+
+// fakeCluster holds the objects of the Harvester cluster the driver is
+// given clients of.
+type fakeCluster struct {
+	dynamic *dynamicfake.FakeDynamicClient
+	k8s     *k8sfake.Clientset
+}
+
+func newFakeCluster(t *testing.T, objects ...runtime.Object) *fakeCluster {
+	cluster := &fakeCluster{
+		dynamic: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), resourceListKind, objects...),
+		k8s:     k8sfake.NewSimpleClientset(),
+	}
+	// The resource of the networks cannot be guessed from their kind.
+	assert.NoError(t, cluster.dynamic.Tracker().Create(networkResource, network(), "default"))
+
+	orig := newClients
+	newClients = func(config *rest.Config) (dynamic.Interface, kubernetes.Interface, error) {
+		assert.Equal(t, "https://harvester.example.com:6443", config.Host)
+		return cluster.dynamic, cluster.k8s, nil
+	}
+	t.Cleanup(func() { newClients = orig })
+	return cluster
+}
+
+func object(apiVersion, kind, namespace, name string, fields map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+	}}
+	for key, value := range fields {
+		obj.Object[key] = value
+	}
+	return obj
+}
+
+func image() *unstructured.Unstructured {
+	return object("harvesterhci.io/v1beta1", "VirtualMachineImage", "images", "ubuntu", map[string]interface{}{
+		"status": map[string]interface{}{"storageClassName": "longhorn-ubuntu"},
+	})
+}
+
+func network() *unstructured.Unstructured {
+	return object("k8s.cni.cncf.io/v1", "NetworkAttachmentDefinition", "default", "vlan10", nil)
+}
+
+func runningVMI() *unstructured.Unstructured {
+	return object("kubevirt.io/v1", "VirtualMachineInstance", "default", "default", map[string]interface{}{
+		"status": map[string]interface{}{
+			"phase": "Running",
+			"interfaces": []interface{}{
+				map[string]interface{}{"name": "default", "ipAddress": "fe80::1"},
+				map[string]interface{}{"name": "default", "ipAddress": "10.0.10.5"},
+			},
+		},
+	})
+}
+
+func newTestDriver(storePath string) *Driver {
+	driver := NewDriver("default", storePath)
+	driver.KubeconfigContent = kubeconfig
+	driver.ImageName = "images/ubuntu"
+	return driver
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	driver := NewDriver("", "")
+
+	// Unmarhsal driver configuration from JSON and args.
+	os.Args = append(os.Args, []string{"--harvester-kubeconfig-content", "test kubeconfig"}...)
+
+	driverBytes, err := json.Marshal(driver)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(driverBytes, driver))
+
+	// Make sure that config has been pulled in from envvars and args.
+	assert.Equal(t, "test kubeconfig", driver.KubeconfigContent)
+}
+
+func TestSetConfigFromFlags(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"harvester-image-name": "default/ubuntu",
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	err := driver.SetConfigFromFlags(checkFlags)
+
+	assert.NoError(t, err)
+	assert.Empty(t, checkFlags.InvalidFlags)
+	assert.Equal(t, "default", driver.Namespace)
+	assert.Equal(t, 2, driver.CPUCount)
+	assert.Equal(t, 4, driver.MemorySize)
+	assert.Equal(t, 40, driver.DiskSize)
+
+	sshPort, err := driver.GetSSHPort()
+	assert.NoError(t, err)
+	assert.Equal(t, "ubuntu", driver.GetSSHUsername())
+	assert.Equal(t, 22, sshPort)
+}
+
+func TestSetConfigFromFlagsInvalid(t *testing.T) {
+	for expected, flags := range map[string]map[string]interface{}{
+		"harvester driver requires the --harvester-image-name option": {},
+		"harvester CPU count, memory and disk sizes must be positive": {
+			"harvester-image-name": "ubuntu",
+			"harvester-cpu-count":  0,
+		},
+		`harvester disk bus must be virtio, sata or scsi, got "ide"`: {
+			"harvester-image-name": "ubuntu",
+			"harvester-disk-bus":   "ide",
+		},
+	} {
+		driver := NewDriver("default", "path")
+		checkFlags := &drivers.CheckDriverOptions{FlagsValues: flags, CreateFlags: driver.GetCreateFlags()}
+
+		assert.EqualError(t, driver.SetConfigFromFlags(checkFlags), expected)
+	}
+}
+
+func TestPreCreateCheck(t *testing.T) {
+	newFakeCluster(t, image())
+
+	driver := newTestDriver("path")
+	driver.NetworkName = "vlan10"
+	assert.NoError(t, driver.PreCreateCheck())
+
+	driver.NetworkName = "vlan20"
+	assert.EqualError(t, driver.PreCreateCheck(), "harvester network vlan20 doesn't exist")
+
+	driver.ImageName = "ubuntu"
+	assert.EqualError(t, driver.PreCreateCheck(), "harvester image ubuntu doesn't exist")
+
+	driver.KubeconfigContent = "server: {"
+	assert.ErrorContains(t, driver.PreCreateCheck(), "harvester kubeconfig: ")
+}
+
+func TestPreCreateCheckUserData(t *testing.T) {
+	newFakeCluster(t, image())
+
+	userData := filepath.Join(t.TempDir(), "user-data")
+	assert.NoError(t, os.WriteFile(userData, []byte("#!/bin/sh\necho hello\n"), 0600))
+
+	driver := newTestDriver("path")
+	driver.UserDataFile = userData
+	assert.EqualError(t, driver.PreCreateCheck(), "user data "+userData+" must be a #cloud-config")
+}
+
+func TestCreate(t *testing.T) {
+	cluster := newFakeCluster(t, image(), runningVMI())
+
+	storePath := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(storePath, "machines", "default"), 0700))
+	userData := filepath.Join(storePath, "user-data")
+	assert.NoError(t, os.WriteFile(userData, []byte("#cloud-config\npackages:\n- qemu-guest-agent\nssh_authorized_keys:\n- ssh-ed25519 AAAA user\n"), 0600))
+
+	driver := newTestDriver(storePath)
+	driver.NetworkName = "vlan10"
+	driver.UserDataFile = userData
+
+	assert.NoError(t, driver.Create())
+	assert.Equal(t, "10.0.10.5", driver.IPAddress)
+
+	ctx := context.Background()
+	secret, err := cluster.k8s.CoreV1().Secrets("default").Get(ctx, "default-cloudinit", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(secret.Data["userdata"]), "#cloud-config\n"))
+	var config struct {
+		Packages          []string `yaml:"packages"`
+		SSHAuthorizedKeys []string `yaml:"ssh_authorized_keys"`
+	}
+	assert.NoError(t, yaml.Unmarshal(secret.Data["userdata"], &config))
+	assert.Equal(t, []string{"qemu-guest-agent"}, config.Packages)
+	assert.Len(t, config.SSHAuthorizedKeys, 2)
+	assert.True(t, strings.HasPrefix(config.SSHAuthorizedKeys[1], "ssh-rsa "))
+
+	vm, err := cluster.dynamic.Resource(vmResource).Namespace("default").Get(ctx, "default", metav1.GetOptions{})
+	assert.NoError(t, err)
+
+	var claims []corev1.PersistentVolumeClaim
+	assert.NoError(t, json.Unmarshal([]byte(vm.GetAnnotations()["harvesterhci.io/volumeClaimTemplates"]), &claims))
+	assert.Len(t, claims, 1)
+	assert.Equal(t, "default-disk-0", claims[0].Name)
+	assert.Equal(t, "images/ubuntu", claims[0].Annotations["harvesterhci.io/imageId"])
+	assert.Equal(t, "longhorn-ubuntu", *claims[0].Spec.StorageClassName)
+	assert.Equal(t, "40Gi", claims[0].Spec.Resources.Requests.Storage().String())
+
+	running, _, _ := unstructured.NestedBool(vm.Object, "spec", "running")
+	assert.True(t, running)
+	domain, _, _ := unstructured.NestedMap(vm.Object, "spec", "template", "spec", "domain")
+	assert.Equal(t, map[string]interface{}{"cpu": "2", "memory": "4Gi"}, domain["resources"].(map[string]interface{})["limits"])
+	networks, _, _ := unstructured.NestedSlice(vm.Object, "spec", "template", "spec", "networks")
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "default", "multus": map[string]interface{}{"networkName": "default/vlan10"}}}, networks)
+}
+
+func TestGetState(t *testing.T) {
+	cluster := newFakeCluster(t)
+
+	driver := newTestDriver("path")
+
+	s, err := driver.GetState()
+	assert.EqualError(t, err, "machine default not found")
+	assert.Equal(t, state.None, s)
+
+	for status, expected := range map[string]state.State{
+		"Starting":           state.Starting,
+		"Running":            state.Running,
+		"Paused":             state.Paused,
+		"Stopping":           state.Stopping,
+		"Stopped":            state.Stopped,
+		"ErrorUnschedulable": state.Error,
+		"Migrating":          state.None,
+	} {
+		vm := object("kubevirt.io/v1", "VirtualMachine", "default", "default", map[string]interface{}{
+			"status": map[string]interface{}{"printableStatus": status},
+		})
+		assert.NoError(t, cluster.dynamic.Tracker().Add(vm))
+
+		s, err := driver.GetState()
+		assert.NoError(t, err)
+		assert.Equal(t, expected, s, status)
+
+		assert.NoError(t, cluster.dynamic.Tracker().Delete(vmResource, "default", "default"))
+	}
+}
+
+func TestStopKill(t *testing.T) {
+	vm := object("kubevirt.io/v1", "VirtualMachine", "default", "default", map[string]interface{}{
+		"spec": map[string]interface{}{"running": true},
+	})
+	cluster := newFakeCluster(t, vm, runningVMI())
+
+	driver := newTestDriver("path")
+	ctx := context.Background()
+
+	assert.NoError(t, driver.Kill())
+	got, err := cluster.dynamic.Resource(vmResource).Namespace("default").Get(ctx, "default", metav1.GetOptions{})
+	assert.NoError(t, err)
+	running, _, _ := unstructured.NestedBool(got.Object, "spec", "running")
+	assert.False(t, running)
+	_, err = cluster.dynamic.Resource(vmiResource).Namespace("default").Get(ctx, "default", metav1.GetOptions{})
+	assert.True(t, isNotFound(err))
+
+	assert.NoError(t, driver.Start())
+	got, _ = cluster.dynamic.Resource(vmResource).Namespace("default").Get(ctx, "default", metav1.GetOptions{})
+	running, _, _ = unstructured.NestedBool(got.Object, "spec", "running")
+	assert.True(t, running)
+}
+
+func TestRemove(t *testing.T) {
+	vm := object("kubevirt.io/v1", "VirtualMachine", "default", "default", nil)
+	cluster := newFakeCluster(t, vm)
+	ctx := context.Background()
+	for _, obj := range []runtime.Object{
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "default-cloudinit"}},
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "default-disk-0"}},
+	} {
+		assert.NoError(t, cluster.k8s.Tracker().Add(obj))
+	}
+
+	driver := newTestDriver("path")
+	assert.NoError(t, driver.Remove())
+
+	_, err := cluster.dynamic.Resource(vmResource).Namespace("default").Get(ctx, "default", metav1.GetOptions{})
+	assert.True(t, isNotFound(err))
+	_, err = cluster.k8s.CoreV1().Secrets("default").Get(ctx, "default-cloudinit", metav1.GetOptions{})
+	assert.True(t, isNotFound(err))
+	_, err = cluster.k8s.CoreV1().PersistentVolumeClaims("default").Get(ctx, "default-disk-0", metav1.GetOptions{})
+	assert.True(t, isNotFound(err))
+
+	// VMs already deleted are ignored.
+	assert.NoError(t, driver.Remove())
+}
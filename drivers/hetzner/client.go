@@ -0,0 +1,207 @@
+package hetzner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/rancher/machine/libmachine/version"
+)
+
+// apiEndpoint is the Hetzner Cloud API, replaced by the tests.
+var apiEndpoint = "https://api.hetzner.cloud/v1"
+
+// Client makes the calls to the Hetzner Cloud API the driver needs.
+type Client struct {
+	token      string
+	endpoint   string
+	httpClient *http.Client
+}
+
+func NewClient(token string) *Client {
+	return &Client{
+		token:      token,
+		endpoint:   apiEndpoint,
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// APIError is an error answered by the Hetzner Cloud API.
+type APIError struct {
+	StatusCode int
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("hetzner: %s (%s)", e.Message, e.Code)
+}
+
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+type Server struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	PublicNet struct {
+		IPv4 struct {
+			IP string `json:"ip"`
+		} `json:"ipv4"`
+		IPv6 struct {
+			IP string `json:"ip"`
+		} `json:"ipv6"`
+	} `json:"public_net"`
+	PrivateNet []struct {
+		Network int64  `json:"network"`
+		IP      string `json:"ip"`
+	} `json:"private_net"`
+}
+
+type ServerCreateRequest struct {
+	Name             string            `json:"name"`
+	ServerType       string            `json:"server_type"`
+	Image            string            `json:"image"`
+	Location         string            `json:"location,omitempty"`
+	SSHKeys          []int64           `json:"ssh_keys,omitempty"`
+	Networks         []int64           `json:"networks,omitempty"`
+	PlacementGroup   int64             `json:"placement_group,omitempty"`
+	UserData         string            `json:"user_data,omitempty"`
+	Labels           map[string]string `json:"labels,omitempty"`
+	StartAfterCreate bool              `json:"start_after_create"`
+}
+
+type SSHKey struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// resource is a named resource of the API, e.g. a network.
+type resource struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+func (c *Client) do(method, path string, body, reply interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.endpoint+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("docker-machine/v%d", version.APIVersion))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 400 {
+		var errReply struct {
+			Error APIError `json:"error"`
+		}
+		if err := json.Unmarshal(data, &errReply); err != nil || errReply.Error.Message == "" {
+			errReply.Error.Code = "unknown"
+			errReply.Error.Message = resp.Status
+		}
+		errReply.Error.StatusCode = resp.StatusCode
+		return &errReply.Error
+	}
+
+	if reply == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, reply)
+}
+
+// findByName returns the ID of the resource of the collection, e.g.
+// "networks", with the given name, or the name itself if it is an ID.
+func (c *Client) findByName(collection, name string) (int64, error) {
+	if id, err := strconv.ParseInt(name, 10, 64); err == nil {
+		return id, nil
+	}
+
+	reply := map[string][]resource{}
+	if err := c.do(http.MethodGet, "/"+collection+"?name="+url.QueryEscape(name), nil, &reply); err != nil {
+		return 0, err
+	}
+	for _, r := range reply[collection] {
+		if r.Name == name {
+			return r.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("hetzner: no %s named %q", collection, name)
+}
+
+// exists fails if the collection, e.g. "locations", has nothing with the
+// given name.
+func (c *Client) exists(collection, name string) error {
+	_, err := c.findByName(collection, name)
+	return err
+}
+
+func (c *Client) CreateSSHKey(name, publicKey string) (*SSHKey, error) {
+	var reply struct {
+		SSHKey SSHKey `json:"ssh_key"`
+	}
+	body := map[string]string{"name": name, "public_key": publicKey}
+	if err := c.do(http.MethodPost, "/ssh_keys", body, &reply); err != nil {
+		return nil, err
+	}
+	return &reply.SSHKey, nil
+}
+
+func (c *Client) DeleteSSHKey(id int64) error {
+	return c.do(http.MethodDelete, fmt.Sprintf("/ssh_keys/%d", id), nil, nil)
+}
+
+func (c *Client) CreateServer(request *ServerCreateRequest) (*Server, error) {
+	var reply struct {
+		Server Server `json:"server"`
+	}
+	if err := c.do(http.MethodPost, "/servers", request, &reply); err != nil {
+		return nil, err
+	}
+	return &reply.Server, nil
+}
+
+func (c *Client) GetServer(id int64) (*Server, error) {
+	var reply struct {
+		Server Server `json:"server"`
+	}
+	if err := c.do(http.MethodGet, fmt.Sprintf("/servers/%d", id), nil, &reply); err != nil {
+		return nil, err
+	}
+	return &reply.Server, nil
+}
+
+func (c *Client) DeleteServer(id int64) error {
+	return c.do(http.MethodDelete, fmt.Sprintf("/servers/%d", id), nil, nil)
+}
+
+// ServerAction runs an action, e.g. "poweron", on the server.
+func (c *Client) ServerAction(id int64, action string) error {
+	return c.do(http.MethodPost, fmt.Sprintf("/servers/%d/actions/%s", id, action), nil, nil)
+}
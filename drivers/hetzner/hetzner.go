@@ -0,0 +1,435 @@
+package hetzner
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	rpcdriver "github.com/rancher/machine/libmachine/drivers/rpc"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/rancher/machine/libmachine/ssh"
+	"github.com/rancher/machine/libmachine/state"
+)
+
+type Driver struct {
+	*drivers.BaseDriver
+	APIToken          string
+	ServerID          int64
+	ServerType        string
+	Image             string
+	Location          string
+	Networks          []string
+	UsePrivateNetwork bool
+	PlacementGroup    string
+	UserDataFile      string
+	SSHKeyID          int64
+	PrivateIPAddress  string
+}
+
+const (
+	defaultSSHPort    = 22
+	defaultSSHUser    = "root"
+	defaultImage      = "ubuntu-22.04"
+	defaultServerType = "cx22"
+)
+
+// Capabilities returns the optional operations supported by the driver.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityStartStop,
+		drivers.CapabilityRestart,
+		drivers.CapabilityKill,
+		drivers.CapabilityPrivateIP,
+		drivers.CapabilityCustomSSHPort,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+	}
+}
+
+// GetCreateFlags registers the flags this driver adds to
+// "docker hosts create"
+func (d *Driver) GetCreateFlags() []mcnflag.Flag {
+	return []mcnflag.Flag{
+		mcnflag.StringFlag{
+			EnvVar:    "HETZNER_API_TOKEN",
+			Name:      "hetzner-api-token",
+			Usage:     "Hetzner Cloud API token",
+			Sensitive: true,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HETZNER_SSH_USER",
+			Name:   "hetzner-ssh-user",
+			Usage:  "SSH username",
+			Value:  defaultSSHUser,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "HETZNER_SSH_PORT",
+			Name:   "hetzner-ssh-port",
+			Usage:  "SSH port",
+			Value:  defaultSSHPort,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HETZNER_SERVER_TYPE",
+			Name:   "hetzner-server-type",
+			Usage:  "Hetzner Cloud server type",
+			Value:  defaultServerType,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HETZNER_IMAGE",
+			Name:   "hetzner-image",
+			Usage:  "Hetzner Cloud image",
+			Value:  defaultImage,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HETZNER_SERVER_LOCATION",
+			Name:   "hetzner-server-location",
+			Usage:  "Hetzner Cloud location, e.g. fsn1 (default chosen by Hetzner)",
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "HETZNER_NETWORKS",
+			Name:   "hetzner-networks",
+			Usage:  "names or IDs of the private networks to attach the server to",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "HETZNER_USE_PRIVATE_NETWORK",
+			Name:   "hetzner-use-private-network",
+			Usage:  "connect to the server through its private network address",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HETZNER_PLACEMENT_GROUP",
+			Name:   "hetzner-placement-group",
+			Usage:  "name or ID of the placement group to add the server to",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HETZNER_USERDATA",
+			Name:   "hetzner-userdata",
+			Usage:  "path to file with cloud-init user-data",
+		},
+	}
+}
+
+func NewDriver(hostName, storePath string) *Driver {
+	return &Driver{
+		Image:      defaultImage,
+		ServerType: defaultServerType,
+		BaseDriver: &drivers.BaseDriver{
+			MachineName: hostName,
+			StorePath:   storePath,
+		},
+	}
+}
+
+// GetSSHHostname returns the private address of the server when connecting
+// through the private network.
+func (d *Driver) GetSSHHostname() (string, error) {
+	if d.UsePrivateNetwork && d.PrivateIPAddress != "" {
+		return d.PrivateIPAddress, nil
+	}
+	return d.GetIP()
+}
+
+// DriverName returns the name of the driver
+func (d *Driver) DriverName() string {
+	return "hetzner"
+}
+
+// UnmarshalJSON loads driver config from JSON. This function is used by the RPCServerDriver that wraps
+// all drivers as a means of populating an already-initialized driver with new configuration.
+// See `RPCServerDriver.SetConfigRaw`.
+func (d *Driver) UnmarshalJSON(data []byte) error {
+	// Unmarshal driver config into an aliased type to prevent infinite recursion on UnmarshalJSON.
+	type targetDriver Driver
+
+	// Copy data from `d` to `target` before unmarshalling. This will ensure that already-initialized values
+	// from `d` that are left untouched during unmarshal (like functions) are preserved.
+	target := targetDriver(*d)
+
+	if err := json.Unmarshal(data, &target); err != nil {
+		return fmt.Errorf("error unmarshalling driver config from JSON: %w", err)
+	}
+
+	// Copy unmarshalled data back to `d`.
+	*d = Driver(target)
+
+	// Make sure to reload values that are subject to change from envvars and os.Args.
+	driverOpts, err := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	if err != nil {
+		return err
+	}
+	if _, ok := driverOpts.Values["hetzner-api-token"]; ok {
+		d.APIToken = driverOpts.String("hetzner-api-token")
+	}
+
+	return nil
+}
+
+func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
+	d.APIToken = flags.String("hetzner-api-token")
+	d.ServerType = flags.String("hetzner-server-type")
+	d.Image = flags.String("hetzner-image")
+	d.Location = flags.String("hetzner-server-location")
+	d.Networks = flags.StringSlice("hetzner-networks")
+	d.UsePrivateNetwork = flags.Bool("hetzner-use-private-network")
+	d.PlacementGroup = flags.String("hetzner-placement-group")
+	d.UserDataFile = flags.String("hetzner-userdata")
+	d.SSHUser = flags.String("hetzner-ssh-user")
+	d.SSHPort = flags.Int("hetzner-ssh-port")
+
+	d.SetSwarmConfigFromFlags(flags)
+
+	if d.APIToken == "" {
+		return fmt.Errorf("hetzner driver requires the --hetzner-api-token option")
+	}
+	if d.UsePrivateNetwork && len(d.Networks) == 0 {
+		return fmt.Errorf("hetzner driver requires the --hetzner-networks option to use the private network")
+	}
+
+	return nil
+}
+
+func (d *Driver) PreCreateCheck() error {
+	if d.UserDataFile != "" {
+		if _, err := os.Stat(d.UserDataFile); os.IsNotExist(err) {
+			return fmt.Errorf("user-data file %s could not be found", d.UserDataFile)
+		}
+	}
+
+	client := d.getClient()
+	if err := client.exists("server_types", d.ServerType); err != nil {
+		return err
+	}
+	if d.Location != "" {
+		if err := client.exists("locations", d.Location); err != nil {
+			return err
+		}
+	}
+	for _, network := range d.Networks {
+		if err := client.exists("networks", network); err != nil {
+			return err
+		}
+	}
+	if d.PlacementGroup != "" {
+		if err := client.exists("placement_groups", d.PlacementGroup); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Driver) Create() error {
+	var userdata string
+	if d.UserDataFile != "" {
+		buf, err := os.ReadFile(d.UserDataFile)
+		if err != nil {
+			return err
+		}
+		userdata = string(buf)
+	}
+
+	client := d.getClient()
+
+	createRequest := d.createRequest(userdata)
+	for _, network := range d.Networks {
+		id, err := client.findByName("networks", network)
+		if err != nil {
+			return err
+		}
+		createRequest.Networks = append(createRequest.Networks, id)
+	}
+	if d.PlacementGroup != "" {
+		id, err := client.findByName("placement_groups", d.PlacementGroup)
+		if err != nil {
+			return err
+		}
+		createRequest.PlacementGroup = id
+	}
+
+	log.Infof("Creating SSH key...")
+
+	key, err := d.createSSHKey()
+	if err != nil {
+		return err
+	}
+	d.SSHKeyID = key.ID
+	createRequest.SSHKeys = []int64{d.SSHKeyID}
+
+	log.Infof("Creating Hetzner Cloud server...")
+
+	server, err := client.CreateServer(createRequest)
+	if err != nil {
+		return err
+	}
+	d.ServerID = server.ID
+
+	log.Info("Waiting for the server to be running...")
+	for {
+		server, err = client.GetServer(d.ServerID)
+		if err != nil {
+			if removeErr := d.Remove(); removeErr != nil {
+				return fmt.Errorf("failed to create machine due to error: %v. Removing server: %v", err, removeErr)
+			}
+			return err
+		}
+
+		d.IPAddress = server.PublicNet.IPv4.IP
+		if len(server.PrivateNet) > 0 {
+			d.PrivateIPAddress = server.PrivateNet[0].IP
+		}
+
+		if server.Status == "running" && d.IPAddress != "" && (len(d.Networks) == 0 || d.PrivateIPAddress != "") {
+			break
+		}
+
+		time.Sleep(5 * time.Second)
+	}
+
+	log.Debugf("Created server ID %d, IP address %s, Private IP address %s",
+		server.ID,
+		d.IPAddress,
+		d.PrivateIPAddress)
+
+	return nil
+}
+
+// createRequest returns the request creating the server, without the IDs of
+// its SSH key, networks and placement group.
+func (d *Driver) createRequest(userdata string) *ServerCreateRequest {
+	return &ServerCreateRequest{
+		Name:             d.MachineName,
+		ServerType:       d.ServerType,
+		Image:            d.Image,
+		Location:         d.Location,
+		UserData:         userdata,
+		Labels:           map[string]string{"docker-machine": d.MachineName},
+		StartAfterCreate: true,
+	}
+}
+
+func (d *Driver) createSSHKey() (*SSHKey, error) {
+	d.SSHKeyPath = d.GetSSHKeyPath()
+
+	if err := ssh.GenerateSSHKey(d.SSHKeyPath); err != nil {
+		return nil, err
+	}
+
+	publicKey, err := os.ReadFile(d.SSHKeyPath + ".pub")
+	if err != nil {
+		return nil, err
+	}
+
+	return d.getClient().CreateSSHKey(d.MachineName, string(publicKey))
+}
+
+func (d *Driver) GetURL() (string, error) {
+	if err := drivers.MustBeRunning(d); err != nil {
+		return "", err
+	}
+
+	ip, err := d.GetIP()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("tcp://%s", net.JoinHostPort(ip, "2376")), nil
+}
+
+// GetIPs returns the public, private and IPv6 addresses of the server.
+func (d *Driver) GetIPs() ([]drivers.NetworkAddress, error) {
+	server, err := d.getClient().GetServer(d.ServerID)
+	if err != nil {
+		return nil, err
+	}
+	return serverAddresses(server), nil
+}
+
+func serverAddresses(server *Server) []drivers.NetworkAddress {
+	var addrs []drivers.NetworkAddress
+	addrs = drivers.AppendAddress(addrs, drivers.AddressPublic, server.PublicNet.IPv4.IP)
+	for _, network := range server.PrivateNet {
+		addrs = drivers.AppendAddress(addrs, drivers.AddressPrivate, network.IP)
+	}
+	return drivers.AppendAddress(addrs, drivers.AddressIPv6, serverIPv6(server.PublicNet.IPv6.IP))
+}
+
+// serverIPv6 returns the address the server gets in the IPv6 network
+// assigned to it, the first one.
+func serverIPv6(network string) string {
+	_, ipNet, err := net.ParseCIDR(network)
+	if err != nil {
+		return network
+	}
+	ip := ipNet.IP.To16()
+	ip[len(ip)-1] |= 1
+	return ip.String()
+}
+
+func (d *Driver) GetState() (state.State, error) {
+	server, err := d.getClient().GetServer(d.ServerID)
+	if err != nil {
+		if !isNotFound(err) {
+			return state.Error, err
+		}
+		return state.None, fmt.Errorf("machine %v not found", d.MachineName)
+	}
+	return serverState(server.Status), nil
+}
+
+func serverState(status string) state.State {
+	switch status {
+	case "initializing", "starting":
+		return state.Starting
+	case "running":
+		return state.Running
+	case "stopping":
+		return state.Stopping
+	case "off":
+		return state.Stopped
+	}
+	return state.None
+}
+
+func (d *Driver) Start() error {
+	return d.getClient().ServerAction(d.ServerID, "poweron")
+}
+
+func (d *Driver) Stop() error {
+	return d.getClient().ServerAction(d.ServerID, "shutdown")
+}
+
+func (d *Driver) Restart() error {
+	return d.getClient().ServerAction(d.ServerID, "reboot")
+}
+
+func (d *Driver) Kill() error {
+	return d.getClient().ServerAction(d.ServerID, "poweroff")
+}
+
+func (d *Driver) Remove() error {
+	client := d.getClient()
+	if d.ServerID != 0 {
+		if err := client.DeleteServer(d.ServerID); err != nil {
+			if !isNotFound(err) {
+				return err
+			}
+			log.Infof("Hetzner Cloud server doesn't exist, assuming it is already deleted")
+		}
+	}
+	if d.SSHKeyID != 0 {
+		if err := client.DeleteSSHKey(d.SSHKeyID); err != nil {
+			if !isNotFound(err) {
+				return err
+			}
+			log.Infof("Hetzner Cloud SSH key doesn't exist, assuming it is already deleted")
+		}
+	}
+	return nil
+}
+
+func (d *Driver) getClient() *Client {
+	return NewClient(d.APIToken)
+}
@@ -0,0 +1,108 @@
+package hetzner
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnmarshalJSON(t *testing.T) {
+	driver := NewDriver("", "")
+
+	// Unmarhsal driver configuration from JSON and args.
+	os.Args = append(os.Args, []string{"--hetzner-api-token", "test api token"}...)
+
+	driverBytes, err := json.Marshal(driver)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(driverBytes, driver))
+
+	// Make sure that config has been pulled in from envvars and args.
+	assert.Equal(t, "test api token", driver.APIToken)
+}
+
+func TestSetConfigFromFlags(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"hetzner-api-token": "TOKEN",
+			"hetzner-networks":  []string{"private"},
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	err := driver.SetConfigFromFlags(checkFlags)
+
+	assert.NoError(t, err)
+	assert.Empty(t, checkFlags.InvalidFlags)
+	assert.Equal(t, "cx22", driver.ServerType)
+	assert.Equal(t, "ubuntu-22.04", driver.Image)
+	assert.Equal(t, []string{"private"}, driver.Networks)
+
+	sshPort, err := driver.GetSSHPort()
+	assert.NoError(t, err)
+	assert.Equal(t, "root", driver.GetSSHUsername())
+	assert.Equal(t, 22, sshPort)
+}
+
+func TestSetConfigFromFlagsRequiresNetworksForPrivateNetwork(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"hetzner-api-token":           "TOKEN",
+			"hetzner-use-private-network": true,
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	assert.EqualError(t, driver.SetConfigFromFlags(checkFlags), "hetzner driver requires the --hetzner-networks option to use the private network")
+}
+
+func TestCreateRequest(t *testing.T) {
+	driver := NewDriver("default", "path")
+	driver.Location = "fsn1"
+
+	body, err := json.Marshal(driver.createRequest(""))
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), `"name":"default"`)
+	assert.Contains(t, string(body), `"server_type":"cx22"`)
+	assert.Contains(t, string(body), `"location":"fsn1"`)
+	assert.Contains(t, string(body), `"labels":{"docker-machine":"default"}`)
+	assert.NotContains(t, string(body), "user_data")
+	assert.NotContains(t, string(body), "placement_group")
+
+	body, err = json.Marshal(driver.createRequest("#cloud-config\n"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), `"user_data":"#cloud-config\n"`)
+}
+
+func TestServerState(t *testing.T) {
+	assert.Equal(t, state.Starting, serverState("initializing"))
+	assert.Equal(t, state.Running, serverState("running"))
+	assert.Equal(t, state.Stopping, serverState("stopping"))
+	assert.Equal(t, state.Stopped, serverState("off"))
+	assert.Equal(t, state.None, serverState("migrating"))
+}
+
+func TestServerAddresses(t *testing.T) {
+	var server Server
+	assert.NoError(t, json.Unmarshal([]byte(`{"id": 42, "public_net": {"ipv4": {"ip": "1.2.3.4"}, "ipv6": {"ip": "2001:db8::/64"}}, "private_net": [{"network": 7, "ip": "10.0.0.2"}]}`), &server))
+
+	assert.Equal(t, []drivers.NetworkAddress{
+		{Kind: drivers.AddressPublic, Address: "1.2.3.4"},
+		{Kind: drivers.AddressPrivate, Address: "10.0.0.2"},
+		{Kind: drivers.AddressIPv6, Address: "2001:db8::1"},
+	}, serverAddresses(&server))
+}
+
+func TestIsNotFound(t *testing.T) {
+	assert.True(t, isNotFound(&APIError{StatusCode: 404, Code: "not_found"}))
+	assert.False(t, isNotFound(&APIError{StatusCode: 401, Code: "unauthorized"}))
+	assert.False(t, isNotFound(errors.New("not found")))
+}
@@ -24,6 +24,15 @@ type Driver struct {
 	MacAddr              string
 	VLanID               int
 	DisableDynamicMemory bool
+	Generation           int
+	SecureBoot           bool
+	SecureBootTemplate   string
+	MinMemSize           int
+	MaxMemSize           int
+	NestedVirtualization bool
+	AdditionalVSwitches  []string
+
+	dryRun bool
 }
 
 const (
@@ -32,6 +41,8 @@ const (
 	defaultCPU                  = 1
 	defaultVLanID               = 0
 	defaultDisableDynamicMemory = false
+	defaultGeneration           = 1
+	defaultSecureBootTemplate   = "MicrosoftUEFICertificateAuthority"
 )
 
 // NewDriver creates a new Hyper-v driver with default settings.
@@ -41,6 +52,8 @@ func NewDriver(hostName, storePath string) *Driver {
 		MemSize:              defaultMemory,
 		CPU:                  defaultCPU,
 		DisableDynamicMemory: defaultDisableDynamicMemory,
+		Generation:           defaultGeneration,
+		SecureBootTemplate:   defaultSecureBootTemplate,
 		BaseDriver: &drivers.BaseDriver{
 			MachineName: hostName,
 			StorePath:   storePath,
@@ -48,6 +61,18 @@ func NewDriver(hostName, storePath string) *Driver {
 	}
 }
 
+// Capabilities returns the optional operations supported by the driver.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityStartStop,
+		drivers.CapabilityRestart,
+		drivers.CapabilityKill,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+		drivers.CapabilitySnapshots,
+	}
+}
+
 // GetCreateFlags registers the flags this driver adds to
 // "docker hosts create"
 func (d *Driver) GetCreateFlags() []mcnflag.Flag {
@@ -96,6 +121,43 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "Disable dynamic memory management setting",
 			EnvVar: "HYPERV_DISABLE_DYNAMIC_MEMORY",
 		},
+		mcnflag.IntFlag{
+			Name:   "hyperv-memory-minimum",
+			Usage:  "Minimum memory size the dynamic memory can shrink the host to in MB.",
+			EnvVar: "HYPERV_MEMORY_MINIMUM",
+		},
+		mcnflag.IntFlag{
+			Name:   "hyperv-memory-maximum",
+			Usage:  "Maximum memory size the dynamic memory can grow the host to in MB.",
+			EnvVar: "HYPERV_MEMORY_MAXIMUM",
+		},
+		mcnflag.IntFlag{
+			Name:   "hyperv-generation",
+			Usage:  "Generation of the VM, 1 for BIOS or 2 for UEFI firmware",
+			Value:  defaultGeneration,
+			EnvVar: "HYPERV_GENERATION",
+		},
+		mcnflag.BoolFlag{
+			Name:   "hyperv-secure-boot",
+			Usage:  "Enable secure boot on a generation 2 VM",
+			EnvVar: "HYPERV_SECURE_BOOT",
+		},
+		mcnflag.StringFlag{
+			Name:   "hyperv-secure-boot-template",
+			Usage:  "Secure boot template of a generation 2 VM",
+			Value:  defaultSecureBootTemplate,
+			EnvVar: "HYPERV_SECURE_BOOT_TEMPLATE",
+		},
+		mcnflag.BoolFlag{
+			Name:   "hyperv-nested-virtualization",
+			Usage:  "Expose the virtualization extensions of the CPU to the VM, disabling dynamic memory",
+			EnvVar: "HYPERV_NESTED_VIRTUALIZATION",
+		},
+		mcnflag.StringSliceFlag{
+			Name:   "hyperv-additional-virtual-switch",
+			Usage:  "Virtual switch to attach an additional network adapter to. Can be repeated.",
+			EnvVar: "HYPERV_ADDITIONAL_VIRTUAL_SWITCH",
+		},
 	}
 }
 
@@ -109,8 +171,39 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.VLanID = flags.Int("hyperv-vlan-id")
 	d.SSHUser = "docker"
 	d.DisableDynamicMemory = flags.Bool("hyperv-disable-dynamic-memory")
+	d.MinMemSize = flags.Int("hyperv-memory-minimum")
+	d.MaxMemSize = flags.Int("hyperv-memory-maximum")
+	d.Generation = flags.Int("hyperv-generation")
+	d.SecureBoot = flags.Bool("hyperv-secure-boot")
+	d.SecureBootTemplate = flags.String("hyperv-secure-boot-template")
+	d.NestedVirtualization = flags.Bool("hyperv-nested-virtualization")
+	d.AdditionalVSwitches = flags.StringSlice("hyperv-additional-virtual-switch")
 	d.SetSwarmConfigFromFlags(flags)
 
+	return d.checkVMOptions()
+}
+
+// checkVMOptions checks that the firmware and memory options can be combined.
+func (d *Driver) checkVMOptions() error {
+	if d.Generation != 1 && d.Generation != 2 {
+		return fmt.Errorf("invalid generation %d, must be 1 or 2", d.Generation)
+	}
+	if d.SecureBoot && d.Generation != 2 {
+		return fmt.Errorf("secure boot requires a generation 2 VM")
+	}
+
+	if d.MinMemSize == 0 && d.MaxMemSize == 0 {
+		return nil
+	}
+	if d.DisableDynamicMemory || d.NestedVirtualization {
+		return fmt.Errorf("minimum and maximum memory require dynamic memory, which is disabled by --hyperv-disable-dynamic-memory and --hyperv-nested-virtualization")
+	}
+	if d.MinMemSize > d.MemSize {
+		return fmt.Errorf("minimum memory %dMB is greater than the memory %dMB", d.MinMemSize, d.MemSize)
+	}
+	if d.MaxMemSize != 0 && d.MaxMemSize < d.MemSize {
+		return fmt.Errorf("maximum memory %dMB is less than the memory %dMB", d.MaxMemSize, d.MemSize)
+	}
 	return nil
 }
 
@@ -157,6 +250,11 @@ func (d *Driver) GetState() (state.State, error) {
 	}
 }
 
+// SetDryRun makes PreCreateCheck skip downloading the boot2docker ISO.
+func (d *Driver) SetDryRun(dryRun bool) {
+	d.dryRun = dryRun
+}
+
 // PreCreateCheck checks that the machine creation process can be started safely.
 func (d *Driver) PreCreateCheck() error {
 	// Check that powershell was found
@@ -182,6 +280,13 @@ func (d *Driver) PreCreateCheck() error {
 	if _, err := d.chooseVirtualSwitch(); err != nil {
 		return err
 	}
+	if err := d.checkAdditionalVirtualSwitches(); err != nil {
+		return err
+	}
+
+	if d.dryRun {
+		return nil
+	}
 
 	// Downloading boot2docker to cache should be done here to make sure
 	// that a download failure will not leave a machine half created.
@@ -218,15 +323,29 @@ func (d *Driver) Create() error {
 		d.MachineName,
 		"-Path", fmt.Sprintf("'%s'", d.ResolveStorePath(".")),
 		"-SwitchName", quote(virtualSwitch),
-		"-MemoryStartupBytes", toMb(d.MemSize)); err != nil {
+		"-MemoryStartupBytes", toMb(d.MemSize),
+		"-Generation", fmt.Sprintf("%d", d.Generation)); err != nil {
 		return err
 	}
-	if d.DisableDynamicMemory {
+	if d.DisableDynamicMemory || d.NestedVirtualization {
 		if err := cmd("Hyper-V\\Set-VMMemory",
 			"-VMName", d.MachineName,
 			"-DynamicMemoryEnabled", "$false"); err != nil {
 			return err
 		}
+	} else if d.MinMemSize > 0 || d.MaxMemSize > 0 {
+		args := []string{"Hyper-V\\Set-VMMemory",
+			"-VMName", d.MachineName,
+			"-DynamicMemoryEnabled", "$true"}
+		if d.MinMemSize > 0 {
+			args = append(args, "-MinimumBytes", toMb(d.MinMemSize))
+		}
+		if d.MaxMemSize > 0 {
+			args = append(args, "-MaximumBytes", toMb(d.MaxMemSize))
+		}
+		if err := cmd(args...); err != nil {
+			return err
+		}
 	}
 
 	if d.CPU > 1 {
@@ -237,6 +356,20 @@ func (d *Driver) Create() error {
 		}
 	}
 
+	if d.NestedVirtualization {
+		if err := cmd("Hyper-V\\Set-VMProcessor",
+			d.MachineName,
+			"-ExposeVirtualizationExtensions", "$true"); err != nil {
+			return err
+		}
+		// the nested VMs reach the network with their own MAC addresses
+		if err := cmd("Hyper-V\\Set-VMNetworkAdapter",
+			"-VMName", d.MachineName,
+			"-MacAddressSpoofing", "On"); err != nil {
+			return err
+		}
+	}
+
 	if d.MacAddr != "" {
 		if err := cmd("Hyper-V\\Set-VMNetworkAdapter",
 			"-VMName", d.MachineName,
@@ -254,7 +387,25 @@ func (d *Driver) Create() error {
 		}
 	}
 
-	if err := cmd("Hyper-V\\Set-VMDvdDrive",
+	for _, vswitch := range d.AdditionalVSwitches {
+		if err := cmd("Hyper-V\\Add-VMNetworkAdapter",
+			"-VMName", d.MachineName,
+			"-SwitchName", quote(vswitch)); err != nil {
+			return err
+		}
+	}
+
+	if d.Generation == 2 {
+		// generation 2 VMs come without a DVD drive and boot from the network first
+		if err := cmd("Hyper-V\\Add-VMDvdDrive",
+			"-VMName", d.MachineName,
+			"-Path", quote(d.ResolveStorePath("boot2docker.iso"))); err != nil {
+			return err
+		}
+		if err := d.setFirmware(); err != nil {
+			return err
+		}
+	} else if err := cmd("Hyper-V\\Set-VMDvdDrive",
 		"-VMName", d.MachineName,
 		"-Path", quote(d.ResolveStorePath("boot2docker.iso"))); err != nil {
 		return err
@@ -309,6 +460,49 @@ func (d *Driver) chooseVirtualSwitch() (string, error) {
 	return d.VSwitch, nil
 }
 
+// setFirmware boots a generation 2 VM from its DVD drive, with secure boot
+// enabled with the template or disabled.
+func (d *Driver) setFirmware() error {
+	args := []string{"Hyper-V\\Set-VMFirmware",
+		"-VMName", d.MachineName,
+		"-FirstBootDevice", fmt.Sprintf("(Hyper-V\\Get-VMDvdDrive -VMName %s)", d.MachineName)}
+	if d.SecureBoot {
+		args = append(args, "-EnableSecureBoot", "On", "-SecureBootTemplate", quote(d.SecureBootTemplate))
+	} else {
+		args = append(args, "-EnableSecureBoot", "Off")
+	}
+	return cmd(args...)
+}
+
+// checkAdditionalVirtualSwitches checks that the additional virtual switches exist
+func (d *Driver) checkAdditionalVirtualSwitches() error {
+	if len(d.AdditionalVSwitches) == 0 {
+		return nil
+	}
+
+	stdout, err := cmdOut("(Hyper-V\\Get-VMSwitch).Name")
+	if err != nil {
+		return err
+	}
+
+	switches := parseLines(stdout)
+	for _, vswitch := range d.AdditionalVSwitches {
+		if !stringInSlice(vswitch, switches) {
+			return fmt.Errorf("vswitch %q not found", vswitch)
+		}
+	}
+	return nil
+}
+
+func stringInSlice(value string, list []string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
 // waitForIP waits until the host has a valid IP
 func (d *Driver) waitForIP() (string, error) {
 	log.Infof("Waiting for host to start...")
@@ -441,7 +635,11 @@ func (d *Driver) publicSSHKeyPath() string {
 
 // generateDiskImage creates a small fixed vhd, put the tar in, convert to dynamic, then resize
 func (d *Driver) generateDiskImage() (string, error) {
+	// generation 2 VMs only attach VHDX disks
 	diskImage := d.ResolveStorePath("disk.vhd")
+	if d.Generation == 2 {
+		diskImage = d.ResolveStorePath("disk.vhdx")
+	}
 	fixed := d.ResolveStorePath("fixed.vhd")
 
 	// Resizing vhds requires administrator privileges
@@ -2,6 +2,7 @@ package hyperv
 
 import (
 	"testing"
+	"time"
 
 	"github.com/rancher/machine/libmachine/drivers"
 	"github.com/stretchr/testify/assert"
@@ -32,6 +33,13 @@ func TestSetConfigFromDefaultFlags(t *testing.T) {
 	assert.Equal(t, defaultVLanID, driver.VLanID)
 	assert.Equal(t, "docker", driver.GetSSHUsername())
 	assert.Equal(t, defaultDisableDynamicMemory, driver.DisableDynamicMemory)
+	assert.Equal(t, defaultGeneration, driver.Generation)
+	assert.False(t, driver.SecureBoot)
+	assert.Equal(t, defaultSecureBootTemplate, driver.SecureBootTemplate)
+	assert.Equal(t, 0, driver.MinMemSize)
+	assert.Equal(t, 0, driver.MaxMemSize)
+	assert.False(t, driver.NestedVirtualization)
+	assert.Empty(t, driver.AdditionalVSwitches)
 }
 
 func TestSetConfigFromCustomFlags(t *testing.T) {
@@ -39,14 +47,19 @@ func TestSetConfigFromCustomFlags(t *testing.T) {
 
 	checkFlags := &drivers.CheckDriverOptions{
 		FlagsValues: map[string]interface{}{
-			"hyperv-boot2docker-url":        "B2D_URL",
-			"hyperv-virtual-switch":         "TheSwitch",
-			"hyperv-disk-size":              100000,
-			"hyperv-memory":                 4096,
-			"hyperv-cpu-count":              4,
-			"hyperv-static-macaddress":      "00:0a:95:9d:68:16",
-			"hyperv-vlan-id":                2,
-			"hyperv-disable-dynamic-memory": true,
+			"hyperv-boot2docker-url":           "B2D_URL",
+			"hyperv-virtual-switch":            "TheSwitch",
+			"hyperv-disk-size":                 100000,
+			"hyperv-memory":                    4096,
+			"hyperv-cpu-count":                 4,
+			"hyperv-static-macaddress":         "00:0a:95:9d:68:16",
+			"hyperv-vlan-id":                   2,
+			"hyperv-disable-dynamic-memory":    true,
+			"hyperv-generation":                2,
+			"hyperv-secure-boot":               true,
+			"hyperv-secure-boot-template":      "MicrosoftWindows",
+			"hyperv-nested-virtualization":     true,
+			"hyperv-additional-virtual-switch": []string{"Internal", "Private"},
 		},
 		CreateFlags: driver.GetCreateFlags(),
 	}
@@ -68,4 +81,68 @@ func TestSetConfigFromCustomFlags(t *testing.T) {
 	assert.Equal(t, 2, driver.VLanID)
 	assert.Equal(t, "docker", driver.GetSSHUsername())
 	assert.Equal(t, true, driver.DisableDynamicMemory)
+	assert.Equal(t, 2, driver.Generation)
+	assert.True(t, driver.SecureBoot)
+	assert.Equal(t, "MicrosoftWindows", driver.SecureBootTemplate)
+	assert.True(t, driver.NestedVirtualization)
+	assert.Equal(t, []string{"Internal", "Private"}, driver.AdditionalVSwitches)
+}
+
+func TestSetConfigFromDynamicMemoryFlags(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"hyperv-memory":         2048,
+			"hyperv-memory-minimum": 512,
+			"hyperv-memory-maximum": 8192,
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	err := driver.SetConfigFromFlags(checkFlags)
+	assert.NoError(t, err)
+	assert.Empty(t, checkFlags.InvalidFlags)
+
+	assert.Equal(t, 512, driver.MinMemSize)
+	assert.Equal(t, 8192, driver.MaxMemSize)
+}
+
+func TestCheckVMOptions(t *testing.T) {
+	tests := []struct {
+		description string
+		driver      *Driver
+		err         string
+	}{
+		{"generation 1", &Driver{Generation: 1, MemSize: 1024}, ""},
+		{"generation 2 with secure boot", &Driver{Generation: 2, SecureBoot: true, MemSize: 1024}, ""},
+		{"invalid generation", &Driver{Generation: 3, MemSize: 1024}, "invalid generation 3, must be 1 or 2"},
+		{"secure boot on generation 1", &Driver{Generation: 1, SecureBoot: true, MemSize: 1024}, "secure boot requires a generation 2 VM"},
+		{"minimum memory only", &Driver{Generation: 1, MemSize: 1024, MinMemSize: 512}, ""},
+		{"maximum memory only", &Driver{Generation: 1, MemSize: 1024, MaxMemSize: 4096}, ""},
+		{"minimum above memory", &Driver{Generation: 1, MemSize: 1024, MinMemSize: 2048}, "minimum memory 2048MB is greater than the memory 1024MB"},
+		{"maximum below memory", &Driver{Generation: 1, MemSize: 1024, MaxMemSize: 512}, "maximum memory 512MB is less than the memory 1024MB"},
+		{"dynamic memory disabled", &Driver{Generation: 1, MemSize: 1024, MaxMemSize: 4096, DisableDynamicMemory: true}, "minimum and maximum memory require dynamic memory, which is disabled by --hyperv-disable-dynamic-memory and --hyperv-nested-virtualization"},
+		{"nested virtualization", &Driver{Generation: 1, MemSize: 1024, MinMemSize: 512, NestedVirtualization: true}, "minimum and maximum memory require dynamic memory, which is disabled by --hyperv-disable-dynamic-memory and --hyperv-nested-virtualization"},
+	}
+
+	for _, test := range tests {
+		err := test.driver.checkVMOptions()
+		if test.err == "" {
+			assert.NoError(t, err, test.description)
+		} else {
+			assert.EqualError(t, err, test.err, test.description)
+		}
+	}
+}
+
+func TestParseSnapshots(t *testing.T) {
+	snapshots, err := parseSnapshots("6c3a2f59-4f3e-4a69-9b3c-2a1f0be6f4c1\tbase\t2024-05-02T10:04:05.1234567Z\r\n\r\n")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []drivers.Snapshot{{
+		ID:      "6c3a2f59-4f3e-4a69-9b3c-2a1f0be6f4c1",
+		Name:    "base",
+		Created: time.Date(2024, 5, 2, 10, 4, 5, 123456700, time.UTC),
+	}}, snapshots)
 }
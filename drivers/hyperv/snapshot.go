@@ -0,0 +1,76 @@
+package hyperv
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rancher/machine/libmachine/drivers"
+)
+
+// snapshotFormat prints each checkpoint piped to it on a line of its ID,
+// name and creation time, separated by tabs.
+const snapshotFormat = `ForEach-Object { "{0}` + "`t" + `{1}` + "`t" + `{2}" -f $_.Id, $_.Name, $_.CreationTime.ToUniversalTime().ToString('o') }`
+
+// CreateSnapshot checkpoints the VM.
+func (d *Driver) CreateSnapshot(name string) (drivers.Snapshot, error) {
+	stdout, err := cmdOut("Hyper-V\\Checkpoint-VM", "-Name", d.MachineName, "-SnapshotName", quote(name), "-Passthru", "|", snapshotFormat)
+	if err != nil {
+		return drivers.Snapshot{}, err
+	}
+
+	snapshots, err := parseSnapshots(stdout)
+	if err != nil {
+		return drivers.Snapshot{}, err
+	}
+	if len(snapshots) != 1 {
+		return drivers.Snapshot{}, fmt.Errorf("unable to find checkpoint %s of %s", name, d.MachineName)
+	}
+	return snapshots[0], nil
+}
+
+// ListSnapshots returns the checkpoints of the VM.
+func (d *Driver) ListSnapshots() ([]drivers.Snapshot, error) {
+	stdout, err := cmdOut("Hyper-V\\Get-VMSnapshot", "-VMName", d.MachineName, "|", snapshotFormat)
+	if err != nil {
+		return nil, err
+	}
+	return parseSnapshots(stdout)
+}
+
+func parseSnapshots(stdout string) ([]drivers.Snapshot, error) {
+	snapshots := []drivers.Snapshot{}
+	for _, line := range parseLines(stdout) {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("unexpected checkpoint %q", line)
+		}
+		created, err := time.Parse(time.RFC3339Nano, fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("unexpected creation time of checkpoint %q: %s", line, err)
+		}
+		snapshots = append(snapshots, drivers.Snapshot{ID: fields[0], Name: fields[1], Created: created})
+	}
+	return snapshots, nil
+}
+
+// RestoreSnapshot applies the checkpoint of the ID to the VM. The restored
+// checkpoint is printed back, none meaning the VM has no checkpoint of the ID.
+func (d *Driver) RestoreSnapshot(id string) error {
+	stdout, err := cmdOut("Hyper-V\\Get-VMSnapshot", "-VMName", d.MachineName, "|", "Where-Object", "{", "$_.Id", "-eq", quote(id), "}", "|", "Hyper-V\\Restore-VMSnapshot", "-Confirm:$false", "-Passthru", "|", snapshotFormat)
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := parseSnapshots(stdout)
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		return fmt.Errorf("unable to find checkpoint %s of %s", id, d.MachineName)
+	}
+	return nil
+}
@@ -0,0 +1,309 @@
+package ibmcloud
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rancher/machine/libmachine/version"
+)
+
+var (
+	// apiEndpoint is the template of the VPC API endpoints, replaced by the
+	// tests.
+	apiEndpoint = "https://{region}.iaas.cloud.ibm.com"
+	// iamEndpoint is the IAM API the API key is exchanged with for a token,
+	// replaced by the tests.
+	iamEndpoint = "https://iam.cloud.ibm.com"
+)
+
+// apiVersion is the date of the VPC API version the calls are made to.
+const apiVersion = "2024-04-30"
+
+// Client makes the calls to the IBM Cloud VPC API the driver needs, in a
+// region.
+type Client struct {
+	apiKey     string
+	endpoint   string
+	token      string
+	httpClient *http.Client
+}
+
+func NewClient(apiKey, region string) *Client {
+	return &Client{
+		apiKey:     apiKey,
+		endpoint:   strings.ReplaceAll(apiEndpoint, "{region}", region),
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// APIError is an error answered by the IBM Cloud VPC API.
+type APIError struct {
+	StatusCode int
+	Errors     []ErrorDetail `json:"errors"`
+}
+
+type ErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = fmt.Sprintf("%s (%s)", err.Message, err.Code)
+	}
+	return "ibmcloud: " + strings.Join(messages, ", ")
+}
+
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+// Reference refers to another resource, by ID or name.
+type Reference struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+type NetworkInterface struct {
+	ID        string     `json:"id,omitempty"`
+	Subnet    *Reference `json:"subnet,omitempty"`
+	PrimaryIP *struct {
+		Address string `json:"address"`
+	} `json:"primary_ip,omitempty"`
+}
+
+type Instance struct {
+	ID                      string            `json:"id"`
+	Name                    string            `json:"name"`
+	Status                  string            `json:"status"`
+	PrimaryNetworkInterface *NetworkInterface `json:"primary_network_interface"`
+}
+
+// PrivateIP returns the address of the instance on its subnet, if it has
+// one yet.
+func (i *Instance) PrivateIP() string {
+	if i.PrimaryNetworkInterface == nil || i.PrimaryNetworkInterface.PrimaryIP == nil || i.PrimaryNetworkInterface.PrimaryIP.Address == "0.0.0.0" {
+		return ""
+	}
+	return i.PrimaryNetworkInterface.PrimaryIP.Address
+}
+
+type InstanceCreateRequest struct {
+	Name                    string           `json:"name"`
+	Profile                 Reference        `json:"profile"`
+	Zone                    Reference        `json:"zone"`
+	Image                   Reference        `json:"image"`
+	Keys                    []Reference      `json:"keys"`
+	PrimaryNetworkInterface NetworkInterface `json:"primary_network_interface"`
+	ResourceGroup           *Reference       `json:"resource_group,omitempty"`
+	UserData                string           `json:"user_data,omitempty"`
+}
+
+type FloatingIP struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+}
+
+type Subnet struct {
+	ID   string    `json:"id"`
+	Zone Reference `json:"zone"`
+}
+
+// authenticate exchanges the API key for an IAM access token.
+func (c *Client) authenticate() error {
+	form := url.Values{
+		"grant_type": {"urn:ibm:params:oauth:grant-type:apikey"},
+		"apikey":     {c.apiKey},
+	}
+	resp, err := c.httpClient.PostForm(iamEndpoint+"/identity/token", form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var reply struct {
+		AccessToken  string `json:"access_token"`
+		ErrorMessage string `json:"errorMessage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil && resp.StatusCode == http.StatusOK {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		if reply.ErrorMessage == "" {
+			reply.ErrorMessage = resp.Status
+		}
+		return fmt.Errorf("ibmcloud: %s", reply.ErrorMessage)
+	}
+	c.token = reply.AccessToken
+	return nil
+}
+
+func (c *Client) do(method, path string, query url.Values, body, reply interface{}) error {
+	if c.token == "" {
+		if err := c.authenticate(); err != nil {
+			return err
+		}
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("version", apiVersion)
+	query.Set("generation", "2")
+
+	req, err := http.NewRequest(method, c.endpoint+"/v1"+path+"?"+query.Encode(), reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("docker-machine/v%d", version.APIVersion))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 400 {
+		apiErr := &APIError{}
+		if err := json.Unmarshal(data, apiErr); err != nil || len(apiErr.Errors) == 0 {
+			apiErr.Errors = []ErrorDetail{{Code: "unknown", Message: resp.Status}}
+		}
+		apiErr.StatusCode = resp.StatusCode
+		return apiErr
+	}
+
+	if reply == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, reply)
+}
+
+func (c *Client) GetZone(region, zone string) error {
+	return c.do(http.MethodGet, "/regions/"+region+"/zones/"+zone, nil, nil, nil)
+}
+
+func (c *Client) GetProfile(name string) error {
+	return c.do(http.MethodGet, "/instance/profiles/"+name, nil, nil, nil)
+}
+
+func (c *Client) GetSubnet(id string) (*Subnet, error) {
+	var reply Subnet
+	if err := c.do(http.MethodGet, "/subnets/"+id, nil, nil, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+// FindImage returns the ID of the image with the name, or the image with
+// the ID.
+func (c *Client) FindImage(nameOrID string) (string, error) {
+	var reply struct {
+		Images []Reference `json:"images"`
+	}
+	if err := c.do(http.MethodGet, "/images", url.Values{"name": {nameOrID}}, nil, &reply); err != nil {
+		return "", err
+	}
+	if len(reply.Images) > 0 {
+		return reply.Images[0].ID, nil
+	}
+
+	var image Reference
+	if err := c.do(http.MethodGet, "/images/"+nameOrID, nil, nil, &image); err != nil {
+		if isNotFound(err) {
+			return "", fmt.Errorf("ibmcloud: no image %s", nameOrID)
+		}
+		return "", err
+	}
+	return image.ID, nil
+}
+
+func (c *Client) CreateKey(name, publicKey string, resourceGroup *Reference) (*Reference, error) {
+	var reply Reference
+	body := map[string]interface{}{"name": name, "public_key": publicKey, "type": "rsa"}
+	if resourceGroup != nil {
+		body["resource_group"] = resourceGroup
+	}
+	if err := c.do(http.MethodPost, "/keys", nil, body, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+func (c *Client) DeleteKey(id string) error {
+	return c.do(http.MethodDelete, "/keys/"+id, nil, nil, nil)
+}
+
+func (c *Client) CreateInstance(request *InstanceCreateRequest) (*Instance, error) {
+	var reply Instance
+	if err := c.do(http.MethodPost, "/instances", nil, request, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+func (c *Client) GetInstance(id string) (*Instance, error) {
+	var reply Instance
+	if err := c.do(http.MethodGet, "/instances/"+id, nil, nil, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+func (c *Client) DeleteInstance(id string) error {
+	return c.do(http.MethodDelete, "/instances/"+id, nil, nil, nil)
+}
+
+// InstanceAction runs an action, e.g. "start", on the instance.
+func (c *Client) InstanceAction(id, action string, force bool) error {
+	body := map[string]interface{}{"type": action, "force": force}
+	return c.do(http.MethodPost, "/instances/"+id+"/actions", nil, body, nil)
+}
+
+// CreateFloatingIP allocates a floating IP bound to the network interface.
+func (c *Client) CreateFloatingIP(name, networkInterfaceID string, resourceGroup *Reference) (*FloatingIP, error) {
+	var reply FloatingIP
+	body := map[string]interface{}{"name": name, "target": Reference{ID: networkInterfaceID}}
+	if resourceGroup != nil {
+		body["resource_group"] = resourceGroup
+	}
+	if err := c.do(http.MethodPost, "/floating_ips", nil, body, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+func (c *Client) GetFloatingIP(id string) (*FloatingIP, error) {
+	var reply FloatingIP
+	if err := c.do(http.MethodGet, "/floating_ips/"+id, nil, nil, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+func (c *Client) DeleteFloatingIP(id string) error {
+	return c.do(http.MethodDelete, "/floating_ips/"+id, nil, nil, nil)
+}
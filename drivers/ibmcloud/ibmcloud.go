@@ -0,0 +1,462 @@
+package ibmcloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	rpcdriver "github.com/rancher/machine/libmachine/drivers/rpc"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/rancher/machine/libmachine/ssh"
+	"github.com/rancher/machine/libmachine/state"
+)
+
+type Driver struct {
+	*drivers.BaseDriver
+	APIKey           string
+	InstanceID       string
+	Zone             string
+	Profile          string
+	Image            string
+	SubnetID         string
+	ResourceGroupID  string
+	FloatingIP       bool
+	UserDataFile     string
+	KeyID            string
+	FloatingIPID     string
+	PrivateIPAddress string
+}
+
+const (
+	defaultSSHPort = 22
+	defaultSSHUser = "root"
+	defaultZone    = "us-south-1"
+	defaultProfile = "bx2-2x8"
+	defaultImage   = "ibm-ubuntu-22-04-4-minimal-amd64-1"
+)
+
+// Capabilities returns the optional operations supported by the driver.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityStartStop,
+		drivers.CapabilityRestart,
+		drivers.CapabilityKill,
+		drivers.CapabilityPrivateIP,
+		drivers.CapabilityCustomSSHPort,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+	}
+}
+
+// GetCreateFlags registers the flags this driver adds to
+// "docker hosts create"
+func (d *Driver) GetCreateFlags() []mcnflag.Flag {
+	return []mcnflag.Flag{
+		mcnflag.StringFlag{
+			EnvVar:    "IC_API_KEY",
+			Name:      "ibmcloud-api-key",
+			Usage:     "IBM Cloud API key",
+			Sensitive: true,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "IBMCLOUD_SSH_USER",
+			Name:   "ibmcloud-ssh-user",
+			Usage:  "SSH username",
+			Value:  defaultSSHUser,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "IBMCLOUD_SSH_PORT",
+			Name:   "ibmcloud-ssh-port",
+			Usage:  "SSH port",
+			Value:  defaultSSHPort,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "IBMCLOUD_ZONE",
+			Name:   "ibmcloud-zone",
+			Usage:  "IBM Cloud VPC zone, whose region the instance is created in",
+			Value:  defaultZone,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "IBMCLOUD_PROFILE",
+			Name:   "ibmcloud-profile",
+			Usage:  "IBM Cloud VPC instance profile",
+			Value:  defaultProfile,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "IBMCLOUD_IMAGE",
+			Name:   "ibmcloud-image",
+			Usage:  "name or ID of the IBM Cloud VPC image",
+			Value:  defaultImage,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "IBMCLOUD_SUBNET_ID",
+			Name:   "ibmcloud-subnet-id",
+			Usage:  "ID of the subnet of the instance, in its zone",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "IBMCLOUD_RESOURCE_GROUP_ID",
+			Name:   "ibmcloud-resource-group-id",
+			Usage:  "ID of the resource group of the instance (default the one of the account)",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "IBMCLOUD_NO_FLOATING_IP",
+			Name:   "ibmcloud-no-floating-ip",
+			Usage:  "do not allocate a floating IP to the instance, reached at its private IP",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "IBMCLOUD_USERDATA",
+			Name:   "ibmcloud-userdata",
+			Usage:  "path to file with cloud-init user-data",
+		},
+	}
+}
+
+func NewDriver(hostName, storePath string) *Driver {
+	return &Driver{
+		Zone:       defaultZone,
+		Profile:    defaultProfile,
+		Image:      defaultImage,
+		FloatingIP: true,
+		BaseDriver: &drivers.BaseDriver{
+			MachineName: hostName,
+			StorePath:   storePath,
+		},
+	}
+}
+
+func (d *Driver) GetSSHHostname() (string, error) {
+	return d.GetIP()
+}
+
+// DriverName returns the name of the driver
+func (d *Driver) DriverName() string {
+	return "ibmcloud"
+}
+
+// UnmarshalJSON loads driver config from JSON. This function is used by the RPCServerDriver that wraps
+// all drivers as a means of populating an already-initialized driver with new configuration.
+// See `RPCServerDriver.SetConfigRaw`.
+func (d *Driver) UnmarshalJSON(data []byte) error {
+	// Unmarshal driver config into an aliased type to prevent infinite recursion on UnmarshalJSON.
+	type targetDriver Driver
+
+	// Copy data from `d` to `target` before unmarshalling. This will ensure that already-initialized values
+	// from `d` that are left untouched during unmarshal (like functions) are preserved.
+	target := targetDriver(*d)
+
+	if err := json.Unmarshal(data, &target); err != nil {
+		return fmt.Errorf("error unmarshalling driver config from JSON: %w", err)
+	}
+
+	// Copy unmarshalled data back to `d`.
+	*d = Driver(target)
+
+	// Make sure to reload values that are subject to change from envvars and os.Args.
+	driverOpts, err := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	if err != nil {
+		return err
+	}
+	if _, ok := driverOpts.Values["ibmcloud-api-key"]; ok {
+		d.APIKey = driverOpts.String("ibmcloud-api-key")
+	}
+
+	return nil
+}
+
+func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
+	d.APIKey = flags.String("ibmcloud-api-key")
+	d.Zone = flags.String("ibmcloud-zone")
+	d.Profile = flags.String("ibmcloud-profile")
+	d.Image = flags.String("ibmcloud-image")
+	d.SubnetID = flags.String("ibmcloud-subnet-id")
+	d.ResourceGroupID = flags.String("ibmcloud-resource-group-id")
+	d.FloatingIP = !flags.Bool("ibmcloud-no-floating-ip")
+	d.UserDataFile = flags.String("ibmcloud-userdata")
+	d.SSHUser = flags.String("ibmcloud-ssh-user")
+	d.SSHPort = flags.Int("ibmcloud-ssh-port")
+
+	d.SetSwarmConfigFromFlags(flags)
+
+	if d.APIKey == "" {
+		return fmt.Errorf("ibmcloud driver requires the --ibmcloud-api-key option")
+	}
+	if d.SubnetID == "" {
+		return fmt.Errorf("ibmcloud driver requires the --ibmcloud-subnet-id option")
+	}
+	if d.region() == "" {
+		return fmt.Errorf("ibmcloud zone must be the one of a region, e.g. us-south-1, got %q", d.Zone)
+	}
+
+	return nil
+}
+
+// region returns the region of the zone, e.g. us-south for us-south-1.
+func (d *Driver) region() string {
+	i := strings.LastIndex(d.Zone, "-")
+	if i <= 0 {
+		return ""
+	}
+	return d.Zone[:i]
+}
+
+func (d *Driver) PreCreateCheck() error {
+	if d.UserDataFile != "" {
+		if _, err := os.Stat(d.UserDataFile); os.IsNotExist(err) {
+			return fmt.Errorf("user-data file %s could not be found", d.UserDataFile)
+		}
+	}
+
+	client := d.getClient()
+	if err := client.GetZone(d.region(), d.Zone); err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("ibmcloud requires a valid zone")
+		}
+		return err
+	}
+	if err := client.GetProfile(d.Profile); err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("ibmcloud requires a valid instance profile")
+		}
+		return err
+	}
+	if _, err := client.FindImage(d.Image); err != nil {
+		return err
+	}
+
+	subnet, err := client.GetSubnet(d.SubnetID)
+	if err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("ibmcloud subnet %s doesn't exist in region %s", d.SubnetID, d.region())
+		}
+		return err
+	}
+	if subnet.Zone.Name != d.Zone {
+		return fmt.Errorf("ibmcloud subnet %s is in zone %s, not %s", d.SubnetID, subnet.Zone.Name, d.Zone)
+	}
+
+	return nil
+}
+
+func (d *Driver) resourceGroup() *Reference {
+	if d.ResourceGroupID == "" {
+		return nil
+	}
+	return &Reference{ID: d.ResourceGroupID}
+}
+
+func (d *Driver) Create() error {
+	client := d.getClient()
+
+	image, err := client.FindImage(d.Image)
+	if err != nil {
+		return err
+	}
+
+	createRequest, err := d.createRequest(image)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Creating SSH key...")
+
+	d.SSHKeyPath = d.GetSSHKeyPath()
+	if err := ssh.GenerateSSHKey(d.SSHKeyPath); err != nil {
+		return err
+	}
+	publicKey, err := os.ReadFile(d.SSHKeyPath + ".pub")
+	if err != nil {
+		return err
+	}
+	key, err := client.CreateKey(d.MachineName, strings.TrimSpace(string(publicKey)), d.resourceGroup())
+	if err != nil {
+		return err
+	}
+	d.KeyID = key.ID
+	createRequest.Keys = []Reference{{ID: key.ID}}
+
+	log.Infof("Creating IBM Cloud VPC instance...")
+
+	instance, err := client.CreateInstance(createRequest)
+	if err != nil {
+		return d.removeAfter(err)
+	}
+	d.InstanceID = instance.ID
+
+	log.Info("Waiting for the instance to be running...")
+	for {
+		instance, err = client.GetInstance(d.InstanceID)
+		if err != nil {
+			return d.removeAfter(err)
+		}
+		if instance.Status == "failed" {
+			return d.removeAfter(fmt.Errorf("ibmcloud instance %s failed to start", d.InstanceID))
+		}
+
+		d.PrivateIPAddress = instance.PrivateIP()
+
+		if instance.Status == "running" && d.PrivateIPAddress != "" {
+			break
+		}
+
+		time.Sleep(5 * time.Second)
+	}
+
+	d.IPAddress = d.PrivateIPAddress
+	if d.FloatingIP {
+		log.Infof("Allocating a floating IP...")
+		floatingIP, err := client.CreateFloatingIP(d.MachineName, instance.PrimaryNetworkInterface.ID, d.resourceGroup())
+		if err != nil {
+			return d.removeAfter(err)
+		}
+		d.FloatingIPID = floatingIP.ID
+		d.IPAddress = floatingIP.Address
+	}
+
+	log.Debugf("Created IBM Cloud VPC instance ID %s, IP address %s, Private IP address %s",
+		instance.ID,
+		d.IPAddress,
+		d.PrivateIPAddress)
+
+	return nil
+}
+
+// createRequest returns the request creating the instance of the image,
+// without its SSH key.
+func (d *Driver) createRequest(image string) (*InstanceCreateRequest, error) {
+	createRequest := &InstanceCreateRequest{
+		Name:                    d.MachineName,
+		Profile:                 Reference{Name: d.Profile},
+		Zone:                    Reference{Name: d.Zone},
+		Image:                   Reference{ID: image},
+		PrimaryNetworkInterface: NetworkInterface{Subnet: &Reference{ID: d.SubnetID}},
+		ResourceGroup:           d.resourceGroup(),
+	}
+
+	if d.UserDataFile != "" {
+		buf, err := os.ReadFile(d.UserDataFile)
+		if err != nil {
+			return nil, err
+		}
+		createRequest.UserData = string(buf)
+	}
+
+	return createRequest, nil
+}
+
+func (d *Driver) removeAfter(err error) error {
+	if removeErr := d.Remove(); removeErr != nil {
+		return fmt.Errorf("failed to create machine due to error: %v. Removing instance: %v", err, removeErr)
+	}
+	return err
+}
+
+func (d *Driver) GetURL() (string, error) {
+	if err := drivers.MustBeRunning(d); err != nil {
+		return "", err
+	}
+
+	ip, err := d.GetIP()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("tcp://%s", net.JoinHostPort(ip, "2376")), nil
+}
+
+// GetIPs returns the floating and private addresses of the instance.
+func (d *Driver) GetIPs() ([]drivers.NetworkAddress, error) {
+	client := d.getClient()
+	instance, err := client.GetInstance(d.InstanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []drivers.NetworkAddress
+	if d.FloatingIPID != "" {
+		floatingIP, err := client.GetFloatingIP(d.FloatingIPID)
+		if err != nil {
+			return nil, err
+		}
+		addrs = drivers.AppendAddress(addrs, drivers.AddressPublic, floatingIP.Address)
+	}
+	addrs = drivers.AppendAddress(addrs, drivers.AddressPrivate, instance.PrivateIP())
+
+	return addrs, nil
+}
+
+func (d *Driver) GetState() (state.State, error) {
+	instance, err := d.getClient().GetInstance(d.InstanceID)
+	if err != nil {
+		if !isNotFound(err) {
+			return state.Error, err
+		}
+		return state.None, fmt.Errorf("machine %v not found", d.MachineName)
+	}
+	return instanceState(instance.Status), nil
+}
+
+func instanceState(status string) state.State {
+	switch status {
+	case "pending", "starting", "restarting":
+		return state.Starting
+	case "running":
+		return state.Running
+	case "stopping":
+		return state.Stopping
+	case "stopped":
+		return state.Stopped
+	case "failed":
+		return state.Error
+	}
+	return state.None
+}
+
+func (d *Driver) Start() error {
+	return d.getClient().InstanceAction(d.InstanceID, "start", false)
+}
+
+func (d *Driver) Stop() error {
+	return d.getClient().InstanceAction(d.InstanceID, "stop", false)
+}
+
+func (d *Driver) Restart() error {
+	return d.getClient().InstanceAction(d.InstanceID, "reboot", false)
+}
+
+func (d *Driver) Kill() error {
+	return d.getClient().InstanceAction(d.InstanceID, "stop", true)
+}
+
+// Remove releases the floating IP of the instance, then deletes the
+// instance and its SSH key.
+func (d *Driver) Remove() error {
+	client := d.getClient()
+	for _, resource := range []struct {
+		name, id string
+		delete   func(string) error
+	}{
+		{"floating IP", d.FloatingIPID, client.DeleteFloatingIP},
+		{"instance", d.InstanceID, client.DeleteInstance},
+		{"SSH key", d.KeyID, client.DeleteKey},
+	} {
+		if resource.id == "" {
+			continue
+		}
+		if err := resource.delete(resource.id); err != nil {
+			if !isNotFound(err) {
+				return err
+			}
+			log.Infof("IBM Cloud VPC %s doesn't exist, assuming it is already deleted", resource.name)
+		}
+	}
+	return nil
+}
+
+func (d *Driver) getClient() *Client {
+	return NewClient(d.APIKey, d.region())
+}
@@ -0,0 +1,130 @@
+package ibmcloud
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnmarshalJSON(t *testing.T) {
+	driver := NewDriver("", "")
+
+	// Unmarhsal driver configuration from JSON and args.
+	os.Args = append(os.Args, []string{"--ibmcloud-api-key", "test api key"}...)
+
+	driverBytes, err := json.Marshal(driver)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(driverBytes, driver))
+
+	// Make sure that config has been pulled in from envvars and args.
+	assert.Equal(t, "test api key", driver.APIKey)
+}
+
+func TestSetConfigFromFlags(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"ibmcloud-api-key":   "KEY",
+			"ibmcloud-subnet-id": "subnet-1",
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	err := driver.SetConfigFromFlags(checkFlags)
+
+	assert.NoError(t, err)
+	assert.Empty(t, checkFlags.InvalidFlags)
+	assert.Equal(t, "us-south-1", driver.Zone)
+	assert.Equal(t, "us-south", driver.region())
+	assert.Equal(t, "bx2-2x8", driver.Profile)
+	assert.True(t, driver.FloatingIP)
+
+	sshPort, err := driver.GetSSHPort()
+	assert.NoError(t, err)
+	assert.Equal(t, "root", driver.GetSSHUsername())
+	assert.Equal(t, 22, sshPort)
+}
+
+func TestSetConfigFromFlagsInvalidZone(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"ibmcloud-api-key":   "KEY",
+			"ibmcloud-subnet-id": "subnet-1",
+			"ibmcloud-zone":      "dallas",
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	assert.EqualError(t, driver.SetConfigFromFlags(checkFlags), `ibmcloud zone must be the one of a region, e.g. us-south-1, got "dallas"`)
+}
+
+func TestRegion(t *testing.T) {
+	driver := NewDriver("default", "path")
+	assert.Equal(t, "us-south", driver.region())
+
+	driver.Zone = "eu-de-2"
+	assert.Equal(t, "eu-de", driver.region())
+
+	driver.Zone = "invalid"
+	assert.Empty(t, driver.region())
+}
+
+func TestCreateRequest(t *testing.T) {
+	userdata := filepath.Join(t.TempDir(), "cloud-init.yaml")
+	assert.NoError(t, os.WriteFile(userdata, []byte("#cloud-config\n"), 0600))
+
+	driver := NewDriver("default", "path")
+	driver.SubnetID = "subnet-1"
+	driver.ResourceGroupID = "rg-1"
+	driver.UserDataFile = userdata
+
+	request, err := driver.createRequest("r006-ubuntu")
+	assert.NoError(t, err)
+	assert.Equal(t, &InstanceCreateRequest{
+		Name:                    "default",
+		Profile:                 Reference{Name: "bx2-2x8"},
+		Zone:                    Reference{Name: "us-south-1"},
+		Image:                   Reference{ID: "r006-ubuntu"},
+		PrimaryNetworkInterface: NetworkInterface{Subnet: &Reference{ID: "subnet-1"}},
+		ResourceGroup:           &Reference{ID: "rg-1"},
+		UserData:                "#cloud-config\n",
+	}, request)
+
+	// The resource group is left to the account default.
+	driver.ResourceGroupID = ""
+	body, err := json.Marshal(driver.resourceGroup())
+	assert.NoError(t, err)
+	assert.Equal(t, "null", string(body))
+}
+
+func TestInstanceState(t *testing.T) {
+	for status, expected := range map[string]state.State{
+		"pending":  state.Starting,
+		"running":  state.Running,
+		"stopping": state.Stopping,
+		"stopped":  state.Stopped,
+		"failed":   state.Error,
+		"deleting": state.None,
+	} {
+		assert.Equal(t, expected, instanceState(status), status)
+	}
+}
+
+func TestPrivateIP(t *testing.T) {
+	var instance Instance
+	assert.NoError(t, json.Unmarshal([]byte(`{"id": "42", "primary_network_interface": {"id": "nic-1", "primary_ip": {"address": "10.240.0.4"}}}`), &instance))
+	assert.Equal(t, "10.240.0.4", instance.PrivateIP())
+
+	// The address is 0.0.0.0 until one is assigned.
+	instance.PrimaryNetworkInterface.PrimaryIP.Address = "0.0.0.0"
+	assert.Empty(t, instance.PrivateIP())
+	assert.Empty(t, (&Instance{}).PrivateIP())
+}
@@ -0,0 +1,28 @@
+package kvm
+
+import (
+	"path/filepath"
+
+	"github.com/rancher/machine/drivers/driverutil"
+)
+
+const (
+	seedDir = "cloudinit"
+	seedISO = "seed.iso"
+)
+
+// createSeedISO writes the NoCloud seed of the machine, whose user data,
+// the cloud-config or else the machine user-data, creates the SSH user, and returns its path.
+func (d *Driver) createSeedISO(publicKey string) (string, error) {
+	userData, err := driverutil.CloudConfigWithUser(d.BaseDriver, d.CloudConfig, publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	dir := d.ResolveStorePath(seedDir)
+	iso := filepath.Join(dir, seedISO)
+	if err := driverutil.WriteSeedISO(iso, filepath.Join(dir, "data"), d.MachineName, userData); err != nil {
+		return "", err
+	}
+	return iso, nil
+}
@@ -0,0 +1,120 @@
+package kvm
+
+import (
+	"encoding/xml"
+)
+
+// domain is the libvirt definition of the machine: a KVM guest with virtio
+// devices booting its disk, with the NoCloud seed as CD-ROM.
+type domain struct {
+	XMLName xml.Name `xml:"domain"`
+	Type    string   `xml:"type,attr"`
+	Name    string   `xml:"name"`
+	Memory  struct {
+		Unit  string `xml:"unit,attr"`
+		Value int    `xml:",chardata"`
+	} `xml:"memory"`
+	VCPU int `xml:"vcpu"`
+	OS   struct {
+		Type string `xml:"type"`
+		Boot struct {
+			Dev string `xml:"dev,attr"`
+		} `xml:"boot"`
+	} `xml:"os"`
+	Features struct {
+		ACPI struct{} `xml:"acpi"`
+		APIC struct{} `xml:"apic"`
+	} `xml:"features"`
+	CPU struct {
+		Mode string `xml:"mode,attr"`
+	} `xml:"cpu"`
+	Devices struct {
+		Disks      []domainDisk      `xml:"disk"`
+		Interfaces []domainInterface `xml:"interface"`
+		Serial     struct {
+			Type string `xml:"type,attr"`
+		} `xml:"serial"`
+		Channel struct {
+			Type   string `xml:"type,attr"`
+			Target struct {
+				Type string `xml:"type,attr"`
+				Name string `xml:"name,attr"`
+			} `xml:"target"`
+		} `xml:"channel"`
+		RNG struct {
+			Model   string `xml:"model,attr"`
+			Backend struct {
+				Model string `xml:"model,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"backend"`
+		} `xml:"rng"`
+	} `xml:"devices"`
+}
+
+type domainDisk struct {
+	Type   string `xml:"type,attr"`
+	Device string `xml:"device,attr"`
+	Driver struct {
+		Name string `xml:"name,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"driver"`
+	Source struct {
+		File string `xml:"file,attr"`
+	} `xml:"source"`
+	Target struct {
+		Dev string `xml:"dev,attr"`
+		Bus string `xml:"bus,attr"`
+	} `xml:"target"`
+	ReadOnly *struct{} `xml:"readonly"`
+}
+
+type domainInterface struct {
+	Type   string `xml:"type,attr"`
+	Source struct {
+		Network string `xml:"network,attr"`
+	} `xml:"source"`
+	Model struct {
+		Type string `xml:"type,attr"`
+	} `xml:"model"`
+}
+
+// domainXML returns the definition of the machine with the disk and seed
+// volumes, by their paths.
+func (d *Driver) domainXML(diskPath, seedPath string) ([]byte, error) {
+	var dom domain
+	dom.Type = "kvm"
+	dom.Name = d.MachineName
+	dom.Memory.Unit = "MiB"
+	dom.Memory.Value = d.Memory
+	dom.VCPU = d.CPU
+	dom.OS.Type = "hvm"
+	dom.OS.Boot.Dev = "hd"
+	dom.CPU.Mode = d.CPUMode
+
+	disk := domainDisk{Type: "file", Device: "disk"}
+	disk.Driver.Name, disk.Driver.Type = "qemu", "qcow2"
+	disk.Source.File = diskPath
+	disk.Target.Dev, disk.Target.Bus = "vda", "virtio"
+
+	seed := domainDisk{Type: "file", Device: "cdrom", ReadOnly: &struct{}{}}
+	seed.Driver.Name, seed.Driver.Type = "qemu", "raw"
+	seed.Source.File = seedPath
+	seed.Target.Dev, seed.Target.Bus = "sda", "sata"
+
+	dom.Devices.Disks = []domainDisk{disk, seed}
+
+	iface := domainInterface{Type: "network"}
+	iface.Source.Network = d.Network
+	iface.Model.Type = "virtio"
+	dom.Devices.Interfaces = []domainInterface{iface}
+
+	dom.Devices.Serial.Type = "pty"
+	// The guest agent reports the addresses when there is no DHCP lease,
+	// e.g. on bridged networks.
+	dom.Devices.Channel.Type = "unix"
+	dom.Devices.Channel.Target.Type, dom.Devices.Channel.Target.Name = "virtio", "org.qemu.guest_agent.0"
+	dom.Devices.RNG.Model = "virtio"
+	dom.Devices.RNG.Backend.Model, dom.Devices.RNG.Backend.Value = "random", "/dev/urandom"
+
+	return xml.MarshalIndent(dom, "", "  ")
+}
@@ -0,0 +1,478 @@
+package kvm
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rancher/machine/drivers/driverutil"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/rancher/machine/libmachine/ssh"
+	"github.com/rancher/machine/libmachine/state"
+)
+
+const (
+	defaultURI         = "qemu:///system"
+	defaultStoragePool = "default"
+	defaultNetwork     = "default"
+	defaultCPU         = 1
+	defaultMemory      = 1024
+	defaultDiskSize    = 20000
+	defaultCPUMode     = "host-passthrough"
+	defaultSSHUser     = "docker"
+)
+
+type Driver struct {
+	*drivers.BaseDriver
+	virshCmd    Virsh
+	URI         string
+	BaseImage   string
+	StoragePool string
+	Network     string
+	CPU         int
+	Memory      int
+	DiskSize    int
+	CPUMode     string
+	CloudConfig string
+}
+
+// NewDriver creates a new KVM driver with default settings.
+func NewDriver(hostName, storePath string) *Driver {
+	return &Driver{
+		URI:         defaultURI,
+		StoragePool: defaultStoragePool,
+		Network:     defaultNetwork,
+		CPU:         defaultCPU,
+		Memory:      defaultMemory,
+		DiskSize:    defaultDiskSize,
+		CPUMode:     defaultCPUMode,
+		BaseDriver: &drivers.BaseDriver{
+			MachineName: hostName,
+			StorePath:   storePath,
+			SSHUser:     defaultSSHUser,
+		},
+	}
+}
+
+// Capabilities returns the optional operations supported by the driver.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityStartStop,
+		drivers.CapabilityRestart,
+		drivers.CapabilityKill,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+	}
+}
+
+// GetCreateFlags registers the flags this driver adds to
+// "docker hosts create"
+func (d *Driver) GetCreateFlags() []mcnflag.Flag {
+	return []mcnflag.Flag{
+		mcnflag.StringFlag{
+			Name:   "kvm-connection-uri",
+			Usage:  "URI of the libvirt daemon",
+			Value:  defaultURI,
+			EnvVar: "KVM_CONNECTION_URI",
+		},
+		mcnflag.StringFlag{
+			Name:   "kvm-base-image",
+			Usage:  "path of the qcow2 cloud image the disk of the machine is backed by",
+			EnvVar: "KVM_BASE_IMAGE",
+		},
+		mcnflag.StringFlag{
+			Name:   "kvm-storage-pool",
+			Usage:  "storage pool of the volumes of the machine",
+			Value:  defaultStoragePool,
+			EnvVar: "KVM_STORAGE_POOL",
+		},
+		mcnflag.StringFlag{
+			Name:   "kvm-network",
+			Usage:  "libvirt network to attach the machine to",
+			Value:  defaultNetwork,
+			EnvVar: "KVM_NETWORK",
+		},
+		mcnflag.IntFlag{
+			Name:   "kvm-cpu-count",
+			Usage:  "number of CPUs for the machine",
+			Value:  defaultCPU,
+			EnvVar: "KVM_CPU_COUNT",
+		},
+		mcnflag.IntFlag{
+			Name:   "kvm-memory",
+			Usage:  "Size of memory for host in MB",
+			Value:  defaultMemory,
+			EnvVar: "KVM_MEMORY_SIZE",
+		},
+		mcnflag.IntFlag{
+			Name:   "kvm-disk-size",
+			Usage:  "Size of disk for host in MB",
+			Value:  defaultDiskSize,
+			EnvVar: "KVM_DISK_SIZE",
+		},
+		mcnflag.StringFlag{
+			Name:   "kvm-cpu-mode",
+			Usage:  "CPU mode of the machine: host-passthrough, host-model or custom",
+			Value:  defaultCPUMode,
+			EnvVar: "KVM_CPU_MODE",
+		},
+		mcnflag.StringFlag{
+			Name:   "kvm-cloud-config",
+			Usage:  "path of a cloud-config file to pass to cloud-init",
+			EnvVar: "KVM_CLOUD_CONFIG",
+		},
+		mcnflag.StringFlag{
+			Name:   "kvm-ssh-user",
+			Usage:  "SSH username, created by cloud-init",
+			Value:  defaultSSHUser,
+			EnvVar: "KVM_SSH_USER",
+		},
+	}
+}
+
+func (d *Driver) GetSSHHostname() (string, error) {
+	return d.GetIP()
+}
+
+// DriverName returns the name of the driver
+func (d *Driver) DriverName() string {
+	return "kvm"
+}
+
+func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
+	d.URI = flags.String("kvm-connection-uri")
+	d.BaseImage = flags.String("kvm-base-image")
+	d.StoragePool = flags.String("kvm-storage-pool")
+	d.Network = flags.String("kvm-network")
+	d.CPU = flags.Int("kvm-cpu-count")
+	d.Memory = flags.Int("kvm-memory")
+	d.DiskSize = flags.Int("kvm-disk-size")
+	d.CPUMode = flags.String("kvm-cpu-mode")
+	d.CloudConfig = flags.String("kvm-cloud-config")
+	d.SSHUser = flags.String("kvm-ssh-user")
+
+	d.SetSwarmConfigFromFlags(flags)
+	if err := d.SetUserDataFromFlags(flags); err != nil {
+		return err
+	}
+
+	if d.BaseImage == "" {
+		return fmt.Errorf("kvm driver requires the --kvm-base-image option")
+	}
+	if d.CPU < 1 {
+		return fmt.Errorf("kvm CPU count must be positive, got %d", d.CPU)
+	}
+	switch d.CPUMode {
+	case "host-passthrough", "host-model", "custom":
+	default:
+		return fmt.Errorf("kvm CPU mode must be host-passthrough, host-model or custom, got %q", d.CPUMode)
+	}
+
+	return nil
+}
+
+func (d *Driver) PreCreateCheck() error {
+	if _, err := os.Stat(d.BaseImage); err != nil {
+		return fmt.Errorf("kvm base image: %s", err)
+	}
+	if _, err := driverutil.CloudConfigWithUser(d.BaseDriver, d.CloudConfig, ""); err != nil {
+		return err
+	}
+
+	virsh := d.getVirsh()
+	if err := virsh.virsh("pool-info", d.StoragePool); err != nil {
+		if errors.Is(err, ErrNotExist) {
+			return fmt.Errorf("kvm storage pool %s doesn't exist", d.StoragePool)
+		}
+		return err
+	}
+	if err := virsh.virsh("net-info", d.Network); err != nil {
+		if errors.Is(err, ErrNotExist) {
+			return fmt.Errorf("kvm network %s doesn't exist", d.Network)
+		}
+		return err
+	}
+	if err := virsh.virsh("dominfo", d.MachineName); err == nil {
+		return fmt.Errorf("kvm domain %s already exists", d.MachineName)
+	} else if !errors.Is(err, ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (d *Driver) diskVolume() string {
+	return d.MachineName + ".qcow2"
+}
+
+func (d *Driver) seedVolume() string {
+	return d.MachineName + "-seed.iso"
+}
+
+func (d *Driver) Create() error {
+	virsh := d.getVirsh()
+
+	log.Infof("Creating SSH key...")
+
+	d.SSHKeyPath = d.GetSSHKeyPath()
+	if err := ssh.GenerateSSHKey(d.SSHKeyPath); err != nil {
+		return err
+	}
+	publicKey, err := os.ReadFile(d.SSHKeyPath + ".pub")
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Creating cloud-init seed...")
+
+	iso, err := d.createSeedISO(strings.TrimSpace(string(publicKey)))
+	if err != nil {
+		return err
+	}
+
+	if err := d.ensureBaseVolume(); err != nil {
+		return err
+	}
+
+	log.Infof("Creating KVM volumes...")
+
+	if err := virsh.virsh("vol-create-as", d.StoragePool, d.diskVolume(), fmt.Sprintf("%dM", d.DiskSize),
+		"--format", "qcow2", "--backing-vol", filepath.Base(d.BaseImage), "--backing-vol-format", "qcow2"); err != nil {
+		return err
+	}
+	if err := d.uploadVolume(d.seedVolume(), iso, "raw"); err != nil {
+		return d.removeAfter(err)
+	}
+
+	diskPath, err := d.volumePath(d.diskVolume())
+	if err != nil {
+		return d.removeAfter(err)
+	}
+	seedPath, err := d.volumePath(d.seedVolume())
+	if err != nil {
+		return d.removeAfter(err)
+	}
+
+	log.Infof("Creating KVM domain...")
+
+	definition, err := d.domainXML(diskPath, seedPath)
+	if err != nil {
+		return d.removeAfter(err)
+	}
+	definitionPath := d.ResolveStorePath("domain.xml")
+	if err := os.WriteFile(definitionPath, definition, 0600); err != nil {
+		return d.removeAfter(err)
+	}
+	if err := virsh.virsh("define", definitionPath); err != nil {
+		return d.removeAfter(err)
+	}
+	if err := virsh.virsh("start", d.MachineName); err != nil {
+		return d.removeAfter(err)
+	}
+
+	log.Info("Waiting for the machine to get an IP address...")
+	for {
+		addrs, err := d.addresses()
+		if err != nil {
+			return d.removeAfter(err)
+		}
+		if len(addrs) > 0 {
+			d.IPAddress = addrs[0].Address
+			break
+		}
+
+		time.Sleep(2 * time.Second)
+	}
+
+	log.Debugf("Created KVM domain %s, IP address %s", d.MachineName, d.IPAddress)
+
+	return nil
+}
+
+// ensureBaseVolume uploads the base image to the storage pool, unless a
+// machine already did.
+func (d *Driver) ensureBaseVolume() error {
+	name := filepath.Base(d.BaseImage)
+	err := d.getVirsh().virsh("vol-info", "--pool", d.StoragePool, name)
+	if err == nil || !errors.Is(err, ErrNotExist) {
+		return err
+	}
+
+	log.Infof("Uploading %s to storage pool %s...", name, d.StoragePool)
+	return d.uploadVolume(name, d.BaseImage, "qcow2")
+}
+
+// uploadVolume creates the volume of the pool with the content of the
+// file.
+func (d *Driver) uploadVolume(name, path, format string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	virsh := d.getVirsh()
+	if err := virsh.virsh("vol-create-as", d.StoragePool, name, strconv.FormatInt(info.Size(), 10)+"b", "--format", format); err != nil {
+		return err
+	}
+	if err := virsh.virsh("vol-upload", "--pool", d.StoragePool, name, path); err != nil {
+		return err
+	}
+	// The capacity of qcow2 volumes is read back from the uploaded header.
+	return virsh.virsh("pool-refresh", d.StoragePool)
+}
+
+func (d *Driver) volumePath(name string) (string, error) {
+	path, err := d.getVirsh().virshOut("vol-path", "--pool", d.StoragePool, name)
+	return strings.TrimSpace(path), err
+}
+
+// addresses returns the addresses of the machine, from the DHCP leases of
+// its network or else from the guest agent.
+func (d *Driver) addresses() ([]drivers.NetworkAddress, error) {
+	virsh := d.getVirsh()
+	out, err := virsh.virshOut("domifaddr", d.MachineName, "--source", "lease")
+	if err != nil {
+		return nil, err
+	}
+	addrs := parseDomIfAddr(out)
+	if len(addrs) == 0 {
+		// The agent fails until the guest runs it.
+		if out, err := virsh.virshOut("domifaddr", d.MachineName, "--source", "agent"); err == nil {
+			addrs = parseDomIfAddr(out)
+		}
+	}
+	return addrs, nil
+}
+
+// parseDomIfAddr returns the addresses listed by "virsh domifaddr", IPv4
+// ones first.
+func parseDomIfAddr(out string) []drivers.NetworkAddress {
+	var ipv4, ipv6 []drivers.NetworkAddress
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[0] == "lo" {
+			continue
+		}
+		ip := net.ParseIP(strings.Split(fields[3], "/")[0])
+		if ip == nil || !ip.IsGlobalUnicast() {
+			continue
+		}
+		switch fields[2] {
+		case "ipv4":
+			ipv4 = drivers.AppendAddress(ipv4, drivers.AddressPrivate, ip.String())
+		case "ipv6":
+			ipv6 = drivers.AppendAddress(ipv6, drivers.AddressIPv6, ip.String())
+		}
+	}
+	return append(ipv4, ipv6...)
+}
+
+func (d *Driver) removeAfter(err error) error {
+	if removeErr := d.Remove(); removeErr != nil {
+		return fmt.Errorf("failed to create machine due to error: %v. Removing domain: %v", err, removeErr)
+	}
+	return err
+}
+
+func (d *Driver) GetURL() (string, error) {
+	if err := drivers.MustBeRunning(d); err != nil {
+		return "", err
+	}
+
+	ip, err := d.GetIP()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("tcp://%s", net.JoinHostPort(ip, "2376")), nil
+}
+
+// GetIPs returns the addresses of the machine on its network.
+func (d *Driver) GetIPs() ([]drivers.NetworkAddress, error) {
+	return d.addresses()
+}
+
+func (d *Driver) GetState() (state.State, error) {
+	out, err := d.getVirsh().virshOut("domstate", d.MachineName)
+	if err != nil {
+		if !errors.Is(err, ErrNotExist) {
+			return state.Error, err
+		}
+		return state.None, fmt.Errorf("machine %v not found", d.MachineName)
+	}
+
+	switch strings.TrimSpace(out) {
+	case "running", "idle", "blocked":
+		return state.Running, nil
+	case "paused", "pmsuspended":
+		return state.Paused, nil
+	case "in shutdown":
+		return state.Stopping, nil
+	case "shut off":
+		return state.Stopped, nil
+	case "crashed":
+		return state.Error, nil
+	}
+	return state.None, nil
+}
+
+func (d *Driver) Start() error {
+	return d.getVirsh().virsh("start", d.MachineName)
+}
+
+// Stop shuts the machine down through ACPI.
+func (d *Driver) Stop() error {
+	return d.getVirsh().virsh("shutdown", d.MachineName)
+}
+
+func (d *Driver) Restart() error {
+	return d.getVirsh().virsh("reboot", d.MachineName)
+}
+
+func (d *Driver) Kill() error {
+	return d.getVirsh().virsh("destroy", d.MachineName)
+}
+
+// Remove powers the domain off, undefines it and deletes its volumes, but
+// the base one, which other machines may be backed by.
+func (d *Driver) Remove() error {
+	virsh := d.getVirsh()
+
+	s, err := d.GetState()
+	if err != nil && s != state.None {
+		return err
+	}
+	if s == state.None {
+		log.Infof("KVM domain doesn't exist, assuming it is already deleted")
+	} else {
+		if s != state.Stopped {
+			if err := virsh.virsh("destroy", d.MachineName); err != nil {
+				return err
+			}
+		}
+		if err := virsh.virsh("undefine", d.MachineName); err != nil {
+			return err
+		}
+	}
+
+	for _, volume := range []string{d.diskVolume(), d.seedVolume()} {
+		if err := virsh.virsh("vol-delete", "--pool", d.StoragePool, volume); err != nil && !errors.Is(err, ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Driver) getVirsh() Virsh {
+	if d.virshCmd == nil {
+		d.virshCmd = NewVirsh(d.URI)
+	}
+	return d.virshCmd
+}
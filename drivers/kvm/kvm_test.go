@@ -0,0 +1,235 @@
+package kvm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rancher/machine/drivers/driverutil"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+// VirshMock answers the commands with their output or error, and records
+// them.
+type VirshMock struct {
+	commands []string
+	outputs  map[string]string
+	errors   map[string]error
+}
+
+func newVirshMock() *VirshMock {
+	return &VirshMock{outputs: map[string]string{}, errors: map[string]error{}}
+}
+
+func (v *VirshMock) virsh(args ...string) error {
+	_, err := v.virshOut(args...)
+	return err
+}
+
+func (v *VirshMock) virshOut(args ...string) (string, error) {
+	command := strings.Join(args, " ")
+	v.commands = append(v.commands, command)
+	return v.outputs[command], v.errors[command]
+}
+
+func notExist(command string) error {
+	return fmt.Errorf("%w: virsh %s failed", ErrNotExist, command)
+}
+
+func newTestDriver(t *testing.T) (*Driver, *VirshMock) {
+	storePath := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(storePath, "machines", "default"), 0700))
+	baseImage := filepath.Join(storePath, "jammy.qcow2")
+	assert.NoError(t, os.WriteFile(baseImage, []byte("QFI\xfb"), 0600))
+
+	virsh := newVirshMock()
+	driver := NewDriver("default", storePath)
+	driver.virshCmd = virsh
+	driver.BaseImage = baseImage
+	return driver, virsh
+}
+
+func TestSetConfigFromFlags(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"kvm-base-image": "/var/lib/images/jammy.qcow2",
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	err := driver.SetConfigFromFlags(checkFlags)
+
+	assert.NoError(t, err)
+	assert.Empty(t, checkFlags.InvalidFlags)
+	assert.Equal(t, "qemu:///system", driver.URI)
+	assert.Equal(t, "default", driver.StoragePool)
+	assert.Equal(t, "default", driver.Network)
+	assert.Equal(t, 20000, driver.DiskSize)
+	assert.Equal(t, "docker", driver.GetSSHUsername())
+}
+
+func TestSetConfigFromFlagsInvalidCPUMode(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"kvm-base-image": "/var/lib/images/jammy.qcow2",
+			"kvm-cpu-mode":   "maximum",
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	assert.EqualError(t, driver.SetConfigFromFlags(checkFlags), `kvm CPU mode must be host-passthrough, host-model or custom, got "maximum"`)
+}
+
+func TestPreCreateCheck(t *testing.T) {
+	driver, virsh := newTestDriver(t)
+	virsh.errors["dominfo default"] = notExist("dominfo")
+	assert.NoError(t, driver.PreCreateCheck())
+
+	delete(virsh.errors, "dominfo default")
+	assert.EqualError(t, driver.PreCreateCheck(), "kvm domain default already exists")
+
+	virsh.errors["net-info default"] = notExist("net-info")
+	assert.EqualError(t, driver.PreCreateCheck(), "kvm network default doesn't exist")
+
+	virsh.errors["pool-info default"] = notExist("pool-info")
+	assert.EqualError(t, driver.PreCreateCheck(), "kvm storage pool default doesn't exist")
+
+	driver.BaseImage = filepath.Join(driver.StorePath, "missing.qcow2")
+	assert.ErrorContains(t, driver.PreCreateCheck(), "kvm base image: ")
+}
+
+func TestCreate(t *testing.T) {
+	driver, virsh := newTestDriver(t)
+
+	orig := driverutil.MakeISO
+	driverutil.MakeISO = func(iso, label, dir string) error {
+		assert.Equal(t, "cidata", label)
+		for _, name := range []string{"user-data", "meta-data"} {
+			_, err := os.Stat(filepath.Join(dir, name))
+			assert.NoError(t, err)
+		}
+		return os.WriteFile(iso, []byte("ISO"), 0600)
+	}
+	t.Cleanup(func() { driverutil.MakeISO = orig })
+
+	virsh.errors["vol-info --pool default jammy.qcow2"] = notExist("vol-info")
+	virsh.outputs["vol-path --pool default default.qcow2"] = "/var/lib/libvirt/images/default.qcow2\n"
+	virsh.outputs["vol-path --pool default default-seed.iso"] = "/var/lib/libvirt/images/default-seed.iso\n"
+	virsh.outputs["domifaddr default --source lease"] = ` Name       MAC address          Protocol     Address
+-------------------------------------------------------------------------------
+ vnet0      52:54:00:8a:1b:2c    ipv4         192.168.122.45/24
+`
+
+	assert.NoError(t, driver.Create())
+	assert.Equal(t, "192.168.122.45", driver.IPAddress)
+
+	seed := filepath.Join(driver.StorePath, "machines", "default", "cloudinit", "seed.iso")
+	assert.Equal(t, []string{
+		"vol-info --pool default jammy.qcow2",
+		"vol-create-as default jammy.qcow2 4b --format qcow2",
+		"vol-upload --pool default jammy.qcow2 " + driver.BaseImage,
+		"pool-refresh default",
+		"vol-create-as default default.qcow2 20000M --format qcow2 --backing-vol jammy.qcow2 --backing-vol-format qcow2",
+		"vol-create-as default default-seed.iso 3b --format raw",
+		"vol-upload --pool default default-seed.iso " + seed,
+		"pool-refresh default",
+		"vol-path --pool default default.qcow2",
+		"vol-path --pool default default-seed.iso",
+		"define " + filepath.Join(driver.StorePath, "machines", "default", "domain.xml"),
+		"start default",
+		"domifaddr default --source lease",
+	}, virsh.commands)
+
+	definition, err := os.ReadFile(filepath.Join(driver.StorePath, "machines", "default", "domain.xml"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(definition), `<source file="/var/lib/libvirt/images/default.qcow2"></source>`)
+	assert.Contains(t, string(definition), `<source file="/var/lib/libvirt/images/default-seed.iso"></source>`)
+	assert.Contains(t, string(definition), `<source network="default"></source>`)
+}
+
+func TestParseDomIfAddr(t *testing.T) {
+	addrs := parseDomIfAddr(` Name       MAC address          Protocol     Address
+-------------------------------------------------------------------------------
+ lo         00:00:00:00:00:00    ipv4         127.0.0.1/8
+ eth0       52:54:00:8a:1b:2c    ipv6         fe80::5054:ff:fe8a:1b2c/64
+ -          -                    ipv6         2001:db8::45/64
+ -          -                    ipv4         10.0.0.45/24
+`)
+
+	assert.Equal(t, []drivers.NetworkAddress{
+		{Kind: drivers.AddressPrivate, Address: "10.0.0.45"},
+		{Kind: drivers.AddressIPv6, Address: "2001:db8::45"},
+	}, addrs)
+}
+
+func TestGetState(t *testing.T) {
+	driver, virsh := newTestDriver(t)
+
+	for domstate, expected := range map[string]state.State{
+		"running":     state.Running,
+		"paused":      state.Paused,
+		"in shutdown": state.Stopping,
+		"shut off":    state.Stopped,
+		"crashed":     state.Error,
+	} {
+		virsh.outputs["domstate default"] = domstate + "\n"
+
+		s, err := driver.GetState()
+		assert.NoError(t, err)
+		assert.Equal(t, expected, s, domstate)
+	}
+
+	virsh.errors["domstate default"] = notExist("domstate")
+	s, err := driver.GetState()
+	assert.EqualError(t, err, "machine default not found")
+	assert.Equal(t, state.None, s)
+}
+
+func TestRemove(t *testing.T) {
+	driver, virsh := newTestDriver(t)
+	virsh.outputs["domstate default"] = "running\n"
+	virsh.errors["vol-delete --pool default default-seed.iso"] = notExist("vol-delete")
+
+	assert.NoError(t, driver.Remove())
+	assert.Equal(t, []string{
+		"domstate default",
+		"destroy default",
+		"undefine default",
+		"vol-delete --pool default default.qcow2",
+		"vol-delete --pool default default-seed.iso",
+	}, virsh.commands)
+
+	// Domains already deleted still have their volumes deleted.
+	virsh.commands = nil
+	virsh.errors["domstate default"] = notExist("domstate")
+	assert.NoError(t, driver.Remove())
+	assert.Equal(t, []string{
+		"domstate default",
+		"vol-delete --pool default default.qcow2",
+		"vol-delete --pool default default-seed.iso",
+	}, virsh.commands)
+}
+
+func TestVirshCmdNotFound(t *testing.T) {
+	virsh := NewVirsh("qemu:///system")
+	virsh.runCmd = func(cmd *exec.Cmd) error {
+		assert.Equal(t, []string{"virsh", "--quiet", "--connect", "qemu:///system", "domstate", "default"}, cmd.Args)
+		io.WriteString(cmd.Stderr, "error: failed to get domain 'default'\n")
+		return errors.New("exit status 1")
+	}
+
+	_, err := virsh.virshOut("domstate", "default")
+	assert.True(t, errors.Is(err, ErrNotExist))
+	assert.EqualError(t, err, "object does not exist: virsh domstate failed: error: failed to get domain 'default'")
+}
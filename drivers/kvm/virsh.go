@@ -0,0 +1,86 @@
+package kvm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/rancher/machine/libmachine/log"
+)
+
+var (
+	ErrNotExist      = errors.New("object does not exist")
+	ErrVirshNotFound = errors.New("virsh not found. Make sure libvirt is installed and virsh is in the path")
+
+	// notFoundErrors are the errors virsh fails with for a missing domain,
+	// pool, network or volume.
+	notFoundErrors = []string{
+		"Domain not found",
+		"failed to get domain",
+		"Storage pool not found",
+		"Network not found",
+		"Storage volume not found",
+		"failed to get vol",
+	}
+)
+
+// Virsh defines the interface to communicate to libvirt.
+type Virsh interface {
+	virsh(args ...string) error
+
+	virshOut(args ...string) (string, error)
+}
+
+// VirshCmd communicates with libvirt through the commandline using `virsh`,
+// connected to the URI.
+type VirshCmd struct {
+	uri    string
+	runCmd func(cmd *exec.Cmd) error
+}
+
+// NewVirsh creates a Virsh instance connected to the URI, e.g.
+// qemu:///system.
+func NewVirsh(uri string) *VirshCmd {
+	return &VirshCmd{
+		uri:    uri,
+		runCmd: func(cmd *exec.Cmd) error { return cmd.Run() },
+	}
+}
+
+func (v *VirshCmd) virsh(args ...string) error {
+	_, err := v.virshOut(args...)
+	return err
+}
+
+func (v *VirshCmd) virshOut(args ...string) (string, error) {
+	args = append([]string{"--quiet", "--connect", v.uri}, args...)
+	cmd := exec.Command("virsh", args...)
+	log.Debugf("COMMAND: virsh %v", strings.Join(args, " "))
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := v.runCmd(cmd)
+	stderrStr := stderr.String()
+	if len(args) > 0 {
+		log.Debugf("STDOUT:\n{\n%v}", stdout.String())
+		log.Debugf("STDERR:\n{\n%v}", stderrStr)
+	}
+
+	if err != nil {
+		if ee, ok := err.(*exec.Error); ok && ee.Err == exec.ErrNotFound {
+			return "", ErrVirshNotFound
+		}
+		err = fmt.Errorf("virsh %s failed: %s", args[3], strings.TrimSpace(stderrStr))
+		for _, notFound := range notFoundErrors {
+			if strings.Contains(stderrStr, notFound) {
+				return "", fmt.Errorf("%w: %w", ErrNotExist, err)
+			}
+		}
+		return "", err
+	}
+
+	return stdout.String(), nil
+}
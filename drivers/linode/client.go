@@ -0,0 +1,170 @@
+package linode
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rancher/machine/libmachine/version"
+)
+
+// apiEndpoint is the Linode API, replaced by the tests.
+var apiEndpoint = "https://api.linode.com/v4"
+
+// Client makes the calls to the Linode API the driver needs.
+type Client struct {
+	token      string
+	endpoint   string
+	httpClient *http.Client
+}
+
+func NewClient(token string) *Client {
+	return &Client{
+		token:      token,
+		endpoint:   apiEndpoint,
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// APIError is an error answered by the Linode API.
+type APIError struct {
+	StatusCode int
+	Reasons    []string
+}
+
+func (e *APIError) Error() string {
+	return "linode: " + strings.Join(e.Reasons, "; ")
+}
+
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+type Instance struct {
+	ID     int      `json:"id"`
+	Label  string   `json:"label"`
+	Status string   `json:"status"`
+	IPv4   []string `json:"ipv4"`
+	IPv6   string   `json:"ipv6"`
+}
+
+// InstanceInterface attaches an instance to the public internet or a VLAN.
+type InstanceInterface struct {
+	Purpose     string `json:"purpose"`
+	Label       string `json:"label,omitempty"`
+	IPAMAddress string `json:"ipam_address,omitempty"`
+}
+
+type InstanceMetadata struct {
+	// UserData is base64 encoded.
+	UserData string `json:"user_data"`
+}
+
+type InstanceCreateRequest struct {
+	Label           string              `json:"label"`
+	Region          string              `json:"region"`
+	Type            string              `json:"type"`
+	Image           string              `json:"image"`
+	RootPass        string              `json:"root_pass"`
+	AuthorizedKeys  []string            `json:"authorized_keys,omitempty"`
+	PrivateIP       bool                `json:"private_ip,omitempty"`
+	Tags            []string            `json:"tags,omitempty"`
+	Interfaces      []InstanceInterface `json:"interfaces,omitempty"`
+	StackScriptID   int                 `json:"stackscript_id,omitempty"`
+	StackScriptData map[string]string   `json:"stackscript_data,omitempty"`
+	Metadata        *InstanceMetadata   `json:"metadata,omitempty"`
+	Booted          bool                `json:"booted"`
+}
+
+func (c *Client) do(method, path string, body, reply interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.endpoint+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("docker-machine/v%d", version.APIVersion))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 400 {
+		var errReply struct {
+			Errors []struct {
+				Field  string `json:"field"`
+				Reason string `json:"reason"`
+			} `json:"errors"`
+		}
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		if err := json.Unmarshal(data, &errReply); err == nil {
+			for _, e := range errReply.Errors {
+				reason := e.Reason
+				if e.Field != "" {
+					reason = e.Field + ": " + reason
+				}
+				apiErr.Reasons = append(apiErr.Reasons, reason)
+			}
+		}
+		if len(apiErr.Reasons) == 0 {
+			apiErr.Reasons = []string{resp.Status}
+		}
+		return apiErr
+	}
+
+	if reply == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, reply)
+}
+
+// Get fails if the API has nothing at path, e.g. a region.
+func (c *Client) Get(path string) error {
+	return c.do(http.MethodGet, path, nil, nil)
+}
+
+func (c *Client) CreateInstance(request *InstanceCreateRequest) (*Instance, error) {
+	var instance Instance
+	if err := c.do(http.MethodPost, "/linode/instances", request, &instance); err != nil {
+		return nil, err
+	}
+	return &instance, nil
+}
+
+func (c *Client) GetInstance(id int) (*Instance, error) {
+	var instance Instance
+	if err := c.do(http.MethodGet, fmt.Sprintf("/linode/instances/%d", id), nil, &instance); err != nil {
+		return nil, err
+	}
+	return &instance, nil
+}
+
+func (c *Client) DeleteInstance(id int) error {
+	return c.do(http.MethodDelete, fmt.Sprintf("/linode/instances/%d", id), nil, nil)
+}
+
+// InstanceAction runs an action, e.g. "boot", on the instance.
+func (c *Client) InstanceAction(id int, action string) error {
+	return c.do(http.MethodPost, fmt.Sprintf("/linode/instances/%d/%s", id, action), struct{}{}, nil)
+}
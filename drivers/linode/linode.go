@@ -0,0 +1,496 @@
+package linode
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	rpcdriver "github.com/rancher/machine/libmachine/drivers/rpc"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/rancher/machine/libmachine/mcnutils"
+	"github.com/rancher/machine/libmachine/ssh"
+	"github.com/rancher/machine/libmachine/state"
+)
+
+type Driver struct {
+	*drivers.BaseDriver
+	Token            string
+	InstanceID       int
+	Region           string
+	InstanceType     string
+	Image            string
+	RootPass         string
+	PrivateIP        bool
+	VLANLabel        string
+	VLANIPAMAddress  string
+	StackScript      string
+	StackScriptData  string
+	UserDataFile     string
+	Tags             string
+	PrivateIPAddress string
+}
+
+const (
+	defaultSSHPort      = 22
+	defaultSSHUser      = "root"
+	defaultImage        = "linode/ubuntu22.04"
+	defaultRegion       = "us-east"
+	defaultInstanceType = "g6-standard-2"
+)
+
+// Capabilities returns the optional operations supported by the driver.
+// Linodes cannot be forcibly powered off.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityStartStop,
+		drivers.CapabilityRestart,
+		drivers.CapabilityPrivateIP,
+		drivers.CapabilityCustomSSHPort,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+	}
+}
+
+// GetCreateFlags registers the flags this driver adds to
+// "docker hosts create"
+func (d *Driver) GetCreateFlags() []mcnflag.Flag {
+	return []mcnflag.Flag{
+		mcnflag.StringFlag{
+			EnvVar:    "LINODE_TOKEN",
+			Name:      "linode-token",
+			Usage:     "Linode API token",
+			Sensitive: true,
+		},
+		mcnflag.StringFlag{
+			EnvVar:    "LINODE_ROOT_PASSWORD",
+			Name:      "linode-root-pass",
+			Usage:     "root password of the Linode (default generated)",
+			Sensitive: true,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_SSH_USER",
+			Name:   "linode-ssh-user",
+			Usage:  "SSH username",
+			Value:  defaultSSHUser,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "LINODE_SSH_PORT",
+			Name:   "linode-ssh-port",
+			Usage:  "SSH port",
+			Value:  defaultSSHPort,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_REGION",
+			Name:   "linode-region",
+			Usage:  "Linode region",
+			Value:  defaultRegion,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_INSTANCE_TYPE",
+			Name:   "linode-instance-type",
+			Usage:  "Linode instance type",
+			Value:  defaultInstanceType,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_IMAGE",
+			Name:   "linode-image",
+			Usage:  "Linode image",
+			Value:  defaultImage,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "LINODE_CREATE_PRIVATE_IP",
+			Name:   "linode-create-private-ip",
+			Usage:  "add a private IP address to the Linode",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_VLAN_LABEL",
+			Name:   "linode-vlan-label",
+			Usage:  "label of the VLAN to attach the Linode to",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_VLAN_IPAM_ADDRESS",
+			Name:   "linode-vlan-ipam-address",
+			Usage:  "address of the Linode in the VLAN, in CIDR notation, e.g. 10.0.0.2/24",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_STACKSCRIPT",
+			Name:   "linode-stackscript",
+			Usage:  "ID of the StackScript to deploy the Linode with",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_STACKSCRIPT_DATA",
+			Name:   "linode-stackscript-data",
+			Usage:  "JSON object of the StackScript user defined fields",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_USERDATA",
+			Name:   "linode-userdata",
+			Usage:  "path to file with cloud-init user-data",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_TAGS",
+			Name:   "linode-tags",
+			Usage:  "comma-separated list of tags to apply to the Linode",
+		},
+	}
+}
+
+func NewDriver(hostName, storePath string) *Driver {
+	return &Driver{
+		Image:        defaultImage,
+		InstanceType: defaultInstanceType,
+		Region:       defaultRegion,
+		BaseDriver: &drivers.BaseDriver{
+			MachineName: hostName,
+			StorePath:   storePath,
+		},
+	}
+}
+
+func (d *Driver) GetSSHHostname() (string, error) {
+	return d.GetIP()
+}
+
+// DriverName returns the name of the driver
+func (d *Driver) DriverName() string {
+	return "linode"
+}
+
+// UnmarshalJSON loads driver config from JSON. This function is used by the RPCServerDriver that wraps
+// all drivers as a means of populating an already-initialized driver with new configuration.
+// See `RPCServerDriver.SetConfigRaw`.
+func (d *Driver) UnmarshalJSON(data []byte) error {
+	// Unmarshal driver config into an aliased type to prevent infinite recursion on UnmarshalJSON.
+	type targetDriver Driver
+
+	// Copy data from `d` to `target` before unmarshalling. This will ensure that already-initialized values
+	// from `d` that are left untouched during unmarshal (like functions) are preserved.
+	target := targetDriver(*d)
+
+	if err := json.Unmarshal(data, &target); err != nil {
+		return fmt.Errorf("error unmarshalling driver config from JSON: %w", err)
+	}
+
+	// Copy unmarshalled data back to `d`.
+	*d = Driver(target)
+
+	// Make sure to reload values that are subject to change from envvars and os.Args.
+	driverOpts, err := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	if err != nil {
+		return err
+	}
+	if _, ok := driverOpts.Values["linode-token"]; ok {
+		d.Token = driverOpts.String("linode-token")
+	}
+
+	return nil
+}
+
+func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
+	d.Token = flags.String("linode-token")
+	d.RootPass = flags.String("linode-root-pass")
+	d.Region = flags.String("linode-region")
+	d.InstanceType = flags.String("linode-instance-type")
+	d.Image = flags.String("linode-image")
+	d.PrivateIP = flags.Bool("linode-create-private-ip")
+	d.VLANLabel = flags.String("linode-vlan-label")
+	d.VLANIPAMAddress = flags.String("linode-vlan-ipam-address")
+	d.StackScript = flags.String("linode-stackscript")
+	d.StackScriptData = flags.String("linode-stackscript-data")
+	d.UserDataFile = flags.String("linode-userdata")
+	d.Tags = flags.String("linode-tags")
+	d.SSHUser = flags.String("linode-ssh-user")
+	d.SSHPort = flags.Int("linode-ssh-port")
+
+	d.SetSwarmConfigFromFlags(flags)
+
+	if d.Token == "" {
+		return fmt.Errorf("linode driver requires the --linode-token option")
+	}
+	if d.VLANIPAMAddress != "" && d.VLANLabel == "" {
+		return fmt.Errorf("linode driver requires the --linode-vlan-label option to set the VLAN address")
+	}
+	if d.StackScript != "" {
+		if _, err := strconv.Atoi(d.StackScript); err != nil {
+			return fmt.Errorf("linode StackScript must be an ID, got %q", d.StackScript)
+		}
+	}
+	if d.StackScriptData != "" {
+		if _, err := d.stackScriptData(); err != nil {
+			return fmt.Errorf("linode StackScript data must be a JSON object of strings: %s", err)
+		}
+	}
+
+	return nil
+}
+
+func (d *Driver) PreCreateCheck() error {
+	if d.UserDataFile != "" {
+		if _, err := os.Stat(d.UserDataFile); os.IsNotExist(err) {
+			return fmt.Errorf("user-data file %s could not be found", d.UserDataFile)
+		}
+	}
+
+	client := d.getClient()
+	if err := client.Get("/regions/" + d.Region); err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("linode requires a valid region")
+		}
+		return err
+	}
+	if err := client.Get("/linode/types/" + d.InstanceType); err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("linode requires a valid instance type")
+		}
+		return err
+	}
+	if d.StackScript != "" {
+		if err := client.Get("/linode/stackscripts/" + d.StackScript); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Driver) Create() error {
+	createRequest, err := d.createRequest()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Creating SSH key...")
+
+	d.SSHKeyPath = d.GetSSHKeyPath()
+	if err := ssh.GenerateSSHKey(d.SSHKeyPath); err != nil {
+		return err
+	}
+	publicKey, err := os.ReadFile(d.SSHKeyPath + ".pub")
+	if err != nil {
+		return err
+	}
+	createRequest.AuthorizedKeys = []string{strings.TrimSpace(string(publicKey))}
+
+	log.Infof("Creating Linode...")
+
+	client := d.getClient()
+	instance, err := client.CreateInstance(createRequest)
+	if err != nil {
+		return err
+	}
+	d.InstanceID = instance.ID
+
+	log.Info("Waiting for the Linode to be running...")
+	for {
+		instance, err = client.GetInstance(d.InstanceID)
+		if err != nil {
+			if removeErr := d.Remove(); removeErr != nil {
+				return fmt.Errorf("failed to create machine due to error: %v. Removing Linode: %v", err, removeErr)
+			}
+			return err
+		}
+
+		d.IPAddress, d.PrivateIPAddress = splitIPv4(instance.IPv4)
+
+		if instance.Status == "running" && d.IPAddress != "" {
+			break
+		}
+
+		time.Sleep(5 * time.Second)
+	}
+
+	log.Debugf("Created Linode ID %d, IP address %s, Private IP address %s",
+		instance.ID,
+		d.IPAddress,
+		d.PrivateIPAddress)
+
+	return nil
+}
+
+// createRequest returns the request creating the Linode, without its
+// authorized key.
+func (d *Driver) createRequest() (*InstanceCreateRequest, error) {
+	createRequest := &InstanceCreateRequest{
+		Label:     d.MachineName,
+		Region:    d.Region,
+		Type:      d.InstanceType,
+		Image:     d.Image,
+		RootPass:  d.RootPass,
+		PrivateIP: d.PrivateIP,
+		Tags:      d.getTags(),
+		Booted:    true,
+	}
+	if createRequest.RootPass == "" {
+		createRequest.RootPass = mcnutils.GenerateRandomID()
+	}
+
+	if d.UserDataFile != "" {
+		buf, err := os.ReadFile(d.UserDataFile)
+		if err != nil {
+			return nil, err
+		}
+		createRequest.Metadata = &InstanceMetadata{UserData: base64.StdEncoding.EncodeToString(buf)}
+	}
+
+	if d.StackScript != "" {
+		createRequest.StackScriptID, _ = strconv.Atoi(d.StackScript)
+		data, err := d.stackScriptData()
+		if err != nil {
+			return nil, err
+		}
+		createRequest.StackScriptData = data
+	}
+
+	if d.VLANLabel != "" {
+		// The public interface has to be listed once any is.
+		createRequest.Interfaces = []InstanceInterface{
+			{Purpose: "public"},
+			{Purpose: "vlan", Label: d.VLANLabel, IPAMAddress: d.VLANIPAMAddress},
+		}
+	}
+
+	return createRequest, nil
+}
+
+// splitIPv4 returns the first public and private addresses of a Linode.
+func splitIPv4(addrs []string) (public, private string) {
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			continue
+		}
+		if ip.IsPrivate() {
+			if private == "" {
+				private = addr
+			}
+		} else if public == "" {
+			public = addr
+		}
+	}
+	return public, private
+}
+
+func (d *Driver) stackScriptData() (map[string]string, error) {
+	if d.StackScriptData == "" {
+		return nil, nil
+	}
+	var data map[string]string
+	if err := json.Unmarshal([]byte(d.StackScriptData), &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (d *Driver) GetURL() (string, error) {
+	if err := drivers.MustBeRunning(d); err != nil {
+		return "", err
+	}
+
+	ip, err := d.GetIP()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("tcp://%s", net.JoinHostPort(ip, "2376")), nil
+}
+
+// GetIPs returns the public, private and IPv6 addresses of the Linode.
+func (d *Driver) GetIPs() ([]drivers.NetworkAddress, error) {
+	instance, err := d.getClient().GetInstance(d.InstanceID)
+	if err != nil {
+		return nil, err
+	}
+	return instanceAddresses(instance), nil
+}
+
+func instanceAddresses(instance *Instance) []drivers.NetworkAddress {
+	var addrs []drivers.NetworkAddress
+	for _, addr := range instance.IPv4 {
+		kind := drivers.AddressPublic
+		if ip := net.ParseIP(addr); ip != nil && ip.IsPrivate() {
+			kind = drivers.AddressPrivate
+		}
+		addrs = drivers.AppendAddress(addrs, kind, addr)
+	}
+	ipv6, _, _ := strings.Cut(instance.IPv6, "/")
+	return drivers.AppendAddress(addrs, drivers.AddressIPv6, ipv6)
+}
+
+func (d *Driver) GetState() (state.State, error) {
+	instance, err := d.getClient().GetInstance(d.InstanceID)
+	if err != nil {
+		if !isNotFound(err) {
+			return state.Error, err
+		}
+		return state.None, fmt.Errorf("machine %v not found", d.MachineName)
+	}
+	return instanceState(instance.Status), nil
+}
+
+func instanceState(status string) state.State {
+	switch status {
+	case "provisioning", "booting", "rebooting":
+		return state.Starting
+	case "running":
+		return state.Running
+	case "shutting_down":
+		return state.Stopping
+	case "offline", "stopped":
+		return state.Stopped
+	}
+	return state.None
+}
+
+func (d *Driver) Start() error {
+	return d.getClient().InstanceAction(d.InstanceID, "boot")
+}
+
+func (d *Driver) Stop() error {
+	return d.getClient().InstanceAction(d.InstanceID, "shutdown")
+}
+
+func (d *Driver) Restart() error {
+	return d.getClient().InstanceAction(d.InstanceID, "reboot")
+}
+
+// Kill shuts the Linode down, which cannot be forcibly powered off.
+func (d *Driver) Kill() error {
+	return d.Stop()
+}
+
+func (d *Driver) Remove() error {
+	if d.InstanceID == 0 {
+		return nil
+	}
+	if err := d.getClient().DeleteInstance(d.InstanceID); err != nil {
+		if !isNotFound(err) {
+			return err
+		}
+		log.Infof("Linode doesn't exist, assuming it is already deleted")
+	}
+	return nil
+}
+
+func (d *Driver) getClient() *Client {
+	return NewClient(d.Token)
+}
+
+func (d *Driver) getTags() []string {
+	var tagList []string
+
+	for _, t := range strings.Split(d.Tags, ",") {
+		t = strings.TrimSpace(t)
+		if t != "" {
+			tagList = append(tagList, t)
+		}
+	}
+
+	return tagList
+}
@@ -0,0 +1,139 @@
+package linode
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnmarshalJSON(t *testing.T) {
+	driver := NewDriver("", "")
+
+	// Unmarhsal driver configuration from JSON and args.
+	os.Args = append(os.Args, []string{"--linode-token", "test token"}...)
+
+	driverBytes, err := json.Marshal(driver)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(driverBytes, driver))
+
+	// Make sure that config has been pulled in from envvars and args.
+	assert.Equal(t, "test token", driver.Token)
+}
+
+func TestSetConfigFromFlags(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"linode-token":            "TOKEN",
+			"linode-stackscript":      "1234",
+			"linode-stackscript-data": `{"hostname": "default"}`,
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	err := driver.SetConfigFromFlags(checkFlags)
+
+	assert.NoError(t, err)
+	assert.Empty(t, checkFlags.InvalidFlags)
+	assert.Equal(t, "us-east", driver.Region)
+	assert.Equal(t, "g6-standard-2", driver.InstanceType)
+	assert.Equal(t, "linode/ubuntu22.04", driver.Image)
+
+	sshPort, err := driver.GetSSHPort()
+	assert.NoError(t, err)
+	assert.Equal(t, "root", driver.GetSSHUsername())
+	assert.Equal(t, 22, sshPort)
+}
+
+func TestSetConfigFromFlagsInvalid(t *testing.T) {
+	for flag, expected := range map[string]string{
+		"linode-vlan-ipam-address": "linode driver requires the --linode-vlan-label option to set the VLAN address",
+		"linode-stackscript":       `linode StackScript must be an ID, got "10.0.0.2/24"`,
+	} {
+		driver := NewDriver("default", "path")
+		checkFlags := &drivers.CheckDriverOptions{
+			FlagsValues: map[string]interface{}{
+				"linode-token": "TOKEN",
+				flag:           "10.0.0.2/24",
+			},
+			CreateFlags: driver.GetCreateFlags(),
+		}
+		assert.EqualError(t, driver.SetConfigFromFlags(checkFlags), expected)
+	}
+}
+
+func TestCreateRequest(t *testing.T) {
+	userdata := filepath.Join(t.TempDir(), "cloud-init.yaml")
+	assert.NoError(t, os.WriteFile(userdata, []byte("#cloud-config\n"), 0600))
+
+	driver := NewDriver("default", "path")
+	driver.RootPass = "s3cr3t"
+	driver.PrivateIP = true
+	driver.VLANLabel = "cluster"
+	driver.VLANIPAMAddress = "10.0.0.2/24"
+	driver.StackScript = "1234"
+	driver.StackScriptData = `{"hostname": "default"}`
+	driver.UserDataFile = userdata
+	driver.Tags = "rancher, test"
+
+	request, err := driver.createRequest()
+	assert.NoError(t, err)
+	assert.Equal(t, &InstanceCreateRequest{
+		Label:     "default",
+		Region:    "us-east",
+		Type:      "g6-standard-2",
+		Image:     "linode/ubuntu22.04",
+		RootPass:  "s3cr3t",
+		PrivateIP: true,
+		Tags:      []string{"rancher", "test"},
+		Interfaces: []InstanceInterface{
+			{Purpose: "public"},
+			{Purpose: "vlan", Label: "cluster", IPAMAddress: "10.0.0.2/24"},
+		},
+		StackScriptID:   1234,
+		StackScriptData: map[string]string{"hostname": "default"},
+		Metadata:        &InstanceMetadata{UserData: "I2Nsb3VkLWNvbmZpZwo="},
+		Booted:          true,
+	}, request)
+
+	// A root password is generated when none is given.
+	driver = NewDriver("default", "path")
+	request, err = driver.createRequest()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, request.RootPass)
+	assert.Nil(t, request.Interfaces)
+}
+
+func TestSplitIPv4(t *testing.T) {
+	public, private := splitIPv4([]string{"192.168.1.2", "1.2.3.4", "5.6.7.8"})
+	assert.Equal(t, "1.2.3.4", public)
+	assert.Equal(t, "192.168.1.2", private)
+
+	public, private = splitIPv4(nil)
+	assert.Empty(t, public)
+	assert.Empty(t, private)
+}
+
+func TestInstanceState(t *testing.T) {
+	assert.Equal(t, state.Starting, instanceState("provisioning"))
+	assert.Equal(t, state.Running, instanceState("running"))
+	assert.Equal(t, state.Stopping, instanceState("shutting_down"))
+	assert.Equal(t, state.Stopped, instanceState("offline"))
+	assert.Equal(t, state.None, instanceState("migrating"))
+}
+
+func TestInstanceAddresses(t *testing.T) {
+	instance := &Instance{IPv4: []string{"1.2.3.4", "192.168.1.2"}, IPv6: "2001:db8::1/128"}
+
+	assert.Equal(t, []drivers.NetworkAddress{
+		{Kind: drivers.AddressPublic, Address: "1.2.3.4"},
+		{Kind: drivers.AddressPrivate, Address: "192.168.1.2"},
+		{Kind: drivers.AddressIPv6, Address: "2001:db8::1"},
+	}, instanceAddresses(instance))
+}
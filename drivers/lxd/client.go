@@ -0,0 +1,297 @@
+package lxd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rancher/machine/libmachine/version"
+)
+
+// defaultSockets are the local unix sockets of the LXD snap, of LXD and of
+// Incus, in the order they are looked for.
+var defaultSockets = []string{
+	"/var/snap/lxd/common/lxd/unix.socket",
+	"/var/lib/lxd/unix.socket",
+	"/var/lib/incus/unix.socket",
+}
+
+// Client makes the calls to the LXD or Incus API the driver needs, in a
+// project.
+type Client struct {
+	endpoint   string
+	project    string
+	httpClient *http.Client
+}
+
+// NewClient returns a client of the API at the URL, e.g.
+// https://lxd:8443, authenticating with the client certificate, or of the
+// API at the local unix socket when no URL is given.
+func NewClient(apiURL, socket, clientCert, clientKey, serverCert, project string) (*Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	c := &Client{project: project, httpClient: &http.Client{Timeout: 60 * time.Second, Transport: transport}}
+
+	if apiURL == "" {
+		if socket == "" {
+			for _, path := range defaultSockets {
+				if _, err := os.Stat(path); err == nil {
+					socket = path
+					break
+				}
+			}
+			if socket == "" {
+				return nil, fmt.Errorf("lxd: none of the sockets %v found, is LXD or Incus running?", defaultSockets)
+			}
+		}
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		}
+		c.endpoint = "http://unix.socket/1.0"
+		return c, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if clientCert != "" {
+		cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("lxd client certificate %s: %s", clientCert, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if serverCert != "" {
+		data, err := os.ReadFile(serverCert)
+		if err != nil {
+			return nil, err
+		}
+		// The server certificate is usually self-signed: it is trusted
+		// as its own CA.
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("lxd server certificate %s: no PEM encoded certificate", serverCert)
+		}
+	}
+	transport.TLSClientConfig = tlsConfig
+	c.endpoint = strings.TrimSuffix(apiURL, "/") + "/1.0"
+	return c, nil
+}
+
+// APIError is an error answered by the LXD API.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return "lxd: " + e.Message
+}
+
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+type Server struct {
+	APIExtensions []string `json:"api_extensions"`
+	Auth          string   `json:"auth"`
+	Environment   struct {
+		Server        string `json:"server"`
+		ServerVersion string `json:"server_version"`
+	} `json:"environment"`
+}
+
+// HasExtension returns whether the server supports the API extension.
+func (s *Server) HasExtension(extension string) bool {
+	for _, e := range s.APIExtensions {
+		if e == extension {
+			return true
+		}
+	}
+	return false
+}
+
+type InstanceSource struct {
+	Type     string `json:"type"`
+	Alias    string `json:"alias"`
+	Server   string `json:"server,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+}
+
+type InstanceCreateRequest struct {
+	Name     string                       `json:"name"`
+	Type     string                       `json:"type"`
+	Source   InstanceSource               `json:"source"`
+	Profiles []string                     `json:"profiles"`
+	Config   map[string]string            `json:"config"`
+	Devices  map[string]map[string]string `json:"devices"`
+}
+
+type Instance struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
+}
+
+type InstanceState struct {
+	Status  string `json:"status"`
+	Network map[string]struct {
+		Addresses []struct {
+			Family  string `json:"family"`
+			Address string `json:"address"`
+			Scope   string `json:"scope"`
+		} `json:"addresses"`
+	} `json:"network"`
+}
+
+// do makes the call and returns the operation it started, if it is
+// asynchronous.
+func (c *Client) do(method, path string, body, reply interface{}) (string, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return "", err
+		}
+	}
+
+	rawURL := c.endpoint + path
+	if c.project != "" && !strings.HasPrefix(path, "/operations/") {
+		rawURL += "?project=" + url.QueryEscape(c.project)
+	}
+	req, err := http.NewRequest(method, rawURL, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("docker-machine/v%d", version.APIVersion))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var envelope struct {
+		Type      string          `json:"type"`
+		Error     string          `json:"error"`
+		ErrorCode int             `json:"error_code"`
+		Operation string          `json:"operation"`
+		Metadata  json.RawMessage `json:"metadata"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		if resp.StatusCode >= 400 {
+			return "", &APIError{StatusCode: resp.StatusCode, Message: resp.Status}
+		}
+		return "", err
+	}
+
+	if envelope.Type == "error" || resp.StatusCode >= 400 {
+		apiErr := &APIError{StatusCode: envelope.ErrorCode, Message: envelope.Error}
+		if apiErr.StatusCode == 0 {
+			apiErr.StatusCode = resp.StatusCode
+		}
+		if apiErr.Message == "" {
+			apiErr.Message = resp.Status
+		}
+		return "", apiErr
+	}
+
+	if reply != nil && len(envelope.Metadata) > 0 {
+		if err := json.Unmarshal(envelope.Metadata, reply); err != nil {
+			return "", err
+		}
+	}
+	if envelope.Type == "async" {
+		return strings.TrimPrefix(envelope.Operation, "/1.0"), nil
+	}
+	return "", nil
+}
+
+// wait makes the asynchronous call and waits for its operation to end,
+// failing if it did.
+func (c *Client) wait(method, path string, body interface{}) error {
+	operation, err := c.do(method, path, body, nil)
+	if err != nil || operation == "" {
+		return err
+	}
+
+	for {
+		var status struct {
+			Status string `json:"status"`
+			Err    string `json:"err"`
+		}
+		if _, err := c.do(http.MethodGet, operation+"/wait?timeout=30", nil, &status); err != nil {
+			return err
+		}
+		switch status.Status {
+		case "Success":
+			return nil
+		case "Failure", "Cancelled":
+			return errors.New("lxd: " + status.Err)
+		}
+	}
+}
+
+func (c *Client) GetServer() (*Server, error) {
+	var server Server
+	if _, err := c.do(http.MethodGet, "", nil, &server); err != nil {
+		return nil, err
+	}
+	return &server, nil
+}
+
+func (c *Client) GetProfile(name string) error {
+	_, err := c.do(http.MethodGet, "/profiles/"+url.PathEscape(name), nil, nil)
+	return err
+}
+
+func (c *Client) GetStoragePool(name string) error {
+	_, err := c.do(http.MethodGet, "/storage-pools/"+url.PathEscape(name), nil, nil)
+	return err
+}
+
+// CreateInstance creates the instance, downloading its image if need be,
+// and waits for it.
+func (c *Client) CreateInstance(request *InstanceCreateRequest) error {
+	return c.wait(http.MethodPost, "/instances", request)
+}
+
+func (c *Client) GetInstance(name string) (*Instance, error) {
+	var instance Instance
+	if _, err := c.do(http.MethodGet, "/instances/"+url.PathEscape(name), nil, &instance); err != nil {
+		return nil, err
+	}
+	return &instance, nil
+}
+
+// GetInstanceState returns the status and the network addresses of the
+// instance.
+func (c *Client) GetInstanceState(name string) (*InstanceState, error) {
+	var instanceState InstanceState
+	if _, err := c.do(http.MethodGet, "/instances/"+url.PathEscape(name)+"/state", nil, &instanceState); err != nil {
+		return nil, err
+	}
+	return &instanceState, nil
+}
+
+// UpdateState runs an action, e.g. "start", on the instance, forcing it
+// if asked, and waits for it.
+func (c *Client) UpdateState(name, action string, force bool) error {
+	body := map[string]interface{}{"action": action, "timeout": 30, "force": force}
+	return c.wait(http.MethodPut, "/instances/"+url.PathEscape(name)+"/state", body)
+}
+
+// DeleteInstance deletes the instance, with its root disk, and waits for
+// it.
+func (c *Client) DeleteInstance(name string) error {
+	return c.wait(http.MethodDelete, "/instances/"+url.PathEscape(name), nil)
+}
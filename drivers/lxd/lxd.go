@@ -0,0 +1,574 @@
+package lxd
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rancher/machine/drivers/driverutil"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/rancher/machine/libmachine/ssh"
+	"github.com/rancher/machine/libmachine/state"
+)
+
+type Driver struct {
+	*drivers.BaseDriver
+	URL             string
+	Socket          string
+	ClientCert      string
+	ClientKey       string
+	ServerCert      string
+	Project         string
+	InstanceType    string
+	Image           string
+	ImageServer     string
+	Profiles        []string
+	StoragePool     string
+	DiskSize        int
+	CPUCount        int
+	Memory          int
+	CloudConfig     string
+	SSHProxyPort    int
+	DockerProxyPort int
+}
+
+const (
+	defaultSSHUser      = "ubuntu"
+	defaultInstanceType = "container"
+	defaultImage        = "ubuntu/jammy/cloud"
+	defaultImageServer  = "https://images.linuxcontainers.org"
+	defaultProfile      = "default"
+	defaultCPUCount     = 2
+	defaultMemory       = 2048
+)
+
+// Capabilities returns the optional operations supported by the driver.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityStartStop,
+		drivers.CapabilityRestart,
+		drivers.CapabilityKill,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+	}
+}
+
+// GetCreateFlags registers the flags this driver adds to
+// "docker hosts create"
+func (d *Driver) GetCreateFlags() []mcnflag.Flag {
+	return []mcnflag.Flag{
+		mcnflag.StringFlag{
+			EnvVar: "LXD_URL",
+			Name:   "lxd-url",
+			Usage:  "URL of a remote LXD or Incus API, e.g. https://lxd.example.com:8443 (default the local unix socket)",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LXD_SOCKET",
+			Name:   "lxd-socket",
+			Usage:  "path of the local unix socket of LXD or Incus (default the first one found)",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LXD_CLIENT_CERT",
+			Name:   "lxd-client-cert",
+			Usage:  "path of the client certificate trusted by the remote API",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LXD_CLIENT_KEY",
+			Name:   "lxd-client-key",
+			Usage:  "path of the key of the client certificate",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LXD_SERVER_CERT",
+			Name:   "lxd-server-cert",
+			Usage:  "path of the certificate of the remote API, when it is self-signed",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LXD_PROJECT",
+			Name:   "lxd-project",
+			Usage:  "project to create the instance in (default the default project)",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LXD_INSTANCE_TYPE",
+			Name:   "lxd-instance-type",
+			Usage:  "type of the instance, container or virtual-machine",
+			Value:  defaultInstanceType,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LXD_IMAGE",
+			Name:   "lxd-image",
+			Usage:  "alias of the image, which must run cloud-init and SSH",
+			Value:  defaultImage,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LXD_IMAGE_SERVER",
+			Name:   "lxd-image-server",
+			Usage:  "simplestreams server of the image, empty for an image of the API",
+			Value:  defaultImageServer,
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "LXD_PROFILES",
+			Name:   "lxd-profiles",
+			Usage:  "profiles applied to the instance",
+			Value:  []string{defaultProfile},
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LXD_STORAGE_POOL",
+			Name:   "lxd-storage-pool",
+			Usage:  "storage pool of the root disk (default the one of the profiles)",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "LXD_DISK_SIZE",
+			Name:   "lxd-disk-size",
+			Usage:  "size of the root disk in GB, with --lxd-storage-pool (default the one of the profiles)",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "LXD_CPU_COUNT",
+			Name:   "lxd-cpu-count",
+			Usage:  "number of CPUs of the instance",
+			Value:  defaultCPUCount,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "LXD_MEMORY",
+			Name:   "lxd-memory",
+			Usage:  "memory of the instance in MB",
+			Value:  defaultMemory,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LXD_CLOUD_CONFIG",
+			Name:   "lxd-cloud-config",
+			Usage:  "path of a cloud-config file merged into the user data",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "LXD_SSH_PROXY_PORT",
+			Name:   "lxd-ssh-proxy-port",
+			Usage:  "port of the host proxied to SSH of a container, with --lxd-docker-proxy-port (default SSH to the container IP)",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "LXD_DOCKER_PROXY_PORT",
+			Name:   "lxd-docker-proxy-port",
+			Usage:  "port of the host proxied to Docker of a container, with --lxd-ssh-proxy-port",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LXD_SSH_USER",
+			Name:   "lxd-ssh-user",
+			Usage:  "SSH username, created by cloud-init",
+			Value:  defaultSSHUser,
+		},
+	}
+}
+
+func NewDriver(hostName, storePath string) *Driver {
+	return &Driver{
+		InstanceType: defaultInstanceType,
+		Image:        defaultImage,
+		ImageServer:  defaultImageServer,
+		Profiles:     []string{defaultProfile},
+		CPUCount:     defaultCPUCount,
+		Memory:       defaultMemory,
+		BaseDriver: &drivers.BaseDriver{
+			MachineName: hostName,
+			StorePath:   storePath,
+			SSHUser:     defaultSSHUser,
+		},
+	}
+}
+
+func (d *Driver) GetSSHHostname() (string, error) {
+	return d.GetIP()
+}
+
+// DriverName returns the name of the driver
+func (d *Driver) DriverName() string {
+	return "lxd"
+}
+
+func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
+	d.URL = flags.String("lxd-url")
+	d.Socket = flags.String("lxd-socket")
+	d.ClientCert = flags.String("lxd-client-cert")
+	d.ClientKey = flags.String("lxd-client-key")
+	d.ServerCert = flags.String("lxd-server-cert")
+	d.Project = flags.String("lxd-project")
+	d.InstanceType = flags.String("lxd-instance-type")
+	d.Image = flags.String("lxd-image")
+	d.ImageServer = flags.String("lxd-image-server")
+	d.Profiles = flags.StringSlice("lxd-profiles")
+	d.StoragePool = flags.String("lxd-storage-pool")
+	d.DiskSize = flags.Int("lxd-disk-size")
+	d.CPUCount = flags.Int("lxd-cpu-count")
+	d.Memory = flags.Int("lxd-memory")
+	d.CloudConfig = flags.String("lxd-cloud-config")
+	d.SSHProxyPort = flags.Int("lxd-ssh-proxy-port")
+	d.DockerProxyPort = flags.Int("lxd-docker-proxy-port")
+	d.SSHUser = flags.String("lxd-ssh-user")
+
+	d.SetSwarmConfigFromFlags(flags)
+	if err := d.SetUserDataFromFlags(flags); err != nil {
+		return err
+	}
+
+	if d.InstanceType != "container" && d.InstanceType != "virtual-machine" {
+		return fmt.Errorf("lxd instance type must be container or virtual-machine, got %q", d.InstanceType)
+	}
+	if d.URL != "" {
+		if _, err := url.Parse(d.URL); err != nil {
+			return fmt.Errorf("lxd URL %s: %s", d.URL, err)
+		}
+		if d.ClientCert == "" || d.ClientKey == "" {
+			return fmt.Errorf("lxd driver requires the --lxd-client-cert and --lxd-client-key options with --lxd-url")
+		}
+	}
+	if d.DiskSize > 0 && d.StoragePool == "" {
+		return fmt.Errorf("lxd driver requires the --lxd-storage-pool option with --lxd-disk-size")
+	}
+	if (d.SSHProxyPort > 0) != (d.DockerProxyPort > 0) {
+		return fmt.Errorf("lxd driver requires both the --lxd-ssh-proxy-port and --lxd-docker-proxy-port options to proxy the ports")
+	}
+	if d.SSHProxyPort > 0 {
+		if d.InstanceType != "container" {
+			return fmt.Errorf("lxd proxy devices forward the ports of containers only, virtual machines are reached on their IP")
+		}
+		d.SSHPort = d.SSHProxyPort
+	}
+
+	return nil
+}
+
+func (d *Driver) PreCreateCheck() error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	server, err := client.GetServer()
+	if err != nil {
+		return err
+	}
+	if server.Auth != "" && server.Auth != "trusted" {
+		return fmt.Errorf("lxd: the client certificate is not trusted by %s", d.URL)
+	}
+	if d.InstanceType == "virtual-machine" && !server.HasExtension("virtual-machines") {
+		return fmt.Errorf("lxd %s %s doesn't support virtual machines", server.Environment.Server, server.Environment.ServerVersion)
+	}
+
+	for _, profile := range d.Profiles {
+		if err := client.GetProfile(profile); err != nil {
+			if isNotFound(err) {
+				return fmt.Errorf("lxd profile %s doesn't exist", profile)
+			}
+			return err
+		}
+	}
+	if d.StoragePool != "" {
+		if err := client.GetStoragePool(d.StoragePool); err != nil {
+			if isNotFound(err) {
+				return fmt.Errorf("lxd storage pool %s doesn't exist", d.StoragePool)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Driver) Create() error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	server, err := client.GetServer()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Creating SSH key...")
+
+	d.SSHKeyPath = d.GetSSHKeyPath()
+	if err := ssh.GenerateSSHKey(d.SSHKeyPath); err != nil {
+		return err
+	}
+	publicKey, err := os.ReadFile(d.SSHKeyPath + ".pub")
+	if err != nil {
+		return err
+	}
+	userData, err := driverutil.CloudConfigWithUser(d.BaseDriver, d.CloudConfig, strings.TrimSpace(string(publicKey)))
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Creating LXD %s %s from image %s...", d.InstanceType, d.MachineName, d.Image)
+
+	if err := client.CreateInstance(d.createRequest(server, string(userData))); err != nil {
+		return err
+	}
+	if err := client.UpdateState(d.MachineName, "start", false); err != nil {
+		return d.removeAfter(err)
+	}
+
+	log.Info("Waiting for the instance to get an IP address...")
+	for {
+		instanceState, err := client.GetInstanceState(d.MachineName)
+		if err != nil {
+			return d.removeAfter(err)
+		}
+		if ip := instanceIP(instanceState); ip != "" {
+			d.IPAddress = ip
+			break
+		}
+
+		time.Sleep(2 * time.Second)
+	}
+	if d.SSHProxyPort > 0 {
+		d.IPAddress = d.proxyHost()
+	}
+
+	log.Debugf("Created LXD %s %s, IP address %s", d.InstanceType, d.MachineName, d.IPAddress)
+
+	return nil
+}
+
+// createRequest returns the request creating the instance with the user
+// data, nested to run Docker if it is a container.
+func (d *Driver) createRequest(server *Server, userData string) *InstanceCreateRequest {
+	request := &InstanceCreateRequest{
+		Name:     d.MachineName,
+		Type:     d.InstanceType,
+		Source:   InstanceSource{Type: "image", Alias: d.Image},
+		Profiles: d.Profiles,
+		Config: map[string]string{
+			"limits.cpu":    strconv.Itoa(d.CPUCount),
+			"limits.memory": fmt.Sprintf("%dMiB", d.Memory),
+		},
+		Devices: map[string]map[string]string{},
+	}
+	if d.ImageServer != "" {
+		request.Source.Server = d.ImageServer
+		request.Source.Protocol = "simplestreams"
+	}
+
+	// Servers before the cloud-init keys only read the user keys.
+	if server.HasExtension("cloud_init") {
+		request.Config["cloud-init.user-data"] = userData
+	} else {
+		request.Config["user.user-data"] = userData
+	}
+	if d.InstanceType == "container" {
+		request.Config["security.nesting"] = "true"
+	}
+
+	if d.StoragePool != "" {
+		root := map[string]string{"type": "disk", "path": "/", "pool": d.StoragePool}
+		if d.DiskSize > 0 {
+			root["size"] = fmt.Sprintf("%dGiB", d.DiskSize)
+		}
+		request.Devices["root"] = root
+	}
+	if d.SSHProxyPort > 0 {
+		listen := "127.0.0.1"
+		if d.URL != "" {
+			listen = "0.0.0.0"
+		}
+		for name, ports := range map[string][2]int{"ssh": {d.SSHProxyPort, 22}, "docker": {d.DockerProxyPort, 2376}} {
+			request.Devices[name] = map[string]string{
+				"type":    "proxy",
+				"listen":  fmt.Sprintf("tcp:%s:%d", listen, ports[0]),
+				"connect": fmt.Sprintf("tcp:127.0.0.1:%d", ports[1]),
+			}
+		}
+	}
+
+	return request
+}
+
+// proxyHost returns the host of the proxy devices: the one of the remote
+// API, or the loopback one.
+func (d *Driver) proxyHost() string {
+	if d.URL == "" {
+		return "127.0.0.1"
+	}
+	u, _ := url.Parse(d.URL)
+	return u.Hostname()
+}
+
+// interfaces returns the names of the network interfaces of the instance
+// but the loopback one, sorted.
+func interfaces(instanceState *InstanceState) []string {
+	var names []string
+	for name := range instanceState.Network {
+		if name != "lo" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// instanceIP returns the first global IPv4 address of the instance.
+func instanceIP(instanceState *InstanceState) string {
+	for _, name := range interfaces(instanceState) {
+		for _, addr := range instanceState.Network[name].Addresses {
+			if addr.Family == "inet" && addr.Scope == "global" {
+				return addr.Address
+			}
+		}
+	}
+	return ""
+}
+
+func (d *Driver) removeAfter(err error) error {
+	if removeErr := d.Remove(); removeErr != nil {
+		return fmt.Errorf("failed to create machine due to error: %v. Removing instance: %v", err, removeErr)
+	}
+	return err
+}
+
+func (d *Driver) GetURL() (string, error) {
+	if err := drivers.MustBeRunning(d); err != nil {
+		return "", err
+	}
+
+	ip, err := d.GetIP()
+	if err != nil {
+		return "", err
+	}
+
+	port := 2376
+	if d.DockerProxyPort > 0 {
+		port = d.DockerProxyPort
+	}
+	return fmt.Sprintf("tcp://%s", net.JoinHostPort(ip, strconv.Itoa(port))), nil
+}
+
+// GetIPs returns the global addresses of the instance.
+func (d *Driver) GetIPs() ([]drivers.NetworkAddress, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return nil, err
+	}
+	instanceState, err := client.GetInstanceState(d.MachineName)
+	if err != nil {
+		return nil, err
+	}
+
+	return instanceAddresses(instanceState), nil
+}
+
+// instanceAddresses returns the global addresses of the instance, private or
+// public as their range is.
+func instanceAddresses(instanceState *InstanceState) []drivers.NetworkAddress {
+	var addrs []drivers.NetworkAddress
+	for _, name := range interfaces(instanceState) {
+		for _, addr := range instanceState.Network[name].Addresses {
+			ip := net.ParseIP(addr.Address)
+			if addr.Scope != "global" || ip == nil {
+				continue
+			}
+			switch {
+			case addr.Family == "inet6":
+				addrs = drivers.AppendAddress(addrs, drivers.AddressIPv6, addr.Address)
+			case ip.IsPrivate():
+				addrs = drivers.AppendAddress(addrs, drivers.AddressPrivate, addr.Address)
+			default:
+				addrs = drivers.AppendAddress(addrs, drivers.AddressPublic, addr.Address)
+			}
+		}
+	}
+
+	return addrs
+}
+
+func (d *Driver) GetState() (state.State, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return state.Error, err
+	}
+	instance, err := client.GetInstance(d.MachineName)
+	if err != nil {
+		if !isNotFound(err) {
+			return state.Error, err
+		}
+		return state.None, fmt.Errorf("machine %v not found", d.MachineName)
+	}
+
+	return instanceStatus(instance.Status), nil
+}
+
+// instanceStatus returns the state of an instance of the status.
+func instanceStatus(status string) state.State {
+	switch status {
+	case "Running":
+		return state.Running
+	case "Starting":
+		return state.Starting
+	case "Stopping":
+		return state.Stopping
+	case "Stopped":
+		return state.Stopped
+	case "Frozen":
+		return state.Paused
+	case "Error":
+		return state.Error
+	}
+	return state.None
+}
+
+func (d *Driver) Start() error {
+	return d.updateState("start", false)
+}
+
+// Stop shuts the instance down cleanly.
+func (d *Driver) Stop() error {
+	return d.updateState("stop", false)
+}
+
+func (d *Driver) Restart() error {
+	return d.updateState("restart", false)
+}
+
+func (d *Driver) Kill() error {
+	return d.updateState("stop", true)
+}
+
+func (d *Driver) updateState(action string, force bool) error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	return client.UpdateState(d.MachineName, action, force)
+}
+
+// Remove stops the instance and deletes it with its root disk.
+func (d *Driver) Remove() error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	instance, err := client.GetInstance(d.MachineName)
+	if err != nil {
+		if !isNotFound(err) {
+			return err
+		}
+		log.Infof("LXD instance doesn't exist, assuming it is already deleted")
+		return nil
+	}
+
+	if instance.Status != "Stopped" {
+		if err := client.UpdateState(d.MachineName, "stop", true); err != nil {
+			return err
+		}
+	}
+	if err := client.DeleteInstance(d.MachineName); err != nil && !isNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func (d *Driver) getClient() (*Client, error) {
+	return NewClient(d.URL, d.Socket, d.ClientCert, d.ClientKey, d.ServerCert, d.Project)
+}
@@ -0,0 +1,153 @@
+package lxd
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetConfigFromFlags(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"lxd-profiles":          []string{"default", "docker"},
+			"lxd-ssh-proxy-port":    2222,
+			"lxd-docker-proxy-port": 2376,
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	err := driver.SetConfigFromFlags(checkFlags)
+
+	assert.NoError(t, err)
+	assert.Empty(t, checkFlags.InvalidFlags)
+	assert.Equal(t, "container", driver.InstanceType)
+	assert.Equal(t, "ubuntu/jammy/cloud", driver.Image)
+	assert.Equal(t, []string{"default", "docker"}, driver.Profiles)
+
+	sshPort, err := driver.GetSSHPort()
+	assert.NoError(t, err)
+	assert.Equal(t, "ubuntu", driver.GetSSHUsername())
+	assert.Equal(t, 2222, sshPort)
+}
+
+func TestSetConfigFromFlagsInvalid(t *testing.T) {
+	for flags, expected := range map[string]string{
+		`{"lxd-instance-type": "vm"}`:     `lxd instance type must be container or virtual-machine, got "vm"`,
+		`{"lxd-url": "https://lxd:8443"}`: "lxd driver requires the --lxd-client-cert and --lxd-client-key options with --lxd-url",
+		`{"lxd-disk-size": 20}`:           "lxd driver requires the --lxd-storage-pool option with --lxd-disk-size",
+		`{"lxd-ssh-proxy-port": 2222}`:    "lxd driver requires both the --lxd-ssh-proxy-port and --lxd-docker-proxy-port options to proxy the ports",
+		`{"lxd-instance-type": "virtual-machine", "lxd-ssh-proxy-port": 2222, "lxd-docker-proxy-port": 2376}`: "lxd proxy devices forward the ports of containers only, virtual machines are reached on their IP",
+	} {
+		var values map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(flags), &values))
+		// JSON numbers are floats, the flags ints.
+		for name, value := range values {
+			if f, ok := value.(float64); ok {
+				values[name] = int(f)
+			}
+		}
+
+		driver := NewDriver("default", "path")
+		checkFlags := &drivers.CheckDriverOptions{FlagsValues: values, CreateFlags: driver.GetCreateFlags()}
+		assert.EqualError(t, driver.SetConfigFromFlags(checkFlags), expected, flags)
+	}
+}
+
+// testInstanceState is the state of an instance with addresses of all the
+// kinds.
+const testInstanceState = `{"status": "Running", "network": {
+	"lo": {"addresses": [{"family": "inet", "address": "127.0.0.1", "scope": "local"}]},
+	"eth0": {"addresses": [{"family": "inet", "address": "10.10.0.5", "scope": "global"}, {"family": "inet6", "address": "fd42::5", "scope": "global"}, {"family": "inet6", "address": "fe80::1", "scope": "link"}]},
+	"eth1": {"addresses": [{"family": "inet", "address": "203.0.113.5", "scope": "global"}]}}}`
+
+func TestCreateRequest(t *testing.T) {
+	driver := NewDriver("default", "path")
+	driver.StoragePool = "fast"
+	driver.DiskSize = 20
+	driver.SSHProxyPort = 2222
+	driver.DockerProxyPort = 12376
+
+	server := &Server{APIExtensions: []string{"virtual-machines", "cloud_init"}}
+	assert.Equal(t, &InstanceCreateRequest{
+		Name: "default",
+		Type: "container",
+		Source: InstanceSource{
+			Type:     "image",
+			Alias:    "ubuntu/jammy/cloud",
+			Server:   "https://images.linuxcontainers.org",
+			Protocol: "simplestreams",
+		},
+		Profiles: []string{"default"},
+		Config: map[string]string{
+			"limits.cpu":           "2",
+			"limits.memory":        "2048MiB",
+			"security.nesting":     "true",
+			"cloud-init.user-data": "#cloud-config\n",
+		},
+		Devices: map[string]map[string]string{
+			"root":   {"type": "disk", "path": "/", "pool": "fast", "size": "20GiB"},
+			"ssh":    {"type": "proxy", "listen": "tcp:127.0.0.1:2222", "connect": "tcp:127.0.0.1:22"},
+			"docker": {"type": "proxy", "listen": "tcp:127.0.0.1:12376", "connect": "tcp:127.0.0.1:2376"},
+		},
+	}, driver.createRequest(server, "#cloud-config\n"))
+
+	// Servers before the cloud-init keys get the user data in the user keys,
+	// remote ones the proxy devices on all their addresses.
+	driver.URL = "https://lxd:8443"
+	driver.InstanceType = "virtual-machine"
+	request := driver.createRequest(&Server{}, "#cloud-config\n")
+	assert.Equal(t, "#cloud-config\n", request.Config["user.user-data"])
+	assert.NotContains(t, request.Config, "cloud-init.user-data")
+	assert.NotContains(t, request.Config, "security.nesting")
+	assert.Equal(t, "tcp:0.0.0.0:2222", request.Devices["ssh"]["listen"])
+	assert.Equal(t, "lxd", driver.proxyHost())
+}
+
+func TestInstanceIP(t *testing.T) {
+	var instanceState InstanceState
+	assert.NoError(t, json.Unmarshal([]byte(testInstanceState), &instanceState))
+	assert.Equal(t, "10.10.0.5", instanceIP(&instanceState))
+
+	// The instance only gets an address once it runs.
+	instanceState = InstanceState{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"status": "Running", "network": {"eth0": {"addresses": [{"family": "inet6", "address": "fe80::1", "scope": "link"}]}}}`), &instanceState))
+	assert.Empty(t, instanceIP(&instanceState))
+}
+
+func TestInstanceStatus(t *testing.T) {
+	for status, expected := range map[string]state.State{
+		"Running":  state.Running,
+		"Starting": state.Starting,
+		"Stopping": state.Stopping,
+		"Stopped":  state.Stopped,
+		"Frozen":   state.Paused,
+		"Error":    state.Error,
+		"Unknown":  state.None,
+	} {
+		assert.Equal(t, expected, instanceStatus(status), status)
+	}
+}
+
+func TestInstanceAddresses(t *testing.T) {
+	var instanceState InstanceState
+	assert.NoError(t, json.Unmarshal([]byte(testInstanceState), &instanceState))
+
+	assert.Equal(t, []drivers.NetworkAddress{
+		{Kind: drivers.AddressPrivate, Address: "10.10.0.5"},
+		{Kind: drivers.AddressIPv6, Address: "fd42::5"},
+		{Kind: drivers.AddressPublic, Address: "203.0.113.5"},
+	}, instanceAddresses(&instanceState))
+}
+
+func TestIsNotFound(t *testing.T) {
+	assert.True(t, isNotFound(&APIError{StatusCode: http.StatusNotFound}))
+	assert.False(t, isNotFound(&APIError{StatusCode: http.StatusInternalServerError}))
+	assert.False(t, isNotFound(errors.New("lxd: timeout")))
+}
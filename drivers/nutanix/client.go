@@ -0,0 +1,353 @@
+package nutanix
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rancher/machine/libmachine/version"
+)
+
+// Client makes the calls to the Prism Central v3 API the driver needs.
+type Client struct {
+	endpoint           string
+	username, password string
+	httpClient         *http.Client
+}
+
+// NewClient returns a client of the Prism Central at the endpoint, e.g.
+// https://pc.example.com:9440.
+func NewClient(endpoint, username, password string, insecureTLS bool) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if insecureTLS {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &Client{
+		endpoint:   strings.TrimSuffix(endpoint, "/") + "/api/nutanix/v3",
+		username:   username,
+		password:   password,
+		httpClient: &http.Client{Timeout: 60 * time.Second, Transport: transport},
+	}
+}
+
+// APIError is an error answered by the Prism Central API.
+type APIError struct {
+	StatusCode  int
+	MessageList []struct {
+		Reason  string `json:"reason"`
+		Message string `json:"message"`
+	} `json:"message_list"`
+}
+
+func (e *APIError) Error() string {
+	if len(e.MessageList) == 0 {
+		return fmt.Sprintf("nutanix: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("nutanix: %s (%s)", e.MessageList[0].Message, e.MessageList[0].Reason)
+}
+
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+type Reference struct {
+	Kind string `json:"kind"`
+	UUID string `json:"uuid"`
+	Name string `json:"name,omitempty"`
+}
+
+// Entity is an entity of the API, with its fields besides metadata kept
+// as they are, for updates.
+type Entity struct {
+	Metadata struct {
+		Kind string `json:"kind"`
+		UUID string `json:"uuid"`
+	} `json:"metadata"`
+	Spec   json.RawMessage `json:"spec,omitempty"`
+	Status json.RawMessage `json:"status,omitempty"`
+}
+
+type VMStatus struct {
+	State     string `json:"state"`
+	Resources struct {
+		PowerState string `json:"power_state"`
+		NICList    []struct {
+			IPEndpointList []struct {
+				IP string `json:"ip"`
+			} `json:"ip_endpoint_list"`
+		} `json:"nic_list"`
+	} `json:"resources"`
+}
+
+// IPs returns the addresses of the NICs of the VM.
+func (s *VMStatus) IPs() []string {
+	var ips []string
+	for _, nic := range s.Resources.NICList {
+		for _, endpoint := range nic.IPEndpointList {
+			if endpoint.IP != "" {
+				ips = append(ips, endpoint.IP)
+			}
+		}
+	}
+	return ips
+}
+
+type Disk struct {
+	DataSourceReference *Reference       `json:"data_source_reference,omitempty"`
+	DeviceProperties    DeviceProperties `json:"device_properties"`
+	DiskSizeMib         int64            `json:"disk_size_mib,omitempty"`
+}
+
+type DeviceProperties struct {
+	DeviceType  string `json:"device_type"`
+	DiskAddress struct {
+		AdapterType string `json:"adapter_type"`
+		DeviceIndex int    `json:"device_index"`
+	} `json:"disk_address"`
+}
+
+type NIC struct {
+	SubnetReference Reference `json:"subnet_reference"`
+}
+
+type VMResources struct {
+	NumSockets         int    `json:"num_sockets"`
+	NumVCPUsPerSocket  int    `json:"num_vcpus_per_socket"`
+	MemorySizeMib      int    `json:"memory_size_mib"`
+	PowerState         string `json:"power_state"`
+	DiskList           []Disk `json:"disk_list"`
+	NICList            []NIC  `json:"nic_list"`
+	GuestCustomization struct {
+		CloudInit struct {
+			UserData string `json:"user_data"`
+		} `json:"cloud_init"`
+	} `json:"guest_customization"`
+}
+
+type VMCreateRequest struct {
+	Spec struct {
+		Name             string      `json:"name"`
+		Resources        VMResources `json:"resources"`
+		ClusterReference Reference   `json:"cluster_reference"`
+	} `json:"spec"`
+	Metadata struct {
+		Kind             string            `json:"kind"`
+		Categories       map[string]string `json:"categories,omitempty"`
+		ProjectReference *Reference        `json:"project_reference,omitempty"`
+	} `json:"metadata"`
+}
+
+func (c *Client) do(method, path string, body, reply interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.endpoint+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.username, c.password)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("docker-machine/v%d", version.APIVersion))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 400 {
+		apiErr := &APIError{}
+		json.Unmarshal(data, apiErr)
+		apiErr.StatusCode = resp.StatusCode
+		return apiErr
+	}
+
+	if reply == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, reply)
+}
+
+// find returns the entities of the kind, e.g. "cluster", with the name.
+func (c *Client) find(kind, name string) ([]Entity, error) {
+	var reply struct {
+		Entities []Entity `json:"entities"`
+	}
+	request := map[string]interface{}{"kind": kind, "filter": "name==" + name, "length": 100}
+	if err := c.do(http.MethodPost, "/"+kind+"s/list", request, &reply); err != nil {
+		return nil, err
+	}
+	return reply.Entities, nil
+}
+
+// FindCluster returns the UUID of the AOS cluster with the name, not the
+// Prism Central one.
+func (c *Client) FindCluster(name string) (string, error) {
+	entities, err := c.find("cluster", name)
+	if err != nil {
+		return "", err
+	}
+	for _, entity := range entities {
+		var status struct {
+			Resources struct {
+				Config struct {
+					ServiceList []string `json:"service_list"`
+				} `json:"config"`
+			} `json:"resources"`
+		}
+		json.Unmarshal(entity.Status, &status)
+		for _, service := range status.Resources.Config.ServiceList {
+			if service == "AOS" {
+				return entity.Metadata.UUID, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("nutanix: no cluster %s", name)
+}
+
+func (c *Client) findOne(kind, name string) (string, error) {
+	entities, err := c.find(kind, name)
+	if err != nil {
+		return "", err
+	}
+	if len(entities) == 0 {
+		return "", fmt.Errorf("nutanix: no %s %s", kind, name)
+	}
+	return entities[0].Metadata.UUID, nil
+}
+
+func (c *Client) FindProject(name string) (string, error) {
+	return c.findOne("project", name)
+}
+
+func (c *Client) FindImage(name string) (string, error) {
+	return c.findOne("image", name)
+}
+
+// FindSubnet returns the UUID of the subnet with the name on the cluster,
+// or of the overlay one, which is on none.
+func (c *Client) FindSubnet(name, clusterUUID string) (string, error) {
+	entities, err := c.find("subnet", name)
+	if err != nil {
+		return "", err
+	}
+	for _, entity := range entities {
+		var spec struct {
+			ClusterReference *Reference `json:"cluster_reference"`
+		}
+		json.Unmarshal(entity.Spec, &spec)
+		if spec.ClusterReference == nil || spec.ClusterReference.UUID == clusterUUID {
+			return entity.Metadata.UUID, nil
+		}
+	}
+	return "", fmt.Errorf("nutanix: no subnet %s on the cluster", name)
+}
+
+// GetCategoryValue fails if the category has no value.
+func (c *Client) GetCategoryValue(key, value string) error {
+	return c.do(http.MethodGet, "/categories/"+key+"/"+value, nil, nil)
+}
+
+// WaitTask waits for the task to succeed.
+func (c *Client) WaitTask(uuid string) error {
+	for {
+		var task struct {
+			Status      string `json:"status"`
+			ErrorDetail string `json:"error_detail"`
+		}
+		if err := c.do(http.MethodGet, "/tasks/"+uuid, nil, &task); err != nil {
+			return err
+		}
+		switch task.Status {
+		case "SUCCEEDED":
+			return nil
+		case "FAILED", "ABORTED":
+			return fmt.Errorf("nutanix: task %s failed: %s", uuid, task.ErrorDetail)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+type taskReply struct {
+	Metadata struct {
+		UUID string `json:"uuid"`
+	} `json:"metadata"`
+	Status struct {
+		ExecutionContext struct {
+			TaskUUID string `json:"task_uuid"`
+		} `json:"execution_context"`
+	} `json:"status"`
+}
+
+// CreateVM creates the VM and returns its UUID and the one of the task
+// creating it.
+func (c *Client) CreateVM(request *VMCreateRequest) (string, string, error) {
+	var reply taskReply
+	if err := c.do(http.MethodPost, "/vms", request, &reply); err != nil {
+		return "", "", err
+	}
+	return reply.Metadata.UUID, reply.Status.ExecutionContext.TaskUUID, nil
+}
+
+func (c *Client) GetVM(uuid string) (*VMStatus, error) {
+	var reply struct {
+		Status VMStatus `json:"status"`
+	}
+	if err := c.do(http.MethodGet, "/vms/"+uuid, nil, &reply); err != nil {
+		return nil, err
+	}
+	return &reply.Status, nil
+}
+
+// SetPowerState powers the VM on or, with the mechanism, ACPI or HARD,
+// off and waits for it.
+func (c *Client) SetPowerState(uuid, powerState, mechanism string) error {
+	// Updates put the spec and metadata read back, with the status left
+	// out.
+	var vm map[string]interface{}
+	if err := c.do(http.MethodGet, "/vms/"+uuid, nil, &vm); err != nil {
+		return err
+	}
+	delete(vm, "status")
+	spec, _ := vm["spec"].(map[string]interface{})
+	resources, _ := spec["resources"].(map[string]interface{})
+	if resources == nil {
+		return fmt.Errorf("nutanix: VM %s has no resources", uuid)
+	}
+	resources["power_state"] = powerState
+	if mechanism != "" {
+		resources["power_state_mechanism"] = map[string]interface{}{"mechanism": mechanism}
+	}
+
+	var reply taskReply
+	if err := c.do(http.MethodPut, "/vms/"+uuid, vm, &reply); err != nil {
+		return err
+	}
+	return c.WaitTask(reply.Status.ExecutionContext.TaskUUID)
+}
+
+// DeleteVM deletes the VM and waits for it.
+func (c *Client) DeleteVM(uuid string) error {
+	var reply taskReply
+	if err := c.do(http.MethodDelete, "/vms/"+uuid, nil, &reply); err != nil {
+		return err
+	}
+	return c.WaitTask(reply.Status.ExecutionContext.TaskUUID)
+}
@@ -0,0 +1,519 @@
+package nutanix
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rancher/machine/drivers/driverutil"
+	"github.com/rancher/machine/libmachine/drivers"
+	rpcdriver "github.com/rancher/machine/libmachine/drivers/rpc"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/rancher/machine/libmachine/ssh"
+	"github.com/rancher/machine/libmachine/state"
+)
+
+type Driver struct {
+	*drivers.BaseDriver
+	Endpoint       string
+	Port           int
+	Username       string
+	Password       string
+	Insecure       bool
+	Cluster        string
+	Project        string
+	Image          string
+	Subnets        []string
+	Categories     []string
+	Sockets        int
+	VCPUsPerSocket int
+	Memory         int
+	DiskSize       int
+	UserDataFile   string
+	VMUUID         string
+}
+
+const (
+	defaultSSHUser        = "ubuntu"
+	defaultPort           = 9440
+	defaultSockets        = 2
+	defaultVCPUsPerSocket = 1
+	defaultMemory         = 4096
+)
+
+// Capabilities returns the optional operations supported by the driver.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityStartStop,
+		drivers.CapabilityRestart,
+		drivers.CapabilityKill,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+	}
+}
+
+// GetCreateFlags registers the flags this driver adds to
+// "docker hosts create"
+func (d *Driver) GetCreateFlags() []mcnflag.Flag {
+	return []mcnflag.Flag{
+		mcnflag.StringFlag{
+			EnvVar: "NUTANIX_ENDPOINT",
+			Name:   "nutanix-endpoint",
+			Usage:  "address of Prism Central",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "NUTANIX_PORT",
+			Name:   "nutanix-port",
+			Usage:  "port of Prism Central",
+			Value:  defaultPort,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "NUTANIX_USERNAME",
+			Name:   "nutanix-username",
+			Usage:  "Prism Central username",
+		},
+		mcnflag.StringFlag{
+			EnvVar:    "NUTANIX_PASSWORD",
+			Name:      "nutanix-password",
+			Usage:     "Prism Central password",
+			Sensitive: true,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "NUTANIX_INSECURE",
+			Name:   "nutanix-insecure",
+			Usage:  "do not verify the certificate of Prism Central, e.g. a self-signed one",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "NUTANIX_CLUSTER",
+			Name:   "nutanix-cluster",
+			Usage:  "name of the cluster to create the VM on",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "NUTANIX_PROJECT",
+			Name:   "nutanix-project",
+			Usage:  "name of the project of the VM",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "NUTANIX_VM_IMAGE",
+			Name:   "nutanix-vm-image",
+			Usage:  "name of the image to clone the disk of the VM from",
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "NUTANIX_VM_NETWORK",
+			Name:   "nutanix-vm-network",
+			Usage:  "names of the subnets to attach the VM to, the first one reaching it",
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "NUTANIX_VM_CATEGORIES",
+			Name:   "nutanix-vm-categories",
+			Usage:  "categories of the VM, as key=value",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "NUTANIX_VM_CPUS",
+			Name:   "nutanix-vm-cpus",
+			Usage:  "number of CPU sockets of the VM",
+			Value:  defaultSockets,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "NUTANIX_VM_CORES",
+			Name:   "nutanix-vm-cores",
+			Usage:  "number of vCPUs per socket of the VM",
+			Value:  defaultVCPUsPerSocket,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "NUTANIX_VM_MEM",
+			Name:   "nutanix-vm-mem",
+			Usage:  "memory of the VM in MiB",
+			Value:  defaultMemory,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "NUTANIX_DISK_SIZE",
+			Name:   "nutanix-disk-size",
+			Usage:  "size of the disk of the VM in GiB (default the one of the image)",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "NUTANIX_CLOUD_INIT",
+			Name:   "nutanix-cloud-init",
+			Usage:  "path of a #cloud-config file to pass to cloud-init",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "NUTANIX_VM_SSH_USER",
+			Name:   "nutanix-vm-ssh-user",
+			Usage:  "SSH username",
+			Value:  defaultSSHUser,
+		},
+	}
+}
+
+func NewDriver(hostName, storePath string) *Driver {
+	return &Driver{
+		Port:           defaultPort,
+		Sockets:        defaultSockets,
+		VCPUsPerSocket: defaultVCPUsPerSocket,
+		Memory:         defaultMemory,
+		BaseDriver: &drivers.BaseDriver{
+			MachineName: hostName,
+			StorePath:   storePath,
+			SSHUser:     defaultSSHUser,
+		},
+	}
+}
+
+func (d *Driver) GetSSHHostname() (string, error) {
+	return d.GetIP()
+}
+
+// DriverName returns the name of the driver
+func (d *Driver) DriverName() string {
+	return "nutanix"
+}
+
+// UnmarshalJSON loads driver config from JSON. This function is used by the RPCServerDriver that wraps
+// all drivers as a means of populating an already-initialized driver with new configuration.
+// See `RPCServerDriver.SetConfigRaw`.
+func (d *Driver) UnmarshalJSON(data []byte) error {
+	// Unmarshal driver config into an aliased type to prevent infinite recursion on UnmarshalJSON.
+	type targetDriver Driver
+
+	// Copy data from `d` to `target` before unmarshalling. This will ensure that already-initialized values
+	// from `d` that are left untouched during unmarshal (like functions) are preserved.
+	target := targetDriver(*d)
+
+	if err := json.Unmarshal(data, &target); err != nil {
+		return fmt.Errorf("error unmarshalling driver config from JSON: %w", err)
+	}
+
+	// Copy unmarshalled data back to `d`.
+	*d = Driver(target)
+
+	// Make sure to reload values that are subject to change from envvars and os.Args.
+	driverOpts, err := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	if err != nil {
+		return err
+	}
+	if _, ok := driverOpts.Values["nutanix-password"]; ok {
+		d.Password = driverOpts.String("nutanix-password")
+	}
+
+	return nil
+}
+
+func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
+	d.Endpoint = flags.String("nutanix-endpoint")
+	d.Port = flags.Int("nutanix-port")
+	d.Username = flags.String("nutanix-username")
+	d.Password = flags.String("nutanix-password")
+	d.Insecure = flags.Bool("nutanix-insecure")
+	d.Cluster = flags.String("nutanix-cluster")
+	d.Project = flags.String("nutanix-project")
+	d.Image = flags.String("nutanix-vm-image")
+	d.Subnets = flags.StringSlice("nutanix-vm-network")
+	d.Categories = flags.StringSlice("nutanix-vm-categories")
+	d.Sockets = flags.Int("nutanix-vm-cpus")
+	d.VCPUsPerSocket = flags.Int("nutanix-vm-cores")
+	d.Memory = flags.Int("nutanix-vm-mem")
+	d.DiskSize = flags.Int("nutanix-disk-size")
+	d.UserDataFile = flags.String("nutanix-cloud-init")
+	d.SSHUser = flags.String("nutanix-vm-ssh-user")
+
+	d.SetSwarmConfigFromFlags(flags)
+	if err := d.SetUserDataFromFlags(flags); err != nil {
+		return err
+	}
+
+	for flag, value := range map[string]string{
+		"nutanix-endpoint": d.Endpoint,
+		"nutanix-username": d.Username,
+		"nutanix-password": d.Password,
+		"nutanix-cluster":  d.Cluster,
+		"nutanix-vm-image": d.Image,
+	} {
+		if value == "" {
+			return fmt.Errorf("nutanix driver requires the --%s option", flag)
+		}
+	}
+	if len(d.Subnets) == 0 {
+		return fmt.Errorf("nutanix driver requires the --nutanix-vm-network option")
+	}
+	if _, err := d.getCategories(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (d *Driver) PreCreateCheck() error {
+	_, err := d.resolve(d.getClient())
+	if err != nil {
+		return err
+	}
+	if _, err := driverutil.CloudConfigWithKey(d.BaseDriver, d.UserDataFile, ""); err != nil {
+		return err
+	}
+	return nil
+}
+
+// resolve returns the request creating the VM, but its user data, with
+// the cluster, project, image, subnets and categories looked up.
+func (d *Driver) resolve(client *Client) (*VMCreateRequest, error) {
+	clusterUUID, err := client.FindCluster(d.Cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	var projectUUID string
+	if d.Project != "" {
+		projectUUID, err = client.FindProject(d.Project)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	imageUUID, err := client.FindImage(d.Image)
+	if err != nil {
+		return nil, err
+	}
+
+	var subnetUUIDs []string
+	for _, subnet := range d.Subnets {
+		subnetUUID, err := client.FindSubnet(subnet, clusterUUID)
+		if err != nil {
+			return nil, err
+		}
+		subnetUUIDs = append(subnetUUIDs, subnetUUID)
+	}
+
+	categories, _ := d.getCategories()
+	for key, value := range categories {
+		if err := client.GetCategoryValue(key, value); err != nil {
+			if isNotFound(err) {
+				return nil, fmt.Errorf("nutanix category %s=%s doesn't exist", key, value)
+			}
+			return nil, err
+		}
+	}
+
+	return d.createRequest(clusterUUID, projectUUID, imageUUID, subnetUUIDs, categories), nil
+}
+
+// createRequest returns the request creating the VM, but its user data, on
+// the cluster, in the project, if any, and from the image and subnets,
+// given by UUID.
+func (d *Driver) createRequest(clusterUUID, projectUUID, imageUUID string, subnetUUIDs []string, categories map[string]string) *VMCreateRequest {
+	request := &VMCreateRequest{}
+	request.Metadata.Kind = "vm"
+	request.Metadata.Categories = categories
+	if projectUUID != "" {
+		request.Metadata.ProjectReference = &Reference{Kind: "project", UUID: projectUUID}
+	}
+	request.Spec.Name = d.MachineName
+	request.Spec.ClusterReference = Reference{Kind: "cluster", UUID: clusterUUID}
+
+	disk := Disk{DataSourceReference: &Reference{Kind: "image", UUID: imageUUID}}
+	disk.DeviceProperties.DeviceType = "DISK"
+	disk.DeviceProperties.DiskAddress.AdapterType = "SCSI"
+	disk.DiskSizeMib = int64(d.DiskSize) * 1024
+
+	resources := &request.Spec.Resources
+	resources.NumSockets = d.Sockets
+	resources.NumVCPUsPerSocket = d.VCPUsPerSocket
+	resources.MemorySizeMib = d.Memory
+	resources.PowerState = "ON"
+	resources.DiskList = []Disk{disk}
+	for _, subnetUUID := range subnetUUIDs {
+		resources.NICList = append(resources.NICList, NIC{SubnetReference: Reference{Kind: "subnet", UUID: subnetUUID}})
+	}
+
+	return request
+}
+
+func (d *Driver) Create() error {
+	client := d.getClient()
+
+	request, err := d.resolve(client)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Creating SSH key...")
+
+	d.SSHKeyPath = d.GetSSHKeyPath()
+	if err := ssh.GenerateSSHKey(d.SSHKeyPath); err != nil {
+		return err
+	}
+	publicKey, err := os.ReadFile(d.SSHKeyPath + ".pub")
+	if err != nil {
+		return err
+	}
+
+	userData, err := driverutil.CloudConfigWithKey(d.BaseDriver, d.UserDataFile, strings.TrimSpace(string(publicKey)))
+	if err != nil {
+		return err
+	}
+	request.Spec.Resources.GuestCustomization.CloudInit.UserData = base64.StdEncoding.EncodeToString(userData)
+
+	log.Infof("Creating Nutanix VM...")
+
+	vmUUID, taskUUID, err := client.CreateVM(request)
+	if err != nil {
+		return err
+	}
+	d.VMUUID = vmUUID
+
+	if err := client.WaitTask(taskUUID); err != nil {
+		return d.removeAfter(err)
+	}
+
+	// The addresses are only known once the guest tools or DHCP report
+	// them.
+	log.Info("Waiting for the VM to get an IP address...")
+	for {
+		vm, err := client.GetVM(d.VMUUID)
+		if err != nil {
+			return d.removeAfter(err)
+		}
+		if ips := vm.IPs(); len(ips) > 0 {
+			d.IPAddress = ips[0]
+			break
+		}
+
+		time.Sleep(5 * time.Second)
+	}
+
+	log.Debugf("Created Nutanix VM %s, IP address %s", d.VMUUID, d.IPAddress)
+
+	return nil
+}
+
+func (d *Driver) removeAfter(err error) error {
+	if removeErr := d.Remove(); removeErr != nil {
+		return fmt.Errorf("failed to create machine due to error: %v. Removing VM: %v", err, removeErr)
+	}
+	return err
+}
+
+func (d *Driver) GetURL() (string, error) {
+	if err := drivers.MustBeRunning(d); err != nil {
+		return "", err
+	}
+
+	ip, err := d.GetIP()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("tcp://%s", net.JoinHostPort(ip, "2376")), nil
+}
+
+// GetIPs returns the addresses of the NICs of the VM, all private.
+func (d *Driver) GetIPs() ([]drivers.NetworkAddress, error) {
+	vm, err := d.getClient().GetVM(d.VMUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	return vmAddresses(vm), nil
+}
+
+// vmAddresses returns the addresses of the NICs of the VM, all private.
+func vmAddresses(vm *VMStatus) []drivers.NetworkAddress {
+	var addrs []drivers.NetworkAddress
+	for _, ip := range vm.IPs() {
+		addrs = drivers.AppendAddress(addrs, drivers.AddressPrivate, ip)
+	}
+	return addrs
+}
+
+func (d *Driver) GetState() (state.State, error) {
+	vm, err := d.getClient().GetVM(d.VMUUID)
+	if err != nil {
+		if !isNotFound(err) {
+			return state.Error, err
+		}
+		return state.None, fmt.Errorf("machine %v not found", d.MachineName)
+	}
+
+	return vmState(vm), nil
+}
+
+// vmState returns the state of the VM, from its power state.
+func vmState(vm *VMStatus) state.State {
+	if vm.State == "ERROR" {
+		return state.Error
+	}
+	switch vm.Resources.PowerState {
+	case "ON":
+		return state.Running
+	case "OFF":
+		return state.Stopped
+	case "PAUSED", "SUSPENDED":
+		return state.Paused
+	}
+	return state.None
+}
+
+func (d *Driver) Start() error {
+	return d.getClient().SetPowerState(d.VMUUID, "ON", "")
+}
+
+// Stop shuts the VM down through ACPI.
+func (d *Driver) Stop() error {
+	return d.getClient().SetPowerState(d.VMUUID, "OFF", "ACPI")
+}
+
+// Restart shuts the VM down and powers it on again, as the v3 API has no
+// reboot.
+func (d *Driver) Restart() error {
+	if err := d.Stop(); err != nil {
+		return err
+	}
+	return d.Start()
+}
+
+func (d *Driver) Kill() error {
+	return d.getClient().SetPowerState(d.VMUUID, "OFF", "HARD")
+}
+
+func (d *Driver) Remove() error {
+	if d.VMUUID == "" {
+		return nil
+	}
+
+	if err := d.getClient().DeleteVM(d.VMUUID); err != nil {
+		if !isNotFound(err) {
+			return err
+		}
+		log.Infof("Nutanix VM doesn't exist, assuming it is already deleted")
+	}
+	return nil
+}
+
+func (d *Driver) getClient() *Client {
+	endpoint := "https://" + net.JoinHostPort(d.Endpoint, strconv.Itoa(d.Port))
+	if strings.Contains(d.Endpoint, "://") {
+		endpoint = d.Endpoint
+	}
+	return NewClient(endpoint, d.Username, d.Password, d.Insecure)
+}
+
+// getCategories returns the categories given as key=value.
+func (d *Driver) getCategories() (map[string]string, error) {
+	if len(d.Categories) == 0 {
+		return nil, nil
+	}
+	categories := map[string]string{}
+	for _, category := range d.Categories {
+		key, value, ok := strings.Cut(category, "=")
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("nutanix category must be key=value, got %q", category)
+		}
+		categories[key] = value
+	}
+	return categories, nil
+}
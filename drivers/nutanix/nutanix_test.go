@@ -0,0 +1,142 @@
+package nutanix
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnmarshalJSON(t *testing.T) {
+	driver := NewDriver("", "")
+
+	// Unmarhsal driver configuration from JSON and args.
+	os.Args = append(os.Args, []string{"--nutanix-password", "test password"}...)
+
+	driverBytes, err := json.Marshal(driver)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(driverBytes, driver))
+
+	// Make sure that config has been pulled in from envvars and args.
+	assert.Equal(t, "test password", driver.Password)
+}
+
+func TestSetConfigFromFlags(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"nutanix-endpoint":   "pc.example.com",
+			"nutanix-username":   "admin",
+			"nutanix-password":   "PASSWORD",
+			"nutanix-cluster":    "cluster-1",
+			"nutanix-vm-image":   "ubuntu-22.04",
+			"nutanix-vm-network": []string{"vlan10"},
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	err := driver.SetConfigFromFlags(checkFlags)
+
+	assert.NoError(t, err)
+	assert.Empty(t, checkFlags.InvalidFlags)
+	assert.Equal(t, 9440, driver.Port)
+	assert.Equal(t, 2, driver.Sockets)
+	assert.Equal(t, 4096, driver.Memory)
+	assert.Equal(t, "ubuntu", driver.GetSSHUsername())
+	assert.Equal(t, "https://pc.example.com:9440/api/nutanix/v3", driver.getClient().endpoint)
+}
+
+func TestSetConfigFromFlagsInvalidCategory(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"nutanix-endpoint":      "pc.example.com",
+			"nutanix-username":      "admin",
+			"nutanix-password":      "PASSWORD",
+			"nutanix-cluster":       "cluster-1",
+			"nutanix-vm-image":      "ubuntu-22.04",
+			"nutanix-vm-network":    []string{"vlan10"},
+			"nutanix-vm-categories": []string{"Environment"},
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	assert.EqualError(t, driver.SetConfigFromFlags(checkFlags), `nutanix category must be key=value, got "Environment"`)
+}
+
+func TestCreateRequest(t *testing.T) {
+	driver := NewDriver("default", "path")
+	driver.DiskSize = 40
+
+	request := driver.createRequest("cluster-uuid", "project-uuid", "image-uuid", []string{"subnet-uuid"}, map[string]string{"Environment": "Dev"})
+	assert.Equal(t, "vm", request.Metadata.Kind)
+	assert.Equal(t, "default", request.Spec.Name)
+	assert.Equal(t, Reference{Kind: "cluster", UUID: "cluster-uuid"}, request.Spec.ClusterReference)
+	assert.Equal(t, &Reference{Kind: "project", UUID: "project-uuid"}, request.Metadata.ProjectReference)
+	assert.Equal(t, map[string]string{"Environment": "Dev"}, request.Metadata.Categories)
+	assert.Equal(t, 2, request.Spec.Resources.NumSockets)
+	assert.Equal(t, 4096, request.Spec.Resources.MemorySizeMib)
+	assert.Equal(t, "ON", request.Spec.Resources.PowerState)
+	assert.Equal(t, []NIC{{SubnetReference: Reference{Kind: "subnet", UUID: "subnet-uuid"}}}, request.Spec.Resources.NICList)
+	assert.Len(t, request.Spec.Resources.DiskList, 1)
+	assert.Equal(t, &Reference{Kind: "image", UUID: "image-uuid"}, request.Spec.Resources.DiskList[0].DataSourceReference)
+	assert.Equal(t, int64(40960), request.Spec.Resources.DiskList[0].DiskSizeMib)
+
+	// Without a project, the reference is left out.
+	data, err := json.Marshal(driver.createRequest("cluster-uuid", "", "image-uuid", nil, nil))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "project_reference")
+	assert.NotContains(t, string(data), "categories")
+}
+
+func TestVMState(t *testing.T) {
+	for powerState, expected := range map[string]state.State{
+		"ON":        state.Running,
+		"OFF":       state.Stopped,
+		"PAUSED":    state.Paused,
+		"SUSPENDED": state.Paused,
+		"UNKNOWN":   state.None,
+	} {
+		vm := &VMStatus{}
+		vm.Resources.PowerState = powerState
+		assert.Equal(t, expected, vmState(vm), powerState)
+	}
+
+	vm := &VMStatus{State: "ERROR"}
+	vm.Resources.PowerState = "ON"
+	assert.Equal(t, state.Error, vmState(vm))
+}
+
+func TestVMAddresses(t *testing.T) {
+	var vm VMStatus
+	assert.NoError(t, json.Unmarshal([]byte(`{"state": "COMPLETE", "resources": {"power_state": "ON", "nic_list": [{"ip_endpoint_list": [{"ip": "10.0.0.5"}]}, {"ip_endpoint_list": [{"ip": ""}]}]}}`), &vm))
+	assert.Equal(t, []drivers.NetworkAddress{{Kind: drivers.AddressPrivate, Address: "10.0.0.5"}}, vmAddresses(&vm))
+
+	// The IP is only known once the VM booted.
+	assert.Empty(t, vmAddresses(&VMStatus{}))
+}
+
+func TestGetCategories(t *testing.T) {
+	driver := NewDriver("default", "path")
+	categories, err := driver.getCategories()
+	assert.NoError(t, err)
+	assert.Nil(t, categories)
+
+	driver.Categories = []string{"Environment=Dev", "Team=rancher"}
+	categories, err = driver.getCategories()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"Environment": "Dev", "Team": "rancher"}, categories)
+}
+
+func TestIsNotFound(t *testing.T) {
+	assert.True(t, isNotFound(&APIError{StatusCode: http.StatusNotFound}))
+	assert.False(t, isNotFound(&APIError{StatusCode: http.StatusUnauthorized}))
+	assert.False(t, isNotFound(errors.New("nutanix: timeout")))
+}
@@ -0,0 +1,297 @@
+package oci
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metadataEndpoint is the instance metadata service, replaced by the tests.
+var metadataEndpoint = "http://169.254.169.254/opc/v2"
+
+// credentials sign the requests to the API with the key of their ID.
+type credentials interface {
+	key() (keyID string, key *rsa.PrivateKey, err error)
+}
+
+// apiKeyCredentials are the API signing key of a user.
+type apiKeyCredentials struct {
+	tenancyID, userID, fingerprint string
+	privateKey                     *rsa.PrivateKey
+}
+
+func newAPIKeyCredentials(tenancyID, userID, fingerprint, privateKeyPath string) (*apiKeyCredentials, error) {
+	data, err := os.ReadFile(privateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("oci private key %s: %s", privateKeyPath, err)
+	}
+	return &apiKeyCredentials{
+		tenancyID:   tenancyID,
+		userID:      userID,
+		fingerprint: fingerprint,
+		privateKey:  privateKey,
+	}, nil
+}
+
+func (c *apiKeyCredentials) key() (string, *rsa.PrivateKey, error) {
+	return c.tenancyID + "/" + c.userID + "/" + c.fingerprint, c.privateKey, nil
+}
+
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM encoded key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// instancePrincipalCredentials are the credentials of the instance the
+// driver runs on: its certificate, rotated by the metadata service, is
+// exchanged for a security token signing with a session key.
+type instancePrincipalCredentials struct {
+	region     string
+	httpClient *http.Client
+
+	lock       sync.Mutex
+	token      string
+	expires    time.Time
+	sessionKey *rsa.PrivateKey
+}
+
+func newInstancePrincipalCredentials(region string, httpClient *http.Client) *instancePrincipalCredentials {
+	return &instancePrincipalCredentials{region: region, httpClient: httpClient}
+}
+
+// instanceRegion returns the region of the instance the driver runs on.
+func instanceRegion(httpClient *http.Client) (string, error) {
+	region, err := getMetadata(httpClient, "/instance/canonicalRegionName")
+	return strings.TrimSpace(string(region)), err
+}
+
+func getMetadata(httpClient *http.Client, path string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, metadataEndpoint+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer Oracle")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oci instance metadata: %s", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oci instance metadata %s: %s", path, resp.Status)
+	}
+	return data, nil
+}
+
+func (c *instancePrincipalCredentials) key() (string, *rsa.PrivateKey, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.token == "" || time.Now().Add(time.Minute).After(c.expires) {
+		if err := c.refresh(); err != nil {
+			return "", nil, fmt.Errorf("oci instance principal: %s", err)
+		}
+	}
+	return "ST$" + c.token, c.sessionKey, nil
+}
+
+func (c *instancePrincipalCredentials) refresh() error {
+	var pems [3][]byte
+	for i, path := range []string{"/identity/cert.pem", "/identity/key.pem", "/identity/intermediate.pem"} {
+		data, err := getMetadata(c.httpClient, path)
+		if err != nil {
+			return err
+		}
+		pems[i] = data
+	}
+
+	certBlock, _ := pem.Decode(pems[0])
+	if certBlock == nil {
+		return errors.New("no PEM encoded certificate")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return err
+	}
+	certKey, err := parsePrivateKey(pems[1])
+	if err != nil {
+		return err
+	}
+	intermediateBlock, _ := pem.Decode(pems[2])
+	if intermediateBlock == nil {
+		return errors.New("no PEM encoded intermediate certificate")
+	}
+
+	var tenancyID string
+	for _, ou := range cert.Subject.OrganizationalUnit {
+		if strings.HasPrefix(ou, "opc-tenant:") {
+			tenancyID = strings.TrimPrefix(ou, "opc-tenant:")
+		}
+	}
+	if tenancyID == "" {
+		return errors.New("no tenancy in the instance certificate")
+	}
+
+	sessionKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	sessionPublicKey, err := x509.MarshalPKIXPublicKey(&sessionKey.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"certificate":              base64.StdEncoding.EncodeToString(certBlock.Bytes),
+		"publicKey":                base64.StdEncoding.EncodeToString(sessionPublicKey),
+		"intermediateCertificates": []string{base64.StdEncoding.EncodeToString(intermediateBlock.Bytes)},
+		"purpose":                  "DEFAULT",
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, serviceEndpoint("auth", c.region)+"/v1/x509", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	keyID := tenancyID + "/fed-x509/" + certFingerprint(cert)
+	if err := signRequest(req, body, keyID, certKey); err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("federation: %s", resp.Status)
+	}
+
+	var reply struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return err
+	}
+	expires, err := tokenExpiry(reply.Token)
+	if err != nil {
+		return err
+	}
+
+	c.token, c.expires, c.sessionKey = reply.Token, expires, sessionKey
+	return nil
+}
+
+// certFingerprint returns the SHA-1 fingerprint of the certificate, e.g.
+// "AB:CD:...".
+func certFingerprint(cert *x509.Certificate) string {
+	sum := sha1.Sum(cert.Raw)
+	hex := make([]string, len(sum))
+	for i, b := range sum {
+		hex[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(hex, ":")
+}
+
+// tokenExpiry returns when the security token, a JWT, expires.
+func tokenExpiry(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, errors.New("malformed security token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, err
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(claims.Exp, 0), nil
+}
+
+// signRequest signs the request, with the body, as described by the HTTP
+// signatures the API authenticates.
+func signRequest(req *http.Request, body []byte, keyID string, key *rsa.PrivateKey) error {
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	headers := []string{"date", "(request-target)", "host"}
+	if req.Method == http.MethodPost || req.Method == http.MethodPut {
+		sum := sha256.Sum256(body)
+		req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		req.Header.Set("X-Content-Sha256", base64.StdEncoding.EncodeToString(sum[:]))
+		headers = append(headers, "content-length", "content-type", "x-content-sha256")
+	}
+
+	digest := sha256.Sum256([]byte(signingString(req, headers)))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf(`Signature version="1",headers=%q,keyId=%q,algorithm="rsa-sha256",signature=%q`,
+		strings.Join(headers, " "), keyID, base64.StdEncoding.EncodeToString(signature)))
+	return nil
+}
+
+func signingString(req *http.Request, headers []string) string {
+	lines := make([]string, len(headers))
+	for i, header := range headers {
+		var value string
+		switch header {
+		case "(request-target)":
+			value = strings.ToLower(req.Method) + " " + req.URL.RequestURI()
+		case "host":
+			value = req.URL.Host
+		default:
+			value = req.Header.Get(header)
+		}
+		lines[i] = header + ": " + value
+	}
+	return strings.Join(lines, "\n")
+}
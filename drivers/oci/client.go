@@ -0,0 +1,298 @@
+package oci
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rancher/machine/libmachine/version"
+)
+
+// apiEndpoint is the template of the OCI API endpoints, replaced by the
+// tests.
+var apiEndpoint = "https://{service}.{region}.oraclecloud.com"
+
+func serviceEndpoint(service, region string) string {
+	return strings.NewReplacer("{service}", service, "{region}", region).Replace(apiEndpoint)
+}
+
+// Client makes the calls to the OCI Core and Identity APIs the driver
+// needs, in a region.
+type Client struct {
+	region      string
+	credentials credentials
+	httpClient  *http.Client
+}
+
+func NewClient(region string, credentials credentials, httpClient *http.Client) *Client {
+	return &Client{
+		region:      region,
+		credentials: credentials,
+		httpClient:  httpClient,
+	}
+}
+
+func newHTTPClient() *http.Client {
+	return &http.Client{Timeout: 60 * time.Second}
+}
+
+// APIError is an error answered by the OCI API.
+type APIError struct {
+	StatusCode int
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("oci: %s (%s)", e.Message, e.Code)
+}
+
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+type Instance struct {
+	ID             string `json:"id"`
+	DisplayName    string `json:"displayName"`
+	LifecycleState string `json:"lifecycleState"`
+}
+
+type ShapeConfig struct {
+	OCPUs       float32 `json:"ocpus"`
+	MemoryInGBs float32 `json:"memoryInGBs"`
+}
+
+type SourceDetails struct {
+	SourceType          string `json:"sourceType"`
+	ImageID             string `json:"imageId"`
+	BootVolumeSizeInGBs int64  `json:"bootVolumeSizeInGBs,omitempty"`
+}
+
+type CreateVnicDetails struct {
+	SubnetID       string `json:"subnetId"`
+	AssignPublicIP bool   `json:"assignPublicIp"`
+}
+
+type InstanceLaunchRequest struct {
+	AvailabilityDomain string            `json:"availabilityDomain"`
+	CompartmentID      string            `json:"compartmentId"`
+	DisplayName        string            `json:"displayName"`
+	Shape              string            `json:"shape"`
+	ShapeConfig        *ShapeConfig      `json:"shapeConfig,omitempty"`
+	SourceDetails      SourceDetails     `json:"sourceDetails"`
+	CreateVnicDetails  CreateVnicDetails `json:"createVnicDetails"`
+	Metadata           map[string]string `json:"metadata"`
+	FreeformTags       map[string]string `json:"freeformTags,omitempty"`
+}
+
+type Shape struct {
+	Shape         string       `json:"shape"`
+	IsFlexible    bool         `json:"isFlexible"`
+	OCPUOptions   *OCPURange   `json:"ocpuOptions"`
+	MemoryOptions *MemoryRange `json:"memoryOptions"`
+}
+
+type OCPURange struct {
+	Min float32 `json:"min"`
+	Max float32 `json:"max"`
+}
+
+type MemoryRange struct {
+	MinInGBs float32 `json:"minInGBs"`
+	MaxInGBs float32 `json:"maxInGBs"`
+}
+
+type Vnic struct {
+	ID            string   `json:"id"`
+	PublicIP      string   `json:"publicIp"`
+	PrivateIP     string   `json:"privateIp"`
+	IPv6Addresses []string `json:"ipv6Addresses"`
+}
+
+func (c *Client) do(method, service, path string, query url.Values, body, reply interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	rawURL := serviceEndpoint(service, c.region) + path
+	if len(query) > 0 {
+		rawURL += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, rawURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("docker-machine/v%d", version.APIVersion))
+
+	keyID, key, err := c.credentials.key()
+	if err != nil {
+		return err
+	}
+	if err := signRequest(req, data, keyID, key); err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 400 {
+		apiErr := &APIError{}
+		if err := json.Unmarshal(respData, apiErr); err != nil || apiErr.Message == "" {
+			apiErr.Code = "Unknown"
+			apiErr.Message = resp.Status
+		}
+		apiErr.StatusCode = resp.StatusCode
+		return apiErr
+	}
+
+	if reply == nil || len(respData) == 0 {
+		return nil
+	}
+	return json.Unmarshal(respData, reply)
+}
+
+// AvailabilityDomains returns the names of the availability domains of
+// the region.
+func (c *Client) AvailabilityDomains(compartmentID string) ([]string, error) {
+	var reply []struct {
+		Name string `json:"name"`
+	}
+	query := url.Values{"compartmentId": {compartmentID}}
+	if err := c.do(http.MethodGet, "identity", "/20160918/availabilityDomains", query, nil, &reply); err != nil {
+		return nil, err
+	}
+	names := make([]string, len(reply))
+	for i, ad := range reply {
+		names[i] = ad.Name
+	}
+	return names, nil
+}
+
+// Shapes returns the shapes which can be launched in the availability
+// domain.
+func (c *Client) Shapes(compartmentID, availabilityDomain string) ([]Shape, error) {
+	var reply []Shape
+	query := url.Values{"compartmentId": {compartmentID}, "availabilityDomain": {availabilityDomain}}
+	if err := c.do(http.MethodGet, "iaas", "/20160918/shapes", query, nil, &reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// FindImage returns the ID of the latest image of the operating system
+// version for the shape.
+func (c *Client) FindImage(compartmentID, os, osVersion, shape string) (string, error) {
+	var reply []struct {
+		ID string `json:"id"`
+	}
+	query := url.Values{
+		"compartmentId":          {compartmentID},
+		"operatingSystem":        {os},
+		"operatingSystemVersion": {osVersion},
+		"shape":                  {shape},
+		"sortBy":                 {"TIMECREATED"},
+		"sortOrder":              {"DESC"},
+		"lifecycleState":         {"AVAILABLE"},
+	}
+	if err := c.do(http.MethodGet, "iaas", "/20160918/images", query, nil, &reply); err != nil {
+		return "", err
+	}
+	if len(reply) == 0 {
+		return "", fmt.Errorf("oci: no %s %s image for shape %s", os, osVersion, shape)
+	}
+	return reply[0].ID, nil
+}
+
+func (c *Client) GetImage(id string) error {
+	return c.do(http.MethodGet, "iaas", "/20160918/images/"+id, nil, nil, nil)
+}
+
+func (c *Client) GetSubnet(id string) error {
+	return c.do(http.MethodGet, "iaas", "/20160918/subnets/"+id, nil, nil, nil)
+}
+
+// FindSubnet returns the ID of the subnet of the VCN with the name.
+func (c *Client) FindSubnet(compartmentID, vcnID, name string) (string, error) {
+	var reply []struct {
+		ID string `json:"id"`
+	}
+	query := url.Values{"compartmentId": {compartmentID}, "vcnId": {vcnID}, "displayName": {name}}
+	if err := c.do(http.MethodGet, "iaas", "/20160918/subnets", query, nil, &reply); err != nil {
+		return "", err
+	}
+	if len(reply) == 0 {
+		return "", fmt.Errorf("oci: no subnet %s in VCN %s", name, vcnID)
+	}
+	return reply[0].ID, nil
+}
+
+func (c *Client) LaunchInstance(request *InstanceLaunchRequest) (*Instance, error) {
+	var reply Instance
+	if err := c.do(http.MethodPost, "iaas", "/20160918/instances", nil, request, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+func (c *Client) GetInstance(id string) (*Instance, error) {
+	var reply Instance
+	if err := c.do(http.MethodGet, "iaas", "/20160918/instances/"+id, nil, nil, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+// TerminateInstance terminates the instance and deletes its boot volume.
+func (c *Client) TerminateInstance(id string) error {
+	query := url.Values{"preserveBootVolume": {"false"}}
+	return c.do(http.MethodDelete, "iaas", "/20160918/instances/"+id, query, nil, nil)
+}
+
+// InstanceAction runs an action, e.g. "SOFTSTOP", on the instance.
+func (c *Client) InstanceAction(id, action string) error {
+	query := url.Values{"action": {action}}
+	return c.do(http.MethodPost, "iaas", "/20160918/instances/"+id, query, nil, nil)
+}
+
+// PrimaryVnic returns the VNIC attached first to the instance, if any is
+// attached yet.
+func (c *Client) PrimaryVnic(compartmentID, instanceID string) (*Vnic, error) {
+	var attachments []struct {
+		VnicID         string `json:"vnicId"`
+		LifecycleState string `json:"lifecycleState"`
+	}
+	query := url.Values{"compartmentId": {compartmentID}, "instanceId": {instanceID}}
+	if err := c.do(http.MethodGet, "iaas", "/20160918/vnicAttachments", query, nil, &attachments); err != nil {
+		return nil, err
+	}
+	for _, attachment := range attachments {
+		if attachment.LifecycleState != "ATTACHED" {
+			continue
+		}
+		var vnic Vnic
+		if err := c.do(http.MethodGet, "iaas", "/20160918/vnics/"+attachment.VnicID, nil, nil, &vnic); err != nil {
+			return nil, err
+		}
+		return &vnic, nil
+	}
+	return nil, nil
+}
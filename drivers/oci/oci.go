@@ -0,0 +1,631 @@
+package oci
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/rancher/machine/libmachine/ssh"
+	"github.com/rancher/machine/libmachine/state"
+)
+
+type Driver struct {
+	*drivers.BaseDriver
+	Region             string
+	TenancyID          string
+	UserID             string
+	Fingerprint        string
+	PrivateKeyPath     string
+	InstancePrincipals bool
+	CompartmentID      string
+	AvailabilityDomain string
+	InstanceID         string
+	Shape              string
+	OCPUs              int
+	MemoryGBs          int
+	ImageID            string
+	ImageOS            string
+	ImageOSVersion     string
+	SubnetID           string
+	VCNID              string
+	SubnetName         string
+	PrivateIPOnly      bool
+	BootVolumeSize     int
+	UserDataFile       string
+	Tags               string
+	PrivateIPAddress   string
+
+	// credentials are kept between the calls for instance principals to
+	// exchange their certificate once.
+	credentials credentials
+}
+
+const (
+	defaultSSHPort        = 22
+	defaultSSHUser        = "ubuntu"
+	defaultShape          = "VM.Standard.E4.Flex"
+	defaultOCPUs          = 1
+	defaultMemoryGBs      = 16
+	defaultImageOS        = "Canonical Ubuntu"
+	defaultImageOSVersion = "22.04"
+
+	// minBootVolumeSize is the smallest boot volume, in GB, instances can
+	// be launched with.
+	minBootVolumeSize = 50
+)
+
+// Capabilities returns the optional operations supported by the driver.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityStartStop,
+		drivers.CapabilityRestart,
+		drivers.CapabilityKill,
+		drivers.CapabilityPrivateIP,
+		drivers.CapabilityCustomSSHPort,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+	}
+}
+
+// GetCreateFlags registers the flags this driver adds to
+// "docker hosts create"
+func (d *Driver) GetCreateFlags() []mcnflag.Flag {
+	return []mcnflag.Flag{
+		mcnflag.StringFlag{
+			EnvVar: "OCI_CLI_REGION",
+			Name:   "oci-region",
+			Usage:  "OCI region, e.g. us-ashburn-1 (default the one of the instance with instance principals)",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OCI_CLI_TENANCY",
+			Name:   "oci-tenancy-id",
+			Usage:  "OCID of the tenancy of the API signing key",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OCI_CLI_USER",
+			Name:   "oci-user-id",
+			Usage:  "OCID of the user of the API signing key",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OCI_CLI_FINGERPRINT",
+			Name:   "oci-fingerprint",
+			Usage:  "fingerprint of the API signing key",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OCI_CLI_KEY_FILE",
+			Name:   "oci-private-key-path",
+			Usage:  "path to the private API signing key",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "OCI_USE_INSTANCE_PRINCIPALS",
+			Name:   "oci-use-instance-principals",
+			Usage:  "authenticate as the instance the driver runs on instead of with an API signing key",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OCI_COMPARTMENT_ID",
+			Name:   "oci-compartment-id",
+			Usage:  "OCID of the compartment to launch the instance in",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OCI_AVAILABILITY_DOMAIN",
+			Name:   "oci-availability-domain",
+			Usage:  "availability domain of the instance (default the first of the region)",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OCI_SSH_USER",
+			Name:   "oci-ssh-user",
+			Usage:  "SSH username",
+			Value:  defaultSSHUser,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "OCI_SSH_PORT",
+			Name:   "oci-ssh-port",
+			Usage:  "SSH port",
+			Value:  defaultSSHPort,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OCI_SHAPE",
+			Name:   "oci-shape",
+			Usage:  "OCI shape",
+			Value:  defaultShape,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "OCI_OCPUS",
+			Name:   "oci-ocpus",
+			Usage:  "number of OCPUs of flexible shapes",
+			Value:  defaultOCPUs,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "OCI_MEMORY_GBS",
+			Name:   "oci-memory-gbs",
+			Usage:  "memory in GB of flexible shapes",
+			Value:  defaultMemoryGBs,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OCI_IMAGE_ID",
+			Name:   "oci-image-id",
+			Usage:  "OCID of the image (default the latest of --oci-image-os and --oci-image-os-version)",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OCI_IMAGE_OS",
+			Name:   "oci-image-os",
+			Usage:  "operating system of the image",
+			Value:  defaultImageOS,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OCI_IMAGE_OS_VERSION",
+			Name:   "oci-image-os-version",
+			Usage:  "operating system version of the image",
+			Value:  defaultImageOSVersion,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OCI_SUBNET_ID",
+			Name:   "oci-subnet-id",
+			Usage:  "OCID of the subnet of the instance",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OCI_VCN_ID",
+			Name:   "oci-vcn-id",
+			Usage:  "OCID of the VCN to find --oci-subnet-name in",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OCI_SUBNET_NAME",
+			Name:   "oci-subnet-name",
+			Usage:  "name of the subnet of the instance in --oci-vcn-id",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "OCI_PRIVATE_IP_ONLY",
+			Name:   "oci-private-ip-only",
+			Usage:  "only give the instance a private IP address, used to reach it",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "OCI_BOOT_VOLUME_SIZE",
+			Name:   "oci-boot-volume-size",
+			Usage:  "size in GB of the boot volume (default the one of the image)",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OCI_USERDATA",
+			Name:   "oci-userdata",
+			Usage:  "path to file with cloud-init user-data",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OCI_TAGS",
+			Name:   "oci-tags",
+			Usage:  "comma-separated list of key=value freeform tags to apply to the instance",
+		},
+	}
+}
+
+func NewDriver(hostName, storePath string) *Driver {
+	return &Driver{
+		Shape:          defaultShape,
+		OCPUs:          defaultOCPUs,
+		MemoryGBs:      defaultMemoryGBs,
+		ImageOS:        defaultImageOS,
+		ImageOSVersion: defaultImageOSVersion,
+		BaseDriver: &drivers.BaseDriver{
+			MachineName: hostName,
+			StorePath:   storePath,
+		},
+	}
+}
+
+func (d *Driver) GetSSHHostname() (string, error) {
+	return d.GetIP()
+}
+
+// DriverName returns the name of the driver
+func (d *Driver) DriverName() string {
+	return "oci"
+}
+
+func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
+	d.Region = flags.String("oci-region")
+	d.TenancyID = flags.String("oci-tenancy-id")
+	d.UserID = flags.String("oci-user-id")
+	d.Fingerprint = flags.String("oci-fingerprint")
+	d.PrivateKeyPath = flags.String("oci-private-key-path")
+	d.InstancePrincipals = flags.Bool("oci-use-instance-principals")
+	d.CompartmentID = flags.String("oci-compartment-id")
+	d.AvailabilityDomain = flags.String("oci-availability-domain")
+	d.Shape = flags.String("oci-shape")
+	d.OCPUs = flags.Int("oci-ocpus")
+	d.MemoryGBs = flags.Int("oci-memory-gbs")
+	d.ImageID = flags.String("oci-image-id")
+	d.ImageOS = flags.String("oci-image-os")
+	d.ImageOSVersion = flags.String("oci-image-os-version")
+	d.SubnetID = flags.String("oci-subnet-id")
+	d.VCNID = flags.String("oci-vcn-id")
+	d.SubnetName = flags.String("oci-subnet-name")
+	d.PrivateIPOnly = flags.Bool("oci-private-ip-only")
+	d.BootVolumeSize = flags.Int("oci-boot-volume-size")
+	d.UserDataFile = flags.String("oci-userdata")
+	d.Tags = flags.String("oci-tags")
+	d.SSHUser = flags.String("oci-ssh-user")
+	d.SSHPort = flags.Int("oci-ssh-port")
+
+	d.SetSwarmConfigFromFlags(flags)
+
+	if !d.InstancePrincipals {
+		if d.Region == "" || d.TenancyID == "" || d.UserID == "" || d.Fingerprint == "" || d.PrivateKeyPath == "" {
+			return fmt.Errorf("oci driver requires the --oci-region, --oci-tenancy-id, --oci-user-id, --oci-fingerprint and --oci-private-key-path options, or --oci-use-instance-principals")
+		}
+	}
+	if d.CompartmentID == "" {
+		return fmt.Errorf("oci driver requires the --oci-compartment-id option")
+	}
+	if d.SubnetID == "" && (d.VCNID == "" || d.SubnetName == "") {
+		return fmt.Errorf("oci driver requires the --oci-subnet-id option, or the --oci-vcn-id and --oci-subnet-name ones")
+	}
+	if d.BootVolumeSize != 0 && d.BootVolumeSize < minBootVolumeSize {
+		return fmt.Errorf("oci boot volume size must be at least %d GB, got %d", minBootVolumeSize, d.BootVolumeSize)
+	}
+
+	return nil
+}
+
+// isFlexible returns whether the OCPUs and memory of the shape are chosen.
+func (d *Driver) isFlexible() bool {
+	return strings.HasSuffix(d.Shape, ".Flex")
+}
+
+func (d *Driver) PreCreateCheck() error {
+	if d.UserDataFile != "" {
+		if _, err := os.Stat(d.UserDataFile); os.IsNotExist(err) {
+			return fmt.Errorf("user-data file %s could not be found", d.UserDataFile)
+		}
+	}
+
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
+	availabilityDomain, err := d.availabilityDomain(client)
+	if err != nil {
+		return err
+	}
+	shapes, err := client.Shapes(d.CompartmentID, availabilityDomain)
+	if err != nil {
+		return err
+	}
+	if err := d.checkShape(shapes); err != nil {
+		return err
+	}
+
+	if d.ImageID != "" {
+		if err := client.GetImage(d.ImageID); err != nil {
+			return err
+		}
+	} else if _, err := client.FindImage(d.CompartmentID, d.ImageOS, d.ImageOSVersion, d.Shape); err != nil {
+		return err
+	}
+
+	if d.SubnetID != "" {
+		return client.GetSubnet(d.SubnetID)
+	}
+	_, err = client.FindSubnet(d.CompartmentID, d.VCNID, d.SubnetName)
+	return err
+}
+
+func (d *Driver) checkShape(shapes []Shape) error {
+	for _, shape := range shapes {
+		if shape.Shape != d.Shape {
+			continue
+		}
+		if !shape.IsFlexible {
+			return nil
+		}
+		if o := shape.OCPUOptions; o != nil && (float32(d.OCPUs) < o.Min || float32(d.OCPUs) > o.Max) {
+			return fmt.Errorf("oci shape %s takes %v to %v OCPUs, got %d", d.Shape, o.Min, o.Max, d.OCPUs)
+		}
+		if m := shape.MemoryOptions; m != nil && (float32(d.MemoryGBs) < m.MinInGBs || float32(d.MemoryGBs) > m.MaxInGBs) {
+			return fmt.Errorf("oci shape %s takes %v to %v GB of memory, got %d", d.Shape, m.MinInGBs, m.MaxInGBs, d.MemoryGBs)
+		}
+		return nil
+	}
+	return fmt.Errorf("oci shape %s is not available in %s", d.Shape, d.AvailabilityDomain)
+}
+
+// availabilityDomain returns the availability domain of the instance,
+// which is the first of the region unless set.
+func (d *Driver) availabilityDomain(client *Client) (string, error) {
+	if d.AvailabilityDomain != "" {
+		return d.AvailabilityDomain, nil
+	}
+	availabilityDomains, err := client.AvailabilityDomains(d.CompartmentID)
+	if err != nil {
+		return "", err
+	}
+	if len(availabilityDomains) == 0 {
+		return "", fmt.Errorf("oci region %s has no availability domain", d.Region)
+	}
+	d.AvailabilityDomain = availabilityDomains[0]
+	return d.AvailabilityDomain, nil
+}
+
+func (d *Driver) Create() error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
+	availabilityDomain, err := d.availabilityDomain(client)
+	if err != nil {
+		return err
+	}
+	imageID := d.ImageID
+	if imageID == "" {
+		if imageID, err = client.FindImage(d.CompartmentID, d.ImageOS, d.ImageOSVersion, d.Shape); err != nil {
+			return err
+		}
+	}
+	subnetID := d.SubnetID
+	if subnetID == "" {
+		if subnetID, err = client.FindSubnet(d.CompartmentID, d.VCNID, d.SubnetName); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Creating SSH key...")
+
+	d.SSHKeyPath = d.GetSSHKeyPath()
+	if err := ssh.GenerateSSHKey(d.SSHKeyPath); err != nil {
+		return err
+	}
+	publicKey, err := os.ReadFile(d.SSHKeyPath + ".pub")
+	if err != nil {
+		return err
+	}
+
+	launchRequest, err := d.launchRequest(availabilityDomain, imageID, subnetID, string(publicKey))
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Launching OCI instance...")
+
+	instance, err := client.LaunchInstance(launchRequest)
+	if err != nil {
+		return err
+	}
+	d.InstanceID = instance.ID
+
+	log.Info("Waiting for the instance to be running...")
+	for {
+		instance, err = client.GetInstance(d.InstanceID)
+		if err == nil && instance.LifecycleState == "RUNNING" {
+			err = d.setIPAddresses(client)
+		}
+		if err != nil {
+			if removeErr := d.Remove(); removeErr != nil {
+				return fmt.Errorf("failed to create machine due to error: %v. Removing instance: %v", err, removeErr)
+			}
+			return err
+		}
+
+		if instance.LifecycleState == "RUNNING" && d.IPAddress != "" {
+			break
+		}
+
+		time.Sleep(5 * time.Second)
+	}
+
+	log.Debugf("Created OCI instance ID %s, IP address %s, Private IP address %s",
+		instance.ID,
+		d.IPAddress,
+		d.PrivateIPAddress)
+
+	return nil
+}
+
+// launchRequest returns the request launching the instance in the
+// availability domain, from the image and on the subnet, authorizing the
+// public key.
+func (d *Driver) launchRequest(availabilityDomain, imageID, subnetID, publicKey string) (*InstanceLaunchRequest, error) {
+	launchRequest := &InstanceLaunchRequest{
+		AvailabilityDomain: availabilityDomain,
+		CompartmentID:      d.CompartmentID,
+		DisplayName:        d.MachineName,
+		Shape:              d.Shape,
+		SourceDetails: SourceDetails{
+			SourceType:          "image",
+			ImageID:             imageID,
+			BootVolumeSizeInGBs: int64(d.BootVolumeSize),
+		},
+		CreateVnicDetails: CreateVnicDetails{
+			SubnetID:       subnetID,
+			AssignPublicIP: !d.PrivateIPOnly,
+		},
+		Metadata:     map[string]string{"ssh_authorized_keys": publicKey},
+		FreeformTags: d.getTags(),
+	}
+	if d.isFlexible() {
+		launchRequest.ShapeConfig = &ShapeConfig{OCPUs: float32(d.OCPUs), MemoryInGBs: float32(d.MemoryGBs)}
+	}
+
+	if d.UserDataFile != "" {
+		buf, err := os.ReadFile(d.UserDataFile)
+		if err != nil {
+			return nil, err
+		}
+		launchRequest.Metadata["user_data"] = base64.StdEncoding.EncodeToString(buf)
+	}
+
+	return launchRequest, nil
+}
+
+// setIPAddresses sets the addresses of the instance once its VNIC is
+// attached.
+func (d *Driver) setIPAddresses(client *Client) error {
+	vnic, err := client.PrimaryVnic(d.CompartmentID, d.InstanceID)
+	if err != nil || vnic == nil {
+		return err
+	}
+
+	d.PrivateIPAddress = vnic.PrivateIP
+	d.IPAddress = vnic.PublicIP
+	if d.PrivateIPOnly {
+		d.IPAddress = vnic.PrivateIP
+	}
+	return nil
+}
+
+func (d *Driver) GetURL() (string, error) {
+	if err := drivers.MustBeRunning(d); err != nil {
+		return "", err
+	}
+
+	ip, err := d.GetIP()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("tcp://%s", net.JoinHostPort(ip, "2376")), nil
+}
+
+// GetIPs returns the public, private and IPv6 addresses of the primary
+// VNIC of the instance.
+func (d *Driver) GetIPs() ([]drivers.NetworkAddress, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return nil, err
+	}
+	vnic, err := client.PrimaryVnic(d.CompartmentID, d.InstanceID)
+	if err != nil || vnic == nil {
+		return nil, err
+	}
+
+	return vnicAddresses(vnic), nil
+}
+
+// vnicAddresses returns the public, private and IPv6 addresses of the VNIC.
+func vnicAddresses(vnic *Vnic) []drivers.NetworkAddress {
+	var addrs []drivers.NetworkAddress
+	addrs = drivers.AppendAddress(addrs, drivers.AddressPublic, vnic.PublicIP)
+	addrs = drivers.AppendAddress(addrs, drivers.AddressPrivate, vnic.PrivateIP)
+	for _, ipv6 := range vnic.IPv6Addresses {
+		addrs = drivers.AppendAddress(addrs, drivers.AddressIPv6, ipv6)
+	}
+	return addrs
+}
+
+func (d *Driver) GetState() (state.State, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return state.Error, err
+	}
+	instance, err := client.GetInstance(d.InstanceID)
+	if err != nil {
+		if !isNotFound(err) {
+			return state.Error, err
+		}
+		return state.None, fmt.Errorf("machine %v not found", d.MachineName)
+	}
+
+	return instanceState(instance.LifecycleState), nil
+}
+
+// instanceState returns the state of an instance in the lifecycle state.
+func instanceState(lifecycleState string) state.State {
+	switch lifecycleState {
+	case "PROVISIONING", "STARTING":
+		return state.Starting
+	case "RUNNING":
+		return state.Running
+	case "STOPPING":
+		return state.Stopping
+	case "STOPPED":
+		return state.Stopped
+	}
+	return state.None
+}
+
+func (d *Driver) action(action string) error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	return client.InstanceAction(d.InstanceID, action)
+}
+
+func (d *Driver) Start() error {
+	return d.action("START")
+}
+
+func (d *Driver) Stop() error {
+	return d.action("SOFTSTOP")
+}
+
+func (d *Driver) Restart() error {
+	return d.action("SOFTRESET")
+}
+
+func (d *Driver) Kill() error {
+	return d.action("STOP")
+}
+
+func (d *Driver) Remove() error {
+	if d.InstanceID == "" {
+		return nil
+	}
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	if err := client.TerminateInstance(d.InstanceID); err != nil {
+		if !isNotFound(err) {
+			return err
+		}
+		log.Infof("OCI instance doesn't exist, assuming it is already terminated")
+	}
+	return nil
+}
+
+func (d *Driver) getClient() (*Client, error) {
+	httpClient := newHTTPClient()
+	if d.credentials == nil {
+		if d.InstancePrincipals {
+			if d.Region == "" {
+				region, err := instanceRegion(httpClient)
+				if err != nil {
+					return nil, err
+				}
+				d.Region = region
+			}
+			d.credentials = newInstancePrincipalCredentials(d.Region, httpClient)
+		} else {
+			credentials, err := newAPIKeyCredentials(d.TenancyID, d.UserID, d.Fingerprint, d.PrivateKeyPath)
+			if err != nil {
+				return nil, err
+			}
+			d.credentials = credentials
+		}
+	}
+	return NewClient(d.Region, d.credentials, httpClient), nil
+}
+
+// getTags returns the freeform tags, given as key=value pairs.
+func (d *Driver) getTags() map[string]string {
+	var tags map[string]string
+
+	for _, t := range strings.Split(d.Tags, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if tags == nil {
+			tags = map[string]string{}
+		}
+		key, value, _ := strings.Cut(t, "=")
+		tags[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+
+	return tags
+}
@@ -0,0 +1,260 @@
+package oci
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+var authorizationRegexp = regexp.MustCompile(`^Signature version="1",headers="([^"]+)",keyId="([^"]+)",algorithm="rsa-sha256",signature="([^"]+)"$`)
+
+func TestSetConfigFromFlags(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"oci-use-instance-principals": true,
+			"oci-compartment-id":          "compartment",
+			"oci-vcn-id":                  "vcn",
+			"oci-subnet-name":             "nodes",
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	err := driver.SetConfigFromFlags(checkFlags)
+
+	assert.NoError(t, err)
+	assert.Empty(t, checkFlags.InvalidFlags)
+	assert.Equal(t, "VM.Standard.E4.Flex", driver.Shape)
+	assert.Equal(t, 1, driver.OCPUs)
+	assert.Equal(t, 16, driver.MemoryGBs)
+	assert.Equal(t, "Canonical Ubuntu", driver.ImageOS)
+	assert.Equal(t, "22.04", driver.ImageOSVersion)
+
+	sshPort, err := driver.GetSSHPort()
+	assert.NoError(t, err)
+	assert.Equal(t, "ubuntu", driver.GetSSHUsername())
+	assert.Equal(t, 22, sshPort)
+}
+
+func TestSetConfigFromFlagsInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		flags    map[string]interface{}
+		expected string
+	}{
+		{
+			map[string]interface{}{"oci-region": "us-phoenix-1"},
+			"oci driver requires the --oci-region, --oci-tenancy-id, --oci-user-id, --oci-fingerprint and --oci-private-key-path options, or --oci-use-instance-principals",
+		},
+		{
+			map[string]interface{}{"oci-use-instance-principals": true, "oci-compartment-id": "compartment", "oci-vcn-id": "vcn"},
+			"oci driver requires the --oci-subnet-id option, or the --oci-vcn-id and --oci-subnet-name ones",
+		},
+		{
+			map[string]interface{}{"oci-use-instance-principals": true, "oci-compartment-id": "compartment", "oci-subnet-id": "subnet", "oci-boot-volume-size": 20},
+			"oci boot volume size must be at least 50 GB, got 20",
+		},
+	} {
+		driver := NewDriver("default", "path")
+		checkFlags := &drivers.CheckDriverOptions{
+			FlagsValues: tc.flags,
+			CreateFlags: driver.GetCreateFlags(),
+		}
+		assert.EqualError(t, driver.SetConfigFromFlags(checkFlags), tc.expected)
+	}
+}
+
+func TestLaunchRequest(t *testing.T) {
+	userdata := filepath.Join(t.TempDir(), "cloud-init.yaml")
+	assert.NoError(t, os.WriteFile(userdata, []byte("#cloud-config\n"), 0600))
+
+	driver := NewDriver("default", "path")
+	driver.CompartmentID = "compartment"
+	driver.OCPUs = 2
+	driver.MemoryGBs = 32
+	driver.BootVolumeSize = 100
+	driver.UserDataFile = userdata
+	driver.Tags = "team=rancher, test"
+
+	request, err := driver.launchRequest("Uocm:PHX-AD-1", "image-new", "subnet-1", "ssh-rsa AAAA")
+	assert.NoError(t, err)
+	assert.Equal(t, &InstanceLaunchRequest{
+		AvailabilityDomain: "Uocm:PHX-AD-1",
+		CompartmentID:      "compartment",
+		DisplayName:        "default",
+		Shape:              "VM.Standard.E4.Flex",
+		ShapeConfig:        &ShapeConfig{OCPUs: 2, MemoryInGBs: 32},
+		SourceDetails:      SourceDetails{SourceType: "image", ImageID: "image-new", BootVolumeSizeInGBs: 100},
+		CreateVnicDetails:  CreateVnicDetails{SubnetID: "subnet-1", AssignPublicIP: true},
+		Metadata:           map[string]string{"ssh_authorized_keys": "ssh-rsa AAAA", "user_data": "I2Nsb3VkLWNvbmZpZwo="},
+		FreeformTags:       map[string]string{"team": "rancher", "test": ""},
+	}, request)
+
+	// Fixed shapes take no shape configuration.
+	driver.Shape = "VM.Standard2.1"
+	driver.PrivateIPOnly = true
+	driver.UserDataFile = ""
+	request, err = driver.launchRequest("Uocm:PHX-AD-1", "image-new", "subnet-1", "ssh-rsa AAAA")
+	assert.NoError(t, err)
+	assert.Nil(t, request.ShapeConfig)
+	assert.False(t, request.CreateVnicDetails.AssignPublicIP)
+	assert.NotContains(t, request.Metadata, "user_data")
+}
+
+func TestCheckShape(t *testing.T) {
+	shapes := []Shape{
+		{Shape: "VM.Standard2.1"},
+		{Shape: "VM.Standard.E4.Flex", IsFlexible: true, OCPUOptions: &OCPURange{Min: 1, Max: 64}, MemoryOptions: &MemoryRange{MinInGBs: 1, MaxInGBs: 1024}},
+	}
+
+	driver := NewDriver("default", "path")
+	driver.AvailabilityDomain = "Uocm:PHX-AD-1"
+	assert.NoError(t, driver.checkShape(shapes))
+
+	driver.MemoryGBs = 2048
+	assert.EqualError(t, driver.checkShape(shapes), "oci shape VM.Standard.E4.Flex takes 1 to 1024 GB of memory, got 2048")
+
+	driver.OCPUs = 128
+	assert.EqualError(t, driver.checkShape(shapes), "oci shape VM.Standard.E4.Flex takes 1 to 64 OCPUs, got 128")
+
+	driver.Shape = "VM.Standard2.1"
+	assert.NoError(t, driver.checkShape(shapes))
+
+	driver.Shape = "BM.GPU4.8"
+	assert.EqualError(t, driver.checkShape(shapes), "oci shape BM.GPU4.8 is not available in Uocm:PHX-AD-1")
+}
+
+func TestInstanceState(t *testing.T) {
+	for lifecycleState, expected := range map[string]state.State{
+		"PROVISIONING": state.Starting,
+		"STARTING":     state.Starting,
+		"RUNNING":      state.Running,
+		"STOPPING":     state.Stopping,
+		"STOPPED":      state.Stopped,
+		"TERMINATED":   state.None,
+	} {
+		assert.Equal(t, expected, instanceState(lifecycleState), lifecycleState)
+	}
+}
+
+func TestVnicAddresses(t *testing.T) {
+	vnic := &Vnic{PublicIP: "1.2.3.4", PrivateIP: "10.0.0.3", IPv6Addresses: []string{"2001:db8::1"}}
+	assert.Equal(t, []drivers.NetworkAddress{
+		{Kind: drivers.AddressPublic, Address: "1.2.3.4"},
+		{Kind: drivers.AddressPrivate, Address: "10.0.0.3"},
+		{Kind: drivers.AddressIPv6, Address: "2001:db8::1"},
+	}, vnicAddresses(vnic))
+
+	assert.Equal(t, []drivers.NetworkAddress{{Kind: drivers.AddressPrivate, Address: "10.0.0.3"}}, vnicAddresses(&Vnic{PrivateIP: "10.0.0.3"}))
+}
+
+func TestSignRequest(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	body := []byte(`{"displayName": "default"}`)
+	req, err := http.NewRequest(http.MethodPost, "https://iaas.us-phoenix-1.oraclecloud.com/20160918/instances", bytes.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	assert.NoError(t, signRequest(req, body, "tenancy/user/aa:bb", key))
+
+	match := authorizationRegexp.FindStringSubmatch(req.Header.Get("Authorization"))
+	if match == nil {
+		t.Fatal("no signature in", req.Header.Get("Authorization"))
+	}
+	assert.Equal(t, "date (request-target) host content-length content-type x-content-sha256", match[1])
+	assert.Equal(t, "tenancy/user/aa:bb", match[2])
+
+	sum := sha256.Sum256(body)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(sum[:]), req.Header.Get("X-Content-Sha256"))
+
+	digest := sha256.Sum256([]byte(signingString(req, strings.Split(match[1], " "))))
+	signature, err := base64.StdEncoding.DecodeString(match[3])
+	assert.NoError(t, err)
+	assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature))
+
+	// Reads only sign the date and target.
+	req, err = http.NewRequest(http.MethodGet, "https://iaas.us-phoenix-1.oraclecloud.com/20160918/shapes?compartmentId=compartment", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, signRequest(req, nil, "tenancy/user/aa:bb", key))
+	match = authorizationRegexp.FindStringSubmatch(req.Header.Get("Authorization"))
+	if match == nil {
+		t.Fatal("no signature in", req.Header.Get("Authorization"))
+	}
+	assert.Equal(t, "date (request-target) host", match[1])
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	parsed, err := parsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	assert.NoError(t, err)
+	assert.True(t, key.Equal(parsed))
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+	parsed, err = parsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	assert.NoError(t, err)
+	assert.True(t, key.Equal(parsed))
+
+	_, err = parsePrivateKey([]byte("not a key"))
+	assert.EqualError(t, err, "no PEM encoded key")
+}
+
+func TestTokenExpiry(t *testing.T) {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"exp": 1700000000}`))
+	expires, err := tokenExpiry("header." + payload + ".signature")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Unix(1700000000, 0), expires)
+
+	_, err = tokenExpiry("token")
+	assert.EqualError(t, err, "malformed security token")
+}
+
+func TestCertFingerprint(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{OrganizationalUnit: []string{"opc-instance:ocid1.instance.test", "opc-tenant:ocid1.tenancy.test"}},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	sum := sha1.Sum(der)
+	fingerprint := certFingerprint(cert)
+	assert.Len(t, fingerprint, len(sum)*3-1)
+	assert.Equal(t, fmt.Sprintf("%02X", sum[0]), fingerprint[:2])
+}
+
+func TestIsNotFound(t *testing.T) {
+	assert.True(t, isNotFound(&APIError{StatusCode: http.StatusNotFound}))
+	assert.False(t, isNotFound(&APIError{StatusCode: http.StatusUnauthorized}))
+	assert.False(t, isNotFound(errors.New("oci: timeout")))
+}
@@ -88,6 +88,7 @@ func (c *GenericClient) CreateInstance(d *Driver) (string, error) {
 		SecurityGroups:   d.SecurityGroups,
 		AvailabilityZone: d.AvailabilityZone,
 		ConfigDrive:      &d.ConfigDrive,
+		Metadata:         d.MachineTags,
 	}
 
 	serverOpts = &keypairs.CreateOptsExt{
@@ -132,8 +133,9 @@ func (c *GenericClient) CreateInstance(d *Driver) (string, error) {
 func (c *GenericClient) VolumeCreate(d *Driver) (string, error) {
 	log.Info("Creating volume...")
 	opts := volumes.CreateOpts{
-		Name: d.VolumeName,
-		Size: d.VolumeSize,
+		Name:     d.VolumeName,
+		Size:     d.VolumeSize,
+		Metadata: d.MachineTags,
 	}
 	if d.VolumeType != "" {
 		opts.VolumeType = d.VolumeType
@@ -651,6 +653,7 @@ func (c *GenericClient) Authenticate(d *Driver) error {
 		"AuthUrl":                   d.AuthUrl,
 		"Insecure":                  d.Insecure,
 		"CaCert":                    d.CaCert,
+		"ClientCert":                d.ClientCert,
 		"DomainId":                  d.DomainId,
 		"DomainName":                d.DomainName,
 		"UserId":                    d.UserId,
@@ -716,6 +719,16 @@ func (c *GenericClient) SetTLSConfig(d *Driver) error {
 		config.RootCAs = certpool
 	}
 
+	if d.ClientCert != "" {
+		// Authenticate with a client certificate, which Keystone may require
+		cert, err := tls.LoadX509KeyPair(d.ClientCert, d.ClientKey)
+		if err != nil {
+			log.Error("Unable to read specified client certificate")
+			return err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
 	transport := &http.Transport{TLSClientConfig: config, Proxy: http.ProxyFromEnvironment}
 	c.Provider.HTTPClient.Transport = transport
 	return nil
@@ -0,0 +1,99 @@
+package openstack
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gophercloud/utils/openstack/clientconfig"
+	"gopkg.in/yaml.v2"
+)
+
+// cloudsFile loads the clouds of the clouds.yaml file at its path, or of the
+// clouds.yaml file clientconfig looks for when the path is empty.
+type cloudsFile string
+
+func (f cloudsFile) LoadCloudsYAML() (map[string]clientconfig.Cloud, error) {
+	if f == "" {
+		return clientconfig.LoadCloudsYAML()
+	}
+
+	content, err := os.ReadFile(string(f))
+	if err != nil {
+		return nil, err
+	}
+	var clouds clientconfig.Clouds
+	if err := yaml.Unmarshal(content, &clouds); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %v", f, err)
+	}
+	return clouds.Clouds, nil
+}
+
+func (f cloudsFile) LoadSecureCloudsYAML() (map[string]clientconfig.Cloud, error) {
+	return clientconfig.LoadSecureCloudsYAML()
+}
+
+func (f cloudsFile) LoadPublicCloudsYAML() (map[string]clientconfig.Cloud, error) {
+	return clientconfig.LoadPublicCloudsYAML()
+}
+
+// loadCloud sets the authentication, region and TLS options left unset from
+// the entry of the cloud in clouds.yaml. They are stored with the machine, so
+// that clouds.yaml is only read when creating it.
+func (d *Driver) loadCloud() error {
+	cloud, err := clientconfig.GetCloudFromYAML(&clientconfig.ClientOpts{
+		Cloud: d.Cloud,
+		// this is needed to disable the OS_CLOUD env detection, the flag reads it
+		EnvPrefix: "_",
+		YAMLOpts:  cloudsFile(d.CloudsFile),
+	})
+	if err != nil {
+		return err
+	}
+
+	if auth := cloud.AuthInfo; auth != nil {
+		for _, option := range []struct {
+			target *string
+			value  string
+		}{
+			{&d.AuthUrl, auth.AuthURL},
+			{&d.UserId, auth.UserID},
+			{&d.Username, auth.Username},
+			{&d.Password, auth.Password},
+			{&d.TenantId, auth.ProjectID},
+			{&d.TenantName, auth.ProjectName},
+			{&d.DomainId, auth.DomainID},
+			{&d.DomainName, auth.DomainName},
+			{&d.TenantDomainId, auth.ProjectDomainID},
+			{&d.TenantDomainName, auth.ProjectDomainName},
+			{&d.UserDomainId, auth.UserDomainID},
+			{&d.UserDomainName, auth.UserDomainName},
+			{&d.ApplicationCredentialId, auth.ApplicationCredentialID},
+			{&d.ApplicationCredentialName, auth.ApplicationCredentialName},
+			{&d.ApplicationCredentialSecret, auth.ApplicationCredentialSecret},
+		} {
+			if *option.target == "" {
+				*option.target = option.value
+			}
+		}
+	}
+
+	if d.Region == "" {
+		d.Region = cloud.RegionName
+	}
+	// clouds.yaml names the endpoint types public, internal and admin.
+	if d.EndpointType == "" && cloud.EndpointType != "" {
+		d.EndpointType = strings.TrimSuffix(cloud.EndpointType, "URL") + "URL"
+	}
+	if cloud.Verify != nil && !*cloud.Verify {
+		d.Insecure = true
+	}
+	if d.CaCert == "" {
+		d.CaCert = cloud.CACertFile
+	}
+	if d.ClientCert == "" && d.ClientKey == "" {
+		d.ClientCert = cloud.ClientCertFile
+		d.ClientKey = cloud.ClientKeyFile
+	}
+	return nil
+}
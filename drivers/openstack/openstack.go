@@ -28,6 +28,10 @@ type Driver struct {
 	ActiveTimeout               int
 	Insecure                    bool
 	CaCert                      string
+	ClientCert                  string
+	ClientKey                   string
+	Cloud                       string
+	CloudsFile                  string
 	DomainId                    string
 	DomainName                  string
 	UserId                      string
@@ -78,6 +82,19 @@ const (
 	defaultActiveTimeout = 200
 )
 
+// Capabilities returns the optional operations supported by the driver.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityStartStop,
+		drivers.CapabilityRestart,
+		drivers.CapabilityKill,
+		drivers.CapabilityPrivateIP,
+		drivers.CapabilityCustomSSHPort,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+	}
+}
+
 func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 	return []mcnflag.Flag{
 		mcnflag.StringFlag{
@@ -97,6 +114,30 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "CA certificate bundle to verify against",
 			Value:  "",
 		},
+		mcnflag.StringFlag{
+			EnvVar: "OS_CERT",
+			Name:   "openstack-cert",
+			Usage:  "Client certificate to authenticate with over TLS",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OS_KEY",
+			Name:   "openstack-key",
+			Usage:  "Private key of the client certificate",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OS_CLOUD",
+			Name:   "openstack-cloud",
+			Usage:  "Cloud in clouds.yaml to read the options not set from",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "OS_CLIENT_CONFIG_FILE",
+			Name:   "openstack-client-config-file",
+			Usage:  "Path to clouds.yaml, looked for in the current directory, ~/.config/openstack and /etc/openstack by default",
+			Value:  "",
+		},
 		mcnflag.StringFlag{
 			EnvVar: "OS_DOMAIN_ID",
 			Name:   "openstack-domain-id",
@@ -122,10 +163,11 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Value:  "",
 		},
 		mcnflag.StringFlag{
-			EnvVar: "OS_PASSWORD",
-			Name:   "openstack-password",
-			Usage:  "OpenStack password",
-			Value:  "",
+			EnvVar:    "OS_PASSWORD",
+			Name:      "openstack-password",
+			Usage:     "OpenStack password",
+			Value:     "",
+			Sensitive: true,
 		},
 		mcnflag.StringFlag{
 			EnvVar: "OS_TENANT_NAME",
@@ -176,10 +218,11 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Value:  "",
 		},
 		mcnflag.StringFlag{
-			EnvVar: "OS_APPLICATION_CREDENTIAL_SECRET",
-			Name:   "openstack-application-credential-secret",
-			Usage:  "OpenStack application credential secret",
-			Value:  "",
+			EnvVar:    "OS_APPLICATION_CREDENTIAL_SECRET",
+			Name:      "openstack-application-credential-secret",
+			Usage:     "OpenStack application credential secret",
+			Value:     "",
+			Sensitive: true,
 		},
 		mcnflag.StringFlag{
 			EnvVar: "OS_REGION_NAME",
@@ -348,6 +391,31 @@ func NewDerivedDriver(hostName, storePath string) *Driver {
 	}
 }
 
+// GetIPs returns every address of the instance. Floating IPs are reported
+// as public. Fixed IPs are reported as private when they fall in a private
+// range, and as public otherwise, as is the case on provider networks.
+func (d *Driver) GetIPs() ([]drivers.NetworkAddress, error) {
+	if err := d.initCompute(); err != nil {
+		return nil, err
+	}
+
+	addresses, err := d.client.GetInstanceIPAddresses(d)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []drivers.NetworkAddress
+	for _, a := range addresses {
+		kind := drivers.AddressPublic
+		if ip := net.ParseIP(a.Address); a.AddressType != Floating && ip != nil && ip.IsPrivate() {
+			kind = drivers.AddressPrivate
+		}
+		addrs = drivers.AppendAddress(addrs, kind, a.Address)
+	}
+
+	return addrs, nil
+}
+
 func (d *Driver) GetSSHHostname() (string, error) {
 	return d.GetIP()
 }
@@ -380,7 +448,10 @@ func (d *Driver) UnmarshalJSON(data []byte) error {
 	*d = Driver(target)
 
 	// Make sure to reload values that are subject to change from envvars and os.Args.
-	driverOpts := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	driverOpts, err := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	if err != nil {
+		return err
+	}
 	if _, ok := driverOpts.Values["openstack-auth-url"]; ok {
 		d.AuthUrl = driverOpts.String("openstack-auth-url")
 	}
@@ -405,6 +476,10 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.ActiveTimeout = flags.Int("openstack-active-timeout")
 	d.Insecure = flags.Bool("openstack-insecure")
 	d.CaCert = flags.String("openstack-cacert")
+	d.ClientCert = flags.String("openstack-cert")
+	d.ClientKey = flags.String("openstack-key")
+	d.Cloud = flags.String("openstack-cloud")
+	d.CloudsFile = flags.String("openstack-client-config-file")
 	d.DomainId = flags.String("openstack-domain-id")
 	d.DomainName = flags.String("openstack-domain-name")
 	d.UserId = flags.String("openstack-user-id")
@@ -458,6 +533,24 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	}
 
 	d.SetSwarmConfigFromFlags(flags)
+	if err := d.SetTagsFromFlags(flags); err != nil {
+		return err
+	}
+	if err := d.SetUserDataFromFlags(flags); err != nil {
+		return err
+	}
+	if err := d.SetSSHJumpHostsFromFlags(flags); err != nil {
+		return err
+	}
+	if err := d.SetSSHRetryPolicyFromFlags(flags); err != nil {
+		return err
+	}
+
+	if d.Cloud != "" {
+		if err := d.loadCloud(); err != nil {
+			return err
+		}
+	}
 
 	return d.checkConfig()
 }
@@ -478,6 +571,11 @@ func (d *Driver) GetURL() (string, error) {
 	return fmt.Sprintf("tcp://%s", net.JoinHostPort(ip, "2376")), nil
 }
 
+// GetTags returns the metadata of the server and of its volume.
+func (d *Driver) GetTags() (map[string]string, error) {
+	return d.MachineTags, nil
+}
+
 func (d *Driver) GetIP() (string, error) {
 	if d.IPAddress != "" {
 		return d.IPAddress, nil
@@ -569,6 +667,13 @@ func (d *Driver) Create() error {
 			return err
 		}
 	}
+	if len(d.UserData) == 0 {
+		userData, err := d.MachineUserData()
+		if err != nil {
+			return err
+		}
+		d.UserData = []byte(userData)
+	}
 	if err := d.createMachine(); err != nil {
 		return err
 	}
@@ -733,6 +838,9 @@ func (d *Driver) checkConfig() error {
 	if (d.KeyPairName != "" && d.PrivateKeyFile == "") || (d.KeyPairName == "" && d.PrivateKeyFile != "") {
 		return fmt.Errorf(errorBothOptions, "KeyPairName", "PrivateKeyFile")
 	}
+	if (d.ClientCert == "") != (d.ClientKey == "") {
+		return fmt.Errorf(errorBothOptions, "ClientCert", "ClientKey")
+	}
 	return nil
 }
 
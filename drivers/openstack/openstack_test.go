@@ -3,6 +3,7 @@ package openstack
 import (
 	"encoding/json"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/rancher/machine/libmachine/drivers"
@@ -49,3 +50,95 @@ func TestSetConfigFromFlags(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Empty(t, checkFlags.InvalidFlags)
 }
+
+func TestSetConfigFromFlagsApplicationCredential(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"openstack-auth-url":                      "http://url",
+			"openstack-application-credential-id":     "ID",
+			"openstack-application-credential-secret": "secret",
+			"openstack-flavor-id":                     "ID",
+			"openstack-image-id":                      "ID",
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	err := driver.SetConfigFromFlags(checkFlags)
+
+	assert.NoError(t, err)
+	assert.Empty(t, checkFlags.InvalidFlags)
+
+	ao, err := driver.(*Driver).parseAuthConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "ID", ao.ApplicationCredentialID)
+	assert.Equal(t, "secret", ao.ApplicationCredentialSecret)
+}
+
+func TestSetConfigFromFlagsCloudsYAML(t *testing.T) {
+	cloudsFile := filepath.Join(t.TempDir(), "clouds.yaml")
+	assert.NoError(t, os.WriteFile(cloudsFile, []byte(`clouds:
+  other:
+    auth:
+      auth_url: http://other
+  mycloud:
+    auth:
+      auth_url: http://keystone:5000/v3
+      application_credential_id: ID
+      application_credential_secret: secret
+    region_name: RegionTwo
+    interface: internal
+    cacert: /etc/ssl/ca.pem
+    cert: /etc/ssl/client.pem
+    key: /etc/ssl/client-key.pem
+`), 0600))
+
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"openstack-cloud":              "mycloud",
+			"openstack-client-config-file": cloudsFile,
+			"openstack-region":             "RegionOne",
+			"openstack-flavor-id":          "ID",
+			"openstack-image-id":           "ID",
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	err := driver.SetConfigFromFlags(checkFlags)
+
+	assert.NoError(t, err)
+	d := driver.(*Driver)
+	assert.Equal(t, "http://keystone:5000/v3", d.AuthUrl)
+	assert.Equal(t, "ID", d.ApplicationCredentialId)
+	assert.Equal(t, "secret", d.ApplicationCredentialSecret)
+	assert.Equal(t, "RegionOne", d.Region)
+	assert.Equal(t, "internalURL", d.EndpointType)
+	assert.Equal(t, "/etc/ssl/ca.pem", d.CaCert)
+	assert.Equal(t, "/etc/ssl/client.pem", d.ClientCert)
+	assert.Equal(t, "/etc/ssl/client-key.pem", d.ClientKey)
+
+	checkFlags.FlagsValues["openstack-cloud"] = "missing"
+	assert.Error(t, NewDriver("default", "path").SetConfigFromFlags(checkFlags))
+}
+
+func TestSetConfigFromFlagsClientCertWithoutKey(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"openstack-auth-url":  "http://url",
+			"openstack-username":  "user",
+			"openstack-password":  "pwd",
+			"openstack-tenant-id": "ID",
+			"openstack-flavor-id": "ID",
+			"openstack-image-id":  "ID",
+			"openstack-cert":      "client.pem",
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	assert.Error(t, driver.SetConfigFromFlags(checkFlags))
+}
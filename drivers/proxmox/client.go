@@ -0,0 +1,315 @@
+package proxmox
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rancher/machine/libmachine/version"
+)
+
+// Client makes the calls to the Proxmox VE API the driver needs, on a
+// node.
+type Client struct {
+	endpoint   string
+	node       string
+	httpClient *http.Client
+
+	// authorization is the API token header, or the ticket cookie and its
+	// CSRF token once logged in with a password.
+	authorization      string
+	username, password string
+	ticket, csrfToken  string
+}
+
+// NewClient returns a client of the API at the URL, e.g.
+// https://pve:8006, authenticating with the API token, or with the user
+// password when no token is given.
+func NewClient(apiURL, node, username, password, tokenID, tokenSecret string, insecureTLS bool) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if insecureTLS {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	c := &Client{
+		endpoint:   strings.TrimSuffix(apiURL, "/") + "/api2/json",
+		node:       node,
+		httpClient: &http.Client{Timeout: 60 * time.Second, Transport: transport},
+		username:   username,
+		password:   password,
+	}
+	if tokenID != "" {
+		c.authorization = fmt.Sprintf("PVEAPIToken=%s!%s=%s", username, tokenID, tokenSecret)
+	}
+	return c
+}
+
+// APIError is an error answered by the Proxmox VE API, whose reason is
+// the one of its status.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return "proxmox: " + e.Message
+}
+
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && (apiErr.StatusCode == http.StatusNotFound || strings.Contains(apiErr.Message, "does not exist"))
+}
+
+type Interface struct {
+	Name        string `json:"name"`
+	IPAddresses []struct {
+		Type    string `json:"ip-address-type"`
+		Address string `json:"ip-address"`
+	} `json:"ip-addresses"`
+}
+
+type VMStatus struct {
+	Status    string `json:"status"`
+	QMPStatus string `json:"qmpstatus"`
+}
+
+func (c *Client) login() error {
+	form := url.Values{"username": {c.username}, "password": {c.password}}
+	var reply struct {
+		Ticket              string `json:"ticket"`
+		CSRFPreventionToken string `json:"CSRFPreventionToken"`
+	}
+	if err := c.send(http.MethodPost, "/access/ticket", form, &reply); err != nil {
+		return err
+	}
+	c.ticket, c.csrfToken = reply.Ticket, reply.CSRFPreventionToken
+	return nil
+}
+
+func (c *Client) do(method, path string, form url.Values, reply interface{}) error {
+	if err := c.authenticate(); err != nil {
+		return err
+	}
+	return c.send(method, path, form, reply)
+}
+
+// authenticate logs in with the password, unless the client has a token or
+// is logged in already.
+func (c *Client) authenticate() error {
+	if c.authorization == "" && c.ticket == "" {
+		return c.login()
+	}
+	return nil
+}
+
+func (c *Client) send(method, path string, form url.Values, reply interface{}) error {
+	var body io.Reader
+	var contentType string
+	rawURL := c.endpoint + path
+	if method == http.MethodGet || method == http.MethodDelete {
+		if len(form) > 0 {
+			rawURL += "?" + form.Encode()
+		}
+	} else {
+		body = strings.NewReader(form.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	}
+	return c.sendBody(method, rawURL, body, contentType, reply)
+}
+
+func (c *Client) sendBody(method, rawURL string, body io.Reader, contentType string, reply interface{}) error {
+	req, err := http.NewRequest(method, rawURL, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("User-Agent", fmt.Sprintf("docker-machine/v%d", version.APIVersion))
+	if c.authorization != "" {
+		req.Header.Set("Authorization", c.authorization)
+	} else if c.ticket != "" {
+		req.AddCookie(&http.Cookie{Name: "PVEAuthCookie", Value: c.ticket})
+		if method != http.MethodGet {
+			req.Header.Set("CSRFPreventionToken", c.csrfToken)
+		}
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 400 {
+		message := strings.TrimSpace(strings.TrimPrefix(resp.Status, strconv.Itoa(resp.StatusCode)))
+		return &APIError{StatusCode: resp.StatusCode, Message: message}
+	}
+
+	if reply == nil {
+		return nil
+	}
+	envelope := struct {
+		Data interface{} `json:"data"`
+	}{reply}
+	return json.Unmarshal(data, &envelope)
+}
+
+func (c *Client) vmPath(vmid int, path string) string {
+	return fmt.Sprintf("/nodes/%s/qemu/%d%s", c.node, vmid, path)
+}
+
+// waitTask waits for the task, by its UPID, to end and fails if it did.
+func (c *Client) waitTask(upid string) error {
+	for {
+		var status struct {
+			Status     string `json:"status"`
+			ExitStatus string `json:"exitstatus"`
+		}
+		if err := c.do(http.MethodGet, "/nodes/"+c.node+"/tasks/"+url.PathEscape(upid)+"/status", nil, &status); err != nil {
+			return err
+		}
+		if status.Status == "stopped" {
+			if status.ExitStatus != "OK" {
+				return fmt.Errorf("proxmox: task %s failed: %s", upid, status.ExitStatus)
+			}
+			return nil
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// task runs a call answering a task and waits for it.
+func (c *Client) task(method, path string, form url.Values) error {
+	var upid string
+	if err := c.do(method, path, form, &upid); err != nil {
+		return err
+	}
+	return c.waitTask(upid)
+}
+
+func (c *Client) GetNode() error {
+	return c.do(http.MethodGet, "/nodes/"+c.node+"/status", nil, nil)
+}
+
+func (c *Client) GetBridge(name string) error {
+	return c.do(http.MethodGet, "/nodes/"+c.node+"/network/"+name, nil, nil)
+}
+
+// GetConfig returns the configuration of the VM or template.
+func (c *Client) GetConfig(vmid int) (map[string]interface{}, error) {
+	var config map[string]interface{}
+	if err := c.do(http.MethodGet, c.vmPath(vmid, "/config"), nil, &config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (c *Client) NextID() (int, error) {
+	var id json.Number
+	if err := c.do(http.MethodGet, "/cluster/nextid", nil, &id); err != nil {
+		return 0, err
+	}
+	n, err := id.Int64()
+	return int(n), err
+}
+
+// Clone clones the template as the VM and waits for the clone.
+func (c *Client) Clone(template, vmid int, form url.Values) error {
+	form.Set("newid", strconv.Itoa(vmid))
+	return c.task(http.MethodPost, c.vmPath(template, "/clone"), form)
+}
+
+func (c *Client) SetConfig(vmid int, form url.Values) error {
+	return c.do(http.MethodPost, c.vmPath(vmid, "/config"), form, nil)
+}
+
+// ResizeDisk grows the disk of the VM to the size, e.g. "32G".
+func (c *Client) ResizeDisk(vmid int, disk, size string) error {
+	return c.do(http.MethodPut, c.vmPath(vmid, "/resize"), url.Values{"disk": {disk}, "size": {size}}, nil)
+}
+
+// Status runs a change of status, e.g. "start", on the VM.
+func (c *Client) Status(vmid int, status string) error {
+	return c.task(http.MethodPost, c.vmPath(vmid, "/status/"+status), url.Values{})
+}
+
+func (c *Client) GetStatus(vmid int) (*VMStatus, error) {
+	var status VMStatus
+	if err := c.do(http.MethodGet, c.vmPath(vmid, "/status/current"), nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Interfaces returns the network interfaces the guest agent of the VM
+// reports, failing until the agent runs.
+func (c *Client) Interfaces(vmid int) ([]Interface, error) {
+	var reply struct {
+		Result []Interface `json:"result"`
+	}
+	if err := c.do(http.MethodGet, c.vmPath(vmid, "/agent/network-get-interfaces"), nil, &reply); err != nil {
+		return nil, err
+	}
+	return reply.Result, nil
+}
+
+// UploadISO uploads the ISO image file to the storage as name, and waits
+// for the upload.
+func (c *Client) UploadISO(storage, name, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	if err := writer.WriteField("content", "iso"); err != nil {
+		return err
+	}
+	part, err := writer.CreateFormFile("filename", name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	if err := c.authenticate(); err != nil {
+		return err
+	}
+	var upid string
+	if err := c.sendBody(http.MethodPost, c.endpoint+"/nodes/"+c.node+"/storage/"+storage+"/upload", &body, writer.FormDataContentType(), &upid); err != nil {
+		return err
+	}
+	return c.waitTask(upid)
+}
+
+// DeleteVolume deletes the volume, e.g. local:iso/seed.iso, of the storage.
+func (c *Client) DeleteVolume(storage, volume string) error {
+	return c.do(http.MethodDelete, "/nodes/"+c.node+"/storage/"+storage+"/content/"+url.PathEscape(volume), nil, nil)
+}
+
+// Destroy deletes the VM and its disks.
+func (c *Client) Destroy(vmid int) error {
+	form := url.Values{"purge": {"1"}, "destroy-unreferenced-disks": {"1"}}
+	return c.task(http.MethodDelete, c.vmPath(vmid, ""), form)
+}
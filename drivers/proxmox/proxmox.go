@@ -0,0 +1,658 @@
+package proxmox
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rancher/machine/drivers/driverutil"
+	"github.com/rancher/machine/libmachine/drivers"
+	rpcdriver "github.com/rancher/machine/libmachine/drivers/rpc"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/rancher/machine/libmachine/ssh"
+	"github.com/rancher/machine/libmachine/state"
+)
+
+type Driver struct {
+	*drivers.BaseDriver
+	URL              string
+	Username         string
+	Password         string
+	TokenID          string
+	TokenSecret      string
+	InsecureTLS      bool
+	Node             string
+	TemplateID       int
+	VMID             int
+	FullClone        bool
+	Storage          string
+	Pool             string
+	Cores            int
+	Memory           int
+	Disk             string
+	DiskSize         int
+	Bridge           string
+	VLAN             int
+	CloudInitStorage string
+	ISOStorage       string
+	// SeedISO is the volume of the uploaded cloud-init seed of the machine
+	// user-data, if any.
+	SeedISO string
+}
+
+const (
+	defaultSSHUser          = "ubuntu"
+	defaultUsername         = "root@pam"
+	defaultCores            = 2
+	defaultMemory           = 2048
+	defaultDisk             = "scsi0"
+	defaultBridge           = "vmbr0"
+	defaultCloudInitStorage = "local-lvm"
+	defaultISOStorage       = "local"
+)
+
+// Capabilities returns the optional operations supported by the driver.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityStartStop,
+		drivers.CapabilityRestart,
+		drivers.CapabilityKill,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+	}
+}
+
+// GetCreateFlags registers the flags this driver adds to
+// "docker hosts create"
+func (d *Driver) GetCreateFlags() []mcnflag.Flag {
+	return []mcnflag.Flag{
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOX_URL",
+			Name:   "proxmox-url",
+			Usage:  "URL of the Proxmox VE API, e.g. https://pve.example.com:8006",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOX_USERNAME",
+			Name:   "proxmox-username",
+			Usage:  "Proxmox VE user, with its realm",
+			Value:  defaultUsername,
+		},
+		mcnflag.StringFlag{
+			EnvVar:    "PROXMOX_PASSWORD",
+			Name:      "proxmox-password",
+			Usage:     "Proxmox VE user password, when no API token is given",
+			Sensitive: true,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOX_TOKEN_ID",
+			Name:   "proxmox-token-id",
+			Usage:  "ID of the API token of the user, e.g. machine",
+		},
+		mcnflag.StringFlag{
+			EnvVar:    "PROXMOX_TOKEN_SECRET",
+			Name:      "proxmox-token-secret",
+			Usage:     "secret of the API token of the user",
+			Sensitive: true,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOX_INSECURE_TLS",
+			Name:   "proxmox-insecure-tls",
+			Usage:  "do not verify the certificate of the API, e.g. a self-signed one",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOX_NODE",
+			Name:   "proxmox-node",
+			Usage:  "Proxmox VE node to create the VM on",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "PROXMOX_TEMPLATE_ID",
+			Name:   "proxmox-template-id",
+			Usage:  "VM ID of the template to clone, which must run the QEMU guest agent",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOX_LINKED_CLONE",
+			Name:   "proxmox-linked-clone",
+			Usage:  "create a linked clone of the template instead of a full one",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOX_STORAGE",
+			Name:   "proxmox-storage",
+			Usage:  "storage of the disks of a full clone (default the one of the template)",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOX_POOL",
+			Name:   "proxmox-pool",
+			Usage:  "resource pool to add the VM to",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "PROXMOX_CORES",
+			Name:   "proxmox-cores",
+			Usage:  "number of CPU cores of the VM",
+			Value:  defaultCores,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "PROXMOX_MEMORY",
+			Name:   "proxmox-memory",
+			Usage:  "memory of the VM in MB",
+			Value:  defaultMemory,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOX_DISK",
+			Name:   "proxmox-disk",
+			Usage:  "disk of the template to resize",
+			Value:  defaultDisk,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "PROXMOX_DISK_SIZE",
+			Name:   "proxmox-disk-size",
+			Usage:  "size of the disk in GB (default the one of the template)",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOX_BRIDGE",
+			Name:   "proxmox-bridge",
+			Usage:  "bridge to attach the network interface of the VM to",
+			Value:  defaultBridge,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "PROXMOX_VLAN",
+			Name:   "proxmox-vlan",
+			Usage:  "VLAN tag of the network interface of the VM",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOX_CLOUDINIT_STORAGE",
+			Name:   "proxmox-cloudinit-storage",
+			Usage:  "storage of the cloud-init drive, when the template has none",
+			Value:  defaultCloudInitStorage,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOX_ISO_STORAGE",
+			Name:   "proxmox-iso-storage",
+			Usage:  "storage of ISO images the cloud-init seed of --machine-user-data is uploaded to",
+			Value:  defaultISOStorage,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOX_SSH_USER",
+			Name:   "proxmox-ssh-user",
+			Usage:  "SSH username, created by cloud-init",
+			Value:  defaultSSHUser,
+		},
+	}
+}
+
+func NewDriver(hostName, storePath string) *Driver {
+	return &Driver{
+		Username:         defaultUsername,
+		FullClone:        true,
+		Cores:            defaultCores,
+		Memory:           defaultMemory,
+		Disk:             defaultDisk,
+		Bridge:           defaultBridge,
+		CloudInitStorage: defaultCloudInitStorage,
+		ISOStorage:       defaultISOStorage,
+		BaseDriver: &drivers.BaseDriver{
+			MachineName: hostName,
+			StorePath:   storePath,
+			SSHUser:     defaultSSHUser,
+		},
+	}
+}
+
+func (d *Driver) GetSSHHostname() (string, error) {
+	return d.GetIP()
+}
+
+// DriverName returns the name of the driver
+func (d *Driver) DriverName() string {
+	return "proxmox"
+}
+
+// UnmarshalJSON loads driver config from JSON. This function is used by the RPCServerDriver that wraps
+// all drivers as a means of populating an already-initialized driver with new configuration.
+// See `RPCServerDriver.SetConfigRaw`.
+func (d *Driver) UnmarshalJSON(data []byte) error {
+	// Unmarshal driver config into an aliased type to prevent infinite recursion on UnmarshalJSON.
+	type targetDriver Driver
+
+	// Copy data from `d` to `target` before unmarshalling. This will ensure that already-initialized values
+	// from `d` that are left untouched during unmarshal (like functions) are preserved.
+	target := targetDriver(*d)
+
+	if err := json.Unmarshal(data, &target); err != nil {
+		return fmt.Errorf("error unmarshalling driver config from JSON: %w", err)
+	}
+
+	// Copy unmarshalled data back to `d`.
+	*d = Driver(target)
+
+	// Make sure to reload values that are subject to change from envvars and os.Args.
+	driverOpts, err := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	if err != nil {
+		return err
+	}
+	if _, ok := driverOpts.Values["proxmox-password"]; ok {
+		d.Password = driverOpts.String("proxmox-password")
+	}
+	if _, ok := driverOpts.Values["proxmox-token-secret"]; ok {
+		d.TokenSecret = driverOpts.String("proxmox-token-secret")
+	}
+
+	return nil
+}
+
+func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
+	d.URL = flags.String("proxmox-url")
+	d.Username = flags.String("proxmox-username")
+	d.Password = flags.String("proxmox-password")
+	d.TokenID = flags.String("proxmox-token-id")
+	d.TokenSecret = flags.String("proxmox-token-secret")
+	d.InsecureTLS = flags.Bool("proxmox-insecure-tls")
+	d.Node = flags.String("proxmox-node")
+	d.TemplateID = flags.Int("proxmox-template-id")
+	d.FullClone = !flags.Bool("proxmox-linked-clone")
+	d.Storage = flags.String("proxmox-storage")
+	d.Pool = flags.String("proxmox-pool")
+	d.Cores = flags.Int("proxmox-cores")
+	d.Memory = flags.Int("proxmox-memory")
+	d.Disk = flags.String("proxmox-disk")
+	d.DiskSize = flags.Int("proxmox-disk-size")
+	d.Bridge = flags.String("proxmox-bridge")
+	d.VLAN = flags.Int("proxmox-vlan")
+	d.CloudInitStorage = flags.String("proxmox-cloudinit-storage")
+	d.ISOStorage = flags.String("proxmox-iso-storage")
+	d.SSHUser = flags.String("proxmox-ssh-user")
+
+	d.SetSwarmConfigFromFlags(flags)
+	if err := d.SetUserDataFromFlags(flags); err != nil {
+		return err
+	}
+
+	if d.URL == "" {
+		return fmt.Errorf("proxmox driver requires the --proxmox-url option")
+	}
+	if d.Node == "" {
+		return fmt.Errorf("proxmox driver requires the --proxmox-node option")
+	}
+	if d.TemplateID <= 0 {
+		return fmt.Errorf("proxmox driver requires the --proxmox-template-id option")
+	}
+	if d.TokenID == "" && d.Password == "" {
+		return fmt.Errorf("proxmox driver requires the --proxmox-token-id or --proxmox-password option")
+	}
+	if d.TokenID != "" && d.TokenSecret == "" {
+		return fmt.Errorf("proxmox driver requires the --proxmox-token-secret option with --proxmox-token-id")
+	}
+	if !d.FullClone && d.Storage != "" {
+		return fmt.Errorf("proxmox linked clones use the storage of the template, --proxmox-storage cannot be given")
+	}
+	if d.VLAN < 0 || d.VLAN > 4094 {
+		return fmt.Errorf("proxmox VLAN tag must be between 1 and 4094, got %d", d.VLAN)
+	}
+
+	return nil
+}
+
+func (d *Driver) PreCreateCheck() error {
+	client := d.getClient()
+	if err := client.GetNode(); err != nil {
+		return fmt.Errorf("proxmox node %s: %s", d.Node, err)
+	}
+
+	config, err := client.GetConfig(d.TemplateID)
+	if err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("proxmox template %d doesn't exist on node %s", d.TemplateID, d.Node)
+		}
+		return err
+	}
+	if template, _ := config["template"].(float64); template != 1 {
+		return fmt.Errorf("proxmox VM %d is not a template", d.TemplateID)
+	}
+	if d.DiskSize > 0 {
+		if _, ok := config[d.Disk]; !ok {
+			return fmt.Errorf("proxmox template %d has no disk %s to resize", d.TemplateID, d.Disk)
+		}
+	}
+
+	if err := client.GetBridge(d.Bridge); err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("proxmox bridge %s doesn't exist on node %s", d.Bridge, d.Node)
+		}
+		return err
+	}
+
+	if d.MachineUserDataFile != "" {
+		if _, err := driverutil.CloudConfigWithUser(d.BaseDriver, "", ""); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Driver) Create() error {
+	client := d.getClient()
+
+	log.Infof("Creating SSH key...")
+
+	d.SSHKeyPath = d.GetSSHKeyPath()
+	if err := ssh.GenerateSSHKey(d.SSHKeyPath); err != nil {
+		return err
+	}
+	publicKey, err := os.ReadFile(d.SSHKeyPath + ".pub")
+	if err != nil {
+		return err
+	}
+
+	if d.VMID, err = client.NextID(); err != nil {
+		return err
+	}
+
+	log.Infof("Cloning Proxmox VE template %d as VM %d...", d.TemplateID, d.VMID)
+
+	if err := client.Clone(d.TemplateID, d.VMID, d.cloneForm()); err != nil {
+		d.VMID = 0
+		return err
+	}
+
+	if err := d.configure(client, strings.TrimSpace(string(publicKey))); err != nil {
+		return d.removeAfter(err)
+	}
+
+	if err := client.Status(d.VMID, "start"); err != nil {
+		return d.removeAfter(err)
+	}
+
+	log.Info("Waiting for the guest agent to report the IP address...")
+	for {
+		interfaces, err := client.Interfaces(d.VMID)
+		if err == nil {
+			if d.IPAddress = guestIP(interfaces); d.IPAddress != "" {
+				break
+			}
+		} else if isNotFound(err) {
+			return d.removeAfter(err)
+		}
+
+		time.Sleep(5 * time.Second)
+	}
+
+	log.Debugf("Created Proxmox VE VM %d, IP address %s", d.VMID, d.IPAddress)
+
+	return nil
+}
+
+// configure sizes the clone, attaches it to the bridge and has cloud-init
+// authorize the key, on a cloud-init drive added unless the template has
+// one. With the machine user-data, the drive is the seed ISO of the user
+// data instead.
+func (d *Driver) configure(client *Client, publicKey string) error {
+	config, err := client.GetConfig(d.VMID)
+	if err != nil {
+		return err
+	}
+
+	var seedISO string
+	if d.MachineUserDataFile != "" {
+		if seedISO, err = d.uploadSeedISO(client, publicKey); err != nil {
+			return err
+		}
+	}
+
+	if err := client.SetConfig(d.VMID, d.configForm(config, publicKey, seedISO)); err != nil {
+		return err
+	}
+
+	if d.DiskSize > 0 {
+		return client.ResizeDisk(d.VMID, d.Disk, fmt.Sprintf("%dG", d.DiskSize))
+	}
+	return nil
+}
+
+// cloneForm returns the parameters of the clone of the template.
+func (d *Driver) cloneForm() url.Values {
+	clone := url.Values{"name": {d.MachineName}}
+	if d.FullClone {
+		clone.Set("full", "1")
+		if d.Storage != "" {
+			clone.Set("storage", d.Storage)
+		}
+	} else {
+		clone.Set("full", "0")
+	}
+	if d.Pool != "" {
+		clone.Set("pool", d.Pool)
+	}
+	return clone
+}
+
+// uploadSeedISO uploads the NoCloud seed of the machine, whose user data,
+// the machine user-data, creates the SSH user, and returns its volume.
+func (d *Driver) uploadSeedISO(client *Client, publicKey string) (string, error) {
+	userData, err := driverutil.CloudConfigWithUser(d.BaseDriver, "", publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	iso := d.ResolveStorePath("seed.iso")
+	if err := driverutil.WriteSeedISO(iso, d.ResolveStorePath("cloudinit"), d.MachineName, userData); err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("vm-%d-cloudinit-seed.iso", d.VMID)
+	log.Infof("Uploading the cloud-init seed %s to storage %s...", name, d.ISOStorage)
+	if err := client.UploadISO(d.ISOStorage, name, iso); err != nil {
+		return "", err
+	}
+	d.SeedISO = d.ISOStorage + ":iso/" + name
+	return d.SeedISO, nil
+}
+
+// configForm returns the configuration of the clone, of the config, which
+// authorizes the key. Given the seed ISO, it replaces the cloud-init drive
+// of Proxmox VE, as cloud-init reads a single one.
+func (d *Driver) configForm(config map[string]interface{}, publicKey, seedISO string) url.Values {
+	net0 := "virtio,bridge=" + d.Bridge
+	if d.VLAN > 0 {
+		net0 += ",tag=" + strconv.Itoa(d.VLAN)
+	}
+	form := url.Values{
+		"cores":  {strconv.Itoa(d.Cores)},
+		"memory": {strconv.Itoa(d.Memory)},
+		"net0":   {net0},
+		"agent":  {"1"},
+	}
+
+	drive := cloudInitDrive(config)
+	if seedISO != "" {
+		if drive == "" {
+			drive = "ide2"
+		}
+		form.Set(drive, seedISO+",media=cdrom")
+		return form
+	}
+
+	form.Set("ciuser", d.SSHUser)
+	form.Set("ipconfig0", "ip=dhcp")
+	// The keys are decoded once more by the API.
+	form.Set("sshkeys", strings.ReplaceAll(url.QueryEscape(publicKey), "+", "%20"))
+	if drive == "" {
+		form.Set("ide2", d.CloudInitStorage+":cloudinit")
+	}
+	return form
+}
+
+// cloudInitDrive returns the drive of the cloud-init drive of the config,
+// if it has one.
+func cloudInitDrive(config map[string]interface{}) string {
+	for drive, value := range config {
+		if s, ok := value.(string); ok && strings.Contains(s, "cloudinit") {
+			return drive
+		}
+	}
+	return ""
+}
+
+// guestIP returns the first global IPv4 address the guest agent reports.
+func guestIP(interfaces []Interface) string {
+	for _, iface := range interfaces {
+		if iface.Name == "lo" {
+			continue
+		}
+		for _, addr := range iface.IPAddresses {
+			ip := net.ParseIP(addr.Address)
+			if addr.Type == "ipv4" && ip != nil && ip.IsGlobalUnicast() {
+				return addr.Address
+			}
+		}
+	}
+	return ""
+}
+
+func (d *Driver) removeAfter(err error) error {
+	if removeErr := d.Remove(); removeErr != nil {
+		return fmt.Errorf("failed to create machine due to error: %v. Removing VM: %v", err, removeErr)
+	}
+	return err
+}
+
+func (d *Driver) GetURL() (string, error) {
+	if err := drivers.MustBeRunning(d); err != nil {
+		return "", err
+	}
+
+	ip, err := d.GetIP()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("tcp://%s", net.JoinHostPort(ip, "2376")), nil
+}
+
+// GetIPs returns the addresses the guest agent reports.
+func (d *Driver) GetIPs() ([]drivers.NetworkAddress, error) {
+	interfaces, err := d.getClient().Interfaces(d.VMID)
+	if err != nil {
+		return nil, err
+	}
+
+	return guestAddresses(interfaces), nil
+}
+
+// guestAddresses returns the global addresses of the interfaces, private or
+// public as their range is.
+func guestAddresses(interfaces []Interface) []drivers.NetworkAddress {
+	var addrs []drivers.NetworkAddress
+	for _, iface := range interfaces {
+		if iface.Name == "lo" {
+			continue
+		}
+		for _, addr := range iface.IPAddresses {
+			ip := net.ParseIP(addr.Address)
+			if ip == nil || !ip.IsGlobalUnicast() {
+				continue
+			}
+			switch {
+			case addr.Type == "ipv6":
+				addrs = drivers.AppendAddress(addrs, drivers.AddressIPv6, addr.Address)
+			case ip.IsPrivate():
+				addrs = drivers.AppendAddress(addrs, drivers.AddressPrivate, addr.Address)
+			default:
+				addrs = drivers.AppendAddress(addrs, drivers.AddressPublic, addr.Address)
+			}
+		}
+	}
+
+	return addrs
+}
+
+func (d *Driver) GetState() (state.State, error) {
+	status, err := d.getClient().GetStatus(d.VMID)
+	if err != nil {
+		if !isNotFound(err) {
+			return state.Error, err
+		}
+		return state.None, fmt.Errorf("machine %v not found", d.MachineName)
+	}
+
+	return vmState(status), nil
+}
+
+// vmState returns the state of the VM of the status.
+func vmState(status *VMStatus) state.State {
+	switch status.Status {
+	case "running":
+		if status.QMPStatus == "paused" {
+			return state.Paused
+		}
+		return state.Running
+	case "stopped":
+		return state.Stopped
+	}
+	return state.None
+}
+
+func (d *Driver) Start() error {
+	return d.getClient().Status(d.VMID, "start")
+}
+
+// Stop shuts the VM down through ACPI or the guest agent.
+func (d *Driver) Stop() error {
+	return d.getClient().Status(d.VMID, "shutdown")
+}
+
+func (d *Driver) Restart() error {
+	return d.getClient().Status(d.VMID, "reboot")
+}
+
+func (d *Driver) Kill() error {
+	return d.getClient().Status(d.VMID, "stop")
+}
+
+// Remove powers the VM off and destroys it with its disks.
+func (d *Driver) Remove() error {
+	if d.VMID == 0 {
+		return nil
+	}
+
+	client := d.getClient()
+	status, err := client.GetStatus(d.VMID)
+	if err != nil {
+		if !isNotFound(err) {
+			return err
+		}
+		log.Infof("Proxmox VE VM doesn't exist, assuming it is already deleted")
+		return d.removeSeedISO(client)
+	}
+
+	if status.Status == "running" {
+		if err := client.Status(d.VMID, "stop"); err != nil {
+			return err
+		}
+	}
+	if err := client.Destroy(d.VMID); err != nil && !isNotFound(err) {
+		return err
+	}
+	return d.removeSeedISO(client)
+}
+
+// removeSeedISO deletes the uploaded cloud-init seed, if any.
+func (d *Driver) removeSeedISO(client *Client) error {
+	if d.SeedISO == "" {
+		return nil
+	}
+	if err := client.DeleteVolume(d.ISOStorage, d.SeedISO); err != nil && !isNotFound(err) {
+		return err
+	}
+	d.SeedISO = ""
+	return nil
+}
+
+func (d *Driver) getClient() *Client {
+	return NewClient(d.URL, d.Node, d.Username, d.Password, d.TokenID, d.TokenSecret, d.InsecureTLS)
+}
@@ -0,0 +1,185 @@
+package proxmox
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnmarshalJSON(t *testing.T) {
+	driver := NewDriver("", "")
+
+	// Unmarhsal driver configuration from JSON and args.
+	os.Args = append(os.Args, []string{"--proxmox-token-secret", "test token secret"}...)
+
+	driverBytes, err := json.Marshal(driver)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(driverBytes, driver))
+
+	// Make sure that config has been pulled in from envvars and args.
+	assert.Equal(t, "test token secret", driver.TokenSecret)
+}
+
+func TestSetConfigFromFlags(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"proxmox-url":          "https://pve:8006",
+			"proxmox-node":         "pve",
+			"proxmox-template-id":  9000,
+			"proxmox-token-id":     "machine",
+			"proxmox-token-secret": "SECRET",
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	err := driver.SetConfigFromFlags(checkFlags)
+
+	assert.NoError(t, err)
+	assert.Empty(t, checkFlags.InvalidFlags)
+	assert.True(t, driver.FullClone)
+	assert.Equal(t, 2, driver.Cores)
+	assert.Equal(t, 2048, driver.Memory)
+	assert.Equal(t, "vmbr0", driver.Bridge)
+	assert.Equal(t, "ubuntu", driver.GetSSHUsername())
+	assert.Equal(t, "local", driver.ISOStorage)
+	assert.Empty(t, driver.MachineUserDataFile)
+}
+
+func TestSetConfigFromFlagsInvalid(t *testing.T) {
+	for flags, expected := range map[string]map[string]interface{}{
+		"proxmox driver requires the --proxmox-token-id or --proxmox-password option": {},
+		"proxmox driver requires the --proxmox-token-secret option with --proxmox-token-id": {
+			"proxmox-token-id": "machine",
+		},
+		"proxmox linked clones use the storage of the template, --proxmox-storage cannot be given": {
+			"proxmox-password":     "PASSWORD",
+			"proxmox-linked-clone": true,
+			"proxmox-storage":      "ceph",
+		},
+		"proxmox VLAN tag must be between 1 and 4094, got 5000": {
+			"proxmox-password": "PASSWORD",
+			"proxmox-vlan":     5000,
+		},
+	} {
+		driver := NewDriver("default", "path")
+		values := map[string]interface{}{
+			"proxmox-url":         "https://pve:8006",
+			"proxmox-node":        "pve",
+			"proxmox-template-id": 9000,
+		}
+		for name, value := range expected {
+			values[name] = value
+		}
+		checkFlags := &drivers.CheckDriverOptions{FlagsValues: values, CreateFlags: driver.GetCreateFlags()}
+
+		assert.EqualError(t, driver.SetConfigFromFlags(checkFlags), flags)
+	}
+}
+
+// testInterfaces are the interfaces the guest agent reports.
+const testInterfaces = `[
+	{"name": "lo", "ip-addresses": [{"ip-address-type": "ipv4", "ip-address": "127.0.0.1"}]},
+	{"name": "eth0", "ip-addresses": [
+		{"ip-address-type": "ipv6", "ip-address": "fe80::1"},
+		{"ip-address-type": "ipv6", "ip-address": "2001:db8::5"},
+		{"ip-address-type": "ipv4", "ip-address": "192.168.1.5"}
+	]}
+]`
+
+func TestCloneForm(t *testing.T) {
+	driver := NewDriver("default", "path")
+	driver.Storage = "ceph"
+	assert.Equal(t, url.Values{"name": {"default"}, "full": {"1"}, "storage": {"ceph"}}, driver.cloneForm())
+
+	// Linked clones use the storage of the template.
+	driver.FullClone = false
+	driver.Pool = "machines"
+	assert.Equal(t, url.Values{"name": {"default"}, "full": {"0"}, "pool": {"machines"}}, driver.cloneForm())
+}
+
+func TestConfigForm(t *testing.T) {
+	driver := NewDriver("default", "path")
+	driver.VLAN = 10
+
+	// The clone already has a cloud-init drive.
+	config := map[string]interface{}{"scsi0": "local-lvm:vm-105-disk-0,size=8G", "ide2": "local-lvm:vm-105-cloudinit,media=cdrom"}
+	assert.Equal(t, url.Values{
+		"cores":     {"2"},
+		"memory":    {"2048"},
+		"net0":      {"virtio,bridge=vmbr0,tag=10"},
+		"agent":     {"1"},
+		"ciuser":    {"ubuntu"},
+		"ipconfig0": {"ip=dhcp"},
+		"sshkeys":   {"ssh-rsa%20AAAA%20user%40host"},
+	}, driver.configForm(config, "ssh-rsa AAAA user@host", ""))
+
+	form := driver.configForm(map[string]interface{}{"scsi0": "local-lvm:vm-105-disk-0,size=8G"}, "ssh-rsa AAAA", "")
+	assert.Equal(t, "local-lvm:cloudinit", form.Get("ide2"))
+}
+
+func TestConfigFormSeedISO(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	// The seed replaces the cloud-init drive of the clone.
+	config := map[string]interface{}{"scsi0": "local-lvm:vm-105-disk-0,size=8G", "ide0": "local-lvm:vm-105-cloudinit,media=cdrom"}
+	assert.Equal(t, url.Values{
+		"cores":  {"2"},
+		"memory": {"2048"},
+		"net0":   {"virtio,bridge=vmbr0"},
+		"agent":  {"1"},
+		"ide0":   {"local:iso/vm-105-cloudinit-seed.iso,media=cdrom"},
+	}, driver.configForm(config, "ssh-rsa AAAA", "local:iso/vm-105-cloudinit-seed.iso"))
+
+	form := driver.configForm(map[string]interface{}{"scsi0": "local-lvm:vm-105-disk-0,size=8G"}, "ssh-rsa AAAA", "local:iso/vm-105-cloudinit-seed.iso")
+	assert.Equal(t, "local:iso/vm-105-cloudinit-seed.iso,media=cdrom", form.Get("ide2"))
+}
+
+func TestCloudInitDrive(t *testing.T) {
+	assert.Equal(t, "ide2", cloudInitDrive(map[string]interface{}{"ide2": "local-lvm:vm-105-cloudinit,media=cdrom", "cores": 2.0}))
+	assert.Empty(t, cloudInitDrive(map[string]interface{}{"ide2": "none,media=cdrom"}))
+}
+
+func TestGuestIP(t *testing.T) {
+	var interfaces []Interface
+	assert.NoError(t, json.Unmarshal([]byte(testInterfaces), &interfaces))
+	assert.Equal(t, "192.168.1.5", guestIP(interfaces))
+
+	assert.Empty(t, guestIP(interfaces[:1]))
+}
+
+func TestVMState(t *testing.T) {
+	for status, expected := range map[VMStatus]state.State{
+		{Status: "running", QMPStatus: "running"}: state.Running,
+		{Status: "running", QMPStatus: "paused"}:  state.Paused,
+		{Status: "stopped", QMPStatus: "stopped"}: state.Stopped,
+		{Status: "unknown"}:                       state.None,
+	} {
+		assert.Equal(t, expected, vmState(&status), status.QMPStatus)
+	}
+}
+
+func TestGuestAddresses(t *testing.T) {
+	var interfaces []Interface
+	assert.NoError(t, json.Unmarshal([]byte(testInterfaces), &interfaces))
+
+	assert.Equal(t, []drivers.NetworkAddress{
+		{Kind: drivers.AddressIPv6, Address: "2001:db8::5"},
+		{Kind: drivers.AddressPrivate, Address: "192.168.1.5"},
+	}, guestAddresses(interfaces))
+}
+
+func TestIsNotFound(t *testing.T) {
+	assert.True(t, isNotFound(&APIError{StatusCode: http.StatusNotFound}))
+	assert.True(t, isNotFound(&APIError{StatusCode: http.StatusInternalServerError, Message: "Configuration file 'nodes/pve/qemu-server/106.conf' does not exist"}))
+	assert.False(t, isNotFound(&APIError{StatusCode: http.StatusUnauthorized, Message: "Unauthorized"}))
+	assert.False(t, isNotFound(errors.New("proxmox: timeout")))
+}
@@ -0,0 +1,16 @@
+package qemu
+
+import (
+	"github.com/rancher/machine/drivers/driverutil"
+)
+
+// createSeedISO writes the NoCloud seed of the machine, whose user data,
+// the cloud-config or else the machine user-data, creates the SSH user.
+func (d *Driver) createSeedISO(publicKey string) error {
+	userData, err := driverutil.CloudConfigWithUser(d.BaseDriver, d.CloudConfig, publicKey)
+	if err != nil {
+		return err
+	}
+
+	return driverutil.WriteSeedISO(d.ResolveStorePath(seedISO), d.ResolveStorePath("cloudinit"), d.MachineName, userData)
+}
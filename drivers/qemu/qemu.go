@@ -0,0 +1,409 @@
+package qemu
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/rancher/machine/drivers/driverutil"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/rancher/machine/libmachine/ssh"
+	"github.com/rancher/machine/libmachine/state"
+)
+
+const (
+	defaultCPU      = 1
+	defaultMemory   = 1024
+	defaultDiskSize = 20000
+	defaultSSHUser  = "docker"
+
+	diskImage = "disk.qcow2"
+	seedISO   = "seed.iso"
+	pidFile   = "qemu.pid"
+)
+
+// lookPath finds the commands, replaced by the tests.
+var lookPath = exec.LookPath
+
+// run runs the command, replaced by the tests.
+var run = func(name string, args ...string) error {
+	log.Debugf("COMMAND: %v %v", name, strings.Join(args, " "))
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		if ee, ok := err.(*exec.Error); ok && ee.Err == exec.ErrNotFound {
+			return fmt.Errorf("%s not found. Make sure QEMU is installed and %s is in the path", name, name)
+		}
+		return fmt.Errorf("%s failed: %v: %s", name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+type Driver struct {
+	*drivers.BaseDriver
+	BaseImage   string
+	Binary      string
+	Machine     string
+	Accelerator string
+	Firmware    string
+	CPU         int
+	Memory      int
+	DiskSize    int
+	DockerPort  int
+	MonitorPort int
+	CloudConfig string
+}
+
+// NewDriver creates a new QEMU driver with default settings.
+func NewDriver(hostName, storePath string) *Driver {
+	binary, machine := defaultMachine()
+	return &Driver{
+		Binary:      binary,
+		Machine:     machine,
+		Accelerator: defaultAccelerator(),
+		CPU:         defaultCPU,
+		Memory:      defaultMemory,
+		DiskSize:    defaultDiskSize,
+		BaseDriver: &drivers.BaseDriver{
+			MachineName: hostName,
+			StorePath:   storePath,
+			SSHUser:     defaultSSHUser,
+		},
+	}
+}
+
+// defaultMachine returns the emulator and machine type of the host
+// architecture.
+func defaultMachine() (string, string) {
+	if runtime.GOARCH == "arm64" {
+		return "qemu-system-aarch64", "virt"
+	}
+	return "qemu-system-x86_64", "q35"
+}
+
+// defaultAccelerator returns the accelerators of the host OS, falling back
+// to emulation.
+func defaultAccelerator() string {
+	switch runtime.GOOS {
+	case "linux":
+		return "kvm:tcg"
+	case "darwin":
+		return "hvf:tcg"
+	case "windows":
+		return "whpx:tcg"
+	}
+	return "tcg"
+}
+
+// Capabilities returns the optional operations supported by the driver.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityStartStop,
+		drivers.CapabilityRestart,
+		drivers.CapabilityKill,
+		drivers.CapabilityCustomSSHPort,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+	}
+}
+
+// GetCreateFlags registers the flags this driver adds to
+// "docker hosts create"
+func (d *Driver) GetCreateFlags() []mcnflag.Flag {
+	binary, machine := defaultMachine()
+	return []mcnflag.Flag{
+		mcnflag.StringFlag{
+			Name:   "qemu-base-image",
+			Usage:  "path of the qcow2 cloud image the disk of the machine is backed by",
+			EnvVar: "QEMU_BASE_IMAGE",
+		},
+		mcnflag.StringFlag{
+			Name:   "qemu-binary",
+			Usage:  "QEMU system emulator to run",
+			Value:  binary,
+			EnvVar: "QEMU_BINARY",
+		},
+		mcnflag.StringFlag{
+			Name:   "qemu-machine",
+			Usage:  "QEMU machine type",
+			Value:  machine,
+			EnvVar: "QEMU_MACHINE",
+		},
+		mcnflag.StringFlag{
+			Name:   "qemu-accelerator",
+			Usage:  "QEMU accelerators to try in order, separated by colons",
+			Value:  defaultAccelerator(),
+			EnvVar: "QEMU_ACCELERATOR",
+		},
+		mcnflag.StringFlag{
+			Name:   "qemu-firmware",
+			Usage:  "path of the UEFI firmware to boot, required by the virt machine type",
+			EnvVar: "QEMU_FIRMWARE",
+		},
+		mcnflag.IntFlag{
+			Name:   "qemu-cpu-count",
+			Usage:  "number of CPUs for the machine",
+			Value:  defaultCPU,
+			EnvVar: "QEMU_CPU_COUNT",
+		},
+		mcnflag.IntFlag{
+			Name:   "qemu-memory",
+			Usage:  "Size of memory for host in MB",
+			Value:  defaultMemory,
+			EnvVar: "QEMU_MEMORY_SIZE",
+		},
+		mcnflag.IntFlag{
+			Name:   "qemu-disk-size",
+			Usage:  "Size of disk for host in MB",
+			Value:  defaultDiskSize,
+			EnvVar: "QEMU_DISK_SIZE",
+		},
+		mcnflag.IntFlag{
+			Name:   "qemu-ssh-port",
+			Usage:  "local port forwarded to SSH (default a free one)",
+			EnvVar: "QEMU_SSH_PORT",
+		},
+		mcnflag.IntFlag{
+			Name:   "qemu-docker-port",
+			Usage:  "local port forwarded to the Docker daemon (default a free one)",
+			EnvVar: "QEMU_DOCKER_PORT",
+		},
+		mcnflag.StringFlag{
+			Name:   "qemu-cloud-config",
+			Usage:  "path of a cloud-config file to pass to cloud-init",
+			EnvVar: "QEMU_CLOUD_CONFIG",
+		},
+		mcnflag.StringFlag{
+			Name:   "qemu-ssh-user",
+			Usage:  "SSH username, created by cloud-init",
+			Value:  defaultSSHUser,
+			EnvVar: "QEMU_SSH_USER",
+		},
+	}
+}
+
+// GetSSHHostname returns the loopback address, SSH being forwarded to the
+// machine.
+func (d *Driver) GetSSHHostname() (string, error) {
+	return "127.0.0.1", nil
+}
+
+// DriverName returns the name of the driver
+func (d *Driver) DriverName() string {
+	return "qemu"
+}
+
+func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
+	d.BaseImage = flags.String("qemu-base-image")
+	d.Binary = flags.String("qemu-binary")
+	d.Machine = flags.String("qemu-machine")
+	d.Accelerator = flags.String("qemu-accelerator")
+	d.Firmware = flags.String("qemu-firmware")
+	d.CPU = flags.Int("qemu-cpu-count")
+	d.Memory = flags.Int("qemu-memory")
+	d.DiskSize = flags.Int("qemu-disk-size")
+	d.SSHPort = flags.Int("qemu-ssh-port")
+	d.DockerPort = flags.Int("qemu-docker-port")
+	d.CloudConfig = flags.String("qemu-cloud-config")
+	d.SSHUser = flags.String("qemu-ssh-user")
+
+	d.SetSwarmConfigFromFlags(flags)
+	if err := d.SetUserDataFromFlags(flags); err != nil {
+		return err
+	}
+
+	if d.BaseImage == "" {
+		return fmt.Errorf("qemu driver requires the --qemu-base-image option")
+	}
+	if d.CPU < 1 {
+		return fmt.Errorf("qemu CPU count must be positive, got %d", d.CPU)
+	}
+	if d.Machine == "virt" && d.Firmware == "" {
+		return fmt.Errorf("qemu virt machines require the --qemu-firmware option")
+	}
+
+	return nil
+}
+
+// PreCreateCheck checks the base image and firmware exist and QEMU can be
+// run.
+func (d *Driver) PreCreateCheck() error {
+	for _, path := range []string{d.BaseImage, d.Firmware} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("qemu: %s", err)
+		}
+	}
+	for _, name := range []string{d.Binary, "qemu-img"} {
+		if _, err := lookPath(name); err != nil {
+			return fmt.Errorf("%s not found. Make sure QEMU is installed and %s is in the path", name, name)
+		}
+	}
+	if _, err := driverutil.CloudConfigWithUser(d.BaseDriver, d.CloudConfig, ""); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (d *Driver) Create() error {
+	log.Infof("Creating SSH key...")
+
+	d.SSHKeyPath = d.GetSSHKeyPath()
+	if err := ssh.GenerateSSHKey(d.SSHKeyPath); err != nil {
+		return err
+	}
+	publicKey, err := os.ReadFile(d.SSHKeyPath + ".pub")
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Creating cloud-init seed...")
+
+	if err := d.createSeedISO(strings.TrimSpace(string(publicKey))); err != nil {
+		return err
+	}
+
+	log.Infof("Creating disk image...")
+
+	baseImage, err := filepath.Abs(d.BaseImage)
+	if err != nil {
+		return err
+	}
+	if err := run("qemu-img", "create", "-f", "qcow2", "-F", "qcow2", "-b", baseImage,
+		d.ResolveStorePath(diskImage), fmt.Sprintf("%dM", d.DiskSize)); err != nil {
+		return err
+	}
+
+	for _, port := range []*int{&d.SSHPort, &d.DockerPort, &d.MonitorPort} {
+		if *port == 0 {
+			if *port, err = freePort(); err != nil {
+				return err
+			}
+		}
+	}
+	d.IPAddress = "127.0.0.1"
+
+	log.Infof("Starting QEMU...")
+	return d.Start()
+}
+
+// freePort returns a local port nothing listens on.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// qemuArgs returns the arguments running the machine in the background,
+// with its SSH and Docker ports forwarded from the loopback ports and its
+// monitor listening on another.
+func (d *Driver) qemuArgs() []string {
+	netdev := fmt.Sprintf("user,id=net0,hostfwd=tcp:127.0.0.1:%d-:22,hostfwd=tcp:127.0.0.1:%d-:2376", d.SSHPort, d.DockerPort)
+	args := []string{
+		"-name", d.MachineName,
+		"-machine", d.Machine + ",accel=" + d.Accelerator,
+		"-cpu", "max",
+		"-smp", strconv.Itoa(d.CPU),
+		"-m", strconv.Itoa(d.Memory),
+		"-drive", "file=" + d.ResolveStorePath(diskImage) + ",if=virtio,format=qcow2",
+		"-drive", "file=" + d.ResolveStorePath(seedISO) + ",if=virtio,format=raw,readonly=on",
+		"-netdev", netdev,
+		"-device", "virtio-net-pci,netdev=net0",
+		"-device", "virtio-rng-pci",
+		"-qmp", fmt.Sprintf("tcp:127.0.0.1:%d,server=on,wait=off", d.MonitorPort),
+		"-serial", "file:" + d.ResolveStorePath("console.log"),
+		"-display", "none",
+		"-pidfile", d.ResolveStorePath(pidFile),
+		"-daemonize",
+	}
+	if d.Firmware != "" {
+		args = append(args, "-bios", d.Firmware)
+	}
+	return args
+}
+
+func (d *Driver) monitorAddress() string {
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(d.MonitorPort))
+}
+
+func (d *Driver) GetURL() (string, error) {
+	if err := drivers.MustBeRunning(d); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("tcp://%s", net.JoinHostPort("127.0.0.1", strconv.Itoa(d.DockerPort))), nil
+}
+
+// GetState asks the monitor whether the machine runs; the monitor only
+// listens while QEMU does.
+func (d *Driver) GetState() (state.State, error) {
+	var status struct {
+		Status string `json:"status"`
+	}
+	if err := qmpCommand(d.monitorAddress(), "query-status", &status); err != nil {
+		if err == errNotRunning {
+			return state.Stopped, nil
+		}
+		return state.Error, err
+	}
+
+	switch status.Status {
+	case "running":
+		return state.Running, nil
+	case "paused", "suspended":
+		return state.Paused, nil
+	case "shutdown":
+		return state.Stopping, nil
+	case "internal-error", "guest-panicked":
+		return state.Error, nil
+	}
+	return state.None, nil
+}
+
+func (d *Driver) Start() error {
+	return run(d.Binary, d.qemuArgs()...)
+}
+
+// Stop powers the machine down through ACPI.
+func (d *Driver) Stop() error {
+	return qmpCommand(d.monitorAddress(), "system_powerdown", nil)
+}
+
+// Restart resets the machine.
+func (d *Driver) Restart() error {
+	return qmpCommand(d.monitorAddress(), "system_reset", nil)
+}
+
+// Kill makes QEMU exit at once.
+func (d *Driver) Kill() error {
+	err := qmpCommand(d.monitorAddress(), "quit", nil)
+	// QEMU may exit before answering.
+	if errors.Is(err, errNotRunning) {
+		return nil
+	}
+	return err
+}
+
+// Remove kills QEMU, the images being deleted with the machine directory.
+func (d *Driver) Remove() error {
+	s, err := d.GetState()
+	if err != nil {
+		return err
+	}
+	if s == state.Stopped {
+		return nil
+	}
+	return d.Kill()
+}
@@ -0,0 +1,223 @@
+package qemu
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rancher/machine/drivers/driverutil"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeMonitor answers the QMP commands with the status, recording them.
+type fakeMonitor struct {
+	port     int
+	status   string
+	commands chan string
+}
+
+func newFakeMonitor(t *testing.T, status string) *fakeMonitor {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	monitor := &fakeMonitor{port: l.Addr().(*net.TCPAddr).Port, status: status, commands: make(chan string, 10)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go monitor.serve(conn)
+		}
+	}()
+	return monitor
+}
+
+func (m *fakeMonitor) serve(conn net.Conn) {
+	defer conn.Close()
+	fmt.Fprintln(conn, `{"QMP": {"version": {"qemu": {"major": 8}}, "capabilities": []}}`)
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var command struct {
+			Execute string `json:"execute"`
+		}
+		json.Unmarshal(scanner.Bytes(), &command)
+		switch command.Execute {
+		case "qmp_capabilities":
+		case "query-status":
+			fmt.Fprintln(conn, `{"event": "RTC_CHANGE", "data": {"offset": 0}}`)
+			fmt.Fprintf(conn, `{"return": {"status": %q, "running": true}}`+"\n", m.status)
+			continue
+		case "quit":
+			m.commands <- command.Execute
+			// QEMU exits without answering.
+			return
+		default:
+			m.commands <- command.Execute
+		}
+		fmt.Fprintln(conn, `{"return": {}}`)
+	}
+}
+
+// stubRun records the commands run instead of running them, writing the
+// seed ISO, and finds the commands given.
+func stubRun(t *testing.T, commandsFound ...string) *[]string {
+	var commands []string
+	origRun, origLookPath, origMakeISO := run, lookPath, driverutil.MakeISO
+	run = func(name string, args ...string) error {
+		commands = append(commands, name+" "+strings.Join(args, " "))
+		return nil
+	}
+	driverutil.MakeISO = func(iso, label, dir string) error {
+		commands = append(commands, fmt.Sprintf("makeISO %s %s %s", label, iso, dir))
+		return os.WriteFile(iso, []byte("ISO"), 0600)
+	}
+	lookPath = func(name string) (string, error) {
+		for _, found := range commandsFound {
+			if name == found {
+				return "/usr/bin/" + name, nil
+			}
+		}
+		return "", exec.ErrNotFound
+	}
+	t.Cleanup(func() { run, lookPath, driverutil.MakeISO = origRun, origLookPath, origMakeISO })
+	return &commands
+}
+
+func TestSetConfigFromFlags(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"qemu-base-image": "jammy.qcow2",
+			"qemu-binary":     "qemu-system-x86_64",
+			"qemu-machine":    "q35",
+			"qemu-ssh-port":   2222,
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	err := driver.SetConfigFromFlags(checkFlags)
+
+	assert.NoError(t, err)
+	assert.Empty(t, checkFlags.InvalidFlags)
+	assert.Equal(t, 1024, driver.Memory)
+	assert.Equal(t, "docker", driver.GetSSHUsername())
+
+	sshPort, err := driver.GetSSHPort()
+	assert.NoError(t, err)
+	assert.Equal(t, 2222, sshPort)
+	host, err := driver.GetSSHHostname()
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", host)
+}
+
+func TestSetConfigFromFlagsVirtWithoutFirmware(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"qemu-base-image": "jammy.qcow2",
+			"qemu-binary":     "qemu-system-aarch64",
+			"qemu-machine":    "virt",
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	assert.EqualError(t, driver.SetConfigFromFlags(checkFlags), "qemu virt machines require the --qemu-firmware option")
+}
+
+func TestCreate(t *testing.T) {
+	commands := stubRun(t)
+
+	storePath := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(storePath, "machines", "default"), 0700))
+
+	driver := NewDriver("default", storePath)
+	driver.BaseImage = "/images/jammy.qcow2"
+	driver.Binary = "qemu-system-x86_64"
+	driver.Machine = "q35"
+	driver.Accelerator = "kvm:tcg"
+	driver.SSHPort = 2222
+
+	assert.NoError(t, driver.Create())
+	assert.Equal(t, 2222, driver.SSHPort)
+	assert.NotZero(t, driver.DockerPort)
+	assert.NotZero(t, driver.MonitorPort)
+	assert.Equal(t, "127.0.0.1", driver.IPAddress)
+
+	dir := filepath.Join(storePath, "machines", "default")
+	assert.Len(t, *commands, 3)
+	assert.Equal(t, "makeISO cidata "+filepath.Join(dir, "seed.iso")+" "+filepath.Join(dir, "cloudinit"), (*commands)[0])
+	assert.Equal(t, "qemu-img create -f qcow2 -F qcow2 -b /images/jammy.qcow2 "+filepath.Join(dir, "disk.qcow2")+" 20000M", (*commands)[1])
+	assert.Contains(t, (*commands)[2], fmt.Sprintf("-netdev user,id=net0,hostfwd=tcp:127.0.0.1:2222-:22,hostfwd=tcp:127.0.0.1:%d-:2376 ", driver.DockerPort))
+	assert.Contains(t, (*commands)[2], "-machine q35,accel=kvm:tcg ")
+	assert.True(t, strings.HasSuffix((*commands)[2], " -daemonize"))
+
+	userData, err := os.ReadFile(filepath.Join(dir, "cloudinit", "user-data"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(userData), "name: docker")
+	assert.Contains(t, string(userData), "- ssh-rsa ")
+}
+
+func TestPreCreateCheck(t *testing.T) {
+	stubRun(t, "qemu-system-x86_64")
+
+	baseImage := filepath.Join(t.TempDir(), "jammy.qcow2")
+	assert.NoError(t, os.WriteFile(baseImage, []byte("QFI\xfb"), 0600))
+
+	driver := NewDriver("default", "path")
+	driver.BaseImage = baseImage
+	driver.Binary = "qemu-system-x86_64"
+	assert.EqualError(t, driver.PreCreateCheck(), "qemu-img not found. Make sure QEMU is installed and qemu-img is in the path")
+
+	driver.Firmware = baseImage + ".fd"
+	assert.ErrorContains(t, driver.PreCreateCheck(), "qemu: stat "+baseImage+".fd: ")
+}
+
+func TestGetState(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	for status, expected := range map[string]state.State{
+		"running":        state.Running,
+		"paused":         state.Paused,
+		"shutdown":       state.Stopping,
+		"guest-panicked": state.Error,
+		"prelaunch":      state.None,
+	} {
+		driver.MonitorPort = newFakeMonitor(t, status).port
+
+		s, err := driver.GetState()
+		assert.NoError(t, err)
+		assert.Equal(t, expected, s, status)
+	}
+
+	// The monitor stops listening once QEMU exits.
+	port, err := freePort()
+	assert.NoError(t, err)
+	driver.MonitorPort = port
+	s, err := driver.GetState()
+	assert.NoError(t, err)
+	assert.Equal(t, state.Stopped, s)
+}
+
+func TestStopKill(t *testing.T) {
+	monitor := newFakeMonitor(t, "running")
+	driver := NewDriver("default", "path")
+	driver.MonitorPort = monitor.port
+
+	assert.NoError(t, driver.Stop())
+	assert.Equal(t, "system_powerdown", <-monitor.commands)
+
+	assert.NoError(t, driver.Remove())
+	assert.Equal(t, "quit", <-monitor.commands)
+}
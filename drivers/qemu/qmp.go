@@ -0,0 +1,74 @@
+package qemu
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// errNotRunning is returned when the monitor does not listen, QEMU having
+// exited.
+var errNotRunning = errors.New("qemu is not running")
+
+// qmpCommand runs the command on the QEMU monitor listening at the
+// address, and decodes its return into the reply, if any.
+func qmpCommand(address, command string, reply interface{}) error {
+	conn, err := net.DialTimeout("tcp", address, 5*time.Second)
+	if err != nil {
+		return errNotRunning
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	scanner := bufio.NewScanner(conn)
+	// The monitor greets with its version before taking commands.
+	if _, err := qmpReceive(scanner); err != nil {
+		return err
+	}
+
+	for _, execute := range []string{"qmp_capabilities", command} {
+		if err := json.NewEncoder(conn).Encode(map[string]string{"execute": execute}); err != nil {
+			return err
+		}
+		ret, err := qmpReceive(scanner)
+		if err != nil {
+			return fmt.Errorf("qemu monitor %s: %w", execute, err)
+		}
+		if execute == command && reply != nil {
+			return json.Unmarshal(ret, reply)
+		}
+	}
+	return nil
+}
+
+// qmpReceive returns the next return or greeting of the monitor, skipping
+// the events.
+func qmpReceive(scanner *bufio.Scanner) (json.RawMessage, error) {
+	for scanner.Scan() {
+		var message struct {
+			QMP    json.RawMessage `json:"QMP"`
+			Return json.RawMessage `json:"return"`
+			Error  *struct {
+				Desc string `json:"desc"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			return nil, err
+		}
+		switch {
+		case message.Error != nil:
+			return nil, fmt.Errorf("%s", message.Error.Desc)
+		case message.QMP != nil:
+			return message.QMP, nil
+		case message.Return != nil:
+			return message.Return, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errNotRunning
+}
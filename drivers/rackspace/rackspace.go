@@ -40,10 +40,11 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Value:  "",
 		},
 		mcnflag.StringFlag{
-			EnvVar: "OS_API_KEY",
-			Name:   "rackspace-api-key",
-			Usage:  "Rackspace API key",
-			Value:  "",
+			EnvVar:    "OS_API_KEY",
+			Name:      "rackspace-api-key",
+			Usage:     "Rackspace API key",
+			Value:     "",
+			Sensitive: true,
 		},
 		mcnflag.StringFlag{
 			EnvVar: "OS_REGION_NAME",
@@ -142,7 +143,10 @@ func (d *Driver) UnmarshalJSON(data []byte) error {
 	*d = Driver(target)
 
 	// Make sure to reload values that are subject to change from envvars and os.Args.
-	driverOpts := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	driverOpts, err := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	if err != nil {
+		return err
+	}
 	if _, ok := driverOpts.Values["rackspace-username"]; ok {
 		d.Username = driverOpts.String("rackspace-username")
 	}
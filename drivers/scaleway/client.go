@@ -0,0 +1,224 @@
+package scaleway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/rancher/machine/libmachine/version"
+)
+
+// apiEndpoint is the Scaleway API, replaced by the tests.
+var apiEndpoint = "https://api.scaleway.com"
+
+// Client makes the calls to the Scaleway Instance API the driver needs, in
+// a zone.
+type Client struct {
+	secretKey  string
+	zone       string
+	endpoint   string
+	httpClient *http.Client
+}
+
+func NewClient(secretKey, zone string) *Client {
+	return &Client{
+		secretKey:  secretKey,
+		zone:       zone,
+		endpoint:   apiEndpoint,
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// APIError is an error answered by the Scaleway API.
+type APIError struct {
+	StatusCode int
+	Type       string `json:"type"`
+	Message    string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("scaleway: %s (%s)", e.Message, e.Type)
+}
+
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+type ServerIP struct {
+	Address string `json:"address"`
+	Family  string `json:"family"`
+}
+
+type Server struct {
+	ID        string                  `json:"id"`
+	Name      string                  `json:"name"`
+	State     string                  `json:"state"`
+	PublicIPs []ServerIP              `json:"public_ips"`
+	PrivateIP string                  `json:"private_ip"`
+	Volumes   map[string]ServerVolume `json:"volumes"`
+}
+
+type ServerVolume struct {
+	ID string `json:"id"`
+}
+
+// PublicIP returns the public address of the server in the family, "inet"
+// or "inet6", if it has one yet.
+func (s *Server) PublicIP(family string) string {
+	for _, ip := range s.PublicIPs {
+		if ip.Family == family {
+			return ip.Address
+		}
+	}
+	return ""
+}
+
+type Volume struct {
+	Name       string `json:"name"`
+	Size       int64  `json:"size"`
+	VolumeType string `json:"volume_type"`
+}
+
+type ServerCreateRequest struct {
+	Name              string            `json:"name"`
+	CommercialType    string            `json:"commercial_type"`
+	Image             string            `json:"image"`
+	Project           string            `json:"project"`
+	Tags              []string          `json:"tags,omitempty"`
+	SecurityGroup     string            `json:"security_group,omitempty"`
+	Volumes           map[string]Volume `json:"volumes,omitempty"`
+	DynamicIPRequired bool              `json:"dynamic_ip_required"`
+	EnableIPv6        bool              `json:"enable_ipv6,omitempty"`
+}
+
+type LocalImage struct {
+	ID                        string   `json:"id"`
+	Label                     string   `json:"label"`
+	CompatibleCommercialTypes []string `json:"compatible_commercial_types"`
+}
+
+func (c *Client) do(method, path string, body, reply interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.endpoint+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Auth-Token", c.secretKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("docker-machine/v%d", version.APIVersion))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 400 {
+		apiErr := &APIError{}
+		if err := json.Unmarshal(data, apiErr); err != nil || apiErr.Message == "" {
+			apiErr.Type = "unknown"
+			apiErr.Message = resp.Status
+		}
+		apiErr.StatusCode = resp.StatusCode
+		return apiErr
+	}
+
+	if reply == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, reply)
+}
+
+func (c *Client) instancePath(path string) string {
+	return "/instance/v1/zones/" + c.zone + path
+}
+
+// ServerTypeExists fails if the commercial type cannot be deployed in the
+// zone.
+func (c *Client) ServerTypeExists(commercialType string) error {
+	var reply struct {
+		Servers map[string]json.RawMessage `json:"servers"`
+	}
+	if err := c.do(http.MethodGet, c.instancePath("/products/servers?per_page=100"), nil, &reply); err != nil {
+		return err
+	}
+	if _, ok := reply.Servers[commercialType]; !ok {
+		return fmt.Errorf("scaleway: no instance type %s in zone %s", commercialType, c.zone)
+	}
+	return nil
+}
+
+// FindImage returns the ID of the image with the label, e.g.
+// "ubuntu_jammy", for the commercial type in the zone.
+func (c *Client) FindImage(label, commercialType string) (string, error) {
+	var reply struct {
+		LocalImages []LocalImage `json:"local_images"`
+	}
+	query := url.Values{"image_label": {label}, "zone": {c.zone}, "type": {"instance_local"}}
+	if err := c.do(http.MethodGet, "/marketplace/v2/local-images?"+query.Encode(), nil, &reply); err != nil {
+		return "", err
+	}
+	for _, image := range reply.LocalImages {
+		for _, compatible := range image.CompatibleCommercialTypes {
+			if compatible == commercialType {
+				return image.ID, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("scaleway: no image %s for instance type %s in zone %s", label, commercialType, c.zone)
+}
+
+func (c *Client) GetSecurityGroup(id string) error {
+	return c.do(http.MethodGet, c.instancePath("/security_groups/"+id), nil, nil)
+}
+
+func (c *Client) CreateServer(request *ServerCreateRequest) (*Server, error) {
+	var reply struct {
+		Server Server `json:"server"`
+	}
+	if err := c.do(http.MethodPost, c.instancePath("/servers"), request, &reply); err != nil {
+		return nil, err
+	}
+	return &reply.Server, nil
+}
+
+func (c *Client) GetServer(id string) (*Server, error) {
+	var reply struct {
+		Server Server `json:"server"`
+	}
+	if err := c.do(http.MethodGet, c.instancePath("/servers/"+id), nil, &reply); err != nil {
+		return nil, err
+	}
+	return &reply.Server, nil
+}
+
+func (c *Client) DeleteServer(id string) error {
+	return c.do(http.MethodDelete, c.instancePath("/servers/"+id), nil, nil)
+}
+
+func (c *Client) DeleteVolume(id string) error {
+	return c.do(http.MethodDelete, c.instancePath("/volumes/"+id), nil, nil)
+}
+
+// ServerAction runs an action, e.g. "poweron", on the server.
+func (c *Client) ServerAction(id, action string) error {
+	return c.do(http.MethodPost, c.instancePath("/servers/"+id+"/action"), map[string]string{"action": action}, nil)
+}
@@ -0,0 +1,468 @@
+package scaleway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	rpcdriver "github.com/rancher/machine/libmachine/drivers/rpc"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/rancher/machine/libmachine/ssh"
+	"github.com/rancher/machine/libmachine/state"
+)
+
+type Driver struct {
+	*drivers.BaseDriver
+	SecretKey        string
+	ProjectID        string
+	ServerID         string
+	Zone             string
+	InstanceType     string
+	Image            string
+	SecurityGroup    string
+	Volumes          []string
+	VolumeType       string
+	IPv6             bool
+	Tags             string
+	PrivateIPAddress string
+	IPv6Address      string
+}
+
+const (
+	defaultSSHPort      = 22
+	defaultSSHUser      = "root"
+	defaultImage        = "ubuntu_jammy"
+	defaultZone         = "fr-par-1"
+	defaultInstanceType = "DEV1-S"
+	defaultVolumeType   = "b_ssd"
+)
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// Capabilities returns the optional operations supported by the driver.
+// Scaleway instances cannot be forcibly powered off.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityStartStop,
+		drivers.CapabilityRestart,
+		drivers.CapabilityPrivateIP,
+		drivers.CapabilityCustomSSHPort,
+		drivers.CapabilityIPv6,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+	}
+}
+
+// GetCreateFlags registers the flags this driver adds to
+// "docker hosts create"
+func (d *Driver) GetCreateFlags() []mcnflag.Flag {
+	return []mcnflag.Flag{
+		mcnflag.StringFlag{
+			EnvVar:    "SCW_SECRET_KEY",
+			Name:      "scaleway-secret-key",
+			Usage:     "Scaleway API secret key",
+			Sensitive: true,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "SCW_DEFAULT_PROJECT_ID",
+			Name:   "scaleway-project-id",
+			Usage:  "Scaleway project to create the instance in",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "SCALEWAY_SSH_USER",
+			Name:   "scaleway-ssh-user",
+			Usage:  "SSH username",
+			Value:  defaultSSHUser,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "SCALEWAY_SSH_PORT",
+			Name:   "scaleway-ssh-port",
+			Usage:  "SSH port",
+			Value:  defaultSSHPort,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "SCW_DEFAULT_ZONE",
+			Name:   "scaleway-zone",
+			Usage:  "Scaleway zone",
+			Value:  defaultZone,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "SCALEWAY_INSTANCE_TYPE",
+			Name:   "scaleway-instance-type",
+			Usage:  "Scaleway instance type",
+			Value:  defaultInstanceType,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "SCALEWAY_IMAGE",
+			Name:   "scaleway-image",
+			Usage:  "Scaleway image label, e.g. ubuntu_jammy, or ID",
+			Value:  defaultImage,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "SCALEWAY_SECURITY_GROUP",
+			Name:   "scaleway-security-group",
+			Usage:  "ID of the security group of the instance (default the one of the project)",
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "SCALEWAY_VOLUMES",
+			Name:   "scaleway-volumes",
+			Usage:  "sizes in GB of the block volumes to attach to the instance",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "SCALEWAY_VOLUME_TYPE",
+			Name:   "scaleway-volume-type",
+			Usage:  "type of the block volumes to attach to the instance",
+			Value:  defaultVolumeType,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "SCALEWAY_IPV6",
+			Name:   "scaleway-ipv6",
+			Usage:  "enable IPv6 for the instance",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "SCALEWAY_TAGS",
+			Name:   "scaleway-tags",
+			Usage:  "comma-separated list of tags to apply to the instance",
+		},
+	}
+}
+
+func NewDriver(hostName, storePath string) *Driver {
+	return &Driver{
+		Image:        defaultImage,
+		InstanceType: defaultInstanceType,
+		Zone:         defaultZone,
+		VolumeType:   defaultVolumeType,
+		BaseDriver: &drivers.BaseDriver{
+			MachineName: hostName,
+			StorePath:   storePath,
+		},
+	}
+}
+
+func (d *Driver) GetSSHHostname() (string, error) {
+	return d.GetIP()
+}
+
+// DriverName returns the name of the driver
+func (d *Driver) DriverName() string {
+	return "scaleway"
+}
+
+// UnmarshalJSON loads driver config from JSON. This function is used by the RPCServerDriver that wraps
+// all drivers as a means of populating an already-initialized driver with new configuration.
+// See `RPCServerDriver.SetConfigRaw`.
+func (d *Driver) UnmarshalJSON(data []byte) error {
+	// Unmarshal driver config into an aliased type to prevent infinite recursion on UnmarshalJSON.
+	type targetDriver Driver
+
+	// Copy data from `d` to `target` before unmarshalling. This will ensure that already-initialized values
+	// from `d` that are left untouched during unmarshal (like functions) are preserved.
+	target := targetDriver(*d)
+
+	if err := json.Unmarshal(data, &target); err != nil {
+		return fmt.Errorf("error unmarshalling driver config from JSON: %w", err)
+	}
+
+	// Copy unmarshalled data back to `d`.
+	*d = Driver(target)
+
+	// Make sure to reload values that are subject to change from envvars and os.Args.
+	driverOpts, err := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	if err != nil {
+		return err
+	}
+	if _, ok := driverOpts.Values["scaleway-secret-key"]; ok {
+		d.SecretKey = driverOpts.String("scaleway-secret-key")
+	}
+
+	return nil
+}
+
+func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
+	d.SecretKey = flags.String("scaleway-secret-key")
+	d.ProjectID = flags.String("scaleway-project-id")
+	d.Zone = flags.String("scaleway-zone")
+	d.InstanceType = flags.String("scaleway-instance-type")
+	d.Image = flags.String("scaleway-image")
+	d.SecurityGroup = flags.String("scaleway-security-group")
+	d.Volumes = flags.StringSlice("scaleway-volumes")
+	d.VolumeType = flags.String("scaleway-volume-type")
+	d.IPv6 = flags.Bool("scaleway-ipv6")
+	d.Tags = flags.String("scaleway-tags")
+	d.SSHUser = flags.String("scaleway-ssh-user")
+	d.SSHPort = flags.Int("scaleway-ssh-port")
+
+	d.SetSwarmConfigFromFlags(flags)
+
+	if d.SecretKey == "" {
+		return fmt.Errorf("scaleway driver requires the --scaleway-secret-key option")
+	}
+	if d.ProjectID == "" {
+		return fmt.Errorf("scaleway driver requires the --scaleway-project-id option")
+	}
+	for _, size := range d.Volumes {
+		if n, err := strconv.Atoi(size); err != nil || n <= 0 {
+			return fmt.Errorf("scaleway volume size must be a number of GB, got %q", size)
+		}
+	}
+
+	return nil
+}
+
+func (d *Driver) PreCreateCheck() error {
+	client := d.getClient()
+	if err := client.ServerTypeExists(d.InstanceType); err != nil {
+		return err
+	}
+	if _, err := d.imageID(client); err != nil {
+		return err
+	}
+	if d.SecurityGroup != "" {
+		if err := client.GetSecurityGroup(d.SecurityGroup); err != nil {
+			if isNotFound(err) {
+				return fmt.Errorf("scaleway security group %s doesn't exist in zone %s", d.SecurityGroup, d.Zone)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// imageID returns the ID of the image, which is looked up in the
+// marketplace when given by label.
+func (d *Driver) imageID(client *Client) (string, error) {
+	if uuidRegexp.MatchString(d.Image) {
+		return d.Image, nil
+	}
+	return client.FindImage(d.Image, d.InstanceType)
+}
+
+func (d *Driver) Create() error {
+	client := d.getClient()
+
+	image, err := d.imageID(client)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Creating SSH key...")
+
+	d.SSHKeyPath = d.GetSSHKeyPath()
+	if err := ssh.GenerateSSHKey(d.SSHKeyPath); err != nil {
+		return err
+	}
+	publicKey, err := os.ReadFile(d.SSHKeyPath + ".pub")
+	if err != nil {
+		return err
+	}
+
+	createRequest := d.createRequest(image, strings.TrimSpace(string(publicKey)))
+
+	log.Infof("Creating Scaleway instance...")
+
+	server, err := client.CreateServer(createRequest)
+	if err != nil {
+		return err
+	}
+	d.ServerID = server.ID
+
+	// Instances are created stopped.
+	if err := client.ServerAction(d.ServerID, "poweron"); err != nil {
+		if removeErr := d.Remove(); removeErr != nil {
+			return fmt.Errorf("failed to create machine due to error: %v. Removing instance: %v", err, removeErr)
+		}
+		return err
+	}
+
+	// The public IP is only known once the instance is running, as no
+	// bootscript reserves it beforehand.
+	log.Info("Waiting for the instance to be running...")
+	for {
+		server, err = client.GetServer(d.ServerID)
+		if err != nil {
+			if removeErr := d.Remove(); removeErr != nil {
+				return fmt.Errorf("failed to create machine due to error: %v. Removing instance: %v", err, removeErr)
+			}
+			return err
+		}
+
+		d.IPAddress = server.PublicIP("inet")
+		d.IPv6Address = server.PublicIP("inet6")
+		d.PrivateIPAddress = server.PrivateIP
+		if d.IPAddress == "" && d.IPv6 {
+			d.IPAddress = d.IPv6Address
+		}
+
+		if server.State == "running" && d.IPAddress != "" {
+			break
+		}
+
+		time.Sleep(5 * time.Second)
+	}
+
+	log.Debugf("Created Scaleway instance ID %s, IP address %s, Private IP address %s",
+		server.ID,
+		d.IPAddress,
+		d.PrivateIPAddress)
+
+	return nil
+}
+
+// createRequest returns the request creating the instance of the image,
+// authorizing the public key.
+func (d *Driver) createRequest(image, publicKey string) *ServerCreateRequest {
+	createRequest := &ServerCreateRequest{
+		Name:              d.MachineName,
+		CommercialType:    d.InstanceType,
+		Image:             image,
+		Project:           d.ProjectID,
+		SecurityGroup:     d.SecurityGroup,
+		DynamicIPRequired: true,
+		EnableIPv6:        d.IPv6,
+		// The images authorize the keys given by tags, with their spaces
+		// replaced.
+		Tags: append(d.getTags(), "AUTHORIZED_KEY="+strings.ReplaceAll(publicKey, " ", "_")),
+	}
+	for i, size := range d.Volumes {
+		if createRequest.Volumes == nil {
+			createRequest.Volumes = map[string]Volume{}
+		}
+		gb, _ := strconv.Atoi(size)
+		createRequest.Volumes[strconv.Itoa(i+1)] = Volume{
+			Name:       fmt.Sprintf("%s-%d", d.MachineName, i+1),
+			Size:       int64(gb) * 1000 * 1000 * 1000,
+			VolumeType: d.VolumeType,
+		}
+	}
+
+	return createRequest
+}
+
+func (d *Driver) GetURL() (string, error) {
+	if err := drivers.MustBeRunning(d); err != nil {
+		return "", err
+	}
+
+	ip, err := d.GetIP()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("tcp://%s", net.JoinHostPort(ip, "2376")), nil
+}
+
+// GetIPs returns the public, private and IPv6 addresses of the instance.
+func (d *Driver) GetIPs() ([]drivers.NetworkAddress, error) {
+	server, err := d.getClient().GetServer(d.ServerID)
+	if err != nil {
+		return nil, err
+	}
+	return serverAddresses(server), nil
+}
+
+func serverAddresses(server *Server) []drivers.NetworkAddress {
+	var addrs []drivers.NetworkAddress
+	addrs = drivers.AppendAddress(addrs, drivers.AddressPublic, server.PublicIP("inet"))
+	addrs = drivers.AppendAddress(addrs, drivers.AddressPrivate, server.PrivateIP)
+	return drivers.AppendAddress(addrs, drivers.AddressIPv6, server.PublicIP("inet6"))
+}
+
+func (d *Driver) GetState() (state.State, error) {
+	server, err := d.getClient().GetServer(d.ServerID)
+	if err != nil {
+		if !isNotFound(err) {
+			return state.Error, err
+		}
+		return state.None, fmt.Errorf("machine %v not found", d.MachineName)
+	}
+	return serverState(server.State), nil
+}
+
+func serverState(status string) state.State {
+	switch status {
+	case "starting":
+		return state.Starting
+	case "running":
+		return state.Running
+	case "stopping":
+		return state.Stopping
+	case "stopped", "stopped in place":
+		return state.Stopped
+	}
+	return state.None
+}
+
+func (d *Driver) Start() error {
+	return d.getClient().ServerAction(d.ServerID, "poweron")
+}
+
+func (d *Driver) Stop() error {
+	return d.getClient().ServerAction(d.ServerID, "poweroff")
+}
+
+func (d *Driver) Restart() error {
+	return d.getClient().ServerAction(d.ServerID, "reboot")
+}
+
+// Kill powers the instance off, as it cannot be forcibly powered off.
+func (d *Driver) Kill() error {
+	return d.Stop()
+}
+
+// Remove terminates a running instance, which deletes its volumes too, and
+// deletes a stopped one and then its volumes.
+func (d *Driver) Remove() error {
+	if d.ServerID == "" {
+		return nil
+	}
+
+	client := d.getClient()
+	server, err := client.GetServer(d.ServerID)
+	if err != nil {
+		if !isNotFound(err) {
+			return err
+		}
+		log.Infof("Scaleway instance doesn't exist, assuming it is already deleted")
+		return nil
+	}
+
+	if server.State == "running" {
+		return client.ServerAction(d.ServerID, "terminate")
+	}
+
+	if err := client.DeleteServer(d.ServerID); err != nil && !isNotFound(err) {
+		return err
+	}
+	for _, volume := range server.Volumes {
+		if err := client.DeleteVolume(volume.ID); err != nil && !isNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Driver) getClient() *Client {
+	return NewClient(d.SecretKey, d.Zone)
+}
+
+func (d *Driver) getTags() []string {
+	var tagList []string
+
+	for _, t := range strings.Split(d.Tags, ",") {
+		t = strings.TrimSpace(t)
+		if t != "" {
+			tagList = append(tagList, t)
+		}
+	}
+
+	return tagList
+}
@@ -0,0 +1,130 @@
+package scaleway
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+const imageID = "a6ef2a49-b4b9-4a56-9bd1-a3b9b3b7c1d2"
+
+func TestUnmarshalJSON(t *testing.T) {
+	driver := NewDriver("", "")
+
+	// Unmarhsal driver configuration from JSON and args.
+	os.Args = append(os.Args, []string{"--scaleway-secret-key", "test secret key"}...)
+
+	driverBytes, err := json.Marshal(driver)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(driverBytes, driver))
+
+	// Make sure that config has been pulled in from envvars and args.
+	assert.Equal(t, "test secret key", driver.SecretKey)
+}
+
+func TestSetConfigFromFlags(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"scaleway-secret-key": "SECRET",
+			"scaleway-project-id": "project",
+			"scaleway-volumes":    []string{"50"},
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	err := driver.SetConfigFromFlags(checkFlags)
+
+	assert.NoError(t, err)
+	assert.Empty(t, checkFlags.InvalidFlags)
+	assert.Equal(t, "fr-par-1", driver.Zone)
+	assert.Equal(t, "DEV1-S", driver.InstanceType)
+	assert.Equal(t, "ubuntu_jammy", driver.Image)
+	assert.Equal(t, []string{"50"}, driver.Volumes)
+
+	sshPort, err := driver.GetSSHPort()
+	assert.NoError(t, err)
+	assert.Equal(t, "root", driver.GetSSHUsername())
+	assert.Equal(t, 22, sshPort)
+}
+
+func TestSetConfigFromFlagsInvalidVolume(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"scaleway-secret-key": "SECRET",
+			"scaleway-project-id": "project",
+			"scaleway-volumes":    []string{"50G"},
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	assert.EqualError(t, driver.SetConfigFromFlags(checkFlags), `scaleway volume size must be a number of GB, got "50G"`)
+}
+
+func TestCreateRequest(t *testing.T) {
+	driver := NewDriver("default", "path")
+	driver.ProjectID = "project"
+	driver.SecurityGroup = "sg-1"
+	driver.Volumes = []string{"50"}
+	driver.IPv6 = true
+	driver.Tags = "rancher, test"
+
+	assert.Equal(t, &ServerCreateRequest{
+		Name:           "default",
+		CommercialType: "DEV1-S",
+		Image:          imageID,
+		Project:        "project",
+		Tags:           []string{"rancher", "test", "AUTHORIZED_KEY=ssh-rsa_AAAA_user@host"},
+		SecurityGroup:  "sg-1",
+		Volumes: map[string]Volume{
+			"1": {Name: "default-1", Size: 50000000000, VolumeType: "b_ssd"},
+		},
+		DynamicIPRequired: true,
+		EnableIPv6:        true,
+	}, driver.createRequest(imageID, "ssh-rsa AAAA user@host"))
+}
+
+func TestImageID(t *testing.T) {
+	driver := NewDriver("default", "path")
+	driver.Image = imageID
+
+	// Image IDs are used as is, without looking them up.
+	image, err := driver.imageID(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, imageID, image)
+}
+
+func TestServerState(t *testing.T) {
+	for status, expected := range map[string]state.State{
+		"starting":         state.Starting,
+		"running":          state.Running,
+		"stopping":         state.Stopping,
+		"stopped":          state.Stopped,
+		"stopped in place": state.Stopped,
+		"locked":           state.None,
+	} {
+		assert.Equal(t, expected, serverState(status), status)
+	}
+}
+
+func TestServerAddresses(t *testing.T) {
+	var server Server
+	assert.NoError(t, json.Unmarshal([]byte(`{"id": "42", "public_ips": [{"address": "2001:db8::1", "family": "inet6"}, {"address": "1.2.3.4", "family": "inet"}], "private_ip": "10.1.2.3"}`), &server))
+
+	assert.Equal(t, "1.2.3.4", server.PublicIP("inet"))
+	assert.Equal(t, []drivers.NetworkAddress{
+		{Kind: drivers.AddressPublic, Address: "1.2.3.4"},
+		{Kind: drivers.AddressPrivate, Address: "10.1.2.3"},
+		{Kind: drivers.AddressIPv6, Address: "2001:db8::1"},
+	}, serverAddresses(&server))
+
+	// The public IP is only known once the instance is running.
+	assert.Empty(t, (&Server{}).PublicIP("inet"))
+}
@@ -82,6 +82,17 @@ func (d *Driver) GetSSHHostname() (string, error) {
 	return d.GetIP()
 }
 
+// Capabilities returns the optional operations supported by the driver.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityStartStop,
+		drivers.CapabilityRestart,
+		drivers.CapabilityKill,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+	}
+}
+
 func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 	// Set hourly billing to true by default since codegangsta cli doesn't take default bool values
 	if os.Getenv("SOFTLAYER_HOURLY_BILLING") == "" {
@@ -106,9 +117,10 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "softlayer user account name",
 		},
 		mcnflag.StringFlag{
-			EnvVar: "SOFTLAYER_API_KEY",
-			Name:   "softlayer-api-key",
-			Usage:  "softlayer user API key",
+			EnvVar:    "SOFTLAYER_API_KEY",
+			Name:      "softlayer-api-key",
+			Usage:     "softlayer user API key",
+			Sensitive: true,
 		},
 		mcnflag.StringFlag{
 			EnvVar: "SOFTLAYER_REGION",
@@ -238,7 +250,10 @@ func (d *Driver) UnmarshalJSON(data []byte) error {
 	*d = Driver(target)
 
 	// Make sure to reload values that are subject to change from envvars and os.Args.
-	driverOpts := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	driverOpts, err := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	if err != nil {
+		return err
+	}
 	if _, ok := driverOpts.Values["softlayer-api-endpoint"]; ok {
 		d.Client.Endpoint = driverOpts.String("softlayer-api-endpoint")
 	}
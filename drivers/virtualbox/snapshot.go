@@ -0,0 +1,88 @@
+package virtualbox
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/state"
+)
+
+var reSnapshotUUID = regexp.MustCompile(`UUID: (\S+)`)
+
+// CreateSnapshot takes a snapshot of the VM, which VirtualBox can take while
+// it runs.
+func (d *Driver) CreateSnapshot(name string) (drivers.Snapshot, error) {
+	out, err := d.vbmOut("snapshot", d.MachineName, "take", name)
+	if err != nil {
+		return drivers.Snapshot{}, err
+	}
+
+	res := reSnapshotUUID.FindStringSubmatch(out)
+	if res == nil {
+		return drivers.Snapshot{}, fmt.Errorf("unable to find the UUID of snapshot %s in %q", name, out)
+	}
+	return drivers.Snapshot{ID: res[1], Name: name}, nil
+}
+
+// ListSnapshots returns the snapshots of the tree of the VM, parents first.
+func (d *Driver) ListSnapshots() ([]drivers.Snapshot, error) {
+	stdout, stderr, err := d.vbmOutErr("snapshot", d.MachineName, "list", "--machinereadable")
+	if err != nil {
+		// VirtualBox fails listing the snapshots of a VM that has none.
+		if strings.Contains(stderr, "does not have any snapshots") {
+			return []drivers.Snapshot{}, nil
+		}
+		return nil, err
+	}
+	return parseSnapshots(stdout)
+}
+
+// parseSnapshots parses the snapshot list of VBoxManage, which names the
+// keys of each snapshot after its path in the tree, SnapshotName-1-2 for the
+// second child of the first child of the root snapshot.
+func parseSnapshots(out string) ([]drivers.Snapshot, error) {
+	snapshots := []drivers.Snapshot{}
+	paths := map[string]int{}
+
+	snapshot := func(path string) *drivers.Snapshot {
+		i, ok := paths[path]
+		if !ok {
+			i = len(snapshots)
+			paths[path] = i
+			snapshots = append(snapshots, drivers.Snapshot{})
+		}
+		return &snapshots[i]
+	}
+
+	err := parseKeyValues(out, reEqualLine, func(key, val string) error {
+		val = strings.Trim(val, `"`)
+		switch {
+		case strings.HasPrefix(key, "SnapshotName"):
+			snapshot(strings.TrimPrefix(key, "SnapshotName")).Name = val
+		case strings.HasPrefix(key, "SnapshotUUID"):
+			snapshot(strings.TrimPrefix(key, "SnapshotUUID")).ID = val
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshots, nil
+}
+
+// RestoreSnapshot restores the VM from the snapshot of the UUID. VirtualBox
+// only restores the snapshots of a stopped VM.
+func (d *Driver) RestoreSnapshot(id string) error {
+	s, err := d.GetState()
+	if err != nil {
+		return err
+	}
+	if s != state.Stopped {
+		return fmt.Errorf("%s must be stopped to restore a snapshot, it is %s", d.MachineName, s)
+	}
+
+	return d.vbm("snapshot", d.MachineName, "restore", id)
+}
@@ -0,0 +1,58 @@
+package virtualbox
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSnapshotList = `SnapshotName="base"
+SnapshotUUID="1b5ec4b5-42a0-4d37-b4ba-2b0fa6e0bf2c"
+SnapshotName-1="configured"
+SnapshotUUID-1="6e2e9d01-8ba3-4aab-96df-55901fc6cf9a"
+SnapshotName-1-1="upgraded"
+SnapshotUUID-1-1="0d210d61-3bd9-4bd4-a0fc-7a4ebfe1c0a1"
+CurrentSnapshotName="upgraded"
+CurrentSnapshotUUID="0d210d61-3bd9-4bd4-a0fc-7a4ebfe1c0a1"
+CurrentSnapshotNode="SnapshotName-1-1"
+`
+
+func TestParseSnapshots(t *testing.T) {
+	snapshots, err := parseSnapshots(testSnapshotList)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []drivers.Snapshot{
+		{ID: "1b5ec4b5-42a0-4d37-b4ba-2b0fa6e0bf2c", Name: "base"},
+		{ID: "6e2e9d01-8ba3-4aab-96df-55901fc6cf9a", Name: "configured"},
+		{ID: "0d210d61-3bd9-4bd4-a0fc-7a4ebfe1c0a1", Name: "upgraded"},
+	}, snapshots)
+}
+
+func TestCreateSnapshot(t *testing.T) {
+	driver := newTestDriver("default")
+	driver.VBoxManager = &VBoxManagerMock{
+		args:   "snapshot default take base",
+		stdOut: "0%...10%...100%\nSnapshot taken. UUID: 1b5ec4b5-42a0-4d37-b4ba-2b0fa6e0bf2c\n",
+	}
+
+	snapshot, err := driver.CreateSnapshot("base")
+
+	assert.NoError(t, err)
+	assert.Equal(t, drivers.Snapshot{ID: "1b5ec4b5-42a0-4d37-b4ba-2b0fa6e0bf2c", Name: "base"}, snapshot)
+}
+
+func TestListSnapshotsNone(t *testing.T) {
+	driver := newTestDriver("default")
+	driver.VBoxManager = &VBoxManagerMock{
+		args:   "snapshot default list --machinereadable",
+		stdErr: "This machine does not have any snapshots",
+		err:    errors.New("exit status 1"),
+	}
+
+	snapshots, err := driver.ListSnapshots()
+
+	assert.NoError(t, err)
+	assert.Empty(t, snapshots)
+}
@@ -54,6 +54,7 @@ type Driver struct {
 	ipWaiter            IPWaiter
 	randomInter         RandomInter
 	sleeper             Sleeper
+	dryRun              bool
 	CPU                 int
 	Memory              int
 	DiskSize            int
@@ -102,6 +103,19 @@ func NewDriver(hostName, storePath string) *Driver {
 	}
 }
 
+// Capabilities returns the optional operations supported by the driver.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityStartStop,
+		drivers.CapabilityRestart,
+		drivers.CapabilityKill,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+		drivers.CapabilitySnapshots,
+		drivers.CapabilityResize,
+	}
+}
+
 // GetCreateFlags registers the flags this driver adds to
 // "docker hosts create"
 func (d *Driver) GetCreateFlags() []mcnflag.Flag {
@@ -224,7 +238,7 @@ func (d *Driver) GetURL() (string, error) {
 	if ip == "" {
 		return "", nil
 	}
-	return fmt.Sprintf("tcp://%s:2376", ip), nil
+	return fmt.Sprintf("tcp://%s", net.JoinHostPort(ip, "2376")), nil
 }
 
 func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
@@ -250,6 +264,11 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	return nil
 }
 
+// SetDryRun makes PreCreateCheck skip downloading the boot2docker ISO.
+func (d *Driver) SetDryRun(dryRun bool) {
+	d.dryRun = dryRun
+}
+
 // PreCreateCheck checks that VBoxManage exists and works
 func (d *Driver) PreCreateCheck() error {
 	// Check that VBoxManage exists and works
@@ -275,8 +294,10 @@ func (d *Driver) PreCreateCheck() error {
 
 	// Downloading boot2docker to cache should be done here to make sure
 	// that a download failure will not leave a machine half created.
-	if err := d.b2dUpdater.UpdateISOCache(d.StorePath, d.Boot2DockerURL); err != nil {
-		return err
+	if !d.dryRun {
+		if err := d.b2dUpdater.UpdateISOCache(d.StorePath, d.Boot2DockerURL); err != nil {
+			return err
+		}
 	}
 
 	// Check that Host-only interfaces are ok
@@ -663,6 +684,33 @@ func (d *Driver) Kill() error {
 	return d.vbm("controlvm", d.MachineName, "poweroff")
 }
 
+// Resize changes the CPUs and memory of the VM, which VirtualBox only
+// changes while it is stopped.
+func (d *Driver) Resize(spec drivers.ResizeSpec) error {
+	args := []string{"modifyvm", d.MachineName}
+	if spec.CPUs != 0 {
+		args = append(args, "--cpus", fmt.Sprintf("%d", spec.CPUs))
+	}
+	if spec.MemoryMB != 0 {
+		args = append(args, "--memory", fmt.Sprintf("%d", spec.MemoryMB))
+	}
+	if len(args) == 2 {
+		return errors.New("virtualbox resizes VMs by CPUs and memory, use --cpus or --memory")
+	}
+
+	if err := drivers.WhileStopped(d, func() error { return d.vbm(args...) }); err != nil {
+		return err
+	}
+
+	if spec.CPUs != 0 {
+		d.CPU = spec.CPUs
+	}
+	if spec.MemoryMB != 0 {
+		d.Memory = spec.MemoryMB
+	}
+	return nil
+}
+
 func (d *Driver) Remove() error {
 	s, err := d.GetState()
 	if err == ErrMachineNotExist {
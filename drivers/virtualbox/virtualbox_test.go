@@ -730,3 +730,25 @@ func TestRemovePaused(t *testing.T) {
 
 	assert.NoError(t, err)
 }
+
+func TestResizeStopped(t *testing.T) {
+	driver := NewDriver("default", "path")
+	mockCalls(t, driver, []Call{
+		{"vbm showvminfo default --machinereadable", `VMState="poweroff"`, nil},
+		{"vbm modifyvm default --cpus 4 --memory 4096", "", nil},
+	})
+
+	err := driver.Resize(drivers.ResizeSpec{CPUs: 4, MemoryMB: 4096})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 4, driver.CPU)
+	assert.Equal(t, 4096, driver.Memory)
+}
+
+func TestResizeWithoutCPUsOrMemory(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	err := driver.Resize(drivers.ResizeSpec{InstanceType: "large"})
+
+	assert.Error(t, err)
+}
@@ -49,6 +49,8 @@ type Driver struct {
 	ConfigDriveISO string
 	ConfigDriveURL string
 	NoShare        bool
+
+	dryRun bool
 }
 
 const (
@@ -59,6 +61,17 @@ const (
 	defaultMemory   = 1024
 )
 
+// Capabilities returns the optional operations supported by the driver.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityStartStop,
+		drivers.CapabilityRestart,
+		drivers.CapabilityKill,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+	}
+}
+
 // GetCreateFlags registers the flags this driver adds to
 // "docker hosts create"
 func (d *Driver) GetCreateFlags() []mcnflag.Flag {
@@ -100,10 +113,11 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Value:  defaultSSHUser,
 		},
 		mcnflag.StringFlag{
-			EnvVar: "FUSION_SSH_PASSWORD",
-			Name:   "vmwarefusion-ssh-password",
-			Usage:  "SSH password",
-			Value:  defaultSSHPass,
+			EnvVar:    "FUSION_SSH_PASSWORD",
+			Name:      "vmwarefusion-ssh-password",
+			Usage:     "SSH password",
+			Value:     defaultSSHPass,
+			Sensitive: true,
 		},
 		mcnflag.BoolFlag{
 			EnvVar: "FUSION_NO_SHARE",
@@ -163,7 +177,10 @@ func (d *Driver) UnmarshalJSON(data []byte) error {
 	*d = Driver(target)
 
 	// Make sure to reload values that are subject to change from envvars and os.Args.
-	driverOpts := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	driverOpts, err := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	if err != nil {
+		return err
+	}
 	if _, ok := driverOpts.Values["vmwarefusion-ssh-user"]; ok {
 		d.SSHUser = driverOpts.String("vmwarefusion-ssh-user")
 	}
@@ -253,8 +270,17 @@ func (d *Driver) GetState() (state.State, error) {
 	return state.Stopped, nil
 }
 
+// SetDryRun makes PreCreateCheck skip downloading the boot2docker ISO.
+func (d *Driver) SetDryRun(dryRun bool) {
+	d.dryRun = dryRun
+}
+
 // PreCreateCheck checks that the machine creation process can be started safely.
 func (d *Driver) PreCreateCheck() error {
+	if d.dryRun {
+		return nil
+	}
+
 	// Downloading boot2docker to cache should be done here to make sure
 	// that a download failure will not leave a machine half created.
 	b2dutils := mcnutils.NewB2dUtils(d.StorePath)
@@ -49,6 +49,18 @@ const (
 	defaultDockerPort  = 2376
 )
 
+// Capabilities returns the optional operations supported by the driver.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityStartStop,
+		drivers.CapabilityRestart,
+		drivers.CapabilityKill,
+		drivers.CapabilityCustomSSHPort,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+	}
+}
+
 // GetCreateFlags registers the flags this driver adds to
 // "docker hosts create"
 func (d *Driver) GetCreateFlags() []mcnflag.Flag {
@@ -59,9 +71,10 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "vCloud Air username",
 		},
 		mcnflag.StringFlag{
-			EnvVar: "VCLOUDAIR_PASSWORD",
-			Name:   "vmwarevcloudair-password",
-			Usage:  "vCloud Air password",
+			EnvVar:    "VCLOUDAIR_PASSWORD",
+			Name:      "vmwarevcloudair-password",
+			Usage:     "vCloud Air password",
+			Sensitive: true,
 		},
 		mcnflag.StringFlag{
 			EnvVar: "VCLOUDAIR_COMPUTEID",
@@ -170,7 +183,10 @@ func (d *Driver) UnmarshalJSON(data []byte) error {
 	*d = Driver(target)
 
 	// Make sure to reload values that are subject to change from envvars and os.Args.
-	driverOpts := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	driverOpts, err := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	if err != nil {
+		return err
+	}
 	if _, ok := driverOpts.Values["vmwarevcloudair-username"]; ok {
 		d.UserName = driverOpts.String("vmwarevcloudair-username")
 	}
@@ -133,6 +133,12 @@ func (d *Driver) createCloudInitIso() error {
 		return err
 	}
 
+	if d.CloudConfig == "" {
+		if d.CloudConfig, err = d.MachineUserData(); err != nil {
+			return err
+		}
+	}
+
 	userdatacontent, err := d.addSSHUserToYaml(string(sshkey))
 	if err != nil {
 		return err
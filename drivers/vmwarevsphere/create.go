@@ -3,10 +3,12 @@ package vmwarevsphere
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 
 	"github.com/rancher/machine/libmachine/log"
 	"github.com/vmware/govmomi/find"
 	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/ovf/importer"
 	"github.com/vmware/govmomi/vapi/library"
 	vapifinder "github.com/vmware/govmomi/vapi/library/finder"
 	"github.com/vmware/govmomi/vapi/vcenter"
@@ -92,6 +94,10 @@ func (d *Driver) postCreate(vm *object.VirtualMachine) error {
 		return err
 	}
 
+	if err := d.addToAntiAffinityRule(vm); err != nil {
+		return err
+	}
+
 	return d.Start()
 }
 
@@ -108,7 +114,7 @@ func (d *Driver) createLegacy() error {
 		GuestId:    "otherLinux64Guest",
 		NumCPUs:    int32(d.CPU),
 		MemoryMB:   int64(d.Memory),
-		VAppConfig: d.getVAppConfig(),
+		VAppConfig: d.getVAppConfig(nil),
 	}
 
 	scsi, err := object.SCSIControllerTypes().CreateSCSIController("pvscsi")
@@ -181,6 +187,9 @@ func (d *Driver) createLegacy() error {
 
 	// Convert MB to KB
 	disk.CapacityInKB = int64(d.DiskSize) * 1024
+	if backing, ok := disk.Backing.(*types.VirtualDiskFlatVer2BackingInfo); ok && d.DiskProvisioning != "" {
+		backing.ThinProvisioned, backing.EagerlyScrub = d.diskBacking()
+	}
 	add = append(add, disk)
 	ide, err := devices.FindIDEController("")
 	if err != nil {
@@ -235,9 +244,8 @@ func (d *Driver) createFromVmName() error {
 	spec := types.VirtualMachineCloneSpec{
 		Location: loc,
 		Config: &types.VirtualMachineConfigSpec{
-			NumCPUs:    int32(d.CPU),
-			MemoryMB:   int64(d.Memory),
-			VAppConfig: d.getVAppConfig(),
+			NumCPUs:  int32(d.CPU),
+			MemoryMB: int64(d.Memory),
 		},
 	}
 
@@ -260,11 +268,32 @@ func (d *Driver) createFromVmName() error {
 
 	var o mo.VirtualMachine
 
-	if err = vm2Clone.Properties(d.getCtx(), vm2Clone.Reference(), []string{"summary.config.guestId"}, &o); err != nil {
+	if err = vm2Clone.Properties(d.getCtx(), vm2Clone.Reference(), []string{"summary.config.guestId", "config.vAppConfig"}, &o); err != nil {
 		return err
 	}
 	// ensure that the guestId of the new vm matches the vm it is cloned from
 	spec.Config.GuestId = o.Summary.Config.GuestId
+	spec.Config.VAppConfig = d.getVAppConfig(vAppConfigInfo(o.Config))
+
+	if d.DiskProvisioning != "" {
+		// convert the disks of the clone to the disk provisioning mode
+		devices, err := vm2Clone.Device(d.getCtx())
+		if err != nil {
+			return err
+		}
+		thin, eagerlyScrub := d.diskBacking()
+		for _, disk := range devices.SelectByType((*types.VirtualDisk)(nil)) {
+			spec.Location.Disk = append(spec.Location.Disk, types.VirtualMachineRelocateSpecDiskLocator{
+				DiskId:    disk.GetVirtualDevice().Key,
+				Datastore: dsref,
+				DiskBackingInfo: &types.VirtualDiskFlatVer2BackingInfo{
+					DiskMode:        string(types.VirtualDiskModePersistent),
+					ThinProvisioned: thin,
+					EagerlyScrub:    eagerlyScrub,
+				},
+			})
+		}
+	}
 
 	folder, err := d.findFolder()
 	if err != nil {
@@ -303,6 +332,15 @@ func (d *Driver) createFromVmName() error {
 	return d.postCreate(vm)
 }
 
+// storageProvisioning returns the disk provisioning mode of the VMs deployed
+// from a template
+func (d *Driver) storageProvisioning() string {
+	if d.DiskProvisioning == "" {
+		return diskProvisioningThin
+	}
+	return d.DiskProvisioning
+}
+
 func (d *Driver) createFromLibraryName() error {
 	c, err := d.getSoapClient()
 	if err != nil {
@@ -354,7 +392,7 @@ func (d *Driver) createFromLibraryName() error {
 			Name:                d.MachineName,
 			DefaultDatastoreID:  ds.Reference().Value,
 			AcceptAllEULA:       true,
-			StorageProvisioning: "thin",
+			StorageProvisioning: d.storageProvisioning(),
 		},
 		Target: vcenter.Target{
 			ResourcePoolID: d.resourcepool.Reference().Value,
@@ -385,11 +423,86 @@ func (d *Driver) createFromLibraryName() error {
 
 	vm := obj.(*object.VirtualMachine)
 	log.Debugf("[createFromLibraryName] machine [%s] has OS [%s]", d.MachineName, d.OS)
+	return d.configureDeployedVM(vm)
+}
+
+// createFromOVF deploys the VM from an OVF or OVA template, at a path or
+// URL
+func (d *Driver) createFromOVF() error {
+	c, err := d.getSoapClient()
+	if err != nil {
+		return err
+	}
+
+	folder, err := d.findFolder()
+	if err != nil {
+		return err
+	}
+
+	ds, err := d.getDatastore(&types.VirtualMachineConfigSpec{})
+	if err != nil {
+		return err
+	}
+
+	// an OVA is a tar archive of the OVF descriptor and the disks
+	opener := importer.Opener{Client: c.Client}
+	var archive importer.Archive = &importer.FileArchive{Path: d.CloneFrom, Opener: opener}
+	descriptor := d.CloneFrom
+	if strings.HasSuffix(strings.ToLower(d.CloneFrom), ".ova") {
+		archive = &importer.TapeArchive{Path: d.CloneFrom, Opener: opener}
+		descriptor = "*.ovf"
+	}
+
+	imp := importer.Importer{
+		Log: func(msg string) (int, error) {
+			log.Debug(strings.TrimSpace(msg))
+			return len(msg), nil
+		},
+		Client:       c.Client,
+		Finder:       d.finder,
+		Datacenter:   d.datacenter,
+		Datastore:    ds,
+		ResourcePool: d.resourcepool,
+		Host:         d.hostsystem,
+		Folder:       folder,
+		Archive:      archive,
+	}
+	ref, err := imp.Import(d.getCtx(), descriptor, importer.Options{
+		Name:             &d.MachineName,
+		DiskProvisioning: d.storageProvisioning(),
+	})
+	if err != nil {
+		return err
+	}
+	if ref.Type != "VirtualMachine" {
+		return fmt.Errorf("OVF template %s deploys a %s, not a virtual machine", d.CloneFrom, ref.Type)
+	}
+
+	log.Info("Fetching MachineID ...")
+	// save the machine id as soon as the VM is created
+	if _, err = d.GetMachineId(); err != nil {
+		// no need to return the error, it is not a blocker for creating the machine,
+		// we will fetch the machineID again after starting the VM
+		log.Warnf("[createFromOVF] failed to fetch MachineID for %s: %v", d.MachineName, err)
+	}
+
+	vm := object.NewVirtualMachine(c.Client, *ref)
+	log.Debugf("[createFromOVF] machine [%s] has OS [%s]", d.MachineName, d.OS)
+	return d.configureDeployedVM(vm)
+}
+
+// configureDeployedVM reconfigures the VM deployed with the defaults of its
+// template based on driver inputs
+func (d *Driver) configureDeployedVM(vm *object.VirtualMachine) error {
+	existing, err := d.getExistingVAppConfig(vm)
+	if err != nil {
+		return err
+	}
 
 	spec := types.VirtualMachineConfigSpec{
 		NumCPUs:    int32(d.CPU),
 		MemoryMB:   int64(d.Memory),
-		VAppConfig: d.getVAppConfig(),
+		VAppConfig: d.getVAppConfig(existing),
 	}
 
 	task, err := vm.Reconfigure(d.getCtx(), spec)
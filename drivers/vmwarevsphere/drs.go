@@ -0,0 +1,193 @@
+package vmwarevsphere
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// findCluster returns the DRS cluster the VM is created in, the owner of its
+// resource pool
+func (d *Driver) findCluster() (*object.ClusterComputeResource, error) {
+	owner, err := d.resourcepool.Owner(d.getCtx())
+	if err != nil {
+		return nil, err
+	}
+	cluster, ok := owner.(*object.ClusterComputeResource)
+	if !ok {
+		return nil, fmt.Errorf("anti-affinity rule %s needs a DRS cluster, resource pool %s is not in one", d.AntiAffinityRule, d.resourcepool.InventoryPath)
+	}
+	return cluster, nil
+}
+
+// antiAffinityRuleAttempts is how many times the anti-affinity rule is read
+// and changed before giving up, the machines created at the same time by
+// other processes changing it too.
+const antiAffinityRuleAttempts = 5
+
+// antiAffinityRuleLocks serializes the changes of the anti-affinity rules by
+// cluster and rule, within this process.
+var antiAffinityRuleLocks = struct {
+	sync.Mutex
+	rules map[string]*sync.Mutex
+}{rules: map[string]*sync.Mutex{}}
+
+func antiAffinityRuleLock(cluster types.ManagedObjectReference, rule string) *sync.Mutex {
+	antiAffinityRuleLocks.Lock()
+	defer antiAffinityRuleLocks.Unlock()
+
+	key := cluster.Value + "/" + rule
+	lock, ok := antiAffinityRuleLocks.rules[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		antiAffinityRuleLocks.rules[key] = lock
+	}
+	return lock
+}
+
+// addToAntiAffinityRule adds the VM to the VM group of the anti-affinity
+// rule, and makes the rule, which needs at least two VMs, span the VMs of the
+// group. vSphere removes the VMs from both when deleting them. As vSphere
+// does not version the DRS configuration, the change is read back and made
+// again when another one overwrote it.
+func (d *Driver) addToAntiAffinityRule(vm *object.VirtualMachine) error {
+	if d.AntiAffinityRule == "" {
+		return nil
+	}
+
+	cluster, err := d.findCluster()
+	if err != nil {
+		return err
+	}
+
+	lock := antiAffinityRuleLock(cluster.Reference(), d.AntiAffinityRule)
+	lock.Lock()
+	defer lock.Unlock()
+
+	log.Infof("Adding VM to anti-affinity rule %s of cluster %s", d.AntiAffinityRule, cluster.InventoryPath)
+	var lastErr error
+	for attempt := 1; attempt <= antiAffinityRuleAttempts; attempt++ {
+		config, err := d.clusterConfig(cluster)
+		if err != nil {
+			return err
+		}
+		if inAntiAffinityRule(config, d.AntiAffinityRule, vm.Reference()) {
+			return nil
+		}
+		if attempt > 1 {
+			log.Debugf("Anti-affinity rule %s changed concurrently, adding the VM again (attempt %d): %v", d.AntiAffinityRule, attempt, lastErr)
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+
+		spec := antiAffinityRuleSpec(config, d.AntiAffinityRule, vm.Reference())
+		task, err := cluster.Reconfigure(d.getCtx(), spec, true)
+		if err == nil {
+			err = task.Wait(d.getCtx())
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = errors.New("the rule kept being changed concurrently")
+	}
+	return fmt.Errorf("unable to add the VM to anti-affinity rule %s of cluster %s: %v", d.AntiAffinityRule, cluster.InventoryPath, lastErr)
+}
+
+// clusterConfig returns the DRS configuration of the cluster.
+func (d *Driver) clusterConfig(cluster *object.ClusterComputeResource) (*types.ClusterConfigInfoEx, error) {
+	var o mo.ClusterComputeResource
+	if err := cluster.Properties(d.getCtx(), cluster.Reference(), []string{"configurationEx"}, &o); err != nil {
+		return nil, err
+	}
+	config, ok := o.ConfigurationEx.(*types.ClusterConfigInfoEx)
+	if !ok {
+		return nil, fmt.Errorf("unable to read the DRS configuration of cluster %s", cluster.InventoryPath)
+	}
+	return config, nil
+}
+
+// inAntiAffinityRule tells whether the VM is in the group of the
+// anti-affinity rule of the name, and in the rule once the group has two VMs.
+func inAntiAffinityRule(config *types.ClusterConfigInfoEx, name string, vm types.ManagedObjectReference) bool {
+	var group []types.ManagedObjectReference
+	for _, g := range config.Group {
+		if existing, ok := g.(*types.ClusterVmGroup); ok && existing.Name == name {
+			group = existing.Vm
+			break
+		}
+	}
+	if !containsVM(group, vm) {
+		return false
+	}
+	if len(group) < 2 {
+		return true
+	}
+
+	for _, r := range config.Rule {
+		if existing, ok := r.(*types.ClusterAntiAffinityRuleSpec); ok && existing.Name == name {
+			return containsVM(existing.Vm, vm)
+		}
+	}
+	return false
+}
+
+func containsVM(vms []types.ManagedObjectReference, vm types.ManagedObjectReference) bool {
+	for _, v := range vms {
+		if v == vm {
+			return true
+		}
+	}
+	return false
+}
+
+// antiAffinityRuleSpec returns the DRS configuration change adding the VM to
+// the group and to the anti-affinity rule of the name.
+func antiAffinityRuleSpec(config *types.ClusterConfigInfoEx, name string, vm types.ManagedObjectReference) *types.ClusterConfigSpecEx {
+	spec := &types.ClusterConfigSpecEx{}
+
+	group := &types.ClusterVmGroup{ClusterGroupInfo: types.ClusterGroupInfo{Name: name}}
+	operation := types.ArrayUpdateOperationAdd
+	for _, g := range config.Group {
+		if existing, ok := g.(*types.ClusterVmGroup); ok && existing.Name == name {
+			group.Vm = existing.Vm
+			operation = types.ArrayUpdateOperationEdit
+			break
+		}
+	}
+	group.Vm = append(group.Vm, vm)
+	spec.GroupSpec = []types.ClusterGroupSpec{{
+		ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: operation},
+		Info:            group,
+	}}
+
+	if len(group.Vm) < 2 {
+		return spec
+	}
+
+	rule := &types.ClusterAntiAffinityRuleSpec{
+		ClusterRuleInfo: types.ClusterRuleInfo{
+			Name:    name,
+			Enabled: types.NewBool(true),
+		},
+		Vm: group.Vm,
+	}
+	operation = types.ArrayUpdateOperationAdd
+	for _, r := range config.Rule {
+		if existing, ok := r.(*types.ClusterAntiAffinityRuleSpec); ok && existing.Name == name {
+			rule.Key = existing.Key
+			rule.Enabled = existing.Enabled
+			operation = types.ArrayUpdateOperationEdit
+			break
+		}
+	}
+	spec.RulesSpec = []types.ClusterRuleSpec{{
+		ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: operation},
+		Info:            rule,
+	}}
+	return spec
+}
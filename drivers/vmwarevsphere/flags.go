@@ -23,9 +23,30 @@ var (
 		creationTypeTmpl:    {},
 		creationTypeLibrary: {},
 		creationTypeLegacy:  {},
+		creationTypeOVF:     {},
+	}
+	supportedDiskProvisionings = map[string]struct{}{
+		"":                        {},
+		diskProvisioningThin:      {},
+		diskProvisioningThick:     {},
+		diskProvisioningEagerZero: {},
 	}
 )
 
+// Capabilities returns the optional operations supported by the driver.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityStartStop,
+		drivers.CapabilityRestart,
+		drivers.CapabilityKill,
+		drivers.CapabilityCustomSSHPort,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+		drivers.CapabilitySnapshots,
+		drivers.CapabilityResize,
+	}
+}
+
 func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 	return []mcnflag.Flag{
 		mcnflag.IntFlag{
@@ -68,9 +89,10 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "vSphere username",
 		},
 		mcnflag.StringFlag{
-			EnvVar: "VSPHERE_PASSWORD",
-			Name:   "vmwarevsphere-password",
-			Usage:  "vSphere password",
+			EnvVar:    "VSPHERE_PASSWORD",
+			Name:      "vmwarevsphere-password",
+			Usage:     "vSphere password",
+			Sensitive: true,
 		},
 		mcnflag.StringSliceFlag{
 			EnvVar: "VSPHERE_NETWORK",
@@ -143,15 +165,26 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "vSphere vApp properties",
 		},
 		mcnflag.StringFlag{
-			EnvVar: "VSPHERE_CREATION_TYPE",
-			Name:   "vmwarevsphere-creation-type",
-			Usage:  "Creation type when creating a new virtual machine. Supported values: vm, template, library, legacy",
-			Value:  creationTypeLegacy,
+			EnvVar:  "VSPHERE_CREATION_TYPE",
+			Name:    "vmwarevsphere-creation-type",
+			Usage:   "Creation type when creating a new virtual machine. Supported values: vm, template, library, ovf, legacy",
+			Value:   creationTypeLegacy,
+			Options: []string{creationTypeVM, creationTypeTmpl, creationTypeLibrary, creationTypeOVF, creationTypeLegacy},
 		},
 		mcnflag.StringFlag{
 			EnvVar: "VSPHERE_CLONE_FROM",
 			Name:   "vmwarevsphere-clone-from",
-			Usage:  "If you choose creation type clone a name of what you want to clone is required",
+			Usage:  "If you choose creation type clone a name of what you want to clone is required, or the path or URL of the OVF or OVA template with creation type ovf",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VSPHERE_DISK_PROVISIONING",
+			Name:   "vmwarevsphere-disk-provisioning",
+			Usage:  "vSphere disk provisioning mode: thin, thick or eagerZeroedThick (default thin, the mode of the source for vm and template)",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VSPHERE_ANTI_AFFINITY_RULE",
+			Name:   "vmwarevsphere-anti-affinity-rule",
+			Usage:  "vSphere DRS anti-affinity rule keeping the virtual machines created with the same rule name on separate hosts of the cluster",
 		},
 		mcnflag.StringFlag{
 			EnvVar: "VSPHERE_CONTENT_LIBRARY",
@@ -165,10 +198,11 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Value:  defaultSSHUser,
 		},
 		mcnflag.StringFlag{
-			EnvVar: "VSPHERE_SSH_PASSWORD",
-			Name:   "vmwarevsphere-ssh-password",
-			Usage:  "If using a non-B2D image you can specify the ssh password",
-			Value:  defaultSSHPass,
+			EnvVar:    "VSPHERE_SSH_PASSWORD",
+			Name:      "vmwarevsphere-ssh-password",
+			Usage:     "If using a non-B2D image you can specify the ssh password",
+			Value:     defaultSSHPass,
+			Sensitive: true,
 		},
 		mcnflag.IntFlag{
 			EnvVar: "VSPHERE_SSH_PORT",
@@ -225,7 +259,10 @@ func (d *Driver) UnmarshalJSON(data []byte) error {
 	*d = Driver(target)
 
 	// Make sure to reload values that are subject to change from envvars and os.Args.
-	driverOpts := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	driverOpts, err := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	if err != nil {
+		return err
+	}
 	if _, ok := driverOpts.Values["vmwarevsphere-ssh-user"]; ok {
 		d.SSHUser = driverOpts.String("vmwarevsphere-ssh-user")
 	}
@@ -291,6 +328,15 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.VAppTransport = flags.String("vmwarevsphere-vapp-transport")
 	d.VAppProperties = flags.StringSlice("vmwarevsphere-vapp-property")
 	d.SetSwarmConfigFromFlags(flags)
+	if err := d.SetUserDataFromFlags(flags); err != nil {
+		return err
+	}
+	if err := d.SetSSHJumpHostsFromFlags(flags); err != nil {
+		return err
+	}
+	if err := d.SetSSHRetryPolicyFromFlags(flags); err != nil {
+		return err
+	}
 	d.ISO = d.ResolveStorePath(isoFilename)
 
 	d.CreationType = flags.String("vmwarevsphere-creation-type")
@@ -310,6 +356,12 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 		}
 	}
 
+	d.DiskProvisioning = flags.String("vmwarevsphere-disk-provisioning")
+	if _, ok := supportedDiskProvisionings[d.DiskProvisioning]; !ok {
+		return fmt.Errorf("disk provisioning %s not supported", d.DiskProvisioning)
+	}
+	d.AntiAffinityRule = flags.String("vmwarevsphere-anti-affinity-rule")
+
 	d.GracefulShutdownTimeout = flags.Int("vmwarevsphere-graceful-shutdown-timeout")
 	if d.GracefulShutdownTimeout < 0 {
 		return errors.New("vmwarevsphere-graceful-shutdown-timeout can not be negative")
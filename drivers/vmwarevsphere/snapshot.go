@@ -0,0 +1,77 @@
+package vmwarevsphere
+
+import (
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// CreateSnapshot snapshots the disks of the VM, without its memory, and
+// names the snapshot by its managed object ID.
+func (d *Driver) CreateSnapshot(name string) (drivers.Snapshot, error) {
+	vm, err := d.fetchVM(d.MachineName)
+	if err != nil {
+		return drivers.Snapshot{}, err
+	}
+
+	task, err := vm.CreateSnapshot(d.getCtx(), name, "", false, false)
+	if err != nil {
+		return drivers.Snapshot{}, err
+	}
+	info, err := task.WaitForResult(d.getCtx(), nil)
+	if err != nil {
+		return drivers.Snapshot{}, err
+	}
+
+	snapshot := drivers.Snapshot{Name: name, Created: info.CompleteTime.UTC()}
+	if ref, ok := info.Result.(types.ManagedObjectReference); ok {
+		snapshot.ID = ref.Value
+	}
+	return snapshot, nil
+}
+
+// ListSnapshots returns the snapshots of the tree of the VM, parents first.
+func (d *Driver) ListSnapshots() ([]drivers.Snapshot, error) {
+	vm, err := d.fetchVM(d.MachineName)
+	if err != nil {
+		return nil, err
+	}
+
+	var o mo.VirtualMachine
+	if err := vm.Properties(d.getCtx(), vm.Reference(), []string{"snapshot"}, &o); err != nil {
+		return nil, err
+	}
+
+	snapshots := []drivers.Snapshot{}
+	if o.Snapshot != nil {
+		snapshots = appendSnapshots(snapshots, o.Snapshot.RootSnapshotList)
+	}
+	return snapshots, nil
+}
+
+func appendSnapshots(snapshots []drivers.Snapshot, tree []types.VirtualMachineSnapshotTree) []drivers.Snapshot {
+	for _, node := range tree {
+		snapshots = append(snapshots, drivers.Snapshot{
+			ID:      node.Snapshot.Value,
+			Name:    node.Name,
+			Created: node.CreateTime.UTC(),
+		})
+		snapshots = appendSnapshots(snapshots, node.ChildSnapshotList)
+	}
+	return snapshots
+}
+
+// RestoreSnapshot reverts the VM to the snapshot of the managed object ID,
+// leaving it in the power state it was snapshotted in.
+func (d *Driver) RestoreSnapshot(id string) error {
+	vm, err := d.fetchVM(d.MachineName)
+	if err != nil {
+		return err
+	}
+
+	task, err := vm.RevertToSnapshot(d.getCtx(), id, true)
+	if err != nil {
+		return err
+	}
+	return task.Wait(d.getCtx())
+}
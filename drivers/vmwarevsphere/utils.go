@@ -291,13 +291,18 @@ func (d *Driver) findFolder() (*object.Folder, error) {
 	return folders.VmFolder, nil
 }
 
-func (d *Driver) getVAppConfig() *types.VmConfigSpec {
-	if d.VAppTransport != "com.vmware.guestInfo" && d.VAppTransport != "iso" {
+// getVAppConfig returns the vApp options to configure, given the existing
+// ones of the template when it has some. The values of the properties the
+// template defines are set, the other properties are added.
+func (d *Driver) getVAppConfig(existing *types.VmConfigInfo) *types.VmConfigSpec {
+	validTransport := d.VAppTransport == "com.vmware.guestInfo" || d.VAppTransport == "iso"
+	if !validTransport && existing == nil {
 		return nil
 	}
 
-	vApp := types.VmConfigSpec{
-		OvfEnvironmentTransport: []string{d.VAppTransport},
+	vApp := types.VmConfigSpec{}
+	if validTransport {
+		vApp.OvfEnvironmentTransport = []string{d.VAppTransport}
 	}
 
 	if d.VAppIpAllocationPolicy == "dhcp" ||
@@ -323,7 +328,18 @@ func (d *Driver) getVAppConfig() *types.VmConfigSpec {
 		}
 	}
 
-	for i, prop := range d.VAppProperties {
+	keys := map[string]int32{}
+	var nextKey int32
+	if existing != nil {
+		for _, p := range existing.Property {
+			keys[p.Id] = p.Key
+			if p.Key >= nextKey {
+				nextKey = p.Key + 1
+			}
+		}
+	}
+
+	for _, prop := range d.VAppProperties {
 		v := strings.SplitN(prop, "=", 2)
 		key := v[0]
 		typ := "string"
@@ -331,6 +347,19 @@ func (d *Driver) getVAppConfig() *types.VmConfigSpec {
 		if len(v) > 1 {
 			value = v[1]
 		}
+		if k, ok := keys[key]; ok {
+			vApp.Property = append(vApp.Property, types.VAppPropertySpec{
+				ArrayUpdateSpec: types.ArrayUpdateSpec{
+					Operation: types.ArrayUpdateOperationEdit,
+				},
+				Info: &types.VAppPropertyInfo{
+					Key:   k,
+					Id:    key,
+					Value: value,
+				},
+			})
+			continue
+		}
 		if strings.HasPrefix(value, "ip:") {
 			typ = value
 			value = ""
@@ -343,13 +372,48 @@ func (d *Driver) getVAppConfig() *types.VmConfigSpec {
 				Operation: types.ArrayUpdateOperationAdd,
 			},
 			Info: &types.VAppPropertyInfo{
-				Key:          int32(i),
+				Key:          nextKey,
 				Id:           key,
 				Type:         typ,
 				DefaultValue: value,
 			},
 		})
+		nextKey++
 	}
 
+	if !validTransport && vApp.IpAssignment == nil && len(vApp.Property) == 0 {
+		return nil
+	}
 	return &vApp
 }
+
+// getExistingVAppConfig returns the vApp options of the VM, nil if it has
+// none.
+func (d *Driver) getExistingVAppConfig(vm *object.VirtualMachine) (*types.VmConfigInfo, error) {
+	var o mo.VirtualMachine
+	if err := vm.Properties(d.getCtx(), vm.Reference(), []string{"config.vAppConfig"}, &o); err != nil {
+		return nil, err
+	}
+	return vAppConfigInfo(o.Config), nil
+}
+
+func vAppConfigInfo(config *types.VirtualMachineConfigInfo) *types.VmConfigInfo {
+	if config == nil || config.VAppConfig == nil {
+		return nil
+	}
+	return config.VAppConfig.GetVmConfigInfo()
+}
+
+// diskBacking returns whether disks are thin provisioned and eagerly zeroed
+// in the disk provisioning mode, nil when the mode is not set.
+func (d *Driver) diskBacking() (thin *bool, eagerlyScrub *bool) {
+	switch d.DiskProvisioning {
+	case diskProvisioningThin:
+		return types.NewBool(true), types.NewBool(false)
+	case diskProvisioningThick:
+		return types.NewBool(false), types.NewBool(false)
+	case diskProvisioningEagerZero:
+		return types.NewBool(false), types.NewBool(true)
+	}
+	return nil, nil
+}
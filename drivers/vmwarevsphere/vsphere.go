@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"os"
 	"strings"
 	"time"
 
@@ -19,6 +20,7 @@ import (
 	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/find"
 	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/ovf/importer"
 	"github.com/vmware/govmomi/vim25/mo"
 	"github.com/vmware/govmomi/vim25/types"
 	"golang.org/x/net/context"
@@ -72,6 +74,8 @@ type Driver struct {
 	CreationType            string
 	ContentLibrary          string
 	CloneFrom               string
+	DiskProvisioning        string
+	AntiAffinityRule        string
 	SSHPassword             string
 	SSHUserGroup            string
 	OS                      string
@@ -102,6 +106,11 @@ const (
 	creationTypeTmpl    = "template"
 	creationTypeLibrary = "library"
 	creationTypeLegacy  = "legacy"
+	creationTypeOVF     = "ovf"
+
+	diskProvisioningThin      = "thin"
+	diskProvisioningThick     = "thick"
+	diskProvisioningEagerZero = "eagerZeroedThick"
 )
 
 func NewDriver(hostName, storePath string) drivers.Driver {
@@ -263,6 +272,18 @@ func (d *Driver) PreCreateCheck() error {
 		}
 	}
 
+	if d.CreationType == creationTypeOVF && !importer.IsRemotePath(d.CloneFrom) {
+		if _, err := os.Stat(d.CloneFrom); err != nil {
+			return fmt.Errorf("Error finding OVF template to deploy: %s", err)
+		}
+	}
+
+	if d.AntiAffinityRule != "" {
+		if _, err := d.findCluster(); err != nil {
+			return err
+		}
+	}
+
 	// TODO: if the user has both the VSPHERE_NETWORK defined and adds --vmwarevsphere-network
 	//       both are used at the same time - probably should detect that and remove the one from ENV
 	if len(d.Networks) == 0 {
@@ -331,6 +352,9 @@ func (d *Driver) Create() error {
 	case "vm", "template":
 		log.Infof("cloning VM from VM or Template: %s...", d.CloneFrom)
 		return d.createFromVmName()
+	case "ovf":
+		log.Infof("deploying VM from OVF template %s...", d.CloneFrom)
+		return d.createFromOVF()
 	default:
 		log.Infof("unable to perform any actions with creationType [%s], change flags and try again", d.CreationType)
 		return nil
@@ -447,6 +471,42 @@ func (d *Driver) Kill() error {
 	return nil
 }
 
+// Resize changes the CPUs and memory of the VM, shutting it down while they
+// change since the VMs created have no CPU or memory hot add.
+func (d *Driver) Resize(spec drivers.ResizeSpec) error {
+	if spec.CPUs == 0 && spec.MemoryMB == 0 {
+		return errors.New("vmwarevsphere resizes VMs by CPUs and memory, use --cpus or --memory")
+	}
+
+	vm, err := d.fetchVM(d.MachineName)
+	if err != nil {
+		return err
+	}
+
+	config := types.VirtualMachineConfigSpec{
+		NumCPUs:  int32(spec.CPUs),
+		MemoryMB: int64(spec.MemoryMB),
+	}
+	err = drivers.WhileStopped(d, func() error {
+		task, err := vm.Reconfigure(d.getCtx(), config)
+		if err != nil {
+			return err
+		}
+		return task.Wait(d.getCtx())
+	})
+	if err != nil {
+		return err
+	}
+
+	if spec.CPUs != 0 {
+		d.CPU = spec.CPUs
+	}
+	if spec.MemoryMB != 0 {
+		d.Memory = spec.MemoryMB
+	}
+	return nil
+}
+
 // Remove removes a VM in vSphere.
 // It will perform a graceful shutdown on the Guest OS if the GracefulShutdownTimeout is greater than zero;
 // It will perform a power off if either the GracefulShutdownTimeout is zero or a graceful shutdown times out.
@@ -7,6 +7,7 @@ import (
 
 	"github.com/rancher/machine/libmachine/drivers"
 	"github.com/stretchr/testify/assert"
+	"github.com/vmware/govmomi/vim25/types"
 )
 
 func TestUnmarshalJSON(t *testing.T) {
@@ -44,3 +45,115 @@ func TestSetConfigFromFlags(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Empty(t, checkFlags.InvalidFlags)
 }
+
+func TestSetConfigFromFlagsDiskProvisioning(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"vmwarevsphere-disk-provisioning": "sparse",
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	assert.Error(t, driver.SetConfigFromFlags(checkFlags))
+
+	checkFlags.FlagsValues["vmwarevsphere-disk-provisioning"] = "eagerZeroedThick"
+	assert.NoError(t, driver.SetConfigFromFlags(checkFlags))
+
+	thin, eagerlyScrub := driver.(*Driver).diskBacking()
+	assert.False(t, *thin)
+	assert.True(t, *eagerlyScrub)
+}
+
+func TestGetVAppConfig(t *testing.T) {
+	driver := NewDriver("default", "path").(*Driver)
+	driver.VAppProperties = []string{"hostname=node1", "extra=value"}
+
+	// Without a transport or a template defining vApp options, none are set.
+	assert.Nil(t, driver.getVAppConfig(nil))
+
+	existing := &types.VmConfigInfo{
+		Property: []types.VAppPropertyInfo{
+			{Key: 3, Id: "hostname"},
+			{Key: 7, Id: "password"},
+		},
+	}
+	vApp := driver.getVAppConfig(existing)
+	assert.Len(t, vApp.Property, 2)
+
+	assert.Equal(t, types.ArrayUpdateOperationEdit, vApp.Property[0].Operation)
+	assert.Equal(t, int32(3), vApp.Property[0].Info.Key)
+	assert.Equal(t, "node1", vApp.Property[0].Info.Value)
+
+	assert.Equal(t, types.ArrayUpdateOperationAdd, vApp.Property[1].Operation)
+	assert.Equal(t, int32(8), vApp.Property[1].Info.Key)
+	assert.Equal(t, "value", vApp.Property[1].Info.DefaultValue)
+
+	driver.VAppTransport = "iso"
+	vApp = driver.getVAppConfig(nil)
+	assert.Equal(t, []string{"iso"}, vApp.OvfEnvironmentTransport)
+	assert.Equal(t, int32(0), vApp.Property[0].Info.Key)
+	assert.Equal(t, int32(1), vApp.Property[1].Info.Key)
+}
+
+func TestAntiAffinityRuleSpec(t *testing.T) {
+	vm1 := types.ManagedObjectReference{Type: "VirtualMachine", Value: "vm-1"}
+	vm2 := types.ManagedObjectReference{Type: "VirtualMachine", Value: "vm-2"}
+
+	// The first VM only creates the group, a rule needs two VMs.
+	spec := antiAffinityRuleSpec(&types.ClusterConfigInfoEx{}, "pool", vm1)
+	assert.Len(t, spec.GroupSpec, 1)
+	assert.Equal(t, types.ArrayUpdateOperationAdd, spec.GroupSpec[0].Operation)
+	assert.Empty(t, spec.RulesSpec)
+
+	config := &types.ClusterConfigInfoEx{
+		Group: []types.BaseClusterGroupInfo{
+			&types.ClusterVmGroup{ClusterGroupInfo: types.ClusterGroupInfo{Name: "pool"}, Vm: []types.ManagedObjectReference{vm1}},
+		},
+	}
+	spec = antiAffinityRuleSpec(config, "pool", vm2)
+	assert.Equal(t, types.ArrayUpdateOperationEdit, spec.GroupSpec[0].Operation)
+	assert.Len(t, spec.RulesSpec, 1)
+	assert.Equal(t, types.ArrayUpdateOperationAdd, spec.RulesSpec[0].Operation)
+	rule := spec.RulesSpec[0].Info.(*types.ClusterAntiAffinityRuleSpec)
+	assert.Equal(t, []types.ManagedObjectReference{vm1, vm2}, rule.Vm)
+
+	config.Rule = []types.BaseClusterRuleInfo{
+		&types.ClusterAntiAffinityRuleSpec{ClusterRuleInfo: types.ClusterRuleInfo{Key: 12, Name: "pool"}, Vm: []types.ManagedObjectReference{vm1}},
+	}
+	spec = antiAffinityRuleSpec(config, "pool", vm2)
+	assert.Equal(t, types.ArrayUpdateOperationEdit, spec.RulesSpec[0].Operation)
+	assert.Equal(t, int32(12), spec.RulesSpec[0].Info.(*types.ClusterAntiAffinityRuleSpec).Key)
+}
+
+func TestInAntiAffinityRule(t *testing.T) {
+	vm1 := types.ManagedObjectReference{Type: "VirtualMachine", Value: "vm-1"}
+	vm2 := types.ManagedObjectReference{Type: "VirtualMachine", Value: "vm-2"}
+
+	config := &types.ClusterConfigInfoEx{}
+	assert.False(t, inAntiAffinityRule(config, "pool", vm1))
+
+	config.Group = []types.BaseClusterGroupInfo{
+		&types.ClusterVmGroup{ClusterGroupInfo: types.ClusterGroupInfo{Name: "pool"}, Vm: []types.ManagedObjectReference{vm1}},
+	}
+	assert.True(t, inAntiAffinityRule(config, "pool", vm1))
+	assert.False(t, inAntiAffinityRule(config, "other", vm1))
+
+	// A concurrent change overwrote the rule of the second VM.
+	config.Group[0].(*types.ClusterVmGroup).Vm = []types.ManagedObjectReference{vm1, vm2}
+	config.Rule = []types.BaseClusterRuleInfo{
+		&types.ClusterAntiAffinityRuleSpec{ClusterRuleInfo: types.ClusterRuleInfo{Name: "pool"}, Vm: []types.ManagedObjectReference{vm1}},
+	}
+	assert.False(t, inAntiAffinityRule(config, "pool", vm2))
+
+	config.Rule[0].(*types.ClusterAntiAffinityRuleSpec).Vm = []types.ManagedObjectReference{vm1, vm2}
+	assert.True(t, inAntiAffinityRule(config, "pool", vm2))
+}
+
+func TestAntiAffinityRuleLock(t *testing.T) {
+	cluster := types.ManagedObjectReference{Type: "ClusterComputeResource", Value: "domain-c1"}
+
+	assert.Same(t, antiAffinityRuleLock(cluster, "pool"), antiAffinityRuleLock(cluster, "pool"))
+	assert.NotSame(t, antiAffinityRuleLock(cluster, "pool"), antiAffinityRuleLock(cluster, "other"))
+}
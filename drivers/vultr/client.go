@@ -0,0 +1,187 @@
+package vultr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/rancher/machine/libmachine/version"
+)
+
+// apiEndpoint is the Vultr API, replaced by the tests.
+var apiEndpoint = "https://api.vultr.com/v2"
+
+// Client makes the calls to the Vultr API the driver needs.
+type Client struct {
+	apiKey     string
+	endpoint   string
+	httpClient *http.Client
+}
+
+func NewClient(apiKey string) *Client {
+	return &Client{
+		apiKey:     apiKey,
+		endpoint:   apiEndpoint,
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// APIError is an error answered by the Vultr API.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return "vultr: " + e.Message
+}
+
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+type Instance struct {
+	ID          string `json:"id"`
+	Label       string `json:"label"`
+	Status      string `json:"status"`
+	PowerStatus string `json:"power_status"`
+	MainIP      string `json:"main_ip"`
+	V6MainIP    string `json:"v6_main_ip"`
+	InternalIP  string `json:"internal_ip"`
+}
+
+type InstanceCreateRequest struct {
+	Region     string   `json:"region"`
+	Plan       string   `json:"plan"`
+	OSID       int      `json:"os_id,omitempty"`
+	SnapshotID string   `json:"snapshot_id,omitempty"`
+	Label      string   `json:"label"`
+	Hostname   string   `json:"hostname"`
+	SSHKeyIDs  []string `json:"sshkey_id,omitempty"`
+	EnableIPv6 bool     `json:"enable_ipv6,omitempty"`
+	AttachVPC  []string `json:"attach_vpc,omitempty"`
+	// UserData is base64 encoded.
+	UserData string   `json:"user_data,omitempty"`
+	Backups  string   `json:"backups,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+type SSHKey struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	SSHKey string `json:"ssh_key"`
+}
+
+func (c *Client) do(method, path string, body, reply interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.endpoint+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("docker-machine/v%d", version.APIVersion))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 400 {
+		var errReply struct {
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(data, &errReply); err != nil || errReply.Error == "" {
+			errReply.Error = resp.Status
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: errReply.Error}
+	}
+
+	if reply == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, reply)
+}
+
+// AvailablePlans returns the plans which can be deployed in the region.
+func (c *Client) AvailablePlans(region string) ([]string, error) {
+	var reply struct {
+		AvailablePlans []string `json:"available_plans"`
+	}
+	if err := c.do(http.MethodGet, "/regions/"+region+"/availability", nil, &reply); err != nil {
+		return nil, err
+	}
+	return reply.AvailablePlans, nil
+}
+
+func (c *Client) GetSSHKey(id string) (*SSHKey, error) {
+	var reply struct {
+		SSHKey SSHKey `json:"ssh_key"`
+	}
+	if err := c.do(http.MethodGet, "/ssh-keys/"+id, nil, &reply); err != nil {
+		return nil, err
+	}
+	return &reply.SSHKey, nil
+}
+
+func (c *Client) CreateSSHKey(name, publicKey string) (*SSHKey, error) {
+	var reply struct {
+		SSHKey SSHKey `json:"ssh_key"`
+	}
+	body := map[string]string{"name": name, "ssh_key": publicKey}
+	if err := c.do(http.MethodPost, "/ssh-keys", body, &reply); err != nil {
+		return nil, err
+	}
+	return &reply.SSHKey, nil
+}
+
+func (c *Client) DeleteSSHKey(id string) error {
+	return c.do(http.MethodDelete, "/ssh-keys/"+id, nil, nil)
+}
+
+func (c *Client) CreateInstance(request *InstanceCreateRequest) (*Instance, error) {
+	var reply struct {
+		Instance Instance `json:"instance"`
+	}
+	if err := c.do(http.MethodPost, "/instances", request, &reply); err != nil {
+		return nil, err
+	}
+	return &reply.Instance, nil
+}
+
+func (c *Client) GetInstance(id string) (*Instance, error) {
+	var reply struct {
+		Instance Instance `json:"instance"`
+	}
+	if err := c.do(http.MethodGet, "/instances/"+id, nil, &reply); err != nil {
+		return nil, err
+	}
+	return &reply.Instance, nil
+}
+
+func (c *Client) DeleteInstance(id string) error {
+	return c.do(http.MethodDelete, "/instances/"+id, nil, nil)
+}
+
+// InstanceAction runs an action, e.g. "start", on the instance.
+func (c *Client) InstanceAction(id, action string) error {
+	return c.do(http.MethodPost, "/instances/"+id+"/"+action, nil, nil)
+}
@@ -0,0 +1,527 @@
+package vultr
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	rpcdriver "github.com/rancher/machine/libmachine/drivers/rpc"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/rancher/machine/libmachine/mcnutils"
+	"github.com/rancher/machine/libmachine/ssh"
+	"github.com/rancher/machine/libmachine/state"
+)
+
+type Driver struct {
+	*drivers.BaseDriver
+	APIKey           string
+	InstanceID       string
+	Region           string
+	Plan             string
+	OSID             int
+	Snapshot         string
+	SSHKeyID         string
+	SSHKey           string
+	IPv6             bool
+	Backups          bool
+	VPCs             []string
+	UserDataFile     string
+	Tags             string
+	PrivateIPAddress string
+	// CreatedSSHKeyID is the SSH key the driver created when not given one
+	// by SSHKeyID, removed with the machine.
+	CreatedSSHKeyID string
+}
+
+const (
+	defaultSSHPort = 22
+	defaultSSHUser = "root"
+	// defaultOSID is Ubuntu 22.04 x64.
+	defaultOSID   = 1743
+	defaultRegion = "ewr"
+	defaultPlan   = "vc2-1c-1gb"
+
+	// unassignedIP is the main IP of the instances still being deployed.
+	unassignedIP = "0.0.0.0"
+)
+
+// Capabilities returns the optional operations supported by the driver.
+func (d *Driver) Capabilities() []drivers.Capability {
+	return []drivers.Capability{
+		drivers.CapabilityStartStop,
+		drivers.CapabilityRestart,
+		drivers.CapabilityKill,
+		drivers.CapabilityPrivateIP,
+		drivers.CapabilityCustomSSHPort,
+		drivers.CapabilityIPv6,
+		drivers.CapabilitySSH,
+		drivers.CapabilityDryRun,
+	}
+}
+
+// GetCreateFlags registers the flags this driver adds to
+// "docker hosts create"
+func (d *Driver) GetCreateFlags() []mcnflag.Flag {
+	return []mcnflag.Flag{
+		mcnflag.StringFlag{
+			EnvVar:    "VULTR_API_KEY",
+			Name:      "vultr-api-key",
+			Usage:     "Vultr API key",
+			Sensitive: true,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VULTR_SSH_USER",
+			Name:   "vultr-ssh-user",
+			Usage:  "SSH username",
+			Value:  defaultSSHUser,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VULTR_SSH_KEY_ID",
+			Name:   "vultr-ssh-key-id",
+			Usage:  "ID of an existing Vultr SSH key",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VULTR_SSH_KEY_PATH",
+			Name:   "vultr-ssh-key-path",
+			Usage:  "SSH private key path ",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VULTR_SSH_PORT",
+			Name:   "vultr-ssh-port",
+			Usage:  "SSH port",
+			Value:  defaultSSHPort,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VULTR_OS_ID",
+			Name:   "vultr-os-id",
+			Usage:  "Vultr operating system ID",
+			Value:  defaultOSID,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VULTR_SNAPSHOT",
+			Name:   "vultr-snapshot",
+			Usage:  "ID of the Vultr snapshot to deploy, rather than an operating system",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VULTR_REGION",
+			Name:   "vultr-region",
+			Usage:  "Vultr region",
+			Value:  defaultRegion,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VULTR_PLAN",
+			Name:   "vultr-plan",
+			Usage:  "Vultr plan",
+			Value:  defaultPlan,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VULTR_IPV6",
+			Name:   "vultr-ipv6",
+			Usage:  "enable ipv6 for the instance",
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "VULTR_VPC",
+			Name:   "vultr-vpc",
+			Usage:  "IDs of the VPCs to attach the instance to",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VULTR_BACKUPS",
+			Name:   "vultr-backups",
+			Usage:  "enable backups for the instance",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VULTR_USERDATA",
+			Name:   "vultr-userdata",
+			Usage:  "path to file with cloud-init user-data",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VULTR_TAGS",
+			Name:   "vultr-tags",
+			Usage:  "comma-separated list of tags to apply to the instance",
+		},
+	}
+}
+
+func NewDriver(hostName, storePath string) *Driver {
+	return &Driver{
+		OSID:   defaultOSID,
+		Plan:   defaultPlan,
+		Region: defaultRegion,
+		BaseDriver: &drivers.BaseDriver{
+			MachineName: hostName,
+			StorePath:   storePath,
+		},
+	}
+}
+
+func (d *Driver) GetSSHHostname() (string, error) {
+	return d.GetIP()
+}
+
+// DriverName returns the name of the driver
+func (d *Driver) DriverName() string {
+	return "vultr"
+}
+
+// UnmarshalJSON loads driver config from JSON. This function is used by the RPCServerDriver that wraps
+// all drivers as a means of populating an already-initialized driver with new configuration.
+// See `RPCServerDriver.SetConfigRaw`.
+func (d *Driver) UnmarshalJSON(data []byte) error {
+	// Unmarshal driver config into an aliased type to prevent infinite recursion on UnmarshalJSON.
+	type targetDriver Driver
+
+	// Copy data from `d` to `target` before unmarshalling. This will ensure that already-initialized values
+	// from `d` that are left untouched during unmarshal (like functions) are preserved.
+	target := targetDriver(*d)
+
+	if err := json.Unmarshal(data, &target); err != nil {
+		return fmt.Errorf("error unmarshalling driver config from JSON: %w", err)
+	}
+
+	// Copy unmarshalled data back to `d`.
+	*d = Driver(target)
+
+	// Make sure to reload values that are subject to change from envvars and os.Args.
+	driverOpts, err := rpcdriver.GetDriverOpts(d.GetCreateFlags(), os.Args)
+	if err != nil {
+		return err
+	}
+	if _, ok := driverOpts.Values["vultr-api-key"]; ok {
+		d.APIKey = driverOpts.String("vultr-api-key")
+	}
+
+	return nil
+}
+
+func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
+	d.APIKey = flags.String("vultr-api-key")
+	d.OSID = flags.Int("vultr-os-id")
+	d.Snapshot = flags.String("vultr-snapshot")
+	d.Region = flags.String("vultr-region")
+	d.Plan = flags.String("vultr-plan")
+	d.IPv6 = flags.Bool("vultr-ipv6")
+	d.VPCs = flags.StringSlice("vultr-vpc")
+	d.Backups = flags.Bool("vultr-backups")
+	d.UserDataFile = flags.String("vultr-userdata")
+	d.SSHUser = flags.String("vultr-ssh-user")
+	d.SSHPort = flags.Int("vultr-ssh-port")
+	d.SSHKeyID = flags.String("vultr-ssh-key-id")
+	d.SSHKey = flags.String("vultr-ssh-key-path")
+	d.Tags = flags.String("vultr-tags")
+
+	d.SetSwarmConfigFromFlags(flags)
+
+	if d.APIKey == "" {
+		return fmt.Errorf("vultr driver requires the --vultr-api-key option")
+	}
+
+	return nil
+}
+
+func (d *Driver) PreCreateCheck() error {
+	if d.UserDataFile != "" {
+		if _, err := os.Stat(d.UserDataFile); os.IsNotExist(err) {
+			return fmt.Errorf("user-data file %s could not be found", d.UserDataFile)
+		}
+	}
+
+	if d.SSHKey != "" {
+		if d.SSHKeyID == "" {
+			return fmt.Errorf("ssh-key-id needs to be provided for %q", d.SSHKey)
+		}
+
+		if _, err := os.Stat(d.SSHKey); os.IsNotExist(err) {
+			return fmt.Errorf("SSH key does not exist: %q", d.SSHKey)
+		}
+	}
+
+	client := d.getClient()
+	if d.SSHKeyID != "" {
+		if _, err := client.GetSSHKey(d.SSHKeyID); err != nil {
+			if isNotFound(err) {
+				return fmt.Errorf("Vultr SSH key %s doesn't exist", d.SSHKeyID)
+			}
+			return err
+		}
+	}
+
+	plans, err := client.AvailablePlans(d.Region)
+	if err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("vultr requires a valid region")
+		}
+		return err
+	}
+	for _, plan := range plans {
+		if plan == d.Plan {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("vultr plan %s is not available in region %s", d.Plan, d.Region)
+}
+
+func (d *Driver) Create() error {
+	createRequest, err := d.createRequest()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Creating SSH key...")
+
+	key, err := d.createSSHKey()
+	if err != nil {
+		return err
+	}
+	createRequest.SSHKeyIDs = []string{key.ID}
+
+	log.Infof("Creating Vultr instance...")
+
+	client := d.getClient()
+	instance, err := client.CreateInstance(createRequest)
+	if err != nil {
+		return err
+	}
+	d.InstanceID = instance.ID
+
+	log.Info("Waiting for IP address to be assigned to the instance...")
+	for {
+		instance, err = client.GetInstance(d.InstanceID)
+		if err != nil {
+			if removeErr := d.Remove(); removeErr != nil {
+				return fmt.Errorf("failed to create machine due to error: %v. Removing instance: %v", err, removeErr)
+			}
+			return err
+		}
+
+		if instance.MainIP != unassignedIP {
+			d.IPAddress = instance.MainIP
+		}
+		d.PrivateIPAddress = instance.InternalIP
+
+		if instance.Status == "active" && d.IPAddress != "" && (len(d.VPCs) == 0 || d.PrivateIPAddress != "") {
+			break
+		}
+
+		time.Sleep(5 * time.Second)
+	}
+
+	log.Debugf("Created instance ID %s, IP address %s, Private IP address %s",
+		instance.ID,
+		d.IPAddress,
+		d.PrivateIPAddress)
+
+	return nil
+}
+
+// createRequest returns the request creating the instance, without its SSH
+// key.
+func (d *Driver) createRequest() (*InstanceCreateRequest, error) {
+	createRequest := &InstanceCreateRequest{
+		Region:     d.Region,
+		Plan:       d.Plan,
+		Label:      d.MachineName,
+		Hostname:   d.MachineName,
+		EnableIPv6: d.IPv6,
+		AttachVPC:  d.VPCs,
+		Tags:       d.getTags(),
+	}
+	if d.Snapshot != "" {
+		createRequest.SnapshotID = d.Snapshot
+	} else {
+		createRequest.OSID = d.OSID
+	}
+	if d.Backups {
+		createRequest.Backups = "enabled"
+	}
+
+	if d.UserDataFile != "" {
+		buf, err := os.ReadFile(d.UserDataFile)
+		if err != nil {
+			return nil, err
+		}
+		createRequest.UserData = base64.StdEncoding.EncodeToString(buf)
+	}
+
+	return createRequest, nil
+}
+
+func (d *Driver) createSSHKey() (*SSHKey, error) {
+	d.SSHKeyPath = d.GetSSHKeyPath()
+
+	if d.SSHKeyID != "" {
+		key, err := d.getClient().GetSSHKey(d.SSHKeyID)
+		if err != nil {
+			return nil, err
+		}
+
+		if d.SSHKey == "" {
+			log.Infof("Assuming Vultr private SSH is located at ~/.ssh/id_rsa")
+			return key, nil
+		}
+
+		if err := copySSHKey(d.SSHKey, d.SSHKeyPath); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+
+	if err := ssh.GenerateSSHKey(d.SSHKeyPath); err != nil {
+		return nil, err
+	}
+
+	publicKey, err := os.ReadFile(d.publicSSHKeyPath())
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := d.getClient().CreateSSHKey(d.MachineName, strings.TrimSpace(string(publicKey)))
+	if err != nil {
+		return nil, err
+	}
+	d.CreatedSSHKeyID = key.ID
+	return key, nil
+}
+
+func (d *Driver) GetURL() (string, error) {
+	if err := drivers.MustBeRunning(d); err != nil {
+		return "", err
+	}
+
+	ip, err := d.GetIP()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("tcp://%s", net.JoinHostPort(ip, "2376")), nil
+}
+
+// GetIPs returns the public, VPC and IPv6 addresses of the instance.
+func (d *Driver) GetIPs() ([]drivers.NetworkAddress, error) {
+	instance, err := d.getClient().GetInstance(d.InstanceID)
+	if err != nil {
+		return nil, err
+	}
+	return instanceAddresses(instance), nil
+}
+
+func instanceAddresses(instance *Instance) []drivers.NetworkAddress {
+	var addrs []drivers.NetworkAddress
+	if instance.MainIP != unassignedIP {
+		addrs = drivers.AppendAddress(addrs, drivers.AddressPublic, instance.MainIP)
+	}
+	addrs = drivers.AppendAddress(addrs, drivers.AddressPrivate, instance.InternalIP)
+	return drivers.AppendAddress(addrs, drivers.AddressIPv6, instance.V6MainIP)
+}
+
+func (d *Driver) GetState() (state.State, error) {
+	instance, err := d.getClient().GetInstance(d.InstanceID)
+	if err != nil {
+		if !isNotFound(err) {
+			return state.Error, err
+		}
+		return state.None, fmt.Errorf("machine %v not found", d.MachineName)
+	}
+	return instanceState(instance), nil
+}
+
+func instanceState(instance *Instance) state.State {
+	switch {
+	case instance.Status == "pending":
+		return state.Starting
+	case instance.Status != "active":
+		return state.None
+	case instance.PowerStatus == "running":
+		return state.Running
+	case instance.PowerStatus == "stopped":
+		return state.Stopped
+	}
+	return state.None
+}
+
+func (d *Driver) Start() error {
+	return d.getClient().InstanceAction(d.InstanceID, "start")
+}
+
+// Stop halts the instance, Vultr having no graceful shutdown.
+func (d *Driver) Stop() error {
+	return d.getClient().InstanceAction(d.InstanceID, "halt")
+}
+
+func (d *Driver) Restart() error {
+	return d.getClient().InstanceAction(d.InstanceID, "reboot")
+}
+
+func (d *Driver) Kill() error {
+	return d.getClient().InstanceAction(d.InstanceID, "halt")
+}
+
+func (d *Driver) Remove() error {
+	client := d.getClient()
+	if d.InstanceID != "" {
+		if err := client.DeleteInstance(d.InstanceID); err != nil {
+			if !isNotFound(err) {
+				return err
+			}
+			log.Infof("Vultr instance doesn't exist, assuming it is already deleted")
+		}
+	}
+	if d.CreatedSSHKeyID != "" {
+		if err := client.DeleteSSHKey(d.CreatedSSHKeyID); err != nil {
+			if !isNotFound(err) {
+				return err
+			}
+			log.Infof("Vultr SSH key doesn't exist, assuming it is already deleted")
+		}
+	}
+	return nil
+}
+
+func (d *Driver) getClient() *Client {
+	return NewClient(d.APIKey)
+}
+
+func (d *Driver) getTags() []string {
+	var tagList []string
+
+	for _, t := range strings.Split(d.Tags, ",") {
+		t = strings.TrimSpace(t)
+		if t != "" {
+			tagList = append(tagList, t)
+		}
+	}
+
+	return tagList
+}
+
+func (d *Driver) GetSSHKeyPath() string {
+	if d.SSHKey != "" {
+		d.SSHKeyPath = d.ResolveStorePath(path.Base(d.SSHKey))
+	} else if d.SSHKeyPath == "" && d.SSHKeyID == "" {
+		d.SSHKeyPath = d.ResolveStorePath("id_rsa")
+	}
+	return d.SSHKeyPath
+}
+
+func (d *Driver) publicSSHKeyPath() string {
+	return d.GetSSHKeyPath() + ".pub"
+}
+
+func copySSHKey(src, dst string) error {
+	if err := mcnutils.CopyFile(src, dst); err != nil {
+		return fmt.Errorf("unable to copy ssh key: %s", err)
+	}
+
+	if err := os.Chmod(dst, 0600); err != nil {
+		return fmt.Errorf("unable to set permissions on the ssh key: %s", err)
+	}
+
+	return nil
+}
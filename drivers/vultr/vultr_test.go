@@ -0,0 +1,112 @@
+package vultr
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnmarshalJSON(t *testing.T) {
+	driver := NewDriver("", "")
+
+	// Unmarhsal driver configuration from JSON and args.
+	os.Args = append(os.Args, []string{"--vultr-api-key", "test api key"}...)
+
+	driverBytes, err := json.Marshal(driver)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(driverBytes, driver))
+
+	// Make sure that config has been pulled in from envvars and args.
+	assert.Equal(t, "test api key", driver.APIKey)
+}
+
+func TestSetConfigFromFlags(t *testing.T) {
+	driver := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"vultr-api-key": "KEY",
+			"vultr-vpc":     []string{"vpc-1"},
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	err := driver.SetConfigFromFlags(checkFlags)
+
+	assert.NoError(t, err)
+	assert.Empty(t, checkFlags.InvalidFlags)
+	assert.Equal(t, 1743, driver.OSID)
+	assert.Equal(t, "ewr", driver.Region)
+	assert.Equal(t, "vc2-1c-1gb", driver.Plan)
+	assert.Equal(t, []string{"vpc-1"}, driver.VPCs)
+	assert.Equal(t, driver.ResolveStorePath("id_rsa"), driver.GetSSHKeyPath())
+
+	sshPort, err := driver.GetSSHPort()
+	assert.NoError(t, err)
+	assert.Equal(t, "root", driver.GetSSHUsername())
+	assert.Equal(t, 22, sshPort)
+}
+
+func TestCreateRequest(t *testing.T) {
+	userdata := filepath.Join(t.TempDir(), "cloud-init.yaml")
+	assert.NoError(t, os.WriteFile(userdata, []byte("#cloud-config\n"), 0600))
+
+	driver := NewDriver("default", "path")
+	driver.Snapshot = "snap-1"
+	driver.VPCs = []string{"vpc-1"}
+	driver.Backups = true
+	driver.UserDataFile = userdata
+	driver.Tags = "rancher, test"
+
+	request, err := driver.createRequest()
+	assert.NoError(t, err)
+	assert.Equal(t, &InstanceCreateRequest{
+		Region:     "ewr",
+		Plan:       "vc2-1c-1gb",
+		SnapshotID: "snap-1",
+		Label:      "default",
+		Hostname:   "default",
+		AttachVPC:  []string{"vpc-1"},
+		UserData:   "I2Nsb3VkLWNvbmZpZwo=",
+		Backups:    "enabled",
+		Tags:       []string{"rancher", "test"},
+	}, request)
+
+	// The OS is installed unless a snapshot is restored.
+	driver = NewDriver("default", "path")
+	request, err = driver.createRequest()
+	assert.NoError(t, err)
+	assert.Equal(t, 1743, request.OSID)
+	assert.Empty(t, request.SnapshotID)
+}
+
+func TestInstanceState(t *testing.T) {
+	for _, tc := range []struct {
+		status, powerStatus string
+		expected            state.State
+	}{
+		{"pending", "running", state.Starting},
+		{"active", "running", state.Running},
+		{"active", "stopped", state.Stopped},
+		{"suspended", "stopped", state.None},
+	} {
+		assert.Equal(t, tc.expected, instanceState(&Instance{Status: tc.status, PowerStatus: tc.powerStatus}), tc.status+" "+tc.powerStatus)
+	}
+}
+
+func TestInstanceAddresses(t *testing.T) {
+	instance := &Instance{MainIP: "1.2.3.4", InternalIP: "10.1.96.3", V6MainIP: "2001:db8::1"}
+	assert.Equal(t, []drivers.NetworkAddress{
+		{Kind: drivers.AddressPublic, Address: "1.2.3.4"},
+		{Kind: drivers.AddressPrivate, Address: "10.1.96.3"},
+		{Kind: drivers.AddressIPv6, Address: "2001:db8::1"},
+	}, instanceAddresses(instance))
+
+	// The main IP is unassigned until the instance is up.
+	assert.Empty(t, instanceAddresses(&Instance{MainIP: unassignedIP}))
+}
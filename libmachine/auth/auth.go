@@ -1,5 +1,7 @@
 package auth
 
+import "time"
+
 type Options struct {
 	CertDir              string
 	CaCertPath           string
@@ -12,6 +14,11 @@ type Options struct {
 	ServerKeyRemotePath  string
 	ClientCertPath       string
 	ServerCertSANs       []string
+	// ServerCertValidity and ServerCertKeyUsages replace the defaults of
+	// the server certificates when set, the usages being named like in
+	// cert.ParseKeyUsages.
+	ServerCertValidity  time.Duration `json:",omitempty"`
+	ServerCertKeyUsages []string      `json:",omitempty"`
 	// StorePath is left in for historical reasons, but not really meant to
 	// be used directly.
 	StorePath string
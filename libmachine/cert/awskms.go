@@ -0,0 +1,117 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+)
+
+func init() {
+	RegisterSigner("awskms", openKMSSigner)
+}
+
+// kmsSigningAlgorithms maps the kinds of signatures to the KMS signing
+// algorithms, for each hash.
+var kmsSigningAlgorithms = map[string]map[crypto.Hash]string{
+	"rsa": {
+		crypto.SHA256: kms.SigningAlgorithmSpecRsassaPkcs1V15Sha256,
+		crypto.SHA384: kms.SigningAlgorithmSpecRsassaPkcs1V15Sha384,
+		crypto.SHA512: kms.SigningAlgorithmSpecRsassaPkcs1V15Sha512,
+	},
+	"rsa-pss": {
+		crypto.SHA256: kms.SigningAlgorithmSpecRsassaPssSha256,
+		crypto.SHA384: kms.SigningAlgorithmSpecRsassaPssSha384,
+		crypto.SHA512: kms.SigningAlgorithmSpecRsassaPssSha512,
+	},
+	"ecdsa": {
+		crypto.SHA256: kms.SigningAlgorithmSpecEcdsaSha256,
+		crypto.SHA384: kms.SigningAlgorithmSpecEcdsaSha384,
+		crypto.SHA512: kms.SigningAlgorithmSpecEcdsaSha512,
+	},
+}
+
+// kmsSigner signs with an asymmetric key of AWS KMS, which never leaves it.
+// The CA keys "awskms:<key ID, ARN or alias>" are opened with it, with the
+// credentials and the region of the AWS environment, or the region of the ARN.
+type kmsSigner struct {
+	client kmsiface.KMSAPI
+	keyID  string
+	public crypto.PublicKey
+}
+
+func openKMSSigner(location string) (crypto.Signer, error) {
+	config := aws.NewConfig()
+	if keyARN, err := arn.Parse(location); err == nil {
+		config = config.WithRegion(keyARN.Region)
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *config,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newKMSSigner(kms.New(sess), location)
+}
+
+func newKMSSigner(client kmsiface.KMSAPI, keyID string) (*kmsSigner, error) {
+	out, err := client.GetPublicKey(&kms.GetPublicKeyInput{KeyId: aws.String(keyID)})
+	if err != nil {
+		return nil, err
+	}
+	if aws.StringValue(out.KeyUsage) != kms.KeyUsageTypeSignVerify {
+		return nil, fmt.Errorf("the KMS key %s is not a signing key", keyID)
+	}
+
+	public, err := x509.ParsePKIXPublicKey(out.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &kmsSigner{client: client, keyID: keyID, public: public}, nil
+}
+
+func (s *kmsSigner) Public() crypto.PublicKey {
+	return s.public
+}
+
+func (s *kmsSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var kind string
+	switch s.public.(type) {
+	case *rsa.PublicKey:
+		kind = "rsa"
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			kind = "rsa-pss"
+		}
+	case *ecdsa.PublicKey:
+		kind = "ecdsa"
+	default:
+		return nil, fmt.Errorf("unsupported KMS key type %T", s.public)
+	}
+
+	algorithm, ok := kmsSigningAlgorithms[kind][opts.HashFunc()]
+	if !ok {
+		return nil, fmt.Errorf("KMS cannot sign %s digests with %s keys", opts.HashFunc(), strings.ToUpper(kind))
+	}
+
+	out, err := s.client.Sign(&kms.SignInput{
+		KeyId:            aws.String(s.keyID),
+		Message:          digest,
+		MessageType:      aws.String(kms.MessageTypeDigest),
+		SigningAlgorithm: aws.String(algorithm),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Signature, nil
+}
@@ -14,6 +14,10 @@ func createCACert(authOptions *auth.Options, caOrg string, bits int) error {
 	caCertPath := authOptions.CaCertPath
 	caPrivateKeyPath := authOptions.CaPrivateKeyPath
 
+	if IsRemoteKey(caPrivateKeyPath) {
+		return fmt.Errorf("the CA certificate %s must be given with the CA key %s, which machine cannot generate", caCertPath, caPrivateKeyPath)
+	}
+
 	log.Infof("Creating CA: %s", caCertPath)
 
 	// check if the key path exists; if so, error
@@ -25,7 +29,7 @@ func createCACert(authOptions *auth.Options, caOrg string, bits int) error {
 		return fmt.Errorf("generating CA certificate failed: %s", err)
 	}
 
-	return nil
+	return encryptKeyFile(caPrivateKeyPath)
 }
 
 func createCert(authOptions *auth.Options, org string, bits int) error {
@@ -106,6 +110,14 @@ func BootstrapCertificates(authOptions *auth.Options) error {
 			return err
 		}
 		if !current {
+			intermediate, err := intermediateCA(caCertPath)
+			if err != nil {
+				return err
+			}
+			if intermediate {
+				return fmt.Errorf("the CA certificate %s is outdated and signed by another CA, renew it with its issuer", caCertPath)
+			}
+
 			log.Info("CA certificate is outdated and needs to be regenerated")
 			os.Remove(caPrivateKeyPath)
 			if err := createCACert(authOptions, caOrg, bits); err != nil {
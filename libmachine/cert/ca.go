@@ -0,0 +1,125 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rancher/machine/libmachine/auth"
+)
+
+// loadCA returns the CA of opts, from its PEM or its files, the key file
+// possibly being kept by a signer instead.
+func loadCA(opts *Options) (tls.Certificate, error) {
+	if len(opts.CACertPEM) > 0 {
+		return tls.X509KeyPair(opts.CACertPEM, opts.CAKeyPEM)
+	}
+
+	certPEM, err := os.ReadFile(opts.CAFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	signer, err := OpenCASigner(opts.CAKeyFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return caWithSigner(certPEM, signer)
+}
+
+// caChain returns the intermediate CAs of the certificates of ca, to bundle
+// into the certificates it signs. The roots are left out, as the clients
+// trust them already.
+func caChain(ca tls.Certificate) ([][]byte, error) {
+	var chain [][]byte
+	for _, der := range ca.Certificate {
+		certificate, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		if !selfSigned(certificate) {
+			chain = append(chain, der)
+		}
+	}
+	return chain, nil
+}
+
+func selfSigned(certificate *x509.Certificate) bool {
+	return bytes.Equal(certificate.RawIssuer, certificate.RawSubject) && certificate.CheckSignatureFrom(certificate) == nil
+}
+
+// ValidateCA fails unless certPEM is a CA certificate valid now and matching
+// keyPEM, followed by the chain of the CAs signing it if it is an
+// intermediate CA, each certificate being signed by the next one.
+func ValidateCA(certPEM, keyPEM []byte) error {
+	ca, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("invalid CA: %s", err)
+	}
+
+	certs := make([]*x509.Certificate, len(ca.Certificate))
+	for i, der := range ca.Certificate {
+		if certs[i], err = x509.ParseCertificate(der); err != nil {
+			return fmt.Errorf("invalid CA certificate: %s", err)
+		}
+	}
+
+	if !certs[0].IsCA || certs[0].KeyUsage&x509.KeyUsageCertSign == 0 {
+		return fmt.Errorf("the certificate of %q is not a CA certificate", certs[0].Subject)
+	}
+
+	now := time.Now()
+	for i, certificate := range certs {
+		if now.Before(certificate.NotBefore) || now.After(certificate.NotAfter) {
+			return fmt.Errorf("the CA certificate of %q is not valid now", certificate.Subject)
+		}
+		if i == 0 || selfSigned(certs[i-1]) {
+			continue
+		}
+		if err := certs[i-1].CheckSignatureFrom(certificate); err != nil {
+			return fmt.Errorf("the CA certificate of %q is not signed by the next one in the chain, %q: %s", certs[i-1].Subject, certificate.Subject, err)
+		}
+	}
+	return nil
+}
+
+// ImportCA makes the machines of authOptions use the operator's CA instead of
+// the one BootstrapCertificates generates: the CA certificate, possibly an
+// intermediate CA followed by its chain, and its key are validated and
+// written to the CA paths.
+func ImportCA(authOptions *auth.Options, certPEM, keyPEM []byte) error {
+	if err := ValidateCA(certPEM, keyPEM); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(authOptions.CaCertPath), 0700); err != nil {
+		return fmt.Errorf("creating machine certificate dir failed: %s", err)
+	}
+	if err := os.WriteFile(authOptions.CaCertPath, certPEM, 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(authOptions.CaPrivateKeyPath, keyPEM, 0600)
+}
+
+// intermediateCA tells whether the CA certificate at path is signed by another
+// CA, which machine cannot regenerate.
+func intermediateCA(path string) (bool, error) {
+	certPEM, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return false, errors.New("Failed to decode PEM data")
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false, err
+	}
+	return !selfSigned(certificate), nil
+}
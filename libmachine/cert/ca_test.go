@@ -0,0 +1,141 @@
+package cert
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rancher/machine/libmachine/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestCA returns a CA certificate and its key as PEM, signed by the parent
+// CA, or self-signed when parent is nil.
+func newTestCA(t *testing.T, name string, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey, []byte, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certificate, key,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+func TestGenerateCertWithIntermediateCA(t *testing.T) {
+	tmpDir := t.TempDir()
+	root, rootKey, rootPEM, _ := newTestCA(t, "root", nil, nil)
+	intermediate, _, intermediatePEM, intermediateKeyPEM := newTestCA(t, "intermediate", root, rootKey)
+	chainPEM := append(intermediatePEM, rootPEM...)
+
+	assert.NoError(t, ValidateCA(chainPEM, intermediateKeyPEM))
+
+	authOptions := &auth.Options{
+		CaCertPath:       filepath.Join(tmpDir, "certs", "ca.pem"),
+		CaPrivateKeyPath: filepath.Join(tmpDir, "certs", "ca-key.pem"),
+	}
+	if err := ImportCA(authOptions, chainPEM, intermediateKeyPEM); err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	for _, opts := range []*Options{
+		{CAFile: authOptions.CaCertPath, CAKeyFile: authOptions.CaPrivateKeyPath},
+		{CACertPEM: chainPEM, CAKeyPEM: intermediateKeyPEM},
+	} {
+		opts.Hosts = []string{"192.168.99.100"}
+		opts.CertFile = filepath.Join(tmpDir, "server.pem")
+		opts.KeyFile = filepath.Join(tmpDir, "server-key.pem")
+		opts.Org = "test-org"
+		opts.Bits = 2048
+		if err := GenerateCert(opts); err != nil {
+			t.Fatal(err)
+		}
+
+		// The server certificate is bundled with the intermediate CA, which
+		// the clients trusting the root only need to verify it.
+		bundle := readCerts(t, opts.CertFile)
+		if assert.Len(t, bundle, 2) {
+			assert.Equal(t, intermediate, bundle[1])
+
+			intermediates := x509.NewCertPool()
+			intermediates.AddCert(bundle[1])
+			_, err := bundle[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+			assert.NoError(t, err)
+		}
+	}
+
+	// The client certificates are not bundled.
+	clientCert := filepath.Join(tmpDir, "cert.pem")
+	if err := GenerateCert(&Options{
+		Hosts:     []string{""},
+		CertFile:  clientCert,
+		KeyFile:   filepath.Join(tmpDir, "key.pem"),
+		CACertPEM: chainPEM,
+		CAKeyPEM:  intermediateKeyPEM,
+		Org:       "test-org",
+		Bits:      2048,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, readCerts(t, clientCert), 1)
+}
+
+func TestValidateCA(t *testing.T) {
+	root, rootKey, rootPEM, rootKeyPEM := newTestCA(t, "root", nil, nil)
+	_, _, intermediatePEM, intermediateKeyPEM := newTestCA(t, "intermediate", root, rootKey)
+	_, _, otherPEM, _ := newTestCA(t, "other", nil, nil)
+
+	assert.NoError(t, ValidateCA(rootPEM, rootKeyPEM))
+	assert.NoError(t, ValidateCA(intermediatePEM, intermediateKeyPEM))
+
+	assert.Error(t, ValidateCA(rootPEM, intermediateKeyPEM))
+	assert.EqualError(t, ValidateCA(append(intermediatePEM, otherPEM...), intermediateKeyPEM),
+		`the CA certificate of "CN=intermediate" is not signed by the next one in the chain, "CN=other": crypto/rsa: verification error`)
+
+	tmpDir := t.TempDir()
+	serverCert := filepath.Join(tmpDir, "server.pem")
+	serverKey := filepath.Join(tmpDir, "server-key.pem")
+	if err := GenerateCert(&Options{
+		Hosts:     []string{"localhost"},
+		CertFile:  serverCert,
+		KeyFile:   serverKey,
+		CACertPEM: rootPEM,
+		CAKeyPEM:  rootKeyPEM,
+		Org:       "test-org",
+		Bits:      2048,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	serverPEM, _ := os.ReadFile(serverCert)
+	serverKeyPEM, _ := os.ReadFile(serverKey)
+	assert.EqualError(t, ValidateCA(serverPEM, serverKeyPEM), `the certificate of "O=test-org" is not a CA certificate`)
+}
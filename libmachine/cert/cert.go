@@ -8,6 +8,7 @@ import (
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"errors"
+	"fmt"
 	"math/big"
 	"net"
 	"net/http"
@@ -15,7 +16,9 @@ import (
 	"time"
 
 	"github.com/rancher/machine/libmachine/auth"
+	"github.com/rancher/machine/libmachine/fips"
 	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/mcnutils"
 )
 
 var defaultGenerator = NewX509CertGenerator()
@@ -23,10 +26,23 @@ var defaultGenerator = NewX509CertGenerator()
 type Options struct {
 	Hosts                                     []string
 	CertFile, KeyFile, CAFile, CAKeyFile, Org string
-	Bits                                      int
-	SwarmMaster                               bool
+	// CACertPEM and CAKeyPEM give the CA instead of CAFile and CAKeyFile.
+	// Either way, the CA certificate may be an intermediate CA followed by
+	// its chain, which is bundled into the server certificates.
+	CACertPEM, CAKeyPEM []byte
+	Bits                int
+	SwarmMaster         bool
+	// Validity replaces DefaultValidity when set. KeyUsage and ExtKeyUsage
+	// replace the key usages of the server certificates when set.
+	Validity    time.Duration
+	KeyUsage    x509.KeyUsage
+	ExtKeyUsage []x509.ExtKeyUsage
 }
 
+// DefaultValidity is the validity of the certificates, unless their Options
+// give another one.
+const DefaultValidity = 1080 * 24 * time.Hour
+
 type Generator interface {
 	GenerateCACertificate(certFile, keyFile, org string, bits int) error
 	GenerateCert(opts *Options) error
@@ -78,15 +94,45 @@ func (xcg *X509CertGenerator) getTLSConfig(caCert, cert, key []byte, allowInsecu
 	}
 	tlsConfig.Certificates = []tls.Certificate{keypair}
 
+	if fips.Enabled() {
+		fips.RestrictTLSConfig(&tlsConfig)
+	}
+
 	return &tlsConfig, nil
 }
 
+// checkFIPSCertificates fails when one of the PEM encoded certificates read
+// from path does not use FIPS-approved algorithms.
+func checkFIPSCertificates(path string, certsPEM []byte) error {
+	for block, rest := pem.Decode(certsPEM); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return err
+		}
+		if err := fips.CheckCertificate(cert); err != nil {
+			return fmt.Errorf("the certificate %s is not FIPS-approved, regenerate it: %s", path, err)
+		}
+	}
+	return nil
+}
+
+// checkFIPSBits fails when RSA keys of the size are not FIPS-approved.
+func checkFIPSBits(bits int) error {
+	if fips.Enabled() && bits < fips.MinRSABits {
+		return fmt.Errorf("%d-bit RSA keys are not FIPS-approved, use %d bits or more", bits, fips.MinRSABits)
+	}
+	return nil
+}
+
 func (xcg *X509CertGenerator) newCertificate(org string) (*x509.Certificate, error) {
 	now := time.Now()
 	// need to set notBefore slightly in the past to account for time
 	// skew in the VMs otherwise the certs sometimes are not yet valid
 	notBefore := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute()-5, 0, 0, time.Local)
-	notAfter := notBefore.Add(time.Hour * 24 * 1080)
+	notAfter := notBefore.Add(DefaultValidity)
 
 	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
 	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
@@ -122,6 +168,10 @@ func (xcg *X509CertGenerator) GenerateCACertificate(certFile, keyFile, org strin
 	template.KeyUsage |= x509.KeyUsageKeyEncipherment
 	template.KeyUsage |= x509.KeyUsageKeyAgreement
 
+	if err := checkFIPSBits(bits); err != nil {
+		return err
+	}
+
 	priv, err := rsa.GenerateKey(rand.Reader, bits)
 	if err != nil {
 		return err
@@ -161,19 +211,29 @@ func (xcg *X509CertGenerator) GenerateCert(opts *Options) error {
 	if err != nil {
 		return err
 	}
-	// client
-	if len(opts.Hosts) == 1 && opts.Hosts[0] == "" {
+	if opts.Validity > 0 {
+		template.NotAfter = template.NotBefore.Add(opts.Validity)
+	}
+	client := len(opts.Hosts) == 1 && opts.Hosts[0] == ""
+	if client {
 		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
 		template.KeyUsage = x509.KeyUsageDigitalSignature
 	} else { // server
 		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
-		if opts.SwarmMaster {
+		if opts.KeyUsage != 0 {
+			template.KeyUsage = opts.KeyUsage
+		}
+		if len(opts.ExtKeyUsage) > 0 {
+			template.ExtKeyUsage = append([]x509.ExtKeyUsage{}, opts.ExtKeyUsage...)
+		}
+		if opts.SwarmMaster && !hasExtKeyUsage(template.ExtKeyUsage, x509.ExtKeyUsageClientAuth) {
 			// Extend the Swarm master's server certificate
 			// permissions to also be able to connect to downstream
 			// nodes as a client.
 			template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageClientAuth)
 		}
 		for _, h := range opts.Hosts {
+			h = mcnutils.UnbracketHost(h)
 			if ip := net.ParseIP(h); ip != nil {
 				template.IPAddresses = append(template.IPAddresses, ip)
 			} else {
@@ -182,11 +242,15 @@ func (xcg *X509CertGenerator) GenerateCert(opts *Options) error {
 		}
 	}
 
-	tlsCert, err := tls.LoadX509KeyPair(opts.CAFile, opts.CAKeyFile)
+	tlsCert, err := loadCA(opts)
 	if err != nil {
 		return err
 	}
 
+	if err := checkFIPSBits(opts.Bits); err != nil {
+		return err
+	}
+
 	priv, err := rsa.GenerateKey(rand.Reader, opts.Bits)
 	if err != nil {
 		return err
@@ -196,6 +260,11 @@ func (xcg *X509CertGenerator) GenerateCert(opts *Options) error {
 	if err != nil {
 		return err
 	}
+	if fips.Enabled() {
+		if err := fips.CheckCertificate(x509Cert); err != nil {
+			return fmt.Errorf("the CA certificate %s is not FIPS-approved, regenerate it: %s", opts.CAFile, err)
+		}
+	}
 
 	derBytes, err := x509.CreateCertificate(rand.Reader, template, x509Cert, &priv.PublicKey, tlsCert.PrivateKey)
 	if err != nil {
@@ -208,6 +277,18 @@ func (xcg *X509CertGenerator) GenerateCert(opts *Options) error {
 	}
 
 	pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
+	if !client {
+		// The clients trusting the root CA only verify the server with
+		// the intermediate CAs it presents.
+		chain, err := caChain(tlsCert)
+		if err != nil {
+			certOut.Close()
+			return err
+		}
+		for _, der := range chain {
+			pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+		}
+	}
 	certOut.Close()
 
 	keyOut, err := os.OpenFile(opts.KeyFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
@@ -248,6 +329,15 @@ func (xcg *X509CertGenerator) ReadTLSConfig(addr string, authOptions *auth.Optio
 		return nil, err
 	}
 
+	if fips.Enabled() {
+		if err := checkFIPSCertificates(caCertPath, caCert); err != nil {
+			return nil, err
+		}
+		if err := checkFIPSCertificates(clientCertPath, clientCert); err != nil {
+			return nil, err
+		}
+	}
+
 	return xcg.getTLSConfig(caCert, clientCert, clientKey, false)
 }
 
@@ -1,9 +1,17 @@
 package cert
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/rancher/machine/libmachine/auth"
+	"github.com/rancher/machine/libmachine/fips"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestGenerateCACertificate(t *testing.T) {
@@ -78,3 +86,179 @@ func TestGenerateCert(t *testing.T) {
 		t.Fatalf("key not created at %s", keyPath)
 	}
 }
+
+func TestGenerateCertIPv6SANs(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	caCertPath := filepath.Join(tmpDir, "ca.pem")
+	caKeyPath := filepath.Join(tmpDir, "key.pem")
+	certPath := filepath.Join(tmpDir, "cert.pem")
+	if err := GenerateCACertificate(caCertPath, caKeyPath, "test-org", 2048); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &Options{
+		Hosts:     []string{"[2001:db8::1]", "192.168.99.100", "localhost"},
+		CertFile:  certPath,
+		CAKeyFile: caKeyPath,
+		CAFile:    caCertPath,
+		KeyFile:   filepath.Join(tmpDir, "cert-key.pem"),
+		Org:       "test-org",
+		Bits:      2048,
+	}
+	if err := GenerateCert(opts); err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(certPEM)
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(certificate.IPAddresses) != 2 || certificate.IPAddresses[0].String() != "2001:db8::1" || certificate.IPAddresses[1].String() != "192.168.99.100" {
+		t.Fatalf("unexpected IP SANs %v", certificate.IPAddresses)
+	}
+	if len(certificate.DNSNames) != 1 || certificate.DNSNames[0] != "localhost" {
+		t.Fatalf("unexpected DNS SANs %v", certificate.DNSNames)
+	}
+}
+
+func TestGenerateCertValidityAndKeyUsage(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	caCertPath := filepath.Join(tmpDir, "ca.pem")
+	caKeyPath := filepath.Join(tmpDir, "key.pem")
+	certPath := filepath.Join(tmpDir, "cert.pem")
+	if err := GenerateCACertificate(caCertPath, caKeyPath, "test-org", 2048); err != nil {
+		t.Fatal(err)
+	}
+
+	keyUsage, extKeyUsage, err := ParseKeyUsages([]string{"digital-signature", "server-auth"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &Options{
+		Hosts:       []string{"lb.example.com", "10.0.0.5"},
+		CertFile:    certPath,
+		CAKeyFile:   caKeyPath,
+		CAFile:      caCertPath,
+		KeyFile:     filepath.Join(tmpDir, "cert-key.pem"),
+		Org:         "test-org",
+		Bits:        2048,
+		SwarmMaster: true,
+		Validity:    90 * 24 * time.Hour,
+		KeyUsage:    keyUsage,
+		ExtKeyUsage: extKeyUsage,
+	}
+	if err := GenerateCert(opts); err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(certPEM)
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 90*24*time.Hour, certificate.NotAfter.Sub(certificate.NotBefore))
+	assert.Equal(t, x509.KeyUsageDigitalSignature, certificate.KeyUsage)
+	assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}, certificate.ExtKeyUsage)
+	assert.Equal(t, []string{"lb.example.com"}, certificate.DNSNames)
+}
+
+func TestParseKeyUsages(t *testing.T) {
+	keyUsage, extKeyUsage, err := ParseKeyUsages(nil)
+	assert.NoError(t, err)
+	assert.Zero(t, keyUsage)
+	assert.Empty(t, extKeyUsage)
+
+	keyUsage, extKeyUsage, err = ParseKeyUsages([]string{"key-encipherment", "key-agreement", "client-auth", "server-auth", "client-auth"})
+	assert.NoError(t, err)
+	assert.Equal(t, x509.KeyUsageKeyEncipherment|x509.KeyUsageKeyAgreement, keyUsage)
+	assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth}, extKeyUsage)
+
+	_, _, err = ParseKeyUsages([]string{"client-auth"})
+	assert.EqualError(t, err, "the server certificates need the server-auth key usage")
+
+	_, _, err = ParseKeyUsages([]string{"cert-sign"})
+	assert.EqualError(t, err, `unknown key usage "cert-sign", expected client-auth, content-commitment, data-encipherment, digital-signature, key-agreement, key-encipherment, server-auth`)
+}
+
+func TestFIPSCertificates(t *testing.T) {
+	if fips.Enabled() {
+		t.Skip("the certificates of the machines created before cannot be generated in the FIPS mode")
+	}
+	tmpDir := t.TempDir()
+	authOptions := &auth.Options{
+		CaCertPath:       filepath.Join(tmpDir, "ca.pem"),
+		CaPrivateKeyPath: filepath.Join(tmpDir, "ca-key.pem"),
+		ClientCertPath:   filepath.Join(tmpDir, "cert.pem"),
+		ClientKeyPath:    filepath.Join(tmpDir, "key.pem"),
+	}
+
+	// The certificates of a machine created before with small keys.
+	if err := GenerateCACertificate(authOptions.CaCertPath, authOptions.CaPrivateKeyPath, "test-org", 1024); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenerateCert(&Options{
+		Hosts:     []string{""},
+		CertFile:  authOptions.ClientCertPath,
+		KeyFile:   authOptions.ClientKeyPath,
+		CAFile:    authOptions.CaCertPath,
+		CAKeyFile: authOptions.CaPrivateKeyPath,
+		Org:       "test-org",
+		Bits:      2048,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(fips.EnvVar, "1")
+
+	_, err := ReadTLSConfig("", authOptions)
+	assert.EqualError(t, err, "the certificate "+authOptions.CaCertPath+" is not FIPS-approved, regenerate it: 1024-bit RSA keys are not FIPS-approved, use 2048 bits or more")
+
+	err = GenerateCACertificate(filepath.Join(tmpDir, "ca2.pem"), filepath.Join(tmpDir, "ca2-key.pem"), "test-org", 1024)
+	assert.EqualError(t, err, "1024-bit RSA keys are not FIPS-approved, use 2048 bits or more")
+
+	err = GenerateCert(&Options{
+		Hosts:     []string{"10.0.0.4"},
+		CertFile:  filepath.Join(tmpDir, "server.pem"),
+		KeyFile:   filepath.Join(tmpDir, "server-key.pem"),
+		CAFile:    authOptions.CaCertPath,
+		CAKeyFile: authOptions.CaPrivateKeyPath,
+		Org:       "test-org",
+		Bits:      2048,
+	})
+	assert.EqualError(t, err, "the CA certificate "+authOptions.CaCertPath+" is not FIPS-approved, regenerate it: 1024-bit RSA keys are not FIPS-approved, use 2048 bits or more")
+}
+
+func TestFIPSTLSConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	authOptions := &auth.Options{
+		CertDir:          tmpDir,
+		CaCertPath:       filepath.Join(tmpDir, "ca.pem"),
+		CaPrivateKeyPath: filepath.Join(tmpDir, "ca-key.pem"),
+		ClientCertPath:   filepath.Join(tmpDir, "cert.pem"),
+		ClientKeyPath:    filepath.Join(tmpDir, "key.pem"),
+	}
+	t.Setenv(fips.EnvVar, "1")
+
+	if err := BootstrapCertificates(authOptions); err != nil {
+		t.Fatal(err)
+	}
+
+	tlsConfig, err := ReadTLSConfig("", authOptions)
+	assert.NoError(t, err)
+	assert.Equal(t, fips.CipherSuites, tlsConfig.CipherSuites)
+	assert.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+}
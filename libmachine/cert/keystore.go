@@ -0,0 +1,122 @@
+package cert
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// CAKeyPassphraseEnv is the environment variable giving the passphrase of the
+// encrypted CA key files. The CA keys machine generates are encrypted with it
+// when it is set.
+const CAKeyPassphraseEnv = "MACHINE_CA_KEY_PASSPHRASE"
+
+// encryptedKeyBlockType is the PEM type of the encrypted key files: the DER
+// of the key, sealed with AES-256-GCM under a key derived from the passphrase
+// with scrypt.
+const encryptedKeyBlockType = "MACHINE ENCRYPTED PRIVATE KEY"
+
+// The scrypt parameters recommended for interactive logins.
+const (
+	scryptN      = 32768
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+)
+
+// EncryptKey returns the PEM private key encrypted with the passphrase, for
+// the CA key to be kept encrypted on disk.
+func EncryptKey(keyPEM, passphrase []byte) ([]byte, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("the key is not PEM encoded")
+	}
+	if block.Type == encryptedKeyBlockType {
+		return nil, errors.New("the key is encrypted already")
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := keystoreCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type: encryptedKeyBlockType,
+		Headers: map[string]string{
+			"Salt":  hex.EncodeToString(salt),
+			"Nonce": hex.EncodeToString(nonce),
+		},
+		Bytes: aead.Seal(nil, nonce, block.Bytes, nil),
+	}), nil
+}
+
+// decryptKey returns the DER key of the encrypted key block.
+func decryptKey(block *pem.Block, passphrase []byte) ([]byte, error) {
+	salt, err := hex.DecodeString(block.Headers["Salt"])
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hex.DecodeString(block.Headers["Nonce"])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := keystoreCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid nonce")
+	}
+
+	der, err := aead.Open(nil, nonce, block.Bytes, nil)
+	if err != nil {
+		return nil, errors.New("wrong passphrase")
+	}
+	return der, nil
+}
+
+func keystoreCipher(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptKeyFile encrypts the key file at path in place when the CA key
+// passphrase is set.
+func encryptKeyFile(path string) error {
+	passphrase := os.Getenv(CAKeyPassphraseEnv)
+	if passphrase == "" {
+		return nil
+	}
+
+	keyPEM, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	encrypted, err := EncryptKey(keyPEM, []byte(passphrase))
+	if err != nil {
+		return fmt.Errorf("encrypting the CA key %s failed: %s", path, err)
+	}
+	return os.WriteFile(path, encrypted, 0600)
+}
@@ -0,0 +1,70 @@
+package cert
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// keyUsages and extKeyUsages name the key usages of the server certificates.
+var (
+	keyUsages = map[string]x509.KeyUsage{
+		"digital-signature":  x509.KeyUsageDigitalSignature,
+		"content-commitment": x509.KeyUsageContentCommitment,
+		"key-encipherment":   x509.KeyUsageKeyEncipherment,
+		"data-encipherment":  x509.KeyUsageDataEncipherment,
+		"key-agreement":      x509.KeyUsageKeyAgreement,
+	}
+	extKeyUsages = map[string]x509.ExtKeyUsage{
+		"server-auth": x509.ExtKeyUsageServerAuth,
+		"client-auth": x509.ExtKeyUsageClientAuth,
+	}
+)
+
+// ParseKeyUsages returns the key usages and the extended key usages of the
+// named usages of a server certificate, like "digital-signature" or
+// "client-auth". Either is zero when no name is of its kind, for the default
+// to be kept.
+func ParseKeyUsages(names []string) (x509.KeyUsage, []x509.ExtKeyUsage, error) {
+	var keyUsage x509.KeyUsage
+	var extKeyUsage []x509.ExtKeyUsage
+	for _, name := range names {
+		if usage, ok := keyUsages[name]; ok {
+			keyUsage |= usage
+		} else if usage, ok := extKeyUsages[name]; ok {
+			if !hasExtKeyUsage(extKeyUsage, usage) {
+				extKeyUsage = append(extKeyUsage, usage)
+			}
+		} else {
+			return 0, nil, fmt.Errorf("unknown key usage %q, expected %s", name, strings.Join(keyUsageNames(), ", "))
+		}
+	}
+
+	if len(extKeyUsage) > 0 && !hasExtKeyUsage(extKeyUsage, x509.ExtKeyUsageServerAuth) {
+		return 0, nil, errors.New("the server certificates need the server-auth key usage")
+	}
+	return keyUsage, extKeyUsage, nil
+}
+
+func keyUsageNames() []string {
+	var names []string
+	for name := range keyUsages {
+		names = append(names, name)
+	}
+	for name := range extKeyUsages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func hasExtKeyUsage(usages []x509.ExtKeyUsage, usage x509.ExtKeyUsage) bool {
+	for _, u := range usages {
+		if u == usage {
+			return true
+		}
+	}
+	return false
+}
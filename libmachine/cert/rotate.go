@@ -0,0 +1,176 @@
+package cert
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rancher/machine/libmachine/auth"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/mcnutils"
+)
+
+// The files of a CA rotation, next to the CA certificate: the new CA, and a
+// copy of the previous CA certificate the clients and the engines trust until
+// the rotation ends.
+const (
+	nextCACertFile     = "ca-next.pem"
+	nextCAKeyFile      = "ca-next-key.pem"
+	previousCACertFile = "ca-previous.pem"
+)
+
+var errNoCARotation = errors.New("no CA rotation is in progress, start one first")
+
+func caRotationPaths(authOptions *auth.Options) (nextCert, nextKey, previousCert string) {
+	dir := filepath.Dir(authOptions.CaCertPath)
+	return filepath.Join(dir, nextCACertFile), filepath.Join(dir, nextCAKeyFile), filepath.Join(dir, previousCACertFile)
+}
+
+// NextCA returns the paths of the certificate and the key of the CA the
+// rotation in progress rotates the CA of authOptions to.
+func NextCA(authOptions *auth.Options) (certPath, keyPath string) {
+	certPath, keyPath, _ = caRotationPaths(authOptions)
+	return certPath, keyPath
+}
+
+// StartCARotation generates a new CA, unless a rotation is in progress, and
+// makes the CA certificate file bundle the current and the new CA
+// certificates, for the clients and the engines to trust both. The current
+// CA, first in the bundle, keeps signing the certificates.
+func StartCARotation(authOptions *auth.Options) error {
+	nextCert, nextKey, previousCert := caRotationPaths(authOptions)
+	if _, err := os.Stat(nextCert); err == nil {
+		return nil
+	}
+
+	if IsRemoteKey(authOptions.CaPrivateKeyPath) {
+		return fmt.Errorf("the CA key %s is kept by a signer, which machine cannot rotate", authOptions.CaPrivateKeyPath)
+	}
+
+	intermediate, err := intermediateCA(authOptions.CaCertPath)
+	if err != nil {
+		return err
+	}
+	if intermediate {
+		return fmt.Errorf("the CA certificate %s is signed by another CA, which machine cannot rotate", authOptions.CaCertPath)
+	}
+
+	log.Infof("Creating the new CA: %s", nextCert)
+
+	if err := mcnutils.CopyFile(authOptions.CaCertPath, previousCert); err != nil {
+		return fmt.Errorf("saving the previous CA certificate failed: %s", err)
+	}
+
+	// A new CA key, unlike the certificate, would not be bundled.
+	os.Remove(nextKey)
+	if err := GenerateCACertificate(nextCert, nextKey, mcnutils.GetUsername(), 2048); err != nil {
+		return fmt.Errorf("generating the new CA certificate failed: %s", err)
+	}
+	if err := encryptKeyFile(nextKey); err != nil {
+		return err
+	}
+
+	return bundleCerts(authOptions.CaCertPath, previousCert, nextCert)
+}
+
+// PromoteCA makes the new CA of the rotation in progress sign the
+// certificates, unless it does already. The previous CA stays trusted, second
+// in the bundle, until the rotation ends.
+func PromoteCA(authOptions *auth.Options) error {
+	nextCert, nextKey, previousCert := caRotationPaths(authOptions)
+
+	promoted, err := caPromoted(authOptions)
+	if err != nil || promoted {
+		return err
+	}
+
+	log.Infof("Promoting the new CA: %s", nextCert)
+
+	// The bundle goes first, so that a failure leaves the rotation unpromoted.
+	if err := bundleCerts(authOptions.CaCertPath, nextCert, previousCert); err != nil {
+		return err
+	}
+	if err := mcnutils.CopyFile(nextKey, authOptions.CaPrivateKeyPath); err != nil {
+		return fmt.Errorf("promoting the new CA key failed: %s", err)
+	}
+	return nil
+}
+
+// EndCARotation makes the new CA, promoted already, the only one trusted and
+// removes the files of the rotation. It does nothing if no rotation is in
+// progress.
+func EndCARotation(authOptions *auth.Options) error {
+	nextCert, nextKey, previousCert := caRotationPaths(authOptions)
+
+	promoted, err := caPromoted(authOptions)
+	if err == errNoCARotation {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !promoted {
+		return errors.New("the new CA must sign the certificates of the machines before the CA rotation ends, finish the rotation first")
+	}
+
+	log.Infof("Ending the CA rotation: %s", authOptions.CaCertPath)
+
+	if err := mcnutils.CopyFile(nextCert, authOptions.CaCertPath); err != nil {
+		return fmt.Errorf("replacing the CA certificate failed: %s", err)
+	}
+	for _, path := range []string{nextCert, nextKey, previousCert} {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// caPromoted tells whether the new CA of the rotation in progress signs the
+// certificates already.
+func caPromoted(authOptions *auth.Options) (bool, error) {
+	_, nextKey, _ := caRotationPaths(authOptions)
+
+	next, err := os.ReadFile(nextKey)
+	if os.IsNotExist(err) {
+		return false, errNoCARotation
+	}
+	if err != nil {
+		return false, err
+	}
+
+	current, err := os.ReadFile(authOptions.CaPrivateKeyPath)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(current, next), nil
+}
+
+// bundleCerts writes the certificates at paths to dst, one after the other.
+func bundleCerts(dst string, paths ...string) error {
+	var bundle bytes.Buffer
+	for _, path := range paths {
+		certPEM, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		bundle.Write(bytes.TrimSpace(certPEM))
+		bundle.WriteByte('\n')
+	}
+
+	if err := os.WriteFile(dst, bundle.Bytes(), 0644); err != nil {
+		return fmt.Errorf("writing the CA bundle failed: %s", err)
+	}
+	return nil
+}
+
+// RegenerateClientCert replaces the client certificate with a new one signed
+// by the CA.
+func RegenerateClientCert(authOptions *auth.Options) error {
+	if err := os.Remove(authOptions.ClientKeyPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return createCert(authOptions, mcnutils.GetUsername()+".<bootstrap>", 2048)
+}
@@ -0,0 +1,111 @@
+package cert
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func readCerts(t *testing.T, path string) []*x509.Certificate {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs = append(certs, certificate)
+	}
+	return certs
+}
+
+func verifiesWith(t *testing.T, certPath string, roots ...*x509.Certificate) bool {
+	pool := x509.NewCertPool()
+	for _, root := range roots {
+		pool.AddCert(root)
+	}
+	_, err := readCerts(t, certPath)[0].Verify(x509.VerifyOptions{
+		Roots:     pool,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return err == nil
+}
+
+func TestCARotation(t *testing.T) {
+	tmpDir := t.TempDir()
+	authOptions := &auth.Options{
+		CertDir:          tmpDir,
+		CaCertPath:       filepath.Join(tmpDir, "ca.pem"),
+		CaPrivateKeyPath: filepath.Join(tmpDir, "ca-key.pem"),
+		ClientCertPath:   filepath.Join(tmpDir, "cert.pem"),
+		ClientKeyPath:    filepath.Join(tmpDir, "key.pem"),
+	}
+	if err := BootstrapCertificates(authOptions); err != nil {
+		t.Fatal(err)
+	}
+	previous := readCerts(t, authOptions.CaCertPath)[0]
+
+	assert.EqualError(t, PromoteCA(authOptions), errNoCARotation.Error())
+	assert.NoError(t, EndCARotation(authOptions))
+
+	// Both CAs are trusted, the current one signing.
+	if err := StartCARotation(authOptions); err != nil {
+		t.Fatal(err)
+	}
+	bundle := readCerts(t, authOptions.CaCertPath)
+	if len(bundle) != 2 {
+		t.Fatalf("expected 2 CA certificates, got %d", len(bundle))
+	}
+	assert.Equal(t, previous, bundle[0])
+	next := bundle[1]
+
+	if err := RegenerateClientCert(authOptions); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, verifiesWith(t, authOptions.ClientCertPath, previous))
+
+	// Starting again keeps the new CA.
+	if err := StartCARotation(authOptions); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, bundle, readCerts(t, authOptions.CaCertPath))
+
+	assert.Error(t, EndCARotation(authOptions))
+
+	// Both CAs are trusted, the new one signing.
+	if err := PromoteCA(authOptions); err != nil {
+		t.Fatal(err)
+	}
+	if err := PromoteCA(authOptions); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []*x509.Certificate{next, previous}, readCerts(t, authOptions.CaCertPath))
+
+	if err := RegenerateClientCert(authOptions); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, verifiesWith(t, authOptions.ClientCertPath, next))
+	assert.False(t, verifiesWith(t, authOptions.ClientCertPath, previous))
+
+	nextCert, nextKey := NextCA(authOptions)
+	assert.Equal(t, []*x509.Certificate{next}, readCerts(t, nextCert))
+
+	// The new CA only is trusted.
+	if err := EndCARotation(authOptions); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []*x509.Certificate{next}, readCerts(t, authOptions.CaCertPath))
+	for _, path := range []string{nextCert, nextKey, filepath.Join(tmpDir, previousCACertFile)} {
+		_, err := os.Stat(path)
+		assert.True(t, os.IsNotExist(err), path)
+	}
+}
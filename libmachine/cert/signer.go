@@ -0,0 +1,138 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// SignerOpener returns the signer of the CA private key at the location, of
+// the scheme it is registered for. The key may never leave its store, the
+// signer signing remotely.
+type SignerOpener func(location string) (crypto.Signer, error)
+
+var signerOpeners = struct {
+	sync.RWMutex
+	openers map[string]SignerOpener
+}{openers: map[string]SignerOpener{}}
+
+// RegisterSigner makes the CA private keys given as "<scheme>:<location>",
+// instead of a key file, open with open.
+func RegisterSigner(scheme string, open SignerOpener) {
+	signerOpeners.Lock()
+	defer signerOpeners.Unlock()
+	signerOpeners.openers[scheme] = open
+}
+
+// signerOpenerOf returns the opener of keyPath and the location it opens,
+// nil if keyPath is a key file.
+func signerOpenerOf(keyPath string) (SignerOpener, string) {
+	scheme, location, ok := strings.Cut(keyPath, ":")
+	if !ok {
+		return nil, ""
+	}
+
+	signerOpeners.RLock()
+	defer signerOpeners.RUnlock()
+	return signerOpeners.openers[scheme], location
+}
+
+// IsRemoteKey tells whether the CA private key at keyPath is kept by a
+// registered signer rather than in a key file.
+func IsRemoteKey(keyPath string) bool {
+	open, _ := signerOpenerOf(keyPath)
+	return open != nil
+}
+
+// OpenCASigner returns the signer of the CA private key at keyPath: a key
+// file, possibly encrypted, or "<scheme>:<location>" for a key kept by a
+// registered signer.
+func OpenCASigner(keyPath string) (crypto.Signer, error) {
+	if open, location := signerOpenerOf(keyPath); open != nil {
+		signer, err := open(location)
+		if err != nil {
+			return nil, fmt.Errorf("opening the CA key %s failed: %s", keyPath, err)
+		}
+		return signer, nil
+	}
+
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("the CA key %s is not PEM encoded", keyPath)
+	}
+
+	der := block.Bytes
+	if block.Type == encryptedKeyBlockType {
+		passphrase := os.Getenv(CAKeyPassphraseEnv)
+		if passphrase == "" {
+			return nil, fmt.Errorf("the CA key %s is encrypted, give its passphrase with $%s", keyPath, CAKeyPassphraseEnv)
+		}
+		if der, err = decryptKey(block, []byte(passphrase)); err != nil {
+			return nil, fmt.Errorf("decrypting the CA key %s failed: %s", keyPath, err)
+		}
+	}
+	return parsePrivateKey(der)
+}
+
+// parsePrivateKey parses the DER private keys of the PEM files openssl and
+// machine write.
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, errors.New("unsupported CA private key")
+	}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case *ecdsa.PrivateKey:
+		return key, nil
+	case ed25519.PrivateKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported CA private key type %T", key)
+}
+
+// caWithSigner returns the CA of the certificates, the CA followed by its
+// chain, signing with signer.
+func caWithSigner(certPEM []byte, signer crypto.Signer) (tls.Certificate, error) {
+	var ca tls.Certificate
+	for block, rest := pem.Decode(certPEM); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			ca.Certificate = append(ca.Certificate, block.Bytes)
+		}
+	}
+	if len(ca.Certificate) == 0 {
+		return ca, errors.New("no CA certificate found")
+	}
+
+	leaf, err := x509.ParseCertificate(ca.Certificate[0])
+	if err != nil {
+		return ca, err
+	}
+	public, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !public.Equal(leaf.PublicKey) {
+		return ca, errors.New("the CA private key does not match the CA certificate")
+	}
+
+	ca.PrivateKey = signer
+	return ca, nil
+}
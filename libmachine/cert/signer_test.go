@@ -0,0 +1,233 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	"github.com/rancher/machine/libmachine/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+// generateServerCert signs a server certificate with the CA and returns it.
+func generateServerCert(t *testing.T, caCertPath, caKeyPath string) *x509.Certificate {
+	dir := t.TempDir()
+	err := GenerateCert(&Options{
+		Hosts:     []string{"192.168.99.100"},
+		CertFile:  filepath.Join(dir, "server.pem"),
+		KeyFile:   filepath.Join(dir, "server-key.pem"),
+		CAFile:    caCertPath,
+		CAKeyFile: caKeyPath,
+		Org:       "test-org",
+		Bits:      2048,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return readCerts(t, filepath.Join(dir, "server.pem"))[0]
+}
+
+func TestEncryptedCAKey(t *testing.T) {
+	tmpDir := t.TempDir()
+	authOptions := &auth.Options{
+		CertDir:          tmpDir,
+		CaCertPath:       filepath.Join(tmpDir, "ca.pem"),
+		CaPrivateKeyPath: filepath.Join(tmpDir, "ca-key.pem"),
+		ClientCertPath:   filepath.Join(tmpDir, "cert.pem"),
+		ClientKeyPath:    filepath.Join(tmpDir, "key.pem"),
+	}
+
+	t.Setenv(CAKeyPassphraseEnv, "secret")
+	if err := BootstrapCertificates(authOptions); err != nil {
+		t.Fatal(err)
+	}
+
+	keyPEM, err := os.ReadFile(authOptions.CaPrivateKeyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(keyPEM)
+	assert.Equal(t, encryptedKeyBlockType, block.Type)
+
+	ca := readCerts(t, authOptions.CaCertPath)[0]
+	assert.NoError(t, generateServerCert(t, authOptions.CaCertPath, authOptions.CaPrivateKeyPath).CheckSignatureFrom(ca))
+
+	t.Setenv(CAKeyPassphraseEnv, "wrong")
+	_, err = OpenCASigner(authOptions.CaPrivateKeyPath)
+	assert.EqualError(t, err, fmt.Sprintf("decrypting the CA key %s failed: wrong passphrase", authOptions.CaPrivateKeyPath))
+
+	t.Setenv(CAKeyPassphraseEnv, "")
+	_, err = OpenCASigner(authOptions.CaPrivateKeyPath)
+	assert.EqualError(t, err, fmt.Sprintf("the CA key %s is encrypted, give its passphrase with $%s", authOptions.CaPrivateKeyPath, CAKeyPassphraseEnv))
+
+	_, err = EncryptKey(keyPEM, []byte("secret"))
+	assert.EqualError(t, err, "the key is encrypted already")
+}
+
+func TestRegisteredSigner(t *testing.T) {
+	tmpDir := t.TempDir()
+	caCertPath := filepath.Join(tmpDir, "ca.pem")
+	caKeyPath := filepath.Join(tmpDir, "ca-key.pem")
+	if err := GenerateCACertificate(caCertPath, caKeyPath, "test-org", 2048); err != nil {
+		t.Fatal(err)
+	}
+
+	var opened []string
+	RegisterSigner("test", func(location string) (crypto.Signer, error) {
+		opened = append(opened, location)
+		return OpenCASigner(caKeyPath)
+	})
+	defer RegisterSigner("test", nil)
+
+	assert.True(t, IsRemoteKey("test:ca"))
+	assert.False(t, IsRemoteKey(caKeyPath))
+	assert.False(t, IsRemoteKey(`C:\Users\docker\ca-key.pem`))
+
+	ca := readCerts(t, caCertPath)[0]
+	assert.NoError(t, generateServerCert(t, caCertPath, "test:ca").CheckSignatureFrom(ca))
+	assert.Equal(t, []string{"ca"}, opened)
+
+	// The CA cannot be generated nor rotated without its key.
+	authOptions := &auth.Options{
+		CertDir:          tmpDir,
+		CaCertPath:       filepath.Join(tmpDir, "missing.pem"),
+		CaPrivateKeyPath: "test:ca",
+	}
+	assert.Error(t, BootstrapCertificates(authOptions))
+	authOptions.CaCertPath = caCertPath
+	assert.Error(t, StartCARotation(authOptions))
+
+	// The key must be the one of the CA.
+	RegisterSigner("test", func(string) (crypto.Signer, error) {
+		return rsa.GenerateKey(rand.Reader, 2048)
+	})
+	err := GenerateCert(&Options{
+		Hosts:     []string{"localhost"},
+		CertFile:  filepath.Join(tmpDir, "server.pem"),
+		KeyFile:   filepath.Join(tmpDir, "server-key.pem"),
+		CAFile:    caCertPath,
+		CAKeyFile: "test:ca",
+		Org:       "test-org",
+		Bits:      2048,
+	})
+	assert.EqualError(t, err, "the CA private key does not match the CA certificate")
+}
+
+func TestVaultSigner(t *testing.T) {
+	tmpDir := t.TempDir()
+	caCertPath := filepath.Join(tmpDir, "ca.pem")
+	caKeyPath := filepath.Join(tmpDir, "ca-key.pem")
+	if err := GenerateCACertificate(caCertPath, caKeyPath, "test-org", 2048); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := OpenCASigner(caKeyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := signer.(*rsa.PrivateKey)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors":["permission denied"]}`)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/transit/keys/machine-ca":
+			der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+			publicKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+				"latest_version": 1,
+				"keys":           map[string]interface{}{"1": map[string]string{"public_key": publicKey}},
+			}})
+		case "/v1/transit/sign/machine-ca/sha2-256":
+			var request struct {
+				Input              string `json:"input"`
+				Prehashed          bool   `json:"prehashed"`
+				SignatureAlgorithm string `json:"signature_algorithm"`
+			}
+			json.NewDecoder(r.Body).Decode(&request)
+			assert.True(t, request.Prehashed)
+			assert.Equal(t, "pkcs1v15", request.SignatureAlgorithm)
+
+			digest, _ := base64.StdEncoding.DecodeString(request.Input)
+			signature, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{
+				"signature": "vault:v1:" + base64.StdEncoding.EncodeToString(signature),
+			}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors":[]}`)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "token")
+
+	ca := readCerts(t, caCertPath)[0]
+	assert.NoError(t, generateServerCert(t, caCertPath, "vault:transit/machine-ca").CheckSignatureFrom(ca))
+
+	t.Setenv("VAULT_TOKEN", "other")
+	_, err = OpenCASigner("vault:transit/machine-ca")
+	assert.EqualError(t, err, "opening the CA key vault:transit/machine-ca failed: Vault responded 403 Forbidden: permission denied")
+
+	_, err = OpenCASigner("vault:machine-ca")
+	assert.EqualError(t, err, "opening the CA key vault:machine-ca failed: expected vault:<mount>/<key>, got vault:machine-ca")
+}
+
+type fakeKMS struct {
+	kmsiface.KMSAPI
+	key *ecdsa.PrivateKey
+}
+
+func (f *fakeKMS) GetPublicKey(input *kms.GetPublicKeyInput) (*kms.GetPublicKeyOutput, error) {
+	der, err := x509.MarshalPKIXPublicKey(&f.key.PublicKey)
+	return &kms.GetPublicKeyOutput{KeyId: input.KeyId, KeyUsage: aws.String(kms.KeyUsageTypeSignVerify), PublicKey: der}, err
+}
+
+func (f *fakeKMS) Sign(input *kms.SignInput) (*kms.SignOutput, error) {
+	if aws.StringValue(input.SigningAlgorithm) != kms.SigningAlgorithmSpecEcdsaSha256 || aws.StringValue(input.MessageType) != kms.MessageTypeDigest {
+		return nil, fmt.Errorf("unexpected signing algorithm %s", aws.StringValue(input.SigningAlgorithm))
+	}
+	signature, err := ecdsa.SignASN1(rand.Reader, f.key, input.Message)
+	return &kms.SignOutput{KeyId: input.KeyId, Signature: signature}, err
+}
+
+func TestKMSSigner(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := newKMSSigner(&fakeKMS{key: key}, "alias/machine-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &key.PublicKey, signer.Public())
+
+	digest := sha256.Sum256([]byte("machine"))
+	signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	assert.NoError(t, err)
+	assert.True(t, ecdsa.VerifyASN1(&key.PublicKey, digest[:], signature))
+
+	_, err = signer.Sign(rand.Reader, digest[:], crypto.SHA1)
+	assert.EqualError(t, err, "KMS cannot sign SHA-1 digests with ECDSA keys")
+}
@@ -0,0 +1,156 @@
+package cert
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterSigner("vault", openVaultSigner)
+}
+
+// vaultHashAlgorithms maps the hashes to their names in the transit API.
+var vaultHashAlgorithms = map[crypto.Hash]string{
+	crypto.SHA256: "sha2-256",
+	crypto.SHA384: "sha2-384",
+	crypto.SHA512: "sha2-512",
+}
+
+// vaultSigner signs with a key of the transit secrets engine of Vault, which
+// never leaves it. The CA keys "vault:<mount>/<key>" are opened with it, from
+// the Vault at $VAULT_ADDR with the token $VAULT_TOKEN.
+type vaultSigner struct {
+	client     *http.Client
+	addr       string
+	token      string
+	mount, key string
+	public     crypto.PublicKey
+}
+
+func openVaultSigner(location string) (crypto.Signer, error) {
+	i := strings.LastIndex(location, "/")
+	if i <= 0 || i == len(location)-1 {
+		return nil, fmt.Errorf("expected vault:<mount>/<key>, got vault:%s", location)
+	}
+
+	addr, token := os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return nil, errors.New("$VAULT_ADDR and $VAULT_TOKEN must be set")
+	}
+
+	return newVaultSigner(&http.Client{Timeout: 30 * time.Second}, addr, token, location[:i], location[i+1:])
+}
+
+func newVaultSigner(client *http.Client, addr, token, mount, key string) (*vaultSigner, error) {
+	s := &vaultSigner{
+		client: client,
+		addr:   strings.TrimSuffix(addr, "/"),
+		token:  token,
+		mount:  mount,
+		key:    key,
+	}
+
+	var keyInfo struct {
+		LatestVersion int `json:"latest_version"`
+		Keys          map[string]struct {
+			PublicKey string `json:"public_key"`
+		} `json:"keys"`
+	}
+	if err := s.call(http.MethodGet, "keys/"+key, nil, &keyInfo); err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode([]byte(keyInfo.Keys[strconv.Itoa(keyInfo.LatestVersion)].PublicKey))
+	if block == nil {
+		return nil, fmt.Errorf("the transit key %s has no public key to sign with", key)
+	}
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	s.public = public
+	return s, nil
+}
+
+func (s *vaultSigner) Public() crypto.PublicKey {
+	return s.public
+}
+
+func (s *vaultSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash, ok := vaultHashAlgorithms[opts.HashFunc()]
+	if !ok {
+		return nil, fmt.Errorf("the transit engine cannot sign %s digests", opts.HashFunc())
+	}
+
+	request := map[string]interface{}{
+		"input":     base64.StdEncoding.EncodeToString(digest),
+		"prehashed": true,
+	}
+	if _, ok := s.public.(*rsa.PublicKey); ok {
+		request["signature_algorithm"] = "pkcs1v15"
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			request["signature_algorithm"] = "pss"
+		}
+	}
+
+	var signed struct {
+		Signature string `json:"signature"`
+	}
+	if err := s.call(http.MethodPost, "sign/"+s.key+"/"+hash, request, &signed); err != nil {
+		return nil, err
+	}
+
+	// The signatures are "vault:v<version>:<base64>".
+	i := strings.LastIndex(signed.Signature, ":")
+	return base64.StdEncoding.DecodeString(signed.Signature[i+1:])
+}
+
+// call calls the endpoint of the transit engine, decoding the data of the
+// response into data.
+func (s *vaultSigner) call(method, endpoint string, request, data interface{}) error {
+	var body io.Reader
+	if request != nil {
+		encoded, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, fmt.Sprintf("%s/v1/%s/%s", s.addr, s.mount, endpoint), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", s.token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []string        `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("Vault responded %s: %s", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Vault responded %s: %s", resp.Status, strings.Join(response.Errors, ", "))
+	}
+	return json.Unmarshal(response.Data, data)
+}
@@ -3,8 +3,8 @@ package check
 import (
 	"errors"
 	"fmt"
+	"net"
 	"net/url"
-	"strings"
 
 	"github.com/rancher/machine/libmachine/auth"
 	"github.com/rancher/machine/libmachine/cert"
@@ -59,6 +59,9 @@ func (mcc *MachineConnChecker) Check(h *host.Host, swarm bool) (string, *auth.Op
 	}
 
 	authOptions := h.AuthOptions()
+	if authOptions == nil {
+		return "", &auth.Options{}, fmt.Errorf("Docker was not provisioned on machine %s", h.Name)
+	}
 
 	if err := checkCert(u.Host, authOptions); err != nil {
 		if swarm {
@@ -88,7 +91,6 @@ func checkCert(hostURL string, authOptions *auth.Options) error {
 	return nil
 }
 
-// TODO: This could use a unit test.
 func parseSwarm(hostURL string, h *host.Host) (string, error) {
 	swarmOptions := h.HostOptions.SwarmOptions
 
@@ -100,8 +102,7 @@ func parseSwarm(hostURL string, h *host.Host) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("There was an error parsing the url: %s", err)
 	}
-	parts := strings.Split(u.Host, ":")
-	swarmPort := parts[1]
+	swarmPort := u.Port()
 
 	// get IP of machine to replace in case swarm host is 0.0.0.0
 	mURL, err := url.Parse(hostURL)
@@ -109,10 +110,9 @@ func parseSwarm(hostURL string, h *host.Host) (string, error) {
 		return "", fmt.Errorf("There was an error parsing the url: %s", err)
 	}
 
-	mParts := strings.Split(mURL.Host, ":")
-	machineIP := mParts[0]
+	machineIP := mURL.Hostname()
 
-	hostURL = fmt.Sprintf("tcp://%s:%s", machineIP, swarmPort)
+	hostURL = fmt.Sprintf("tcp://%s", net.JoinHostPort(machineIP, swarmPort))
 
 	return hostURL, nil
 }
@@ -8,6 +8,8 @@ import (
 
 	"github.com/rancher/machine/libmachine/auth"
 	"github.com/rancher/machine/libmachine/cert"
+	"github.com/rancher/machine/libmachine/host"
+	"github.com/rancher/machine/libmachine/swarm"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -58,3 +60,19 @@ func TestCheckCert(t *testing.T) {
 		assert.Equal(t, c.expectedErr, err)
 	}
 }
+
+func TestParseSwarm(t *testing.T) {
+	h := &host.Host{HostOptions: &host.Options{SwarmOptions: &swarm.Options{Master: true, Host: "tcp://0.0.0.0:3376"}}}
+
+	swarmURL, err := parseSwarm("tcp://192.168.99.100:2376", h)
+	assert.NoError(t, err)
+	assert.Equal(t, "tcp://192.168.99.100:3376", swarmURL)
+
+	swarmURL, err = parseSwarm("tcp://[2001:db8::1]:2376", h)
+	assert.NoError(t, err)
+	assert.Equal(t, "tcp://[2001:db8::1]:3376", swarmURL)
+
+	h.HostOptions.SwarmOptions.Master = false
+	_, err = parseSwarm("tcp://192.168.99.100:2376", h)
+	assert.Error(t, err)
+}
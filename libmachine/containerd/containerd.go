@@ -0,0 +1,18 @@
+package containerd
+
+const (
+	DefaultVersion     = "1.7.22"
+	DefaultRuncVersion = "1.1.14"
+	// SocketPath is the path of the gRPC socket of containerd on the
+	// machine, reached through an SSH tunnel.
+	SocketPath = "/run/containerd/containerd.sock"
+)
+
+// Options configure the containerd a machine is provisioned with instead of
+// the Docker engine.
+type Options struct {
+	Version     string
+	RuncVersion string
+	// RegistryMirror are the mirrors of Docker Hub.
+	RegistryMirror []string `json:",omitempty"`
+}
@@ -38,6 +38,10 @@ func (e CrashError) Error() string {
 	return e.Cause.Error()
 }
 
+func (e CrashError) Unwrap() error {
+	return e.Cause
+}
+
 type BugsnagCrashReporter struct {
 	baseDir string
 	apiKey  string
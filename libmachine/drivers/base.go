@@ -3,6 +3,8 @@ package drivers
 import (
 	"errors"
 	"path/filepath"
+
+	"github.com/rancher/machine/libmachine/ssh"
 )
 
 const (
@@ -23,6 +25,33 @@ type BaseDriver struct {
 	SwarmMaster    bool
 	SwarmHost      string
 	SwarmDiscovery string
+	// The SSH connections go through the bastion at SSHBastionHost, unless
+	// it is empty.
+	SSHBastionHost    string
+	SSHBastionPort    int
+	SSHBastionUser    string
+	SSHBastionKeyPath string
+	// MachineTags are tagged on the cloud resources of the machine by the
+	// drivers implementing DriverWithTags.
+	MachineTags map[string]string
+	// MachineUserDataFile is the user-data template passed to the machine by
+	// the drivers supporting it.
+	MachineUserDataFile string
+	// PreferIPv6 makes GetIP report the IPv6 address of dual-stack machines,
+	// for the drivers supporting it.
+	PreferIPv6 bool
+	// SSHKeyType is the type of the SSH key generated for the machine, by
+	// the drivers supporting it.
+	SSHKeyType ssh.KeyType
+	// SSHJumpHosts are the jump hosts, in the [user@]host[:port] form, the
+	// SSH connections go through in order, before the bastion at
+	// SSHBastionHost if there is one. They authenticate with the key at
+	// SSHJumpKeyPath, or the ssh-agent when it is empty.
+	SSHJumpHosts   []string
+	SSHJumpKeyPath string
+	// SSHRetryPolicy is how long to wait for SSH to be available on the
+	// machine, the default when nil.
+	SSHRetryPolicy *ssh.RetryPolicy `json:",omitempty"`
 }
 
 // DriverName returns the name of the driver
@@ -68,6 +97,36 @@ func (d *BaseDriver) GetSSHUsername() string {
 	return d.SSHUser
 }
 
+// GetSSHBastion returns the bastion the SSH connections go through, chained
+// to the jump hosts, nil if neither SSHBastionHost nor SSHJumpHosts are set.
+// The port defaults to 22 and the user to root.
+func (d *BaseDriver) GetSSHBastion() (*ssh.Bastion, error) {
+	bastions, err := d.sshJumpBastions()
+	if err != nil {
+		return nil, err
+	}
+	if d.SSHBastionHost == "" {
+		return ssh.ChainBastions(bastions...), nil
+	}
+
+	bastion := &ssh.Bastion{
+		User: d.SSHBastionUser,
+		Host: d.SSHBastionHost,
+		Port: d.SSHBastionPort,
+		Auth: &ssh.Auth{},
+	}
+	if bastion.User == "" {
+		bastion.User = DefaultSSHUser
+	}
+	if bastion.Port == 0 {
+		bastion.Port = DefaultSSHPort
+	}
+	if d.SSHBastionKeyPath != "" {
+		bastion.Auth.Keys = []string{d.SSHBastionKeyPath}
+	}
+	return ssh.ChainBastions(append(bastions, bastion)...), nil
+}
+
 // PreCreateCheck is called to enforce pre-creation steps
 func (d *BaseDriver) PreCreateCheck() error {
 	return nil
@@ -85,6 +144,16 @@ func (d *BaseDriver) SetSwarmConfigFromFlags(flags DriverOptions) {
 	d.SwarmDiscovery = flags.String("swarm-discovery")
 }
 
+// SetTagsFromFlags sets the machine tags from the --machine-tags flag
+func (d *BaseDriver) SetTagsFromFlags(flags DriverOptions) error {
+	tags, err := ParseTags(flags.String(MachineTagsFlag))
+	if err != nil {
+		return err
+	}
+	d.MachineTags = tags
+	return nil
+}
+
 func EngineInstallURLFlagSet(flags DriverOptions) bool {
 	return EngineInstallURLSet(flags.String("engine-install-url"))
 }
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/rancher/machine/libmachine/ssh"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -48,3 +49,27 @@ func TestEngineInstallUrlFlagSet(t *testing.T) {
 	options := createDriverOptionWithEngineInstall("https://test.docker.com")
 	assert.True(t, EngineInstallURLFlagSet(options))
 }
+
+func TestGetSSHBastion(t *testing.T) {
+	bastion, err := (&BaseDriver{}).GetSSHBastion()
+	assert.NoError(t, err)
+	assert.Nil(t, bastion)
+
+	bastion, err = (&BaseDriver{SSHBastionHost: "bastion.example.com"}).GetSSHBastion()
+	assert.NoError(t, err)
+	assert.Equal(t, &ssh.Bastion{User: "root", Host: "bastion.example.com", Port: 22, Auth: &ssh.Auth{}}, bastion)
+
+	bastion, err = (&BaseDriver{
+		SSHBastionHost:    "bastion.example.com",
+		SSHBastionPort:    2222,
+		SSHBastionUser:    "jump",
+		SSHBastionKeyPath: "/machines/default/bastion-id_rsa",
+	}).GetSSHBastion()
+	assert.NoError(t, err)
+	assert.Equal(t, &ssh.Bastion{
+		User: "jump",
+		Host: "bastion.example.com",
+		Port: 2222,
+		Auth: &ssh.Auth{Keys: []string{"/machines/default/bastion-id_rsa"}},
+	}, bastion)
+}
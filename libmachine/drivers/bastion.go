@@ -0,0 +1,25 @@
+package drivers
+
+import "github.com/rancher/machine/libmachine/ssh"
+
+// DriverWithSSHBastion is implemented by drivers of machines that may only be
+// reachable through a bastion, or jump host. BaseDriver implements it from
+// its SSHBastion fields.
+type DriverWithSSHBastion interface {
+	Driver
+
+	// GetSSHBastion returns the bastion the SSH connections to the machine
+	// go through, or nil if they connect to it directly.
+	GetSSHBastion() (*ssh.Bastion, error)
+}
+
+// GetSSHBastion returns the bastion the SSH connections to the machine driven
+// by d go through, or nil if d does not implement DriverWithSSHBastion or
+// has no bastion.
+func GetSSHBastion(d Driver) (*ssh.Bastion, error) {
+	if bd, ok := d.(DriverWithSSHBastion); ok {
+		return bd.GetSSHBastion()
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,79 @@
+package drivers
+
+// Capability names an optional operation or feature a driver supports.
+type Capability string
+
+const (
+	// CapabilityStartStop means Start and Stop power the machine on and off
+	// without destroying it.
+	CapabilityStartStop Capability = "start-stop"
+	// CapabilityRestart means Restart reboots the machine.
+	CapabilityRestart Capability = "restart"
+	// CapabilityKill means Kill forcibly powers the machine off.
+	CapabilityKill Capability = "kill"
+	// CapabilityResize means the machine can be resized after creation.
+	CapabilityResize Capability = "resize"
+	// CapabilityPrivateIP means GetIPs reports private addresses.
+	CapabilityPrivateIP Capability = "private-ip"
+	// CapabilityCustomSSHPort means the SSH port can be set at create time.
+	CapabilityCustomSSHPort Capability = "custom-ssh-port"
+	// CapabilityDryRun means PreCreateCheck has no side effects once the
+	// driver is in dry-run mode, see DriverWithDryRun.
+	CapabilityDryRun Capability = "dry-run"
+	// CapabilitySnapshots means the driver can snapshot and restore the
+	// machine.
+	CapabilitySnapshots Capability = "snapshots"
+	// CapabilityIPv6 means the machine can be given an IPv6 address.
+	CapabilityIPv6 Capability = "ipv6"
+	// CapabilitySSH means the machine is provisioned and reached over SSH.
+	CapabilitySSH Capability = "ssh"
+)
+
+// DriverWithCapabilities is implemented by drivers that can describe which
+// optional operations they support before a machine is created.
+type DriverWithCapabilities interface {
+	Driver
+
+	// Capabilities returns the capabilities supported by the driver.
+	Capabilities() []Capability
+}
+
+// GetCapabilities returns the capabilities of d, or none if d does not
+// implement DriverWithCapabilities.
+func GetCapabilities(d Driver) []Capability {
+	if cd, ok := d.(DriverWithCapabilities); ok {
+		return cd.Capabilities()
+	}
+
+	return []Capability{}
+}
+
+// HasCapability reports whether d advertises the capability c.
+func HasCapability(d Driver, c Capability) bool {
+	for _, capability := range GetCapabilities(d) {
+		if capability == c {
+			return true
+		}
+	}
+	return false
+}
+
+// DriverWithArchitectures is implemented by drivers that can describe the CPU
+// architectures, named like GOARCH, of the machines they create.
+type DriverWithArchitectures interface {
+	Driver
+
+	// SupportedArchitectures returns the architectures the driver can create
+	// machines of.
+	SupportedArchitectures() []string
+}
+
+// GetSupportedArchitectures returns the architectures d supports, or none if
+// d does not implement DriverWithArchitectures.
+func GetSupportedArchitectures(d Driver) []string {
+	if ad, ok := d.(DriverWithArchitectures); ok {
+		return ad.SupportedArchitectures()
+	}
+
+	return []string{}
+}
@@ -0,0 +1,41 @@
+package drivers
+
+import "errors"
+
+// ErrCostNotSupported is returned by EstimateCost for drivers that do not
+// implement DriverWithCost.
+var ErrCostNotSupported = errors.New("driver does not estimate the cost of machines")
+
+// HoursPerMonth is the number of hours the monthly price of a machine priced
+// by the hour is estimated for.
+const HoursPerMonth = 730
+
+// CostEstimate is the price of running the machine, excluding its storage
+// and traffic unless Source tells otherwise.
+type CostEstimate struct {
+	Currency string
+	Hourly   float64
+	Monthly  float64
+	// Source names the price list the estimate comes from.
+	Source string `json:",omitempty"`
+}
+
+// DriverWithCost is implemented by drivers that can price the machine before
+// and after Create.
+type DriverWithCost interface {
+	Driver
+
+	// EstimateCost returns the price of the machine configured by
+	// SetConfigFromFlags.
+	EstimateCost() (*CostEstimate, error)
+}
+
+// EstimateCost returns the price of the machine of d. It returns
+// ErrCostNotSupported if d does not implement DriverWithCost.
+func EstimateCost(d Driver) (*CostEstimate, error) {
+	if cd, ok := d.(DriverWithCost); ok {
+		return cd.EstimateCost()
+	}
+
+	return nil, ErrCostNotSupported
+}
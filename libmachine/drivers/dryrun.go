@@ -0,0 +1,20 @@
+package drivers
+
+// DriverWithDryRun is implemented by drivers whose PreCreateCheck has side
+// effects, such as downloading an ISO, that it can skip when a machine is
+// only being validated.
+type DriverWithDryRun interface {
+	Driver
+
+	// SetDryRun enables or disables the side effects of PreCreateCheck.
+	SetDryRun(dryRun bool)
+}
+
+// SetDryRun puts d in dry-run mode if it implements DriverWithDryRun. Drivers
+// which advertise CapabilityDryRun without implementing it have no side
+// effects to skip.
+func SetDryRun(d Driver, dryRun bool) {
+	if dd, ok := d.(DriverWithDryRun); ok {
+		dd.SetDryRun(dryRun)
+	}
+}
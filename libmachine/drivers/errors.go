@@ -0,0 +1,71 @@
+package drivers
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorCode classifies a driver failure, for callers to tell the failures
+// worth retrying from the terminal ones without matching error messages.
+type ErrorCode string
+
+const (
+	// ErrorCodeQuotaExceeded means the account has no quota left for the
+	// machine.
+	ErrorCodeQuotaExceeded ErrorCode = "quota-exceeded"
+	// ErrorCodeAuthFailure means the credentials were rejected or lack a
+	// permission.
+	ErrorCodeAuthFailure ErrorCode = "auth-failure"
+	// ErrorCodeNotFound means a resource the machine needs, such as its
+	// image or network, does not exist.
+	ErrorCodeNotFound ErrorCode = "not-found"
+	// ErrorCodeTransientNetwork means the provider could not be reached or
+	// throttled the request. The operation can be retried.
+	ErrorCodeTransientNetwork ErrorCode = "transient-network"
+	// ErrorCodeInvalidFlag means the value of a flag of the driver is
+	// invalid.
+	ErrorCodeInvalidFlag ErrorCode = "invalid-flag"
+)
+
+// Error is a driver failure with its code. The code survives the RPC calls
+// to driver plugins.
+type Error struct {
+	Code ErrorCode
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NewError returns err with the code, or nil if err is nil.
+func NewError(code ErrorCode, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// Errorf formats an error with the code.
+func Errorf(code ErrorCode, format string, args ...interface{}) error {
+	return &Error{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+// GetErrorCode returns the code of err, or "" if it has none.
+func GetErrorCode(err error) ErrorCode {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
+
+// IsRetryable reports whether the operation which failed with err can be
+// retried as is.
+func IsRetryable(err error) bool {
+	return GetErrorCode(err) == ErrorCodeTransientNetwork
+}
@@ -0,0 +1,22 @@
+package drivers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorCodes(t *testing.T) {
+	err := Errorf(ErrorCodeQuotaExceeded, "no vCPU left in %s", "us-east-1")
+	wrapped := fmt.Errorf("Error launching instance: %w", err)
+
+	assert.Equal(t, "Error launching instance: no vCPU left in us-east-1", wrapped.Error())
+	assert.Equal(t, ErrorCodeQuotaExceeded, GetErrorCode(wrapped))
+	assert.False(t, IsRetryable(wrapped))
+
+	assert.True(t, IsRetryable(NewError(ErrorCodeTransientNetwork, errors.New("connection reset"))))
+	assert.Equal(t, ErrorCode(""), GetErrorCode(errors.New("unclassified")))
+	assert.NoError(t, NewError(ErrorCodeNotFound, nil))
+}
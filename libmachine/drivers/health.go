@@ -0,0 +1,23 @@
+package drivers
+
+import "time"
+
+// DriverWithHealth is implemented by drivers running in a plugin process,
+// which can stop responding while the machine binary still holds them.
+type DriverWithHealth interface {
+	Driver
+
+	// Health returns when the plugin of the driver last answered a
+	// heartbeat, and why it is considered unhealthy, if it is.
+	Health() (time.Time, error)
+}
+
+// GetHealth returns the health of d. Drivers which do not implement
+// DriverWithHealth run in this process and are always healthy.
+func GetHealth(d Driver) (time.Time, error) {
+	if hd, ok := d.(DriverWithHealth); ok {
+		return hd.Health()
+	}
+
+	return time.Time{}, nil
+}
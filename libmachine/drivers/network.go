@@ -0,0 +1,117 @@
+package drivers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// AddressKind labels the role of an address reported by a driver.
+type AddressKind string
+
+const (
+	// AddressPublic is an address reachable from outside the machine's network.
+	AddressPublic AddressKind = "public"
+	// AddressPrivate is an address only reachable within the machine's network.
+	AddressPrivate AddressKind = "private"
+	// AddressIPv6 is a globally routable IPv6 address.
+	AddressIPv6 AddressKind = "ipv6"
+)
+
+// NetworkAddress is a single address a machine can be reached at.
+type NetworkAddress struct {
+	Kind    AddressKind
+	Address string
+	// Interface identifies the network interface of the address on machines
+	// with several, e.g. the ID of the cloud NIC or the name of the network.
+	Interface string `json:",omitempty"`
+}
+
+// DriverWithNetwork is implemented by drivers that know about more than the
+// single address returned by GetIP, e.g. both the public and private address
+// of a cloud instance.
+type DriverWithNetwork interface {
+	Driver
+
+	// GetIPs returns every known address of the machine, labeled by kind.
+	GetIPs() ([]NetworkAddress, error)
+}
+
+// ErrAddressKindsNotReported is returned by GetIPs for drivers that only
+// report the single address returned by GetIP, whose kind is unknown.
+var ErrAddressKindsNotReported = errors.New("driver does not report address kinds")
+
+// ErrAddressKindNotFound is returned when a machine has no address of the
+// requested kind.
+type ErrAddressKindNotFound struct {
+	MachineName string
+	Kind        AddressKind
+}
+
+func (e ErrAddressKindNotFound) Error() string {
+	return fmt.Sprintf("machine %q has no %s address", e.MachineName, e.Kind)
+}
+
+// GetIPs returns every known address of the machine driven by d. It returns
+// ErrAddressKindsNotReported if d does not implement DriverWithNetwork.
+func GetIPs(d Driver) ([]NetworkAddress, error) {
+	if nd, ok := d.(DriverWithNetwork); ok {
+		return nd.GetIPs()
+	}
+
+	return nil, ErrAddressKindsNotReported
+}
+
+// AddressesOfKind filters addrs down to those of the given kind.
+func AddressesOfKind(addrs []NetworkAddress, kind AddressKind) []NetworkAddress {
+	var filtered []NetworkAddress
+	for _, addr := range addrs {
+		if addr.Kind == kind {
+			filtered = append(filtered, addr)
+		}
+	}
+	return filtered
+}
+
+// AppendAddress appends ip to addrs with the given kind, skipping empty and
+// duplicate values. IPv6 literals are always labeled AddressIPv6.
+func AppendAddress(addrs []NetworkAddress, kind AddressKind, ip string) []NetworkAddress {
+	return AppendInterfaceAddress(addrs, kind, "", ip)
+}
+
+// AppendInterfaceAddress appends ip of the network interface iface to addrs
+// like AppendAddress.
+func AppendInterfaceAddress(addrs []NetworkAddress, kind AddressKind, iface, ip string) []NetworkAddress {
+	if ip == "" {
+		return addrs
+	}
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		kind = AddressIPv6
+	}
+	for _, addr := range addrs {
+		if addr.Address == ip {
+			return addrs
+		}
+	}
+	return append(addrs, NetworkAddress{Kind: kind, Address: ip, Interface: iface})
+}
+
+// PreferIPv6Flag is the create flag making GetIP report the IPv6 address of
+// dual-stack machines, for the drivers supporting it.
+const PreferIPv6Flag = "machine-prefer-ipv6"
+
+// SetIPv6PreferenceFromFlags sets whether GetIP prefers the IPv6 address from
+// the --machine-prefer-ipv6 flag
+func (d *BaseDriver) SetIPv6PreferenceFromFlags(flags DriverOptions) {
+	d.PreferIPv6 = flags.Bool(PreferIPv6Flag)
+}
+
+// SelectIP returns the address GetIP reports out of the IPv4 and IPv6
+// addresses of the machine: the IPv6 one when it is preferred, or when the
+// machine is IPv6-only, and the IPv4 one otherwise.
+func (d *BaseDriver) SelectIP(ipv4, ipv6 string) string {
+	if ipv6 != "" && (d.PreferIPv6 || ipv4 == "") {
+		return ipv6
+	}
+	return ipv4
+}
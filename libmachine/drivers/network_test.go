@@ -0,0 +1,31 @@
+package drivers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppendInterfaceAddress(t *testing.T) {
+	var addrs []NetworkAddress
+	addrs = AppendInterfaceAddress(addrs, AddressPrivate, "eth1", "10.0.0.5")
+	addrs = AppendInterfaceAddress(addrs, AddressPrivate, "eth1", "2001:db8::5")
+	addrs = AppendAddress(addrs, AddressPrivate, "10.0.0.5")
+	addrs = AppendAddress(addrs, AddressPublic, "")
+
+	assert.Equal(t, []NetworkAddress{
+		{Kind: AddressPrivate, Address: "10.0.0.5", Interface: "eth1"},
+		{Kind: AddressIPv6, Address: "2001:db8::5", Interface: "eth1"},
+	}, addrs)
+}
+
+func TestSelectIP(t *testing.T) {
+	d := &BaseDriver{}
+	assert.Equal(t, "203.0.113.5", d.SelectIP("203.0.113.5", "2001:db8::5"))
+	assert.Equal(t, "2001:db8::5", d.SelectIP("", "2001:db8::5"))
+	assert.Equal(t, "203.0.113.5", d.SelectIP("203.0.113.5", ""))
+
+	d.PreferIPv6 = true
+	assert.Equal(t, "2001:db8::5", d.SelectIP("203.0.113.5", "2001:db8::5"))
+	assert.Equal(t, "203.0.113.5", d.SelectIP("203.0.113.5", ""))
+}
@@ -0,0 +1,38 @@
+package drivers
+
+import "errors"
+
+// ErrPlanNotSupported is returned by PreCreatePlan for drivers that do not
+// implement DriverWithPlan.
+var ErrPlanNotSupported = errors.New("driver does not report the resources it creates")
+
+// PlannedResource is a resource Create would create.
+type PlannedResource struct {
+	// Type is the kind of the resource, named the way the provider does,
+	// such as instance or security-group.
+	Type    string
+	Name    string
+	Details string `json:",omitempty"`
+}
+
+// DriverWithPlan is implemented by drivers that can tell, before Create, the
+// resources it would create. PreCreatePlan is called after PreCreateCheck,
+// with the driver in dry-run mode.
+type DriverWithPlan interface {
+	Driver
+
+	// PreCreatePlan checks what PreCreateCheck leaves to Create, such as
+	// quotas, and returns the resources Create would create, without
+	// creating anything.
+	PreCreatePlan() ([]PlannedResource, error)
+}
+
+// PreCreatePlan returns the resources Create would create for d. It returns
+// ErrPlanNotSupported if d does not implement DriverWithPlan.
+func PreCreatePlan(d Driver) ([]PlannedResource, error) {
+	if pd, ok := d.(DriverWithPlan); ok {
+		return pd.PreCreatePlan()
+	}
+
+	return nil, ErrPlanNotSupported
+}
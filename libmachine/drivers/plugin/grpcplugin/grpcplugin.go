@@ -0,0 +1,200 @@
+// Package grpcplugin serves net/rpc style receivers over gRPC, so a driver
+// plugin can be reached over either transport with the same methods.
+//
+// Messages are gob encoded like net/rpc does, which keeps the types the
+// driver API exchanges, like flags held in interfaces, unchanged.
+package grpcplugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"reflect"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// ServicePackage versions the gRPC services. A receiver registered as
+// RPCServerDriver is served as machine.plugin.v1.RPCServerDriver.
+const ServicePackage = "machine.plugin.v1"
+
+var typeOfError = reflect.TypeOf((*error)(nil)).Elem()
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string {
+	return "gob"
+}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// Server serves receivers over gRPC.
+type Server struct {
+	server *grpc.Server
+}
+
+func NewServer() *Server {
+	return &Server{
+		server: grpc.NewServer(grpc.ForceServerCodec(gobCodec{})),
+	}
+}
+
+// RegisterName serves the methods of rcvr that net/rpc would serve, the
+// exported methods of the form
+//
+//	func (t *T) MethodName(args T1, reply *T2) error
+//
+// as the gRPC service called name.
+func (s *Server) RegisterName(name string, rcvr interface{}) error {
+	desc := &grpc.ServiceDesc{
+		ServiceName: ServicePackage + "." + name,
+		HandlerType: (*interface{})(nil),
+	}
+
+	value := reflect.ValueOf(rcvr)
+	for i := 0; i < value.NumMethod(); i++ {
+		method := value.Type().Method(i)
+		if !isRPCMethod(method.Type) {
+			continue
+		}
+		desc.Methods = append(desc.Methods, grpc.MethodDesc{
+			MethodName: method.Name,
+			Handler:    handler(value.Method(i)),
+		})
+	}
+
+	if len(desc.Methods) == 0 {
+		return fmt.Errorf("grpcplugin: type %s has no methods of suitable type", value.Type())
+	}
+
+	s.server.RegisterService(desc, rcvr)
+	return nil
+}
+
+func (s *Server) Serve(listener net.Listener) error {
+	return s.server.Serve(listener)
+}
+
+func (s *Server) Stop() {
+	s.server.Stop()
+}
+
+// isRPCMethod reports whether t, the type of a method including its
+// receiver, is one net/rpc serves.
+func isRPCMethod(t reflect.Type) bool {
+	return t.NumIn() == 3 && t.NumOut() == 1 &&
+		t.In(2).Kind() == reflect.Ptr &&
+		t.Out(0) == typeOfError
+}
+
+func handler(method reflect.Value) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	argType := method.Type().In(0)
+	replyType := method.Type().In(1).Elem()
+
+	return func(_ interface{}, _ context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+		var argv reflect.Value
+		if argType.Kind() == reflect.Ptr {
+			argv = reflect.New(argType.Elem())
+		} else {
+			argv = reflect.New(argType)
+		}
+		if err := dec(argv.Interface()); err != nil {
+			return nil, err
+		}
+		if argType.Kind() != reflect.Ptr {
+			argv = argv.Elem()
+		}
+
+		replyv := reflect.New(replyType)
+		if errv := method.Call([]reflect.Value{argv, replyv})[0]; !errv.IsNil() {
+			return nil, status.Error(codes.Unknown, errv.Interface().(error).Error())
+		}
+		return replyv.Interface(), nil
+	}
+}
+
+// Client calls the methods of a Server like a *rpc.Client would, returning
+// the same errors so that callers do not depend on the transport.
+type Client struct {
+	conn *grpc.ClientConn
+}
+
+// Dial connects to the Server listening at addr on the named network, like
+// "tcp" or "unix".
+func Dial(network, addr string) (*Client, error) {
+	return DialFunc(network, addr, nil)
+}
+
+// DialFunc is Dial, calling setup on each connection to addr before gRPC
+// uses it, e.g. to authenticate it.
+func DialFunc(network, addr string, setup func(net.Conn) error) (*Client, error) {
+	dialer := func(ctx context.Context, _ string) (net.Conn, error) {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, network, addr)
+		if err != nil || setup == nil {
+			return conn, err
+		}
+		if err := setup(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+
+	conn, err := grpc.NewClient("passthrough:///"+addr,
+		grpc.WithContextDialer(dialer),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(gobCodec{})))
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn}, nil
+}
+
+// Call invokes serviceMethod, of the form "Service.Method".
+func (c *Client) Call(serviceMethod string, args interface{}, reply interface{}) error {
+	dot := strings.LastIndex(serviceMethod, ".")
+	if dot < 0 {
+		return errors.New("rpc: service/method request ill-formed: " + serviceMethod)
+	}
+	fullMethod := "/" + ServicePackage + "." + serviceMethod[:dot] + "/" + serviceMethod[dot+1:]
+
+	err := c.conn.Invoke(context.Background(), fullMethod, args, reply)
+	if err == nil {
+		return nil
+	}
+
+	s := status.Convert(err)
+	switch s.Code() {
+	case codes.Unimplemented:
+		return errors.New("rpc: can't find method " + serviceMethod)
+	case codes.Unavailable, codes.Canceled:
+		return rpc.ErrShutdown
+	}
+	return rpc.ServerError(s.Message())
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
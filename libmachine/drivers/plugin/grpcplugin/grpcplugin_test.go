@@ -0,0 +1,116 @@
+package grpcplugin
+
+import (
+	"errors"
+	"net"
+	"net/rpc"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type Args struct {
+	A, B int
+}
+
+type Arith struct {
+	calls int
+}
+
+func (a *Arith) Add(args Args, reply *int) error {
+	a.calls++
+	*reply = args.A + args.B
+	return nil
+}
+
+func (a *Arith) Div(args *Args, reply *int) error {
+	if args.B == 0 {
+		return errors.New("divide by zero")
+	}
+	*reply = args.A / args.B
+	return nil
+}
+
+func (a *Arith) Ping(_, _ *struct{}) error {
+	return nil
+}
+
+// NotServed does not have the signature of a net/rpc method.
+func (a *Arith) NotServed() {}
+
+func newTestClient(t *testing.T, rcvr interface{}) (*Client, *Server) {
+	server := NewServer()
+	if err := server.RegisterName("Arith", rcvr); err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	client, err := Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return client, server
+}
+
+func TestCall(t *testing.T) {
+	arith := &Arith{}
+	client, _ := newTestClient(t, arith)
+
+	var sum int
+	assert.NoError(t, client.Call("Arith.Add", Args{A: 1, B: 2}, &sum))
+	assert.Equal(t, 3, sum)
+	assert.Equal(t, 1, arith.calls)
+
+	var quotient int
+	assert.NoError(t, client.Call("Arith.Div", &Args{A: 9, B: 3}, &quotient))
+	assert.Equal(t, 3, quotient)
+
+	assert.NoError(t, client.Call("Arith.Ping", struct{}{}, nil))
+}
+
+func TestCallErrors(t *testing.T) {
+	client, server := newTestClient(t, &Arith{})
+
+	var quotient int
+	err := client.Call("Arith.Div", Args{A: 1}, &quotient)
+	assert.Equal(t, rpc.ServerError("divide by zero"), err)
+
+	assert.EqualError(t, client.Call("Arith.NotServed", struct{}{}, nil), "rpc: can't find method Arith.NotServed")
+	assert.EqualError(t, client.Call("Arith", struct{}{}, nil), "rpc: service/method request ill-formed: Arith")
+
+	server.Stop()
+	assert.Equal(t, rpc.ErrShutdown, client.Call("Arith.Ping", struct{}{}, nil))
+}
+
+func TestCallOverUnixSocket(t *testing.T) {
+	server := NewServer()
+	assert.NoError(t, server.RegisterName("Arith", &Arith{}))
+
+	listener, err := net.Listen("unix", filepath.Join(t.TempDir(), "plugin.sock"))
+	if err != nil {
+		t.Skipf("unix sockets are not supported: %s", err)
+	}
+	go server.Serve(listener)
+	defer server.Stop()
+
+	client, err := Dial("unix", listener.Addr().String())
+	assert.NoError(t, err)
+	defer client.Close()
+
+	var sum int
+	assert.NoError(t, client.Call("Arith.Add", Args{A: 1, B: 2}, &sum))
+	assert.Equal(t, 3, sum)
+}
+
+func TestRegisterNameWithoutMethods(t *testing.T) {
+	assert.EqualError(t, NewServer().RegisterName("Empty", &struct{}{}), "grpcplugin: type *struct {} has no methods of suitable type")
+}
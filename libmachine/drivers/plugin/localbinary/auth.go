@@ -0,0 +1,144 @@
+package localbinary
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rancher/machine/libmachine/log"
+)
+
+// PluginEnvSessionToken is the secret the machine binary generates for each
+// plugin it starts. Plugins knowing it only serve the connections proving
+// they know it, and prove it in turn, which keeps other local processes from
+// driving them.
+const PluginEnvSessionToken = "MACHINE_PLUGIN_SESSION_TOKEN"
+
+const (
+	authTimeout = 10 * time.Second
+
+	hostProof   = "machine-host"
+	pluginProof = "machine-plugin"
+)
+
+// ErrUnauthenticated is returned when the other side of a plugin connection
+// does not know the session token.
+var ErrUnauthenticated = errors.New("the driver plugin connection is not authenticated")
+
+// NewSessionToken generates a random session token.
+func NewSessionToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+func proof(token, side string) []byte {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte(side))
+	return mac.Sum(nil)
+}
+
+// readProof reads the proof the other side sent and checks it.
+func readProof(conn net.Conn, token, side string) error {
+	received := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(conn, received); err != nil {
+		return err
+	}
+	if !hmac.Equal(received, proof(token, side)) {
+		return ErrUnauthenticated
+	}
+	return nil
+}
+
+// AuthenticateConn proves the machine binary knows token to the plugin
+// listening on conn, then checks that the plugin knows it as well. It is
+// done before any RPC.
+func AuthenticateConn(conn net.Conn, token string) error {
+	conn.SetDeadline(time.Now().Add(authTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if _, err := conn.Write(proof(token, hostProof)); err != nil {
+		return err
+	}
+	return readProof(conn, token, pluginProof)
+}
+
+// authenticatePlugin is the plugin side of AuthenticateConn.
+func authenticatePlugin(conn net.Conn, token string) error {
+	conn.SetDeadline(time.Now().Add(authTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if err := readProof(conn, token, hostProof); err != nil {
+		return err
+	}
+	_, err := conn.Write(proof(token, pluginProof))
+	return err
+}
+
+// authListener only accepts the connections authenticated with its token.
+// The connections are authenticated concurrently so that a client sending
+// nothing does not hold back the other ones.
+type authListener struct {
+	net.Listener
+	token string
+
+	once   sync.Once
+	conns  chan net.Conn
+	err    error
+	doneCh chan struct{}
+}
+
+// AuthListener wraps l so that it only accepts the connections of the
+// machine binary which generated token.
+func AuthListener(l net.Listener, token string) net.Listener {
+	return &authListener{
+		Listener: l,
+		token:    token,
+		conns:    make(chan net.Conn),
+		doneCh:   make(chan struct{}),
+	}
+}
+
+func (l *authListener) Accept() (net.Conn, error) {
+	l.once.Do(func() { go l.acceptLoop() })
+
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.doneCh:
+		return nil, l.err
+	}
+}
+
+func (l *authListener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			l.err = err
+			close(l.doneCh)
+			return
+		}
+
+		go func() {
+			if err := authenticatePlugin(conn, l.token); err != nil {
+				log.Debugf("Rejecting the driver plugin connection from %s: %s", conn.RemoteAddr(), err)
+				conn.Close()
+				return
+			}
+
+			select {
+			case l.conns <- conn:
+			case <-l.doneCh:
+				conn.Close()
+			}
+		}()
+	}
+}
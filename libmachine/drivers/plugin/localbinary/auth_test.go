@@ -0,0 +1,93 @@
+package localbinary
+
+import (
+	"crypto/sha256"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSessionToken(t *testing.T) {
+	token, err := NewSessionToken()
+	assert.NoError(t, err)
+	assert.Len(t, token, 64)
+
+	other, err := NewSessionToken()
+	assert.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+func listenAuthenticated(t *testing.T, token string) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := AuthListener(l, token)
+	t.Cleanup(func() { listener.Close() })
+	return listener
+}
+
+func TestAuthListenerAcceptsAuthenticatedConnections(t *testing.T) {
+	listener := listenAuthenticated(t, "secret")
+
+	// A connection sending nothing does not hold back the other ones.
+	idle, err := net.Dial("tcp", listener.Addr().String())
+	assert.NoError(t, err)
+	defer idle.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	accepted := make(chan net.Conn)
+	go func() {
+		c, err := listener.Accept()
+		assert.NoError(t, err)
+		accepted <- c
+	}()
+
+	assert.NoError(t, AuthenticateConn(conn, "secret"))
+	select {
+	case c := <-accepted:
+		c.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("the authenticated connection was not accepted")
+	}
+}
+
+func TestAuthListenerRejectsOtherTokens(t *testing.T) {
+	listener := listenAuthenticated(t, "secret")
+	go listener.Accept()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	assert.Error(t, AuthenticateConn(conn, "guessed"))
+}
+
+func TestAuthenticateConnRejectsImpostorPlugin(t *testing.T) {
+	host, plugin := net.Pipe()
+	defer host.Close()
+	defer plugin.Close()
+
+	// A plugin accepting any connection, without knowing the token.
+	go func() {
+		io.ReadFull(plugin, make([]byte, sha256.Size))
+		plugin.Write(proof("other", pluginProof))
+	}()
+
+	assert.Equal(t, ErrUnauthenticated, AuthenticateConn(host, "secret"))
+}
+
+func TestPluginAuthenticateLegacyPlugin(t *testing.T) {
+	lbp := &Plugin{Addr: "127.0.0.1:1234", sessionToken: "secret"}
+	host, _ := net.Pipe()
+	defer host.Close()
+
+	// Plugins predating session tokens do not expect any proof.
+	assert.NoError(t, lbp.Authenticate(host))
+}
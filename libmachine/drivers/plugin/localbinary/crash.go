@@ -0,0 +1,98 @@
+package localbinary
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const redactedArg = "<REDACTED>"
+
+// sensitiveFlag matches the names of the flags whose values are kept out of
+// crash reports.
+var sensitiveFlag = regexp.MustCompile(`(?i)(secret|password|token|key|credential)`)
+
+// ErrPluginCrashed is returned when the plugin process exited while it was
+// expected to serve its driver. The calls made to the crashed plugin fail
+// with it, Cause being the error of the call.
+type ErrPluginCrashed struct {
+	DriverName string
+	// CommandLine is how the plugin was started, without the values of the
+	// sensitive flags.
+	CommandLine []string
+	// ExitCode is -1 if the plugin was killed by a signal.
+	ExitCode int
+	// Status describes how the plugin exited, e.g. "exit status 2" or
+	// "signal: killed".
+	Status string
+	// Stderr holds the last lines the plugin wrote to stderr.
+	Stderr []string
+	Cause  error
+}
+
+func (e ErrPluginCrashed) Error() string {
+	msg := fmt.Sprintf("Driver plugin %s exited unexpectedly (%s)", e.DriverName, e.Status)
+	if e.Cause != nil {
+		msg += ": " + e.Cause.Error()
+	}
+	if len(e.CommandLine) > 0 {
+		msg += "\nCommand: " + strings.Join(e.CommandLine, " ")
+	}
+	if len(e.Stderr) > 0 {
+		msg += "\nLast plugin output:\n" + strings.Join(e.Stderr, "\n")
+	}
+	return msg
+}
+
+func (e ErrPluginCrashed) Unwrap() error {
+	return e.Cause
+}
+
+// newErrPluginCrashed describes the plugin process which exited with state.
+func (lbp *Plugin) newErrPluginCrashed(state *os.ProcessState) ErrPluginCrashed {
+	crash := ErrPluginCrashed{
+		DriverName: lbp.DriverName,
+		ExitCode:   state.ExitCode(),
+		Status:     state.String(),
+		Stderr:     append([]string{}, lbp.stderrTail...),
+	}
+	if described, ok := lbp.Executor.(interface{ CommandLine() []string }); ok {
+		crash.CommandLine = described.CommandLine()
+	}
+	return crash
+}
+
+// Crashed returns the ErrPluginCrashed describing the crash of the plugin,
+// or nil if it did not crash.
+func (lbp *Plugin) Crashed() error {
+	lbp.crashLock.Lock()
+	defer lbp.crashLock.Unlock()
+	return lbp.crashErr
+}
+
+// redactArgs returns args without the values of the sensitive flags, given
+// as --name=value or --name value.
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	redactNext := false
+	for i, arg := range args {
+		switch {
+		case redactNext && !strings.HasPrefix(arg, "-"):
+			redacted[i] = redactedArg
+			redactNext = false
+			continue
+		case strings.HasPrefix(arg, "-"):
+			name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+			sensitive := sensitiveFlag.MatchString(name)
+			redactNext = sensitive && !hasValue
+			if sensitive && hasValue {
+				arg = arg[:strings.Index(arg, "=")+1] + redactedArg
+			}
+		default:
+			redactNext = false
+		}
+		redacted[i] = arg
+	}
+	return redacted
+}
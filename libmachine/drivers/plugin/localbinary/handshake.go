@@ -0,0 +1,146 @@
+package localbinary
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/rancher/machine/libmachine/version"
+)
+
+// Protocols a plugin can serve its driver with.
+const (
+	// ProtocolNetRPC is net/rpc over HTTP, the only protocol of the plugins
+	// predating the handshake.
+	ProtocolNetRPC = "netrpc"
+	ProtocolGRPC   = "grpc"
+)
+
+// Networks a plugin can listen on.
+const (
+	NetworkTCP  = "tcp"
+	NetworkUnix = "unix"
+)
+
+const (
+	// CoreProtocolVersion is the version of the handshake itself.
+	CoreProtocolVersion = 1
+
+	// HandshakePrefix starts the line a plugin writes to its stdout once it
+	// serves its driver, the rest of the line being the JSON encoded
+	// handshake.
+	HandshakePrefix = "@machine-plugin "
+
+	// PluginEnvProtocols lists the protocols the machine binary supports,
+	// in order of preference. Plugins predating the handshake ignore it.
+	PluginEnvProtocols = "MACHINE_PLUGIN_PROTOCOLS"
+
+	// PluginEnvNetworks lists the networks the machine binary dials plugins
+	// on, in order of preference.
+	PluginEnvNetworks = "MACHINE_PLUGIN_NETWORKS"
+
+	// PluginEnvMultiplex set to true asks the plugin to serve the machines
+	// of the machine binary which started it, each with its own instance of
+	// the driver. Plugins which cannot create driver instances ignore it.
+	PluginEnvMultiplex = "MACHINE_PLUGIN_MULTIPLEX"
+)
+
+var (
+	// SupportedProtocols are the protocols this machine binary dials
+	// plugins with, in order of preference.
+	SupportedProtocols = []string{ProtocolGRPC, ProtocolNetRPC}
+
+	// SupportedNetworks are the networks this machine binary dials plugins
+	// on, in order of preference. Unix sockets avoid the port allocation of
+	// TCP and the firewalls filtering it, and are available on Windows 10
+	// and later too.
+	SupportedNetworks = []string{NetworkUnix, NetworkTCP}
+)
+
+// Handshake tells the machine binary where and how a plugin serves its
+// driver.
+type Handshake struct {
+	CoreProtocolVersion int
+	APIVersion          int
+	Network             string
+	Address             string
+	Protocol            string
+
+	// Authenticated tells the plugin only serves the connections
+	// authenticated with its session token.
+	Authenticated bool
+
+	// Multiplexed tells the plugin serves several machines, see
+	// PluginEnvMultiplex.
+	Multiplexed bool
+}
+
+func (h Handshake) String() string {
+	data, _ := json.Marshal(h)
+	return HandshakePrefix + string(data)
+}
+
+// ErrIncompatiblePlugin is returned when a plugin serves its driver with an
+// API version this machine binary does not speak.
+type ErrIncompatiblePlugin struct {
+	DriverName string
+	APIVersion int
+}
+
+func (e ErrIncompatiblePlugin) Error() string {
+	return fmt.Sprintf("Driver %q uses the plugin API version %d but this machine binary uses version %d. Upgrade the driver plugin or machine so that their versions match.", e.DriverName, e.APIVersion, version.APIVersion)
+}
+
+// NegotiateProtocol returns the first protocol of offered, the value of
+// PluginEnvProtocols, that the plugin serves, falling back to net/rpc.
+func NegotiateProtocol(offered string, served []string) string {
+	return negotiate(offered, served, ProtocolNetRPC)
+}
+
+// NegotiateNetwork returns the first network of offered, the value of
+// PluginEnvNetworks, that the plugin can listen on, falling back to TCP.
+func NegotiateNetwork(offered string, supported []string) string {
+	return negotiate(offered, supported, NetworkTCP)
+}
+
+func negotiate(offered string, supported []string, fallback string) string {
+	for _, choice := range strings.Split(offered, ",") {
+		for _, s := range supported {
+			if strings.TrimSpace(choice) == s {
+				return s
+			}
+		}
+	}
+	return fallback
+}
+
+// parseHandshake decodes a line of the stdout of a plugin. It returns false
+// for lines that are neither a handshake nor the bare address printed by the
+// plugins predating it, e.g. warnings printed by the driver at startup.
+func parseHandshake(line string) (Handshake, bool, error) {
+	line = strings.TrimSpace(line)
+
+	if strings.HasPrefix(line, HandshakePrefix) {
+		var h Handshake
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, HandshakePrefix)), &h); err != nil {
+			return h, false, fmt.Errorf("Error decoding the plugin handshake: %s", err)
+		}
+		if h.CoreProtocolVersion != CoreProtocolVersion {
+			return h, false, fmt.Errorf("Plugin uses an incompatible handshake version (%d)", h.CoreProtocolVersion)
+		}
+		if h.Protocol != ProtocolNetRPC && h.Protocol != ProtocolGRPC {
+			return h, false, fmt.Errorf("Plugin serves the unknown protocol %q", h.Protocol)
+		}
+		if h.Network != NetworkTCP && h.Network != NetworkUnix {
+			return h, false, fmt.Errorf("Plugin listens on the unknown network %q", h.Network)
+		}
+		return h, true, nil
+	}
+
+	if host, _, err := net.SplitHostPort(line); err == nil && net.ParseIP(host) != nil {
+		return Handshake{Network: NetworkTCP, Address: line, Protocol: ProtocolNetRPC}, true, nil
+	}
+
+	return Handshake{}, false, nil
+}
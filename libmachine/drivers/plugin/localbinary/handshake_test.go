@@ -0,0 +1,114 @@
+package localbinary
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHandshake(t *testing.T) {
+	unix := Handshake{CoreProtocolVersion: CoreProtocolVersion, APIVersion: 1, Network: "unix", Address: "/tmp/machine-plugin-1234/plugin.sock", Protocol: ProtocolNetRPC}
+	grpc := Handshake{CoreProtocolVersion: CoreProtocolVersion, APIVersion: 1, Network: "tcp", Address: "127.0.0.1:5678", Protocol: ProtocolGRPC}
+
+	var testCases = []struct {
+		line          string
+		expected      Handshake
+		expectedOk    bool
+		expectedError string
+	}{
+		{grpc.String(), grpc, true, ""},
+		{unix.String(), unix, true, ""},
+		{"127.0.0.1:1234\n", Handshake{Network: "tcp", Address: "127.0.0.1:1234", Protocol: ProtocolNetRPC}, true, ""},
+		{"Warning: the API endpoint is deprecated", Handshake{}, false, ""},
+		{"localhost:1234", Handshake{}, false, ""},
+		{HandshakePrefix + "{", Handshake{}, false, "Error decoding the plugin handshake: unexpected end of JSON input"},
+		{HandshakePrefix + `{"CoreProtocolVersion":2}`, Handshake{}, false, "Plugin uses an incompatible handshake version (2)"},
+		{HandshakePrefix + `{"CoreProtocolVersion":1,"Protocol":"carrier-pigeon"}`, Handshake{}, false, `Plugin serves the unknown protocol "carrier-pigeon"`},
+		{HandshakePrefix + `{"CoreProtocolVersion":1,"Protocol":"grpc","Network":"udp"}`, Handshake{}, false, `Plugin listens on the unknown network "udp"`},
+	}
+
+	for _, tc := range testCases {
+		h, ok, err := parseHandshake(tc.line)
+		assert.Equal(t, tc.expectedOk, ok, tc.line)
+		if tc.expectedError != "" {
+			assert.EqualError(t, err, tc.expectedError)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, h)
+	}
+}
+
+func TestNegotiateProtocol(t *testing.T) {
+	assert.Equal(t, ProtocolGRPC, NegotiateProtocol("grpc,netrpc", SupportedProtocols))
+	assert.Equal(t, ProtocolNetRPC, NegotiateProtocol("netrpc, grpc", SupportedProtocols))
+	assert.Equal(t, ProtocolNetRPC, NegotiateProtocol("grpc", []string{ProtocolNetRPC}))
+	assert.Equal(t, ProtocolNetRPC, NegotiateProtocol("", SupportedProtocols))
+}
+
+func TestNegotiateNetwork(t *testing.T) {
+	assert.Equal(t, NetworkUnix, NegotiateNetwork("unix,tcp", SupportedNetworks))
+	assert.Equal(t, NetworkTCP, NegotiateNetwork("unix,tcp", []string{NetworkTCP}))
+	assert.Equal(t, NetworkTCP, NegotiateNetwork("", SupportedNetworks))
+}
+
+func TestReadHandshakeSkipsDriverOutput(t *testing.T) {
+	h := Handshake{CoreProtocolVersion: CoreProtocolVersion, APIVersion: 1, Network: "tcp", Address: "127.0.0.1:5678", Protocol: ProtocolGRPC}
+	out := "Warning: could not load the credentials file\n" + h.String() + "\n"
+
+	lbp := &Plugin{MachineName: "test"}
+	assert.NoError(t, lbp.readHandshake(bufio.NewScanner(strings.NewReader(out))))
+	assert.Equal(t, h, lbp.handshake)
+}
+
+func TestReadHandshakePluginExited(t *testing.T) {
+	lbp := &Plugin{MachineName: "test"}
+	err := lbp.readHandshake(bufio.NewScanner(strings.NewReader("panic: nil pointer dereference\n")))
+	assert.EqualError(t, err, "Plugin exited before serving its driver")
+}
+
+func TestAddressHandshakeError(t *testing.T) {
+	fe := &FakeExecutor{
+		stdout: nopCloser{strings.NewReader(HandshakePrefix + `{"CoreProtocolVersion":2}` + "\n")},
+		stderr: nopCloser{strings.NewReader("")},
+	}
+	lbp := &Plugin{
+		Executor: fe,
+		addrCh:   make(chan string, 1),
+		stopCh:   make(chan bool, 1),
+	}
+
+	go lbp.Serve()
+
+	_, err := lbp.Address()
+	assert.EqualError(t, err, "Plugin uses an incompatible handshake version (2)")
+
+	protocol, err := lbp.Protocol()
+	assert.Empty(t, protocol)
+	assert.Error(t, err)
+}
+
+type nopCloser struct {
+	*strings.Reader
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+func TestReadHandshakeIncompatibleAPIVersion(t *testing.T) {
+	h := Handshake{CoreProtocolVersion: CoreProtocolVersion, APIVersion: 2, Network: "tcp", Address: "127.0.0.1:5678", Protocol: ProtocolGRPC}
+
+	lbp := &Plugin{DriverName: "hetzner"}
+	err := lbp.readHandshake(bufio.NewScanner(strings.NewReader(h.String() + "\n")))
+	assert.Equal(t, ErrIncompatiblePlugin{DriverName: "hetzner", APIVersion: 2}, err)
+	assert.EqualError(t, err, `Driver "hetzner" uses the plugin API version 2 but this machine binary uses version 1. Upgrade the driver plugin or machine so that their versions match.`)
+}
+
+func TestReadHandshakeLegacyPluginVersionUnknown(t *testing.T) {
+	lbp := &Plugin{DriverName: "hetzner"}
+	assert.NoError(t, lbp.readHandshake(bufio.NewScanner(strings.NewReader("127.0.0.1:1234\n"))))
+	assert.Equal(t, 0, lbp.handshake.APIVersion)
+}
@@ -2,53 +2,122 @@ package localbinary
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
-	"syscall"
+	"sync"
 	"time"
 
+	"github.com/rancher/machine/libmachine/drivers/plugin/sandbox"
 	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/metrics"
+	"github.com/rancher/machine/libmachine/progress"
+	"github.com/rancher/machine/libmachine/version"
 )
 
 var (
 	// Timeout where we will bail if we're not able to properly contact the
 	// plugin server.
-	defaultTimeout               = 10 * time.Second
+	defaultTimeout = 10 * time.Second
+
+	// How long a closing plugin is given to exit on its own, then once sent
+	// SIGTERM, before being killed.
+	defaultGracePeriod = 10 * time.Second
+
 	CurrentBinaryIsDockerMachine = false
 	CoreDrivers                  = []string{
+		"aliyunecs",
 		"amazonec2",
 		"azure",
 		"digitalocean",
+		"equinixmetal",
 		"exoscale",
 		"generic",
 		"google",
+		"harvester",
+		"hetzner",
 		"hyperv",
+		"ibmcloud",
+		"kvm",
+		"linode",
+		"lxd",
 		"none",
+		"nutanix",
+		"oci",
 		"openstack",
+		"proxmox",
+		"qemu",
 		"rackspace",
+		"scaleway",
 		"softlayer",
 		"virtualbox",
 		"vmwarefusion",
 		"vmwarevcloudair",
 		"vmwarevsphere",
+		"vultr",
 		"pod",
 		"noop",
 	}
+
+	// overridableDrivers are the core drivers which used to be plugins of
+	// their own. Their binaries in the PATH can still be used instead of the
+	// built-in drivers, see PluginEnvExternalDrivers.
+	overridableDrivers = []string{
+		"aliyunecs",
+		"equinixmetal",
+		"harvester",
+		"hetzner",
+		"ibmcloud",
+		"kvm",
+		"linode",
+		"lxd",
+		"nutanix",
+		"oci",
+		"proxmox",
+		"qemu",
+		"scaleway",
+		"vultr",
+	}
+
+	// PluginSandbox, when set, is the sandbox the drivers other than the
+	// core ones are started in. Sandboxing plugins is opt-in.
+	PluginSandbox *sandbox.Options
+
+	// PluginsDir, when set, is searched for the driver binaries missing from
+	// the PATH.
+	PluginsDir string
 )
 
 const (
-	pluginOut           = "(%s) %s"
-	pluginErr           = "(%s) DBG | %s"
-	PluginEnvKey        = "MACHINE_PLUGIN_TOKEN"
-	PluginEnvVal        = "42"
-	PluginEnvDriverName = "MACHINE_PLUGIN_DRIVER_NAME"
-	PluginUID           = "MACHINE_PLUGIN_UID"
-	PluginGID           = "MACHINE_PLUGIN_GID"
+	driverBinaryPrefix   = "docker-machine-driver-"
+	PluginEnvTimeout     = "MACHINE_PLUGIN_TIMEOUT"
+	PluginEnvRetries     = "MACHINE_PLUGIN_RETRIES"
+	PluginEnvGracePeriod = "MACHINE_PLUGIN_GRACE_PERIOD"
+	pluginOut            = "(%s) %s"
+	pluginErr            = "(%s) DBG | %s"
+	PluginEnvKey         = "MACHINE_PLUGIN_TOKEN"
+	PluginEnvVal         = "42"
+	PluginEnvDriverName  = "MACHINE_PLUGIN_DRIVER_NAME"
+	PluginUID            = "MACHINE_PLUGIN_UID"
+	PluginGID            = "MACHINE_PLUGIN_GID"
+
+	// PluginEnvLogFormat set to "json" asks the plugin to log frames, see
+	// log.Frame, rather than plain lines.
+	PluginEnvLogFormat  = "MACHINE_PLUGIN_LOG_FORMAT"
+	PluginLogFormatJSON = "json"
+
+	// PluginEnvExternalDrivers set to true uses the driver binaries found in
+	// the PATH for the core drivers which used to be plugins, rather than
+	// the built-in drivers.
+	PluginEnvExternalDrivers = "MACHINE_EXTERNAL_DRIVERS"
 )
 
 type PluginStreamer interface {
@@ -71,6 +140,27 @@ type PluginServer interface {
 	Close() error
 }
 
+// ContextPluginServer is a PluginServer whose startup can be cancelled.
+type ContextPluginServer interface {
+	// AddressContext is Address, giving up once ctx is done.
+	AddressContext(ctx context.Context) (string, error)
+
+	// ServeContext is Serve, stopping the plugin once ctx is done.
+	ServeContext(ctx context.Context) error
+}
+
+// PluginHealth keeps track of the heartbeats a plugin answered, to tell the
+// plugins which stopped responding.
+type PluginHealth interface {
+	// RecordHeartbeat notes that the plugin answered a heartbeat at the
+	// given time.
+	RecordHeartbeat(at time.Time)
+
+	// LastHeartbeat returns when the plugin last answered a heartbeat, or
+	// the zero time if it never did.
+	LastHeartbeat() time.Time
+}
+
 type McnBinaryExecutor interface {
 	// Execute the driver plugin.  Returns scanners for plugin binary
 	// stdout and stderr.
@@ -85,15 +175,44 @@ type McnBinaryExecutor interface {
 type DriverPlugin interface {
 	PluginServer
 	PluginStreamer
+	PluginHealth
 }
 
 type Plugin struct {
 	Executor    McnBinaryExecutor
+	DriverName  string
 	Addr        string
 	MachineName string
 	addrCh      chan string
 	stopCh      chan bool
+	exitedCh    chan struct{}
 	timeout     time.Duration
+	retries     int
+	backoff     time.Duration
+
+	// handshake is set before the address is sent to addrCh, or handshakeErr
+	// if the plugin could not tell where it serves its driver.
+	handshake    Handshake
+	handshakeErr error
+
+	// closeErrCh receives the result of stopping the plugin process on
+	// Close, and stderrTail the last lines the plugin wrote to stderr.
+	closeErrCh chan error
+	stderrTail []string
+
+	// servedCh is closed once Serve returned.
+	servedCh chan struct{}
+
+	// sessionToken authenticates the connections to the plugin, see
+	// PluginEnvSessionToken.
+	sessionToken string
+
+	heartbeatLock sync.Mutex
+	lastHeartbeat time.Time
+
+	// crashErr describes why the plugin process crashed, if it did.
+	crashLock sync.Mutex
+	crashErr  error
 }
 
 type Executor struct {
@@ -101,6 +220,46 @@ type Executor struct {
 	DriverName                 string
 	cmd                        *exec.Cmd
 	binaryPath                 string
+	sessionToken               string
+	commandLine                []string
+
+	// builtin is set when binaryPath is machine itself, serving one of its
+	// core drivers.
+	builtin bool
+
+	// multiplex asks the plugin to serve several machines.
+	multiplex bool
+
+	// exitCh is closed once the plugin process exited, with its state in
+	// exitState, or exitErr if waiting for it failed.
+	exitCh    chan struct{}
+	exitState *os.ProcessState
+	exitErr   error
+
+	// confinement holds the restrictions applied to the plugin process
+	// once started, released on Close.
+	confinement io.Closer
+
+	// gracePeriod is how long Close waits for the plugin to exit on its
+	// own, then once sent SIGTERM, before killing it.
+	gracePeriod time.Duration
+
+	// lock guards starting the plugin process against killing it.
+	lock   sync.Mutex
+	killed bool
+}
+
+// processKiller is implemented by the executors which can stop the plugin
+// process right away.
+type processKiller interface {
+	Kill() error
+}
+
+// processWatcher is implemented by the executors telling when the plugin
+// process exits on its own.
+type processWatcher interface {
+	Exited() <-chan struct{}
+	ExitState() (*os.ProcessState, error)
 }
 
 type ErrPluginBinaryNotFound struct {
@@ -112,82 +271,294 @@ func (e ErrPluginBinaryNotFound) Error() string {
 	return fmt.Sprintf("Driver %q not found. Do you have the plugin binary %q accessible in your PATH?", e.driverName, e.driverPath)
 }
 
-// driverPath locates the path of a driver binary based on its name.
+// driverPath locates the path of a driver binary based on its name, and
+// tells whether it is the driver built into machine.
 //   - For core drivers, there is no separate driver binary. The current binary is reused if it's `docker-machine`,
-//     or it is assumed that `docker-machine` is available in the PATH.
+//     or it is assumed that `docker-machine` is available in the PATH. The core drivers which used to be plugins
+//     are the exception when PluginEnvExternalDrivers is set: their `docker-machine-driver-driverName` binary in
+//     the PATH is used if there is one.
 //   - For non-core drivers, a separate binary must be in the PATH with the name `docker-machine-driver-driverName`.
-func driverPath(driverName string) string {
+func driverPath(driverName string) (string, bool) {
+	external := driverBinaryPrefix + driverName
+	if !isCoreDriver(driverName) {
+		return external, false
+	}
+
+	if externalDriverAllowed(driverName) {
+		if _, err := exec.LookPath(external); err == nil {
+			log.Warnf("Using the %s binary in the PATH rather than the built-in %s driver", external, driverName)
+			return external, false
+		}
+	}
+
+	if CurrentBinaryIsDockerMachine {
+		return os.Args[0], true
+	}
+
+	return "rancher-machine", true
+}
+
+// externalDriverAllowed reports whether the binary of the core driver in the
+// PATH may be used rather than the built-in driver, which is opt-in and only
+// for the core drivers which used to be plugins.
+func externalDriverAllowed(driverName string) bool {
+	value := os.Getenv(PluginEnvExternalDrivers)
+	if value == "" {
+		return false
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Warnf("Ignoring the invalid %s %q", PluginEnvExternalDrivers, value)
+		return false
+	}
+	if !enabled {
+		return false
+	}
+
+	for _, name := range overridableDrivers {
+		if name == driverName {
+			return true
+		}
+	}
+	return false
+}
+
+func isCoreDriver(driverName string) bool {
 	for _, coreDriver := range CoreDrivers {
 		if coreDriver == driverName {
-			if CurrentBinaryIsDockerMachine {
-				return os.Args[0]
+			return true
+		}
+	}
+
+	return false
+}
+
+// ListDrivers returns the names of every driver that NewPlugin can resolve:
+// the core drivers followed by the installed plugins, sorted by name.
+func ListDrivers() []string {
+	names := append([]string{}, CoreDrivers...)
+	for _, plugin := range InstalledPlugins() {
+		if !isCoreDriver(plugin.DriverName) {
+			names = append(names, plugin.DriverName)
+		}
+	}
+	return names
+}
+
+// InstalledPlugin is a driver binary NewPlugin resolves a driver name to.
+type InstalledPlugin struct {
+	DriverName string
+	Path       string
+}
+
+// InstalledPlugins returns the `docker-machine-driver-*` binaries found in
+// the PATH, the plugins directory or installed from the plugin registry,
+// sorted by driver name. Binaries shadowed by an earlier directory are left
+// out, as are the ones named after a core driver NewPlugin does not resolve
+// them for, see driverPath.
+func InstalledPlugins() []InstalledPlugin {
+	seen := map[string]bool{}
+
+	dirs := filepath.SplitList(os.Getenv("PATH"))
+	pathDirs := len(dirs)
+	if PluginsDir != "" {
+		dirs = append(dirs, PluginsDir)
+	}
+	if PluginRegistry != nil {
+		dirs = append(dirs, PluginRegistry.PluginsDir)
+	}
+
+	var plugins []InstalledPlugin
+	for i, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			name := strings.TrimSuffix(entry.Name(), ".exe")
+			if entry.IsDir() || !strings.HasPrefix(name, driverBinaryPrefix) {
+				continue
+			}
+
+			name = strings.TrimPrefix(name, driverBinaryPrefix)
+			if name == "" || seen[name] || (isCoreDriver(name) && (i >= pathDirs || !externalDriverAllowed(name))) {
+				continue
+			}
+			path, err := exec.LookPath(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				continue
 			}
 
-			return "rancher-machine"
+			seen[name] = true
+			plugins = append(plugins, InstalledPlugin{DriverName: name, Path: path})
 		}
 	}
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].DriverName < plugins[j].DriverName })
 
-	return fmt.Sprintf("docker-machine-driver-%s", driverName)
+	return plugins
+}
+
+// pluginTimeout reads MACHINE_PLUGIN_TIMEOUT, a duration like "30s" or a
+// number of seconds.
+func pluginTimeout() time.Duration {
+	return durationFromEnv(PluginEnvTimeout, defaultTimeout)
+}
+
+// pluginGracePeriod reads MACHINE_PLUGIN_GRACE_PERIOD, a duration like
+// "30s" or a number of seconds.
+func pluginGracePeriod() time.Duration {
+	return durationFromEnv(PluginEnvGracePeriod, defaultGracePeriod)
+}
+
+func durationFromEnv(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if duration, err := time.ParseDuration(value); err == nil && duration > 0 {
+		return duration
+	}
+
+	log.Warnf("Ignoring the invalid %s %q, using %s", name, value, defaultValue)
+	return defaultValue
+}
+
+// pluginRetries reads MACHINE_PLUGIN_RETRIES, the number of times Address
+// keeps waiting for a slow plugin server.
+func pluginRetries() int {
+	value := os.Getenv(PluginEnvRetries)
+	if value == "" {
+		return 0
+	}
+
+	retries, err := strconv.Atoi(value)
+	if err != nil || retries < 0 {
+		log.Warnf("Ignoring the invalid %s %q", PluginEnvRetries, value)
+		return 0
+	}
+	return retries
 }
 
 // NewPlugin creates a Plugin for the specified driver.
 //
 // The `driverName` can be either a simple name or an absolute path to the driver:
 //   - If `driverName` is a simple name, "docker-machine-driver-" is prepended to it,
-//     and the executable is searched for in the directories listed in the PATH environment variable.
+//     and the executable is searched for in the directories listed in the PATH environment variable,
+//     then in PluginsDir.
 //   - If `driverName` is an absolute path, the executable is searched for at that specific location.
 func NewPlugin(driverName string) (*Plugin, error) {
 	var path string
+	var builtin bool
 	dir, name := filepath.Split(driverName)
 	if dir == "" {
-		path = driverPath(driverName)
+		path, builtin = driverPath(driverName)
 	} else {
 		path = driverName
 	}
 	binaryPath, err := exec.LookPath(path)
+	if err != nil && dir == "" && PluginsDir != "" && !isCoreDriver(name) {
+		binaryPath, err = exec.LookPath(filepath.Join(PluginsDir, path))
+	}
 	if err != nil {
-		return nil, ErrPluginBinaryNotFound{name, path}
+		notFound := ErrPluginBinaryNotFound{name, path}
+		if dir != "" || PluginRegistry == nil || isCoreDriver(name) {
+			return nil, notFound
+		}
+
+		binaryPath, err = PluginRegistry.Install(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s\n%s", notFound, err)
+		}
 	}
 
 	log.Debugf("Found binary path at %s", binaryPath)
 
+	if !builtin {
+		if err := verifyBinary(name, binaryPath); err != nil {
+			return nil, err
+		}
+	}
+
+	token, err := NewSessionToken()
+	if err != nil {
+		return nil, fmt.Errorf("Error generating the plugin session token: %s", err)
+	}
+
 	return &Plugin{
-		stopCh: make(chan bool),
-		addrCh: make(chan string, 1),
+		DriverName:   name,
+		sessionToken: token,
+		stopCh:       make(chan bool),
+		addrCh:       make(chan string, 1),
+		exitedCh:     make(chan struct{}),
+		timeout:      pluginTimeout(),
+		retries:      pluginRetries(),
+		closeErrCh:   make(chan error, 1),
+		servedCh:     make(chan struct{}),
 		Executor: &Executor{
-			DriverName: name,
-			binaryPath: binaryPath,
+			DriverName:   name,
+			binaryPath:   binaryPath,
+			builtin:      builtin,
+			sessionToken: token,
+			gracePeriod:  pluginGracePeriod(),
 		},
 	}, nil
 }
 
+// NewMultiplexedPlugin is NewPlugin, asking the plugin to serve several
+// machines. Whether it does is known once it is listening, see Multiplexed.
+func NewMultiplexedPlugin(driverName string) (*Plugin, error) {
+	p, err := NewPlugin(driverName)
+	if err != nil {
+		return nil, err
+	}
+	p.Executor.(*Executor).multiplex = true
+	return p, nil
+}
+
 func (lbe *Executor) Start() (*bufio.Scanner, *bufio.Scanner, error) {
 	var err error
 
 	log.Debugf("Launching plugin server for driver %s", lbe.DriverName)
 
-	// The child process that gets executed when we run this subcommand will already inherit all this process' envvars,
-	// but we still need to pass all command-line arguments to it manually.
+	// The child process inherits the envvars of this process, plus the ones
+	// telling it to serve its driver. They are not set on this process so
+	// that plugins can be started concurrently. We still need to pass all
+	// command-line arguments to it manually.
+	env := append(os.Environ(),
+		PluginEnvKey+"="+PluginEnvVal,
+		PluginEnvSessionToken+"="+lbe.sessionToken,
+		PluginEnvDriverName+"="+lbe.DriverName,
+		PluginEnvProtocols+"="+strings.Join(SupportedProtocols, ","),
+		PluginEnvNetworks+"="+strings.Join(SupportedNetworks, ","),
+		PluginEnvLogFormat+"="+PluginLogFormatJSON)
+	if lbe.multiplex {
+		env = append(env, PluginEnvMultiplex+"=true")
+	}
+
 	cmd := exec.Command(lbe.binaryPath, os.Args...)
+	cmd.Env = env
 	gid := os.Getenv(PluginGID)
 	uid := os.Getenv(PluginUID)
-	if uid != "" && gid != "" {
-		uid, err := strconv.Atoi(uid)
-		if err != nil {
-			return nil, nil, fmt.Errorf("error parsing user ID: %w", err)
+	restricted := uid != "" && gid != ""
+	if restricted {
+		if err := dropPrivileges(cmd, uid, gid); err != nil {
+			return nil, nil, err
 		}
-		gid, err := strconv.Atoi(gid)
+	}
+	if PluginSandbox != nil && !lbe.builtin {
+		log.Debugf("Sandboxing plugin server for driver %s", lbe.DriverName)
+		cmd, err = sandbox.Command(*PluginSandbox, lbe.binaryPath, os.Args, env, cmd.SysProcAttr)
 		if err != nil {
-			return nil, nil, fmt.Errorf("error parsing group ID: %w", err)
-		}
-		cmd.SysProcAttr = &syscall.SysProcAttr{
-			Credential: &syscall.Credential{
-				Uid: uint32(uid),
-				Gid: uint32(gid),
-			},
+			return nil, nil, fmt.Errorf("Error sandboxing plugin binary: %s", err)
 		}
 	}
 	lbe.cmd = cmd
+	lbe.commandLine = append([]string{lbe.binaryPath}, redactArgs(os.Args)...)
 	lbe.pluginStdout, err = lbe.cmd.StdoutPipe()
 	if err != nil {
 		return nil, nil, fmt.Errorf("Error getting cmd stdout pipe: %s", err)
@@ -201,97 +572,517 @@ func (lbe *Executor) Start() (*bufio.Scanner, *bufio.Scanner, error) {
 	outScanner := bufio.NewScanner(lbe.pluginStdout)
 	errScanner := bufio.NewScanner(lbe.pluginStderr)
 
-	os.Setenv(PluginEnvKey, PluginEnvVal)
-	os.Setenv(PluginEnvDriverName, lbe.DriverName)
-
+	lbe.lock.Lock()
+	defer lbe.lock.Unlock()
+	if lbe.killed {
+		return nil, nil, errors.New("Plugin binary was killed before starting")
+	}
 	if err := lbe.cmd.Start(); err != nil {
 		return nil, nil, fmt.Errorf("Error starting plugin binary: %s", err)
 	}
 
+	// On Windows the restricted plugin starts suspended, confine resumes it.
+	if restricted {
+		lbe.confinement, err = confine(lbe.cmd)
+		if err != nil {
+			lbe.cmd.Process.Kill()
+			lbe.cmd.Wait()
+			return nil, nil, fmt.Errorf("Error confining plugin binary: %s", err)
+		}
+	}
+
+	// Wait for the process rather than the command, which would close the
+	// pipes before their output was read.
+	lbe.exitCh = make(chan struct{})
+	go func() {
+		lbe.exitState, lbe.exitErr = lbe.cmd.Process.Wait()
+		close(lbe.exitCh)
+	}()
+
 	return outScanner, errScanner, nil
 }
 
+// Kill stops the plugin process right away, or keeps it from starting.
+func (lbe *Executor) Kill() error {
+	lbe.lock.Lock()
+	defer lbe.lock.Unlock()
+
+	lbe.killed = true
+	if lbe.cmd == nil || lbe.cmd.Process == nil {
+		return nil
+	}
+	return lbe.cmd.Process.Kill()
+}
+
+// CommandLine returns how the plugin was started, without the values of the
+// sensitive flags.
+func (lbe *Executor) CommandLine() []string {
+	return lbe.commandLine
+}
+
+// Exited returns a channel closed once the plugin process exited.
+func (lbe *Executor) Exited() <-chan struct{} {
+	return lbe.exitCh
+}
+
+// ExitState returns how the plugin process exited, once Exited is closed.
+func (lbe *Executor) ExitState() (*os.ProcessState, error) {
+	return lbe.exitState, lbe.exitErr
+}
+
 func (lbe *Executor) Close() error {
-	if err := lbe.cmd.Wait(); err != nil {
-		return fmt.Errorf("Error waiting for binary close: %s", err)
+	stopErr := lbe.waitOrStop()
+	lbe.pluginStdout.Close()
+	lbe.pluginStderr.Close()
+	if lbe.confinement != nil {
+		lbe.confinement.Close()
+	}
+
+	if stopErr != nil {
+		return stopErr
+	}
+	if lbe.exitErr != nil {
+		return fmt.Errorf("Error waiting for binary close: %s", lbe.exitErr)
+	}
+	if !lbe.exitState.Success() {
+		return fmt.Errorf("Error waiting for binary close: %s", lbe.exitState)
 	}
 
 	return nil
 }
 
-func stream(scanner *bufio.Scanner, streamOutCh chan<- string) {
+// waitOrStop waits for the plugin process to exit, sending it SIGTERM then
+// killing it if it does not within the grace period.
+func (lbe *Executor) waitOrStop() error {
+	gracePeriod := lbe.gracePeriod
+	if gracePeriod <= 0 {
+		gracePeriod = defaultGracePeriod
+	}
+
+	select {
+	case <-lbe.exitCh:
+		return nil
+	case <-time.After(gracePeriod):
+	}
+
+	log.Debugf("Driver plugin %s did not exit in %s, terminating it", lbe.DriverName, gracePeriod)
+	if err := terminate(lbe.cmd.Process); err != nil {
+		log.Debugf("Error terminating driver plugin %s: %s", lbe.DriverName, err)
+	}
+
+	select {
+	case <-lbe.exitCh:
+		return fmt.Errorf("Driver plugin %s did not exit in %s and was terminated", lbe.DriverName, gracePeriod)
+	case <-time.After(gracePeriod):
+	}
+
+	lbe.cmd.Process.Kill()
+	<-lbe.exitCh
+	return fmt.Errorf("Driver plugin %s did not exit after being terminated and was killed", lbe.DriverName)
+}
+
+func stream(scanner *bufio.Scanner, streamOutCh chan<- string, machineName string) {
 	for scanner.Scan() {
 		line := scanner.Text()
 		if err := scanner.Err(); err != nil {
 			log.Warnf("Scanning stream: %s", err)
 		}
+
+		// Progress events reported by the driver are not plugin output.
+		if ev, ok := progress.ParsePluginEvent(line); ok {
+			ev.Machine = machineName
+			progress.Emit(ev)
+			continue
+		}
+
 		streamOutCh <- strings.Trim(line, "\n")
 	}
+	close(streamOutCh)
 }
 
 func (lbp *Plugin) AttachStream(scanner *bufio.Scanner) <-chan string {
 	streamOutCh := make(chan string)
-	go stream(scanner, streamOutCh)
+	go stream(scanner, streamOutCh, lbp.MachineName)
 	return streamOutCh
 }
 
-func (lbp *Plugin) execServer() error {
+func (lbp *Plugin) execServer(ctx context.Context) error {
+	if lbp.servedCh != nil {
+		defer close(lbp.servedCh)
+	}
+
+	start := time.Now()
 	outScanner, errScanner, err := lbp.Executor.Start()
 	if err != nil {
+		metrics.ObserveHandshake(lbp.DriverName, time.Since(start), err)
+		lbp.handshakeErr = err
+		lbp.addrCh <- ""
 		return err
 	}
 
-	// Scan just one line to get the address, then send it to the relevant
-	// channel.
-	outScanner.Scan()
-	addr := outScanner.Text()
-	if err := outScanner.Err(); err != nil {
-		return fmt.Errorf("Reading plugin address failed: %s", err)
-	}
+	// Stop a plugin stuck before serving its driver once ctx is done.
+	handshook := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			lbp.kill()
+		case <-handshook:
+		}
+	}()
 
-	lbp.addrCh <- strings.TrimSpace(addr)
+	// Scan lines until the plugin tells where it serves its driver, then send
+	// the address to the relevant channel. The lines printed before, e.g.
+	// warnings of the driver, are plugin output.
+	err = lbp.readHandshake(outScanner)
+	close(handshook)
+	metrics.ObserveHandshake(lbp.DriverName, time.Since(start), err)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		lbp.handshakeErr = err
+		lbp.addrCh <- ""
+		return err
+	}
+	lbp.addrCh <- lbp.handshake.Address
 
 	stdOutCh := lbp.AttachStream(outScanner)
 	stdErrCh := lbp.AttachStream(errScanner)
 
+	var exited <-chan struct{}
+	watcher, watched := lbp.Executor.(processWatcher)
+	if watched {
+		exited = watcher.Exited()
+	}
+
 	for {
 		select {
-		case out := <-stdOutCh:
-			log.Infof(pluginOut, lbp.MachineName, out)
-		case err := <-stdErrCh:
-			log.Debugf(pluginErr, lbp.MachineName, err)
+		case out, ok := <-stdOutCh:
+			if !ok {
+				stdOutCh = nil
+				continue
+			}
+			lbp.logOutput(out, false)
+		case err, ok := <-stdErrCh:
+			if !ok {
+				stdErrCh = nil
+				continue
+			}
+			lbp.recordStderr(err)
+			lbp.logOutput(err, true)
+		case <-exited:
+			// Plugins exit cleanly once asked to close, before being
+			// stopped.
+			exited = nil
+			if err := lbp.processExited(watcher, stdErrCh); err != nil {
+				return err
+			}
 		case <-lbp.stopCh:
-			if err := lbp.Executor.Close(); err != nil {
-				return fmt.Errorf("Error closing local plugin binary: %s", err)
+			err := lbp.closeExecutor(stdErrCh)
+			if lbp.closeErrCh != nil {
+				lbp.closeErrCh <- err
+			}
+			return err
+		case <-ctx.Done():
+			lbp.kill()
+			lbp.Executor.Close()
+			return ctx.Err()
+		}
+	}
+}
+
+// stderrTailLines is how many of the last lines written by the plugin to
+// stderr are kept to explain why it failed to close.
+const stderrTailLines = 10
+
+func (lbp *Plugin) recordStderr(line string) {
+	lbp.stderrTail = append(lbp.stderrTail, line)
+	if len(lbp.stderrTail) > stderrTailLines {
+		lbp.stderrTail = lbp.stderrTail[len(lbp.stderrTail)-stderrTailLines:]
+	}
+}
+
+// closeExecutor stops the plugin process. If it does not exit cleanly, the
+// returned error includes the last lines the plugin wrote to stderr.
+func (lbp *Plugin) closeExecutor(stdErrCh <-chan string) error {
+	err := lbp.Executor.Close()
+	if err == nil {
+		return nil
+	}
+
+	lbp.drainStderr(stdErrCh)
+
+	msg := fmt.Sprintf("Error closing driver plugin %s: %s", lbp.DriverName, err)
+	if len(lbp.stderrTail) > 0 {
+		msg += "\nLast plugin output:\n" + strings.Join(lbp.stderrTail, "\n")
+	}
+	return errors.New(msg)
+}
+
+// drainStderr records what the plugin wrote to stderr before exiting, for up
+// to a second.
+func (lbp *Plugin) drainStderr(stdErrCh <-chan string) {
+	drained := time.After(time.Second)
+	for stdErrCh != nil {
+		select {
+		case line, ok := <-stdErrCh:
+			if !ok {
+				stdErrCh = nil
+				continue
 			}
+			lbp.recordStderr(line)
+		case <-drained:
+			stdErrCh = nil
+		}
+	}
+}
+
+// processExited logs how the plugin process exited. It returns an error if
+// the plugin crashed, an ErrPluginCrashed if it exited with an error, after
+// closing the channel returned by Exited.
+func (lbp *Plugin) processExited(watcher processWatcher, stdErrCh <-chan string) error {
+	state, err := watcher.ExitState()
+	if err != nil {
+		err = fmt.Errorf("Error waiting for the driver plugin: %s", err)
+	} else if !state.Success() {
+		lbp.drainStderr(stdErrCh)
+		err = lbp.newErrPluginCrashed(state)
+	}
+
+	if err == nil {
+		log.Debugf("(%s) Driver plugin exited", lbp.MachineName)
+		return nil
+	}
+
+	lbp.crashLock.Lock()
+	lbp.crashErr = err
+	lbp.crashLock.Unlock()
+
+	log.Warnf("(%s) %s", lbp.MachineName, err)
+	lbp.Executor.Close()
+	if lbp.exitedCh != nil {
+		close(lbp.exitedCh)
+	}
+	return err
+}
+
+// Exited returns a channel closed if the plugin process crashed. The plugin
+// must then be started again to be used.
+func (lbp *Plugin) Exited() <-chan struct{} {
+	return lbp.exitedCh
+}
+
+func (lbp *Plugin) readHandshake(scanner *bufio.Scanner) error {
+	for scanner.Scan() {
+		h, ok, err := parseHandshake(scanner.Text())
+		if err != nil {
+			return err
+		}
+		if ok {
+			// Plugins predating the handshake report their API version
+			// once connected to.
+			if h.APIVersion != 0 && h.APIVersion != version.APIVersion {
+				return ErrIncompatiblePlugin{DriverName: lbp.DriverName, APIVersion: h.APIVersion}
+			}
+			lbp.handshake = h
 			return nil
 		}
+		lbp.logOutput(strings.TrimSpace(scanner.Text()), false)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("Reading plugin address failed: %s", err)
+	}
+	return errors.New("Plugin exited before serving its driver")
+}
+
+// logOutput logs a line of output of the plugin at the level of the frame
+// it holds. The plain lines of older plugins are logged at the info level if
+// written to stdout, and at the debug level if written to stderr.
+func (lbp *Plugin) logOutput(line string, stderr bool) {
+	frame, ok := log.ParseFrame(line)
+	if !ok {
+		if stderr {
+			log.Debugf(pluginErr, lbp.MachineName, line)
+		} else {
+			log.Infof(pluginOut, lbp.MachineName, line)
+		}
+		return
+	}
+
+	switch frame.Level {
+	case log.LevelError:
+		log.Errorf(pluginOut, lbp.MachineName, frame)
+	case log.LevelWarn:
+		log.Warnf(pluginOut, lbp.MachineName, frame)
+	case log.LevelInfo:
+		log.Infof(pluginOut, lbp.MachineName, frame)
+	default:
+		log.Debugf(pluginErr, lbp.MachineName, frame)
 	}
 }
 
 func (lbp *Plugin) Serve() error {
-	return lbp.execServer()
+	return lbp.execServer(context.Background())
+}
+
+// ServeContext is Serve, killing the plugin once ctx is done.
+func (lbp *Plugin) ServeContext(ctx context.Context) error {
+	return lbp.execServer(ctx)
+}
+
+// kill stops the plugin process right away, if the executor can.
+func (lbp *Plugin) kill() {
+	if killer, ok := lbp.Executor.(processKiller); ok {
+		if err := killer.Kill(); err != nil {
+			log.Debugf("Error killing the driver plugin: %s", err)
+		}
+	}
+}
+
+// SetTimeout sets how long Address waits for the plugin server to listen,
+// MACHINE_PLUGIN_TIMEOUT or 10s by default.
+func (lbp *Plugin) SetTimeout(timeout time.Duration) {
+	lbp.timeout = timeout
+}
+
+// SetRetries makes Address keep waiting for a slow plugin server retries
+// more times once the timeout expired, the first time for backoff and then
+// twice as long as the previous time.
+func (lbp *Plugin) SetRetries(retries int, backoff time.Duration) {
+	lbp.retries = retries
+	lbp.backoff = backoff
 }
 
 func (lbp *Plugin) Address() (string, error) {
+	return lbp.AddressContext(context.Background())
+}
+
+// AddressContext is Address, giving up once ctx is done. The plugin is then
+// killed since it never told where it serves its driver. The deadline of ctx,
+// if any, replaces the timeout and retries of the plugin.
+func (lbp *Plugin) AddressContext(ctx context.Context) (string, error) {
 	if lbp.Addr == "" {
 		if lbp.timeout == 0 {
 			lbp.timeout = defaultTimeout
 		}
 
-		select {
-		case lbp.Addr = <-lbp.addrCh:
-			log.Debugf("Plugin server listening at address %s", lbp.Addr)
-			close(lbp.addrCh)
-			return lbp.Addr, nil
-		case <-time.After(lbp.timeout):
-			return "", fmt.Errorf("Failed to dial the plugin server in %s", lbp.timeout)
+		wait, waited := lbp.timeout, time.Duration(0)
+		backoff := lbp.backoff
+		if backoff == 0 {
+			backoff = lbp.timeout
+		}
+		_, hasDeadline := ctx.Deadline()
+
+		for attempt := 0; ; attempt++ {
+			var timeout <-chan time.Time
+			if !hasDeadline {
+				timeout = time.After(wait)
+			}
+
+			select {
+			case addr, ok := <-lbp.addrCh:
+				if !ok || addr == "" && lbp.handshakeErr != nil {
+					if ok {
+						close(lbp.addrCh)
+					}
+					return "", lbp.handshakeErr
+				}
+				lbp.Addr = addr
+				log.Debugf("Plugin server listening at address %s", lbp.Addr)
+				close(lbp.addrCh)
+				return lbp.Addr, nil
+			case <-ctx.Done():
+				lbp.kill()
+				return "", fmt.Errorf("Failed to dial the plugin server: %w", ctx.Err())
+			case <-timeout:
+				waited += wait
+				if attempt >= lbp.retries {
+					return "", fmt.Errorf("Failed to dial the plugin server in %s", waited)
+				}
+				log.Debugf("Plugin server not listening after %s, waiting %s more", waited, backoff)
+				wait, backoff = backoff, backoff*2
+			}
 		}
 	}
 	return lbp.Addr, nil
 }
 
-func (lbp *Plugin) Close() error {
-	lbp.stopCh <- true
+// Protocol returns the protocol the plugin serves its driver with, once it
+// is listening.
+func (lbp *Plugin) Protocol() (string, error) {
+	if _, err := lbp.Address(); err != nil {
+		return "", err
+	}
+	if lbp.handshake.Protocol == "" {
+		return ProtocolNetRPC, nil
+	}
+	return lbp.handshake.Protocol, nil
+}
+
+// Multiplexed tells whether the plugin serves several machines, once it is
+// listening.
+func (lbp *Plugin) Multiplexed() (bool, error) {
+	if _, err := lbp.Address(); err != nil {
+		return false, err
+	}
+	return lbp.handshake.Multiplexed, nil
+}
+
+// Network returns the network the plugin listens on, once it is listening.
+func (lbp *Plugin) Network() (string, error) {
+	if _, err := lbp.Address(); err != nil {
+		return "", err
+	}
+	if lbp.handshake.Network == "" {
+		return NetworkTCP, nil
+	}
+	return lbp.handshake.Network, nil
+}
+
+func (lbp *Plugin) RecordHeartbeat(at time.Time) {
+	lbp.heartbeatLock.Lock()
+	defer lbp.heartbeatLock.Unlock()
+	if at.After(lbp.lastHeartbeat) {
+		lbp.lastHeartbeat = at
+	}
+}
+
+func (lbp *Plugin) LastHeartbeat() time.Time {
+	lbp.heartbeatLock.Lock()
+	defer lbp.heartbeatLock.Unlock()
+	return lbp.lastHeartbeat
+}
+
+// Authenticate proves to the plugin listening on conn that it was started by
+// this machine binary, and checks that the plugin was. Plugins predating
+// session tokens accept any connection.
+func (lbp *Plugin) Authenticate(conn net.Conn) error {
+	if _, err := lbp.Address(); err != nil {
+		return err
+	}
+	if !lbp.handshake.Authenticated {
+		return nil
+	}
+	if err := AuthenticateConn(conn, lbp.sessionToken); err != nil {
+		return fmt.Errorf("Error authenticating to the driver plugin %s: %s", lbp.DriverName, err)
+	}
 	return nil
 }
+
+// Close stops the plugin server, returning why if the plugin process could
+// not be stopped cleanly.
+func (lbp *Plugin) Close() error {
+	select {
+	case lbp.stopCh <- true:
+	case <-lbp.exitedCh:
+		return nil
+	case <-lbp.servedCh:
+		return nil
+	}
+
+	if lbp.closeErrCh == nil {
+		return nil
+	}
+	return <-lbp.closeErrCh
+}
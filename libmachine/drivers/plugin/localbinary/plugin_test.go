@@ -2,14 +2,21 @@ package localbinary
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"testing"
 	"time"
 
 	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
 
 	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/metrics"
+	"github.com/rancher/machine/libmachine/progress"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -69,6 +76,58 @@ func TestLocalBinaryPluginAddressTimeout(t *testing.T) {
 	assert.EqualError(t, err, "Failed to dial the plugin server in 1s")
 }
 
+func TestLocalBinaryPluginAddressRetries(t *testing.T) {
+	lbp := &Plugin{addrCh: make(chan string, 1)}
+	lbp.SetTimeout(50 * time.Millisecond)
+	lbp.SetRetries(2, 50*time.Millisecond)
+
+	go func() {
+		time.Sleep(120 * time.Millisecond)
+		lbp.addrCh <- "127.0.0.1:12345"
+	}()
+
+	addr, err := lbp.Address()
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:12345", addr)
+}
+
+func TestLocalBinaryPluginAddressRetriesExhausted(t *testing.T) {
+	lbp := &Plugin{addrCh: make(chan string, 1)}
+	lbp.SetTimeout(50 * time.Millisecond)
+	lbp.SetRetries(2, 50*time.Millisecond)
+
+	addr, err := lbp.Address()
+
+	assert.Empty(t, addr)
+	assert.EqualError(t, err, "Failed to dial the plugin server in 200ms")
+}
+
+func TestPluginTimeoutFromEnv(t *testing.T) {
+	var testCases = []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", defaultTimeout},
+		{"30", 30 * time.Second},
+		{"1m30s", 90 * time.Second},
+		{"-5", defaultTimeout},
+		{"soon", defaultTimeout},
+	}
+
+	for _, tc := range testCases {
+		t.Setenv(PluginEnvTimeout, tc.value)
+		assert.Equal(t, tc.expected, pluginTimeout(), tc.value)
+	}
+}
+
+func TestPluginRetriesFromEnv(t *testing.T) {
+	t.Setenv(PluginEnvRetries, "3")
+	assert.Equal(t, 3, pluginRetries())
+
+	t.Setenv(PluginEnvRetries, "many")
+	assert.Equal(t, 0, pluginRetries())
+}
+
 func TestLocalBinaryPluginClose(t *testing.T) {
 	lbp := &Plugin{}
 	lbp.stopCh = make(chan bool, 1)
@@ -113,7 +172,7 @@ func TestExecServer(t *testing.T) {
 
 	// Start the docker-machine-foo plugin server
 	go func() {
-		finalErr <- lbp.execServer()
+		finalErr <- lbp.execServer(context.Background())
 	}()
 
 	logOutScanner := bufio.NewScanner(logOutReader)
@@ -157,3 +216,382 @@ func TestExecServer(t *testing.T) {
 		t.Fatalf("Error serving: %s", err)
 	}
 }
+
+func TestListDrivers(t *testing.T) {
+	dir := t.TempDir()
+	for name, mode := range map[string]os.FileMode{
+		"docker-machine-driver-zeta":      0755,
+		"docker-machine-driver-alpha":     0755,
+		"docker-machine-driver-amazonec2": 0755,
+		"docker-machine-driver-noexec":    0644,
+		"unrelated":                       0755,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir)
+
+	drivers := ListDrivers()
+
+	assert.Equal(t, CoreDrivers, drivers[:len(CoreDrivers)])
+	assert.Equal(t, []string{"alpha", "zeta"}, drivers[len(CoreDrivers):])
+}
+
+func TestInstalledPlugins(t *testing.T) {
+	pathDir, pluginsDir := t.TempDir(), t.TempDir()
+	for _, path := range []string{
+		filepath.Join(pathDir, "docker-machine-driver-zeta"),
+		filepath.Join(pluginsDir, "docker-machine-driver-zeta"),
+		filepath.Join(pluginsDir, "docker-machine-driver-alpha"),
+	} {
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", pathDir)
+	defer func(orig string) { PluginsDir = orig }(PluginsDir)
+	PluginsDir = pluginsDir
+
+	// The binaries in the PATH shadow the ones of the plugins directory.
+	assert.Equal(t, []InstalledPlugin{
+		{DriverName: "alpha", Path: filepath.Join(pluginsDir, "docker-machine-driver-alpha")},
+		{DriverName: "zeta", Path: filepath.Join(pathDir, "docker-machine-driver-zeta")},
+	}, InstalledPlugins())
+}
+
+func TestNewPluginFromPluginsDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake driver binary is a shell script")
+	}
+	pluginsDir := t.TempDir()
+	binary := filepath.Join(pluginsDir, "docker-machine-driver-alpha")
+	if err := os.WriteFile(binary, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", t.TempDir())
+	defer func(orig string) { PluginsDir = orig }(PluginsDir)
+	PluginsDir = pluginsDir
+
+	p, err := NewPlugin("alpha")
+
+	assert.NoError(t, err)
+	assert.Equal(t, binary, p.Executor.(*Executor).binaryPath)
+}
+
+func TestNewPluginPrefersExternalCoreDriver(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake driver binary is a shell script")
+	}
+	pathDir := t.TempDir()
+	binary := filepath.Join(pathDir, "docker-machine-driver-hetzner")
+	if err := os.WriteFile(binary, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", pathDir)
+	t.Setenv(PluginEnvExternalDrivers, "true")
+
+	p, err := NewPlugin("hetzner")
+
+	assert.NoError(t, err)
+	assert.Equal(t, binary, p.Executor.(*Executor).binaryPath)
+	assert.False(t, p.Executor.(*Executor).builtin)
+	assert.Equal(t, []InstalledPlugin{{DriverName: "hetzner", Path: binary}}, InstalledPlugins())
+}
+
+func TestExternalCoreDriverIsOptIn(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake driver binary is a shell script")
+	}
+	pathDir := t.TempDir()
+	for _, name := range []string{"hetzner", "amazonec2"} {
+		if err := os.WriteFile(filepath.Join(pathDir, "docker-machine-driver-"+name), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", pathDir)
+
+	path, builtin := driverPath("hetzner")
+	assert.Equal(t, "rancher-machine", path)
+	assert.True(t, builtin)
+	assert.Empty(t, InstalledPlugins())
+
+	// Only the core drivers which used to be plugins can be overridden.
+	t.Setenv(PluginEnvExternalDrivers, "true")
+	path, builtin = driverPath("amazonec2")
+	assert.Equal(t, "rancher-machine", path)
+	assert.True(t, builtin)
+	assert.Equal(t, []InstalledPlugin{{DriverName: "hetzner", Path: filepath.Join(pathDir, "docker-machine-driver-hetzner")}}, InstalledPlugins())
+}
+
+func TestAttachStreamProgressEvents(t *testing.T) {
+	var events []progress.Event
+	defer progress.Subscribe("machine", func(ev progress.Event) {
+		events = append(events, ev)
+	})()
+
+	out := &bytes.Buffer{}
+	out.WriteString("Creating instance...\n")
+	progress.PluginWriter(out)(progress.Event{Type: progress.StepStarted, Machine: "plugin-side", Step: progress.WaitingForInstance})
+	out.WriteString("Instance created\n")
+
+	lbp := &Plugin{MachineName: "machine"}
+	outCh := lbp.AttachStream(bufio.NewScanner(out))
+
+	assert.Equal(t, "Creating instance...", <-outCh)
+	assert.Equal(t, "Instance created", <-outCh)
+	assert.Equal(t, []progress.Event{{Type: progress.StepStarted, Machine: "machine", Step: progress.WaitingForInstance}}, events)
+}
+
+func newScriptPlugin(t *testing.T, script string) *Plugin {
+	if runtime.GOOS == "windows" {
+		t.Skip("the driver binary is a shell script")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "docker-machine-driver-script"), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+
+	p, err := NewPlugin("script")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestPluginProcessCrash(t *testing.T) {
+	p := newScriptPlugin(t, "echo 127.0.0.1:1234\nsleep 0.1\nexit 3\n")
+
+	served := make(chan error)
+	go func() { served <- p.Serve() }()
+
+	_, err := p.Address()
+	assert.NoError(t, err)
+
+	select {
+	case <-p.Exited():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the crash of the plugin was not detected")
+	}
+	err = <-served
+	crash, ok := err.(ErrPluginCrashed)
+	assert.True(t, ok, err)
+	assert.Equal(t, 3, crash.ExitCode)
+	assert.Equal(t, "exit status 3", crash.Status)
+	assert.Equal(t, err, p.Crashed())
+
+	// A crashed plugin can still be closed.
+	assert.NoError(t, p.Close())
+}
+
+func TestPluginProcessCrashDiagnostics(t *testing.T) {
+	p := newScriptPlugin(t, "echo 127.0.0.1:1234\necho panic: nil map >&2\necho goroutine 1 >&2\nexit 2\n")
+
+	served := make(chan error)
+	go func() { served <- p.Serve() }()
+
+	_, err := p.Address()
+	assert.NoError(t, err)
+
+	crash, ok := (<-served).(ErrPluginCrashed)
+	assert.True(t, ok)
+	assert.Equal(t, "script", crash.DriverName)
+	assert.Equal(t, []string{"panic: nil map", "goroutine 1"}, crash.Stderr)
+	assert.Equal(t, p.Executor.(*Executor).binaryPath, crash.CommandLine[0])
+
+	crash.CommandLine = []string{"docker-machine-driver-script", "create"}
+	crash.Cause = io.ErrUnexpectedEOF
+	assert.ErrorIs(t, crash, io.ErrUnexpectedEOF)
+	assert.EqualError(t, crash, "Driver plugin script exited unexpectedly (exit status 2): unexpected EOF\n"+
+		"Command: docker-machine-driver-script create\n"+
+		"Last plugin output:\n"+
+		"panic: nil map\n"+
+		"goroutine 1")
+}
+
+func TestRedactArgs(t *testing.T) {
+	assert.Equal(t,
+		[]string{"create", "--amazonec2-secret-key", "<REDACTED>", "--digitalocean-access-token=<REDACTED>", "--debug", "--amazonec2-region", "eu-west-1", "default"},
+		redactArgs([]string{"create", "--amazonec2-secret-key", "s3cr3t", "--digitalocean-access-token=t0k3n", "--debug", "--amazonec2-region", "eu-west-1", "default"}))
+}
+
+func TestPluginProcessCleanExit(t *testing.T) {
+	p := newScriptPlugin(t, "echo 127.0.0.1:1234\n")
+
+	served := make(chan error)
+	go func() { served <- p.Serve() }()
+
+	_, err := p.Address()
+	assert.NoError(t, err)
+
+	assert.NoError(t, p.Close())
+	assert.NoError(t, <-served)
+
+	select {
+	case <-p.Exited():
+		t.Fatal("a plugin exiting cleanly did not crash")
+	default:
+	}
+}
+
+func TestPluginHandshakeMetrics(t *testing.T) {
+	metrics.Reset()
+	defer metrics.Reset()
+	p := newScriptPlugin(t, "echo 127.0.0.1:1234\n")
+
+	go p.Serve()
+	_, err := p.Address()
+	assert.NoError(t, err)
+	assert.NoError(t, p.Close())
+
+	assert.Equal(t, uint64(1), metrics.PluginHandshakeDuration.Count("script"))
+}
+
+func TestPluginGracePeriodFromEnv(t *testing.T) {
+	t.Setenv(PluginEnvGracePeriod, "")
+	assert.Equal(t, defaultGracePeriod, pluginGracePeriod())
+
+	t.Setenv(PluginEnvGracePeriod, "2s")
+	assert.Equal(t, 2*time.Second, pluginGracePeriod())
+}
+
+func TestPluginCloseTerminatesHungPlugin(t *testing.T) {
+	p := newScriptPlugin(t, "echo 127.0.0.1:1234\necho waiting for the API >&2\nexec /bin/sleep 60\n")
+	p.Executor.(*Executor).gracePeriod = 100 * time.Millisecond
+
+	go p.Serve()
+	_, err := p.Address()
+	assert.NoError(t, err)
+
+	assert.EqualError(t, p.Close(), "Error closing driver plugin script: Driver plugin script did not exit in 100ms and was terminated\n"+
+		"Last plugin output:\n"+
+		"waiting for the API")
+}
+
+func TestPluginCloseKillsPluginIgnoringSIGTERM(t *testing.T) {
+	p := newScriptPlugin(t, "trap '' TERM\necho 127.0.0.1:1234\nwhile true; do /bin/sleep 0.05; done\n")
+	p.Executor.(*Executor).gracePeriod = 100 * time.Millisecond
+
+	go p.Serve()
+	_, err := p.Address()
+	assert.NoError(t, err)
+
+	assert.EqualError(t, p.Close(), "Error closing driver plugin script: Driver plugin script did not exit after being terminated and was killed")
+}
+
+func TestPluginsStartConcurrently(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the driver binaries are shell scripts")
+	}
+
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+
+	const count = 8
+	plugins := make([]*Plugin, count)
+	for i := range plugins {
+		name := fmt.Sprintf("driver%d", i)
+		script := fmt.Sprintf("#!/bin/sh\necho \"$%s\" > %s\necho 127.0.0.1:1234\n", PluginEnvDriverName, filepath.Join(dir, name+".out"))
+		if err := os.WriteFile(filepath.Join(dir, driverBinaryPrefix+name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		p, err := NewPlugin(name)
+		assert.NoError(t, err)
+		plugins[i] = p
+	}
+
+	var wg sync.WaitGroup
+	for _, p := range plugins {
+		wg.Add(1)
+		go func(p *Plugin) {
+			defer wg.Done()
+			go p.Serve()
+			_, err := p.Address()
+			assert.NoError(t, err)
+			assert.NoError(t, p.Close())
+		}(p)
+	}
+	wg.Wait()
+
+	// Each plugin was told its own driver name, without changing the
+	// environment of this process.
+	for i := 0; i < count; i++ {
+		data, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("driver%d.out", i)))
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("driver%d\n", i), string(data))
+	}
+	assert.Empty(t, os.Getenv(PluginEnvDriverName))
+	assert.Empty(t, os.Getenv(PluginEnvKey))
+}
+
+func TestPluginAddressContextDeadline(t *testing.T) {
+	p := newScriptPlugin(t, "exec /bin/sleep 60\n")
+	p.Executor.(*Executor).gracePeriod = 100 * time.Millisecond
+
+	served := make(chan error)
+	go func() { served <- p.Serve() }()
+
+	// The deadline replaces the timeout of the plugin.
+	p.timeout = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := p.AddressContext(ctx)
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the plugin stuck before its handshake was not killed")
+	}
+	assert.NoError(t, p.Close())
+}
+
+func TestPluginServeContextCancel(t *testing.T) {
+	p := newScriptPlugin(t, "echo 127.0.0.1:1234\nexec /bin/sleep 60\n")
+	p.Executor.(*Executor).gracePeriod = 100 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- p.ServeContext(ctx) }()
+
+	_, err := p.Address()
+	assert.NoError(t, err)
+
+	cancel()
+	select {
+	case err := <-served:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the plugin was not stopped once the context was cancelled")
+	}
+	assert.NoError(t, p.Close())
+}
+
+func TestLogOutputFrames(t *testing.T) {
+	out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+	log.SetOutWriter(out)
+	log.SetErrWriter(errOut)
+	log.SetDebug(true)
+	defer func() {
+		log.SetOutWriter(os.Stdout)
+		log.SetErrWriter(os.Stderr)
+		log.SetDebug(false)
+	}()
+
+	lbp := &Plugin{MachineName: "test"}
+	lbp.logOutput(`{"time":"2024-01-02T15:04:05Z","level":"warn","msg":"Quota almost reached","fields":{"region":"fsn1"}}`, true)
+	lbp.logOutput(`{"time":"2024-01-02T15:04:05Z","level":"error","msg":"Server failed"}`, true)
+	lbp.logOutput(`{"time":"2024-01-02T15:04:05Z","level":"debug","msg":"GET /servers"}`, true)
+	lbp.logOutput("Creating server...", false)
+	lbp.logOutput("plain debug line", true)
+
+	assert.Equal(t, "(test) Quota almost reached region=fsn1\n"+
+		"(test) DBG | GET /servers\n"+
+		"(test) Creating server...\n"+
+		"(test) DBG | plain debug line\n", out.String())
+	assert.Equal(t, "(test) Server failed\n", errOut.String())
+}
@@ -0,0 +1,25 @@
+//go:build !windows
+
+package localbinary
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDropPrivileges(t *testing.T) {
+	cmd := exec.Command("true")
+
+	err := dropPrivileges(cmd, "1000", "100")
+
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1000), cmd.SysProcAttr.Credential.Uid)
+	assert.Equal(t, uint32(100), cmd.SysProcAttr.Credential.Gid)
+}
+
+func TestDropPrivilegesInvalidID(t *testing.T) {
+	assert.EqualError(t, dropPrivileges(exec.Command("true"), "nobody", "100"), `error parsing user ID: strconv.Atoi: parsing "nobody": invalid syntax`)
+	assert.EqualError(t, dropPrivileges(exec.Command("true"), "1000", "users"), `error parsing group ID: strconv.Atoi: parsing "users": invalid syntax`)
+}
@@ -0,0 +1,160 @@
+package localbinary
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"syscall"
+	"unsafe"
+
+	"github.com/rancher/machine/libmachine/log"
+	"golang.org/x/sys/windows"
+)
+
+var procCreateRestrictedToken = windows.NewLazySystemDLL("advapi32.dll").NewProc("CreateRestrictedToken")
+
+// Flags of CreateRestrictedToken.
+const (
+	disableMaxPrivilege = 0x1
+	luaToken            = 0x4
+)
+
+// pluginUIRestrictions keep the plugin from interacting with the desktop of
+// the user.
+const pluginUIRestrictions = windows.JOB_OBJECT_UILIMIT_DESKTOP |
+	windows.JOB_OBJECT_UILIMIT_DISPLAYSETTINGS |
+	windows.JOB_OBJECT_UILIMIT_EXITWINDOWS |
+	windows.JOB_OBJECT_UILIMIT_GLOBALATOMS |
+	windows.JOB_OBJECT_UILIMIT_HANDLES |
+	windows.JOB_OBJECT_UILIMIT_READCLIPBOARD |
+	windows.JOB_OBJECT_UILIMIT_SYSTEMPARAMETERS |
+	windows.JOB_OBJECT_UILIMIT_WRITECLIPBOARD
+
+// dropPrivileges makes cmd run the plugin with a restricted token: the
+// privileges of the user are removed and the Administrators group only
+// denies access. Windows has no user and group IDs to switch to, setting
+// them only enables the restrictions. The plugin is created suspended, so
+// that confine can put it in its job object before it runs.
+func dropPrivileges(cmd *exec.Cmd, uid, gid string) error {
+	log.Debugf("Ignoring plugin user %s and group %s on Windows, restricting the plugin token instead", uid, gid)
+
+	token, err := restrictedToken()
+	if err != nil {
+		return err
+	}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Token:         syscall.Token(token),
+		CreationFlags: windows.CREATE_SUSPENDED,
+	}
+	return nil
+}
+
+func restrictedToken() (windows.Token, error) {
+	var token windows.Token
+	if err := windows.OpenProcessToken(windows.CurrentProcess(), windows.TOKEN_DUPLICATE|windows.TOKEN_ASSIGN_PRIMARY|windows.TOKEN_QUERY, &token); err != nil {
+		return 0, err
+	}
+	defer token.Close()
+
+	admins, err := windows.CreateWellKnownSid(windows.WinBuiltinAdministratorsSid)
+	if err != nil {
+		return 0, err
+	}
+	disabled := []windows.SIDAndAttributes{{Sid: admins}}
+
+	var restricted windows.Token
+	r, _, err := procCreateRestrictedToken.Call(
+		uintptr(token),
+		disableMaxPrivilege|luaToken,
+		uintptr(len(disabled)),
+		uintptr(unsafe.Pointer(&disabled[0])),
+		0, 0, 0, 0,
+		uintptr(unsafe.Pointer(&restricted)))
+	if r == 0 {
+		return 0, err
+	}
+	return restricted, nil
+}
+
+// confine assigns the started plugin process to a job object limiting its
+// access to the desktop and killing it, with the processes it started, when
+// the machine binary exits. The process was created suspended and is only
+// resumed once in the job, so none of it runs unconfined.
+func confine(cmd *exec.Cmd) (io.Closer, error) {
+	if cmd.SysProcAttr != nil && cmd.SysProcAttr.Token != 0 {
+		windows.Token(cmd.SysProcAttr.Token).Close()
+	}
+
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{
+		BasicLimitInformation: windows.JOBOBJECT_BASIC_LIMIT_INFORMATION{
+			LimitFlags: windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE,
+		},
+	}
+	if _, err := windows.SetInformationJobObject(job, windows.JobObjectExtendedLimitInformation, uintptr(unsafe.Pointer(&limits)), uint32(unsafe.Sizeof(limits))); err != nil {
+		windows.CloseHandle(job)
+		return nil, err
+	}
+
+	ui := windows.JOBOBJECT_BASIC_UI_RESTRICTIONS{UIRestrictionsClass: pluginUIRestrictions}
+	if _, err := windows.SetInformationJobObject(job, windows.JobObjectBasicUIRestrictions, uintptr(unsafe.Pointer(&ui)), uint32(unsafe.Sizeof(ui))); err != nil {
+		windows.CloseHandle(job)
+		return nil, err
+	}
+
+	process, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(cmd.Process.Pid))
+	if err != nil {
+		windows.CloseHandle(job)
+		return nil, err
+	}
+	defer windows.CloseHandle(process)
+
+	if err := windows.AssignProcessToJobObject(job, process); err != nil {
+		windows.CloseHandle(job)
+		return nil, err
+	}
+
+	if err := resume(uint32(cmd.Process.Pid)); err != nil {
+		windows.CloseHandle(job)
+		return nil, err
+	}
+
+	return jobObject(job), nil
+}
+
+// resume resumes the main thread of the suspended process of the given ID,
+// the only thread it has. The handle of the thread is not kept by
+// exec.Cmd, so it is looked up in a snapshot of the threads.
+func resume(pid uint32) error {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPTHREAD, 0)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(snapshot)
+
+	entry := windows.ThreadEntry32{Size: uint32(unsafe.Sizeof(windows.ThreadEntry32{}))}
+	for err = windows.Thread32First(snapshot, &entry); err == nil; err = windows.Thread32Next(snapshot, &entry) {
+		if entry.OwnerProcessID != pid {
+			continue
+		}
+		thread, err := windows.OpenThread(windows.THREAD_SUSPEND_RESUME, false, entry.ThreadID)
+		if err != nil {
+			return err
+		}
+		defer windows.CloseHandle(thread)
+		_, err = windows.ResumeThread(thread)
+		return err
+	}
+	return fmt.Errorf("no thread found for process %d: %s", pid, err)
+}
+
+type jobObject windows.Handle
+
+func (j jobObject) Close() error {
+	return windows.CloseHandle(windows.Handle(j))
+}
@@ -0,0 +1,192 @@
+package localbinary
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/rancher/machine/libmachine/log"
+)
+
+// PluginRegistry, when set, is where NewPlugin installs the driver binaries
+// it cannot find from. Installing drivers is opt-in.
+var PluginRegistry *Registry
+
+// Registry installs driver binaries listed by an HTTP index, a JSON document
+// like:
+//
+//	{
+//	  "plugins": {
+//	    "cloudsigma": {
+//	      "version": "5.0.2",
+//	      "binaries": {
+//	        "linux-amd64": {"url": "cloudsigma/5.0.2/linux-amd64", "sha256": "9f86d08..."}
+//	      }
+//	    }
+//	  }
+//	}
+//
+// The URLs of the binaries may be relative to the one of the index.
+type Registry struct {
+	IndexURL   string
+	PluginsDir string
+	Client     *http.Client
+}
+
+type registryIndex struct {
+	Plugins map[string]registryPlugin `json:"plugins"`
+}
+
+type registryPlugin struct {
+	Version  string                    `json:"version"`
+	Binaries map[string]registryBinary `json:"binaries"`
+}
+
+type registryBinary struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+}
+
+func NewRegistry(indexURL, pluginsDir string) *Registry {
+	return &Registry{
+		IndexURL:   indexURL,
+		PluginsDir: pluginsDir,
+		Client: &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+			},
+		},
+	}
+}
+
+// binaryPath is where the binary of the named driver is installed.
+func (r *Registry) binaryPath(driverName string) string {
+	file := driverBinaryPrefix + driverName
+	if runtime.GOOS == "windows" {
+		file += ".exe"
+	}
+	return filepath.Join(r.PluginsDir, file)
+}
+
+// Install returns the path of the binary of the named driver, downloading it
+// first unless it was already installed.
+func (r *Registry) Install(driverName string) (string, error) {
+	dest := r.binaryPath(driverName)
+	if _, err := os.Stat(dest); err == nil {
+		return dest, nil
+	}
+
+	plugin, binary, err := r.lookup(driverName)
+	if err != nil {
+		return "", err
+	}
+
+	binaryURL, err := r.resolve(binary.URL)
+	if err != nil {
+		return "", err
+	}
+
+	log.Infof("Downloading driver %s %s from %s...", driverName, plugin.Version, binaryURL)
+
+	if err := os.MkdirAll(r.PluginsDir, 0700); err != nil {
+		return "", err
+	}
+
+	if err := r.download(binaryURL, binary.SHA256, dest); err != nil {
+		return "", fmt.Errorf("Error installing driver %s: %s", driverName, err)
+	}
+
+	return dest, nil
+}
+
+func (r *Registry) lookup(driverName string) (registryPlugin, registryBinary, error) {
+	resp, err := r.Client.Get(r.IndexURL)
+	if err != nil {
+		return registryPlugin{}, registryBinary{}, fmt.Errorf("Error getting the plugin registry index: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return registryPlugin{}, registryBinary{}, fmt.Errorf("Error getting the plugin registry index: %s", resp.Status)
+	}
+
+	var index registryIndex
+	if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+		return registryPlugin{}, registryBinary{}, fmt.Errorf("Error decoding the plugin registry index: %s", err)
+	}
+
+	plugin, ok := index.Plugins[driverName]
+	if !ok {
+		return registryPlugin{}, registryBinary{}, fmt.Errorf("Driver %q is not in the plugin registry", driverName)
+	}
+
+	platform := runtime.GOOS + "-" + runtime.GOARCH
+	binary, ok := plugin.Binaries[platform]
+	if !ok {
+		return registryPlugin{}, registryBinary{}, fmt.Errorf("The plugin registry has no %s binary of driver %q", platform, driverName)
+	}
+	if binary.SHA256 == "" {
+		return registryPlugin{}, registryBinary{}, fmt.Errorf("The plugin registry has no checksum for the %s binary of driver %q", platform, driverName)
+	}
+
+	return plugin, binary, nil
+}
+
+func (r *Registry) resolve(binaryURL string) (string, error) {
+	base, err := url.Parse(r.IndexURL)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(binaryURL)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// download writes the binary at binaryURL to dest once its checksum was
+// verified, so that a partial or tampered download is never executed.
+func (r *Registry) download(binaryURL, checksum, dest string) error {
+	resp, err := r.Client.Get(binaryURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Error downloading %s: %s", binaryURL, resp.Status)
+	}
+
+	f, err := os.CreateTemp(r.PluginsDir, filepath.Base(dest)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, hash), resp.Body); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != strings.ToLower(checksum) {
+		return fmt.Errorf("checksum mismatch, expected %s but got %s", checksum, actual)
+	}
+
+	if err := os.Chmod(f.Name(), 0755); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), dest)
+}
@@ -0,0 +1,106 @@
+package localbinary
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var fakeDriverBinary = []byte("#!/bin/sh\necho 127.0.0.1:1234\n")
+
+func newTestRegistry(t *testing.T, checksum string) (*Registry, *int) {
+	downloads := 0
+	platform := runtime.GOOS + "-" + runtime.GOARCH
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/index.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"plugins": {"cloudsigma": {"version": "5.0.2", "binaries": {%q: {"url": "cloudsigma/5.0.2/%s", "sha256": %q}}}}}`, platform, platform, checksum)
+	})
+	mux.HandleFunc("/cloudsigma/5.0.2/"+platform, func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		w.Write(fakeDriverBinary)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return NewRegistry(server.URL+"/index.json", filepath.Join(t.TempDir(), "plugins")), &downloads
+}
+
+func checksumOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestRegistryInstall(t *testing.T) {
+	registry, downloads := newTestRegistry(t, checksumOf(fakeDriverBinary))
+
+	path, err := registry.Install("cloudsigma")
+	assert.NoError(t, err)
+	assert.Equal(t, registry.binaryPath("cloudsigma"), path)
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, fakeDriverBinary, data)
+
+	// Installed drivers are not downloaded again.
+	_, err = registry.Install("cloudsigma")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, *downloads)
+}
+
+func TestRegistryInstallChecksumMismatch(t *testing.T) {
+	registry, _ := newTestRegistry(t, checksumOf([]byte("another binary")))
+
+	_, err := registry.Install("cloudsigma")
+	assert.EqualError(t, err, fmt.Sprintf("Error installing driver cloudsigma: checksum mismatch, expected %s but got %s", checksumOf([]byte("another binary")), checksumOf(fakeDriverBinary)))
+
+	entries, err := os.ReadDir(registry.PluginsDir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestRegistryInstallUnknownDriver(t *testing.T) {
+	registry, _ := newTestRegistry(t, checksumOf(fakeDriverBinary))
+
+	_, err := registry.Install("unknown")
+	assert.EqualError(t, err, `Driver "unknown" is not in the plugin registry`)
+}
+
+func TestRegistryInstallMissingChecksum(t *testing.T) {
+	registry, downloads := newTestRegistry(t, "")
+
+	_, err := registry.Install("cloudsigma")
+	assert.EqualError(t, err, fmt.Sprintf(`The plugin registry has no checksum for the %s-%s binary of driver "cloudsigma"`, runtime.GOOS, runtime.GOARCH))
+	assert.Equal(t, 0, *downloads)
+}
+
+func TestNewPluginInstallsFromRegistry(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake driver binary is a shell script")
+	}
+	t.Setenv("PATH", t.TempDir())
+
+	_, err := NewPlugin("cloudsigma")
+	assert.IsType(t, ErrPluginBinaryNotFound{}, err)
+
+	registry, _ := newTestRegistry(t, checksumOf(fakeDriverBinary))
+	defer func(orig *Registry) { PluginRegistry = orig }(PluginRegistry)
+	PluginRegistry = registry
+
+	p, err := NewPlugin("cloudsigma")
+	assert.NoError(t, err)
+	assert.Equal(t, registry.binaryPath("cloudsigma"), p.Executor.(*Executor).binaryPath)
+	assert.Equal(t, append(append([]string{}, CoreDrivers...), "cloudsigma"), ListDrivers())
+
+	// Core drivers are never installed.
+	_, err = NewPlugin("amazonec2")
+	assert.IsType(t, ErrPluginBinaryNotFound{}, err)
+}
@@ -0,0 +1,9 @@
+package localbinary
+
+import "os"
+
+// terminate stops the plugin process. Windows has no signal asking a process
+// to exit, so it is killed right away.
+func terminate(process *os.Process) error {
+	return process.Kill()
+}
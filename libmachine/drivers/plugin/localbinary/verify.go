@@ -0,0 +1,271 @@
+package localbinary
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rancher/machine/libmachine/log"
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	// PluginEnvVerify set to "strict" makes NewPlugin refuse the driver
+	// binaries it could not verify. Otherwise they only trigger a warning.
+	PluginEnvVerify = "MACHINE_PLUGIN_VERIFY"
+
+	// PluginEnvManifest is the path of a manifest listing the SHA256 of the
+	// trusted driver binaries, in the format of sha256sum:
+	//
+	//	9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08  docker-machine-driver-hetzner
+	PluginEnvManifest = "MACHINE_PLUGIN_MANIFEST"
+
+	// PluginEnvPublicKey is the minisign public key, or the path of the file
+	// holding it, that driver binaries are signed with. The signature of a
+	// binary is read from the file of the same name with the .minisig
+	// extension.
+	PluginEnvPublicKey = "MACHINE_PLUGIN_PUBLIC_KEY"
+
+	verifyStrict       = "strict"
+	signatureExtension = ".minisig"
+)
+
+var errNoVerification = errors.New("neither a manifest nor a public key is configured to verify it")
+
+// ErrPluginNotVerified is returned when a driver binary failed verification,
+// or could not be verified in strict mode.
+type ErrPluginNotVerified struct {
+	DriverName string
+	BinaryPath string
+	Reason     error
+}
+
+func (e ErrPluginNotVerified) Error() string {
+	return fmt.Sprintf("Refusing to start driver %q from %s: %s", e.DriverName, e.BinaryPath, e.Reason)
+}
+
+// verifyBinary checks the driver binary at binaryPath against the manifest
+// and the public key configured. A binary known to be tampered with is always
+// refused, while a binary neither listed nor signed is only refused in strict
+// mode.
+func verifyBinary(driverName, binaryPath string) error {
+	strict := false
+	switch mode := os.Getenv(PluginEnvVerify); mode {
+	case "":
+	case verifyStrict:
+		strict = true
+	default:
+		log.Warnf("Ignoring the invalid %s %q", PluginEnvVerify, mode)
+	}
+
+	manifest, publicKey := os.Getenv(PluginEnvManifest), os.Getenv(PluginEnvPublicKey)
+	if manifest == "" && publicKey == "" {
+		if strict {
+			return ErrPluginNotVerified{driverName, binaryPath, errNoVerification}
+		}
+		return nil
+	}
+
+	verified, err := verifyChecksum(manifest, binaryPath)
+	if err == nil && !verified {
+		verified, err = verifySignature(publicKey, binaryPath)
+	}
+	if err != nil {
+		return ErrPluginNotVerified{driverName, binaryPath, err}
+	}
+
+	if !verified {
+		reason := errors.New("it is neither listed in the manifest nor signed")
+		if strict {
+			return ErrPluginNotVerified{driverName, binaryPath, reason}
+		}
+		log.Warnf("Driver %q from %s is not verified: %s", driverName, binaryPath, reason)
+	}
+
+	return nil
+}
+
+// verifyChecksum returns whether the binary is listed in manifest, failing if
+// its checksum does not match.
+func verifyChecksum(manifest, binaryPath string) (bool, error) {
+	if manifest == "" {
+		return false, nil
+	}
+
+	checksums, err := readManifest(manifest)
+	if err != nil {
+		return false, err
+	}
+
+	expected, ok := checksums[filepath.Base(binaryPath)]
+	if !ok {
+		return false, nil
+	}
+
+	actual, err := fileChecksum(binaryPath)
+	if err != nil {
+		return false, err
+	}
+	if actual != expected {
+		return false, fmt.Errorf("checksum mismatch, expected %s but got %s", expected, actual)
+	}
+
+	return true, nil
+}
+
+// readManifest returns the checksums of a manifest by file name.
+func readManifest(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading the plugin manifest: %s", err)
+	}
+	defer f.Close()
+
+	checksums := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Invalid plugin manifest line %q", line)
+		}
+
+		// sha256sum marks the files read in binary mode with a *.
+		name := strings.TrimPrefix(fields[1], "*")
+		checksums[filepath.Base(name)] = strings.ToLower(fields[0])
+	}
+
+	return checksums, scanner.Err()
+}
+
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// verifySignature returns whether the binary is signed, failing if its
+// minisign signature is not valid for publicKey.
+func verifySignature(publicKey, binaryPath string) (bool, error) {
+	if publicKey == "" {
+		return false, nil
+	}
+
+	signature, err := os.ReadFile(binaryPath + signatureExtension)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	key, err := parseMinisignPublicKey(publicKey)
+	if err != nil {
+		return false, err
+	}
+
+	binary, err := os.ReadFile(binaryPath)
+	if err != nil {
+		return false, err
+	}
+
+	if err := key.verify(binary, signature); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+type minisignPublicKey struct {
+	keyID [8]byte
+	key   ed25519.PublicKey
+}
+
+// parseMinisignPublicKey decodes a minisign public key, given as is or as the
+// path of a file holding it.
+func parseMinisignPublicKey(value string) (minisignPublicKey, error) {
+	if data, err := os.ReadFile(value); err == nil {
+		value = lastLine(data)
+	}
+
+	var key minisignPublicKey
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil || len(data) != 2+8+ed25519.PublicKeySize || string(data[:2]) != "Ed" {
+		return key, errors.New("the plugin public key is not a minisign public key")
+	}
+
+	copy(key.keyID[:], data[2:10])
+	key.key = ed25519.PublicKey(data[10:])
+	return key, nil
+}
+
+// verify checks a minisign signature file of message, made of an untrusted
+// comment, the signature, a trusted comment and the signature of the trusted
+// comment.
+func (k minisignPublicKey) verify(message, signatureFile []byte) error {
+	lines := strings.Split(strings.TrimSpace(string(signatureFile)), "\n")
+	if len(lines) != 4 {
+		return errors.New("invalid minisign signature")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(sig) != 2+8+ed25519.SignatureSize {
+		return errors.New("invalid minisign signature")
+	}
+
+	if !bytes.Equal(sig[2:10], k.keyID[:]) {
+		return errors.New("the binary is signed with another key")
+	}
+
+	switch string(sig[:2]) {
+	case "Ed":
+	case "ED":
+		// Signatures of prehashed messages, the default of recent
+		// minisign versions.
+		hash := blake2b.Sum512(message)
+		message = hash[:]
+	default:
+		return errors.New("unsupported minisign signature algorithm")
+	}
+
+	if !ed25519.Verify(k.key, message, sig[10:]) {
+		return errors.New("invalid signature")
+	}
+
+	trustedComment := strings.TrimSpace(lines[2])
+	if !strings.HasPrefix(trustedComment, "trusted comment: ") {
+		return errors.New("invalid minisign signature")
+	}
+	signed := append(append([]byte{}, sig[10:]...), strings.TrimPrefix(trustedComment, "trusted comment: ")...)
+	globalSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || !ed25519.Verify(k.key, signed, globalSig) {
+		return errors.New("invalid signature of the trusted comment")
+	}
+
+	return nil
+}
+
+func lastLine(data []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	return lines[len(lines)-1]
+}
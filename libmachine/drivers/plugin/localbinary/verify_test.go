@@ -0,0 +1,133 @@
+package localbinary
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/blake2b"
+)
+
+func writeTestBinary(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "docker-machine-driver-hetzner")
+	assert.NoError(t, os.WriteFile(path, fakeDriverBinary, 0755))
+	return path
+}
+
+func writeManifest(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "SHA256SUMS")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+// minisignKey generates a minisign key pair, returning the encoded public
+// key.
+func minisignKey(t *testing.T) (string, ed25519.PrivateKey, []byte) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	keyID := []byte("testkey!")
+	encoded := base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), pub...))
+	return encoded, priv, keyID
+}
+
+// signMinisign writes the prehashed minisign signature of the binary at path.
+func signMinisign(t *testing.T, priv ed25519.PrivateKey, keyID []byte, path string) {
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	hash := blake2b.Sum512(data)
+	sig := ed25519.Sign(priv, hash[:])
+	comment := "timestamp:1700000000\tfile:" + filepath.Base(path)
+	globalSig := ed25519.Sign(priv, append(append([]byte{}, sig...), comment...))
+
+	content := fmt.Sprintf("untrusted comment: signature from minisign secret key\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(append(append([]byte("ED"), keyID...), sig...)),
+		comment,
+		base64.StdEncoding.EncodeToString(globalSig))
+	assert.NoError(t, os.WriteFile(path+signatureExtension, []byte(content), 0600))
+}
+
+func TestVerifyBinaryDisabled(t *testing.T) {
+	assert.NoError(t, verifyBinary("hetzner", writeTestBinary(t)))
+}
+
+func TestVerifyBinaryStrictWithoutManifestOrKey(t *testing.T) {
+	t.Setenv(PluginEnvVerify, "strict")
+
+	err := verifyBinary("hetzner", writeTestBinary(t))
+
+	assert.IsType(t, ErrPluginNotVerified{}, err)
+}
+
+func TestVerifyBinaryManifest(t *testing.T) {
+	binary := writeTestBinary(t)
+	t.Setenv(PluginEnvVerify, "strict")
+	t.Setenv(PluginEnvManifest, writeManifest(t, "# drivers\n"+checksumOf(fakeDriverBinary)+" *docker-machine-driver-hetzner\n"))
+
+	assert.NoError(t, verifyBinary("hetzner", binary))
+}
+
+func TestVerifyBinaryManifestMismatch(t *testing.T) {
+	binary := writeTestBinary(t)
+	t.Setenv(PluginEnvManifest, writeManifest(t, checksumOf([]byte("another binary"))+"  docker-machine-driver-hetzner\n"))
+
+	err := verifyBinary("hetzner", binary)
+
+	assert.EqualError(t, err, fmt.Sprintf("Refusing to start driver \"hetzner\" from %s: checksum mismatch, expected %s but got %s", binary, checksumOf([]byte("another binary")), checksumOf(fakeDriverBinary)))
+}
+
+func TestVerifyBinaryNotListed(t *testing.T) {
+	binary := writeTestBinary(t)
+	t.Setenv(PluginEnvManifest, writeManifest(t, checksumOf(fakeDriverBinary)+"  docker-machine-driver-other\n"))
+
+	// Unlisted binaries are only refused in strict mode.
+	assert.NoError(t, verifyBinary("hetzner", binary))
+
+	t.Setenv(PluginEnvVerify, "strict")
+	assert.EqualError(t, verifyBinary("hetzner", binary), fmt.Sprintf("Refusing to start driver \"hetzner\" from %s: it is neither listed in the manifest nor signed", binary))
+}
+
+func TestVerifyBinarySignature(t *testing.T) {
+	binary := writeTestBinary(t)
+	publicKey, priv, keyID := minisignKey(t)
+	signMinisign(t, priv, keyID, binary)
+
+	keyFile := filepath.Join(t.TempDir(), "minisign.pub")
+	assert.NoError(t, os.WriteFile(keyFile, []byte("untrusted comment: minisign public key\n"+publicKey+"\n"), 0600))
+
+	t.Setenv(PluginEnvVerify, "strict")
+	for _, key := range []string{publicKey, keyFile} {
+		t.Setenv(PluginEnvPublicKey, key)
+		assert.NoError(t, verifyBinary("hetzner", binary))
+	}
+}
+
+func TestVerifyBinaryTamperedSignature(t *testing.T) {
+	binary := writeTestBinary(t)
+	publicKey, priv, keyID := minisignKey(t)
+	signMinisign(t, priv, keyID, binary)
+	assert.NoError(t, os.WriteFile(binary, []byte("#!/bin/sh\nrm -rf ~\n"), 0755))
+	t.Setenv(PluginEnvPublicKey, publicKey)
+
+	err := verifyBinary("hetzner", binary)
+
+	assert.EqualError(t, err, fmt.Sprintf("Refusing to start driver \"hetzner\" from %s: invalid signature", binary))
+}
+
+func TestVerifyBinaryOtherKey(t *testing.T) {
+	binary := writeTestBinary(t)
+	_, priv, _ := minisignKey(t)
+	signMinisign(t, priv, []byte("otherkey"), binary)
+	publicKey, _, _ := minisignKey(t)
+	t.Setenv(PluginEnvPublicKey, publicKey)
+
+	err := verifyBinary("hetzner", binary)
+
+	assert.EqualError(t, err, fmt.Sprintf("Refusing to start driver \"hetzner\" from %s: the binary is signed with another key", binary))
+}
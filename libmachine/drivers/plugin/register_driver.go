@@ -6,12 +6,15 @@ import (
 	"net/http"
 	"net/rpc"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/drivers/plugin/grpcplugin"
 	"github.com/rancher/machine/libmachine/drivers/plugin/localbinary"
 	"github.com/rancher/machine/libmachine/drivers/rpc"
 	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/progress"
 	"github.com/rancher/machine/libmachine/version"
 )
 
@@ -20,6 +23,27 @@ var (
 )
 
 func RegisterDriver(d drivers.Driver) {
+	rpcd := rpcdriver.NewRPCServerDriver(d)
+	serve(rpcd, rpcd.CloseCh, rpcd.HeartbeatCh, false)
+}
+
+// RegisterDriverFactory is RegisterDriver for the plugins able to create
+// instances of their driver. They serve all the machines of the machine
+// binary which started them when it asks for it, see
+// localbinary.PluginEnvMultiplex.
+func RegisterDriverFactory(newDriver func() drivers.Driver) {
+	if os.Getenv(localbinary.PluginEnvMultiplex) != "true" {
+		RegisterDriver(newDriver())
+		return
+	}
+
+	mux := rpcdriver.NewRPCServerDriverMux(newDriver)
+	serve(mux, mux.CloseCh, mux.HeartbeatCh, true)
+}
+
+// serve serves rcvr, which is an RPCServerDriver or RPCServerDriverMux,
+// until the machine binary closes it or stops sending heartbeats.
+func serve(rcvr interface{}, closeCh, heartbeatCh <-chan bool, multiplexed bool) {
 	if os.Getenv(localbinary.PluginEnvKey) != localbinary.PluginEnvVal {
 		fmt.Fprintf(os.Stderr, `This is a Docker Machine plugin binary.
 Plugin binaries are not intended to be invoked directly.
@@ -29,35 +53,126 @@ Please use this plugin through the main 'docker-machine' binary.
 		os.Exit(1)
 	}
 
+	// Log frames the machine binary routes to its own levels, if it reads
+	// them.
+	if os.Getenv(localbinary.PluginEnvLogFormat) == localbinary.PluginLogFormatJSON {
+		log.SetFrameOutput(os.Stderr)
+	}
 	log.SetDebug(true)
 	os.Setenv("MACHINE_DEBUG", "1")
 
-	rpcd := rpcdriver.NewRPCServerDriver(d)
-	rpc.RegisterName(rpcdriver.RPCServiceNameV0, rpcd)
-	rpc.RegisterName(rpcdriver.RPCServiceNameV1, rpcd)
-	rpc.HandleHTTP()
+	// Progress events go to the machine binary over RPC once it polls for
+	// them, and through stdout to the machine binaries which do not.
+	stdout := progress.PluginWriter(os.Stdout)
+	progress.SetDefault(func(ev progress.Event) {
+		if !rpcdriver.ProgressQueue.Push(ev) {
+			stdout(ev)
+		}
+	})
 
-	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	listener, cleanup, err := listen(os.Getenv(localbinary.PluginEnvNetworks))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading RPC server: %s\n", err)
 		os.Exit(1)
 	}
-	defer listener.Close()
+	exit := func(code int) {
+		cleanup()
+		os.Exit(code)
+	}
 
-	fmt.Println(listener.Addr())
+	// Only the machine binary which started the plugin knows the session
+	// token. It is not passed on to the processes the driver starts.
+	token := os.Getenv(localbinary.PluginEnvSessionToken)
+	os.Unsetenv(localbinary.PluginEnvSessionToken)
+	if token != "" {
+		listener = localbinary.AuthListener(listener, token)
+	}
 
-	go http.Serve(listener, nil)
+	offered := os.Getenv(localbinary.PluginEnvProtocols)
+	protocol := localbinary.NegotiateProtocol(offered, localbinary.SupportedProtocols)
+
+	switch protocol {
+	case localbinary.ProtocolGRPC:
+		server := grpcplugin.NewServer()
+		if err := server.RegisterName(rpcdriver.RPCServiceNameV1, rcvr); err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading RPC server: %s\n", err)
+			exit(1)
+		}
+		go server.Serve(listener)
+	default:
+		if !multiplexed {
+			rpc.RegisterName(rpcdriver.RPCServiceNameV0, rcvr)
+		}
+		rpc.RegisterName(rpcdriver.RPCServiceNameV1, rcvr)
+		// The RPC server is served alone, not on the default mux which
+		// packages such as expvar or pprof add their handlers to.
+		mux := http.NewServeMux()
+		mux.Handle(rpc.DefaultRPCPath, rpc.DefaultServer)
+		go http.Serve(listener, mux)
+	}
+
+	if offered == "" {
+		// The machine binary predates the handshake and reads a bare address.
+		fmt.Println(listener.Addr())
+	} else {
+		fmt.Println(localbinary.Handshake{
+			CoreProtocolVersion: localbinary.CoreProtocolVersion,
+			APIVersion:          version.APIVersion,
+			Network:             listener.Addr().Network(),
+			Address:             listener.Addr().String(),
+			Protocol:            protocol,
+			Authenticated:       token != "",
+			Multiplexed:         multiplexed,
+		})
+	}
 
 	for {
 		select {
-		case <-rpcd.CloseCh:
+		case <-closeCh:
 			log.Debug("Closing plugin on server side")
-			os.Exit(0)
-		case <-rpcd.HeartbeatCh:
+			exit(0)
+		case <-heartbeatCh:
 			continue
 		case <-time.After(heartbeatTimeout):
 			// TODO: Add heartbeat retry logic
-			os.Exit(1)
+			exit(1)
+		}
+	}
+}
+
+// listen listens on the preferred network of the ones offered by the
+// machine binary, falling back to TCP. The returned function removes the
+// unix socket, if any.
+func listen(offered string) (net.Listener, func(), error) {
+	if localbinary.NegotiateNetwork(offered, localbinary.SupportedNetworks) == localbinary.NetworkUnix {
+		listener, cleanup, err := listenUnix()
+		if err == nil {
+			return listener, cleanup, nil
 		}
+		log.Debugf("Error listening on a unix socket, using TCP: %s", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, nil, err
 	}
+	return listener, func() { listener.Close() }, nil
+}
+
+func listenUnix() (net.Listener, func(), error) {
+	dir, err := os.MkdirTemp("", "machine-plugin-")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	listener, err := net.Listen("unix", filepath.Join(dir, "plugin.sock"))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, nil, err
+	}
+
+	return listener, func() {
+		listener.Close()
+		os.RemoveAll(dir)
+	}, nil
 }
@@ -0,0 +1,35 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListenUnix(t *testing.T) {
+	listener, cleanup, err := listen("unix,tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "unix", listener.Addr().Network())
+	socketDir := filepath.Dir(listener.Addr().String())
+
+	cleanup()
+	_, err = os.Stat(socketDir)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestListenTCP(t *testing.T) {
+	for _, offered := range []string{"", "tcp", "carrier-pigeon"} {
+		listener, cleanup, err := listen(offered)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "tcp", listener.Addr().Network(), offered)
+		cleanup()
+	}
+}
@@ -0,0 +1,31 @@
+// Package sandbox runs untrusted driver plugins in restricted Linux
+// namespaces, with a read-only filesystem except the machine storage path
+// and a seccomp filter denying the system calls a driver has no use for.
+//
+// The sandbox is set up by the machine binary itself, re-executed by
+// Command, before it executes the plugin. Binaries starting sandboxed
+// plugins must call Init first thing in main.
+package sandbox
+
+import "errors"
+
+// ErrUnsupported is returned by Command on platforms without sandboxing.
+var ErrUnsupported = errors.New("Sandboxed driver plugins are only supported on Linux")
+
+// Options tells what a sandboxed plugin may write to.
+type Options struct {
+	// WritablePaths stay writable, the rest of the filesystem is made
+	// read-only.
+	WritablePaths []string
+
+	// TempDir is the temporary directory of the plugin, created if missing.
+	// It must be in one of WritablePaths.
+	TempDir string
+}
+
+const (
+	envInit     = "MACHINE_SANDBOX_INIT"
+	envWritable = "MACHINE_SANDBOX_WRITABLE"
+	envUID      = "MACHINE_SANDBOX_UID"
+	envGID      = "MACHINE_SANDBOX_GID"
+)
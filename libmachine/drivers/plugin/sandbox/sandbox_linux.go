@@ -0,0 +1,375 @@
+package sandbox
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// deniedSyscalls are the system calls a driver has no use for and which
+// could be used to escape the sandbox or harm the host.
+var deniedSyscalls = []uintptr{
+	unix.SYS_ACCT,
+	unix.SYS_ADD_KEY,
+	unix.SYS_BPF,
+	unix.SYS_DELETE_MODULE,
+	unix.SYS_FINIT_MODULE,
+	unix.SYS_FSMOUNT,
+	unix.SYS_FSOPEN,
+	unix.SYS_INIT_MODULE,
+	unix.SYS_KEXEC_FILE_LOAD,
+	unix.SYS_KEXEC_LOAD,
+	unix.SYS_KEYCTL,
+	unix.SYS_MOUNT,
+	unix.SYS_MOUNT_SETATTR,
+	unix.SYS_MOVE_MOUNT,
+	unix.SYS_OPEN_BY_HANDLE_AT,
+	unix.SYS_OPEN_TREE,
+	unix.SYS_PERF_EVENT_OPEN,
+	unix.SYS_PIVOT_ROOT,
+	unix.SYS_PTRACE,
+	unix.SYS_REBOOT,
+	unix.SYS_REQUEST_KEY,
+	unix.SYS_SETNS,
+	unix.SYS_SWAPOFF,
+	unix.SYS_SWAPON,
+	unix.SYS_UMOUNT2,
+	unix.SYS_UNSHARE,
+	unix.SYS_USERFAULTFD,
+}
+
+var auditArches = map[string]uint32{
+	"amd64": unix.AUDIT_ARCH_X86_64,
+	"arm64": unix.AUDIT_ARCH_AARCH64,
+}
+
+// x32SyscallBit is set in the numbers of the x32 system calls, which share
+// the x86_64 audit architecture.
+const x32SyscallBit = 0x40000000
+
+// preservedFlags are the mount flags kept when remounting, which the kernel
+// refuses to clear on mounts inherited by a user namespace.
+var preservedFlags = map[string]uintptr{
+	"nosuid":     unix.MS_NOSUID,
+	"nodev":      unix.MS_NODEV,
+	"noexec":     unix.MS_NOEXEC,
+	"noatime":    unix.MS_NOATIME,
+	"nodiratime": unix.MS_NODIRATIME,
+	"relatime":   unix.MS_RELATIME,
+}
+
+// Command returns the command starting the plugin at binaryPath with args
+// and the environment env in a sandbox. The plugin runs with the credential
+// of attr if set, which requires machine to run as root.
+func Command(opts Options, binaryPath string, args, env []string, attr *syscall.SysProcAttr) (*exec.Cmd, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("Error locating the machine binary to sandbox the driver plugin: %s", err)
+	}
+
+	if opts.TempDir != "" {
+		if err := os.MkdirAll(opts.TempDir, 0700); err != nil {
+			return nil, err
+		}
+	}
+
+	cmd := exec.Command(self, args...)
+	cmd.Env = append(append([]string{}, env...),
+		envInit+"="+binaryPath,
+		envWritable+"="+strings.Join(opts.WritablePaths, string(os.PathListSeparator)))
+	if opts.TempDir != "" {
+		cmd.Env = append(cmd.Env, "TMPDIR="+opts.TempDir)
+	}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS,
+		Pdeathsig:  syscall.SIGKILL,
+	}
+
+	var cred *syscall.Credential
+	if attr != nil {
+		cred = attr.Credential
+	}
+
+	if os.Geteuid() == 0 {
+		// The sandbox is set up as root, the credential dropped right
+		// before executing the plugin.
+		if cred != nil {
+			cmd.Env = append(cmd.Env,
+				envUID+"="+strconv.FormatUint(uint64(cred.Uid), 10),
+				envGID+"="+strconv.FormatUint(uint64(cred.Gid), 10))
+		}
+		return cmd, nil
+	}
+
+	if cred != nil {
+		return nil, fmt.Errorf("Running a sandboxed driver plugin as another user requires root")
+	}
+
+	// A user namespace lets an unprivileged machine set up the sandbox, the
+	// plugin running as the same user as machine.
+	cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER
+	cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Geteuid(), Size: 1}}
+	cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getegid(), Size: 1}}
+	cmd.SysProcAttr.GidMappingsEnableSetgroups = false
+
+	return cmd, nil
+}
+
+// Init sets up the sandbox and executes the plugin if the current process
+// was started by Command, and returns otherwise.
+func Init() {
+	binaryPath := os.Getenv(envInit)
+	if binaryPath == "" {
+		return
+	}
+
+	// The seccomp filter applies to the thread executing the plugin.
+	runtime.LockOSThread()
+
+	if err := setup(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error sandboxing the driver plugin: %s\n", err)
+		os.Exit(1)
+	}
+
+	env := []string{}
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, "MACHINE_SANDBOX_") {
+			env = append(env, kv)
+		}
+	}
+
+	err := syscall.Exec(binaryPath, append([]string{binaryPath}, os.Args[1:]...), env)
+	fmt.Fprintf(os.Stderr, "Error starting the sandboxed driver plugin: %s\n", err)
+	os.Exit(1)
+}
+
+func setup() error {
+	// Keep the mounts below from propagating to the host.
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("Error making the mounts private: %s", err)
+	}
+
+	// The plugin only sees its own processes.
+	if err := unix.Mount("proc", "/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		fmt.Fprintf(os.Stderr, "Error mounting the sandbox /proc: %s\n", err)
+	}
+
+	mounts, err := readMountinfo("/proc/self/mountinfo")
+	if err != nil {
+		return err
+	}
+
+	if err := makeReadOnly(mounts); err != nil {
+		return err
+	}
+
+	for _, path := range filepath.SplitList(os.Getenv(envWritable)) {
+		if err := makeWritable(path, mounts); err != nil {
+			return err
+		}
+	}
+
+	if err := dropCredential(); err != nil {
+		return err
+	}
+
+	return installSeccompFilter()
+}
+
+type mount struct {
+	point string
+	flags uintptr
+}
+
+// readMountinfo returns the mounts listed by a mountinfo file, sorted by
+// mount point.
+func readMountinfo(path string) ([]mount, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	mounts := []mount{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+
+		m := mount{point: unescapeMountPoint(fields[4])}
+		for _, opt := range strings.Split(fields[5], ",") {
+			m.flags |= preservedFlags[opt]
+		}
+		mounts = append(mounts, m)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(mounts, func(i, j int) bool { return mounts[i].point < mounts[j].point })
+	return mounts, nil
+}
+
+// unescapeMountPoint decodes the octal escapes, like \040 for a space, of a
+// mountinfo mount point.
+func unescapeMountPoint(point string) string {
+	if !strings.Contains(point, `\`) {
+		return point
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(point); i++ {
+		if point[i] == '\\' && i+4 <= len(point) {
+			if c, err := strconv.ParseUint(point[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(point[i])
+	}
+	return b.String()
+}
+
+// isVirtual reports whether the plugin needs to write to the given mount
+// point, device nodes like /dev/null and its own /proc.
+func isVirtual(point string) bool {
+	for _, dir := range []string{"/dev", "/proc"} {
+		if point == dir || strings.HasPrefix(point, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// remount changes the flags of the mount at point, replaced by the tests.
+var remount = func(point string, flags uintptr) error {
+	return unix.Mount("", point, "", unix.MS_BIND|unix.MS_REMOUNT|flags, "")
+}
+
+// makeReadOnly remounts the mounts read-only, but the virtual ones. A mount
+// left writable would let the plugin write to the host, so it is an error.
+func makeReadOnly(mounts []mount) error {
+	for _, m := range mounts {
+		if isVirtual(m.point) {
+			continue
+		}
+
+		if err := remount(m.point, unix.MS_RDONLY|m.flags); err != nil {
+			return fmt.Errorf("Error making %s read-only: %s", m.point, err)
+		}
+	}
+	return nil
+}
+
+// makeWritable bind mounts path on itself, writable.
+func makeWritable(path string, mounts []mount) error {
+	if err := unix.Mount(path, path, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("Error making %s writable: %s", path, err)
+	}
+
+	// The bind mount inherits the flags of the mount containing path.
+	var flags uintptr
+	for _, m := range mounts {
+		if m.point == "/" || path == m.point || strings.HasPrefix(path, m.point+"/") {
+			flags = m.flags
+		}
+	}
+
+	if err := remount(path, flags); err != nil {
+		return fmt.Errorf("Error making %s writable: %s", path, err)
+	}
+	return nil
+}
+
+func dropCredential() error {
+	uid, gid := os.Getenv(envUID), os.Getenv(envGID)
+	if uid == "" || gid == "" {
+		return nil
+	}
+
+	u, err := strconv.Atoi(uid)
+	if err != nil {
+		return fmt.Errorf("error parsing user ID: %w", err)
+	}
+	g, err := strconv.Atoi(gid)
+	if err != nil {
+		return fmt.Errorf("error parsing group ID: %w", err)
+	}
+
+	if err := syscall.Setgroups([]int{}); err != nil {
+		return err
+	}
+	if err := syscall.Setgid(g); err != nil {
+		return err
+	}
+	return syscall.Setuid(u)
+}
+
+// seccompFilter returns a BPF program making the denied system calls fail
+// with EPERM, and killing the process making a system call of another
+// architecture.
+func seccompFilter(arch uint32, denied []uintptr) []unix.SockFilter {
+	const (
+		loadWord  = unix.BPF_LD | unix.BPF_W | unix.BPF_ABS
+		jumpEqual = unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K
+		jumpGE    = unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K
+		ret       = unix.BPF_RET | unix.BPF_K
+
+		// Offsets of the fields of struct seccomp_data.
+		nrOffset   = 0
+		archOffset = 4
+
+		deny = unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM)
+	)
+
+	filter := []unix.SockFilter{
+		{Code: loadWord, K: archOffset},
+		{Code: jumpEqual, Jt: 1, K: arch},
+		{Code: ret, K: unix.SECCOMP_RET_KILL_PROCESS},
+		{Code: loadWord, K: nrOffset},
+		{Code: jumpGE, Jf: 1, K: x32SyscallBit},
+		{Code: ret, K: deny},
+	}
+	for _, nr := range denied {
+		filter = append(filter,
+			unix.SockFilter{Code: jumpEqual, Jf: 1, K: uint32(nr)},
+			unix.SockFilter{Code: ret, K: deny})
+	}
+	return append(filter, unix.SockFilter{Code: ret, K: unix.SECCOMP_RET_ALLOW})
+}
+
+func installSeccompFilter() error {
+	arch, ok := auditArches[runtime.GOARCH]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "No seccomp filter for the %s architecture\n", runtime.GOARCH)
+		return nil
+	}
+
+	// Required to install a filter without CAP_SYS_ADMIN, and so that the
+	// plugin cannot gain privileges the filter would not restrict.
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("Error setting no_new_privs: %s", err)
+	}
+
+	filter := seccompFilter(arch, deniedSyscalls)
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	if err := unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&prog)), 0, 0); err != nil {
+		return fmt.Errorf("Error installing the seccomp filter: %s", err)
+	}
+	return nil
+}
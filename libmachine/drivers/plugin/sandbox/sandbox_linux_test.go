@@ -0,0 +1,123 @@
+package sandbox
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestMain(m *testing.M) {
+	// The sandboxed commands of the tests re-execute the test binary.
+	Init()
+	os.Exit(m.Run())
+}
+
+func TestReadMountinfo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mountinfo")
+	err := os.WriteFile(path, []byte(`22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+24 22 0:5 / /dev rw,nosuid shared:2 - devtmpfs udev rw
+30 22 0:25 / /mnt/my\040disk ro,nosuid,nodev,noexec master:1 - tmpfs tmpfs rw
+`), 0600)
+	assert.NoError(t, err)
+
+	mounts, err := readMountinfo(path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []mount{
+		{point: "/", flags: unix.MS_RELATIME},
+		{point: "/dev", flags: unix.MS_NOSUID},
+		{point: "/mnt/my disk", flags: unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC},
+	}, mounts)
+}
+
+func TestIsVirtual(t *testing.T) {
+	assert.True(t, isVirtual("/dev"))
+	assert.True(t, isVirtual("/dev/shm"))
+	assert.True(t, isVirtual("/proc"))
+	assert.False(t, isVirtual("/devices"))
+	assert.False(t, isVirtual("/"))
+}
+
+func TestMakeReadOnly(t *testing.T) {
+	defer func(orig func(string, uintptr) error) { remount = orig }(remount)
+	var remounted []string
+	remount = func(point string, flags uintptr) error {
+		remounted = append(remounted, point)
+		assert.NotZero(t, flags&unix.MS_RDONLY, point)
+		if point == "/home" {
+			return unix.EPERM
+		}
+		return nil
+	}
+
+	mounts := []mount{{point: "/"}, {point: "/dev"}, {point: "/home"}, {point: "/var"}}
+	assert.EqualError(t, makeReadOnly(mounts), "Error making /home read-only: operation not permitted")
+	assert.Equal(t, []string{"/", "/home"}, remounted)
+
+	remounted = nil
+	assert.NoError(t, makeReadOnly([]mount{{point: "/"}, {point: "/proc"}, {point: "/var"}}))
+	assert.Equal(t, []string{"/", "/var"}, remounted)
+}
+
+func TestSeccompFilter(t *testing.T) {
+	filter := seccompFilter(unix.AUDIT_ARCH_X86_64, []uintptr{unix.SYS_MOUNT, unix.SYS_PTRACE})
+
+	// Architecture check, x32 check, two instructions per denied system
+	// call, then allow.
+	assert.Len(t, filter, 6+2*2+1)
+	assert.Equal(t, uint32(unix.AUDIT_ARCH_X86_64), filter[1].K)
+	assert.Equal(t, uint32(unix.SYS_MOUNT), filter[6].K)
+	assert.Equal(t, uint32(unix.SECCOMP_RET_ERRNO|uint32(unix.EPERM)), filter[7].K)
+	assert.Equal(t, uint32(unix.SYS_PTRACE), filter[8].K)
+	assert.Equal(t, uint32(unix.SECCOMP_RET_ALLOW), filter[len(filter)-1].K)
+}
+
+func TestCommandRestrictsPlugin(t *testing.T) {
+	if _, ok := auditArches[runtime.GOARCH]; !ok {
+		t.Skipf("no seccomp filter for %s", runtime.GOARCH)
+	}
+
+	writable, readOnly := t.TempDir(), t.TempDir()
+
+	script := `
+set -e
+! echo test > ` + readOnly + `/file 2>/dev/null
+echo test > ` + writable + `/file
+echo test > "$TMPDIR/file"
+! unshare -m true 2>/dev/null
+`
+
+	cmd, err := Command(Options{
+		WritablePaths: []string{writable},
+		TempDir:       filepath.Join(writable, "tmp"),
+	}, "/bin/sh", []string{"-c", script}, os.Environ(), nil)
+	assert.NoError(t, err)
+
+	// The sandbox needs namespaces, which containers running the tests may
+	// deny.
+	skipUnlessNamespaces(t)
+
+	out, err := cmd.CombinedOutput()
+	assert.NoError(t, err, string(out))
+
+	assert.FileExists(t, filepath.Join(writable, "file"))
+	assert.FileExists(t, filepath.Join(writable, "tmp", "file"))
+	assert.NoFileExists(t, filepath.Join(readOnly, "file"))
+}
+
+func skipUnlessNamespaces(t *testing.T) {
+	cmd, err := Command(Options{}, "/bin/true", nil, os.Environ(), nil)
+	assert.NoError(t, err)
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("sandbox unavailable: %s %s", err, out)
+	}
+	if _, err := exec.LookPath("unshare"); err != nil {
+		t.Skip("unshare not found")
+	}
+}
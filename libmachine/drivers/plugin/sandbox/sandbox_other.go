@@ -0,0 +1,14 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+func Command(opts Options, binaryPath string, args, env []string, attr *syscall.SysProcAttr) (*exec.Cmd, error) {
+	return nil, ErrUnsupported
+}
+
+func Init() {}
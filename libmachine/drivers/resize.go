@@ -0,0 +1,68 @@
+package drivers
+
+import (
+	"errors"
+
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/mcnutils"
+	"github.com/rancher/machine/libmachine/state"
+)
+
+// ErrResizeNotSupported is returned by Resize for drivers that do not
+// implement DriverWithResize.
+var ErrResizeNotSupported = errors.New("driver does not support resizing")
+
+// ResizeSpec is the size a machine is resized to. The drivers of clouds read
+// the instance type, the others the CPUs and memory. Zero values keep the
+// current size.
+type ResizeSpec struct {
+	InstanceType string
+	CPUs         int
+	MemoryMB     int
+}
+
+// DriverWithResize is implemented by drivers that can change the size of the
+// machine without recreating it. They declare CapabilityResize.
+type DriverWithResize interface {
+	Driver
+
+	// Resize changes the size of the machine, restarting it if needed.
+	Resize(spec ResizeSpec) error
+}
+
+// Resize changes the size of the machine driven by d. It returns
+// ErrResizeNotSupported if d does not implement DriverWithResize.
+func Resize(d Driver, spec ResizeSpec) error {
+	if rd, ok := d.(DriverWithResize); ok {
+		return rd.Resize(spec)
+	}
+
+	return ErrResizeNotSupported
+}
+
+// WhileStopped calls change with the machine driven by d stopped, stopping
+// it first and starting it again afterwards if it is running.
+func WhileStopped(d Driver, change func() error) error {
+	s, err := d.GetState()
+	if err != nil {
+		return err
+	}
+	if s != state.Running {
+		return change()
+	}
+
+	log.Infof("Stopping %q...", d.GetMachineName())
+	if err := d.Stop(); err != nil {
+		return err
+	}
+	if err := mcnutils.WaitFor(MachineInState(d, state.Stopped)); err != nil {
+		return err
+	}
+
+	if err := change(); err != nil {
+		return err
+	}
+
+	log.Infof("Starting %q...", d.GetMachineName())
+	return d.Start()
+}
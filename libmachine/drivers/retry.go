@@ -0,0 +1,63 @@
+package drivers
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/rancher/machine/libmachine/log"
+)
+
+// RetryOptions tells Retry how often to call an operation again, and on which
+// errors.
+type RetryOptions struct {
+	// Attempts is the maximum number of calls, one or less making a single
+	// call.
+	Attempts int
+	// Backoff is the delay before the second call, doubled for each of the
+	// following ones up to MaxBackoff. Each delay is randomized down to half
+	// its value, so that many machines throttled at once do not retry in
+	// lockstep.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Retryable classifies the errors of the driver, true for the ones the
+	// operation can be retried after, such as API rate limits.
+	Retryable func(error) bool
+}
+
+// DefaultRetryOptions suit the rate limits of the cloud APIs, which are
+// usually lifted within a minute. Retryable is left for the driver to set.
+var DefaultRetryOptions = RetryOptions{
+	Attempts:   6,
+	Backoff:    2 * time.Second,
+	MaxBackoff: 30 * time.Second,
+}
+
+// WithRetryable returns the options retrying the errors retryable accepts.
+func (o RetryOptions) WithRetryable(retryable func(error) bool) RetryOptions {
+	o.Retryable = retryable
+	return o
+}
+
+// retrySleep is swapped out in tests.
+var retrySleep = time.Sleep
+
+// Retry calls fn until it succeeds, fails with an error opts.Retryable does
+// not retry, or the attempts run out. It returns the last error of fn.
+func Retry(opts RetryOptions, operation string, fn func() error) error {
+	backoff := opts.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= opts.Attempts || opts.Retryable == nil || !opts.Retryable(err) {
+			return err
+		}
+
+		delay := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		log.Debugf("%s failed (attempt %d/%d), retrying in %s: %s", operation, attempt, opts.Attempts, delay, err)
+		retrySleep(delay)
+
+		backoff *= 2
+		if opts.MaxBackoff > 0 && backoff > opts.MaxBackoff {
+			backoff = opts.MaxBackoff
+		}
+	}
+}
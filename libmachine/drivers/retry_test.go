@@ -0,0 +1,77 @@
+package drivers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errThrottled = errors.New("rate limit exceeded")
+
+func recordSleeps(t *testing.T) *[]time.Duration {
+	sleeps := &[]time.Duration{}
+	orig := retrySleep
+	retrySleep = func(d time.Duration) { *sleeps = append(*sleeps, d) }
+	t.Cleanup(func() { retrySleep = orig })
+	return sleeps
+}
+
+func testRetryOptions() RetryOptions {
+	return RetryOptions{
+		Attempts:   4,
+		Backoff:    time.Second,
+		MaxBackoff: 3 * time.Second,
+		Retryable:  func(err error) bool { return err == errThrottled },
+	}
+}
+
+func TestRetryBacksOffOnRetryableErrors(t *testing.T) {
+	sleeps := recordSleeps(t)
+
+	calls := 0
+	err := Retry(testRetryOptions(), "create", func() error {
+		calls++
+		if calls < 4 {
+			return errThrottled
+		}
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 4, calls)
+	assert.Len(t, *sleeps, 3)
+	for i, max := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+		assert.True(t, (*sleeps)[i] >= max/2 && (*sleeps)[i] <= max, "delay %d is %s", i, (*sleeps)[i])
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	sleeps := recordSleeps(t)
+
+	calls := 0
+	err := Retry(testRetryOptions(), "create", func() error {
+		calls++
+		return errThrottled
+	})
+
+	assert.Equal(t, errThrottled, err)
+	assert.Equal(t, 4, calls)
+	assert.Len(t, *sleeps, 3)
+}
+
+func TestRetryStopsOnTerminalErrors(t *testing.T) {
+	sleeps := recordSleeps(t)
+	errDenied := errors.New("access denied")
+
+	calls := 0
+	err := Retry(testRetryOptions(), "create", func() error {
+		calls++
+		return errDenied
+	})
+
+	assert.Equal(t, errDenied, err)
+	assert.Equal(t, 1, calls)
+	assert.Empty(t, *sleeps)
+}
@@ -1,22 +1,35 @@
 package rpcdriver
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
 	"net/rpc"
+	"reflect"
 	"sync"
 	"time"
 
 	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/drivers/plugin/grpcplugin"
 	"github.com/rancher/machine/libmachine/drivers/plugin/localbinary"
 	"github.com/rancher/machine/libmachine/log"
 	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/rancher/machine/libmachine/metrics"
+	"github.com/rancher/machine/libmachine/ssh"
 	"github.com/rancher/machine/libmachine/state"
 	"github.com/rancher/machine/libmachine/version"
 )
 
 var (
 	heartbeatInterval = 5 * time.Second
+
+	// heartbeatTimeout is how long a plugin has to answer a heartbeat
+	// before being reported as not responding.
+	heartbeatTimeout = 5 * time.Second
 )
 
 type RPCClientDriverFactory interface {
@@ -27,19 +40,41 @@ type RPCClientDriverFactory interface {
 type DefaultRPCClientDriverFactory struct {
 	openedDrivers     []*RPCClientDriver
 	openedDriversLock sync.Locker
+	reconnect         ReconnectOptions
+
+	// sharedPlugins are the plugins serving several machines, by driver
+	// name, see EnvMultiplexPlugins.
+	sharedLock    sync.Mutex
+	sharedPlugins map[string]*sharedPlugin
 }
 
 func NewRPCClientDriverFactory() RPCClientDriverFactory {
 	return &DefaultRPCClientDriverFactory{
 		openedDrivers:     []*RPCClientDriver{},
 		openedDriversLock: &sync.Mutex{},
+		sharedPlugins:     map[string]*sharedPlugin{},
 	}
 }
 
 type RPCClientDriver struct {
 	plugin          localbinary.DriverPlugin
 	heartbeatDoneCh chan bool
+	closedCh        chan struct{}
 	Client          *InternalClient
+	apiVersion      int
+
+	// lock guards the plugin and the client, which are replaced when the
+	// plugin is relaunched, and the last known config of the driver.
+	lock       sync.RWMutex
+	reconnect  ReconnectOptions
+	launch     pluginLauncher
+	lastConfig []byte
+
+	// heartbeatErr is why the last heartbeat failed, guarded by lock.
+	heartbeatErr error
+
+	closeOnce sync.Once
+	closeErr  error
 }
 
 type RPCCall struct {
@@ -48,9 +83,16 @@ type RPCCall struct {
 	Reply         interface{}
 }
 
+// Caller makes the calls to a plugin, over net/rpc or gRPC.
+type Caller interface {
+	Call(serviceMethod string, args interface{}, reply interface{}) error
+	Close() error
+}
+
 type InternalClient struct {
 	MachineName    string
-	RPCClient      *rpc.Client
+	DriverName     string
+	RPCClient      Caller
 	rpcServiceName string
 }
 
@@ -62,6 +104,9 @@ const (
 	GetVersionMethod         = `.GetVersion`
 	CloseMethod              = `.Close`
 	GetCreateFlagsMethod     = `.GetCreateFlags`
+	FlagSchemaMethod         = `.FlagSchema`
+	CapabilitiesMethod       = `.Capabilities`
+	ArchitecturesMethod      = `.SupportedArchitectures`
 	SetConfigRawMethod       = `.SetConfigRaw`
 	GetConfigRawMethod       = `.GetConfigRaw`
 	DriverNameMethod         = `.DriverName`
@@ -69,12 +114,24 @@ const (
 	GetURLMethod             = `.GetURL`
 	GetMachineNameMethod     = `.GetMachineName`
 	GetIPMethod              = `.GetIP`
+	GetIPsMethod             = `.GetIPs`
+	GetTagsMethod            = `.GetTags`
+	CreateSnapshotMethod     = `.CreateSnapshot`
+	ListSnapshotsMethod      = `.ListSnapshots`
+	RestoreSnapshotMethod    = `.RestoreSnapshot`
+	ResizeMethod             = `.Resize`
+	PreCreatePlanMethod      = `.PreCreatePlan`
+	EstimateCostMethod       = `.EstimateCost`
+	GetSSHBastionMethod      = `.GetSSHBastion`
 	GetSSHHostnameMethod     = `.GetSSHHostname`
+	GetSSHPasswordMethod     = `.GetSSHPassword`
+	GetSSHRetryPolicyMethod  = `.GetSSHRetryPolicy`
 	GetSSHKeyPathMethod      = `.GetSSHKeyPath`
 	GetSSHPortMethod         = `.GetSSHPort`
 	GetSSHUsernameMethod     = `.GetSSHUsername`
 	GetStateMethod           = `.GetState`
 	PreCreateCheckMethod     = `.PreCreateCheck`
+	SetDryRunMethod          = `.SetDryRun`
 	CreateMethod             = `.Create`
 	RemoveMethod             = `.Remove`
 	StartMethod              = `.Start`
@@ -82,20 +139,59 @@ const (
 	RestartMethod            = `.Restart`
 	KillMethod               = `.Kill`
 	UpgradeMethod            = `.Upgrade`
+	ProgressEventsMethod     = `.ProgressEvents`
 )
 
 func (ic *InternalClient) Call(serviceMethod string, args interface{}, reply interface{}) error {
-	if serviceMethod != HeartbeatMethod {
+	if serviceMethod != HeartbeatMethod && serviceMethod != ProgressEventsMethod {
 		log.Debugf("(%s) Calling %+v", ic.MachineName, serviceMethod)
 	}
-	return ic.RPCClient.Call(ic.rpcServiceName+serviceMethod, args, reply)
+	start := time.Now()
+	err := ic.RPCClient.Call(ic.rpcServiceName+serviceMethod, args, reply)
+	metrics.ObserveCall(ic.DriverName, serviceMethod, time.Since(start), err)
+	return err
+}
+
+// CallContext is Call, returning once ctx is done. The plugin is not
+// interrupted: the call goes on in the background and its reply is dropped.
+func (ic *InternalClient) CallContext(ctx context.Context, serviceMethod string, args interface{}, reply interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if ctx.Done() == nil {
+		return ic.Call(serviceMethod, args, reply)
+	}
+
+	// Decode into a reply of our own, so that a call finishing after ctx is
+	// done does not write to the reply of the caller.
+	var own reflect.Value
+	callReply := reply
+	if v := reflect.ValueOf(reply); v.Kind() == reflect.Ptr && !v.IsNil() {
+		own = reflect.New(v.Elem().Type())
+		callReply = own.Interface()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- ic.Call(serviceMethod, args, callReply)
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil && own.IsValid() {
+			reflect.ValueOf(reply).Elem().Set(own.Elem())
+		}
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (ic *InternalClient) switchToV0() {
 	ic.rpcServiceName = RPCServiceNameV0
 }
 
-func NewInternalClient(rpcclient *rpc.Client) *InternalClient {
+func NewInternalClient(rpcclient Caller) *InternalClient {
 	return &InternalClient{
 		RPCClient:      rpcclient,
 		rpcServiceName: RPCServiceNameV1,
@@ -117,13 +213,27 @@ func (f *DefaultRPCClientDriverFactory) Close() error {
 	return nil
 }
 
-func (f *DefaultRPCClientDriverFactory) NewRPCClientDriver(driverName string, rawDriver []byte) (*RPCClientDriver, error) {
-	mcnName := ""
+// SetReconnect makes the drivers created from now on relaunch their plugin
+// when the connection to it is lost.
+func (f *DefaultRPCClientDriverFactory) SetReconnect(reconnect ReconnectOptions) {
+	f.openedDriversLock.Lock()
+	defer f.openedDriversLock.Unlock()
+	f.reconnect = reconnect
+}
 
-	p, err := localbinary.NewPlugin(driverName)
+// launchPlugin starts the plugin of the named driver and connects to it,
+// killing the plugin if ctx is done before it answered. A multiplexed plugin
+// is asked to serve several machines.
+func launchPlugin(ctx context.Context, driverName, machineName string, multiplex bool) (*localbinary.Plugin, *InternalClient, error) {
+	newPlugin := localbinary.NewPlugin
+	if multiplex {
+		newPlugin = localbinary.NewMultiplexedPlugin
+	}
+	p, err := newPlugin(driverName)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	p.MachineName = machineName
 
 	go func() {
 		if err := p.Serve(); err != nil {
@@ -133,70 +243,218 @@ func (f *DefaultRPCClientDriverFactory) NewRPCClientDriver(driverName string, ra
 		}
 	}()
 
-	addr, err := p.Address()
-	if err != nil {
-		return nil, fmt.Errorf("Error attempting to get plugin server address for RPC: %s", err)
+	addr, err := p.AddressContext(ctx)
+	if _, ok := err.(localbinary.ErrIncompatiblePlugin); ok {
+		return nil, nil, err
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("Error attempting to get plugin server address for RPC: %s", err)
 	}
 
-	rpcclient, err := rpc.DialHTTP("tcp", addr)
+	protocol, err := p.Protocol()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	network, err := p.Network()
+	if err != nil {
+		return nil, nil, err
 	}
 
-	c := &RPCClientDriver{
-		Client:          NewInternalClient(rpcclient),
-		heartbeatDoneCh: make(chan bool),
+	var rpcclient Caller
+	switch protocol {
+	case localbinary.ProtocolGRPC:
+		rpcclient, err = grpcplugin.DialFunc(network, addr, p.Authenticate)
+	default:
+		rpcclient, err = dialHTTP(network, addr, p.Authenticate)
 	}
+	if err != nil {
+		p.Close()
+		return nil, nil, err
+	}
+	log.Debugf("Using the %s plugin protocol over %s", protocol, network)
 
-	f.openedDriversLock.Lock()
-	f.openedDrivers = append(f.openedDrivers, c)
-	f.openedDriversLock.Unlock()
+	client := NewInternalClient(rpcclient)
+	client.MachineName = machineName
+	client.DriverName = driverName
 
 	var serverVersion int
-	if err := c.Client.Call(GetVersionMethod, struct{}{}, &serverVersion); err != nil {
+	if err := client.CallContext(ctx, GetVersionMethod, struct{}{}, &serverVersion); err != nil && ctx.Err() == nil && protocol == localbinary.ProtocolNetRPC {
 		// this is the first call we make to the server. We try to play nice with old pre 0.5.1 client,
 		// by gracefully trying old RPCServiceName, we do this only once, and keep the result for future calls.
 		log.Debugf(err.Error())
-		log.Debugf("Client (%s) with %s does not work, re-attempting with %s", c.Client.MachineName, RPCServiceNameV1, RPCServiceNameV0)
-		c.Client.switchToV0()
-		if err := c.Client.Call(GetVersionMethod, struct{}{}, &serverVersion); err != nil {
-			return nil, err
+		log.Debugf("Client (%s) with %s does not work, re-attempting with %s", client.MachineName, RPCServiceNameV1, RPCServiceNameV0)
+		client.switchToV0()
+		if err := client.CallContext(ctx, GetVersionMethod, struct{}{}, &serverVersion); err != nil {
+			p.Close()
+			return nil, nil, err
 		}
+	} else if err != nil {
+		p.Close()
+		return nil, nil, err
 	}
 
 	if serverVersion != version.APIVersion {
-		return nil, fmt.Errorf("Driver binary uses an incompatible API version (%d)", serverVersion)
+		return nil, nil, localbinary.ErrIncompatiblePlugin{DriverName: driverName, APIVersion: serverVersion}
 	}
 	log.Debug("Using API Version ", serverVersion)
+	p.RecordHeartbeat(time.Now())
 
-	go func(c *RPCClientDriver) {
-		for {
-			select {
-			case <-c.heartbeatDoneCh:
-				return
-			case <-time.After(heartbeatInterval):
-				if err := c.Client.Call(HeartbeatMethod, struct{}{}, nil); err != nil {
-					log.Warnf("Wrapper Docker Machine process exiting due to closed plugin server (%s)", err)
-					if err := c.close(); err != nil {
-						log.Warn(err)
-					}
-				}
-			}
+	return p, client, nil
+}
+
+// dialHTTP is rpc.DialHTTP, calling setup on the connection before the
+// HTTP CONNECT handshake of net/rpc.
+func dialHTTP(network, addr string, setup func(net.Conn) error) (*rpc.Client, error) {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := setup(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	io.WriteString(conn, "CONNECT "+rpc.DefaultRPCPath+" HTTP/1.0\n\n")
+
+	// The status net/rpc answers with once connected.
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: "CONNECT"})
+	if err == nil && resp.Status == "200 Connected to Go RPC" {
+		return rpc.NewClient(conn), nil
+	}
+	if err == nil {
+		err = errors.New("unexpected HTTP response: " + resp.Status)
+	}
+	conn.Close()
+	return nil, &net.OpError{Op: "dial-http", Net: network + " " + addr, Addr: nil, Err: err}
+}
+
+func (f *DefaultRPCClientDriverFactory) NewRPCClientDriver(driverName string, rawDriver []byte) (*RPCClientDriver, error) {
+	return f.NewRPCClientDriverContext(context.Background(), driverName, rawDriver)
+}
+
+// NewRPCClientDriverContext is NewRPCClientDriver, giving up on a plugin
+// which did not complete its handshake once ctx is done. ctx only covers the
+// startup of the plugin: the driver returned outlives it.
+func (f *DefaultRPCClientDriverFactory) NewRPCClientDriverContext(ctx context.Context, driverName string, rawDriver []byte) (*RPCClientDriver, error) {
+	mcnName := ""
+
+	launch := func(ctx context.Context) (localbinary.DriverPlugin, *InternalClient, error) {
+		return launchPlugin(ctx, driverName, mcnName, false)
+	}
+	if multiplexEnabled() {
+		launch = func(ctx context.Context) (localbinary.DriverPlugin, *InternalClient, error) {
+			return f.launchShared(ctx, driverName)
 		}
-	}(c)
+	}
+
+	p, client, err := launch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	f.openedDriversLock.Lock()
+	c := &RPCClientDriver{
+		Client:          client,
+		heartbeatDoneCh: make(chan bool),
+		closedCh:        make(chan struct{}),
+		apiVersion:      version.APIVersion,
+		reconnect:       f.reconnect,
+		launch: func() (localbinary.DriverPlugin, *InternalClient, error) {
+			return launch(context.Background())
+		},
+	}
+	f.openedDrivers = append(f.openedDrivers, c)
+	f.openedDriversLock.Unlock()
+
+	go c.heartbeat()
 
 	if err := c.SetConfigRaw(rawDriver); err != nil {
 		return nil, err
 	}
 
 	mcnName = c.GetMachineName()
-	p.MachineName = mcnName
+	if dedicated, ok := p.(*localbinary.Plugin); ok {
+		dedicated.MachineName = mcnName
+	}
 	c.Client.MachineName = mcnName
+	c.lock.Lock()
 	c.plugin = p
+	c.lock.Unlock()
+
+	if c.reconnect.Attempts > 0 {
+		go c.supervise()
+	}
 
 	return c, nil
 }
 
+// heartbeat calls the plugin every heartbeatInterval until the driver is
+// closed, so that a plugin which stopped responding is noticed before the
+// next operation times out.
+func (c *RPCClientDriver) heartbeat() {
+	for {
+		select {
+		case <-c.heartbeatDoneCh:
+			return
+		case <-time.After(heartbeatInterval):
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), heartbeatTimeout)
+		err := c.internalClient().CallContext(ctx, HeartbeatMethod, struct{}{}, nil)
+		cancel()
+
+		c.lock.Lock()
+		c.heartbeatErr = err
+		plugin := c.plugin
+		c.lock.Unlock()
+
+		switch {
+		case err == nil:
+			if plugin != nil {
+				plugin.RecordHeartbeat(time.Now())
+			}
+		case errors.Is(err, context.DeadlineExceeded):
+			// The plugin is alive but hung, e.g. on a deadlock.
+			log.Warnf("Driver plugin did not answer the heartbeat in %s", heartbeatTimeout)
+		case c.reconnect.Attempts > 0:
+			// The next call relaunches the plugin.
+			log.Debugf("Lost the connection to the driver plugin (%s)", err)
+		default:
+			log.Warnf("Wrapper Docker Machine process exiting due to closed plugin server (%s)", err)
+			if err := c.close(); err != nil {
+				log.Warn(err)
+			}
+		}
+	}
+}
+
+// LastHeartbeat returns when the plugin last answered a heartbeat.
+func (c *RPCClientDriver) LastHeartbeat() time.Time {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.plugin == nil {
+		return time.Time{}
+	}
+	return c.plugin.LastHeartbeat()
+}
+
+// Health returns when the plugin last answered a heartbeat, failing if it
+// did not answer the last one or has not answered any for too long.
+func (c *RPCClientDriver) Health() (time.Time, error) {
+	last := c.LastHeartbeat()
+
+	c.lock.RLock()
+	err := c.heartbeatErr
+	c.lock.RUnlock()
+
+	if err != nil {
+		return last, fmt.Errorf("Driver plugin is not responding: %s", err)
+	}
+	if !last.IsZero() && time.Since(last) > 2*heartbeatInterval+heartbeatTimeout {
+		return last, fmt.Errorf("Driver plugin is not responding since %s", last.Format(time.RFC3339))
+	}
+	return last, nil
+}
+
 func (c *RPCClientDriver) MarshalJSON() ([]byte, error) {
 	return c.GetConfigRaw()
 }
@@ -205,13 +463,27 @@ func (c *RPCClientDriver) UnmarshalJSON(data []byte) error {
 	return c.SetConfigRaw(data)
 }
 
+// Close stops the plugin of the driver once the caller is done with it,
+// rather than when the factory is closed.
+func (c *RPCClientDriver) Close() error {
+	return c.close()
+}
+
 func (c *RPCClientDriver) close() error {
+	c.closeOnce.Do(func() { c.closeErr = c.closePlugin() })
+	return c.closeErr
+}
+
+func (c *RPCClientDriver) closePlugin() error {
 	c.heartbeatDoneCh <- true
 	close(c.heartbeatDoneCh)
+	if c.closedCh != nil {
+		close(c.closedCh)
+	}
 
 	log.Debug("Making call to close driver server")
 
-	if err := c.Client.Call(CloseMethod, struct{}{}, nil); err != nil {
+	if err := c.internalClient().Call(CloseMethod, struct{}{}, nil); err != nil {
 		log.Debugf("Failed to make call to close driver server: %s", err)
 	} else {
 		log.Debug("Successfully made call to close driver server")
@@ -219,6 +491,8 @@ func (c *RPCClientDriver) close() error {
 
 	log.Debug("Making call to close connection to plugin binary")
 
+	c.lock.RLock()
+	defer c.lock.RUnlock()
 	return c.plugin.Close()
 }
 
@@ -227,7 +501,7 @@ func (c *RPCClientDriver) close() error {
 func (c *RPCClientDriver) rpcStringCall(method string) (string, error) {
 	var info string
 
-	if err := c.Client.Call(method, struct{}{}, &info); err != nil {
+	if err := c.call(method, struct{}{}, &info); err != nil {
 		return "", err
 	}
 
@@ -237,21 +511,77 @@ func (c *RPCClientDriver) rpcStringCall(method string) (string, error) {
 func (c *RPCClientDriver) GetCreateFlags() []mcnflag.Flag {
 	var flags []mcnflag.Flag
 
-	if err := c.Client.Call(GetCreateFlagsMethod, struct{}{}, &flags); err != nil {
+	if err := c.call(GetCreateFlagsMethod, struct{}{}, &flags); err != nil {
 		log.Warnf("Error attempting call to get create flags: %s", err)
 	}
 
 	return flags
 }
 
+// APIVersion returns the plugin API version reported by the driver binary.
+func (c *RPCClientDriver) APIVersion() int {
+	return c.apiVersion
+}
+
+// Capabilities returns the capabilities advertised by the plugin. Plugins
+// built before capability discovery existed advertise none.
+func (c *RPCClientDriver) Capabilities() []drivers.Capability {
+	capabilities := []drivers.Capability{}
+
+	if err := c.call(CapabilitiesMethod, struct{}{}, &capabilities); err != nil {
+		if isMethodNotFound(err) {
+			log.Debugf("Driver plugin does not report capabilities: %s", err)
+		} else {
+			log.Warnf("Error attempting call to get capabilities: %s", err)
+		}
+		return []drivers.Capability{}
+	}
+
+	return capabilities
+}
+
+// SupportedArchitectures returns the architectures advertised by the plugin.
+// Plugins built before architecture discovery existed advertise none.
+func (c *RPCClientDriver) SupportedArchitectures() []string {
+	architectures := []string{}
+
+	if err := c.call(ArchitecturesMethod, struct{}{}, &architectures); err != nil {
+		if isMethodNotFound(err) {
+			log.Debugf("Driver plugin does not report architectures: %s", err)
+		} else {
+			log.Warnf("Error attempting call to get architectures: %s", err)
+		}
+		return []string{}
+	}
+
+	return architectures
+}
+
+// FlagSchema returns the schema of the create flags described by the plugin.
+// The flags of plugins built before the schema existed are described here.
+func (c *RPCClientDriver) FlagSchema() []mcnflag.Schema {
+	var schemas []mcnflag.Schema
+
+	if err := c.call(FlagSchemaMethod, struct{}{}, &schemas); err != nil {
+		if isMethodNotFound(err) {
+			log.Debugf("Driver plugin does not describe its flags: %s", err)
+		} else {
+			log.Warnf("Error attempting call to get flag schema: %s", err)
+		}
+		return mcnflag.DescribeFlags(c.GetCreateFlags())
+	}
+
+	return schemas
+}
+
 func (c *RPCClientDriver) SetConfigRaw(data []byte) error {
-	return c.Client.Call(SetConfigRawMethod, data, nil)
+	return c.call(SetConfigRawMethod, data, nil)
 }
 
 func (c *RPCClientDriver) GetConfigRaw() ([]byte, error) {
 	var data []byte
 
-	if err := c.Client.Call(GetConfigRawMethod, struct{}{}, &data); err != nil {
+	if err := c.call(GetConfigRawMethod, struct{}{}, &data); err != nil {
 		return nil, err
 	}
 
@@ -269,7 +599,7 @@ func (c *RPCClientDriver) DriverName() string {
 }
 
 func (c *RPCClientDriver) SetConfigFromFlags(flags drivers.DriverOptions) error {
-	return c.Client.Call(SetConfigFromFlagsMethod, &flags, nil)
+	return c.call(SetConfigFromFlagsMethod, &flags, nil)
 }
 
 func (c *RPCClientDriver) GetURL() (string, error) {
@@ -289,6 +619,172 @@ func (c *RPCClientDriver) GetIP() (string, error) {
 	return c.rpcStringCall(GetIPMethod)
 }
 
+// GetIPs returns every address the plugin knows about. Plugins built before
+// GetIPs existed, and drivers that don't implement it, yield
+// drivers.ErrAddressKindsNotReported.
+func (c *RPCClientDriver) GetIPs() ([]drivers.NetworkAddress, error) {
+	var addrs []drivers.NetworkAddress
+
+	if err := c.call(GetIPsMethod, struct{}{}, &addrs); err != nil {
+		if isMethodNotFound(err) || err.Error() == drivers.ErrAddressKindsNotReported.Error() {
+			return nil, drivers.ErrAddressKindsNotReported
+		}
+		return nil, err
+	}
+
+	return addrs, nil
+}
+
+// GetTags returns the tags of the machine reported by the plugin. Plugins
+// built before GetTags existed, and drivers that don't tag the machine, yield
+// drivers.ErrTagsNotReported.
+func (c *RPCClientDriver) GetTags() (map[string]string, error) {
+	var tags map[string]string
+
+	if err := c.call(GetTagsMethod, struct{}{}, &tags); err != nil {
+		if isMethodNotFound(err) || err.Error() == drivers.ErrTagsNotReported.Error() {
+			return nil, drivers.ErrTagsNotReported
+		}
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// snapshotError returns drivers.ErrSnapshotsNotSupported for the plugins built
+// before snapshots existed, and for the drivers that don't support them.
+func snapshotError(err error) error {
+	if isMethodNotFound(err) || err.Error() == drivers.ErrSnapshotsNotSupported.Error() {
+		return drivers.ErrSnapshotsNotSupported
+	}
+	return err
+}
+
+func (c *RPCClientDriver) CreateSnapshot(name string) (drivers.Snapshot, error) {
+	var snapshot drivers.Snapshot
+
+	if err := c.call(CreateSnapshotMethod, name, &snapshot); err != nil {
+		return drivers.Snapshot{}, snapshotError(err)
+	}
+
+	return snapshot, nil
+}
+
+func (c *RPCClientDriver) ListSnapshots() ([]drivers.Snapshot, error) {
+	var snapshots []drivers.Snapshot
+
+	if err := c.call(ListSnapshotsMethod, struct{}{}, &snapshots); err != nil {
+		return nil, snapshotError(err)
+	}
+
+	return snapshots, nil
+}
+
+func (c *RPCClientDriver) RestoreSnapshot(id string) error {
+	if err := c.call(RestoreSnapshotMethod, id, nil); err != nil {
+		return snapshotError(err)
+	}
+
+	return nil
+}
+
+// PreCreatePlan returns the resources the plugin would create. Plugins built
+// before plans existed, and the drivers that don't report them, return
+// drivers.ErrPlanNotSupported.
+func (c *RPCClientDriver) PreCreatePlan() ([]drivers.PlannedResource, error) {
+	var resources []drivers.PlannedResource
+
+	if err := c.call(PreCreatePlanMethod, struct{}{}, &resources); err != nil {
+		if isMethodNotFound(err) || err.Error() == drivers.ErrPlanNotSupported.Error() {
+			return nil, drivers.ErrPlanNotSupported
+		}
+		return nil, err
+	}
+
+	return resources, nil
+}
+
+// EstimateCost returns the price of the machine of the plugin. Plugins built
+// before cost estimates existed, and the drivers that don't estimate them,
+// return drivers.ErrCostNotSupported.
+func (c *RPCClientDriver) EstimateCost() (*drivers.CostEstimate, error) {
+	var estimate drivers.CostEstimate
+
+	if err := c.call(EstimateCostMethod, struct{}{}, &estimate); err != nil {
+		if isMethodNotFound(err) || err.Error() == drivers.ErrCostNotSupported.Error() {
+			return nil, drivers.ErrCostNotSupported
+		}
+		return nil, err
+	}
+
+	return &estimate, nil
+}
+
+// Resize resizes the machine of the plugin. Plugins built before resizing
+// existed, and the drivers that don't support it, return
+// drivers.ErrResizeNotSupported.
+func (c *RPCClientDriver) Resize(spec drivers.ResizeSpec) error {
+	if err := c.call(ResizeMethod, &spec, nil); err != nil {
+		if isMethodNotFound(err) || err.Error() == drivers.ErrResizeNotSupported.Error() {
+			return drivers.ErrResizeNotSupported
+		}
+		return err
+	}
+
+	return nil
+}
+
+// GetSSHBastion returns the bastion of the plugin. Plugins built before
+// bastions existed have none.
+func (c *RPCClientDriver) GetSSHBastion() (*ssh.Bastion, error) {
+	var bastion ssh.Bastion
+
+	if err := c.call(GetSSHBastionMethod, struct{}{}, &bastion); err != nil {
+		if isMethodNotFound(err) {
+			log.Debugf("Driver plugin does not report a bastion: %s", err)
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if bastion.Host == "" {
+		return nil, nil
+	}
+	return &bastion, nil
+}
+
+// GetSSHPassword returns the password authentication of the plugin. Plugins
+// built before it existed authenticate with their key only.
+func (c *RPCClientDriver) GetSSHPassword() (drivers.SSHPassword, error) {
+	var password drivers.SSHPassword
+
+	if err := c.call(GetSSHPasswordMethod, struct{}{}, &password); err != nil {
+		if isMethodNotFound(err) {
+			log.Debugf("Driver plugin does not report a password: %s", err)
+			return drivers.SSHPassword{}, nil
+		}
+		return drivers.SSHPassword{}, err
+	}
+
+	return password, nil
+}
+
+// GetSSHRetryPolicy returns the SSH retry policy of the plugin. Plugins built
+// before it existed use the default one.
+func (c *RPCClientDriver) GetSSHRetryPolicy() (ssh.RetryPolicy, error) {
+	var policy ssh.RetryPolicy
+
+	if err := c.call(GetSSHRetryPolicyMethod, struct{}{}, &policy); err != nil {
+		if isMethodNotFound(err) {
+			log.Debugf("Driver plugin does not report an SSH retry policy: %s", err)
+			return ssh.DefaultRetryPolicy, nil
+		}
+		return ssh.RetryPolicy{}, err
+	}
+
+	return policy, nil
+}
+
 func (c *RPCClientDriver) GetSSHHostname() (string, error) {
 	return c.rpcStringCall(GetSSHHostnameMethod)
 }
@@ -307,7 +803,7 @@ func (c *RPCClientDriver) GetSSHKeyPath() string {
 func (c *RPCClientDriver) GetSSHPort() (int, error) {
 	var port int
 
-	if err := c.Client.Call(GetSSHPortMethod, struct{}{}, &port); err != nil {
+	if err := c.call(GetSSHPortMethod, struct{}{}, &port); err != nil {
 		return 0, err
 	}
 
@@ -326,7 +822,18 @@ func (c *RPCClientDriver) GetSSHUsername() string {
 func (c *RPCClientDriver) GetState() (state.State, error) {
 	var s state.State
 
-	if err := c.Client.Call(GetStateMethod, struct{}{}, &s); err != nil {
+	if err := c.call(GetStateMethod, struct{}{}, &s); err != nil {
+		return state.Error, err
+	}
+
+	return s, nil
+}
+
+// GetStateContext is GetState, returning once ctx is done.
+func (c *RPCClientDriver) GetStateContext(ctx context.Context) (state.State, error) {
+	var s state.State
+
+	if err := c.callContext(ctx, GetStateMethod, struct{}{}, &s); err != nil {
 		return state.Error, err
 	}
 
@@ -334,33 +841,93 @@ func (c *RPCClientDriver) GetState() (state.State, error) {
 }
 
 func (c *RPCClientDriver) PreCreateCheck() error {
-	return c.Client.Call(PreCreateCheckMethod, struct{}{}, nil)
+	return c.call(PreCreateCheckMethod, struct{}{}, nil)
+}
+
+// PreCreateCheckContext is PreCreateCheck, returning once ctx is done. The
+// plugin still running it is then stopped, unless other machines share it.
+func (c *RPCClientDriver) PreCreateCheckContext(ctx context.Context) error {
+	return c.callContext(ctx, PreCreateCheckMethod, struct{}{}, nil)
+}
+
+// SetDryRun asks the plugin to skip the side effects of PreCreateCheck.
+// Plugins built before dry runs existed ignore it.
+func (c *RPCClientDriver) SetDryRun(dryRun bool) {
+	if err := c.call(SetDryRunMethod, dryRun, nil); err != nil {
+		if isMethodNotFound(err) {
+			log.Debugf("Driver plugin does not support dry runs: %s", err)
+		} else {
+			log.Warnf("Error attempting call to set dry run: %s", err)
+		}
+	}
 }
 
 func (c *RPCClientDriver) Create() error {
-	return c.Client.Call(CreateMethod, struct{}{}, nil)
+	return c.call(CreateMethod, struct{}{}, nil)
+}
+
+// CreateContext is Create, returning once ctx is done. The plugin still
+// running it is then stopped, unless other machines share it.
+func (c *RPCClientDriver) CreateContext(ctx context.Context) error {
+	return c.callContext(ctx, CreateMethod, struct{}{}, nil)
 }
 
 func (c *RPCClientDriver) Remove() error {
-	return c.Client.Call(RemoveMethod, struct{}{}, nil)
+	return c.call(RemoveMethod, struct{}{}, nil)
+}
+
+// RemoveContext is Remove, returning once ctx is done. The plugin still
+// running it is then stopped, unless other machines share it.
+func (c *RPCClientDriver) RemoveContext(ctx context.Context) error {
+	return c.callContext(ctx, RemoveMethod, struct{}{}, nil)
 }
 
 func (c *RPCClientDriver) Start() error {
-	return c.Client.Call(StartMethod, struct{}{}, nil)
+	return c.call(StartMethod, struct{}{}, nil)
+}
+
+// StartContext is Start, returning once ctx is done. The plugin still
+// running it is then stopped, unless other machines share it.
+func (c *RPCClientDriver) StartContext(ctx context.Context) error {
+	return c.callContext(ctx, StartMethod, struct{}{}, nil)
 }
 
 func (c *RPCClientDriver) Stop() error {
-	return c.Client.Call(StopMethod, struct{}{}, nil)
+	return c.call(StopMethod, struct{}{}, nil)
+}
+
+// StopContext is Stop, returning once ctx is done. The plugin still
+// running it is then stopped, unless other machines share it.
+func (c *RPCClientDriver) StopContext(ctx context.Context) error {
+	return c.callContext(ctx, StopMethod, struct{}{}, nil)
 }
 
 func (c *RPCClientDriver) Restart() error {
-	return c.Client.Call(RestartMethod, struct{}{}, nil)
+	return c.call(RestartMethod, struct{}{}, nil)
+}
+
+// RestartContext is Restart, returning once ctx is done. The plugin still
+// running it is then stopped, unless other machines share it.
+func (c *RPCClientDriver) RestartContext(ctx context.Context) error {
+	return c.callContext(ctx, RestartMethod, struct{}{}, nil)
 }
 
 func (c *RPCClientDriver) Kill() error {
-	return c.Client.Call(KillMethod, struct{}{}, nil)
+	return c.call(KillMethod, struct{}{}, nil)
+}
+
+// KillContext is Kill, returning once ctx is done. The plugin still
+// running it is then stopped, unless other machines share it.
+func (c *RPCClientDriver) KillContext(ctx context.Context) error {
+	return c.callContext(ctx, KillMethod, struct{}{}, nil)
 }
 
 func (c *RPCClientDriver) Upgrade() error {
-	return c.Client.Call(UpgradeMethod, struct{}{}, nil)
+	return c.call(UpgradeMethod, struct{}{}, nil)
+}
+
+// UpgradeContext is Upgrade, returning once ctx is done. The plugin still
+// running it is then stopped, unless other machines share it.
+func (c *RPCClientDriver) UpgradeContext(ctx context.Context) error {
+	return c.callContext(ctx, UpgradeMethod, struct{}{}, nil)
 }
@@ -0,0 +1,400 @@
+package rpcdriver
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/rpc"
+	"testing"
+	"time"
+
+	"github.com/rancher/machine/drivers/fakedriver"
+	"github.com/rancher/machine/drivers/generic"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/drivers/plugin/grpcplugin"
+	"github.com/rancher/machine/libmachine/drivers/plugin/localbinary"
+	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/rancher/machine/libmachine/metrics"
+	"github.com/rancher/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+// legacyServerDriver only serves the methods of a plugin built before
+// capability discovery existed.
+type legacyServerDriver struct{}
+
+func (l *legacyServerDriver) DriverName(_ *struct{}, reply *string) error {
+	*reply = "legacy"
+	return nil
+}
+
+// stuckServerDriver serves a Create which never returns on its own.
+type stuckServerDriver struct {
+	unblock chan struct{}
+}
+
+func (s *stuckServerDriver) Create(_ *struct{}, _ *struct{}) error {
+	<-s.unblock
+	return nil
+}
+
+func (s *stuckServerDriver) Heartbeat(_ *struct{}, _ *struct{}) error {
+	<-s.unblock
+	return nil
+}
+
+func newTestClientDriver(t *testing.T, rcvr interface{}) *RPCClientDriver {
+	server := rpc.NewServer()
+	if err := server.RegisterName(RPCServiceNameV1, rcvr); err != nil {
+		t.Fatal(err)
+	}
+
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(serverConn)
+
+	client := rpc.NewClient(clientConn)
+	t.Cleanup(func() { client.Close() })
+
+	return &RPCClientDriver{Client: NewInternalClient(client)}
+}
+
+func newTestGRPCClientDriver(t *testing.T, rcvr interface{}) *RPCClientDriver {
+	server := grpcplugin.NewServer()
+	if err := server.RegisterName(RPCServiceNameV1, rcvr); err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	client, err := grpcplugin.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return &RPCClientDriver{Client: NewInternalClient(client)}
+}
+
+func TestRPCClientDriverCapabilities(t *testing.T) {
+	d := &fakedriver.Driver{
+		MockCapabilities: []drivers.Capability{drivers.CapabilityStartStop, drivers.CapabilityKill},
+	}
+	c := newTestClientDriver(t, NewRPCServerDriver(d))
+
+	assert.Equal(t, d.MockCapabilities, c.Capabilities())
+}
+
+func TestRPCClientDriverCapabilitiesLegacyPlugin(t *testing.T) {
+	c := newTestClientDriver(t, &legacyServerDriver{})
+
+	assert.Equal(t, "legacy", c.DriverName())
+	assert.Equal(t, []drivers.Capability{}, c.Capabilities())
+}
+
+func TestRPCClientDriverOverGRPC(t *testing.T) {
+	netrpc := newTestClientDriver(t, NewRPCServerDriver(generic.NewDriver("default", "path")))
+	grpc := newTestGRPCClientDriver(t, NewRPCServerDriver(generic.NewDriver("default", "path")))
+
+	assert.Equal(t, netrpc.GetCreateFlags(), grpc.GetCreateFlags())
+
+	flags, err := GetDriverOpts(grpc.GetCreateFlags(), []string{"--generic-ip-address", "1.2.3.4", "--generic-ssh-port", "2222"})
+	assert.NoError(t, err)
+	assert.NoError(t, grpc.SetConfigFromFlags(flags))
+
+	ip, err := grpc.GetIP()
+	assert.NoError(t, err)
+	assert.Equal(t, "1.2.3.4", ip)
+	port, err := grpc.GetSSHPort()
+	assert.NoError(t, err)
+	assert.Equal(t, 2222, port)
+
+	assert.EqualError(t, grpc.SetConfigFromFlags(&RPCFlags{Values: map[string]interface{}{}}), "generic driver requires the --generic-ip-address option")
+}
+
+func TestRPCClientDriverOverGRPCLegacyPlugin(t *testing.T) {
+	c := newTestGRPCClientDriver(t, &legacyServerDriver{})
+
+	assert.Equal(t, "legacy", c.DriverName())
+	assert.Equal(t, []drivers.Capability{}, c.Capabilities())
+}
+
+func TestRPCClientDriverCreateContext(t *testing.T) {
+	server := &stuckServerDriver{unblock: make(chan struct{})}
+	defer close(server.unblock)
+	c := newTestClientDriver(t, server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	assert.ErrorIs(t, c.CreateContext(ctx), context.DeadlineExceeded)
+}
+
+// stoppedPlugin records that it was stopped.
+type stoppedPlugin struct {
+	*fakePlugin
+	stopped chan struct{}
+}
+
+func (p *stoppedPlugin) Close() error {
+	close(p.stopped)
+	return nil
+}
+
+func TestRPCClientDriverCreateContextStopsThePlugin(t *testing.T) {
+	server := &stuckServerDriver{unblock: make(chan struct{})}
+	defer close(server.unblock)
+	c := newTestClientDriver(t, server)
+	p := &stoppedPlugin{fakePlugin: &fakePlugin{}, stopped: make(chan struct{})}
+	c.plugin = p
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	assert.ErrorIs(t, c.CreateContext(ctx), context.DeadlineExceeded)
+	select {
+	case <-p.stopped:
+	default:
+		t.Fatal("the plugin still running Create was not stopped")
+	}
+}
+
+func TestRPCClientDriverCreateContextLeavesSharedPlugins(t *testing.T) {
+	server := &stuckServerDriver{unblock: make(chan struct{})}
+	defer close(server.unblock)
+	c := newTestClientDriver(t, server)
+	c.plugin = &sharedPluginRef{release: func() error {
+		t.Fatal("the shared plugin was released")
+		return nil
+	}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	assert.ErrorIs(t, c.CreateContext(ctx), context.DeadlineExceeded)
+}
+
+func TestRPCClientDriverGetStateContext(t *testing.T) {
+	c := newTestClientDriver(t, NewRPCServerDriver(&fakedriver.Driver{MockState: state.Running}))
+
+	s, err := c.GetStateContext(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, state.Running, s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s, err = c.GetStateContext(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, state.Error, s)
+}
+
+func TestDialHTTPAuthenticated(t *testing.T) {
+	server := rpc.NewServer()
+	if err := server.RegisterName(RPCServiceNameV1, &legacyServerDriver{}); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := localbinary.AuthListener(l, "secret")
+	defer listener.Close()
+	go http.Serve(listener, server)
+
+	client, err := dialHTTP("tcp", listener.Addr().String(), func(conn net.Conn) error {
+		return localbinary.AuthenticateConn(conn, "secret")
+	})
+	assert.NoError(t, err)
+	defer client.Close()
+
+	c := &RPCClientDriver{Client: NewInternalClient(client)}
+	assert.Equal(t, "legacy", c.DriverName())
+
+	_, err = dialHTTP("tcp", listener.Addr().String(), func(conn net.Conn) error {
+		return localbinary.AuthenticateConn(conn, "guessed")
+	})
+	assert.Error(t, err)
+}
+
+// startHeartbeat makes c ping its plugin quickly, until the test ends.
+func startHeartbeat(t *testing.T, c *RPCClientDriver) {
+	interval, timeout := heartbeatInterval, heartbeatTimeout
+	heartbeatInterval, heartbeatTimeout = 10*time.Millisecond, 50*time.Millisecond
+
+	c.plugin = &fakePlugin{}
+	c.heartbeatDoneCh = make(chan bool)
+	go c.heartbeat()
+
+	t.Cleanup(func() {
+		c.heartbeatDoneCh <- true
+		heartbeatInterval, heartbeatTimeout = interval, timeout
+	})
+}
+
+func TestRPCClientDriverHealth(t *testing.T) {
+	server := NewRPCServerDriver(&fakedriver.Driver{})
+	go func() {
+		for range server.HeartbeatCh {
+		}
+	}()
+	c := newTestClientDriver(t, server)
+	startHeartbeat(t, c)
+
+	assert.Eventually(t, func() bool { return !c.LastHeartbeat().IsZero() }, 5*time.Second, 10*time.Millisecond)
+	_, err := drivers.GetHealth(c)
+	assert.NoError(t, err)
+}
+
+func TestRPCClientDriverHealthHungPlugin(t *testing.T) {
+	server := &stuckServerDriver{unblock: make(chan struct{})}
+	defer close(server.unblock)
+	c := newTestClientDriver(t, server)
+	startHeartbeat(t, c)
+
+	assert.Eventually(t, func() bool {
+		_, err := drivers.GetHealth(c)
+		return err != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	last, err := c.Health()
+	assert.True(t, last.IsZero())
+	assert.EqualError(t, err, "Driver plugin is not responding: context deadline exceeded")
+}
+
+func TestRPCClientDriverCallMetrics(t *testing.T) {
+	metrics.Reset()
+	defer metrics.Reset()
+
+	c := newTestClientDriver(t, &legacyServerDriver{})
+	c.Client.DriverName = "legacy"
+
+	c.DriverName()
+	c.Capabilities()
+
+	assert.Equal(t, float64(1), metrics.PluginCalls.Value("legacy", "DriverName"))
+	assert.Equal(t, float64(1), metrics.PluginCallErrors.Value("legacy", "Capabilities"))
+}
+
+func TestRPCClientDriverSupportedArchitectures(t *testing.T) {
+	d := &fakedriver.Driver{MockArchitectures: []string{"amd64", "arm64"}}
+	c := newTestClientDriver(t, NewRPCServerDriver(d))
+
+	assert.Equal(t, []string{"amd64", "arm64"}, c.SupportedArchitectures())
+}
+
+func TestRPCClientDriverGetTags(t *testing.T) {
+	d := &fakedriver.TaggedDriver{Driver: &fakedriver.Driver{}, MockTags: map[string]string{"env": "prod"}}
+
+	tags, err := newTestClientDriver(t, NewRPCServerDriver(d)).GetTags()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "prod"}, tags)
+
+	_, err = newTestClientDriver(t, NewRPCServerDriver(&fakedriver.Driver{})).GetTags()
+	assert.Equal(t, drivers.ErrTagsNotReported, err)
+
+	_, err = newTestClientDriver(t, &legacyServerDriver{}).GetTags()
+	assert.Equal(t, drivers.ErrTagsNotReported, err)
+}
+
+func TestRPCClientDriverFlagSchema(t *testing.T) {
+	d := generic.NewDriver("default", "path")
+	expected := mcnflag.DescribeFlags(d.GetCreateFlags())
+
+	assert.Equal(t, expected, newTestClientDriver(t, NewRPCServerDriver(d)).FlagSchema())
+	assert.Equal(t, expected, newTestGRPCClientDriver(t, NewRPCServerDriver(d)).FlagSchema())
+}
+
+func TestRPCClientDriverFlagSchemaLegacyPlugin(t *testing.T) {
+	c := newTestClientDriver(t, &legacyServerDriver{})
+
+	assert.Equal(t, []mcnflag.Schema{}, c.FlagSchema())
+}
+
+func TestRPCClientDriverSupportedArchitecturesLegacyPlugin(t *testing.T) {
+	c := newTestClientDriver(t, &legacyServerDriver{})
+
+	assert.Equal(t, []string{}, c.SupportedArchitectures())
+}
+
+func TestRPCClientDriverSnapshots(t *testing.T) {
+	d := &fakedriver.SnapshotDriver{Driver: &fakedriver.Driver{}}
+	c := newTestClientDriver(t, NewRPCServerDriver(d))
+
+	snapshot, err := c.CreateSnapshot("base")
+	assert.NoError(t, err)
+	assert.Equal(t, drivers.Snapshot{ID: "snap-1", Name: "base"}, snapshot)
+
+	snapshots, err := c.ListSnapshots()
+	assert.NoError(t, err)
+	assert.Equal(t, []drivers.Snapshot{snapshot}, snapshots)
+
+	assert.NoError(t, c.RestoreSnapshot("snap-1"))
+	assert.Equal(t, "snap-1", d.MockRestored)
+	assert.EqualError(t, c.RestoreSnapshot("snap-2"), "snapshot snap-2 not found")
+}
+
+func TestRPCClientDriverSnapshotsNotSupported(t *testing.T) {
+	for _, c := range []*RPCClientDriver{
+		newTestClientDriver(t, NewRPCServerDriver(&fakedriver.Driver{})),
+		newTestClientDriver(t, &legacyServerDriver{}),
+	} {
+		_, err := c.CreateSnapshot("base")
+		assert.Equal(t, drivers.ErrSnapshotsNotSupported, err)
+		_, err = c.ListSnapshots()
+		assert.Equal(t, drivers.ErrSnapshotsNotSupported, err)
+		assert.Equal(t, drivers.ErrSnapshotsNotSupported, c.RestoreSnapshot("snap-1"))
+	}
+}
+
+func TestRPCClientDriverResize(t *testing.T) {
+	d := &fakedriver.ResizableDriver{Driver: &fakedriver.Driver{}}
+	spec := drivers.ResizeSpec{InstanceType: "t3.large"}
+
+	assert.NoError(t, newTestClientDriver(t, NewRPCServerDriver(d)).Resize(spec))
+	assert.Equal(t, spec, d.MockSpec)
+
+	assert.Equal(t, drivers.ErrResizeNotSupported, newTestClientDriver(t, NewRPCServerDriver(&fakedriver.Driver{})).Resize(spec))
+	assert.Equal(t, drivers.ErrResizeNotSupported, newTestClientDriver(t, &legacyServerDriver{}).Resize(spec))
+}
+
+// plannedDriver reports the instance it would create.
+type plannedDriver struct {
+	*fakedriver.Driver
+}
+
+func (d *plannedDriver) PreCreatePlan() ([]drivers.PlannedResource, error) {
+	return []drivers.PlannedResource{{Type: "instance", Name: d.MockName, Details: "t3.micro"}}, nil
+}
+
+func TestRPCClientDriverPreCreatePlan(t *testing.T) {
+	d := &plannedDriver{Driver: &fakedriver.Driver{MockName: "planned"}}
+
+	resources, err := newTestClientDriver(t, NewRPCServerDriver(d)).PreCreatePlan()
+	assert.NoError(t, err)
+	assert.Equal(t, []drivers.PlannedResource{{Type: "instance", Name: "planned", Details: "t3.micro"}}, resources)
+
+	_, err = newTestClientDriver(t, NewRPCServerDriver(&fakedriver.Driver{})).PreCreatePlan()
+	assert.Equal(t, drivers.ErrPlanNotSupported, err)
+
+	_, err = newTestClientDriver(t, &legacyServerDriver{}).PreCreatePlan()
+	assert.Equal(t, drivers.ErrPlanNotSupported, err)
+}
+
+func TestRPCClientDriverEstimateCost(t *testing.T) {
+	d := &fakedriver.PricedDriver{Driver: &fakedriver.Driver{}, MockCost: drivers.CostEstimate{Currency: "USD", Hourly: 0.5, Monthly: 365}}
+
+	estimate, err := newTestClientDriver(t, NewRPCServerDriver(d)).EstimateCost()
+	assert.NoError(t, err)
+	assert.Equal(t, &drivers.CostEstimate{Currency: "USD", Hourly: 0.5, Monthly: 365}, estimate)
+
+	_, err = newTestClientDriver(t, NewRPCServerDriver(&fakedriver.Driver{})).EstimateCost()
+	assert.Equal(t, drivers.ErrCostNotSupported, err)
+
+	_, err = newTestClientDriver(t, &legacyServerDriver{}).EstimateCost()
+	assert.Equal(t, drivers.ErrCostNotSupported, err)
+}
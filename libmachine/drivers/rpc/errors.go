@@ -0,0 +1,39 @@
+package rpcdriver
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/rancher/machine/libmachine/drivers"
+)
+
+// errorCodePrefix starts the message of the errors with a code returned by
+// the plugin, since RPC errors only carry a message. Machine binaries which
+// predate the codes show them with the message.
+const errorCodePrefix = "[machine-error "
+
+// encodeError puts the code of err, if any, in its message.
+func encodeError(err error) error {
+	code := drivers.GetErrorCode(err)
+	if code == "" {
+		return err
+	}
+	return errors.New(errorCodePrefix + string(code) + "] " + err.Error())
+}
+
+// decodeError returns the error encodeError encoded with its code again.
+func decodeError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	message := err.Error()
+	if !strings.HasPrefix(message, errorCodePrefix) {
+		return err
+	}
+	code, message, ok := strings.Cut(strings.TrimPrefix(message, errorCodePrefix), "] ")
+	if !ok {
+		return err
+	}
+	return drivers.NewError(drivers.ErrorCode(code), errors.New(message))
+}
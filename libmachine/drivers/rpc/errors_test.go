@@ -0,0 +1,42 @@
+package rpcdriver
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rancher/machine/drivers/fakedriver"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/stretchr/testify/assert"
+)
+
+// quotaDriver fails to create the machine for lack of quota.
+type quotaDriver struct {
+	*fakedriver.Driver
+}
+
+func (d *quotaDriver) Create() error {
+	return drivers.Errorf(drivers.ErrorCodeQuotaExceeded, "instance limit exceeded")
+}
+
+func TestRPCClientDriverErrorCode(t *testing.T) {
+	c := newTestClientDriver(t, NewRPCServerDriver(&quotaDriver{&fakedriver.Driver{}}))
+
+	err := c.Create()
+	assert.EqualError(t, err, "instance limit exceeded")
+	assert.Equal(t, drivers.ErrorCodeQuotaExceeded, drivers.GetErrorCode(err))
+	assert.False(t, drivers.IsRetryable(err))
+}
+
+func TestDecodeError(t *testing.T) {
+	assert.Nil(t, decodeError(nil))
+
+	err := decodeError(encodeError(drivers.Errorf(drivers.ErrorCodeTransientNetwork, "connection reset")))
+	assert.EqualError(t, err, "connection reset")
+	assert.True(t, drivers.IsRetryable(err))
+
+	err = decodeError(errors.New("[machine-error without end"))
+	assert.EqualError(t, err, "[machine-error without end")
+	assert.Equal(t, drivers.ErrorCode(""), drivers.GetErrorCode(err))
+
+	assert.Equal(t, errors.New("plain"), encodeError(errors.New("plain")))
+}
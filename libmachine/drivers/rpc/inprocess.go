@@ -0,0 +1,48 @@
+package rpcdriver
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/drivers/plugin/localbinary"
+	"github.com/rancher/machine/libmachine/log"
+)
+
+// EnvInProcessDrivers set to true runs the drivers compiled into the machine
+// binary in its own process, rather than re-executing the binary as their
+// plugin.
+const EnvInProcessDrivers = "MACHINE_INPROCESS_DRIVERS"
+
+// InProcessDrivers creates the drivers compiled into the machine binary, by
+// name.
+var InProcessDrivers = map[string]func() drivers.Driver{}
+
+func inProcessEnabled() bool {
+	return boolFromEnv(EnvInProcessDrivers)
+}
+
+// NewInProcessDriver returns the named driver configured with rawDriver,
+// running in this process, if it is compiled in and in-process drivers are
+// enabled. Otherwise it returns false and the driver runs as a plugin.
+//
+// Drivers are still run as plugins when the plugins drop privileges, which
+// this process cannot do for them.
+func NewInProcessDriver(driverName string, rawDriver []byte) (drivers.Driver, bool, error) {
+	newDriver, ok := InProcessDrivers[driverName]
+	if !ok || !inProcessEnabled() {
+		return nil, false, nil
+	}
+	if os.Getenv(localbinary.PluginUID) != "" && os.Getenv(localbinary.PluginGID) != "" {
+		log.Debugf("Running the %s driver as a plugin to drop its privileges", driverName)
+		return nil, false, nil
+	}
+
+	log.Debugf("Running the %s driver in process", driverName)
+	d := newDriver()
+	if err := json.Unmarshal(rawDriver, &d); err != nil {
+		return nil, true, fmt.Errorf("Error loading the %s driver config: %s", driverName, err)
+	}
+	return d, true, nil
+}
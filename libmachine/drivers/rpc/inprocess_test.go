@@ -0,0 +1,55 @@
+package rpcdriver
+
+import (
+	"testing"
+
+	"github.com/rancher/machine/drivers/fakedriver"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/drivers/plugin/localbinary"
+	"github.com/stretchr/testify/assert"
+)
+
+func withInProcessDrivers(t *testing.T) {
+	previous := InProcessDrivers
+	InProcessDrivers = map[string]func() drivers.Driver{
+		"fake": func() drivers.Driver { return &fakedriver.Driver{} },
+	}
+	t.Cleanup(func() { InProcessDrivers = previous })
+}
+
+func TestNewInProcessDriver(t *testing.T) {
+	withInProcessDrivers(t)
+	t.Setenv(EnvInProcessDrivers, "true")
+
+	d, ok, err := NewInProcessDriver("fake", []byte(`{"MockName":"default"}`))
+
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	assert.Equal(t, "default", d.GetMachineName())
+	assert.IsType(t, &fakedriver.Driver{}, d)
+}
+
+func TestNewInProcessDriverDisabled(t *testing.T) {
+	withInProcessDrivers(t)
+
+	for _, value := range []string{"", "false", "maybe"} {
+		t.Setenv(EnvInProcessDrivers, value)
+		_, ok, _ := NewInProcessDriver("fake", []byte(`{}`))
+		assert.False(t, ok, value)
+	}
+}
+
+func TestNewInProcessDriverPlugins(t *testing.T) {
+	withInProcessDrivers(t)
+	t.Setenv(EnvInProcessDrivers, "true")
+
+	// Drivers not compiled in are plugins.
+	_, ok, _ := NewInProcessDriver("hetzner", []byte(`{}`))
+	assert.False(t, ok)
+
+	// So are the drivers dropping their privileges.
+	t.Setenv(localbinary.PluginUID, "1000")
+	t.Setenv(localbinary.PluginGID, "1000")
+	_, ok, _ = NewInProcessDriver("fake", []byte(`{}`))
+	assert.False(t, ok)
+}
@@ -0,0 +1,285 @@
+package rpcdriver
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/drivers/plugin/localbinary"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/version"
+)
+
+// EnvMultiplexPlugins set to true has the machines of a same driver share
+// a single plugin process, rather than starting one each. Plugins which
+// cannot serve several machines still get one process per machine.
+const EnvMultiplexPlugins = "MACHINE_MULTIPLEX_PLUGINS"
+
+const (
+	NewInstanceMethod = `.NewInstance`
+	MuxCallMethod     = `.Call`
+)
+
+func multiplexEnabled() bool {
+	return boolFromEnv(EnvMultiplexPlugins)
+}
+
+func boolFromEnv(name string) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return false
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Warnf("Ignoring the invalid %s %q", name, value)
+		return false
+	}
+	return enabled
+}
+
+// MuxCallArgs is a call to a method of the driver instance of a machine
+// served by a multiplexed plugin. Args and the reply are gob encoded.
+type MuxCallArgs struct {
+	Instance string
+	Method   string
+	Args     []byte
+}
+
+// RPCServerDriverMux serves several machines from one plugin process, each
+// with its own instance of the driver, which is an RPCServerDriver.
+type RPCServerDriverMux struct {
+	newDriver   func() drivers.Driver
+	CloseCh     chan bool
+	HeartbeatCh chan bool
+
+	lock      sync.Mutex
+	instances map[string]*RPCServerDriver
+	lastID    int
+}
+
+func NewRPCServerDriverMux(newDriver func() drivers.Driver) *RPCServerDriverMux {
+	return &RPCServerDriverMux{
+		newDriver:   newDriver,
+		CloseCh:     make(chan bool),
+		HeartbeatCh: make(chan bool),
+		instances:   map[string]*RPCServerDriver{},
+	}
+}
+
+// Close stops the plugin, once the last machine released its instance.
+func (m *RPCServerDriverMux) Close(_, _ *struct{}) error {
+	m.CloseCh <- true
+	return nil
+}
+
+func (m *RPCServerDriverMux) GetVersion(_ *struct{}, reply *int) error {
+	*reply = version.APIVersion
+	return nil
+}
+
+func (m *RPCServerDriverMux) Heartbeat(_, _ *struct{}) error {
+	m.HeartbeatCh <- true
+	return nil
+}
+
+// NewInstance creates the driver instance of a machine, replying with its
+// ID.
+func (m *RPCServerDriverMux) NewInstance(_ *struct{}, reply *string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.lastID++
+	id := strconv.Itoa(m.lastID)
+	m.instances[id] = &RPCServerDriver{
+		ActualDriver: m.newDriver(),
+		HeartbeatCh:  m.HeartbeatCh,
+	}
+	*reply = id
+	return nil
+}
+
+// Call calls a method of the RPCServerDriver of an instance. Closing an
+// instance releases it, the plugin serving the other ones.
+func (m *RPCServerDriverMux) Call(args MuxCallArgs, reply *[]byte) error {
+	m.lock.Lock()
+	instance, ok := m.instances[args.Instance]
+	if ok && args.Method == strings.TrimPrefix(CloseMethod, ".") {
+		delete(m.instances, args.Instance)
+	}
+	m.lock.Unlock()
+
+	if !ok {
+		return fmt.Errorf("Unknown driver instance %q", args.Instance)
+	}
+	if args.Method == strings.TrimPrefix(CloseMethod, ".") {
+		return nil
+	}
+
+	method := reflect.ValueOf(instance).MethodByName(args.Method)
+	if !method.IsValid() || method.Type().NumIn() != 2 || method.Type().NumOut() != 1 {
+		return fmt.Errorf("rpc: can't find method %s.%s", RPCServiceNameV1, args.Method)
+	}
+
+	argType, replyType := method.Type().In(0), method.Type().In(1)
+	argv := reflect.New(argType)
+	if argType.Kind() == reflect.Ptr {
+		argv = reflect.New(argType.Elem())
+	}
+	if err := gob.NewDecoder(bytes.NewReader(args.Args)).Decode(argv.Interface()); err != nil {
+		return fmt.Errorf("Error decoding the arguments of %s: %s", args.Method, err)
+	}
+	if argType.Kind() != reflect.Ptr {
+		argv = argv.Elem()
+	}
+
+	replyv := reflect.New(replyType.Elem())
+	if err, _ := method.Call([]reflect.Value{argv, replyv})[0].Interface().(error); err != nil {
+		return err
+	}
+
+	var encoded bytes.Buffer
+	if err := gob.NewEncoder(&encoded).Encode(replyv.Interface()); err != nil {
+		return fmt.Errorf("Error encoding the reply of %s: %s", args.Method, err)
+	}
+	*reply = encoded.Bytes()
+	return nil
+}
+
+// muxCaller makes the calls of a machine to its driver instance in a
+// multiplexed plugin, over the connection shared by the machines.
+type muxCaller struct {
+	shared   Caller
+	instance string
+}
+
+func (c *muxCaller) Call(serviceMethod string, args interface{}, reply interface{}) error {
+	_, method, _ := strings.Cut(serviceMethod, ".")
+
+	var encoded bytes.Buffer
+	if err := gob.NewEncoder(&encoded).Encode(args); err != nil {
+		return err
+	}
+
+	var encodedReply []byte
+	call := MuxCallArgs{Instance: c.instance, Method: method, Args: encoded.Bytes()}
+	if err := c.shared.Call(RPCServiceNameV1+MuxCallMethod, call, &encodedReply); err != nil {
+		return err
+	}
+	if reply == nil {
+		return nil
+	}
+	return gob.NewDecoder(bytes.NewReader(encodedReply)).Decode(reply)
+}
+
+// Close does nothing, the connection being closed with the plugin.
+func (c *muxCaller) Close() error {
+	return nil
+}
+
+// sharedPlugin is a multiplexed plugin, serving every machine of its driver
+// until the last one releases it.
+type sharedPlugin struct {
+	driverName string
+	plugin     *localbinary.Plugin
+	client     *InternalClient
+	refs       int
+}
+
+func (s *sharedPlugin) exited() bool {
+	select {
+	case <-s.plugin.Exited():
+		return true
+	default:
+		return false
+	}
+}
+
+// sharedPluginRef is the reference of a machine to a shared plugin, which
+// is only closed once every machine closed theirs.
+type sharedPluginRef struct {
+	*localbinary.Plugin
+	once    sync.Once
+	release func() error
+}
+
+func (r *sharedPluginRef) Close() error {
+	var err error
+	r.once.Do(func() { err = r.release() })
+	return err
+}
+
+// launchShared connects the named driver to the plugin shared by the
+// machines of this driver, starting it if needed. A plugin which cannot
+// serve several machines is dedicated to this one, as if it was launched
+// with launchPlugin.
+func (f *DefaultRPCClientDriverFactory) launchShared(ctx context.Context, driverName string) (localbinary.DriverPlugin, *InternalClient, error) {
+	f.sharedLock.Lock()
+	defer f.sharedLock.Unlock()
+
+	s := f.sharedPlugins[driverName]
+	if s != nil && s.exited() {
+		delete(f.sharedPlugins, driverName)
+		s = nil
+	}
+
+	if s == nil {
+		// The output of the plugin is logged under the driver name, not
+		// the one of a machine.
+		p, client, err := launchPlugin(ctx, driverName, driverName, true)
+		if err != nil {
+			return nil, nil, err
+		}
+		if multiplexed, _ := p.Multiplexed(); !multiplexed {
+			log.Debugf("The %s driver plugin cannot serve several machines", driverName)
+			return p, client, nil
+		}
+		s = &sharedPlugin{driverName: driverName, plugin: p, client: client}
+		f.sharedPlugins[driverName] = s
+	}
+
+	var instance string
+	if err := s.client.CallContext(ctx, NewInstanceMethod, struct{}{}, &instance); err != nil {
+		if s.refs == 0 {
+			f.closeShared(s)
+		}
+		return nil, nil, err
+	}
+	s.refs++
+	log.Debugf("Sharing the %s driver plugin with %d machines", driverName, s.refs)
+
+	client := NewInternalClient(&muxCaller{shared: s.client.RPCClient, instance: instance})
+	client.DriverName = driverName
+	ref := &sharedPluginRef{Plugin: s.plugin, release: func() error { return f.releaseShared(s) }}
+	return ref, client, nil
+}
+
+// releaseShared closes a shared plugin once the last machine released it.
+func (f *DefaultRPCClientDriverFactory) releaseShared(s *sharedPlugin) error {
+	f.sharedLock.Lock()
+	defer f.sharedLock.Unlock()
+
+	s.refs--
+	if s.refs > 0 {
+		return nil
+	}
+	return f.closeShared(s)
+}
+
+func (f *DefaultRPCClientDriverFactory) closeShared(s *sharedPlugin) error {
+	if f.sharedPlugins[s.driverName] == s {
+		delete(f.sharedPlugins, s.driverName)
+	}
+
+	if err := s.client.Call(CloseMethod, struct{}{}, nil); err != nil {
+		log.Debugf("Failed to make call to close the shared driver server: %s", err)
+	}
+	return s.plugin.Close()
+}
@@ -0,0 +1,89 @@
+package rpcdriver
+
+import (
+	"net"
+	"net/rpc"
+	"testing"
+
+	"github.com/rancher/machine/drivers/fakedriver"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMuxClient(t *testing.T) (*RPCServerDriverMux, *InternalClient) {
+	mux := NewRPCServerDriverMux(func() drivers.Driver {
+		return &fakedriver.Driver{BaseDriver: &drivers.BaseDriver{}}
+	})
+	server := rpc.NewServer()
+	if err := server.RegisterName(RPCServiceNameV1, mux); err != nil {
+		t.Fatal(err)
+	}
+
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(serverConn)
+
+	client := rpc.NewClient(clientConn)
+	t.Cleanup(func() { client.Close() })
+	return mux, NewInternalClient(client)
+}
+
+func newMuxInstance(t *testing.T, shared *InternalClient) *RPCClientDriver {
+	var instance string
+	if err := shared.Call(NewInstanceMethod, struct{}{}, &instance); err != nil {
+		t.Fatal(err)
+	}
+	return &RPCClientDriver{Client: NewInternalClient(&muxCaller{shared: shared.RPCClient, instance: instance})}
+}
+
+func TestMuxServesInstancesIndependently(t *testing.T) {
+	_, shared := newMuxClient(t)
+	first, second := newMuxInstance(t, shared), newMuxInstance(t, shared)
+
+	assert.NoError(t, first.SetConfigRaw([]byte(`{"MockState":1,"MockIP":"1.2.3.4","MockName":"first"}`)))
+	assert.NoError(t, second.SetConfigRaw([]byte(`{"MockState":1,"MockIP":"5.6.7.8","MockName":"second"}`)))
+	assert.NoError(t, second.Stop())
+
+	ip, err := first.GetIP()
+	assert.NoError(t, err)
+	assert.Equal(t, "1.2.3.4", ip)
+
+	s, err := first.GetState()
+	assert.NoError(t, err)
+	assert.Equal(t, state.Running, s)
+
+	s, err = second.GetState()
+	assert.NoError(t, err)
+	assert.Equal(t, state.Stopped, s)
+}
+
+func TestMuxCallsDriverMethodsWithArguments(t *testing.T) {
+	_, shared := newMuxClient(t)
+	c := newMuxInstance(t, shared)
+
+	assert.NoError(t, c.SetConfigFromFlags(&RPCFlags{Values: map[string]interface{}{"url": "tcp://1.2.3.4:2376"}}))
+	assert.NoError(t, c.SetConfigRaw([]byte(`{"MockName":"machine"}`)))
+	assert.Equal(t, "machine", c.GetMachineName())
+}
+
+func TestMuxCloseReleasesInstance(t *testing.T) {
+	mux, shared := newMuxClient(t)
+	first, second := newMuxInstance(t, shared), newMuxInstance(t, shared)
+
+	assert.NoError(t, first.Client.Call(CloseMethod, struct{}{}, nil))
+	assert.Len(t, mux.instances, 1)
+
+	_, err := first.GetState()
+	assert.EqualError(t, err, `Unknown driver instance "1"`)
+
+	_, err = second.GetState()
+	assert.NoError(t, err)
+}
+
+func TestMuxUnknownMethod(t *testing.T) {
+	_, shared := newMuxClient(t)
+	c := newMuxInstance(t, shared)
+
+	err := c.Client.Call(".Frobnicate", struct{}{}, nil)
+	assert.True(t, isMethodNotFound(err), "%s is not a missing method", err)
+}
@@ -0,0 +1,74 @@
+package rpcdriver
+
+import (
+	"time"
+
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/progress"
+)
+
+// ProgressQueue holds the progress events of the machines served by the
+// plugin process, until the machine binary polls them.
+var ProgressQueue = progress.NewQueue()
+
+// progressPollTimeout is how long a poll for progress events waits in the
+// plugin, which also bounds how long a call outlives the operation.
+const progressPollTimeout = 250 * time.Millisecond
+
+// progressMethods are the long operations the progress events of are
+// streamed during.
+var progressMethods = map[string]bool{
+	PreCreateCheckMethod:  true,
+	CreateMethod:          true,
+	RemoveMethod:          true,
+	StartMethod:           true,
+	StopMethod:            true,
+	RestartMethod:         true,
+	KillMethod:            true,
+	UpgradeMethod:         true,
+	CreateSnapshotMethod:  true,
+	RestoreSnapshotMethod: true,
+	ResizeMethod:          true,
+}
+
+// streamProgress emits the progress events the plugin reports, until the
+// returned function is called. Plugins built before the events were sent over
+// RPC still write them to their stdout.
+func (c *RPCClientDriver) streamProgress() (stop func()) {
+	client, _ := c.connection()
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+		for {
+			// The last poll only collects the events left.
+			timeout := progressPollTimeout
+			select {
+			case <-done:
+				timeout = 0
+			default:
+			}
+
+			var events []progress.Event
+			if err := client.Call(ProgressEventsMethod, timeout, &events); err != nil {
+				if !isMethodNotFound(err) {
+					log.Debugf("Error polling the progress of the driver plugin: %s", err)
+				}
+				return
+			}
+			for _, ev := range events {
+				progress.Emit(ev)
+			}
+
+			if timeout == 0 {
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+	}
+}
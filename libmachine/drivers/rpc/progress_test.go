@@ -0,0 +1,47 @@
+package rpcdriver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rancher/machine/drivers/fakedriver"
+	"github.com/rancher/machine/libmachine/progress"
+	"github.com/stretchr/testify/assert"
+)
+
+// progressDriver reports progress while it creates the machine, the way the
+// default handler of a plugin queues the events.
+type progressDriver struct {
+	*fakedriver.Driver
+}
+
+func (d *progressDriver) Create() error {
+	ev := progress.Event{Type: progress.StepProgress, Machine: d.GetMachineName(), Step: "uploading", Percent: 50, Message: "Uploading disk"}
+	for !ProgressQueue.Push(ev) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+func TestRPCClientDriverStreamsProgress(t *testing.T) {
+	d := &progressDriver{&fakedriver.Driver{MockName: "streamed"}}
+	c := newTestClientDriver(t, NewRPCServerDriver(d))
+
+	var events []progress.Event
+	defer progress.Subscribe("streamed", func(ev progress.Event) {
+		events = append(events, ev)
+	})()
+
+	assert.NoError(t, c.Create())
+	assert.Equal(t, []progress.Event{
+		{Type: progress.StepProgress, Machine: "streamed", Step: "uploading", Percent: 50, Message: "Uploading disk"},
+	}, events)
+}
+
+func TestRPCClientDriverProgressLegacyPlugin(t *testing.T) {
+	server := &stuckServerDriver{unblock: make(chan struct{})}
+	close(server.unblock)
+	c := newTestClientDriver(t, server)
+
+	assert.NoError(t, c.Create())
+}
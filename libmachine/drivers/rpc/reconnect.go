@@ -0,0 +1,305 @@
+package rpcdriver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/rpc"
+	"time"
+
+	"github.com/rancher/machine/libmachine/drivers/plugin/localbinary"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/metrics"
+)
+
+// ReconnectOptions makes an RPC client driver relaunch its plugin when the
+// connection to it is lost, e.g. because a cloud SDK made it panic. The
+// relaunched plugin is given the last known config of the driver.
+type ReconnectOptions struct {
+	// Attempts is the number of times an idempotent call is retried once
+	// the connection is lost. Zero disables reconnection.
+	Attempts int
+	// Backoff is the delay before the first retry, doubled for each of the
+	// following ones.
+	Backoff time.Duration
+}
+
+// pluginLauncher starts a plugin and connects to it.
+type pluginLauncher func() (localbinary.DriverPlugin, *InternalClient, error)
+
+// idempotentMethods can be retried against a relaunched plugin.
+var idempotentMethods = map[string]bool{
+	GetConfigRawMethod:      true,
+	DriverNameMethod:        true,
+	GetMachineNameMethod:    true,
+	GetURLMethod:            true,
+	GetIPMethod:             true,
+	GetIPsMethod:            true,
+	GetTagsMethod:           true,
+	ListSnapshotsMethod:     true,
+	PreCreatePlanMethod:     true,
+	EstimateCostMethod:      true,
+	GetSSHBastionMethod:     true,
+	GetSSHHostnameMethod:    true,
+	GetSSHPasswordMethod:    true,
+	GetSSHRetryPolicyMethod: true,
+	GetSSHKeyPathMethod:     true,
+	GetSSHPortMethod:        true,
+	GetSSHUsernameMethod:    true,
+	GetStateMethod:          true,
+}
+
+// mutatingMethods change the config of the driver, which is captured again
+// after they succeed.
+var mutatingMethods = map[string]bool{
+	SetConfigFromFlagsMethod: true,
+	PreCreateCheckMethod:     true,
+	CreateMethod:             true,
+	RemoveMethod:             true,
+	StartMethod:              true,
+	StopMethod:               true,
+	RestartMethod:            true,
+	KillMethod:               true,
+	UpgradeMethod:            true,
+	CreateSnapshotMethod:     true,
+	RestoreSnapshotMethod:    true,
+	ResizeMethod:             true,
+}
+
+func isConnectionError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, rpc.ErrShutdown) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.ErrClosedPipe) ||
+		errors.As(err, &netErr)
+}
+
+func (c *RPCClientDriver) internalClient() *InternalClient {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.Client
+}
+
+// connection returns the client and the plugin it is connected to.
+func (c *RPCClientDriver) connection() (*InternalClient, localbinary.DriverPlugin) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.Client, c.plugin
+}
+
+// crashWait is how long a call which lost the connection to its plugin waits
+// for the plugin to be noticed exiting, the connection usually being lost
+// first.
+var crashWait = 500 * time.Millisecond
+
+// withCrashDiagnostics wraps err, a connection error of a call to plugin, in
+// the ErrPluginCrashed describing how the plugin died, if it crashed.
+func withCrashDiagnostics(plugin localbinary.DriverPlugin, err error) error {
+	crashed, ok := plugin.(interface {
+		Exited() <-chan struct{}
+		Crashed() error
+	})
+	if !ok || !isConnectionError(err) {
+		return err
+	}
+
+	select {
+	case <-crashed.Exited():
+	case <-time.After(crashWait):
+	}
+
+	if crash, ok := crashed.Crashed().(localbinary.ErrPluginCrashed); ok {
+		crash.Cause = err
+		return crash
+	}
+	return err
+}
+
+// call makes an RPC call to the plugin. If the plugin died and reconnection
+// is enabled, the plugin is relaunched. Idempotent calls are then retried,
+// other ones fail but the driver can still be used.
+func (c *RPCClientDriver) call(method string, args interface{}, reply interface{}) error {
+	return c.callContext(context.Background(), method, args, reply)
+}
+
+// callContext is call, returning once ctx is done. A long operation still
+// running in the plugin is then interrupted, see interrupt, other calls go on
+// until they complete or the driver is closed.
+func (c *RPCClientDriver) callContext(ctx context.Context, method string, args interface{}, reply interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if progressMethods[method] {
+		defer c.streamProgress()()
+	}
+
+	client, plugin := c.connection()
+	err := client.CallContext(ctx, method, args, reply)
+	if err == nil {
+		c.captureConfig(method, args, reply)
+		return nil
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil && errors.Is(err, ctxErr) {
+		c.interrupt(method, plugin)
+		return err
+	}
+	err = withCrashDiagnostics(plugin, decodeError(err))
+
+	if c.reconnect.Attempts == 0 || c.launch == nil || !isConnectionError(err) {
+		return err
+	}
+
+	if !idempotentMethods[method] {
+		log.Warnf("Lost the connection to the driver plugin during %s, relaunching it", method)
+		if relaunchErr := c.relaunch(client); relaunchErr != nil {
+			log.Warnf("Error relaunching the driver plugin: %s", relaunchErr)
+		}
+		return err
+	}
+
+	backoff := c.reconnect.Backoff
+	for attempt := 1; attempt <= c.reconnect.Attempts; attempt++ {
+		log.Debugf("Lost the connection to the driver plugin during %s, relaunching it (attempt %d/%d)", method, attempt, c.reconnect.Attempts)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+
+		if err = c.relaunch(client); err != nil {
+			continue
+		}
+
+		client, plugin = c.connection()
+		err = client.CallContext(ctx, method, args, reply)
+		if err == nil {
+			c.captureConfig(method, args, reply)
+			return nil
+		}
+		err = withCrashDiagnostics(plugin, err)
+		if !isConnectionError(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// interrupt stops the plugin running the long operation the caller gave up
+// on, the drivers having no way to cancel one. The driver then fails its
+// calls, unless reconnection relaunches the plugin. A plugin shared with
+// other machines is left running the operation.
+func (c *RPCClientDriver) interrupt(method string, plugin localbinary.DriverPlugin) {
+	if !progressMethods[method] || plugin == nil {
+		return
+	}
+	if _, ok := plugin.(*sharedPluginRef); ok {
+		log.Warnf("Gave up on %s, which goes on in the driver plugin shared with other machines", method[1:])
+		return
+	}
+
+	log.Warnf("Gave up on %s, stopping the driver plugin", method[1:])
+	if err := plugin.Close(); err != nil {
+		log.Debugf("Error stopping the driver plugin: %s", err)
+	}
+}
+
+// captureConfig keeps the last known config of the driver, to replay it to a
+// relaunched plugin.
+func (c *RPCClientDriver) captureConfig(method string, args interface{}, reply interface{}) {
+	if c.reconnect.Attempts == 0 {
+		return
+	}
+
+	switch {
+	case method == SetConfigRawMethod:
+		if raw, ok := args.([]byte); ok {
+			c.setLastConfig(raw)
+		}
+	case method == GetConfigRawMethod:
+		if raw, ok := reply.(*[]byte); ok {
+			c.setLastConfig(*raw)
+		}
+	case mutatingMethods[method]:
+		var raw []byte
+		if err := c.internalClient().Call(GetConfigRawMethod, struct{}{}, &raw); err != nil {
+			log.Debugf("Error capturing the driver config after %s: %s", method, err)
+			return
+		}
+		c.setLastConfig(raw)
+	}
+}
+
+func (c *RPCClientDriver) setLastConfig(raw []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.lastConfig = raw
+}
+
+// relaunch replaces the plugin of stale, the client which lost its
+// connection, by a new one configured like the old one.
+func (c *RPCClientDriver) relaunch(stale *InternalClient) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// The plugin was already relaunched, e.g. by the supervisor.
+	if c.Client != stale {
+		return nil
+	}
+
+	if c.plugin != nil {
+		if err := c.plugin.Close(); err != nil {
+			log.Debugf("Error closing the lost driver plugin: %s", err)
+		}
+	}
+
+	plugin, client, err := c.launch()
+	if err != nil {
+		return fmt.Errorf("Error relaunching the driver plugin: %s", err)
+	}
+
+	if c.lastConfig != nil {
+		if err := client.Call(SetConfigRawMethod, c.lastConfig, nil); err != nil {
+			plugin.Close()
+			return fmt.Errorf("Error replaying the config to the relaunched driver plugin: %s", err)
+		}
+	}
+
+	client.MachineName = c.Client.MachineName
+	c.Client = client
+	c.plugin = plugin
+	metrics.PluginRestarts.Inc(client.DriverName)
+	return nil
+}
+
+// supervise relaunches the plugin as soon as its process crashes, rather
+// than on the next call, until the driver is closed.
+func (c *RPCClientDriver) supervise() {
+	for {
+		c.lock.RLock()
+		plugin, client := c.plugin, c.Client
+		c.lock.RUnlock()
+
+		watched, ok := plugin.(interface{ Exited() <-chan struct{} })
+		if !ok {
+			return
+		}
+
+		select {
+		case <-c.closedCh:
+			return
+		case <-watched.Exited():
+		}
+
+		log.Warnf("(%s) Relaunching the crashed driver plugin", client.MachineName)
+		if err := c.relaunch(client); err != nil {
+			// The next call tries again.
+			log.Warn(err)
+			return
+		}
+	}
+}
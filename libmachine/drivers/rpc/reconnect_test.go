@@ -0,0 +1,231 @@
+package rpcdriver
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/rpc"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rancher/machine/drivers/fakedriver"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/drivers/plugin/localbinary"
+	"github.com/rancher/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePlugin is a plugin server running in the test process. Killing it
+// closes the connection like a plugin process dying would.
+type fakePlugin struct {
+	driver *fakedriver.Driver
+	conn   net.Conn
+	exited chan struct{}
+
+	lock          sync.Mutex
+	lastHeartbeat time.Time
+}
+
+func (p *fakePlugin) Serve() error                              { return nil }
+func (p *fakePlugin) Address() (string, error)                  { return "pipe", nil }
+func (p *fakePlugin) Close() error                              { return p.conn.Close() }
+func (p *fakePlugin) AttachStream(*bufio.Scanner) <-chan string { return nil }
+
+func (p *fakePlugin) RecordHeartbeat(at time.Time) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.lastHeartbeat = at
+}
+
+func (p *fakePlugin) LastHeartbeat() time.Time {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.lastHeartbeat
+}
+
+func (p *fakePlugin) Exited() <-chan struct{} {
+	return p.exited
+}
+
+func (p *fakePlugin) kill() {
+	p.conn.Close()
+}
+
+// crash kills the plugin and reports its process exited.
+func (p *fakePlugin) crash() {
+	p.kill()
+	close(p.exited)
+}
+
+// fakeLauncher launches fake plugins, keeping the ones it launched.
+type fakeLauncher struct {
+	t       *testing.T
+	lock    sync.Mutex
+	plugins []*fakePlugin
+}
+
+func (l *fakeLauncher) launch() (localbinary.DriverPlugin, *InternalClient, error) {
+	d := &fakedriver.Driver{BaseDriver: &drivers.BaseDriver{}}
+	server := rpc.NewServer()
+	if err := server.RegisterName(RPCServiceNameV1, NewRPCServerDriver(d)); err != nil {
+		return nil, nil, err
+	}
+
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(serverConn)
+
+	client := rpc.NewClient(clientConn)
+	l.t.Cleanup(func() { client.Close() })
+
+	p := &fakePlugin{driver: d, conn: serverConn, exited: make(chan struct{})}
+	l.lock.Lock()
+	l.plugins = append(l.plugins, p)
+	l.lock.Unlock()
+	return p, NewInternalClient(client), nil
+}
+
+func (l *fakeLauncher) last() *fakePlugin {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.plugins[len(l.plugins)-1]
+}
+
+func (l *fakeLauncher) launched() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return len(l.plugins)
+}
+
+func newReconnectingClientDriver(t *testing.T, attempts int) (*RPCClientDriver, *fakeLauncher) {
+	l := &fakeLauncher{t: t}
+	p, client, err := l.launch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &RPCClientDriver{
+		Client:    client,
+		plugin:    p,
+		closedCh:  make(chan struct{}),
+		reconnect: ReconnectOptions{Attempts: attempts},
+		launch:    l.launch,
+	}, l
+}
+
+func TestReconnectRetriesIdempotentCalls(t *testing.T) {
+	c, l := newReconnectingClientDriver(t, 2)
+
+	assert.NoError(t, c.SetConfigRaw([]byte(`{"MockState":1,"MockIP":"1.2.3.4","MockName":"old"}`)))
+	assert.NoError(t, c.SetConfigRaw([]byte(`{"MockState":1,"MockIP":"5.6.7.8","MockName":"latest"}`)))
+
+	l.last().kill()
+
+	ip, err := c.GetIP()
+	assert.NoError(t, err)
+	assert.Equal(t, "5.6.7.8", ip)
+	assert.Equal(t, 2, l.launched())
+	assert.Equal(t, "latest", l.last().driver.MockName)
+
+	s, err := c.GetState()
+	assert.NoError(t, err)
+	assert.Equal(t, state.Running, s)
+	assert.Equal(t, 2, l.launched())
+}
+
+func TestReconnectReplaysConfigCapturedAfterMutation(t *testing.T) {
+	c, l := newReconnectingClientDriver(t, 1)
+
+	assert.NoError(t, c.SetConfigRaw([]byte(`{"MockState":1,"MockName":"default"}`)))
+	assert.NoError(t, c.Stop())
+
+	l.last().kill()
+
+	s, err := c.GetState()
+	assert.NoError(t, err)
+	assert.Equal(t, state.Stopped, s)
+	assert.Equal(t, 2, l.launched())
+}
+
+func TestReconnectFailsMutatingCalls(t *testing.T) {
+	c, l := newReconnectingClientDriver(t, 2)
+
+	assert.NoError(t, c.SetConfigRaw([]byte(`{"MockState":1,"MockName":"default"}`)))
+
+	l.last().kill()
+
+	err := c.Create()
+	assert.True(t, isConnectionError(err), "%s is not a connection error", err)
+
+	s, err := c.GetState()
+	assert.NoError(t, err)
+	assert.Equal(t, state.Running, s)
+	assert.Equal(t, 2, l.launched())
+}
+
+func TestReconnectDisabled(t *testing.T) {
+	c, l := newReconnectingClientDriver(t, 0)
+
+	assert.NoError(t, c.SetConfigRaw([]byte(`{"MockState":1,"MockName":"default"}`)))
+
+	l.last().kill()
+
+	_, err := c.GetState()
+	assert.Error(t, err)
+	assert.Equal(t, 1, l.launched())
+}
+
+func TestReconnectGivesUp(t *testing.T) {
+	c, l := newReconnectingClientDriver(t, 3)
+	c.launch = func() (localbinary.DriverPlugin, *InternalClient, error) {
+		return nil, nil, errors.New("plugin binary is gone")
+	}
+
+	assert.NoError(t, c.SetConfigRaw([]byte(`{"MockState":1,"MockName":"default"}`)))
+
+	l.last().kill()
+
+	_, err := c.GetState()
+	assert.EqualError(t, err, "Error relaunching the driver plugin: plugin binary is gone")
+}
+
+func TestSuperviseRelaunchesCrashedPlugin(t *testing.T) {
+	c, l := newReconnectingClientDriver(t, 1)
+	go c.supervise()
+	defer close(c.closedCh)
+
+	assert.NoError(t, c.SetConfigRaw([]byte(`{"MockState":1,"MockName":"default"}`)))
+
+	crashed := c.internalClient()
+	l.last().crash()
+
+	assert.Eventually(t, func() bool { return c.internalClient() != crashed }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "default", l.last().driver.MockName)
+
+	s, err := c.GetState()
+	assert.NoError(t, err)
+	assert.Equal(t, state.Running, s)
+	assert.Equal(t, 2, l.launched())
+}
+
+// crashedPlugin is a fakePlugin reporting how it crashed.
+type crashedPlugin struct {
+	*fakePlugin
+}
+
+func (p *crashedPlugin) Crashed() error {
+	return localbinary.ErrPluginCrashed{DriverName: "fake", ExitCode: 2, Status: "exit status 2", Stderr: []string{"panic: nil map"}}
+}
+
+func TestCallWrapsCrashDiagnostics(t *testing.T) {
+	c, l := newReconnectingClientDriver(t, 0)
+	c.plugin = &crashedPlugin{l.last()}
+
+	l.last().crash()
+
+	err := c.Create()
+	crash, ok := err.(localbinary.ErrPluginCrashed)
+	assert.True(t, ok, "%s is not a crash", err)
+	assert.Equal(t, []string{"panic: nil map"}, crash.Stderr)
+	assert.True(t, isConnectionError(err), "%s is not a connection error", err)
+}
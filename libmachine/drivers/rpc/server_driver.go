@@ -5,10 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"runtime/debug"
+	"time"
 
 	"github.com/rancher/machine/libmachine/drivers"
 	"github.com/rancher/machine/libmachine/log"
 	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/rancher/machine/libmachine/progress"
+	"github.com/rancher/machine/libmachine/ssh"
 	"github.com/rancher/machine/libmachine/state"
 	"github.com/rancher/machine/libmachine/version"
 )
@@ -120,6 +123,34 @@ func (r *RPCServerDriver) GetCreateFlags(_ *struct{}, reply *[]mcnflag.Flag) err
 	return nil
 }
 
+func (r *RPCServerDriver) Capabilities(_ *struct{}, reply *[]drivers.Capability) error {
+	*reply = drivers.GetCapabilities(r.ActualDriver)
+	return nil
+}
+
+func (r *RPCServerDriver) FlagSchema(_ *struct{}, reply *[]mcnflag.Schema) error {
+	*reply = drivers.GetFlagSchema(r.ActualDriver)
+	return nil
+}
+
+func (r *RPCServerDriver) SupportedArchitectures(_ *struct{}, reply *[]string) error {
+	*reply = drivers.GetSupportedArchitectures(r.ActualDriver)
+	return nil
+}
+
+// ProgressEvents returns the progress events of the machine, waiting up to
+// timeout for one. Without a timeout, it returns the events left and stops
+// holding those of the machine.
+func (r *RPCServerDriver) ProgressEvents(timeout time.Duration, reply *[]progress.Event) error {
+	*reply = ProgressQueue.Poll(r.ActualDriver.GetMachineName(), timeout)
+	return nil
+}
+
+func (r *RPCServerDriver) SetDryRun(dryRun bool, _ *struct{}) error {
+	drivers.SetDryRun(r.ActualDriver, dryRun)
+	return nil
+}
+
 func (r *RPCServerDriver) SetConfigRaw(data []byte, _ *struct{}) error {
 	return json.Unmarshal(data, &r.ActualDriver)
 }
@@ -137,7 +168,7 @@ func (r *RPCServerDriver) Create(_, _ *struct{}) (err error) {
 	// during create.
 	defer trapPanic(&err)
 
-	err = r.ActualDriver.Create()
+	err = encodeError(r.ActualDriver.Create())
 
 	return err
 }
@@ -153,6 +184,76 @@ func (r *RPCServerDriver) GetIP(_ *struct{}, reply *string) error {
 	return err
 }
 
+func (r *RPCServerDriver) GetIPs(_ *struct{}, reply *[]drivers.NetworkAddress) error {
+	addrs, err := drivers.GetIPs(r.ActualDriver)
+	*reply = addrs
+	return err
+}
+
+func (r *RPCServerDriver) GetTags(_ *struct{}, reply *map[string]string) error {
+	tags, err := drivers.GetTags(r.ActualDriver)
+	*reply = tags
+	return err
+}
+
+func (r *RPCServerDriver) CreateSnapshot(name string, reply *drivers.Snapshot) error {
+	snapshot, err := drivers.CreateSnapshot(r.ActualDriver, name)
+	*reply = snapshot
+	return encodeError(err)
+}
+
+func (r *RPCServerDriver) ListSnapshots(_ *struct{}, reply *[]drivers.Snapshot) error {
+	snapshots, err := drivers.ListSnapshots(r.ActualDriver)
+	*reply = snapshots
+	return encodeError(err)
+}
+
+func (r *RPCServerDriver) RestoreSnapshot(id string, _ *struct{}) error {
+	return encodeError(drivers.RestoreSnapshot(r.ActualDriver, id))
+}
+
+func (r *RPCServerDriver) PreCreatePlan(_ *struct{}, reply *[]drivers.PlannedResource) error {
+	resources, err := drivers.PreCreatePlan(r.ActualDriver)
+	*reply = resources
+	return encodeError(err)
+}
+
+func (r *RPCServerDriver) EstimateCost(_ *struct{}, reply *drivers.CostEstimate) error {
+	estimate, err := drivers.EstimateCost(r.ActualDriver)
+	if estimate != nil {
+		*reply = *estimate
+	}
+	return encodeError(err)
+}
+
+func (r *RPCServerDriver) Resize(spec *drivers.ResizeSpec, _ *struct{}) error {
+	return encodeError(drivers.Resize(r.ActualDriver, *spec))
+}
+
+// GetSSHBastion replies the bastion of the driver, or a zero one without a
+// host if it has none, since gob cannot encode nil pointers.
+func (r *RPCServerDriver) GetSSHBastion(_ *struct{}, reply *ssh.Bastion) error {
+	bastion, err := drivers.GetSSHBastion(r.ActualDriver)
+	if bastion != nil {
+		*reply = *bastion
+	}
+	return err
+}
+
+// GetSSHPassword replies the password authentication of the driver.
+func (r *RPCServerDriver) GetSSHPassword(_ *struct{}, reply *drivers.SSHPassword) error {
+	password, err := drivers.GetSSHPassword(r.ActualDriver)
+	*reply = password
+	return err
+}
+
+// GetSSHRetryPolicy replies the SSH retry policy of the driver.
+func (r *RPCServerDriver) GetSSHRetryPolicy(_ *struct{}, reply *ssh.RetryPolicy) error {
+	policy, err := drivers.GetSSHRetryPolicy(r.ActualDriver)
+	*reply = policy
+	return err
+}
+
 func (r *RPCServerDriver) GetMachineName(_ *struct{}, reply *string) error {
 	*reply = r.ActualDriver.GetMachineName()
 	return nil
@@ -190,35 +291,35 @@ func (r *RPCServerDriver) GetURL(_ *struct{}, reply *string) error {
 func (r *RPCServerDriver) GetState(_ *struct{}, reply *state.State) error {
 	s, err := r.ActualDriver.GetState()
 	*reply = s
-	return err
+	return encodeError(err)
 }
 
 func (r *RPCServerDriver) Kill(_ *struct{}, _ *struct{}) error {
-	return r.ActualDriver.Kill()
+	return encodeError(r.ActualDriver.Kill())
 }
 
 func (r *RPCServerDriver) PreCreateCheck(_ *struct{}, _ *struct{}) error {
-	return r.ActualDriver.PreCreateCheck()
+	return encodeError(r.ActualDriver.PreCreateCheck())
 }
 
 func (r *RPCServerDriver) Remove(_ *struct{}, _ *struct{}) error {
-	return r.ActualDriver.Remove()
+	return encodeError(r.ActualDriver.Remove())
 }
 
 func (r *RPCServerDriver) Restart(_ *struct{}, _ *struct{}) error {
-	return r.ActualDriver.Restart()
+	return encodeError(r.ActualDriver.Restart())
 }
 
 func (r *RPCServerDriver) SetConfigFromFlags(flags *drivers.DriverOptions, _ *struct{}) error {
-	return r.ActualDriver.SetConfigFromFlags(*flags)
+	return encodeError(r.ActualDriver.SetConfigFromFlags(*flags))
 }
 
 func (r *RPCServerDriver) Start(_ *struct{}, _ *struct{}) error {
-	return r.ActualDriver.Start()
+	return encodeError(r.ActualDriver.Start())
 }
 
 func (r *RPCServerDriver) Stop(_ *struct{}, _ *struct{}) error {
-	return r.ActualDriver.Stop()
+	return encodeError(r.ActualDriver.Stop())
 }
 
 func (r *RPCServerDriver) Heartbeat(_ *struct{}, _ *struct{}) error {
@@ -3,8 +3,12 @@ package rpcdriver
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/rancher/machine/drivers/fakedriver"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/ssh"
+	"github.com/rancher/machine/libmachine/state"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -14,6 +18,15 @@ type panicDriver struct {
 	returnErr error
 }
 
+type passwordDriver struct {
+	*fakedriver.Driver
+	password drivers.SSHPassword
+}
+
+func (p *passwordDriver) GetSSHPassword() (drivers.SSHPassword, error) {
+	return p.password, nil
+}
+
 type FakeStacker struct {
 	trace []byte
 }
@@ -73,3 +86,64 @@ func TestRPCServerDriverCreate(t *testing.T) {
 		assert.Equal(t, tc.expectedErr, tc.serverDriver.Create(nil, nil))
 	}
 }
+
+func TestRPCServerDriverGetIPs(t *testing.T) {
+	single := &fakedriver.Driver{MockState: state.Running, MockIP: "1.2.3.4"}
+	multi := &fakedriver.NetworkDriver{
+		Driver: &fakedriver.Driver{MockState: state.Running},
+		MockIPs: []drivers.NetworkAddress{
+			{Kind: drivers.AddressPublic, Address: "1.2.3.4"},
+			{Kind: drivers.AddressPrivate, Address: "10.0.0.4"},
+		},
+	}
+
+	var addrs []drivers.NetworkAddress
+	assert.Equal(t, drivers.ErrAddressKindsNotReported, NewRPCServerDriver(single).GetIPs(nil, &addrs))
+	assert.Empty(t, addrs)
+
+	assert.NoError(t, NewRPCServerDriver(multi).GetIPs(nil, &addrs))
+	assert.Equal(t, multi.MockIPs, addrs)
+}
+
+func TestRPCServerDriverGetSSHBastion(t *testing.T) {
+	direct := &fakedriver.Driver{BaseDriver: &drivers.BaseDriver{}}
+	jump := &fakedriver.Driver{BaseDriver: &drivers.BaseDriver{SSHBastionHost: "bastion.example.com"}}
+
+	var bastion ssh.Bastion
+	assert.NoError(t, NewRPCServerDriver(direct).GetSSHBastion(nil, &bastion))
+	assert.Empty(t, bastion.Host)
+
+	assert.NoError(t, NewRPCServerDriver(jump).GetSSHBastion(nil, &bastion))
+	assert.Equal(t, "bastion.example.com", bastion.Host)
+	assert.Equal(t, 22, bastion.Port)
+}
+
+func TestRPCServerDriverGetSSHPassword(t *testing.T) {
+	keyOnly := &fakedriver.Driver{BaseDriver: &drivers.BaseDriver{}}
+	appliance := &passwordDriver{Driver: keyOnly, password: drivers.SSHPassword{Password: "admin"}}
+
+	var password drivers.SSHPassword
+	assert.NoError(t, NewRPCServerDriver(keyOnly).GetSSHPassword(nil, &password))
+	assert.False(t, password.IsSet())
+
+	assert.NoError(t, NewRPCServerDriver(appliance).GetSSHPassword(nil, &password))
+	assert.Equal(t, drivers.SSHPassword{Password: "admin"}, password)
+}
+
+func TestRPCServerDriverGetSSHRetryPolicy(t *testing.T) {
+	d := &fakedriver.Driver{BaseDriver: &drivers.BaseDriver{}}
+
+	var policy ssh.RetryPolicy
+	assert.NoError(t, NewRPCServerDriver(d).GetSSHRetryPolicy(nil, &policy))
+	assert.Equal(t, ssh.DefaultRetryPolicy, policy)
+
+	d.SSHRetryPolicy = &ssh.RetryPolicy{Interval: time.Second, Multiplier: 2, MaxInterval: time.Minute, Timeout: 20 * time.Minute}
+	assert.NoError(t, NewRPCServerDriver(d).GetSSHRetryPolicy(nil, &policy))
+	assert.Equal(t, *d.SSHRetryPolicy, policy)
+}
+
+func TestIsMethodNotFound(t *testing.T) {
+	assert.True(t, isMethodNotFound(errors.New("rpc: can't find method RPCServerDriver.GetIPs")))
+	assert.False(t, isMethodNotFound(errors.New("connection refused")))
+	assert.False(t, isMethodNotFound(nil))
+}
@@ -8,8 +8,15 @@ import (
 	"github.com/rancher/machine/libmachine/mcnflag"
 )
 
-// GetDriverOpts converts driver flags into RPCFlags.
-func GetDriverOpts(flags []mcnflag.Flag, args []string) *RPCFlags {
+// isMethodNotFound reports whether err is the net/rpc error returned when
+// calling a method an older plugin does not serve.
+func isMethodNotFound(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "rpc: can't find method")
+}
+
+// GetDriverOpts converts driver flags into RPCFlags. It fails on the string
+// flags whose value cannot be resolved, see resolveStringFlag.
+func GetDriverOpts(flags []mcnflag.Flag, args []string) (*RPCFlags, error) {
 	allFlags := getAllFlags(args)
 	foundFlags := make(map[string]any)
 
@@ -30,6 +37,9 @@ func GetDriverOpts(flags []mcnflag.Flag, args []string) *RPCFlags {
 				defaultValue = flag.Value
 			}
 			setFlag(flag.Name, flag.EnvVar, defaultValue, allFlags, foundFlags, toString)
+			if err := resolveStringFlag(flag.Name, allFlags, foundFlags); err != nil {
+				return nil, err
+			}
 
 		case mcnflag.StringFlag:
 			flag := f.(mcnflag.StringFlag)
@@ -38,6 +48,9 @@ func GetDriverOpts(flags []mcnflag.Flag, args []string) *RPCFlags {
 				defaultValue = flag.Value
 			}
 			setFlag(flag.Name, flag.EnvVar, defaultValue, allFlags, foundFlags, toString)
+			if err := resolveStringFlag(flag.Name, allFlags, foundFlags); err != nil {
+				return nil, err
+			}
 
 		case *mcnflag.IntFlag:
 			flag := f.(*mcnflag.IntFlag)
@@ -65,7 +78,7 @@ func GetDriverOpts(flags []mcnflag.Flag, args []string) *RPCFlags {
 		}
 	}
 
-	return &RPCFlags{Values: foundFlags}
+	return &RPCFlags{Values: foundFlags}, nil
 }
 
 // getAllFlags retrieves all flags present in args. These flags are identified by their prefix, which can be "-" or
@@ -132,6 +145,25 @@ func toStringSlice(v any) any {
 	return nil
 }
 
+// resolveStringFlag applies the --<name>-file, MACHINE_DRIVER_<NAME>_FILE and
+// ref+env:// indirections to the value of a string flag. A value that cannot
+// be resolved is an error, so that it is never mistaken for the secret itself.
+func resolveStringFlag(name string, allFlags map[string]any, foundFlags map[string]any) error {
+	filePath, _ := allFlags[mcnflag.FileFlagName(name)].(string)
+	value, found := foundFlags[name].(string)
+	if !found && filePath == "" && os.Getenv(mcnflag.FileEnvVar(name)) == "" {
+		return nil
+	}
+
+	resolved, err := mcnflag.ResolveStringValue(name, value, filePath)
+	if err != nil {
+		return err
+	}
+
+	foundFlags[name] = resolved
+	return nil
+}
+
 func setFlag(
 	name, envvar string,
 	defaultValue any,
@@ -1,6 +1,8 @@
 package rpcdriver
 
 import (
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -47,6 +49,39 @@ func TestGetDriverOpts(t *testing.T) {
 		"bool-value":                 true,
 	}
 
-	result := GetDriverOpts(flags, args)
+	result, err := GetDriverOpts(flags, args)
+	assert.NoError(t, err)
 	assert.True(t, reflect.DeepEqual(expected, result.Values))
 }
+
+func TestGetDriverOptsIndirectValues(t *testing.T) {
+	secretPath := filepath.Join(t.TempDir(), "secret")
+	assert.NoError(t, os.WriteFile(secretPath, []byte("s3cr3t\n"), 0600))
+	t.Setenv("TEST_DRIVER_TOKEN", "token-from-env")
+
+	flags := []mcnflag.Flag{
+		mcnflag.StringFlag{Name: "secret", Sensitive: true},
+		mcnflag.StringFlag{Name: "token"},
+	}
+	args := []string{"create", "--secret-file", secretPath, "--token=ref+env://TEST_DRIVER_TOKEN"}
+
+	result, err := GetDriverOpts(flags, args)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"secret": "s3cr3t",
+		"token":  "token-from-env",
+	}, result.Values)
+}
+
+func TestGetDriverOptsUnresolvableValues(t *testing.T) {
+	flags := []mcnflag.Flag{
+		mcnflag.StringFlag{Name: "secret", Sensitive: true},
+	}
+
+	_, err := GetDriverOpts(flags, []string{"create", "--secret-file", filepath.Join(t.TempDir(), "missing")})
+	assert.Error(t, err)
+
+	_, err = GetDriverOpts(flags, []string{"create", "--secret", "ref+env://TEST_DRIVER_UNSET"})
+	assert.Error(t, err)
+}
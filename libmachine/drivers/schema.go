@@ -0,0 +1,22 @@
+package drivers
+
+import "github.com/rancher/machine/libmachine/mcnflag"
+
+// DriverWithFlagSchema is implemented by drivers that describe their create
+// flags themselves, like plugins, which describe the flags of types only
+// they know.
+type DriverWithFlagSchema interface {
+	Driver
+
+	// FlagSchema returns the schema of the create flags.
+	FlagSchema() []mcnflag.Schema
+}
+
+// GetFlagSchema returns the schema of the create flags of d.
+func GetFlagSchema(d Driver) []mcnflag.Schema {
+	if sd, ok := d.(DriverWithFlagSchema); ok {
+		return sd.FlagSchema()
+	}
+
+	return mcnflag.DescribeFlags(d.GetCreateFlags())
+}
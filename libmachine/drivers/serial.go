@@ -2,10 +2,12 @@ package drivers
 
 import (
 	"sync"
+	"time"
 
 	"encoding/json"
 
 	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/rancher/machine/libmachine/ssh"
 	"github.com/rancher/machine/libmachine/state"
 )
 
@@ -36,6 +38,40 @@ func newSerialDriverWithLock(innerDriver Driver, lock sync.Locker) Driver {
 	}
 }
 
+// Capabilities returns the capabilities supported by the driver
+func (d *SerialDriver) Capabilities() []Capability {
+	d.Lock()
+	defer d.Unlock()
+	return GetCapabilities(d.Driver)
+}
+
+// SupportedArchitectures returns the architectures supported by the driver
+func (d *SerialDriver) SupportedArchitectures() []string {
+	d.Lock()
+	defer d.Unlock()
+	return GetSupportedArchitectures(d.Driver)
+}
+
+// FlagSchema returns the schema of the create flags of the driver
+func (d *SerialDriver) FlagSchema() []mcnflag.Schema {
+	d.Lock()
+	defer d.Unlock()
+	return GetFlagSchema(d.Driver)
+}
+
+// SetDryRun enables or disables the side effects of PreCreateCheck
+func (d *SerialDriver) SetDryRun(dryRun bool) {
+	d.Lock()
+	defer d.Unlock()
+	SetDryRun(d.Driver, dryRun)
+}
+
+// Health returns the health of the plugin of the driver. It does not wait
+// for the other calls, which a hung plugin would hold.
+func (d *SerialDriver) Health() (time.Time, error) {
+	return GetHealth(d.Driver)
+}
+
 // Create a host using the driver's config
 func (d *SerialDriver) Create() error {
 	d.Lock()
@@ -66,6 +102,69 @@ func (d *SerialDriver) GetIP() (string, error) {
 	return d.Driver.GetIP()
 }
 
+// CreateSnapshot snapshots the machine
+func (d *SerialDriver) CreateSnapshot(name string) (Snapshot, error) {
+	d.Lock()
+	defer d.Unlock()
+	return CreateSnapshot(d.Driver, name)
+}
+
+// ListSnapshots returns the snapshots of the machine
+func (d *SerialDriver) ListSnapshots() ([]Snapshot, error) {
+	d.Lock()
+	defer d.Unlock()
+	return ListSnapshots(d.Driver)
+}
+
+// RestoreSnapshot restores the machine from a snapshot
+func (d *SerialDriver) RestoreSnapshot(id string) error {
+	d.Lock()
+	defer d.Unlock()
+	return RestoreSnapshot(d.Driver, id)
+}
+
+// EstimateCost returns the price of the machine
+func (d *SerialDriver) EstimateCost() (*CostEstimate, error) {
+	d.Lock()
+	defer d.Unlock()
+	return EstimateCost(d.Driver)
+}
+
+// PreCreatePlan returns the resources Create would create
+func (d *SerialDriver) PreCreatePlan() ([]PlannedResource, error) {
+	d.Lock()
+	defer d.Unlock()
+	return PreCreatePlan(d.Driver)
+}
+
+// Resize changes the size of the machine
+func (d *SerialDriver) Resize(spec ResizeSpec) error {
+	d.Lock()
+	defer d.Unlock()
+	return Resize(d.Driver, spec)
+}
+
+// GetTags returns the tags of the resources of the machine
+func (d *SerialDriver) GetTags() (map[string]string, error) {
+	d.Lock()
+	defer d.Unlock()
+	return GetTags(d.Driver)
+}
+
+// GetIPs returns every known address of the machine, labeled by kind
+func (d *SerialDriver) GetIPs() ([]NetworkAddress, error) {
+	d.Lock()
+	defer d.Unlock()
+	return GetIPs(d.Driver)
+}
+
+// GetSSHBastion returns the bastion the SSH connections go through, if any
+func (d *SerialDriver) GetSSHBastion() (*ssh.Bastion, error) {
+	d.Lock()
+	defer d.Unlock()
+	return GetSSHBastion(d.Driver)
+}
+
 // GetMachineName returns the name of the machine
 func (d *SerialDriver) GetMachineName() string {
 	d.Lock()
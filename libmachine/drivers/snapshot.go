@@ -0,0 +1,65 @@
+package drivers
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrSnapshotsNotSupported is returned by the snapshot operations of drivers
+// that do not implement DriverWithSnapshots.
+var ErrSnapshotsNotSupported = errors.New("driver does not support snapshots")
+
+// Snapshot is a saved state of the disks of a machine.
+type Snapshot struct {
+	// ID identifies the snapshot to RestoreSnapshot.
+	ID      string
+	Name    string
+	Created time.Time
+}
+
+// DriverWithSnapshots is implemented by drivers that can snapshot the disks
+// of the machine and restore them. They declare CapabilitySnapshots.
+type DriverWithSnapshots interface {
+	Driver
+
+	// CreateSnapshot snapshots the machine under the name.
+	CreateSnapshot(name string) (Snapshot, error)
+
+	// ListSnapshots returns the snapshots of the machine, oldest first.
+	ListSnapshots() ([]Snapshot, error)
+
+	// RestoreSnapshot restores the disks of the machine from the snapshot of
+	// the ID, which some drivers require the machine to be stopped for.
+	RestoreSnapshot(id string) error
+}
+
+// CreateSnapshot snapshots the machine driven by d. It returns
+// ErrSnapshotsNotSupported if d does not implement DriverWithSnapshots.
+func CreateSnapshot(d Driver, name string) (Snapshot, error) {
+	if sd, ok := d.(DriverWithSnapshots); ok {
+		return sd.CreateSnapshot(name)
+	}
+
+	return Snapshot{}, ErrSnapshotsNotSupported
+}
+
+// ListSnapshots returns the snapshots of the machine driven by d. It returns
+// ErrSnapshotsNotSupported if d does not implement DriverWithSnapshots.
+func ListSnapshots(d Driver) ([]Snapshot, error) {
+	if sd, ok := d.(DriverWithSnapshots); ok {
+		return sd.ListSnapshots()
+	}
+
+	return nil, ErrSnapshotsNotSupported
+}
+
+// RestoreSnapshot restores the machine driven by d from a snapshot. It
+// returns ErrSnapshotsNotSupported if d does not implement
+// DriverWithSnapshots.
+func RestoreSnapshot(d Driver, id string) error {
+	if sd, ok := d.(DriverWithSnapshots); ok {
+		return sd.RestoreSnapshot(id)
+	}
+
+	return ErrSnapshotsNotSupported
+}
@@ -0,0 +1,74 @@
+package drivers
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/rancher/machine/libmachine/ssh"
+)
+
+// sshCertAuthorities maps the names of the machines to the SSH certificate
+// authorities of their connections.
+var sshCertAuthorities = struct {
+	sync.RWMutex
+	userSigners map[string]ssh.UserCertSigner
+	hostCAs     map[string]*ssh.HostCA
+}{userSigners: map[string]ssh.UserCertSigner{}, hostCAs: map[string]*ssh.HostCA{}}
+
+// SetSSHCertAuthorities makes the SSH connections to the named machine
+// authenticate with certificates signed by userSigner, and accept the host
+// key certificates signed by hostCA only, when they are not nil.
+func SetSSHCertAuthorities(machineName string, userSigner ssh.UserCertSigner, hostCA *ssh.HostCA) {
+	sshCertAuthorities.Lock()
+	defer sshCertAuthorities.Unlock()
+	sshCertAuthorities.userSigners[machineName] = userSigner
+	sshCertAuthorities.hostCAs[machineName] = hostCA
+}
+
+func sshHostCAOf(machineName string) *ssh.HostCA {
+	sshCertAuthorities.RLock()
+	defer sshCertAuthorities.RUnlock()
+	return sshCertAuthorities.hostCAs[machineName]
+}
+
+// RenewSSHUserCert signs the key of the machine of d for its SSH user, if the
+// machine has a user CA, unless its certificate is valid for a while still.
+func RenewSSHUserCert(d Driver) error {
+	sshCertAuthorities.RLock()
+	signer := sshCertAuthorities.userSigners[d.GetMachineName()]
+	sshCertAuthorities.RUnlock()
+
+	if signer == nil {
+		return nil
+	}
+
+	// The key is only generated once the machine is created.
+	keyPath := d.GetSSHKeyPath()
+	if _, err := os.Stat(keyPath); err != nil {
+		return nil
+	}
+
+	if err := ssh.RenewUserCert(signer, keyPath, d.GetMachineName(), d.GetSSHUsername()); err != nil {
+		return fmt.Errorf("Error signing the SSH key of %s: %s", d.GetMachineName(), err)
+	}
+	return nil
+}
+
+// VerifySSHHostCert makes client accept the host key certificates signed by
+// the host CA of the machine of d only, if it has one.
+func VerifySSHHostCert(d Driver, client ssh.Client) error {
+	hostCA := sshHostCAOf(d.GetMachineName())
+	if hostCA == nil {
+		return nil
+	}
+
+	verifying, ok := client.(ssh.HostCertVerifyingClient)
+	if !ok {
+		return fmt.Errorf("the SSH client of %s cannot verify host certificates", d.GetMachineName())
+	}
+	if err := verifying.VerifyHostCert(hostCA); err != nil {
+		return fmt.Errorf("Error verifying the SSH host certificate of %s: %s", d.GetMachineName(), err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package drivers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/ssh"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenewSSHUserCert(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "id_rsa")
+	d := &MockDriver{calls: &CallRecorder{}, machineName: "signed", sshKeyPath: keyPath, sshUsername: "docker"}
+
+	assert.NoError(t, ssh.GenerateSSHKey(filepath.Join(dir, "user-ca")))
+	SetSSHCertAuthorities("signed", &ssh.FileUserCertSigner{KeyPath: filepath.Join(dir, "user-ca")}, nil)
+	t.Cleanup(func() { SetSSHCertAuthorities("signed", nil, nil) })
+
+	// The key is not generated yet.
+	assert.NoError(t, RenewSSHUserCert(d))
+	assert.NoFileExists(t, ssh.UserCertPath(keyPath))
+
+	assert.NoError(t, ssh.GenerateSSHKey(keyPath))
+	assert.NoError(t, RenewSSHUserCert(d))
+	assert.FileExists(t, ssh.UserCertPath(keyPath))
+}
+
+func TestVerifySSHHostCert(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, ssh.GenerateSSHKey(filepath.Join(dir, "host-ca")))
+	d := &MockDriver{calls: &CallRecorder{}, machineName: "certified"}
+
+	VerifySSHHostKeys("certified", filepath.Join(dir, "certified", ssh.KnownHostsFile))
+	SetSSHCertAuthorities("certified", nil, &ssh.HostCA{
+		KeyPath:        filepath.Join(dir, "host-ca.pub"),
+		KnownHostsPath: filepath.Join(dir, "certified", ssh.HostCAKnownHostsFile),
+	})
+	t.Cleanup(func() { SetSSHCertAuthorities("certified", nil, nil) })
+
+	client := &ssh.ExternalClient{BaseArgs: []string{"-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null", "docker@localhost"}}
+	VerifySSHHostKey(d, client)
+	assert.NoError(t, VerifySSHHostCert(d, client))
+
+	// The host CA verifies the host key, not the known_hosts file.
+	assert.Equal(t, []string{"-o", "StrictHostKeyChecking=yes", "-o", `UserKnownHostsFile="` + filepath.Join(dir, "certified", ssh.HostCAKnownHostsFile) + `"`, "docker@localhost"}, client.BaseArgs)
+	_, err := os.Stat(filepath.Join(dir, "certified", ssh.HostCAKnownHostsFile))
+	assert.NoError(t, err)
+}
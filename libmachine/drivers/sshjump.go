@@ -0,0 +1,102 @@
+package drivers
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rancher/machine/libmachine/ssh"
+)
+
+const (
+	// SSHJumpHostsFlag is the create flag giving the comma-separated jump
+	// hosts, in the [user@]host[:port] form, the SSH connections to the
+	// machine go through, in order, for the drivers supporting them.
+	SSHJumpHostsFlag = "ssh-jump-hosts"
+	// SSHJumpKeyFlag is the create flag giving the private key of the jump
+	// hosts. Without one, they authenticate with the ssh-agent.
+	SSHJumpKeyFlag = "ssh-jump-key"
+)
+
+// ParseSSHJumpHost parses a jump host in the [user@]host[:port] form of the
+// ProxyJump option of OpenSSH. The user defaults to root and the port to 22.
+func ParseSSHJumpHost(jumpHost string) (*ssh.Bastion, error) {
+	bastion := &ssh.Bastion{
+		User: DefaultSSHUser,
+		Port: DefaultSSHPort,
+		Auth: &ssh.Auth{},
+	}
+
+	address := jumpHost
+	if user, rest, ok := strings.Cut(jumpHost, "@"); ok {
+		bastion.User, address = user, rest
+	}
+
+	bastion.Host = address
+	if host, port, err := net.SplitHostPort(address); err == nil {
+		p, err := strconv.Atoi(port)
+		if err != nil || p <= 0 || p > 65535 {
+			return nil, fmt.Errorf("invalid port %q of the jump host %q", port, jumpHost)
+		}
+		bastion.Host, bastion.Port = host, p
+	}
+
+	if bastion.User == "" || bastion.Host == "" || strings.ContainsAny(bastion.Host, "@/ ") {
+		return nil, fmt.Errorf("invalid jump host %q, must be [user@]host[:port]", jumpHost)
+	}
+	return bastion, nil
+}
+
+// SetSSHJumpHostsFromFlags sets the jump hosts of the machine from the
+// --ssh-jump-hosts and --ssh-jump-key flags.
+func (d *BaseDriver) SetSSHJumpHostsFromFlags(flags DriverOptions) error {
+	var jumpHosts []string
+	if value := flags.String(SSHJumpHostsFlag); value != "" {
+		for _, jumpHost := range strings.Split(value, ",") {
+			jumpHost = strings.TrimSpace(jumpHost)
+			if _, err := ParseSSHJumpHost(jumpHost); err != nil {
+				return err
+			}
+			jumpHosts = append(jumpHosts, jumpHost)
+		}
+	}
+
+	keyPath := flags.String(SSHJumpKeyFlag)
+	if keyPath != "" {
+		if len(jumpHosts) == 0 {
+			return fmt.Errorf("--%s requires the --%s option", SSHJumpKeyFlag, SSHJumpHostsFlag)
+		}
+		if _, err := os.Stat(keyPath); os.IsNotExist(err) {
+			return fmt.Errorf("SSH jump key does not exist: %q", keyPath)
+		}
+		abs, err := filepath.Abs(keyPath)
+		if err != nil {
+			return err
+		}
+		keyPath = abs
+	}
+
+	d.SSHJumpHosts = jumpHosts
+	d.SSHJumpKeyPath = keyPath
+	return nil
+}
+
+// sshJumpBastions returns the bastions of the jump hosts of the machine, in
+// order.
+func (d *BaseDriver) sshJumpBastions() ([]*ssh.Bastion, error) {
+	bastions := make([]*ssh.Bastion, 0, len(d.SSHJumpHosts))
+	for _, jumpHost := range d.SSHJumpHosts {
+		bastion, err := ParseSSHJumpHost(jumpHost)
+		if err != nil {
+			return nil, err
+		}
+		if d.SSHJumpKeyPath != "" {
+			bastion.Auth.Keys = []string{d.SSHJumpKeyPath}
+		}
+		bastions = append(bastions, bastion)
+	}
+	return bastions, nil
+}
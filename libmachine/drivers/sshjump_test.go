@@ -0,0 +1,90 @@
+package drivers
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/rancher/machine/libmachine/ssh"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSSHJumpHost(t *testing.T) {
+	for jumpHost, expected := range map[string]*ssh.Bastion{
+		"bastion.example.com":           {User: "root", Host: "bastion.example.com", Port: 22, Auth: &ssh.Auth{}},
+		"jump@bastion.example.com:2222": {User: "jump", Host: "bastion.example.com", Port: 2222, Auth: &ssh.Auth{}},
+		"jump@[2001:db8::1]:2222":       {User: "jump", Host: "2001:db8::1", Port: 2222, Auth: &ssh.Auth{}},
+		"2001:db8::1":                   {User: "root", Host: "2001:db8::1", Port: 22, Auth: &ssh.Auth{}},
+		"jump@10.0.0.4":                 {User: "jump", Host: "10.0.0.4", Port: 22, Auth: &ssh.Auth{}},
+	} {
+		bastion, err := ParseSSHJumpHost(jumpHost)
+		assert.NoError(t, err, jumpHost)
+		assert.Equal(t, expected, bastion, jumpHost)
+	}
+
+	for _, jumpHost := range []string{"", "jump@", "@bastion", "bastion:0", "bastion:ssh", "a@b@c"} {
+		_, err := ParseSSHJumpHost(jumpHost)
+		assert.Error(t, err, jumpHost)
+	}
+}
+
+func TestSetSSHJumpHostsFromFlags(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "id_jump")
+	assert.NoError(t, ssh.GenerateSSHKey(keyPath))
+
+	d := &BaseDriver{}
+	flags := &CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			SSHJumpHostsFlag: "jump@outer.example.com, inner.example.com:2222",
+			SSHJumpKeyFlag:   keyPath,
+		},
+		CreateFlags: []mcnflag.Flag{
+			mcnflag.StringFlag{Name: SSHJumpHostsFlag},
+			mcnflag.StringFlag{Name: SSHJumpKeyFlag},
+		},
+	}
+
+	assert.NoError(t, d.SetSSHJumpHostsFromFlags(flags))
+	assert.Equal(t, []string{"jump@outer.example.com", "inner.example.com:2222"}, d.SSHJumpHosts)
+	assert.Equal(t, keyPath, d.SSHJumpKeyPath)
+
+	flags.FlagsValues[SSHJumpHostsFlag] = "jump@"
+	assert.Error(t, d.SetSSHJumpHostsFromFlags(flags))
+
+	flags.FlagsValues[SSHJumpHostsFlag] = ""
+	assert.EqualError(t, d.SetSSHJumpHostsFromFlags(flags), "--ssh-jump-key requires the --ssh-jump-hosts option")
+
+	flags.FlagsValues[SSHJumpKeyFlag] = ""
+	assert.NoError(t, d.SetSSHJumpHostsFromFlags(flags))
+	assert.Empty(t, d.SSHJumpHosts)
+}
+
+func TestGetSSHBastionChainsJumpHosts(t *testing.T) {
+	d := &BaseDriver{
+		SSHJumpHosts:   []string{"jump@outer.example.com", "inner.example.com:2222"},
+		SSHJumpKeyPath: "/keys/id_jump",
+		SSHBastionHost: "bastion.example.com",
+	}
+
+	bastion, err := d.GetSSHBastion()
+	assert.NoError(t, err)
+
+	// The bastion connects to the machine, through the jump hosts.
+	assert.Equal(t, "bastion.example.com", bastion.Host)
+	assert.Empty(t, bastion.Auth.Keys)
+	assert.Equal(t, "inner.example.com", bastion.Via.Host)
+	assert.Equal(t, 2222, bastion.Via.Port)
+	assert.Equal(t, []string{"/keys/id_jump"}, bastion.Via.Auth.Keys)
+	assert.Equal(t, "jump@outer.example.com", bastion.Via.Via.User+"@"+bastion.Via.Via.Host)
+	assert.Nil(t, bastion.Via.Via.Via)
+
+	d.SSHBastionHost = ""
+	bastion, err = d.GetSSHBastion()
+	assert.NoError(t, err)
+	assert.Equal(t, "inner.example.com", bastion.Host)
+
+	d.SSHJumpHosts = nil
+	bastion, err = d.GetSSHBastion()
+	assert.NoError(t, err)
+	assert.Nil(t, bastion)
+}
@@ -0,0 +1,45 @@
+package drivers
+
+import (
+	"fmt"
+
+	"github.com/rancher/machine/libmachine/fips"
+	"github.com/rancher/machine/libmachine/ssh"
+)
+
+// SSHKeyTypeFlag is the create flag giving the type of the SSH key generated
+// for the machine, by the drivers supporting it.
+const SSHKeyTypeFlag = "ssh-key-type"
+
+// SetSSHKeyTypeFromFlags sets the type of the SSH key generated for the
+// machine from the --ssh-key-type flag, failing for the types the
+// cloud of the driver does not accept, when it does not accept all of them.
+func (d *BaseDriver) SetSSHKeyTypeFromFlags(flags DriverOptions, supported ...ssh.KeyType) error {
+	keyType, err := ssh.ParseKeyType(flags.String(SSHKeyTypeFlag))
+	if err != nil {
+		return err
+	}
+
+	if fips.Enabled() && keyType == ssh.KeyTypeEd25519 {
+		return fmt.Errorf("--%s=%s is not FIPS-approved, use rsa or ecdsa", SSHKeyTypeFlag, keyType)
+	}
+
+	if len(supported) > 0 {
+		ok := false
+		for _, s := range supported {
+			ok = ok || s == keyType
+		}
+		if !ok {
+			return fmt.Errorf("--%s=%s is not supported by the driver, use one of %v", SSHKeyTypeFlag, keyType, supported)
+		}
+	}
+
+	d.SSHKeyType = keyType
+	return nil
+}
+
+// GenerateSSHKey generates the SSH key pair of the machine at path, of the
+// type set from the flags.
+func (d *BaseDriver) GenerateSSHKey(path string) error {
+	return ssh.GenerateSSHKeyOfType(path, d.SSHKeyType)
+}
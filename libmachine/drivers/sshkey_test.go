@@ -0,0 +1,45 @@
+package drivers
+
+import (
+	"testing"
+
+	"github.com/rancher/machine/libmachine/fips"
+	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/rancher/machine/libmachine/ssh"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetSSHKeyTypeFromFlags(t *testing.T) {
+	d := &BaseDriver{}
+	flags := &CheckDriverOptions{
+		FlagsValues: map[string]interface{}{SSHKeyTypeFlag: "ed25519"},
+		CreateFlags: []mcnflag.Flag{mcnflag.StringFlag{Name: SSHKeyTypeFlag}},
+	}
+
+	assert.NoError(t, d.SetSSHKeyTypeFromFlags(flags))
+	assert.Equal(t, ssh.KeyTypeEd25519, d.SSHKeyType)
+
+	flags.FlagsValues[SSHKeyTypeFlag] = "ecdsa"
+	assert.EqualError(t, d.SetSSHKeyTypeFromFlags(flags, ssh.KeyTypeRSA, ssh.KeyTypeEd25519), "--ssh-key-type=ecdsa is not supported by the driver, use one of [rsa ed25519]")
+
+	flags.FlagsValues[SSHKeyTypeFlag] = "dsa"
+	assert.Error(t, d.SetSSHKeyTypeFromFlags(flags))
+
+	flags.FlagsValues[SSHKeyTypeFlag] = ""
+	assert.NoError(t, d.SetSSHKeyTypeFromFlags(flags))
+	assert.Equal(t, ssh.KeyTypeRSA, d.SSHKeyType)
+}
+
+func TestSetSSHKeyTypeFromFlagsFIPS(t *testing.T) {
+	t.Setenv(fips.EnvVar, "1")
+
+	d := &BaseDriver{}
+	flags := &CheckDriverOptions{
+		FlagsValues: map[string]interface{}{SSHKeyTypeFlag: "ed25519"},
+		CreateFlags: []mcnflag.Flag{mcnflag.StringFlag{Name: SSHKeyTypeFlag}},
+	}
+	assert.EqualError(t, d.SetSSHKeyTypeFromFlags(flags), "--ssh-key-type=ed25519 is not FIPS-approved, use rsa or ecdsa")
+
+	flags.FlagsValues[SSHKeyTypeFlag] = "ecdsa"
+	assert.NoError(t, d.SetSSHKeyTypeFromFlags(flags))
+}
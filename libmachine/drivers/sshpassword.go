@@ -0,0 +1,95 @@
+package drivers
+
+import (
+	"os"
+	"sync"
+
+	"github.com/rancher/machine/libmachine/ssh"
+)
+
+// SSHPassword is how the SSH connections to a machine authenticate before
+// its key is installed there, for the appliances the key cannot be injected
+// in beforehand.
+type SSHPassword struct {
+	// Password is the password of the SSH user.
+	Password string
+	// Prompt makes the password be asked on the terminal when there is none.
+	Prompt bool
+}
+
+// IsSet tells whether the SSH connections authenticate with a password.
+func (p SSHPassword) IsSet() bool {
+	return p.Password != "" || p.Prompt
+}
+
+// DriverWithSSHPassword is implemented by drivers of machines reachable with
+// a password until the provisioner installs their SSH key.
+type DriverWithSSHPassword interface {
+	Driver
+
+	// GetSSHPassword returns the password authentication of the machine, a
+	// zero one if it authenticates with its key only.
+	GetSSHPassword() (SSHPassword, error)
+}
+
+// GetSSHPassword returns the password authentication of the machine driven by
+// d, a zero one if d does not implement DriverWithSSHPassword.
+func GetSSHPassword(d Driver) (SSHPassword, error) {
+	if pd, ok := d.(DriverWithSSHPassword); ok {
+		return pd.GetSSHPassword()
+	}
+
+	return SSHPassword{}, nil
+}
+
+// sshKeysInstalled holds the names of the machines whose SSH key was
+// installed, which stop authenticating with a password.
+var sshKeysInstalled = struct {
+	sync.RWMutex
+	names map[string]bool
+}{names: map[string]bool{}}
+
+// SSHKeyInstalled makes the SSH connections to the named machine authenticate
+// with its key only, closing the shared ones authenticated with a password.
+func SSHKeyInstalled(machineName string) {
+	sshKeysInstalled.Lock()
+	sshKeysInstalled.names[machineName] = true
+	sshKeysInstalled.Unlock()
+
+	CloseSSHConnections(machineName)
+}
+
+// GetSSHAuth returns the authentication of the SSH connections to the machine
+// driven by d: its key, and its password until the key is installed.
+func GetSSHAuth(d Driver) (*ssh.Auth, error) {
+	auth := &ssh.Auth{}
+	keyPath := d.GetSSHKeyPath()
+	if keyPath != "" {
+		auth.Keys = []string{keyPath}
+	}
+
+	sshKeysInstalled.RLock()
+	installed := sshKeysInstalled.names[d.GetMachineName()]
+	sshKeysInstalled.RUnlock()
+	if installed {
+		return auth, nil
+	}
+
+	password, err := GetSSHPassword(d)
+	if err != nil {
+		return nil, err
+	}
+	if !password.IsSet() {
+		return auth, nil
+	}
+
+	// The key is only generated once the machine is created.
+	if _, err := os.Stat(keyPath); err != nil {
+		auth.Keys = nil
+	}
+	if password.Password != "" {
+		auth.Passwords = []string{password.Password}
+	}
+	auth.Prompt = password.Prompt
+	return auth, nil
+}
@@ -0,0 +1,55 @@
+package drivers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/ssh"
+	"github.com/stretchr/testify/assert"
+)
+
+type passwordDriver struct {
+	*MockDriver
+	password SSHPassword
+}
+
+func (d *passwordDriver) GetSSHPassword() (SSHPassword, error) {
+	return d.password, nil
+}
+
+func TestGetSSHAuth(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "id_rsa")
+	d := &passwordDriver{
+		MockDriver: &MockDriver{calls: &CallRecorder{}, machineName: "appliance", sshKeyPath: keyPath},
+		password:   SSHPassword{Password: "admin"},
+	}
+
+	// The key is not generated yet.
+	auth, err := GetSSHAuth(d)
+	assert.NoError(t, err)
+	assert.Equal(t, &ssh.Auth{Passwords: []string{"admin"}}, auth)
+
+	assert.NoError(t, os.WriteFile(keyPath, []byte("key"), 0600))
+	auth, err = GetSSHAuth(d)
+	assert.NoError(t, err)
+	assert.Equal(t, &ssh.Auth{Keys: []string{keyPath}, Passwords: []string{"admin"}}, auth)
+
+	SSHKeyInstalled("appliance")
+	t.Cleanup(func() {
+		sshKeysInstalled.Lock()
+		delete(sshKeysInstalled.names, "appliance")
+		sshKeysInstalled.Unlock()
+	})
+	auth, err = GetSSHAuth(d)
+	assert.NoError(t, err)
+	assert.Equal(t, &ssh.Auth{Keys: []string{keyPath}}, auth)
+}
+
+func TestGetSSHAuthWithoutPassword(t *testing.T) {
+	d := &MockDriver{calls: &CallRecorder{}, machineName: "default", sshKeyPath: "/machines/default/id_rsa"}
+
+	auth, err := GetSSHAuth(d)
+	assert.NoError(t, err)
+	assert.Equal(t, &ssh.Auth{Keys: []string{"/machines/default/id_rsa"}}, auth)
+}
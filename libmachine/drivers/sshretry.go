@@ -0,0 +1,94 @@
+package drivers
+
+import (
+	"time"
+
+	"github.com/rancher/machine/libmachine/ssh"
+)
+
+const (
+	// SSHWaitAttemptsFlag is the create flag giving the maximum number of
+	// attempts to connect to the machine over SSH, unlimited but for the
+	// timeout when zero, for the drivers supporting it.
+	SSHWaitAttemptsFlag = "ssh-wait-attempts"
+	// SSHWaitIntervalFlag is the create flag giving the seconds between two
+	// attempts.
+	SSHWaitIntervalFlag = "ssh-wait-interval"
+	// SSHWaitTimeoutFlag is the create flag giving the seconds to wait for
+	// SSH in total, unlimited but for the attempts when zero.
+	SSHWaitTimeoutFlag = "ssh-wait-timeout"
+	// SSHWaitBackoffFlag is the create flag doubling the interval after each
+	// attempt, up to sshWaitMaxInterval.
+	SSHWaitBackoffFlag = "ssh-wait-backoff"
+)
+
+// sshWaitMaxInterval caps the interval doubled by --ssh-wait-backoff.
+const sshWaitMaxInterval = time.Minute
+
+// DriverWithSSHRetryPolicy is implemented by drivers of machines waited for
+// with their own SSH retry policy. BaseDriver implements it from its
+// SSHRetryPolicy field.
+type DriverWithSSHRetryPolicy interface {
+	Driver
+
+	// GetSSHRetryPolicy returns how long to wait for SSH to be available
+	// on the machine.
+	GetSSHRetryPolicy() (ssh.RetryPolicy, error)
+}
+
+// GetSSHRetryPolicy returns how long to wait for SSH to be available on the
+// machine driven by d, ssh.DefaultRetryPolicy if d does not implement
+// DriverWithSSHRetryPolicy or has no policy.
+func GetSSHRetryPolicy(d Driver) (ssh.RetryPolicy, error) {
+	if rd, ok := d.(DriverWithSSHRetryPolicy); ok {
+		policy, err := rd.GetSSHRetryPolicy()
+		if err != nil || policy != (ssh.RetryPolicy{}) {
+			return policy, err
+		}
+	}
+
+	return ssh.DefaultRetryPolicy, nil
+}
+
+// GetSSHRetryPolicy returns the SSH retry policy of the machine, the default
+// one when SSHRetryPolicy is nil.
+func (d *BaseDriver) GetSSHRetryPolicy() (ssh.RetryPolicy, error) {
+	if d.SSHRetryPolicy == nil {
+		return ssh.DefaultRetryPolicy, nil
+	}
+	return *d.SSHRetryPolicy, nil
+}
+
+// SetSSHRetryPolicyFromFlags sets the SSH retry policy of the machine from the
+// --ssh-wait-attempts, --ssh-wait-interval, --ssh-wait-timeout and
+// --ssh-wait-backoff flags.
+func (d *BaseDriver) SetSSHRetryPolicyFromFlags(flags DriverOptions) error {
+	policy := ssh.RetryPolicy{
+		MaxAttempts: flags.Int(SSHWaitAttemptsFlag),
+		Interval:    time.Duration(flags.Int(SSHWaitIntervalFlag)) * time.Second,
+		Timeout:     time.Duration(flags.Int(SSHWaitTimeoutFlag)) * time.Second,
+	}
+	if flags.Bool(SSHWaitBackoffFlag) {
+		policy.Multiplier = 2
+		policy.MaxInterval = sshWaitMaxInterval
+	}
+
+	// The drivers given none of the flags keep the defaults. Given only a
+	// timeout, the attempts are unlimited but for it.
+	if policy.Interval == 0 {
+		policy.Interval = ssh.DefaultRetryPolicy.Interval
+	}
+	if policy.MaxAttempts == 0 && policy.Timeout == 0 {
+		policy.MaxAttempts = ssh.DefaultRetryPolicy.MaxAttempts
+	}
+
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+
+	d.SSHRetryPolicy = nil
+	if policy != ssh.DefaultRetryPolicy {
+		d.SSHRetryPolicy = &policy
+	}
+	return nil
+}
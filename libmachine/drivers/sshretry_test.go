@@ -0,0 +1,58 @@
+package drivers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/rancher/machine/libmachine/ssh"
+	"github.com/stretchr/testify/assert"
+)
+
+func sshRetryFlags(values map[string]interface{}) *CheckDriverOptions {
+	return &CheckDriverOptions{
+		FlagsValues: values,
+		CreateFlags: []mcnflag.Flag{
+			mcnflag.IntFlag{Name: SSHWaitAttemptsFlag},
+			mcnflag.IntFlag{Name: SSHWaitIntervalFlag},
+			mcnflag.IntFlag{Name: SSHWaitTimeoutFlag},
+			mcnflag.BoolFlag{Name: SSHWaitBackoffFlag},
+		},
+	}
+}
+
+func TestSetSSHRetryPolicyFromFlags(t *testing.T) {
+	d := &BaseDriver{}
+
+	assert.NoError(t, d.SetSSHRetryPolicyFromFlags(sshRetryFlags(map[string]interface{}{})))
+	assert.Nil(t, d.SSHRetryPolicy)
+	policy, err := GetSSHRetryPolicy(&MockDriver{})
+	assert.NoError(t, err)
+	assert.Equal(t, ssh.DefaultRetryPolicy, policy)
+
+	assert.NoError(t, d.SetSSHRetryPolicyFromFlags(sshRetryFlags(map[string]interface{}{
+		SSHWaitAttemptsFlag: 0,
+		SSHWaitIntervalFlag: 5,
+		SSHWaitTimeoutFlag:  1800,
+		SSHWaitBackoffFlag:  true,
+	})))
+	assert.Equal(t, &ssh.RetryPolicy{
+		Interval:    5 * time.Second,
+		Multiplier:  2,
+		MaxInterval: time.Minute,
+		Timeout:     30 * time.Minute,
+	}, d.SSHRetryPolicy)
+
+	// The default attempts do not cut a timeout short.
+	assert.NoError(t, d.SetSSHRetryPolicyFromFlags(sshRetryFlags(map[string]interface{}{
+		SSHWaitTimeoutFlag: 600,
+	})))
+	assert.Equal(t, &ssh.RetryPolicy{
+		Interval: ssh.DefaultRetryPolicy.Interval,
+		Timeout:  10 * time.Minute,
+	}, d.SSHRetryPolicy)
+
+	assert.Error(t, d.SetSSHRetryPolicyFromFlags(sshRetryFlags(map[string]interface{}{
+		SSHWaitAttemptsFlag: -1,
+	})))
+}
@@ -0,0 +1,66 @@
+package drivers
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MachineTagsFlag is the create flag giving the key=value tags the drivers
+// supporting DriverWithTags apply to the cloud resources of the machine.
+const MachineTagsFlag = "machine-tags"
+
+// ErrTagsNotReported is returned by GetTags for drivers that do not tag the
+// resources of the machine.
+var ErrTagsNotReported = errors.New("driver does not report tags")
+
+// DriverWithTags is implemented by drivers that tag the resources they create
+// for the machine, its instance, disks and network interfaces.
+type DriverWithTags interface {
+	Driver
+
+	// GetTags returns the tags applied to the resources of the machine, the
+	// machine tags and those given with the flags of the driver.
+	GetTags() (map[string]string, error)
+}
+
+// GetTags returns the tags of the machine driven by d. It returns
+// ErrTagsNotReported if d does not implement DriverWithTags.
+func GetTags(d Driver) (map[string]string, error) {
+	if td, ok := d.(DriverWithTags); ok {
+		return td.GetTags()
+	}
+
+	return nil, ErrTagsNotReported
+}
+
+// ParseTags parses comma-separated key=value tags. Values may be empty, keys
+// may not.
+func ParseTags(s string) (map[string]string, error) {
+	tags := map[string]string{}
+	if s == "" {
+		return tags, nil
+	}
+
+	for _, tag := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(tag, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid tag %q of --%s, expected key=value", tag, MachineTagsFlag)
+		}
+		tags[key] = strings.TrimSpace(value)
+	}
+	return tags, nil
+}
+
+// SortedTagKeys returns the keys of tags in order, for the drivers to tag
+// the resources the same way every time.
+func SortedTagKeys(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,39 @@
+package drivers
+
+import (
+	"testing"
+
+	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTags(t *testing.T) {
+	tags, err := ParseTags("env=prod, team=infra,empty=")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "prod", "team": "infra", "empty": ""}, tags)
+	assert.Equal(t, []string{"empty", "env", "team"}, SortedTagKeys(tags))
+
+	tags, err = ParseTags("")
+	assert.NoError(t, err)
+	assert.Empty(t, tags)
+
+	_, err = ParseTags("env=prod,team")
+	assert.EqualError(t, err, `invalid tag "team" of --machine-tags, expected key=value`)
+
+	_, err = ParseTags("=prod")
+	assert.EqualError(t, err, `invalid tag "=prod" of --machine-tags, expected key=value`)
+}
+
+func TestSetTagsFromFlags(t *testing.T) {
+	d := &BaseDriver{}
+	flags := &CheckDriverOptions{
+		FlagsValues: map[string]interface{}{MachineTagsFlag: "env=prod"},
+		CreateFlags: []mcnflag.Flag{mcnflag.StringFlag{Name: MachineTagsFlag}},
+	}
+
+	assert.NoError(t, d.SetTagsFromFlags(flags))
+	assert.Equal(t, map[string]string{"env": "prod"}, d.MachineTags)
+
+	flags.FlagsValues[MachineTagsFlag] = "env"
+	assert.Error(t, d.SetTagsFromFlags(flags))
+}
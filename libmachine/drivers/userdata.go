@@ -0,0 +1,70 @@
+package drivers
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// MachineUserDataFlag is the create flag giving the file of the user-data,
+// usually a cloud-init config, the drivers pass to the machine. The drivers
+// given a user-data file with a flag of their own use that one instead.
+const MachineUserDataFlag = "machine-user-data"
+
+// UserDataVars are the variables of the template of the machine user-data,
+// such as {{.MachineName}}.
+type UserDataVars struct {
+	MachineName  string
+	SSHUser      string
+	SSHPublicKey string
+}
+
+// RenderUserData executes the user-data template text with vars.
+func RenderUserData(text string, vars UserDataVars) (string, error) {
+	tmpl, err := template.New(MachineUserDataFlag).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid template of --%s: %s", MachineUserDataFlag, err)
+	}
+
+	var userData bytes.Buffer
+	if err := tmpl.Execute(&userData, vars); err != nil {
+		return "", fmt.Errorf("invalid template of --%s: %s", MachineUserDataFlag, err)
+	}
+	return userData.String(), nil
+}
+
+// SetUserDataFromFlags sets the machine user-data file from the
+// --machine-user-data flag
+func (d *BaseDriver) SetUserDataFromFlags(flags DriverOptions) error {
+	d.MachineUserDataFile = flags.String(MachineUserDataFlag)
+	if d.MachineUserDataFile == "" {
+		return nil
+	}
+
+	if _, err := os.Stat(d.MachineUserDataFile); err != nil {
+		return fmt.Errorf("user-data file %s could not be found", d.MachineUserDataFile)
+	}
+	return nil
+}
+
+// MachineUserData returns the machine user-data, its template executed, or
+// nothing if there is none. It is called by Create once the SSH key of the
+// machine exists, for {{.SSHPublicKey}} to be set.
+func (d *BaseDriver) MachineUserData() (string, error) {
+	if d.MachineUserDataFile == "" {
+		return "", nil
+	}
+
+	text, err := os.ReadFile(d.MachineUserDataFile)
+	if err != nil {
+		return "", err
+	}
+
+	vars := UserDataVars{MachineName: d.MachineName, SSHUser: d.SSHUser}
+	if publicKey, err := os.ReadFile(d.GetSSHKeyPath() + ".pub"); err == nil {
+		vars.SSHPublicKey = strings.TrimSpace(string(publicKey))
+	}
+	return RenderUserData(string(text), vars)
+}
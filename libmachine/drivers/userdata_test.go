@@ -0,0 +1,51 @@
+package drivers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderUserData(t *testing.T) {
+	userData, err := RenderUserData("#cloud-config\nhostname: {{.MachineName}}\nssh_authorized_keys: [{{.SSHPublicKey}}]\n", UserDataVars{
+		MachineName:  "default",
+		SSHPublicKey: "ssh-rsa AAAA",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "#cloud-config\nhostname: default\nssh_authorized_keys: [ssh-rsa AAAA]\n", userData)
+
+	_, err = RenderUserData("hostname: {{.Hostname}}", UserDataVars{})
+	assert.Error(t, err)
+
+	_, err = RenderUserData("hostname: {{.MachineName", UserDataVars{})
+	assert.Error(t, err)
+}
+
+func TestMachineUserData(t *testing.T) {
+	dir := t.TempDir()
+	userDataPath := filepath.Join(dir, "user-data.yml")
+	assert.NoError(t, os.WriteFile(userDataPath, []byte("user: {{.SSHUser}}\nkey: {{.SSHPublicKey}}\n"), 0600))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "machines", "default"), 0700))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "machines", "default", "id_rsa.pub"), []byte("ssh-rsa AAAA\n"), 0600))
+
+	d := &BaseDriver{MachineName: "default", StorePath: dir, SSHUser: "docker"}
+	userData, err := d.MachineUserData()
+	assert.NoError(t, err)
+	assert.Empty(t, userData)
+
+	flags := &CheckDriverOptions{
+		FlagsValues: map[string]interface{}{MachineUserDataFlag: userDataPath},
+		CreateFlags: []mcnflag.Flag{mcnflag.StringFlag{Name: MachineUserDataFlag}},
+	}
+	assert.NoError(t, d.SetUserDataFromFlags(flags))
+
+	userData, err = d.MachineUserData()
+	assert.NoError(t, err)
+	assert.Equal(t, "user: docker\nkey: ssh-rsa AAAA\n", userData)
+
+	flags.FlagsValues[MachineUserDataFlag] = filepath.Join(dir, "does-not-exist.yml")
+	assert.Error(t, d.SetUserDataFromFlags(flags))
+}
@@ -2,35 +2,208 @@ package drivers
 
 import (
 	"fmt"
-	"time"
+	"io"
+	"sync"
 
 	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/mcnutils"
 	"github.com/rancher/machine/libmachine/ssh"
 )
 
+// sshSharing maps the names of the machines sharing SSH connections to the
+// directory holding their control sockets, if any. The connections are
+// shared, and closed, by machine name.
+var sshSharing = struct {
+	sync.RWMutex
+	controlDirs map[string]string
+}{controlDirs: map[string]string{}}
+
+// ShareSSHConnections makes the SSH clients of the named machine share one
+// connection, with the control sockets of the external client in
+// controlDir.
+func ShareSSHConnections(machineName, controlDir string) {
+	sshSharing.Lock()
+	defer sshSharing.Unlock()
+	sshSharing.controlDirs[machineName] = controlDir
+}
+
+// ReuseSSHConnections makes the native SSH clients of the named machine
+// share one connection, like for a whole provisioning run, rather than
+// opening one per command. The returned function closes the connection and
+// stops the sharing, unless the machine shares its connections anyway.
+func ReuseSSHConnections(machineName string) func() {
+	sshSharing.Lock()
+	_, shared := sshSharing.controlDirs[machineName]
+	if !shared {
+		sshSharing.controlDirs[machineName] = ""
+	}
+	sshSharing.Unlock()
+
+	if shared {
+		return func() {}
+	}
+
+	return func() {
+		CloseSSHConnections(machineName)
+
+		sshSharing.Lock()
+		delete(sshSharing.controlDirs, machineName)
+		sshSharing.Unlock()
+	}
+}
+
+// CloseSSHConnections closes the SSH connections shared by the named
+// machine, if any. New ones are opened as needed.
+func CloseSSHConnections(machineName string) {
+	sshSharing.RLock()
+	controlDir, ok := sshSharing.controlDirs[machineName]
+	sshSharing.RUnlock()
+
+	if !ok {
+		return
+	}
+
+	if err := ssh.CloseSharedConnections(machineName, controlDir); err != nil {
+		log.Debugf("Error closing the shared SSH connections of %s: %s", machineName, err)
+	}
+}
+
+// sshKnownHosts maps the names of the machines verifying their SSH host key
+// to their known_hosts file.
+var sshKnownHosts = struct {
+	sync.RWMutex
+	paths map[string]string
+}{paths: map[string]string{}}
+
+// VerifySSHHostKeys makes the SSH clients of the named machine verify its
+// host key against the known_hosts file at knownHostsPath, recording the key
+// there on the first connection, like when the machine is provisioned.
+func VerifySSHHostKeys(machineName, knownHostsPath string) {
+	sshKnownHosts.Lock()
+	defer sshKnownHosts.Unlock()
+	sshKnownHosts.paths[machineName] = knownHostsPath
+}
+
+// ForgetSSHHostKey removes the host key recorded for the named machine, for
+// the next connection to record its new one, like once it was recreated.
+func ForgetSSHHostKey(machineName string) error {
+	knownHosts := sshKnownHostsOf(machineName)
+	if knownHosts == nil {
+		return nil
+	}
+	return knownHosts.Forget()
+}
+
+func sshKnownHostsOf(machineName string) *ssh.KnownHosts {
+	sshKnownHosts.RLock()
+	path, ok := sshKnownHosts.paths[machineName]
+	sshKnownHosts.RUnlock()
+
+	if !ok {
+		return nil
+	}
+	return &ssh.KnownHosts{Path: path, Alias: machineName}
+}
+
+// VerifySSHHostKey makes client verify the host key of the machine of d, if
+// the machine verifies it.
+func VerifySSHHostKey(d Driver, client ssh.Client) {
+	knownHosts := sshKnownHostsOf(d.GetMachineName())
+	// The host CA verifies the machines which have one.
+	if knownHosts == nil || sshHostCAOf(d.GetMachineName()) != nil {
+		return
+	}
+
+	if verifying, ok := client.(ssh.HostKeyVerifyingClient); ok {
+		verifying.VerifyHostKey(knownHosts)
+	}
+}
+
+// sshAlgorithms maps the names of the machines to the SSH algorithms their
+// clients offer.
+var sshAlgorithms = struct {
+	sync.RWMutex
+	algorithms map[string]ssh.Algorithms
+}{algorithms: map[string]ssh.Algorithms{}}
+
+// SetSSHAlgorithms makes the SSH clients of the named machine offer the
+// algorithms, unless the environment overrides them.
+func SetSSHAlgorithms(machineName string, algorithms ssh.Algorithms) {
+	sshAlgorithms.Lock()
+	defer sshAlgorithms.Unlock()
+	sshAlgorithms.algorithms[machineName] = algorithms
+}
+
+// SetSSHClientAlgorithms makes client offer the SSH algorithms of the
+// machine of d, if it has ones.
+func SetSSHClientAlgorithms(d Driver, client ssh.Client) error {
+	sshAlgorithms.RLock()
+	algorithms := sshAlgorithms.algorithms[d.GetMachineName()].WithEnv()
+	sshAlgorithms.RUnlock()
+
+	if algorithms.IsZero() {
+		return nil
+	}
+
+	algorithmsClient, ok := client.(ssh.AlgorithmsClient)
+	if !ok {
+		return fmt.Errorf("the SSH client of %s cannot set its algorithms", d.GetMachineName())
+	}
+	if err := algorithmsClient.SetAlgorithms(algorithms); err != nil {
+		return fmt.Errorf("Error setting the SSH algorithms of %s: %s", d.GetMachineName(), err)
+	}
+	return nil
+}
+
 func GetSSHClientFromDriver(d Driver) (ssh.Client, error) {
 	address, err := d.GetSSHHostname()
 	if err != nil {
 		return nil, err
 	}
+	address = mcnutils.UnbracketHost(address)
 
 	port, err := d.GetSSHPort()
 	if err != nil {
 		return nil, err
 	}
 
-	var auth *ssh.Auth
-	if d.GetSSHKeyPath() == "" {
-		auth = &ssh.Auth{}
+	auth, err := GetSSHAuth(d)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := RenewSSHUserCert(d); err != nil {
+		return nil, err
+	}
+
+	bastion, err := GetSSHBastion(d)
+	if err != nil {
+		return nil, err
+	}
+
+	sshSharing.RLock()
+	controlDir, shared := sshSharing.controlDirs[d.GetMachineName()]
+	sshSharing.RUnlock()
+
+	var client ssh.Client
+	if shared {
+		client, err = ssh.NewSharedClient(d.GetSSHUsername(), address, port, auth, bastion, d.GetMachineName(), controlDir)
 	} else {
-		auth = &ssh.Auth{
-			Keys: []string{d.GetSSHKeyPath()},
-		}
+		client, err = ssh.NewBastionClient(d.GetSSHUsername(), address, port, auth, bastion)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	client, err := ssh.NewClient(d.GetSSHUsername(), address, port, auth)
-	return client, err
+	if err := SetSSHClientAlgorithms(d, client); err != nil {
+		return nil, err
+	}
 
+	VerifySSHHostKey(d, client)
+	if err := VerifySSHHostCert(d, client); err != nil {
+		return nil, err
+	}
+	return client, nil
 }
 
 func RunSSHCommandFromDriver(d Driver, command string) (string, error) {
@@ -39,6 +212,12 @@ func RunSSHCommandFromDriver(d Driver, command string) (string, error) {
 		return "", err
 	}
 
+	return runSSHCommand(client, command)
+}
+
+// runSSHCommand runs the command on the machine with client.
+func runSSHCommand(client ssh.Client, command string) (string, error) {
+
 	log.Debugf("About to run SSH command:\n%s", command)
 
 	output, err := client.Output(command)
@@ -50,20 +229,75 @@ func RunSSHCommandFromDriver(d Driver, command string) (string, error) {
 	return output, nil
 }
 
-// WaitForSSH tries to run `exit 0` on the host machine using the driver. It will retry up to
-// 60 times with 3 seconds in between each attempt. If the command still errors after the final
-// attempt, the error will be returned.
+// RunSSHCommandWithInputFromDriver runs the command on the machine with input
+// as its standard input.
+func RunSSHCommandWithInputFromDriver(d Driver, command string, input io.Reader) (string, error) {
+	client, err := GetSSHClientFromDriver(d)
+	if err != nil {
+		return "", err
+	}
+
+	inputClient, ok := client.(ssh.InputClient)
+	if !ok {
+		return "", fmt.Errorf("the SSH client of %s cannot send input to commands", d.GetMachineName())
+	}
+
+	log.Debugf("About to run SSH command with input:\n%s", command)
+
+	output, err := inputClient.OutputWithInput(command, input)
+	log.Debugf("SSH cmd err, output: %v: %s", err, output)
+	if err != nil {
+		return "", fmt.Errorf(`ssh command error: command: %s err: %v output: %s`, command, err, output)
+	}
+
+	return output, nil
+}
+
+// UploadFromDriver writes content to the file at path on the machine, with
+// the attributes.
+func UploadFromDriver(d Driver, content io.Reader, path string, attrs ssh.FileAttributes) error {
+	client, err := GetSSHClientFromDriver(d)
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("About to upload %s (%#o, owner %q)", path, attrs.Mode, attrs.Owner)
+
+	if err := client.Upload(content, path, attrs); err != nil {
+		return fmt.Errorf("ssh upload error: %s", err)
+	}
+	return nil
+}
+
+// WaitForSSH tries to run `exit 0` on the host machine using the driver. It will retry with the
+// SSH retry policy of the machine, by default up to 60 times with 3 seconds in between each
+// attempt. If the command still errors after the final attempt, the error will be returned.
 func WaitForSSH(d Driver) error {
+	policy, err := GetSSHRetryPolicy(d)
+	if err != nil {
+		return err
+	}
+
 	var lastErr error
-	for i := 0; i < 60; i++ {
+	if err := policy.WaitFor(func() bool {
 		log.Debug("Getting to WaitForSSH function...")
-		if _, lastErr = RunSSHCommandFromDriver(d, "exit 0"); lastErr == nil {
-			return nil
+		var client ssh.Client
+		if client, lastErr = GetSSHClientFromDriver(d); lastErr != nil {
+			log.Debugf("Error getting the SSH client: %s", lastErr)
+			return false
+		}
+		// The policy of the machine retries the attempts, which dial once.
+		if retryClient, ok := client.(ssh.DialRetryClient); ok {
+			retryClient.SetDialRetryPolicy(ssh.RetryPolicy{MaxAttempts: 1})
+		}
+		if _, lastErr = runSSHCommand(client, "exit 0"); lastErr == nil {
+			return true
 		}
 
 		log.Debugf("Error getting SSH command 'exit 0' : %s", lastErr)
-		time.Sleep(3 * time.Second)
+		return false
+	}); err != nil {
+		return fmt.Errorf("Too many retries waiting for SSH to be available (%s). Last error: %w", err, lastErr)
 	}
-
-	return fmt.Errorf("Too many retries waiting for SSH to be available. Last error: %w", lastErr)
+	return nil
 }
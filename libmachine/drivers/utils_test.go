@@ -0,0 +1,44 @@
+package drivers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sharingDir(machineName string) (string, bool) {
+	sshSharing.RLock()
+	defer sshSharing.RUnlock()
+	controlDir, ok := sshSharing.controlDirs[machineName]
+	return controlDir, ok
+}
+
+func TestReuseSSHConnections(t *testing.T) {
+	release := ReuseSSHConnections("reused")
+	controlDir, ok := sharingDir("reused")
+	assert.True(t, ok)
+	assert.Empty(t, controlDir)
+
+	// Reusing the connections again leaves them to the first reuse.
+	ReuseSSHConnections("reused")()
+	_, ok = sharingDir("reused")
+	assert.True(t, ok)
+
+	release()
+	_, ok = sharingDir("reused")
+	assert.False(t, ok)
+}
+
+func TestReuseSSHConnectionsKeepsSharing(t *testing.T) {
+	ShareSSHConnections("shared", "/machines/shared")
+	defer func() {
+		sshSharing.Lock()
+		delete(sshSharing.controlDirs, "shared")
+		sshSharing.Unlock()
+	}()
+
+	ReuseSSHConnections("shared")()
+	controlDir, ok := sharingDir("shared")
+	assert.True(t, ok)
+	assert.Equal(t, "/machines/shared", controlDir)
+}
@@ -18,4 +18,18 @@ type Options struct {
 	TLSVerify        bool `json:"TlsVerify"`
 	RegistryMirror   []string
 	InstallURL       string
+	InstallVersion   string `json:",omitempty"`
+	PackagesURL      string `json:",omitempty"`
+	OfflineBundle    string `json:",omitempty"`
+	NvidiaRuntime    bool
+	// SELinux is the SELinux mode to put the machine in, left as it is
+	// when empty, and SELinuxBooleans the booleans to set, like
+	// container_manage_cgroup=on.
+	SELinux         string   `json:",omitempty"`
+	SELinuxBooleans []string `json:",omitempty"`
+	// HTTPProxy, HTTPSProxy and NoProxy are the proxy settings of the
+	// engine, and of the downloads of the provisioning.
+	HTTPProxy  string `json:",omitempty"`
+	HTTPSProxy string `json:",omitempty"`
+	NoProxy    string `json:",omitempty"`
 }
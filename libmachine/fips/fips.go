@@ -0,0 +1,112 @@
+// Package fips restricts the crypto of machine to the algorithms approved by
+// FIPS 140, for the deployments which need it. The mode is enabled by
+// building with the fips tag, or at runtime with the MACHINE_FIPS
+// environment variable, which the driver plugins inherit.
+//
+// It only restricts the algorithms; building with GOEXPERIMENT=boringcrypto
+// is what makes them run in a validated module.
+package fips
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// EnvVar is the environment variable enabling the mode at runtime.
+const EnvVar = "MACHINE_FIPS"
+
+// MinRSABits is the smallest approved size of the RSA keys.
+const MinRSABits = 2048
+
+var (
+	// CipherSuites are the approved TLS 1.2 cipher suites.
+	CipherSuites = []uint16{
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	}
+
+	// CurvePreferences are the approved curves of the TLS key exchanges.
+	CurvePreferences = []tls.CurveID{tls.CurveP256, tls.CurveP384}
+
+	approvedSignatureAlgorithms = map[x509.SignatureAlgorithm]bool{
+		x509.SHA256WithRSA:    true,
+		x509.SHA384WithRSA:    true,
+		x509.SHA512WithRSA:    true,
+		x509.SHA256WithRSAPSS: true,
+		x509.SHA384WithRSAPSS: true,
+		x509.SHA512WithRSAPSS: true,
+		x509.ECDSAWithSHA256:  true,
+		x509.ECDSAWithSHA384:  true,
+		x509.ECDSAWithSHA512:  true,
+	}
+)
+
+// Enabled tells whether the crypto is restricted to the approved
+// algorithms.
+func Enabled() bool {
+	if buildEnabled {
+		return true
+	}
+	enabled, _ := strconv.ParseBool(os.Getenv(EnvVar))
+	return enabled
+}
+
+// Enable restricts the crypto to the approved algorithms, in this process
+// and the driver plugins it starts.
+func Enable() {
+	os.Setenv(EnvVar, "1")
+}
+
+// CheckPublicKey fails when key is not an RSA key of MinRSABits or more, or
+// an ECDSA key on a NIST curve.
+func CheckPublicKey(key crypto.PublicKey) error {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if bits := k.N.BitLen(); bits < MinRSABits {
+			return fmt.Errorf("%d-bit RSA keys are not FIPS-approved, use %d bits or more", bits, MinRSABits)
+		}
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256(), elliptic.P384(), elliptic.P521():
+		default:
+			return fmt.Errorf("ECDSA keys on the %s curve are not FIPS-approved", k.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		return fmt.Errorf("Ed25519 keys are not FIPS-approved, use RSA or ECDSA")
+	default:
+		return fmt.Errorf("%T keys are not FIPS-approved, use RSA or ECDSA", key)
+	}
+	return nil
+}
+
+// CheckCertificate fails when the key or the signature of cert are not
+// approved.
+func CheckCertificate(cert *x509.Certificate) error {
+	if err := CheckPublicKey(cert.PublicKey); err != nil {
+		return err
+	}
+	if !approvedSignatureAlgorithms[cert.SignatureAlgorithm] {
+		return fmt.Errorf("%s signatures are not FIPS-approved", cert.SignatureAlgorithm)
+	}
+	return nil
+}
+
+// RestrictTLSConfig restricts config to the approved versions, cipher
+// suites and curves of TLS. TLS 1.3 is left out, Go does not let its cipher
+// suites be restricted.
+func RestrictTLSConfig(config *tls.Config) {
+	config.MinVersion = tls.VersionTLS12
+	config.MaxVersion = tls.VersionTLS12
+	config.CipherSuites = CipherSuites
+	config.CurvePreferences = CurvePreferences
+}
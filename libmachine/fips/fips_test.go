@@ -0,0 +1,86 @@
+package fips
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnabled(t *testing.T) {
+	if buildEnabled {
+		t.Skip("built with the fips tag")
+	}
+
+	t.Setenv(EnvVar, "")
+	assert.False(t, Enabled())
+
+	Enable()
+	assert.True(t, Enabled())
+
+	t.Setenv(EnvVar, "false")
+	assert.False(t, Enabled())
+}
+
+func TestCheckPublicKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	assert.NoError(t, CheckPublicKey(&rsaKey.PublicKey))
+
+	smallKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+	assert.EqualError(t, CheckPublicKey(&smallKey.PublicKey), "1024-bit RSA keys are not FIPS-approved, use 2048 bits or more")
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.NoError(t, err)
+	assert.NoError(t, CheckPublicKey(&ecKey.PublicKey))
+
+	ecKey, err = ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	assert.NoError(t, err)
+	assert.EqualError(t, CheckPublicKey(&ecKey.PublicKey), "ECDSA keys on the P-224 curve are not FIPS-approved")
+
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	assert.EqualError(t, CheckPublicKey(edKey), "Ed25519 keys are not FIPS-approved, use RSA or ECDSA")
+}
+
+func TestCheckCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	for algorithm, approved := range map[x509.SignatureAlgorithm]bool{
+		x509.ECDSAWithSHA256: true,
+		x509.ECDSAWithSHA1:   false,
+	} {
+		template := &x509.Certificate{SerialNumber: big.NewInt(1), SignatureAlgorithm: algorithm}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		assert.NoError(t, err)
+
+		if approved {
+			assert.NoError(t, CheckCertificate(cert))
+		} else {
+			assert.EqualError(t, CheckCertificate(cert), "ECDSA-SHA1 signatures are not FIPS-approved")
+		}
+	}
+}
+
+func TestRestrictTLSConfig(t *testing.T) {
+	config := &tls.Config{}
+	RestrictTLSConfig(config)
+
+	assert.Equal(t, uint16(tls.VersionTLS12), config.MinVersion)
+	assert.Equal(t, uint16(tls.VersionTLS12), config.MaxVersion)
+	assert.Equal(t, CipherSuites, config.CipherSuites)
+	assert.Equal(t, CurvePreferences, config.CurvePreferences)
+}
@@ -0,0 +1,37 @@
+package host
+
+// Checkpoint records a phase of the provisioning of a host that completed,
+// for a failed creation to be resumed from where it stopped.
+type Checkpoint string
+
+// The phases of the provisioning of a host, in the order they complete.
+const (
+	// CheckpointMachineCreated is reached once the driver created the
+	// machine.
+	CheckpointMachineCreated Checkpoint = "MachineCreated"
+	// CheckpointPackagesInstalled is reached once the engine is installed.
+	CheckpointPackagesInstalled Checkpoint = "PackagesInstalled"
+	// CheckpointDaemonConfigured is reached once the engine runs with its
+	// options and certificates.
+	CheckpointDaemonConfigured Checkpoint = "DaemonConfigured"
+	// CheckpointDaemonVerified is reached once the engine is reachable
+	// from the client.
+	CheckpointDaemonVerified Checkpoint = "DaemonVerified"
+)
+
+// HasCheckpoint tells whether the host reached the checkpoint.
+func (h *Host) HasCheckpoint(checkpoint Checkpoint) bool {
+	for _, c := range h.Checkpoints {
+		if c == checkpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// AddCheckpoint records that the host reached the checkpoint.
+func (h *Host) AddCheckpoint(checkpoint Checkpoint) {
+	if !h.HasCheckpoint(checkpoint) {
+		h.Checkpoints = append(h.Checkpoints, checkpoint)
+	}
+}
@@ -1,12 +1,18 @@
 package host
 
 import (
+	"errors"
+	"fmt"
+	"path/filepath"
 	"regexp"
+	"strings"
 
 	"github.com/rancher/machine/libmachine/auth"
 	"github.com/rancher/machine/libmachine/cert"
+	"github.com/rancher/machine/libmachine/containerd"
 	"github.com/rancher/machine/libmachine/drivers"
 	"github.com/rancher/machine/libmachine/engine"
+	"github.com/rancher/machine/libmachine/k3s"
 	"github.com/rancher/machine/libmachine/log"
 	"github.com/rancher/machine/libmachine/mcndockerclient"
 	"github.com/rancher/machine/libmachine/mcnerror"
@@ -39,13 +45,31 @@ func SetSSHClientCreator(creator SSHClientCreator) {
 	stdSSHClientCreator = creator
 }
 
+// LifecycleState records whether a host made it through creation.
+type LifecycleState string
+
+// LifecycleError marks a host whose creation failed after the driver started
+// creating it. Some of its resources may still exist until it is removed.
+const LifecycleError LifecycleState = "Error"
+
+// The engines a machine is provisioned with.
+const (
+	ProvisionEngineDocker     = "docker"
+	ProvisionEngineK3s        = "k3s"
+	ProvisionEngineContainerd = "containerd"
+	ProvisionEnginePodman     = "podman"
+)
+
 type Host struct {
-	ConfigVersion int
-	Driver        drivers.Driver
-	DriverName    string
-	HostOptions   *Options
-	Name          string
-	RawDriver     []byte `json:"-"`
+	ConfigVersion  int
+	Driver         drivers.Driver
+	DriverName     string
+	HostOptions    *Options
+	Name           string
+	RawDriver      []byte         `json:"-"`
+	LifecycleState LifecycleState `json:",omitempty"`
+	// Checkpoints are the phases of the provisioning the host completed.
+	Checkpoints []Checkpoint `json:",omitempty"`
 }
 
 type Options struct {
@@ -55,9 +79,33 @@ type Options struct {
 	CustomInstallScript string
 	HostnameOverride    string
 	MachineOS           string
-	EngineOptions       *engine.Options
-	SwarmOptions        *swarm.Options
-	AuthOptions         *auth.Options
+	KeepOnError         bool `json:"-"`
+	// SSHConnectionSharing makes the SSH commands run on the machine share
+	// one connection.
+	SSHConnectionSharing bool `json:",omitempty"`
+	// SSHAlgorithms are the ciphers, key exchanges and MACs the SSH clients
+	// offer to the machine, the defaults when nil.
+	SSHAlgorithms *ssh.Algorithms `json:",omitempty"`
+	// SSHCertAuthorities are the CAs signing the SSH user certificates the
+	// clients authenticate with and the host key certificates of the
+	// machine, none when nil.
+	SSHCertAuthorities *ssh.CertAuthorities `json:",omitempty"`
+	// CARotation is the last step of the rotation of the CA in progress the
+	// machine went through, if any.
+	CARotation CARotation `json:",omitempty"`
+	// PreProvisionHook and PostProvisionHook, the path of a local script or
+	// inline commands, are run on the machine before and after the engine
+	// is installed.
+	PreProvisionHook  string `json:",omitempty"`
+	PostProvisionHook string `json:",omitempty"`
+	// ProvisionEngine is what the machine is provisioned with, the Docker
+	// engine when empty.
+	ProvisionEngine   string              `json:",omitempty"`
+	K3sOptions        *k3s.Options        `json:",omitempty"`
+	ContainerdOptions *containerd.Options `json:",omitempty"`
+	EngineOptions     *engine.Options
+	SwarmOptions      *swarm.Options
+	AuthOptions       *auth.Options
 }
 
 type Metadata struct {
@@ -78,6 +126,41 @@ func (h *Host) CreateSSHClient() (ssh.Client, error) {
 	return stdSSHClientCreator.CreateSSHClient(h.Driver)
 }
 
+// LocalForward forwards the connections to localAddr, on the local host, to
+// remoteAddr on the machine, like a daemon bound to localhost:2375 there,
+// until the returned tunnel is closed. The tunnels go over the shared SSH
+// connection of the machine when it shares one.
+func (h *Host) LocalForward(localAddr, remoteAddr string) (*ssh.Tunnel, error) {
+	client, err := h.tunnelingClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.LocalForward(localAddr, remoteAddr)
+}
+
+// RemoteForward forwards the connections to remoteAddr, on the machine, to
+// localAddr on the local host, until the returned tunnel is closed.
+func (h *Host) RemoteForward(remoteAddr, localAddr string) (*ssh.Tunnel, error) {
+	client, err := h.tunnelingClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.RemoteForward(remoteAddr, localAddr)
+}
+
+func (h *Host) tunnelingClient() (ssh.TunnelingClient, error) {
+	client, err := drivers.GetSSHClientFromDriver(h.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	tunnelingClient, ok := client.(ssh.TunnelingClient)
+	if !ok {
+		return nil, fmt.Errorf("the SSH client of %s cannot forward ports", h.Name)
+	}
+	return tunnelingClient, nil
+}
+
 func (creator *StandardSSHClientCreator) CreateSSHClient(d drivers.Driver) (ssh.Client, error) {
 	addr, err := d.GetSSHHostname()
 	if err != nil {
@@ -89,12 +172,34 @@ func (creator *StandardSSHClientCreator) CreateSSHClient(d drivers.Driver) (ssh.
 		return &ssh.ExternalClient{}, err
 	}
 
-	auth := &ssh.Auth{}
-	if d.GetSSHKeyPath() != "" {
-		auth.Keys = []string{d.GetSSHKeyPath()}
+	auth, err := drivers.GetSSHAuth(d)
+	if err != nil {
+		return &ssh.ExternalClient{}, err
+	}
+
+	if err := drivers.RenewSSHUserCert(d); err != nil {
+		return &ssh.ExternalClient{}, err
+	}
+
+	bastion, err := drivers.GetSSHBastion(d)
+	if err != nil {
+		return &ssh.ExternalClient{}, err
+	}
+
+	client, err := ssh.NewBastionClient(d.GetSSHUsername(), addr, port, auth, bastion)
+	if err != nil {
+		return &ssh.ExternalClient{}, err
 	}
 
-	return ssh.NewClient(d.GetSSHUsername(), addr, port, auth)
+	if err := drivers.SetSSHClientAlgorithms(d, client); err != nil {
+		return &ssh.ExternalClient{}, err
+	}
+
+	drivers.VerifySSHHostKey(d, client)
+	if err := drivers.VerifySSHHostCert(d, client); err != nil {
+		return &ssh.ExternalClient{}, err
+	}
+	return client, nil
 }
 
 func (h *Host) runActionForState(action func() error, desiredState state.State) error {
@@ -138,6 +243,8 @@ func (h *Host) Stop() error {
 		return err
 	}
 
+	drivers.CloseSSHConnections(h.Name)
+
 	log.Infof("Machine %q was stopped.", h.Name)
 	return nil
 }
@@ -188,12 +295,28 @@ func (h *Host) DockerVersion() (string, error) {
 	return dockerVersion, nil
 }
 
+// isPreCEVersion reports whether dockerVersion predates the CE versioning
+// scheme. A version that cannot be parsed is assumed not to, so that the
+// regular package upgrade is attempted.
+func isPreCEVersion(dockerVersion string) bool {
+	cmp, err := versioncmp.Compare(dockerVersion, provision.LastReleaseBeforeCEVersioning)
+	if err != nil {
+		log.Warnf("Skipping pre-CE migration check: %s", err)
+		return false
+	}
+	return cmp <= 0
+}
+
 func (h *Host) Upgrade() error {
 	if h.HostOptions.AuthOptions == nil {
 		log.Warnf(noDockerError, h.Name, "cannot upgrade docker")
 		return nil
 	}
 
+	if h.HostOptions.MachineOS == provision.WindowsMachineOS {
+		return errors.New("upgrading Windows machines is not supported, upgrade the Mirantis Container Runtime on the machine")
+	}
+
 	machineState, err := h.Driver.GetState()
 	if err != nil {
 		return err
@@ -211,6 +334,14 @@ func (h *Host) Upgrade() error {
 		return err
 	}
 
+	if h.HostOptions.ProvisionEngine == ProvisionEnginePodman {
+		log.Info("Upgrading podman...")
+		if err := provisioner.Package("podman", pkgaction.Upgrade); err != nil {
+			return err
+		}
+		return provisioner.Service("podman.socket", serviceaction.Restart)
+	}
+
 	dockerVersion, err := h.DockerVersion()
 	if err != nil {
 		return err
@@ -220,13 +351,14 @@ func (h *Host) Upgrade() error {
 	// release (e.g., 17.03.0-ce), we should simply uninstall and
 	// re-install from scratch, since the official package names will
 	// change from 'docker-engine' to 'docker-ce'.
-	if versioncmp.LessThanOrEqualTo(dockerVersion, provision.LastReleaseBeforeCEVersioning) &&
-		// RancherOS and boot2docker, being 'static ISO builds', have
-		// an upgrade process which simply grabs the latest if it's
-		// different, and so do not need to jump through this hoop to
-		// upgrade safely.
-		provisioner.String() != "rancheros" &&
-		provisioner.String() != "boot2docker" {
+	//
+	// RancherOS and boot2docker, being 'static ISO builds', have
+	// an upgrade process which simply grabs the latest if it's
+	// different, and so do not need to jump through this hoop to
+	// upgrade safely.
+	if provisioner.String() != "rancheros" &&
+		provisioner.String() != "boot2docker" &&
+		isPreCEVersion(dockerVersion) {
 
 		// Name of package 'docker-engine' will fall through in this
 		// case, so that we execute, e.g.,
@@ -270,17 +402,51 @@ func (h *Host) ConfigureAuth() error {
 		return nil
 	}
 
+	if h.HostOptions.MachineOS == provision.WindowsMachineOS && h.HostOptions.CustomInstallScript == "" {
+		return provision.ConfigureWindowsAuth(h.Driver, *h.HostOptions.AuthOptions, *h.HostOptions.EngineOptions)
+	}
+
 	provisioner, err := provision.DetectProvisioner(h.Driver)
 	if err != nil {
 		return err
 	}
 
+	if h.HostOptions.ProvisionEngine == ProvisionEnginePodman {
+		return provision.ConfigurePodmanAuth(provisioner, *h.HostOptions.AuthOptions)
+	}
+
 	// TODO: This is kind of a hack (or is it?  I'm not really sure until
 	// we have more clearly defined outlook on what the responsibilities
 	// and modularity of the provisioners should be).
 	//
 	// Call provision to re-provision the certs properly.
-	return provisioner.Provision(swarm.Options{}, *h.HostOptions.AuthOptions, *h.HostOptions.EngineOptions)
+	return provision.ProvisionWithProxy(provisioner, swarm.Options{}, *h.HostOptions.AuthOptions, *h.HostOptions.EngineOptions)
+}
+
+// ConfigureEngine applies the engine options, like the registry mirrors or
+// the labels, to the engine of the machine, which is reconfigured and
+// restarted without being provisioned again.
+func (h *Host) ConfigureEngine(engineOptions engine.Options) error {
+	if h.HostOptions.AuthOptions == nil || h.HostOptions.EngineOptions == nil {
+		return fmt.Errorf(noDockerError, h.Name, "cannot configure the engine")
+	}
+
+	if h.HostOptions.MachineOS == provision.WindowsMachineOS {
+		if err := provision.ConfigureWindowsAuth(h.Driver, *h.HostOptions.AuthOptions, engineOptions); err != nil {
+			return err
+		}
+	} else {
+		provisioner, err := provision.DetectProvisioner(h.Driver)
+		if err != nil {
+			return err
+		}
+		if err := provision.ConfigureEngine(provisioner, *h.HostOptions.AuthOptions, engineOptions); err != nil {
+			return err
+		}
+	}
+
+	h.HostOptions.EngineOptions = &engineOptions
+	return nil
 }
 
 func (h *Host) ConfigureAllAuth() error {
@@ -296,7 +462,170 @@ func (h *Host) ConfigureAllAuth() error {
 	return h.ConfigureAuth()
 }
 
+// CARotation is a step of the rotation of the CA of the machines, which the
+// engines and the clients trust along with the previous one until it ends.
+type CARotation int
+
+const (
+	// KeepCA rotates the certificates without rotating the CA.
+	KeepCA CARotation = iota
+	// StartCARotation generates the new CA, for the first machine rotated,
+	// and makes the engine trust it along with the current one. Every
+	// machine of the CA goes through this step before the next one.
+	StartCARotation
+	// FinishCARotation makes the new CA sign the certificates, and the
+	// engine trust it only.
+	FinishCARotation
+	// EndCARotation makes the clients trust the new CA only, once every
+	// machine of the CA is finished. No certificate is rotated.
+	EndCARotation
+)
+
+// caRotationSteps names the steps of a CA rotation.
+var caRotationSteps = map[CARotation]string{
+	StartCARotation:  "start",
+	FinishCARotation: "finish",
+	EndCARotation:    "end",
+}
+
+// CheckCARotation fails unless every machine of the CA at caCertPath went
+// through the step of the CA rotation before rotation, saved in their options
+// by RotateCerts.
+func CheckCARotation(rotation CARotation, caCertPath string, machines []*Host) error {
+	if rotation != FinishCARotation && rotation != EndCARotation {
+		return nil
+	}
+
+	var behind []string
+	for _, h := range machines {
+		if h.HostOptions == nil || h.HostOptions.AuthOptions == nil || h.HostOptions.AuthOptions.CaCertPath != caCertPath {
+			continue
+		}
+		if h.HostOptions.CARotation < rotation-1 {
+			behind = append(behind, h.Name)
+		}
+	}
+	if len(behind) > 0 {
+		return fmt.Errorf("the CA rotation cannot %s before the machines %s of the CA %s %s it", caRotationSteps[rotation], strings.Join(behind, ", "), caCertPath, caRotationSteps[rotation-1])
+	}
+	return nil
+}
+
+// RotateCertsOptions tells RotateCerts which certificates to rotate.
+type RotateCertsOptions struct {
+	// OnlyClient rotates the client certificate only, which the engine
+	// keeps trusting without being restarted as its CA is the same.
+	OnlyClient bool
+	// CA is the step of the rotation of the CA, if any.
+	CA CARotation
+}
+
+// RotateCerts generates new client and server certificates and installs the
+// server ones on the machine, restarting the engine once without provisioning
+// the machine again. The step of the CA rotation, if any, is set in the
+// options of the machine, to be saved.
+func (h *Host) RotateCerts(opts RotateCertsOptions) error {
+	if err := h.rotateCerts(opts); err != nil {
+		return err
+	}
+
+	switch opts.CA {
+	case StartCARotation, FinishCARotation:
+		// The machines started again, a finished rotation being resumed,
+		// stay finished.
+		if h.HostOptions.CARotation < opts.CA {
+			h.HostOptions.CARotation = opts.CA
+		}
+	case EndCARotation:
+		h.HostOptions.CARotation = KeepCA
+	}
+	return nil
+}
+
+func (h *Host) rotateCerts(opts RotateCertsOptions) error {
+	if h.HostOptions.AuthOptions == nil {
+		return fmt.Errorf(noDockerError, h.Name, "cannot rotate the certificates")
+	}
+	if opts.OnlyClient && opts.CA != KeepCA {
+		return errors.New("the CA cannot be rotated with the client certificate only")
+	}
+
+	authOptions := *h.HostOptions.AuthOptions
+
+	var err error
+	switch opts.CA {
+	case StartCARotation:
+		err = cert.StartCARotation(&authOptions)
+	case FinishCARotation:
+		err = cert.PromoteCA(&authOptions)
+	case EndCARotation:
+		return cert.EndCARotation(&authOptions)
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Info("Regenerating the client certificate")
+	if err := cert.RegenerateClientCert(&authOptions); err != nil {
+		return err
+	}
+
+	if opts.OnlyClient {
+		for src, dst := range map[string]string{
+			authOptions.ClientCertPath: "cert.pem",
+			authOptions.ClientKeyPath:  "key.pem",
+		} {
+			if err := mcnutils.CopyFile(src, filepath.Join(authOptions.StorePath, dst)); err != nil {
+				return fmt.Errorf("Copying %s to machine dir failed: %s", dst, err)
+			}
+		}
+		return nil
+	}
+
+	if opts.CA == FinishCARotation {
+		// The engine trusts the new CA only, the previous one being left
+		// to the clients until the rotation ends.
+		authOptions.CaCertPath, authOptions.CaPrivateKeyPath = cert.NextCA(&authOptions)
+	}
+
+	log.Infof("Rotating the server certificate of %s", h.Name)
+
+	if h.HostOptions.MachineOS == provision.WindowsMachineOS && h.HostOptions.CustomInstallScript == "" {
+		return provision.ConfigureWindowsAuth(h.Driver, authOptions, *h.HostOptions.EngineOptions)
+	}
+
+	provisioner, err := provision.DetectProvisioner(h.Driver)
+	if err != nil {
+		return err
+	}
+
+	if h.HostOptions.ProvisionEngine == ProvisionEnginePodman {
+		return provision.ConfigurePodmanAuth(provisioner, authOptions)
+	}
+
+	swarmMaster := h.HostOptions.SwarmOptions != nil && h.HostOptions.SwarmOptions.Master
+	return provision.RotateServerCert(provisioner, authOptions, swarmMaster)
+}
+
 func (h *Host) Provision() error {
+	return h.provision(false)
+}
+
+// ResumeProvision provisions the host again after a provisioning that failed.
+// The Docker engine the failed provisioning installed, as the
+// PackagesInstalled checkpoint tells, is configured without installing its
+// packages again or running the pre-provisioning hook again.
+func (h *Host) ResumeProvision() error {
+	return h.provision(h.HasCheckpoint(CheckpointPackagesInstalled))
+}
+
+func (h *Host) provision(installed bool) error {
+	defer drivers.ReuseSSHConnections(h.Name)()
+
+	if h.HostOptions.MachineOS == provision.WindowsMachineOS && h.HostOptions.CustomInstallScript == "" {
+		return provision.ProvisionWindows(h.Driver, *h.HostOptions.AuthOptions, *h.HostOptions.EngineOptions)
+	}
+
 	provisioner, err := provision.DetectProvisioner(h.Driver)
 	if err != nil {
 		return err
@@ -307,5 +636,44 @@ func (h *Host) Provision() error {
 		return provision.WithCustomScript(provisioner, h.HostOptions.CustomInstallScript, h.HostOptions.HostnameOverride)
 	}
 
-	return provisioner.Provision(*h.HostOptions.SwarmOptions, *h.HostOptions.AuthOptions, *h.HostOptions.EngineOptions)
+	if h.HostOptions.ProvisionEngine == ProvisionEngineK3s {
+		return provision.WithK3s(provisioner, *h.HostOptions.K3sOptions, h.HostOptions.HostnameOverride)
+	}
+
+	if h.HostOptions.ProvisionEngine == ProvisionEngineContainerd {
+		return provision.WithContainerd(provisioner, *h.HostOptions.ContainerdOptions, h.HostOptions.HostnameOverride)
+	}
+
+	installed = installed && h.HostOptions.ProvisionEngine != ProvisionEnginePodman
+
+	if h.HostOptions.PreProvisionHook != "" && !installed {
+		if err := provision.RunHook(h.Driver, provision.PreProvisionHook, h.HostOptions.PreProvisionHook); err != nil {
+			return err
+		}
+	}
+
+	if h.HostOptions.ProvisionEngine == ProvisionEnginePodman {
+		if err := provision.WithPodman(provisioner, *h.HostOptions.AuthOptions, h.HostOptions.HostnameOverride); err != nil {
+			return err
+		}
+	} else {
+		provisionEngine := provision.ProvisionWithProxy
+		if installed {
+			log.Infof("Docker was installed on machine %s already, configuring it", h.Name)
+			provisionEngine = provision.ConfigureInstalledEngine
+		}
+		if err := provisionEngine(provisioner, *h.HostOptions.SwarmOptions, *h.HostOptions.AuthOptions, *h.HostOptions.EngineOptions); err != nil {
+			return err
+		}
+		if h.HostOptions.EngineOptions.NvidiaRuntime {
+			if err := provision.ConfigureNvidiaRuntime(provisioner); err != nil {
+				return err
+			}
+		}
+	}
+
+	if h.HostOptions.PostProvisionHook != "" {
+		return provision.RunHook(h.Driver, provision.PostProvisionHook, h.HostOptions.PostProvisionHook)
+	}
+	return nil
 }
@@ -5,8 +5,12 @@ import (
 
 	"github.com/rancher/machine/drivers/fakedriver"
 	_ "github.com/rancher/machine/drivers/none"
+	"github.com/rancher/machine/libmachine/auth"
+	"github.com/rancher/machine/libmachine/engine"
 	"github.com/rancher/machine/libmachine/provision"
 	"github.com/rancher/machine/libmachine/state"
+	"github.com/rancher/machine/libmachine/swarm"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestValidateHostnameValid(t *testing.T) {
@@ -55,3 +59,60 @@ func TestStart(t *testing.T) {
 		t.Fatalf("Expected no error but got one: %s", err)
 	}
 }
+
+func TestIsPreCEVersion(t *testing.T) {
+	cases := []struct {
+		version string
+		want    bool
+	}{
+		{"1.12.6", true},
+		{"1.13.1", true},
+		{"17.03.0-ce", false},
+		{"24.0.7", false},
+		{"not-a-version", false},
+	}
+
+	for _, tc := range cases {
+		if got := isPreCEVersion(tc.version); got != tc.want {
+			t.Errorf("isPreCEVersion(%q) == %v, want %v", tc.version, got, tc.want)
+		}
+	}
+}
+
+func TestCheckCARotation(t *testing.T) {
+	machine := func(name, caCertPath string, rotation CARotation) *Host {
+		return &Host{Name: name, HostOptions: &Options{CARotation: rotation, AuthOptions: &auth.Options{CaCertPath: caCertPath}}}
+	}
+	machines := []*Host{
+		machine("started", "/certs/ca.pem", StartCARotation),
+		machine("finished", "/certs/ca.pem", FinishCARotation),
+		machine("other-ca", "/other/ca.pem", KeepCA),
+		{Name: "no-docker", HostOptions: &Options{}},
+	}
+
+	assert.NoError(t, CheckCARotation(StartCARotation, "/certs/ca.pem", machines))
+	assert.NoError(t, CheckCARotation(FinishCARotation, "/certs/ca.pem", machines))
+	assert.EqualError(t, CheckCARotation(EndCARotation, "/certs/ca.pem", machines), "the CA rotation cannot end before the machines started of the CA /certs/ca.pem finish it")
+	assert.EqualError(t, CheckCARotation(FinishCARotation, "/other/ca.pem", machines), "the CA rotation cannot finish before the machines other-ca of the CA /other/ca.pem start it")
+}
+
+func TestResumeProvisionSkipsTheInstall(t *testing.T) {
+	defer provision.SetDetector(&provision.StandardDetector{})
+	provision.SetDetector(&provision.FakeDetector{Provisioner: provision.NewFakeProvisioner(nil)})
+
+	h := &Host{
+		Name:   "resumed",
+		Driver: &fakedriver.Driver{MockName: "resumed"},
+		HostOptions: &Options{
+			EngineOptions: &engine.Options{},
+			SwarmOptions:  &swarm.Options{},
+			AuthOptions:   &auth.Options{},
+		},
+	}
+	assert.NoError(t, h.ResumeProvision())
+
+	// The engine installed already is configured rather than provisioned,
+	// which the fake provisioner cannot do.
+	h.AddCheckpoint(CheckpointPackagesInstalled)
+	assert.EqualError(t, h.ResumeProvision(), "the engine of fakeprovisioner machines cannot be configured")
+}
@@ -0,0 +1,25 @@
+package k3s
+
+const (
+	DefaultInstallURL = "https://get.k3s.io"
+	RoleServer        = "server"
+	RoleAgent         = "agent"
+)
+
+// Options configure the k3s a machine is provisioned with instead of the
+// Docker engine.
+type Options struct {
+	// Role is server or agent. An agent joins the cluster of the server at
+	// ServerURL with the Token of the cluster.
+	Role      string
+	Channel   string
+	Version   string
+	ServerURL string `json:",omitempty"`
+	// Token is not saved with the machine: it is only kept in a file
+	// readable by root on the machine, which later provisionings reuse.
+	Token string `json:"-"`
+	// RegistriesFile is the path of the registries.yaml installed on the
+	// machine, if any.
+	RegistriesFile string `json:",omitempty"`
+	InstallURL     string
+}
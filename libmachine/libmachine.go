@@ -1,6 +1,7 @@
 package libmachine
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"path/filepath"
@@ -16,8 +17,10 @@ import (
 	"github.com/rancher/machine/libmachine/host"
 	"github.com/rancher/machine/libmachine/log"
 	"github.com/rancher/machine/libmachine/mcnerror"
+	"github.com/rancher/machine/libmachine/mcnflag"
 	"github.com/rancher/machine/libmachine/mcnutils"
 	"github.com/rancher/machine/libmachine/persist"
+	"github.com/rancher/machine/libmachine/progress"
 	"github.com/rancher/machine/libmachine/provision"
 	"github.com/rancher/machine/libmachine/ssh"
 	"github.com/rancher/machine/libmachine/state"
@@ -29,6 +32,8 @@ type API interface {
 	io.Closer
 	NewHost(driverName string, rawDriver []byte) (*host.Host, error)
 	Create(h *host.Host) error
+	// Resume resumes the provisioning of a host whose creation failed.
+	Resume(h *host.Host) error
 	persist.Store
 	GetMachinesDir() string
 }
@@ -38,6 +43,9 @@ type Client struct {
 	IsDebug        bool
 	SSHClientType  ssh.ClientType
 	GithubAPIToken string
+	// Progress, if set, receives the progress events of Create instead of
+	// the default handler, which logs their banners.
+	Progress progress.Func
 	persist.Store
 	clientDriverFactory rpcdriver.RPCClientDriverFactory
 }
@@ -52,8 +60,22 @@ func NewClient(storePath, certsDir string) *Client {
 	}
 }
 
+// newDriver returns the named driver configured with rawDriver, running in
+// this process if it can, or else as a plugin.
+func (api *Client) newDriver(driverName string, rawDriver []byte) (drivers.Driver, error) {
+	if d, ok, err := rpcdriver.NewInProcessDriver(driverName, rawDriver); ok {
+		return d, err
+	}
+
+	d, err := api.clientDriverFactory.NewRPCClientDriver(driverName, rawDriver)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
 func (api *Client) NewHost(driverName string, rawDriver []byte) (*host.Host, error) {
-	driver, err := api.clientDriverFactory.NewRPCClientDriver(driverName, rawDriver)
+	driver, err := api.newDriver(driverName, rawDriver)
 	if err != nil {
 		return nil, err
 	}
@@ -87,13 +109,98 @@ func (api *Client) NewHost(driverName string, rawDriver []byte) (*host.Host, err
 	}, nil
 }
 
+// DriverFlagSchema describes the create flags of the named driver.
+func (api *Client) DriverFlagSchema(driverName string) ([]mcnflag.Schema, error) {
+	return DriverFlagSchema(api, driverName)
+}
+
+// DriverFlagSchema describes the create flags of the named driver, launching
+// its plugin through api. Nothing is read from or written to the store.
+func DriverFlagSchema(api API, driverName string) ([]mcnflag.Schema, error) {
+	rawDriver, err := json.Marshal(&drivers.BaseDriver{MachineName: "temp-driver-loader"})
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling base driver: %s", err)
+	}
+
+	h, err := api.NewHost(driverName, rawDriver)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseDriver(h.Driver)
+
+	return drivers.GetFlagSchema(h.Driver), nil
+}
+
+// CloseDriver stops the plugin of a driver only launched to be described
+// or probed, rather than leaving it running until the API is closed.
+func CloseDriver(d drivers.Driver) {
+	closer, ok := d.(io.Closer)
+	if !ok {
+		return
+	}
+	if err := closer.Close(); err != nil {
+		log.Debugf("Error closing the driver plugin: %s", err)
+	}
+}
+
+// PluginInfo describes an installed driver plugin. Error is set when the
+// plugin could not be launched.
+type PluginInfo struct {
+	DriverName string
+	Path       string
+	APIVersion int `json:",omitempty"`
+	Flags      []mcnflag.Schema
+	Error      string `json:",omitempty"`
+}
+
+// ListPlugins describes the driver plugins installed on this host.
+func (api *Client) ListPlugins() []PluginInfo {
+	return DescribePlugins(api, localbinary.InstalledPlugins())
+}
+
+// DescribePlugins briefly launches each plugin through api to ask for its
+// API version and create flags, closing it once described. A plugin that
+// fails to launch is reported with its error instead of aborting the
+// listing.
+func DescribePlugins(api API, plugins []localbinary.InstalledPlugin) []PluginInfo {
+	rawDriver, err := json.Marshal(&drivers.BaseDriver{MachineName: "temp-driver-loader"})
+	if err != nil {
+		rawDriver = []byte("{}")
+	}
+
+	infos := make([]PluginInfo, 0, len(plugins))
+	for _, plugin := range plugins {
+		info := PluginInfo{DriverName: plugin.DriverName, Path: plugin.Path, Flags: []mcnflag.Schema{}}
+
+		// Launch the binary that was found rather than resolving the name
+		// again.
+		h, err := api.NewHost(plugin.Path, rawDriver)
+		switch {
+		case err != nil:
+			info.Error = err.Error()
+		case h == nil || h.Driver == nil:
+			info.Error = fmt.Sprintf("Driver %q could not be loaded", plugin.DriverName)
+		default:
+			if versioned, ok := h.Driver.(interface{ APIVersion() int }); ok {
+				info.APIVersion = versioned.APIVersion()
+			}
+			info.Flags = drivers.GetFlagSchema(h.Driver)
+			CloseDriver(h.Driver)
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos
+}
+
 func (api *Client) Load(name string) (*host.Host, error) {
 	h, err := api.Store.Load(name)
 	if err != nil {
 		return nil, err
 	}
 
-	d, err := api.clientDriverFactory.NewRPCClientDriver(h.DriverName, h.RawDriver)
+	d, err := api.newDriver(h.DriverName, h.RawDriver)
 	if err != nil {
 		// Not being able to find a driver binary is a "known error"
 		if _, ok := err.(localbinary.ErrPluginBinaryNotFound); ok {
@@ -109,19 +216,86 @@ func (api *Client) Load(name string) (*host.Host, error) {
 		h.Driver = d
 	}
 
+	api.shareSSHConnections(h)
+	api.verifySSHHostKeys(h)
+	api.setSSHAlgorithms(h)
+	api.setSSHCertAuthorities(h)
+
 	return h, nil
 }
 
+// shareSSHConnections registers the machine directory of h as the home of its
+// SSH control sockets, if the machine shares its SSH connections.
+func (api *Client) shareSSHConnections(h *host.Host) {
+	if h.HostOptions != nil && h.HostOptions.SSHConnectionSharing {
+		drivers.ShareSSHConnections(h.Name, filepath.Join(api.GetMachinesDir(), h.Name))
+	}
+}
+
+// verifySSHHostKeys makes the SSH clients of h verify its host key against
+// the known_hosts file of its machine directory.
+func (api *Client) verifySSHHostKeys(h *host.Host) {
+	drivers.VerifySSHHostKeys(h.Name, filepath.Join(api.GetMachinesDir(), h.Name, ssh.KnownHostsFile))
+}
+
+// setSSHAlgorithms makes the SSH clients of h offer the algorithms of its
+// options.
+func (api *Client) setSSHAlgorithms(h *host.Host) {
+	if h.HostOptions != nil && h.HostOptions.SSHAlgorithms != nil {
+		drivers.SetSSHAlgorithms(h.Name, *h.HostOptions.SSHAlgorithms)
+	}
+}
+
+// setSSHCertAuthorities makes the SSH clients of h authenticate with the
+// certificates signed by its user CA and verify its host certificate with
+// its host CA, from its options or the environment.
+func (api *Client) setSSHCertAuthorities(h *host.Host) {
+	var authorities ssh.CertAuthorities
+	if h.HostOptions != nil && h.HostOptions.SSHCertAuthorities != nil {
+		authorities = *h.HostOptions.SSHCertAuthorities
+	}
+	authorities = authorities.WithEnv()
+	if authorities.IsZero() {
+		return
+	}
+
+	var userSigner ssh.UserCertSigner
+	if authorities.UserCAKey != "" {
+		userSigner = &ssh.FileUserCertSigner{KeyPath: authorities.UserCAKey, Validity: authorities.UserCertValidity}
+	}
+	var hostCA *ssh.HostCA
+	if authorities.HostCAKey != "" {
+		hostCA = &ssh.HostCA{
+			KeyPath:        authorities.HostCAKey,
+			KnownHostsPath: filepath.Join(api.GetMachinesDir(), h.Name, ssh.HostCAKnownHostsFile),
+		}
+	}
+	drivers.SetSSHCertAuthorities(h.Name, userSigner, hostCA)
+}
+
 // Create is the wrapper method which covers all of the boilerplate around
 // actually creating, provisioning, and persisting an instance in the store.
-func (api *Client) Create(h *host.Host) error {
-	if h.HostOptions.CustomInstallScript == "" {
+func (api *Client) Create(h *host.Host) (err error) {
+	defer api.subscribeCheckpoints(h)()
+
+	steps := progress.NewTracker(h.Name)
+	defer func() { steps.Done(err) }()
+
+	api.shareSSHConnections(h)
+	api.verifySSHHostKeys(h)
+	api.setSSHAlgorithms(h)
+	api.setSSHCertAuthorities(h)
+	// The commands of the whole create reuse one SSH connection.
+	defer drivers.ReuseSSHConnections(h.Name)()
+
+	if h.HostOptions.AuthOptions != nil {
+		steps.Start(progress.GeneratingCerts, "")
 		if err := cert.BootstrapCertificates(h.AuthOptions()); err != nil {
 			return fmt.Errorf("Error generating certificates: %s", err)
 		}
 	}
 
-	log.Info("Running pre-create checks...")
+	steps.Start(progress.PreCreateCheck, "Running pre-create checks...")
 
 	if err := h.Driver.PreCreateCheck(); err != nil {
 		return mcnerror.ErrDuringPreCreate{
@@ -133,17 +307,11 @@ func (api *Client) Create(h *host.Host) error {
 		return fmt.Errorf("Error saving host to store before attempting creation: %s", err)
 	}
 
-	log.Info("Creating machine...")
+	steps.Start(progress.CreatingMachine, "Creating machine...")
 
-	if err := api.performCreate(h); err != nil {
-		if h.Driver.DriverName() == "vmwarevsphere" {
-			// it is possible that the VM is instantiated but fails to bootstrap,
-			// save the machine to the store, so the VM and associated resources can be found and destroyed later
-			if err := api.Save(h); err != nil {
-				log.Warnf("Error saving host to store after creation fails: %s", err)
-			}
-		}
-		return fmt.Errorf("Error creating machine: %s", err)
+	if err := api.performCreate(h, steps); err != nil {
+		api.rollbackCreate(h)
+		return fmt.Errorf("Error creating machine: %w", err)
 	}
 
 	log.Debug("Reticulating splines...")
@@ -151,9 +319,45 @@ func (api *Client) Create(h *host.Host) error {
 	return nil
 }
 
-func (api *Client) performCreate(h *host.Host) error {
+// rollbackCreate cleans up after performCreate failed. By then the driver has
+// been asked to create the machine, so cloud resources may exist; they are
+// removed on a best-effort basis unless KeepOnError is set. The host is always
+// saved in the Error lifecycle state so that 'rm' can retry the cleanup.
+func (api *Client) rollbackCreate(h *host.Host) {
+	h.LifecycleState = host.LifecycleError
+
+	if h.HostOptions.KeepOnError {
+		log.Infof("Keeping the resources of machine %q, resume its provisioning with 'provision --resume' or remove them with 'rm' when done", h.Name)
+	} else {
+		log.Info("Removing the resources created for the machine...")
+		if err := removeDriver(h.Driver); err != nil {
+			log.Warnf("Error removing the resources created for the machine, remove them with 'rm': %s", err)
+		} else {
+			// There is nothing left to resume.
+			h.Checkpoints = nil
+		}
+	}
+
+	if err := api.Save(h); err != nil {
+		log.Warnf("Error saving host to store after creation failed: %s", err)
+	}
+}
+
+// removeDriver calls Remove on d, turning a panic into an error so that a
+// broken driver cannot abort the rollback.
+func removeDriver(d drivers.Driver) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic in the driver: %v", r)
+		}
+	}()
+
+	return d.Remove()
+}
+
+func (api *Client) performCreate(h *host.Host, steps *progress.Tracker) error {
 	if err := h.Driver.Create(); err != nil {
-		return fmt.Errorf("Error in driver during machine creation: %s", err)
+		return fmt.Errorf("Error in driver during machine creation: %w", err)
 	}
 
 	if err := api.Save(h); err != nil {
@@ -165,7 +369,7 @@ func (api *Client) performCreate(h *host.Host) error {
 		return nil
 	}
 
-	log.Info("Waiting for machine to be running, this may take a few minutes...")
+	steps.Start(progress.WaitingForInstance, "Waiting for machine to be running, this may take a few minutes...")
 	if err := mcnutils.WaitFor(drivers.MachineInState(h.Driver, state.Running)); err != nil {
 		return fmt.Errorf("Error waiting for machine to be running: %s", err)
 	}
@@ -175,25 +379,78 @@ func (api *Client) performCreate(h *host.Host) error {
 		return nil
 	}
 
-	log.Info("Detecting operating system of created instance...")
+	if h.HostOptions.MachineOS == provision.WindowsMachineOS && h.HostOptions.CustomInstallScript == "" {
+		steps.Start(progress.Provisioning, "Provisioning the Windows machine over SSH...")
+		if err := drivers.WaitForSSH(h.Driver); err != nil {
+			return err
+		}
+		if err := provision.ProvisionWindows(h.Driver, *h.HostOptions.AuthOptions, *h.HostOptions.EngineOptions); err != nil {
+			return err
+		}
+		return checkDocker(h, steps)
+	}
+
+	if err := provision.InstallSSHKey(h.Driver); err != nil {
+		return err
+	}
+
+	steps.Start(progress.DetectingOS, "Detecting operating system of created instance...")
 	provisioner, err := provision.DetectProvisioner(h.Driver)
 	if err != nil {
 		return fmt.Errorf("Error detecting OS: %s", err)
 	}
 
-	log.Infof("Provisioning with %s...", provisioner.String())
+	steps.Start(progress.Provisioning, fmt.Sprintf("Provisioning with %s...", provisioner.String()))
 	if h.HostOptions.CustomInstallScript != "" {
-		log.Infof("Provisioning with custom install script via SSH, not installing Docker...")
+		steps.Start(progress.RunningCustomScript, "Provisioning with custom install script via SSH, not installing Docker...")
 		return provision.WithCustomScript(provisioner, h.HostOptions.CustomInstallScript, h.HostOptions.HostnameOverride)
+	} else if h.HostOptions.ProvisionEngine == host.ProvisionEngineK3s {
+		steps.Start(progress.InstallingK3s, "Installing k3s...")
+		return provision.WithK3s(provisioner, *h.HostOptions.K3sOptions, h.HostOptions.HostnameOverride)
+	} else if h.HostOptions.ProvisionEngine == host.ProvisionEngineContainerd {
+		steps.Start(progress.InstallingContainerd, "Installing containerd...")
+		return provision.WithContainerd(provisioner, *h.HostOptions.ContainerdOptions, h.HostOptions.HostnameOverride)
+	}
+
+	if h.HostOptions.PreProvisionHook != "" {
+		steps.Start(progress.RunningHook, "Running the pre-provisioning hook...")
+		if err := provision.RunHook(h.Driver, provision.PreProvisionHook, h.HostOptions.PreProvisionHook); err != nil {
+			return err
+		}
+	}
+
+	if h.HostOptions.ProvisionEngine == host.ProvisionEnginePodman {
+		steps.Start(progress.InstallingPodman, "Installing Podman...")
+		if err := provision.WithPodman(provisioner, *h.HostOptions.AuthOptions, h.HostOptions.HostnameOverride); err != nil {
+			return err
+		}
 	} else {
-		if err := provisioner.Provision(*h.HostOptions.SwarmOptions, *h.HostOptions.AuthOptions, *h.HostOptions.EngineOptions); err != nil {
+		if err := provision.ProvisionWithProxy(provisioner, *h.HostOptions.SwarmOptions, *h.HostOptions.AuthOptions, *h.HostOptions.EngineOptions); err != nil {
 			return err
 		}
 	}
 
-	// We should check the connection to docker here
-	log.Info("Checking connection to Docker...")
-	if _, _, err = check.DefaultConnChecker.Check(h, false); err != nil {
+	if h.HostOptions.EngineOptions != nil && h.HostOptions.EngineOptions.NvidiaRuntime {
+		steps.Start(progress.ConfiguringGPU, "Configuring the NVIDIA container runtime...")
+		if err := provision.ConfigureNvidiaRuntime(provisioner); err != nil {
+			return err
+		}
+	}
+
+	if h.HostOptions.PostProvisionHook != "" {
+		steps.Start(progress.RunningHook, "Running the post-provisioning hook...")
+		if err := provision.RunHook(h.Driver, provision.PostProvisionHook, h.HostOptions.PostProvisionHook); err != nil {
+			return err
+		}
+	}
+
+	return checkDocker(h, steps)
+}
+
+// checkDocker checks the connection to the engine of the provisioned host.
+func checkDocker(h *host.Host, steps *progress.Tracker) error {
+	steps.Start(progress.CheckingDocker, "Checking connection to Docker...")
+	if _, _, err := check.DefaultConnChecker.Check(h, false); err != nil {
 		return fmt.Errorf("Error checking the host: %s", err)
 	}
 
@@ -201,6 +458,14 @@ func (api *Client) performCreate(h *host.Host) error {
 	return nil
 }
 
+// ReconnectPlugins makes the drivers loaded from now on relaunch their
+// plugin when it dies, retrying idempotent calls like GetState.
+func (api *Client) ReconnectPlugins(opts rpcdriver.ReconnectOptions) {
+	if f, ok := api.clientDriverFactory.(*rpcdriver.DefaultRPCClientDriverFactory); ok {
+		f.SetReconnect(opts)
+	}
+}
+
 func (api *Client) Close() error {
 	return api.clientDriverFactory.Close()
 }
@@ -0,0 +1,255 @@
+package libmachine
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/machine/drivers/fakedriver"
+	"github.com/rancher/machine/libmachine/auth"
+	"github.com/rancher/machine/libmachine/check"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/drivers/plugin/localbinary"
+	"github.com/rancher/machine/libmachine/engine"
+	"github.com/rancher/machine/libmachine/host"
+	"github.com/rancher/machine/libmachine/persist/persisttest"
+	"github.com/rancher/machine/libmachine/progress"
+	"github.com/rancher/machine/libmachine/provision"
+	"github.com/rancher/machine/libmachine/state"
+	"github.com/rancher/machine/libmachine/swarm"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingDriver struct {
+	*fakedriver.Driver
+	preCreateErr, createErr, removeErr error
+	removeCalls                        int
+}
+
+func (d *failingDriver) PreCreateCheck() error {
+	return d.preCreateErr
+}
+
+func (d *failingDriver) Create() error {
+	return d.createErr
+}
+
+func (d *failingDriver) Remove() error {
+	d.removeCalls++
+	return d.removeErr
+}
+
+func newFailingHost(d drivers.Driver, keepOnError bool) *host.Host {
+	return &host.Host{
+		Name:   "failing",
+		Driver: d,
+		HostOptions: &host.Options{
+			// Skips certificate generation.
+			CustomInstallScript: "install.sh",
+			KeepOnError:         keepOnError,
+		},
+	}
+}
+
+func TestCreateRollback(t *testing.T) {
+	testCases := []struct {
+		description     string
+		driver          *failingDriver
+		keepOnError     bool
+		wantRemoveCalls int
+	}{
+		{
+			description:     "rollback succeeds",
+			driver:          &failingDriver{Driver: &fakedriver.Driver{}, createErr: errors.New("quota exceeded")},
+			wantRemoveCalls: 1,
+		},
+		{
+			description:     "rollback fails",
+			driver:          &failingDriver{Driver: &fakedriver.Driver{}, createErr: errors.New("quota exceeded"), removeErr: errors.New("API unavailable")},
+			wantRemoveCalls: 1,
+		},
+		{
+			description:     "keep on error",
+			driver:          &failingDriver{Driver: &fakedriver.Driver{}, createErr: errors.New("quota exceeded")},
+			keepOnError:     true,
+			wantRemoveCalls: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		store := &persisttest.FakeStore{}
+		api := &Client{Store: store}
+		h := newFailingHost(tc.driver, tc.keepOnError)
+
+		err := api.Create(h)
+
+		assert.EqualError(t, err, "Error creating machine: Error in driver during machine creation: quota exceeded", tc.description)
+		assert.Equal(t, tc.wantRemoveCalls, tc.driver.removeCalls, tc.description)
+		assert.Equal(t, host.LifecycleError, h.LifecycleState, tc.description)
+		assert.Contains(t, store.Hosts, h, tc.description)
+	}
+}
+
+func TestCreateNoRollbackBeforeDriverCreate(t *testing.T) {
+	store := &persisttest.FakeStore{}
+	api := &Client{Store: store}
+	d := &failingDriver{Driver: &fakedriver.Driver{}, preCreateErr: errors.New("invalid region")}
+	h := newFailingHost(d, false)
+
+	err := api.Create(h)
+
+	assert.Error(t, err)
+	assert.Equal(t, 0, d.removeCalls)
+	assert.Empty(t, h.LifecycleState)
+	assert.Empty(t, store.Hosts)
+}
+
+func TestRemoveDriverPanic(t *testing.T) {
+	err := removeDriver(&panickingDriver{&fakedriver.Driver{}})
+
+	assert.EqualError(t, err, "panic in the driver: boom")
+}
+
+type panickingDriver struct {
+	*fakedriver.Driver
+}
+
+func (d *panickingDriver) Remove() error {
+	panic("boom")
+}
+
+type fakeConnChecker struct{}
+
+func (fakeConnChecker) Check(_ *host.Host, _ bool) (string, *auth.Options, error) {
+	return "tcp://1.2.3.4:2376", nil, nil
+}
+
+func newProgressHost(t *testing.T, d drivers.Driver) *host.Host {
+	certDir := t.TempDir()
+	return &host.Host{
+		Name:   "progress",
+		Driver: d,
+		HostOptions: &host.Options{
+			AuthOptions: &auth.Options{
+				CertDir:          certDir,
+				CaCertPath:       filepath.Join(certDir, "ca.pem"),
+				CaPrivateKeyPath: filepath.Join(certDir, "ca-key.pem"),
+				ClientCertPath:   filepath.Join(certDir, "cert.pem"),
+				ClientKeyPath:    filepath.Join(certDir, "key.pem"),
+			},
+			EngineOptions: &engine.Options{},
+			SwarmOptions:  &swarm.Options{},
+		},
+	}
+}
+
+type recordedStep struct {
+	Type progress.EventType
+	Step string
+}
+
+func recordProgress(api *Client) *[]progress.Event {
+	events := &[]progress.Event{}
+	api.Progress = func(ev progress.Event) {
+		*events = append(*events, ev)
+	}
+	return events
+}
+
+func stepsOf(events []progress.Event) []recordedStep {
+	steps := []recordedStep{}
+	for _, ev := range events {
+		steps = append(steps, recordedStep{ev.Type, ev.Step})
+	}
+	return steps
+}
+
+func TestCreateProgress(t *testing.T) {
+	defer provision.SetDetector(&provision.StandardDetector{})
+	provision.SetDetector(&provision.FakeDetector{Provisioner: provision.NewFakeProvisioner(nil)})
+	defer func(orig check.ConnChecker) { check.DefaultConnChecker = orig }(check.DefaultConnChecker)
+	check.DefaultConnChecker = fakeConnChecker{}
+
+	api := &Client{Store: &persisttest.FakeStore{}}
+	events := recordProgress(api)
+	d := &fakedriver.Driver{MockState: state.Running, MockName: "progress"}
+
+	err := api.Create(newProgressHost(t, d))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []recordedStep{
+		{progress.StepStarted, progress.GeneratingCerts},
+		{progress.StepCompleted, progress.GeneratingCerts},
+		{progress.StepStarted, progress.PreCreateCheck},
+		{progress.StepCompleted, progress.PreCreateCheck},
+		{progress.StepStarted, progress.CreatingMachine},
+		{progress.StepCompleted, progress.CreatingMachine},
+		{progress.StepStarted, progress.WaitingForInstance},
+		{progress.StepCompleted, progress.WaitingForInstance},
+		{progress.StepStarted, progress.DetectingOS},
+		{progress.StepCompleted, progress.DetectingOS},
+		{progress.StepStarted, progress.Provisioning},
+		{progress.StepCompleted, progress.Provisioning},
+		{progress.StepStarted, progress.CheckingDocker},
+		{progress.StepCompleted, progress.CheckingDocker},
+	}, stepsOf(*events))
+}
+
+func TestCreateProgressFailure(t *testing.T) {
+	api := &Client{Store: &persisttest.FakeStore{}}
+	events := recordProgress(api)
+	d := &failingDriver{Driver: &fakedriver.Driver{}, createErr: errors.New("quota exceeded")}
+
+	err := api.Create(newProgressHost(t, d))
+
+	assert.Error(t, err)
+	assert.Equal(t, []recordedStep{
+		{progress.StepStarted, progress.GeneratingCerts},
+		{progress.StepCompleted, progress.GeneratingCerts},
+		{progress.StepStarted, progress.PreCreateCheck},
+		{progress.StepCompleted, progress.PreCreateCheck},
+		{progress.StepStarted, progress.CreatingMachine},
+		{progress.StepFailed, progress.CreatingMachine},
+	}, stepsOf(*events))
+
+	failure := (*events)[len(*events)-1]
+	assert.Equal(t, "progress", failure.Machine)
+	assert.Equal(t, err.Error(), failure.Error)
+}
+
+// closingDriver counts how many times its plugin was closed.
+type closingDriver struct {
+	*fakedriver.Driver
+	closed int
+}
+
+func (d *closingDriver) Close() error {
+	d.closed++
+	return nil
+}
+
+// describingAPI creates hosts of its driver, to describe it.
+type describingAPI struct {
+	API
+	driver drivers.Driver
+}
+
+func (api *describingAPI) NewHost(driverName string, rawDriver []byte) (*host.Host, error) {
+	return &host.Host{Driver: api.driver}, nil
+}
+
+func TestDescribedPluginsAreClosed(t *testing.T) {
+	d := &closingDriver{Driver: &fakedriver.Driver{}}
+	api := &describingAPI{driver: d}
+
+	_, err := DriverFlagSchema(api, "fake")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, d.closed)
+
+	infos := DescribePlugins(api, []localbinary.InstalledPlugin{
+		{DriverName: "fake", Path: "/plugins/rancher-machine-driver-fake"},
+		{DriverName: "other", Path: "/plugins/rancher-machine-driver-other"},
+	})
+	assert.Len(t, infos, 2)
+	assert.Equal(t, 3, d.closed)
+}
@@ -0,0 +1,162 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Levels of a Frame.
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+// Frame is a log entry a driver plugin writes as a line of JSON, for the
+// machine binary to log it at its level:
+//
+//	{"time":"2024-01-02T15:04:05Z","level":"warn","msg":"Quota almost reached","fields":{"region":"fsn1"}}
+type Frame struct {
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Message string                 `json:"msg"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+// String returns the message of the frame followed by its fields, sorted by
+// name.
+func (f Frame) String() string {
+	if len(f.Fields) == 0 {
+		return f.Message
+	}
+
+	names := make([]string, 0, len(f.Fields))
+	for name := range f.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := []string{f.Message}
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=%v", name, f.Fields[name]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// ParseFrame decodes a line written by a FrameMachineLogger. It returns false
+// for any other line, e.g. the plain output of older plugins.
+func ParseFrame(line string) (Frame, bool) {
+	var f Frame
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "{") {
+		return f, false
+	}
+	if err := json.Unmarshal([]byte(line), &f); err != nil || f.Level == "" {
+		return f, false
+	}
+	return f, true
+}
+
+// FrameMachineLogger writes each entry as a Frame, the format driver plugins
+// log in when the machine binary asks for it.
+type FrameMachineLogger struct {
+	writer  io.Writer
+	debug   bool
+	history *HistoryRecorder
+}
+
+// NewFrameMachineLogger creates a MachineLogger writing frames to w.
+func NewFrameMachineLogger(w io.Writer) MachineLogger {
+	return &FrameMachineLogger{
+		writer:  w,
+		debug:   false,
+		history: NewHistoryRecorder(),
+	}
+}
+
+func (ml *FrameMachineLogger) write(level, message string) {
+	data, err := json.Marshal(Frame{
+		Time:    time.Now().UTC(),
+		Level:   level,
+		Message: strings.TrimSuffix(message, "\n"),
+	})
+	if err != nil {
+		return
+	}
+	ml.writer.Write(append(data, '\n'))
+}
+
+func (ml *FrameMachineLogger) SetDebug(debug bool) {
+	ml.debug = debug
+}
+
+// SetOutWriter sets where frames of every level are written.
+func (ml *FrameMachineLogger) SetOutWriter(out io.Writer) {
+	ml.writer = out
+}
+
+// SetErrWriter does nothing: errors are written with the other frames.
+func (ml *FrameMachineLogger) SetErrWriter(err io.Writer) {}
+
+func (ml *FrameMachineLogger) Debug(args ...interface{}) {
+	ml.history.Record(args...)
+	if ml.debug {
+		ml.write(LevelDebug, fmt.Sprintln(args...))
+	}
+}
+
+func (ml *FrameMachineLogger) Debugf(fmtString string, args ...interface{}) {
+	ml.history.Recordf(fmtString, args...)
+	if ml.debug {
+		ml.write(LevelDebug, fmt.Sprintf(fmtString, args...))
+	}
+}
+
+func (ml *FrameMachineLogger) Error(args ...interface{}) {
+	ml.history.Record(args...)
+	ml.write(LevelError, fmt.Sprintln(args...))
+}
+
+func (ml *FrameMachineLogger) Errorf(fmtString string, args ...interface{}) {
+	ml.history.Recordf(fmtString, args...)
+	ml.write(LevelError, fmt.Sprintf(fmtString, args...))
+}
+
+func (ml *FrameMachineLogger) Info(args ...interface{}) {
+	ml.history.Record(args...)
+	ml.write(LevelInfo, fmt.Sprintln(args...))
+}
+
+func (ml *FrameMachineLogger) Infof(fmtString string, args ...interface{}) {
+	ml.history.Recordf(fmtString, args...)
+	ml.write(LevelInfo, fmt.Sprintf(fmtString, args...))
+}
+
+func (ml *FrameMachineLogger) Warn(args ...interface{}) {
+	ml.history.Record(args...)
+	ml.write(LevelWarn, fmt.Sprintln(args...))
+}
+
+func (ml *FrameMachineLogger) Warnf(fmtString string, args ...interface{}) {
+	ml.history.Recordf(fmtString, args...)
+	ml.write(LevelWarn, fmt.Sprintf(fmtString, args...))
+}
+
+func (ml *FrameMachineLogger) History() []string {
+	return ml.history.records
+}
+
+// SetFrameOutput makes the package level functions write frames to w,
+// keeping the debug setting.
+func SetFrameOutput(w io.Writer) {
+	framed := NewFrameMachineLogger(w)
+	if fml, ok := logger.(*FmtMachineLogger); ok {
+		framed.SetDebug(fml.debug)
+	}
+	logger = framed
+}
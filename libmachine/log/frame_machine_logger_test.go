@@ -0,0 +1,52 @@
+package log
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrameMachineLoggerLevels(t *testing.T) {
+	out := &bytes.Buffer{}
+	testLogger := NewFrameMachineLogger(out)
+
+	testLogger.Debug("hidden")
+	testLogger.SetDebug(true)
+	testLogger.Debugf("creating %s", "server")
+	testLogger.Info("created")
+	testLogger.Warnf("%d%% of the quota used", 90)
+	testLogger.Error("failed")
+
+	var frames []Frame
+	for _, line := range bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n")) {
+		frame, ok := ParseFrame(string(line))
+		assert.True(t, ok, string(line))
+		assert.False(t, frame.Time.IsZero())
+		frames = append(frames, Frame{Level: frame.Level, Message: frame.Message})
+	}
+
+	assert.Equal(t, []Frame{
+		{Level: LevelDebug, Message: "creating server"},
+		{Level: LevelInfo, Message: "created"},
+		{Level: LevelWarn, Message: "90% of the quota used"},
+		{Level: LevelError, Message: "failed"},
+	}, frames)
+	assert.Equal(t, []string{"hidden", "creating server", "created", "90% of the quota used", "failed"}, testLogger.History())
+}
+
+func TestParseFrame(t *testing.T) {
+	frame, ok := ParseFrame(`{"time":"2024-01-02T15:04:05Z","level":"warn","msg":"Quota almost reached","fields":{"region":"fsn1","used":90}}`)
+	assert.True(t, ok)
+	assert.Equal(t, LevelWarn, frame.Level)
+	assert.Equal(t, "Quota almost reached region=fsn1 used=90", frame.String())
+
+	for _, line := range []string{
+		"Creating server...",
+		`{"msg":"no level"}`,
+		`{"level":`,
+	} {
+		_, ok := ParseFrame(line)
+		assert.False(t, ok, line)
+	}
+}
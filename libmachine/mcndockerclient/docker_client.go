@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/rancher/machine/libmachine/cert"
+	"github.com/rancher/machine/libmachine/ssh"
 	"github.com/samalba/dockerclient"
 )
 
@@ -22,6 +23,29 @@ func DockerClient(dockerHost DockerHost) (*dockerclient.DockerClient, error) {
 	return dockerclient.NewDockerClient(url, tlsConfig)
 }
 
+// Forwarder forwards the connections to a local address to one on the
+// machine, like the libmachine hosts do over their SSH connection.
+type Forwarder interface {
+	LocalForward(localAddr, remoteAddr string) (*ssh.Tunnel, error)
+}
+
+// TunneledDockerClient creates a docker client for a daemon listening on
+// remoteAddr on the machine without TLS, like localhost:2375 or
+// /var/run/docker.sock, through a tunnel the caller closes when done.
+func TunneledDockerClient(forwarder Forwarder, remoteAddr string) (*dockerclient.DockerClient, *ssh.Tunnel, error) {
+	tunnel, err := forwarder.LocalForward("127.0.0.1:0", remoteAddr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to forward %s: %s", remoteAddr, err)
+	}
+
+	docker, err := dockerclient.NewDockerClient("tcp://"+tunnel.Addr().String(), nil)
+	if err != nil {
+		tunnel.Close()
+		return nil, nil, err
+	}
+	return docker, tunnel, nil
+}
+
 // CreateContainer creates a docker container.
 func CreateContainer(dockerHost DockerHost, config *dockerclient.ContainerConfig, name string) error {
 	docker, err := DockerClient(dockerHost)
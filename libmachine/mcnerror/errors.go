@@ -36,6 +36,10 @@ func (e ErrDuringPreCreate) Error() string {
 	return fmt.Sprintf("Error with pre-create check: %q", e.Cause)
 }
 
+func (e ErrDuringPreCreate) Unwrap() error {
+	return e.Cause
+}
+
 type ErrHostAlreadyInState struct {
 	Name  string
 	State state.State
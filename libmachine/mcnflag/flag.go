@@ -12,6 +12,20 @@ type StringFlag struct {
 	Usage  string
 	EnvVar string
 	Value  string
+
+	// Sensitive marks credentials. A --<name>-file companion flag is
+	// generated for them so the value can be kept out of the command line.
+	Sensitive bool
+
+	// Options are the values the flag accepts, when it is an enum.
+	Options []string
+	// Pattern is a regular expression the whole value must match.
+	Pattern string
+	// Required flags must be given a value.
+	Required bool
+	// Group names the section of the forms built from the flags the flag
+	// belongs to.
+	Group string
 }
 
 // TODO: Could this be done more succinctly using embedding?
@@ -24,10 +38,12 @@ func (f StringFlag) Default() interface{} {
 }
 
 type StringSliceFlag struct {
-	Name   string
-	Usage  string
-	EnvVar string
-	Value  []string
+	Name     string
+	Usage    string
+	EnvVar   string
+	Value    []string
+	Required bool
+	Group    string
 }
 
 // TODO: Could this be done more succinctly using embedding?
@@ -44,6 +60,7 @@ type IntFlag struct {
 	Usage  string
 	EnvVar string
 	Value  int
+	Group  string
 }
 
 // TODO: Could this be done more succinctly using embedding?
@@ -59,6 +76,7 @@ type BoolFlag struct {
 	Name   string
 	Usage  string
 	EnvVar string
+	Group  string
 }
 
 // TODO: Could this be done more succinctly using embedding?
@@ -69,3 +87,20 @@ func (f BoolFlag) String() string {
 func (f BoolFlag) Default() interface{} {
 	return false
 }
+
+// Indirect returns the flag f points to, if it is a pointer to one of the
+// flag types of this package. Flags decoded from a driver plugin are
+// pointers.
+func Indirect(f Flag) Flag {
+	switch f := f.(type) {
+	case *StringFlag:
+		return *f
+	case *StringSliceFlag:
+		return *f
+	case *IntFlag:
+		return *f
+	case *BoolFlag:
+		return *f
+	}
+	return f
+}
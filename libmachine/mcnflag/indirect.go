@@ -0,0 +1,78 @@
+package mcnflag
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvRefPrefix introduces a string flag value that names the environment
+// variable holding the actual value, e.g. "ref+env://AWS_SECRET_ACCESS_KEY".
+const EnvRefPrefix = "ref+env://"
+
+// FileFlagName returns the name of the companion flag that reads the value of
+// the named flag from a file.
+func FileFlagName(name string) string {
+	return name + "-file"
+}
+
+// FileEnvVar returns the environment variable that names a file holding the
+// value of the named flag, e.g. MACHINE_DRIVER_AMAZONEC2_SECRET_KEY_FILE for
+// amazonec2-secret-key.
+func FileEnvVar(name string) string {
+	return "MACHINE_DRIVER_" + strings.ToUpper(strings.Replace(name, "-", "_", -1)) + "_FILE"
+}
+
+// ReadValueFile returns the contents of path, without trailing newlines, as
+// the value of the named flag.
+func ReadValueFile(name, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading the value of --%s from file: %s", name, err)
+	}
+
+	value := strings.TrimRight(string(data), "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("error reading the value of --%s from file: %s is empty", name, path)
+	}
+
+	return value, nil
+}
+
+// ResolveStringValue returns the value of the named string flag once its
+// indirections are applied. A file named by filePath, or else by the
+// FileEnvVar environment variable, takes precedence over value, which may
+// itself be an EnvRefPrefix reference.
+func ResolveStringValue(name, value, filePath string) (string, error) {
+	if filePath == "" {
+		filePath = os.Getenv(FileEnvVar(name))
+	}
+	if filePath != "" {
+		return ReadValueFile(name, filePath)
+	}
+
+	return ResolveValue(name, value)
+}
+
+// ResolveValue resolves an EnvRefPrefix reference given as the value of the
+// named flag. Any other value is returned unchanged.
+func ResolveValue(name, value string) (string, error) {
+	if !strings.HasPrefix(value, EnvRefPrefix) {
+		return value, nil
+	}
+
+	envVar := strings.TrimPrefix(value, EnvRefPrefix)
+	if envVar == "" {
+		return "", fmt.Errorf("error resolving the value of --%s: missing environment variable name", name)
+	}
+
+	resolved, ok := os.LookupEnv(envVar)
+	if !ok {
+		return "", fmt.Errorf("error resolving the value of --%s: environment variable %s is not set", name, envVar)
+	}
+	if resolved == "" {
+		return "", fmt.Errorf("error resolving the value of --%s: environment variable %s is empty", name, envVar)
+	}
+
+	return resolved, nil
+}
@@ -0,0 +1,67 @@
+package mcnflag
+
+import (
+	"fmt"
+
+	"github.com/rancher/machine/libmachine/log"
+)
+
+// Types of the flags described by a Schema.
+const (
+	SchemaTypeString = "string"
+	SchemaTypeInt    = "int"
+	SchemaTypeBool   = "bool"
+	SchemaTypeSlice  = "slice"
+)
+
+// Schema describes a create flag for the tools, like UIs, building their
+// forms from the flags of a driver.
+type Schema struct {
+	Name        string
+	Type        string
+	Default     interface{}
+	EnvVar      string `json:",omitempty"`
+	Description string
+	Sensitive   bool
+	Enum        []string `json:",omitempty"`
+	Pattern     string   `json:",omitempty"`
+	Required    bool     `json:",omitempty"`
+	Group       string   `json:",omitempty"`
+}
+
+// DescribeFlags returns the schema of each flag.
+func DescribeFlags(flags []Flag) []Schema {
+	schemas := []Schema{}
+	for _, f := range flags {
+		schemas = append(schemas, DescribeFlag(f))
+	}
+	return schemas
+}
+
+// DescribeFlag returns the schema of f. Flags of a type unknown to machine,
+// which third-party plugins may define, are described as string flags.
+func DescribeFlag(f Flag) Schema {
+	switch f := Indirect(f).(type) {
+	case StringFlag:
+		return Schema{Name: f.Name, Type: SchemaTypeString, Default: f.Value, EnvVar: f.EnvVar, Description: f.Usage, Sensitive: f.Sensitive,
+			Enum: f.Options, Pattern: f.Pattern, Required: f.Required, Group: f.Group}
+	case IntFlag:
+		return Schema{Name: f.Name, Type: SchemaTypeInt, Default: f.Value, EnvVar: f.EnvVar, Description: f.Usage, Group: f.Group}
+	case BoolFlag:
+		return Schema{Name: f.Name, Type: SchemaTypeBool, Default: false, EnvVar: f.EnvVar, Description: f.Usage, Group: f.Group}
+	case StringSliceFlag:
+		value := f.Value
+		if value == nil {
+			value = []string{}
+		}
+		return Schema{Name: f.Name, Type: SchemaTypeSlice, Default: value, EnvVar: f.EnvVar, Description: f.Usage, Required: f.Required, Group: f.Group}
+	}
+
+	log.Warnf("Flag %s has the unknown type %T, describing it as a string flag", f, f)
+
+	value := ""
+	if f.Default() != nil {
+		value = fmt.Sprint(f.Default())
+	}
+	return Schema{Name: f.String(), Type: SchemaTypeString, Default: value}
+}
@@ -0,0 +1,70 @@
+package mcnflag
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// customFlag stands for a flag type defined by a third-party plugin.
+type customFlag struct{}
+
+func (f customFlag) String() string {
+	return "custom-duration"
+}
+
+func (f customFlag) Default() interface{} {
+	return 30
+}
+
+func TestDescribeFlags(t *testing.T) {
+	schemas := DescribeFlags([]Flag{
+		StringFlag{Name: "token", Usage: "API token", EnvVar: "TOKEN", Sensitive: true},
+		IntFlag{Name: "disk-size", Usage: "Disk size", Value: 20},
+		BoolFlag{Name: "private", Usage: "Private networking", EnvVar: "PRIVATE"},
+		StringSliceFlag{Name: "tags", Usage: "Tags"},
+		StringSliceFlag{Name: "zones", Value: []string{"a", "b"}},
+	})
+
+	assert.Equal(t, []Schema{
+		{Name: "token", Type: SchemaTypeString, Default: "", EnvVar: "TOKEN", Description: "API token", Sensitive: true},
+		{Name: "disk-size", Type: SchemaTypeInt, Default: 20, Description: "Disk size"},
+		{Name: "private", Type: SchemaTypeBool, Default: false, EnvVar: "PRIVATE", Description: "Private networking"},
+		{Name: "tags", Type: SchemaTypeSlice, Default: []string{}, Description: "Tags"},
+		{Name: "zones", Type: SchemaTypeSlice, Default: []string{"a", "b"}},
+	}, schemas)
+}
+
+func TestDescribeFlagsFromPlugin(t *testing.T) {
+	schemas := DescribeFlags([]Flag{
+		&StringFlag{Name: "url", Usage: "URL"},
+		&IntFlag{Name: "disk-size", Value: 20},
+	})
+
+	assert.Equal(t, []Schema{
+		{Name: "url", Type: SchemaTypeString, Default: "", Description: "URL"},
+		{Name: "disk-size", Type: SchemaTypeInt, Default: 20},
+	}, schemas)
+}
+
+func TestDescribeUnknownFlag(t *testing.T) {
+	schema := DescribeFlag(customFlag{})
+
+	assert.Equal(t, Schema{Name: "custom-duration", Type: SchemaTypeString, Default: "30"}, schema)
+}
+
+func TestDescribeFlagConstraints(t *testing.T) {
+	schemas := DescribeFlags([]Flag{
+		StringFlag{Name: "http-tokens", Options: []string{"optional", "required"}, Group: "metadata"},
+		StringFlag{Name: "zone", Pattern: `[a-z]+-[0-9]+[a-z]`, Required: true},
+		StringSliceFlag{Name: "tags", Required: true},
+		IntFlag{Name: "disk-size", Group: "storage"},
+	})
+
+	assert.Equal(t, []Schema{
+		{Name: "http-tokens", Type: SchemaTypeString, Default: "", Enum: []string{"optional", "required"}, Group: "metadata"},
+		{Name: "zone", Type: SchemaTypeString, Default: "", Pattern: `[a-z]+-[0-9]+[a-z]`, Required: true},
+		{Name: "tags", Type: SchemaTypeSlice, Default: []string{}, Required: true},
+		{Name: "disk-size", Type: SchemaTypeInt, Default: 0, Group: "storage"},
+	}, schemas)
+}
@@ -0,0 +1,59 @@
+package mcnflag
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ValidateValues checks the values of the flags, by name, against the
+// constraints the flags declare.
+func ValidateValues(flags []Flag, values map[string]interface{}) error {
+	for _, f := range flags {
+		if err := Validate(f, values[f.String()]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks value against the options, pattern and requirement of f. An
+// empty value of a flag that is not required is valid.
+func Validate(f Flag, value interface{}) error {
+	switch f := Indirect(f).(type) {
+	case StringFlag:
+		s, _ := value.(string)
+		if s == "" {
+			if f.Required {
+				return fmt.Errorf("--%s is required", f.Name)
+			}
+			return nil
+		}
+		if len(f.Options) > 0 && !contains(f.Options, s) {
+			return fmt.Errorf("invalid value %q for --%s, expected one of %s", s, f.Name, strings.Join(f.Options, ", "))
+		}
+		if f.Pattern != "" {
+			re, err := regexp.Compile("^(?:" + f.Pattern + ")$")
+			if err != nil {
+				return fmt.Errorf("invalid pattern of --%s: %s", f.Name, err)
+			}
+			if !re.MatchString(s) {
+				return fmt.Errorf("invalid value %q for --%s, expected a value matching %s", s, f.Name, f.Pattern)
+			}
+		}
+	case StringSliceFlag:
+		if s, _ := value.([]string); f.Required && len(s) == 0 {
+			return fmt.Errorf("--%s is required", f.Name)
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package mcnflag
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	tokens := StringFlag{Name: "http-tokens", Options: []string{"optional", "required"}}
+	zone := &StringFlag{Name: "zone", Pattern: `[a-z]+-[0-9]+[a-z]`, Required: true}
+	tags := StringSliceFlag{Name: "tags", Required: true}
+
+	assert.NoError(t, Validate(tokens, ""))
+	assert.NoError(t, Validate(tokens, "required"))
+	assert.EqualError(t, Validate(tokens, "always"), `invalid value "always" for --http-tokens, expected one of optional, required`)
+
+	assert.NoError(t, Validate(zone, "us-1a"))
+	assert.EqualError(t, Validate(zone, ""), "--zone is required")
+	assert.EqualError(t, Validate(zone, "us-1a-b"), `invalid value "us-1a-b" for --zone, expected a value matching [a-z]+-[0-9]+[a-z]`)
+	assert.EqualError(t, Validate(StringFlag{Name: "name", Pattern: "("}, "x"), "invalid pattern of --name: error parsing regexp: missing closing ): `^(?:()$`")
+
+	assert.NoError(t, Validate(tags, []string{"a"}))
+	assert.EqualError(t, Validate(tags, []string{}), "--tags is required")
+	assert.NoError(t, Validate(IntFlag{Name: "size"}, 0))
+}
+
+func TestValidateValues(t *testing.T) {
+	flags := []Flag{
+		BoolFlag{Name: "private"},
+		StringFlag{Name: "region", Required: true},
+	}
+
+	assert.NoError(t, ValidateValues(flags, map[string]interface{}{"private": true, "region": "eu"}))
+	assert.EqualError(t, ValidateValues(flags, map[string]interface{}{"private": true}), "--region is required")
+}
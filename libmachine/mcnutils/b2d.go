@@ -16,6 +16,7 @@ import (
 	"strings"
 
 	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/progress"
 	"github.com/rancher/machine/version"
 )
 
@@ -79,7 +80,9 @@ type releaseGetter interface {
 	// getReleaseURL gets the latest release download URL from the given URL.
 	getReleaseURL(apiURL string) (string, error)
 	// download downloads a file from the given dlURL and saves it under dir.
-	download(dir, file, dlURL string) error
+	// download downloads the file, reporting the progress of the download
+	// to the machine, if any.
+	download(dir, file, dlURL, machine string) error
 }
 
 // b2dReleaseGetter implements the releaseGetter interface for getting the release of Boot2Docker.
@@ -190,7 +193,7 @@ Consider specifying another storage driver (e.g. 'overlay') using '--engine-stor
 	return url, nil
 }
 
-func (*b2dReleaseGetter) download(dir, file, isoURL string) error {
+func (*b2dReleaseGetter) download(dir, file, isoURL, machine string) error {
 	u, err := url.Parse(isoURL)
 
 	var src io.ReadCloser
@@ -212,6 +215,7 @@ func (*b2dReleaseGetter) download(dir, file, isoURL string) error {
 			ReadCloser:     s.Body,
 			out:            os.Stdout,
 			expectedLength: s.ContentLength,
+			machine:        machine,
 		}
 	}
 
@@ -336,12 +340,29 @@ type B2dUtils struct {
 }
 
 func NewB2dUtils(storePath string) *B2dUtils {
+	return NewB2dUtilsForArch(storePath, "")
+}
+
+// ISOFilename returns the name of the Boot2Docker ISO release asset for the
+// architecture, named like GOARCH. The amd64 ISO keeps its historical name.
+func ISOFilename(arch string) string {
+	if arch == "" || arch == "amd64" {
+		return defaultISOFilename
+	}
+	return fmt.Sprintf("boot2docker-%s.iso", arch)
+}
+
+// NewB2dUtilsForArch is like NewB2dUtils, but for the Boot2Docker ISO of the
+// architecture, which is cached apart from the ISOs of other architectures.
+// It is still copied to the machine directory as boot2docker.iso.
+func NewB2dUtilsForArch(storePath, arch string) *B2dUtils {
 	imgCachePath := filepath.Join(storePath, "cache")
+	isoFilename := ISOFilename(arch)
 
 	return &B2dUtils{
-		releaseGetter: &b2dReleaseGetter{isoFilename: defaultISOFilename},
+		releaseGetter: &b2dReleaseGetter{isoFilename: isoFilename},
 		iso: &b2dISO{
-			commonIsoPath:  filepath.Join(imgCachePath, defaultISOFilename),
+			commonIsoPath:  filepath.Join(imgCachePath, isoFilename),
 			volumeIDOffset: defaultVolumeIDOffset,
 			volumeIDLength: defaultVolumeIDLength,
 		},
@@ -352,16 +373,25 @@ func NewB2dUtils(storePath string) *B2dUtils {
 
 // DownloadISO downloads boot2docker ISO image for the given tag and save it at dest.
 func (b *B2dUtils) DownloadISO(dir, file, isoURL string) error {
+	return b.downloadISO(dir, file, isoURL, "")
+}
+
+// downloadISO is DownloadISO, reporting the progress of the download to the
+// machine, if any.
+func (b *B2dUtils) downloadISO(dir, file, isoURL, machine string) error {
 	log.Infof("Downloading %s from %s...", b.path(), isoURL)
-	return b.download(dir, file, isoURL)
+	return b.download(dir, file, isoURL, machine)
 }
 
+// ReaderWithProgress prints how much of the download it reads went, or
+// reports it to the machine, if any, as progress events.
 type ReaderWithProgress struct {
 	io.ReadCloser
 	out                io.Writer
 	bytesTransferred   int64
 	expectedLength     int64
 	nextPercentToPrint int64
+	machine            string
 }
 
 func (r *ReaderWithProgress) Read(p []byte) (int, error) {
@@ -372,7 +402,11 @@ func (r *ReaderWithProgress) Read(p []byte) (int, error) {
 		percentage := r.bytesTransferred * 100 / r.expectedLength
 
 		for percentage >= r.nextPercentToPrint {
-			if r.nextPercentToPrint%10 == 0 {
+			if r.machine != "" {
+				if r.nextPercentToPrint%10 == 0 && r.nextPercentToPrint > 0 {
+					progress.Report(r.machine, progress.DownloadingISO, int(r.nextPercentToPrint), "Downloading the Boot2Docker ISO...")
+				}
+			} else if r.nextPercentToPrint%10 == 0 {
 				fmt.Fprintf(r.out, "%d%%", r.nextPercentToPrint)
 			} else if r.nextPercentToPrint%2 == 0 {
 				fmt.Fprint(r.out, ".")
@@ -385,17 +419,23 @@ func (r *ReaderWithProgress) Read(p []byte) (int, error) {
 }
 
 func (r *ReaderWithProgress) Close() error {
-	fmt.Fprintln(r.out)
+	if r.machine == "" {
+		fmt.Fprintln(r.out)
+	}
 	return r.ReadCloser.Close()
 }
 
 func (b *B2dUtils) DownloadLatestBoot2Docker(apiURL string) error {
+	return b.downloadLatestBoot2Docker(apiURL, "")
+}
+
+func (b *B2dUtils) downloadLatestBoot2Docker(apiURL, machine string) error {
 	latestReleaseURL, err := b.getReleaseURL(apiURL)
 	if err != nil {
 		return err
 	}
 
-	return b.DownloadISOFromURL(latestReleaseURL)
+	return b.downloadISO(b.imgCachePath, b.filename(), latestReleaseURL, machine)
 }
 
 func (b *B2dUtils) DownloadISOFromURL(latestReleaseURL string) error {
@@ -403,6 +443,12 @@ func (b *B2dUtils) DownloadISOFromURL(latestReleaseURL string) error {
 }
 
 func (b *B2dUtils) UpdateISOCache(isoURL string) error {
+	return b.updateISOCache(isoURL, "")
+}
+
+// updateISOCache is UpdateISOCache, reporting the progress of the download
+// to the machine, if any.
+func (b *B2dUtils) updateISOCache(isoURL, machine string) error {
 	// recreate the cache dir if it has been manually deleted
 	if _, err := os.Stat(b.imgCachePath); os.IsNotExist(err) {
 		log.Infof("Image cache directory does not exist, creating it at %s...", b.imgCachePath)
@@ -424,26 +470,26 @@ func (b *B2dUtils) UpdateISOCache(isoURL string) error {
 
 	if !exists {
 		log.Info("No default Boot2Docker ISO found locally, downloading the latest release...")
-		return b.DownloadLatestBoot2Docker("")
+		return b.downloadLatestBoot2Docker("", machine)
 	}
 
 	latest := b.isLatest()
 	if !latest {
 		log.Info("Default Boot2Docker ISO is out-of-date, downloading the latest release...")
-		return b.DownloadLatestBoot2Docker("")
+		return b.downloadLatestBoot2Docker("", machine)
 	}
 
 	return nil
 }
 
 func (b *B2dUtils) CopyIsoToMachineDir(isoURL, machineName string) error {
-	if err := b.UpdateISOCache(isoURL); err != nil {
+	if err := b.updateISOCache(isoURL, machineName); err != nil {
 		return err
 	}
 
 	// TODO: This is a bit off-color.
 	machineDir := filepath.Join(b.storePath, "machines", machineName)
-	machineIsoPath := filepath.Join(machineDir, b.filename())
+	machineIsoPath := filepath.Join(machineDir, defaultISOFilename)
 
 	// By default just copy the existing "cached" iso to the machine's directory...
 	if isoURL == "" {
@@ -457,7 +503,7 @@ func (b *B2dUtils) CopyIsoToMachineDir(isoURL, machineName string) error {
 		return err
 	}
 
-	return b.DownloadISO(machineDir, b.filename(), downloadURL)
+	return b.downloadISO(machineDir, defaultISOFilename, downloadURL, machineName)
 }
 
 // isLatest checks the latest release tag and
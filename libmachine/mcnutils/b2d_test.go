@@ -11,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/progress"
 	"github.com/rancher/machine/version"
 	"github.com/stretchr/testify/assert"
 )
@@ -175,6 +176,41 @@ func TestReaderWithProgress(t *testing.T) {
 	assert.Equal(t, "0%....10%....20%....30%....40%....50%....60%....70%....80%....90%....100%\n", output.String())
 }
 
+func TestReaderWithProgressReportsToTheMachine(t *testing.T) {
+	var events []progress.Event
+	unsubscribe := progress.Subscribe("downloading", func(ev progress.Event) {
+		events = append(events, ev)
+	})
+	defer unsubscribe()
+
+	readCloser := MockReadCloser{blockLengths: []int{5, 20, 75}}
+	output := new(bytes.Buffer)
+	buffer := make([]byte, 100)
+
+	readerWithProgress := ReaderWithProgress{
+		ReadCloser:     &readCloser,
+		out:            output,
+		expectedLength: 100,
+		machine:        "downloading",
+	}
+
+	readerWithProgress.Read(buffer)
+	assert.Empty(t, events)
+
+	readerWithProgress.Read(buffer)
+	readerWithProgress.Read(buffer)
+	readerWithProgress.Close()
+
+	var percents []int
+	for _, ev := range events {
+		assert.Equal(t, progress.StepProgress, ev.Type)
+		assert.Equal(t, progress.DownloadingISO, ev.Step)
+		percents = append(percents, ev.Percent)
+	}
+	assert.Equal(t, []int{10, 20, 30, 40, 50, 60, 70, 80, 90, 100}, percents)
+	assert.Empty(t, output.String())
+}
+
 type mockReleaseGetter struct {
 	ver    string
 	apiErr error
@@ -193,7 +229,7 @@ func (m *mockReleaseGetter) getReleaseURL(apiURL string) (string, error) {
 	return "http://127.0.0.1/dummy", m.apiErr
 }
 
-func (m *mockReleaseGetter) download(dir, file, isoURL string) error {
+func (m *mockReleaseGetter) download(dir, file, isoURL, machine string) error {
 	path := filepath.Join(dir, file)
 	var err error
 	if _, e := os.Stat(path); os.IsNotExist(e) {
@@ -8,6 +8,7 @@ import (
 	"os"
 	"runtime"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -131,3 +132,12 @@ func GenerateRandomID() string {
 		return value
 	}
 }
+
+// UnbracketHost returns host without the brackets of an IPv6 literal such as
+// [2001:db8::1], which net.ParseIP and net.JoinHostPort take bare.
+func UnbracketHost(host string) string {
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		return host[1 : len(host)-1]
+	}
+	return host
+}
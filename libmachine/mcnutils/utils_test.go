@@ -98,3 +98,16 @@ func TestShortenIdInvalid(t *testing.T) {
 		t.Fatalf("Id returned is incorrect: truncate on %s returned %s", id, truncID)
 	}
 }
+
+func TestUnbracketHost(t *testing.T) {
+	for host, expected := range map[string]string{
+		"[2001:db8::1]":  "2001:db8::1",
+		"2001:db8::1":    "2001:db8::1",
+		"192.168.99.100": "192.168.99.100",
+		"example.com":    "example.com",
+	} {
+		if unbracketed := UnbracketHost(host); unbracketed != expected {
+			t.Fatalf("UnbracketHost(%s) returned %s, expected %s", host, unbracketed, expected)
+		}
+	}
+}
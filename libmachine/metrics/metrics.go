@@ -0,0 +1,329 @@
+// Package metrics counts the calls made to driver plugins, their failures
+// and latency, and how often plugins are restarted, so that operators can
+// tell which drivers are slow or flaky.
+//
+// The metrics can be written in the Prometheus text format with
+// WritePrometheus, or served with Handler. They are only served once
+// ListenAndServe is called, on their own listener: expvar is not used, as it
+// would publish the command line of the process, credentials included, on
+// the default HTTP mux which driver plugins serve their RPC on.
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the buckets of the
+// duration histograms.
+var durationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300, 900}
+
+var (
+	// PluginCalls counts the RPC calls made to driver plugins.
+	PluginCalls = newCounterVec("machine_plugin_calls_total", "RPC calls made to driver plugins.", "driver", "method")
+
+	// PluginCallErrors counts the RPC calls to driver plugins which failed.
+	PluginCallErrors = newCounterVec("machine_plugin_call_errors_total", "RPC calls to driver plugins which failed.", "driver", "method")
+
+	// PluginCallDuration is the latency of the RPC calls to driver plugins.
+	PluginCallDuration = newHistogramVec("machine_plugin_call_duration_seconds", "Latency of the RPC calls to driver plugins.", "driver", "method")
+
+	// PluginRestarts counts the driver plugins relaunched after they crashed
+	// or the connection to them was lost.
+	PluginRestarts = newCounterVec("machine_plugin_restarts_total", "Driver plugins relaunched after losing them.", "driver")
+
+	// PluginHandshakeDuration is how long driver plugins take to start
+	// serving their driver.
+	PluginHandshakeDuration = newHistogramVec("machine_plugin_handshake_duration_seconds", "Time driver plugins take to start serving their driver.", "driver")
+
+	// PluginHandshakeErrors counts the driver plugins which failed to start
+	// serving their driver.
+	PluginHandshakeErrors = newCounterVec("machine_plugin_handshake_errors_total", "Driver plugins which failed to start serving their driver.", "driver")
+
+	families = []family{PluginCalls, PluginCallErrors, PluginCallDuration, PluginRestarts, PluginHandshakeDuration, PluginHandshakeErrors}
+)
+
+// ObserveCall records an RPC call to the plugin of driver, which took
+// duration and failed with err, if not nil.
+func ObserveCall(driver, method string, duration time.Duration, err error) {
+	method = strings.TrimPrefix(method, ".")
+	PluginCalls.Inc(driver, method)
+	if err != nil {
+		PluginCallErrors.Inc(driver, method)
+	}
+	PluginCallDuration.Observe(duration.Seconds(), driver, method)
+}
+
+// ObserveHandshake records the startup of the plugin of driver, which took
+// duration and failed with err, if not nil.
+func ObserveHandshake(driver string, duration time.Duration, err error) {
+	if err != nil {
+		PluginHandshakeErrors.Inc(driver)
+		return
+	}
+	PluginHandshakeDuration.Observe(duration.Seconds(), driver)
+}
+
+type family interface {
+	metricName() string
+	writePrometheus(w io.Writer)
+	snapshot() map[string]interface{}
+	reset()
+}
+
+// labelKey joins label values, which cannot hold a NUL byte.
+func labelKey(values []string) string {
+	return strings.Join(values, "\x00")
+}
+
+// labelString formats the labels of a series, e.g. driver="google",method="Create".
+func labelString(names []string, key string) string {
+	values := strings.Split(key, "\x00")
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs[i] = name + "=" + strconv.Quote(value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CounterVec is a counter for each combination of label values.
+type CounterVec struct {
+	name, help string
+	labels     []string
+
+	lock   sync.Mutex
+	values map[string]float64
+}
+
+func newCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{name: name, help: help, labels: labels, values: map[string]float64{}}
+}
+
+// Inc increments the counter of the given label values.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.values[labelKey(labelValues)]++
+}
+
+// Value returns the counter of the given label values.
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.values[labelKey(labelValues)]
+}
+
+func (c *CounterVec) metricName() string {
+	return c.name
+}
+
+func (c *CounterVec) writePrometheus(w io.Writer) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s{%s} %s\n", c.name, labelString(c.labels, key), formatFloat(c.values[key]))
+	}
+}
+
+func (c *CounterVec) snapshot() map[string]interface{} {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	series := map[string]interface{}{}
+	for key, value := range c.values {
+		series[labelString(c.labels, key)] = value
+	}
+	return series
+}
+
+func (c *CounterVec) reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.values = map[string]float64{}
+}
+
+// HistogramVec is a histogram of durations for each combination of label
+// values.
+type HistogramVec struct {
+	name, help string
+	labels     []string
+
+	lock   sync.Mutex
+	series map[string]*histogram
+}
+
+type histogram struct {
+	// buckets counts the observations of each bucket of durationBuckets,
+	// not cumulated.
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+func newHistogramVec(name, help string, labels ...string) *HistogramVec {
+	return &HistogramVec{name: name, help: help, labels: labels, series: map[string]*histogram{}}
+}
+
+// Observe adds value, in seconds, to the histogram of the given label values.
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	key := labelKey(labelValues)
+	series, ok := h.series[key]
+	if !ok {
+		series = &histogram{buckets: make([]uint64, len(durationBuckets))}
+		h.series[key] = series
+	}
+
+	series.count++
+	series.sum += value
+	if i := sort.SearchFloat64s(durationBuckets, value); i < len(durationBuckets) {
+		series.buckets[i]++
+	}
+}
+
+// Count returns how many values were observed for the given label values.
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if series, ok := h.series[labelKey(labelValues)]; ok {
+		return series.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) metricName() string {
+	return h.name
+}
+
+func (h *HistogramVec) writePrometheus(w io.Writer) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for _, key := range sortedKeys(h.series) {
+		series, labels := h.series[key], labelString(h.labels, key)
+
+		var cumulated uint64
+		for i, bound := range durationBuckets {
+			cumulated += series.buckets[i]
+			fmt.Fprintf(w, "%s_bucket{%s,le=%q} %d\n", h.name, labels, formatFloat(bound), cumulated)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", h.name, labels, series.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", h.name, labels, formatFloat(series.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", h.name, labels, series.count)
+	}
+}
+
+func (h *HistogramVec) snapshot() map[string]interface{} {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	series := map[string]interface{}{}
+	for key, s := range h.series {
+		buckets := map[string]uint64{}
+		var cumulated uint64
+		for i, bound := range durationBuckets {
+			cumulated += s.buckets[i]
+			buckets[formatFloat(bound)] = cumulated
+		}
+		series[labelString(h.labels, key)] = map[string]interface{}{
+			"count":   s.count,
+			"sum":     s.sum,
+			"buckets": buckets,
+		}
+	}
+	return series
+}
+
+func (h *HistogramVec) reset() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.series = map[string]*histogram{}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func snapshot() interface{} {
+	all := map[string]interface{}{}
+	for _, f := range families {
+		all[f.metricName()] = f.snapshot()
+	}
+	return all
+}
+
+// WritePrometheus writes the metrics in the Prometheus text format.
+func WritePrometheus(w io.Writer) {
+	for _, f := range families {
+		f.writePrometheus(w)
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		WritePrometheus(w)
+	})
+}
+
+// JSONHandler serves the metrics as JSON, by metric and series.
+func JSONHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(snapshot())
+	})
+}
+
+// NewServeMux returns the mux serving the metrics, only, on /metrics in the
+// Prometheus text format and on /metrics.json as JSON.
+func NewServeMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	mux.Handle("/metrics.json", JSONHandler())
+	return mux
+}
+
+// ListenAndServe serves the metrics on addr, in the background, until the
+// process exits. It returns the listener, or the error listening.
+func ListenAndServe(addr string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot serve the metrics on %s: %s", addr, err)
+	}
+	go http.Serve(listener, NewServeMux())
+	return listener, nil
+}
+
+// Reset clears every metric.
+func Reset() {
+	for _, f := range families {
+		f.reset()
+	}
+}
@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserveCall(t *testing.T) {
+	Reset()
+	defer Reset()
+
+	ObserveCall("google", ".Create", 2*time.Second, nil)
+	ObserveCall("google", ".Create", 40*time.Millisecond, errors.New("quota exceeded"))
+	ObserveCall("google", ".GetState", time.Millisecond, nil)
+
+	assert.Equal(t, float64(2), PluginCalls.Value("google", "Create"))
+	assert.Equal(t, float64(1), PluginCallErrors.Value("google", "Create"))
+	assert.Equal(t, float64(0), PluginCallErrors.Value("google", "GetState"))
+	assert.Equal(t, uint64(2), PluginCallDuration.Count("google", "Create"))
+}
+
+func TestObserveHandshake(t *testing.T) {
+	Reset()
+	defer Reset()
+
+	ObserveHandshake("hetzner", 300*time.Millisecond, nil)
+	ObserveHandshake("hetzner", 10*time.Second, errors.New("timeout"))
+
+	assert.Equal(t, uint64(1), PluginHandshakeDuration.Count("hetzner"))
+	assert.Equal(t, float64(1), PluginHandshakeErrors.Value("hetzner"))
+}
+
+func TestWritePrometheus(t *testing.T) {
+	Reset()
+	defer Reset()
+
+	ObserveCall("google", ".Create", 30*time.Millisecond, nil)
+	PluginRestarts.Inc("google")
+
+	out := &bytes.Buffer{}
+	WritePrometheus(out)
+
+	assert.Contains(t, out.String(), "# TYPE machine_plugin_calls_total counter\nmachine_plugin_calls_total{driver=\"google\",method=\"Create\"} 1\n")
+	assert.Contains(t, out.String(), "machine_plugin_call_duration_seconds_bucket{driver=\"google\",method=\"Create\",le=\"0.025\"} 0\n")
+	assert.Contains(t, out.String(), "machine_plugin_call_duration_seconds_bucket{driver=\"google\",method=\"Create\",le=\"0.05\"} 1\n")
+	assert.Contains(t, out.String(), "machine_plugin_call_duration_seconds_bucket{driver=\"google\",method=\"Create\",le=\"+Inf\"} 1\n")
+	assert.Contains(t, out.String(), "machine_plugin_call_duration_seconds_count{driver=\"google\",method=\"Create\"} 1\n")
+	assert.Contains(t, out.String(), "machine_plugin_restarts_total{driver=\"google\"} 1\n")
+}
+
+func TestHandler(t *testing.T) {
+	Reset()
+	defer Reset()
+	PluginRestarts.Inc("google")
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, "text/plain; version=0.0.4", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "machine_plugin_restarts_total{driver=\"google\"} 1\n")
+}
+
+func TestListenAndServe(t *testing.T) {
+	Reset()
+	defer Reset()
+	PluginRestarts.Inc("google")
+
+	listener, err := ListenAndServe("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	resp, err := http.Get("http://" + listener.Addr().String() + "/metrics.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var published map[string]map[string]interface{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&published))
+	assert.Equal(t, float64(1), published["machine_plugin_restarts_total"][`driver="google"`])
+
+	// Nothing else is served, the command line least of all.
+	resp, err = http.Get("http://" + listener.Addr().String() + "/debug/vars")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestDefaultServeMuxUntouched(t *testing.T) {
+	_, pattern := http.DefaultServeMux.Handler(httptest.NewRequest("GET", "/debug/vars", nil))
+	assert.Empty(t, pattern)
+}
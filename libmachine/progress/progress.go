@@ -0,0 +1,200 @@
+package progress
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/rancher/machine/libmachine/log"
+)
+
+// EventType tells whether a step started, completed or failed.
+type EventType string
+
+const (
+	StepStarted   EventType = "StepStarted"
+	StepCompleted EventType = "StepCompleted"
+	StepFailed    EventType = "StepFailed"
+	// StepProgress reports how far a step, or a phase of a driver operation,
+	// has gone.
+	StepProgress EventType = "StepProgress"
+)
+
+// Names of the steps reported while creating and provisioning a machine.
+const (
+	GeneratingCerts      = "generating-certs"
+	PreCreateCheck       = "pre-create-check"
+	CreatingMachine      = "creating-machine"
+	WaitingForInstance   = "waiting-for-instance"
+	WaitingForSSH        = "waiting-for-ssh"
+	DetectingOS          = "detecting-os"
+	Provisioning         = "provisioning"
+	InstallingDocker     = "installing-docker"
+	InstallingK3s        = "installing-k3s"
+	InstallingContainerd = "installing-containerd"
+	InstallingPodman     = "installing-podman"
+	CopyingCerts         = "copying-certs"
+	ConfiguringEngine    = "configuring-engine"
+	ConfiguringSwarm     = "configuring-swarm"
+	CheckingDocker       = "checking-docker"
+	RunningCustomScript  = "running-custom-script"
+	RunningHook          = "running-hook"
+	ConfiguringGPU       = "configuring-gpu"
+	DetectingProvisioner = "detecting-provisioner"
+	DownloadingISO       = "downloading-iso"
+)
+
+// PluginEventPrefix starts the lines a driver plugin writes to its stdout to
+// report an event, the rest of the line being the JSON encoded event.
+const PluginEventPrefix = "@machine-progress "
+
+// Event is a step of the creation of a machine.
+type Event struct {
+	Type    EventType
+	Machine string
+	Step    string
+	// Message is the human-readable banner of the step, if any.
+	Message string `json:",omitempty"`
+	// Percent is how far a StepProgress event says the step has gone, 0
+	// when the driver cannot tell.
+	Percent int    `json:",omitempty"`
+	Error   string `json:",omitempty"`
+}
+
+// Func receives progress events.
+type Func func(Event)
+
+var (
+	mu             sync.RWMutex
+	subscribers    = map[string]Func{}
+	defaultHandler = LogBanner
+)
+
+// Subscribe sends the events of the named machine to fn instead of the
+// default handler, until the returned function is called.
+func Subscribe(machine string, fn Func) (unsubscribe func()) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	subscribers[machine] = fn
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		delete(subscribers, machine)
+	}
+}
+
+// SetDefault sets the handler of the events of machines nobody subscribed
+// to. It logs their banners unless changed.
+func SetDefault(fn Func) {
+	mu.Lock()
+	defer mu.Unlock()
+	defaultHandler = fn
+}
+
+// Handler returns the function the events of the named machine are sent to,
+// its subscriber or else the default handler.
+func Handler(machine string) Func {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if fn, ok := subscribers[machine]; ok {
+		return fn
+	}
+	return defaultHandler
+}
+
+// Emit sends ev to the subscriber of its machine.
+func Emit(ev Event) {
+	Handler(ev.Machine)(ev)
+}
+
+// Report emits the progress of a phase of an operation on the named machine,
+// for the drivers to report long operations with.
+func Report(machine, phase string, percent int, message string) {
+	Emit(Event{Type: StepProgress, Machine: machine, Step: phase, Percent: percent, Message: message})
+}
+
+// LogBanner logs the banner of the steps that have one, which is how the
+// progress of a create has always been shown.
+func LogBanner(ev Event) {
+	if ev.Type == StepFailed || ev.Message == "" {
+		return
+	}
+	if ev.Type == StepProgress && ev.Percent > 0 {
+		log.Infof("%s (%d%%)", ev.Message, ev.Percent)
+		return
+	}
+	log.Info(ev.Message)
+}
+
+// LogJSON logs every event as a JSON object.
+func LogJSON(ev Event) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		log.Debugf("Error encoding progress event: %s", err)
+		return
+	}
+	log.Info(string(data))
+}
+
+// PluginWriter returns a handler writing events to w, the stdout of a driver
+// plugin, for the machine binary to pick them up.
+func PluginWriter(w io.Writer) Func {
+	return func(ev Event) {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return
+		}
+		io.WriteString(w, PluginEventPrefix+string(data)+"\n")
+	}
+}
+
+// ParsePluginEvent decodes a line written by PluginWriter. It returns false
+// for any other line.
+func ParsePluginEvent(line string) (Event, bool) {
+	var ev Event
+	if !strings.HasPrefix(line, PluginEventPrefix) {
+		return ev, false
+	}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, PluginEventPrefix)), &ev); err != nil {
+		return ev, false
+	}
+	return ev, true
+}
+
+// Tracker reports a sequence of steps of one machine, each step ending when
+// the next one starts.
+type Tracker struct {
+	machine string
+	current string
+}
+
+func NewTracker(machine string) *Tracker {
+	return &Tracker{machine: machine}
+}
+
+// Start completes the current step, if any, and starts the named one.
+func (t *Tracker) Start(step, message string) {
+	t.Done(nil)
+
+	t.current = step
+	Emit(Event{Type: StepStarted, Machine: t.machine, Step: step, Message: message})
+}
+
+// Done completes the current step, or fails it if err is not nil.
+func (t *Tracker) Done(err error) {
+	if t.current == "" {
+		return
+	}
+
+	ev := Event{Type: StepCompleted, Machine: t.machine, Step: t.current}
+	if err != nil {
+		ev.Type = StepFailed
+		ev.Error = err.Error()
+	}
+	t.current = ""
+
+	Emit(ev)
+}
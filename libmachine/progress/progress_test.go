@@ -0,0 +1,66 @@
+package progress
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func record(machine string) (*[]Event, func()) {
+	events := &[]Event{}
+	unsubscribe := Subscribe(machine, func(ev Event) {
+		*events = append(*events, ev)
+	})
+	return events, unsubscribe
+}
+
+func TestTracker(t *testing.T) {
+	events, unsubscribe := record("tracked")
+	defer unsubscribe()
+
+	steps := NewTracker("tracked")
+	steps.Start(WaitingForSSH, "Waiting for SSH to be available...")
+	steps.Start(InstallingDocker, "")
+	steps.Done(errors.New("no route to host"))
+	steps.Done(nil)
+
+	assert.Equal(t, []Event{
+		{Type: StepStarted, Machine: "tracked", Step: WaitingForSSH, Message: "Waiting for SSH to be available..."},
+		{Type: StepCompleted, Machine: "tracked", Step: WaitingForSSH},
+		{Type: StepStarted, Machine: "tracked", Step: InstallingDocker},
+		{Type: StepFailed, Machine: "tracked", Step: InstallingDocker, Error: "no route to host"},
+	}, *events)
+}
+
+func TestSubscribeIsPerMachine(t *testing.T) {
+	events, unsubscribe := record("subscribed")
+
+	Emit(Event{Type: StepStarted, Machine: "other", Step: CreatingMachine})
+	Emit(Event{Type: StepStarted, Machine: "subscribed", Step: CreatingMachine})
+	unsubscribe()
+	Emit(Event{Type: StepCompleted, Machine: "subscribed", Step: CreatingMachine})
+
+	assert.Equal(t, []Event{{Type: StepStarted, Machine: "subscribed", Step: CreatingMachine}}, *events)
+}
+
+func TestPluginEvents(t *testing.T) {
+	out := &bytes.Buffer{}
+	ev := Event{Type: StepFailed, Machine: "plugin", Step: WaitingForInstance, Error: "instance terminated"}
+
+	PluginWriter(out)(ev)
+
+	line := strings.TrimSuffix(out.String(), "\n")
+	assert.True(t, strings.HasPrefix(line, PluginEventPrefix))
+
+	parsed, ok := ParsePluginEvent(line)
+	assert.True(t, ok)
+	assert.Equal(t, ev, parsed)
+
+	_, ok = ParsePluginEvent("Waiting for instance...")
+	assert.False(t, ok)
+	_, ok = ParsePluginEvent(PluginEventPrefix + "{not json")
+	assert.False(t, ok)
+}
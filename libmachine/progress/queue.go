@@ -0,0 +1,84 @@
+package progress
+
+import (
+	"sync"
+	"time"
+)
+
+// Queue holds the events of the machines a driver plugin serves, until the
+// machine binary polls them over RPC. The events of a machine are only held
+// once it has been polled, machine binaries which never poll read them from
+// the stdout of the plugin instead.
+type Queue struct {
+	mu     sync.Mutex
+	polled map[string]bool
+	events map[string][]Event
+	wake   map[string]chan struct{}
+}
+
+func NewQueue() *Queue {
+	return &Queue{
+		polled: map[string]bool{},
+		events: map[string][]Event{},
+		wake:   map[string]chan struct{}{},
+	}
+}
+
+// Push holds ev for the next poll of its machine. It returns false, leaving
+// ev to another handler, if nobody polls the machine.
+func (q *Queue) Push(ev Event) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.polled[ev.Machine] {
+		return false
+	}
+
+	q.events[ev.Machine] = append(q.events[ev.Machine], ev)
+	if wake, ok := q.wake[ev.Machine]; ok {
+		close(wake)
+		delete(q.wake, ev.Machine)
+	}
+	return true
+}
+
+// Poll returns the events held for the machine, waiting up to timeout for
+// one if there are none yet. A poll without a timeout is the last one: it
+// collects the events left and the machine is no longer polled.
+func (q *Queue) Poll(machine string, timeout time.Duration) []Event {
+	q.mu.Lock()
+	if timeout <= 0 {
+		events := q.events[machine]
+		delete(q.polled, machine)
+		delete(q.events, machine)
+		if wake, ok := q.wake[machine]; ok {
+			close(wake)
+			delete(q.wake, machine)
+		}
+		q.mu.Unlock()
+		return events
+	}
+	q.polled[machine] = true
+
+	if len(q.events[machine]) == 0 {
+		wake, ok := q.wake[machine]
+		if !ok {
+			wake = make(chan struct{})
+			q.wake[machine] = wake
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-time.After(timeout):
+		}
+
+		q.mu.Lock()
+	}
+
+	events := q.events[machine]
+	delete(q.events, machine)
+	q.mu.Unlock()
+
+	return events
+}
@@ -0,0 +1,49 @@
+package progress
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueHoldsEventsOfPolledMachines(t *testing.T) {
+	q := NewQueue()
+	ev := Event{Type: StepProgress, Machine: "polled", Step: CreatingMachine, Percent: 20}
+
+	assert.False(t, q.Push(ev))
+	assert.Empty(t, q.Poll("polled", time.Millisecond))
+
+	assert.True(t, q.Push(ev))
+	assert.False(t, q.Push(Event{Machine: "other"}))
+	assert.Equal(t, []Event{ev}, q.Poll("polled", time.Millisecond))
+	assert.Empty(t, q.Poll("polled", time.Millisecond))
+}
+
+func TestQueuePollWaitsForEvents(t *testing.T) {
+	q := NewQueue()
+	q.Poll("waiting", time.Millisecond)
+	ev := Event{Type: StepStarted, Machine: "waiting", Step: CreatingMachine}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.Push(ev)
+	}()
+
+	assert.Equal(t, []Event{ev}, q.Poll("waiting", time.Minute))
+	assert.Empty(t, q.Poll("waiting", time.Millisecond))
+}
+
+func TestQueueLastPollForgetsTheMachine(t *testing.T) {
+	q := NewQueue()
+	ev := Event{Type: StepCompleted, Machine: "done", Step: CreatingMachine}
+
+	q.Poll("done", time.Millisecond)
+	assert.True(t, q.Push(ev))
+
+	assert.Equal(t, []Event{ev}, q.Poll("done", 0))
+	assert.False(t, q.Push(ev))
+	assert.Empty(t, q.polled)
+	assert.Empty(t, q.events)
+	assert.Empty(t, q.wake)
+}
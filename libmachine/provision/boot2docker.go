@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net"
 	"path"
+	"strconv"
 	"text/template"
 	"time"
 
@@ -54,7 +55,13 @@ func (provisioner *Boot2DockerProvisioner) upgradeIso() error {
 	// TODO: Ideally, we should not read from mcndirs directory at all.
 	// The driver should be able to communicate how and where to place the
 	// relevant files.
-	b2dutils := mcnutils.NewB2dUtils(mcndirs.GetBaseDir())
+	// The architecture is read before stopping the machine, to upgrade to
+	// the ISO of the same one.
+	arch, err := machineArchitecture(provisioner)
+	if err != nil {
+		return err
+	}
+	b2dutils := mcnutils.NewB2dUtilsForArch(mcndirs.GetBaseDir(), arch)
 
 	// Check if the driver has specified a custom b2d url
 	jsonDriver, err := json.Marshal(provisioner.GetDriver())
@@ -128,6 +135,11 @@ func (provisioner *Boot2DockerProvisioner) GetAuthOptions() auth.Options {
 	return provisioner.AuthOptions
 }
 
+func (provisioner *Boot2DockerProvisioner) setEngineOptions(authOptions auth.Options, engineOptions engine.Options) {
+	provisioner.AuthOptions = authOptions
+	provisioner.EngineOptions = engineOptions
+}
+
 func (provisioner *Boot2DockerProvisioner) GetSwarmOptions() swarm.Options {
 	return provisioner.SwarmOptions
 }
@@ -197,7 +209,7 @@ func (provisioner *Boot2DockerProvisioner) AttemptIPContact(dockerPort int) {
 		return
 	}
 
-	if conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", ip, dockerPort), 5*time.Second); err != nil {
+	if conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, strconv.Itoa(dockerPort)), 5*time.Second); err != nil {
 		log.Warnf(`
 This machine has been allocated an IP address, but Docker Machine could not
 reach it successfully.
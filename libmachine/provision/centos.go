@@ -43,26 +43,26 @@ func (provisioner *CentosProvisioner) Provision(swarmOptions swarm.Options, auth
 	}
 	provisioner.EngineOptions.StorageDriver = storageDriver
 
-	if err := provisioner.SetHostname(provisioner.Driver.GetMachineName()); err != nil {
-		return err
-	}
-
-	if err := installDockerGeneric(provisioner, provisioner.EngineOptions.InstallURL); err != nil {
-		return err
-	} else if err == nil {
+	if err := installConcurrently(provisioner, func() error {
+		if err := installDockerEngine(provisioner, &provisioner.EngineOptions); err != nil {
+			return err
+		}
 		if err := provisioner.Service("docker", serviceaction.Restart); err != nil {
 			return err
 		}
 		if err := provisioner.Service("docker", serviceaction.Enable); err != nil {
 			return err
 		}
-	}
 
-	for _, pkg := range provisioner.Packages {
-		log.Debugf("installing base package: name=%s", pkg)
-		if err := provisioner.Package(pkg, pkgaction.Install); err != nil {
-			return err
+		for _, pkg := range provisioner.Packages {
+			log.Debugf("installing base package: name=%s", pkg)
+			if err := provisioner.Package(pkg, pkgaction.Install); err != nil {
+				return err
+			}
 		}
+		return nil
+	}); err != nil {
+		return err
 	}
 
 	if err := mcnutils.WaitFor(provisioner.dockerDaemonResponding); err != nil {
@@ -75,7 +75,7 @@ func (provisioner *CentosProvisioner) Provision(swarmOptions swarm.Options, auth
 
 	provisioner.AuthOptions = setRemoteAuthOptions(provisioner)
 
-	if err := ConfigureAuth(provisioner); err != nil {
+	if err := configureAuth(provisioner, false); err != nil {
 		return err
 	}
 
@@ -0,0 +1,109 @@
+package provision
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rancher/machine/libmachine/engine"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/versioncmp"
+)
+
+// The first releases running on the unified cgroup v2 hierarchy.
+var (
+	cgroupV2EngineVersion     = versioncmp.MustParse("20.10.0")
+	cgroupV2ContainerdVersion = versioncmp.MustParse("1.4.0")
+	cgroupV2RuncVersion       = versioncmp.MustParse("1.0.0")
+)
+
+// systemdCgroupDriver is the engine flag making dockerd manage the cgroups of
+// the containers through systemd, as it has to on cgroup v2 hosts.
+const systemdCgroupDriver = "exec-opt=native.cgroupdriver=systemd"
+
+// isCgroupV2 tells whether the machine mounts the unified cgroup v2
+// hierarchy.
+func isCgroupV2(p SSHCommander) bool {
+	output, err := p.SSHCommand("stat -fc %T /sys/fs/cgroup/")
+	if err != nil {
+		log.Debugf("Error detecting the cgroup version of the machine, assuming cgroup v1: %s", err)
+		return false
+	}
+	return strings.TrimSpace(output) == "cgroup2fs"
+}
+
+// checkCgroupV2Version fails when the release of the component cannot run on
+// cgroup v2, which needs minimum or later.
+func checkCgroupV2Version(component string, version, minimum versioncmp.Version) error {
+	if version.Release().Compare(minimum) < 0 {
+		return fmt.Errorf("%s %s cannot run on the cgroup v2 hierarchy of the machine, it needs %s or later", component, version, minimum)
+	}
+	return nil
+}
+
+// installDockerWithCgroups installs the engine with install, failing before
+// installing anything when the version pinned cannot run on the cgroup v2
+// hierarchy of the machine, and after when the one installed cannot. On
+// cgroup v2 machines the engine uses the systemd cgroup driver.
+func installDockerWithCgroups(p Provisioner, engineOptions *engine.Options, install func() error) error {
+	cgroupV2 := isCgroupV2(p)
+	if cgroupV2 && engineOptions.InstallVersion != "" {
+		want, err := ParseEngineInstallVersion(engineOptions.InstallVersion)
+		if err != nil {
+			return err
+		}
+		if err := checkCgroupV2Version("Docker", want, cgroupV2EngineVersion); err != nil {
+			return err
+		}
+	}
+
+	if err := install(); err != nil {
+		return err
+	}
+	if !cgroupV2 {
+		return nil
+	}
+
+	// The engine may not be installed when asked not to.
+	if installed, err := installedDockerVersion(p); err == nil {
+		if err := checkCgroupV2Version("Docker", installed, cgroupV2EngineVersion); err != nil {
+			return err
+		}
+	}
+
+	log.Debug("Using the systemd cgroup driver on the cgroup v2 machine")
+	engineOptions.ArbitraryFlags = withCgroupDriver(engineOptions.ArbitraryFlags)
+	return nil
+}
+
+// withCgroupDriver returns the engine flags with the systemd cgroup driver,
+// unless they set one already.
+func withCgroupDriver(flags []string) []string {
+	for _, flag := range flags {
+		if strings.Contains(flag, "native.cgroupdriver") {
+			return flags
+		}
+	}
+	return append(flags, systemdCgroupDriver)
+}
+
+// checkContainerdCgroups fails when the containerd or runc releases of the
+// options cannot run on the cgroup v2 hierarchy of the machine.
+func checkContainerdCgroups(containerdVersion, runcVersion string) error {
+	for _, release := range []struct {
+		component string
+		version   string
+		minimum   versioncmp.Version
+	}{
+		{"containerd", containerdVersion, cgroupV2ContainerdVersion},
+		{"runc", runcVersion, cgroupV2RuncVersion},
+	} {
+		v, err := versioncmp.Parse(release.version)
+		if err != nil {
+			return err
+		}
+		if err := checkCgroupV2Version(release.component, v, release.minimum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
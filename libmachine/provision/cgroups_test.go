@@ -0,0 +1,51 @@
+package provision
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/engine"
+	"github.com/rancher/machine/libmachine/provision/provisiontest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsCgroupV2(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{Responses: map[string]string{"stat -fc %T /sys/fs/cgroup/": "cgroup2fs\n"}}
+	assert.True(t, isCgroupV2(commander))
+
+	commander.Responses["stat -fc %T /sys/fs/cgroup/"] = "tmpfs\n"
+	assert.False(t, isCgroupV2(commander))
+}
+
+func TestInstallDockerWithCgroupsRejectsOldVersion(t *testing.T) {
+	p := NewDebianProvisioner(nil).(*DebianProvisioner)
+	p.SSHCommander = &provisiontest.FakeSSHCommander{Responses: map[string]string{"stat -fc %T /sys/fs/cgroup/": "cgroup2fs\n"}}
+
+	err := installDockerWithCgroups(p, &engine.Options{InstallVersion: "19.03.15"}, func() error {
+		return errors.New("expected no installation")
+	})
+
+	assert.EqualError(t, err, "Docker 19.3.15 cannot run on the cgroup v2 hierarchy of the machine, it needs 20.10.0 or later")
+}
+
+func TestInstallDockerWithCgroupsDriver(t *testing.T) {
+	p := NewDebianProvisioner(nil).(*DebianProvisioner)
+	p.SSHCommander = &provisiontest.FakeSSHCommander{Responses: map[string]string{
+		"stat -fc %T /sys/fs/cgroup/": "cgroup2fs\n",
+		"dockerd --version":           "Docker version 24.0.7, build 311b9ff\n",
+	}}
+	engineOptions := &engine.Options{ArbitraryFlags: []string{"debug"}}
+
+	assert.NoError(t, installDockerWithCgroups(p, engineOptions, func() error { return nil }))
+	assert.Equal(t, []string{"debug", systemdCgroupDriver}, engineOptions.ArbitraryFlags)
+}
+
+func TestWithCgroupDriver(t *testing.T) {
+	flags := []string{"exec-opt=native.cgroupdriver=cgroupfs"}
+	assert.Equal(t, flags, withCgroupDriver(flags))
+}
+
+func TestCheckContainerdCgroups(t *testing.T) {
+	assert.NoError(t, checkContainerdCgroups("1.7.22", "1.1.14"))
+	assert.EqualError(t, checkContainerdCgroups("1.3.9", "1.1.14"), "containerd 1.3.9 cannot run on the cgroup v2 hierarchy of the machine, it needs 1.4.0 or later")
+}
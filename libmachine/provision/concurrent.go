@@ -0,0 +1,60 @@
+package provision
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/rancher/machine/libmachine/progress"
+)
+
+// runConcurrently runs the tasks at the same time and waits for all of them,
+// returning the errors of the ones that failed together.
+func runConcurrently(tasks ...func() error) error {
+	errs := make([]error, len(tasks))
+
+	var wg sync.WaitGroup
+	for i, task := range tasks {
+		wg.Add(1)
+		go func(i int, task func() error) {
+			defer wg.Done()
+			errs[i] = task()
+		}(i, task)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// installConcurrently runs the steps of the provisioning that do not depend
+// on each other at the same time: setting the hostname of the machine,
+// installing the packages and the engine on it with install, and generating
+// its server certificate locally. The provisioners doing so configure the
+// auth of the engine with configureAuth, without generating the certificate
+// again.
+//
+// The steps reported by install are not overlapped: the generation of the
+// certificate is reported once install returns, as it was when it followed
+// the install.
+func installConcurrently(p Provisioner, install func() error) error {
+	driver := p.GetDriver()
+	authOptions := p.GetAuthOptions()
+	swarmMaster := p.GetSwarmOptions().Master
+
+	var certErr error
+	err := runConcurrently(
+		func() error {
+			return p.SetHostname(driver.GetMachineName())
+		},
+		install,
+		func() error {
+			certErr = generateServerCert(driver, authOptions, swarmMaster)
+			return certErr
+		},
+	)
+
+	steps := progress.NewTracker(driver.GetMachineName())
+	steps.Start(progress.GeneratingCerts, "Copying certs to the local machine directory...")
+	steps.Done(certErr)
+
+	return err
+}
@@ -0,0 +1,75 @@
+package provision
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rancher/machine/drivers/fakedriver"
+	"github.com/rancher/machine/libmachine/progress"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunConcurrently(t *testing.T) {
+	// Each task waits for the others to start, which only the concurrent
+	// runs get through.
+	var started sync.WaitGroup
+	started.Add(3)
+	task := func(err error) func() error {
+		return func() error {
+			started.Done()
+			started.Wait()
+			return err
+		}
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- runConcurrently(task(errors.New("hostname failed")), task(nil), task(errors.New("install failed")))
+	}()
+
+	select {
+	case err := <-done:
+		assert.EqualError(t, err, "hostname failed\ninstall failed")
+	case <-time.After(5 * time.Second):
+		t.Fatal("the tasks did not run concurrently")
+	}
+}
+
+func TestRunConcurrentlySucceeds(t *testing.T) {
+	assert.NoError(t, runConcurrently(func() error { return nil }, func() error { return nil }))
+}
+
+func TestInstallConcurrentlyReportsSequentialSteps(t *testing.T) {
+	p := NewUbuntuSystemdProvisioner(&fakedriver.Driver{MockName: "concurrent"}).(*UbuntuSystemdProvisioner)
+	p.SSHCommander = &recordingSSHCommander{}
+
+	var events []progress.Event
+	unsubscribe := progress.Subscribe("concurrent", func(ev progress.Event) {
+		events = append(events, ev)
+	})
+	defer unsubscribe()
+
+	err := installConcurrently(p, func() error {
+		steps := progress.NewTracker("concurrent")
+		steps.Start(progress.InstallingDocker, "Installing Docker...")
+		// The certificate is generated meanwhile, without reporting it.
+		time.Sleep(10 * time.Millisecond)
+		steps.Done(nil)
+		return nil
+	})
+	// The fake machine has no CA to sign its certificate with.
+	assert.Error(t, err)
+
+	var types []string
+	for _, ev := range events {
+		types = append(types, string(ev.Type)+" "+ev.Step)
+	}
+	assert.Equal(t, []string{
+		"StepStarted installing-docker",
+		"StepCompleted installing-docker",
+		"StepStarted generating-certs",
+		"StepFailed generating-certs",
+	}, types)
+}
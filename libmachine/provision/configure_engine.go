@@ -0,0 +1,119 @@
+package provision
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rancher/machine/libmachine/auth"
+	"github.com/rancher/machine/libmachine/engine"
+	"github.com/rancher/machine/libmachine/progress"
+	"github.com/rancher/machine/libmachine/provision/serviceaction"
+	"github.com/rancher/machine/libmachine/swarm"
+)
+
+// engineConfigurable is a provisioner whose options can be set without
+// provisioning the machine.
+type engineConfigurable interface {
+	setEngineOptions(authOptions auth.Options, engineOptions engine.Options)
+}
+
+// ConfigureEngine renders the configuration of the engine of a provisioned
+// machine from the engine options again and restarts the engine, without
+// installing anything or regenerating the certificates.
+func ConfigureEngine(p Provisioner, authOptions auth.Options, engineOptions engine.Options) (err error) {
+	configurable, ok := p.(engineConfigurable)
+	if !ok {
+		return fmt.Errorf("the engine of %s machines cannot be configured", p)
+	}
+
+	steps := progress.NewTracker(p.GetDriver().GetMachineName())
+	defer func() { steps.Done(err) }()
+
+	steps.Start(progress.ConfiguringEngine, "Setting Docker configuration on the remote daemon...")
+
+	if engineOptions, err = installedEngineOptions(p, engineOptions); err != nil {
+		return err
+	}
+
+	configurable.setEngineOptions(authOptions, engineOptions)
+	configurable.setEngineOptions(setRemoteAuthOptions(p), engineOptions)
+
+	dockerPort, err := enginePort(p.GetDriver())
+	if err != nil {
+		return err
+	}
+
+	dkrcfg, err := p.GenerateDockerOptions(dockerPort)
+	if err != nil {
+		return err
+	}
+
+	if err := writeDockerOptions(p, dkrcfg); err != nil {
+		return err
+	}
+
+	if err := p.Service("docker", serviceaction.Restart); err != nil {
+		return err
+	}
+
+	return WaitForDocker(p, dockerPort)
+}
+
+// installedEngineOptions returns the engine options with the settings the
+// provisioning picked for the engine installed on the machine, which are not
+// saved with them.
+func installedEngineOptions(p Provisioner, engineOptions engine.Options) (engine.Options, error) {
+	if engineOptions.StorageDriver == "" {
+		// Keep the storage driver the provisioner picked.
+		output, err := p.SSHCommand("sudo docker info --format '{{.Driver}}'")
+		if err != nil {
+			return engineOptions, fmt.Errorf("Error getting the storage driver of the engine: %s", err)
+		}
+		engineOptions.StorageDriver = strings.TrimSpace(output)
+	}
+
+	// The SELinux support of the engine is not saved with the options when
+	// the provisioning enables it.
+	if !engineOptions.SelinuxEnabled {
+		engineOptions.SelinuxEnabled = selinuxEnabled(p, engineOptions)
+	}
+
+	if isCgroupV2(p) {
+		engineOptions.ArbitraryFlags = withCgroupDriver(engineOptions.ArbitraryFlags)
+	}
+	return engineOptions, nil
+}
+
+// ConfigureInstalledEngine does what Provision does once the engine is
+// installed, for a provisioning that failed after installing it to resume
+// without installing the packages again: it configures the proxy, the
+// certificates and the options of the engine, and the swarm.
+func ConfigureInstalledEngine(p Provisioner, swarmOptions swarm.Options, authOptions auth.Options, engineOptions engine.Options) error {
+	configurable, ok := p.(engineConfigurable)
+	if !ok {
+		return fmt.Errorf("the engine of %s machines cannot be configured", p)
+	}
+
+	if err := ConfigureProxy(p, engineOptions); err != nil {
+		return err
+	}
+
+	engineOptions, err := installedEngineOptions(p, engineOptions)
+	if err != nil {
+		return err
+	}
+
+	if err := makeDockerOptionsDir(p); err != nil {
+		return err
+	}
+
+	configurable.setEngineOptions(authOptions, engineOptions)
+	configurable.setEngineOptions(setRemoteAuthOptions(p), engineOptions)
+
+	if err := configureAuth(p, true); err != nil {
+		return err
+	}
+
+	swarmOptions.Env = engineOptions.Env
+	return configureSwarm(p, swarmOptions, p.GetAuthOptions())
+}
@@ -2,24 +2,28 @@ package provision
 
 import (
 	"fmt"
+	"net"
 	"net/url"
 	"strconv"
 	"strings"
 
 	"github.com/rancher/machine/libmachine/auth"
 	"github.com/rancher/machine/libmachine/engine"
-	"github.com/rancher/machine/libmachine/log"
 	"github.com/rancher/machine/libmachine/mcndockerclient"
+	"github.com/rancher/machine/libmachine/progress"
 	"github.com/rancher/machine/libmachine/swarm"
 	"github.com/samalba/dockerclient"
 )
 
-func configureSwarm(p Provisioner, swarmOptions swarm.Options, authOptions auth.Options) error {
+func configureSwarm(p Provisioner, swarmOptions swarm.Options, authOptions auth.Options) (err error) {
 	if !swarmOptions.IsSwarm {
 		return nil
 	}
 
-	log.Info("Configuring swarm...")
+	steps := progress.NewTracker(p.GetDriver().GetMachineName())
+	defer func() { steps.Done(err) }()
+
+	steps.Start(progress.ConfiguringSwarm, "Configuring swarm...")
 
 	ip, err := p.GetDriver().GetIP()
 	if err != nil {
@@ -37,27 +41,29 @@ func configureSwarm(p Provisioner, swarmOptions swarm.Options, authOptions auth.
 		return err
 	}
 
-	parts := strings.Split(engineURL, ":")
-	if len(parts) == 3 {
-		dPort, err := strconv.Atoi(parts[2])
+	eu, err := url.Parse(engineURL)
+	if err != nil {
+		return err
+	}
+	if eu.Port() != "" {
+		dPort, err := strconv.Atoi(eu.Port())
 		if err != nil {
 			return err
 		}
 		enginePort = dPort
 	}
 
-	parts = strings.Split(u.Host, ":")
-	port := parts[1]
+	port := u.Port()
 
 	dockerDir := p.GetDockerOptionsDir()
 	dockerHost := &mcndockerclient.RemoteDocker{
-		HostURL:    fmt.Sprintf("tcp://%s:%d", ip, enginePort),
+		HostURL:    "tcp://" + net.JoinHostPort(ip, strconv.Itoa(enginePort)),
 		AuthOption: &authOptions,
 	}
-	advertiseInfo := fmt.Sprintf("%s:%d", ip, enginePort)
+	advertiseInfo := net.JoinHostPort(ip, strconv.Itoa(enginePort))
 
 	if swarmOptions.Master {
-		advertiseMasterInfo := fmt.Sprintf("%s:%s", ip, "3376")
+		advertiseMasterInfo := net.JoinHostPort(ip, "3376")
 		cmd := fmt.Sprintf("manage --tlsverify --tlscacert=%s --tlscert=%s --tlskey=%s -H %s --strategy %s --advertise %s",
 			authOptions.CaCertRemotePath,
 			authOptions.ServerCertRemotePath,
@@ -0,0 +1,96 @@
+package provision
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/rancher/machine/libmachine/containerd"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/provision/pkgaction"
+	"github.com/rancher/machine/libmachine/provision/serviceaction"
+	"github.com/rancher/machine/libmachine/ssh"
+)
+
+// containerdGroup is the group owning the gRPC socket of containerd, to which
+// the SSH user of the machine is added.
+const containerdGroup = "containerd"
+
+// WithContainerd provisions the machine with containerd instead of the Docker
+// engine. Its gRPC socket is not exposed, clients reach it through an SSH
+// tunnel as the SSH user of the machine.
+func WithContainerd(provisioner Provisioner, opts containerd.Options, hostname string) error {
+	if hostname == "" {
+		hostname = provisioner.GetDriver().GetMachineName()
+	}
+
+	if err := provisioner.SetHostname(hostname); err != nil {
+		return err
+	}
+
+	for _, pkg := range provisioner.GetPackages() {
+		if err := provisioner.Package(pkg, pkgaction.Install); err != nil {
+			return err
+		}
+	}
+
+	cgroupV2 := isCgroupV2(provisioner)
+	if cgroupV2 {
+		if err := checkContainerdCgroups(opts.Version, opts.RuncVersion); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Installing containerd %s...", opts.Version)
+	for _, command := range containerdInstallCommands(opts, provisioner.GetDriver().GetSSHUsername()) {
+		if output, err := provisioner.SSHCommand(command); err != nil {
+			return fmt.Errorf("error installing containerd: %s: output: %s, error: %s", command, output, err)
+		}
+	}
+
+	gid, err := provisioner.SSHCommand(fmt.Sprintf("getent group %s | cut -d: -f3", containerdGroup))
+	if err != nil {
+		return fmt.Errorf("error getting the group of the containerd socket: %s", err)
+	}
+
+	config := containerdConfig(strings.TrimSpace(gid), opts.RegistryMirror, cgroupV2)
+	if err := uploadFile(provisioner, "/etc/containerd/config.toml", strings.NewReader(config+"\n"), ssh.FileAttributes{Owner: "root"}); err != nil {
+		return fmt.Errorf("error writing the containerd configuration: %s", err)
+	}
+
+	if err := provisioner.Service("containerd", serviceaction.Enable); err != nil {
+		return err
+	}
+	return provisioner.Service("containerd", serviceaction.Restart)
+}
+
+// containerdInstallCommands returns the commands installing the containerd
+// and runc releases of the options for the architecture of the machine, and
+// giving user access to the containerd socket.
+func containerdInstallCommands(opts containerd.Options, user string) []string {
+	arch := "$(uname -m | sed 's/x86_64/amd64/;s/aarch64/arm64/')"
+	return []string{
+		fmt.Sprintf("curl -fsSL https://github.com/containerd/containerd/releases/download/v%[1]s/containerd-%[1]s-linux-%[2]s.tar.gz | sudo tar -xz -C /usr/local", opts.Version, arch),
+		fmt.Sprintf("curl -fsSL -o /tmp/runc https://github.com/opencontainers/runc/releases/download/v%s/runc.%s && sudo install -m 755 /tmp/runc /usr/local/sbin/runc", opts.RuncVersion, arch),
+		fmt.Sprintf("sudo curl -fsSL -o /etc/systemd/system/containerd.service https://raw.githubusercontent.com/containerd/containerd/v%s/containerd.service", opts.Version),
+		fmt.Sprintf("sudo groupadd -f %s && sudo usermod -aG %s %s", containerdGroup, containerdGroup, user),
+	}
+}
+
+// containerdConfig returns the config.toml of containerd giving the group gid
+// access to its socket and pulling the Docker Hub images from the mirrors.
+func containerdConfig(gid string, registryMirror []string, systemdCgroup bool) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "version = 2\n\n[grpc]\n  address = %q\n  gid = %s\n", containerd.SocketPath, gid)
+	if systemdCgroup {
+		b.WriteString("\n[plugins.\"io.containerd.grpc.v1.cri\".containerd.runtimes.runc.options]\n  SystemdCgroup = true\n")
+	}
+	if len(registryMirror) > 0 {
+		endpoints := make([]string, len(registryMirror))
+		for i, mirror := range registryMirror {
+			endpoints[i] = fmt.Sprintf("%q", mirror)
+		}
+		fmt.Fprintf(&b, "\n[plugins.\"io.containerd.grpc.v1.cri\".registry.mirrors.\"docker.io\"]\n  endpoint = [%s]\n", strings.Join(endpoints, ", "))
+	}
+	return b.String()
+}
@@ -0,0 +1,36 @@
+package provision
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainerdConfig(t *testing.T) {
+	assert.Equal(t, `version = 2
+
+[grpc]
+  address = "/run/containerd/containerd.sock"
+  gid = 1001
+`, containerdConfig("1001", nil, false))
+
+	assert.Equal(t, `version = 2
+
+[grpc]
+  address = "/run/containerd/containerd.sock"
+  gid = 1001
+
+[plugins."io.containerd.grpc.v1.cri".registry.mirrors."docker.io"]
+  endpoint = ["https://mirror.example.com", "https://registry-1.docker.io"]
+`, containerdConfig("1001", []string{"https://mirror.example.com", "https://registry-1.docker.io"}, false))
+
+	assert.Equal(t, `version = 2
+
+[grpc]
+  address = "/run/containerd/containerd.sock"
+  gid = 1001
+
+[plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc.options]
+  SystemdCgroup = true
+`, containerdConfig("1001", nil, true))
+}
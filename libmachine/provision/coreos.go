@@ -75,8 +75,14 @@ func (provisioner *CoreOSProvisioner) GenerateDockerOptions(dockerPort int) (*Do
 		return nil, err
 	}
 
+	v, err := versioncmp.Parse(dockerVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1.12.0 release candidates already ship dockerd.
 	arg := "daemon"
-	if versioncmp.GreaterThanOrEqualTo(dockerVersion, "1.12.0") {
+	if v.Release().Compare(versioncmp.MustParse("1.12.0")) >= 0 {
 		arg = ""
 	}
 
@@ -98,19 +98,15 @@ func (provisioner *DebianProvisioner) Provision(swarmOptions swarm.Options, auth
 		return err
 	}
 
-	log.Debug("setting hostname")
-	if err := provisioner.SetHostname(provisioner.Driver.GetMachineName()); err != nil {
-		return err
-	}
-
-	log.Debug("installing base packages")
-	for _, pkg := range provisioner.Packages {
-		if err := provisioner.Package(pkg, pkgaction.Install); err != nil {
-			return err
+	log.Debug("setting hostname, installing packages and generating certs")
+	if err := installConcurrently(provisioner, func() error {
+		for _, pkg := range provisioner.Packages {
+			if err := provisioner.Package(pkg, pkgaction.Install); err != nil {
+				return err
+			}
 		}
-	}
-
-	if err := installDockerGeneric(provisioner, provisioner.EngineOptions.InstallURL); err != nil {
+		return installDockerEngine(provisioner, &provisioner.EngineOptions)
+	}); err != nil {
 		return err
 	}
 
@@ -122,7 +118,7 @@ func (provisioner *DebianProvisioner) Provision(swarmOptions swarm.Options, auth
 	provisioner.AuthOptions = setRemoteAuthOptions(provisioner)
 
 	log.Debug("configuring auth")
-	if err := ConfigureAuth(provisioner); err != nil {
+	if err := configureAuth(provisioner, false); err != nil {
 		return err
 	}
 
@@ -0,0 +1,99 @@
+package provision
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/progress"
+	"github.com/rancher/machine/libmachine/ssh"
+	"github.com/rancher/machine/libmachine/versioncmp"
+)
+
+// dockerBundleDir is where the binaries of the offline bundles are installed,
+// the path the engine options of the systemd provisioners start dockerd from.
+const dockerBundleDir = "/usr/bin"
+
+// dockerBundleUnit is the unit of the engine installed from an offline bundle,
+// which starts the containerd of the bundle itself.
+const dockerBundleUnit = `[Unit]
+Description=Docker Application Container Engine
+Documentation=https://docs.docker.com
+After=network-online.target firewalld.service
+Wants=network-online.target
+
+[Service]
+Type=notify
+ExecStart=` + dockerBundleDir + `/dockerd
+ExecReload=/bin/kill -s HUP $MAINPID
+LimitNOFILE=infinity
+LimitNPROC=infinity
+LimitCORE=infinity
+TasksMax=infinity
+Delegate=yes
+KillMode=process
+Restart=on-failure
+StartLimitBurst=3
+StartLimitInterval=60s
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// installDockerBundle installs the engine from the offline bundle at the
+// local path, a tarball of the static binaries Docker publishes at
+// https://download.docker.com/linux/static, for machines that cannot reach
+// the internet. The engine is checked to be of the version, if one is given.
+func installDockerBundle(p Provisioner, bundle, version string) (err error) {
+	var want *versioncmp.Version
+	if version != "" {
+		v, err := ParseEngineInstallVersion(version)
+		if err != nil {
+			return err
+		}
+		want = &v
+	}
+
+	steps := progress.NewTracker(p.GetDriver().GetMachineName())
+	defer func() { steps.Done(err) }()
+
+	steps.Start(progress.InstallingDocker, fmt.Sprintf("Installing Docker from the offline bundle: %s", bundle))
+
+	if installed, err := installedDockerVersion(p); err == nil && (want == nil || installed.Compare(*want) == 0) {
+		log.Infof("Docker %s is already installed", installed)
+		return nil
+	}
+
+	if _, err := p.SSHCommand("systemctl --version"); err != nil {
+		return fmt.Errorf("installing Docker from an offline bundle needs systemd: %s", err)
+	}
+
+	f, err := os.Open(bundle)
+	if err != nil {
+		return fmt.Errorf("Error opening the offline bundle: %s", err)
+	}
+	defer f.Close()
+
+	log.Debugf("Uploading the offline bundle %s to %s", bundle, dockerBundleDir)
+	if _, err := drivers.RunSSHCommandWithInputFromDriver(p.GetDriver(), fmt.Sprintf("sudo tar -xzf - -C %s --strip-components=1 --no-same-owner", dockerBundleDir), f); err != nil {
+		return fmt.Errorf("Error uploading the offline bundle: %s", err)
+	}
+
+	if err := uploadFile(p, "/etc/systemd/system/docker.service", strings.NewReader(dockerBundleUnit), ssh.FileAttributes{Owner: "root"}); err != nil {
+		return fmt.Errorf("Error installing the Docker service: %s", err)
+	}
+
+	for _, command := range []string{
+		"sudo groupadd -f docker",
+		"sudo systemctl daemon-reload",
+		"sudo systemctl enable --now docker",
+	} {
+		if output, err := p.SSHCommand(command); err != nil {
+			return fmt.Errorf("Error installing the Docker service: %s", output)
+		}
+	}
+
+	return checkInstalledDockerVersion(p, want)
+}
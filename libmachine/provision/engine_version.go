@@ -0,0 +1,226 @@
+package provision
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/rancher/machine/libmachine/engine"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/progress"
+	"github.com/rancher/machine/libmachine/versioncmp"
+)
+
+// DefaultEnginePackagesURL is the base URL of the package repositories Docker
+// publishes for each distribution.
+const DefaultEnginePackagesURL = "https://download.docker.com/linux"
+
+var dockerdVersionRegexp = regexp.MustCompile(`Docker version ([^,\s]+)`)
+
+// enginePackages are the commands installing the packages of the engine from
+// the Docker repository of a distribution.
+type enginePackages struct {
+	// setup adds the Docker repository to the package manager.
+	setup []string
+	// list prints the package versions of the engine, newest first, one per
+	// line.
+	list string
+	// install returns the command installing the package version.
+	install func(pkgVersion string) string
+}
+
+// ParseEngineInstallVersion parses the engine version to install, which has
+// to be an exact release like 24.0.7.
+func ParseEngineInstallVersion(version string) (versioncmp.Version, error) {
+	v, err := versioncmp.Parse(version)
+	if err != nil {
+		return v, err
+	}
+	if len(v.Segments) < 3 || v.Build != "" {
+		return v, fmt.Errorf("engine install version %q is not an exact release like 24.0.7", version)
+	}
+	return v, nil
+}
+
+// installDockerEngine installs the engine the way the engine options say,
+// and configures its cgroup driver for the machine.
+func installDockerEngine(p Provisioner, engineOptions *engine.Options) error {
+	return installDockerWithCgroups(p, engineOptions, func() error {
+		return installDockerFromSource(p, *engineOptions)
+	})
+}
+
+// installDockerFromSource installs the engine from the offline bundle or the
+// package repository of the engine options, in the version they pin, or the
+// one the install script gives otherwise.
+func installDockerFromSource(p Provisioner, engineOptions engine.Options) error {
+	switch {
+	case engineOptions.OfflineBundle != "":
+		return installDockerBundle(p, engineOptions.OfflineBundle, engineOptions.InstallVersion)
+	case engineOptions.InstallVersion != "" || engineOptions.PackagesURL != "":
+		return installDockerPackages(p, engineOptions.PackagesURL, engineOptions.InstallVersion)
+	}
+	return installDockerGeneric(p, engineOptions.InstallURL)
+}
+
+// installDockerPackages installs the packages of the engine, in the version
+// if one is given, from the Docker repository at packagesURL, or its mirror,
+// with the package manager of the machine.
+func installDockerPackages(p Provisioner, packagesURL, version string) (err error) {
+	var want *versioncmp.Version
+	if version != "" {
+		v, err := ParseEngineInstallVersion(version)
+		if err != nil {
+			return err
+		}
+		want = &v
+	}
+	if packagesURL == "" {
+		packagesURL = DefaultEnginePackagesURL
+	}
+
+	steps := progress.NewTracker(p.GetDriver().GetMachineName())
+	defer func() { steps.Done(err) }()
+
+	steps.Start(progress.InstallingDocker, fmt.Sprintf("Installing Docker from: %s", packagesURL))
+
+	if installed, err := installedDockerVersion(p); err == nil && (want == nil || installed.Compare(*want) == 0) {
+		log.Infof("Docker %s is already installed", installed)
+		return nil
+	}
+
+	osRelease, err := p.GetOsReleaseInfo()
+	if err != nil {
+		return err
+	}
+	packages, err := enginePackagesFor(osRelease, strings.TrimSuffix(packagesURL, "/"))
+	if err != nil {
+		return err
+	}
+
+	for _, command := range packages.setup {
+		if output, err := p.SSHCommand(command); err != nil {
+			return fmt.Errorf("Error adding the Docker repository: %s", output)
+		}
+	}
+
+	pkgVersion := ""
+	if want != nil {
+		output, err := p.SSHCommand(packages.list)
+		if err != nil {
+			return fmt.Errorf("Error listing the Docker packages: %s", output)
+		}
+		if pkgVersion, err = resolvePackageVersion(*want, output); err != nil {
+			return err
+		}
+		log.Infof("Installing the %s packages of Docker", pkgVersion)
+	}
+
+	if output, err := p.SSHCommand(packages.install(pkgVersion)); err != nil {
+		return fmt.Errorf("Error installing Docker: %s", output)
+	}
+
+	return checkInstalledDockerVersion(p, want)
+}
+
+// checkInstalledDockerVersion checks that the engine installed on the machine
+// is of the version, if one is wanted.
+func checkInstalledDockerVersion(p SSHCommander, want *versioncmp.Version) error {
+	installed, err := installedDockerVersion(p)
+	if err != nil {
+		return err
+	}
+	if want != nil && installed.Compare(*want) != 0 {
+		return fmt.Errorf("Docker %s was installed instead of %s", installed, want)
+	}
+	return nil
+}
+
+// enginePackagesFor returns the commands installing the engine on the
+// distribution, from the repositories Docker publishes at packagesURL.
+func enginePackagesFor(osRelease *OsRelease, packagesURL string) (*enginePackages, error) {
+	switch osRelease.ID {
+	case "ubuntu", "debian", "raspbian":
+		repoURL := fmt.Sprintf("%s/%s", packagesURL, osRelease.ID)
+		return &enginePackages{
+			setup: []string{
+				"sudo -E apt-get update",
+				"sudo -E apt-get install -y ca-certificates curl gnupg",
+				"sudo install -m 0755 -d /etc/apt/keyrings",
+				fmt.Sprintf("curl -fsSL %s/gpg | sudo gpg --dearmor --yes -o /etc/apt/keyrings/docker.gpg", repoURL),
+				fmt.Sprintf(`echo "deb [arch=$(dpkg --print-architecture) signed-by=/etc/apt/keyrings/docker.gpg] %s $(. /etc/os-release && echo "$VERSION_CODENAME") stable" | sudo tee /etc/apt/sources.list.d/docker.list`, repoURL),
+				"sudo -E apt-get update",
+			},
+			list: "apt-cache madison docker-ce | awk '{print $3}'",
+			install: func(pkgVersion string) string {
+				if pkgVersion == "" {
+					return "sudo -E apt-get install -y docker-ce docker-ce-cli containerd.io"
+				}
+				return fmt.Sprintf("sudo -E apt-get install -y --allow-downgrades docker-ce=%[1]s docker-ce-cli=%[1]s containerd.io", pkgVersion)
+			},
+		}, nil
+	case "centos", "rocky", "almalinux", "ol", "rhel", "fedora":
+		dist := osRelease.ID
+		switch dist {
+		case "rocky", "almalinux", "ol":
+			dist = "centos"
+		}
+		return &enginePackages{
+			setup: []string{
+				fmt.Sprintf("sudo curl -fsSL -o /etc/yum.repos.d/docker-ce.repo %s/%s/docker-ce.repo", packagesURL, dist),
+			},
+			list: "sudo -E yum list --showduplicates --quiet docker-ce | awk '$1 ~ /^docker-ce\\./ {print $2}' | sort -rV",
+			install: func(pkgVersion string) string {
+				if pkgVersion == "" {
+					return "sudo -E yum install -y docker-ce docker-ce-cli containerd.io"
+				}
+				// yum names the package versions without their epoch.
+				if n := strings.IndexByte(pkgVersion, ':'); n != -1 {
+					pkgVersion = pkgVersion[n+1:]
+				}
+				return fmt.Sprintf("sudo -E yum install -y docker-ce-%[1]s docker-ce-cli-%[1]s containerd.io", pkgVersion)
+			},
+		}, nil
+	}
+	return nil, fmt.Errorf("installing the engine from the Docker packages is not supported on %s", osRelease.ID)
+}
+
+// resolvePackageVersion returns the first of the package versions listed,
+// one per line, of the engine version.
+func resolvePackageVersion(want versioncmp.Version, listed string) (string, error) {
+	for _, line := range strings.Split(listed, "\n") {
+		pkgVersion := strings.TrimSpace(line)
+		if pkgVersion == "" {
+			continue
+		}
+		v, err := versioncmp.Parse(pkgVersion)
+		if err != nil {
+			log.Debugf("Skipping the Docker package version %q: %s", pkgVersion, err)
+			continue
+		}
+		if v.Compare(want) == 0 {
+			return pkgVersion, nil
+		}
+	}
+	return "", fmt.Errorf("no package of Docker %s was found in the Docker repository", want)
+}
+
+// installedDockerVersion returns the version of the engine installed on the
+// machine.
+func installedDockerVersion(p SSHCommander) (versioncmp.Version, error) {
+	output, err := p.SSHCommand("dockerd --version")
+	if err != nil {
+		return versioncmp.Version{}, fmt.Errorf("Error getting the installed Docker version: %s", err)
+	}
+	return parseDockerdVersion(output)
+}
+
+// parseDockerdVersion parses the version `dockerd --version` prints, like
+// "Docker version 24.0.7, build 311b9ff".
+func parseDockerdVersion(output string) (versioncmp.Version, error) {
+	match := dockerdVersionRegexp.FindStringSubmatch(output)
+	if match == nil {
+		return versioncmp.Version{}, fmt.Errorf("unable to read the Docker version from %q", strings.TrimSpace(output))
+	}
+	return versioncmp.Parse(match[1])
+}
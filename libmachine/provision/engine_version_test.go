@@ -0,0 +1,97 @@
+package provision
+
+import (
+	"testing"
+
+	"github.com/rancher/machine/libmachine/versioncmp"
+)
+
+func TestParseEngineInstallVersion(t *testing.T) {
+	for _, version := range []string{"24.0.7", "v24.0.7", "17.03.2-ce", "25.0.0-rc.1"} {
+		if _, err := ParseEngineInstallVersion(version); err != nil {
+			t.Fatalf("expected %q to be an exact version: %s", version, err)
+		}
+	}
+
+	for _, version := range []string{"", "24", "24.0", "latest", "5:24.0.7-1~ubuntu.22.04~jammy"} {
+		if _, err := ParseEngineInstallVersion(version); err == nil {
+			t.Fatalf("expected %q not to be an exact version", version)
+		}
+	}
+}
+
+func TestResolvePackageVersion(t *testing.T) {
+	want := versioncmp.MustParse("24.0.7")
+
+	apt := `5:25.0.0-1~ubuntu.22.04~jammy
+5:24.0.8-1~ubuntu.22.04~jammy
+5:24.0.7-1~ubuntu.22.04~jammy
+5:24.0.6-1~ubuntu.22.04~jammy
+`
+	if pkgVersion, err := resolvePackageVersion(want, apt); err != nil || pkgVersion != "5:24.0.7-1~ubuntu.22.04~jammy" {
+		t.Fatalf("expected the jammy package of 24.0.7, got %q: %v", pkgVersion, err)
+	}
+
+	yum := `3:24.0.9-1.el9
+3:24.0.7-1.el9
+3:24.0.0-1.el9
+`
+	if pkgVersion, err := resolvePackageVersion(want, yum); err != nil || pkgVersion != "3:24.0.7-1.el9" {
+		t.Fatalf("expected the el9 package of 24.0.7, got %q: %v", pkgVersion, err)
+	}
+
+	if _, err := resolvePackageVersion(want, "5:24.0.70-1~debian.12~bookworm\n5:24.0.7~rc.1-1~debian.12~bookworm\n"); err == nil {
+		t.Fatal("expected no package of 24.0.7")
+	}
+}
+
+func TestEnginePackagesInstall(t *testing.T) {
+	packages, err := enginePackagesFor(&OsRelease{ID: "ubuntu"}, DefaultEnginePackagesURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "sudo -E apt-get install -y --allow-downgrades docker-ce=5:24.0.7-1~ubuntu.22.04~jammy docker-ce-cli=5:24.0.7-1~ubuntu.22.04~jammy containerd.io"
+	if command := packages.install("5:24.0.7-1~ubuntu.22.04~jammy"); command != expected {
+		t.Fatalf("expected %q, got %q", expected, command)
+	}
+
+	packages, err = enginePackagesFor(&OsRelease{ID: "rocky"}, DefaultEnginePackagesURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "sudo -E yum install -y docker-ce-24.0.7-1.el9 docker-ce-cli-24.0.7-1.el9 containerd.io"
+	if command := packages.install("3:24.0.7-1.el9"); command != expected {
+		t.Fatalf("expected %q, got %q", expected, command)
+	}
+
+	if command := packages.install(""); command != "sudo -E yum install -y docker-ce docker-ce-cli containerd.io" {
+		t.Fatalf("expected the latest packages to be installed, got %q", command)
+	}
+
+	packages, err = enginePackagesFor(&OsRelease{ID: "almalinux"}, "https://mirror.example.com/docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "sudo curl -fsSL -o /etc/yum.repos.d/docker-ce.repo https://mirror.example.com/docker/centos/docker-ce.repo"
+	if packages.setup[0] != expected {
+		t.Fatalf("expected %q, got %q", expected, packages.setup[0])
+	}
+
+	if _, err := enginePackagesFor(&OsRelease{ID: "opensuse-leap"}, DefaultEnginePackagesURL); err == nil {
+		t.Fatal("expected no engine packages for opensuse-leap")
+	}
+}
+
+func TestParseDockerdVersion(t *testing.T) {
+	v, err := parseDockerdVersion("Docker version 24.0.7, build 311b9ff\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Compare(versioncmp.MustParse("24.0.7")) != 0 {
+		t.Fatalf("expected 24.0.7, got %s", v)
+	}
+
+	if _, err := parseDockerdVersion("dockerd: command not found"); err == nil {
+		t.Fatal("expected no version")
+	}
+}
@@ -0,0 +1,156 @@
+package provision
+
+import (
+	"fmt"
+
+	"github.com/rancher/machine/libmachine/auth"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/engine"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/mcnutils"
+	"github.com/rancher/machine/libmachine/provision/pkgaction"
+	"github.com/rancher/machine/libmachine/provision/serviceaction"
+	"github.com/rancher/machine/libmachine/swarm"
+)
+
+// dockerCentOSRepo is the Docker repository of the rebuilds of Red Hat
+// Enterprise Linux.
+const dockerCentOSRepo = "https://download.docker.com/linux/centos/docker-ce.repo"
+
+// EnterpriseLinuxProvisioner provisions the rebuilds of Red Hat Enterprise
+// Linux 8 and 9, which the Docker install script does not know, with dnf from
+// the CentOS repository of Docker.
+type EnterpriseLinuxProvisioner struct {
+	*RedHatProvisioner
+}
+
+func NewEnterpriseLinuxProvisioner(osReleaseID string, d drivers.Driver) *EnterpriseLinuxProvisioner {
+	return &EnterpriseLinuxProvisioner{
+		NewRedHatProvisioner(osReleaseID, d),
+	}
+}
+
+func (provisioner *EnterpriseLinuxProvisioner) Package(name string, action pkgaction.PackageAction) error {
+	var packageAction string
+
+	switch action {
+	case pkgaction.Install:
+		packageAction = "install"
+	case pkgaction.Remove, pkgaction.Purge:
+		packageAction = "remove"
+	case pkgaction.Upgrade:
+		packageAction = "upgrade"
+	}
+
+	command := fmt.Sprintf("sudo -E dnf %s -y %s", packageAction, name)
+
+	if _, err := provisioner.SSHCommand(command); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (provisioner *EnterpriseLinuxProvisioner) Provision(swarmOptions swarm.Options, authOptions auth.Options, engineOptions engine.Options) error {
+	provisioner.SwarmOptions = swarmOptions
+	provisioner.AuthOptions = authOptions
+	provisioner.EngineOptions = engineOptions
+	swarmOptions.Env = engineOptions.Env
+
+	storageDriver, err := decideStorageDriver(provisioner, DefaultStorageDriver, engineOptions.StorageDriver)
+	if err != nil {
+		return err
+	}
+	provisioner.EngineOptions.StorageDriver = storageDriver
+
+	if err := installConcurrently(provisioner, func() error {
+		for _, pkg := range provisioner.Packages {
+			log.Debugf("installing base package: name=%s", pkg)
+			if err := provisioner.Package(pkg, pkgaction.Install); err != nil {
+				return err
+			}
+		}
+
+		if err := configureSELinux(provisioner, &provisioner.EngineOptions); err != nil {
+			return err
+		}
+
+		if err := installDockerWithCgroups(provisioner, &provisioner.EngineOptions, provisioner.installDocker); err != nil {
+			return err
+		}
+		if err := provisioner.Service("docker", serviceaction.Restart); err != nil {
+			return err
+		}
+		return provisioner.Service("docker", serviceaction.Enable)
+	}); err != nil {
+		return err
+	}
+
+	if err := mcnutils.WaitFor(provisioner.dockerDaemonResponding); err != nil {
+		return err
+	}
+
+	// Docker labels the containers for SELinux only when told to.
+	if provisioner.EngineOptions.SELinux == "" && selinuxEnabled(provisioner, provisioner.EngineOptions) {
+		log.Debug("SELinux is enforcing, enabling SELinux support of the engine")
+		provisioner.EngineOptions.SelinuxEnabled = true
+	}
+
+	dockerPort, err := enginePort(provisioner.Driver)
+	if err != nil {
+		return err
+	}
+	if _, err := provisioner.SSHCommand(firewalldOpenPortCommand(dockerPort)); err != nil {
+		return fmt.Errorf("error opening port %d in firewalld: %s", dockerPort, err)
+	}
+
+	if err := makeDockerOptionsDir(provisioner); err != nil {
+		return err
+	}
+
+	provisioner.AuthOptions = setRemoteAuthOptions(provisioner)
+
+	if err := configureAuth(provisioner, false); err != nil {
+		return err
+	}
+
+	if provisioner.EngineOptions.SELinux == SELinuxEnforcing {
+		if err := verifySELinuxLabels(provisioner, provisioner.GetDockerOptionsDir()); err != nil {
+			return err
+		}
+	}
+
+	err = configureSwarm(provisioner, swarmOptions, provisioner.AuthOptions)
+	return err
+}
+
+// installDocker installs Docker from its CentOS repository, unless another
+// install URL is given.
+func (provisioner *EnterpriseLinuxProvisioner) installDocker() error {
+	if provisioner.EngineOptions.OfflineBundle != "" || provisioner.EngineOptions.InstallVersion != "" || provisioner.EngineOptions.PackagesURL != "" {
+		return installDockerFromSource(provisioner, provisioner.EngineOptions)
+	}
+
+	installURL := provisioner.EngineOptions.InstallURL
+	if installURL != "" && installURL != drivers.DefaultEngineInstallURL {
+		return installDockerGeneric(provisioner, installURL)
+	}
+
+	log.Infof("Installing Docker from: %s", dockerCentOSRepo)
+	for _, command := range []string{
+		"sudo -E dnf install -y dnf-plugins-core",
+		fmt.Sprintf("sudo -E dnf config-manager --add-repo %s", dockerCentOSRepo),
+		"sudo -E dnf install -y docker-ce docker-ce-cli containerd.io",
+	} {
+		if output, err := provisioner.SSHCommand(command); err != nil {
+			return fmt.Errorf("Error installing Docker: %s", output)
+		}
+	}
+	return nil
+}
+
+// firewalldOpenPortCommand returns the command opening the TCP port in
+// firewalld, if it is running.
+func firewalldOpenPortCommand(port int) string {
+	return fmt.Sprintf("if sudo systemctl is-active --quiet firewalld; then sudo firewall-cmd --permanent --add-port=%d/tcp && sudo firewall-cmd --reload; fi", port)
+}
@@ -0,0 +1,40 @@
+package provision
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rancher/machine/drivers/fakedriver"
+)
+
+func TestEnterpriseLinuxCompatibleWithHost(t *testing.T) {
+	for id, p := range map[string]Provisioner{
+		"rocky":     NewRockyProvisioner(&fakedriver.Driver{}),
+		"almalinux": NewAlmaLinuxProvisioner(&fakedriver.Driver{}),
+	} {
+		p.SetOsReleaseInfo(&OsRelease{ID: id, IDLike: "rhel centos fedora", VersionID: "9.4"})
+		if !p.CompatibleWithHost() {
+			t.Fatalf("expected the %s provisioner to be compatible with %s", p, id)
+		}
+	}
+}
+
+func TestEnterpriseLinuxGenerateDockerOptionsSelinux(t *testing.T) {
+	p := NewEnterpriseLinuxProvisioner("rocky", &fakedriver.Driver{})
+	p.EngineOptions.SelinuxEnabled = true
+
+	opts, err := p.GenerateDockerOptions(2376)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(opts.EngineOptions, "--selinux-enabled ") {
+		t.Fatalf("expected the engine to enable SELinux support: %s", opts.EngineOptions)
+	}
+}
+
+func TestFirewalldOpenPortCommand(t *testing.T) {
+	expected := "if sudo systemctl is-active --quiet firewalld; then sudo firewall-cmd --permanent --add-port=2376/tcp && sudo firewall-cmd --reload; fi"
+	if command := firewalldOpenPortCommand(2376); command != expected {
+		t.Fatalf("expected %q, got %q", expected, command)
+	}
+}
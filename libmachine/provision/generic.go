@@ -3,11 +3,13 @@ package provision
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"text/template"
 
 	"github.com/rancher/machine/libmachine/auth"
 	"github.com/rancher/machine/libmachine/drivers"
 	"github.com/rancher/machine/libmachine/engine"
+	"github.com/rancher/machine/libmachine/ssh"
 	"github.com/rancher/machine/libmachine/swarm"
 )
 
@@ -32,6 +34,19 @@ func (sshCmder GenericSSHCommander) SSHCommand(args string) (string, error) {
 	return drivers.RunSSHCommandFromDriver(sshCmder.Driver, args)
 }
 
+func (sshCmder GenericSSHCommander) Upload(content io.Reader, path string, attrs ssh.FileAttributes) error {
+	return drivers.UploadFromDriver(sshCmder.Driver, content, path, attrs)
+}
+
+// Upload uploads the file with the SSHCommander of the provisioner.
+func (provisioner *GenericProvisioner) Upload(content io.Reader, path string, attrs ssh.FileAttributes) error {
+	uploader, ok := provisioner.SSHCommander.(FileUploader)
+	if !ok {
+		return fmt.Errorf("the provisioner cannot upload %s to the machine", path)
+	}
+	return uploader.Upload(content, path, attrs)
+}
+
 func (provisioner *GenericProvisioner) Hostname() (string, error) {
 	return provisioner.SSHCommand("hostname")
 }
@@ -133,6 +148,11 @@ DOCKER_OPTS='
 	}, nil
 }
 
+func (provisioner *GenericProvisioner) setEngineOptions(authOptions auth.Options, engineOptions engine.Options) {
+	provisioner.AuthOptions = authOptions
+	provisioner.EngineOptions = engineOptions
+}
+
 func (provisioner *GenericProvisioner) GetDriver() drivers.Driver {
 	return provisioner.Driver
 }
@@ -0,0 +1,108 @@
+package provision
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/log"
+)
+
+const (
+	// PreProvisionHook is the hook run before the engine is installed.
+	PreProvisionHook = "pre-provision"
+	// PostProvisionHook is the hook run after the engine is installed.
+	PostProvisionHook = "post-provision"
+)
+
+// RunHook runs the hook, the path of a local script or inline commands, on
+// the machine as root, logging its output as it runs. The script is written
+// to a file only the SSH user can access, removed once the hook ran.
+func RunHook(d drivers.Driver, name, hook string) error {
+	script, err := hookScript(hook)
+	if err != nil {
+		return err
+	}
+
+	output, err := drivers.RunSSHCommandWithInputFromDriver(d,
+		fmt.Sprintf(`path=$(mktemp /tmp/machine-%s-hook.XXXXXXXXXX) && chmod 0700 "$path" && cat >"$path" && echo "$path"`, name),
+		strings.NewReader(script))
+	if err != nil {
+		return fmt.Errorf("error uploading the %s hook: %s", name, err)
+	}
+	remotePath := strings.TrimSpace(output)
+	defer func() {
+		if _, err := drivers.RunSSHCommandFromDriver(d, "rm -f "+shellQuote(remotePath)); err != nil {
+			log.Debugf("Error removing the %s hook: %s", name, err)
+		}
+	}()
+
+	client, err := drivers.GetSSHClientFromDriver(d)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Running the %s hook...", name)
+	stdout, stderr, err := client.Start("sudo sh " + shellQuote(remotePath))
+	if err != nil {
+		return fmt.Errorf("error running the %s hook: %s", name, err)
+	}
+
+	var wg sync.WaitGroup
+	for _, output := range []io.Reader{stdout, stderr} {
+		wg.Add(1)
+		go func(output io.Reader) {
+			defer wg.Done()
+			logHookOutput(name, output)
+		}(output)
+	}
+	wg.Wait()
+
+	if err := client.Wait(); err != nil {
+		return fmt.Errorf("the %s hook failed: %s", name, err)
+	}
+	return nil
+}
+
+// hookScript returns the content of the hook script, or the inline commands
+// of the hook when it is not the path of a local file. A hook looking like
+// the path of a script that does not exist is an error, rather than
+// commands which would fail on the machine.
+func hookScript(hook string) (string, error) {
+	info, err := os.Stat(hook)
+	if err != nil || info.IsDir() {
+		if hookLooksLikePath(hook) {
+			return "", fmt.Errorf("hook script %s not found", hook)
+		}
+		return hook, nil
+	}
+
+	content, err := os.ReadFile(hook)
+	if err != nil {
+		return "", fmt.Errorf("unable to read file %s: %v", hook, err)
+	}
+	return string(content), nil
+}
+
+// hookLooksLikePath tells whether the hook, a single word with a slash or
+// the extension of a script, is the path of a script.
+func hookLooksLikePath(hook string) bool {
+	if strings.ContainsAny(hook, " \t\n;|&") {
+		return false
+	}
+	return strings.ContainsAny(hook, `/\`) || strings.HasSuffix(hook, ".sh")
+}
+
+func logHookOutput(name string, output io.Reader) {
+	scanner := bufio.NewScanner(output)
+	for scanner.Scan() {
+		log.Infof("(%s hook) %s", name, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		log.Debugf("Error reading the output of the %s hook: %s", name, err)
+	}
+}
@@ -0,0 +1,47 @@
+package provision
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHookScript(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hook.sh")
+	if err := os.WriteFile(path, []byte("mkfs.xfs /dev/sdb\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	script, err := hookScript(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if script != "mkfs.xfs /dev/sdb\n" {
+		t.Fatalf("expected the content of the script, got %q", script)
+	}
+
+	script, err = hookScript("sysctl -w vm.max_map_count=262144")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if script != "sysctl -w vm.max_map_count=262144" {
+		t.Fatalf("expected the inline commands, got %q", script)
+	}
+}
+
+func TestHookScriptNotFound(t *testing.T) {
+	for _, hook := range []string{"./hooks/pre.sh", "/etc/machine/pre-provision", "pre.sh"} {
+		if _, err := hookScript(hook); err == nil {
+			t.Fatalf("expected an error for the missing script %s", hook)
+		}
+	}
+
+	// Commands with paths are inline commands.
+	script, err := hookScript("mkdir -p /data && chmod 700 /data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if script != "mkdir -p /data && chmod 700 /data" {
+		t.Fatalf("expected the inline commands, got %q", script)
+	}
+}
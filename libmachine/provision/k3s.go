@@ -0,0 +1,90 @@
+package provision
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rancher/machine/libmachine/k3s"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/provision/pkgaction"
+	"github.com/rancher/machine/libmachine/ssh"
+)
+
+const (
+	k3sRegistriesPath = "/etc/rancher/k3s/registries.yaml"
+	// k3sTokenPath is the file holding the token of the cluster an agent
+	// joins, so that it never is on a command line.
+	k3sTokenPath = "/etc/rancher/k3s/cluster-token"
+)
+
+// WithK3s provisions the machine with k3s instead of the Docker engine.
+func WithK3s(provisioner Provisioner, opts k3s.Options, hostname string) error {
+	if hostname == "" {
+		hostname = provisioner.GetDriver().GetMachineName()
+	}
+
+	if err := provisioner.SetHostname(hostname); err != nil {
+		return err
+	}
+
+	for _, pkg := range provisioner.GetPackages() {
+		if err := provisioner.Package(pkg, pkgaction.Install); err != nil {
+			return err
+		}
+	}
+
+	if opts.RegistriesFile != "" {
+		registries, err := os.Open(opts.RegistriesFile)
+		if err != nil {
+			return fmt.Errorf("unable to read file %s: %v", opts.RegistriesFile, err)
+		}
+		err = uploadFile(provisioner, k3sRegistriesPath, registries, ssh.FileAttributes{Mode: 0600, Owner: "root"})
+		registries.Close()
+		if err != nil {
+			return fmt.Errorf("error uploading registries.yaml: %s", err)
+		}
+	}
+
+	if opts.Token != "" {
+		if err := uploadFile(provisioner, k3sTokenPath, strings.NewReader(opts.Token), ssh.FileAttributes{Mode: 0600, Owner: "root"}); err != nil {
+			return fmt.Errorf("error uploading the k3s token: %s", err)
+		}
+	}
+
+	log.Infof("Installing k3s %s...", opts.Role)
+	if output, err := provisioner.SSHCommand(k3sInstallCommand(opts)); err != nil {
+		return fmt.Errorf("error installing k3s: output: %s, error: %s", output, err)
+	}
+
+	return nil
+}
+
+// k3sInstallCommand returns the command running the k3s install script with
+// the environment selecting the release and the cluster to join. The token
+// of the cluster is read from k3sTokenPath, uploaded when the token is
+// given and reused by agents when it no longer is.
+func k3sInstallCommand(opts k3s.Options) string {
+	env := map[string]string{
+		"INSTALL_K3S_CHANNEL": opts.Channel,
+		"INSTALL_K3S_VERSION": opts.Version,
+		"K3S_URL":             opts.ServerURL,
+	}
+	if opts.Token != "" || opts.Role == k3s.RoleAgent {
+		env["K3S_TOKEN_FILE"] = k3sTokenPath
+	}
+	var vars []string
+	for name, value := range env {
+		if value != "" {
+			vars = append(vars, name+"="+shellQuote(value))
+		}
+	}
+	sort.Strings(vars)
+
+	installURL := opts.InstallURL
+	if installURL == "" {
+		installURL = k3s.DefaultInstallURL
+	}
+	return fmt.Sprintf("curl -sfL %s | sudo %s sh -s - %s", shellQuote(installURL), strings.Join(vars, " "), shellQuote(opts.Role))
+}
@@ -0,0 +1,58 @@
+package provision
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/k3s"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestK3sInstallCommand(t *testing.T) {
+	assert.Equal(t, "curl -sfL 'https://get.k3s.io' | sudo INSTALL_K3S_CHANNEL='stable' sh -s - 'server'",
+		k3sInstallCommand(k3s.Options{Role: k3s.RoleServer, Channel: "stable"}))
+
+	assert.Equal(t, "curl -sfL 'https://example.com/k3s.sh' | sudo INSTALL_K3S_VERSION='v1.30.4+k3s1' K3S_TOKEN_FILE='/etc/rancher/k3s/cluster-token' K3S_URL='https://10.0.0.1:6443' sh -s - 'agent'",
+		k3sInstallCommand(k3s.Options{
+			Role:       k3s.RoleAgent,
+			Version:    "v1.30.4+k3s1",
+			ServerURL:  "https://10.0.0.1:6443",
+			Token:      "secret",
+			InstallURL: "https://example.com/k3s.sh",
+		}))
+
+	// The values are quoted, and the token never is on the command line.
+	command := k3sInstallCommand(k3s.Options{
+		Role:      k3s.RoleAgent,
+		ServerURL: "https://10.0.0.1:6443'; reboot; '",
+		Token:     "K10'$(id)",
+	})
+	assert.Contains(t, command, `K3S_URL='https://10.0.0.1:6443'\''; reboot; '\'''`)
+	assert.NotContains(t, command, "K10")
+}
+
+func TestK3sTokenNotSaved(t *testing.T) {
+	data, err := json.Marshal(k3s.Options{Role: k3s.RoleAgent, ServerURL: "https://10.0.0.1:6443", Token: "secret"})
+
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "secret")
+}
+
+func TestWithK3sUploadsToken(t *testing.T) {
+	p := NewUbuntuSystemdProvisioner(nil).(*UbuntuSystemdProvisioner)
+	commander := &recordingSSHCommander{}
+	p.SSHCommander = commander
+
+	assert.NoError(t, WithK3s(p, k3s.Options{Role: k3s.RoleAgent, ServerURL: "https://10.0.0.1:6443", Token: "secret"}, "agent-1"))
+
+	var uploaded bool
+	for _, command := range commander.commands {
+		if command == "upload /etc/rancher/k3s/cluster-token 0600 root: secret" {
+			uploaded = true
+		} else {
+			assert.NotContains(t, command, "secret")
+		}
+	}
+	assert.True(t, uploaded, strings.Join(commander.commands, "\n"))
+}
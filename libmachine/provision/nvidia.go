@@ -0,0 +1,67 @@
+package provision
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/provision/serviceaction"
+)
+
+const nvidiaToolkitRepo = "https://nvidia.github.io/libnvidia-container"
+
+// nvidiaToolkitCommands returns the commands installing the NVIDIA container
+// toolkit from its repository with the package manager of the distribution.
+func nvidiaToolkitCommands(osRelease *OsRelease) ([]string, error) {
+	ids := append([]string{osRelease.ID}, strings.Fields(osRelease.IDLike)...)
+	for _, id := range ids {
+		switch id {
+		case "debian", "ubuntu":
+			return []string{
+				fmt.Sprintf("curl -fsSL %s/gpgkey | sudo gpg --batch --yes --dearmor -o /usr/share/keyrings/nvidia-container-toolkit-keyring.gpg", nvidiaToolkitRepo),
+				fmt.Sprintf("curl -fsSL %s/stable/deb/nvidia-container-toolkit.list | sed 's#deb https://#deb [signed-by=/usr/share/keyrings/nvidia-container-toolkit-keyring.gpg] https://#g' | sudo tee /etc/apt/sources.list.d/nvidia-container-toolkit.list", nvidiaToolkitRepo),
+				"sudo apt-get update",
+				"sudo DEBIAN_FRONTEND=noninteractive apt-get install -y nvidia-container-toolkit",
+			}, nil
+		case "rhel", "centos", "fedora", "rocky", "ol", "amzn":
+			return []string{
+				fmt.Sprintf("curl -fsSL %s/stable/rpm/nvidia-container-toolkit.repo | sudo tee /etc/yum.repos.d/nvidia-container-toolkit.repo", nvidiaToolkitRepo),
+				"sudo yum install -y nvidia-container-toolkit",
+			}, nil
+		case "suse", "sles", "opensuse":
+			return []string{
+				fmt.Sprintf("sudo zypper --non-interactive ar %s/stable/rpm/nvidia-container-toolkit.repo", nvidiaToolkitRepo),
+				"sudo zypper --non-interactive --gpg-auto-import-keys install -y nvidia-container-toolkit",
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("installing the NVIDIA container toolkit is not supported on %s", osRelease.PrettyName)
+}
+
+// ConfigureNvidiaRuntime installs the NVIDIA container toolkit and makes its
+// runtime the default runtime of the engine, so that containers see the GPUs
+// of the machine. The NVIDIA driver itself comes with the machine image.
+func ConfigureNvidiaRuntime(p Provisioner) error {
+	if _, err := p.SSHCommand("command -v nvidia-smi"); err != nil {
+		log.Warnf("nvidia-smi was not found on the machine, the NVIDIA driver may not be installed")
+	}
+
+	osRelease, err := p.GetOsReleaseInfo()
+	if err != nil {
+		return err
+	}
+	commands, err := nvidiaToolkitCommands(osRelease)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Installing the NVIDIA container toolkit...")
+	commands = append(commands, "sudo nvidia-ctk runtime configure --runtime=docker --set-as-default")
+	for _, command := range commands {
+		if output, err := p.SSHCommand(command); err != nil {
+			return fmt.Errorf("error configuring the NVIDIA runtime: %s: output: %s, error: %s", command, output, err)
+		}
+	}
+
+	return p.Service("docker", serviceaction.Restart)
+}
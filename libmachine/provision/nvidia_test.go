@@ -0,0 +1,31 @@
+package provision
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNvidiaToolkitCommands(t *testing.T) {
+	for _, test := range []struct {
+		osRelease OsRelease
+		command   string
+	}{
+		{OsRelease{ID: "ubuntu", IDLike: "debian"}, "apt-get install -y nvidia-container-toolkit"},
+		{OsRelease{ID: "linuxmint", IDLike: "ubuntu debian"}, "apt-get install -y nvidia-container-toolkit"},
+		{OsRelease{ID: "rocky", IDLike: "rhel centos fedora"}, "yum install -y nvidia-container-toolkit"},
+		{OsRelease{ID: "amzn", IDLike: "centos rhel fedora"}, "yum install -y nvidia-container-toolkit"},
+		{OsRelease{ID: "sles"}, "zypper --non-interactive --gpg-auto-import-keys install -y nvidia-container-toolkit"},
+	} {
+		commands, err := nvidiaToolkitCommands(&test.osRelease)
+		if err != nil {
+			t.Fatalf("%s: %s", test.osRelease.ID, err)
+		}
+		if last := commands[len(commands)-1]; !strings.Contains(last, test.command) {
+			t.Fatalf("%s: expected %q to install with %q", test.osRelease.ID, last, test.command)
+		}
+	}
+
+	if _, err := nvidiaToolkitCommands(&OsRelease{ID: "arch", PrettyName: "Arch Linux"}); err == nil {
+		t.Fatal("expected an error for Arch Linux")
+	}
+}
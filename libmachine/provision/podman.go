@@ -0,0 +1,100 @@
+package provision
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/rancher/machine/libmachine/auth"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/provision/pkgaction"
+	"github.com/rancher/machine/libmachine/provision/serviceaction"
+	"github.com/rancher/machine/libmachine/ssh"
+)
+
+const (
+	podmanSocketPath = "/run/podman/podman.sock"
+	podmanTLSDir     = "/etc/podman-tls"
+	podmanTLSService = "podman-tls"
+)
+
+// WithPodman provisions the machine with Podman instead of the Docker engine.
+// The Docker-compatible API of its socket is served over TLS on the engine
+// port, so that the Docker clients reach it like a Docker engine.
+func WithPodman(provisioner Provisioner, authOptions auth.Options, hostname string) error {
+	if hostname == "" {
+		hostname = provisioner.GetDriver().GetMachineName()
+	}
+
+	if err := provisioner.SetHostname(hostname); err != nil {
+		return err
+	}
+
+	for _, pkg := range append(provisioner.GetPackages(), "podman", "socat") {
+		if err := provisioner.Package(pkg, pkgaction.Install); err != nil {
+			return err
+		}
+	}
+
+	log.Info("Enabling the Podman API socket...")
+	if err := provisioner.Service("podman.socket", serviceaction.Enable); err != nil {
+		return err
+	}
+	if err := provisioner.Service("podman.socket", serviceaction.Restart); err != nil {
+		return err
+	}
+
+	return ConfigurePodmanAuth(provisioner, authOptions)
+}
+
+// ConfigurePodmanAuth generates the server certificate of the machine and
+// serves the Podman API over TLS with it.
+func ConfigurePodmanAuth(provisioner Provisioner, authOptions auth.Options) error {
+	driver := provisioner.GetDriver()
+
+	authOptions.CaCertRemotePath = path.Join(podmanTLSDir, "ca.pem")
+	authOptions.ServerCertRemotePath = path.Join(podmanTLSDir, "server.pem")
+	authOptions.ServerKeyRemotePath = path.Join(podmanTLSDir, "server-key.pem")
+
+	if err := generateServerCert(driver, authOptions, false); err != nil {
+		return err
+	}
+	if err := copyServerCert(provisioner, authOptions); err != nil {
+		return err
+	}
+
+	port, err := enginePort(driver)
+	if err != nil {
+		return err
+	}
+	unit := fmt.Sprintf("/etc/systemd/system/%s.service", podmanTLSService)
+	if err := uploadFile(provisioner, unit, strings.NewReader(podmanTLSUnit(port, authOptions)+"\n"), ssh.FileAttributes{Owner: "root"}); err != nil {
+		return fmt.Errorf("error writing the %s service: %s", podmanTLSService, err)
+	}
+
+	if err := provisioner.Service(podmanTLSService, serviceaction.Enable); err != nil {
+		return err
+	}
+	if err := provisioner.Service(podmanTLSService, serviceaction.Restart); err != nil {
+		return err
+	}
+
+	return WaitForDocker(provisioner, port)
+}
+
+// podmanTLSUnit returns the systemd unit forwarding the TLS connections to
+// the port, of the clients with a certificate of the CA, to the Podman
+// socket.
+func podmanTLSUnit(port int, authOptions auth.Options) string {
+	return fmt.Sprintf(`[Unit]
+Description=TLS endpoint of the Podman API
+Requires=podman.socket
+After=podman.socket
+
+[Service]
+ExecStart=/usr/bin/socat OPENSSL-LISTEN:%d,reuseaddr,fork,cert=%s,key=%s,cafile=%s,verify=1 UNIX-CONNECT:%s
+Restart=always
+
+[Install]
+WantedBy=multi-user.target`, port, authOptions.ServerCertRemotePath, authOptions.ServerKeyRemotePath, authOptions.CaCertRemotePath, podmanSocketPath)
+}
@@ -0,0 +1,20 @@
+package provision
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPodmanTLSUnit(t *testing.T) {
+	unit := podmanTLSUnit(2376, auth.Options{
+		CaCertRemotePath:     "/etc/podman-tls/ca.pem",
+		ServerCertRemotePath: "/etc/podman-tls/server.pem",
+		ServerKeyRemotePath:  "/etc/podman-tls/server-key.pem",
+	})
+
+	assert.Contains(t, unit, "ExecStart=/usr/bin/socat OPENSSL-LISTEN:2376,reuseaddr,fork,cert=/etc/podman-tls/server.pem,key=/etc/podman-tls/server-key.pem,cafile=/etc/podman-tls/ca.pem,verify=1 UNIX-CONNECT:/run/podman/podman.sock\n")
+	assert.True(t, strings.HasPrefix(unit, "[Unit]\n"))
+}
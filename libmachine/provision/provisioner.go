@@ -2,13 +2,16 @@ package provision
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/rancher/machine/libmachine/auth"
 	"github.com/rancher/machine/libmachine/drivers"
 	"github.com/rancher/machine/libmachine/engine"
 	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/progress"
 	"github.com/rancher/machine/libmachine/provision/pkgaction"
 	"github.com/rancher/machine/libmachine/provision/serviceaction"
+	"github.com/rancher/machine/libmachine/ssh"
 	"github.com/rancher/machine/libmachine/swarm"
 )
 
@@ -27,6 +30,13 @@ type SSHCommander interface {
 	SSHCommand(args string) (string, error)
 }
 
+// FileUploader is an SSHCommander able to upload files to the machine.
+type FileUploader interface {
+	// Upload writes content to the file at path on the machine, with the
+	// attributes.
+	Upload(content io.Reader, path string, attrs ssh.FileAttributes) error
+}
+
 type Detector interface {
 	DetectProvisioner(d drivers.Driver) (Provisioner, error)
 }
@@ -104,13 +114,16 @@ func DetectProvisioner(d drivers.Driver) (Provisioner, error) {
 	return detector.DetectProvisioner(d)
 }
 
-func (detector StandardDetector) DetectProvisioner(d drivers.Driver) (Provisioner, error) {
-	log.Info("Waiting for SSH to be available...")
+func (detector StandardDetector) DetectProvisioner(d drivers.Driver) (_ Provisioner, err error) {
+	steps := progress.NewTracker(d.GetMachineName())
+	defer func() { steps.Done(err) }()
+
+	steps.Start(progress.WaitingForSSH, "Waiting for SSH to be available...")
 	if err := drivers.WaitForSSH(d); err != nil {
 		return nil, err
 	}
 
-	log.Info("Detecting the provisioner...")
+	steps.Start(progress.DetectingProvisioner, "Detecting the provisioner...")
 
 	osReleaseOut, err := drivers.RunSSHCommandFromDriver(d, "cat /etc/os-release")
 	if err != nil {
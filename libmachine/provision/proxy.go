@@ -0,0 +1,182 @@
+package provision
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/rancher/machine/libmachine/auth"
+	"github.com/rancher/machine/libmachine/engine"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/ssh"
+	"github.com/rancher/machine/libmachine/swarm"
+)
+
+const (
+	// dockerProxyDropIn is the systemd drop-in setting the proxy of dockerd.
+	dockerProxyDropIn = "/etc/systemd/system/docker.service.d/http-proxy.conf"
+	// sudoersProxyFile keeps the proxy variables in the environment of the
+	// commands run with sudo.
+	sudoersProxyFile = "/etc/sudoers.d/machine-proxy"
+	// proxyEnvFile holds the proxy variables sourced by the commands of the
+	// provisioning, only readable by the SSH user as the proxy URLs may
+	// have credentials.
+	proxyEnvFile = "/etc/machine-proxy.env"
+)
+
+// sshCommanderWrapper is implemented by the provisioners running their
+// commands through an SSHCommander they can wrap.
+type sshCommanderWrapper interface {
+	wrapSSHCommander(wrap func(SSHCommander) SSHCommander)
+}
+
+func (provisioner *GenericProvisioner) wrapSSHCommander(wrap func(SSHCommander) SSHCommander) {
+	provisioner.SSHCommander = wrap(provisioner.SSHCommander)
+}
+
+// proxySSHCommander runs the commands with the proxy variables of the
+// proxyEnvFile set, for the package managers and curl to download through
+// the proxy. The variables are not on the command lines, which are logged.
+type proxySSHCommander struct {
+	SSHCommander
+}
+
+func (c proxySSHCommander) SSHCommand(args string) (string, error) {
+	return c.SSHCommander.SSHCommand(fmt.Sprintf("set -a; . %s; set +a; %s", proxyEnvFile, args))
+}
+
+// Upload uploads the file with the wrapped SSHCommander, which needs no
+// proxy.
+func (c proxySSHCommander) Upload(content io.Reader, path string, attrs ssh.FileAttributes) error {
+	return uploadFile(c.SSHCommander, path, content, attrs)
+}
+
+// CheckProxyOptions checks the proxy settings of the engine options.
+func CheckProxyOptions(engineOptions engine.Options) error {
+	for _, proxy := range []struct{ name, value string }{
+		{"HTTP proxy", engineOptions.HTTPProxy},
+		{"HTTPS proxy", engineOptions.HTTPSProxy},
+	} {
+		if proxy.value == "" {
+			continue
+		}
+		u, err := url.Parse(proxy.value)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+			return fmt.Errorf("invalid %s %q, must be an http, https or socks5 URL", proxy.name, proxy.value)
+		}
+		if strings.ContainsAny(proxy.value, `'"`) {
+			return fmt.Errorf("invalid %s %q, must not contain quotes", proxy.name, proxy.value)
+		}
+	}
+	if strings.ContainsAny(engineOptions.NoProxy, "'\" \t") {
+		return fmt.Errorf("invalid no proxy list %q, must be a comma-separated list of hosts", engineOptions.NoProxy)
+	}
+	return nil
+}
+
+// proxyEnv returns the proxy variables of the engine options, in both the
+// upper case and the lower case some tools only read.
+func proxyEnv(engineOptions engine.Options) []string {
+	var env []string
+	for _, proxy := range []struct{ name, value string }{
+		{"HTTP_PROXY", engineOptions.HTTPProxy},
+		{"HTTPS_PROXY", engineOptions.HTTPSProxy},
+		{"NO_PROXY", engineOptions.NoProxy},
+	} {
+		if proxy.value != "" {
+			env = append(env, proxy.name+"="+proxy.value, strings.ToLower(proxy.name)+"="+proxy.value)
+		}
+	}
+	return env
+}
+
+// redactedProxyEnv returns the proxy variables with the passwords of the
+// proxy URLs redacted, for the logs.
+func redactedProxyEnv(env []string) []string {
+	redacted := make([]string, len(env))
+	for i, variable := range env {
+		name, value, _ := strings.Cut(variable, "=")
+		if u, err := url.Parse(value); err == nil && u.User != nil {
+			value = u.Redacted()
+		}
+		redacted[i] = name + "=" + value
+	}
+	return redacted
+}
+
+// proxyEnvScript renders the proxyEnvFile setting the proxy variables.
+func proxyEnvScript(env []string) string {
+	var script strings.Builder
+	for _, variable := range env {
+		name, value, _ := strings.Cut(variable, "=")
+		fmt.Fprintf(&script, "%s=%s\n", name, shellQuote(value))
+	}
+	return script.String()
+}
+
+// proxyDropIn renders the systemd drop-in setting the proxy variables of
+// dockerd. The % of the values, a specifier for systemd, are escaped.
+func proxyDropIn(env []string) string {
+	quoted := make([]string, len(env))
+	for i, variable := range env {
+		quoted[i] = fmt.Sprintf("%q", strings.ReplaceAll(variable, "%", "%%"))
+	}
+	return fmt.Sprintf("[Service]\nEnvironment=%s\n", strings.Join(quoted, " "))
+}
+
+// ProvisionWithProxy provisions the machine with p, downloading through the
+// proxy of the engine options, if they have one, see ConfigureProxy.
+func ProvisionWithProxy(p Provisioner, swarmOptions swarm.Options, authOptions auth.Options, engineOptions engine.Options) error {
+	if err := ConfigureProxy(p, engineOptions); err != nil {
+		return err
+	}
+	return p.Provision(swarmOptions, authOptions, engineOptions)
+}
+
+// ConfigureProxy makes the provisioning of the machine download through the
+// proxy of the engine options, if they have one, and sets the proxy of the
+// engine with a systemd drop-in, before the engine is installed.
+func ConfigureProxy(p Provisioner, engineOptions engine.Options) error {
+	env := proxyEnv(engineOptions)
+	if len(env) == 0 {
+		return nil
+	}
+
+	log.Debugf("Configuring the proxy of the machine: %s", strings.Join(redactedProxyEnv(env), " "))
+
+	names := make([]string, len(env))
+	for i, variable := range env {
+		names[i], _, _ = strings.Cut(variable, "=")
+	}
+	sudoers := fmt.Sprintf("Defaults env_keep += \"%s\"\n", strings.Join(names, " "))
+	if err := uploadFile(p, sudoersProxyFile, strings.NewReader(sudoers), ssh.FileAttributes{Mode: 0440, Owner: "root"}); err != nil {
+		return fmt.Errorf("Error keeping the proxy variables for sudo: %s", err)
+	}
+
+	if w, ok := p.(sshCommanderWrapper); ok {
+		attrs := ssh.FileAttributes{Mode: 0600, Owner: p.GetDriver().GetSSHUsername()}
+		if err := uploadFile(p, proxyEnvFile, strings.NewReader(proxyEnvScript(env)), attrs); err != nil {
+			return fmt.Errorf("Error setting the proxy of the provisioning: %s", err)
+		}
+		w.wrapSSHCommander(func(c SSHCommander) SSHCommander {
+			if _, ok := c.(proxySSHCommander); ok {
+				return c
+			}
+			return proxySSHCommander{SSHCommander: c}
+		})
+	}
+
+	if _, err := p.SSHCommand("systemctl --version"); err != nil {
+		log.Warnf("The engine of the machine is not run by systemd, set its proxy with --engine-env")
+		return nil
+	}
+
+	if err := uploadFile(p, dockerProxyDropIn, strings.NewReader(proxyDropIn(env)), ssh.FileAttributes{Mode: 0600, Owner: "root"}); err != nil {
+		return fmt.Errorf("Error setting the proxy of the engine: %s", err)
+	}
+	if _, err := p.SSHCommand("sudo systemctl daemon-reload"); err != nil {
+		return fmt.Errorf("Error setting the proxy of the engine: %s", err)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package provision
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/rancher/machine/libmachine/drivers"
 	"github.com/rancher/machine/libmachine/log"
@@ -40,3 +41,23 @@ func (sshCmder RedHatSSHCommander) SSHCommand(args string) (string, error) {
 
 	return output, nil
 }
+
+func (sshCmder RedHatSSHCommander) Upload(content io.Reader, path string, attrs ssh.FileAttributes) error {
+	client, err := drivers.GetSSHClientFromDriver(sshCmder.Driver)
+	if err != nil {
+		return err
+	}
+
+	// Like the commands, the sudo installing the file needs a tty with the
+	// external client, which scp does without.
+	if c, ok := client.(*ssh.ExternalClient); ok {
+		c.BaseArgs = append(c.BaseArgs, "-tt")
+	}
+
+	log.Debugf("About to upload %s (%#o, owner %q)", path, attrs.Mode, attrs.Owner)
+
+	if err := client.Upload(content, path, attrs); err != nil {
+		return fmt.Errorf("RHEL ssh upload error: %s", err)
+	}
+	return nil
+}
@@ -12,12 +12,12 @@ func init() {
 
 func NewRockyProvisioner(d drivers.Driver) Provisioner {
 	return &RockyProvisioner{
-		NewRedHatProvisioner("rocky", d),
+		NewEnterpriseLinuxProvisioner("rocky", d),
 	}
 }
 
 type RockyProvisioner struct {
-	*RedHatProvisioner
+	*EnterpriseLinuxProvisioner
 }
 
 func (provisioner *RockyProvisioner) String() string {
@@ -0,0 +1,120 @@
+package provision
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rancher/machine/libmachine/engine"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/provision/pkgaction"
+)
+
+// SELinux modes the Red Hat family provisioners put the machines in.
+const (
+	// SELinuxEnforcing keeps SELinux enforcing, with the policy of
+	// container-selinux and the SELinux support of the engine.
+	SELinuxEnforcing = "enforcing"
+	// SELinuxPermissive makes SELinux permissive, until it is enforced
+	// again.
+	SELinuxPermissive = "permissive"
+)
+
+// CheckSELinuxOptions checks the SELinux mode and the booleans, in the form
+// name=on or name=off, of the engine options.
+func CheckSELinuxOptions(mode string, booleans []string) error {
+	switch mode {
+	case "", SELinuxEnforcing, SELinuxPermissive:
+	default:
+		return fmt.Errorf("invalid SELinux mode %q, must be %s or %s", mode, SELinuxEnforcing, SELinuxPermissive)
+	}
+
+	for _, boolean := range booleans {
+		name, value, ok := strings.Cut(boolean, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("invalid SELinux boolean %q, must be name=on or name=off", boolean)
+		}
+		switch value {
+		case "on", "off", "1", "0", "true", "false":
+		default:
+			return fmt.Errorf("invalid SELinux boolean %q, must be name=on or name=off", boolean)
+		}
+	}
+	return nil
+}
+
+// configureSELinux puts the machine in the SELinux mode of the engine
+// options and sets their booleans, before the engine is installed. The
+// engine labels the containers for SELinux when it is enforced.
+func configureSELinux(p Provisioner, engineOptions *engine.Options) error {
+	switch engineOptions.SELinux {
+	case SELinuxEnforcing:
+		output, err := p.SSHCommand("getenforce")
+		if err != nil {
+			return fmt.Errorf("Error getting the SELinux mode of the machine: %s", err)
+		}
+		switch strings.TrimSpace(output) {
+		case "Disabled":
+			return fmt.Errorf("SELinux is disabled on the machine, it cannot be enforced without relabeling the file systems and rebooting")
+		case "Permissive":
+			log.Info("Enforcing SELinux...")
+			if _, err := p.SSHCommand("sudo setenforce 1 && sudo sed -i 's/^SELINUX=.*/SELINUX=enforcing/' /etc/selinux/config"); err != nil {
+				return fmt.Errorf("Error enforcing SELinux: %s", err)
+			}
+		}
+
+		if err := p.Package("container-selinux", pkgaction.Install); err != nil {
+			return err
+		}
+		engineOptions.SelinuxEnabled = true
+	case SELinuxPermissive:
+		log.Info("Making SELinux permissive...")
+		if _, err := p.SSHCommand("if selinuxenabled; then sudo setenforce 0; fi && sudo sed -i 's/^SELINUX=enforcing/SELINUX=permissive/' /etc/selinux/config"); err != nil {
+			return fmt.Errorf("Error making SELinux permissive: %s", err)
+		}
+		engineOptions.SelinuxEnabled = false
+	}
+
+	for _, boolean := range engineOptions.SELinuxBooleans {
+		log.Debugf("Setting the SELinux boolean %s", boolean)
+		if _, err := p.SSHCommand("sudo setsebool -P " + shellQuote(boolean)); err != nil {
+			return fmt.Errorf("Error setting the SELinux boolean %s: %s", boolean, err)
+		}
+	}
+	return nil
+}
+
+// selinuxEnabled tells whether the engine labels the containers for SELinux,
+// which it does when SELinux is enforced, as asked by the engine options or
+// as found on the machine.
+func selinuxEnabled(p SSHCommander, engineOptions engine.Options) bool {
+	switch engineOptions.SELinux {
+	case SELinuxEnforcing:
+		return true
+	case SELinuxPermissive:
+		return false
+	}
+	output, err := p.SSHCommand("getenforce")
+	return err == nil && strings.TrimSpace(output) == "Enforcing"
+}
+
+// verifySELinuxLabels restores the SELinux labels of the certificates in dir
+// and checks that they all have the label of the policy, which the engine
+// needs to read them while SELinux is enforced.
+func verifySELinuxLabels(p SSHCommander, dir string) error {
+	output, err := p.SSHCommand(fmt.Sprintf("sudo restorecon -RFv %s", dir))
+	if err != nil {
+		return fmt.Errorf("Error restoring the SELinux labels of %s: %s", dir, err)
+	}
+	if relabeled := strings.TrimSpace(output); relabeled != "" {
+		log.Debugf("Relabeled the certificates: %s", relabeled)
+	}
+
+	output, err = p.SSHCommand(fmt.Sprintf("sudo restorecon -RFnv %s", dir))
+	if err != nil {
+		return fmt.Errorf("Error verifying the SELinux labels of %s: %s", dir, err)
+	}
+	if mislabeled := strings.TrimSpace(output); mislabeled != "" {
+		return fmt.Errorf("the SELinux labels of %s do not match the policy: %s", dir, mislabeled)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package provision
+
+import (
+	"testing"
+
+	"github.com/rancher/machine/libmachine/engine"
+	"github.com/rancher/machine/libmachine/provision/provisiontest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckSELinuxOptions(t *testing.T) {
+	assert.NoError(t, CheckSELinuxOptions("", nil))
+	assert.NoError(t, CheckSELinuxOptions(SELinuxEnforcing, []string{"container_manage_cgroup=on", "virt_use_nfs=0"}))
+
+	assert.EqualError(t, CheckSELinuxOptions("disabled", nil), `invalid SELinux mode "disabled", must be enforcing or permissive`)
+	assert.EqualError(t, CheckSELinuxOptions("", []string{"container_manage_cgroup"}), `invalid SELinux boolean "container_manage_cgroup", must be name=on or name=off`)
+}
+
+func TestConfigureSELinuxEnforcing(t *testing.T) {
+	p := NewRedHatProvisioner("rhel", nil)
+	commander := &provisiontest.FakeSSHCommander{Responses: map[string]string{
+		"getenforce": "Permissive\n",
+		"sudo setenforce 1 && sudo sed -i 's/^SELINUX=.*/SELINUX=enforcing/' /etc/selinux/config": "",
+		"sudo -E yum install -y container-selinux":                                                "",
+		"sudo setsebool -P 'container_manage_cgroup=on'":                                          "",
+	}}
+	p.SSHCommander = commander
+	engineOptions := &engine.Options{SELinux: SELinuxEnforcing, SELinuxBooleans: []string{"container_manage_cgroup=on"}}
+
+	assert.NoError(t, configureSELinux(p, engineOptions))
+	assert.True(t, engineOptions.SelinuxEnabled)
+
+	commander.Responses["getenforce"] = "Disabled\n"
+	assert.Error(t, configureSELinux(p, engineOptions))
+}
+
+func TestSELinuxEnabled(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{Responses: map[string]string{"getenforce": "Enforcing\n"}}
+
+	assert.True(t, selinuxEnabled(commander, engine.Options{}))
+	assert.False(t, selinuxEnabled(commander, engine.Options{SELinux: SELinuxPermissive}))
+
+	commander.Responses["getenforce"] = "Permissive\n"
+	assert.False(t, selinuxEnabled(commander, engine.Options{}))
+	assert.True(t, selinuxEnabled(commander, engine.Options{SELinux: SELinuxEnforcing}))
+
+	// Machines without SELinux have no getenforce.
+	assert.False(t, selinuxEnabled(&provisiontest.FakeSSHCommander{}, engine.Options{}))
+}
+
+func TestVerifySELinuxLabels(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{Responses: map[string]string{
+		"sudo restorecon -RFv /etc/docker":  "",
+		"sudo restorecon -RFnv /etc/docker": "",
+	}}
+	assert.NoError(t, verifySELinuxLabels(commander, "/etc/docker"))
+
+	commander.Responses["sudo restorecon -RFnv /etc/docker"] = "Would relabel /etc/docker/server.pem from unconfined_u:object_r:user_home_t:s0 to system_u:object_r:container_config_t:s0\n"
+	assert.EqualError(t, verifySELinuxLabels(commander, "/etc/docker"), "the SELinux labels of /etc/docker do not match the policy: Would relabel /etc/docker/server.pem from unconfined_u:object_r:user_home_t:s0 to system_u:object_r:container_config_t:s0")
+}
@@ -0,0 +1,48 @@
+package provision
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/log"
+)
+
+// authorizeKeyCommand adds the public key it reads to the authorized keys of
+// the SSH user, unless it is there already.
+const authorizeKeyCommand = `umask 077 && mkdir -p ~/.ssh && touch ~/.ssh/authorized_keys && ` +
+	`key="$(cat)" && { grep -qxF "$key" ~/.ssh/authorized_keys || echo "$key" >> ~/.ssh/authorized_keys; }`
+
+// InstallSSHKey installs the SSH key of a machine reached with a password in
+// its authorized keys, then switches its SSH connections to the key. It does
+// nothing for the machines authenticating with their key already.
+func InstallSSHKey(d drivers.Driver) error {
+	password, err := drivers.GetSSHPassword(d)
+	if err != nil {
+		return err
+	}
+	if !password.IsSet() {
+		return nil
+	}
+
+	publicKey, err := os.ReadFile(d.GetSSHKeyPath() + ".pub")
+	if err != nil {
+		return fmt.Errorf("error reading the SSH public key: %s", err)
+	}
+
+	if err := drivers.WaitForSSH(d); err != nil {
+		return err
+	}
+
+	log.Info("Installing the SSH key...")
+	if _, err := drivers.RunSSHCommandWithInputFromDriver(d, authorizeKeyCommand, bytes.NewReader(bytes.TrimSpace(publicKey))); err != nil {
+		return fmt.Errorf("error installing the SSH key: %s", err)
+	}
+
+	drivers.SSHKeyInstalled(d.GetMachineName())
+	if _, err := drivers.RunSSHCommandFromDriver(d, "exit 0"); err != nil {
+		return fmt.Errorf("error connecting with the installed SSH key: %s", err)
+	}
+	return nil
+}
@@ -49,6 +49,9 @@ type SUSEProvisioner struct {
 }
 
 func (provisioner *SUSEProvisioner) CompatibleWithHost() bool {
+	if isTransactionalSUSE(provisioner.OsReleaseInfo.ID) {
+		return false
+	}
 	return strings.ToLower(provisioner.OsReleaseInfo.ID) == strings.ToLower(provisioner.OsReleaseID) || strings.Contains(provisioner.OsReleaseInfo.IDLike, "opensuse")
 }
 
@@ -110,39 +113,19 @@ func (provisioner *SUSEProvisioner) Provision(swarmOptions swarm.Options, authOp
 	provisioner.EngineOptions = engineOptions
 	swarmOptions.Env = engineOptions.Env
 
-	// figure out the filesystem used by /var/lib/docker
-	fs, err := provisioner.SSHCommand("stat -f -c %T /var/lib/docker")
-	if err != nil {
-		// figure out the filesystem used by /var/lib
-		fs, err = provisioner.SSHCommand("stat -f -c %T /var/lib/")
-		if err != nil {
-			return err
-		}
-	}
-	graphDriver := DefaultStorageDriver
-	if strings.Contains(fs, "btrfs") {
-		graphDriver = "btrfs"
-	}
-
-	storageDriver, err := decideStorageDriver(provisioner, graphDriver, engineOptions.StorageDriver)
-	if err != nil {
+	if err := provisioner.setStorageDriver(); err != nil {
 		return err
 	}
-	provisioner.EngineOptions.StorageDriver = storageDriver
 
-	log.Debug("Setting hostname")
-	if err := provisioner.SetHostname(provisioner.Driver.GetMachineName()); err != nil {
-		return err
-	}
-
-	log.Debug("Installing base packages")
-	for _, pkg := range provisioner.Packages {
-		if err := provisioner.Package(pkg, pkgaction.Install); err != nil {
-			return err
+	log.Debug("Setting hostname, installing packages and generating certs")
+	if err := installConcurrently(provisioner, func() error {
+		for _, pkg := range provisioner.Packages {
+			if err := provisioner.Package(pkg, pkgaction.Install); err != nil {
+				return err
+			}
 		}
-	}
-
-	if err := installDockerGeneric(provisioner, provisioner.EngineOptions.InstallURL); err != nil {
+		return installDockerEngine(provisioner, &provisioner.EngineOptions)
+	}); err != nil {
 		return err
 	}
 
@@ -167,7 +150,7 @@ func (provisioner *SUSEProvisioner) Provision(swarmOptions swarm.Options, authOp
 	provisioner.AuthOptions = setRemoteAuthOptions(provisioner)
 
 	log.Debug("Configuring auth")
-	if err := ConfigureAuth(provisioner); err != nil {
+	if err := configureAuth(provisioner, false); err != nil {
 		return err
 	}
 
@@ -178,8 +161,32 @@ func (provisioner *SUSEProvisioner) Provision(swarmOptions swarm.Options, authOp
 
 	// enable in systemd
 	log.Debug("Enabling docker in systemd")
-	err = provisioner.Service("docker", serviceaction.Enable)
-	return err
+	return provisioner.Service("docker", serviceaction.Enable)
+}
+
+// setStorageDriver sets the storage driver of the engine, btrfs when
+// /var/lib/docker is on btrfs unless another one is given.
+func (provisioner *SUSEProvisioner) setStorageDriver() error {
+	// figure out the filesystem used by /var/lib/docker
+	fs, err := provisioner.SSHCommand("stat -f -c %T /var/lib/docker")
+	if err != nil {
+		// figure out the filesystem used by /var/lib
+		fs, err = provisioner.SSHCommand("stat -f -c %T /var/lib/")
+		if err != nil {
+			return err
+		}
+	}
+	graphDriver := DefaultStorageDriver
+	if strings.Contains(fs, "btrfs") {
+		graphDriver = "btrfs"
+	}
+
+	storageDriver, err := decideStorageDriver(provisioner, graphDriver, provisioner.EngineOptions.StorageDriver)
+	if err != nil {
+		return err
+	}
+	provisioner.EngineOptions.StorageDriver = storageDriver
+	return nil
 }
 
 func (provisioner *SUSEProvisioner) configureFirewall() error {
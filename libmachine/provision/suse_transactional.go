@@ -0,0 +1,188 @@
+package provision
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rancher/machine/libmachine/auth"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/engine"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/mcnutils"
+	"github.com/rancher/machine/libmachine/provision/pkgaction"
+	"github.com/rancher/machine/libmachine/provision/serviceaction"
+	"github.com/rancher/machine/libmachine/swarm"
+)
+
+// transactionalSUSEIDs are the IDs of the immutable SUSE variants, whose root
+// file system is only changed by transactional-update.
+var transactionalSUSEIDs = []string{"opensuse-microos", "sle-micro", "sl-micro"}
+
+func init() {
+	Register("openSUSE MicroOS", &RegisteredProvisioner{
+		New: NewMicroOSProvisioner,
+	})
+	Register("SLE Micro", &RegisteredProvisioner{
+		New: NewSLEMicroProvisioner,
+	})
+}
+
+func NewMicroOSProvisioner(d drivers.Driver) Provisioner {
+	return &TransactionalSUSEProvisioner{
+		SUSEProvisioner{NewSystemdProvisioner("opensuse-microos", d)},
+	}
+}
+
+func NewSLEMicroProvisioner(d drivers.Driver) Provisioner {
+	return &TransactionalSUSEProvisioner{
+		SUSEProvisioner{NewSystemdProvisioner("sle-micro", d)},
+	}
+}
+
+func isTransactionalSUSE(id string) bool {
+	for _, transactionalID := range transactionalSUSEIDs {
+		if strings.EqualFold(id, transactionalID) {
+			return true
+		}
+	}
+	return false
+}
+
+// TransactionalSUSEProvisioner provisions the immutable SUSE variants. Their
+// packages are changed in a new snapshot of the root file system, which the
+// machine is rebooted into.
+type TransactionalSUSEProvisioner struct {
+	SUSEProvisioner
+}
+
+func (provisioner *TransactionalSUSEProvisioner) CompatibleWithHost() bool {
+	return isTransactionalSUSE(provisioner.OsReleaseInfo.ID)
+}
+
+func (provisioner *TransactionalSUSEProvisioner) String() string {
+	return "transactional-suse"
+}
+
+func (provisioner *TransactionalSUSEProvisioner) Package(name string, action pkgaction.PackageAction) error {
+	if action == pkgaction.Install {
+		return provisioner.installPackages(name)
+	}
+
+	var packageAction string
+	switch action {
+	case pkgaction.Remove, pkgaction.Purge:
+		packageAction = "remove"
+	case pkgaction.Upgrade:
+		packageAction = "update"
+	}
+	return provisioner.transactionalUpdate(packageAction, name)
+}
+
+// installPackages installs the packages that are not installed yet in one
+// snapshot.
+func (provisioner *TransactionalSUSEProvisioner) installPackages(names ...string) error {
+	var missing []string
+	for _, name := range names {
+		if _, err := provisioner.SSHCommand(fmt.Sprintf("rpm -q %s", name)); err == nil {
+			log.Debugf("%s is already installed, skipping operation", name)
+			continue
+		}
+		missing = append(missing, name)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return provisioner.transactionalUpdate("install", missing...)
+}
+
+// transactionalUpdate runs the zypper action on the packages in a new
+// snapshot and reboots the machine into it.
+func (provisioner *TransactionalSUSEProvisioner) transactionalUpdate(action string, names ...string) error {
+	bootID, err := provisioner.SSHCommand("cat /proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("transactional-update: action=%s names=%s", action, names)
+	if output, err := provisioner.SSHCommand(transactionalUpdateCommand(action, names)); err != nil {
+		return fmt.Errorf("error running transactional-update: output: %s, error: %s", output, err)
+	}
+
+	log.Info("Rebooting the machine into the new snapshot...")
+	// ignore errors here because the SSH connection will close
+	if _, err := provisioner.SSHCommand("sudo systemctl reboot"); err != nil {
+		log.Debugf("Reboot command ended with: %s", err)
+	}
+
+	return provisioner.waitForReboot(strings.TrimSpace(bootID))
+}
+
+// waitForReboot waits for the machine to be reachable again with another boot
+// ID than bootID.
+func (provisioner *TransactionalSUSEProvisioner) waitForReboot(bootID string) error {
+	if err := drivers.WaitForSSH(provisioner.Driver); err != nil {
+		return err
+	}
+	return mcnutils.WaitForSpecific(func() bool {
+		current, err := provisioner.SSHCommand("cat /proc/sys/kernel/random/boot_id")
+		return err == nil && strings.TrimSpace(current) != bootID
+	}, 60, 5*time.Second)
+}
+
+func transactionalUpdateCommand(action string, names []string) string {
+	return fmt.Sprintf("sudo transactional-update --non-interactive pkg %s %s", action, strings.Join(names, " "))
+}
+
+func (provisioner *TransactionalSUSEProvisioner) Provision(swarmOptions swarm.Options, authOptions auth.Options, engineOptions engine.Options) error {
+	provisioner.SwarmOptions = swarmOptions
+	provisioner.AuthOptions = authOptions
+	provisioner.EngineOptions = engineOptions
+	swarmOptions.Env = engineOptions.Env
+
+	if err := provisioner.setStorageDriver(); err != nil {
+		return err
+	}
+
+	log.Debug("Setting hostname")
+	if err := provisioner.SetHostname(provisioner.Driver.GetMachineName()); err != nil {
+		return err
+	}
+
+	// The Docker install script cannot change the root file system, Docker
+	// comes from the repositories of the distribution with the base packages.
+	log.Info("Installing Docker with transactional-update...")
+	if err := provisioner.installPackages(append(provisioner.Packages, "docker")...); err != nil {
+		return err
+	}
+
+	if _, installed := provisioner.SSHCommand("rpm -q firewalld"); installed == nil {
+		log.Debug("Configuring SUSE firewall")
+		if err := provisioner.configureFirewall(); err != nil {
+			return err
+		}
+	}
+
+	log.Debug("Starting systemd docker service")
+	if err := provisioner.Service("docker", serviceaction.Enable); err != nil {
+		return err
+	}
+	if err := provisioner.Service("docker", serviceaction.Start); err != nil {
+		return err
+	}
+
+	log.Debug("Waiting for docker daemon")
+	if err := mcnutils.WaitFor(provisioner.dockerDaemonResponding); err != nil {
+		return err
+	}
+
+	provisioner.AuthOptions = setRemoteAuthOptions(provisioner)
+
+	log.Debug("Configuring auth")
+	if err := ConfigureAuth(provisioner); err != nil {
+		return err
+	}
+
+	log.Debug("Configuring swarm")
+	return configureSwarm(provisioner, swarmOptions, provisioner.AuthOptions)
+}
@@ -0,0 +1,36 @@
+package provision
+
+import (
+	"testing"
+
+	"github.com/rancher/machine/drivers/fakedriver"
+)
+
+func TestTransactionalSUSECompatibleWithHost(t *testing.T) {
+	microOS := &OsRelease{ID: "opensuse-microos", IDLike: "suse opensuse opensuse-tumbleweed microos"}
+
+	p := NewMicroOSProvisioner(&fakedriver.Driver{})
+	p.SetOsReleaseInfo(microOS)
+	if !p.CompatibleWithHost() {
+		t.Fatal("expected the MicroOS provisioner to be compatible with openSUSE MicroOS")
+	}
+
+	p = NewOpenSUSEProvisioner(&fakedriver.Driver{})
+	p.SetOsReleaseInfo(microOS)
+	if p.CompatibleWithHost() {
+		t.Fatal("expected the openSUSE provisioner not to be compatible with openSUSE MicroOS")
+	}
+
+	p = NewSLEMicroProvisioner(&fakedriver.Driver{})
+	p.SetOsReleaseInfo(&OsRelease{ID: "sl-micro", IDLike: "suse"})
+	if !p.CompatibleWithHost() {
+		t.Fatal("expected the SLE Micro provisioner to be compatible with SL Micro")
+	}
+}
+
+func TestTransactionalUpdateCommand(t *testing.T) {
+	expected := "sudo transactional-update --non-interactive pkg install curl docker"
+	if command := transactionalUpdateCommand("install", []string{"curl", "docker"}); command != expected {
+		t.Fatalf("expected %q, got %q", expected, command)
+	}
+}
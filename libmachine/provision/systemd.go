@@ -46,8 +46,14 @@ func (p *SystemdProvisioner) GenerateDockerOptions(dockerPort int) (*DockerOptio
 		return nil, err
 	}
 
+	v, err := versioncmp.Parse(dockerVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1.12.0 release candidates already ship dockerd.
 	arg := "dockerd"
-	if versioncmp.LessThan(dockerVersion, "1.12.0") {
+	if v.Release().Compare(versioncmp.MustParse("1.12.0")) < 0 {
 		arg = "docker daemon"
 	}
 
@@ -2,6 +2,7 @@ package provision
 
 import (
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"path"
@@ -13,10 +14,13 @@ import (
 
 	"github.com/rancher/machine/libmachine/auth"
 	"github.com/rancher/machine/libmachine/cert"
+	"github.com/rancher/machine/libmachine/drivers"
 	"github.com/rancher/machine/libmachine/engine"
 	"github.com/rancher/machine/libmachine/log"
 	"github.com/rancher/machine/libmachine/mcnutils"
+	"github.com/rancher/machine/libmachine/progress"
 	"github.com/rancher/machine/libmachine/provision/serviceaction"
+	"github.com/rancher/machine/libmachine/ssh"
 )
 
 type DockerOptions struct {
@@ -24,14 +28,58 @@ type DockerOptions struct {
 	EngineOptionsPath string
 }
 
-func installDockerGeneric(p Provisioner, baseURL string) error {
+// dockerArchitectures maps the hardware names uname reports to the
+// architectures Docker publishes packages for.
+var dockerArchitectures = map[string]string{
+	"x86_64":  "amd64",
+	"amd64":   "amd64",
+	"aarch64": "arm64",
+	"arm64":   "arm64",
+	"armv7l":  "armhf",
+	"s390x":   "s390x",
+	"ppc64le": "ppc64le",
+}
+
+// machineArchitecture returns the architecture of the machine, named the way
+// Docker packages and Boot2Docker ISOs are. The architectures Docker is not
+// known to publish packages for are returned as uname names them, with a
+// warning.
+func machineArchitecture(p SSHCommander) (string, error) {
+	output, err := p.SSHCommand("uname -m")
+	if err != nil {
+		return "", fmt.Errorf("Error detecting the machine architecture: %s", err)
+	}
+
+	machine := strings.TrimSpace(output)
+	arch, ok := dockerArchitectures[machine]
+	if !ok {
+		log.Warnf("Docker may have no packages for the %s architecture of the machine", machine)
+		return machine, nil
+	}
+	return arch, nil
+}
+
+func installDockerGeneric(p Provisioner, baseURL string) (err error) {
 	if strings.EqualFold(baseURL, "none") {
 		log.Info("Skipping Docker installation")
 		return nil
 	}
+
+	steps := progress.NewTracker(p.GetDriver().GetMachineName())
+	defer func() { steps.Done(err) }()
+
 	// install docker - until cloudinit we use ubuntu everywhere so we
 	// just install it using the docker repos
-	log.Infof("Installing Docker from: %s", baseURL)
+	steps.Start(progress.InstallingDocker, fmt.Sprintf("Installing Docker from: %s", baseURL))
+
+	// The install script picks the packages of the architecture, warn early
+	// about the ones it may have none for.
+	arch, err := machineArchitecture(p)
+	if err != nil {
+		return err
+	}
+	log.Debugf("Installing the %s packages of Docker", arch)
+
 	if output, err := p.SSHCommand(fmt.Sprintf("if ! type docker; then curl -sSL %s | sh -; fi", baseURL)); err != nil {
 		return fmt.Errorf("Error installing Docker: %s", output)
 	}
@@ -49,8 +97,13 @@ func makeDockerOptionsDir(p Provisioner) error {
 }
 
 func setRemoteAuthOptions(p Provisioner) auth.Options {
+	return remoteAuthOptions(p, p.GetAuthOptions())
+}
+
+// remoteAuthOptions returns authOptions with the remote paths of the
+// certificates in the docker options directory of the provisioner.
+func remoteAuthOptions(p Provisioner, authOptions auth.Options) auth.Options {
 	dockerDir := p.GetDockerOptionsDir()
-	authOptions := p.GetAuthOptions()
 
 	// due to windows clients, we cannot use filepath.Join as the paths
 	// will be mucked on the linux hosts
@@ -61,16 +114,150 @@ func setRemoteAuthOptions(p Provisioner) auth.Options {
 	return authOptions
 }
 
+// otherAddresses returns the addresses of the machine on its networks other
+// than ip, for the engine to be reachable on each, like from the private
+// network of the machine.
+func otherAddresses(driver drivers.Driver, ip string) []string {
+	addrs, err := drivers.GetIPs(driver)
+	if err != nil {
+		if err != drivers.ErrAddressKindsNotReported {
+			log.Debugf("Error getting the addresses of the machine: %s", err)
+		}
+		return nil
+	}
+
+	var others []string
+	for _, addr := range addrs {
+		if addr.Address != ip {
+			others = append(others, addr.Address)
+		}
+	}
+	return others
+}
+
 func ConfigureAuth(p Provisioner) error {
-	var (
-		err error
-	)
+	return configureAuth(p, true)
+}
 
+// configureAuth configures the engine to use the certificates of the machine,
+// generating its server certificate first unless generateCert is false
+// because installConcurrently already did.
+func configureAuth(p Provisioner, generateCert bool) (err error) {
 	driver := p.GetDriver()
 	machineName := driver.GetMachineName()
+
+	steps := progress.NewTracker(machineName)
+	defer func() { steps.Done(err) }()
+
 	authOptions := p.GetAuthOptions()
 	swarmOptions := p.GetSwarmOptions()
-	org := mcnutils.GetUsername() + "." + machineName
+
+	if generateCert {
+		steps.Start(progress.GeneratingCerts, "Copying certs to the local machine directory...")
+
+		if err := generateServerCert(driver, authOptions, swarmOptions.Master); err != nil {
+			return err
+		}
+	}
+
+	if err := p.Service("docker", serviceaction.Stop); err != nil {
+		return err
+	}
+
+	if _, err := p.SSHCommand(`if [ ! -z "$(ip link show docker0)" ]; then sudo ip link delete docker0; fi`); err != nil {
+		return err
+	}
+
+	steps.Start(progress.CopyingCerts, "Copying certs to the remote machine...")
+
+	if err := copyServerCert(p, authOptions); err != nil {
+		return err
+	}
+
+	dockerPort, err := enginePort(driver)
+	if err != nil {
+		return err
+	}
+
+	dkrcfg, err := p.GenerateDockerOptions(dockerPort)
+	if err != nil {
+		return err
+	}
+
+	steps.Start(progress.ConfiguringEngine, "Setting Docker configuration on the remote daemon...")
+
+	if err := writeDockerOptions(p, dkrcfg); err != nil {
+		return err
+	}
+
+	if err := p.Service("docker", serviceaction.Restart); err != nil {
+		return err
+	}
+
+	return WaitForDocker(p, dockerPort)
+}
+
+// RotateServerCert generates a new server certificate for the engine of the
+// machine and installs it with the CA of authOptions, restarting the engine
+// once. Unlike ConfigureAuth, the engine keeps running while the certificates
+// are copied and its configuration is left alone.
+func RotateServerCert(p Provisioner, authOptions auth.Options, swarmMaster bool) (err error) {
+	driver := p.GetDriver()
+
+	steps := progress.NewTracker(driver.GetMachineName())
+	defer func() { steps.Done(err) }()
+
+	steps.Start(progress.GeneratingCerts, "Copying certs to the local machine directory...")
+
+	if err := generateServerCert(driver, authOptions, swarmMaster); err != nil {
+		return err
+	}
+
+	steps.Start(progress.CopyingCerts, "Copying certs to the remote machine...")
+
+	if err := copyServerCert(p, remoteAuthOptions(p, authOptions)); err != nil {
+		return err
+	}
+
+	dockerPort, err := enginePort(driver)
+	if err != nil {
+		return err
+	}
+
+	steps.Start(progress.ConfiguringEngine, "Restarting Docker with the new certs...")
+
+	if err := p.Service("docker", serviceaction.Restart); err != nil {
+		return err
+	}
+
+	return WaitForDocker(p, dockerPort)
+}
+
+// uploadFile writes content to the file at path on the machine, with the
+// attributes, with the FileUploader of p.
+func uploadFile(p SSHCommander, path string, content io.Reader, attrs ssh.FileAttributes) error {
+	uploader, ok := p.(FileUploader)
+	if !ok {
+		return fmt.Errorf("the provisioner cannot upload %s to the machine", path)
+	}
+	return uploader.Upload(content, path, attrs)
+}
+
+// shellQuote quotes s as a single word of the shell running the commands
+// on the machine.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// writeDockerOptions writes the configuration of the daemon to the machine.
+func writeDockerOptions(p SSHCommander, dkrcfg *DockerOptions) error {
+	return uploadFile(p, dkrcfg.EngineOptionsPath, strings.NewReader(dkrcfg.EngineOptions), ssh.FileAttributes{Owner: "root"})
+}
+
+// generateServerCert copies the CA and client certificates to the machine
+// directory and generates the server certificate of the machine.
+func generateServerCert(driver drivers.Driver, authOptions auth.Options, swarmMaster bool) error {
+	org := mcnutils.GetUsername() + "." + driver.GetMachineName()
 	bits := 2048
 
 	ip, err := driver.GetIP()
@@ -78,8 +265,6 @@ func ConfigureAuth(p Provisioner) error {
 		return err
 	}
 
-	log.Info("Copying certs to the local machine directory...")
-
 	if err := mcnutils.CopyFile(authOptions.CaCertPath, filepath.Join(authOptions.StorePath, "ca.pem")); err != nil {
 		return fmt.Errorf("Copying ca.pem to machine dir failed: %s", err)
 	}
@@ -92,8 +277,16 @@ func ConfigureAuth(p Provisioner) error {
 		return fmt.Errorf("Copying key.pem to machine dir failed: %s", err)
 	}
 
-	// The Host IP is always added to the certificate's SANs list
-	hosts := append(authOptions.ServerCertSANs, ip, "localhost")
+	keyUsage, extKeyUsage, err := cert.ParseKeyUsages(authOptions.ServerCertKeyUsages)
+	if err != nil {
+		return err
+	}
+
+	// The Host IP is always added to the certificate's SANs list, with the
+	// addresses of the other networks of the machine, as they are when the
+	// machine is provisioned.
+	hosts := append(append([]string{}, authOptions.ServerCertSANs...), ip, "localhost")
+	hosts = uniqueHosts(append(hosts, otherAddresses(driver, ip)...))
 	log.Debugf("generating server cert: %s ca-key=%s private-key=%s org=%s san=%s",
 		authOptions.ServerCertPath,
 		authOptions.CaCertPath,
@@ -112,89 +305,75 @@ func ConfigureAuth(p Provisioner) error {
 		CAKeyFile:   authOptions.CaPrivateKeyPath,
 		Org:         org,
 		Bits:        bits,
-		SwarmMaster: swarmOptions.Master,
+		SwarmMaster: swarmMaster,
+		Validity:    authOptions.ServerCertValidity,
+		KeyUsage:    keyUsage,
+		ExtKeyUsage: extKeyUsage,
 	})
 
 	if err != nil {
 		return fmt.Errorf("error generating server cert: %s", err)
 	}
+	return nil
+}
 
-	if err := p.Service("docker", serviceaction.Stop); err != nil {
-		return err
-	}
-
-	if _, err := p.SSHCommand(`if [ ! -z "$(ip link show docker0)" ]; then sudo ip link delete docker0; fi`); err != nil {
-		return err
-	}
-
-	// upload certs and configure TLS auth
-	caCert, err := os.ReadFile(authOptions.CaCertPath)
-	if err != nil {
-		return err
-	}
-
-	serverCert, err := os.ReadFile(authOptions.ServerCertPath)
-	if err != nil {
-		return err
-	}
-	serverKey, err := os.ReadFile(authOptions.ServerKeyPath)
-	if err != nil {
-		return err
-	}
-
-	log.Info("Copying certs to the remote machine...")
-
-	// printf will choke if we don't pass a format string because of the
-	// dashes, so that's the reason for the '%%s'
-	certTransferCmdFmt := "printf '%%s' '%s' | sudo tee %s"
-
-	// These ones are for Jessie and Mike <3 <3 <3
-	if _, err := p.SSHCommand(fmt.Sprintf(certTransferCmdFmt, string(caCert), authOptions.CaCertRemotePath)); err != nil {
-		return err
-	}
-
-	if _, err := p.SSHCommand(fmt.Sprintf(certTransferCmdFmt, string(serverCert), authOptions.ServerCertRemotePath)); err != nil {
-		return err
+// uniqueHosts returns the hosts without the duplicates, in order.
+func uniqueHosts(hosts []string) []string {
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, h := range hosts {
+		if !seen[h] {
+			seen[h] = true
+			unique = append(unique, h)
+		}
 	}
+	return unique
+}
 
-	if _, err := p.SSHCommand(fmt.Sprintf(certTransferCmdFmt, string(serverKey), authOptions.ServerKeyRemotePath)); err != nil {
-		return err
+// copyServerCert uploads the CA and the server certificate to their remote
+// paths.
+func copyServerCert(p SSHCommander, authOptions auth.Options) error {
+	for _, file := range []struct {
+		local, remote string
+		mode          os.FileMode
+	}{
+		{authOptions.CaCertPath, authOptions.CaCertRemotePath, 0644},
+		{authOptions.ServerCertPath, authOptions.ServerCertRemotePath, 0644},
+		{authOptions.ServerKeyPath, authOptions.ServerKeyRemotePath, 0600},
+	} {
+		f, err := os.Open(file.local)
+		if err != nil {
+			return err
+		}
+		err = uploadFile(p, file.remote, f, ssh.FileAttributes{Mode: file.mode, Owner: "root"})
+		f.Close()
+		if err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
+// enginePort returns the port of the URL of the machine, the one the engine
+// listens on.
+func enginePort(driver drivers.Driver) (int, error) {
 	dockerURL, err := driver.GetURL()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	u, err := url.Parse(dockerURL)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	dockerPort := engine.DefaultPort
-	parts := strings.Split(u.Host, ":")
-	if len(parts) == 2 {
-		dPort, err := strconv.Atoi(parts[1])
+	if u.Port() != "" {
+		dPort, err := strconv.Atoi(u.Port())
 		if err != nil {
-			return err
+			return 0, err
 		}
 		dockerPort = dPort
 	}
-
-	dkrcfg, err := p.GenerateDockerOptions(dockerPort)
-	if err != nil {
-		return err
-	}
-
-	log.Info("Setting Docker configuration on the remote daemon...")
-
-	if _, err = p.SSHCommand(fmt.Sprintf("sudo mkdir -p %s && printf %%s \"%s\" | sudo tee %s", path.Dir(dkrcfg.EngineOptionsPath), dkrcfg.EngineOptions, dkrcfg.EngineOptionsPath)); err != nil {
-		return err
-	}
-
-	if err := p.Service("docker", serviceaction.Restart); err != nil {
-		return err
-	}
-
-	return WaitForDocker(p, dockerPort)
+	return dockerPort, nil
 }
 
 func matchNetstatOut(reDaemonListening, netstatOut string) bool {
@@ -8,10 +8,12 @@ import (
 
 	"github.com/rancher/machine/drivers/fakedriver"
 	"github.com/rancher/machine/libmachine/auth"
+	"github.com/rancher/machine/libmachine/drivers"
 	"github.com/rancher/machine/libmachine/engine"
 	"github.com/rancher/machine/libmachine/provision/pkgaction"
 	"github.com/rancher/machine/libmachine/provision/provisiontest"
 	"github.com/rancher/machine/libmachine/provision/serviceaction"
+	"github.com/rancher/machine/libmachine/state"
 	"github.com/rancher/machine/libmachine/swarm"
 	"github.com/stretchr/testify/assert"
 )
@@ -173,6 +175,7 @@ func TestUbuntuSystemdDaemonBinary(t *testing.T) {
 	}{
 		{"Docker version 1.9.1\n", "docker daemon"},
 		{"Docker version 1.11.2\n", "docker daemon"},
+		{"Docker version 1.12.0-rc1, build 1f136c1\n", "dockerd"},
 		{"Docker version 1.12.0\n", "dockerd"},
 		{"Docker version 1.13.0\n", "dockerd"},
 	}
@@ -282,3 +285,69 @@ func TestDockerClientVersion(t *testing.T) {
 		}
 	}
 }
+
+// urlDriver is a driver whose engine has the URL.
+type urlDriver struct {
+	*fakedriver.Driver
+	url string
+}
+
+func (d *urlDriver) GetURL() (string, error) {
+	return d.url, nil
+}
+
+func TestEnginePort(t *testing.T) {
+	for url, expected := range map[string]int{
+		"tcp://1.2.3.4:2377":    2377,
+		"tcp://[fd00::1]:2377":  2377,
+		"tcp://[fd00::1]":       2376,
+		"tcp://machine.example": 2376,
+	} {
+		port, err := enginePort(&urlDriver{Driver: &fakedriver.Driver{}, url: url})
+
+		assert.NoError(t, err, url)
+		assert.Equal(t, expected, port, url)
+	}
+}
+
+func TestMachineArchitecture(t *testing.T) {
+	for machine, expected := range map[string]string{
+		"x86_64\n":  "amd64",
+		"aarch64\n": "arm64",
+		"armv7l\n":  "armhf",
+	} {
+		commander := &provisiontest.FakeSSHCommander{Responses: map[string]string{"uname -m": machine}}
+		arch, err := machineArchitecture(commander)
+
+		assert.NoError(t, err)
+		assert.Equal(t, expected, arch)
+	}
+
+	commander := &provisiontest.FakeSSHCommander{Responses: map[string]string{"uname -m": "riscv64\n"}}
+	arch, err := machineArchitecture(commander)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "riscv64", arch)
+}
+
+func TestOtherAddresses(t *testing.T) {
+	driver := &fakedriver.NetworkDriver{
+		Driver: &fakedriver.Driver{MockState: state.Running},
+		MockIPs: []drivers.NetworkAddress{
+			{Kind: drivers.AddressPublic, Address: "5.6.7.8"},
+			{Kind: drivers.AddressPrivate, Address: "10.0.0.5", Interface: "eth1"},
+		},
+	}
+
+	assert.Equal(t, []string{"10.0.0.5"}, otherAddresses(driver, "5.6.7.8"))
+	assert.Empty(t, otherAddresses(&fakedriver.Driver{}, "5.6.7.8"))
+
+	driver.MockState = state.Stopped
+	assert.Empty(t, otherAddresses(driver, "5.6.7.8"))
+}
+
+func TestUniqueHosts(t *testing.T) {
+	hosts := uniqueHosts([]string{"lb.example.com", "10.0.0.5", "192.168.99.100", "localhost", "10.0.0.5"})
+
+	assert.Equal(t, []string{"lb.example.com", "10.0.0.5", "192.168.99.100", "localhost"}, hosts)
+}
@@ -0,0 +1,211 @@
+package provision
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/rancher/machine/libmachine/auth"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/engine"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/mcnutils"
+)
+
+const (
+	// WindowsMachineOS is the OS the drivers with an OS flag advertise for
+	// Windows machines.
+	WindowsMachineOS = "windows"
+
+	// DefaultWindowsEngineInstallURL is the install script of the Mirantis
+	// Container Runtime, formerly Docker EE, for Windows Server.
+	DefaultWindowsEngineInstallURL = "https://get.mirantis.com/install.ps1"
+
+	windowsDockerDir = `C:\ProgramData\docker`
+)
+
+// windowsCommander runs PowerShell commands on a Windows machine through its
+// OpenSSH server, whatever its default shell is.
+type windowsCommander struct {
+	drivers.Driver
+}
+
+func (c windowsCommander) SSHCommand(script string) (string, error) {
+	return drivers.RunSSHCommandFromDriver(c.Driver, powershellCommand(script))
+}
+
+// SSHCommandWithInput runs the script with input as its standard input, to
+// keep the input off the command line.
+func (c windowsCommander) SSHCommandWithInput(script string, input io.Reader) (string, error) {
+	return drivers.RunSSHCommandWithInputFromDriver(c.Driver, powershellCommand(script), input)
+}
+
+// windowsInputCommander runs PowerShell scripts with a standard input.
+type windowsInputCommander interface {
+	SSHCommandWithInput(script string, input io.Reader) (string, error)
+}
+
+// powershellCommand returns the command running the script, encoded to keep
+// the quotes of the script away from the shell.
+func powershellCommand(script string) string {
+	codes := utf16.Encode([]rune(script))
+	b := make([]byte, 2*len(codes))
+	for i, code := range codes {
+		binary.LittleEndian.PutUint16(b[2*i:], code)
+	}
+	return "powershell -NoProfile -NonInteractive -EncodedCommand " + base64.StdEncoding.EncodeToString(b)
+}
+
+// ProvisionWindows installs the Mirantis Container Runtime on a Windows Server
+// machine and configures the daemon with TLS.
+func ProvisionWindows(d drivers.Driver, authOptions auth.Options, engineOptions engine.Options) error {
+	c := windowsCommander{d}
+
+	installURL := engineOptions.InstallURL
+	if installURL == "" || installURL == drivers.DefaultEngineInstallURL {
+		installURL = DefaultWindowsEngineInstallURL
+	}
+	if !strings.EqualFold(installURL, "none") {
+		log.Infof("Installing the container runtime from: %s", installURL)
+		output, err := c.SSHCommand(fmt.Sprintf("if (-not (Get-Service docker -ErrorAction SilentlyContinue)) { Invoke-WebRequest -UseBasicParsing -OutFile $env:TEMP\\install-docker.ps1 %s; & $env:TEMP\\install-docker.ps1; Write-Output installed-docker }", powershellQuote(installURL)))
+		if err != nil {
+			return fmt.Errorf("Error installing Docker: %s", err)
+		}
+
+		// The Containers feature is only enabled after a restart.
+		if strings.Contains(output, "installed-docker") {
+			if err := rebootWindows(c); err != nil {
+				return err
+			}
+		}
+	}
+
+	return ConfigureWindowsAuth(d, authOptions, engineOptions)
+}
+
+// ConfigureWindowsAuth generates the server certificate of the Windows
+// machine and restarts the daemon listening with TLS on the engine port and
+// on its named pipe.
+func ConfigureWindowsAuth(d drivers.Driver, authOptions auth.Options, engineOptions engine.Options) error {
+	c := windowsCommander{d}
+
+	authOptions.CaCertRemotePath = windowsDockerDir + `\certs.d\ca.pem`
+	authOptions.ServerCertRemotePath = windowsDockerDir + `\certs.d\server.pem`
+	authOptions.ServerKeyRemotePath = windowsDockerDir + `\certs.d\server-key.pem`
+
+	if err := generateServerCert(d, authOptions, false); err != nil {
+		return err
+	}
+
+	for local, remote := range map[string]string{
+		authOptions.CaCertPath:     authOptions.CaCertRemotePath,
+		authOptions.ServerCertPath: authOptions.ServerCertRemotePath,
+		authOptions.ServerKeyPath:  authOptions.ServerKeyRemotePath,
+	} {
+		content, err := os.ReadFile(local)
+		if err != nil {
+			return err
+		}
+		if err := writeWindowsFile(c, remote, content); err != nil {
+			return err
+		}
+	}
+
+	port, err := enginePort(d)
+	if err != nil {
+		return err
+	}
+	engineOptions.Labels = append(engineOptions.Labels, fmt.Sprintf("provider=%s", d.DriverName()))
+	config, err := windowsDaemonConfig(port, authOptions, engineOptions)
+	if err != nil {
+		return err
+	}
+	if err := writeWindowsFile(c, windowsDockerDir+`\config\daemon.json`, config); err != nil {
+		return err
+	}
+
+	log.Info("Opening the engine port in the Windows firewall...")
+	if _, err := c.SSHCommand(fmt.Sprintf("if (-not (Get-NetFirewallRule -Name docker-tls -ErrorAction SilentlyContinue)) { New-NetFirewallRule -Name docker-tls -DisplayName 'Docker TLS' -Direction Inbound -Protocol TCP -LocalPort %d -Action Allow | Out-Null }", port)); err != nil {
+		return err
+	}
+
+	if _, err := c.SSHCommand("Restart-Service docker"); err != nil {
+		return err
+	}
+
+	listening := regexp.MustCompile(fmt.Sprintf(`:%d\s+\S+\s+LISTENING`, port))
+	if err := mcnutils.WaitForSpecific(func() bool {
+		output, err := c.SSHCommand("netstat -an -p tcp")
+		return err == nil && listening.MatchString(output)
+	}, 20, 3*time.Second); err != nil {
+		return NewErrDaemonAvailable(err)
+	}
+	return nil
+}
+
+// windowsDaemonConfig returns the daemon.json making the daemon listen on its
+// named pipe and with TLS on the port.
+func windowsDaemonConfig(port int, authOptions auth.Options, engineOptions engine.Options) ([]byte, error) {
+	config := map[string]interface{}{
+		"hosts":     []string{fmt.Sprintf("tcp://0.0.0.0:%d", port), "npipe://"},
+		"tlsverify": true,
+		"tlscacert": authOptions.CaCertRemotePath,
+		"tlscert":   authOptions.ServerCertRemotePath,
+		"tlskey":    authOptions.ServerKeyRemotePath,
+	}
+	if len(engineOptions.Labels) > 0 {
+		config["labels"] = engineOptions.Labels
+	}
+	if len(engineOptions.InsecureRegistry) > 0 {
+		config["insecure-registries"] = engineOptions.InsecureRegistry
+	}
+	if len(engineOptions.RegistryMirror) > 0 {
+		config["registry-mirrors"] = engineOptions.RegistryMirror
+	}
+	if len(engineOptions.DNS) > 0 {
+		config["dns"] = engineOptions.DNS
+	}
+	return json.MarshalIndent(config, "", "  ")
+}
+
+// writeWindowsFile writes the content to the path on the machine, creating
+// its directory. The content is sent, base64 encoded, on the standard input
+// of the script, so that neither the logs of the commands nor the limit of
+// the length of command lines see it.
+func writeWindowsFile(c windowsInputCommander, path string, content []byte) error {
+	path = powershellQuote(path)
+	_, err := c.SSHCommandWithInput(fmt.Sprintf("New-Item -ItemType Directory -Force -Path (Split-Path %s) | Out-Null; [IO.File]::WriteAllBytes(%s, [Convert]::FromBase64String([Console]::In.ReadToEnd()))",
+		path, path), strings.NewReader(base64.StdEncoding.EncodeToString(content)))
+	return err
+}
+
+// powershellQuote quotes s as a PowerShell string taken verbatim.
+func powershellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// rebootWindows restarts the machine and waits for it to be back.
+func rebootWindows(c windowsCommander) error {
+	bootTime, err := c.SSHCommand("(Get-CimInstance Win32_OperatingSystem).LastBootUpTime.Ticks")
+	if err != nil {
+		return err
+	}
+
+	log.Info("Restarting the machine to enable the Containers feature...")
+	// ignore errors here because the SSH connection will close
+	if _, err := c.SSHCommand("Restart-Computer -Force"); err != nil {
+		log.Debugf("Restart command ended with: %s", err)
+	}
+
+	return mcnutils.WaitForSpecific(func() bool {
+		current, err := c.SSHCommand("(Get-CimInstance Win32_OperatingSystem).LastBootUpTime.Ticks")
+		return err == nil && strings.TrimSpace(current) != strings.TrimSpace(bootTime)
+	}, 60, 5*time.Second)
+}
@@ -0,0 +1,117 @@
+package libmachine
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/host"
+	"github.com/rancher/machine/libmachine/log"
+	"github.com/rancher/machine/libmachine/mcnutils"
+	"github.com/rancher/machine/libmachine/progress"
+	"github.com/rancher/machine/libmachine/state"
+)
+
+// stepCheckpoints are the checkpoints reached when the steps complete.
+var stepCheckpoints = map[string]host.Checkpoint{
+	progress.CreatingMachine:      host.CheckpointMachineCreated,
+	progress.InstallingDocker:     host.CheckpointPackagesInstalled,
+	progress.InstallingK3s:        host.CheckpointPackagesInstalled,
+	progress.InstallingContainerd: host.CheckpointPackagesInstalled,
+	progress.InstallingPodman:     host.CheckpointPackagesInstalled,
+	progress.RunningCustomScript:  host.CheckpointPackagesInstalled,
+	progress.ConfiguringEngine:    host.CheckpointDaemonConfigured,
+	progress.CheckingDocker:       host.CheckpointDaemonVerified,
+}
+
+// recordCheckpoints returns a handler adding to h the checkpoints of the
+// steps that complete, before sending the events on to forward.
+func recordCheckpoints(h *host.Host, forward progress.Func) progress.Func {
+	var mu sync.Mutex
+	return func(ev progress.Event) {
+		if checkpoint, ok := stepCheckpoints[ev.Step]; ok && ev.Type == progress.StepCompleted {
+			mu.Lock()
+			h.AddCheckpoint(checkpoint)
+			mu.Unlock()
+		}
+		forward(ev)
+	}
+}
+
+// subscribeCheckpoints records the checkpoints h reaches until the returned
+// function is called, sending the events to api.Progress if set.
+func (api *Client) subscribeCheckpoints(h *host.Host) (unsubscribe func()) {
+	forward := progress.Handler(h.Name)
+	if api.Progress != nil {
+		forward = api.Progress
+	}
+	return progress.Subscribe(h.Name, recordCheckpoints(h, forward))
+}
+
+// Resume resumes the provisioning of a host whose creation failed, from the
+// last checkpoint it reached, instead of creating it again. The steps the
+// checkpoints do not cover are run again, which they can be.
+func (api *Client) Resume(h *host.Host) (err error) {
+	if h.LifecycleState != host.LifecycleError {
+		log.Infof("Machine %q was created, there is nothing to resume", h.Name)
+		return nil
+	}
+	if !h.HasCheckpoint(host.CheckpointMachineCreated) {
+		return fmt.Errorf("machine %q was not created, remove it and create it again", h.Name)
+	}
+
+	defer api.subscribeCheckpoints(h)()
+
+	steps := progress.NewTracker(h.Name)
+	defer func() { steps.Done(err) }()
+
+	if err := api.resume(h, steps); err != nil {
+		if saveErr := api.Save(h); saveErr != nil {
+			log.Warnf("Error saving host to store after resuming failed: %s", saveErr)
+		}
+		return fmt.Errorf("Error resuming the provisioning of machine %q: %w", h.Name, err)
+	}
+
+	h.LifecycleState = ""
+	return api.Save(h)
+}
+
+func (api *Client) resume(h *host.Host, steps *progress.Tracker) error {
+	if h.HasCheckpoint(host.CheckpointDaemonVerified) {
+		return nil
+	}
+
+	steps.Start(progress.WaitingForInstance, "Waiting for machine to be running, this may take a few minutes...")
+	s, err := h.Driver.GetState()
+	if err != nil {
+		return err
+	}
+	if s != state.Running {
+		// The engine may not be installed yet, Host.Start would wait for it.
+		log.Infof("Starting machine %q...", h.Name)
+		if err := h.Driver.Start(); err != nil {
+			return err
+		}
+	}
+	if err := mcnutils.WaitFor(drivers.MachineInState(h.Driver, state.Running)); err != nil {
+		return fmt.Errorf("Error waiting for machine to be running: %s", err)
+	}
+
+	// The hosts checked for Docker are the ones the checkpoints of the
+	// engine are recorded for.
+	dockerChecked := h.HostOptions.CustomInstallScript == "" && (h.HostOptions.ProvisionEngine == "" ||
+		h.HostOptions.ProvisionEngine == host.ProvisionEngineDocker ||
+		h.HostOptions.ProvisionEngine == host.ProvisionEnginePodman)
+
+	if !dockerChecked || !h.HasCheckpoint(host.CheckpointDaemonConfigured) {
+		steps.Start(progress.Provisioning, "Resuming the provisioning...")
+		if err := h.ResumeProvision(); err != nil {
+			return err
+		}
+	}
+
+	if !dockerChecked {
+		return nil
+	}
+	return checkDocker(h, steps)
+}
@@ -0,0 +1,94 @@
+package libmachine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rancher/machine/drivers/fakedriver"
+	"github.com/rancher/machine/libmachine/auth"
+	"github.com/rancher/machine/libmachine/check"
+	"github.com/rancher/machine/libmachine/host"
+	"github.com/rancher/machine/libmachine/persist/persisttest"
+	"github.com/rancher/machine/libmachine/progress"
+	"github.com/rancher/machine/libmachine/provision"
+	"github.com/rancher/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingConnChecker struct{}
+
+func (failingConnChecker) Check(_ *host.Host, _ bool) (string, *auth.Options, error) {
+	return "", nil, errors.New("connection refused")
+}
+
+func TestRecordCheckpoints(t *testing.T) {
+	h := &host.Host{Name: "recorded"}
+	forwarded := 0
+	record := recordCheckpoints(h, func(progress.Event) { forwarded++ })
+
+	for _, ev := range []progress.Event{
+		{Type: progress.StepStarted, Step: progress.CreatingMachine},
+		{Type: progress.StepCompleted, Step: progress.CreatingMachine},
+		{Type: progress.StepCompleted, Step: progress.WaitingForInstance},
+		{Type: progress.StepCompleted, Step: progress.InstallingDocker},
+		{Type: progress.StepCompleted, Step: progress.CopyingCerts},
+		{Type: progress.StepFailed, Step: progress.ConfiguringEngine},
+	} {
+		record(ev)
+	}
+
+	assert.Equal(t, 6, forwarded)
+	assert.Equal(t, []host.Checkpoint{
+		host.CheckpointMachineCreated,
+		host.CheckpointPackagesInstalled,
+	}, h.Checkpoints)
+}
+
+func TestCreateFailureResumes(t *testing.T) {
+	defer provision.SetDetector(&provision.StandardDetector{})
+	provision.SetDetector(&provision.FakeDetector{Provisioner: provision.NewFakeProvisioner(nil)})
+	defer func(orig check.ConnChecker) { check.DefaultConnChecker = orig }(check.DefaultConnChecker)
+	check.DefaultConnChecker = failingConnChecker{}
+
+	api := &Client{Store: &persisttest.FakeStore{}}
+	recordProgress(api)
+	h := newProgressHost(t, &fakedriver.Driver{MockState: state.Running, MockName: "progress"})
+	h.HostOptions.KeepOnError = true
+
+	assert.Error(t, api.Create(h))
+	assert.Equal(t, host.LifecycleError, h.LifecycleState)
+	assert.True(t, h.HasCheckpoint(host.CheckpointMachineCreated))
+	assert.False(t, h.HasCheckpoint(host.CheckpointDaemonVerified))
+
+	check.DefaultConnChecker = fakeConnChecker{}
+
+	assert.NoError(t, api.Resume(h))
+	assert.Equal(t, host.LifecycleState(""), h.LifecycleState)
+	assert.True(t, h.HasCheckpoint(host.CheckpointDaemonVerified))
+}
+
+func TestCreateRollbackClearsCheckpoints(t *testing.T) {
+	defer provision.SetDetector(&provision.StandardDetector{})
+	provision.SetDetector(&provision.FakeDetector{Provisioner: provision.NewFakeProvisioner(nil)})
+	defer func(orig check.ConnChecker) { check.DefaultConnChecker = orig }(check.DefaultConnChecker)
+	check.DefaultConnChecker = failingConnChecker{}
+
+	api := &Client{Store: &persisttest.FakeStore{}}
+	recordProgress(api)
+	h := newProgressHost(t, &fakedriver.Driver{MockState: state.Running, MockName: "progress"})
+
+	assert.Error(t, api.Create(h))
+	assert.Empty(t, h.Checkpoints)
+
+	err := api.Resume(h)
+
+	assert.EqualError(t, err, `machine "progress" was not created, remove it and create it again`)
+}
+
+func TestResumeCreatedHost(t *testing.T) {
+	api := &Client{Store: &persisttest.FakeStore{}}
+	h := &host.Host{Name: "created", Driver: &fakedriver.Driver{}}
+
+	assert.NoError(t, api.Resume(h))
+	assert.Empty(t, h.Checkpoints)
+}
@@ -0,0 +1,105 @@
+package ssh
+
+import (
+	"io"
+	"net"
+	"os"
+
+	"github.com/rancher/machine/libmachine/log"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// agentSocketEnv is the environment variable with the socket of the running
+// ssh-agent.
+const agentSocketEnv = "SSH_AUTH_SOCK"
+
+// AgentForwardingClient is a Client able to forward the local ssh-agent to
+// the machine, like `ssh -A` does.
+type AgentForwardingClient interface {
+	Client
+	// ForwardAgent makes the shells of the client forward the agent.
+	ForwardAgent()
+}
+
+// agentSocket returns the socket of the running ssh-agent, if there is one.
+func agentSocket() string {
+	return os.Getenv(agentSocketEnv)
+}
+
+// withAgent runs f with a connection to the ssh-agent listening on socket,
+// closed once f returns.
+func withAgent(socket string, f func(agent.ExtendedAgent) error) error {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return err
+	}
+	defer closeConn(conn)
+
+	return f(agent.NewClient(conn))
+}
+
+// agentAuthMethod authenticates with the keys of the ssh-agent listening on
+// socket.
+func agentAuthMethod(socket string) ssh.AuthMethod {
+	return ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+		var keys []*agent.Key
+		if err := withAgent(socket, func(a agent.ExtendedAgent) (err error) {
+			keys, err = a.List()
+			return err
+		}); err != nil {
+			log.Debugf("Error listing the keys of the ssh-agent at %s: %s", socket, err)
+			return nil, nil
+		}
+
+		signers := make([]ssh.Signer, 0, len(keys))
+		for _, key := range keys {
+			signers = append(signers, &agentSigner{socket: socket, key: key})
+		}
+		return signers, nil
+	})
+}
+
+// agentSigner signs with a key of the ssh-agent. It connects to the agent
+// for each signature rather than keeping a connection open for as long as
+// the client config lives.
+type agentSigner struct {
+	socket string
+	key    ssh.PublicKey
+}
+
+func (s *agentSigner) PublicKey() ssh.PublicKey {
+	return s.key
+}
+
+func (s *agentSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	return s.SignWithAlgorithm(rand, data, "")
+}
+
+// SignWithAlgorithm signs RSA keys with the SHA-2 algorithms the servers
+// refusing SHA-1 signatures ask for.
+func (s *agentSigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	var flags agent.SignatureFlags
+	switch algorithm {
+	case ssh.KeyAlgoRSASHA256:
+		flags = agent.SignatureFlagRsaSha256
+	case ssh.KeyAlgoRSASHA512:
+		flags = agent.SignatureFlagRsaSha512
+	}
+
+	var signature *ssh.Signature
+	err := withAgent(s.socket, func(a agent.ExtendedAgent) (err error) {
+		signature, err = a.SignWithFlags(s.key, data, flags)
+		return err
+	})
+	return signature, err
+}
+
+// forwardAgent forwards the ssh-agent listening on socket to the session of
+// conn.
+func forwardAgent(conn *ssh.Client, session *ssh.Session, socket string) error {
+	if err := agent.ForwardToRemote(conn, socket); err != nil {
+		return err
+	}
+	return agent.RequestAgentForwarding(session)
+}
@@ -0,0 +1,115 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// serveAgent serves an ssh-agent holding the key on a unix socket, which it
+// makes the socket of the running agent.
+func serveAgent(t *testing.T, key interface{}) {
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	t.Setenv(agentSocketEnv, socket)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+}
+
+func TestNativeClientWithAgent(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serveAgent(t, key)
+
+	publicKey, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The server only accepts the key of the agent.
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, offered ssh.PublicKey) (*ssh.Permissions, error) {
+			if !bytes.Equal(offered.Marshal(), publicKey.Marshal()) {
+				return nil, fmt.Errorf("unknown key")
+			}
+			return nil, nil
+		},
+	}
+	hostKey, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	server := &testServer{listener: listener, config: config}
+	go server.serve()
+
+	client, err := NewNativeClient("docker", "127.0.0.1", listener.Addr().(*net.TCPAddr).Port, &Auth{})
+	assert.NoError(t, err)
+
+	out, err := client.Output("exit 0")
+	assert.NoError(t, err)
+	assert.Equal(t, "ok\n", out)
+}
+
+func TestNativeConfigWithoutAgent(t *testing.T) {
+	t.Setenv(agentSocketEnv, "")
+
+	config, err := NewNativeConfig("docker", &Auth{Passwords: []string{"tcuser"}})
+	assert.NoError(t, err)
+	// The password, and the keyboard-interactive answers with it.
+	assert.Len(t, config.Auth, 2)
+}
+
+func TestNativeConfigWithKeysIgnoresAgent(t *testing.T) {
+	t.Setenv(agentSocketEnv, filepath.Join(t.TempDir(), "agent.sock"))
+
+	keyPath := filepath.Join(t.TempDir(), "id_rsa")
+	assert.NoError(t, GenerateSSHKey(keyPath))
+
+	config, err := NewNativeConfig("docker", &Auth{Keys: []string{keyPath}})
+	assert.NoError(t, err)
+	assert.Len(t, config.Auth, 1)
+}
+
+func TestExternalClientForwardAgent(t *testing.T) {
+	client := &ExternalClient{BaseArgs: []string{"docker@localhost", "-p", "22"}}
+	client.ForwardAgent()
+
+	assert.Equal(t, []string{"docker@localhost", "-p", "22", "-A"}, client.BaseArgs)
+}
@@ -0,0 +1,237 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rancher/machine/libmachine/fips"
+)
+
+// The environment variables overriding the SSH algorithms of the machines.
+const (
+	CiphersEnv      = "MACHINE_SSH_CIPHERS"
+	KeyExchangesEnv = "MACHINE_SSH_KEX_ALGORITHMS"
+	MACsEnv         = "MACHINE_SSH_MACS"
+)
+
+// The algorithms of the native client, the preferred ones of the Go SSH
+// library by default.
+var (
+	defaultCiphers = []string{
+		"aes128-gcm@openssh.com", "aes256-gcm@openssh.com",
+		"chacha20-poly1305@openssh.com",
+		"aes128-ctr", "aes192-ctr", "aes256-ctr",
+	}
+	supportedCiphers = append(defaultCiphers,
+		"arcfour256", "arcfour128", "arcfour",
+		"aes128-cbc", "3des-cbc",
+	)
+	defaultKeyExchanges = []string{
+		"curve25519-sha256", "curve25519-sha256@libssh.org",
+		"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+		"diffie-hellman-group14-sha256", "diffie-hellman-group14-sha1",
+	}
+	supportedKeyExchanges = append(defaultKeyExchanges,
+		"diffie-hellman-group16-sha512", "diffie-hellman-group1-sha1",
+		"diffie-hellman-group-exchange-sha256", "diffie-hellman-group-exchange-sha1",
+	)
+	defaultMACs = []string{
+		"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com",
+		"hmac-sha2-256", "hmac-sha2-512",
+		"hmac-sha1", "hmac-sha1-96",
+	}
+	supportedMACs = defaultMACs
+)
+
+// Algorithms are the ciphers, key exchanges and MACs the SSH clients offer
+// to a machine, for the hardened ones rejecting the defaults. Each is a
+// comma-separated list, like the options of OpenSSH: it replaces the
+// defaults of the client, or is added to them when it starts with "+" and
+// removed from them when it starts with "-". Empty keeps the defaults.
+type Algorithms struct {
+	Ciphers      string `json:",omitempty"`
+	KeyExchanges string `json:",omitempty"`
+	MACs         string `json:",omitempty"`
+}
+
+// WithEnv returns the algorithms with the ones set in the environment
+// instead.
+func (a Algorithms) WithEnv() Algorithms {
+	for _, env := range []struct {
+		name  string
+		value *string
+	}{
+		{CiphersEnv, &a.Ciphers},
+		{KeyExchangesEnv, &a.KeyExchanges},
+		{MACsEnv, &a.MACs},
+	} {
+		if value := os.Getenv(env.name); value != "" {
+			*env.value = value
+		}
+	}
+	return a
+}
+
+// IsZero tells whether the algorithms are all the defaults.
+func (a Algorithms) IsZero() bool {
+	return a == Algorithms{}
+}
+
+// Validate fails when an algorithm is not supported by the native client,
+// or not approved in the FIPS mode.
+func (a Algorithms) Validate() error {
+	_, _, _, err := a.native(nil, nil, nil)
+	return err
+}
+
+// native returns the ciphers, key exchanges and MACs of the native client
+// with the ones it has, the defaults when nil.
+func (a Algorithms) native(ciphers, keyExchanges, macs []string) ([]string, []string, []string, error) {
+	var err error
+	if ciphers, err = resolveAlgorithms("cipher", a.Ciphers, ciphers, defaultCiphers, supportedCiphers, fipsCiphers); err != nil {
+		return nil, nil, nil, err
+	}
+	if keyExchanges, err = resolveAlgorithms("key exchange", a.KeyExchanges, keyExchanges, defaultKeyExchanges, supportedKeyExchanges, fipsKeyExchanges); err != nil {
+		return nil, nil, nil, err
+	}
+	if macs, err = resolveAlgorithms("MAC", a.MACs, macs, defaultMACs, supportedMACs, fipsMACs); err != nil {
+		return nil, nil, nil, err
+	}
+	return ciphers, keyExchanges, macs, nil
+}
+
+// resolveAlgorithms returns the algorithms of the client, current or the
+// defaults when nil, changed by value.
+func resolveAlgorithms(kind, value string, current, defaults, supported, approved []string) ([]string, error) {
+	if current == nil {
+		current = defaults
+	}
+	if value == "" {
+		return current, nil
+	}
+	if fips.Enabled() {
+		supported = approved
+	}
+
+	op := value[0]
+	if op == '+' || op == '-' {
+		value = value[1:]
+	}
+
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !contains(supported, name) && op != '-' {
+			if fips.Enabled() {
+				return nil, fmt.Errorf("the SSH %s %q is not FIPS-approved", kind, name)
+			}
+			return nil, fmt.Errorf("the SSH %s %q is not supported, the supported ones are %s", kind, name, strings.Join(supported, ","))
+		}
+		names = append(names, name)
+	}
+
+	var resolved []string
+	switch op {
+	case '+':
+		resolved = append([]string{}, current...)
+		for _, name := range names {
+			if !contains(resolved, name) {
+				resolved = append(resolved, name)
+			}
+		}
+	case '-':
+		for _, name := range current {
+			if !contains(names, name) {
+				resolved = append(resolved, name)
+			}
+		}
+	default:
+		resolved = names
+	}
+
+	if len(resolved) == 0 {
+		return nil, fmt.Errorf("no SSH %s is left with %q", kind, value)
+	}
+	return resolved, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// AlgorithmsClient is a Client whose algorithms can be set.
+type AlgorithmsClient interface {
+	Client
+	// SetAlgorithms makes the client offer the algorithms to the machine.
+	SetAlgorithms(algorithms Algorithms) error
+}
+
+// SetAlgorithms makes the client offer the algorithms to the machine.
+func (client *NativeClient) SetAlgorithms(algorithms Algorithms) error {
+	ciphers, keyExchanges, macs, err := algorithms.native(client.Config.Ciphers, client.Config.KeyExchanges, client.Config.MACs)
+	if err != nil {
+		return err
+	}
+
+	client.Config.Ciphers = ciphers
+	client.Config.KeyExchanges = keyExchanges
+	client.Config.MACs = macs
+	return nil
+}
+
+// SetAlgorithms makes the client offer the algorithms to the machine. The
+// ssh binary resolves them against its own defaults, but in the FIPS mode.
+func (client *ExternalClient) SetAlgorithms(algorithms Algorithms) error {
+	values := map[string]string{
+		"Ciphers":       algorithms.Ciphers,
+		"KexAlgorithms": algorithms.KeyExchanges,
+		"MACs":          algorithms.MACs,
+	}
+
+	if fips.Enabled() {
+		ciphers, keyExchanges, macs, err := algorithms.native(fipsCiphers, fipsKeyExchanges, fipsMACs)
+		if err != nil {
+			return err
+		}
+		values["Ciphers"] = strings.Join(ciphers, ",")
+		values["KexAlgorithms"] = strings.Join(keyExchanges, ",")
+		values["MACs"] = strings.Join(macs, ",")
+	}
+
+	for _, option := range []string{"Ciphers", "KexAlgorithms", "MACs"} {
+		if values[option] != "" {
+			client.BaseArgs = setExternalOption(client.BaseArgs, option, values[option])
+		}
+	}
+	return nil
+}
+
+// setExternalOption sets the option in args, replacing its value if it is
+// there since ssh takes the first one.
+func setExternalOption(args []string, option, value string) []string {
+	for i, arg := range args {
+		if strings.HasPrefix(arg, option+"=") {
+			args[i] = option + "=" + value
+			return args
+		}
+	}
+	return append(args, "-o", option+"="+value)
+}
+
+// noCommonAlgorithmError returns err with how to set the algorithms when
+// the machine rejected the ones offered, nil otherwise.
+func noCommonAlgorithmError(err error) error {
+	if !strings.Contains(err.Error(), "no common algorithm") {
+		return nil
+	}
+	return fmt.Errorf("%s. The machine accepts none of the SSH algorithms offered, set the ones it accepts with the --ssh-ciphers, --ssh-kex-algorithms and --ssh-macs create flags or the %s, %s and %s environment variables", err, CiphersEnv, KeyExchangesEnv, MACsEnv)
+}
@@ -0,0 +1,77 @@
+package ssh
+
+import (
+	"testing"
+
+	"github.com/rancher/machine/libmachine/fips"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveAlgorithms(t *testing.T) {
+	if fips.Enabled() {
+		t.Skip("the algorithms are restricted to the approved ones")
+	}
+
+	for _, tc := range []struct {
+		value    string
+		expected []string
+	}{
+		{"", defaultMACs},
+		{"hmac-sha2-512,hmac-sha2-256", []string{"hmac-sha2-512", "hmac-sha2-256"}},
+		{"-hmac-sha1,hmac-sha1-96", []string{"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com", "hmac-sha2-256", "hmac-sha2-512"}},
+	} {
+		resolved, err := resolveAlgorithms("MAC", tc.value, nil, defaultMACs, supportedMACs, fipsMACs)
+		assert.NoError(t, err, tc.value)
+		assert.Equal(t, tc.expected, resolved, tc.value)
+	}
+
+	resolved, err := resolveAlgorithms("cipher", "+aes128-cbc", []string{"aes256-ctr"}, defaultCiphers, supportedCiphers, fipsCiphers)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"aes256-ctr", "aes128-cbc"}, resolved)
+
+	_, err = resolveAlgorithms("cipher", "+blowfish-cbc", nil, defaultCiphers, supportedCiphers, fipsCiphers)
+	assert.EqualError(t, err, `the SSH cipher "blowfish-cbc" is not supported, the supported ones are `+
+		"aes128-gcm@openssh.com,aes256-gcm@openssh.com,chacha20-poly1305@openssh.com,aes128-ctr,aes192-ctr,aes256-ctr,arcfour256,arcfour128,arcfour,aes128-cbc,3des-cbc")
+
+	_, err = resolveAlgorithms("key exchange", "-curve25519-sha256", []string{"curve25519-sha256"}, defaultKeyExchanges, supportedKeyExchanges, fipsKeyExchanges)
+	assert.EqualError(t, err, `no SSH key exchange is left with "curve25519-sha256"`)
+}
+
+func TestAlgorithmsWithEnv(t *testing.T) {
+	t.Setenv(CiphersEnv, "aes256-gcm@openssh.com")
+	t.Setenv(MACsEnv, "")
+
+	algorithms := Algorithms{Ciphers: "+aes128-cbc", MACs: "hmac-sha2-256"}.WithEnv()
+	assert.Equal(t, Algorithms{Ciphers: "aes256-gcm@openssh.com", MACs: "hmac-sha2-256"}, algorithms)
+}
+
+func TestExternalClientSetAlgorithms(t *testing.T) {
+	if fips.Enabled() {
+		t.Skip("the algorithms are restricted to the approved ones")
+	}
+
+	client := &ExternalClient{BaseArgs: []string{"-F", "/dev/null", "docker@localhost", "-p", "22"}}
+	assert.NoError(t, client.SetAlgorithms(Algorithms{Ciphers: "+aes128-cbc", MACs: "-hmac-sha1"}))
+	assert.Equal(t, []string{"-F", "/dev/null", "docker@localhost", "-p", "22", "-o", "Ciphers=+aes128-cbc", "-o", "MACs=-hmac-sha1"}, client.BaseArgs)
+}
+
+func TestNativeClientNoCommonAlgorithm(t *testing.T) {
+	if fips.Enabled() {
+		t.Skip("the test server has an Ed25519 host key")
+	}
+
+	server := newTestServer(t)
+	server.config.Ciphers = []string{"aes128-cbc"}
+	client := server.nativeClient(t)
+
+	_, err := client.Output("exit 0")
+	assert.ErrorContains(t, err, "no common algorithm for client to server cipher")
+	assert.ErrorContains(t, err, CiphersEnv)
+	// The handshake is not retried.
+	assert.Equal(t, 1, server.connections())
+
+	assert.NoError(t, client.SetAlgorithms(Algorithms{Ciphers: "+aes128-cbc"}))
+	out, err := client.Output("exit 0")
+	assert.NoError(t, err)
+	assert.Equal(t, "ok\n", out)
+}
@@ -0,0 +1,149 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// bastionTimeout is the ConnectTimeout of the external client.
+const bastionTimeout = 10 * time.Second
+
+// Bastion is an SSH server, or jump host, the connections to a machine that
+// is not reachable directly go through.
+type Bastion struct {
+	User string
+	Host string
+	Port int
+	Auth *Auth
+	// Via is the bastion this one is reached through, if it is not
+	// reachable directly either.
+	Via *Bastion
+}
+
+// ChainBastions links the bastions, each one reached through the one before
+// it, and returns the last, the one connecting to the machine. The first
+// bastion is reached directly. It returns nil without bastions.
+func ChainBastions(bastions ...*Bastion) *Bastion {
+	var last *Bastion
+	for _, b := range bastions {
+		b.Via = last
+		last = b
+	}
+	return last
+}
+
+func (b *Bastion) address() string {
+	return net.JoinHostPort(b.Host, strconv.Itoa(b.Port))
+}
+
+// Dial connects to addr from the bastion, reached through the bastions it is
+// chained to. Closing the returned connection closes the connections to the
+// bastions too.
+func (b *Bastion) Dial(network, addr string) (net.Conn, error) {
+	config, err := NewNativeConfig(b.User, b.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting config for the bastion %s: %s", b.address(), err)
+	}
+	config.Timeout = bastionTimeout
+
+	client, err := dialSSH(b.address(), &config, b.Via)
+	if err != nil {
+		return nil, fmt.Errorf("Error dialing the bastion %s: %s", b.address(), err)
+	}
+
+	conn, err := client.Dial(network, addr)
+	if err != nil {
+		closeConn(client)
+		return nil, fmt.Errorf("Error dialing %s through the bastion %s: %s", addr, b.address(), err)
+	}
+
+	return &bastionConn{Conn: conn, bastion: client}, nil
+}
+
+// bastionConn is a connection forwarded by a bastion.
+type bastionConn struct {
+	net.Conn
+	bastion *ssh.Client
+}
+
+func (c *bastionConn) Close() error {
+	err := c.Conn.Close()
+	closeConn(c.bastion)
+	return err
+}
+
+// dialSSH opens an SSH connection to addr, through the bastion if there is
+// one, and keeps it alive.
+func dialSSH(addr string, config *ssh.ClientConfig, bastion *Bastion) (*ssh.Client, error) {
+	if bastion == nil {
+		client, err := ssh.Dial("tcp", addr, config)
+		if err != nil {
+			return nil, err
+		}
+		sendKeepAlives(client)
+		return client, nil
+	}
+
+	conn, err := bastion.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		closeConn(conn)
+		return nil, err
+	}
+	client := ssh.NewClient(c, chans, reqs)
+	sendKeepAlives(client)
+	return client, nil
+}
+
+// bastionProxyCommand returns the ProxyCommand option making the ssh binary
+// at sshBinaryPath reach the host through the bastion.
+func bastionProxyCommand(sshBinaryPath string, bastion *Bastion) string {
+	return fmt.Sprintf("ProxyCommand='%s'", ProxyCommand(sshBinaryPath, bastion))
+}
+
+// ProxyCommand returns the command the ssh binary at sshBinaryPath proxies
+// its connections with to reach the hosts through the bastion, and the
+// bastions it is chained to.
+func ProxyCommand(sshBinaryPath string, bastion *Bastion) string {
+	args := []string{sshBinaryPath,
+		"-F", "/dev/null",
+		"-o", "ConnectTimeout=10",
+		"-o", "LogLevel=quiet",
+		"-o", "PasswordAuthentication=no",
+		"-o", "StrictHostKeyChecking=no",
+		"-o", "UserKnownHostsFile=/dev/null",
+	}
+	if len(bastion.Auth.Keys) > 0 {
+		args = append(args, "-o", "IdentitiesOnly=yes")
+	}
+	for _, privateKeyPath := range bastion.Auth.Keys {
+		if privateKeyPath != "" {
+			args = append(args, "-i", fmt.Sprintf("%q", privateKeyPath))
+		}
+	}
+	if bastion.Via != nil {
+		// The tokens of the proxy command of the bastion are escaped, for
+		// the ssh binary reaching the bastion to expand them rather than
+		// the one proxied.
+		via := strings.ReplaceAll(ProxyCommand(sshBinaryPath, bastion.Via), "%", "%%")
+		args = append(args, "-o", "ProxyCommand="+shellQuote(via))
+	}
+	args = append(args, "-p", strconv.Itoa(bastion.Port), "-W", "%h:%p", fmt.Sprintf("%s@%s", bastion.User, bastion.Host))
+
+	return strings.Join(args, " ")
+}
+
+// shellQuote quotes s as a single word of the shell running the proxy
+// commands.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
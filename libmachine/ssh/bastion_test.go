@@ -0,0 +1,153 @@
+package ssh
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// forward connects a direct-tcpip channel, opened to reach a host through the
+// test server, to the host.
+func forward(newChannel ssh.NewChannel) {
+	var target struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	go func() {
+		io.Copy(conn, channel)
+		conn.Close()
+	}()
+	io.Copy(channel, conn)
+	channel.Close()
+}
+
+func (s *testServer) bastion(t *testing.T) *Bastion {
+	client := s.nativeClient(t)
+	return &Bastion{
+		User: "jump",
+		Host: client.Hostname,
+		Port: client.Port,
+		Auth: &Auth{Passwords: []string{"tcuser"}},
+	}
+}
+
+func TestNativeClientThroughBastion(t *testing.T) {
+	bastion := newTestServer(t)
+	server := newTestServer(t)
+
+	client := server.nativeClient(t)
+	client.Bastion = bastion.bastion(t)
+
+	out, err := client.Output("exit 0")
+	assert.NoError(t, err)
+	assert.Equal(t, "ok\n", out)
+
+	// The dial check and the command both go through the bastion.
+	assert.Equal(t, 2, bastion.connections())
+	assert.Equal(t, 2, server.connections())
+}
+
+func TestBastionDial(t *testing.T) {
+	bastion := newTestServer(t)
+	server := newTestServer(t)
+
+	conn, err := bastion.bastion(t).Dial("tcp", server.listener.Addr().String())
+	assert.NoError(t, err)
+	assert.NoError(t, conn.Close())
+
+	_, err = bastion.bastion(t).Dial("tcp", "127.0.0.1:1")
+	assert.Error(t, err)
+}
+
+func TestBastionProxyCommand(t *testing.T) {
+	bastion := &Bastion{
+		User: "jump",
+		Host: "bastion.example.com",
+		Port: 2222,
+		Auth: &Auth{Keys: []string{"/tmp/bastion key"}},
+	}
+
+	proxyCommand := bastionProxyCommand("/usr/bin/ssh", bastion)
+	assert.True(t, strings.HasPrefix(proxyCommand, "ProxyCommand='/usr/bin/ssh -F /dev/null "))
+	assert.Contains(t, proxyCommand, ` -o IdentitiesOnly=yes -i "/tmp/bastion key" -p 2222 -W %h:%p jump@bastion.example.com'`)
+
+	proxyCommand = bastionProxyCommand("/usr/bin/ssh", &Bastion{User: "jump", Host: "bastion.example.com", Port: 22, Auth: &Auth{}})
+	assert.NotContains(t, proxyCommand, "IdentitiesOnly")
+	assert.NotContains(t, proxyCommand, " -i ")
+}
+
+func TestExternalClientThroughBastion(t *testing.T) {
+	bastion := &Bastion{User: "jump", Host: "bastion.example.com", Port: 22, Auth: &Auth{}}
+
+	client, err := newExternalClient("/usr/bin/ssh", "docker", "10.0.0.4", 22, &Auth{}, bastion)
+	assert.NoError(t, err)
+	assert.Contains(t, client.BaseArgs, bastionProxyCommand("/usr/bin/ssh", bastion))
+	assert.Contains(t, client.BaseArgs, "docker@10.0.0.4")
+}
+
+func TestNativeClientThroughChainedBastions(t *testing.T) {
+	outer := newTestServer(t)
+	inner := newTestServer(t)
+	server := newTestServer(t)
+
+	client := server.nativeClient(t)
+	client.Bastion = ChainBastions(outer.bastion(t), inner.bastion(t))
+
+	out, err := client.Output("exit 0")
+	assert.NoError(t, err)
+	assert.Equal(t, "ok\n", out)
+
+	assert.Equal(t, 2, outer.connections())
+	assert.Equal(t, 2, inner.connections())
+	assert.Equal(t, 2, server.connections())
+}
+
+func TestChainBastions(t *testing.T) {
+	assert.Nil(t, ChainBastions())
+
+	outer := &Bastion{Host: "outer"}
+	inner := &Bastion{Host: "inner"}
+	bastion := ChainBastions(outer, inner)
+	assert.Equal(t, inner, bastion)
+	assert.Equal(t, outer, bastion.Via)
+	assert.Nil(t, outer.Via)
+}
+
+func TestChainedBastionProxyCommand(t *testing.T) {
+	bastion := ChainBastions(
+		&Bastion{User: "outer", Host: "outer.example.com", Port: 22, Auth: &Auth{Keys: []string{"/tmp/outer key"}}},
+		&Bastion{User: "inner", Host: "inner.example.com", Port: 2222, Auth: &Auth{}},
+	)
+
+	proxyCommand := ProxyCommand("/usr/bin/ssh", bastion)
+	// The tokens of the outer bastion are expanded by the ssh binary reaching
+	// the inner one.
+	assert.Contains(t, proxyCommand, ` -o ProxyCommand='/usr/bin/ssh -F /dev/null `)
+	assert.Contains(t, proxyCommand, ` -o IdentitiesOnly=yes -i "/tmp/outer key" -p 22 -W %%h:%%p outer@outer.example.com' -p 2222 -W %h:%p inner@inner.example.com`)
+	assert.Equal(t, "ProxyCommand='"+proxyCommand+"'", bastionProxyCommand("/usr/bin/ssh", bastion))
+}
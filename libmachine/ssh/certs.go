@@ -0,0 +1,351 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// The environment variables setting the SSH certificate authorities of the
+// machines.
+const (
+	UserCAKeyEnv = "MACHINE_SSH_USER_CA_KEY"
+	HostCAKeyEnv = "MACHINE_SSH_HOST_CA_KEY"
+)
+
+const (
+	// DefaultUserCertValidity is how long the user certificates are valid.
+	DefaultUserCertValidity = time.Hour
+	// userCertRenewal is how long before it expires a user certificate is
+	// renewed, for the connections opened with it to outlive the command.
+	userCertRenewal = 5 * time.Minute
+	// certClockSkew backdates the certificates for the machines whose clock
+	// is behind.
+	certClockSkew = 5 * time.Minute
+)
+
+// CertAuthorities are the SSH certificate authorities of a machine, for the
+// environments using an SSH CA rather than raw keys. The key of the machine
+// is signed by the user CA, short-lived certificates it authenticates with,
+// and its host key certificate is validated against the host CA.
+type CertAuthorities struct {
+	// UserCAKey is the private key of the user CA.
+	UserCAKey string `json:",omitempty"`
+	// UserCertValidity is how long the user certificates are valid,
+	// DefaultUserCertValidity when zero.
+	UserCertValidity time.Duration `json:",omitempty"`
+	// HostCAKey is the public key of the host CA.
+	HostCAKey string `json:",omitempty"`
+}
+
+// WithEnv returns the certificate authorities with the ones set in the
+// environment instead.
+func (c CertAuthorities) WithEnv() CertAuthorities {
+	if value := os.Getenv(UserCAKeyEnv); value != "" {
+		c.UserCAKey = value
+	}
+	if value := os.Getenv(HostCAKeyEnv); value != "" {
+		c.HostCAKey = value
+	}
+	return c
+}
+
+// IsZero tells whether the machine uses no certificate authority.
+func (c CertAuthorities) IsZero() bool {
+	return c == CertAuthorities{}
+}
+
+// UserCertSigner signs the user certificates of the machines. Signing with a
+// CA kept elsewhere, like the SSH secrets engine of Vault, only takes another
+// implementation.
+type UserCertSigner interface {
+	// SignUserCert returns the certificate of key, identified by keyID, for
+	// the principals to log in as.
+	SignUserCert(key ssh.PublicKey, keyID string, principals []string) (*ssh.Certificate, error)
+}
+
+// FileUserCertSigner signs the user certificates with the private key of a
+// CA stored in a file.
+type FileUserCertSigner struct {
+	KeyPath  string
+	Validity time.Duration
+}
+
+// SignUserCert returns the certificate of key, valid for Validity.
+func (s *FileUserCertSigner) SignUserCert(key ssh.PublicKey, keyID string, principals []string) (*ssh.Certificate, error) {
+	pem, err := os.ReadFile(s.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading the SSH user CA key: %s", err)
+	}
+	ca, err := ssh.ParsePrivateKey(pem)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing the SSH user CA key %s: %s", s.KeyPath, err)
+	}
+
+	validity := s.Validity
+	if validity <= 0 {
+		validity = DefaultUserCertValidity
+	}
+
+	var serial [8]byte
+	if _, err := rand.Read(serial[:]); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	cert := &ssh.Certificate{
+		Key:             key,
+		Serial:          binary.BigEndian.Uint64(serial[:]),
+		CertType:        ssh.UserCert,
+		KeyId:           keyID,
+		ValidPrincipals: principals,
+		ValidAfter:      uint64(now.Add(-certClockSkew).Unix()),
+		ValidBefore:     uint64(now.Add(validity).Unix()),
+		Permissions: ssh.Permissions{
+			Extensions: map[string]string{
+				"permit-agent-forwarding": "",
+				"permit-port-forwarding":  "",
+				"permit-pty":              "",
+				"permit-user-rc":          "",
+			},
+		},
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		return nil, fmt.Errorf("Error signing the SSH certificate: %s", err)
+	}
+	return cert, nil
+}
+
+// UserCertPath returns the path of the certificate of the private key at
+// keyPath, where the ssh binary loads it from.
+func UserCertPath(keyPath string) string {
+	return keyPath + "-cert.pub"
+}
+
+// readUserCert returns the certificate of the private key at keyPath, or nil
+// if it has none.
+func readUserCert(keyPath string) (*ssh.Certificate, error) {
+	content, err := os.ReadFile(UserCertPath(keyPath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key, _, _, _, err := ssh.ParseAuthorizedKey(content)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing the SSH certificate %s: %s", UserCertPath(keyPath), err)
+	}
+	cert, ok := key.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an SSH certificate", UserCertPath(keyPath))
+	}
+	return cert, nil
+}
+
+// RenewUserCert signs the private key at keyPath for principal, unless its
+// certificate is valid for a while still.
+func RenewUserCert(signer UserCertSigner, keyPath, keyID, principal string) error {
+	cert, err := readUserCert(keyPath)
+	if err != nil {
+		return err
+	}
+	if cert != nil && time.Unix(int64(cert.ValidBefore), 0).After(time.Now().Add(userCertRenewal)) && contains(cert.ValidPrincipals, principal) {
+		return nil
+	}
+
+	pem, err := os.ReadFile(keyPath)
+	if err != nil {
+		return err
+	}
+	key, err := ssh.ParsePrivateKey(pem)
+	if err != nil {
+		return fmt.Errorf("Error parsing the SSH key %s: %s", keyPath, err)
+	}
+
+	cert, err = signer.SignUserCert(key.PublicKey(), keyID, []string{principal})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(UserCertPath(keyPath), ssh.MarshalAuthorizedKey(cert), 0600)
+}
+
+// certSigner returns the signer authenticating with the certificate of the
+// private key at keyPath, or nil if it has none.
+func certSigner(keyPath string, key ssh.Signer) (ssh.Signer, error) {
+	cert, err := readUserCert(keyPath)
+	if err != nil || cert == nil {
+		return nil, err
+	}
+	return ssh.NewCertSigner(cert, key)
+}
+
+// HostCAKnownHostsFile is the name of the known_hosts file trusting the host
+// CA in the directory of a machine.
+const HostCAKnownHostsFile = "known_hosts_ca"
+
+// HostCA is the certificate authority signing the host keys of a machine.
+// The principals of the host certificates must include the address the
+// machine is connected to.
+type HostCA struct {
+	// KeyPath is the public key of the CA.
+	KeyPath string
+	// KnownHostsPath is the known_hosts file trusting the CA the external
+	// client is given.
+	KnownHostsPath string
+}
+
+// publicKey returns the public key of the CA.
+func (ca *HostCA) publicKey() (ssh.PublicKey, error) {
+	content, err := os.ReadFile(ca.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading the SSH host CA key: %s", err)
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey(content)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing the SSH host CA key %s: %s", ca.KeyPath, err)
+	}
+	return key, nil
+}
+
+// ErrHostCertRejected is returned when the host key certificate of a machine
+// is missing or not valid for the host CA.
+type ErrHostCertRejected struct {
+	Err error
+}
+
+func (e ErrHostCertRejected) Error() string {
+	return fmt.Sprintf("the SSH host certificate of the machine is rejected: %s", e.Err)
+}
+
+// HostKeyCallback returns the callback accepting the host key certificates
+// signed by the CA only.
+func (ca *HostCA) HostKeyCallback() (ssh.HostKeyCallback, error) {
+	key, err := ca.publicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	checker := &ssh.CertChecker{
+		IsHostAuthority: func(auth ssh.PublicKey, _ string) bool {
+			return bytes.Equal(auth.Marshal(), key.Marshal())
+		},
+		HostKeyFallback: func(hostname string, _ net.Addr, _ ssh.PublicKey) error {
+			return fmt.Errorf("%s presented a host key without certificate", hostname)
+		},
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if err := checker.CheckHostKey(hostname, remote, key); err != nil {
+			return ErrHostCertRejected{Err: err}
+		}
+		return nil
+	}, nil
+}
+
+// HostCertVerifyingClient is a Client able to verify the host key
+// certificate of the machine.
+type HostCertVerifyingClient interface {
+	Client
+	// VerifyHostCert makes the client accept the host key certificates
+	// signed by ca only.
+	VerifyHostCert(ca *HostCA) error
+}
+
+// VerifyHostCert makes the client accept the host key certificates signed by
+// ca only, rather than the host key recorded for the machine.
+func (client *NativeClient) VerifyHostCert(ca *HostCA) error {
+	callback, err := ca.HostKeyCallback()
+	if err != nil {
+		return err
+	}
+
+	client.Config.HostKeyCallback = callback
+	client.Config.HostKeyAlgorithms = hostCertAlgorithms(client.Config.HostKeyAlgorithms)
+	return nil
+}
+
+// hostCertAlgorithmsOf maps the host key algorithms to the ones of their
+// certificates.
+var hostCertAlgorithmsOf = map[string]string{
+	ssh.KeyAlgoRSASHA512: ssh.CertAlgoRSASHA512v01,
+	ssh.KeyAlgoRSASHA256: ssh.CertAlgoRSASHA256v01,
+	ssh.KeyAlgoRSA:       ssh.CertAlgoRSAv01,
+	ssh.KeyAlgoECDSA256:  ssh.CertAlgoECDSA256v01,
+	ssh.KeyAlgoECDSA384:  ssh.CertAlgoECDSA384v01,
+	ssh.KeyAlgoECDSA521:  ssh.CertAlgoECDSA521v01,
+	ssh.KeyAlgoED25519:   ssh.CertAlgoED25519v01,
+}
+
+// hostCertAlgorithms returns the certificate algorithms of the host key
+// algorithms, nil for all the ones of the client when none are set.
+func hostCertAlgorithms(algorithms []string) []string {
+	var certAlgorithms []string
+	for _, algorithm := range algorithms {
+		if certAlgorithm, ok := hostCertAlgorithmsOf[algorithm]; ok {
+			certAlgorithms = append(certAlgorithms, certAlgorithm)
+		}
+	}
+	return certAlgorithms
+}
+
+// VerifyHostCert makes the client accept the host key certificates signed by
+// ca only, writing the known_hosts file trusting it.
+func (client *ExternalClient) VerifyHostCert(ca *HostCA) error {
+	key, err := ca.publicKey()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(ca.KnownHostsPath), 0700); err != nil {
+		return err
+	}
+	line := "@cert-authority * " + string(ssh.MarshalAuthorizedKey(key))
+	if err := os.WriteFile(ca.KnownHostsPath, []byte(line), 0600); err != nil {
+		return err
+	}
+
+	args := make([]string, 0, len(client.BaseArgs))
+	for _, arg := range client.BaseArgs {
+		switch {
+		case arg == "LogLevel=quiet":
+			arg = "LogLevel=error"
+		case arg == "StrictHostKeyChecking=no":
+			arg = "StrictHostKeyChecking=yes"
+		case strings.HasPrefix(arg, "HostKeyAlgorithms="):
+			arg = "HostKeyAlgorithms=" + strings.Join(hostCertAlgorithms(strings.Split(strings.TrimPrefix(arg, "HostKeyAlgorithms="), ",")), ",")
+		case strings.HasPrefix(arg, "UserKnownHostsFile="):
+			arg = fmt.Sprintf("UserKnownHostsFile=%q", ca.KnownHostsPath)
+		case strings.HasPrefix(arg, "HostKeyAlias="):
+			// The principals are checked against the address.
+			if len(args) > 0 && args[len(args)-1] == "-o" {
+				args = args[:len(args)-1]
+			}
+			continue
+		}
+		args = append(args, arg)
+	}
+	if !containsPrefix(args, "UserKnownHostsFile=") {
+		return errors.New("the external SSH client does not verify host keys")
+	}
+	client.BaseArgs = args
+	return nil
+}
+
+func containsPrefix(values []string, prefix string) bool {
+	for _, v := range values {
+		if strings.HasPrefix(v, prefix) {
+			return true
+		}
+	}
+	return false
+}
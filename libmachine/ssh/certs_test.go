@@ -0,0 +1,182 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rancher/machine/libmachine/fips"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// generateKey generates an Ed25519 key pair at path.
+func generateKey(t *testing.T, path string) ssh.Signer {
+	assert.NoError(t, GenerateSSHKeyOfType(path, KeyTypeEd25519))
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.ParsePrivateKey(pem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func (s *testServer) clientWithKey(t *testing.T, keyPath string) *NativeClient {
+	host, port, err := net.SplitHostPort(s.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := strconv.Atoi(port)
+
+	client, err := NewNativeClient("docker", host, p, &Auth{Keys: []string{keyPath}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client.(*NativeClient)
+}
+
+func TestRenewUserCert(t *testing.T) {
+	if fips.Enabled() {
+		t.Skip("the keys are Ed25519 ones")
+	}
+
+	dir := t.TempDir()
+	ca := generateKey(t, filepath.Join(dir, "user-ca"))
+	keyPath := filepath.Join(dir, "id_ed25519")
+	key := generateKey(t, keyPath)
+	signer := &FileUserCertSigner{KeyPath: filepath.Join(dir, "user-ca"), Validity: 10 * time.Minute}
+
+	assert.NoError(t, RenewUserCert(signer, keyPath, "default", "docker"))
+	cert, err := readUserCert(keyPath)
+	if !assert.NoError(t, err) || !assert.NotNil(t, cert) {
+		return
+	}
+	assert.Equal(t, uint32(ssh.UserCert), cert.CertType)
+	assert.Equal(t, "default", cert.KeyId)
+	assert.Equal(t, []string{"docker"}, cert.ValidPrincipals)
+	assert.Equal(t, key.PublicKey().Marshal(), cert.Key.Marshal())
+	assert.Equal(t, ca.PublicKey().Marshal(), cert.SignatureKey.Marshal())
+
+	// The certificate is valid for a while still.
+	content, _ := os.ReadFile(UserCertPath(keyPath))
+	assert.NoError(t, RenewUserCert(signer, keyPath, "default", "docker"))
+	renewed, _ := os.ReadFile(UserCertPath(keyPath))
+	assert.Equal(t, content, renewed)
+
+	// Not for another user, nor once it is about to expire.
+	assert.NoError(t, RenewUserCert(signer, keyPath, "default", "root"))
+	renewed, _ = os.ReadFile(UserCertPath(keyPath))
+	assert.NotEqual(t, content, renewed)
+
+	signer.Validity = time.Minute
+	assert.NoError(t, RenewUserCert(signer, keyPath, "default", "docker"))
+	content, _ = os.ReadFile(UserCertPath(keyPath))
+	assert.NoError(t, RenewUserCert(signer, keyPath, "default", "docker"))
+	renewed, _ = os.ReadFile(UserCertPath(keyPath))
+	assert.NotEqual(t, content, renewed)
+}
+
+func TestNativeClientUserCert(t *testing.T) {
+	if fips.Enabled() {
+		t.Skip("the keys are Ed25519 ones")
+	}
+
+	dir := t.TempDir()
+	ca := generateKey(t, filepath.Join(dir, "user-ca"))
+	keyPath := filepath.Join(dir, "id_ed25519")
+	generateKey(t, keyPath)
+
+	server := newTestServer(t)
+	// Like sshd with TrustedUserCAKeys and no authorized keys.
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return bytes.Equal(auth.Marshal(), ca.PublicKey().Marshal())
+		},
+	}
+	server.config.PasswordCallback = nil
+	server.config.PublicKeyCallback = checker.Authenticate
+
+	signer := &FileUserCertSigner{KeyPath: filepath.Join(dir, "user-ca")}
+	assert.NoError(t, RenewUserCert(signer, keyPath, "default", "docker"))
+
+	out, err := server.clientWithKey(t, keyPath).Output("exit 0")
+	assert.NoError(t, err)
+	assert.Equal(t, "ok\n", out)
+}
+
+func TestNativeClientHostCert(t *testing.T) {
+	if fips.Enabled() {
+		t.Skip("the keys are Ed25519 ones")
+	}
+
+	dir := t.TempDir()
+	ca := generateKey(t, filepath.Join(dir, "host-ca"))
+	hostCA := &HostCA{KeyPath: filepath.Join(dir, "host-ca.pub")}
+
+	server := newTestServer(t)
+	client := server.nativeClient(t)
+	assert.NoError(t, client.VerifyHostCert(hostCA))
+
+	// The machine has no host certificate.
+	_, err := client.Output("exit 0")
+	assert.ErrorContains(t, err, "presented a host key without certificate")
+	// The connection is not retried.
+	assert.Equal(t, 1, server.connections())
+
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := &ssh.Certificate{
+		Key:             hostSigner.PublicKey(),
+		CertType:        ssh.HostCert,
+		ValidPrincipals: []string{"127.0.0.1"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	assert.NoError(t, cert.SignCert(rand.Reader, ca))
+	certSigner, err := ssh.NewCertSigner(cert, hostSigner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.config.AddHostKey(certSigner)
+
+	out, err := client.Output("exit 0")
+	assert.NoError(t, err)
+	assert.Equal(t, "ok\n", out)
+}
+
+func TestExternalClientVerifyHostCert(t *testing.T) {
+	if fips.Enabled() {
+		t.Skip("the keys are Ed25519 ones")
+	}
+
+	dir := t.TempDir()
+	ca := generateKey(t, filepath.Join(dir, "host-ca"))
+	hostCA := &HostCA{KeyPath: filepath.Join(dir, "host-ca.pub"), KnownHostsPath: filepath.Join(dir, "default", HostCAKnownHostsFile)}
+
+	client := &ExternalClient{BaseArgs: []string{"-F", "/dev/null", "-o", "LogLevel=quiet", "-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null", "docker@localhost"}}
+	assert.NoError(t, client.VerifyHostCert(hostCA))
+	assert.Equal(t, []string{"-F", "/dev/null", "-o", "LogLevel=error", "-o", "StrictHostKeyChecking=yes", "-o", `UserKnownHostsFile="` + hostCA.KnownHostsPath + `"`, "docker@localhost"}, client.BaseArgs)
+
+	content, err := os.ReadFile(hostCA.KnownHostsPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "@cert-authority * "+string(ssh.MarshalAuthorizedKey(ca.PublicKey())), string(content))
+}
+
+func TestHostCertAlgorithms(t *testing.T) {
+	assert.Equal(t, []string{ssh.CertAlgoECDSA256v01, ssh.CertAlgoRSASHA256v01}, hostCertAlgorithms([]string{ssh.KeyAlgoECDSA256, ssh.KeyAlgoRSASHA256}))
+	assert.Nil(t, hostCertAlgorithms(nil))
+}
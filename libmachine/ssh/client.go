@@ -1,6 +1,7 @@
 package ssh
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -11,8 +12,8 @@ import (
 	"strings"
 
 	"github.com/docker/docker/pkg/term"
+	"github.com/rancher/machine/libmachine/fips"
 	"github.com/rancher/machine/libmachine/log"
-	"github.com/rancher/machine/libmachine/mcnutils"
 	"github.com/rancher/machine/libmachine/util"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/terminal"
@@ -33,12 +34,29 @@ type Client interface {
 	// Wait waits for the command started by the Start function to exit. The
 	// returned error follows the same logic as in the exec.Cmd.Wait function.
 	Wait() error
+
+	// Upload writes content to the file at path on the machine, with the
+	// attributes.
+	Upload(content io.Reader, path string, attrs FileAttributes) error
+
+	// Download copies the file at path on the machine to w.
+	Download(path string, w io.Writer) error
+}
+
+// InputClient is a Client able to feed the standard input of the commands it
+// runs.
+type InputClient interface {
+	Client
+	OutputWithInput(command string, input io.Reader) (string, error)
 }
 
 type ExternalClient struct {
 	BaseArgs   []string
 	BinaryPath string
 	cmd        *exec.Cmd
+	// user and host are the destination of the client, which scp takes in
+	// another form than ssh.
+	user, host string
 }
 
 type NativeClient struct {
@@ -47,11 +65,23 @@ type NativeClient struct {
 	Port        int
 	openSession *ssh.Session
 	openClient  *ssh.Client
+	// Bastion is the jump host the connections go through, if any.
+	Bastion *Bastion
+	// sharedKey identifies the connection shared with other clients, if
+	// any, see NewSharedClient.
+	sharedKey string
+	// forwardAgent tells whether the shells forward the ssh-agent.
+	forwardAgent bool
+	// dialPolicy retries the dials, DefaultRetryPolicy when nil.
+	dialPolicy *RetryPolicy
 }
 
 type Auth struct {
 	Passwords []string
 	Keys      []string
+	// Prompt makes the native client ask the password on the terminal, when
+	// there are no Passwords.
+	Prompt bool
 }
 
 type ClientType string
@@ -95,37 +125,59 @@ func SetDefaultClient(clientType ClientType) {
 }
 
 func NewClient(user string, host string, port int, auth *Auth) (Client, error) {
+	return NewBastionClient(user, host, port, auth, nil)
+}
+
+// NewBastionClient is like NewClient, but the returned client reaches the
+// host through the bastion, unless it is nil.
+func NewBastionClient(user string, host string, port int, auth *Auth, bastion *Bastion) (Client, error) {
+	// The ssh binary cannot be given a password.
+	if len(auth.Passwords) > 0 || auth.Prompt {
+		log.Debug("Authenticating with a password, using native Go implementation")
+		client, err := newNativeClient(user, host, port, auth, bastion)
+		log.Debug(client)
+		return client, err
+	}
+
 	sshBinaryPath, err := exec.LookPath("ssh")
 	if err != nil {
 		log.Debug("SSH binary not found, using native Go implementation")
-		client, err := NewNativeClient(user, host, port, auth)
+		client, err := newNativeClient(user, host, port, auth, bastion)
 		log.Debug(client)
 		return client, err
 	}
 
 	if defaultClientType == Native {
 		log.Debug("Using SSH client type: native")
-		client, err := NewNativeClient(user, host, port, auth)
+		client, err := newNativeClient(user, host, port, auth, bastion)
 		log.Debug(client)
 		return client, err
 	}
 
 	log.Debug("Using SSH client type: external")
-	client, err := NewExternalClient(sshBinaryPath, user, host, port, auth)
+	client, err := newExternalClient(sshBinaryPath, user, host, port, auth, bastion)
 	log.Debug(client)
 	return client, err
 }
 
 func NewNativeClient(user, host string, port int, auth *Auth) (Client, error) {
+	return newNativeClient(user, host, port, auth, nil)
+}
+
+func newNativeClient(user, host string, port int, auth *Auth, bastion *Bastion) (Client, error) {
 	config, err := NewNativeConfig(user, auth)
 	if err != nil {
 		return nil, fmt.Errorf("Error getting config for native Go SSH: %s", err)
 	}
+	if auth.Prompt && len(auth.Passwords) == 0 {
+		config.Auth = append(config.Auth, promptAuthMethods(user, host)...)
+	}
 
 	return &NativeClient{
 		Config:   config,
 		Hostname: host,
 		Port:     port,
+		Bastion:  bastion,
 	}, nil
 }
 
@@ -144,25 +196,73 @@ func NewNativeConfig(user string, auth *Auth) (ssh.ClientConfig, error) {
 		if err != nil {
 			return ssh.ClientConfig{}, err
 		}
+		if fips.Enabled() {
+			if err := checkFIPSKey(k, privateKey.PublicKey()); err != nil {
+				return ssh.ClientConfig{}, err
+			}
+		}
+
+		// Like the ssh binary, offer the certificate of the key first.
+		signers := []ssh.Signer{privateKey}
+		cert, err := certSigner(k, privateKey)
+		if err != nil {
+			return ssh.ClientConfig{}, err
+		}
+		if cert != nil {
+			signers = append([]ssh.Signer{cert}, signers...)
+		}
 
-		authMethods = append(authMethods, ssh.PublicKeys(privateKey))
+		authMethods = append(authMethods, ssh.PublicKeys(signers...))
+	}
+
+	// Like the external client, use the identities offered by the ssh-agent
+	// when none are explicitly provided.
+	if socket := agentSocket(); len(auth.Keys) == 0 && socket != "" {
+		authMethods = append(authMethods, agentAuthMethod(socket))
 	}
 
 	for _, p := range auth.Passwords {
 		authMethods = append(authMethods, ssh.Password(p))
 	}
+	// The machines not accepting passwords may ask for them interactively.
+	if len(auth.Passwords) > 0 {
+		authMethods = append(authMethods, ssh.KeyboardInteractive(passwordChallenge(func() (string, error) {
+			return auth.Passwords[0], nil
+		})))
+	}
 
-	return ssh.ClientConfig{
+	config := ssh.ClientConfig{
 		User:            user,
 		Auth:            authMethods,
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-	}, nil
+	}
+	if fips.Enabled() {
+		restrictFIPSConfig(&config)
+	}
+	return config, nil
 }
 
-func (client *NativeClient) dialSuccess() bool {
-	conn, err := ssh.Dial("tcp", net.JoinHostPort(client.Hostname, strconv.Itoa(client.Port)), &client.Config)
+func (client *NativeClient) address() string {
+	return net.JoinHostPort(client.Hostname, strconv.Itoa(client.Port))
+}
+
+// dialSuccess tells whether the client can connect to the machine, setting
+// the error in dialErr otherwise. A host key that changed or a host
+// certificate rejected, or algorithms the machine rejects, are not waited on,
+// but set in fatalErr.
+func (client *NativeClient) dialSuccess(fatalErr, dialErr *error) bool {
+	conn, err := dialSSH(client.address(), &client.Config, client.Bastion)
 	if err != nil {
 		log.Debugf("Error dialing TCP: %s", err)
+		*dialErr = err
+		if errors.As(err, &ErrHostKeyChanged{}) || errors.As(err, &ErrHostCertRejected{}) {
+			*fatalErr = err
+			return true
+		}
+		if algorithmsErr := noCommonAlgorithmError(err); algorithmsErr != nil {
+			*fatalErr = algorithmsErr
+			return true
+		}
 		return false
 	}
 	closeConn(conn)
@@ -170,11 +270,28 @@ func (client *NativeClient) dialSuccess() bool {
 }
 
 func (client *NativeClient) session(command string) (*ssh.Client, *ssh.Session, error) {
-	if err := mcnutils.WaitFor(client.dialSuccess); err != nil {
-		return nil, nil, fmt.Errorf("Error attempting SSH client dial: %s", err)
+	if client.sharedKey != "" {
+		return client.sharedSession()
+	}
+
+	return client.dial()
+}
+
+func (client *NativeClient) dial() (*ssh.Client, *ssh.Session, error) {
+	policy := DefaultRetryPolicy
+	if client.dialPolicy != nil {
+		policy = *client.dialPolicy
+	}
+
+	var fatalErr, dialErr error
+	if err := policy.WaitFor(func() bool { return client.dialSuccess(&fatalErr, &dialErr) }); err != nil {
+		return nil, nil, fmt.Errorf("Error attempting SSH client dial: %s: %s", err, dialErr)
+	}
+	if fatalErr != nil {
+		return nil, nil, fatalErr
 	}
 
-	conn, err := ssh.Dial("tcp", net.JoinHostPort(client.Hostname, strconv.Itoa(client.Port)), &client.Config)
+	conn, err := dialSSH(client.address(), &client.Config, client.Bastion)
 	if err != nil {
 		return nil, nil, fmt.Errorf("Mysterious error dialing TCP for SSH (we already succeeded at least once) : %s", err)
 	}
@@ -186,11 +303,27 @@ func (client *NativeClient) session(command string) (*ssh.Client, *ssh.Session,
 func (client *NativeClient) Output(command string) (string, error) {
 	conn, session, err := client.session(command)
 	if err != nil {
-		return "", nil
+		return "", err
 	}
-	defer closeConn(conn)
+	defer client.release(conn)
+	defer session.Close()
+
+	output, err := session.CombinedOutput(command)
+
+	return string(output), err
+}
+
+// OutputWithInput runs the command with input as its standard input, like to
+// upload a file.
+func (client *NativeClient) OutputWithInput(command string, input io.Reader) (string, error) {
+	conn, session, err := client.session(command)
+	if err != nil {
+		return "", err
+	}
+	defer client.release(conn)
 	defer session.Close()
 
+	session.Stdin = input
 	output, err := session.CombinedOutput(command)
 
 	return string(output), err
@@ -201,7 +334,7 @@ func (client *NativeClient) OutputWithPty(command string) (string, error) {
 	if err != nil {
 		return "", nil
 	}
-	defer closeConn(conn)
+	defer client.release(conn)
 	defer session.Close()
 
 	fd := int(os.Stdout.Fd())
@@ -259,9 +392,11 @@ func (client *NativeClient) Wait() error {
 
 	_ = client.openSession.Close()
 
-	err = client.openClient.Close()
-	if err != nil {
-		return err
+	if client.sharedKey == "" {
+		err = client.openClient.Close()
+		if err != nil {
+			return err
+		}
 	}
 
 	client.openSession = nil
@@ -273,7 +408,7 @@ func (client *NativeClient) Shell(args ...string) error {
 	var (
 		termWidth, termHeight int
 	)
-	conn, err := ssh.Dial("tcp", net.JoinHostPort(client.Hostname, strconv.Itoa(client.Port)), &client.Config)
+	conn, err := dialSSH(client.address(), &client.Config, client.Bastion)
 	if err != nil {
 		return err
 	}
@@ -286,6 +421,16 @@ func (client *NativeClient) Shell(args ...string) error {
 
 	defer session.Close()
 
+	if client.forwardAgent {
+		if socket := agentSocket(); socket != "" {
+			if err := forwardAgent(conn, session, socket); err != nil {
+				return fmt.Errorf("Error forwarding the ssh-agent: %s", err)
+			}
+		} else {
+			log.Warnf("Not forwarding the ssh-agent, %s is not set", agentSocketEnv)
+		}
+	}
+
 	session.Stdout = os.Stdout
 	session.Stderr = os.Stderr
 	session.Stdin = os.Stdin
@@ -333,9 +478,20 @@ func (client *NativeClient) Shell(args ...string) error {
 	return nil
 }
 
+// ForwardAgent makes the shells of the client forward the ssh-agent.
+func (client *NativeClient) ForwardAgent() {
+	client.forwardAgent = true
+}
+
 func NewExternalClient(sshBinaryPath, user, host string, port int, auth *Auth) (*ExternalClient, error) {
+	return newExternalClient(sshBinaryPath, user, host, port, auth, nil)
+}
+
+func newExternalClient(sshBinaryPath, user, host string, port int, auth *Auth, bastion *Bastion) (*ExternalClient, error) {
 	client := &ExternalClient{
 		BinaryPath: sshBinaryPath,
+		user:       user,
+		host:       host,
 	}
 	var args []string
 	// http proxy should be used for the SSH connection
@@ -349,10 +505,17 @@ func NewExternalClient(sshBinaryPath, user, host string, port int, auth *Auth) (
 	}
 	ncBinaryPath, _ := exec.LookPath("nc")
 	log.Debugf("proxy_url: %s; ncBinaryPath: %s", proxy_url, ncBinaryPath)
-	if proxy_url != "" && ncBinaryPath != "" {
-		args = append(baseSSHArgs, "-o", fmt.Sprintf(SSHProxyArg, ncBinaryPath, proxy_url), fmt.Sprintf("%s@%s", user, host))
+	if bastion != nil {
+		// the http proxy, if any, is the concern of the bastion
+		args = append(externalBaseArgs(), "-o", bastionProxyCommand(sshBinaryPath, bastion), fmt.Sprintf("%s@%s", user, host))
+	} else if proxy_url != "" && ncBinaryPath != "" {
+		args = append(externalBaseArgs(), "-o", fmt.Sprintf(SSHProxyArg, ncBinaryPath, proxy_url), fmt.Sprintf("%s@%s", user, host))
 	} else {
-		args = append(baseSSHArgs, fmt.Sprintf("%s@%s", user, host))
+		args = append(externalBaseArgs(), fmt.Sprintf("%s@%s", user, host))
+	}
+
+	if fips.Enabled() {
+		args = append(args, fipsExternalArgs()...)
 	}
 
 	// If no identities are explicitly provided, also look at the identities
@@ -382,6 +545,11 @@ func NewExternalClient(sshBinaryPath, user, host string, port int, auth *Auth) (
 					return nil, fmt.Errorf("permissions %#o for '%s' are too open", perm, privateKeyPath)
 				}
 			}
+			if fips.Enabled() {
+				if err := checkFIPSKeyFile(privateKeyPath); err != nil {
+					return nil, err
+				}
+			}
 			args = append(args, "-i", privateKeyPath)
 		}
 	}
@@ -394,11 +562,30 @@ func NewExternalClient(sshBinaryPath, user, host string, port int, auth *Auth) (
 	return client, nil
 }
 
+// ForwardAgent makes the client forward the ssh-agent, in its shells as in
+// its commands.
+func (client *ExternalClient) ForwardAgent() {
+	client.BaseArgs = append(client.BaseArgs, "-A")
+}
+
+// externalBaseArgs returns a copy of the base arguments of the external
+// client, with the keepalive interval set.
+func externalBaseArgs() []string {
+	args := make([]string, len(baseSSHArgs))
+	for i, arg := range baseSSHArgs {
+		if strings.HasPrefix(arg, "ServerAliveInterval=") {
+			arg = keepAliveArg()
+		}
+		args[i] = arg
+	}
+	return args
+}
+
 func getSSHCmd(binaryPath string, args ...string) *exec.Cmd {
 	// remove the quote to avoid parsing errors
 	for i, arg := range args {
 		if strings.HasPrefix(arg, "ProxyCommand='") {
-			args[i] = strings.ReplaceAll(arg, "'", "")
+			args[i] = "ProxyCommand=" + strings.TrimSuffix(strings.TrimPrefix(arg, "ProxyCommand='"), "'")
 			break
 		}
 	}
@@ -412,6 +599,16 @@ func (client *ExternalClient) Output(command string) (string, error) {
 	return string(output), err
 }
 
+// OutputWithInput runs the command with input as its standard input, like to
+// upload a file.
+func (client *ExternalClient) OutputWithInput(command string, input io.Reader) (string, error) {
+	args := append(client.BaseArgs, command)
+	cmd := getSSHCmd(client.BinaryPath, args...)
+	cmd.Stdin = input
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
 func (client *ExternalClient) Shell(args ...string) error {
 	args = append(client.BaseArgs, args...)
 	cmd := getSSHCmd(client.BinaryPath, args...)
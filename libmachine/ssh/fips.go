@@ -0,0 +1,75 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rancher/machine/libmachine/fips"
+	"golang.org/x/crypto/ssh"
+)
+
+// The FIPS-approved SSH algorithms, the ones of the clients in the FIPS mode.
+var (
+	fipsCiphers = []string{
+		"aes128-gcm@openssh.com", "aes256-gcm@openssh.com",
+		"aes128-ctr", "aes192-ctr", "aes256-ctr",
+	}
+	fipsKeyExchanges = []string{
+		"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+		"diffie-hellman-group14-sha256",
+	}
+	fipsMACs = []string{
+		"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com",
+		"hmac-sha2-256", "hmac-sha2-512",
+	}
+	fipsHostKeyAlgorithms = []string{
+		ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+		ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSASHA512,
+	}
+)
+
+// restrictFIPSConfig restricts the algorithms of the native config to the
+// approved ones.
+func restrictFIPSConfig(config *ssh.ClientConfig) {
+	config.Ciphers = fipsCiphers
+	config.KeyExchanges = fipsKeyExchanges
+	config.MACs = fipsMACs
+	config.HostKeyAlgorithms = fipsHostKeyAlgorithms
+}
+
+// fipsExternalArgs returns the options restricting the algorithms of the
+// external client to the approved ones.
+func fipsExternalArgs() []string {
+	return []string{
+		"-o", "Ciphers=" + strings.Join(fipsCiphers, ","),
+		"-o", "KexAlgorithms=" + strings.Join(fipsKeyExchanges, ","),
+		"-o", "MACs=" + strings.Join(fipsMACs, ","),
+		"-o", "HostKeyAlgorithms=" + strings.Join(fipsHostKeyAlgorithms, ","),
+	}
+}
+
+// checkFIPSKey fails when the public key is not approved.
+func checkFIPSKey(name string, key ssh.PublicKey) error {
+	cryptoKey, ok := key.(ssh.CryptoPublicKey)
+	if !ok {
+		return fmt.Errorf("the SSH key %s is not FIPS-approved: %s keys are not supported", name, key.Type())
+	}
+	if err := fips.CheckPublicKey(cryptoKey.CryptoPublicKey()); err != nil {
+		return fmt.Errorf("the SSH key %s is not FIPS-approved: %s", name, err)
+	}
+	return nil
+}
+
+// checkFIPSKeyFile fails when the private key at path is not approved.
+func checkFIPSKeyFile(path string) error {
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return checkFIPSKey(path, signer.PublicKey())
+}
@@ -0,0 +1,55 @@
+package ssh
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/fips"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFIPSKeyGeneration(t *testing.T) {
+	t.Setenv(fips.EnvVar, "1")
+
+	_, err := NewKeyPairOfType(KeyTypeEd25519)
+	assert.EqualError(t, err, "Ed25519 keys are not FIPS-approved, use RSA or ECDSA")
+
+	_, err = NewKeyPairOfType(KeyTypeECDSA)
+	assert.NoError(t, err)
+}
+
+func TestFIPSNativeConfig(t *testing.T) {
+	if fips.Enabled() {
+		t.Skip("the keys of the machines created before cannot be generated in the FIPS mode")
+	}
+	dir := t.TempDir()
+	rsaKeyPath := filepath.Join(dir, "id_rsa")
+	assert.NoError(t, GenerateSSHKeyOfType(rsaKeyPath, KeyTypeRSA))
+	edKeyPath := filepath.Join(dir, "id_ed25519")
+	assert.NoError(t, GenerateSSHKeyOfType(edKeyPath, KeyTypeEd25519))
+
+	t.Setenv(fips.EnvVar, "1")
+
+	config, err := NewNativeConfig("docker", &Auth{Keys: []string{rsaKeyPath}})
+	assert.NoError(t, err)
+	assert.Equal(t, fipsCiphers, config.Ciphers)
+	assert.Equal(t, fipsKeyExchanges, config.KeyExchanges)
+	assert.Equal(t, fipsMACs, config.MACs)
+	assert.Equal(t, fipsHostKeyAlgorithms, config.HostKeyAlgorithms)
+
+	// The keys of the machines created before are refused.
+	_, err = NewNativeConfig("docker", &Auth{Keys: []string{edKeyPath}})
+	assert.EqualError(t, err, "the SSH key "+edKeyPath+" is not FIPS-approved: Ed25519 keys are not FIPS-approved, use RSA or ECDSA")
+
+	_, err = newExternalClient("/usr/bin/ssh", "docker", "localhost", 22, &Auth{Keys: []string{edKeyPath}}, nil)
+	assert.Error(t, err)
+}
+
+func TestFIPSExternalClient(t *testing.T) {
+	t.Setenv(fips.EnvVar, "1")
+
+	client, err := newExternalClient("/usr/bin/ssh", "docker", "localhost", 22, &Auth{}, nil)
+	assert.NoError(t, err)
+	assert.Contains(t, client.BaseArgs, "Ciphers=aes128-gcm@openssh.com,aes256-gcm@openssh.com,aes128-ctr,aes192-ctr,aes256-ctr")
+	assert.Contains(t, client.BaseArgs, "MACs=hmac-sha2-256-etm@openssh.com,hmac-sha2-512-etm@openssh.com,hmac-sha2-256,hmac-sha2-512")
+}
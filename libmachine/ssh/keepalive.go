@@ -0,0 +1,104 @@
+package ssh
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rancher/machine/libmachine/log"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// DefaultKeepAliveInterval is the interval of the keepalives sent on
+	// the SSH connections.
+	DefaultKeepAliveInterval = 60 * time.Second
+
+	// keepAliveCountMax is the number of keepalives left unanswered before
+	// a connection is closed, the ServerAliveCountMax default of OpenSSH.
+	keepAliveCountMax = 3
+
+	keepAliveRequest = "keepalive@openssh.com"
+)
+
+var keepAlive = struct {
+	sync.RWMutex
+	interval time.Duration
+}{interval: DefaultKeepAliveInterval}
+
+// SetKeepAliveInterval sets the interval of the keepalives sent on the SSH
+// connections, to keep them from being dropped while idle and to detect the
+// machines which stopped answering. Zero disables them.
+func SetKeepAliveInterval(interval time.Duration) {
+	keepAlive.Lock()
+	defer keepAlive.Unlock()
+	keepAlive.interval = interval
+}
+
+func keepAliveInterval() time.Duration {
+	keepAlive.RLock()
+	defer keepAlive.RUnlock()
+	return keepAlive.interval
+}
+
+// keepAliveArg returns the option making the external client send the
+// keepalives.
+func keepAliveArg() string {
+	seconds := int(keepAliveInterval().Seconds())
+	if seconds < 0 {
+		seconds = 0
+	}
+	return fmt.Sprintf("ServerAliveInterval=%d", seconds)
+}
+
+// sendKeepAlives sends keepalives on conn until it is closed, the way the
+// ServerAliveInterval option of OpenSSH does, and closes it once
+// keepAliveCountMax of them went unanswered, for the commands using it to
+// fail rather than hang on a machine that went away.
+func sendKeepAlives(conn ssh.Conn) {
+	interval := keepAliveInterval()
+	if interval <= 0 {
+		return
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		_ = conn.Wait()
+		close(closed)
+	}()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		// A single keepalive is pending at a time, so the goroutine sending
+		// it never blocks on replies.
+		replies := make(chan error, 1)
+		pending, missed := false, 0
+		for {
+			select {
+			case <-closed:
+				return
+			case err := <-replies:
+				if err != nil {
+					return
+				}
+				pending, missed = false, 0
+			case <-ticker.C:
+				if pending {
+					if missed++; missed >= keepAliveCountMax {
+						log.Debugf("Closing the SSH connection to %s, %d keepalives went unanswered", conn.RemoteAddr(), missed)
+						closeConn(conn)
+						return
+					}
+					continue
+				}
+				pending = true
+				go func() {
+					_, _, err := conn.SendRequest(keepAliveRequest, true, nil)
+					replies <- err
+				}()
+			}
+		}
+	}()
+}
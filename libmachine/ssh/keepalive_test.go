@@ -0,0 +1,106 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// serveUnresponsive serves SSH connections which never answer the requests
+// sent on them, like a machine that went away would.
+func serveUnresponsive(t *testing.T) string {
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				go func() {
+					for range reqs {
+					}
+				}()
+				for newChannel := range chans {
+					newChannel.Reject(ssh.Prohibited, "no channels")
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func withKeepAliveInterval(t *testing.T, interval time.Duration) {
+	SetKeepAliveInterval(interval)
+	t.Cleanup(func() { SetKeepAliveInterval(DefaultKeepAliveInterval) })
+}
+
+func TestKeepAlivesCloseUnresponsiveConnections(t *testing.T) {
+	withKeepAliveInterval(t, 10*time.Millisecond)
+
+	conn, err := dialSSH(serveUnresponsive(t), &ssh.ClientConfig{User: "docker", HostKeyCallback: ssh.InsecureIgnoreHostKey()}, nil)
+	assert.NoError(t, err)
+
+	closed := make(chan error, 1)
+	go func() { closed <- conn.Wait() }()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the unresponsive connection was not closed")
+	}
+}
+
+func TestKeepAlivesKeepAnsweredConnections(t *testing.T) {
+	withKeepAliveInterval(t, 10*time.Millisecond)
+
+	client := newTestServer(t).nativeClient(t)
+	conn, err := dialSSH(client.address(), &client.Config, nil)
+	assert.NoError(t, err)
+	defer closeConn(conn)
+
+	time.Sleep(20 * keepAliveCountMax * time.Millisecond)
+
+	session, err := conn.NewSession()
+	assert.NoError(t, err)
+	session.Close()
+}
+
+func TestExternalClientKeepAliveInterval(t *testing.T) {
+	withKeepAliveInterval(t, 15*time.Second)
+
+	client, err := newExternalClient("/usr/bin/ssh", "docker", "localhost", 22, &Auth{}, nil)
+	assert.NoError(t, err)
+	assert.Contains(t, client.BaseArgs, "ServerAliveInterval=15")
+	assert.Contains(t, baseSSHArgs, "ServerAliveInterval=60")
+
+	SetKeepAliveInterval(0)
+	client, err = newExternalClient("/usr/bin/ssh", "docker", "localhost", 22, &Auth{}, nil)
+	assert.NoError(t, err)
+	assert.Contains(t, client.BaseArgs, "ServerAliveInterval=0")
+}
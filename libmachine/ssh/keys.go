@@ -1,6 +1,9 @@
 package ssh
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/md5"
 	"crypto/rand"
 	"crypto/rsa"
@@ -13,6 +16,7 @@ import (
 	"os"
 	"runtime"
 
+	"github.com/rancher/machine/libmachine/fips"
 	gossh "golang.org/x/crypto/ssh"
 )
 
@@ -23,26 +27,99 @@ var (
 	ErrUnableToWriteFile = errors.New("Unable to write file")
 )
 
+// KeyType is the algorithm of an SSH key pair.
+type KeyType string
+
+const (
+	KeyTypeRSA     KeyType = "rsa"
+	KeyTypeECDSA   KeyType = "ecdsa"
+	KeyTypeEd25519 KeyType = "ed25519"
+)
+
+// KeyTypes are the types of the key pairs NewKeyPairOfType generates.
+var KeyTypes = []KeyType{KeyTypeRSA, KeyTypeECDSA, KeyTypeEd25519}
+
+// ParseKeyType parses the type of an SSH key pair, RSA when empty.
+func ParseKeyType(s string) (KeyType, error) {
+	if s == "" {
+		return KeyTypeRSA, nil
+	}
+	for _, keyType := range KeyTypes {
+		if KeyType(s) == keyType {
+			return keyType, nil
+		}
+	}
+	return "", fmt.Errorf("invalid SSH key type %q, must be one of rsa, ecdsa, ed25519", s)
+}
+
 type KeyPair struct {
 	PrivateKey []byte
 	PublicKey  []byte
+	// Type is the algorithm of the key pair, RSA when empty.
+	Type KeyType
 }
 
 // NewKeyPair generates a new SSH keypair
 // This will return a private & public key encoded as DER.
 func NewKeyPair() (keyPair *KeyPair, err error) {
-	priv, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		return nil, ErrKeyGeneration
+	return NewKeyPairOfType(KeyTypeRSA)
+}
+
+// NewKeyPairOfType generates a new SSH keypair of the type. The private key
+// is encoded as DER, in the OpenSSH format for Ed25519 keys.
+func NewKeyPairOfType(keyType KeyType) (*KeyPair, error) {
+	var (
+		priv, pub interface{}
+		privDer   []byte
+	)
+
+	switch keyType {
+	case "", KeyTypeRSA:
+		rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, ErrKeyGeneration
+		}
+		if err := rsaKey.Validate(); err != nil {
+			return nil, ErrValidation
+		}
+		priv, pub = rsaKey, &rsaKey.PublicKey
+		privDer = x509.MarshalPKCS1PrivateKey(rsaKey)
+	case KeyTypeECDSA:
+		ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, ErrKeyGeneration
+		}
+		if privDer, err = x509.MarshalECPrivateKey(ecKey); err != nil {
+			return nil, ErrKeyGeneration
+		}
+		priv, pub = ecKey, &ecKey.PublicKey
+	case KeyTypeEd25519:
+		edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, ErrKeyGeneration
+		}
+		block, err := gossh.MarshalPrivateKey(edKey, "")
+		if err != nil {
+			return nil, ErrKeyGeneration
+		}
+		priv, pub = edKey, edPub
+		privDer = block.Bytes
+	default:
+		return nil, fmt.Errorf("invalid SSH key type %q", keyType)
 	}
 
-	if err := priv.Validate(); err != nil {
-		return nil, ErrValidation
+	if fips.Enabled() {
+		if err := fips.CheckPublicKey(pub); err != nil {
+			return nil, err
+		}
 	}
 
-	privDer := x509.MarshalPKCS1PrivateKey(priv)
+	// The private key is checked to sign with the public one.
+	if _, err := gossh.NewSignerFromKey(priv); err != nil {
+		return nil, ErrValidation
+	}
 
-	pubSSH, err := gossh.NewPublicKey(&priv.PublicKey)
+	pubSSH, err := gossh.NewPublicKey(pub)
 	if err != nil {
 		return nil, ErrPublicKey
 	}
@@ -50,9 +127,21 @@ func NewKeyPair() (keyPair *KeyPair, err error) {
 	return &KeyPair{
 		PrivateKey: privDer,
 		PublicKey:  gossh.MarshalAuthorizedKey(pubSSH),
+		Type:       keyType,
 	}, nil
 }
 
+// pemType returns the type of the PEM block of the private key.
+func (kp *KeyPair) pemType() string {
+	switch kp.Type {
+	case KeyTypeECDSA:
+		return "EC PRIVATE KEY"
+	case KeyTypeEd25519:
+		return "OPENSSH PRIVATE KEY"
+	}
+	return "RSA PRIVATE KEY"
+}
+
 // WriteToFile writes keypair to files
 func (kp *KeyPair) WriteToFile(privateKeyPath string, publicKeyPath string) error {
 	files := []struct {
@@ -62,7 +151,7 @@ func (kp *KeyPair) WriteToFile(privateKeyPath string, publicKeyPath string) erro
 	}{
 		{
 			File:  privateKeyPath,
-			Value: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Headers: nil, Bytes: kp.PrivateKey}),
+			Value: pem.EncodeToMemory(&pem.Block{Type: kp.pemType(), Headers: nil, Bytes: kp.PrivateKey}),
 		},
 		{
 			File:  publicKeyPath,
@@ -105,12 +194,18 @@ func (kp *KeyPair) Fingerprint() string {
 // GenerateSSHKey generates SSH keypair based on path of the private key
 // The public key would be generated to the same path with ".pub" added
 func GenerateSSHKey(path string) error {
+	return GenerateSSHKeyOfType(path, KeyTypeRSA)
+}
+
+// GenerateSSHKeyOfType generates an SSH keypair of the type like
+// GenerateSSHKey.
+func GenerateSSHKeyOfType(path string, keyType KeyType) error {
 	if _, err := os.Stat(path); err != nil {
 		if !os.IsNotExist(err) {
 			return fmt.Errorf("Desired directory for SSH keys does not exist: %s", err)
 		}
 
-		kp, err := NewKeyPair()
+		kp, err := NewKeyPairOfType(keyType)
 		if err != nil {
 			return fmt.Errorf("Error generating key pair: %s", err)
 		}
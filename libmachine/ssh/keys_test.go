@@ -1,8 +1,13 @@
 package ssh
 
 import (
+	"bytes"
 	"encoding/pem"
+	"os"
+	"path/filepath"
 	"testing"
+
+	gossh "golang.org/x/crypto/ssh"
 )
 
 func TestNewKeyPair(t *testing.T) {
@@ -19,3 +24,57 @@ func TestNewKeyPair(t *testing.T) {
 		t.Fatal("Unable to generate fingerprint")
 	}
 }
+
+func TestGenerateSSHKeyOfType(t *testing.T) {
+	for keyType, algorithm := range map[KeyType]string{
+		KeyTypeRSA:     gossh.KeyAlgoRSA,
+		KeyTypeECDSA:   gossh.KeyAlgoECDSA256,
+		KeyTypeEd25519: gossh.KeyAlgoED25519,
+	} {
+		path := filepath.Join(t.TempDir(), "id_"+string(keyType))
+		if err := GenerateSSHKeyOfType(path, keyType); err != nil {
+			t.Fatal(err)
+		}
+
+		privateKey, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer, err := gossh.ParsePrivateKey(privateKey)
+		if err != nil {
+			t.Fatalf("%s: %s", keyType, err)
+		}
+
+		publicKey, err := os.ReadFile(path + ".pub")
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, _, _, _, err := gossh.ParseAuthorizedKey(publicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pub.Type() != algorithm {
+			t.Errorf("%s: got a %s public key", keyType, pub.Type())
+		}
+		if !bytes.Equal(pub.Marshal(), signer.PublicKey().Marshal()) {
+			t.Errorf("%s: the public key does not match the private key", keyType)
+		}
+
+		// The native client loads the keys of every type.
+		if _, err := NewNativeConfig("root", &Auth{Keys: []string{path}}); err != nil {
+			t.Errorf("%s: %s", keyType, err)
+		}
+	}
+}
+
+func TestParseKeyType(t *testing.T) {
+	for s, want := range map[string]KeyType{"": KeyTypeRSA, "rsa": KeyTypeRSA, "ecdsa": KeyTypeECDSA, "ed25519": KeyTypeEd25519} {
+		if keyType, err := ParseKeyType(s); err != nil || keyType != want {
+			t.Errorf("ParseKeyType(%q) = %q, %v, want %q", s, keyType, err, want)
+		}
+	}
+
+	if _, err := ParseKeyType("dsa"); err == nil {
+		t.Error("expected an error for dsa keys")
+	}
+}
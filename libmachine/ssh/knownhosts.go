@@ -0,0 +1,212 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/rancher/machine/libmachine/log"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// KnownHostsFile is the name of the known_hosts file in the directory of a
+// machine.
+const KnownHostsFile = "known_hosts"
+
+// knownHostsLock serializes the updates of the known_hosts files.
+var knownHostsLock sync.Mutex
+
+// KnownHosts is the known_hosts file holding the host key of a machine. The
+// key is recorded under the alias of the machine the first time it is
+// connected to, like when it is provisioned, and verified afterwards,
+// whatever its address.
+type KnownHosts struct {
+	Path  string
+	Alias string
+}
+
+// HostKeyVerifyingClient is a Client able to verify the host key of the
+// machine against its known_hosts file.
+type HostKeyVerifyingClient interface {
+	Client
+	// VerifyHostKey makes the client verify the host key of the machine,
+	// recording it in knownHosts if there is none yet.
+	VerifyHostKey(knownHosts *KnownHosts)
+}
+
+// ErrHostKeyChanged is returned when the host key of a machine is not the
+// one recorded in its known_hosts file.
+type ErrHostKeyChanged struct {
+	Alias string
+	Path  string
+}
+
+func (e ErrHostKeyChanged) Error() string {
+	return fmt.Sprintf("the SSH host key of %s does not match the one recorded in %s, which may be a man-in-the-middle attack. If the machine was recreated, refresh it with: ssh --refresh-hostkey %s", e.Alias, e.Path, e.Alias)
+}
+
+// keys returns the host keys recorded for the machine.
+func (kh *KnownHosts) keys() ([]ssh.PublicKey, error) {
+	content, err := os.ReadFile(kh.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []ssh.PublicKey
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		_, hosts, key, _, _, err := ssh.ParseKnownHosts(scanner.Bytes())
+		if err != nil {
+			continue
+		}
+		for _, host := range hosts {
+			if host == kh.Alias {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys, scanner.Err()
+}
+
+// known tells whether a host key is recorded for the machine.
+func (kh *KnownHosts) known() bool {
+	keys, err := kh.keys()
+	if err != nil {
+		log.Debugf("Error reading the known hosts %s: %s", kh.Path, err)
+	}
+	return len(keys) > 0
+}
+
+// record records the host key of the machine.
+func (kh *KnownHosts) record(key ssh.PublicKey) error {
+	if err := os.MkdirAll(filepath.Dir(kh.Path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(kh.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintln(f, knownhosts.Line([]string{kh.Alias}, key))
+	return err
+}
+
+// Forget removes the host keys recorded for the machine, for the next
+// connection to record the new one.
+func (kh *KnownHosts) Forget() error {
+	knownHostsLock.Lock()
+	defer knownHostsLock.Unlock()
+
+	if err := os.Remove(kh.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// HostKeyCallback returns the callback verifying the host key of the
+// machine, and recording it if there is none yet.
+func (kh *KnownHosts) HostKeyCallback() ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		knownHostsLock.Lock()
+		defer knownHostsLock.Unlock()
+
+		keys, err := kh.keys()
+		if err != nil {
+			return fmt.Errorf("Error reading the known hosts %s: %s", kh.Path, err)
+		}
+
+		if len(keys) == 0 {
+			log.Debugf("Recording the SSH host key %s of %s in %s", ssh.FingerprintSHA256(key), kh.Alias, kh.Path)
+			return kh.record(key)
+		}
+
+		for _, known := range keys {
+			if bytes.Equal(known.Marshal(), key.Marshal()) {
+				return nil
+			}
+		}
+		return ErrHostKeyChanged{Alias: kh.Alias, Path: kh.Path}
+	}
+}
+
+// hostKeyAlgorithms returns the host key algorithms of the keys recorded,
+// for the server to present one of them rather than another key it has.
+func (kh *KnownHosts) hostKeyAlgorithms() []string {
+	keys, err := kh.keys()
+	if err != nil {
+		return nil
+	}
+
+	var algorithms []string
+	for _, key := range keys {
+		if key.Type() == ssh.KeyAlgoRSA {
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA)
+			continue
+		}
+		algorithms = append(algorithms, key.Type())
+	}
+	return algorithms
+}
+
+// VerifyHostKey makes the client verify the host key of the machine,
+// recording it in knownHosts if there is none yet.
+func (client *NativeClient) VerifyHostKey(knownHosts *KnownHosts) {
+	client.Config.HostKeyCallback = knownHosts.HostKeyCallback()
+
+	algorithms := knownHosts.hostKeyAlgorithms()
+	if len(client.Config.HostKeyAlgorithms) > 0 {
+		algorithms = intersect(algorithms, client.Config.HostKeyAlgorithms)
+	}
+	if len(algorithms) > 0 {
+		client.Config.HostKeyAlgorithms = algorithms
+	}
+}
+
+// VerifyHostKey makes the client verify the host key of the machine,
+// recording it in knownHosts if there is none yet.
+func (client *ExternalClient) VerifyHostKey(knownHosts *KnownHosts) {
+	// The ssh binary records the key when it does not know the machine,
+	// and refuses to connect, telling why, when the key changed once it
+	// does.
+	strict, logLevel := "StrictHostKeyChecking=no", "LogLevel=quiet"
+	if knownHosts.known() {
+		strict, logLevel = "StrictHostKeyChecking=yes", "LogLevel=error"
+	}
+
+	args := make([]string, 0, len(client.BaseArgs)+2)
+	for _, arg := range client.BaseArgs {
+		switch arg {
+		case "LogLevel=quiet":
+			arg = logLevel
+		case "StrictHostKeyChecking=no":
+			arg = strict
+		case "UserKnownHostsFile=/dev/null":
+			args = append(args, fmt.Sprintf("UserKnownHostsFile=%q", knownHosts.Path), "-o")
+			arg = fmt.Sprintf("HostKeyAlias=%s", knownHosts.Alias)
+		}
+		args = append(args, arg)
+	}
+	client.BaseArgs = args
+}
+
+func intersect(values, allowed []string) []string {
+	var both []string
+	for _, v := range values {
+		for _, a := range allowed {
+			if v == a {
+				both = append(both, v)
+				break
+			}
+		}
+	}
+	return both
+}
@@ -0,0 +1,84 @@
+package ssh
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/fips"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestKnownHostsRecordsAndVerifiesHostKey(t *testing.T) {
+	if fips.Enabled() {
+		t.Skip("the test server has an Ed25519 host key")
+	}
+
+	server := newTestServer(t)
+	knownHosts := &KnownHosts{Path: filepath.Join(t.TempDir(), KnownHostsFile), Alias: "default"}
+
+	client := server.nativeClient(t)
+	client.VerifyHostKey(knownHosts)
+	_, err := client.Output("exit 0")
+	assert.NoError(t, err)
+
+	content, err := os.ReadFile(knownHosts.Path)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(content), "default ssh-ed25519 "))
+
+	client = server.nativeClient(t)
+	client.VerifyHostKey(knownHosts)
+	_, err = client.Output("exit 0")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ssh-ed25519"}, client.Config.HostKeyAlgorithms)
+}
+
+func TestKnownHostsRejectsChangedHostKey(t *testing.T) {
+	if fips.Enabled() {
+		t.Skip("the test server has an Ed25519 host key")
+	}
+
+	knownHosts := &KnownHosts{Path: filepath.Join(t.TempDir(), KnownHostsFile), Alias: "default"}
+
+	client := newTestServer(t).nativeClient(t)
+	client.VerifyHostKey(knownHosts)
+	_, err := client.Output("exit 0")
+	assert.NoError(t, err)
+
+	// Another server, with another host key, takes the place of the machine.
+	client = newTestServer(t).nativeClient(t)
+	client.VerifyHostKey(knownHosts)
+	_, err = client.Output("exit 0")
+	assert.ErrorContains(t, err, "does not match")
+
+	assert.NoError(t, knownHosts.Forget())
+	client.VerifyHostKey(knownHosts)
+	_, err = client.Output("exit 0")
+	assert.NoError(t, err)
+}
+
+func TestExternalClientVerifyHostKey(t *testing.T) {
+	knownHosts := &KnownHosts{Path: filepath.Join(t.TempDir(), KnownHostsFile), Alias: "default"}
+
+	client := &ExternalClient{BaseArgs: externalBaseArgs()}
+	client.VerifyHostKey(knownHosts)
+	assert.Contains(t, client.BaseArgs, "StrictHostKeyChecking=no")
+	assert.Contains(t, client.BaseArgs, "HostKeyAlias=default")
+	assert.Contains(t, client.BaseArgs, "UserKnownHostsFile=\""+knownHosts.Path+"\"")
+	assert.NotContains(t, client.BaseArgs, "UserKnownHostsFile=/dev/null")
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	publicKey, err := ssh.NewPublicKey(&key.PublicKey)
+	assert.NoError(t, err)
+	assert.NoError(t, knownHosts.record(publicKey))
+
+	client = &ExternalClient{BaseArgs: externalBaseArgs()}
+	client.VerifyHostKey(knownHosts)
+	assert.Contains(t, client.BaseArgs, "StrictHostKeyChecking=yes")
+	assert.Contains(t, client.BaseArgs, "LogLevel=error")
+}
@@ -0,0 +1,76 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// promptedPasswords are the passwords typed on the terminal, by user@host,
+// asked once per run.
+var promptedPasswords = struct {
+	sync.Mutex
+	passwords map[string]string
+}{passwords: map[string]string{}}
+
+// passwordChallenge answers the keyboard-interactive questions the machine
+// asks without echo, like its password, with the password.
+func passwordChallenge(password func() (string, error)) ssh.KeyboardInteractiveChallenge {
+	return func(_, _ string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		for i, question := range questions {
+			if echos[i] {
+				return nil, fmt.Errorf("cannot answer the SSH question %q", question)
+			}
+			p, err := password()
+			if err != nil {
+				return nil, err
+			}
+			answers[i] = p
+		}
+		return answers, nil
+	}
+}
+
+// promptAuthMethods authenticate as user on host with the password asked on
+// the terminal.
+func promptAuthMethods(user, host string) []ssh.AuthMethod {
+	prompt := func() (string, error) {
+		return promptPassword(user, host)
+	}
+	return []ssh.AuthMethod{
+		ssh.PasswordCallback(prompt),
+		ssh.KeyboardInteractive(passwordChallenge(prompt)),
+	}
+}
+
+// promptPassword asks the password of user on host on the terminal, the
+// first time only.
+func promptPassword(user, host string) (string, error) {
+	promptedPasswords.Lock()
+	defer promptedPasswords.Unlock()
+
+	key := user + "@" + host
+	if password, ok := promptedPasswords.passwords[key]; ok {
+		return password, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return "", errors.New("cannot prompt for the SSH password, the standard input is not a terminal")
+	}
+
+	fmt.Fprintf(os.Stderr, "SSH password of %s: ", key)
+	password, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	promptedPasswords.passwords[key] = string(password)
+	return string(password), nil
+}
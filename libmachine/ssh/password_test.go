@@ -0,0 +1,73 @@
+package ssh
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/fips"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestNativeClientKeyboardInteractive(t *testing.T) {
+	if fips.Enabled() {
+		t.Skip("the test server has an Ed25519 host key")
+	}
+
+	server := newTestServer(t)
+	// Like the appliances only asking for the password interactively.
+	server.config.PasswordCallback = nil
+	server.config.KeyboardInteractiveCallback = func(_ ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+		answers, err := challenge("", "", []string{"Password: "}, []bool{false})
+		if err != nil {
+			return nil, err
+		}
+		if len(answers) != 1 || answers[0] != "tcuser" {
+			return nil, errors.New("wrong password")
+		}
+		return nil, nil
+	}
+
+	client := server.nativeClient(t)
+	out, err := client.Output("exit 0")
+	assert.NoError(t, err)
+	assert.Equal(t, "ok\n", out)
+}
+
+func TestPasswordChallenge(t *testing.T) {
+	challenge := passwordChallenge(func() (string, error) { return "tcuser", nil })
+
+	answers, err := challenge("docker", "", []string{"Password: ", "Verification code: "}, []bool{false, false})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tcuser", "tcuser"}, answers)
+
+	_, err = challenge("docker", "", []string{"Username: "}, []bool{true})
+	assert.EqualError(t, err, `cannot answer the SSH question "Username: "`)
+}
+
+func TestNewBastionClientWithPassword(t *testing.T) {
+	client, err := NewBastionClient("docker", "localhost", 22, &Auth{Passwords: []string{"tcuser"}}, nil)
+	assert.NoError(t, err)
+	assert.IsType(t, &NativeClient{}, client)
+
+	client, err = NewBastionClient("docker", "localhost", 22, &Auth{Prompt: true}, nil)
+	assert.NoError(t, err)
+	assert.IsType(t, &NativeClient{}, client)
+	assert.Len(t, client.(*NativeClient).Config.Auth, 2)
+}
+
+func TestPromptPasswordCached(t *testing.T) {
+	promptedPasswords.Lock()
+	promptedPasswords.passwords["docker@192.168.99.100"] = "tcuser"
+	promptedPasswords.Unlock()
+	t.Cleanup(func() {
+		promptedPasswords.Lock()
+		delete(promptedPasswords.passwords, "docker@192.168.99.100")
+		promptedPasswords.Unlock()
+	})
+
+	// The password is not asked again.
+	password, err := promptPassword("docker", "192.168.99.100")
+	assert.NoError(t, err)
+	assert.Equal(t, "tcuser", password)
+}
@@ -0,0 +1,99 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RetryPolicy tells how long to wait for SSH to be available on a machine,
+// short for the cloud VMs booting fast and long for the slow Windows or
+// bare-metal machines.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, unlimited but for
+	// Timeout when zero.
+	MaxAttempts int `json:",omitempty"`
+	// Interval is the delay between the first two attempts, and the
+	// following ones without Multiplier.
+	Interval time.Duration `json:",omitempty"`
+	// Multiplier multiplies the delay after each attempt, for an exponential
+	// backoff up to MaxInterval, when more than 1.
+	Multiplier  float64       `json:",omitempty"`
+	MaxInterval time.Duration `json:",omitempty"`
+	// Timeout is how long to wait in total, unlimited but for MaxAttempts
+	// when zero.
+	Timeout time.Duration `json:",omitempty"`
+}
+
+// DefaultRetryPolicy is the policy of the machines without their own one, and
+// of the dials of the native client without their own one.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 60,
+	Interval:    3 * time.Second,
+}
+
+// retrySleep is swapped out in tests.
+var retrySleep = time.Sleep
+
+// Validate fails when the policy is inconsistent or would wait forever.
+func (p RetryPolicy) Validate() error {
+	switch {
+	case p.MaxAttempts < 0:
+		return fmt.Errorf("the SSH retry attempts must not be negative, got %d", p.MaxAttempts)
+	case p.Interval < 0 || p.MaxInterval < 0 || p.Timeout < 0:
+		return errors.New("the SSH retry durations must not be negative")
+	case p.Multiplier < 0:
+		return fmt.Errorf("the SSH retry multiplier must not be negative, got %g", p.Multiplier)
+	case p.MaxAttempts == 0 && p.Timeout == 0:
+		return errors.New("the SSH retries need a maximum number of attempts or a timeout")
+	}
+	return nil
+}
+
+// WaitFor calls f until it returns true, the attempts run out or the timeout
+// expires.
+func (p RetryPolicy) WaitFor(f func() bool) error {
+	start := time.Now()
+	interval := p.Interval
+	for attempt := 1; ; attempt++ {
+		if f() {
+			return nil
+		}
+
+		if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+			return fmt.Errorf("Maximum number of retries (%d) exceeded", p.MaxAttempts)
+		}
+		if p.Timeout > 0 && time.Since(start)+interval > p.Timeout {
+			return fmt.Errorf("Timed out after %s (%d attempts)", p.Timeout, attempt)
+		}
+
+		retrySleep(interval)
+		interval = p.next(interval)
+	}
+}
+
+// next returns the delay following interval.
+func (p RetryPolicy) next(interval time.Duration) time.Duration {
+	if p.Multiplier <= 1 {
+		return interval
+	}
+
+	next := time.Duration(float64(interval) * p.Multiplier)
+	if p.MaxInterval > 0 && next > p.MaxInterval {
+		next = p.MaxInterval
+	}
+	return next
+}
+
+// DialRetryClient is a Client whose dials to the machine can be retried with
+// another policy than DefaultRetryPolicy.
+type DialRetryClient interface {
+	Client
+	// SetDialRetryPolicy makes the client retry its dials with policy.
+	SetDialRetryPolicy(policy RetryPolicy)
+}
+
+// SetDialRetryPolicy makes the client retry its dials with policy.
+func (client *NativeClient) SetDialRetryPolicy(policy RetryPolicy) {
+	client.dialPolicy = &policy
+}
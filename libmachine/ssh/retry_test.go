@@ -0,0 +1,88 @@
+package ssh
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordSleeps records the delays slept by the retries instead of sleeping.
+func recordSleeps(t *testing.T) *[]time.Duration {
+	var sleeps []time.Duration
+	retrySleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+	t.Cleanup(func() { retrySleep = time.Sleep })
+	return &sleeps
+}
+
+func TestRetryPolicyWaitFor(t *testing.T) {
+	sleeps := recordSleeps(t)
+
+	calls := 0
+	err := RetryPolicy{MaxAttempts: 5, Interval: time.Second}.WaitFor(func() bool {
+		calls++
+		return calls == 3
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []time.Duration{time.Second, time.Second}, *sleeps)
+
+	err = RetryPolicy{MaxAttempts: 2, Interval: time.Second}.WaitFor(func() bool { return false })
+	assert.EqualError(t, err, "Maximum number of retries (2) exceeded")
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	sleeps := recordSleeps(t)
+
+	policy := RetryPolicy{MaxAttempts: 6, Interval: time.Second, Multiplier: 2, MaxInterval: 10 * time.Second}
+	assert.Error(t, policy.WaitFor(func() bool { return false }))
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second}, *sleeps)
+}
+
+func TestRetryPolicyTimeout(t *testing.T) {
+	recordSleeps(t)
+
+	// The sleeps are skipped, so the attempts take the time.
+	policy := RetryPolicy{Interval: time.Millisecond, Timeout: 50 * time.Millisecond}
+	calls := 0
+	err := policy.WaitFor(func() bool {
+		calls++
+		time.Sleep(10 * time.Millisecond)
+		return false
+	})
+	assert.ErrorContains(t, err, "Timed out after 50ms")
+	assert.True(t, calls >= 2 && calls <= 6, "%d attempts", calls)
+}
+
+func TestRetryPolicyValidate(t *testing.T) {
+	assert.NoError(t, DefaultRetryPolicy.Validate())
+	assert.NoError(t, RetryPolicy{Timeout: time.Minute, Interval: time.Second}.Validate())
+	assert.EqualError(t, RetryPolicy{Interval: time.Second}.Validate(), "the SSH retries need a maximum number of attempts or a timeout")
+	assert.Error(t, RetryPolicy{MaxAttempts: -1}.Validate())
+	assert.Error(t, RetryPolicy{MaxAttempts: 1, Multiplier: -2}.Validate())
+}
+
+func TestNativeClientDialRetryPolicy(t *testing.T) {
+	sleeps := recordSleeps(t)
+
+	// Nothing listens on the port of a closed listener.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	client, err := NewNativeClient("docker", "127.0.0.1", port, &Auth{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.(DialRetryClient).SetDialRetryPolicy(RetryPolicy{MaxAttempts: 1})
+
+	_, err = client.Output("exit 0")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Maximum number of retries (1) exceeded")
+	assert.Contains(t, err.Error(), "connection refused")
+	assert.Empty(t, *sleeps)
+}
@@ -0,0 +1,254 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rancher/machine/libmachine/log"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	controlSocketPrefix = "ssh-"
+	controlPersist      = "60s"
+
+	// controlHashLen is the length of the hash %C expands to.
+	controlHashLen = 40
+	// maxControlPathLen stays under the smallest unix socket path limit, 104
+	// bytes on BSDs.
+	maxControlPathLen = 100
+)
+
+// sharedConn is a native connection shared by the clients of one machine.
+type sharedConn struct {
+	sync.Mutex
+	conn *ssh.Client
+}
+
+var (
+	sharedConnsLock sync.Mutex
+	sharedConns     = map[string]*sharedConn{}
+
+	opensshVersionRegex = regexp.MustCompile(`OpenSSH_(\d+)\.(\d+)`)
+
+	// externalSharingSupported reports whether the ssh binary at the given
+	// path supports the ControlPersist option and the %C token. The answer
+	// is computed once since machine only ever uses the ssh found in PATH.
+	externalSharingSupported = opensshSupportsSharing
+	externalSharingOnce      sync.Once
+	externalSharing          bool
+
+	// exitControlMaster asks the ssh master listening on the control socket
+	// to exit, closing the connection it shares.
+	exitControlMaster = func(socket string) error {
+		sshBinaryPath, err := exec.LookPath("ssh")
+		if err != nil {
+			return err
+		}
+		// ssh requires a destination, the master is found by its socket.
+		return exec.Command(sshBinaryPath, "-O", "exit", "-o", "ControlPath="+socket, "machine").Run()
+	}
+)
+
+// NewSharedClient is like NewBastionClient, but the commands run by the
+// returned client share a single connection with the other clients created
+// with key, the name of the machine. controlDir, the directory of the
+// machine, holds the control sockets of the external client. Without
+// controlDir, only the native clients share their connection.
+func NewSharedClient(user, host string, port int, auth *Auth, bastion *Bastion, key, controlDir string) (Client, error) {
+	client, err := NewBastionClient(user, host, port, auth, bastion)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c := client.(type) {
+	case *NativeClient:
+		c.sharedKey = key + "|" + c.Config.User + "@" + c.address()
+		if bastion != nil {
+			c.sharedKey += "|" + bastion.User + "@" + bastion.address()
+		}
+	case *ExternalClient:
+		if controlDir == "" {
+			break
+		}
+		if !externalSharingSupported(c.BinaryPath) {
+			log.Debug("The SSH binary does not support connection sharing")
+			break
+		}
+		controlPath := filepath.Join(controlDir, controlSocketPrefix+"%C")
+		if len(controlPath)-len("%C")+controlHashLen > maxControlPathLen {
+			log.Debugf("Not sharing SSH connections, the control path %s is too long", controlPath)
+			break
+		}
+		c.BaseArgs = sharingArgs(c.BaseArgs, controlPath)
+	}
+
+	return client, nil
+}
+
+// sharingArgs returns a copy of args with the options disabling multiplexing
+// replaced by ones using the control socket at controlPath.
+func sharingArgs(args []string, controlPath string) []string {
+	shared := []string{}
+	for _, arg := range args {
+		switch arg {
+		case "ControlMaster=no":
+			shared = append(shared, "ControlMaster=auto")
+		case "ControlPath=none":
+			shared = append(shared, "ControlPath="+controlPath, "-o", "ControlPersist="+controlPersist)
+		default:
+			shared = append(shared, arg)
+		}
+	}
+	return shared
+}
+
+// unsharedArgs returns a copy of args with the options sharing the
+// connection replaced by the ones disabling it, like for the forwardings,
+// which would outlive the ssh requesting them through a shared connection.
+func unsharedArgs(args []string) []string {
+	unshared := []string{}
+	for _, arg := range args {
+		switch {
+		case arg == "ControlMaster=auto":
+			unshared = append(unshared, "ControlMaster=no")
+		case strings.HasPrefix(arg, "ControlPath="):
+			unshared = append(unshared, "ControlPath=none")
+		case strings.HasPrefix(arg, "ControlPersist="):
+			// Drop the -o before it too.
+			unshared = unshared[:len(unshared)-1]
+		default:
+			unshared = append(unshared, arg)
+		}
+	}
+	return unshared
+}
+
+func opensshSupportsSharing(binaryPath string) bool {
+	externalSharingOnce.Do(func() {
+		// Windows builds of OpenSSH do not support control sockets.
+		if runtime.GOOS == "windows" {
+			return
+		}
+
+		// ssh -V prints its version on stderr.
+		out, err := exec.Command(binaryPath, "-V").CombinedOutput()
+		if err != nil {
+			log.Debugf("Error getting the SSH client version: %s", err)
+			return
+		}
+
+		externalSharing = opensshAtLeast(string(out), 6, 7)
+	})
+	return externalSharing
+}
+
+// opensshAtLeast reports whether version, the output of ssh -V, is OpenSSH
+// major.minor or later.
+func opensshAtLeast(version string, major, minor int) bool {
+	m := opensshVersionRegex.FindStringSubmatch(version)
+	if m == nil {
+		return false
+	}
+
+	gotMajor, _ := strconv.Atoi(m[1])
+	gotMinor, _ := strconv.Atoi(m[2])
+	return gotMajor > major || gotMajor == major && gotMinor >= minor
+}
+
+// sharedSession opens a session on the shared connection of the client,
+// dialing it first if there is none or it broke.
+func (client *NativeClient) sharedSession() (*ssh.Client, *ssh.Session, error) {
+	sharedConnsLock.Lock()
+	shared, ok := sharedConns[client.sharedKey]
+	if !ok {
+		shared = &sharedConn{}
+		sharedConns[client.sharedKey] = shared
+	}
+	sharedConnsLock.Unlock()
+
+	// Only the clients of a same machine wait for each other.
+	shared.Lock()
+	defer shared.Unlock()
+
+	if shared.conn != nil {
+		session, err := shared.conn.NewSession()
+		if err == nil {
+			return shared.conn, session, nil
+		}
+		log.Debugf("Reconnecting, the shared SSH connection failed: %s", err)
+		closeConn(shared.conn)
+		shared.conn = nil
+	}
+
+	conn, session, err := client.dial()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	shared.conn = conn
+	return conn, session, nil
+}
+
+// release closes conn once a command is done with it, unless it is shared.
+func (client *NativeClient) release(conn *ssh.Client) {
+	if client.sharedKey == "" {
+		closeConn(conn)
+	}
+}
+
+// CloseSharedConnections closes the connections shared by the clients
+// created with key, and the ones of the ssh masters of the control sockets
+// controlDir holds, if any, before removing the sockets.
+func CloseSharedConnections(key, controlDir string) error {
+	if key == "" {
+		return errors.New("no key of the shared SSH connections to close")
+	}
+
+	sharedConnsLock.Lock()
+	for sharedKey, shared := range sharedConns {
+		if !strings.HasPrefix(sharedKey, key+"|") {
+			continue
+		}
+		shared.Lock()
+		if shared.conn != nil {
+			closeConn(shared.conn)
+		}
+		shared.Unlock()
+		delete(sharedConns, sharedKey)
+	}
+	sharedConnsLock.Unlock()
+
+	if controlDir == "" {
+		return nil
+	}
+
+	sockets, err := filepath.Glob(filepath.Join(controlDir, controlSocketPrefix+"*"))
+	if err != nil {
+		return err
+	}
+
+	for _, socket := range sockets {
+		fi, err := os.Lstat(socket)
+		if err != nil || fi.Mode()&os.ModeSocket == 0 {
+			continue
+		}
+		// A master which already exited leaves a stale socket behind.
+		if err := exitControlMaster(socket); err != nil {
+			log.Debugf("Error stopping the SSH master of %s: %s", socket, err)
+		}
+		if err := os.Remove(socket); err != nil {
+			return fmt.Errorf("Error removing the SSH control socket: %s", err)
+		}
+	}
+
+	return nil
+}
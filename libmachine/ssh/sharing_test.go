@@ -0,0 +1,270 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// testServer is an SSH server answering "ok" to every command, serving SFTP
+// on the local filesystem and counting the connections it accepts.
+type testServer struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+	conns    int32
+}
+
+func newTestServer(t *testing.T) *testServer {
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	s := &testServer{listener: listener, config: config}
+	go s.serve()
+	return s
+}
+
+func (s *testServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		atomic.AddInt32(&s.conns, 1)
+		go s.handle(conn)
+	}
+}
+
+func (s *testServer) handle(conn net.Conn) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() == "direct-tcpip" {
+			go forward(newChannel)
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer channel.Close()
+			for req := range requests {
+				if req.Type == "subsystem" && bytes.HasSuffix(req.Payload, []byte("sftp")) {
+					req.Reply(true, nil)
+					if server, err := sftp.NewServer(channel); err == nil {
+						server.Serve()
+					}
+					return
+				}
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				req.Reply(true, nil)
+				channel.Write([]byte("ok\n"))
+				channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+				return
+			}
+		}()
+	}
+}
+
+func (s *testServer) connections() int {
+	return int(atomic.LoadInt32(&s.conns))
+}
+
+func (s *testServer) nativeClient(t *testing.T) *NativeClient {
+	host, port, err := net.SplitHostPort(s.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := strconv.Atoi(port)
+
+	client, err := NewNativeClient("docker", host, p, &Auth{Passwords: []string{"tcuser"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client.(*NativeClient)
+}
+
+func TestNativeClientWithoutSharing(t *testing.T) {
+	server := newTestServer(t)
+	client := server.nativeClient(t)
+
+	for i := 0; i < 3; i++ {
+		out, err := client.Output("exit 0")
+		assert.NoError(t, err)
+		assert.Equal(t, "ok\n", out)
+	}
+
+	// Each command checks the host can be dialed, then dials it again.
+	assert.Equal(t, 6, server.connections())
+}
+
+func TestNativeClientSharing(t *testing.T) {
+	defer SetDefaultClient(defaultClientType)
+	SetDefaultClient(Native)
+
+	server := newTestServer(t)
+	controlDir := t.TempDir()
+	defer CloseSharedConnections("default", controlDir)
+
+	base := server.nativeClient(t)
+	for i := 0; i < 3; i++ {
+		client, err := NewSharedClient("docker", base.Hostname, base.Port, &Auth{Passwords: []string{"tcuser"}}, nil, "default", controlDir)
+		assert.NoError(t, err)
+
+		out, err := client.Output("exit 0")
+		assert.NoError(t, err)
+		assert.Equal(t, "ok\n", out)
+	}
+
+	assert.Equal(t, 2, server.connections())
+}
+
+func TestNativeClientSharingReconnects(t *testing.T) {
+	defer SetDefaultClient(defaultClientType)
+	SetDefaultClient(Native)
+
+	server := newTestServer(t)
+	controlDir := t.TempDir()
+	defer CloseSharedConnections("default", controlDir)
+
+	base := server.nativeClient(t)
+	client, err := NewSharedClient("docker", base.Hostname, base.Port, &Auth{Passwords: []string{"tcuser"}}, nil, "default", controlDir)
+	assert.NoError(t, err)
+
+	_, err = client.Output("exit 0")
+	assert.NoError(t, err)
+
+	sharedConns[client.(*NativeClient).sharedKey].conn.Close()
+
+	out, err := client.Output("exit 0")
+	assert.NoError(t, err)
+	assert.Equal(t, "ok\n", out)
+	assert.Equal(t, 4, server.connections())
+}
+
+func TestCloseSharedConnections(t *testing.T) {
+	controlDir := t.TempDir()
+	socketPath := filepath.Join(controlDir, "ssh-0123")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Skipf("unix sockets are not supported: %s", err)
+	}
+	defer listener.Close()
+	notSocket := filepath.Join(controlDir, "ssh-notes")
+	assert.NoError(t, os.WriteFile(notSocket, []byte{}, 0600))
+
+	defer func(orig func(string) error) { exitControlMaster = orig }(exitControlMaster)
+	exited := []string{}
+	exitControlMaster = func(socket string) error {
+		exited = append(exited, socket)
+		return nil
+	}
+
+	sharedConns["default|docker@1.2.3.4:22"] = &sharedConn{}
+	sharedConns["other|docker@1.2.3.5:22"] = &sharedConn{}
+	defer delete(sharedConns, "other|docker@1.2.3.5:22")
+
+	assert.NoError(t, CloseSharedConnections("default", controlDir))
+
+	assert.Equal(t, []string{socketPath}, exited)
+	_, err = os.Lstat(socketPath)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Lstat(notSocket)
+	assert.NoError(t, err)
+	assert.NotContains(t, sharedConns, "default|docker@1.2.3.4:22")
+	// The connections of the other machines are left alone, whether they
+	// have a control directory or not.
+	assert.Contains(t, sharedConns, "other|docker@1.2.3.5:22")
+
+	assert.Error(t, CloseSharedConnections("", ""))
+	assert.Contains(t, sharedConns, "other|docker@1.2.3.5:22")
+}
+
+func TestExternalClientSharingArgs(t *testing.T) {
+	sshBinaryPath, err := exec.LookPath("ssh")
+	if err != nil {
+		t.Skip("ssh binary not found")
+	}
+	defer SetDefaultClient(defaultClientType)
+	SetDefaultClient(External)
+	defer func(orig func(string) bool) { externalSharingSupported = orig }(externalSharingSupported)
+	externalSharingSupported = func(string) bool { return true }
+
+	client, err := NewSharedClient("docker", "localhost", 22, &Auth{}, nil, "default", "/machines/default")
+	assert.NoError(t, err)
+
+	external := client.(*ExternalClient)
+	assert.Equal(t, sshBinaryPath, external.BinaryPath)
+	assert.Equal(t, []string{
+		"-F", "/dev/null",
+		"-o", "ConnectionAttempts=3",
+		"-o", "ConnectTimeout=10",
+		"-o", "ControlMaster=auto",
+		"-o", "ControlPath=/machines/default/ssh-%C",
+		"-o", "ControlPersist=60s",
+		"-o", "LogLevel=quiet",
+		"-o", "PasswordAuthentication=no",
+		"-o", "ServerAliveInterval=60",
+		"-o", "StrictHostKeyChecking=no",
+		"-o", "UserKnownHostsFile=/dev/null",
+		"docker@localhost",
+		"-p", "22",
+	}, external.BaseArgs)
+
+	// Control sockets are not used when their path would be too long.
+	client, err = NewSharedClient("docker", "localhost", 22, &Auth{}, nil, "default", "/"+strings.Repeat("m", 80))
+	assert.NoError(t, err)
+	assert.Contains(t, client.(*ExternalClient).BaseArgs, "ControlPath=none")
+
+	// Nor when the ssh binary does not support them.
+	externalSharingSupported = func(string) bool { return false }
+	client, err = NewSharedClient("docker", "localhost", 22, &Auth{}, nil, "default", "/machines/default")
+	assert.NoError(t, err)
+	assert.Contains(t, client.(*ExternalClient).BaseArgs, "ControlPath=none")
+}
+
+func TestOpensshAtLeast(t *testing.T) {
+	assert.True(t, opensshAtLeast("OpenSSH_9.2p1 Debian-2+deb12u7, OpenSSL 3.0.17 1 Jul 2025", 6, 7))
+	assert.True(t, opensshAtLeast("OpenSSH_6.7p1", 6, 7))
+	assert.False(t, opensshAtLeast("OpenSSH_6.6.1p1 Ubuntu-2ubuntu2", 6, 7))
+	assert.False(t, opensshAtLeast("OpenSSH_for_Windows_8.1p1", 6, 7))
+	assert.False(t, opensshAtLeast("Sun_SSH_1.5", 6, 7))
+}
@@ -1,6 +1,12 @@
 package sshtest
 
-import "io"
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/rancher/machine/libmachine/ssh"
+)
 
 type CmdResult struct {
 	Out string
@@ -9,7 +15,13 @@ type CmdResult struct {
 
 type FakeClient struct {
 	ActivatedShell []string
+	AgentForwarded bool
 	Outputs        map[string]CmdResult
+	// Files are the contents of the files on the machine, by path, the
+	// uploaded ones included.
+	Files map[string]string
+	// FileAttributes are the attributes of the uploaded files, by path.
+	FileAttributes map[string]ssh.FileAttributes
 }
 
 func (fsc *FakeClient) Output(command string) (string, error) {
@@ -22,6 +34,10 @@ func (fsc *FakeClient) Shell(args ...string) error {
 	return nil
 }
 
+func (fsc *FakeClient) ForwardAgent() {
+	fsc.AgentForwarded = true
+}
+
 func (fsc *FakeClient) Start(command string) (io.ReadCloser, io.ReadCloser, error) {
 	return nil, nil, nil
 }
@@ -29,3 +45,26 @@ func (fsc *FakeClient) Start(command string) (io.ReadCloser, io.ReadCloser, erro
 func (fsc *FakeClient) Wait() error {
 	return nil
 }
+
+func (fsc *FakeClient) Upload(content io.Reader, path string, attrs ssh.FileAttributes) error {
+	b, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	if fsc.Files == nil {
+		fsc.Files = map[string]string{}
+		fsc.FileAttributes = map[string]ssh.FileAttributes{}
+	}
+	fsc.Files[path] = string(b)
+	fsc.FileAttributes[path] = attrs
+	return nil
+}
+
+func (fsc *FakeClient) Download(path string, w io.Writer) error {
+	content, ok := fsc.Files[path]
+	if !ok {
+		return errors.New("No such file on the FakeClient machine")
+	}
+	_, err := io.Copy(w, strings.NewReader(content))
+	return err
+}
@@ -0,0 +1,261 @@
+package ssh
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+// defaultFileMode is the mode of the files uploaded without one.
+const defaultFileMode os.FileMode = 0644
+
+// FileAttributes are the attributes of a file uploaded to the machine.
+type FileAttributes struct {
+	// Mode is the permissions of the file, 0644 when zero.
+	Mode os.FileMode
+	// Owner is the user, or the user:group, owning the file. A file owned
+	// by another user than the SSH one, like root, is staged in /tmp and
+	// installed with sudo. Without owner, the file belongs to the SSH user.
+	Owner string
+}
+
+func (attrs FileAttributes) mode() os.FileMode {
+	if attrs.Mode == 0 {
+		return defaultFileMode
+	}
+	return attrs.Mode.Perm()
+}
+
+// stagingPath returns the path the file is uploaded to before being
+// installed at dest.
+func (attrs FileAttributes) stagingPath(dest string) (string, error) {
+	if attrs.Owner == "" {
+		return dest, nil
+	}
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return "/tmp/.machine-upload-" + hex.EncodeToString(suffix), nil
+}
+
+// installCommand returns the command installing the file staged at staged
+// at dest, with its mode and owner, and removing the staged one.
+func (attrs FileAttributes) installCommand(staged, dest string) string {
+	owner, group, _ := strings.Cut(attrs.Owner, ":")
+	install := fmt.Sprintf("sudo install -m %04o -o %s", attrs.mode(), shellQuote(owner))
+	if group != "" {
+		install += " -g " + shellQuote(group)
+	}
+	return fmt.Sprintf("sudo mkdir -p %s && %s %s %s; status=$?; rm -f %s; exit $status",
+		shellQuote(path.Dir(dest)), install, shellQuote(staged), shellQuote(dest), shellQuote(staged))
+}
+
+// install installs the file staged by client at dest, if it has an owner.
+func (attrs FileAttributes) install(client Client, staged, dest string) error {
+	if attrs.Owner == "" {
+		return nil
+	}
+
+	if output, err := client.Output(attrs.installCommand(staged, dest)); err != nil {
+		return fmt.Errorf("Error installing %s: %s: %s", dest, err, output)
+	}
+	return nil
+}
+
+// withSFTP runs f with an SFTP client on a connection to the machine.
+func (client *NativeClient) withSFTP(f func(*sftp.Client) error) error {
+	conn, session, err := client.session("")
+	if err != nil {
+		return err
+	}
+	defer client.release(conn)
+	// The SFTP client opens its own session.
+	session.Close()
+
+	sftpClient, err := sftp.NewClient(conn)
+	if err != nil {
+		return fmt.Errorf("Error starting SFTP: %s", err)
+	}
+	defer sftpClient.Close()
+
+	return f(sftpClient)
+}
+
+// Upload writes content to the file at dest on the machine, with the
+// attributes, over SFTP.
+func (client *NativeClient) Upload(content io.Reader, dest string, attrs FileAttributes) error {
+	staged, err := attrs.stagingPath(dest)
+	if err != nil {
+		return err
+	}
+
+	if err := client.withSFTP(func(sftpClient *sftp.Client) error {
+		if attrs.Owner == "" {
+			if err := sftpClient.MkdirAll(path.Dir(dest)); err != nil {
+				return err
+			}
+		}
+
+		f, err := sftpClient.OpenFile(staged, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+		if err != nil {
+			return err
+		}
+		if _, err := f.ReadFrom(content); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+
+		// The staged file is only readable by the SSH user until installed.
+		mode := attrs.mode()
+		if staged != dest {
+			mode = 0600
+		}
+		return sftpClient.Chmod(staged, mode)
+	}); err != nil {
+		return fmt.Errorf("Error uploading %s: %s", dest, err)
+	}
+
+	return attrs.install(client, staged, dest)
+}
+
+// Download copies the file at src on the machine to w, over SFTP.
+func (client *NativeClient) Download(src string, w io.Writer) error {
+	if err := client.withSFTP(func(sftpClient *sftp.Client) error {
+		f, err := sftpClient.Open(src)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = f.WriteTo(w)
+		return err
+	}); err != nil {
+		return fmt.Errorf("Error downloading %s: %s", src, err)
+	}
+	return nil
+}
+
+// scpArgs returns the arguments of scp with the options of the client.
+func (client *ExternalClient) scpArgs() []string {
+	destination := fmt.Sprintf("%s@%s", client.user, client.host)
+
+	args := make([]string, 0, len(client.BaseArgs)+1)
+	for _, arg := range client.BaseArgs {
+		switch arg {
+		case destination, "-A", "-t", "-tt":
+			// scp takes the destination with the paths and forwards nothing.
+			continue
+		case "-p":
+			arg = "-P"
+		}
+		args = append(args, arg)
+	}
+	return append(args, "-q")
+}
+
+// scpLocation returns the location of the file at p on the machine, in the
+// form of scp.
+func (client *ExternalClient) scpLocation(p string) string {
+	host := client.host
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	return fmt.Sprintf("%s@%s:%s", client.user, host, p)
+}
+
+// scp copies src to dest with scp.
+func (client *ExternalClient) scp(src, dest string) error {
+	if client.user == "" || client.host == "" {
+		return errors.New("the SSH client has no destination to copy files to")
+	}
+
+	scpBinaryPath, err := exec.LookPath("scp")
+	if err != nil {
+		return errors.New("You must have a copy of the scp binary locally to transfer files")
+	}
+
+	args := append(client.scpArgs(), src, dest)
+	output, err := getSSHCmd(scpBinaryPath, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %s", err, output)
+	}
+	return nil
+}
+
+// Upload writes content to the file at dest on the machine, with the
+// attributes, with scp.
+func (client *ExternalClient) Upload(content io.Reader, dest string, attrs FileAttributes) error {
+	local, err := os.CreateTemp("", "machine-upload-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(local.Name())
+
+	if _, err := io.Copy(local, content); err != nil {
+		local.Close()
+		return err
+	}
+	if err := local.Close(); err != nil {
+		return err
+	}
+
+	staged, err := attrs.stagingPath(dest)
+	if err != nil {
+		return err
+	}
+
+	if attrs.Owner == "" {
+		if output, err := client.Output(fmt.Sprintf("mkdir -p %s", shellQuote(path.Dir(dest)))); err != nil {
+			return fmt.Errorf("Error uploading %s: %s: %s", dest, err, output)
+		}
+	}
+
+	if err := client.scp(local.Name(), client.scpLocation(staged)); err != nil {
+		return fmt.Errorf("Error uploading %s: %s", dest, err)
+	}
+
+	// The staged file keeps the 0600 mode of the local one until installed.
+	if staged == dest {
+		if output, err := client.Output(fmt.Sprintf("chmod %04o %s", attrs.mode(), shellQuote(dest))); err != nil {
+			return fmt.Errorf("Error uploading %s: %s: %s", dest, err, output)
+		}
+	}
+
+	return attrs.install(client, staged, dest)
+}
+
+// Download copies the file at src on the machine to w, with scp.
+func (client *ExternalClient) Download(src string, w io.Writer) error {
+	local, err := os.CreateTemp("", "machine-download-")
+	if err != nil {
+		return err
+	}
+	local.Close()
+	defer os.Remove(local.Name())
+
+	if err := client.scp(client.scpLocation(src), local.Name()); err != nil {
+		return fmt.Errorf("Error downloading %s: %s", src, err)
+	}
+
+	f, err := os.Open(local.Name())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
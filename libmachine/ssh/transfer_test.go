@@ -0,0 +1,65 @@
+package ssh
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/fips"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNativeClientUploadDownload(t *testing.T) {
+	if fips.Enabled() {
+		t.Skip("the test server has an Ed25519 host key")
+	}
+
+	client := newTestServer(t).nativeClient(t)
+	dest := filepath.ToSlash(filepath.Join(t.TempDir(), "etc", "docker", "daemon.json"))
+
+	assert.NoError(t, client.Upload(strings.NewReader(`{"debug": true}`), dest, FileAttributes{Mode: 0640}))
+
+	content, err := os.ReadFile(dest)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"debug": true}`, string(content))
+	if fi, err := os.Stat(dest); assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0640), fi.Mode().Perm())
+	}
+
+	var downloaded bytes.Buffer
+	assert.NoError(t, client.Download(dest, &downloaded))
+	assert.Equal(t, `{"debug": true}`, downloaded.String())
+
+	assert.Error(t, client.Download(dest+".missing", &downloaded))
+}
+
+func TestFileAttributesInstallCommand(t *testing.T) {
+	attrs := FileAttributes{Mode: 0600, Owner: "root:docker"}
+
+	staged, err := attrs.stagingPath("/etc/docker/server-key.pem")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(staged, "/tmp/.machine-upload-"))
+
+	assert.Equal(t, "sudo mkdir -p '/etc/docker' && sudo install -m 0600 -o 'root' -g 'docker' '/tmp/staged' '/etc/docker/server-key.pem'; status=$?; rm -f '/tmp/staged'; exit $status",
+		attrs.installCommand("/tmp/staged", "/etc/docker/server-key.pem"))
+
+	assert.Equal(t, "sudo mkdir -p '/etc' && sudo install -m 0644 -o 'root' '/tmp/staged' '/etc/hostname'; status=$?; rm -f '/tmp/staged'; exit $status",
+		FileAttributes{Owner: "root"}.installCommand("/tmp/staged", "/etc/hostname"))
+
+	staged, err = FileAttributes{}.stagingPath("/home/docker/file")
+	assert.NoError(t, err)
+	assert.Equal(t, "/home/docker/file", staged)
+}
+
+func TestExternalClientScpArgs(t *testing.T) {
+	client := &ExternalClient{
+		BaseArgs: []string{"-F", "/dev/null", "-o", "IdentitiesOnly=yes", "docker@fe80::1", "-i", "/tmp/id_rsa", "-p", "2222", "-A", "-tt"},
+		user:     "docker",
+		host:     "fe80::1",
+	}
+
+	assert.Equal(t, []string{"-F", "/dev/null", "-o", "IdentitiesOnly=yes", "-i", "/tmp/id_rsa", "-P", "2222", "-q"}, client.scpArgs())
+	assert.Equal(t, "docker@[fe80::1]:/etc/hostname", client.scpLocation("/etc/hostname"))
+}
@@ -0,0 +1,298 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/rancher/machine/libmachine/log"
+	"golang.org/x/crypto/ssh"
+)
+
+// tunnelReady is printed by the external client once its forwardings are
+// set up.
+const tunnelReady = "machine-tunnel-ready"
+
+// TunnelingClient is a Client able to forward ports over its connection to
+// the machine, like `ssh -L` and `ssh -R` do.
+type TunnelingClient interface {
+	Client
+	// LocalForward forwards the connections to localAddr, on the local
+	// host, to remoteAddr on the machine.
+	LocalForward(localAddr, remoteAddr string) (*Tunnel, error)
+	// RemoteForward forwards the connections to remoteAddr, on the machine,
+	// to localAddr on the local host.
+	RemoteForward(remoteAddr, localAddr string) (*Tunnel, error)
+}
+
+// Tunnel is a port forwarded over the SSH connection to a machine. It
+// forwards the connections until it is closed or the SSH connection breaks.
+type Tunnel struct {
+	addr     net.Addr
+	stop     func()
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// Addr returns the address the tunnel listens on, on the local host for a
+// local forward and on the machine for a remote one.
+func (t *Tunnel) Addr() net.Addr {
+	return t.addr
+}
+
+// Done returns a channel closed once the tunnel stopped forwarding.
+func (t *Tunnel) Done() <-chan struct{} {
+	return t.done
+}
+
+// Close stops the tunnel, closing the connections it forwards.
+func (t *Tunnel) Close() error {
+	t.stopOnce.Do(t.stop)
+	<-t.done
+	return nil
+}
+
+// forwardNetwork returns the network of addr, a unix socket for a path.
+func forwardNetwork(addr string) string {
+	if strings.HasPrefix(addr, "/") {
+		return "unix"
+	}
+	return "tcp"
+}
+
+// LocalForward forwards the connections to localAddr to remoteAddr on the
+// machine, over the shared connection of the client if it has one.
+func (client *NativeClient) LocalForward(localAddr, remoteAddr string) (*Tunnel, error) {
+	conn, err := client.tunnelConn()
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen(forwardNetwork(localAddr), localAddr)
+	if err != nil {
+		client.release(conn)
+		return nil, fmt.Errorf("Error listening on %s: %s", localAddr, err)
+	}
+
+	return client.forward(conn, listener, func() (net.Conn, error) {
+		return conn.Dial(forwardNetwork(remoteAddr), remoteAddr)
+	}), nil
+}
+
+// RemoteForward forwards the connections to remoteAddr on the machine to
+// localAddr, over the shared connection of the client if it has one.
+func (client *NativeClient) RemoteForward(remoteAddr, localAddr string) (*Tunnel, error) {
+	conn, err := client.tunnelConn()
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := conn.Listen(forwardNetwork(remoteAddr), remoteAddr)
+	if err != nil {
+		client.release(conn)
+		return nil, fmt.Errorf("Error listening on %s on the machine: %s", remoteAddr, err)
+	}
+
+	return client.forward(conn, listener, func() (net.Conn, error) {
+		return net.Dial(forwardNetwork(localAddr), localAddr)
+	}), nil
+}
+
+// tunnelConn returns the connection to the machine a tunnel goes through.
+func (client *NativeClient) tunnelConn() (*ssh.Client, error) {
+	conn, session, err := client.session("")
+	if err != nil {
+		return nil, err
+	}
+	// The forwarded connections open their own channels.
+	session.Close()
+	return conn, nil
+}
+
+// forward starts a tunnel forwarding the connections accepted by listener to
+// the ones dial opens, each one a channel of conn.
+func (client *NativeClient) forward(conn *ssh.Client, listener net.Listener, dial func() (net.Conn, error)) *Tunnel {
+	t := &Tunnel{
+		addr: listener.Addr(),
+		stop: func() { listener.Close() },
+		done: make(chan struct{}),
+	}
+
+	var (
+		lock    sync.Mutex
+		stopped bool
+		active  = map[net.Conn]struct{}{}
+		wg      sync.WaitGroup
+	)
+
+	// The tunnel stops with the connection, like once the machine stopped.
+	go func() {
+		_ = conn.Wait()
+		t.stopOnce.Do(t.stop)
+	}()
+
+	go func() {
+		defer close(t.done)
+		defer client.release(conn)
+
+		for {
+			accepted, err := listener.Accept()
+			if err != nil {
+				break
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				dialed, err := dial()
+				if err != nil {
+					log.Debugf("Error forwarding a connection to %s: %s", t.addr, err)
+					accepted.Close()
+					return
+				}
+
+				lock.Lock()
+				if stopped {
+					lock.Unlock()
+					accepted.Close()
+					dialed.Close()
+					return
+				}
+				active[accepted], active[dialed] = struct{}{}, struct{}{}
+				lock.Unlock()
+
+				pipe(accepted, dialed)
+
+				lock.Lock()
+				delete(active, accepted)
+				delete(active, dialed)
+				lock.Unlock()
+			}()
+		}
+
+		lock.Lock()
+		stopped = true
+		for c := range active {
+			c.Close()
+		}
+		lock.Unlock()
+		wg.Wait()
+	}()
+
+	return t
+}
+
+// pipe copies the data between a and b until either is done, then closes
+// both.
+func pipe(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(a, b)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(b, a)
+		done <- struct{}{}
+	}()
+
+	<-done
+	a.Close()
+	b.Close()
+	<-done
+}
+
+// LocalForward forwards the connections to localAddr to remoteAddr on the
+// machine, with an ssh process running until the tunnel is closed.
+func (client *ExternalClient) LocalForward(localAddr, remoteAddr string) (*Tunnel, error) {
+	addr, err := freeLocalAddr(localAddr)
+	if err != nil {
+		return nil, fmt.Errorf("Error listening on %s: %s", localAddr, err)
+	}
+
+	return client.tunnel(addr, "-L", addr.String()+":"+remoteAddr)
+}
+
+// RemoteForward forwards the connections to remoteAddr on the machine to
+// localAddr, with an ssh process running until the tunnel is closed.
+func (client *ExternalClient) RemoteForward(remoteAddr, localAddr string) (*Tunnel, error) {
+	var addr net.Addr
+	if forwardNetwork(remoteAddr) == "unix" {
+		addr = &net.UnixAddr{Name: remoteAddr, Net: "unix"}
+	} else {
+		tcpAddr, err := net.ResolveTCPAddr("tcp", remoteAddr)
+		if err != nil {
+			return nil, err
+		}
+		// ssh only logs the port the machine picked.
+		if tcpAddr.Port == 0 {
+			return nil, errors.New("the external SSH client needs a port to listen on the machine")
+		}
+		addr = tcpAddr
+	}
+
+	return client.tunnel(addr, "-R", remoteAddr+":"+localAddr)
+}
+
+// freeLocalAddr returns localAddr with a free port when it has none, since
+// ssh does not tell the port it picked.
+func freeLocalAddr(localAddr string) (net.Addr, error) {
+	if forwardNetwork(localAddr) == "unix" {
+		return &net.UnixAddr{Name: localAddr, Net: "unix"}, nil
+	}
+
+	listener, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+	return listener.Addr(), nil
+}
+
+// tunnel starts an ssh process forwarding spec with flag, -L or -R, and
+// returns once the forwarding is set up.
+func (client *ExternalClient) tunnel(addr net.Addr, flag, spec string) (*Tunnel, error) {
+	args := append(unsharedArgs(client.BaseArgs), "-o", "ExitOnForwardFailure=yes", flag, spec, "echo "+tunnelReady+" && cat >/dev/null")
+	cmd := getSSHCmd(client.BinaryPath, args...)
+
+	log.Debug(cmd)
+
+	// cat keeps the session, and so the forwarding, open.
+	if _, err := cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	// ssh runs the command once the forwarding is set up, or exits.
+	if line, _ := bufio.NewReader(stdout).ReadString('\n'); strings.TrimSpace(line) != tunnelReady {
+		_ = cmd.Process.Kill()
+		err := cmd.Wait()
+		return nil, fmt.Errorf("Error forwarding %s: %v: %s", spec, err, strings.TrimSpace(stderr.String()))
+	}
+
+	t := &Tunnel{
+		addr: addr,
+		// ssh waits for the forwarded connections to end before exiting.
+		stop: func() { _ = cmd.Process.Kill() },
+		done: make(chan struct{}),
+	}
+	go func() {
+		_ = cmd.Wait()
+		close(t.done)
+	}()
+	return t, nil
+}
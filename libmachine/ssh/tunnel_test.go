@@ -0,0 +1,76 @@
+package ssh
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/fips"
+	"github.com/stretchr/testify/assert"
+)
+
+// echoServer is a TCP server echoing the lines it reads, like a daemon
+// listening on the machine.
+func echoServer(t *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener
+}
+
+func TestNativeClientLocalForward(t *testing.T) {
+	if fips.Enabled() {
+		t.Skip("the test server has an Ed25519 host key")
+	}
+
+	server := newTestServer(t)
+	daemon := echoServer(t)
+	client := server.nativeClient(t)
+
+	tunnel, err := client.LocalForward("127.0.0.1:0", daemon.Addr().String())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Both connections go through the one of the tunnel.
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", tunnel.Addr().String())
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = conn.Write([]byte("ping\n"))
+		assert.NoError(t, err)
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "ping\n", line)
+		conn.Close()
+	}
+	assert.Equal(t, 2, server.connections())
+
+	assert.NoError(t, tunnel.Close())
+	<-tunnel.Done()
+
+	_, err = net.Dial("tcp", tunnel.Addr().String())
+	assert.Error(t, err)
+}
+
+func TestUnsharedArgs(t *testing.T) {
+	assert.Equal(t, baseSSHArgs, unsharedArgs(sharingArgs(baseSSHArgs, "/machines/default/ssh-%C")))
+	assert.Equal(t, baseSSHArgs, unsharedArgs(baseSSHArgs))
+}
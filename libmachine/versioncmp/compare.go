@@ -1,9 +1,15 @@
 // Package versioncmp provides functions for comparing version strings.
 //
-// Version strings are dot-separated integers with an optional
-// pre-release suffix. A pre-release suffix is an arbitrary string with a
-// leading dash character. All functions ignore these suffixes, so "1.2" and
-// "1.2-rc" are considered equivalent.
+// Version strings are dot-separated integers with optional edition,
+// pre-release and build suffixes, as produced by the docker CLI and by the
+// apt and yum package managers. See Parse for the accepted forms. A
+// pre-release sorts before the corresponding release, so "1.2-rc" is less
+// than "1.2", while build and packaging metadata are ignored.
+//
+// The boolean helpers (LessThan, Equal, ...) predate Parse and are kept for
+// compatibility with driver plugins; they fall back to a lenient comparison
+// when either argument cannot be parsed. New code should use Compare or
+// Parse so that malformed input is reported as an error.
 package versioncmp
 
 import (
@@ -18,8 +24,18 @@ const (
 
 // compare compares two versions of Docker to decipher which came first.
 //
-// compare returns -1 if v1 < v2, 1 if v1 > v2, 0 otherwise.
+// compare returns -1 if v1 < v2, 1 if v1 > v2, 0 otherwise. Inputs that Parse
+// rejects are compared with the lenient legacy rules.
 func compare(v1, v2 string) int {
+	if c, err := Compare(v1, v2); err == nil {
+		return c
+	}
+	return compareLegacy(v1, v2)
+}
+
+// compareLegacy is the historical comparison, in which non-numeric segments
+// compare as zero.
+func compareLegacy(v1, v2 string) int {
 	// Replace RC string with "." to make the RC number appear as simply
 	// another sub-version.
 	v1 = strings.Replace(v1, rcString, ".", -1)
@@ -0,0 +1,341 @@
+package versioncmp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Version is a parsed, normalized version string.
+//
+// Segments holds every dot-separated numeric component of the release, so
+// "1.13.1" and "20.10.24.1" are both represented without truncation.
+// Prerelease holds the pre-release identifiers ("rc.1", "beta2"), Edition
+// holds the Docker edition marker ("ce" or "ee") and Build holds any build or
+// packaging metadata ("1~ubuntu.22.04~jammy", "3.el9") that does not
+// participate in ordering.
+type Version struct {
+	Segments   []int
+	Prerelease string
+	Edition    string
+	Build      string
+}
+
+// ParseError is returned when a version string cannot be normalized.
+type ParseError struct {
+	Input  string
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid version %q: %s", e.Input, e.Reason)
+}
+
+// prereleaseTags mark a pre-release, as opposed to distro or packaging
+// metadata, when they make up a whole token or are followed by a digit or a
+// dot ("rc", "rc1", "rc.1"). "precise" and "devuan" are not pre-releases.
+var prereleaseTags = []string{"alpha", "beta", "rc", "tp", "pre", "dev"}
+
+// Parse normalizes a version string as reported by the docker CLI, apt or yum
+// into a Version.
+//
+// Accepted forms include "24.0.7", "v24.0.7", "1.13.0-rc1", "24.0.7-rc.1",
+// "17.03.0-ce-rc2", "5:24.0.7-1~ubuntu.22.04~jammy", "24.0.7~ubuntu.22.04",
+// "24.0.0~rc.1-1~debian.12~bookworm", "20.10.24+dfsg1",
+// "1.13.1-209.git7d71120.el7.centos" and "17.03.2.ce-1.el7.centos". A package
+// epoch ("5:") is discarded.
+func Parse(s string) (Version, error) {
+	var v Version
+
+	input := strings.TrimSpace(s)
+	if input == "" {
+		return v, &ParseError{Input: s, Reason: "empty version"}
+	}
+
+	rest := strings.TrimPrefix(input, "v")
+	if n := strings.IndexByte(rest, ':'); n != -1 {
+		if _, err := strconv.Atoi(rest[:n]); err != nil {
+			return v, &ParseError{Input: s, Reason: "malformed epoch"}
+		}
+		rest = rest[n+1:]
+	}
+
+	if n := strings.IndexByte(rest, '+'); n != -1 {
+		v.Build = rest[n+1:]
+		rest = rest[:n]
+	}
+
+	end := strings.IndexAny(rest, "-~")
+	core := rest
+	suffix := ""
+	if end != -1 {
+		core, suffix = rest[:end], rest[end:]
+	}
+
+	if core == "" {
+		return v, &ParseError{Input: s, Reason: "missing numeric release"}
+	}
+	segs := strings.Split(core, ".")
+	if last := strings.ToLower(segs[len(segs)-1]); len(segs) > 1 && (last == "ce" || last == "ee") {
+		// yum spells the edition as a trailing segment: 17.03.2.ce
+		v.Edition = last
+		segs = segs[:len(segs)-1]
+	}
+	for _, seg := range segs {
+		n, err := strconv.Atoi(seg)
+		if err != nil || n < 0 {
+			return v, &ParseError{Input: s, Reason: fmt.Sprintf("non-numeric release segment %q", seg)}
+		}
+		v.Segments = append(v.Segments, n)
+	}
+
+	if err := v.parseSuffix(suffix); err != nil {
+		return Version{}, &ParseError{Input: s, Reason: err.Error()}
+	}
+
+	return v, nil
+}
+
+// parseSuffix classifies the '-' or '~' delimited tokens that follow the
+// numeric release. Edition markers and pre-release tags are only recognized
+// before the first build token; everything from the first build token on is
+// metadata.
+func (v *Version) parseSuffix(suffix string) error {
+	var build []string
+
+	for suffix != "" {
+		delim := suffix[0]
+		suffix = suffix[1:]
+		token := suffix
+		if n := strings.IndexAny(suffix, "-~"); n != -1 {
+			token, suffix = suffix[:n], suffix[n:]
+		} else {
+			suffix = ""
+		}
+
+		if token == "" {
+			return fmt.Errorf("empty suffix after %q", delim)
+		}
+
+		if len(build) > 0 {
+			build = append(build, string(delim)+token)
+			continue
+		}
+
+		switch lower := strings.ToLower(token); {
+		case lower == "ce" || lower == "ee":
+			v.Edition = lower
+		case isPrerelease(lower):
+			if v.Prerelease != "" {
+				v.Prerelease += "."
+			}
+			v.Prerelease += lower
+		default:
+			build = append(build, token)
+		}
+	}
+
+	if len(build) > 0 {
+		meta := strings.Join(build, "")
+		if v.Build != "" {
+			meta += "+" + v.Build
+		}
+		v.Build = meta
+	}
+
+	return nil
+}
+
+func isPrerelease(token string) bool {
+	for _, tag := range prereleaseTags {
+		if !strings.HasPrefix(token, tag) {
+			continue
+		}
+		rest := token[len(tag):]
+		if rest == "" || rest[0] == '.' || (rest[0] >= '0' && rest[0] <= '9') {
+			return true
+		}
+	}
+	return false
+}
+
+// MustParse is like Parse but panics on error. It is intended for constants.
+func MustParse(s string) Version {
+	v, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Compare returns -1 if v < other, 1 if v > other and 0 if they are
+// equivalent.
+//
+// Missing release segments are treated as zero, so "1.12" equals "1.12.0". A
+// version with a pre-release sorts before the same release without one, and
+// pre-release identifiers are ordered as in semantic versioning with letter
+// and digit runs split apart, so "rc1" equals "rc.1" and "rc2" precedes
+// "rc10". Edition and build metadata are ignored.
+func (v Version) Compare(other Version) int {
+	max := len(v.Segments)
+	if len(other.Segments) > max {
+		max = len(other.Segments)
+	}
+	for i := 0; i < max; i++ {
+		var a, b int
+		if i < len(v.Segments) {
+			a = v.Segments[i]
+		}
+		if i < len(other.Segments) {
+			b = other.Segments[i]
+		}
+		if a != b {
+			return cmpInt(a, b)
+		}
+	}
+
+	switch {
+	case v.Prerelease == "" && other.Prerelease == "":
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case other.Prerelease == "":
+		return -1
+	}
+
+	return comparePrerelease(v.Prerelease, other.Prerelease)
+}
+
+// Release returns v without its pre-release, edition and build metadata, so
+// that "1.12.0-rc2" can be compared as the 1.12.0 release it precedes.
+func (v Version) Release() Version {
+	return Version{Segments: v.Segments}
+}
+
+// String returns the normalized form of the version, without the epoch.
+func (v Version) String() string {
+	segs := make([]string, len(v.Segments))
+	for i, n := range v.Segments {
+		segs[i] = strconv.Itoa(n)
+	}
+	s := strings.Join(segs, ".")
+	if v.Edition != "" {
+		s += "-" + v.Edition
+	}
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Major returns the first release segment.
+func (v Version) Major() int { return v.segment(0) }
+
+// Minor returns the second release segment, or 0 if absent.
+func (v Version) Minor() int { return v.segment(1) }
+
+// Patch returns the third release segment, or 0 if absent.
+func (v Version) Patch() int { return v.segment(2) }
+
+func (v Version) segment(i int) int {
+	if i < len(v.Segments) {
+		return v.Segments[i]
+	}
+	return 0
+}
+
+// Compare parses both arguments and compares them. Unlike LessThan and
+// friends, it reports unparseable input as an error instead of guessing.
+func Compare(v1, v2 string) (int, error) {
+	a, err := Parse(v1)
+	if err != nil {
+		return 0, err
+	}
+	b, err := Parse(v2)
+	if err != nil {
+		return 0, err
+	}
+	return a.Compare(b), nil
+}
+
+func comparePrerelease(p1, p2 string) int {
+	ids1 := prereleaseIdentifiers(p1)
+	ids2 := prereleaseIdentifiers(p2)
+
+	for i := 0; i < len(ids1) && i < len(ids2); i++ {
+		a, b := ids1[i], ids2[i]
+		an, aErr := strconv.Atoi(a)
+		bn, bErr := strconv.Atoi(b)
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				return cmpInt(an, bn)
+			}
+		case aErr == nil:
+			// Numeric identifiers have lower precedence than
+			// alphanumeric ones.
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(a, b); c != 0 {
+				return c
+			}
+		}
+	}
+
+	return cmpInt(len(ids1), len(ids2))
+}
+
+// prereleaseIdentifiers splits "rc.1", "rc1" and "beta-2" alike into
+// ["rc", "1"] style identifiers.
+func prereleaseIdentifiers(p string) []string {
+	var (
+		ids  []string
+		curr []rune
+		kind int
+	)
+
+	flush := func() {
+		if len(curr) > 0 {
+			ids = append(ids, string(curr))
+			curr = curr[:0]
+		}
+	}
+
+	for _, r := range p {
+		var k int
+		switch {
+		case unicode.IsDigit(r):
+			k = 1
+		case unicode.IsLetter(r):
+			k = 2
+		default:
+			flush()
+			kind = 0
+			continue
+		}
+		if k != kind {
+			flush()
+			kind = k
+		}
+		curr = append(curr, r)
+	}
+	flush()
+
+	return ids
+}
+
+func cmpInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
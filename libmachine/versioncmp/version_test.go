@@ -0,0 +1,194 @@
+package versioncmp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		in   string
+		want Version
+	}{
+		{"24.0.7", Version{Segments: []int{24, 0, 7}}},
+		{"v24.0.7", Version{Segments: []int{24, 0, 7}}},
+		{" 24.0.7\n", Version{Segments: []int{24, 0, 7}}},
+		{"20.10.24.1", Version{Segments: []int{20, 10, 24, 1}}},
+		{"1.12", Version{Segments: []int{1, 12}}},
+		{"1.13.0-rc1", Version{Segments: []int{1, 13, 0}, Prerelease: "rc1"}},
+		{"24.0.7-rc.1", Version{Segments: []int{24, 0, 7}, Prerelease: "rc.1"}},
+		{"25.0.0-beta.3", Version{Segments: []int{25, 0, 0}, Prerelease: "beta.3"}},
+		{"17.03.0-ce", Version{Segments: []int{17, 3, 0}, Edition: "ce"}},
+		{"17.03.0-ce-rc2", Version{Segments: []int{17, 3, 0}, Edition: "ce", Prerelease: "rc2"}},
+		{"18.09.1-ee", Version{Segments: []int{18, 9, 1}, Edition: "ee"}},
+		{"24.0.7~ubuntu.22.04", Version{Segments: []int{24, 0, 7}, Build: "ubuntu.22.04"}},
+		// apt-cache madison docker-ce
+		{"5:24.0.7-1~ubuntu.22.04~jammy", Version{Segments: []int{24, 0, 7}, Build: "1~ubuntu.22.04~jammy"}},
+		{"5:24.0.0~rc.1-1~debian.12~bookworm", Version{Segments: []int{24, 0, 0}, Prerelease: "rc.1", Build: "1~debian.12~bookworm"}},
+		{"18.06.3~ce~3-0~ubuntu", Version{Segments: []int{18, 6, 3}, Edition: "ce", Build: "3-0~ubuntu"}},
+		// yum list docker-ce --showduplicates
+		{"3:24.0.7-1.el9", Version{Segments: []int{24, 0, 7}, Build: "1.el9"}},
+		{"1.13.1-209.git7d71120.el7.centos", Version{Segments: []int{1, 13, 1}, Build: "209.git7d71120.el7.centos"}},
+		{"17.03.2.ce-1.el7.centos", Version{Segments: []int{17, 3, 2}, Edition: "ce", Build: "1.el7.centos"}},
+		// Debian/Ubuntu distro packages
+		{"20.10.24+dfsg1", Version{Segments: []int{20, 10, 24}, Build: "dfsg1"}},
+		{"24.0.5-0ubuntu1~22.04.1", Version{Segments: []int{24, 0, 5}, Build: "0ubuntu1~22.04.1"}},
+		{"1.05.00.0156", Version{Segments: []int{1, 5, 0, 156}}},
+		// Distro tokens that start like a pre-release tag
+		{"24.0.7~precise", Version{Segments: []int{24, 0, 7}, Build: "precise"}},
+		{"24.0.7-devel", Version{Segments: []int{24, 0, 7}, Build: "devel"}},
+		{"24.0.7-devuan1", Version{Segments: []int{24, 0, 7}, Build: "devuan1"}},
+		{"24.0.7-rcs", Version{Segments: []int{24, 0, 7}, Build: "rcs"}},
+		{"24.0.7-dev", Version{Segments: []int{24, 0, 7}, Prerelease: "dev"}},
+		{"24.0.7-tp5", Version{Segments: []int{24, 0, 7}, Prerelease: "tp5"}},
+	}
+
+	for _, tc := range cases {
+		got, err := Parse(tc.in)
+		if err != nil {
+			t.Errorf("Parse(%q) returned error: %s", tc.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Parse(%q) == %+v, want %+v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"   ",
+		"latest",
+		"1.a",
+		"1..2",
+		"x:24.0.7",
+		"24.0.7-",
+		"24.0.7--rc1",
+		"-rc1",
+	} {
+		if v, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) == %+v, want error", in, v)
+		} else if _, ok := err.(*ParseError); !ok {
+			t.Errorf("Parse(%q) returned %T, want *ParseError", in, err)
+		}
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	cases := []struct {
+		v1, v2 string
+		want   int
+	}{
+		{"24.0.7", "24.0.7", 0},
+		{"24.0.7", "24.0.6", 1},
+		{"24.0.7", "24.0.10", -1},
+		{"24.0", "24.0.0", 0},
+		{"20.10.24.1", "20.10.24", 1},
+		{"20.10.24.1", "20.10.24.2", -1},
+		{"20.10.24.0", "20.10.24", 0},
+
+		// Pre-releases sort before the release.
+		{"24.0.7-rc.1", "24.0.7", -1},
+		{"24.0.7", "24.0.7-rc.1", 1},
+		{"24.0.7-rc.1", "24.0.6", 1},
+		{"24.0.7-rc.1", "24.0.7-rc.2", -1},
+		{"24.0.7-rc.2", "24.0.7-rc.10", -1},
+		{"24.0.7-rc1", "24.0.7-rc.1", 0},
+		{"24.0.7-beta.1", "24.0.7-rc.1", -1},
+		{"24.0.7-alpha", "24.0.7-alpha.1", -1},
+		{"5:24.0.0~rc.1-1~debian.12~bookworm", "24.0.0", -1},
+
+		// Editions and packaging metadata are ignored.
+		{"17.03.0-ce", "17.03.0", 0},
+		{"17.03.0-ce", "17.03.0-ee", 0},
+		{"17.03.0-ce-rc1", "17.03.0-ce", -1},
+		{"24.0.7~ubuntu.22.04", "24.0.7", 0},
+		{"5:24.0.7-1~ubuntu.22.04~jammy", "24.0.7", 0},
+		{"5:24.0.7-1~ubuntu.22.04~jammy", "5:24.0.6-1~ubuntu.22.04~jammy", 1},
+		{"3:24.0.7-1.el9", "24.0.7", 0},
+		{"20.10.24+dfsg1", "20.10.24", 0},
+		{"24.0.5-0ubuntu1~22.04.1", "24.0.7", -1},
+		{"1.13.1-209.git7d71120.el7.centos", "1.13.1", 0},
+		{"24.0.7~precise", "24.0.7", 0},
+		{"24.0.7-devel", "24.0.7", 0},
+		{"24.0.7-devuan1", "24.0.7", 0},
+
+		// CE scheme releases are newer than every pre-CE release.
+		{"17.03.0-ce", "1.13.1", 1},
+		{"1.13.1", "17.03.0-ce-rc1", -1},
+	}
+
+	for _, tc := range cases {
+		got, err := Compare(tc.v1, tc.v2)
+		if err != nil {
+			t.Errorf("Compare(%q, %q) returned error: %s", tc.v1, tc.v2, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("Compare(%q, %q) == %d, want %d", tc.v1, tc.v2, got, tc.want)
+		}
+	}
+}
+
+func TestCompareInvalid(t *testing.T) {
+	cases := []struct {
+		v1, v2 string
+	}{
+		{"1.a", "1.b"},
+		{"24.0.7", "latest"},
+		{"", "24.0.7"},
+	}
+
+	for _, tc := range cases {
+		if got, err := Compare(tc.v1, tc.v2); err == nil {
+			t.Errorf("Compare(%q, %q) == %d, want error", tc.v1, tc.v2, got)
+		}
+	}
+}
+
+func TestVersionString(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"24.0.7", "24.0.7"},
+		{"v1.13.0-rc1", "1.13.0-rc1"},
+		{"17.03.0-ce-rc2", "17.3.0-ce-rc2"},
+		{"5:24.0.7-1~ubuntu.22.04~jammy", "24.0.7+1~ubuntu.22.04~jammy"},
+	}
+
+	for _, tc := range cases {
+		if got := MustParse(tc.in).String(); got != tc.want {
+			t.Errorf("Parse(%q).String() == %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestVersionRelease(t *testing.T) {
+	v := MustParse("1.12.0-rc1")
+	if got := v.Release().Compare(MustParse("1.12.0")); got != 0 {
+		t.Errorf("Parse(\"1.12.0-rc1\").Release().Compare(1.12.0) == %d, want 0", got)
+	}
+	if got := v.Compare(MustParse("1.12.0")); got != -1 {
+		t.Errorf("Parse(\"1.12.0-rc1\").Compare(1.12.0) == %d, want -1", got)
+	}
+}
+
+func TestVersionAccessors(t *testing.T) {
+	v := MustParse("24.0")
+	if v.Major() != 24 || v.Minor() != 0 || v.Patch() != 0 {
+		t.Errorf("unexpected components for %q: %d.%d.%d", v, v.Major(), v.Minor(), v.Patch())
+	}
+}
+
+func TestLegacyWrappersPrerelease(t *testing.T) {
+	if !LessThan("24.0.7-rc.1", "24.0.7") {
+		t.Error("LessThan(\"24.0.7-rc.1\", \"24.0.7\") == false, want true")
+	}
+	if !Equal("5:24.0.7-1~ubuntu.22.04~jammy", "24.0.7") {
+		t.Error("Equal(\"5:24.0.7-1~ubuntu.22.04~jammy\", \"24.0.7\") == false, want true")
+	}
+	if !GreaterThan("20.10.24.1", "20.10.24") {
+		t.Error("GreaterThan(\"20.10.24.1\", \"20.10.24\") == false, want true")
+	}
+}